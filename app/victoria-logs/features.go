@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+)
+
+// featuresResponse is the response for /api/v1/status/features.
+type featuresResponse struct {
+	Version string              `json:"version"`
+	Insert  *vlinsert.Features  `json:"insert"`
+	Select  *vlselect.Features  `json:"select"`
+	Storage *vlstorage.Features `json:"storage"`
+}
+
+// processFeaturesRequest returns capabilities enabled at the current VictoriaLogs instance.
+//
+// See https://docs.victoriametrics.com/victorialogs/#status-features
+func processFeaturesRequest(w http.ResponseWriter) {
+	featuresRequests.Inc()
+
+	resp := &featuresResponse{
+		Version: buildinfo.Version,
+		Insert:  vlinsert.GetFeatures(),
+		Select:  vlselect.GetFeatures(),
+		Storage: vlstorage.GetFeatures(),
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal features response: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+var featuresRequests = metrics.NewCounter(`vl_http_requests_total{path="/api/v1/status/features"}`)
@@ -26,6 +26,9 @@ var (
 	useProxyProtocol = flagutil.NewArrayBool("httpListenAddr.useProxyProtocol", "Whether to use proxy protocol for connections accepted at the given -httpListenAddr . "+
 		"See https://www.haproxy.org/download/1.8/doc/proxy-protocol.txt . "+
 		"With enabled proxy protocol http server cannot serve regular /metrics endpoint. Use -pushmetrics.url for metrics pushing")
+	configCheck = flag.Bool("configCheck", false, "Whether to verify command-line flags and config files, to check -storageDataPath and -storage.extraDataPaths "+
+		"for write permissions and free disk space, and then exit without starting VictoriaLogs. The exit code is non-zero if errors are found. "+
+		"See https://docs.victoriametrics.com/victorialogs/#config-check")
 )
 
 func main() {
@@ -36,6 +39,11 @@ func main() {
 	buildinfo.Init()
 	logger.Init()
 
+	if *configCheck {
+		mustCheckConfig()
+		return
+	}
+
 	listenAddrs := *httpListenAddrs
 	if len(listenAddrs) == 0 {
 		listenAddrs = []string{":9428"}
@@ -52,6 +60,7 @@ func main() {
 	go httpserver.Serve(listenAddrs, requestHandler, httpserver.ServeOptions{
 		UseProxyProtocol: useProxyProtocol,
 	})
+	vlstorage.MustStartHTTP2Server(requestHandler)
 	logger.Infof("started VictoriaLogs in %.3f seconds; see https://docs.victoriametrics.com/victorialogs/", time.Since(startTime).Seconds())
 
 	pushmetrics.Init()
@@ -65,6 +74,7 @@ func main() {
 		logger.Fatalf("cannot stop the webservice: %s", err)
 	}
 	logger.Infof("successfully shut down the webservice in %.3f seconds", time.Since(startTime).Seconds())
+	vlstorage.MustStopHTTP2Server()
 
 	vlinsert.Stop()
 	vlselect.Stop()
@@ -73,6 +83,33 @@ func main() {
 	logger.Infof("the VictoriaLogs has been stopped in %.3f seconds", time.Since(startTime).Seconds())
 }
 
+// mustCheckConfig verifies the configuration for all the VictoriaLogs components without starting them.
+//
+// It exits with non-zero code if errors are found.
+func mustCheckConfig() {
+	checks := []struct {
+		name  string
+		check func() error
+	}{
+		{"storage", vlstorage.CheckConfig},
+		{"select", vlselect.CheckConfig},
+		{"insert", vlinsert.CheckConfig},
+	}
+	failed := 0
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			failed++
+			logger.Errorf("%s config check failed: %s", c.name, err)
+			continue
+		}
+		logger.Infof("%s config check passed", c.name)
+	}
+	if failed > 0 {
+		logger.Fatalf("found errors in %d out of %d config checks", failed, len(checks))
+	}
+	logger.Infof("all the config checks passed")
+}
+
 func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 	if r.URL.Path == "/" {
 		if r.Method != http.MethodGet {
@@ -87,9 +124,19 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 			{"select/vmui", "Web UI for VictoriaLogs"},
 			{"metrics", "available service metrics"},
 			{"flags", "command-line flags"},
+			{"api/v1/status/features", "enabled capabilities"},
+			{"api/v1/status/config", "effective configuration"},
 		})
 		return true
 	}
+	if r.URL.Path == "/api/v1/status/features" {
+		processFeaturesRequest(w)
+		return true
+	}
+	if r.URL.Path == "/api/v1/status/config" {
+		processStatusConfigRequest(w, r)
+		return true
+	}
 	if vlinsert.RequestHandler(w, r) {
 		return true
 	}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var statusConfigAuthKey = flagutil.NewPassword("statusConfigAuthKey", "authKey, which must be passed in query string to /api/v1/status/config . It overrides -httpAuth.* . "+
+	"See https://docs.victoriametrics.com/victorialogs/#status-config")
+
+// configFlag is a command-line flag with its effective value.
+type configFlag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	IsSet bool   `json:"is_set"`
+}
+
+// statusConfigResponse is the response for /api/v1/status/config.
+type statusConfigResponse struct {
+	Version      string        `json:"version"`
+	Hash         string        `json:"hash"`
+	Flags        []*configFlag `json:"flags"`
+	ScrapeConfig string        `json:"scrape_config"`
+}
+
+// processStatusConfigRequest returns the effective configuration of the current VictoriaLogs instance with redacted secrets.
+//
+// See https://docs.victoriametrics.com/victorialogs/#status-config
+func processStatusConfigRequest(w http.ResponseWriter, r *http.Request) {
+	statusConfigRequests.Inc()
+
+	if !httpserver.CheckAuthFlag(w, r, statusConfigAuthKey) {
+		return
+	}
+
+	flags := getConfigFlags()
+	hash := getConfigHash(flags)
+
+	// Allow cheap change detection via If-None-Match request header.
+	etag := `"` + hash + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	target := r.Host
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	switch format := r.FormValue("format"); format {
+	case "", "json":
+		resp := &statusConfigResponse{
+			Version:      buildinfo.Version,
+			Hash:         hash,
+			Flags:        flags,
+			ScrapeConfig: getScrapeConfig(target, scheme),
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			logger.Panicf("BUG: cannot marshal status config response: %s", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case "scrape_config":
+		w.Header().Set("Content-Type", "application/yaml")
+		fmt.Fprintf(w, "%s", getScrapeConfig(target, scheme))
+	case "http_sd":
+		data := getHTTPSDConfig(target, scheme)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		httpserver.Errorf(w, r, "unsupported format=%q; supported values: json, scrape_config, http_sd", format)
+	}
+}
+
+// getConfigFlags returns all the command-line flags with their effective values.
+//
+// The values of secret flags are replaced with `secret`.
+func getConfigFlags() []*configFlag {
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	var flags []*configFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if flagutil.IsSecretFlag(strings.ToLower(f.Name)) {
+			value = "secret"
+		}
+		flags = append(flags, &configFlag{
+			Name:  f.Name,
+			Value: value,
+			IsSet: setFlags[f.Name],
+		})
+	})
+	return flags
+}
+
+// getConfigHash returns a hash for the given flags.
+//
+// The hash changes whenever the value of some non-secret flag changes, so it can be used for detecting config drift across multiple instances.
+func getConfigHash(flags []*configFlag) string {
+	h := sha256.New()
+	for _, f := range flags {
+		fmt.Fprintf(h, "-%s=%q\n", f.Name, f.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// getScrapeConfig returns Prometheus scrape config for scraping /metrics from the given target.
+func getScrapeConfig(target, scheme string) string {
+	var sb strings.Builder
+	sb.WriteString("scrape_configs:\n")
+	sb.WriteString("- job_name: victorialogs\n")
+	fmt.Fprintf(&sb, "  scheme: %s\n", scheme)
+	fmt.Fprintf(&sb, "  metrics_path: %q\n", getMetricsPath())
+	sb.WriteString("  static_configs:\n")
+	fmt.Fprintf(&sb, "  - targets: [%q]\n", target)
+	return sb.String()
+}
+
+// getHTTPSDConfig returns Prometheus HTTP service discovery response for the given target.
+//
+// See https://prometheus.io/docs/prometheus/latest/http_sd/
+func getHTTPSDConfig(target, scheme string) []byte {
+	sd := []map[string]any{
+		{
+			"targets": []string{target},
+			"labels": map[string]string{
+				"__scheme__":       scheme,
+				"__metrics_path__": getMetricsPath(),
+			},
+		},
+	}
+	data, err := json.Marshal(sd)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal http_sd response: %s", err)
+	}
+	return data
+}
+
+func getMetricsPath() string {
+	prefix := ""
+	if f := flag.Lookup("http.pathPrefix"); f != nil {
+		prefix = strings.TrimSuffix(f.Value.String(), "/")
+	}
+	return prefix + "/metrics"
+}
+
+var statusConfigRequests = metrics.NewCounter(`vl_http_requests_total{path="/api/v1/status/config"}`)
@@ -10,7 +10,6 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastjson"
 
@@ -79,16 +78,25 @@ func datadogLogsIngestion(w http.ResponseWriter, r *http.Request) bool {
 	}
 
 	encoding := r.Header.Get("Content-Encoding")
-	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
+	im := cp.GetIngestionMetrics("datadog")
+	err = insertutil.ReadUncompressedData("datadog", im.NewReceivedBytesReader(r.Body), encoding, maxRequestSize, func(data []byte) error {
+		im.AddUncompressedBytes(len(data))
 		lmp := cp.NewLogMessageProcessor("datadog", false)
 		err := readLogsRequest(ts, data, lmp)
 		lmp.MustClose()
+		if err != nil {
+			im.AddParseErrors(1)
+		}
 		return err
 	})
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot read DataDog protocol data: %s", err)
 		return true
 	}
+	if drr := cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return true
+	}
 
 	// update v2LogsRequestDuration only for successfully parsed requests
 	// There is no need in updating v2LogsRequestDuration for request errors,
@@ -30,14 +30,40 @@ func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
 	// This header is needed for Logstash
 	w.Header().Set("X-Elastic-Product", "Elasticsearch")
 
-	if strings.HasPrefix(path, "/insert/elasticsearch/_ilm/policy") {
-		// Return fake response for Elasticsearch ilm request.
-		fmt.Fprintf(w, `{}`)
+	if strings.HasPrefix(path, "/insert/elasticsearch/_ilm/") {
+		// Return fake response for Elasticsearch ILM requests.
+		// See: https://www.elastic.co/guide/en/elasticsearch/reference/8.8/index-lifecycle-management-api.html
+		writeNoopResponse(w, r)
 		return true
 	}
-	if strings.HasPrefix(path, "/insert/elasticsearch/_index_template") {
-		// Return fake response for Elasticsearch index template request.
-		fmt.Fprintf(w, `{}`)
+	if strings.HasPrefix(path, "/insert/elasticsearch/_index_template") ||
+		strings.HasPrefix(path, "/insert/elasticsearch/_component_template") ||
+		strings.HasPrefix(path, "/insert/elasticsearch/_template") {
+		// Return fake response for Elasticsearch index template requests.
+		// See: https://www.elastic.co/guide/en/elasticsearch/reference/8.8/index-templates.html
+		writeNoopResponse(w, r)
+		return true
+	}
+	if strings.HasPrefix(path, "/insert/elasticsearch/_data_stream") {
+		// Return fake response for Elasticsearch data stream requests.
+		// Logs are written to data streams via /_bulk, so there is no need in creating data streams in advance.
+		// See: https://www.elastic.co/guide/en/elasticsearch/reference/8.8/data-stream-apis.html
+		writeNoopResponse(w, r)
+		return true
+	}
+	if strings.HasPrefix(path, "/insert/elasticsearch/_xpack") {
+		// Return fake response for Elasticsearch X-Pack info request, which is used by Beats and Elastic Agent.
+		// See: https://www.elastic.co/guide/en/elasticsearch/reference/8.8/info-api.html
+		fmt.Fprintf(w, `{
+			"build": {},
+			"license": {
+				"uid": "cbff45e7-c553-41f7-ae4f-9205eabd80xx",
+				"type": "oss",
+				"mode": "oss",
+				"status": "active"
+			},
+			"features": {}
+		}`)
 		return true
 	}
 	if strings.HasPrefix(path, "/insert/elasticsearch/_ingest") {
@@ -107,15 +133,22 @@ func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		lmp := cp.NewLogMessageProcessor("elasticsearch_bulk", true)
+		im := cp.GetIngestionMetrics("elasticsearch_bulk")
 		encoding := r.Header.Get("Content-Encoding")
 		streamName := fmt.Sprintf("remoteAddr=%s, requestURI=%q", httpserver.GetQuotedRemoteAddr(r), r.RequestURI)
-		n, err := readBulkRequest(streamName, r.Body, encoding, cp.TimeFields, cp.MsgFields, lmp)
+		n, err := readBulkRequest(streamName, im.NewReceivedBytesReader(r.Body), encoding, cp.TimeFields, cp.MsgFields, lmp, im)
 		lmp.MustClose()
 		if err != nil {
+			im.AddParseErrors(1)
 			httpserver.Errorf(w, r, "cannot decode log message #%d in /_bulk request: %s, stream fields: %s", n, err, cp.StreamFields)
 			return true
 		}
 
+		if drr := cp.DryRun; drr != nil {
+			drr.WriteResponse(w)
+			return true
+		}
+
 		tookMs := time.Since(startTime).Milliseconds()
 		bw := bufferedwriter.Get(w)
 		defer bufferedwriter.Put(bw)
@@ -133,12 +166,27 @@ func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
 	}
 }
 
+// writeNoopResponse writes fake successful response for Elasticsearch management APIs,
+// which aren't needed for data ingestion into VictoriaLogs.
+//
+// Requests for reading the managed objects get an empty object, while requests for changing them are acknowledged.
+func writeNoopResponse(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		fmt.Fprintf(w, `{}`)
+	case http.MethodHead:
+		// Return empty response for existence check requests.
+	default:
+		fmt.Fprintf(w, `{"acknowledged":true}`)
+	}
+}
+
 var (
 	bulkRequestsTotal   = metrics.NewCounter(`vl_http_requests_total{path="/insert/elasticsearch/_bulk"}`)
 	bulkRequestDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/insert/elasticsearch/_bulk"}`)
 )
 
-func readBulkRequest(streamName string, r io.Reader, encoding string, timeFields, msgFields []string, lmp insertutil.LogMessageProcessor) (int, error) {
+func readBulkRequest(streamName string, r io.Reader, encoding string, timeFields, msgFields []string, lmp insertutil.LogMessageProcessor, im *insertutil.IngestionMetrics) (int, error) {
 	// See https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
 
 	reader, err := protoparserutil.GetUncompressedReader(r, encoding)
@@ -147,7 +195,7 @@ func readBulkRequest(streamName string, r io.Reader, encoding string, timeFields
 	}
 	defer protoparserutil.PutUncompressedReader(reader)
 
-	wcr := writeconcurrencylimiter.GetReader(reader)
+	wcr := writeconcurrencylimiter.GetReader(im.NewUncompressedBytesReader(reader))
 	defer writeconcurrencylimiter.PutReader(wcr)
 
 	lr := insertutil.NewLineReader(streamName, wcr)
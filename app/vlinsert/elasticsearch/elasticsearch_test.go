@@ -2,8 +2,11 @@ package elasticsearch
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/golang/snappy"
@@ -12,15 +15,64 @@ import (
 	"github.com/klauspost/compress/zstd"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
+var testIngestionMetrics = insertutil.GetIngestionMetrics("test", logstorage.TenantID{})
+
+func TestRequestHandlerNoop(t *testing.T) {
+	f := func(method, path, responseExpected string) {
+		t.Helper()
+
+		r := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		if !RequestHandler(path, w, r) {
+			t.Fatalf("unexpected unhandled request %s %s", method, path)
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status code for %s %s; got %d; want %d", method, path, w.Code, http.StatusOK)
+		}
+		if response := w.Body.String(); response != responseExpected {
+			t.Fatalf("unexpected response for %s %s;\ngot\n%s\nwant\n%s", method, path, response, responseExpected)
+		}
+	}
+
+	f(http.MethodGet, "/insert/elasticsearch/_ilm/policy/filebeat", `{}`)
+	f(http.MethodHead, "/insert/elasticsearch/_ilm/policy/filebeat", ``)
+	f(http.MethodPut, "/insert/elasticsearch/_ilm/policy/filebeat", `{"acknowledged":true}`)
+	f(http.MethodGet, "/insert/elasticsearch/_index_template/logs", `{}`)
+	f(http.MethodPut, "/insert/elasticsearch/_index_template/logs", `{"acknowledged":true}`)
+	f(http.MethodPut, "/insert/elasticsearch/_component_template/logs-mappings", `{"acknowledged":true}`)
+	f(http.MethodHead, "/insert/elasticsearch/_template/filebeat-8.9.0", ``)
+	f(http.MethodGet, "/insert/elasticsearch/_data_stream/logs-generic-default", `{}`)
+	f(http.MethodPut, "/insert/elasticsearch/_data_stream/logs-generic-default", `{"acknowledged":true}`)
+
+	// Verify that the X-Pack info response is a valid JSON with the license
+	r := httptest.NewRequest(http.MethodGet, "/insert/elasticsearch/_xpack", nil)
+	w := httptest.NewRecorder()
+	if !RequestHandler("/insert/elasticsearch/_xpack", w, r) {
+		t.Fatalf("unexpected unhandled request for /_xpack")
+	}
+	var resp struct {
+		License struct {
+			Status string `json:"status"`
+		} `json:"license"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot parse /_xpack response: %s", err)
+	}
+	if resp.License.Status != "active" {
+		t.Fatalf("unexpected license status in /_xpack response; got %q; want %q", resp.License.Status, "active")
+	}
+}
+
 func TestReadBulkRequest_Failure(t *testing.T) {
 	f := func(data string) {
 		t.Helper()
 
 		tlp := &insertutil.TestLogMessageProcessor{}
 		r := bytes.NewBufferString(data)
-		rows, err := readBulkRequest("test", r, "", []string{"_time"}, []string{"_msg"}, tlp)
+		rows, err := readBulkRequest("test", r, "", []string{"_time"}, []string{"_msg"}, tlp, testIngestionMetrics)
 		if err == nil {
 			t.Fatalf("expecting non-empty error")
 		}
@@ -47,7 +99,7 @@ func TestReadBulkRequest_Success(t *testing.T) {
 
 		// Read the request without compression
 		r := bytes.NewBufferString(data)
-		rows, err := readBulkRequest("test", r, "", timeFields, msgFields, tlp)
+		rows, err := readBulkRequest("test", r, "", timeFields, msgFields, tlp, testIngestionMetrics)
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
@@ -64,7 +116,7 @@ func TestReadBulkRequest_Success(t *testing.T) {
 			data = compressData(data, encoding)
 		}
 		r = bytes.NewBufferString(data)
-		rows, err = readBulkRequest("test", r, encoding, timeFields, msgFields, tlp)
+		rows, err = readBulkRequest("test", r, encoding, timeFields, msgFields, tlp, testIngestionMetrics)
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
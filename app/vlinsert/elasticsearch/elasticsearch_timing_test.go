@@ -51,7 +51,7 @@ func benchmarkReadBulkRequest(b *testing.B, encoding string) {
 		r := &bytes.Reader{}
 		for pb.Next() {
 			r.Reset(dataBytes)
-			_, err := readBulkRequest("test", r, encoding, timeFields, msgFields, blp)
+			_, err := readBulkRequest("test", r, encoding, timeFields, msgFields, blp, testIngestionMetrics)
 			if err != nil {
 				panic(fmt.Errorf("unexpected error: %w", err))
 			}
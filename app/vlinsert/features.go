@@ -0,0 +1,72 @@
+package vlinsert
+
+import (
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/fluentforward"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/gelf"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/kafka"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/lumberjack"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/opentelemetry"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/syslog"
+)
+
+// httpProtocols contains data ingestion protocols served at /insert/* HTTP endpoints.
+var httpProtocols = []string{
+	"jsonline",
+	"native",
+	"elasticsearch",
+	"loki",
+	"opentelemetry",
+	"journald",
+	"datadog",
+	"splunk",
+	"pubsub",
+}
+
+// Features contains data ingestion capabilities of the current VictoriaLogs instance.
+type Features struct {
+	// HTTPEnabled is set to false when /insert/* HTTP endpoints are disabled via -insert.disable command-line flag.
+	HTTPEnabled bool `json:"http_enabled"`
+
+	// Protocols contains the names of the enabled data ingestion protocols.
+	Protocols []string `json:"protocols"`
+
+	// MaxLineSizeBytes is the value of -insert.maxLineSizeBytes command-line flag.
+	MaxLineSizeBytes int64 `json:"max_line_size_bytes"`
+
+	// MaxFieldsPerLine is the value of -insert.maxFieldsPerLine command-line flag.
+	MaxFieldsPerLine int `json:"max_fields_per_line"`
+}
+
+// GetFeatures returns data ingestion capabilities of the current VictoriaLogs instance.
+func GetFeatures() *Features {
+	protocols := []string{}
+	if !*disableInsert {
+		protocols = append(protocols, httpProtocols...)
+	}
+	if opentelemetry.IsGRPCEnabled() {
+		protocols = append(protocols, "opentelemetry_grpc")
+	}
+	if syslog.IsEnabled() {
+		protocols = append(protocols, "syslog")
+	}
+	if gelf.IsEnabled() {
+		protocols = append(protocols, "gelf")
+	}
+	if fluentforward.IsEnabled() {
+		protocols = append(protocols, "fluentforward")
+	}
+	if kafka.IsEnabled() {
+		protocols = append(protocols, "kafka")
+	}
+	if lumberjack.IsEnabled() {
+		protocols = append(protocols, "lumberjack")
+	}
+
+	return &Features{
+		HTTPEnabled:      !*disableInsert,
+		Protocols:        protocols,
+		MaxLineSizeBytes: insertutil.MaxLineSizeBytes.N,
+		MaxFieldsPerLine: *insertutil.MaxFieldsPerLine,
+	}
+}
@@ -0,0 +1,548 @@
+package fluentforward
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	listenAddrs = flagutil.NewArrayString("fluentd.listenAddr", "Comma-separated list of TCP addresses to listen to for logs sent via Fluentd forward protocol. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#fluentd-forward-protocol")
+
+	fluentdStreamFields = flagutil.NewArrayString("fluentd.streamFields", "Comma-separated list of fields to use as log stream fields for logs ingested via Fluentd forward protocol. "+
+		"By default the tag field is used. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#fluentd-forward-protocol")
+	fluentdIgnoreFields = flagutil.NewArrayString("fluentd.ignoreFields", "Comma-separated list of fields to ignore for logs ingested via Fluentd forward protocol. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#fluentd-forward-protocol")
+	fluentdMsgFields = flagutil.NewArrayString("fluentd.msgField", "Comma-separated list of fields to use as log message for logs ingested via Fluentd forward protocol. "+
+		"By default message and log fields are used. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#fluentd-forward-protocol")
+	fluentdTenantID = flag.String("fluentd.tenantID", "0:0", "TenantID for logs ingested via Fluentd forward protocol. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#fluentd-forward-protocol")
+
+	sharedKey = flagutil.NewPassword("fluentd.sharedKey", "Optional shared key for authenticating clients sending logs via Fluentd forward protocol. "+
+		"If set, then clients must perform the handshake with the same shared_key. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#fluentd-forward-protocol")
+	maxMessageSize = flagutil.NewBytes("fluentd.maxMessageSize", 64*1024*1024, "The maximum size in bytes of a single Fluentd forward protocol message after decompression")
+)
+
+// defaultStreamFields contains the log stream fields for logs ingested via Fluentd forward protocol if -fluentd.streamFields isn't set.
+var defaultStreamFields = []string{"tag"}
+
+// defaultMsgFields contains the log message fields for logs ingested via Fluentd forward protocol if -fluentd.msgField isn't set.
+//
+// The log field is set by fluent-bit tail input and by Docker fluentd logging driver.
+var defaultMsgFields = []string{"message", "log"}
+
+// MustInit starts accepting logs via Fluentd forward protocol at -fluentd.listenAddr.
+//
+// This function must be called after flag.Parse().
+//
+// MustStop() must be called in order to free up resources occupied by the initialized listeners.
+func MustInit() {
+	if workersStopCh != nil {
+		logger.Panicf("BUG: MustInit() called twice without MustStop() call")
+	}
+	workersStopCh = make(chan struct{})
+
+	if len(*listenAddrs) == 0 {
+		return
+	}
+	cp, err := getCommonParams()
+	if err != nil {
+		logger.Fatalf("cannot initialize Fluentd forward protocol listeners: %s", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Fatalf("cannot obtain hostname for Fluentd forward protocol handshake: %s", err)
+	}
+
+	for _, addr := range *listenAddrs {
+		workersWG.Add(1)
+		go func(addr string) {
+			runTCPListener(addr, cp, hostname)
+			workersWG.Done()
+		}(addr)
+	}
+}
+
+var (
+	workersWG     sync.WaitGroup
+	workersStopCh chan struct{}
+)
+
+// IsEnabled returns true if Fluentd forward protocol listeners are configured via -fluentd.listenAddr command-line flag.
+func IsEnabled() bool {
+	return len(*listenAddrs) > 0
+}
+
+// CheckConfig verifies -fluentd.* command-line flags without starting Fluentd forward protocol listeners.
+func CheckConfig() error {
+	if len(*listenAddrs) == 0 {
+		return nil
+	}
+	if _, err := getCommonParams(); err != nil {
+		return fmt.Errorf("invalid config for Fluentd forward protocol listeners: %w", err)
+	}
+	return nil
+}
+
+// MustStop stops Fluentd forward protocol listeners initialized via MustInit()
+func MustStop() {
+	close(workersStopCh)
+	workersWG.Wait()
+	workersStopCh = nil
+}
+
+func getCommonParams() (*insertutil.CommonParams, error) {
+	tenantID, err := logstorage.ParseTenantID(*fluentdTenantID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -fluentd.tenantID=%q: %w", *fluentdTenantID, err)
+	}
+	streamFields := *fluentdStreamFields
+	if len(streamFields) == 0 {
+		streamFields = defaultStreamFields
+	}
+	msgFields := *fluentdMsgFields
+	if len(msgFields) == 0 {
+		msgFields = defaultMsgFields
+	}
+	cp := &insertutil.CommonParams{
+		TenantID:     tenantID,
+		TimeFields:   []string{"_time"},
+		MsgFields:    msgFields,
+		StreamFields: streamFields,
+		IgnoreFields: *fluentdIgnoreFields,
+	}
+	return cp, nil
+}
+
+func runTCPListener(addr string, cp *insertutil.CommonParams, hostname string) {
+	ln, err := netutil.NewTCPListener("fluentd", addr, false, nil)
+	if err != nil {
+		logger.Fatalf("fluentd: cannot start TCP listener at %s: %s", addr, err)
+	}
+
+	doneCh := make(chan struct{})
+	go func() {
+		serveStreamListener(ln, cp, hostname)
+		close(doneCh)
+	}()
+
+	logger.Infof("started accepting logs via Fluentd forward protocol at -fluentd.listenAddr=%q", addr)
+	<-workersStopCh
+	if err := ln.Close(); err != nil {
+		logger.Fatalf("fluentd: cannot close TCP listener at %s: %s", addr, err)
+	}
+	<-doneCh
+	logger.Infof("finished accepting logs via Fluentd forward protocol at -fluentd.listenAddr=%q", addr)
+}
+
+func serveStreamListener(ln net.Listener, cp *insertutil.CommonParams, hostname string) {
+	var cm ingestserver.ConnsMap
+	cm.Init("fluentd")
+
+	var wg sync.WaitGroup
+	addr := ln.Addr()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) {
+				if ne.Temporary() {
+					logger.Errorf("fluentd: temporary error when listening for TCP addr %q: %s", addr, err)
+					time.Sleep(time.Second)
+					continue
+				}
+				if strings.Contains(err.Error(), "use of closed network connection") {
+					break
+				}
+				logger.Fatalf("fluentd: unrecoverable error when accepting TCP connections at %q: %s", addr, err)
+			}
+			logger.Fatalf("fluentd: unexpected error when accepting TCP connections at %q: %s", addr, err)
+		}
+		if !cm.Add(c) {
+			_ = c.Close()
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			if err := processConn(c, cp, hostname); err != nil {
+				errorsTotal.Inc()
+				logger.Errorf("fluentd: cannot process data from %s at %q: %s", c.RemoteAddr(), addr, err)
+			}
+
+			cm.Delete(c)
+			_ = c.Close()
+			wg.Done()
+		}()
+	}
+
+	cm.CloseAll(0)
+	wg.Wait()
+}
+
+var errorsTotal = metrics.NewCounter(`vl_errors_total{type="fluentd"}`)
+
+// processConn processes Fluentd forward protocol messages received via c.
+//
+// See https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1
+func processConn(c net.Conn, cp *insertutil.CommonParams, hostname string) error {
+	if err := insertutil.CanWriteData(); err != nil {
+		return err
+	}
+
+	im := cp.GetIngestionMetrics("fluentd")
+	mr := newMsgpackReader(im.NewUncompressedBytesReader(im.NewReceivedBytesReader(c)), maxMessageSize.IntN())
+
+	if key := sharedKey.Get(); key != "" {
+		if err := handshake(mr, c, hostname, key); err != nil {
+			return fmt.Errorf("cannot perform handshake: %w", err)
+		}
+	}
+
+	newLogMessageProcessor := func() insertutil.LogMessageProcessor {
+		return cp.NewLogMessageProcessor("fluentd", false)
+	}
+	err := processStreamInternal(mr, c, newLogMessageProcessor, cp.MsgFields)
+	if err != nil {
+		im.AddParseErrors(1)
+	}
+	return err
+}
+
+// processStreamInternal reads Fluentd forward protocol messages from mr until EOF.
+//
+// Every message is passed to a new LogMessageProcessor obtained via newLogMessageProcessor,
+// so the message logs are sent to the storage before sending the ack response to w.
+func processStreamInternal(mr *msgpackReader, w io.Writer, newLogMessageProcessor func() insertutil.LogMessageProcessor, msgFields []string) error {
+	var ackBuf []byte
+	n := 0
+	for {
+		if err := mr.hasMoreData(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("cannot read message #%d: %w", n, err)
+		}
+
+		mr.resetLimit()
+		v, err := mr.readValue()
+		if err != nil {
+			return fmt.Errorf("cannot read message #%d: %w", n, err)
+		}
+
+		lmp := newLogMessageProcessor()
+		chunk, err := processMessage(v, lmp, msgFields)
+		lmp.MustClose()
+		if err != nil {
+			return fmt.Errorf("cannot process message #%d: %w", n, err)
+		}
+
+		if chunk != "" {
+			// Send ack response to the client, which requested it via chunk option.
+			ackBuf = appendMsgpackMapHeader(ackBuf[:0], 1)
+			ackBuf = appendMsgpackString(ackBuf, "ack")
+			ackBuf = appendMsgpackString(ackBuf, chunk)
+			if _, err := w.Write(ackBuf); err != nil {
+				return fmt.Errorf("cannot send ack response for message #%d: %w", n, err)
+			}
+		}
+		n++
+	}
+}
+
+// processMessage passes logs from Fluentd forward protocol message v to lmp.
+//
+// It returns the chunk option if it is set in the message. The chunk must be sent back to the client in the ack response.
+func processMessage(v *msgpackValue, lmp insertutil.LogMessageProcessor, msgFields []string) (string, error) {
+	if v.typ != msgpackArray || len(v.items) < 2 {
+		return "", fmt.Errorf("unexpected message; want array with at least 2 items")
+	}
+	tagValue := v.items[0]
+	if !tagValue.isString() {
+		return "", fmt.Errorf("unexpected tag type; want string")
+	}
+	tag := bytesutil.ToUnsafeString(tagValue.s)
+
+	var option *msgpackValue
+	entries := v.items[1]
+	switch entries.typ {
+	case msgpackArray:
+		// Forward mode: [tag, [[time, record], ...], option]
+		if len(v.items) > 2 {
+			option = v.items[2]
+		}
+		for i, entry := range entries.items {
+			if err := processEntry(entry, tag, lmp, msgFields); err != nil {
+				return "", fmt.Errorf("cannot process entry #%d: %w", i, err)
+			}
+		}
+	case msgpackString, msgpackBinary:
+		// PackedForward and CompressedPackedForward modes: [tag, packed entries, option]
+		if len(v.items) > 2 {
+			option = v.items[2]
+		}
+		if err := processPackedEntries(entries.s, option, tag, lmp, msgFields); err != nil {
+			return "", err
+		}
+	default:
+		// Message mode: [tag, time, record, option]
+		if len(v.items) < 3 {
+			return "", fmt.Errorf("unexpected message; want [tag, time, record] array")
+		}
+		if len(v.items) > 3 {
+			option = v.items[3]
+		}
+		if err := processRecord(v.items[1], v.items[2], tag, lmp, msgFields); err != nil {
+			return "", err
+		}
+	}
+
+	if option == nil {
+		return "", nil
+	}
+	chunk := option.get("chunk")
+	if chunk == nil || !chunk.isString() {
+		return "", nil
+	}
+	return string(chunk.s), nil
+}
+
+func processPackedEntries(data []byte, option *msgpackValue, tag string, lmp insertutil.LogMessageProcessor, msgFields []string) error {
+	var r io.Reader = bytes.NewReader(data)
+	if option != nil {
+		if compressed := option.get("compressed"); compressed != nil && compressed.isString() {
+			compressMethod := string(compressed.s)
+			if compressMethod != "gzip" {
+				return fmt.Errorf("unsupported compressed option %q; supported value: gzip", compressMethod)
+			}
+			zr, err := protoparserutil.GetUncompressedReader(r, compressMethod)
+			if err != nil {
+				return fmt.Errorf("cannot decompress packed entries: %w", err)
+			}
+			defer protoparserutil.PutUncompressedReader(zr)
+			r = zr
+		}
+	}
+
+	mr := newMsgpackReader(r, maxMessageSize.IntN())
+	for i := 0; ; i++ {
+		entry, err := mr.readValue()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("cannot read packed entry #%d: %w", i, err)
+		}
+		if err := processEntry(entry, tag, lmp, msgFields); err != nil {
+			return fmt.Errorf("cannot process packed entry #%d: %w", i, err)
+		}
+	}
+}
+
+// processEntry processes [time, record] entry.
+func processEntry(entry *msgpackValue, tag string, lmp insertutil.LogMessageProcessor, msgFields []string) error {
+	if entry.typ != msgpackArray || len(entry.items) < 2 {
+		return fmt.Errorf("unexpected entry; want [time, record] array")
+	}
+	return processRecord(entry.items[0], entry.items[1], tag, lmp, msgFields)
+}
+
+func processRecord(timeValue, record *msgpackValue, tag string, lmp insertutil.LogMessageProcessor, msgFields []string) error {
+	ts, err := parseTime(timeValue)
+	if err != nil {
+		return err
+	}
+	if ts == 0 {
+		ts = time.Now().UnixNano()
+	}
+	if record.typ != msgpackMap {
+		return fmt.Errorf("unexpected record type; want map")
+	}
+
+	fields := []logstorage.Field{
+		{
+			Name:  "tag",
+			Value: tag,
+		},
+	}
+	fields, _ = appendRecordFields(fields, nil, "", record)
+	logstorage.RenameField(fields[1:], msgFields, "_msg")
+	lmp.AddRow(ts, fields, -1)
+	return nil
+}
+
+// appendRecordFields appends fields from record map to dst.
+//
+// Nested maps are flattened with dot-separated field names, while arrays are stored as JSON strings.
+func appendRecordFields(dst []logstorage.Field, buf []byte, prefix string, record *msgpackValue) ([]logstorage.Field, []byte) {
+	for i := 0; i < len(record.items); i += 2 {
+		k, v := record.items[i], record.items[i+1]
+		if v.typ == msgpackNil {
+			continue
+		}
+
+		var name string
+		if k.isString() {
+			name = bytesutil.ToUnsafeString(k.s)
+		} else {
+			bufLen := len(buf)
+			buf = k.appendString(buf)
+			name = bytesutil.ToUnsafeString(buf[bufLen:])
+		}
+		if prefix != "" {
+			bufLen := len(buf)
+			buf = append(buf, prefix...)
+			buf = append(buf, '.')
+			buf = append(buf, name...)
+			name = bytesutil.ToUnsafeString(buf[bufLen:])
+		}
+
+		if v.typ == msgpackMap {
+			dst, buf = appendRecordFields(dst, buf, name, v)
+			continue
+		}
+
+		var value string
+		if v.isString() {
+			value = bytesutil.ToUnsafeString(v.s)
+		} else {
+			bufLen := len(buf)
+			buf = v.appendString(buf)
+			value = bytesutil.ToUnsafeString(buf[bufLen:])
+		}
+		dst = append(dst, logstorage.Field{
+			Name:  name,
+			Value: value,
+		})
+	}
+	return dst, buf
+}
+
+// parseTime parses Fluentd event time from v and returns it in nanoseconds.
+//
+// The time can be either an integer number of seconds or EventTime ext type.
+// See https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1#eventtime-ext-format
+func parseTime(v *msgpackValue) (int64, error) {
+	switch v.typ {
+	case msgpackInt:
+		return v.i * 1e9, nil
+	case msgpackUint:
+		return int64(v.u) * 1e9, nil
+	case msgpackFloat:
+		return int64(v.f * 1e9), nil
+	case msgpackExt:
+		if v.extType != 0 || len(v.s) != 8 {
+			return 0, fmt.Errorf("unexpected EventTime; want ext type 0 with 8 bytes; got ext type %d with %d bytes", v.extType, len(v.s))
+		}
+		secs := binary.BigEndian.Uint32(v.s[:4])
+		nsecs := binary.BigEndian.Uint32(v.s[4:])
+		return int64(secs)*1e9 + int64(nsecs), nil
+	default:
+		return 0, fmt.Errorf("unexpected time type; want integer or EventTime")
+	}
+}
+
+// handshake performs Fluentd forward protocol handshake with the client for the given sharedKey.
+//
+// See https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1#handshake-messages
+func handshake(mr *msgpackReader, w io.Writer, hostname, sharedKey string) error {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return fmt.Errorf("cannot generate nonce: %w", err)
+	}
+
+	// Send HELO message: ["HELO", {"nonce": nonce, "auth": "", "keepalive": true}]
+	// The auth option is empty, since user authentication isn't supported.
+	var buf []byte
+	buf = appendMsgpackArrayHeader(buf, 2)
+	buf = appendMsgpackString(buf, "HELO")
+	buf = appendMsgpackMapHeader(buf, 3)
+	buf = appendMsgpackString(buf, "nonce")
+	buf = appendMsgpackBinary(buf, nonce[:])
+	buf = appendMsgpackString(buf, "auth")
+	buf = appendMsgpackString(buf, "")
+	buf = appendMsgpackString(buf, "keepalive")
+	buf = appendMsgpackBool(buf, true)
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("cannot send HELO message: %w", err)
+	}
+
+	// Read PING message: ["PING", client_hostname, shared_key_salt, sha512_hex(shared_key_salt + client_hostname + nonce + shared_key), username, password]
+	mr.resetLimit()
+	ping, err := mr.readValue()
+	if err != nil {
+		return fmt.Errorf("cannot read PING message: %w", err)
+	}
+	if ping.typ != msgpackArray || len(ping.items) < 4 {
+		return fmt.Errorf("unexpected PING message; want array with at least 4 items")
+	}
+	for _, item := range ping.items[:4] {
+		if !item.isString() {
+			return fmt.Errorf("unexpected PING message; want string items")
+		}
+	}
+	if string(ping.items[0].s) != "PING" {
+		return fmt.Errorf("unexpected message type %q; want PING", ping.items[0].s)
+	}
+	clientHostname := ping.items[1].s
+	salt := ping.items[2].s
+	digest := ping.items[3].s
+
+	digestExpected := getSharedKeyDigest(salt, clientHostname, nonce[:], sharedKey)
+	authResult := subtle.ConstantTimeCompare(digest, digestExpected) == 1
+
+	// Send PONG message: ["PONG", auth_result, reason, server_hostname, sha512_hex(shared_key_salt + server_hostname + nonce + shared_key)]
+	buf = appendMsgpackArrayHeader(buf[:0], 5)
+	buf = appendMsgpackString(buf, "PONG")
+	buf = appendMsgpackBool(buf, authResult)
+	if authResult {
+		buf = appendMsgpackString(buf, "")
+		buf = appendMsgpackString(buf, hostname)
+		buf = appendMsgpackString(buf, string(getSharedKeyDigest(salt, []byte(hostname), nonce[:], sharedKey)))
+	} else {
+		buf = appendMsgpackString(buf, "shared_key mismatch")
+		buf = appendMsgpackString(buf, "")
+		buf = appendMsgpackString(buf, "")
+	}
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("cannot send PONG message: %w", err)
+	}
+	if !authResult {
+		return fmt.Errorf("shared_key mismatch for client hostname %q", clientHostname)
+	}
+	return nil
+}
+
+func getSharedKeyDigest(salt, hostname, nonce []byte, sharedKey string) []byte {
+	h := sha512.New()
+	h.Write(salt)
+	h.Write(hostname)
+	h.Write(nonce)
+	h.Write([]byte(sharedKey))
+	return hex.AppendEncode(nil, h.Sum(nil))
+}
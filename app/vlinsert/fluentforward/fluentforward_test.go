@@ -0,0 +1,264 @@
+package fluentforward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+func appendTestUint32(dst []byte, n uint32) []byte {
+	dst = append(dst, 0xce)
+	return binary.BigEndian.AppendUint32(dst, n)
+}
+
+func appendTestEventTime(dst []byte, secs, nsecs uint32) []byte {
+	dst = append(dst, 0xd7, 0x00)
+	dst = binary.BigEndian.AppendUint32(dst, secs)
+	return binary.BigEndian.AppendUint32(dst, nsecs)
+}
+
+// appendTestRecord appends msgpack map with the given key-value pairs to dst.
+func appendTestRecord(dst []byte, kvs ...string) []byte {
+	dst = appendMsgpackMapHeader(dst, len(kvs)/2)
+	for _, s := range kvs {
+		dst = appendMsgpackString(dst, s)
+	}
+	return dst
+}
+
+func TestProcessStreamInternal_Success(t *testing.T) {
+	f := func(data []byte, timestampsExpected []int64, resultExpected, ackExpected string) {
+		t.Helper()
+
+		lmp := &insertutil.TestLogMessageProcessor{}
+		newLogMessageProcessor := func() insertutil.LogMessageProcessor {
+			return lmp
+		}
+		var ack bytes.Buffer
+		mr := newMsgpackReader(bytes.NewReader(data), len(data)+1)
+		if err := processStreamInternal(mr, &ack, newLogMessageProcessor, defaultMsgFields); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := lmp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ack.String() != ackExpected {
+			t.Fatalf("unexpected ack response; got %q; want %q", ack.String(), ackExpected)
+		}
+	}
+
+	// empty stream
+	f(nil, nil, "", "")
+
+	// Message mode with integer time
+	var data []byte
+	data = appendMsgpackArrayHeader(data, 3)
+	data = appendMsgpackString(data, "app.logs")
+	data = appendTestUint32(data, 1700000000)
+	data = appendTestRecord(data, "log", "hello", "level", "info")
+	f(data, []int64{1700000000000000000}, `{"tag":"app.logs","_msg":"hello","level":"info"}`, "")
+
+	// Message mode with EventTime, nested record and chunk option
+	data = appendMsgpackArrayHeader(data[:0], 4)
+	data = appendMsgpackString(data, "app")
+	data = appendTestEventTime(data, 1700000000, 123)
+	data = appendMsgpackMapHeader(data, 4)
+	data = appendMsgpackString(data, "message")
+	data = appendMsgpackString(data, "foo")
+	data = appendMsgpackString(data, "kubernetes")
+	data = appendTestRecord(data, "pod_name", "bar", "namespace", "baz")
+	data = appendMsgpackString(data, "tags")
+	data = append(data, 0x92, 0x01, 0xa1, 'x')
+	data = appendMsgpackString(data, "empty")
+	data = append(data, 0xc0)
+	data = appendTestRecord(data, "chunk", "abc")
+	f(data, []int64{1700000000000000123}, `{"tag":"app","_msg":"foo","kubernetes.pod_name":"bar","kubernetes.namespace":"baz","tags":"[1,\"x\"]"}`,
+		"\x81\xa3ack\xa3abc")
+
+	// Forward mode
+	data = appendMsgpackArrayHeader(data[:0], 2)
+	data = appendMsgpackString(data, "fwd")
+	data = appendMsgpackArrayHeader(data, 2)
+	data = appendMsgpackArrayHeader(data, 2)
+	data = appendTestUint32(data, 1700000001)
+	data = appendTestRecord(data, "message", "a")
+	data = appendMsgpackArrayHeader(data, 2)
+	data = appendTestEventTime(data, 1700000002, 0)
+	data = appendTestRecord(data, "message", "b")
+	f(data, []int64{1700000001000000000, 1700000002000000000}, `{"tag":"fwd","_msg":"a"}
+{"tag":"fwd","_msg":"b"}`, "")
+
+	// PackedForward mode followed by Message mode in the same stream
+	var entries []byte
+	entries = appendMsgpackArrayHeader(entries, 2)
+	entries = appendTestUint32(entries, 1700000003)
+	entries = appendTestRecord(entries, "log", "c")
+	entries = appendMsgpackArrayHeader(entries, 2)
+	entries = appendTestUint32(entries, 1700000004)
+	entries = appendTestRecord(entries, "log", "d")
+	data = appendMsgpackArrayHeader(data[:0], 3)
+	data = appendMsgpackString(data, "packed")
+	data = appendMsgpackBinary(data, entries)
+	data = appendTestRecord(data, "size", "2", "chunk", "p1")
+	data = appendMsgpackArrayHeader(data, 3)
+	data = appendMsgpackString(data, "msg")
+	data = appendTestUint32(data, 1700000005)
+	data = appendTestRecord(data, "log", "e")
+	f(data, []int64{1700000003000000000, 1700000004000000000, 1700000005000000000}, `{"tag":"packed","_msg":"c"}
+{"tag":"packed","_msg":"d"}
+{"tag":"msg","_msg":"e"}`, "\x81\xa3ack\xa2p1")
+
+	// CompressedPackedForward mode
+	var bb bytes.Buffer
+	zw := gzip.NewWriter(&bb)
+	if _, err := zw.Write(entries); err != nil {
+		t.Fatalf("cannot compress entries: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close gzip writer: %s", err)
+	}
+	data = appendMsgpackArrayHeader(data[:0], 3)
+	data = appendMsgpackString(data, "compressed")
+	data = appendMsgpackString(data, bb.String())
+	data = appendTestRecord(data, "compressed", "gzip")
+	f(data, []int64{1700000003000000000, 1700000004000000000}, `{"tag":"compressed","_msg":"c"}
+{"tag":"compressed","_msg":"d"}`, "")
+}
+
+func TestProcessStreamInternal_Failure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		newLogMessageProcessor := func() insertutil.LogMessageProcessor {
+			return &insertutil.TestLogMessageProcessor{}
+		}
+		var ack bytes.Buffer
+		mr := newMsgpackReader(bytes.NewReader(data), len(data)+1)
+		if err := processStreamInternal(mr, &ack, newLogMessageProcessor, defaultMsgFields); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// truncated message
+	f([]byte{0x93, 0xa1, 'a'})
+
+	// non-array message
+	f(appendTestRecord(nil, "foo", "bar"))
+
+	// missing record
+	var data []byte
+	data = appendMsgpackArrayHeader(data, 2)
+	data = appendMsgpackString(data, "tag")
+	data = appendTestUint32(data, 1700000000)
+	f(data)
+
+	// non-string tag
+	data = appendMsgpackArrayHeader(data[:0], 3)
+	data = appendTestUint32(data, 1)
+	data = appendTestUint32(data, 1700000000)
+	data = appendTestRecord(data, "foo", "bar")
+	f(data)
+
+	// invalid time
+	data = appendMsgpackArrayHeader(data[:0], 3)
+	data = appendMsgpackString(data, "tag")
+	data = appendMsgpackArrayHeader(data, 1)
+	data = appendMsgpackArrayHeader(data, 2)
+	data = appendMsgpackString(data, "foo")
+	data = appendTestRecord(data, "foo", "bar")
+	data = append(data, 0xc0)
+	f(data)
+
+	// non-map record
+	data = appendMsgpackArrayHeader(data[:0], 3)
+	data = appendMsgpackString(data, "tag")
+	data = appendTestUint32(data, 1700000000)
+	data = appendMsgpackString(data, "foo")
+	f(data)
+
+	// unsupported compression
+	data = appendMsgpackArrayHeader(data[:0], 3)
+	data = appendMsgpackString(data, "tag")
+	data = appendMsgpackBinary(data, []byte("foo"))
+	data = appendTestRecord(data, "compressed", "zstd")
+	f(data)
+}
+
+func TestHandshake(t *testing.T) {
+	f := func(clientSharedKey string, authResultExpected bool) {
+		t.Helper()
+
+		serverConn, clientConn := net.Pipe()
+		defer serverConn.Close()
+		defer clientConn.Close()
+
+		errCh := make(chan error, 1)
+		go func() {
+			mr := newMsgpackReader(serverConn, 1024)
+			errCh <- handshake(mr, serverConn, "server", "secret")
+		}()
+
+		// Read HELO
+		mr := newMsgpackReader(clientConn, 1024)
+		helo, err := mr.readValue()
+		if err != nil {
+			t.Fatalf("cannot read HELO: %s", err)
+		}
+		if helo.typ != msgpackArray || len(helo.items) != 2 || string(helo.items[0].s) != "HELO" {
+			t.Fatalf("unexpected HELO message: %s", helo.appendJSON(nil))
+		}
+		nonce := helo.items[1].get("nonce")
+		if nonce == nil || len(nonce.s) != 16 {
+			t.Fatalf("unexpected nonce in HELO message: %s", helo.appendJSON(nil))
+		}
+
+		// Send PING
+		salt := []byte("salt")
+		var ping []byte
+		ping = appendMsgpackArrayHeader(ping, 6)
+		ping = appendMsgpackString(ping, "PING")
+		ping = appendMsgpackString(ping, "client")
+		ping = appendMsgpackString(ping, string(salt))
+		ping = appendMsgpackString(ping, string(getSharedKeyDigest(salt, []byte("client"), nonce.s, clientSharedKey)))
+		ping = appendMsgpackString(ping, "")
+		ping = appendMsgpackString(ping, "")
+		if _, err := clientConn.Write(ping); err != nil {
+			t.Fatalf("cannot send PING: %s", err)
+		}
+
+		// Read PONG
+		pong, err := mr.readValue()
+		if err != nil {
+			t.Fatalf("cannot read PONG: %s", err)
+		}
+		if pong.typ != msgpackArray || len(pong.items) != 5 || string(pong.items[0].s) != "PONG" {
+			t.Fatalf("unexpected PONG message: %s", pong.appendJSON(nil))
+		}
+		if pong.items[1].b != authResultExpected {
+			t.Fatalf("unexpected auth result; got %v; want %v", pong.items[1].b, authResultExpected)
+		}
+
+		err = <-errCh
+		if authResultExpected {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(pong.items[3].s) != "server" {
+				t.Fatalf("unexpected server hostname; got %q; want %q", pong.items[3].s, "server")
+			}
+			digestExpected := getSharedKeyDigest(salt, []byte("server"), nonce.s, "secret")
+			if string(pong.items[4].s) != string(digestExpected) {
+				t.Fatalf("unexpected server digest; got %q; want %q", pong.items[4].s, digestExpected)
+			}
+		} else if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f("secret", true)
+	f("invalid", false)
+}
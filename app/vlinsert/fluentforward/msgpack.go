@@ -0,0 +1,446 @@
+package fluentforward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/valyala/quicktemplate"
+)
+
+// msgpackType is the type of msgpack value.
+//
+// See https://github.com/msgpack/msgpack/blob/master/spec.md#type-system
+type msgpackType int
+
+const (
+	msgpackNil msgpackType = iota
+	msgpackBool
+	msgpackInt
+	msgpackUint
+	msgpackFloat
+	msgpackString
+	msgpackBinary
+	msgpackArray
+	msgpackMap
+	msgpackExt
+)
+
+// msgpackValue is a decoded msgpack value.
+type msgpackValue struct {
+	typ msgpackType
+
+	b bool
+	i int64
+	u uint64
+	f float64
+
+	// s contains the contents of string, binary and ext values.
+	s []byte
+
+	// extType is the type of ext value.
+	extType int8
+
+	// items contains array items for array value and key-value pairs for map value.
+	//
+	// Map key-value pairs are stored as items[2*i] and items[2*i+1].
+	items []*msgpackValue
+}
+
+// get returns the value for the given key in map value.
+//
+// nil is returned if v isn't a map or it doesn't contain the given key.
+func (v *msgpackValue) get(key string) *msgpackValue {
+	if v.typ != msgpackMap {
+		return nil
+	}
+	for i := 0; i < len(v.items); i += 2 {
+		k := v.items[i]
+		if k.isString() && string(k.s) == key {
+			return v.items[i+1]
+		}
+	}
+	return nil
+}
+
+// isString returns true if v contains string or binary value.
+func (v *msgpackValue) isString() bool {
+	return v.typ == msgpackString || v.typ == msgpackBinary
+}
+
+// appendString appends string representation of scalar v to dst.
+func (v *msgpackValue) appendString(dst []byte) []byte {
+	switch v.typ {
+	case msgpackBool:
+		return strconv.AppendBool(dst, v.b)
+	case msgpackInt:
+		return strconv.AppendInt(dst, v.i, 10)
+	case msgpackUint:
+		return strconv.AppendUint(dst, v.u, 10)
+	case msgpackFloat:
+		return strconv.AppendFloat(dst, v.f, 'g', -1, 64)
+	case msgpackString, msgpackBinary, msgpackExt:
+		return append(dst, v.s...)
+	case msgpackArray, msgpackMap:
+		return v.appendJSON(dst)
+	default:
+		return dst
+	}
+}
+
+// appendJSON appends JSON representation of v to dst.
+func (v *msgpackValue) appendJSON(dst []byte) []byte {
+	switch v.typ {
+	case msgpackNil:
+		return append(dst, "null"...)
+	case msgpackFloat:
+		if math.IsNaN(v.f) || math.IsInf(v.f, 0) {
+			return quicktemplate.AppendJSONString(dst, strconv.FormatFloat(v.f, 'g', -1, 64), true)
+		}
+		return v.appendString(dst)
+	case msgpackBool, msgpackInt, msgpackUint:
+		return v.appendString(dst)
+	case msgpackString, msgpackBinary, msgpackExt:
+		return quicktemplate.AppendJSONString(dst, string(v.s), true)
+	case msgpackArray:
+		dst = append(dst, '[')
+		for i, item := range v.items {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = item.appendJSON(dst)
+		}
+		return append(dst, ']')
+	case msgpackMap:
+		dst = append(dst, '{')
+		for i := 0; i < len(v.items); i += 2 {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			k := v.items[i]
+			if k.isString() {
+				dst = quicktemplate.AppendJSONString(dst, string(k.s), true)
+			} else {
+				dst = quicktemplate.AppendJSONString(dst, string(k.appendString(nil)), true)
+			}
+			dst = append(dst, ':')
+			dst = v.items[i+1].appendJSON(dst)
+		}
+		return append(dst, '}')
+	default:
+		return dst
+	}
+}
+
+// msgpackReader reads msgpack values from the underlying reader.
+type msgpackReader struct {
+	br *bufio.Reader
+
+	// bytesRead is the number of bytes read since the last resetLimit call.
+	bytesRead int
+
+	// maxBytes is the maximum number of bytes, which can be read since the last resetLimit call.
+	maxBytes int
+
+	buf [8]byte
+}
+
+func newMsgpackReader(r io.Reader, maxBytes int) *msgpackReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, 64*1024)
+	}
+	return &msgpackReader{
+		br:       br,
+		maxBytes: maxBytes,
+	}
+}
+
+// resetLimit resets the number of bytes read, which is limited by maxBytes.
+func (mr *msgpackReader) resetLimit() {
+	mr.bytesRead = 0
+}
+
+// hasMoreData returns true if mr contains more data to read.
+//
+// It returns io.EOF error if there is no more data.
+func (mr *msgpackReader) hasMoreData() error {
+	_, err := mr.br.Peek(1)
+	return err
+}
+
+func (mr *msgpackReader) readBytes(n int) ([]byte, error) {
+	if err := mr.addBytesRead(n); err != nil {
+		return nil, err
+	}
+	if n <= len(mr.buf) {
+		b := mr.buf[:n]
+		if _, err := io.ReadFull(mr.br, b); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return b, nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(mr.br, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+func (mr *msgpackReader) addBytesRead(n int) error {
+	mr.bytesRead += n
+	if mr.bytesRead > mr.maxBytes {
+		return fmt.Errorf("too big message; it mustn't exceed %d bytes", mr.maxBytes)
+	}
+	return nil
+}
+
+func (mr *msgpackReader) readUint(n int) (uint64, error) {
+	b, err := mr.readBytes(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (mr *msgpackReader) readLen(n int) (int, error) {
+	u, err := mr.readUint(n)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(mr.maxBytes) {
+		return 0, fmt.Errorf("too big length: %d; it mustn't exceed %d", u, mr.maxBytes)
+	}
+	return int(u), nil
+}
+
+func (mr *msgpackReader) readData(n int) ([]byte, error) {
+	b, err := mr.readBytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if n <= len(mr.buf) {
+		// b points to mr.buf, so it must be copied.
+		b = append([]byte{}, b...)
+	}
+	return b, nil
+}
+
+func (mr *msgpackReader) readItems(v *msgpackValue, n int) error {
+	// Every item occupies at least a single byte, so this check prevents from huge memory allocations for malformed lengths.
+	if n > mr.maxBytes-mr.bytesRead {
+		return fmt.Errorf("too big number of items: %d; the message mustn't exceed %d bytes", n, mr.maxBytes)
+	}
+
+	v.items = make([]*msgpackValue, n)
+	for i := range v.items {
+		item, err := mr.readValue()
+		if err != nil {
+			return err
+		}
+		v.items[i] = item
+	}
+	return nil
+}
+
+// readValue reads the next msgpack value from mr.
+//
+// io.EOF is returned if there is no more data to read.
+func (mr *msgpackReader) readValue() (*msgpackValue, error) {
+	c, err := mr.br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if err := mr.addBytesRead(1); err != nil {
+		return nil, err
+	}
+	v, err := mr.readValueInternal(c)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return v, nil
+}
+
+func (mr *msgpackReader) readValueInternal(c byte) (*msgpackValue, error) {
+	v := &msgpackValue{}
+	switch {
+	case c <= 0x7f:
+		v.typ = msgpackInt
+		v.i = int64(c)
+		return v, nil
+	case c >= 0xe0:
+		v.typ = msgpackInt
+		v.i = int64(int8(c))
+		return v, nil
+	case c >= 0x80 && c <= 0x8f:
+		v.typ = msgpackMap
+		return v, mr.readItems(v, 2*int(c&0x0f))
+	case c >= 0x90 && c <= 0x9f:
+		v.typ = msgpackArray
+		return v, mr.readItems(v, int(c&0x0f))
+	case c >= 0xa0 && c <= 0xbf:
+		v.typ = msgpackString
+		s, err := mr.readData(int(c & 0x1f))
+		v.s = s
+		return v, err
+	}
+
+	switch c {
+	case 0xc0:
+		v.typ = msgpackNil
+		return v, nil
+	case 0xc2, 0xc3:
+		v.typ = msgpackBool
+		v.b = c == 0xc3
+		return v, nil
+	case 0xc4, 0xc5, 0xc6:
+		v.typ = msgpackBinary
+		n, err := mr.readLen(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		s, err := mr.readData(n)
+		v.s = s
+		return v, err
+	case 0xd9, 0xda, 0xdb:
+		v.typ = msgpackString
+		n, err := mr.readLen(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := mr.readData(n)
+		v.s = s
+		return v, err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := mr.readLen(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return v, mr.readExt(v, n)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return v, mr.readExt(v, 1<<(c-0xd4))
+	case 0xca:
+		u, err := mr.readUint(4)
+		v.typ = msgpackFloat
+		v.f = float64(math.Float32frombits(uint32(u)))
+		return v, err
+	case 0xcb:
+		u, err := mr.readUint(8)
+		v.typ = msgpackFloat
+		v.f = math.Float64frombits(u)
+		return v, err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := mr.readUint(1 << (c - 0xcc))
+		v.typ = msgpackUint
+		v.u = u
+		return v, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		u, err := mr.readUint(n)
+		v.typ = msgpackInt
+		switch n {
+		case 1:
+			v.i = int64(int8(u))
+		case 2:
+			v.i = int64(int16(u))
+		case 4:
+			v.i = int64(int32(u))
+		default:
+			v.i = int64(u)
+		}
+		return v, err
+	case 0xdc, 0xdd:
+		n, err := mr.readLen(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		v.typ = msgpackArray
+		return v, mr.readItems(v, n)
+	case 0xde, 0xdf:
+		n, err := mr.readLen(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		v.typ = msgpackMap
+		return v, mr.readItems(v, 2*n)
+	default:
+		return nil, fmt.Errorf("unexpected msgpack type byte 0x%02x", c)
+	}
+}
+
+func (mr *msgpackReader) readExt(v *msgpackValue, n int) error {
+	t, err := mr.readUint(1)
+	if err != nil {
+		return err
+	}
+	v.typ = msgpackExt
+	v.extType = int8(t)
+	v.s, err = mr.readData(n)
+	return err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// msgpack encoding helpers for the responses sent to fluentd clients.
+
+func appendMsgpackArrayHeader(dst []byte, n int) []byte {
+	if n < 16 {
+		return append(dst, 0x90|byte(n))
+	}
+	dst = append(dst, 0xdc)
+	return binary.BigEndian.AppendUint16(dst, uint16(n))
+}
+
+func appendMsgpackMapHeader(dst []byte, n int) []byte {
+	if n < 16 {
+		return append(dst, 0x80|byte(n))
+	}
+	dst = append(dst, 0xde)
+	return binary.BigEndian.AppendUint16(dst, uint16(n))
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n < 256:
+		dst = append(dst, 0xd9, byte(n))
+	case n < 65536:
+		dst = append(dst, 0xda)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(n))
+	default:
+		dst = append(dst, 0xdb)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(n))
+	}
+	return append(dst, s...)
+}
+
+func appendMsgpackBinary(dst []byte, b []byte) []byte {
+	dst = append(dst, 0xc4, byte(len(b)))
+	return append(dst, b...)
+}
+
+func appendMsgpackBool(dst []byte, b bool) []byte {
+	if b {
+		return append(dst, 0xc3)
+	}
+	return append(dst, 0xc2)
+}
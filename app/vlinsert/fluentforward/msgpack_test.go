@@ -0,0 +1,114 @@
+package fluentforward
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMsgpackReader_Success(t *testing.T) {
+	f := func(data []byte, resultExpected string) {
+		t.Helper()
+
+		mr := newMsgpackReader(bytes.NewReader(data), len(data))
+		v, err := mr.readValue()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := v.appendJSON(nil)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+		if _, err := mr.readValue(); err != io.EOF {
+			t.Fatalf("expecting io.EOF; got %v", err)
+		}
+	}
+
+	// scalars
+	f([]byte{0xc0}, `null`)
+	f([]byte{0xc2}, `false`)
+	f([]byte{0xc3}, `true`)
+	f([]byte{0x05}, `5`)
+	f([]byte{0xff}, `-1`)
+	f([]byte{0xcc, 0xc8}, `200`)
+	f([]byte{0xcd, 0x01, 0x00}, `256`)
+	f([]byte{0xce, 0x00, 0x01, 0x00, 0x00}, `65536`)
+	f([]byte{0xcf, 0, 0, 0, 1, 0, 0, 0, 0}, `4294967296`)
+	f([]byte{0xd0, 0x80}, `-128`)
+	f([]byte{0xd1, 0xff, 0x00}, `-256`)
+	f([]byte{0xd2, 0xff, 0xff, 0xff, 0xfe}, `-2`)
+	f([]byte{0xd3, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfd}, `-3`)
+	f([]byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, `1.5`)
+	f([]byte{0xcb, 0x40, 0x04, 0, 0, 0, 0, 0, 0}, `2.5`)
+
+	// strings and binary
+	f(appendMsgpackString(nil, "foo"), `"foo"`)
+	f(appendMsgpackString(nil, string(bytes.Repeat([]byte("a"), 40))), `"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"`)
+	f([]byte{0xda, 0x00, 0x02, 'a', 'b'}, `"ab"`)
+	f(appendMsgpackBinary(nil, []byte("bar")), `"bar"`)
+	f([]byte{0xc5, 0x00, 0x01, 'x'}, `"x"`)
+
+	// ext
+	f([]byte{0xd4, 0x01, 'a'}, `"a"`)
+	f([]byte{0xc7, 0x02, 0x05, 'a', 'b'}, `"ab"`)
+
+	// arrays and maps
+	f([]byte{0x90}, `[]`)
+	f([]byte{0x92, 0x01, 0xa1, 'a'}, `[1,"a"]`)
+	f([]byte{0xdc, 0x00, 0x01, 0xc3}, `[true]`)
+	f([]byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x91, 0xc0}, `{"a":1,"b":[null]}`)
+	f([]byte{0xde, 0x00, 0x01, 0x01, 0x02}, `{"1":2}`)
+}
+
+func TestMsgpackReader_Failure(t *testing.T) {
+	f := func(data []byte, maxBytes int) {
+		t.Helper()
+
+		mr := newMsgpackReader(bytes.NewReader(data), maxBytes)
+		if _, err := mr.readValue(); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// empty data
+	f(nil, 100)
+
+	// unsupported type byte
+	f([]byte{0xc1}, 100)
+
+	// truncated data
+	f([]byte{0xcd, 0x01}, 100)
+	f([]byte{0xa3, 'a'}, 100)
+	f([]byte{0x92, 0x01}, 100)
+	f([]byte{0x81, 0xa1, 'a'}, 100)
+
+	// too big message
+	f(appendMsgpackString(nil, "foobar"), 5)
+	f([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, 100)
+	f([]byte{0xdb, 0x00, 0x00, 0x10, 0x00}, 100)
+}
+
+func TestMsgpackValueGet(t *testing.T) {
+	data := []byte{0x82, 0xa1, 'a', 0x01, 0xc4, 0x01, 'b', 0xa1, 'c'}
+	mr := newMsgpackReader(bytes.NewReader(data), len(data))
+	v, err := mr.readValue()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(key, resultExpected string) {
+		t.Helper()
+
+		result := "<nil>"
+		if x := v.get(key); x != nil {
+			result = string(x.appendJSON(nil))
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected value for key %q; got %s; want %s", key, result, resultExpected)
+		}
+	}
+
+	f("a", `1`)
+	f("b", `"c"`)
+	f("c", `<nil>`)
+}
@@ -0,0 +1,617 @@
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	listenAddrTCP = flagutil.NewArrayString("gelf.listenAddr.tcp", "Comma-separated list of TCP addresses to listen to for GELF messages. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#gelf")
+	listenAddrUDP = flagutil.NewArrayString("gelf.listenAddr.udp", "Comma-separated list of UDP addresses to listen to for GELF messages. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#gelf")
+
+	gelfStreamFields = flagutil.NewArrayString("gelf.streamFields", "Comma-separated list of fields to use as log stream fields for logs ingested via GELF. "+
+		"By default host and container_name fields are used. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#gelf")
+	gelfIgnoreFields = flagutil.NewArrayString("gelf.ignoreFields", "Comma-separated list of fields to ignore for logs ingested via GELF. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#gelf")
+	gelfTenantID = flag.String("gelf.tenantID", "0:0", "TenantID for logs ingested via GELF. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#gelf")
+
+	chunksTimeout = flag.Duration("gelf.chunksTimeout", 5*time.Second, "The maximum duration for receiving all the chunks of a chunked GELF message over UDP. "+
+		"Incomplete messages are dropped after this timeout")
+)
+
+// defaultStreamFields contains the log stream fields for logs ingested via GELF if -gelf.streamFields isn't set.
+//
+// The container_name field is set by Docker gelf logging driver.
+var defaultStreamFields = []string{"host", "container_name"}
+
+// MustInit starts accepting GELF messages at -gelf.listenAddr.tcp and -gelf.listenAddr.udp.
+//
+// This function must be called after flag.Parse().
+//
+// MustStop() must be called in order to free up resources occupied by the initialized GELF listeners.
+func MustInit() {
+	if workersStopCh != nil {
+		logger.Panicf("BUG: MustInit() called twice without MustStop() call")
+	}
+	workersStopCh = make(chan struct{})
+
+	if len(*listenAddrTCP) == 0 && len(*listenAddrUDP) == 0 {
+		return
+	}
+	cp, err := getCommonParams()
+	if err != nil {
+		logger.Fatalf("cannot initialize GELF listeners: %s", err)
+	}
+
+	for _, addr := range *listenAddrTCP {
+		workersWG.Add(1)
+		go func(addr string) {
+			runTCPListener(addr, cp)
+			workersWG.Done()
+		}(addr)
+	}
+
+	for _, addr := range *listenAddrUDP {
+		workersWG.Add(1)
+		go func(addr string) {
+			runUDPListener(addr, cp)
+			workersWG.Done()
+		}(addr)
+	}
+}
+
+var (
+	workersWG     sync.WaitGroup
+	workersStopCh chan struct{}
+)
+
+// IsEnabled returns true if GELF listeners are configured via -gelf.listenAddr.* command-line flags.
+func IsEnabled() bool {
+	return len(*listenAddrTCP) > 0 || len(*listenAddrUDP) > 0
+}
+
+// CheckConfig verifies -gelf.* command-line flags without starting GELF listeners.
+func CheckConfig() error {
+	if len(*listenAddrTCP) == 0 && len(*listenAddrUDP) == 0 {
+		return nil
+	}
+	if _, err := getCommonParams(); err != nil {
+		return fmt.Errorf("invalid config for GELF listeners: %w", err)
+	}
+	return nil
+}
+
+// MustStop stops GELF listeners initialized via MustInit()
+func MustStop() {
+	close(workersStopCh)
+	workersWG.Wait()
+	workersStopCh = nil
+}
+
+func getCommonParams() (*insertutil.CommonParams, error) {
+	tenantID, err := logstorage.ParseTenantID(*gelfTenantID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -gelf.tenantID=%q: %w", *gelfTenantID, err)
+	}
+	streamFields := *gelfStreamFields
+	if len(streamFields) == 0 {
+		streamFields = defaultStreamFields
+	}
+	cp := &insertutil.CommonParams{
+		TenantID:     tenantID,
+		TimeFields:   []string{"_time"},
+		StreamFields: streamFields,
+		IgnoreFields: *gelfIgnoreFields,
+	}
+	return cp, nil
+}
+
+func runUDPListener(addr string, cp *insertutil.CommonParams) {
+	ln, err := net.ListenPacket(netutil.GetUDPNetwork(), addr)
+	if err != nil {
+		logger.Fatalf("cannot start UDP GELF server at %q: %s", addr, err)
+	}
+
+	doneCh := make(chan struct{})
+	go func() {
+		servePacketListener(ln, cp)
+		close(doneCh)
+	}()
+
+	logger.Infof("started accepting GELF messages at -gelf.listenAddr.udp=%q", addr)
+	<-workersStopCh
+	if err := ln.Close(); err != nil {
+		logger.Fatalf("gelf: cannot close UDP listener at %s: %s", addr, err)
+	}
+	<-doneCh
+	logger.Infof("finished accepting GELF messages at -gelf.listenAddr.udp=%q", addr)
+}
+
+func runTCPListener(addr string, cp *insertutil.CommonParams) {
+	ln, err := netutil.NewTCPListener("gelf", addr, false, nil)
+	if err != nil {
+		logger.Fatalf("gelf: cannot start TCP listener at %s: %s", addr, err)
+	}
+
+	doneCh := make(chan struct{})
+	go func() {
+		serveStreamListener(ln, cp)
+		close(doneCh)
+	}()
+
+	logger.Infof("started accepting GELF messages at -gelf.listenAddr.tcp=%q", addr)
+	<-workersStopCh
+	if err := ln.Close(); err != nil {
+		logger.Fatalf("gelf: cannot close TCP listener at %s: %s", addr, err)
+	}
+	<-doneCh
+	logger.Infof("finished accepting GELF messages at -gelf.listenAddr.tcp=%q", addr)
+}
+
+func servePacketListener(ln net.PacketConn, cp *insertutil.CommonParams) {
+	ca := newChunksAssembler()
+	gomaxprocs := cgroup.AvailableCPUs()
+	var wg sync.WaitGroup
+	localAddr := ln.LocalAddr()
+	for i := 0; i < gomaxprocs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var bb bytesutil.ByteBuffer
+			bb.B = bytesutil.ResizeNoCopyNoOverallocate(bb.B, 64*1024)
+			for {
+				bb.Reset()
+				bb.B = bb.B[:cap(bb.B)]
+				n, remoteAddr, err := ln.ReadFrom(bb.B)
+				if err != nil {
+					udpErrorsTotal.Inc()
+					var ne net.Error
+					if errors.As(err, &ne) {
+						if ne.Temporary() {
+							logger.Errorf("gelf: temporary error when listening for UDP at %q: %s", localAddr, err)
+							time.Sleep(time.Second)
+							continue
+						}
+						if strings.Contains(err.Error(), "use of closed network connection") {
+							break
+						}
+					}
+					logger.Errorf("gelf: cannot read UDP data from %s at %s: %s", remoteAddr, localAddr, err)
+					continue
+				}
+				bb.B = bb.B[:n]
+				udpRequestsTotal.Inc()
+
+				data, err := ca.addPacket(remoteAddr.String(), bb.B, time.Now())
+				if err != nil {
+					errorsTotal.Inc()
+					logger.Errorf("gelf: cannot process UDP packet from %s at %s: %s", remoteAddr, localAddr, err)
+					continue
+				}
+				if data == nil {
+					// Wait for the remaining chunks of the message.
+					continue
+				}
+				if err := processPacket(data, cp); err != nil {
+					errorsTotal.Inc()
+					logger.Errorf("gelf: cannot process UDP message from %s at %s: %s", remoteAddr, localAddr, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func serveStreamListener(ln net.Listener, cp *insertutil.CommonParams) {
+	var cm ingestserver.ConnsMap
+	cm.Init("gelf")
+
+	var wg sync.WaitGroup
+	addr := ln.Addr()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) {
+				if ne.Temporary() {
+					logger.Errorf("gelf: temporary error when listening for TCP addr %q: %s", addr, err)
+					time.Sleep(time.Second)
+					continue
+				}
+				if strings.Contains(err.Error(), "use of closed network connection") {
+					break
+				}
+				logger.Fatalf("gelf: unrecoverable error when accepting TCP connections at %q: %s", addr, err)
+			}
+			logger.Fatalf("gelf: unexpected error when accepting TCP connections at %q: %s", addr, err)
+		}
+		if !cm.Add(c) {
+			_ = c.Close()
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			if err := processStream(c, cp); err != nil {
+				errorsTotal.Inc()
+				logger.Errorf("gelf: cannot process TCP data from %s at %q: %s", c.RemoteAddr(), addr, err)
+			}
+
+			cm.Delete(c)
+			_ = c.Close()
+			wg.Done()
+		}()
+	}
+
+	cm.CloseAll(0)
+	wg.Wait()
+}
+
+// processPacket processes a single GELF message received over UDP.
+//
+// The message may be compressed with gzip or zlib.
+func processPacket(data []byte, cp *insertutil.CommonParams) error {
+	if err := insertutil.CanWriteData(); err != nil {
+		return err
+	}
+
+	im := cp.GetIngestionMetrics("gelf_udp")
+	im.AddReceivedBytes(len(data))
+
+	var bb *bytesutil.ByteBuffer
+	if compressMethod := getCompressMethod(data); compressMethod != "" {
+		bb = uncompressedBufPool.Get()
+		defer uncompressedBufPool.Put(bb)
+
+		if err := decompress(bb, data, compressMethod); err != nil {
+			im.AddParseErrors(1)
+			return err
+		}
+		data = bb.B
+	}
+	im.AddUncompressedBytes(len(data))
+
+	lmp := cp.NewLogMessageProcessor("gelf_udp", true)
+	err := processMessage(data, lmp)
+	lmp.MustClose()
+	if err != nil {
+		im.AddParseErrors(1)
+	}
+	return err
+}
+
+var uncompressedBufPool bytesutil.ByteBufferPool
+
+// getCompressMethod returns compression method for the GELF message in data according to its magic bytes.
+//
+// Empty string is returned for uncompressed messages.
+func getCompressMethod(data []byte) string {
+	if len(data) < 2 {
+		return ""
+	}
+	if data[0] == 0x1f && data[1] == 0x8b {
+		return "gzip"
+	}
+	if data[0] == 0x78 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0 {
+		// zlib header - see https://www.rfc-editor.org/rfc/rfc1950#section-2.2
+		return "deflate"
+	}
+	return ""
+}
+
+func decompress(dst *bytesutil.ByteBuffer, data []byte, compressMethod string) error {
+	r, err := protoparserutil.GetUncompressedReader(bytes.NewReader(data), compressMethod)
+	if err != nil {
+		return fmt.Errorf("cannot decompress %s message: %w", compressMethod, err)
+	}
+	defer protoparserutil.PutUncompressedReader(r)
+
+	maxSize := insertutil.MaxLineSizeBytes.IntN()
+	if _, err := dst.ReadFrom(io.LimitReader(r, int64(maxSize)+1)); err != nil {
+		return fmt.Errorf("cannot decompress %s message: %w", compressMethod, err)
+	}
+	if len(dst.B) > maxSize {
+		return fmt.Errorf("too big decompressed message; it mustn't exceed -insert.maxLineSizeBytes=%d bytes", maxSize)
+	}
+	return nil
+}
+
+// processStream processes null-delimited GELF messages received over TCP.
+func processStream(r io.Reader, cp *insertutil.CommonParams) error {
+	if err := insertutil.CanWriteData(); err != nil {
+		return err
+	}
+
+	im := cp.GetIngestionMetrics("gelf_tcp")
+	lmp := cp.NewLogMessageProcessor("gelf_tcp", true)
+	// GELF messages over TCP are always uncompressed.
+	err := processStreamInternal(im.NewUncompressedBytesReader(im.NewReceivedBytesReader(r)), lmp)
+	lmp.MustClose()
+	if err != nil {
+		im.AddParseErrors(1)
+	}
+	return err
+}
+
+func processStreamInternal(r io.Reader, lmp insertutil.LogMessageProcessor) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	maxSize := insertutil.MaxLineSizeBytes.IntN()
+
+	var buf []byte
+	n := 0
+	for {
+		buf = buf[:0]
+		var err error
+		for {
+			var chunk []byte
+			chunk, err = br.ReadSlice(0)
+			buf = append(buf, chunk...)
+			if len(buf) > maxSize {
+				return fmt.Errorf("too long message #%d; it mustn't exceed -insert.maxLineSizeBytes=%d bytes", n, maxSize)
+			}
+			if err != bufio.ErrBufferFull {
+				break
+			}
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("cannot read message #%d: %w", n, err)
+		}
+
+		msg := bytes.TrimRight(buf, "\x00")
+		if len(bytes.TrimSpace(msg)) > 0 {
+			if err := processMessage(msg, lmp); err != nil {
+				return fmt.Errorf("cannot process message #%d: %w", n, err)
+			}
+			n++
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// processMessage parses GELF message from data and passes it to lmp.
+//
+// See https://go2docs.graylog.org/current/getting_in_log_data/gelf.html#GELFPayloadSpecification
+func processMessage(data []byte, lmp insertutil.LogMessageProcessor) error {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(data)
+	if err != nil {
+		return fmt.Errorf("cannot parse JSON: %w", err)
+	}
+	o, err := v.Object()
+	if err != nil {
+		return fmt.Errorf("unexpected message type; want JSON object: %w", err)
+	}
+
+	var fields []logstorage.Field
+	var buf []byte
+	ts := int64(0)
+	o.Visit(func(k []byte, v *fastjson.Value) {
+		if err != nil {
+			return
+		}
+		name := bytesutil.ToUnsafeString(k)
+		switch name {
+		case "version":
+			return
+		case "timestamp":
+			ts, err = parseTimestamp(v)
+			return
+		case "short_message":
+			name = "_msg"
+		default:
+			// Additional fields are prefixed with '_' according to GELF spec.
+			name = strings.TrimPrefix(name, "_")
+		}
+		if name == "" || v.Type() == fastjson.TypeNull {
+			return
+		}
+
+		var value string
+		if v.Type() == fastjson.TypeString {
+			value = bytesutil.ToUnsafeString(v.GetStringBytes())
+		} else {
+			bufLen := len(buf)
+			buf = v.MarshalTo(buf)
+			value = bytesutil.ToUnsafeString(buf[bufLen:])
+		}
+		fields = append(fields, logstorage.Field{
+			Name:  name,
+			Value: value,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if ts == 0 {
+		ts = time.Now().UnixNano()
+	}
+	lmp.AddRow(ts, fields, -1)
+	return nil
+}
+
+var parserPool fastjson.ParserPool
+
+// parseTimestamp parses GELF timestamp in seconds since Unix epoch with optional fractional part and returns it in nanoseconds.
+func parseTimestamp(v *fastjson.Value) (int64, error) {
+	var s string
+	switch v.Type() {
+	case fastjson.TypeNumber:
+		var b [32]byte
+		s = bytesutil.ToUnsafeString(v.MarshalTo(b[:0]))
+	case fastjson.TypeString:
+		s = bytesutil.ToUnsafeString(v.GetStringBytes())
+	default:
+		return 0, fmt.Errorf("unexpected type for timestamp: %s; want number", v.Type())
+	}
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	nsecs, ok := timeutil.TryParseUnixTimestamp(s)
+	if !ok {
+		return 0, fmt.Errorf("cannot parse timestamp %q", s)
+	}
+	return nsecs, nil
+}
+
+// GELF chunked message constants.
+//
+// See https://go2docs.graylog.org/current/getting_in_log_data/gelf.html#ChunkedGELF
+const (
+	chunkHeaderSize = 12
+	maxChunksCount  = 128
+
+	// maxPendingMessages is the maximum number of chunked messages, which can be assembled simultaneously.
+	maxPendingMessages = 10_000
+)
+
+var chunkMagic = []byte{0x1e, 0x0f}
+
+// chunksAssembler assembles chunked GELF messages received over UDP.
+type chunksAssembler struct {
+	mu       sync.Mutex
+	messages map[chunkedMessageKey]*chunkedMessage
+
+	lastCleanup time.Time
+}
+
+type chunkedMessageKey struct {
+	remoteAddr string
+	id         uint64
+}
+
+type chunkedMessage struct {
+	chunks   [][]byte
+	received int
+	size     int
+
+	createdAt time.Time
+}
+
+func newChunksAssembler() *chunksAssembler {
+	return &chunksAssembler{
+		messages:    make(map[chunkedMessageKey]*chunkedMessage),
+		lastCleanup: time.Now(),
+	}
+}
+
+// addPacket adds UDP packet received from remoteAddr to ca.
+//
+// It returns the whole message if the packet isn't chunked or if it is the last missing chunk of the message.
+// Otherwise nil is returned. The caller mustn't hold the returned message after packet is reused.
+func (ca *chunksAssembler) addPacket(remoteAddr string, packet []byte, now time.Time) ([]byte, error) {
+	if !bytes.HasPrefix(packet, chunkMagic) {
+		return packet, nil
+	}
+	if len(packet) < chunkHeaderSize {
+		return nil, fmt.Errorf("too short chunk; got %d bytes; want at least %d bytes", len(packet), chunkHeaderSize)
+	}
+	k := chunkedMessageKey{
+		remoteAddr: remoteAddr,
+		id:         binary.BigEndian.Uint64(packet[2:10]),
+	}
+	seqNum := int(packet[10])
+	seqCount := int(packet[11])
+	if seqCount == 0 || seqCount > maxChunksCount {
+		return nil, fmt.Errorf("invalid chunks count: %d; it must be in the range [1..%d]", seqCount, maxChunksCount)
+	}
+	if seqNum >= seqCount {
+		return nil, fmt.Errorf("invalid chunk sequence number: %d; it must be smaller than chunks count %d", seqNum, seqCount)
+	}
+	payload := packet[chunkHeaderSize:]
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if now.Sub(ca.lastCleanup) > *chunksTimeout {
+		ca.cleanupLocked(now)
+	}
+
+	m := ca.messages[k]
+	if m == nil {
+		if len(ca.messages) >= maxPendingMessages {
+			chunksDroppedTotal.Inc()
+			return nil, fmt.Errorf("too many incomplete chunked messages; dropping the chunk")
+		}
+		m = &chunkedMessage{
+			chunks:    make([][]byte, seqCount),
+			createdAt: now,
+		}
+		ca.messages[k] = m
+	}
+	if len(m.chunks) != seqCount {
+		delete(ca.messages, k)
+		chunksDroppedTotal.Add(m.received + 1)
+		return nil, fmt.Errorf("unexpected chunks count: %d; want %d", seqCount, len(m.chunks))
+	}
+	if m.chunks[seqNum] != nil {
+		// Duplicate chunk
+		return nil, nil
+	}
+	m.size += len(payload)
+	if maxSize := insertutil.MaxLineSizeBytes.IntN(); m.size > maxSize {
+		delete(ca.messages, k)
+		chunksDroppedTotal.Add(m.received + 1)
+		return nil, fmt.Errorf("too big chunked message; it mustn't exceed -insert.maxLineSizeBytes=%d bytes", maxSize)
+	}
+	m.chunks[seqNum] = append([]byte{}, payload...)
+	m.received++
+	if m.received < seqCount {
+		return nil, nil
+	}
+
+	delete(ca.messages, k)
+	data := make([]byte, 0, m.size)
+	for _, chunk := range m.chunks {
+		data = append(data, chunk...)
+	}
+	return data, nil
+}
+
+// cleanupLocked drops incomplete messages, which weren't assembled during -gelf.chunksTimeout.
+func (ca *chunksAssembler) cleanupLocked(now time.Time) {
+	for k, m := range ca.messages {
+		if now.Sub(m.createdAt) > *chunksTimeout {
+			chunksDroppedTotal.Add(m.received)
+			delete(ca.messages, k)
+		}
+	}
+	ca.lastCleanup = now
+}
+
+var (
+	errorsTotal        = metrics.NewCounter(`vl_errors_total{type="gelf"}`)
+	chunksDroppedTotal = metrics.NewCounter(`vl_gelf_chunks_dropped_total`)
+
+	udpRequestsTotal = metrics.NewCounter(`vl_udp_reqests_total{type="gelf"}`)
+	udpErrorsTotal   = metrics.NewCounter(`vl_udp_errors_total{type="gelf"}`)
+)
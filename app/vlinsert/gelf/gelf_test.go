@@ -0,0 +1,183 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+func TestProcessMessageFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		lmp := &insertutil.TestLogMessageProcessor{}
+		if err := processMessage([]byte(data), lmp); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f("")
+	f("foobar")
+	f(`[]`)
+	f(`{"short_message":"foo","timestamp":"bar"}`)
+	f(`{"short_message":"foo","timestamp":[]}`)
+}
+
+func TestProcessMessageSuccess(t *testing.T) {
+	f := func(data string, timestampsExpected []int64, resultExpected string) {
+		t.Helper()
+
+		lmp := &insertutil.TestLogMessageProcessor{}
+		if err := processMessage([]byte(data), lmp); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := lmp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	f(`{"version":"1.1","host":"example.org","short_message":"A short message","full_message":"Backtrace here\n\nmore stuff","timestamp":1385053862.3072,`+
+		`"level":1,"_user_id":9001,"_some_info":"foo","_null":null}`,
+		[]int64{1385053862307200000},
+		`{"host":"example.org","_msg":"A short message","full_message":"Backtrace here\n\nmore stuff","level":"1","user_id":"9001","some_info":"foo"}`)
+
+	// Docker gelf logging driver message
+	f(`{"version":"1.1","host":"docker-host","short_message":"hello","timestamp":1700000000,"level":6,`+
+		`"_command":"echo hello","_container_id":"abc","_container_name":"app","_created":"2023-11-14T22:13:20Z","_image_name":"alpine","_tag":"abc"}`,
+		[]int64{1700000000000000000},
+		`{"host":"docker-host","_msg":"hello","level":"6","command":"echo hello","container_id":"abc","container_name":"app","created":"2023-11-14T22:13:20Z","image_name":"alpine","tag":"abc"}`)
+}
+
+func TestProcessStreamInternal(t *testing.T) {
+	f := func(data string, timestampsExpected []int64, resultExpected string) {
+		t.Helper()
+
+		lmp := &insertutil.TestLogMessageProcessor{}
+		if err := processStreamInternal(strings.NewReader(data), lmp); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := lmp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	f("", nil, "")
+	f("\x00\x00", nil, "")
+	f(`{"short_message":"foo","timestamp":1700000000}`, []int64{1700000000000000000}, `{"_msg":"foo"}`)
+	f(`{"short_message":"foo","timestamp":1700000000}`+"\x00"+`{"short_message":"bar","timestamp":1700000001}`+"\x00\x00\n",
+		[]int64{1700000000000000000, 1700000001000000000},
+		`{"_msg":"foo"}
+{"_msg":"bar"}`)
+
+	// invalid message
+	lmp := &insertutil.TestLogMessageProcessor{}
+	if err := processStreamInternal(strings.NewReader("{\"short_message\":\"foo\"}\x00bar\x00"), lmp); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	msg := []byte(`{"short_message":"foo"}`)
+
+	var gzipBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzipBuf)
+	_, _ = gw.Write(msg)
+	_ = gw.Close()
+
+	var zlibBuf bytes.Buffer
+	zw := zlib.NewWriter(&zlibBuf)
+	_, _ = zw.Write(msg)
+	_ = zw.Close()
+
+	f := func(data []byte, compressMethodExpected string) {
+		t.Helper()
+
+		compressMethod := getCompressMethod(data)
+		if compressMethod != compressMethodExpected {
+			t.Fatalf("unexpected compress method; got %q; want %q", compressMethod, compressMethodExpected)
+		}
+		if compressMethod == "" {
+			return
+		}
+		var bb bytesutil.ByteBuffer
+		if err := decompress(&bb, data, compressMethod); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !bytes.Equal(bb.B, msg) {
+			t.Fatalf("unexpected decompressed message; got %q; want %q", bb.B, msg)
+		}
+	}
+
+	f(msg, "")
+	f(gzipBuf.Bytes(), "gzip")
+	f(zlibBuf.Bytes(), "deflate")
+}
+
+func newChunk(id uint64, seqNum, seqCount byte, payload string) []byte {
+	chunk := append([]byte{}, chunkMagic...)
+	chunk = binary.BigEndian.AppendUint64(chunk, id)
+	chunk = append(chunk, seqNum, seqCount)
+	return append(chunk, payload...)
+}
+
+func TestChunksAssembler(t *testing.T) {
+	ca := newChunksAssembler()
+	now := time.Now()
+
+	f := func(remoteAddr string, packet []byte, resultExpected string) {
+		t.Helper()
+
+		result, err := ca.addPacket(remoteAddr, packet, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	// non-chunked message
+	f("a", []byte("foobar"), "foobar")
+
+	// chunks in random order from multiple senders with duplicates
+	f("a", newChunk(1, 2, 3, "baz"), "")
+	f("b", newChunk(1, 0, 2, "xx"), "")
+	f("a", newChunk(1, 0, 3, "foo"), "")
+	f("a", newChunk(1, 0, 3, "foo"), "")
+	f("b", newChunk(1, 1, 2, "yy"), "xxyy")
+	f("a", newChunk(1, 1, 3, "bar"), "foobarbaz")
+
+	// single chunk
+	f("a", newChunk(2, 0, 1, "qwe"), "qwe")
+
+	// incomplete message is dropped after the timeout
+	f("a", newChunk(3, 0, 2, "foo"), "")
+	now = now.Add(2 * *chunksTimeout)
+	f("a", newChunk(4, 0, 1, "bar"), "bar")
+	f("a", newChunk(3, 1, 2, "baz"), "")
+	if n := len(ca.messages); n != 1 {
+		t.Fatalf("unexpected number of pending messages; got %d; want 1", n)
+	}
+
+	// invalid chunks
+	fError := func(packet []byte) {
+		t.Helper()
+
+		if _, err := ca.addPacket("a", packet, now); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	fError(chunkMagic)
+	fError(newChunk(5, 0, 0, "foo"))
+	fError(newChunk(5, 0, 129, "foo"))
+	fError(newChunk(5, 2, 2, "foo"))
+	fError(newChunk(3, 0, 3, "foo"))
+}
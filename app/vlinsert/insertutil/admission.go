@@ -0,0 +1,137 @@
+package insertutil
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	vmmetrics "github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	softMemoryPercent = flag.Float64("insert.admission.softMemoryPercent", 80, "Memory usage in percent of the available memory, after which new data ingestion requests "+
+		"are rejected with 429 status code with the probability growing linearly up to -insert.admission.hardMemoryPercent. "+
+		"It is used only if -insert.admission.hardMemoryPercent is set. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#admission-control")
+	hardMemoryPercent = flag.Float64("insert.admission.hardMemoryPercent", 0, "Memory usage in percent of the available memory, after which all the new data ingestion requests "+
+		"are rejected with 429 status code. Memory-based admission control is disabled by default. For example, set it to 95 for enabling it. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#admission-control")
+	maxConcurrentRequests = flag.Int("insert.admission.maxConcurrentRequests", 0, "The maximum number of concurrently processed data ingestion requests. "+
+		"New requests are rejected with 429 status code when this limit is reached. The limit is reduced proportionally when memory usage exceeds -insert.admission.softMemoryPercent. "+
+		"By default there is no limit. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#admission-control")
+)
+
+// memoryUsageSampleInterval is the interval between memory usage measurements for admission control.
+const memoryUsageSampleInterval = 100 * time.Millisecond
+
+var inflightRequests atomic.Int64
+
+var (
+	memoryUsageLastSample atomic.Int64
+	memoryUsageBytes      atomic.Uint64
+	memoryUsageLock       sync.Mutex
+	memoryUsageSamples    = []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+)
+
+var (
+	_ = vmmetrics.NewGauge(`vl_insert_inflight_requests`, func() float64 {
+		return float64(inflightRequests.Load())
+	})
+	_ = vmmetrics.NewGauge(`vl_insert_admission_memory_usage_ratio`, func() float64 {
+		return getMemoryUsageRatio()
+	})
+)
+
+// AdmitRequest checks whether a new data ingestion request for the given endpoint can be processed
+// according to the current memory usage and the number of concurrently processed requests.
+//
+// It returns an error with http.StatusTooManyRequests status code if the request must be rejected.
+// Otherwise ReleaseRequest must be called after the request is processed.
+func AdmitRequest(endpoint string) error {
+	n := inflightRequests.Add(1)
+	err := checkAdmission(endpoint, n, getMemoryUsageRatio(), rand.Float64())
+	if err != nil {
+		inflightRequests.Add(-1)
+		return err
+	}
+	return nil
+}
+
+// ReleaseRequest must be called after processing the request admitted via AdmitRequest.
+func ReleaseRequest() {
+	inflightRequests.Add(-1)
+}
+
+func checkAdmission(endpoint string, inflight int64, memoryUsageRatio, randValue float64) error {
+	// rejectRatio is the share of new requests to reject because of memory pressure.
+	rejectRatio := 0.0
+	if *hardMemoryPercent > 0 {
+		soft := *softMemoryPercent / 100
+		hard := *hardMemoryPercent / 100
+		switch {
+		case memoryUsageRatio >= hard:
+			rejectRatio = 1
+		case memoryUsageRatio > soft:
+			rejectRatio = (memoryUsageRatio - soft) / (hard - soft)
+		}
+	}
+	if rejectRatio > 0 && randValue < rejectRatio {
+		vmmetrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_admission_rejected_total{endpoint=%q,reason="memory"}`, endpoint)).Inc()
+		return &httpserver.ErrorWithStatusCode{
+			Err: fmt.Errorf("cannot process the request because memory usage is too high: %.1f%% of the available memory; "+
+				"retry the request later or reduce ingestion rate; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#admission-control", memoryUsageRatio*100),
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+
+	if *maxConcurrentRequests > 0 {
+		limit := int64(float64(*maxConcurrentRequests) * (1 - rejectRatio))
+		limit = max(limit, 1)
+		if inflight > limit {
+			vmmetrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_admission_rejected_total{endpoint=%q,reason="concurrency"}`, endpoint)).Inc()
+			return &httpserver.ErrorWithStatusCode{
+				Err: fmt.Errorf("cannot process the request because the number of concurrent data ingestion requests exceeds %d; "+
+					"retry the request later or increase -insert.admission.maxConcurrentRequests", limit),
+				StatusCode: http.StatusTooManyRequests,
+			}
+		}
+	}
+	return nil
+}
+
+// getMemoryUsageRatio returns the ratio of the memory used by the current process to the available memory.
+func getMemoryUsageRatio() float64 {
+	available := memory.Allowed() + memory.Remaining()
+	if available <= 0 {
+		return 0
+	}
+	return float64(getMemoryUsageBytes()) / float64(available)
+}
+
+func getMemoryUsageBytes() uint64 {
+	now := time.Now().UnixNano()
+	if now-memoryUsageLastSample.Load() < int64(memoryUsageSampleInterval) {
+		return memoryUsageBytes.Load()
+	}
+
+	memoryUsageLock.Lock()
+	defer memoryUsageLock.Unlock()
+
+	if now-memoryUsageLastSample.Load() < int64(memoryUsageSampleInterval) {
+		return memoryUsageBytes.Load()
+	}
+	metrics.Read(memoryUsageSamples)
+	n := memoryUsageSamples[0].Value.Uint64() - memoryUsageSamples[1].Value.Uint64()
+	memoryUsageBytes.Store(n)
+	memoryUsageLastSample.Store(now)
+	return n
+}
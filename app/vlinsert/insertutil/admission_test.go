@@ -0,0 +1,105 @@
+package insertutil
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+func TestCheckAdmission(t *testing.T) {
+	defer func(soft, hard float64, maxConcurrent int) {
+		*softMemoryPercent = soft
+		*hardMemoryPercent = hard
+		*maxConcurrentRequests = maxConcurrent
+	}(*softMemoryPercent, *hardMemoryPercent, *maxConcurrentRequests)
+
+	f := func(inflight int64, memoryUsageRatio, randValue float64, admitExpected bool) {
+		t.Helper()
+
+		err := checkAdmission("jsonline", inflight, memoryUsageRatio, randValue)
+		if admitExpected {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		var esc *httpserver.ErrorWithStatusCode
+		if !errors.As(err, &esc) || esc.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("unexpected error; got %v; want error with %d status code", err, http.StatusTooManyRequests)
+		}
+	}
+
+	// memory-based admission control is disabled by default
+	*hardMemoryPercent = mustParseFloat64(t, flag.Lookup("insert.admission.hardMemoryPercent").DefValue)
+	*maxConcurrentRequests = 0
+	f(1000, 1.5, 0, true)
+
+	*softMemoryPercent = 80
+	*hardMemoryPercent = 90
+
+	// memory usage below the soft limit
+	f(1000, 0.5, 0, true)
+
+	// memory usage between the soft and the hard limit
+	f(1, 0.85, 0.4, false)
+	f(1, 0.85, 0.6, true)
+
+	// memory usage above the hard limit
+	f(1, 0.9, 0.99, false)
+	f(1, 1.5, 0.99, false)
+
+	// disabled memory-based admission control
+	*hardMemoryPercent = 0
+	f(1, 1.5, 0, true)
+
+	// concurrency limit
+	*hardMemoryPercent = 90
+	*maxConcurrentRequests = 10
+	f(10, 0.5, 0, true)
+	f(11, 0.5, 0, false)
+
+	// concurrency limit is reduced under memory pressure
+	f(5, 0.85, 0.6, true)
+	f(6, 0.85, 0.6, false)
+}
+
+func mustParseFloat64(t *testing.T, s string) float64 {
+	t.Helper()
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %s", s, err)
+	}
+	return f
+}
+
+func TestAdmitRequest(t *testing.T) {
+	defer func(maxConcurrent int) {
+		*maxConcurrentRequests = maxConcurrent
+	}(*maxConcurrentRequests)
+	*maxConcurrentRequests = 1
+
+	if err := AdmitRequest("jsonline"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := AdmitRequest("jsonline"); err == nil {
+		t.Fatalf("expecting non-nil error when the concurrency limit is reached")
+	}
+	ReleaseRequest()
+
+	if err := AdmitRequest("loki"); err != nil {
+		t.Fatalf("unexpected error after releasing the request: %s", err)
+	}
+	ReleaseRequest()
+
+	if n := inflightRequests.Load(); n != 0 {
+		t.Fatalf("unexpected number of inflight requests; got %d; want 0", n)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
@@ -43,10 +44,33 @@ type CommonParams struct {
 	Debug           bool
 	DebugRequestURI string
 	DebugRemoteAddr string
+
+	// DryRun is set if the request contains dry_run=1 query arg. In this case the ingested logs are collected at DryRun instead of storing them.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#dry-run
+	DryRun *DryRunResult
+
+	// Pipeline is the transformation pipeline set via `pipeline` query arg or `VL-Pipeline` request header.
+	//
+	// If it is nil, then the pipeline is selected according to match sections at -insert.pipelineFile.
+	// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#transformation-pipelines
+	Pipeline *Pipeline
 }
 
 // GetCommonParams returns CommonParams from r.
+//
+// Params missing in r are set to per-tenant defaults from -insert.tenantDefaultsFile.
 func GetCommonParams(r *http.Request) (*CommonParams, error) {
+	cp, err := GetRawCommonParams(r)
+	if err != nil {
+		return nil, err
+	}
+	cp.applyTenantDefaults()
+	return cp, nil
+}
+
+// GetRawCommonParams returns CommonParams from r without applying per-tenant defaults from -insert.tenantDefaultsFile.
+func GetRawCommonParams(r *http.Request) (*CommonParams, error) {
 	// Extract tenantID
 	tenantID, err := logstorage.GetTenantIDFromRequest(r)
 	if err != nil {
@@ -84,6 +108,16 @@ func GetCommonParams(r *http.Request) (*CommonParams, error) {
 		debugRemoteAddr = httpserver.GetQuotedRemoteAddr(r)
 	}
 
+	dryRun, err := getDryRunResult(r)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline, err := getPipelineFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
 	cp := &CommonParams{
 		TenantID:         tenantID,
 		TimeFields:       timeFields,
@@ -97,6 +131,8 @@ func GetCommonParams(r *http.Request) (*CommonParams, error) {
 		Debug:           debug,
 		DebugRequestURI: debugRequestURI,
 		DebugRemoteAddr: debugRemoteAddr,
+		DryRun:          dryRun,
+		Pipeline:        pipeline,
 	}
 
 	return cp, nil
@@ -124,6 +160,15 @@ func getExtraFields(r *http.Request) ([]logstorage.Field, error) {
 
 // GetCommonParamsForSyslog returns common params needed for parsing syslog messages and storing them to the given tenantID.
 func GetCommonParamsForSyslog(tenantID logstorage.TenantID, streamFields, ignoreFields, decolorizeFields []string, extraFields []logstorage.Field) *CommonParams {
+	if td := tenantDefaults[tenantID]; td != nil {
+		if streamFields == nil && len(td.StreamFields) > 0 {
+			streamFields = td.StreamFields
+		}
+		if ignoreFields == nil {
+			ignoreFields = td.IgnoreFields
+		}
+	}
+
 	// See https://docs.victoriametrics.com/victorialogs/logsql/#unpack_syslog-pipe
 	if streamFields == nil {
 		streamFields = []string{
@@ -170,11 +215,61 @@ func SetLogRowsStorage(storage LogRowsStorage) {
 	logRowsStorage = storage
 }
 
+// LogRowsWatcher is an interface for watching logs before they are written to the storage.
+type LogRowsWatcher interface {
+	// WatchLogRows is called for every lr before writing it to the storage.
+	//
+	// The implementation cannot hold references to lr, since the caller can reuse it.
+	WatchLogRows(lr *logstorage.LogRows)
+}
+
+var logRowsWatchers []LogRowsWatcher
+
+// AddLogRowsWatcher adds the watcher for logs written to the storage via LogMessageProcessor.
+//
+// This function must be called before using LogMessageProcessor from this package.
+func AddLogRowsWatcher(watcher LogRowsWatcher) {
+	logRowsWatchers = append(logRowsWatchers, watcher)
+}
+
 // CanWriteData returns non-nil error if data cannot be written to the underlying storage.
 func CanWriteData() error {
 	return logRowsStorage.CanWriteData()
 }
 
+// timestampChecker is an optional interface, which can be implemented by LogRowsStorage.
+type timestampChecker interface {
+	// IsTimestampAllowed must return false if logs with the given timestamp are dropped by the underlying storage.
+	IsTimestampAllowed(timestamp int64) bool
+}
+
+// IsTimestampAllowed returns false if logs with the given timestamp in nanoseconds are dropped by the underlying storage.
+func IsTimestampAllowed(timestamp int64) bool {
+	tc, ok := logRowsStorage.(timestampChecker)
+	if !ok {
+		return true
+	}
+	return tc.IsTimestampAllowed(timestamp)
+}
+
+// pendingDataFlusher is an optional interface, which can be implemented by LogRowsStorage.
+type pendingDataFlusher interface {
+	// FlushPendingData must send logs buffered by the underlying storage to their destination and wait until they are accepted there.
+	FlushPendingData()
+}
+
+// FlushPendingData sends logs buffered by the underlying storage to their destination and waits until they are accepted there.
+//
+// It must be called after LogMessageProcessor.MustClose() when the caller needs to be sure the logs reached the storage,
+// e.g. before acknowledging the logs at the source.
+func FlushPendingData() {
+	pf, ok := logRowsStorage.(pendingDataFlusher)
+	if !ok {
+		return
+	}
+	pf.FlushPendingData()
+}
+
 // LogMessageProcessor is an interface for log message processors.
 type LogMessageProcessor interface {
 	// AddRow must add row to the LogMessageProcessor with the given timestamp and fields.
@@ -188,6 +283,14 @@ type LogMessageProcessor interface {
 	MustClose()
 }
 
+// RejectedRowsCounter is an optional interface, which may be implemented by LogMessageProcessor.
+//
+// LogMessageProcessor returned by CommonParams.NewLogMessageProcessor implements this interface.
+type RejectedRowsCounter interface {
+	// TooManyFieldsRows must return the number of rows dropped by AddRow, since they contain more than -insert.maxFieldsPerLine fields.
+	TooManyFieldsRows() int64
+}
+
 type logMessageProcessor struct {
 	mu            sync.Mutex
 	wg            sync.WaitGroup
@@ -197,9 +300,30 @@ type logMessageProcessor struct {
 	cp *CommonParams
 	lr *logstorage.LogRows
 
+	// rps contains row processors to apply to the added rows; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#row-processors
+	rps    []RowProcessor
+	rpsBuf rowProcessorsBuf
+
+	// pl is an optional transformation pipeline to apply to the added rows; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#transformation-pipelines
+	pl    *Pipeline
+	plBuf pipelineBuf
+
 	rowsIngestedTotal  *metrics.Counter
 	bytesIngestedTotal *metrics.Counter
 	flushDuration      *metrics.Summary
+
+	// protocolName is the name of the data ingestion protocol used for obtaining per-tenant ingestion metrics.
+	protocolName string
+
+	// preview is an optional ring buffer for the last ingested rows; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#ingestion-preview
+	preview *ingestPreviewRing
+
+	// im contains ingestion metrics for imTenantID.
+	im         *IngestionMetrics
+	imTenantID logstorage.TenantID
+
+	// tooManyFieldsRows is the number of rows dropped because of -insert.maxFieldsPerLine limit.
+	tooManyFieldsRows atomic.Int64
 }
 
 func (lmp *logMessageProcessor) initPeriodicFlush() {
@@ -234,21 +358,50 @@ func (lmp *logMessageProcessor) initPeriodicFlush() {
 // instead of the pre-configured stream fields.
 func (lmp *logMessageProcessor) AddRow(timestamp int64, fields []logstorage.Field, streamFieldsLen int) {
 	lmp.rowsIngestedTotal.Inc()
+	lmp.im.rowsIngested.Inc()
 	n := logstorage.EstimatedJSONRowLen(fields)
 	lmp.bytesIngestedTotal.Add(n)
 
-	if len(fields) > *MaxFieldsPerLine {
-		line := logstorage.MarshalFieldsToJSON(nil, fields)
-		logger.Warnf("dropping log line with %d fields; it exceeds -insert.maxFieldsPerLine=%d; %s", len(fields), *MaxFieldsPerLine, line)
-		rowsDroppedTotalTooManyFields.Inc()
+	if lmp.preview != nil {
+		lmp.preview.add(timestamp, fields)
+	}
+
+	if !checkMaxFieldsPerLine(fields) {
+		lmp.tooManyFieldsRows.Add(1)
 		return
 	}
 
 	lmp.mu.Lock()
 	defer lmp.mu.Unlock()
 
-	lmp.lr.MustAdd(lmp.cp.TenantID, timestamp, fields, streamFieldsLen)
+	tenantID := lmp.cp.TenantID
+	if lmp.pl != nil {
+		var ok bool
+		tenantID, fields, streamFieldsLen, ok = lmp.pl.apply(&lmp.plBuf, tenantID, fields, streamFieldsLen)
+		if !ok {
+			return
+		}
+	}
+
+	if len(lmp.rps) > 0 {
+		var ok bool
+		fields, ok = applyRowProcessors(lmp.rps, &lmp.rpsBuf, tenantID, timestamp, fields)
+		if !ok {
+			return
+		}
+	}
+
+	if ls := loadShedderGlobal; ls != nil && ls.shouldDrop(fields, n) {
+		return
+	}
+
+	lmp.lr.MustAdd(tenantID, timestamp, fields, streamFieldsLen)
 
+	if drr := lmp.cp.DryRun; drr != nil {
+		drr.addRow(lmp.lr)
+		lmp.lr.ResetKeepSettings()
+		return
+	}
 	if lmp.cp.Debug {
 		s := lmp.lr.GetRowString(0)
 		lmp.lr.ResetKeepSettings()
@@ -261,6 +414,22 @@ func (lmp *logMessageProcessor) AddRow(timestamp int64, fields []logstorage.Fiel
 	}
 }
 
+// TooManyFieldsRows implements RejectedRowsCounter interface.
+func (lmp *logMessageProcessor) TooManyFieldsRows() int64 {
+	return lmp.tooManyFieldsRows.Load()
+}
+
+// checkMaxFieldsPerLine returns false and logs the dropped row if fields exceed -insert.maxFieldsPerLine.
+func checkMaxFieldsPerLine(fields []logstorage.Field) bool {
+	if len(fields) <= *MaxFieldsPerLine {
+		return true
+	}
+	line := logstorage.MarshalFieldsToJSON(nil, fields)
+	logger.Warnf("dropping log line with %d fields; it exceeds -insert.maxFieldsPerLine=%d; %s", len(fields), *MaxFieldsPerLine, line)
+	rowsDroppedTotalTooManyFields.Inc()
+	return false
+}
+
 // InsertRowProcessor is used by native data ingestion protocol parser.
 type InsertRowProcessor interface {
 	// AddInsertRow must add r to the underlying storage.
@@ -270,13 +439,12 @@ type InsertRowProcessor interface {
 // AddInsertRow adds r to lmp.
 func (lmp *logMessageProcessor) AddInsertRow(r *logstorage.InsertRow) {
 	lmp.rowsIngestedTotal.Inc()
+	lmp.getIngestionMetrics(r.TenantID).rowsIngested.Inc()
 	n := logstorage.EstimatedJSONRowLen(r.Fields)
 	lmp.bytesIngestedTotal.Add(n)
 
-	if len(r.Fields) > *MaxFieldsPerLine {
-		line := logstorage.MarshalFieldsToJSON(nil, r.Fields)
-		logger.Warnf("dropping log line with %d fields; it exceeds -insert.maxFieldsPerLine=%d; %s", len(r.Fields), *MaxFieldsPerLine, line)
-		rowsDroppedTotalTooManyFields.Inc()
+	if !checkMaxFieldsPerLine(r.Fields) {
+		lmp.tooManyFieldsRows.Add(1)
 		return
 	}
 
@@ -285,6 +453,11 @@ func (lmp *logMessageProcessor) AddInsertRow(r *logstorage.InsertRow) {
 
 	lmp.lr.MustAddInsertRow(r)
 
+	if drr := lmp.cp.DryRun; drr != nil {
+		drr.addRow(lmp.lr)
+		lmp.lr.ResetKeepSettings()
+		return
+	}
 	if lmp.cp.Debug {
 		s := lmp.lr.GetRowString(0)
 		lmp.lr.ResetKeepSettings()
@@ -297,10 +470,32 @@ func (lmp *logMessageProcessor) AddInsertRow(r *logstorage.InsertRow) {
 	}
 }
 
+// getIngestionMetrics returns ingestion metrics for the given tenantID.
+//
+// Rows ingested via native protocol may belong to distinct tenants, so the metrics are obtained per each tenant.
+func (lmp *logMessageProcessor) getIngestionMetrics(tenantID logstorage.TenantID) *IngestionMetrics {
+	lmp.mu.Lock()
+	defer lmp.mu.Unlock()
+
+	if lmp.imTenantID != tenantID {
+		lmp.im = GetIngestionMetrics(lmp.protocolName, tenantID)
+		lmp.imTenantID = tenantID
+	}
+	return lmp.im
+}
+
 // flushLocked must be called under locked lmp.mu.
 func (lmp *logMessageProcessor) flushLocked() {
+	if lmp.cp.DryRun != nil {
+		// Nothing to flush, since the rows aren't stored in dry-run mode.
+		return
+	}
+
 	start := time.Now()
 	lmp.lastFlushTime = start
+	for _, watcher := range logRowsWatchers {
+		watcher.WatchLogRows(lmp.lr)
+	}
 	logRowsStorage.MustAddRows(lmp.lr)
 	lmp.lr.ResetKeepSettings()
 	lmp.flushDuration.UpdateDuration(start)
@@ -314,6 +509,7 @@ func (lmp *logMessageProcessor) MustClose() {
 	lmp.flushLocked()
 	logstorage.PutLogRows(lmp.lr)
 	lmp.lr = nil
+	lmp.plBuf.reset()
 	messageProcessorCount.Add(-1)
 }
 
@@ -322,17 +518,33 @@ func (lmp *logMessageProcessor) MustClose() {
 // MustClose() must be called on the returned LogMessageProcessor when it is no longer needed.
 func (cp *CommonParams) NewLogMessageProcessor(protocolName string, isStreamMode bool) LogMessageProcessor {
 	lr := logstorage.GetLogRows(cp.StreamFields, cp.IgnoreFields, cp.DecolorizeFields, cp.ExtraFields, *defaultMsgValue)
+	if sl := streamLimiterGlobal; sl != nil {
+		lr.SetStreamLimiter(sl)
+	}
 	rowsIngestedTotal := metrics.GetOrCreateCounter(fmt.Sprintf("vl_rows_ingested_total{type=%q}", protocolName))
 	bytesIngestedTotal := metrics.GetOrCreateCounter(fmt.Sprintf("vl_bytes_ingested_total{type=%q}", protocolName))
 	flushDuration := metrics.GetOrCreateSummary(fmt.Sprintf("vl_insert_flush_duration_seconds{type=%q}", protocolName))
+	pl := cp.Pipeline
+	if pl == nil {
+		pl = getPipeline(protocolName, cp.TenantID)
+	}
 	lmp := &logMessageProcessor{
 		cp: cp,
 		lr: lr,
 
+		rps: getRowProcessors(protocolName, cp.TenantID),
+		pl:  pl,
+
 		rowsIngestedTotal:  rowsIngestedTotal,
 		bytesIngestedTotal: bytesIngestedTotal,
 		flushDuration:      flushDuration,
 
+		protocolName: protocolName,
+		im:           cp.GetIngestionMetrics(protocolName),
+		imTenantID:   cp.TenantID,
+
+		preview: ingestPreviewGlobal.getRing(cp.TenantID, protocolName),
+
 		stopCh: make(chan struct{}),
 	}
 
@@ -355,3 +567,35 @@ var (
 func IsJSONContentType(ct string) bool {
 	return ct == "application/json" || strings.HasPrefix(ct, "application/json;")
 }
+
+// AppendInsertRowFields appends r fields to dst in the form suitable for logstorage.Filter.MatchRow and returns the result.
+//
+// The appended fields include _time and _stream fields. The _time value is stored in timestampBuf, which is returned as the second value.
+func AppendInsertRowFields(dst []logstorage.Field, timestampBuf []byte, r *logstorage.InsertRow) ([]logstorage.Field, []byte) {
+	timestampBuf = time.Unix(0, r.Timestamp).UTC().AppendFormat(timestampBuf, time.RFC3339Nano)
+	dst = append(dst, logstorage.Field{
+		Name:  "_time",
+		Value: bytesutil.ToUnsafeString(timestampBuf),
+	}, logstorage.Field{
+		Name:  "_stream",
+		Value: getStreamString(r.StreamTagsCanonical),
+	})
+	for _, f := range r.Fields {
+		if f.Name == "" {
+			// The _msg field is stored with empty name.
+			f.Name = "_msg"
+		}
+		dst = append(dst, f)
+	}
+	return dst, timestampBuf
+}
+
+func getStreamString(streamTagsCanonical string) string {
+	st := logstorage.GetStreamTags()
+	defer logstorage.PutStreamTags(st)
+
+	if _, err := st.UnmarshalCanonical(bytesutil.ToUnsafeBytes(streamTagsCanonical)); err != nil {
+		logger.Panicf("BUG: cannot unmarshal streamTagsCanonical: %s", err)
+	}
+	return st.String()
+}
@@ -0,0 +1,30 @@
+package insertutil
+
+import (
+	"errors"
+)
+
+// CheckConfig verifies command-line flags and config files for data ingestion.
+//
+// It doesn't change the state initialized via MustInit* functions from this package, so it can be used for -configCheck.
+func CheckConfig() error {
+	var errs []error
+	if _, err := loadTenantDefaults(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := newStreamLimiterFromFlags(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := loadPriorityRules(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := loadPipelines(); err != nil {
+		errs = append(errs, err)
+	}
+	if rpcs, err := parseRowProcessorFlags(); err != nil {
+		errs = append(errs, err)
+	} else {
+		mustCloseRowProcessorConfigs(rpcs)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,168 @@
+package insertutil
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	vmmetrics "github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	decompressionMaxConcurrency = flag.Int("insert.decompression.maxConcurrency", 0, "The maximum number of concurrently decompressed data ingestion requests per endpoint. "+
+		"Compressed requests over this limit wait in the queue limited by -insert.decompression.maxQueueSize. "+
+		"By default the limit equals to the number of available CPU cores. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#decompression-limits")
+	decompressionMaxQueueSize = flag.Int("insert.decompression.maxQueueSize", 100, "The maximum number of compressed data ingestion requests per endpoint, "+
+		"which can wait for decompression because of -insert.decompression.maxConcurrency limit. "+
+		"Requests over this limit are rejected with 429 status code. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#decompression-limits")
+	decompressionMaxQueueDuration = flag.Duration("insert.decompression.maxQueueDuration", 30*time.Second, "The maximum duration a compressed data ingestion request "+
+		"can wait for decompression because of -insert.decompression.maxConcurrency limit. "+
+		"Requests waiting for longer duration are rejected with 429 status code. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#decompression-limits")
+)
+
+// ReadUncompressedData reads the data from r, decompresses it according to the given encoding and calls the callback for the decompressed data.
+//
+// The number of concurrent decompressions for the given endpoint is limited by -insert.decompression.maxConcurrency,
+// since every decompression may occupy up to maxDataSize of memory until the callback returns.
+// Uncompressed requests aren't limited.
+func ReadUncompressedData(endpoint string, r io.Reader, encoding string, maxDataSize *flagutil.Bytes, callback func(data []byte) error) error {
+	if !isCompressedEncoding(encoding) {
+		return protoparserutil.ReadUncompressedData(r, encoding, maxDataSize, callback)
+	}
+
+	dl := getDecompressionLimiter(endpoint)
+	if err := dl.acquire(); err != nil {
+		return err
+	}
+	defer dl.release()
+
+	return protoparserutil.ReadUncompressedData(r, encoding, maxDataSize, callback)
+}
+
+func isCompressedEncoding(encoding string) bool {
+	switch encoding {
+	case "", "none", "identity":
+		return false
+	default:
+		return true
+	}
+}
+
+var (
+	decompressionLimitersLock sync.Mutex
+	decompressionLimiters     = make(map[string]*decompressionLimiter)
+)
+
+func getDecompressionLimiter(endpoint string) *decompressionLimiter {
+	decompressionLimitersLock.Lock()
+	defer decompressionLimitersLock.Unlock()
+
+	dl := decompressionLimiters[endpoint]
+	if dl == nil {
+		maxConcurrency := *decompressionMaxConcurrency
+		if maxConcurrency <= 0 {
+			maxConcurrency = cgroup.AvailableCPUs()
+		}
+		dl = newDecompressionLimiter(endpoint, maxConcurrency, *decompressionMaxQueueSize, *decompressionMaxQueueDuration)
+		decompressionLimiters[endpoint] = dl
+	}
+	return dl
+}
+
+// decompressionLimiter limits the number of concurrent decompressions for a single data ingestion endpoint.
+type decompressionLimiter struct {
+	endpoint string
+
+	// concurrencyCh contains a token per every in-progress decompression.
+	concurrencyCh chan struct{}
+
+	maxQueueSize     int
+	maxQueueDuration time.Duration
+
+	// queueSize is the number of requests waiting for a free slot in concurrencyCh.
+	queueSize atomic.Int64
+
+	rejectedQueueFull *vmmetrics.Counter
+	rejectedTimeout   *vmmetrics.Counter
+	waitDuration      *vmmetrics.Summary
+}
+
+func newDecompressionLimiter(endpoint string, maxConcurrency, maxQueueSize int, maxQueueDuration time.Duration) *decompressionLimiter {
+	dl := &decompressionLimiter{
+		endpoint:         endpoint,
+		concurrencyCh:    make(chan struct{}, maxConcurrency),
+		maxQueueSize:     maxQueueSize,
+		maxQueueDuration: maxQueueDuration,
+
+		rejectedQueueFull: vmmetrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_decompression_rejected_total{endpoint=%q,reason="queue_full"}`, endpoint)),
+		rejectedTimeout:   vmmetrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_decompression_rejected_total{endpoint=%q,reason="timeout"}`, endpoint)),
+		waitDuration:      vmmetrics.GetOrCreateSummary(fmt.Sprintf(`vl_insert_decompression_queue_wait_duration_seconds{endpoint=%q}`, endpoint)),
+	}
+	_ = vmmetrics.GetOrCreateGauge(fmt.Sprintf(`vl_insert_decompression_queue_size{endpoint=%q}`, endpoint), func() float64 {
+		return float64(dl.queueSize.Load())
+	})
+	_ = vmmetrics.GetOrCreateGauge(fmt.Sprintf(`vl_insert_decompression_concurrency{endpoint=%q}`, endpoint), func() float64 {
+		return float64(len(dl.concurrencyCh))
+	})
+	_ = vmmetrics.GetOrCreateGauge(fmt.Sprintf(`vl_insert_decompression_max_concurrency{endpoint=%q}`, endpoint), func() float64 {
+		return float64(cap(dl.concurrencyCh))
+	})
+	return dl
+}
+
+// acquire obtains a slot for decompression.
+//
+// It returns an error with http.StatusTooManyRequests status code if the slot cannot be obtained.
+// Otherwise release must be called after the decompressed data is processed.
+func (dl *decompressionLimiter) acquire() error {
+	// Fast path - there is a free slot.
+	select {
+	case dl.concurrencyCh <- struct{}{}:
+		return nil
+	default:
+	}
+
+	// Slow path - wait in the queue for a free slot.
+	n := dl.queueSize.Add(1)
+	defer dl.queueSize.Add(-1)
+	if n > int64(dl.maxQueueSize) {
+		dl.rejectedQueueFull.Inc()
+		return &httpserver.ErrorWithStatusCode{
+			Err: fmt.Errorf("cannot decompress the request because %d compressed requests for the endpoint %q are already waiting for decompression; "+
+				"retry the request later or increase -insert.decompression.maxQueueSize; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#decompression-limits",
+				dl.maxQueueSize, dl.endpoint),
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+
+	startTime := time.Now()
+	t := timerpool.Get(dl.maxQueueDuration)
+	defer timerpool.Put(t)
+	select {
+	case dl.concurrencyCh <- struct{}{}:
+		dl.waitDuration.UpdateDuration(startTime)
+		return nil
+	case <-t.C:
+		dl.rejectedTimeout.Inc()
+		return &httpserver.ErrorWithStatusCode{
+			Err: fmt.Errorf("cannot decompress the request for the endpoint %q during -insert.decompression.maxQueueDuration=%s because of -insert.decompression.maxConcurrency=%d limit; "+
+				"retry the request later; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#decompression-limits",
+				dl.endpoint, dl.maxQueueDuration, cap(dl.concurrencyCh)),
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+}
+
+// release releases the slot obtained via acquire.
+func (dl *decompressionLimiter) release() {
+	<-dl.concurrencyCh
+}
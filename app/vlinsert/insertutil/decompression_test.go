@@ -0,0 +1,109 @@
+package insertutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+func TestDecompressionLimiter(t *testing.T) {
+	dl := newDecompressionLimiter("test_decompression_limiter", 1, 1, 50*time.Millisecond)
+
+	expectTooManyRequests := func(err error) {
+		t.Helper()
+
+		var esc *httpserver.ErrorWithStatusCode
+		if !errors.As(err, &esc) || esc.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expecting error with status code %d; got %v", http.StatusTooManyRequests, err)
+		}
+	}
+
+	rejectedQueueFull := dl.rejectedQueueFull.Get()
+	rejectedTimeout := dl.rejectedTimeout.Get()
+
+	if err := dl.acquire(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The request must wait in the queue until the first request releases the slot.
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- dl.acquire()
+	}()
+	for dl.queueSize.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full, so the request must be rejected immediately.
+	expectTooManyRequests(dl.acquire())
+	if n := dl.rejectedQueueFull.Get() - rejectedQueueFull; n != 1 {
+		t.Fatalf("unexpected number of requests rejected because of full queue; got %d; want 1", n)
+	}
+
+	dl.release()
+	if err := <-waitCh; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := dl.queueSize.Load(); n != 0 {
+		t.Fatalf("unexpected queue size; got %d; want 0", n)
+	}
+
+	// The request must be rejected after waiting for maxQueueDuration.
+	expectTooManyRequests(dl.acquire())
+	if n := dl.rejectedTimeout.Get() - rejectedTimeout; n != 1 {
+		t.Fatalf("unexpected number of requests rejected because of timeout; got %d; want 1", n)
+	}
+
+	dl.release()
+	if n := len(dl.concurrencyCh); n != 0 {
+		t.Fatalf("unexpected number of in-progress decompressions; got %d; want 0", n)
+	}
+}
+
+func TestReadUncompressedData(t *testing.T) {
+	maxDataSize := &flagutil.Bytes{
+		N:    1024,
+		Name: "test.maxDataSize",
+	}
+
+	f := func(data []byte, encoding, resultExpected string) {
+		t.Helper()
+
+		var result string
+		err := ReadUncompressedData("test_read_uncompressed_data", bytes.NewReader(data), encoding, maxDataSize, func(data []byte) error {
+			result = string(data)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f([]byte("foo"), "", "foo")
+	f([]byte("foo"), "identity", "foo")
+
+	var bb bytes.Buffer
+	zw := gzip.NewWriter(&bb)
+	if _, err := zw.Write([]byte("bar")); err != nil {
+		t.Fatalf("cannot compress data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close gzip writer: %s", err)
+	}
+	f(bb.Bytes(), "gzip", "bar")
+
+	// The slot must be released after the decompression.
+	dl := getDecompressionLimiter("test_read_uncompressed_data")
+	if n := len(dl.concurrencyCh); n != 0 {
+		t.Fatalf("unexpected number of in-progress decompressions; got %d; want 0", n)
+	}
+}
@@ -0,0 +1,125 @@
+package insertutil
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+const (
+	// defaultDryRunLimit is the default number of log entries returned in the response for requests with dry_run=1.
+	defaultDryRunLimit = 10
+
+	// maxDryRunLimit is the maximum number of log entries, which can be returned in the response for requests with dry_run=1.
+	maxDryRunLimit = 1000
+)
+
+// DryRunResult collects log entries obtained from data ingestion requests with dry_run=1 query arg.
+//
+// Such log entries aren't stored in VictoriaLogs. Instead, the first log entries are returned to the client,
+// so it can verify how the log entries are parsed.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#dry-run
+type DryRunResult struct {
+	limit int
+
+	mu          sync.Mutex
+	rowsTotal   int
+	parseErrors int
+	rows        []string
+}
+
+// getDryRunResult returns DryRunResult for r if it contains dry_run=1 query arg or VL-Dry-Run: 1 header.
+//
+// nil is returned if r isn't a dry-run request.
+func getDryRunResult(r *http.Request) (*DryRunResult, error) {
+	dv := httputil.GetRequestValue(r, "dry_run", "VL-Dry-Run")
+	if dv == "" {
+		return nil, nil
+	}
+	dryRun, err := strconv.ParseBool(dv)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse dry_run=%q: %w", dv, err)
+	}
+	if !dryRun {
+		return nil, nil
+	}
+
+	limit := defaultDryRunLimit
+	if lv := httputil.GetRequestValue(r, "dry_run_limit", "VL-Dry-Run-Limit"); lv != "" {
+		n, err := strconv.Atoi(lv)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse dry_run_limit=%q: %w", lv, err)
+		}
+		if n < 0 || n > maxDryRunLimit {
+			return nil, fmt.Errorf("dry_run_limit=%d must be in the range [0...%d]", n, maxDryRunLimit)
+		}
+		limit = n
+	}
+
+	drr := &DryRunResult{
+		limit: limit,
+	}
+	return drr, nil
+}
+
+// addRow registers the last row from lr at drr.
+func (drr *DryRunResult) addRow(lr *logstorage.LogRows) {
+	n := lr.RowsCount()
+	if n == 0 {
+		// The row has been dropped by lr, for example, because of stream limits.
+		return
+	}
+
+	drr.mu.Lock()
+	defer drr.mu.Unlock()
+
+	drr.rowsTotal++
+	if len(drr.rows) < drr.limit {
+		drr.rows = append(drr.rows, lr.GetRowString(n-1))
+	}
+	rowsDroppedTotalDryRun.Inc()
+}
+
+// AddParseErrors registers n parse errors at drr.
+//
+// It must be called by data ingestion protocols, which skip invalid log entries instead of failing the whole request.
+func (drr *DryRunResult) AddParseErrors(n int) {
+	drr.mu.Lock()
+	drr.parseErrors += n
+	drr.mu.Unlock()
+}
+
+// WriteResponse writes drr to w in JSON.
+//
+// The response contains the total number of log entries, which would be stored without dry_run=1, the number of parse errors
+// and up to dry_run_limit first log entries with _time and _stream fields derived from the request params.
+func (drr *DryRunResult) WriteResponse(w http.ResponseWriter) {
+	drr.mu.Lock()
+	defer drr.mu.Unlock()
+
+	var b []byte
+	b = append(b, `{"rows_total":`...)
+	b = strconv.AppendInt(b, int64(drr.rowsTotal), 10)
+	b = append(b, `,"parse_errors":`...)
+	b = strconv.AppendInt(b, int64(drr.parseErrors), 10)
+	b = append(b, `,"rows":[`...)
+	for i, row := range drr.rows {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, row...)
+	}
+	b = append(b, "]}\n"...)
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+var rowsDroppedTotalDryRun = metrics.NewCounter(`vl_rows_dropped_total{reason="dry_run"}`)
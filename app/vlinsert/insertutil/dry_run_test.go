@@ -0,0 +1,100 @@
+package insertutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestGetDryRunResultFailure(t *testing.T) {
+	f := func(args string) {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodPost, "http://localhost/insert/jsonline?"+args, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		drr, err := getDryRunResult(r)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if drr != nil {
+			t.Fatalf("expecting nil DryRunResult; got %v", drr)
+		}
+	}
+
+	f("dry_run=foo")
+	f("dry_run=1&dry_run_limit=foo")
+	f("dry_run=1&dry_run_limit=-1")
+	f("dry_run=1&dry_run_limit=1001")
+}
+
+func TestGetDryRunResultSuccess(t *testing.T) {
+	f := func(args string, limitExpected int) {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodPost, "http://localhost/insert/jsonline?"+args, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		drr, err := getDryRunResult(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if limitExpected < 0 {
+			if drr != nil {
+				t.Fatalf("expecting nil DryRunResult; got %v", drr)
+			}
+			return
+		}
+		if drr == nil {
+			t.Fatalf("expecting non-nil DryRunResult")
+		}
+		if drr.limit != limitExpected {
+			t.Fatalf("unexpected limit; got %d; want %d", drr.limit, limitExpected)
+		}
+	}
+
+	f("", -1)
+	f("dry_run=0", -1)
+	f("dry_run=1", defaultDryRunLimit)
+	f("dry_run=true&dry_run_limit=0", 0)
+	f("dry_run=1&dry_run_limit=2", 2)
+}
+
+func TestDryRunResult(t *testing.T) {
+	cp := &CommonParams{
+		TimeFields:   []string{"_time"},
+		StreamFields: []string{"host"},
+		DryRun: &DryRunResult{
+			limit: 2,
+		},
+	}
+	lmp := cp.NewLogMessageProcessor("test_dry_run", false)
+	for i, msg := range []string{"foo", "bar", "baz"} {
+		ts := time.Date(2025, 1, 2, 3, 4, 5+i, 0, time.UTC).UnixNano()
+		lmp.AddRow(ts, []logstorage.Field{
+			{Name: "_msg", Value: msg},
+			{Name: "host", Value: "h1"},
+		}, -1)
+	}
+	lmp.MustClose()
+
+	cp.DryRun.AddParseErrors(3)
+
+	w := httptest.NewRecorder()
+	cp.DryRun.WriteResponse(w)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("unexpected Content-Type; got %q; want %q", ct, "application/json")
+	}
+	responseExpected := `{"rows_total":3,"parse_errors":3,"rows":[` +
+		`{"_msg":"foo","_stream":"{host=\"h1\"}","_time":"2025-01-02T03:04:05Z","host":"h1"},` +
+		`{"_msg":"bar","_stream":"{host=\"h1\"}","_time":"2025-01-02T03:04:06Z","host":"h1"}]}` + "\n"
+	if response := w.Body.String(); response != responseExpected {
+		t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", response, responseExpected)
+	}
+}
@@ -0,0 +1,254 @@
+package insertutil
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/valyala/quicktemplate"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	ingestPreviewSamples = flag.Int("insert.previewSamples", 0, "The number of the last ingested log entries to keep in memory per each (tenant, data ingestion protocol) pair. "+
+		"The kept log entries can be inspected via /admin/ingest_preview endpoint. Ingestion preview is disabled if this flag is set to 0. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#ingestion-preview")
+	ingestPreviewAuthKey = flagutil.NewPassword("ingestPreviewAuthKey", "authKey, which must be passed in query string to /admin/ingest_preview . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#ingestion-preview")
+)
+
+// maxIngestPreviewValueLen is the maximum length of field values kept for ingestion preview.
+//
+// Longer values are truncated in order to limit memory usage.
+const maxIngestPreviewValueLen = 1024
+
+// ingestPreviewKey is the key for the ingestion preview ring buffer.
+type ingestPreviewKey struct {
+	tenantID     logstorage.TenantID
+	protocolName string
+}
+
+// ingestPreviewSample is a log entry kept for ingestion preview.
+type ingestPreviewSample struct {
+	// ingestedAt is the time when the log entry has been received.
+	ingestedAt int64
+
+	// timestamp is the log entry timestamp obtained during parsing.
+	timestamp int64
+
+	// fields contains JSON-encoded log fields as they have been received before applying the data ingestion params.
+	fields []byte
+}
+
+// ingestPreviewRing is a ring buffer with the last ingested log entries for the given ingestPreviewKey.
+type ingestPreviewRing struct {
+	mu      sync.Mutex
+	samples []ingestPreviewSample
+	next    int
+}
+
+func (ipr *ingestPreviewRing) add(timestamp int64, fields []logstorage.Field) {
+	ipr.mu.Lock()
+	defer ipr.mu.Unlock()
+
+	if len(ipr.samples) < cap(ipr.samples) {
+		ipr.samples = append(ipr.samples, ingestPreviewSample{})
+	}
+	s := &ipr.samples[ipr.next]
+	ipr.next++
+	if ipr.next >= cap(ipr.samples) {
+		ipr.next = 0
+	}
+
+	s.ingestedAt = time.Now().UnixNano()
+	s.timestamp = timestamp
+	s.fields = marshalIngestPreviewFields(s.fields[:0], fields)
+}
+
+// getSamples appends the samples from ipr to dst in the order they were added and returns the result.
+func (ipr *ingestPreviewRing) getSamples(dst []ingestPreviewSample) []ingestPreviewSample {
+	ipr.mu.Lock()
+	defer ipr.mu.Unlock()
+
+	n := len(ipr.samples)
+	if n < cap(ipr.samples) {
+		// The ring buffer isn't full yet.
+		for _, s := range ipr.samples {
+			dst = append(dst, s.clone())
+		}
+		return dst
+	}
+	for i := 0; i < n; i++ {
+		s := &ipr.samples[(ipr.next+i)%n]
+		dst = append(dst, s.clone())
+	}
+	return dst
+}
+
+func (s *ingestPreviewSample) clone() ingestPreviewSample {
+	return ingestPreviewSample{
+		ingestedAt: s.ingestedAt,
+		timestamp:  s.timestamp,
+		fields:     append([]byte{}, s.fields...),
+	}
+}
+
+// marshalIngestPreviewFields appends JSON-encoded fields to dst and returns the result.
+//
+// Field values are truncated to maxIngestPreviewValueLen bytes.
+func marshalIngestPreviewFields(dst []byte, fields []logstorage.Field) []byte {
+	dst = append(dst, '{')
+	for i, f := range fields {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		v := f.Value
+		if len(v) > maxIngestPreviewValueLen {
+			v = v[:maxIngestPreviewValueLen] + "..."
+		}
+		dst = quicktemplate.AppendJSONString(dst, f.Name, true)
+		dst = append(dst, ':')
+		dst = quicktemplate.AppendJSONString(dst, v, true)
+	}
+	dst = append(dst, '}')
+	return dst
+}
+
+// ingestPreview holds ingestion preview ring buffers per each ingestPreviewKey.
+type ingestPreview struct {
+	samplesPerKey int
+
+	mu    sync.Mutex
+	rings map[ingestPreviewKey]*ingestPreviewRing
+}
+
+var ingestPreviewGlobal = &ingestPreview{
+	rings: make(map[ingestPreviewKey]*ingestPreviewRing),
+}
+
+// getRing returns the ring buffer for the given tenantID and protocolName.
+//
+// nil is returned if ingestion preview is disabled.
+func (ip *ingestPreview) getRing(tenantID logstorage.TenantID, protocolName string) *ingestPreviewRing {
+	samplesPerKey := ip.samplesPerKey
+	if samplesPerKey <= 0 {
+		samplesPerKey = *ingestPreviewSamples
+	}
+	if samplesPerKey <= 0 {
+		return nil
+	}
+
+	k := ingestPreviewKey{
+		tenantID:     tenantID,
+		protocolName: protocolName,
+	}
+
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+
+	ipr := ip.rings[k]
+	if ipr == nil {
+		ipr = &ingestPreviewRing{
+			samples: make([]ingestPreviewSample, 0, samplesPerKey),
+		}
+		ip.rings[k] = ipr
+	}
+	return ipr
+}
+
+// marshalJSON appends JSON representation of ip samples for the given optional tenantID and protocolName to dst and returns the result.
+func (ip *ingestPreview) marshalJSON(dst []byte, tenantID *logstorage.TenantID, protocolName string) []byte {
+	ip.mu.Lock()
+	keys := make([]ingestPreviewKey, 0, len(ip.rings))
+	rings := make(map[ingestPreviewKey]*ingestPreviewRing, len(ip.rings))
+	for k, ipr := range ip.rings {
+		if tenantID != nil && k.tenantID != *tenantID {
+			continue
+		}
+		if protocolName != "" && k.protocolName != protocolName {
+			continue
+		}
+		keys = append(keys, k)
+		rings[k] = ipr
+	}
+	ip.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := &keys[i], &keys[j]
+		if a.tenantID.AccountID != b.tenantID.AccountID {
+			return a.tenantID.AccountID < b.tenantID.AccountID
+		}
+		if a.tenantID.ProjectID != b.tenantID.ProjectID {
+			return a.tenantID.ProjectID < b.tenantID.ProjectID
+		}
+		return a.protocolName < b.protocolName
+	})
+
+	var samples []ingestPreviewSample
+	dst = append(dst, '[')
+	for i, k := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, `{"tenant":"`...)
+		dst = strconv.AppendUint(dst, uint64(k.tenantID.AccountID), 10)
+		dst = append(dst, ':')
+		dst = strconv.AppendUint(dst, uint64(k.tenantID.ProjectID), 10)
+		dst = append(dst, `","protocol":`...)
+		dst = quicktemplate.AppendJSONString(dst, k.protocolName, true)
+		dst = append(dst, `,"samples":[`...)
+		samples = rings[k].getSamples(samples[:0])
+		for j := range samples {
+			s := &samples[j]
+			if j > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, `{"ingested_at":"`...)
+			dst = time.Unix(0, s.ingestedAt).UTC().AppendFormat(dst, time.RFC3339Nano)
+			dst = append(dst, `","timestamp":"`...)
+			dst = time.Unix(0, s.timestamp).UTC().AppendFormat(dst, time.RFC3339Nano)
+			dst = append(dst, `","fields":`...)
+			dst = append(dst, s.fields...)
+			dst = append(dst, '}')
+		}
+		dst = append(dst, "]}"...)
+	}
+	dst = append(dst, ']')
+	return dst
+}
+
+// ProcessIngestPreviewRequest processes /admin/ingest_preview request.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#ingestion-preview
+func ProcessIngestPreviewRequest(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.CheckAuthFlag(w, r, ingestPreviewAuthKey) {
+		return
+	}
+	if *ingestPreviewSamples <= 0 {
+		httpserver.Errorf(w, r, "ingestion preview is disabled; set -insert.previewSamples command-line flag to a positive value in order to enable it")
+		return
+	}
+
+	var tenantID *logstorage.TenantID
+	if logstorage.HasTenantInRequest(r) {
+		tid, err := logstorage.GetTenantIDFromRequest(r)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot obtain tenantID: %s", err)
+			return
+		}
+		tenantID = &tid
+	}
+	protocolName := r.FormValue("protocol")
+
+	data := ingestPreviewGlobal.marshalJSON(nil, tenantID, protocolName)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok","data":%s}`, data)
+}
@@ -0,0 +1,66 @@
+package insertutil
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestIngestPreview(t *testing.T) {
+	ip := &ingestPreview{
+		samplesPerKey: 2,
+		rings:         make(map[ingestPreviewKey]*ingestPreviewRing),
+	}
+
+	tenant0 := logstorage.TenantID{}
+	tenant1 := logstorage.TenantID{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+	addRows := func(tenantID logstorage.TenantID, protocolName string, msgs ...string) {
+		ipr := ip.getRing(tenantID, protocolName)
+		for i, msg := range msgs {
+			ts := time.Date(2025, 1, 2, 3, 4, 5+i, 0, time.UTC).UnixNano()
+			ipr.add(ts, []logstorage.Field{
+				{Name: "message", Value: msg},
+			})
+		}
+	}
+	addRows(tenant1, "jsonline", "foo")
+	addRows(tenant0, "jsonline", "a", "b", "c")
+	addRows(tenant0, "elasticsearch_bulk", strings.Repeat("x", maxIngestPreviewValueLen+10))
+
+	// The ingested_at values depend on the current time, so they are replaced with a constant.
+	reIngestedAt := regexp.MustCompile(`"ingested_at":"[^"]+"`)
+
+	f := func(tenantID *logstorage.TenantID, protocolName, resultExpected string) {
+		t.Helper()
+
+		data := ip.marshalJSON(nil, tenantID, protocolName)
+		result := reIngestedAt.ReplaceAllString(string(data), `"ingested_at":"X"`)
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	longValue := strings.Repeat("x", maxIngestPreviewValueLen) + "..."
+
+	// all the samples
+	f(nil, "", `[`+
+		`{"tenant":"0:0","protocol":"elasticsearch_bulk","samples":[{"ingested_at":"X","timestamp":"2025-01-02T03:04:05Z","fields":{"message":"`+longValue+`"}}]},`+
+		`{"tenant":"0:0","protocol":"jsonline","samples":[{"ingested_at":"X","timestamp":"2025-01-02T03:04:06Z","fields":{"message":"b"}},{"ingested_at":"X","timestamp":"2025-01-02T03:04:07Z","fields":{"message":"c"}}]},`+
+		`{"tenant":"1:2","protocol":"jsonline","samples":[{"ingested_at":"X","timestamp":"2025-01-02T03:04:05Z","fields":{"message":"foo"}}]}`+
+		`]`)
+
+	// filter by tenant
+	f(&tenant1, "", `[{"tenant":"1:2","protocol":"jsonline","samples":[{"ingested_at":"X","timestamp":"2025-01-02T03:04:05Z","fields":{"message":"foo"}}]}]`)
+
+	// filter by protocol
+	f(nil, "elasticsearch_bulk", `[{"tenant":"0:0","protocol":"elasticsearch_bulk","samples":[{"ingested_at":"X","timestamp":"2025-01-02T03:04:05Z","fields":{"message":"`+longValue+`"}}]}]`)
+
+	// no matching samples
+	f(&tenant1, "loki_json", `[]`)
+}
@@ -0,0 +1,243 @@
+package insertutil
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var ingestSelftestAuthKey = flagutil.NewPassword("ingestSelftestAuthKey", "authKey, which must be passed in query string to /debug/ingest_selftest . "+
+	"The endpoint is disabled if this flag isn't set. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#ingestion-self-test")
+
+const (
+	// maxIngestSelftestDuration is the maximum duration of a single ingestion self-test.
+	maxIngestSelftestDuration = 5 * time.Minute
+
+	// ingestSelftestTickInterval is the interval for generating logs at the target rate.
+	ingestSelftestTickInterval = 100 * time.Millisecond
+)
+
+// ingestSelftestInProgress is set to true while the ingestion self-test is running.
+//
+// Only a single self-test may run at a time in order to limit the additional load on the system.
+var ingestSelftestInProgress atomic.Bool
+
+// ingestSelftestArgs contains args for the ingestion self-test.
+type ingestSelftestArgs struct {
+	// rate is the target number of log entries per second. Logs are generated as fast as possible if rate is zero.
+	rate float64
+
+	// duration is the duration of the self-test.
+	duration time.Duration
+
+	// streams is the number of log streams to generate.
+	streams int
+
+	// cardinality is the number of unique values for the trace_id field.
+	cardinality int
+}
+
+func parseIngestSelftestArgs(r *http.Request) (*ingestSelftestArgs, error) {
+	a := &ingestSelftestArgs{
+		rate:        1000,
+		duration:    10 * time.Second,
+		streams:     10,
+		cardinality: 1000,
+	}
+
+	if s := r.FormValue("rate"); s != "" {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("cannot parse rate=%q; it must be a non-negative number", s)
+		}
+		a.rate = rate
+	}
+	if s := r.FormValue("duration"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("cannot parse duration=%q; it must be a positive duration such as 30s", s)
+		}
+		if d > maxIngestSelftestDuration {
+			return nil, fmt.Errorf("duration=%s cannot exceed %s", d, maxIngestSelftestDuration)
+		}
+		a.duration = d
+	}
+	if s := r.FormValue("streams"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("cannot parse streams=%q; it must be a positive integer", s)
+		}
+		a.streams = n
+	}
+	if s := r.FormValue("cardinality"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("cannot parse cardinality=%q; it must be a positive integer", s)
+		}
+		a.cardinality = n
+	}
+	return a, nil
+}
+
+// ProcessIngestSelftestRequest handles /debug/ingest_selftest request.
+//
+// It ingests synthetic logs at the given rate during the given duration and returns the achieved ingestion rate.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#ingestion-self-test
+func ProcessIngestSelftestRequest(w http.ResponseWriter, r *http.Request) {
+	if ingestSelftestAuthKey.Get() == "" {
+		httpserver.Errorf(w, r, "ingestion self-test is disabled; set -ingestSelftestAuthKey command-line flag in order to enable it")
+		return
+	}
+	if !httpserver.CheckAuthFlag(w, r, ingestSelftestAuthKey) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpserver.Errorf(w, r, "unsupported method %s; use POST", r.Method)
+		return
+	}
+
+	a, err := parseIngestSelftestArgs(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	cp, err := GetCommonParams(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if err := CanWriteData(); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	if !ingestSelftestInProgress.CompareAndSwap(false, true) {
+		httpserver.Errorf(w, r, "another ingestion self-test is already in progress")
+		return
+	}
+	defer ingestSelftestInProgress.Store(false)
+
+	runID := fmt.Sprintf("%016x", rand.Uint64())
+	lmp := cp.NewLogMessageProcessor("selftest", true)
+	startTime := time.Now()
+	rows, bytes := runIngestSelftest(lmp, a, runID)
+	lmp.MustClose()
+	d := time.Since(startTime).Seconds()
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok","run_id":%q,"tenant":"%d:%d","rows":%d,"bytes":%d,"duration_seconds":%.3f,"target_rate":%g,"achieved_rate":%.3f}`,
+		runID, cp.TenantID.AccountID, cp.TenantID.ProjectID, rows, bytes, d, a.rate, float64(rows)/d)
+}
+
+// runIngestSelftest generates synthetic logs according to a and passes them to lmp.
+//
+// It returns the number of generated rows and their size in bytes.
+func runIngestSelftest(lmp LogMessageProcessor, a *ingestSelftestArgs, runID string) (uint64, uint64) {
+	g := newIngestSelftestGenerator(a, runID)
+
+	startTime := time.Now()
+	deadline := startTime.Add(a.duration)
+	if a.rate <= 0 {
+		for time.Now().Before(deadline) {
+			for i := 0; i < 1000; i++ {
+				g.addRow(lmp, time.Now().UnixNano())
+			}
+		}
+		return g.rows, g.bytes
+	}
+
+	t := time.NewTicker(ingestSelftestTickInterval)
+	defer t.Stop()
+	for {
+		<-t.C
+		ct := time.Now()
+		if ct.After(deadline) {
+			ct = deadline
+		}
+		n := uint64(a.rate*ct.Sub(startTime).Seconds()) - g.rows
+		timestamp := ct.UnixNano()
+		for i := uint64(0); i < n; i++ {
+			g.addRow(lmp, timestamp)
+		}
+		if !ct.Before(deadline) {
+			return g.rows, g.bytes
+		}
+	}
+}
+
+// ingestSelftestGenerator generates synthetic log entries for the ingestion self-test.
+type ingestSelftestGenerator struct {
+	a     *ingestSelftestArgs
+	runID string
+
+	rows  uint64
+	bytes uint64
+
+	fields []logstorage.Field
+	buf    []byte
+}
+
+func newIngestSelftestGenerator(a *ingestSelftestArgs, runID string) *ingestSelftestGenerator {
+	return &ingestSelftestGenerator{
+		a:     a,
+		runID: runID,
+	}
+}
+
+var ingestSelftestLevels = []string{"info", "info", "info", "info", "info", "info", "warn", "warn", "error", "debug"}
+
+var ingestSelftestMessages = []string{
+	"GET /api/v1/users/%d HTTP/1.1 200",
+	"POST /api/v1/orders/%d HTTP/1.1 201",
+	"cannot connect to database replica %d: connection refused",
+	"processed batch %d in 12ms",
+	"cache miss for key user:%d",
+}
+
+// addRow generates a synthetic log entry with the given timestamp and passes it to lmp.
+//
+// The first two fields - host and app - are used as log stream fields.
+func (g *ingestSelftestGenerator) addRow(lmp LogMessageProcessor, timestamp int64) {
+	streamID := g.rows % uint64(g.a.streams)
+	n := rand.Intn(g.a.cardinality)
+
+	buf := g.buf[:0]
+	bufLen := len(buf)
+	buf = fmt.Appendf(buf, "host-%d", streamID)
+	host := bytesutil.ToUnsafeString(buf[bufLen:])
+	bufLen = len(buf)
+	buf = fmt.Appendf(buf, ingestSelftestMessages[n%len(ingestSelftestMessages)], n)
+	msg := bytesutil.ToUnsafeString(buf[bufLen:])
+	bufLen = len(buf)
+	buf = fmt.Appendf(buf, "%016x", n)
+	traceID := bytesutil.ToUnsafeString(buf[bufLen:])
+	g.buf = buf
+
+	fields := append(g.fields[:0],
+		logstorage.Field{Name: "host", Value: host},
+		logstorage.Field{Name: "app", Value: "selftest"},
+		logstorage.Field{Name: "_msg", Value: msg},
+		logstorage.Field{Name: "level", Value: ingestSelftestLevels[rand.Intn(len(ingestSelftestLevels))]},
+		logstorage.Field{Name: "trace_id", Value: traceID},
+		logstorage.Field{Name: "selftest_run_id", Value: g.runID},
+	)
+	g.fields = fields
+
+	lmp.AddRow(timestamp, fields, 2)
+
+	g.rows++
+	for _, f := range fields {
+		g.bytes += uint64(len(f.Name) + len(f.Value))
+	}
+}
@@ -0,0 +1,104 @@
+package insertutil
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParseIngestSelftestArgs_Success(t *testing.T) {
+	f := func(query string, aExpected *ingestSelftestArgs) {
+		t.Helper()
+
+		r := httptest.NewRequest("POST", "/debug/ingest_selftest?"+query, nil)
+		a, err := parseIngestSelftestArgs(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if *a != *aExpected {
+			t.Fatalf("unexpected args; got %+v; want %+v", a, aExpected)
+		}
+	}
+
+	f("", &ingestSelftestArgs{
+		rate:        1000,
+		duration:    10 * time.Second,
+		streams:     10,
+		cardinality: 1000,
+	})
+	f("rate=0&duration=1m&streams=100&cardinality=5", &ingestSelftestArgs{
+		rate:        0,
+		duration:    time.Minute,
+		streams:     100,
+		cardinality: 5,
+	})
+}
+
+func TestParseIngestSelftestArgs_Failure(t *testing.T) {
+	f := func(query string) {
+		t.Helper()
+
+		r := httptest.NewRequest("POST", "/debug/ingest_selftest?"+query, nil)
+		if _, err := parseIngestSelftestArgs(r); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f("rate=foo")
+	f("rate=-1")
+	f("duration=foo")
+	f("duration=0s")
+	f("duration=1h")
+	f("streams=0")
+	f("cardinality=-5")
+}
+
+func TestIngestSelftestGenerator(t *testing.T) {
+	a := &ingestSelftestArgs{
+		streams:     3,
+		cardinality: 2,
+	}
+	g := newIngestSelftestGenerator(a, "abc")
+
+	var lmp selftestLogMessageProcessor
+	for i := 0; i < 100; i++ {
+		g.addRow(&lmp, 123)
+	}
+
+	if g.rows != 100 {
+		t.Fatalf("unexpected number of rows; got %d; want 100", g.rows)
+	}
+	if len(lmp.hosts) != 3 {
+		t.Fatalf("unexpected number of hosts; got %d; want 3", len(lmp.hosts))
+	}
+	if len(lmp.traceIDs) != 2 {
+		t.Fatalf("unexpected number of trace_id values; got %d; want 2", len(lmp.traceIDs))
+	}
+}
+
+type selftestLogMessageProcessor struct {
+	hosts    map[string]struct{}
+	traceIDs map[string]struct{}
+}
+
+func (lmp *selftestLogMessageProcessor) AddRow(_ int64, fields []logstorage.Field, streamFieldsLen int) {
+	if streamFieldsLen != 2 || fields[0].Name != "host" || fields[1].Name != "app" {
+		panic("BUG: unexpected stream fields")
+	}
+	if lmp.hosts == nil {
+		lmp.hosts = make(map[string]struct{})
+		lmp.traceIDs = make(map[string]struct{})
+	}
+	lmp.hosts[strings.Clone(fields[0].Value)] = struct{}{}
+	for _, f := range fields {
+		if f.Name == "trace_id" {
+			lmp.traceIDs[strings.Clone(f.Value)] = struct{}{}
+		}
+	}
+}
+
+func (lmp *selftestLogMessageProcessor) MustClose() {
+}
@@ -0,0 +1,102 @@
+package insertutil
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// IngestionMetrics contains ingestion metrics for the particular data ingestion protocol and tenant.
+//
+// See https://docs.victoriametrics.com/victorialogs/metrics/#data-ingestion-metrics
+type IngestionMetrics struct {
+	rowsIngested      *metrics.Counter
+	receivedBytes     *metrics.Counter
+	uncompressedBytes *metrics.Counter
+	parseErrors       *metrics.Counter
+}
+
+type ingestionMetricsKey struct {
+	protocolName string
+	tenantID     logstorage.TenantID
+}
+
+var (
+	ingestionMetricsMap     = make(map[ingestionMetricsKey]*IngestionMetrics)
+	ingestionMetricsMapLock sync.Mutex
+)
+
+// GetIngestionMetrics returns ingestion metrics for the given protocolName and tenantID.
+func GetIngestionMetrics(protocolName string, tenantID logstorage.TenantID) *IngestionMetrics {
+	k := ingestionMetricsKey{
+		protocolName: protocolName,
+		tenantID:     tenantID,
+	}
+
+	ingestionMetricsMapLock.Lock()
+	defer ingestionMetricsMapLock.Unlock()
+
+	im := ingestionMetricsMap[k]
+	if im == nil {
+		labels := fmt.Sprintf(`type=%q,accountID="%d",projectID="%d"`, protocolName, tenantID.AccountID, tenantID.ProjectID)
+		im = &IngestionMetrics{
+			rowsIngested:      metrics.GetOrCreateCounter(`vl_insert_rows_total{` + labels + `}`),
+			receivedBytes:     metrics.GetOrCreateCounter(`vl_insert_received_bytes_total{` + labels + `}`),
+			uncompressedBytes: metrics.GetOrCreateCounter(`vl_insert_uncompressed_bytes_total{` + labels + `}`),
+			parseErrors:       metrics.GetOrCreateCounter(`vl_insert_parse_errors_total{` + labels + `}`),
+		}
+		ingestionMetricsMap[k] = im
+	}
+	return im
+}
+
+// GetIngestionMetrics returns ingestion metrics for the given protocolName and cp.TenantID.
+func (cp *CommonParams) GetIngestionMetrics(protocolName string) *IngestionMetrics {
+	return GetIngestionMetrics(protocolName, cp.TenantID)
+}
+
+// NewReceivedBytesReader returns a reader, which counts the bytes read from r as received bytes before decompression.
+func (im *IngestionMetrics) NewReceivedBytesReader(r io.Reader) io.Reader {
+	return &countingReader{
+		r: r,
+		c: im.receivedBytes,
+	}
+}
+
+// NewUncompressedBytesReader returns a reader, which counts the bytes read from r as bytes after decompression.
+func (im *IngestionMetrics) NewUncompressedBytesReader(r io.Reader) io.Reader {
+	return &countingReader{
+		r: r,
+		c: im.uncompressedBytes,
+	}
+}
+
+// AddReceivedBytes registers n received bytes before decompression.
+func (im *IngestionMetrics) AddReceivedBytes(n int) {
+	im.receivedBytes.Add(n)
+}
+
+// AddUncompressedBytes registers n bytes after decompression.
+func (im *IngestionMetrics) AddUncompressedBytes(n int) {
+	im.uncompressedBytes.Add(n)
+}
+
+// AddParseErrors registers n errors during parsing of the ingested data.
+func (im *IngestionMetrics) AddParseErrors(n int) {
+	im.parseErrors.Add(n)
+}
+
+type countingReader struct {
+	r io.Reader
+	c *metrics.Counter
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.c.Add(n)
+	return n, err
+}
@@ -0,0 +1,49 @@
+package insertutil
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestIngestionMetrics(t *testing.T) {
+	tenantID := logstorage.TenantID{
+		AccountID: 12,
+		ProjectID: 34,
+	}
+	im := GetIngestionMetrics("test_ingestion_metrics", tenantID)
+	if im2 := GetIngestionMetrics("test_ingestion_metrics", tenantID); im2 != im {
+		t.Fatalf("expecting the same ingestion metrics for the same protocol and tenant")
+	}
+	if im2 := GetIngestionMetrics("test_ingestion_metrics", logstorage.TenantID{}); im2 == im {
+		t.Fatalf("expecting distinct ingestion metrics for distinct tenants")
+	}
+
+	data := []byte("foo bar baz")
+	r := im.NewUncompressedBytesReader(im.NewReceivedBytesReader(bytes.NewReader(data)))
+	result, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(result, data) {
+		t.Fatalf("unexpected data read; got %q; want %q", result, data)
+	}
+	if n := im.receivedBytes.Get(); n != uint64(len(data)) {
+		t.Fatalf("unexpected received bytes; got %d; want %d", n, len(data))
+	}
+	if n := im.uncompressedBytes.Get(); n != uint64(len(data)) {
+		t.Fatalf("unexpected uncompressed bytes; got %d; want %d", n, len(data))
+	}
+
+	im.AddUncompressedBytes(5)
+	if n := im.uncompressedBytes.Get(); n != uint64(len(data)+5) {
+		t.Fatalf("unexpected uncompressed bytes; got %d; want %d", n, len(data)+5)
+	}
+
+	im.AddParseErrors(3)
+	if n := im.parseErrors.Get(); n != 3 {
+		t.Fatalf("unexpected parse errors; got %d; want 3", n)
+	}
+}
@@ -0,0 +1,238 @@
+package insertutil
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	priorityRulesFile = flag.String("insert.priorityRulesFile", "", "Optional path to a file with rules for assigning priority classes to the ingested logs. "+
+		"Logs with lower priority are dropped first when memory usage exceeds -insert.loadShedding.memoryPercent. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#load-shedding")
+	loadSheddingMemoryPercent = flag.Float64("insert.loadShedding.memoryPercent", 70, "Memory usage in percent of the available memory, after which the ingested logs "+
+		"are dropped according to their priority classes from -insert.priorityRulesFile. Logs with critical priority are never dropped. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#load-shedding")
+)
+
+// priorityClass is the priority class of the ingested logs for load shedding.
+type priorityClass int
+
+const (
+	priorityLow priorityClass = iota
+	priorityNormal
+	priorityHigh
+	priorityCritical
+)
+
+var priorityClassNames = [...]string{
+	priorityLow:      "low",
+	priorityNormal:   "normal",
+	priorityHigh:     "high",
+	priorityCritical: "critical",
+}
+
+// priorityClassSheddingStart contains the load level in the range [0..1], after which logs with the given priority class start to be dropped.
+//
+// Logs with critical priority are never dropped.
+var priorityClassSheddingStart = [...]float64{
+	priorityLow:      0,
+	priorityNormal:   0.5,
+	priorityHigh:     0.75,
+	priorityCritical: 1,
+}
+
+func (pc priorityClass) String() string {
+	return priorityClassNames[pc]
+}
+
+func parsePriorityClass(s string) (priorityClass, error) {
+	for pc, name := range priorityClassNames {
+		if s == name {
+			return priorityClass(pc), nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported priority %q; supported values: low, normal, high, critical", s)
+}
+
+// PriorityRule assigns the priority class to the ingested logs matching the given filter.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#load-shedding
+type PriorityRule struct {
+	// Filter is LogsQL filter for selecting logs with the given priority.
+	Filter string `yaml:"filter"`
+
+	// Priority is the priority class for the selected logs - low, normal, high or critical.
+	Priority string `yaml:"priority"`
+
+	f  *logstorage.Filter
+	pc priorityClass
+}
+
+type priorityRulesConfig struct {
+	// DefaultPriority is the priority class for logs, which do not match any rule. By default normal priority is used.
+	DefaultPriority string `yaml:"default_priority,omitempty"`
+
+	Rules []*PriorityRule `yaml:"rules"`
+}
+
+// loadShedder drops the ingested logs according to their priority classes when the memory usage is too high.
+type loadShedder struct {
+	rules           []*PriorityRule
+	defaultPriority priorityClass
+
+	rowsDropped  [len(priorityClassNames)]*metrics.Counter
+	bytesDropped [len(priorityClassNames)]*metrics.Counter
+}
+
+// loadShedderGlobal is the load shedder configured via -insert.priorityRulesFile.
+//
+// It is nil if load shedding isn't configured.
+var loadShedderGlobal *loadShedder
+
+// MustInitLoadShedding initializes load shedding according to -insert.priorityRulesFile.
+//
+// This function must be called before using LogMessageProcessor from this package.
+func MustInitLoadShedding() {
+	if *priorityRulesFile == "" {
+		loadShedderGlobal = nil
+		return
+	}
+	ls, err := loadPriorityRules()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	for pc, name := range priorityClassNames {
+		ls.rowsDropped[pc] = metrics.GetOrCreateCounter(fmt.Sprintf(`vl_rows_dropped_total{reason="load_shedding",priority=%q}`, name))
+		ls.bytesDropped[pc] = metrics.GetOrCreateCounter(fmt.Sprintf(`vl_bytes_dropped_total{reason="load_shedding",priority=%q}`, name))
+
+		pc := priorityClass(pc)
+		_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vl_insert_load_shedding_drop_ratio{priority=%q}`, name), func() float64 {
+			return getSheddingProbability(pc, getLoadLevel(getMemoryUsageRatio()))
+		})
+	}
+
+	loadShedderGlobal = ls
+	logger.Infof("loaded %d priority rules for load shedding from -insert.priorityRulesFile=%q", len(ls.rules), *priorityRulesFile)
+}
+
+// loadPriorityRules loads load shedding rules from -insert.priorityRulesFile.
+//
+// nil is returned if -insert.priorityRulesFile isn't set.
+func loadPriorityRules() (*loadShedder, error) {
+	if *priorityRulesFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(*priorityRulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -insert.priorityRulesFile: %w", err)
+	}
+	ls, err := parsePriorityRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.priorityRulesFile=%q: %w", *priorityRulesFile, err)
+	}
+	if *hardMemoryPercent <= 0 {
+		return nil, fmt.Errorf("-insert.priorityRulesFile requires -insert.admission.hardMemoryPercent to be set")
+	}
+	if *loadSheddingMemoryPercent >= *hardMemoryPercent {
+		return nil, fmt.Errorf("-insert.loadShedding.memoryPercent=%v must be smaller than -insert.admission.hardMemoryPercent=%v", *loadSheddingMemoryPercent, *hardMemoryPercent)
+	}
+	return ls, nil
+}
+
+func parsePriorityRules(data []byte) (*loadShedder, error) {
+	var cfg priorityRulesConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	ls := &loadShedder{
+		rules:           cfg.Rules,
+		defaultPriority: priorityNormal,
+	}
+	if cfg.DefaultPriority != "" {
+		pc, err := parsePriorityClass(cfg.DefaultPriority)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse default_priority: %w", err)
+		}
+		ls.defaultPriority = pc
+	}
+	for i, rule := range cfg.Rules {
+		if rule.Filter == "" {
+			return nil, fmt.Errorf("missing filter in the rule #%d", i+1)
+		}
+		f, err := logstorage.ParseFilter(rule.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse filter in the rule #%d: %w", i+1, err)
+		}
+		pc, err := parsePriorityClass(rule.Priority)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse priority in the rule #%d: %w", i+1, err)
+		}
+		rule.f = f
+		rule.pc = pc
+	}
+	return ls, nil
+}
+
+// getPriority returns the priority class for the log entry with the given fields.
+//
+// The priority is obtained from the first matching rule.
+func (ls *loadShedder) getPriority(fields []logstorage.Field) priorityClass {
+	for _, rule := range ls.rules {
+		if rule.f.MatchRow(fields) {
+			return rule.pc
+		}
+	}
+	return ls.defaultPriority
+}
+
+// shouldDrop returns true if the log entry with the given fields must be dropped because of high memory usage.
+func (ls *loadShedder) shouldDrop(fields []logstorage.Field, rowLen int) bool {
+	load := getLoadLevel(getMemoryUsageRatio())
+	if load <= 0 {
+		// Fast path - there is no need in matching priority rules.
+		return false
+	}
+
+	pc := ls.getPriority(fields)
+	p := getSheddingProbability(pc, load)
+	if p <= 0 || rand.Float64() >= p {
+		return false
+	}
+	ls.rowsDropped[pc].Inc()
+	ls.bytesDropped[pc].Add(rowLen)
+	return true
+}
+
+// getLoadLevel returns the load level in the range [0..1] for the given memoryUsageRatio.
+//
+// The load level grows linearly from 0 at -insert.loadShedding.memoryPercent to 1 at -insert.admission.hardMemoryPercent.
+func getLoadLevel(memoryUsageRatio float64) float64 {
+	start := *loadSheddingMemoryPercent / 100
+	end := *hardMemoryPercent / 100
+	if memoryUsageRatio <= start || end <= start {
+		return 0
+	}
+	return min((memoryUsageRatio-start)/(end-start), 1)
+}
+
+// getSheddingProbability returns the probability of dropping logs with the given priority class at the given load level.
+func getSheddingProbability(pc priorityClass, load float64) float64 {
+	if pc == priorityCritical {
+		return 0
+	}
+	start := priorityClassSheddingStart[pc]
+	if load <= start {
+		return 0
+	}
+	return (load - start) / (1 - start)
+}
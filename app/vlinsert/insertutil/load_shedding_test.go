@@ -0,0 +1,138 @@
+package insertutil
+
+import (
+	"math"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParsePriorityRules_Failure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		if _, err := parsePriorityRules([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid yaml
+	f("foo")
+
+	// unknown field
+	f(`rules: [{filter: "error", priority: low, foo: bar}]`)
+
+	// missing filter
+	f(`rules: [{priority: low}]`)
+
+	// invalid filter
+	f(`rules: [{filter: "foo(", priority: low}]`)
+
+	// filter with pipes
+	f(`rules: [{filter: "error | limit 10", priority: low}]`)
+
+	// invalid priority
+	f(`rules: [{filter: "error", priority: foo}]`)
+	f(`rules: [{filter: "error"}]`)
+
+	// invalid default priority
+	f(`default_priority: foo`)
+}
+
+func TestLoadShedderGetPriority(t *testing.T) {
+	data := `
+default_priority: low
+rules:
+- filter: 'app:=audit or level:error'
+  priority: critical
+- filter: 'env:=prod'
+  priority: high
+- filter: 'env:=staging'
+  priority: normal
+`
+	ls, err := parsePriorityRules([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := func(fields []logstorage.Field, pcExpected priorityClass) {
+		t.Helper()
+
+		pc := ls.getPriority(fields)
+		if pc != pcExpected {
+			t.Fatalf("unexpected priority for %s; got %s; want %s", fields, pc, pcExpected)
+		}
+	}
+
+	f([]logstorage.Field{{Name: "app", Value: "audit"}, {Name: "env", Value: "dev"}}, priorityCritical)
+	f([]logstorage.Field{{Name: "level", Value: "error"}, {Name: "env", Value: "prod"}}, priorityCritical)
+	f([]logstorage.Field{{Name: "level", Value: "info"}, {Name: "env", Value: "prod"}}, priorityHigh)
+	f([]logstorage.Field{{Name: "env", Value: "staging"}}, priorityNormal)
+	f([]logstorage.Field{{Name: "env", Value: "dev"}}, priorityLow)
+	f(nil, priorityLow)
+}
+
+func TestGetLoadLevel(t *testing.T) {
+	defer func(start, hard float64) {
+		*loadSheddingMemoryPercent = start
+		*hardMemoryPercent = hard
+	}(*loadSheddingMemoryPercent, *hardMemoryPercent)
+
+	f := func(memoryUsageRatio, loadExpected float64) {
+		t.Helper()
+
+		load := getLoadLevel(memoryUsageRatio)
+		if math.Abs(load-loadExpected) > 1e-9 {
+			t.Fatalf("unexpected load level for memoryUsageRatio=%v; got %v; want %v", memoryUsageRatio, load, loadExpected)
+		}
+	}
+
+	*loadSheddingMemoryPercent = 70
+	*hardMemoryPercent = 90
+
+	f(0, 0)
+	f(0.7, 0)
+	f(0.75, 0.25)
+	f(0.8, 0.5)
+	f(0.9, 1)
+	f(1.5, 1)
+
+	// load shedding is disabled
+	*hardMemoryPercent = 0
+	f(0.8, 0)
+}
+
+func TestGetSheddingProbability(t *testing.T) {
+	f := func(pc priorityClass, load, pExpected float64) {
+		t.Helper()
+
+		p := getSheddingProbability(pc, load)
+		if math.Abs(p-pExpected) > 1e-9 {
+			t.Fatalf("unexpected probability for priority=%s, load=%v; got %v; want %v", pc, load, p, pExpected)
+		}
+	}
+
+	// no load
+	f(priorityLow, 0, 0)
+	f(priorityNormal, 0, 0)
+	f(priorityHigh, 0, 0)
+	f(priorityCritical, 0, 0)
+
+	// medium load
+	f(priorityLow, 0.5, 0.5)
+	f(priorityNormal, 0.5, 0)
+	f(priorityHigh, 0.5, 0)
+	f(priorityCritical, 0.5, 0)
+
+	// high load
+	f(priorityLow, 0.875, 0.875)
+	f(priorityNormal, 0.875, 0.75)
+	f(priorityHigh, 0.875, 0.5)
+	f(priorityCritical, 0.875, 0)
+
+	// max load
+	f(priorityLow, 1, 1)
+	f(priorityNormal, 1, 1)
+	f(priorityHigh, 1, 1)
+	f(priorityCritical, 1, 0)
+}
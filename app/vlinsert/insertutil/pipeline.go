@@ -0,0 +1,439 @@
+package insertutil
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+var pipelineFile = flag.String("insert.pipelineFile", "", "Optional path to a file with transformation pipelines for the ingested logs. "+
+	"Pipelines may drop and rename fields, parse JSON in _msg, add static fields, drop logs and route them to other tenants before storing them. "+
+	"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#transformation-pipelines")
+
+// Pipeline is a transformation pipeline, which is applied to the ingested logs before storing them.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#transformation-pipelines
+type Pipeline struct {
+	// Name is the pipeline name, which can be passed via `pipeline` query arg or via `VL-Pipeline` request header.
+	Name string `yaml:"name"`
+
+	// Match is an optional selector for the logs the pipeline is applied to by default.
+	//
+	// If it is missing, then the pipeline is applied only to requests with the pipeline name.
+	Match *PipelineMatch `yaml:"match,omitempty"`
+
+	// Steps contains transformation steps, which are applied in order.
+	Steps []*PipelineStep `yaml:"steps"`
+}
+
+// PipelineMatch selects the logs the pipeline is applied to by default.
+type PipelineMatch struct {
+	// Protocols is an optional list of data ingestion protocols. Protocols are matched by prefix, so `syslog` matches all the syslog protocols.
+	Protocols []string `yaml:"protocols,omitempty"`
+
+	// Tenants is an optional list of tenants in the form AccountID:ProjectID or AccountID.
+	Tenants []string `yaml:"tenants,omitempty"`
+
+	tenantIDs []logstorage.TenantID
+}
+
+// PipelineStep is a single transformation step.
+//
+// Every step must contain exactly one action.
+type PipelineStep struct {
+	// If is an optional LogsQL filter. The step is applied only to logs matching the filter.
+	If string `yaml:"if,omitempty"`
+
+	// DropFields contains the names of fields to drop. Names may end with '*' in order to drop all the fields with the given prefix.
+	DropFields []string `yaml:"drop_fields,omitempty"`
+
+	// RenameFields maps old field names to new field names. Existing fields with the new names are overwritten.
+	RenameFields map[string]string `yaml:"rename_fields,omitempty"`
+
+	// ParseJSON parses JSON object from the given field into log fields.
+	ParseJSON *PipelineParseJSON `yaml:"parse_json,omitempty"`
+
+	// AddFields contains static fields to add to logs. Existing fields with the same names are overwritten.
+	AddFields map[string]string `yaml:"add_fields,omitempty"`
+
+	// SetTenant is the tenant in the form AccountID:ProjectID or AccountID to route logs to.
+	SetTenant string `yaml:"set_tenant,omitempty"`
+
+	// Drop drops logs if set to true.
+	Drop bool `yaml:"drop,omitempty"`
+
+	f           *logstorage.Filter
+	addFields   []logstorage.Field
+	setTenantID logstorage.TenantID
+}
+
+// PipelineParseJSON is the configuration for parse_json step.
+type PipelineParseJSON struct {
+	// Field is the name of the field with JSON object to parse. By default _msg field is parsed.
+	Field string `yaml:"field,omitempty"`
+
+	// Prefix is an optional prefix to add to the names of the parsed fields.
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+type pipelinesConfig struct {
+	Pipelines []*Pipeline `yaml:"pipelines"`
+}
+
+// pipelinesGlobal contains pipelines loaded from -insert.pipelineFile.
+//
+// It is read-only after MustInitPipelines call.
+var pipelinesGlobal []*Pipeline
+
+// MustInitPipelines loads transformation pipelines from -insert.pipelineFile.
+//
+// This function must be called before using GetCommonParams and LogMessageProcessor from this package.
+func MustInitPipelines() {
+	if *pipelineFile == "" {
+		pipelinesGlobal = nil
+		return
+	}
+	pls, err := loadPipelines()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	pipelinesGlobal = pls
+	logger.Infof("loaded %d transformation pipelines from -insert.pipelineFile=%q", len(pls), *pipelineFile)
+}
+
+func loadPipelines() ([]*Pipeline, error) {
+	if *pipelineFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(*pipelineFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -insert.pipelineFile: %w", err)
+	}
+	pls, err := parsePipelines(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.pipelineFile=%q: %w", *pipelineFile, err)
+	}
+	return pls, nil
+}
+
+func parsePipelines(data []byte) ([]*Pipeline, error) {
+	var cfg pipelinesConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{}, len(cfg.Pipelines))
+	for i, pl := range cfg.Pipelines {
+		if pl.Name == "" {
+			return nil, fmt.Errorf("missing name in the pipeline #%d", i+1)
+		}
+		if _, ok := names[pl.Name]; ok {
+			return nil, fmt.Errorf("duplicate pipeline name %q", pl.Name)
+		}
+		names[pl.Name] = struct{}{}
+
+		if err := pl.init(); err != nil {
+			return nil, fmt.Errorf("cannot initialize pipeline %q: %w", pl.Name, err)
+		}
+	}
+	return cfg.Pipelines, nil
+}
+
+func (pl *Pipeline) init() error {
+	if pm := pl.Match; pm != nil {
+		for _, s := range pm.Tenants {
+			tenantID, err := logstorage.ParseTenantID(s)
+			if err != nil {
+				return fmt.Errorf("cannot parse tenant at match section: %w", err)
+			}
+			pm.tenantIDs = append(pm.tenantIDs, tenantID)
+		}
+	}
+	if len(pl.Steps) == 0 {
+		return fmt.Errorf("missing steps")
+	}
+	for i, ps := range pl.Steps {
+		if err := ps.init(); err != nil {
+			return fmt.Errorf("cannot initialize step #%d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (ps *PipelineStep) init() error {
+	if ps.If != "" {
+		f, err := logstorage.ParseFilter(ps.If)
+		if err != nil {
+			return fmt.Errorf("cannot parse `if` filter: %w", err)
+		}
+		ps.f = f
+	}
+
+	actions := 0
+	if len(ps.DropFields) > 0 {
+		actions++
+	}
+	if len(ps.RenameFields) > 0 {
+		for oldName, newName := range ps.RenameFields {
+			if oldName == "" || newName == "" {
+				return fmt.Errorf("field names cannot be empty at rename_fields")
+			}
+		}
+		actions++
+	}
+	if pj := ps.ParseJSON; pj != nil {
+		if pj.Field == "" {
+			pj.Field = "_msg"
+		}
+		actions++
+	}
+	if len(ps.AddFields) > 0 {
+		// Sort fields by name in order to get deterministic order of the added fields.
+		for name, value := range ps.AddFields {
+			if name == "" {
+				return fmt.Errorf("field name cannot be empty at add_fields")
+			}
+			ps.addFields = append(ps.addFields, logstorage.Field{
+				Name:  name,
+				Value: value,
+			})
+		}
+		sort.Slice(ps.addFields, func(i, j int) bool {
+			return ps.addFields[i].Name < ps.addFields[j].Name
+		})
+		actions++
+	}
+	if ps.SetTenant != "" {
+		tenantID, err := logstorage.ParseTenantID(ps.SetTenant)
+		if err != nil {
+			return fmt.Errorf("cannot parse set_tenant: %w", err)
+		}
+		ps.setTenantID = tenantID
+		actions++
+	}
+	if ps.Drop {
+		actions++
+	}
+
+	if actions != 1 {
+		return fmt.Errorf("the step must contain exactly one action from drop_fields, rename_fields, parse_json, add_fields, set_tenant or drop; got %d actions", actions)
+	}
+	return nil
+}
+
+func (pm *PipelineMatch) matches(protocolName string, tenantID logstorage.TenantID) bool {
+	if len(pm.Protocols) > 0 {
+		ok := slices.ContainsFunc(pm.Protocols, func(p string) bool {
+			return strings.HasPrefix(protocolName, p)
+		})
+		if !ok {
+			return false
+		}
+	}
+	return len(pm.tenantIDs) == 0 || slices.Contains(pm.tenantIDs, tenantID)
+}
+
+// getPipelineFromRequest returns the pipeline with the name from `pipeline` query arg or `VL-Pipeline` request header.
+//
+// nil is returned if the pipeline name isn't set in r.
+func getPipelineFromRequest(r *http.Request) (*Pipeline, error) {
+	name := httputil.GetRequestValue(r, "pipeline", "VL-Pipeline")
+	if name == "" {
+		return nil, nil
+	}
+	for _, pl := range pipelinesGlobal {
+		if pl.Name == name {
+			return pl, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown pipeline=%q; see -insert.pipelineFile", name)
+}
+
+// getPipeline returns the first pipeline from -insert.pipelineFile with the match section matching the given protocolName and tenantID.
+//
+// nil is returned if there are no matching pipelines.
+func getPipeline(protocolName string, tenantID logstorage.TenantID) *Pipeline {
+	for _, pl := range pipelinesGlobal {
+		if pl.Match != nil && pl.Match.matches(protocolName, tenantID) {
+			return pl
+		}
+	}
+	return nil
+}
+
+// pipelineBuf holds buffers for applying the pipeline to a single log entry.
+//
+// It cannot be used concurrently.
+type pipelineBuf struct {
+	fields []logstorage.Field
+
+	// jps contains JSON parsers per every parse_json step, since the parsed fields must remain valid until the end of the pipeline.
+	jps []*logstorage.JSONParser
+
+	keyBuf []byte
+}
+
+func (pb *pipelineBuf) reset() {
+	clear(pb.fields)
+	pb.fields = pb.fields[:0]
+	for _, jp := range pb.jps {
+		logstorage.PutJSONParser(jp)
+	}
+	clear(pb.jps)
+	pb.jps = pb.jps[:0]
+	pb.keyBuf = pb.keyBuf[:0]
+}
+
+// apply applies pl to the log entry with the given tenantID, fields and streamFieldsLen.
+//
+// It returns the resulting tenantID, fields and streamFieldsLen. The returned fields are valid until the next call to pb.reset().
+// It returns false if the log entry must be dropped.
+func (pl *Pipeline) apply(pb *pipelineBuf, tenantID logstorage.TenantID, fields []logstorage.Field, streamFieldsLen int) (logstorage.TenantID, []logstorage.Field, int, bool) {
+	pb.reset()
+	pb.fields = append(pb.fields, fields...)
+
+	for _, ps := range pl.Steps {
+		if ps.f != nil && !ps.f.MatchRow(pb.fields) {
+			continue
+		}
+		switch {
+		case len(ps.DropFields) > 0:
+			pb.fields, streamFieldsLen = deleteFields(pb.fields, streamFieldsLen, func(name string) bool {
+				return prefixfilter.MatchFilters(ps.DropFields, name)
+			})
+		case len(ps.RenameFields) > 0:
+			pb.fields, streamFieldsLen = renameFields(pb.fields, streamFieldsLen, ps.RenameFields)
+		case ps.ParseJSON != nil:
+			pb.parseJSON(ps.ParseJSON)
+		case len(ps.addFields) > 0:
+			for _, f := range ps.addFields {
+				pb.fields = setField(pb.fields, f.Name, f.Value)
+			}
+		case ps.SetTenant != "":
+			tenantID = ps.setTenantID
+		case ps.Drop:
+			rowsDroppedTotalPipeline.Inc()
+			return tenantID, nil, 0, false
+		}
+	}
+	return tenantID, pb.fields, streamFieldsLen, true
+}
+
+// parseJSON parses JSON object from pj.Field into pb.fields. The field is left untouched if it doesn't contain JSON object.
+func (pb *pipelineBuf) parseJSON(pj *PipelineParseJSON) {
+	v := ""
+	for _, f := range pb.fields {
+		if f.Name == pj.Field {
+			v = f.Value
+			break
+		}
+	}
+	if v == "" || v[0] != '{' {
+		return
+	}
+
+	jp := logstorage.GetJSONParser()
+	if err := jp.ParseLogMessage(bytesutil.ToUnsafeBytes(v)); err != nil {
+		logstorage.PutJSONParser(jp)
+		return
+	}
+	pb.jps = append(pb.jps, jp)
+
+	for _, f := range jp.Fields {
+		name := f.Name
+		if pj.Prefix != "" {
+			keyBufLen := len(pb.keyBuf)
+			pb.keyBuf = append(pb.keyBuf, pj.Prefix...)
+			pb.keyBuf = append(pb.keyBuf, name...)
+			name = bytesutil.ToUnsafeString(pb.keyBuf[keyBufLen:])
+		}
+		pb.fields = setField(pb.fields, name, f.Value)
+	}
+}
+
+// deleteFields deletes fields matching the given needDelete func.
+//
+// It returns the remaining fields and the updated streamFieldsLen.
+func deleteFields(fields []logstorage.Field, streamFieldsLen int, needDelete func(name string) bool) ([]logstorage.Field, int) {
+	dst := fields[:0]
+	for i, f := range fields {
+		if needDelete(f.Name) {
+			if i < streamFieldsLen {
+				streamFieldsLen--
+			}
+			continue
+		}
+		dst = append(dst, f)
+	}
+	clear(fields[len(dst):])
+	return dst, streamFieldsLen
+}
+
+// renameFields renames fields according to renames.
+//
+// Fields with the new names, which aren't renamed, are dropped, so the renamed fields overwrite them.
+func renameFields(fields []logstorage.Field, streamFieldsLen int, renames map[string]string) ([]logstorage.Field, int) {
+	renamed := false
+	for _, f := range fields {
+		if _, ok := renames[f.Name]; ok {
+			renamed = true
+			break
+		}
+	}
+	if !renamed {
+		return fields, streamFieldsLen
+	}
+
+	// Drop the existing fields with the new names, since they are overwritten by the renamed fields.
+	newNames := make(map[string]struct{}, len(renames))
+	for _, f := range fields {
+		if newName, ok := renames[f.Name]; ok {
+			newNames[newName] = struct{}{}
+		}
+	}
+	fields, streamFieldsLen = deleteFields(fields, streamFieldsLen, func(name string) bool {
+		if _, ok := renames[name]; ok {
+			return false
+		}
+		_, ok := newNames[name]
+		return ok
+	})
+
+	for i := range fields {
+		f := &fields[i]
+		if newName, ok := renames[f.Name]; ok {
+			f.Name = newName
+		}
+	}
+	return fields, streamFieldsLen
+}
+
+// setField sets the field with the given name to the given value.
+//
+// The field is appended to fields if it is missing there.
+func setField(fields []logstorage.Field, name, value string) []logstorage.Field {
+	for i := range fields {
+		if fields[i].Name == name {
+			fields[i].Value = value
+			return fields
+		}
+	}
+	return append(fields, logstorage.Field{
+		Name:  name,
+		Value: value,
+	})
+}
+
+var rowsDroppedTotalPipeline = metrics.NewCounter(`vl_rows_dropped_total{reason="pipeline"}`)
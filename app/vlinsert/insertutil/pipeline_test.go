@@ -0,0 +1,191 @@
+package insertutil
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParsePipelines_Failure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		if _, err := parsePipelines([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid yaml
+	f("foo")
+
+	// unknown field
+	f(`pipelines: [{name: foo, steps: [{drop: true}], foo: bar}]`)
+	f(`pipelines: [{name: foo, steps: [{foo: bar}]}]`)
+
+	// missing name
+	f(`pipelines: [{steps: [{drop: true}]}]`)
+
+	// duplicate name
+	f(`pipelines: [{name: foo, steps: [{drop: true}]}, {name: foo, steps: [{drop: true}]}]`)
+
+	// missing steps
+	f(`pipelines: [{name: foo}]`)
+
+	// invalid tenant at match section
+	f(`pipelines: [{name: foo, match: {tenants: [bar]}, steps: [{drop: true}]}]`)
+
+	// invalid if filter
+	f(`pipelines: [{name: foo, steps: [{if: "foo(", drop: true}]}]`)
+
+	// missing action
+	f(`pipelines: [{name: foo, steps: [{if: "error"}]}]`)
+
+	// multiple actions
+	f(`pipelines: [{name: foo, steps: [{drop: true, drop_fields: [bar]}]}]`)
+
+	// empty field names
+	f(`pipelines: [{name: foo, steps: [{rename_fields: {"": bar}}]}]`)
+	f(`pipelines: [{name: foo, steps: [{rename_fields: {bar: ""}}]}]`)
+	f(`pipelines: [{name: foo, steps: [{add_fields: {"": bar}}]}]`)
+
+	// invalid set_tenant
+	f(`pipelines: [{name: foo, steps: [{set_tenant: bar}]}]`)
+}
+
+func TestPipelineApply(t *testing.T) {
+	data := `
+pipelines:
+- name: test
+  steps:
+  - drop: true
+    if: 'level:=debug'
+  - parse_json: {}
+  - parse_json:
+      field: req
+      prefix: req.
+  - drop_fields: [password, 'secret.*']
+  - rename_fields:
+      app: service
+      msg: _msg
+  - add_fields:
+      env: prod
+      dc: eu
+  - set_tenant: '12:34'
+    if: 'env:=prod service:=billing'
+`
+	pls, err := parsePipelines([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pl := pls[0]
+
+	var pb pipelineBuf
+	defer pb.reset()
+
+	tenantID := logstorage.TenantID{}
+
+	f := func(fields []logstorage.Field, streamFieldsLen int, resultExpected string, streamFieldsLenExpected int, tenantIDExpected logstorage.TenantID) {
+		t.Helper()
+
+		tid, result, n, ok := pl.apply(&pb, tenantID, fields, streamFieldsLen)
+		if !ok {
+			t.Fatalf("unexpected drop of the log entry")
+		}
+		if s := string(logstorage.MarshalFieldsToJSON(nil, result)); s != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", s, resultExpected)
+		}
+		if n != streamFieldsLenExpected {
+			t.Fatalf("unexpected streamFieldsLen; got %d; want %d", n, streamFieldsLenExpected)
+		}
+		if tid != tenantIDExpected {
+			t.Fatalf("unexpected tenant; got %s; want %s", tid, tenantIDExpected)
+		}
+	}
+
+	fDrop := func(fields []logstorage.Field) {
+		t.Helper()
+
+		if _, _, _, ok := pl.apply(&pb, tenantID, fields, -1); ok {
+			t.Fatalf("expecting the log entry to be dropped")
+		}
+	}
+
+	// plain text message
+	f([]logstorage.Field{
+		{Name: "_msg", Value: "foo bar"},
+		{Name: "password", Value: "qwerty"},
+	}, -1, `{"_msg":"foo bar","dc":"eu","env":"prod"}`, -1, tenantID)
+
+	// JSON message
+	f([]logstorage.Field{
+		{Name: "host", Value: "h1"},
+		{Name: "_msg", Value: `{"msg":"payment failed","app":"billing","secret":{"token":"abc"},"req":"{\"path\":\"/pay\"}"}`},
+	}, -1, `{"host":"h1","_msg":"payment failed","service":"billing","req":"{\"path\":\"/pay\"}","req.path":"/pay","dc":"eu","env":"prod"}`, -1, logstorage.TenantID{
+		AccountID: 12,
+		ProjectID: 34,
+	})
+
+	// stream fields are kept at their positions
+	f([]logstorage.Field{
+		{Name: "password", Value: "qwerty"},
+		{Name: "app", Value: "api"},
+		{Name: "_msg", Value: "foo"},
+		{Name: "service", Value: "bar"},
+	}, 2, `{"service":"api","_msg":"foo","dc":"eu","env":"prod"}`, 1, tenantID)
+
+	// dropped logs
+	fDrop([]logstorage.Field{
+		{Name: "level", Value: "debug"},
+		{Name: "_msg", Value: "foo"},
+	})
+	fDrop([]logstorage.Field{
+		{Name: "_msg", Value: `{"level":"info","msg":"foo"}`},
+		{Name: "level", Value: "debug"},
+	})
+}
+
+func TestPipelineMatch(t *testing.T) {
+	data := `
+pipelines:
+- name: explicit
+  steps:
+  - drop: true
+- name: jsonline
+  match:
+    protocols: [jsonline]
+    tenants: ['1:2']
+  steps:
+  - drop: true
+- name: syslog
+  match:
+    protocols: [syslog]
+  steps:
+  - drop: true
+`
+	pls, err := parsePipelines([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	pipelinesGlobal = pls
+	defer func() {
+		pipelinesGlobal = nil
+	}()
+
+	f := func(protocolName string, tenantID logstorage.TenantID, nameExpected string) {
+		t.Helper()
+
+		pl := getPipeline(protocolName, tenantID)
+		name := ""
+		if pl != nil {
+			name = pl.Name
+		}
+		if name != nameExpected {
+			t.Fatalf("unexpected pipeline for protocol=%q, tenant=%s; got %q; want %q", protocolName, tenantID, name, nameExpected)
+		}
+	}
+
+	f("jsonline", logstorage.TenantID{AccountID: 1, ProjectID: 2}, "jsonline")
+	f("jsonline", logstorage.TenantID{}, "")
+	f("syslog_tcp", logstorage.TenantID{}, "syslog")
+	f("loki", logstorage.TenantID{AccountID: 1, ProjectID: 2}, "")
+}
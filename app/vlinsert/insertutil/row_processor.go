@@ -0,0 +1,206 @@
+package insertutil
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var rowProcessorFlags = flagutil.NewArrayString("insert.rowProcessor", "Optional names of row processors to apply to every ingested log entry before storing it. "+
+	"Every item may contain optional filters in the form 'name?protocol=jsonline&tenant=accountID:projectID'. "+
+	"Row processors must be registered via insertutil.RegisterRowProcessor() when building VictoriaLogs or loaded from WebAssembly modules "+
+	"by passing the path to the .wasm file instead of the name; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#row-processors")
+
+// RowProcessor processes every ingested log entry before it is stored.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#row-processors
+type RowProcessor interface {
+	// ProcessRow must append the processed fields for the log entry with the given tenantID, timestamp and fields to dst and return the result.
+	//
+	// It must return false if the log entry must be dropped.
+	//
+	// The initial fields must be kept at their positions, since they may be used as log stream fields.
+	// The implementation cannot hold references to fields, since the caller can reuse them.
+	// The implementation must be safe for concurrent use by multiple goroutines.
+	ProcessRow(dst []logstorage.Field, tenantID logstorage.TenantID, timestamp int64, fields []logstorage.Field) ([]logstorage.Field, bool)
+}
+
+var (
+	rowProcessorsLock sync.Mutex
+	rowProcessors     = make(map[string]RowProcessor)
+)
+
+// RegisterRowProcessor registers rp under the given name, so it could be enabled via -insert.rowProcessor command-line flag.
+//
+// This function must be called from init() functions of the packages with RowProcessor implementations.
+func RegisterRowProcessor(name string, rp RowProcessor) {
+	rowProcessorsLock.Lock()
+	defer rowProcessorsLock.Unlock()
+
+	if _, ok := rowProcessors[name]; ok {
+		logger.Panicf("BUG: row processor %q is already registered", name)
+	}
+	rowProcessors[name] = rp
+}
+
+// rowProcessorConfig is a row processor enabled via -insert.rowProcessor command-line flag.
+type rowProcessorConfig struct {
+	name string
+	rp   RowProcessor
+
+	// wrp is set if rp is loaded from WebAssembly module.
+	wrp *wasmRowProcessor
+
+	// protocols is an optional list of protocols to apply rp to.
+	protocols []string
+
+	// tenantIDs is an optional list of tenants to apply rp to.
+	tenantIDs []logstorage.TenantID
+}
+
+func (rpc *rowProcessorConfig) matches(protocolName string, tenantID logstorage.TenantID) bool {
+	if len(rpc.protocols) > 0 {
+		// Match protocols by prefix, so all the syslog protocols could be matched with `protocol=syslog`.
+		ok := slices.ContainsFunc(rpc.protocols, func(p string) bool {
+			return strings.HasPrefix(protocolName, p)
+		})
+		if !ok {
+			return false
+		}
+	}
+	return len(rpc.tenantIDs) == 0 || slices.Contains(rpc.tenantIDs, tenantID)
+}
+
+func parseRowProcessorConfig(s string) (*rowProcessorConfig, error) {
+	name, args, _ := strings.Cut(s, "?")
+	rowProcessorsLock.Lock()
+	rp := rowProcessors[name]
+	rowProcessorsLock.Unlock()
+	if rp == nil && !strings.HasSuffix(name, ".wasm") {
+		if strings.HasSuffix(name, ".so") {
+			return nil, fmt.Errorf("cannot load row processor from %q: loading row processors from Go plugins isn't supported; "+
+				"use WebAssembly module instead; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#webassembly-row-processors", name)
+		}
+		return nil, fmt.Errorf("unknown row processor %q", name)
+	}
+
+	qs, err := url.ParseQuery(args)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse filters for row processor %q: %w", name, err)
+	}
+	rpc := &rowProcessorConfig{
+		name: name,
+		rp:   rp,
+	}
+	for k, vs := range qs {
+		switch k {
+		case "protocol":
+			rpc.protocols = append(rpc.protocols, vs...)
+		case "tenant":
+			for _, v := range vs {
+				tenantID, err := logstorage.ParseTenantID(v)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse tenant for row processor %q: %w", name, err)
+				}
+				rpc.tenantIDs = append(rpc.tenantIDs, tenantID)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported filter %q for row processor %q; supported filters: protocol, tenant", k, name)
+		}
+	}
+
+	if rp == nil {
+		wrp, err := newWASMRowProcessor(name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load row processor: %w", err)
+		}
+		rpc.rp = wrp
+		rpc.wrp = wrp
+	}
+	return rpc, nil
+}
+
+func (rpc *rowProcessorConfig) mustClose() {
+	if rpc.wrp != nil {
+		rpc.wrp.mustClose()
+	}
+}
+
+var (
+	rowProcessorConfigsOnce sync.Once
+	rowProcessorConfigs     []*rowProcessorConfig
+)
+
+func getRowProcessorConfigs() []*rowProcessorConfig {
+	rowProcessorConfigsOnce.Do(func() {
+		rpcs, err := parseRowProcessorFlags()
+		if err != nil {
+			logger.Fatalf("%s", err)
+		}
+		rowProcessorConfigs = rpcs
+	})
+	return rowProcessorConfigs
+}
+
+func parseRowProcessorFlags() ([]*rowProcessorConfig, error) {
+	var rpcs []*rowProcessorConfig
+	for _, s := range *rowProcessorFlags {
+		rpc, err := parseRowProcessorConfig(s)
+		if err != nil {
+			mustCloseRowProcessorConfigs(rpcs)
+			return nil, fmt.Errorf("cannot parse -insert.rowProcessor=%q: %w", s, err)
+		}
+		rpcs = append(rpcs, rpc)
+	}
+	return rpcs, nil
+}
+
+func mustCloseRowProcessorConfigs(rpcs []*rowProcessorConfig) {
+	for _, rpc := range rpcs {
+		rpc.mustClose()
+	}
+}
+
+// getRowProcessors returns row processors, which must be applied to logs ingested via the given protocolName into the given tenantID.
+func getRowProcessors(protocolName string, tenantID logstorage.TenantID) []RowProcessor {
+	var rps []RowProcessor
+	for _, rpc := range getRowProcessorConfigs() {
+		if rpc.matches(protocolName, tenantID) {
+			rps = append(rps, rpc.rp)
+		}
+	}
+	return rps
+}
+
+// applyRowProcessors applies rps to the log entry with the given tenantID, timestamp and fields.
+//
+// The processed fields are stored in buf. It returns false if the log entry must be dropped.
+func applyRowProcessors(rps []RowProcessor, buf *rowProcessorsBuf, tenantID logstorage.TenantID, timestamp int64, fields []logstorage.Field) ([]logstorage.Field, bool) {
+	for _, rp := range rps {
+		// Swap buffers, since the processed fields may refer to the previous buffer.
+		buf.a, buf.b = buf.b, buf.a
+		dst, ok := rp.ProcessRow(buf.a[:0], tenantID, timestamp, fields)
+		buf.a = dst
+		if !ok {
+			rowsDroppedTotalRowProcessor.Inc()
+			return nil, false
+		}
+		fields = dst
+	}
+	return fields, true
+}
+
+type rowProcessorsBuf struct {
+	a []logstorage.Field
+	b []logstorage.Field
+}
+
+var rowsDroppedTotalRowProcessor = metrics.NewCounter(`vl_rows_dropped_total{reason="row_processor"}`)
@@ -0,0 +1,136 @@
+package insertutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+type testRowProcessor struct {
+	name string
+}
+
+func (trp *testRowProcessor) ProcessRow(dst []logstorage.Field, tenantID logstorage.TenantID, _ int64, fields []logstorage.Field) ([]logstorage.Field, bool) {
+	for _, f := range fields {
+		if f.Name == "drop" {
+			return dst, false
+		}
+	}
+	dst = append(dst, fields...)
+	dst = append(dst, logstorage.Field{
+		Name:  trp.name,
+		Value: fmt.Sprintf("%d:%d", tenantID.AccountID, tenantID.ProjectID),
+	})
+	return dst, true
+}
+
+func init() {
+	RegisterRowProcessor("test_foo", &testRowProcessor{name: "foo"})
+	RegisterRowProcessor("test_bar", &testRowProcessor{name: "bar"})
+}
+
+func TestParseRowProcessorConfigFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		rpc, err := parseRowProcessorConfig(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+		if rpc != nil {
+			t.Fatalf("expecting nil rpc; got %v", rpc)
+		}
+	}
+
+	// unknown processor
+	f("")
+	f("unknown")
+	f("unknown?protocol=jsonline")
+
+	// missing WebAssembly module
+	f("/path/to/enrich.wasm")
+	f("/path/to/enrich.wasm?protocol=jsonline")
+
+	// Go plugins
+	f("/path/to/enrich.so?protocol=jsonline")
+
+	// invalid filters
+	f("test_foo?tenant=abc")
+	f("test_foo?foo=bar")
+	f("test_foo?protocol=%zz")
+}
+
+func TestRowProcessorConfigMatches(t *testing.T) {
+	f := func(s, protocolName string, tenantID logstorage.TenantID, resultExpected bool) {
+		t.Helper()
+
+		rpc, err := parseRowProcessorConfig(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := rpc.matches(protocolName, tenantID)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for matches(%q, %s) at %q; got %v; want %v", protocolName, tenantID, s, result, resultExpected)
+		}
+	}
+
+	tenantID := logstorage.TenantID{
+		AccountID: 12,
+		ProjectID: 34,
+	}
+
+	f("test_foo", "jsonline", tenantID, true)
+	f("test_foo?protocol=jsonline", "jsonline", tenantID, true)
+	f("test_foo?protocol=loki", "jsonline", tenantID, false)
+	f("test_foo?protocol=syslog", "syslog_tcp", tenantID, true)
+	f("test_foo?protocol=loki&protocol=jsonline", "jsonline", tenantID, true)
+	f("test_foo?tenant=12:34", "jsonline", tenantID, true)
+	f("test_foo?tenant=12:0", "jsonline", tenantID, false)
+	f("test_foo?tenant=12:0&tenant=12:34", "jsonline", tenantID, true)
+	f("test_foo?protocol=loki&tenant=12:34", "jsonline", tenantID, false)
+}
+
+func TestApplyRowProcessors(t *testing.T) {
+	f := func(fields []logstorage.Field, resultExpected string) {
+		t.Helper()
+
+		rps := []RowProcessor{
+			rowProcessors["test_foo"],
+			rowProcessors["test_bar"],
+		}
+		tenantID := logstorage.TenantID{
+			AccountID: 12,
+			ProjectID: 34,
+		}
+
+		var buf rowProcessorsBuf
+		result, ok := applyRowProcessors(rps, &buf, tenantID, 123, fields)
+		if !ok {
+			if resultExpected != "" {
+				t.Fatalf("unexpected row drop; want %s", resultExpected)
+			}
+			return
+		}
+		data := logstorage.MarshalFieldsToJSON(nil, result)
+		if string(data) != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", data, resultExpected)
+		}
+	}
+
+	f(nil, `{"foo":"12:34","bar":"12:34"}`)
+	f([]logstorage.Field{
+		{
+			Name:  "_msg",
+			Value: "abc",
+		},
+	}, `{"_msg":"abc","foo":"12:34","bar":"12:34"}`)
+
+	// dropped row
+	f([]logstorage.Field{
+		{
+			Name:  "drop",
+			Value: "1",
+		},
+	}, "")
+}
@@ -0,0 +1,324 @@
+package insertutil
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	maxHourlyStreamsPerTenant = flag.Int("insert.maxHourlyStreamsPerTenant", 0, "The maximum number of unique log streams, which can be ingested per tenant during the current hour. "+
+		"Logs for new streams above the limit are processed according to -insert.streamLimitAction. By default there is no limit. "+
+		"See also -insert.tenantMaxHourlyStreams and https://docs.victoriametrics.com/victorialogs/data-ingestion/#stream-limits")
+	maxDailyStreamsPerTenant = flag.Int("insert.maxDailyStreamsPerTenant", 0, "The maximum number of unique log streams, which can be ingested per tenant during the current day. "+
+		"Logs for new streams above the limit are processed according to -insert.streamLimitAction. By default there is no limit. "+
+		"See also -insert.tenantMaxDailyStreams and https://docs.victoriametrics.com/victorialogs/data-ingestion/#stream-limits")
+	tenantMaxHourlyStreams = flagutil.NewArrayString("insert.tenantMaxHourlyStreams", "Optional per-tenant limits on the number of unique log streams per hour "+
+		"in the form 'accountID:projectID=N'. It overrides -insert.maxHourlyStreamsPerTenant for the given tenant. Zero N means no limit. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#stream-limits")
+	tenantMaxDailyStreams = flagutil.NewArrayString("insert.tenantMaxDailyStreams", "Optional per-tenant limits on the number of unique log streams per day "+
+		"in the form 'accountID:projectID=N'. It overrides -insert.maxDailyStreamsPerTenant for the given tenant. Zero N means no limit. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#stream-limits")
+	streamLimitAction = flag.String("insert.streamLimitAction", "drop", "The action for logs of new streams exceeding -insert.maxHourlyStreamsPerTenant or -insert.maxDailyStreamsPerTenant. "+
+		"Supported values: 'drop' - drop the logs; 'reroute' - store the logs into the catch-all {stream_limit_exceeded=\"true\"} stream. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#stream-limits")
+	streamLimitsAuthKey = flagutil.NewPassword("streamLimitsAuthKey", "authKey, which must be passed in query string to /insert/stream_limits . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#stream-limits")
+)
+
+var (
+	rowsDroppedTotalStreamLimit  = metrics.NewCounter(`vl_rows_dropped_total{reason="stream_limit"}`)
+	rowsReroutedTotalStreamLimit = metrics.NewCounter(`vl_rows_rerouted_to_catch_all_stream_total{reason="stream_limit"}`)
+
+	hourlyStreamLimitExceeded = metrics.NewCounter(`vl_stream_limit_exceeded_total{window="hourly"}`)
+	dailyStreamLimitExceeded  = metrics.NewCounter(`vl_stream_limit_exceeded_total{window="daily"}`)
+)
+
+// streamLimiterGlobal limits the number of log streams per tenant according to -insert.*Streams* flags.
+//
+// It is nil if stream limits aren't configured.
+var streamLimiterGlobal *streamLimiter
+
+// MustInitStreamLimiter initializes stream limiter according to -insert.*Streams* command-line flags.
+//
+// This function must be called before using LogMessageProcessor from this package.
+func MustInitStreamLimiter() {
+	sl, err := newStreamLimiterFromFlags()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	streamLimiterGlobal = sl
+}
+
+// newStreamLimiterFromFlags returns stream limiter configured via -insert.*Streams* command-line flags.
+//
+// nil is returned if stream limits aren't configured.
+func newStreamLimiterFromFlags() (*streamLimiter, error) {
+	var reroute bool
+	switch *streamLimitAction {
+	case "drop":
+	case "reroute":
+		reroute = true
+	default:
+		return nil, fmt.Errorf("unsupported -insert.streamLimitAction=%q; supported values: drop, reroute", *streamLimitAction)
+	}
+
+	hourlyLimits, err := parseTenantStreamLimits(*tenantMaxHourlyStreams)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.tenantMaxHourlyStreams: %w", err)
+	}
+	dailyLimits, err := parseTenantStreamLimits(*tenantMaxDailyStreams)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.tenantMaxDailyStreams: %w", err)
+	}
+
+	if *maxHourlyStreamsPerTenant <= 0 && *maxDailyStreamsPerTenant <= 0 && len(hourlyLimits) == 0 && len(dailyLimits) == 0 {
+		return nil, nil
+	}
+	return newStreamLimiter(*maxHourlyStreamsPerTenant, *maxDailyStreamsPerTenant, hourlyLimits, dailyLimits, reroute), nil
+}
+
+func parseTenantStreamLimits(a []string) (map[logstorage.TenantID]int, error) {
+	m := make(map[logstorage.TenantID]int, len(a))
+	for _, s := range a {
+		n := strings.LastIndexByte(s, '=')
+		if n < 0 {
+			return nil, fmt.Errorf("missing '=' in %q; expecting 'accountID:projectID=N'", s)
+		}
+		tenantID, err := logstorage.ParseTenantID(s[:n])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse tenant at %q: %w", s, err)
+		}
+		limit, err := strconv.Atoi(s[n+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse limit at %q: %w", s, err)
+		}
+		if limit < 0 {
+			return nil, fmt.Errorf("limit at %q cannot be negative", s)
+		}
+		if _, ok := m[tenantID]; ok {
+			return nil, fmt.Errorf("duplicate limit for tenant %s", tenantID)
+		}
+		m[tenantID] = limit
+	}
+	return m, nil
+}
+
+// streamLimiter implements logstorage.StreamLimiter.
+//
+// It tracks unique streams per tenant for the current hour and the current day.
+type streamLimiter struct {
+	defaultHourlyLimit int
+	defaultDailyLimit  int
+	hourlyLimits       map[logstorage.TenantID]int
+	dailyLimits        map[logstorage.TenantID]int
+	reroute            bool
+
+	mu      sync.Mutex
+	tenants map[logstorage.TenantID]*tenantStreams
+
+	// currentHour and currentDay are the current hour and day since the Unix epoch.
+	currentHour int64
+	currentDay  int64
+
+	// nowFunc returns the current time. It is overridden in tests.
+	nowFunc func() time.Time
+}
+
+// tenantStreams contains unique streams for a single tenant.
+type tenantStreams struct {
+	hourly map[uint64]struct{}
+	daily  map[uint64]struct{}
+
+	// rowsRejected is the number of rows for new streams exceeding the limits.
+	rowsRejected uint64
+}
+
+func newStreamLimiter(defaultHourlyLimit, defaultDailyLimit int, hourlyLimits, dailyLimits map[logstorage.TenantID]int, reroute bool) *streamLimiter {
+	return &streamLimiter{
+		defaultHourlyLimit: defaultHourlyLimit,
+		defaultDailyLimit:  defaultDailyLimit,
+		hourlyLimits:       hourlyLimits,
+		dailyLimits:        dailyLimits,
+		reroute:            reroute,
+
+		tenants: make(map[logstorage.TenantID]*tenantStreams),
+		nowFunc: time.Now,
+	}
+}
+
+func (sl *streamLimiter) getHourlyLimit(tenantID logstorage.TenantID) int {
+	if limit, ok := sl.hourlyLimits[tenantID]; ok {
+		return limit
+	}
+	return sl.defaultHourlyLimit
+}
+
+func (sl *streamLimiter) getDailyLimit(tenantID logstorage.TenantID) int {
+	if limit, ok := sl.dailyLimits[tenantID]; ok {
+		return limit
+	}
+	return sl.defaultDailyLimit
+}
+
+// AllowStream implements logstorage.StreamLimiter interface.
+func (sl *streamLimiter) AllowStream(tenantID logstorage.TenantID, streamHash uint64) bool {
+	hourlyLimit := sl.getHourlyLimit(tenantID)
+	dailyLimit := sl.getDailyLimit(tenantID)
+	if hourlyLimit <= 0 && dailyLimit <= 0 {
+		return true
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.resetExpiredWindowsLocked()
+
+	ts := sl.tenants[tenantID]
+	if ts == nil {
+		ts = &tenantStreams{
+			hourly: make(map[uint64]struct{}),
+			daily:  make(map[uint64]struct{}),
+		}
+		sl.tenants[tenantID] = ts
+	}
+
+	_, inHourly := ts.hourly[streamHash]
+	_, inDaily := ts.daily[streamHash]
+	if !inHourly && hourlyLimit > 0 && len(ts.hourly) >= hourlyLimit {
+		hourlyStreamLimitExceeded.Inc()
+		sl.registerRejectedRow(ts)
+		return false
+	}
+	if !inDaily && dailyLimit > 0 && len(ts.daily) >= dailyLimit {
+		dailyStreamLimitExceeded.Inc()
+		sl.registerRejectedRow(ts)
+		return false
+	}
+	if !inHourly {
+		ts.hourly[streamHash] = struct{}{}
+	}
+	if !inDaily {
+		ts.daily[streamHash] = struct{}{}
+	}
+	return true
+}
+
+func (sl *streamLimiter) registerRejectedRow(ts *tenantStreams) {
+	ts.rowsRejected++
+	if sl.reroute {
+		rowsReroutedTotalStreamLimit.Inc()
+	} else {
+		rowsDroppedTotalStreamLimit.Inc()
+	}
+}
+
+// RerouteToCatchAllStream implements logstorage.StreamLimiter interface.
+func (sl *streamLimiter) RerouteToCatchAllStream() bool {
+	return sl.reroute
+}
+
+func (sl *streamLimiter) resetExpiredWindowsLocked() {
+	now := sl.nowFunc().Unix()
+	hour := now / 3600
+	day := now / (24 * 3600)
+	if hour == sl.currentHour && day == sl.currentDay {
+		return
+	}
+
+	resetDaily := day != sl.currentDay
+	for tenantID, ts := range sl.tenants {
+		ts.hourly = make(map[uint64]struct{})
+		if resetDaily {
+			ts.daily = make(map[uint64]struct{})
+			ts.rowsRejected = 0
+			delete(sl.tenants, tenantID)
+		}
+	}
+	sl.currentHour = hour
+	sl.currentDay = day
+}
+
+// tenantStreamLimitsStatus is the JSON representation of per-tenant stream limits returned from /insert/stream_limits.
+type tenantStreamLimitsStatus struct {
+	Tenant        string `json:"tenant"`
+	HourlyStreams int    `json:"hourly_streams"`
+	HourlyLimit   int    `json:"hourly_limit"`
+	DailyStreams  int    `json:"daily_streams"`
+	DailyLimit    int    `json:"daily_limit"`
+	RowsRejected  uint64 `json:"rows_rejected"`
+}
+
+func (sl *streamLimiter) getStatus(tenantID *logstorage.TenantID) []tenantStreamLimitsStatus {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.resetExpiredWindowsLocked()
+
+	var a []tenantStreamLimitsStatus
+	for tid, ts := range sl.tenants {
+		if tenantID != nil && tid != *tenantID {
+			continue
+		}
+		a = append(a, tenantStreamLimitsStatus{
+			Tenant:        fmt.Sprintf("%d:%d", tid.AccountID, tid.ProjectID),
+			HourlyStreams: len(ts.hourly),
+			HourlyLimit:   sl.getHourlyLimit(tid),
+			DailyStreams:  len(ts.daily),
+			DailyLimit:    sl.getDailyLimit(tid),
+			RowsRejected:  ts.rowsRejected,
+		})
+	}
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].Tenant < a[j].Tenant
+	})
+	return a
+}
+
+// ProcessStreamLimitsRequest processes /insert/stream_limits request.
+//
+// It returns the number of unique streams per tenant for the current hour and day together with the configured limits.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#stream-limits
+func ProcessStreamLimitsRequest(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.CheckAuthFlag(w, r, streamLimitsAuthKey) {
+		return
+	}
+
+	var tenantID *logstorage.TenantID
+	if logstorage.HasTenantInRequest(r) {
+		tid, err := logstorage.GetTenantIDFromRequest(r)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot obtain tenantID: %s", err)
+			return
+		}
+		tenantID = &tid
+	}
+
+	a := []tenantStreamLimitsStatus{}
+	if sl := streamLimiterGlobal; sl != nil {
+		if status := sl.getStatus(tenantID); status != nil {
+			a = status
+		}
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal stream limits to JSON: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok","data":%s}`, data)
+}
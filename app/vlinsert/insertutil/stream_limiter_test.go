@@ -0,0 +1,154 @@
+package insertutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParseTenantStreamLimitsFailure(t *testing.T) {
+	f := func(a []string) {
+		t.Helper()
+
+		_, err := parseTenantStreamLimits(a)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// missing '='
+	f([]string{"1:2"})
+
+	// invalid tenant
+	f([]string{"foo=10"})
+
+	// invalid limit
+	f([]string{"1:2=foo"})
+
+	// negative limit
+	f([]string{"1:2=-1"})
+
+	// duplicate tenant
+	f([]string{"1:0=10", "1=20"})
+}
+
+func TestParseTenantStreamLimitsSuccess(t *testing.T) {
+	m, err := parseTenantStreamLimits([]string{"1:2=10", "3=0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	mExpected := map[logstorage.TenantID]int{
+		{AccountID: 1, ProjectID: 2}: 10,
+		{AccountID: 3, ProjectID: 0}: 0,
+	}
+	if !reflect.DeepEqual(m, mExpected) {
+		t.Fatalf("unexpected result; got %v; want %v", m, mExpected)
+	}
+}
+
+func TestStreamLimiter(t *testing.T) {
+	tenant1 := logstorage.TenantID{AccountID: 1}
+	tenant2 := logstorage.TenantID{AccountID: 2}
+	tenant3 := logstorage.TenantID{AccountID: 3}
+
+	hourlyLimits := map[logstorage.TenantID]int{
+		tenant2: 3,
+		tenant3: 0,
+	}
+	sl := newStreamLimiter(2, 3, hourlyLimits, nil, false)
+
+	now := time.Date(2025, 1, 2, 10, 30, 0, 0, time.UTC)
+	sl.nowFunc = func() time.Time {
+		return now
+	}
+
+	f := func(tenantID logstorage.TenantID, streamHash uint64, resultExpected bool) {
+		t.Helper()
+
+		result := sl.AllowStream(tenantID, streamHash)
+		if result != resultExpected {
+			t.Fatalf("unexpected AllowStream(%s, %d) result; got %v; want %v", tenantID, streamHash, result, resultExpected)
+		}
+	}
+
+	// the default hourly limit
+	f(tenant1, 1, true)
+	f(tenant1, 2, true)
+	f(tenant1, 1, true)
+	f(tenant1, 3, false)
+
+	// the per-tenant hourly limit
+	f(tenant2, 1, true)
+	f(tenant2, 2, true)
+	f(tenant2, 3, true)
+	f(tenant2, 4, false)
+
+	// zero per-tenant hourly limit disables the hourly limit, while the daily limit is still applied
+	f(tenant3, 1, true)
+	f(tenant3, 2, true)
+	f(tenant3, 3, true)
+	f(tenant3, 4, false)
+
+	// the next hour resets the hourly limit, while the daily limit is still applied
+	now = now.Add(time.Hour)
+	f(tenant1, 3, true)
+	f(tenant1, 4, false)
+	f(tenant2, 4, false)
+	f(tenant2, 1, true)
+
+	status := sl.getStatus(&tenant1)
+	statusExpected := []tenantStreamLimitsStatus{
+		{
+			Tenant:        "1:0",
+			HourlyStreams: 1,
+			HourlyLimit:   2,
+			DailyStreams:  3,
+			DailyLimit:    3,
+			RowsRejected:  2,
+		},
+	}
+	if !reflect.DeepEqual(status, statusExpected) {
+		t.Fatalf("unexpected status\ngot\n%+v\nwant\n%+v", status, statusExpected)
+	}
+
+	// the next day resets all the limits
+	now = now.Add(24 * time.Hour)
+	f(tenant1, 4, true)
+	f(tenant1, 5, true)
+	f(tenant1, 6, false)
+
+	status = sl.getStatus(nil)
+	if len(status) != 1 {
+		t.Fatalf("unexpected number of tenants in status; got %d; want 1", len(status))
+	}
+}
+
+func TestProcessStreamLimitsRequestAuthKey(t *testing.T) {
+	if err := streamLimitsAuthKey.Set("secret"); err != nil {
+		t.Fatalf("cannot set -streamLimitsAuthKey: %s", err)
+	}
+	defer func() {
+		if err := streamLimitsAuthKey.Set(""); err != nil {
+			t.Fatalf("cannot reset -streamLimitsAuthKey: %s", err)
+		}
+	}()
+
+	f := func(url string, statusCodeExpected int) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		w := httptest.NewRecorder()
+		ProcessStreamLimitsRequest(w, r)
+		if w.Code != statusCodeExpected {
+			t.Fatalf("unexpected status code for %q; got %d; want %d; response: %s", url, w.Code, statusCodeExpected, w.Body.String())
+		}
+	}
+
+	f("/insert/stream_limits", http.StatusUnauthorized)
+	f("/insert/stream_limits?authKey=foo", http.StatusUnauthorized)
+	f("/insert/stream_limits?authKey=secret", http.StatusOK)
+}
@@ -0,0 +1,119 @@
+package insertutil
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var tenantDefaultsFile = flag.String("insert.tenantDefaultsFile", "", "Optional path to a file with per-tenant defaults for _stream_fields, _msg_field, _time_field and ignore_fields, "+
+	"which are used when the corresponding query args and request headers aren't set during data ingestion. "+
+	"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#per-tenant-defaults")
+
+// TenantDefaults contains default ingestion params for a single tenant.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#per-tenant-defaults
+type TenantDefaults struct {
+	// Tenant is the tenant in the form AccountID:ProjectID or AccountID.
+	Tenant string `yaml:"tenant"`
+
+	// StreamFields is the default value for _stream_fields.
+	StreamFields []string `yaml:"stream_fields,omitempty"`
+
+	// MsgFields is the default value for _msg_field.
+	MsgFields []string `yaml:"msg_field,omitempty"`
+
+	// TimeFields is the default value for _time_field.
+	TimeFields []string `yaml:"time_field,omitempty"`
+
+	// IgnoreFields is the default value for ignore_fields.
+	IgnoreFields []string `yaml:"ignore_fields,omitempty"`
+}
+
+type tenantDefaultsConfig struct {
+	Tenants []*TenantDefaults `yaml:"tenants"`
+}
+
+// tenantDefaults contains per-tenant defaults loaded from -insert.tenantDefaultsFile.
+//
+// It is read-only after MustInitTenantDefaults call.
+var tenantDefaults map[logstorage.TenantID]*TenantDefaults
+
+// MustInitTenantDefaults loads per-tenant defaults from -insert.tenantDefaultsFile.
+//
+// This function must be called before using GetCommonParams.
+func MustInitTenantDefaults() {
+	if *tenantDefaultsFile == "" {
+		return
+	}
+	m, err := loadTenantDefaults()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	tenantDefaults = m
+	logger.Infof("loaded per-tenant ingestion defaults for %d tenants from -insert.tenantDefaultsFile=%q", len(m), *tenantDefaultsFile)
+}
+
+func loadTenantDefaults() (map[logstorage.TenantID]*TenantDefaults, error) {
+	if *tenantDefaultsFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(*tenantDefaultsFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -insert.tenantDefaultsFile: %w", err)
+	}
+	m, err := parseTenantDefaults(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.tenantDefaultsFile=%q: %w", *tenantDefaultsFile, err)
+	}
+	return m, nil
+}
+
+func parseTenantDefaults(data []byte) (map[logstorage.TenantID]*TenantDefaults, error) {
+	var cfg tenantDefaultsConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+	m := make(map[logstorage.TenantID]*TenantDefaults, len(cfg.Tenants))
+	for i, td := range cfg.Tenants {
+		if td.Tenant == "" {
+			return nil, fmt.Errorf("missing tenant in the entry #%d", i+1)
+		}
+		tenantID, err := logstorage.ParseTenantID(td.Tenant)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse tenant in the entry #%d: %w", i+1, err)
+		}
+		if _, ok := m[tenantID]; ok {
+			return nil, fmt.Errorf("duplicate defaults for tenant %q", td.Tenant)
+		}
+		m[tenantID] = td
+	}
+	return m, nil
+}
+
+// applyTenantDefaults sets the fields, which aren't set in cp, to the defaults for cp.TenantID.
+func (cp *CommonParams) applyTenantDefaults() {
+	td := tenantDefaults[cp.TenantID]
+	if td == nil {
+		return
+	}
+	if !cp.IsTimeFieldSet && len(td.TimeFields) > 0 {
+		cp.TimeFields = td.TimeFields
+		cp.IsTimeFieldSet = true
+	}
+	if len(cp.MsgFields) == 0 {
+		cp.MsgFields = td.MsgFields
+	}
+	if len(cp.StreamFields) == 0 {
+		cp.StreamFields = td.StreamFields
+	}
+	if len(cp.IgnoreFields) == 0 {
+		cp.IgnoreFields = td.IgnoreFields
+	}
+}
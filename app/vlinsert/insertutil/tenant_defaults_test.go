@@ -0,0 +1,111 @@
+package insertutil
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParseTenantDefaultsFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		_, err := parseTenantDefaults([]byte(data))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// unknown field
+	f(`
+tenants:
+- tenant: "1:2"
+  foo: bar
+`)
+
+	// missing tenant
+	f(`
+tenants:
+- stream_fields: [host]
+`)
+
+	// invalid tenant
+	f(`
+tenants:
+- tenant: "foo"
+`)
+
+	// duplicate tenant
+	f(`
+tenants:
+- tenant: "1:0"
+- tenant: "1"
+`)
+}
+
+func TestGetCommonParamsTenantDefaults(t *testing.T) {
+	m, err := parseTenantDefaults([]byte(`
+tenants:
+- tenant: "12:34"
+  stream_fields: [host, app]
+  msg_field: [message]
+  time_field: [ts]
+  ignore_fields: [password]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func(m map[logstorage.TenantID]*TenantDefaults) {
+		tenantDefaults = m
+	}(tenantDefaults)
+	tenantDefaults = m
+
+	f := func(requestURI string, accountID string, timeFieldsExpected, msgFieldsExpected, streamFieldsExpected, ignoreFieldsExpected []string) {
+		t.Helper()
+
+		r := httptest.NewRequest("POST", requestURI, nil)
+		if accountID != "" {
+			r.Header.Set("AccountID", accountID)
+			r.Header.Set("ProjectID", "34")
+		}
+		cp, err := GetCommonParams(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(cp.TimeFields, timeFieldsExpected) {
+			t.Fatalf("unexpected TimeFields; got %q; want %q", cp.TimeFields, timeFieldsExpected)
+		}
+		if !reflect.DeepEqual(cp.MsgFields, msgFieldsExpected) {
+			t.Fatalf("unexpected MsgFields; got %q; want %q", cp.MsgFields, msgFieldsExpected)
+		}
+		if !reflect.DeepEqual(cp.StreamFields, streamFieldsExpected) {
+			t.Fatalf("unexpected StreamFields; got %q; want %q", cp.StreamFields, streamFieldsExpected)
+		}
+		if !reflect.DeepEqual(cp.IgnoreFields, ignoreFieldsExpected) {
+			t.Fatalf("unexpected IgnoreFields; got %q; want %q", cp.IgnoreFields, ignoreFieldsExpected)
+		}
+	}
+
+	// tenant without defaults
+	f("/insert/jsonline", "", []string{"_time"}, nil, nil, nil)
+
+	// tenant with defaults
+	f("/insert/jsonline", "12", []string{"ts"}, []string{"message"}, []string{"host", "app"}, []string{"password"})
+
+	// query args override defaults
+	f("/insert/jsonline?_stream_fields=foo&_time_field=t", "12", []string{"t"}, []string{"message"}, []string{"foo"}, []string{"password"})
+
+	// syslog uses only stream fields and ignore fields from defaults
+	cp := GetCommonParamsForSyslog(logstorage.TenantID{AccountID: 12, ProjectID: 34}, nil, nil, nil, nil)
+	if !reflect.DeepEqual(cp.StreamFields, []string{"host", "app"}) {
+		t.Fatalf("unexpected StreamFields for syslog; got %q", cp.StreamFields)
+	}
+	if !reflect.DeepEqual(cp.IgnoreFields, []string{"password"}) {
+		t.Fatalf("unexpected IgnoreFields for syslog; got %q", cp.IgnoreFields)
+	}
+	if !reflect.DeepEqual(cp.MsgFields, []string{"message"}) {
+		t.Fatalf("unexpected MsgFields for syslog; got %q", cp.MsgFields)
+	}
+}
@@ -12,6 +12,8 @@ import (
 type TestLogMessageProcessor struct {
 	timestamps []int64
 	rows       []string
+
+	tooManyFieldsRows int64
 }
 
 // AddRow adds row with the given timestamp and fields to tlp
@@ -19,10 +21,19 @@ func (tlp *TestLogMessageProcessor) AddRow(timestamp int64, fields []logstorage.
 	if streamFieldsLen >= 0 {
 		panic(fmt.Errorf("BUG: streamFieldsLen must be negative; got %d", streamFieldsLen))
 	}
+	if !checkMaxFieldsPerLine(fields) {
+		tlp.tooManyFieldsRows++
+		return
+	}
 	tlp.timestamps = append(tlp.timestamps, timestamp)
 	tlp.rows = append(tlp.rows, string(logstorage.MarshalFieldsToJSON(nil, fields)))
 }
 
+// TooManyFieldsRows implements RejectedRowsCounter interface.
+func (tlp *TestLogMessageProcessor) TooManyFieldsRows() int64 {
+	return tlp.tooManyFieldsRows
+}
+
 // MustClose closes tlp.
 func (tlp *TestLogMessageProcessor) MustClose() {
 }
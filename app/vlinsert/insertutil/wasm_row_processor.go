@@ -0,0 +1,126 @@
+package insertutil
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/wasmplugin"
+)
+
+// wasmRowProcessFunc is the name of the function, which must be exported by WebAssembly row processors.
+//
+// The function accepts a JSON object with `tenant`, `timestamp` and `fields` keys
+// and must return a JSON object with the fields to set, or `null` if the log entry must be dropped.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#webassembly-row-processors
+const wasmRowProcessFunc = "vl_process_row"
+
+// wasmRowProcessor is RowProcessor, which runs the row processing function from WebAssembly module.
+type wasmRowProcessor struct {
+	m *wasmplugin.Module
+}
+
+func newWASMRowProcessor(path string) (*wasmRowProcessor, error) {
+	m, err := wasmplugin.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.CheckFunction(wasmRowProcessFunc, 1); err != nil {
+		m.MustClose()
+		return nil, fmt.Errorf("unexpected WebAssembly module %q: %w", path, err)
+	}
+	wrp := &wasmRowProcessor{
+		m: m,
+	}
+	return wrp, nil
+}
+
+func (wrp *wasmRowProcessor) mustClose() {
+	wrp.m.MustClose()
+}
+
+// ProcessRow implements RowProcessor interface.
+func (wrp *wasmRowProcessor) ProcessRow(dst []logstorage.Field, tenantID logstorage.TenantID, timestamp int64, fields []logstorage.Field) ([]logstorage.Field, bool) {
+	bb := wasmRowProcessorBufPool.Get()
+	defer wasmRowProcessorBufPool.Put(bb)
+
+	bb.B = marshalWASMRowProcessorInput(bb.B[:0], tenantID, timestamp, fields)
+	inputLen := len(bb.B)
+	result, err := wrp.m.Call(bb.B, wasmRowProcessFunc, bb.B)
+	bb.B = result
+	if err != nil {
+		wasmRowProcessorErrors.Inc()
+		wasmRowProcessorLogger.Warnf("cannot process log entry; storing it without changes: %s", err)
+		return append(dst, fields...), true
+	}
+
+	p := wasmRowProcessorParserPool.Get()
+	defer wasmRowProcessorParserPool.Put(p)
+
+	v, err := p.ParseBytes(result[inputLen:])
+	if err == nil && v.Type() == fastjson.TypeNull {
+		return dst, false
+	}
+	var o *fastjson.Object
+	if err == nil {
+		o, err = v.Object()
+	}
+	if err != nil {
+		wasmRowProcessorErrors.Inc()
+		wasmRowProcessorLogger.Warnf("cannot parse the result returned by %q from WebAssembly module %q; storing the log entry without changes: %s",
+			wasmRowProcessFunc, wrp.m.Path(), err)
+		return append(dst, fields...), true
+	}
+
+	// Keep the initial fields at their positions and update them with the returned fields.
+	dstLen := len(dst)
+	dst = append(dst, fields...)
+	o.Visit(func(k []byte, v *fastjson.Value) {
+		var value string
+		if v.Type() == fastjson.TypeString {
+			value = string(v.GetStringBytes())
+		} else {
+			value = string(v.MarshalTo(nil))
+		}
+		for i := range dst[dstLen:] {
+			f := &dst[dstLen+i]
+			if f.Name == string(k) {
+				f.Value = value
+				return
+			}
+		}
+		dst = append(dst, logstorage.Field{
+			Name:  string(k),
+			Value: value,
+		})
+	})
+	return dst, true
+}
+
+func marshalWASMRowProcessorInput(dst []byte, tenantID logstorage.TenantID, timestamp int64, fields []logstorage.Field) []byte {
+	dst = append(dst, `{"tenant":"`...)
+	dst = strconv.AppendUint(dst, uint64(tenantID.AccountID), 10)
+	dst = append(dst, ':')
+	dst = strconv.AppendUint(dst, uint64(tenantID.ProjectID), 10)
+	dst = append(dst, `","timestamp":`...)
+	dst = strconv.AppendInt(dst, timestamp, 10)
+	dst = append(dst, `,"fields":`...)
+	dst = logstorage.MarshalFieldsToJSON(dst, fields)
+	dst = append(dst, '}')
+	return dst
+}
+
+var (
+	wasmRowProcessorBufPool    bytesutil.ByteBufferPool
+	wasmRowProcessorParserPool fastjson.ParserPool
+
+	wasmRowProcessorLogger = logger.WithThrottler("wasm_row_processor", 5*time.Second)
+	wasmRowProcessorErrors = metrics.NewCounter(`vl_row_processor_errors_total{type="wasm"}`)
+)
@@ -0,0 +1,138 @@
+package insertutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/wasmplugin"
+)
+
+// echoRowFunc returns the input passed to vl_process_row as is.
+var echoRowFunc = wasmplugin.TestFunc{
+	Name:      wasmRowProcessFunc,
+	ArgsCount: 1,
+	Code: []byte{
+		0x20, 0x00, // local.get 0
+		0xad,       // i64.extend_i32_u
+		0x42, 0x20, // i64.const 32
+		0x86,       // i64.shl
+		0x20, 0x01, // local.get 1
+		0xad, // i64.extend_i32_u
+		0x84, // i64.or
+	},
+}
+
+func writeTestWASMModule(t *testing.T, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.wasm")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("cannot write WebAssembly module: %s", err)
+	}
+	return path
+}
+
+func TestParseRowProcessorConfigWASM(t *testing.T) {
+	path := writeTestWASMModule(t, wasmplugin.NewTestModule("", echoRowFunc))
+	rpc, err := parseRowProcessorConfig(path + "?protocol=jsonline&tenant=12:34")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rpc.mustClose()
+
+	if rpc.wrp == nil {
+		t.Fatalf("expecting row processor loaded from WebAssembly module")
+	}
+	if !rpc.matches("jsonline", logstorage.TenantID{AccountID: 12, ProjectID: 34}) {
+		t.Fatalf("expecting the row processor to match jsonline protocol and 12:34 tenant")
+	}
+	if rpc.matches("loki", logstorage.TenantID{AccountID: 12, ProjectID: 34}) {
+		t.Fatalf("unexpected match for loki protocol")
+	}
+
+	// The module without vl_process_row function
+	path = writeTestWASMModule(t, wasmplugin.NewTestModule("{}", wasmplugin.NewTestFuncReturningData("process_row", 1, 2)))
+	if _, err := parseRowProcessorConfig(path); err == nil {
+		t.Fatalf("expecting non-nil error for the module without %s function", wasmRowProcessFunc)
+	}
+
+	// The module with invalid vl_process_row signature
+	path = writeTestWASMModule(t, wasmplugin.NewTestModule("{}", wasmplugin.NewTestFuncReturningData(wasmRowProcessFunc, 2, 2)))
+	if _, err := parseRowProcessorConfig(path); err == nil {
+		t.Fatalf("expecting non-nil error for the module with invalid %s signature", wasmRowProcessFunc)
+	}
+
+	// Invalid WebAssembly module
+	path = writeTestWASMModule(t, []byte("foobar"))
+	if _, err := parseRowProcessorConfig(path); err == nil {
+		t.Fatalf("expecting non-nil error for invalid WebAssembly module")
+	}
+}
+
+func TestWASMRowProcessor(t *testing.T) {
+	f := func(fn wasmplugin.TestFunc, data string, fields []logstorage.Field, resultExpected string) {
+		t.Helper()
+
+		path := writeTestWASMModule(t, wasmplugin.NewTestModule(data, fn))
+		wrp, err := newWASMRowProcessor(path)
+		if err != nil {
+			t.Fatalf("cannot load row processor: %s", err)
+		}
+		defer wrp.mustClose()
+
+		tenantID := logstorage.TenantID{
+			AccountID: 12,
+			ProjectID: 34,
+		}
+		prefix := []logstorage.Field{
+			{
+				Name:  "prefix",
+				Value: "x",
+			},
+		}
+		result, ok := wrp.ProcessRow(prefix, tenantID, 123, fields)
+		if !ok {
+			if resultExpected != "" {
+				t.Fatalf("unexpected row drop; want %s", resultExpected)
+			}
+			return
+		}
+		if resultExpected == "" {
+			t.Fatalf("expecting row drop; got %s", logstorage.MarshalFieldsToJSON(nil, result))
+		}
+		data = string(logstorage.MarshalFieldsToJSON(nil, result))
+		if data != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", data, resultExpected)
+		}
+	}
+
+	fields := []logstorage.Field{
+		{
+			Name:  "_msg",
+			Value: "abc",
+		},
+		{
+			Name:  "level",
+			Value: "info",
+		},
+	}
+
+	// The input is returned as is
+	f(echoRowFunc, "", fields, `{"prefix":"x","_msg":"abc","level":"info","tenant":"12:34","timestamp":"123","fields":"{\"_msg\":\"abc\",\"level\":\"info\"}"}`)
+
+	// update the existing field and add new fields
+	const data = `{"level":"error","foo":"bar","n":42}`
+	f(wasmplugin.NewTestFuncReturningData(wasmRowProcessFunc, 1, len(data)), data, fields, `{"prefix":"x","_msg":"abc","level":"error","foo":"bar","n":"42"}`)
+
+	// empty object leaves the log entry unchanged
+	f(wasmplugin.NewTestFuncReturningData(wasmRowProcessFunc, 1, 2), "{}", fields, `{"prefix":"x","_msg":"abc","level":"info"}`)
+
+	// null drops the log entry
+	f(wasmplugin.NewTestFuncReturningData(wasmRowProcessFunc, 1, 4), "null", fields, "")
+
+	// invalid result leaves the log entry unchanged
+	f(wasmplugin.NewTestFuncReturningData(wasmRowProcessFunc, 1, 3), "foo", fields, `{"prefix":"x","_msg":"abc","level":"info"}`)
+	f(wasmplugin.NewTestFuncReturningData(wasmRowProcessFunc, 1, 2), "[]", fields, `{"prefix":"x","_msg":"abc","level":"info"}`)
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
 	"github.com/VictoriaMetrics/metrics"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
@@ -28,14 +27,16 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	version := r.FormValue("version")
-	if version != netinsert.ProtocolVersion {
-		httpserver.Errorf(w, r, "unsupported protocol version=%q; want %q", version, netinsert.ProtocolVersion)
+	if !netinsert.SupportedProtocolVersions.IsSupported("/internal/insert", version) {
+		httpserver.Errorf(w, r, "unsupported protocol version=%q; supported versions: %q; see https://docs.victoriametrics.com/victorialogs/cluster/#upgrading",
+			version, netinsert.SupportedProtocolVersions["/internal/insert"])
 		return
 	}
 
 	requestsTotal.Inc()
 
-	cp, err := insertutil.GetCommonParams(r)
+	// Do not apply per-tenant defaults, since the ingested logs already contain all the needed fields.
+	cp, err := insertutil.GetRawCommonParams(r)
 	if err != nil {
 		httpserver.Errorf(w, r, "%s", err)
 		return
@@ -75,7 +76,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	encoding := r.Header.Get("Content-Encoding")
-	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
+	err = insertutil.ReadUncompressedData("internalinsert", r.Body, encoding, maxRequestSize, func(data []byte) error {
 		lmp := cp.NewLogMessageProcessor("internalinsert", false)
 		irp := lmp.(insertutil.InsertRowProcessor)
 		err := parseData(irp, data)
@@ -87,6 +88,10 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 		httpserver.Errorf(w, r, "cannot parse internal insert request: %s", err)
 		return
 	}
+	if drr := cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return
+	}
 
 	requestDuration.UpdateDuration(startTime)
 }
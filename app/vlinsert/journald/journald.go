@@ -114,23 +114,30 @@ func handleJournald(r *http.Request, w http.ResponseWriter) {
 	}
 
 	encoding := r.Header.Get("Content-Encoding")
-	reader, err := protoparserutil.GetUncompressedReader(r.Body, encoding)
+	im := cp.GetIngestionMetrics("journald")
+	reader, err := protoparserutil.GetUncompressedReader(im.NewReceivedBytesReader(r.Body), encoding)
 	if err != nil {
 		errorsTotal.Inc()
+		im.AddParseErrors(1)
 		logger.Errorf("cannot decode journald request: %s", err)
 		return
 	}
 
 	lmp := cp.NewLogMessageProcessor("journald", true)
 	streamName := fmt.Sprintf("remoteAddr=%s, requestURI=%q", httpserver.GetQuotedRemoteAddr(r), r.RequestURI)
-	err = processStreamInternal(streamName, reader, lmp, cp)
+	err = processStreamInternal(streamName, im.NewUncompressedBytesReader(reader), lmp, cp)
 	protoparserutil.PutUncompressedReader(reader)
 	lmp.MustClose()
 	if err != nil {
 		errorsTotal.Inc()
+		im.AddParseErrors(1)
 		httpserver.Errorf(w, r, "cannot read journald protocol data: %s", err)
 		return
 	}
+	if drr := cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return
+	}
 
 	// systemd starting release v258 will support compression, which starts working after negotiation: it expects supported compression
 	// algorithms list in Accept-Encoding response header in a format "<algorithm_1>[:<priority_1>][;<algorithm_2>:<priority_2>]"
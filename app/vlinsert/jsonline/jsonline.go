@@ -39,8 +39,10 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	encoding := r.Header.Get("Content-Encoding")
-	reader, err := protoparserutil.GetUncompressedReader(r.Body, encoding)
+	im := cp.GetIngestionMetrics("jsonline")
+	reader, err := protoparserutil.GetUncompressedReader(im.NewReceivedBytesReader(r.Body), encoding)
 	if err != nil {
+		im.AddParseErrors(1)
 		logger.Errorf("cannot decode jsonline request: %s", err)
 		return
 	}
@@ -48,17 +50,26 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 
 	lmp := cp.NewLogMessageProcessor("jsonline", true)
 	streamName := fmt.Sprintf("remoteAddr=%s, requestURI=%q", httpserver.GetQuotedRemoteAddr(r), r.RequestURI)
-	err = processStreamInternal(streamName, reader, cp.TimeFields, cp.MsgFields, lmp)
+	parseErrors, err := processStreamInternal(streamName, im.NewUncompressedBytesReader(reader), cp.TimeFields, cp.MsgFields, lmp)
 	lmp.MustClose()
+	im.AddParseErrors(parseErrors)
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot process jsonline request; error: %s", err)
 		return
 	}
+	if drr := cp.DryRun; drr != nil {
+		drr.AddParseErrors(parseErrors)
+		drr.WriteResponse(w)
+		return
+	}
 
 	requestDuration.UpdateDuration(startTime)
 }
 
-func processStreamInternal(streamName string, r io.Reader, timeFields, msgFields []string, lmp insertutil.LogMessageProcessor) error {
+// processStreamInternal reads JSON lines from r and sends them to lmp.
+//
+// It returns the number of lines, which couldn't be parsed.
+func processStreamInternal(streamName string, r io.Reader, timeFields, msgFields []string, lmp insertutil.LogMessageProcessor) (int, error) {
 	wcr := writeconcurrencylimiter.GetReader(r)
 	defer writeconcurrencylimiter.PutReader(wcr)
 
@@ -84,10 +95,10 @@ func processStreamInternal(streamName string, r io.Reader, timeFields, msgFields
 
 	if errors > 0 && n == errors {
 		// Return an error if no logs were processed and there were errors
-		return lastError
+		return errors, lastError
 	}
 
-	return nil
+	return errors, nil
 }
 
 func readLine(lr *insertutil.LineReader, timeFields, msgFields []string, lmp insertutil.LogMessageProcessor) (bool, error) {
@@ -16,7 +16,7 @@ func TestProcessStreamInternalSuccess(t *testing.T) {
 		msgFields := []string{msgField}
 		tlp := &insertutil.TestLogMessageProcessor{}
 		r := bytes.NewBufferString(data)
-		if err := processStreamInternal("test", r, timeFields, msgFields, tlp); err != nil {
+		if _, err := processStreamInternal("test", r, timeFields, msgFields, tlp); err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
 
@@ -72,7 +72,7 @@ func TestProcessStreamInternalFailure(t *testing.T) {
 
 		tlp := &insertutil.TestLogMessageProcessor{}
 		r := strings.NewReader(data)
-		if err := processStreamInternal("test", r, []string{"time"}, nil, tlp); err == nil {
+		if _, err := processStreamInternal("test", r, []string{"time"}, nil, tlp); err == nil {
 			t.Fatalf("expected error, got nil")
 		}
 
@@ -95,3 +95,31 @@ foo
 	// invalid timestamp field
 	f(`{"time":"foobar"}`)
 }
+
+func FuzzProcessStreamInternal(f *testing.F) {
+	seeds := []string{
+		"",
+		"\n\n",
+		"foobar",
+		`{}`,
+		`{"_msg":"foo"}`,
+		`{"time":"foobar"}`,
+		`{"time":"2023-06-06T04:48:11.735Z","log":{"offset":71770,"file":{"path":"/var/log/auth.log"}},"message":"foobar"}`,
+		`{"time":"2023-06-06T04:48:12.735+01:00","message":"baz"}
+{"message":"xyz","time":"2023-06-06 04:48:13.735Z","x":"y"}`,
+		`{"time":1686026891735,"message":"foo","a":[1,"b",{"c":null}],"b":true,"c":1.5e10}`,
+		`{"message":"\u0000😀","":"empty name","x":{"":{"":""}}}`,
+		`{"a":{"b":{"c":{"d":{"e":{"f":"deeply nested"}}}}}}`,
+		`{"a":"b"`,
+		`[1,2,3]`,
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(_ *testing.T, data string) {
+		tlp := &insertutil.TestLogMessageProcessor{}
+		r := strings.NewReader(data)
+		_, _ = processStreamInternal("fuzz", r, []string{"time"}, []string{"message"}, tlp)
+	})
+}
@@ -0,0 +1,214 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+// commitTimeout is the maximum duration for committing offsets of the processed records.
+const commitTimeout = 30 * time.Second
+
+// consumer consumes records from Kafka topics as a member of consumer group.
+//
+// Offsets are committed only after the logs from the consumed records are accepted by the storage, so logs are delivered at least once.
+type consumer struct {
+	cl *kgo.Client
+
+	groupID string
+	tcs     map[string]*topicConfig
+
+	stopCh <-chan struct{}
+
+	// lagsMu protects lags, since they are updated by rebalance callbacks.
+	lagsMu sync.Mutex
+
+	// lags contains the number of records left to consume per every assigned partition.
+	lags map[topicPartition]int64
+}
+
+// topicPartition identifies a single partition of Kafka topic.
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+func (tp topicPartition) String() string {
+	return fmt.Sprintf("%s/%d", tp.topic, tp.partition)
+}
+
+func newConsumer(opts []kgo.Opt, groupID string, tcs []*topicConfig, stopCh <-chan struct{}) (*consumer, error) {
+	c := &consumer{
+		groupID: groupID,
+		tcs:     make(map[string]*topicConfig, len(tcs)),
+		stopCh:  stopCh,
+		lags:    make(map[topicPartition]int64),
+	}
+	topics := make([]string, 0, len(tcs))
+	for _, tc := range tcs {
+		topics = append(topics, tc.topic)
+		c.tcs[tc.topic] = tc
+	}
+
+	opts = append(opts,
+		kgo.ConsumerGroup(groupID),
+		kgo.ConsumeTopics(topics...),
+
+		// Offsets are committed by processFetches after the logs are accepted by the storage.
+		kgo.DisableAutoCommit(),
+
+		// Partitions mustn't be revoked while their records are processed, since their offsets cannot be committed after that.
+		kgo.BlockRebalanceOnPoll(),
+
+		kgo.OnPartitionsAssigned(c.onPartitionsAssigned),
+		kgo.OnPartitionsRevoked(c.onPartitionsRevoked),
+		kgo.OnPartitionsLost(c.onPartitionsRevoked),
+	)
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.cl = cl
+	return c, nil
+}
+
+// run consumes records until stopCh is closed.
+func (c *consumer) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-c.stopCh
+		cancel()
+	}()
+
+	for {
+		fetches := c.cl.PollFetches(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		c.processFetches(fetches)
+		c.cl.AllowRebalance()
+	}
+
+	// Leave the consumer group, so the consumed partitions are re-assigned to other group members without waiting for session timeout.
+	c.cl.CloseAllowingRebalance()
+}
+
+// processFetches sends logs from the fetched records to the storage and then commits offsets for the fetched records.
+func (c *consumer) processFetches(fetches kgo.Fetches) {
+	fetches.EachError(func(topic string, partition int32, err error) {
+		errorsTotal.Inc()
+		logger.Errorf("kafka: cannot fetch records from partition %s/%d: %s", topic, partition, err)
+	})
+
+	recordsCount := 0
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+		recordsCount += len(p.Records)
+
+		tp := topicPartition{
+			topic:     p.Topic,
+			partition: p.Partition,
+		}
+		c.tcs[p.Topic].processRecords(tp, p.Records)
+
+		nextOffset := p.Records[len(p.Records)-1].Offset + 1
+		c.setLag(tp, p.HighWatermark-nextOffset)
+	})
+	if recordsCount == 0 {
+		return
+	}
+
+	// The logs may be buffered before sending them to remote storage nodes.
+	// Wait until they are accepted by the storage nodes, since they cannot be re-read from Kafka after committing the offsets.
+	insertutil.FlushPendingData()
+
+	// Do not use the context canceled on shutdown, since the offsets for the processed records must be committed on graceful shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+	if err := c.cl.CommitUncommittedOffsets(ctx); err != nil {
+		errorsTotal.Inc()
+		logger.Errorf("kafka: cannot commit offsets for consumer group %q: %s", c.groupID, err)
+		return
+	}
+	offsetCommitsTotal.Inc()
+}
+
+func (c *consumer) onPartitionsAssigned(_ context.Context, _ *kgo.Client, _ map[string][]int32) {
+	rebalancesTotal.Inc()
+}
+
+func (c *consumer) onPartitionsRevoked(_ context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	c.lagsMu.Lock()
+	defer c.lagsMu.Unlock()
+
+	for topic, partitions := range revoked {
+		for _, partition := range partitions {
+			tp := topicPartition{
+				topic:     topic,
+				partition: partition,
+			}
+			delete(c.lags, tp)
+		}
+	}
+	c.updateLagLocked()
+}
+
+func (c *consumer) setLag(tp topicPartition, lag int64) {
+	c.lagsMu.Lock()
+	defer c.lagsMu.Unlock()
+
+	c.lags[tp] = max(lag, 0)
+	c.updateLagLocked()
+}
+
+func (c *consumer) updateLagLocked() {
+	var lag int64
+	for _, n := range c.lags {
+		lag += n
+	}
+	consumerLag.Store(lag)
+}
+
+// kgoLogger writes warnings and errors from Kafka client to the log.
+type kgoLogger struct{}
+
+func (kgoLogger) Level() kgo.LogLevel {
+	return kgo.LogLevelWarn
+}
+
+func (kgoLogger) Log(level kgo.LogLevel, msg string, keyvals ...any) {
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fmt.Fprintf(&sb, "; %v: %v", keyvals[i], keyvals[i+1])
+	}
+	if level == kgo.LogLevelError {
+		kgoLogs.Errorf("kafka: %s", sb.String())
+	} else {
+		kgoLogs.Warnf("kafka: %s", sb.String())
+	}
+}
+
+var kgoLogs = logger.WithThrottler("kafka_client", 5*time.Second)
+
+var (
+	errorsTotal        = metrics.NewCounter(`vl_errors_total{type="kafka"}`)
+	rebalancesTotal    = metrics.NewCounter(`vl_kafka_consumer_rebalances_total`)
+	offsetCommitsTotal = metrics.NewCounter(`vl_kafka_consumer_offset_commits_total`)
+
+	consumerLag atomic.Int64
+	_           = metrics.NewGauge(`vl_kafka_consumer_lag`, func() float64 {
+		return float64(consumerLag.Load())
+	})
+)
@@ -0,0 +1,410 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/opentelemetry"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	brokers = flagutil.NewArrayString("kafka.brokers", "Comma-separated list of Kafka broker addresses for consuming logs from -kafka.topic. "+
+		"For example, -kafka.brokers=kafka1:9092,kafka2:9092. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/")
+	topics = flagutil.NewArrayString("kafka.topic", "Kafka topics to consume logs from. Every topic can be configured via the corresponding -kafka.topic.* flags. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/")
+	topicFormat = flagutil.NewArrayString("kafka.topic.format", "Format of messages at the corresponding -kafka.topic. "+
+		"Supported values: json, otlp_proto, otlp_json. By default json is used. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#message-formats")
+	topicTenantID = flagutil.NewArrayString("kafka.topic.tenantID", "TenantID for logs consumed from the corresponding -kafka.topic. By default 0:0 is used. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/")
+	topicStreamFields = flagutil.NewArrayString("kafka.topic.streamFields", "Fields to use as log stream fields for logs consumed from the corresponding -kafka.topic. "+
+		`For example, -kafka.topic.streamFields='["host","app"]'. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#stream-fields`)
+	topicIgnoreFields = flagutil.NewArrayString("kafka.topic.ignoreFields", "Fields to ignore for logs consumed from the corresponding -kafka.topic. "+
+		`For example, -kafka.topic.ignoreFields='["trace_id","span_id"]'. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/`)
+	topicMsgField = flagutil.NewArrayString("kafka.topic.msgField", "Fields to use as log message for logs consumed from the corresponding -kafka.topic. "+
+		`For example, -kafka.topic.msgField='["message","log"]'. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/`)
+	topicTimeField = flagutil.NewArrayString("kafka.topic.timeField", "Fields to use as log timestamp for logs consumed from the corresponding -kafka.topic in json format. "+
+		`For example, -kafka.topic.timeField='["ts"]'. By default _time field is used. Kafka record timestamp is used if these fields are missing. `+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/")
+
+	groupID = flag.String("kafka.groupID", "victorialogs", "Kafka consumer group id for consuming logs from -kafka.topic. "+
+		"VictoriaLogs instances with the same consumer group id share the consumed topic partitions. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#scaling")
+	clientID      = flag.String("kafka.clientID", "victorialogs", "Client id to send to Kafka brokers")
+	initialOffset = flag.String("kafka.initialOffset", "earliest", "The offset to start consuming -kafka.topic partitions without committed offsets from. "+
+		"Supported values: earliest, latest")
+	fetchMaxBytes = flagutil.NewBytes("kafka.fetchMaxBytes", 16*1024*1024, "The maximum size of records to fetch from a single Kafka broker per request")
+
+	saslMechanism = flag.String("kafka.sasl.mechanism", "", "Optional SASL mechanism for authenticating at Kafka brokers. "+
+		"Supported values: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#security")
+	saslUsername = flag.String("kafka.sasl.username", "", "Username for SASL authentication at Kafka brokers. See -kafka.sasl.mechanism")
+	saslPassword = flagutil.NewPassword("kafka.sasl.password", "Password for SASL authentication at Kafka brokers. See -kafka.sasl.mechanism")
+
+	useTLS = flag.Bool("kafka.tls", false, "Whether to use TLS for connecting to Kafka brokers. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#security")
+	tlsCAFile             = flag.String("kafka.tlsCAFile", "", "Optional path to TLS CA file for verifying Kafka broker certificates. By default the system CA is used")
+	tlsCertFile           = flag.String("kafka.tlsCertFile", "", "Optional path to client-side TLS certificate file for connecting to Kafka brokers")
+	tlsKeyFile            = flag.String("kafka.tlsKeyFile", "", "Optional path to client-side TLS key file for connecting to Kafka brokers")
+	tlsServerName         = flag.String("kafka.tlsServerName", "", "Optional TLS server name for verifying Kafka broker certificates")
+	tlsInsecureSkipVerify = flag.Bool("kafka.tlsInsecureSkipVerify", false, "Whether to skip verification of Kafka broker certificates")
+)
+
+// Supported message formats.
+const (
+	formatJSON      = "json"
+	formatOTLPProto = "otlp_proto"
+	formatOTLPJSON  = "otlp_json"
+)
+
+var (
+	workersWG     sync.WaitGroup
+	workersStopCh chan struct{}
+)
+
+// MustInit starts consuming logs from -kafka.topic.
+//
+// This function must be called after flag.Parse().
+//
+// MustStop() must be called in order to stop consuming logs.
+func MustInit() {
+	if workersStopCh != nil {
+		logger.Panicf("BUG: MustInit() called twice without MustStop() call")
+	}
+	workersStopCh = make(chan struct{})
+
+	if len(*topics) == 0 {
+		return
+	}
+	c, err := newConsumerFromFlags(workersStopCh)
+	if err != nil {
+		logger.Fatalf("cannot initialize Kafka consumer: %s", err)
+	}
+	workersWG.Add(1)
+	go func() {
+		defer workersWG.Done()
+		logger.Infof("started consuming logs from Kafka topics %q via consumer group %q", []string(*topics), *groupID)
+		c.run()
+		logger.Infof("stopped consuming logs from Kafka topics %q", []string(*topics))
+	}()
+}
+
+// MustStop stops consuming logs from -kafka.topic.
+func MustStop() {
+	close(workersStopCh)
+	workersWG.Wait()
+	workersStopCh = nil
+}
+
+// IsEnabled returns true if Kafka consumer is configured via -kafka.topic command-line flag.
+func IsEnabled() bool {
+	return len(*topics) > 0
+}
+
+// CheckConfig verifies -kafka.* command-line flags without connecting to Kafka brokers.
+func CheckConfig() error {
+	if len(*topics) == 0 {
+		return nil
+	}
+	if _, err := getTopicConfigs(); err != nil {
+		return fmt.Errorf("invalid config for Kafka consumer: %w", err)
+	}
+	if _, err := getClientOpts(); err != nil {
+		return fmt.Errorf("invalid config for Kafka consumer: %w", err)
+	}
+	return nil
+}
+
+// newConsumerFromFlags returns consumer configured via -kafka.* command-line flags.
+func newConsumerFromFlags(stopCh <-chan struct{}) (*consumer, error) {
+	tcs, err := getTopicConfigs()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := getClientOpts()
+	if err != nil {
+		return nil, err
+	}
+	return newConsumer(opts, *groupID, tcs, stopCh)
+}
+
+func getTopicConfigs() ([]*topicConfig, error) {
+	tcs := make([]*topicConfig, len(*topics))
+	for i := range *topics {
+		tc, err := getTopicConfig(i)
+		if err != nil {
+			return nil, err
+		}
+		tcs[i] = tc
+	}
+	return tcs, nil
+}
+
+// getClientOpts returns options for Kafka client configured via -kafka.* command-line flags.
+func getClientOpts() ([]kgo.Opt, error) {
+	if len(*brokers) == 0 {
+		return nil, fmt.Errorf("-kafka.brokers must be set when -kafka.topic is set")
+	}
+
+	var offset kgo.Offset
+	switch *initialOffset {
+	case "earliest":
+		offset = kgo.NewOffset().AtStart()
+	case "latest":
+		offset = kgo.NewOffset().AtEnd()
+	default:
+		return nil, fmt.Errorf("unsupported -kafka.initialOffset=%q; supported values: earliest, latest", *initialOffset)
+	}
+
+	maxBytes := fetchMaxBytes.IntN()
+	if maxBytes <= 0 || maxBytes > maxFetchMaxBytes {
+		return nil, fmt.Errorf("-kafka.fetchMaxBytes=%d must be in the range [1..%d]", maxBytes, maxFetchMaxBytes)
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(*brokers...),
+		kgo.ClientID(*clientID),
+		kgo.ConsumeResetOffset(offset),
+		kgo.FetchMaxBytes(int32(maxBytes)),
+		kgo.FetchMaxPartitionBytes(int32(min(maxBytes, partitionMaxBytes))),
+		kgo.BrokerMaxReadBytes(int32(max(maxBytes, brokerMaxReadBytes))),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.WithLogger(kgoLogger{}),
+	}
+
+	mechanism, err := getSASLMechanism()
+	if err != nil {
+		return nil, err
+	}
+	if mechanism != nil {
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	if *useTLS {
+		tlsOpts := &promauth.Options{
+			TLSConfig: &promauth.TLSConfig{
+				CAFile:             *tlsCAFile,
+				CertFile:           *tlsCertFile,
+				KeyFile:            *tlsKeyFile,
+				ServerName:         *tlsServerName,
+				InsecureSkipVerify: *tlsInsecureSkipVerify,
+			},
+		}
+		ac, err := tlsOpts.NewConfig()
+		if err != nil {
+			return nil, fmt.Errorf("cannot initialize TLS config for -kafka.tls: %w", err)
+		}
+		opts = append(opts, kgo.Dialer(newTLSDialFunc(ac)))
+	}
+
+	return opts, nil
+}
+
+const (
+	partitionMaxBytes  = 4 * 1024 * 1024
+	brokerMaxReadBytes = 100 * 1024 * 1024
+	maxFetchMaxBytes   = 1024 * 1024 * 1024
+)
+
+func getSASLMechanism() (sasl.Mechanism, error) {
+	switch *saslMechanism {
+	case "":
+		return nil, nil
+	case "PLAIN":
+		a := plain.Auth{
+			User: *saslUsername,
+			Pass: saslPassword.Get(),
+		}
+		return a.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		a := scram.Auth{
+			User: *saslUsername,
+			Pass: saslPassword.Get(),
+		}
+		return a.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		a := scram.Auth{
+			User: *saslUsername,
+			Pass: saslPassword.Get(),
+		}
+		return a.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("unsupported -kafka.sasl.mechanism=%q; supported values: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512", *saslMechanism)
+	}
+}
+
+// newTLSDialFunc returns a function for establishing TLS connections to Kafka brokers according to ac.
+//
+// TLS config is obtained from ac on every connection, so the updated TLS files are picked up without restart.
+func newTLSDialFunc(ac *promauth.Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		tlsCfg, err := ac.GetTLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("cannot initialize TLS config for -kafka.tls: %w", err)
+		}
+		d := &tls.Dialer{
+			NetDialer: &net.Dialer{
+				Timeout: dialTimeout,
+			},
+			Config: tlsCfg,
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+const dialTimeout = 10 * time.Second
+
+// topicConfig contains configuration for consuming logs from a single Kafka topic.
+type topicConfig struct {
+	topic  string
+	format string
+	cp     *insertutil.CommonParams
+}
+
+func getTopicConfig(argIdx int) (*topicConfig, error) {
+	topic := topics.GetOptionalArg(argIdx)
+
+	format := topicFormat.GetOptionalArg(argIdx)
+	switch format {
+	case "":
+		format = formatJSON
+	case formatJSON, formatOTLPProto, formatOTLPJSON:
+	default:
+		return nil, fmt.Errorf("unsupported -kafka.topic.format=%q for -kafka.topic=%q; supported values: %s, %s, %s", format, topic, formatJSON, formatOTLPProto, formatOTLPJSON)
+	}
+
+	tenantIDStr := topicTenantID.GetOptionalArg(argIdx)
+	tenantID, err := logstorage.ParseTenantID(tenantIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.topic.tenantID=%q for -kafka.topic=%q: %w", tenantIDStr, topic, err)
+	}
+
+	streamFields, err := getFieldsList("streamFields", topicStreamFields, argIdx, topic)
+	if err != nil {
+		return nil, err
+	}
+	ignoreFields, err := getFieldsList("ignoreFields", topicIgnoreFields, argIdx, topic)
+	if err != nil {
+		return nil, err
+	}
+	msgFields, err := getFieldsList("msgField", topicMsgField, argIdx, topic)
+	if err != nil {
+		return nil, err
+	}
+	timeFields, err := getFieldsList("timeField", topicTimeField, argIdx, topic)
+	if err != nil {
+		return nil, err
+	}
+	if len(timeFields) == 0 {
+		timeFields = []string{"_time"}
+	}
+
+	tc := &topicConfig{
+		topic:  topic,
+		format: format,
+		cp: &insertutil.CommonParams{
+			TenantID:     tenantID,
+			TimeFields:   timeFields,
+			MsgFields:    msgFields,
+			StreamFields: streamFields,
+			IgnoreFields: ignoreFields,
+		},
+	}
+	return tc, nil
+}
+
+// getFieldsList returns the list of fields from JSON array at the given argIdx for the -kafka.topic.<name> flag.
+func getFieldsList(name string, a *flagutil.ArrayString, argIdx int, topic string) ([]string, error) {
+	s := a.GetOptionalArg(argIdx)
+	if s == "" {
+		return nil, nil
+	}
+	var fields []string
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.topic.%s=%q for -kafka.topic=%q: %w", name, s, topic, err)
+	}
+	return fields, nil
+}
+
+// processRecords sends logs from rs fetched from tp to the storage.
+func (tc *topicConfig) processRecords(tp topicPartition, rs []*kgo.Record) {
+	im := tc.cp.GetIngestionMetrics("kafka")
+	lmp := tc.cp.NewLogMessageProcessor("kafka", false)
+	for _, r := range rs {
+		// Records are decompressed by Kafka client, so the size of compressed records is unknown.
+		im.AddReceivedBytes(len(r.Value))
+		im.AddUncompressedBytes(len(r.Value))
+		if err := tc.processRecord(lmp, r); err != nil {
+			im.AddParseErrors(1)
+			errorsTotal.Inc()
+			invalidRecordsLogger.Errorf("kafka: cannot process record at offset %d from partition %s: %s", r.Offset, tp, err)
+		}
+	}
+	lmp.MustClose()
+}
+
+var invalidRecordsLogger = logger.WithThrottler("kafka_invalid_records", 5*time.Second)
+
+// processRecord sends logs from r to lmp according to tc.
+func (tc *topicConfig) processRecord(lmp insertutil.LogMessageProcessor, r *kgo.Record) error {
+	useDefaultStreamFields := len(tc.cp.StreamFields) == 0
+	switch tc.format {
+	case formatOTLPProto:
+		return opentelemetry.PushProtobufLogsData(r.Value, lmp, tc.cp.MsgFields, useDefaultStreamFields)
+	case formatOTLPJSON:
+		return opentelemetry.PushJSONLogsData(r.Value, lmp, tc.cp.MsgFields, useDefaultStreamFields)
+	default:
+		return tc.processJSONRecord(lmp, r)
+	}
+}
+
+func (tc *topicConfig) processJSONRecord(lmp insertutil.LogMessageProcessor, r *kgo.Record) error {
+	p := logstorage.GetJSONParser()
+	defer logstorage.PutJSONParser(p)
+
+	if err := p.ParseLogMessage(r.Value); err != nil {
+		return err
+	}
+
+	// Use the record timestamp if the message doesn't contain time fields.
+	// Records written by old Kafka clients may have no timestamp. The current time is used for them.
+	ts := r.Timestamp.UnixNano()
+	if r.Timestamp.UnixMilli() < 0 {
+		ts = time.Now().UnixNano()
+	}
+	if hasAnyField(p.Fields, tc.cp.TimeFields) {
+		var err error
+		ts, err = insertutil.ExtractTimestampFromFields(tc.cp.TimeFields, p.Fields)
+		if err != nil {
+			return err
+		}
+	}
+	logstorage.RenameField(p.Fields, tc.cp.MsgFields, "_msg")
+	lmp.AddRow(ts, p.Fields, -1)
+	return nil
+}
+
+func hasAnyField(fields []logstorage.Field, names []string) bool {
+	for _, f := range fields {
+		for _, name := range names {
+			if f.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
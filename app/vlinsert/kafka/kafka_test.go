@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+const testBaseTimestamp = 1700000000000
+
+func TestProcessRecord_Success(t *testing.T) {
+	f := func(format string, msgFields []string, value string, timestampsExpected []int64, resultExpected string) {
+		t.Helper()
+
+		tc := &topicConfig{
+			topic:  "logs",
+			format: format,
+			cp: &insertutil.CommonParams{
+				TimeFields: []string{"_time"},
+				MsgFields:  msgFields,
+				// Explicitly set stream fields, since TestLogMessageProcessor doesn't support default OpenTelemetry stream fields.
+				StreamFields: []string{"service.name"},
+			},
+		}
+		r := &kgo.Record{
+			Timestamp: time.UnixMilli(testBaseTimestamp),
+			Value:     []byte(value),
+		}
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := tc.processRecord(tlp, r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := tlp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// JSON message without time field gets the record timestamp
+	f(formatJSON, nil, `{"_msg":"foo","level":"info"}`, []int64{testBaseTimestamp * 1e6}, `{"_msg":"foo","level":"info"}`)
+
+	// JSON message with time field
+	f(formatJSON, nil, `{"_msg":"foo","_time":"2024-01-02T03:04:05Z"}`, []int64{1704164645000000000}, `{"_msg":"foo"}`)
+
+	// JSON message with custom message field
+	f(formatJSON, []string{"message"}, `{"message":"foo","host":"h1"}`, []int64{testBaseTimestamp * 1e6}, `{"_msg":"foo","host":"h1"}`)
+
+	// OpenTelemetry JSON
+	f(formatOTLPJSON, nil, `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"svc"}}]},"scopeLogs":[{"logRecords":[{"timeUnixNano":"1234","body":{"stringValue":"foo"}}]}]}]}`,
+		[]int64{1234}, `{"service.name":"svc","_msg":"foo","severity":"Unspecified"}`)
+
+	// empty OpenTelemetry protobuf
+	f(formatOTLPProto, nil, ``, nil, ``)
+}
+
+func TestProcessRecord_Failure(t *testing.T) {
+	f := func(format, value string) {
+		t.Helper()
+
+		tc := &topicConfig{
+			topic:  "logs",
+			format: format,
+			cp: &insertutil.CommonParams{
+				TimeFields:   []string{"_time"},
+				StreamFields: []string{"service.name"},
+			},
+		}
+		r := &kgo.Record{
+			Timestamp: time.UnixMilli(testBaseTimestamp),
+			Value:     []byte(value),
+		}
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := tc.processRecord(tlp, r); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid JSON
+	f(formatJSON, `foo`)
+	f(formatJSON, `{"_msg":"foo"`)
+
+	// invalid time field
+	f(formatJSON, `{"_msg":"foo","_time":"bar"}`)
+
+	// invalid OpenTelemetry data
+	f(formatOTLPJSON, `{"resourceLogs":{}}`)
+	f(formatOTLPProto, "\xff\xff")
+}
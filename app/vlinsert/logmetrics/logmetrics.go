@@ -0,0 +1,554 @@
+package logmetrics
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	configPath = flag.String("logMetrics.config", "", "Optional path to a file with rules for extracting metrics from the ingested logs. "+
+		"The extracted metrics are sent to -logMetrics.remoteWriteURL; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#metrics-extraction")
+	remoteWriteURL = flag.String("logMetrics.remoteWriteURL", "", "Prometheus remote write url for sending metrics extracted from the ingested logs according to -logMetrics.config. "+
+		"For example, http://victoriametrics:8428/api/v1/write")
+	flushInterval = flag.Duration("logMetrics.flushInterval", 10*time.Second, "The interval for sending metrics extracted from the ingested logs to -logMetrics.remoteWriteURL")
+	maxSeries     = flag.Int("logMetrics.maxSeries", 100_000, "The maximum number of series, which can be extracted from the ingested logs according to -logMetrics.config. "+
+		"Logs for new series are ignored when the limit is reached")
+	extraLabels = flagutil.NewArrayString("logMetrics.extraLabel", "Optional extra label in the form 'name=value' to add to all the metrics extracted from the ingested logs. "+
+		"For example, -logMetrics.extraLabel=instance=vlinsert-1 . This is useful for distinguishing metrics sent from multiple vlinsert nodes")
+)
+
+// seriesStaleTimeout is the duration after which the series without new samples is removed.
+const seriesStaleTimeout = time.Hour
+
+// maxSummarySamples is the maximum number of samples, which are kept per every summary series between flushes.
+const maxSummarySamples = 1024
+
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var defaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+var (
+	seriesDropped   = metrics.NewCounter(`vl_log_metrics_series_dropped_total`)
+	sendErrors      = metrics.NewCounter(`vl_log_metrics_remote_write_errors_total`)
+	samplesSent     = metrics.NewCounter(`vl_log_metrics_samples_sent_total`)
+	globalExtractor *extractor
+)
+
+// Init initializes metrics extraction from the ingested logs according to -logMetrics.config.
+//
+// Stop must be called when metrics extraction is no longer needed.
+func Init() {
+	if *configPath == "" {
+		return
+	}
+	rules, labels, err := loadConfig()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	e := newExtractor(rules, labels, *maxSeries)
+	globalExtractor = e
+	_ = metrics.NewGauge(`vl_log_metrics_series`, func() float64 {
+		return float64(e.seriesCount())
+	})
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.runFlusher(*remoteWriteURL, *flushInterval)
+	}()
+
+	insertutil.AddLogRowsWatcher(e)
+	logger.Infof("loaded %d rules for metrics extraction from -logMetrics.config=%q", len(rules), *configPath)
+}
+
+// CheckConfig verifies -logMetrics.* command-line flags and -logMetrics.config without starting metrics extraction.
+func CheckConfig() error {
+	if *configPath == "" {
+		return nil
+	}
+	_, _, err := loadConfig()
+	return err
+}
+
+func loadConfig() ([]*Rule, []prompb.Label, error) {
+	if *remoteWriteURL == "" {
+		return nil, nil, fmt.Errorf("missing -logMetrics.remoteWriteURL for sending metrics extracted according to -logMetrics.config=%q", *configPath)
+	}
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read -logMetrics.config: %w", err)
+	}
+	rules, err := parseRules(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse -logMetrics.config=%q: %w", *configPath, err)
+	}
+	labels, err := parseExtraLabels(*extraLabels)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse -logMetrics.extraLabel: %w", err)
+	}
+	return rules, labels, nil
+}
+
+// Stop stops metrics extraction and sends the remaining metrics to -logMetrics.remoteWriteURL.
+func Stop() {
+	e := globalExtractor
+	if e == nil {
+		return
+	}
+	close(e.stopCh)
+	e.wg.Wait()
+	globalExtractor = nil
+}
+
+// Rule is a rule for extracting metrics from the ingested logs.
+type Rule struct {
+	// Name is the metric name
+	Name string `yaml:"name"`
+
+	// Filter is LogsQL filter for selecting logs to extract the metric from
+	Filter string `yaml:"filter"`
+
+	// Field is the name of log field with numeric value for the metric
+	Field string `yaml:"field"`
+
+	// Type is the metric type - either histogram or summary. By default histogram is used
+	Type string `yaml:"type,omitempty"`
+
+	// Scale is an optional multiplier for the field value. For example, 0.001 converts milliseconds to seconds
+	Scale float64 `yaml:"scale,omitempty"`
+
+	// Buckets contains upper bounds for histogram buckets
+	Buckets []float64 `yaml:"buckets,omitempty"`
+
+	// Quantiles contains quantiles for summary
+	Quantiles []float64 `yaml:"quantiles,omitempty"`
+
+	// Labels contains names of log fields to use as metric labels
+	Labels []string `yaml:"labels,omitempty"`
+
+	// Tenant is an optional tenant in the form AccountID:ProjectID to extract the metric from. By default logs from all the tenants are used
+	Tenant string `yaml:"tenant,omitempty"`
+
+	f        *logstorage.Filter
+	tenantID *logstorage.TenantID
+}
+
+type rulesConfig struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+func parseRules(data []byte) ([]*Rule, error) {
+	var cfg rulesConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{})
+	for i, r := range cfg.Rules {
+		if err := r.init(); err != nil {
+			return nil, fmt.Errorf("invalid rule #%d: %w", i+1, err)
+		}
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = struct{}{}
+	}
+	return cfg.Rules, nil
+}
+
+func (r *Rule) init() error {
+	if !isValidMetricName(r.Name) {
+		return fmt.Errorf("invalid name %q; it must match [a-zA-Z_:][a-zA-Z0-9_:]*", r.Name)
+	}
+	if r.Field == "" {
+		return fmt.Errorf("missing field for the rule %q", r.Name)
+	}
+	if r.Filter == "" {
+		r.Filter = "*"
+	}
+	f, err := logstorage.ParseFilter(r.Filter)
+	if err != nil {
+		return fmt.Errorf("cannot parse filter %q for the rule %q: %w", r.Filter, r.Name, err)
+	}
+	r.f = f
+
+	switch r.Type {
+	case "", "histogram":
+		r.Type = "histogram"
+		if len(r.Buckets) == 0 {
+			r.Buckets = defaultBuckets
+		}
+		if !slices.IsSorted(r.Buckets) {
+			return fmt.Errorf("buckets for the rule %q must be sorted in ascending order", r.Name)
+		}
+	case "summary":
+		if len(r.Quantiles) == 0 {
+			r.Quantiles = defaultQuantiles
+		}
+		for _, q := range r.Quantiles {
+			if q < 0 || q > 1 {
+				return fmt.Errorf("quantile %v for the rule %q must be in the range [0..1]", q, r.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %q for the rule %q; supported types: histogram, summary", r.Type, r.Name)
+	}
+	if r.Scale == 0 {
+		r.Scale = 1
+	}
+	for _, label := range r.Labels {
+		if !isValidLabelName(label) {
+			return fmt.Errorf("invalid label %q for the rule %q; it must match [a-zA-Z_][a-zA-Z0-9_]*", label, r.Name)
+		}
+	}
+	if r.Tenant != "" {
+		tenantID, err := logstorage.ParseTenantID(r.Tenant)
+		if err != nil {
+			return fmt.Errorf("cannot parse tenant for the rule %q: %w", r.Name, err)
+		}
+		r.tenantID = &tenantID
+	}
+	return nil
+}
+
+func isValidMetricName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func isValidLabelName(s string) bool {
+	return isValidMetricName(s) && !strings.Contains(s, ":")
+}
+
+func parseExtraLabels(a []string) ([]prompb.Label, error) {
+	var labels []prompb.Label
+	for _, s := range a {
+		name, value, ok := strings.Cut(s, "=")
+		if !ok || !isValidLabelName(name) {
+			return nil, fmt.Errorf("invalid label %q; it must be in the form 'name=value'", s)
+		}
+		labels = append(labels, prompb.Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	return labels, nil
+}
+
+// extractor extracts metrics from the ingested logs.
+//
+// It implements insertutil.LogRowsWatcher.
+type extractor struct {
+	rules       []*Rule
+	extraLabels []prompb.Label
+	maxSeries   int
+
+	// mu protects series
+	mu     sync.Mutex
+	series map[string]*series
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newExtractor(rules []*Rule, extraLabels []prompb.Label, maxSeries int) *extractor {
+	return &extractor{
+		rules:       rules,
+		extraLabels: extraLabels,
+		maxSeries:   maxSeries,
+		series:      make(map[string]*series),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// series holds the state for a single extracted histogram or summary.
+type series struct {
+	rule   *Rule
+	labels []prompb.Label
+
+	// bucketCounts contains the number of samples per every rule.Buckets item plus +Inf bucket.
+	bucketCounts []uint64
+
+	// samples contains the samples for calculating summary quantiles since the last flush.
+	samples      []float64
+	samplesTotal uint64
+
+	count uint64
+	sum   float64
+
+	lastUpdate time.Time
+}
+
+func (e *extractor) seriesCount() int {
+	e.mu.Lock()
+	n := len(e.series)
+	e.mu.Unlock()
+	return n
+}
+
+// WatchLogRows extracts metrics from lr according to the configured rules.
+func (e *extractor) WatchLogRows(lr *logstorage.LogRows) {
+	var fields []logstorage.Field
+	var timestampBuf []byte
+	var key []byte
+	lr.ForEachRow(func(_ uint64, r *logstorage.InsertRow) {
+		fields = fields[:0]
+		for _, rule := range e.rules {
+			if rule.tenantID != nil && *rule.tenantID != r.TenantID {
+				continue
+			}
+			if len(fields) == 0 {
+				fields, timestampBuf = insertutil.AppendInsertRowFields(fields, timestampBuf[:0], r)
+			}
+			if !rule.f.MatchRow(fields) {
+				continue
+			}
+			v, ok := getFieldValue(fields, rule.Field)
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(n) {
+				continue
+			}
+			key = e.updateSeries(key[:0], rule, fields, n*rule.Scale)
+		}
+	})
+}
+
+func getFieldValue(fields []logstorage.Field, name string) (string, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+func (e *extractor) updateSeries(key []byte, rule *Rule, fields []logstorage.Field, v float64) []byte {
+	key = append(key, rule.Name...)
+	for _, label := range rule.Labels {
+		value, _ := getFieldValue(fields, label)
+		key = append(key, 0)
+		key = append(key, value...)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := e.series[string(key)]
+	if s == nil {
+		if len(e.series) >= e.maxSeries {
+			seriesDropped.Inc()
+			return key
+		}
+		s = newSeries(rule, fields)
+		e.series[string(key)] = s
+	}
+	s.update(v)
+	return key
+}
+
+func newSeries(rule *Rule, fields []logstorage.Field) *series {
+	var labels []prompb.Label
+	for _, label := range rule.Labels {
+		value, _ := getFieldValue(fields, label)
+		if value == "" {
+			continue
+		}
+		labels = append(labels, prompb.Label{
+			Name:  label,
+			Value: strings.Clone(value),
+		})
+	}
+	s := &series{
+		rule:   rule,
+		labels: labels,
+	}
+	if rule.Type == "histogram" {
+		s.bucketCounts = make([]uint64, len(rule.Buckets)+1)
+	}
+	return s
+}
+
+func (s *series) update(v float64) {
+	s.count++
+	s.sum += v
+	s.lastUpdate = time.Now()
+
+	if s.rule.Type == "histogram" {
+		idx := sort.SearchFloat64s(s.rule.Buckets, v)
+		s.bucketCounts[idx]++
+		return
+	}
+
+	// Use reservoir sampling for limiting the memory usage for summary samples.
+	s.samplesTotal++
+	if len(s.samples) < maxSummarySamples {
+		s.samples = append(s.samples, v)
+		return
+	}
+	if n := rand.Uint64() % s.samplesTotal; n < maxSummarySamples {
+		s.samples[n] = v
+	}
+}
+
+func (e *extractor) runFlusher(remoteWriteURL string, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	hc := &http.Client{
+		Timeout: time.Minute,
+	}
+	for {
+		select {
+		case <-e.stopCh:
+			e.flush(hc, remoteWriteURL, time.Now())
+			return
+		case <-t.C:
+			e.flush(hc, remoteWriteURL, time.Now())
+		}
+	}
+}
+
+func (e *extractor) flush(hc *http.Client, remoteWriteURL string, now time.Time) {
+	wr := e.getWriteRequest(now)
+	if len(wr.Timeseries) == 0 {
+		return
+	}
+	if err := sendWriteRequest(hc, remoteWriteURL, wr); err != nil {
+		// There is no need in retrying, since the next flush sends the updated cumulative values.
+		logger.Warnf("cannot send metrics extracted from logs to -logMetrics.remoteWriteURL: %s", err)
+		sendErrors.Inc()
+		return
+	}
+	samplesSent.Add(len(wr.Timeseries))
+}
+
+// getWriteRequest returns the current state of all the tracked series at the given time and removes stale series.
+func (e *extractor) getWriteRequest(now time.Time) *prompb.WriteRequest {
+	timestamp := now.UnixMilli()
+	wr := &prompb.WriteRequest{}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for key, s := range e.series {
+		if now.Sub(s.lastUpdate) > seriesStaleTimeout {
+			delete(e.series, key)
+			continue
+		}
+		wr.Timeseries = s.appendTimeSeries(wr.Timeseries, e.extraLabels, timestamp)
+	}
+	return wr
+}
+
+func (s *series) appendTimeSeries(dst []prompb.TimeSeries, extraLabels []prompb.Label, timestamp int64) []prompb.TimeSeries {
+	name := s.rule.Name
+	if s.rule.Type == "histogram" {
+		cumulative := uint64(0)
+		for i, upperBound := range s.rule.Buckets {
+			cumulative += s.bucketCounts[i]
+			dst = s.appendSample(dst, name+"_bucket", extraLabels, "le", formatFloat(upperBound), float64(cumulative), timestamp)
+		}
+		dst = s.appendSample(dst, name+"_bucket", extraLabels, "le", "+Inf", float64(s.count), timestamp)
+	} else if len(s.samples) > 0 {
+		sort.Float64s(s.samples)
+		for _, q := range s.rule.Quantiles {
+			dst = s.appendSample(dst, name, extraLabels, "quantile", formatFloat(q), getQuantile(s.samples, q), timestamp)
+		}
+		// Quantiles are calculated over the samples received since the previous flush.
+		s.samples = s.samples[:0]
+		s.samplesTotal = 0
+	}
+	dst = s.appendSample(dst, name+"_sum", extraLabels, "", "", s.sum, timestamp)
+	dst = s.appendSample(dst, name+"_count", extraLabels, "", "", float64(s.count), timestamp)
+	return dst
+}
+
+func (s *series) appendSample(dst []prompb.TimeSeries, name string, extraLabels []prompb.Label, labelName, labelValue string, v float64, timestamp int64) []prompb.TimeSeries {
+	labels := make([]prompb.Label, 0, 2+len(s.labels)+len(extraLabels))
+	labels = append(labels, prompb.Label{
+		Name:  "__name__",
+		Value: name,
+	})
+	labels = append(labels, s.labels...)
+	labels = append(labels, extraLabels...)
+	if labelName != "" {
+		labels = append(labels, prompb.Label{
+			Name:  labelName,
+			Value: labelValue,
+		})
+	}
+	return append(dst, prompb.TimeSeries{
+		Labels: labels,
+		Samples: []prompb.Sample{{
+			Value:     v,
+			Timestamp: timestamp,
+		}},
+	})
+}
+
+func getQuantile(sortedSamples []float64, q float64) float64 {
+	idx := int(math.Round(q * float64(len(sortedSamples)-1)))
+	return sortedSamples[idx]
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sendWriteRequest(hc *http.Client, remoteWriteURL string, wr *prompb.WriteRequest) error {
+	data := wr.MarshalProtobuf(nil)
+	body := snappy.Encode(nil, data)
+
+	req, err := http.NewRequest(http.MethodPost, remoteWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response code %d; response body: %q", resp.StatusCode, respBody)
+	}
+	return nil
+}
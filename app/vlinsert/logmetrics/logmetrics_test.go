@@ -0,0 +1,300 @@
+package logmetrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParseRulesSuccess(t *testing.T) {
+	f := func(data string, rulesExpected int) {
+		t.Helper()
+
+		rules, err := parseRules([]byte(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(rules) != rulesExpected {
+			t.Fatalf("unexpected number of rules; got %d; want %d", len(rules), rulesExpected)
+		}
+	}
+
+	f(``, 0)
+	f(`
+rules:
+- name: nginx_request_duration_seconds
+  filter: '{app="nginx"}'
+  field: duration_ms
+  scale: 0.001
+  labels: [host]
+`, 1)
+	f(`
+rules:
+- name: foo
+  field: bar
+  type: summary
+  quantiles: [0.5, 1]
+  tenant: "12:34"
+- name: bar
+  field: baz
+  type: histogram
+  buckets: [1, 10, 100]
+`, 2)
+}
+
+func TestParseRulesFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		_, err := parseRules([]byte(data))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid yaml
+	f(`rules: foo`)
+
+	// unknown field
+	f(`
+rules:
+- name: foo
+  field: bar
+  unknown: baz
+`)
+
+	// invalid metric name
+	f(`
+rules:
+- name: foo-bar
+  field: bar
+`)
+
+	// missing field
+	f(`
+rules:
+- name: foo
+`)
+
+	// invalid filter
+	f(`
+rules:
+- name: foo
+  field: bar
+  filter: 'foo('
+`)
+
+	// unsupported type
+	f(`
+rules:
+- name: foo
+  field: bar
+  type: gauge
+`)
+
+	// unsorted buckets
+	f(`
+rules:
+- name: foo
+  field: bar
+  buckets: [10, 1]
+`)
+
+	// invalid quantile
+	f(`
+rules:
+- name: foo
+  field: bar
+  type: summary
+  quantiles: [1.5]
+`)
+
+	// invalid label
+	f(`
+rules:
+- name: foo
+  field: bar
+  labels: [foo.bar]
+`)
+
+	// invalid tenant
+	f(`
+rules:
+- name: foo
+  field: bar
+  tenant: abc
+`)
+
+	// duplicate names
+	f(`
+rules:
+- name: foo
+  field: bar
+- name: foo
+  field: baz
+`)
+}
+
+func TestExtractorWatchLogRows(t *testing.T) {
+	f := func(config string, resultExpected string) {
+		t.Helper()
+
+		rules, err := parseRules([]byte(config))
+		if err != nil {
+			t.Fatalf("cannot parse rules: %s", err)
+		}
+		extraLabels := []prompb.Label{{Name: "instance", Value: "foo"}}
+		e := newExtractor(rules, extraLabels, 3)
+
+		lr := logstorage.GetLogRows([]string{"app"}, nil, nil, nil, "")
+		defer logstorage.PutLogRows(lr)
+
+		ts := time.Date(2025, 1, 10, 12, 34, 56, 0, time.UTC).UnixNano()
+		addRow := func(tenantID logstorage.TenantID, app, host, duration string) {
+			lr.MustAdd(tenantID, ts, []logstorage.Field{
+				{Name: "_msg", Value: "GET /foo 200"},
+				{Name: "app", Value: app},
+				{Name: "host", Value: host},
+				{Name: "duration_ms", Value: duration},
+			}, -1)
+		}
+		addRow(logstorage.TenantID{}, "nginx", "h1", "5")
+		addRow(logstorage.TenantID{}, "nginx", "h1", "50")
+		addRow(logstorage.TenantID{}, "nginx", "h2", "2000")
+		addRow(logstorage.TenantID{}, "nginx", "h2", "not a number")
+		addRow(logstorage.TenantID{}, "apache", "h1", "10")
+		addRow(logstorage.TenantID{AccountID: 1}, "nginx", "h3", "20")
+
+		e.WatchLogRows(lr)
+
+		now := time.Unix(1000, 0)
+		wr := e.getWriteRequest(now)
+		result := marshalTimeSeries(wr.Timeseries)
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// histogram
+	f(`
+rules:
+- name: nginx_request_duration_seconds
+  filter: '{app="nginx"}'
+  field: duration_ms
+  scale: 0.001
+  buckets: [0.01, 0.1, 1]
+  labels: [host]
+  tenant: "0:0"
+`, `nginx_request_duration_seconds_bucket{host="h1",instance="foo",le="+Inf"} 2
+nginx_request_duration_seconds_bucket{host="h1",instance="foo",le="0.01"} 1
+nginx_request_duration_seconds_bucket{host="h1",instance="foo",le="0.1"} 2
+nginx_request_duration_seconds_bucket{host="h1",instance="foo",le="1"} 2
+nginx_request_duration_seconds_bucket{host="h2",instance="foo",le="+Inf"} 1
+nginx_request_duration_seconds_bucket{host="h2",instance="foo",le="0.01"} 0
+nginx_request_duration_seconds_bucket{host="h2",instance="foo",le="0.1"} 0
+nginx_request_duration_seconds_bucket{host="h2",instance="foo",le="1"} 0
+nginx_request_duration_seconds_count{host="h1",instance="foo"} 2
+nginx_request_duration_seconds_count{host="h2",instance="foo"} 1
+nginx_request_duration_seconds_sum{host="h1",instance="foo"} 0.055
+nginx_request_duration_seconds_sum{host="h2",instance="foo"} 2
+`)
+
+	// summary across all the tenants
+	f(`
+rules:
+- name: request_duration_ms
+  filter: 'GET'
+  field: duration_ms
+  type: summary
+  quantiles: [0, 0.5, 1]
+`, `request_duration_ms_count{instance="foo"} 5
+request_duration_ms_sum{instance="foo"} 2085
+request_duration_ms{instance="foo",quantile="0"} 5
+request_duration_ms{instance="foo",quantile="0.5"} 20
+request_duration_ms{instance="foo",quantile="1"} 2000
+`)
+
+	// series limit
+	f(`
+rules:
+- name: duration
+  field: duration_ms
+  type: summary
+  quantiles: [1]
+  labels: [app, host]
+`, `duration_count{app="apache",host="h1",instance="foo"} 1
+duration_count{app="nginx",host="h1",instance="foo"} 2
+duration_count{app="nginx",host="h2",instance="foo"} 1
+duration_sum{app="apache",host="h1",instance="foo"} 10
+duration_sum{app="nginx",host="h1",instance="foo"} 55
+duration_sum{app="nginx",host="h2",instance="foo"} 2000
+duration{app="apache",host="h1",instance="foo",quantile="1"} 10
+duration{app="nginx",host="h1",instance="foo",quantile="1"} 50
+duration{app="nginx",host="h2",instance="foo",quantile="1"} 2000
+`)
+}
+
+func TestExtractorRemoveStaleSeries(t *testing.T) {
+	rules, err := parseRules([]byte(`
+rules:
+- name: foo
+  field: bar
+`))
+	if err != nil {
+		t.Fatalf("cannot parse rules: %s", err)
+	}
+	e := newExtractor(rules, nil, 10)
+
+	lr := logstorage.GetLogRows(nil, nil, nil, nil, "")
+	defer logstorage.PutLogRows(lr)
+	lr.MustAdd(logstorage.TenantID{}, time.Now().UnixNano(), []logstorage.Field{
+		{Name: "bar", Value: "1"},
+	}, -1)
+	e.WatchLogRows(lr)
+
+	if n := e.seriesCount(); n != 1 {
+		t.Fatalf("unexpected number of series; got %d; want 1", n)
+	}
+	wr := e.getWriteRequest(time.Now())
+	if len(wr.Timeseries) == 0 {
+		t.Fatalf("expecting non-empty time series")
+	}
+
+	wr = e.getWriteRequest(time.Now().Add(2 * seriesStaleTimeout))
+	if len(wr.Timeseries) != 0 {
+		t.Fatalf("unexpected time series for stale series: %d", len(wr.Timeseries))
+	}
+	if n := e.seriesCount(); n != 0 {
+		t.Fatalf("unexpected number of series after removing stale series; got %d; want 0", n)
+	}
+}
+
+func marshalTimeSeries(tss []prompb.TimeSeries) string {
+	var lines []string
+	for _, ts := range tss {
+		var name string
+		var labels []string
+		for _, label := range ts.Labels {
+			if label.Name == "__name__" {
+				name = label.Value
+				continue
+			}
+			labels = append(labels, fmt.Sprintf("%s=%q", label.Name, label.Value))
+		}
+		sort.Strings(labels)
+		for _, s := range ts.Samples {
+			lines = append(lines, fmt.Sprintf("%s{%s} %s", name, strings.Join(labels, ","), formatFloat(s.Value)))
+		}
+	}
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
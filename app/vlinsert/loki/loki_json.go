@@ -9,7 +9,6 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastjson"
@@ -37,17 +36,26 @@ func handleJSON(r *http.Request, w http.ResponseWriter) {
 	}
 
 	encoding := r.Header.Get("Content-Encoding")
-	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
+	im := cp.cp.GetIngestionMetrics("loki_json")
+	err = insertutil.ReadUncompressedData("loki_json", im.NewReceivedBytesReader(r.Body), encoding, maxRequestSize, func(data []byte) error {
+		im.AddUncompressedBytes(len(data))
 		lmp := cp.cp.NewLogMessageProcessor("loki_json", false)
 		useDefaultStreamFields := len(cp.cp.StreamFields) == 0
 		err := parseJSONRequest(data, lmp, cp.cp.MsgFields, useDefaultStreamFields, cp.parseMessage)
 		lmp.MustClose()
+		if err != nil {
+			im.AddParseErrors(1)
+		}
 		return err
 	})
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot read Loki json data: %s", err)
 		return
 	}
+	if drr := cp.cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return
+	}
 
 	// update requestJSONDuration only for successfully parsed requests
 	// There is no need in updating requestJSONDuration for request errors,
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
 	"github.com/VictoriaMetrics/metrics"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
@@ -33,17 +32,26 @@ func handleProtobuf(r *http.Request, w http.ResponseWriter) {
 		// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#ingest-logs
 		encoding = "snappy"
 	}
-	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
+	im := cp.cp.GetIngestionMetrics("loki_protobuf")
+	err = insertutil.ReadUncompressedData("loki_protobuf", im.NewReceivedBytesReader(r.Body), encoding, maxRequestSize, func(data []byte) error {
+		im.AddUncompressedBytes(len(data))
 		lmp := cp.cp.NewLogMessageProcessor("loki_protobuf", false)
 		useDefaultStreamFields := len(cp.cp.StreamFields) == 0
 		err := parseProtobufRequest(data, lmp, cp.cp.MsgFields, useDefaultStreamFields, cp.parseMessage)
 		lmp.MustClose()
+		if err != nil {
+			im.AddParseErrors(1)
+		}
 		return err
 	})
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot read Loki protobuf data: %s", err)
 		return
 	}
+	if drr := cp.cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return
+	}
 
 	// update requestProtobufDuration only for successfully parsed requests
 	// There is no need in updating requestProtobufDuration for request errors,
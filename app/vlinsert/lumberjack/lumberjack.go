@@ -0,0 +1,341 @@
+package lumberjack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ingestserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	listenAddrs = flagutil.NewArrayString("lumberjack.listenAddr", "Comma-separated list of TCP addresses to listen to for logs sent via Lumberjack v2 protocol "+
+		"by Filebeat, Winlogbeat and other Beats with the logstash output. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#lumberjack-protocol")
+
+	streamFields = flagutil.NewArrayString("lumberjack.streamFields", "Comma-separated list of fields to use as log stream fields for logs ingested via Lumberjack protocol. "+
+		"By default host.name and agent.type fields are used. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#lumberjack-protocol")
+	ignoreFields = flagutil.NewArrayString("lumberjack.ignoreFields", "Comma-separated list of fields to ignore for logs ingested via Lumberjack protocol. "+
+		"By default @metadata.* fields are ignored. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#lumberjack-protocol")
+	msgFields = flagutil.NewArrayString("lumberjack.msgField", "Comma-separated list of fields to use as log message for logs ingested via Lumberjack protocol. "+
+		"By default message field is used. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#lumberjack-protocol")
+	tenantID = flag.String("lumberjack.tenantID", "0:0", "TenantID for logs ingested via Lumberjack protocol. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#lumberjack-protocol")
+
+	tlsEnable = flagutil.NewArrayBool("lumberjack.tls", "Whether to enable TLS for receiving logs at the corresponding -lumberjack.listenAddr. "+
+		"The corresponding -lumberjack.tlsCertFile and -lumberjack.tlsKeyFile must be set if -lumberjack.tls is set. See also -lumberjack.mtls")
+	tlsCertFile = flagutil.NewArrayString("lumberjack.tlsCertFile", "Path to file with TLS certificate for the corresponding -lumberjack.listenAddr if the corresponding -lumberjack.tls is set. "+
+		"The provided certificate file is automatically re-read every second, so it can be dynamically updated")
+	tlsKeyFile = flagutil.NewArrayString("lumberjack.tlsKeyFile", "Path to file with TLS key for the corresponding -lumberjack.listenAddr if the corresponding -lumberjack.tls is set. "+
+		"The provided key file is automatically re-read every second, so it can be dynamically updated")
+	tlsCipherSuites = flagutil.NewArrayString("lumberjack.tlsCipherSuites", "Optional list of TLS cipher suites for -lumberjack.listenAddr if -lumberjack.tls is set. "+
+		"See the list of supported cipher suites at https://pkg.go.dev/crypto/tls#pkg-constants")
+	tlsMinVersion = flag.String("lumberjack.tlsMinVersion", "TLS12", "The minimum TLS version to use for -lumberjack.listenAddr if -lumberjack.tls is set. "+
+		"Supported values: TLS10, TLS11, TLS12, TLS13")
+	mtlsEnable = flagutil.NewArrayBool("lumberjack.mtls", "Whether to require valid client certificate for TLS connections to the corresponding -lumberjack.listenAddr. "+
+		"This flag works only if -lumberjack.tls flag is set for the corresponding -lumberjack.listenAddr. See also -lumberjack.mtlsCAFile")
+	mtlsCAFile = flagutil.NewArrayString("lumberjack.mtlsCAFile", "Optional path to TLS Root CA for verifying client certificates at the corresponding -lumberjack.listenAddr "+
+		"when the corresponding -lumberjack.mtls is enabled. By default the host system TLS Root CA is used for client certificate verification")
+
+	maxFrameSize = flagutil.NewBytes("lumberjack.maxFrameSize", 64*1024*1024, "The maximum size in bytes of a single Lumberjack protocol frame after decompression")
+)
+
+// defaultStreamFields contains the log stream fields for logs ingested via Lumberjack protocol if -lumberjack.streamFields isn't set.
+var defaultStreamFields = []string{"host.name", "agent.type"}
+
+// defaultMsgFields contains the log message fields for logs ingested via Lumberjack protocol if -lumberjack.msgField isn't set.
+var defaultMsgFields = []string{"message"}
+
+// defaultIgnoreFields contains the fields to ignore for logs ingested via Lumberjack protocol if -lumberjack.ignoreFields isn't set.
+//
+// Beats put internal data such as the target index name into @metadata, which isn't sent to outputs by Logstash.
+var defaultIgnoreFields = []string{"@metadata.*"}
+
+// MustInit starts accepting logs via Lumberjack v2 protocol at -lumberjack.listenAddr.
+//
+// This function must be called after flag.Parse().
+//
+// MustStop() must be called in order to free up resources occupied by the initialized listeners.
+func MustInit() {
+	if workersStopCh != nil {
+		logger.Panicf("BUG: MustInit() called twice without MustStop() call")
+	}
+	workersStopCh = make(chan struct{})
+
+	if len(*listenAddrs) == 0 {
+		return
+	}
+	cp, err := getCommonParams()
+	if err != nil {
+		logger.Fatalf("cannot initialize Lumberjack protocol listeners: %s", err)
+	}
+
+	for argIdx, addr := range *listenAddrs {
+		tlsConfig, err := getTLSConfig(argIdx)
+		if err != nil {
+			logger.Fatalf("invalid TLS config for -lumberjack.listenAddr=%q: %s", addr, err)
+		}
+		workersWG.Add(1)
+		go func(addr string) {
+			runTCPListener(addr, tlsConfig, cp)
+			workersWG.Done()
+		}(addr)
+	}
+}
+
+var (
+	workersWG     sync.WaitGroup
+	workersStopCh chan struct{}
+)
+
+// IsEnabled returns true if Lumberjack protocol listeners are configured via -lumberjack.listenAddr command-line flag.
+func IsEnabled() bool {
+	return len(*listenAddrs) > 0
+}
+
+// CheckConfig verifies -lumberjack.* command-line flags without starting Lumberjack protocol listeners.
+func CheckConfig() error {
+	if len(*listenAddrs) == 0 {
+		return nil
+	}
+	var errs []error
+	if _, err := getCommonParams(); err != nil {
+		errs = append(errs, fmt.Errorf("invalid config for Lumberjack protocol listeners: %w", err))
+	}
+	for argIdx, addr := range *listenAddrs {
+		if _, err := getTLSConfig(argIdx); err != nil {
+			errs = append(errs, fmt.Errorf("invalid TLS config for -lumberjack.listenAddr=%q: %w", addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MustStop stops Lumberjack protocol listeners initialized via MustInit()
+func MustStop() {
+	close(workersStopCh)
+	workersWG.Wait()
+	workersStopCh = nil
+}
+
+func getCommonParams() (*insertutil.CommonParams, error) {
+	tid, err := logstorage.ParseTenantID(*tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -lumberjack.tenantID=%q: %w", *tenantID, err)
+	}
+	sfs := *streamFields
+	if len(sfs) == 0 {
+		sfs = defaultStreamFields
+	}
+	mfs := *msgFields
+	if len(mfs) == 0 {
+		mfs = defaultMsgFields
+	}
+	ifs := *ignoreFields
+	if len(ifs) == 0 {
+		ifs = defaultIgnoreFields
+	}
+	cp := &insertutil.CommonParams{
+		TenantID:     tid,
+		TimeFields:   []string{"@timestamp"},
+		MsgFields:    mfs,
+		StreamFields: sfs,
+		IgnoreFields: ifs,
+	}
+	return cp, nil
+}
+
+// getTLSConfig returns TLS config for -lumberjack.listenAddr at the given argIdx.
+//
+// nil is returned if TLS isn't enabled for the given listener.
+func getTLSConfig(argIdx int) (*tls.Config, error) {
+	if !tlsEnable.GetOptionalArg(argIdx) {
+		return nil, nil
+	}
+	certFile := tlsCertFile.GetOptionalArg(argIdx)
+	keyFile := tlsKeyFile.GetOptionalArg(argIdx)
+	tc, err := netutil.GetServerTLSConfig(certFile, keyFile, *tlsMinVersion, *tlsCipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS cert from -lumberjack.tlsCertFile=%q, -lumberjack.tlsKeyFile=%q, -lumberjack.tlsMinVersion=%q, -lumberjack.tlsCipherSuites=%q: %w",
+			certFile, keyFile, *tlsMinVersion, *tlsCipherSuites, err)
+	}
+	if mtlsEnable.GetOptionalArg(argIdx) {
+		caFile := mtlsCAFile.GetOptionalArg(argIdx)
+		if err := setClientCertVerification(tc, caFile); err != nil {
+			return nil, fmt.Errorf("cannot set up client certificate verification with -lumberjack.mtlsCAFile=%q: %w", caFile, err)
+		}
+	}
+	return tc, nil
+}
+
+// setClientCertVerification configures tc to require and verify client certificates.
+//
+// Client certificates are verified against root CA certificates from caFile if it isn't empty.
+// Otherwise the host system root CA certificates are used.
+func setClientCertVerification(tc *tls.Config, caFile string) error {
+	tc.ClientAuth = tls.RequireAndVerifyClientCert
+	if caFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("cannot read root CA file: %w", err)
+	}
+	cp := x509.NewCertPool()
+	if !cp.AppendCertsFromPEM(data) {
+		return fmt.Errorf("cannot find PEM-encoded certificates in %q", caFile)
+	}
+	tc.ClientCAs = cp
+	return nil
+}
+
+func runTCPListener(addr string, tlsConfig *tls.Config, cp *insertutil.CommonParams) {
+	ln, err := netutil.NewTCPListener("lumberjack", addr, false, tlsConfig)
+	if err != nil {
+		logger.Fatalf("lumberjack: cannot start TCP listener at %s: %s", addr, err)
+	}
+
+	doneCh := make(chan struct{})
+	go func() {
+		serveStreamListener(ln, cp)
+		close(doneCh)
+	}()
+
+	logger.Infof("started accepting logs via Lumberjack protocol at -lumberjack.listenAddr=%q", addr)
+	<-workersStopCh
+	if err := ln.Close(); err != nil {
+		logger.Fatalf("lumberjack: cannot close TCP listener at %s: %s", addr, err)
+	}
+	<-doneCh
+	logger.Infof("finished accepting logs via Lumberjack protocol at -lumberjack.listenAddr=%q", addr)
+}
+
+func serveStreamListener(ln net.Listener, cp *insertutil.CommonParams) {
+	var cm ingestserver.ConnsMap
+	cm.Init("lumberjack")
+
+	var wg sync.WaitGroup
+	addr := ln.Addr()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) {
+				if ne.Temporary() {
+					logger.Errorf("lumberjack: temporary error when listening for TCP addr %q: %s", addr, err)
+					time.Sleep(time.Second)
+					continue
+				}
+				if strings.Contains(err.Error(), "use of closed network connection") {
+					break
+				}
+				logger.Fatalf("lumberjack: unrecoverable error when accepting TCP connections at %q: %s", addr, err)
+			}
+			logger.Fatalf("lumberjack: unexpected error when accepting TCP connections at %q: %s", addr, err)
+		}
+		if !cm.Add(c) {
+			_ = c.Close()
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			if err := processConn(c, cp); err != nil {
+				errorsTotal.Inc()
+				logger.Errorf("lumberjack: cannot process data from %s at %q: %s", c.RemoteAddr(), addr, err)
+			}
+
+			cm.Delete(c)
+			_ = c.Close()
+			wg.Done()
+		}()
+	}
+
+	cm.CloseAll(0)
+	wg.Wait()
+}
+
+var errorsTotal = metrics.NewCounter(`vl_errors_total{type="lumberjack"}`)
+
+// processConn processes Lumberjack v2 protocol frames received via c.
+//
+// See https://github.com/elastic/go-lumber/blob/main/PROTOCOL.md
+func processConn(c net.Conn, cp *insertutil.CommonParams) error {
+	if err := insertutil.CanWriteData(); err != nil {
+		return err
+	}
+
+	im := cp.GetIngestionMetrics("lumberjack")
+	newLogMessageProcessor := func() insertutil.LogMessageProcessor {
+		return cp.NewLogMessageProcessor("lumberjack", false)
+	}
+	err := processStreamInternal(im.NewUncompressedBytesReader(im.NewReceivedBytesReader(c)), c, newLogMessageProcessor, cp.MsgFields)
+	if err != nil {
+		im.AddParseErrors(1)
+	}
+	return err
+}
+
+// processStreamInternal reads Lumberjack v2 protocol frames from r until EOF.
+//
+// Every window of events is passed to a new LogMessageProcessor obtained via newLogMessageProcessor,
+// so the window logs are sent to the storage before sending the ack response to w.
+func processStreamInternal(r io.Reader, w io.Writer, newLogMessageProcessor func() insertutil.LogMessageProcessor, msgFields []string) error {
+	fr := newFrameReader(r, maxFrameSize.IntN())
+	jp := logstorage.GetJSONParser()
+	defer logstorage.PutJSONParser(jp)
+
+	var ackBuf []byte
+	n := 0
+	for {
+		windowSize, err := fr.readWindowSize()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("cannot read window #%d: %w", n, err)
+		}
+
+		lmp := newLogMessageProcessor()
+		lastSeq, err := fr.readEvents(windowSize, func(data []byte) error {
+			return processEvent(jp, data, lmp, msgFields)
+		})
+		lmp.MustClose()
+		if err != nil {
+			return fmt.Errorf("cannot read events for window #%d: %w", n, err)
+		}
+
+		ackBuf = appendAck(ackBuf[:0], lastSeq)
+		if _, err := w.Write(ackBuf); err != nil {
+			return fmt.Errorf("cannot send ack response for window #%d: %w", n, err)
+		}
+		n++
+	}
+}
+
+// processEvent passes the JSON event sent by Beats to lmp.
+func processEvent(jp *logstorage.JSONParser, data []byte, lmp insertutil.LogMessageProcessor, msgFields []string) error {
+	if err := jp.ParseLogMessage(data); err != nil {
+		return err
+	}
+	ts, err := insertutil.ExtractTimestampFromFields([]string{"@timestamp"}, jp.Fields)
+	if err != nil {
+		return err
+	}
+	logstorage.RenameField(jp.Fields, msgFields, "_msg")
+	lmp.AddRow(ts, jp.Fields, -1)
+	return nil
+}
@@ -0,0 +1,137 @@
+package lumberjack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+func appendTestWindowSize(dst []byte, n uint32) []byte {
+	dst = append(dst, protocolVersion, frameTypeWindowSize)
+	return binary.BigEndian.AppendUint32(dst, n)
+}
+
+func appendTestJSONFrame(dst []byte, seq uint32, data string) []byte {
+	dst = append(dst, protocolVersion, frameTypeJSON)
+	dst = binary.BigEndian.AppendUint32(dst, seq)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(data)))
+	return append(dst, data...)
+}
+
+func appendTestCompressedFrame(t *testing.T, dst, frames []byte) []byte {
+	t.Helper()
+
+	var bb bytes.Buffer
+	zw := zlib.NewWriter(&bb)
+	if _, err := zw.Write(frames); err != nil {
+		t.Fatalf("cannot compress frames: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close zlib writer: %s", err)
+	}
+	dst = append(dst, protocolVersion, frameTypeCompressed)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(bb.Len()))
+	return append(dst, bb.Bytes()...)
+}
+
+func TestProcessStreamInternal_Success(t *testing.T) {
+	f := func(data []byte, timestampsExpected []int64, resultExpected, ackExpected string) {
+		t.Helper()
+
+		lmp := &insertutil.TestLogMessageProcessor{}
+		newLogMessageProcessor := func() insertutil.LogMessageProcessor {
+			return lmp
+		}
+		var ack bytes.Buffer
+		if err := processStreamInternal(bytes.NewReader(data), &ack, newLogMessageProcessor, defaultMsgFields); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := lmp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ack.String() != ackExpected {
+			t.Fatalf("unexpected ack response; got %q; want %q", ack.String(), ackExpected)
+		}
+	}
+
+	// empty stream
+	f(nil, nil, "", "")
+
+	// uncompressed JSON frames
+	var data []byte
+	data = appendTestWindowSize(data, 2)
+	data = appendTestJSONFrame(data, 1, `{"@timestamp":"2023-11-14T22:13:20Z","message":"foo","host":{"name":"h1"},"@metadata":{"beat":"filebeat"}}`)
+	data = appendTestJSONFrame(data, 2, `{"@timestamp":"2023-11-14T22:13:21.5Z","message":"bar","log":{"file":{"path":"/var/log/app.log"}}}`)
+	f(data, []int64{1700000000000000000, 1700000001500000000},
+		`{"_msg":"foo","host.name":"h1","@metadata.beat":"filebeat"}
+{"_msg":"bar","log.file.path":"/var/log/app.log"}`, "2A\x00\x00\x00\x02")
+
+	// compressed frames in multiple windows, like Filebeat sends them
+	data = appendTestWindowSize(data[:0], 2)
+	var frames []byte
+	frames = appendTestJSONFrame(frames, 1, `{"@timestamp":"2023-11-14T22:13:20Z","message":"a"}`)
+	frames = appendTestJSONFrame(frames, 2, `{"@timestamp":"2023-11-14T22:13:21Z","message":"b"}`)
+	data = appendTestCompressedFrame(t, data, frames)
+	data = appendTestWindowSize(data, 1)
+	frames = appendTestJSONFrame(frames[:0], 1, `{"@timestamp":"2023-11-14T22:13:22Z","message":"c","tags":["x","y"]}`)
+	data = appendTestCompressedFrame(t, data, frames)
+	f(data, []int64{1700000000000000000, 1700000001000000000, 1700000002000000000}, `{"_msg":"a"}
+{"_msg":"b"}
+{"_msg":"c","tags":"[\"x\",\"y\"]"}`, "2A\x00\x00\x00\x022A\x00\x00\x00\x01")
+}
+
+func TestProcessStreamInternal_Failure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		lmp := &insertutil.TestLogMessageProcessor{}
+		newLogMessageProcessor := func() insertutil.LogMessageProcessor {
+			return lmp
+		}
+		var ack bytes.Buffer
+		if err := processStreamInternal(bytes.NewReader(data), &ack, newLogMessageProcessor, defaultMsgFields); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// Lumberjack v1 protocol
+	f([]byte("1W\x00\x00\x00\x01"))
+
+	// missing window size frame
+	f(appendTestJSONFrame(nil, 1, `{"message":"foo"}`))
+
+	// zero window size
+	f(appendTestWindowSize(nil, 0))
+
+	// unsupported frame type
+	f(append(appendTestWindowSize(nil, 1), protocolVersion, 'D'))
+
+	// truncated window size frame
+	f([]byte("2W\x00\x00"))
+
+	// missing events in the window
+	f(appendTestJSONFrame(appendTestWindowSize(nil, 2), 1, `{"message":"foo"}`))
+
+	// invalid JSON
+	f(appendTestJSONFrame(appendTestWindowSize(nil, 1), 1, `{"message":`))
+
+	// invalid timestamp
+	f(appendTestJSONFrame(appendTestWindowSize(nil, 1), 1, `{"@timestamp":"foo","message":"bar"}`))
+
+	// too big payload size
+	data := appendTestWindowSize(nil, 1)
+	data = append(data, protocolVersion, frameTypeJSON)
+	data = binary.BigEndian.AppendUint32(data, 1)
+	data = binary.BigEndian.AppendUint32(data, 0xffffffff)
+	f(data)
+
+	// invalid compressed payload
+	data = appendTestWindowSize(nil, 1)
+	data = append(data, protocolVersion, frameTypeCompressed)
+	data = binary.BigEndian.AppendUint32(data, 3)
+	data = append(data, "foo"...)
+	f(data)
+}
@@ -0,0 +1,224 @@
+package lumberjack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+)
+
+// Lumberjack v2 protocol constants.
+//
+// See https://github.com/elastic/go-lumber/blob/main/PROTOCOL.md
+const (
+	protocolVersion = '2'
+
+	frameTypeWindowSize = 'W'
+	frameTypeCompressed = 'C'
+	frameTypeJSON       = 'J'
+	frameTypeAck        = 'A'
+)
+
+// frameReader reads Lumberjack v2 frames.
+type frameReader struct {
+	br *bufio.Reader
+
+	// maxFrameSize is the maximum size of a single frame payload after decompression.
+	maxFrameSize int
+
+	// buf is used for reading frame payloads.
+	buf []byte
+
+	// compressedBuf and uncompressedBuf are used for reading compressed frames.
+	compressedBuf   []byte
+	uncompressedBuf []byte
+}
+
+func newFrameReader(r io.Reader, maxFrameSize int) *frameReader {
+	return &frameReader{
+		br:           bufio.NewReaderSize(r, 64*1024),
+		maxFrameSize: maxFrameSize,
+	}
+}
+
+// readWindowSize reads window size frame, which must precede every batch of events.
+//
+// io.EOF is returned if the stream is closed by the client before the frame.
+func (fr *frameReader) readWindowSize() (uint32, error) {
+	if _, err := fr.br.Peek(1); err != nil {
+		return 0, err
+	}
+	frameType, err := readFrameHeader(fr.br)
+	if err != nil {
+		return 0, err
+	}
+	if frameType != frameTypeWindowSize {
+		return 0, fmt.Errorf("unexpected frame type %q; want window size frame %q", frameType, frameTypeWindowSize)
+	}
+	windowSize, err := readUint32(fr.br)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read window size: %w", err)
+	}
+	if windowSize == 0 {
+		return 0, fmt.Errorf("window size cannot be zero")
+	}
+	return windowSize, nil
+}
+
+// readEvents reads windowSize events and calls f for every read event.
+//
+// It returns the sequence number of the last read event. This number must be sent to the client in the ack frame.
+func (fr *frameReader) readEvents(windowSize uint32, f func(data []byte) error) (uint32, error) {
+	var lastSeq uint32
+	n := uint32(0)
+	for n < windowSize {
+		frameType, err := readFrameHeader(fr.br)
+		if err != nil {
+			return lastSeq, err
+		}
+		switch frameType {
+		case frameTypeJSON:
+			seq, data, err := fr.readJSONFrame(fr.br, &fr.buf)
+			if err != nil {
+				return lastSeq, err
+			}
+			if err := f(data); err != nil {
+				return lastSeq, fmt.Errorf("cannot process event with seq=%d: %w", seq, err)
+			}
+			lastSeq = seq
+			n++
+		case frameTypeCompressed:
+			data, err := fr.readCompressedFrame()
+			if err != nil {
+				return lastSeq, err
+			}
+			seq, count, err := fr.readCompressedEvents(data, f)
+			if err != nil {
+				return lastSeq, err
+			}
+			if count > 0 {
+				lastSeq = seq
+				n += count
+			}
+		default:
+			return lastSeq, fmt.Errorf("unexpected frame type %q inside the window; want %q or %q", frameType, frameTypeJSON, frameTypeCompressed)
+		}
+	}
+	return lastSeq, nil
+}
+
+// readCompressedEvents reads events from the uncompressed payload of compressed frame and calls f for every read event.
+//
+// It returns the sequence number of the last read event and the number of read events.
+func (fr *frameReader) readCompressedEvents(data []byte, f func(data []byte) error) (uint32, uint32, error) {
+	r := bytes.NewReader(data)
+	var lastSeq uint32
+	n := uint32(0)
+	for r.Len() > 0 {
+		frameType, err := readFrameHeader(r)
+		if err != nil {
+			return lastSeq, n, fmt.Errorf("cannot read frame inside compressed frame: %w", err)
+		}
+		if frameType != frameTypeJSON {
+			return lastSeq, n, fmt.Errorf("unexpected frame type %q inside compressed frame; want %q", frameType, frameTypeJSON)
+		}
+		seq, event, err := fr.readJSONFrame(r, &fr.buf)
+		if err != nil {
+			return lastSeq, n, err
+		}
+		if err := f(event); err != nil {
+			return lastSeq, n, fmt.Errorf("cannot process event with seq=%d: %w", seq, err)
+		}
+		lastSeq = seq
+		n++
+	}
+	return lastSeq, n, nil
+}
+
+// readJSONFrame reads JSON data frame payload after the frame header from r.
+func (fr *frameReader) readJSONFrame(r io.Reader, buf *[]byte) (uint32, []byte, error) {
+	seq, err := readUint32(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot read sequence number for JSON frame: %w", err)
+	}
+	data, err := fr.readPayload(r, buf)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot read JSON frame with seq=%d: %w", seq, err)
+	}
+	return seq, data, nil
+}
+
+// readCompressedFrame reads and decompresses compressed frame payload after the frame header.
+func (fr *frameReader) readCompressedFrame() ([]byte, error) {
+	compressed, err := fr.readPayload(fr.br, &fr.compressedBuf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read compressed frame: %w", err)
+	}
+
+	zr, err := protoparserutil.GetUncompressedReader(bytes.NewReader(compressed), "deflate")
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress compressed frame: %w", err)
+	}
+	defer protoparserutil.PutUncompressedReader(zr)
+
+	bb := bytes.NewBuffer(fr.uncompressedBuf[:0])
+	_, err = bb.ReadFrom(io.LimitReader(zr, int64(fr.maxFrameSize)+1))
+	fr.uncompressedBuf = bb.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress compressed frame: %w", err)
+	}
+	if len(fr.uncompressedBuf) > fr.maxFrameSize {
+		return nil, fmt.Errorf("too big uncompressed frame; it mustn't exceed -lumberjack.maxFrameSize=%d bytes", fr.maxFrameSize)
+	}
+	return fr.uncompressedBuf, nil
+}
+
+// readPayload reads length-prefixed payload from r into buf.
+func (fr *frameReader) readPayload(r io.Reader, buf *[]byte) ([]byte, error) {
+	size, err := readUint32(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read payload size: %w", err)
+	}
+	if uint64(size) > uint64(fr.maxFrameSize) {
+		return nil, fmt.Errorf("too big payload size: %d bytes; it mustn't exceed -lumberjack.maxFrameSize=%d bytes", size, fr.maxFrameSize)
+	}
+	b := *buf
+	if cap(b) < int(size) {
+		b = make([]byte, size)
+	}
+	b = b[:size]
+	*buf = b
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("cannot read payload with size %d bytes: %w", size, err)
+	}
+	return b, nil
+}
+
+// readFrameHeader reads protocol version and frame type from r.
+func readFrameHeader(r io.Reader) (byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, fmt.Errorf("cannot read frame header: %w", err)
+	}
+	if hdr[0] != protocolVersion {
+		return 0, fmt.Errorf("unsupported protocol version %q; only Lumberjack v2 protocol is supported", hdr[0])
+	}
+	return hdr[1], nil
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// appendAck appends ack frame for the given sequence number to dst.
+func appendAck(dst []byte, seq uint32) []byte {
+	dst = append(dst, protocolVersion, frameTypeAck)
+	return binary.BigEndian.AppendUint32(dst, seq)
+}
@@ -1,6 +1,7 @@
 package vlinsert
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -10,13 +11,25 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/datadog"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/elasticsearch"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/fluentforward"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/gelf"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/internalinsert"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/journald"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/jsonline"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/kafka"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/logmetrics"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/loki"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/lumberjack"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/mirror"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/nativeinsert"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/opentelemetry"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/pubsub"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/sigma"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/splunk"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/syslog"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/watch"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
 var (
@@ -26,12 +39,53 @@ var (
 
 // Init initializes vlinsert
 func Init() {
+	insertutil.MustInitTenantDefaults()
+	insertutil.MustInitStreamLimiter()
+	insertutil.MustInitLoadShedding()
+	insertutil.MustInitPipelines()
+	watch.Init()
+	logmetrics.Init()
+	sigma.Init()
 	syslog.MustInit()
+	gelf.MustInit()
+	fluentforward.MustInit()
+	lumberjack.MustInit()
+	opentelemetry.MustInit()
+	kafka.MustInit()
+	mirror.Init()
+}
+
+// CheckConfig verifies command-line flags and config files for vlinsert without starting data ingestion.
+//
+// It returns all the found errors.
+func CheckConfig() error {
+	return errors.Join(
+		insertutil.CheckConfig(),
+		watch.CheckConfig(),
+		logmetrics.CheckConfig(),
+		sigma.CheckConfig(),
+		syslog.CheckConfig(),
+		gelf.CheckConfig(),
+		fluentforward.CheckConfig(),
+		lumberjack.CheckConfig(),
+		opentelemetry.CheckConfig(),
+		kafka.CheckConfig(),
+		mirror.CheckConfig(),
+	)
 }
 
 // Stop stops vlinsert
 func Stop() {
+	mirror.Stop()
+	kafka.MustStop()
+	opentelemetry.MustStop()
+	lumberjack.MustStop()
+	fluentforward.MustStop()
+	gelf.MustStop()
 	syslog.MustStop()
+	sigma.Stop()
+	logmetrics.Stop()
+	watch.Stop()
 }
 
 // RequestHandler handles insert requests for VictoriaLogs
@@ -43,10 +97,25 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			httpserver.Errorf(w, r, "requests to /insert/* are disabled with -insert.disable command-line flag")
 			return true
 		}
+		path, err := logstorage.StripTenantFromPath(r, path, "/insert/")
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
 
 		return insertHandler(w, r, path)
 	}
 
+	if path == "/admin/ingest_preview" {
+		insertutil.ProcessIngestPreviewRequest(w, r)
+		return true
+	}
+
+	if path == "/debug/ingest_selftest" {
+		insertutil.ProcessIngestSelftestRequest(w, r)
+		return true
+	}
+
 	if path == "/internal/insert" {
 		if *disableInternalInsert || *disableInsert {
 			httpserver.Errorf(w, r, "requests to /internal/insert are disabled with -internalinsert.disable or -insert.disable command-line flag")
@@ -60,6 +129,19 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 }
 
 func insertHandler(w http.ResponseWriter, r *http.Request, path string) bool {
+	if endpoint := getIngestionEndpoint(path); endpoint != "" {
+		if err := insertutil.AdmitRequest(endpoint); err != nil {
+			w.Header().Set("Retry-After", "1")
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		defer insertutil.ReleaseRequest()
+
+		if mr := mirror.StartRequest(r); mr != nil {
+			defer mr.Finish()
+		}
+	}
+
 	switch path {
 	case "/insert/jsonline":
 		jsonline.RequestHandler(w, r)
@@ -67,6 +149,9 @@ func insertHandler(w http.ResponseWriter, r *http.Request, path string) bool {
 	case "/insert/native":
 		nativeinsert.RequestHandler(w, r)
 		return true
+	case "/insert/stream_limits":
+		insertutil.ProcessStreamLimitsRequest(w, r)
+		return true
 	case "/insert/ready":
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(200)
@@ -87,7 +172,31 @@ func insertHandler(w http.ResponseWriter, r *http.Request, path string) bool {
 		return journald.RequestHandler(path, w, r)
 	case strings.HasPrefix(path, "/insert/datadog/"):
 		return datadog.RequestHandler(path, w, r)
+	case strings.HasPrefix(path, "/insert/splunk/"):
+		return splunk.RequestHandler(path, w, r)
+	case strings.HasPrefix(path, "/insert/pubsub/"):
+		return pubsub.RequestHandler(path, w, r)
+	case strings.HasPrefix(path, "/insert/watches"):
+		return watch.RequestHandler(path, w, r)
 	}
 
 	return false
 }
+
+// getIngestionEndpoint returns the name of data ingestion endpoint for the given path.
+//
+// An empty string is returned if the path doesn't belong to data ingestion endpoint.
+func getIngestionEndpoint(path string) string {
+	switch path {
+	case "/insert/jsonline":
+		return "jsonline"
+	case "/insert/native":
+		return "native"
+	}
+	for _, endpoint := range []string{"elasticsearch", "loki", "opentelemetry", "journald", "datadog", "splunk", "pubsub"} {
+		if strings.HasPrefix(path, "/insert/"+endpoint) {
+			return endpoint
+		}
+	}
+	return ""
+}
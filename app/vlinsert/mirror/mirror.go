@@ -0,0 +1,276 @@
+package mirror
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	mirrorURL = flag.String("insert.mirrorURL", "", "Optional URL of a secondary VictoriaLogs for mirroring data ingestion requests to. For example, http://victorialogs-new:9428 . "+
+		"Mirrored requests are sent in background and their responses are ignored. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#request-mirroring")
+	mirrorPercent        = flag.Float64("insert.mirrorPercent", 100, "The percentage of data ingestion requests to mirror to -insert.mirrorURL")
+	mirrorMaxRequestSize = flagutil.NewBytes("insert.mirrorMaxRequestSize", 16*1024*1024, "The maximum size of data ingestion request body, which can be mirrored to -insert.mirrorURL. "+
+		"Bigger requests aren't mirrored")
+	mirrorConcurrency = flag.Int("insert.mirrorConcurrency", 8, "The maximum number of concurrent requests to -insert.mirrorURL. "+
+		"New requests aren't mirrored when the limit is reached")
+	mirrorTimeout = flag.Duration("insert.mirrorTimeout", 10*time.Second, "Timeout for mirrored requests to -insert.mirrorURL")
+)
+
+func init() {
+	// -insert.mirrorURL may contain basic auth credentials, so hide it at /metrics page.
+	flagutil.RegisterSecretFlag("insert.mirrorURL")
+}
+
+var (
+	requestsMirrored = metrics.NewCounter(`vl_insert_mirror_requests_total`)
+	bytesMirrored    = metrics.NewCounter(`vl_insert_mirror_bytes_total`)
+	mirrorErrors     = metrics.NewCounter(`vl_insert_mirror_errors_total`)
+
+	requestsDroppedConcurrency = metrics.NewCounter(`vl_insert_mirror_requests_dropped_total{reason="concurrency"}`)
+	requestsDroppedTooBig      = metrics.NewCounter(`vl_insert_mirror_requests_dropped_total{reason="too_big"}`)
+)
+
+// hopByHopHeaders contains headers, which mustn't be copied to mirrored requests.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type mirror struct {
+	baseURL *url.URL
+	hc      *http.Client
+
+	// concurrencyCh limits the number of concurrent mirrored requests.
+	concurrencyCh chan struct{}
+
+	wg sync.WaitGroup
+}
+
+var globalMirror *mirror
+
+// Init initializes request mirroring according to -insert.mirrorURL.
+//
+// Stop must be called when request mirroring is no longer needed.
+func Init() {
+	if *mirrorURL == "" {
+		return
+	}
+	u, err := parseFlags()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	globalMirror = &mirror{
+		baseURL: u,
+		hc: &http.Client{
+			Timeout: *mirrorTimeout,
+		},
+		concurrencyCh: make(chan struct{}, *mirrorConcurrency),
+	}
+	logger.Infof("mirroring %v%% of data ingestion requests to -insert.mirrorURL=%q", *mirrorPercent, u.Redacted())
+}
+
+// CheckConfig verifies -insert.mirror* command-line flags without starting request mirroring.
+func CheckConfig() error {
+	if *mirrorURL == "" {
+		return nil
+	}
+	_, err := parseFlags()
+	return err
+}
+
+// parseFlags verifies -insert.mirror* command-line flags and returns the parsed -insert.mirrorURL.
+func parseFlags() (*url.URL, error) {
+	u, err := url.Parse(*mirrorURL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.mirrorURL=%q: %w", *mirrorURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme in -insert.mirrorURL=%q; supported schemes: http, https", *mirrorURL)
+	}
+	if *mirrorPercent < 0 || *mirrorPercent > 100 {
+		return nil, fmt.Errorf("-insert.mirrorPercent=%v must be in the range [0...100]", *mirrorPercent)
+	}
+	if *mirrorConcurrency <= 0 {
+		return nil, fmt.Errorf("-insert.mirrorConcurrency=%d must be positive", *mirrorConcurrency)
+	}
+	return u, nil
+}
+
+// Stop waits until all the mirrored requests are finished.
+func Stop() {
+	m := globalMirror
+	if m == nil {
+		return
+	}
+	m.wg.Wait()
+	globalMirror = nil
+}
+
+// Request is a data ingestion request, which is mirrored to -insert.mirrorURL.
+type Request struct {
+	m *mirror
+
+	r  *http.Request
+	br *bodyReader
+}
+
+// StartRequest starts mirroring r to -insert.mirrorURL.
+//
+// It returns nil if r mustn't be mirrored. Otherwise Finish must be called on the returned Request after r is processed.
+func StartRequest(r *http.Request) *Request {
+	m := globalMirror
+	if m == nil || r.Method != http.MethodPost || r.Body == nil {
+		return nil
+	}
+	if *mirrorPercent < 100 && rand.Float64()*100 >= *mirrorPercent {
+		return nil
+	}
+
+	br := &bodyReader{
+		r:       r.Body,
+		bb:      bbPool.Get(),
+		maxSize: mirrorMaxRequestSize.IntN(),
+	}
+	r.Body = br
+	return &Request{
+		m:  m,
+		r:  r,
+		br: br,
+	}
+}
+
+// Finish sends the request body read during the request processing to -insert.mirrorURL in background.
+//
+// The request isn't mirrored if its body wasn't read until the end, e.g. if the request processing failed.
+func (mr *Request) Finish() {
+	br := mr.br
+	if !br.isEOF {
+		if br.isTooBig {
+			requestsDroppedTooBig.Inc()
+		}
+		bbPool.Put(br.bb)
+		return
+	}
+
+	m := mr.m
+	select {
+	case m.concurrencyCh <- struct{}{}:
+	default:
+		requestsDroppedConcurrency.Inc()
+		bbPool.Put(br.bb)
+		return
+	}
+
+	reqURL := m.getRequestURL(mr.r.URL)
+	header := mr.r.Header.Clone()
+	for _, h := range hopByHopHeaders {
+		header.Del(h)
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer func() {
+			bbPool.Put(br.bb)
+			<-m.concurrencyCh
+			m.wg.Done()
+		}()
+
+		if err := m.sendRequest(reqURL, header, br.bb.B); err != nil {
+			mirrorErrors.Inc()
+			logger.Warnf("cannot mirror data ingestion request to -insert.mirrorURL: %s", err)
+			return
+		}
+		requestsMirrored.Inc()
+		bytesMirrored.Add(len(br.bb.B))
+	}()
+}
+
+// getRequestURL returns the url for mirroring the request with the given u.
+//
+// The path and query args from u are appended to -insert.mirrorURL.
+func (m *mirror) getRequestURL(u *url.URL) string {
+	dst := *m.baseURL
+	dst.Path = strings.TrimSuffix(dst.Path, "/") + u.Path
+	if u.RawQuery != "" {
+		if dst.RawQuery != "" {
+			dst.RawQuery += "&" + u.RawQuery
+		} else {
+			dst.RawQuery = u.RawQuery
+		}
+	}
+	return dst.String()
+}
+
+func (m *mirror) sendRequest(reqURL string, header http.Header, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, reqURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header = header
+
+	resp, err := m.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response code %d from %q; response body: %q", resp.StatusCode, req.URL.Redacted(), respBody)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// bodyReader copies the read request body into bb, so it could be mirrored after the request processing.
+type bodyReader struct {
+	r       io.ReadCloser
+	bb      *bytesutil.ByteBuffer
+	maxSize int
+
+	isEOF    bool
+	isTooBig bool
+}
+
+func (br *bodyReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	if !br.isTooBig {
+		if len(br.bb.B)+n > br.maxSize {
+			br.isTooBig = true
+			br.bb.Reset()
+		} else {
+			br.bb.MustWrite(p[:n])
+		}
+	}
+	if err == io.EOF && !br.isTooBig {
+		br.isEOF = true
+	}
+	return n, err
+}
+
+func (br *bodyReader) Close() error {
+	return br.r.Close()
+}
+
+var bbPool bytesutil.ByteBufferPool
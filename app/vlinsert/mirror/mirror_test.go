@@ -0,0 +1,117 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMirrorGetRequestURL(t *testing.T) {
+	f := func(baseURL, requestURI, resultExpected string) {
+		t.Helper()
+
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			t.Fatalf("cannot parse baseURL: %s", err)
+		}
+		m := &mirror{
+			baseURL: u,
+		}
+		ru, err := url.ParseRequestURI(requestURI)
+		if err != nil {
+			t.Fatalf("cannot parse requestURI: %s", err)
+		}
+		result := m.getRequestURL(ru)
+		if result != resultExpected {
+			t.Fatalf("unexpected url; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f("http://foo:9428", "/insert/jsonline", "http://foo:9428/insert/jsonline")
+	f("http://foo:9428/", "/insert/jsonline?_stream_fields=a,b", "http://foo:9428/insert/jsonline?_stream_fields=a,b")
+	f("https://foo/prefix/", "/insert/loki/api/v1/push", "https://foo/prefix/insert/loki/api/v1/push")
+	f("http://foo/prefix?extra_fields=env=new", "/insert/jsonline?debug=1", "http://foo/prefix/insert/jsonline?extra_fields=env=new&debug=1")
+}
+
+func TestMirrorRequest(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	var paths []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		paths = append(paths, r.URL.RequestURI()+" "+r.Header.Get("Content-Encoding"))
+		mu.Unlock()
+	}))
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatalf("cannot parse url: %s", err)
+	}
+	globalMirror = &mirror{
+		baseURL:       u,
+		hc:            &http.Client{},
+		concurrencyCh: make(chan struct{}, 1),
+	}
+	defer Stop()
+
+	sendRequest := func(method, body string, readFully bool) {
+		t.Helper()
+
+		r := httptest.NewRequest(method, "/insert/jsonline?_msg_field=message", strings.NewReader(body))
+		r.Header.Set("Content-Encoding", "gzip")
+		mr := StartRequest(r)
+		if mr == nil {
+			if method == http.MethodPost {
+				t.Fatalf("expecting non-nil request for %s method", method)
+			}
+			return
+		}
+		if readFully {
+			_, _ = io.ReadAll(r.Body)
+		} else {
+			_, _ = io.ReadFull(r.Body, make([]byte, 1))
+		}
+		mr.Finish()
+		globalMirror.wg.Wait()
+	}
+
+	defer func(n int) {
+		mirrorMaxRequestSize.N = int64(n)
+	}(mirrorMaxRequestSize.IntN())
+	mirrorMaxRequestSize.N = 10
+
+	// mirrored request
+	sendRequest(http.MethodPost, "foo", true)
+
+	// non-POST request isn't mirrored
+	sendRequest(http.MethodGet, "bar", true)
+
+	// partially read request isn't mirrored
+	sendRequest(http.MethodPost, "baz", false)
+
+	// too big request isn't mirrored
+	sendRequest(http.MethodPost, "too big request body", true)
+
+	// the second mirrored request
+	sendRequest(http.MethodPost, "", true)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(bodies) != 2 || bodies[0] != "foo" || bodies[1] != "" {
+		t.Fatalf("unexpected mirrored bodies: %q", bodies)
+	}
+	for _, path := range paths {
+		if path != "/insert/jsonline?_msg_field=message gzip" {
+			t.Fatalf("unexpected mirrored request: %q", path)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package opentelemetry
+
+import (
+	"flag"
+	"net/http"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+var (
+	resourceAttributesPrefix = flag.String("opentelemetry.resourceAttributesPrefix", "", "Optional prefix to add to the names of resource attributes of the ingested OpenTelemetry logs. "+
+		"For example, -opentelemetry.resourceAttributesPrefix=resource stores the 'host' resource attribute in the 'resource.host' field. "+
+		"This prevents from collisions between resource attributes and log record attributes. "+
+		"It can be overridden via resource_attributes_prefix query arg or via VL-Resource-Attributes-Prefix request header. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#resource-and-scope-attributes")
+	resourceAttributes = flagutil.NewArrayString("opentelemetry.resourceAttributes", "Optional list of resource attributes to store for the ingested OpenTelemetry logs. "+
+		"All the resource attributes are stored by default. Attribute names may end with '*' in order to match all the attributes with the given prefix. "+
+		"It can be overridden via resource_attributes query arg or via VL-Resource-Attributes request header. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#resource-and-scope-attributes")
+	scopeAttributes = flagutil.NewArrayString("opentelemetry.scopeAttributes", "Optional list of scope attributes to store for the ingested OpenTelemetry logs. "+
+		"All the scope attributes are stored by default. Attribute names may end with '*' in order to match all the attributes with the given prefix. "+
+		"It can be overridden via scope_attributes query arg or via VL-Scope-Attributes request header. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#resource-and-scope-attributes")
+	streamResourceAttributes = flagutil.NewArrayString("opentelemetry.streamResourceAttributes", "Optional list of resource attributes to use as log stream fields for the ingested OpenTelemetry logs. "+
+		"All the resource attributes are used as log stream fields by default. Attribute names may end with '*' in order to match all the attributes with the given prefix. "+
+		"It can be overridden via stream_resource_attributes query arg or via VL-Stream-Resource-Attributes request header. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#resource-and-scope-attributes")
+)
+
+// attributesOptions contains options for storing resource and scope attributes.
+//
+// The zero value stores all the attributes as is and uses all the resource attributes as log stream fields.
+type attributesOptions struct {
+	// resourceAttributesPrefix is the prefix to add to resource attribute names.
+	resourceAttributesPrefix string
+
+	// resourceAttributes contains resource attributes to store. All the resource attributes are stored if it is nil.
+	resourceAttributes *prefixfilter.Filter
+
+	// scopeAttributes contains scope attributes to store. All the scope attributes are stored if it is nil.
+	scopeAttributes *prefixfilter.Filter
+
+	// streamResourceAttributes contains resource attributes to use as log stream fields.
+	// All the resource attributes are used as log stream fields if it is nil.
+	streamResourceAttributes *prefixfilter.Filter
+}
+
+// getAttributesOptions returns attributes options for r.
+//
+// Options missing in r are obtained from the corresponding command-line flags.
+func getAttributesOptions(r *http.Request) *attributesOptions {
+	prefix := httputil.GetRequestValue(r, "resource_attributes_prefix", "VL-Resource-Attributes-Prefix")
+	resourceAttrs := httputil.GetArray(r, "resource_attributes", "VL-Resource-Attributes")
+	scopeAttrs := httputil.GetArray(r, "scope_attributes", "VL-Scope-Attributes")
+	streamResourceAttrs := httputil.GetArray(r, "stream_resource_attributes", "VL-Stream-Resource-Attributes")
+	if prefix == "" && resourceAttrs == nil && scopeAttrs == nil && streamResourceAttrs == nil {
+		return getDefaultAttributesOptions()
+	}
+
+	ao := *getDefaultAttributesOptions()
+	if prefix != "" {
+		ao.resourceAttributesPrefix = prefix
+	}
+	if resourceAttrs != nil {
+		ao.resourceAttributes = newAttributesFilter(resourceAttrs)
+	}
+	if scopeAttrs != nil {
+		ao.scopeAttributes = newAttributesFilter(scopeAttrs)
+	}
+	if streamResourceAttrs != nil {
+		ao.streamResourceAttributes = newAttributesFilter(streamResourceAttrs)
+	}
+	return &ao
+}
+
+func getDefaultAttributesOptions() *attributesOptions {
+	defaultAttributesOptionsOnce.Do(func() {
+		defaultAttributesOptions = &attributesOptions{
+			resourceAttributesPrefix: *resourceAttributesPrefix,
+			resourceAttributes:       newAttributesFilter(*resourceAttributes),
+			scopeAttributes:          newAttributesFilter(*scopeAttributes),
+			streamResourceAttributes: newAttributesFilter(*streamResourceAttributes),
+		}
+	})
+	return defaultAttributesOptions
+}
+
+var (
+	defaultAttributesOptions     *attributesOptions
+	defaultAttributesOptionsOnce sync.Once
+)
+
+// newAttributesFilter returns a filter for the given attribute names.
+//
+// nil is returned if names is empty, which means that all the attributes must be matched.
+func newAttributesFilter(names []string) *prefixfilter.Filter {
+	if len(names) == 0 {
+		return nil
+	}
+	var f prefixfilter.Filter
+	f.AddAllowFilters(names)
+	return &f
+}
+
+// matchAttribute returns true if the attribute with the given key must be matched by f.
+func matchAttribute(f *prefixfilter.Filter, key string) bool {
+	return f == nil || f.MatchString(key)
+}
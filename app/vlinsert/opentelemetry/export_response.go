@@ -0,0 +1,116 @@
+package opentelemetry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/easyproto"
+	"github.com/valyala/quicktemplate"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// rejectsCountingLogMessageProcessor counts log records, which are dropped by the underlying LogMessageProcessor or by the storage.
+//
+// The counts are returned to OpenTelemetry clients in ExportLogsPartialSuccess message,
+// so they could report accurate telemetry for the dropped log records.
+type rejectsCountingLogMessageProcessor struct {
+	insertutil.LogMessageProcessor
+
+	// invalidTimestamps is the number of log records with timestamps outside the retention configured at the storage.
+	invalidTimestamps int64
+}
+
+// AddRow implements insertutil.LogMessageProcessor interface.
+func (rlmp *rejectsCountingLogMessageProcessor) AddRow(timestamp int64, fields []logstorage.Field, streamFieldsLen int) {
+	tooManyFields := rlmp.tooManyFieldsRows()
+	rlmp.LogMessageProcessor.AddRow(timestamp, fields, streamFieldsLen)
+	if rlmp.tooManyFieldsRows() > tooManyFields {
+		// The row has been already dropped by the underlying LogMessageProcessor.
+		return
+	}
+	if !insertutil.IsTimestampAllowed(timestamp) {
+		rlmp.invalidTimestamps++
+	}
+}
+
+// tooManyFieldsRows returns the number of log records dropped by the underlying LogMessageProcessor because of -insert.maxFieldsPerLine limit.
+func (rlmp *rejectsCountingLogMessageProcessor) tooManyFieldsRows() int64 {
+	rc, ok := rlmp.LogMessageProcessor.(insertutil.RejectedRowsCounter)
+	if !ok {
+		return 0
+	}
+	return rc.TooManyFieldsRows()
+}
+
+// newExportLogsServiceResponse returns ExportLogsServiceResponse for the log records passed to rlmp.
+func (rlmp *rejectsCountingLogMessageProcessor) newExportLogsServiceResponse() *exportLogsServiceResponse {
+	tooManyFields := rlmp.tooManyFieldsRows()
+
+	var reasons []string
+	if tooManyFields > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d log records were dropped because they contain more than -insert.maxFieldsPerLine=%d fields",
+			tooManyFields, *insertutil.MaxFieldsPerLine))
+	}
+	if rlmp.invalidTimestamps > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d log records were dropped because their timestamps are outside the configured retention; "+
+			"see https://docs.victoriametrics.com/victorialogs/#retention", rlmp.invalidTimestamps))
+	}
+	return &exportLogsServiceResponse{
+		rejectedLogRecords: tooManyFields + rlmp.invalidTimestamps,
+		errorMessage:       strings.Join(reasons, "; "),
+	}
+}
+
+var exportResponseMarshalerPool easyproto.MarshalerPool
+
+// exportLogsServiceResponse represents ExportLogsServiceResponse message.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/v1.5.0/opentelemetry/proto/collector/logs/v1/logs_service.proto
+type exportLogsServiceResponse struct {
+	// rejectedLogRecords is the number of rejected log records.
+	rejectedLogRecords int64
+
+	// errorMessage is the explanation for rejected log records.
+	errorMessage string
+}
+
+func (resp *exportLogsServiceResponse) marshalProtobuf(dst []byte) []byte {
+	// message ExportLogsServiceResponse {
+	//   ExportLogsPartialSuccess partial_success = 1;
+	// }
+	//
+	// message ExportLogsPartialSuccess {
+	//   int64 rejected_log_records = 1;
+	//   string error_message = 2;
+	// }
+	if resp.rejectedLogRecords == 0 && resp.errorMessage == "" {
+		return dst
+	}
+
+	m := exportResponseMarshalerPool.Get()
+	mm := m.MessageMarshaler().AppendMessage(1)
+	mm.AppendInt64(1, resp.rejectedLogRecords)
+	mm.AppendString(2, resp.errorMessage)
+	dst = m.Marshal(dst)
+	exportResponseMarshalerPool.Put(m)
+	return dst
+}
+
+// marshalJSON appends JSON representation of resp to dst according to OTLP/JSON encoding.
+//
+// See https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+func (resp *exportLogsServiceResponse) marshalJSON(dst []byte) []byte {
+	if resp.rejectedLogRecords == 0 && resp.errorMessage == "" {
+		return append(dst, "{}"...)
+	}
+
+	// int64 values are encoded as strings in OTLP/JSON
+	dst = append(dst, `{"partialSuccess":{"rejectedLogRecords":"`...)
+	dst = strconv.AppendInt(dst, resp.rejectedLogRecords, 10)
+	dst = append(dst, `","errorMessage":`...)
+	dst = quicktemplate.AppendJSONString(dst, resp.errorMessage, true)
+	return append(dst, "}}"...)
+}
@@ -0,0 +1,93 @@
+package opentelemetry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestExportLogsServiceResponseMarshalJSON(t *testing.T) {
+	f := func(resp *exportLogsServiceResponse, resultExpected string) {
+		t.Helper()
+
+		result := resp.marshalJSON(nil)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(&exportLogsServiceResponse{}, `{}`)
+	f(&exportLogsServiceResponse{
+		rejectedLogRecords: 2,
+		errorMessage:       `foo "bar"`,
+	}, `{"partialSuccess":{"rejectedLogRecords":"2","errorMessage":"foo \"bar\""}}`)
+}
+
+// testTimestampStorage implements insertutil.LogRowsStorage interface with timestamp checks.
+type testTimestampStorage struct {
+	minTimestamp int64
+}
+
+func (*testTimestampStorage) MustAddRows(_ *logstorage.LogRows) {}
+
+func (*testTimestampStorage) CanWriteData() error {
+	return nil
+}
+
+func (s *testTimestampStorage) IsTimestampAllowed(timestamp int64) bool {
+	return timestamp >= s.minTimestamp
+}
+
+func TestRejectsCountingLogMessageProcessor(t *testing.T) {
+	insertutil.SetLogRowsStorage(&testTimestampStorage{
+		minTimestamp: 100,
+	})
+	defer insertutil.SetLogRowsStorage(nil)
+
+	f := func(timestamps []int64, fieldsCounts []int, rejectedExpected int64, errorMessageExpected string) {
+		t.Helper()
+
+		rlmp := &rejectsCountingLogMessageProcessor{
+			LogMessageProcessor: &insertutil.TestLogMessageProcessor{},
+		}
+		for i, timestamp := range timestamps {
+			fields := make([]logstorage.Field, fieldsCounts[i])
+			for j := range fields {
+				fields[j] = logstorage.Field{
+					Name:  fmt.Sprintf("field_%d", j),
+					Value: "foo",
+				}
+			}
+			rlmp.AddRow(timestamp, fields, -1)
+		}
+
+		resp := rlmp.newExportLogsServiceResponse()
+		if resp.rejectedLogRecords != rejectedExpected {
+			t.Fatalf("unexpected rejectedLogRecords; got %d; want %d", resp.rejectedLogRecords, rejectedExpected)
+		}
+		if resp.errorMessage != errorMessageExpected {
+			t.Fatalf("unexpected errorMessage\ngot\n%s\nwant\n%s", resp.errorMessage, errorMessageExpected)
+		}
+	}
+
+	maxFields := *insertutil.MaxFieldsPerLine
+
+	// no rejected records
+	f(nil, nil, 0, "")
+	f([]int64{100, 200}, []int{1, maxFields}, 0, "")
+
+	// records with too many fields
+	f([]int64{100, 200}, []int{maxFields + 1, 1}, 1,
+		fmt.Sprintf("1 log records were dropped because they contain more than -insert.maxFieldsPerLine=%d fields", maxFields))
+
+	// records with invalid timestamps
+	f([]int64{10, 20, 200}, []int{1, 1, 1}, 2,
+		"2 log records were dropped because their timestamps are outside the configured retention; see https://docs.victoriametrics.com/victorialogs/#retention")
+
+	// records with too many fields and invalid timestamps
+	f([]int64{10, 200}, []int{1, maxFields + 1}, 2,
+		fmt.Sprintf("1 log records were dropped because they contain more than -insert.maxFieldsPerLine=%d fields; "+
+			"1 log records were dropped because their timestamps are outside the configured retention; see https://docs.victoriametrics.com/victorialogs/#retention", maxFields))
+}
@@ -0,0 +1,358 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+var (
+	grpcListenAddr = flag.String("opentelemetry.grpcListenAddr", "", "Optional TCP address to listen to for OpenTelemetry logs sent via gRPC (OTLP/gRPC). "+
+		"For example, -opentelemetry.grpcListenAddr=:4317 . See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#grpc")
+	grpcTLS = flag.Bool("opentelemetry.grpc.tls", false, "Whether to enable TLS for -opentelemetry.grpcListenAddr. "+
+		"-opentelemetry.grpc.tlsCertFile and -opentelemetry.grpc.tlsKeyFile must be set if -opentelemetry.grpc.tls is set")
+	grpcTLSCertFile = flag.String("opentelemetry.grpc.tlsCertFile", "", "Path to file with TLS certificate for -opentelemetry.grpcListenAddr if -opentelemetry.grpc.tls is set. "+
+		"The provided certificate file is automatically re-read every second, so it can be dynamically updated")
+	grpcTLSKeyFile = flag.String("opentelemetry.grpc.tlsKeyFile", "", "Path to file with TLS key for -opentelemetry.grpcListenAddr if -opentelemetry.grpc.tls is set. "+
+		"The provided key file is automatically re-read every second, so it can be dynamically updated")
+)
+
+// grpcExportLogsPath is the path for LogsService.Export gRPC method.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/v1.5.0/opentelemetry/proto/collector/logs/v1/logs_service.proto
+const grpcExportLogsPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+// gRPC status codes.
+//
+// See https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	grpcCodeOK                = 0
+	grpcCodeInvalidArgument   = 3
+	grpcCodeResourceExhausted = 8
+	grpcCodeUnimplemented     = 12
+	grpcCodeInternal          = 13
+	grpcCodeUnavailable       = 14
+)
+
+// grpcAcceptEncoding is the list of supported gRPC message encodings.
+const grpcAcceptEncoding = "gzip,zstd,identity"
+
+var (
+	grpcServer   *http.Server
+	grpcServerWG sync.WaitGroup
+)
+
+// MustInit starts accepting OpenTelemetry gRPC requests at -opentelemetry.grpcListenAddr if it is set.
+//
+// MustStop must be called in order to free up resources occupied by the gRPC server.
+func MustInit() {
+	if *grpcListenAddr == "" {
+		return
+	}
+
+	ln, err := netutil.NewTCPListener("opentelemetry_grpc", *grpcListenAddr, false, nil)
+	if err != nil {
+		logger.Fatalf("cannot start listening for OpenTelemetry gRPC requests at -opentelemetry.grpcListenAddr=%q: %s", *grpcListenAddr, err)
+	}
+
+	// gRPC works only over HTTP/2.
+	var protocols http.Protocols
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Handler:   http.HandlerFunc(grpcRequestHandler),
+		Protocols: &protocols,
+	}
+	if *grpcTLS {
+		tc, err := getGRPCServerTLSConfig()
+		if err != nil {
+			logger.Fatalf("%s", err)
+		}
+		srv.TLSConfig = tc
+	}
+	grpcServer = srv
+
+	logger.Infof("started accepting OpenTelemetry gRPC requests at -opentelemetry.grpcListenAddr=%q", *grpcListenAddr)
+	grpcServerWG.Add(1)
+	go func() {
+		defer grpcServerWG.Done()
+		var err error
+		if *grpcTLS {
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("cannot serve OpenTelemetry gRPC requests at -opentelemetry.grpcListenAddr=%q: %s", *grpcListenAddr, err)
+		}
+	}()
+}
+
+// MustStop stops the gRPC server started by MustInit.
+func MustStop() {
+	if grpcServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := grpcServer.Shutdown(ctx); err != nil {
+		logger.Errorf("cannot gracefully stop OpenTelemetry gRPC server at -opentelemetry.grpcListenAddr=%q: %s", *grpcListenAddr, err)
+		_ = grpcServer.Close()
+	}
+	grpcServerWG.Wait()
+	grpcServer = nil
+}
+
+// IsGRPCEnabled returns true if OTLP/gRPC listener is configured via -opentelemetry.grpcListenAddr command-line flag.
+func IsGRPCEnabled() bool {
+	return *grpcListenAddr != ""
+}
+
+// CheckConfig verifies -opentelemetry.grpc.* command-line flags without starting the gRPC server.
+func CheckConfig() error {
+	if *grpcListenAddr == "" || !*grpcTLS {
+		return nil
+	}
+	_, err := getGRPCServerTLSConfig()
+	return err
+}
+
+func getGRPCServerTLSConfig() (*tls.Config, error) {
+	tc, err := netutil.GetServerTLSConfig(*grpcTLSCertFile, *grpcTLSKeyFile, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS cert from -opentelemetry.grpc.tlsCertFile=%q, -opentelemetry.grpc.tlsKeyFile=%q: %w", *grpcTLSCertFile, *grpcTLSKeyFile, err)
+	}
+	return tc, nil
+}
+
+// grpcError is an error with gRPC status code.
+type grpcError struct {
+	code int
+	err  error
+}
+
+func (ge *grpcError) Error() string {
+	return ge.err.Error()
+}
+
+func newGRPCError(code int, format string, args ...any) *grpcError {
+	return &grpcError{
+		code: code,
+		err:  fmt.Errorf(format, args...),
+	}
+}
+
+func grpcRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !isGRPCContentType(r.Header.Get("Content-Type")) {
+		// See https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		fmt.Fprintf(w, "only gRPC requests with application/grpc content type are supported")
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Accept-Encoding", grpcAcceptEncoding)
+	// gRPC status is sent in trailers after the response message.
+	h.Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	if r.URL.Path != grpcExportLogsPath {
+		writeGRPCStatus(w, grpcCodeUnimplemented, fmt.Sprintf("unknown gRPC method %q; supported method: %q", r.URL.Path, grpcExportLogsPath))
+		return
+	}
+
+	startTime := time.Now()
+	requestsGRPCTotal.Inc()
+
+	resp, err := processGRPCExportRequest(r)
+	if err != nil {
+		errorsGRPCTotal.Inc()
+		httpserver.LogError(r, err.Error())
+
+		code := grpcCodeInternal
+		var ge *grpcError
+		if errors.As(err, &ge) {
+			code = ge.code
+		}
+		writeGRPCStatus(w, code, err.Error())
+		return
+	}
+
+	bb := grpcResponseBufPool.Get()
+	bb.B = appendGRPCMessage(bb.B[:0], resp.marshalProtobuf)
+	_, _ = w.Write(bb.B)
+	grpcResponseBufPool.Put(bb)
+	writeGRPCStatus(w, grpcCodeOK, "")
+
+	// update requestGRPCDuration only for successfully parsed requests
+	// There is no need in updating requestGRPCDuration for request errors,
+	// since their timings are usually much smaller than the timing for successful request parsing.
+	requestGRPCDuration.UpdateDuration(startTime)
+}
+
+var grpcResponseBufPool bytesutil.ByteBufferPool
+
+var (
+	requestsGRPCTotal = metrics.NewCounter(`vl_grpc_requests_total{method="` + grpcExportLogsPath + `"}`)
+	errorsGRPCTotal   = metrics.NewCounter(`vl_grpc_errors_total{method="` + grpcExportLogsPath + `"}`)
+
+	requestGRPCDuration = metrics.NewSummary(`vl_grpc_request_duration_seconds{method="` + grpcExportLogsPath + `"}`)
+)
+
+func isGRPCContentType(ct string) bool {
+	return ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+proto") || strings.HasPrefix(ct, "application/grpc;")
+}
+
+func processGRPCExportRequest(r *http.Request) (*exportLogsServiceResponse, error) {
+	cp, err := insertutil.GetCommonParams(r)
+	if err != nil {
+		return nil, newGRPCError(grpcCodeInvalidArgument, "cannot parse common params from request: %w", err)
+	}
+	if cp.DryRun != nil {
+		return nil, newGRPCError(grpcCodeInvalidArgument, "dry run isn't supported for OpenTelemetry gRPC requests")
+	}
+	if err := insertutil.CanWriteData(); err != nil {
+		return nil, newGRPCError(grpcCodeUnavailable, "%w", err)
+	}
+	if err := insertutil.AdmitRequest("opentelemetry"); err != nil {
+		return nil, newGRPCError(grpcCodeUnavailable, "%w", err)
+	}
+	defer insertutil.ReleaseRequest()
+
+	ao := getAttributesOptions(r)
+
+	im := cp.GetIngestionMetrics("opentelemetry_grpc")
+	bb := grpcRequestBufPool.Get()
+	defer grpcRequestBufPool.Put(bb)
+
+	compressed, err := readGRPCMessage(bb, im.NewReceivedBytesReader(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	encoding := "identity"
+	if compressed {
+		encoding = r.Header.Get("Grpc-Encoding")
+		if encoding == "" {
+			return nil, newGRPCError(grpcCodeInternal, "missing grpc-encoding header for compressed message")
+		}
+		switch encoding {
+		case "gzip", "zstd", "identity":
+		default:
+			return nil, newGRPCError(grpcCodeUnimplemented, "unsupported grpc-encoding=%q; supported encodings: %s", encoding, grpcAcceptEncoding)
+		}
+	}
+
+	var resp *exportLogsServiceResponse
+	err = insertutil.ReadUncompressedData("opentelemetry_grpc", bytes.NewReader(bb.B), encoding, maxRequestSize, func(data []byte) error {
+		im.AddUncompressedBytes(len(data))
+		lmp := cp.NewLogMessageProcessor("opentelemetry_grpc", false)
+		rlmp := &rejectsCountingLogMessageProcessor{
+			LogMessageProcessor: lmp,
+		}
+		useDefaultStreamFields := len(cp.StreamFields) == 0
+		err := pushProtobufRequest(data, rlmp, cp.MsgFields, useDefaultStreamFields, ao)
+		lmp.MustClose()
+		resp = rlmp.newExportLogsServiceResponse()
+		if err != nil {
+			im.AddParseErrors(1)
+		}
+		return err
+	})
+	if err != nil {
+		var esc *httpserver.ErrorWithStatusCode
+		if errors.As(err, &esc) && esc.StatusCode == http.StatusTooManyRequests {
+			// The request has been rejected by decompression limits, so it must be retried later.
+			return nil, newGRPCError(grpcCodeUnavailable, "%w", err)
+		}
+		return nil, newGRPCError(grpcCodeInvalidArgument, "cannot read OpenTelemetry protocol data: %w", err)
+	}
+	return resp, nil
+}
+
+var grpcRequestBufPool bytesutil.ByteBufferPool
+
+// readGRPCMessage reads a single length-prefixed gRPC message from r into bb.
+//
+// It returns true if the message is compressed.
+//
+// See https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#requests
+func readGRPCMessage(bb *bytesutil.ByteBuffer, r io.Reader) (bool, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return false, newGRPCError(grpcCodeInvalidArgument, "cannot read gRPC message header: %w", err)
+	}
+	compressed := false
+	switch hdr[0] {
+	case 0:
+	case 1:
+		compressed = true
+	default:
+		return false, newGRPCError(grpcCodeInvalidArgument, "unexpected compressed flag in gRPC message header: %d", hdr[0])
+	}
+
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if int64(n) > maxRequestSize.N {
+		return false, newGRPCError(grpcCodeResourceExhausted, "too big gRPC message size: %d bytes; it mustn't exceed -%s=%d bytes", n, maxRequestSize.Name, maxRequestSize.N)
+	}
+	bb.B = bytesutil.ResizeNoCopyNoOverallocate(bb.B, int(n))
+	if _, err := io.ReadFull(r, bb.B); err != nil {
+		return false, newGRPCError(grpcCodeInvalidArgument, "cannot read gRPC message with %d bytes: %w", n, err)
+	}
+	return compressed, nil
+}
+
+// appendGRPCMessage appends uncompressed length-prefixed gRPC message generated by marshal to dst and returns the result.
+func appendGRPCMessage(dst []byte, marshal func(dst []byte) []byte) []byte {
+	dstLen := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0)
+	dst = marshal(dst)
+	binary.BigEndian.PutUint32(dst[dstLen+1:], uint32(len(dst)-dstLen-5))
+	return dst
+}
+
+// writeGRPCStatus writes gRPC status with the given code and message to w in trailers.
+//
+// The trailers must be declared in the Trailer header before writing the response.
+func writeGRPCStatus(w http.ResponseWriter, code int, msg string) {
+	h := w.Header()
+	h.Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		h.Set("Grpc-Message", encodeGRPCMessage(msg))
+	}
+}
+
+// encodeGRPCMessage percent-encodes msg according to gRPC spec.
+//
+// See https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#responses
+func encodeGRPCMessage(msg string) string {
+	var b []byte
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b = append(b, c)
+			continue
+		}
+		b = append(b, '%', "0123456789ABCDEF"[c>>4], "0123456789ABCDEF"[c&15])
+	}
+	return string(b)
+}
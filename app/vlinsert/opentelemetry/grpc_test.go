@@ -0,0 +1,126 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+)
+
+func TestReadGRPCMessage_Success(t *testing.T) {
+	f := func(src []byte, compressedExpected bool, msgExpected string) {
+		t.Helper()
+
+		var bb bytesutil.ByteBuffer
+		compressed, err := readGRPCMessage(&bb, bytes.NewReader(src))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if compressed != compressedExpected {
+			t.Fatalf("unexpected compressed flag; got %v; want %v", compressed, compressedExpected)
+		}
+		if string(bb.B) != msgExpected {
+			t.Fatalf("unexpected message; got %q; want %q", bb.B, msgExpected)
+		}
+	}
+
+	f([]byte{0, 0, 0, 0, 0}, false, "")
+	f([]byte{0, 0, 0, 0, 3, 'f', 'o', 'o'}, false, "foo")
+	f([]byte{1, 0, 0, 0, 3, 'b', 'a', 'r'}, true, "bar")
+}
+
+func TestReadGRPCMessage_Failure(t *testing.T) {
+	f := func(src []byte, codeExpected int) {
+		t.Helper()
+
+		var bb bytesutil.ByteBuffer
+		_, err := readGRPCMessage(&bb, bytes.NewReader(src))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		var ge *grpcError
+		if !errors.As(err, &ge) {
+			t.Fatalf("expecting grpcError; got %T", err)
+		}
+		if ge.code != codeExpected {
+			t.Fatalf("unexpected code; got %d; want %d", ge.code, codeExpected)
+		}
+	}
+
+	// missing header
+	f(nil, grpcCodeInvalidArgument)
+	f([]byte{0, 0, 0}, grpcCodeInvalidArgument)
+
+	// invalid compressed flag
+	f([]byte{2, 0, 0, 0, 0}, grpcCodeInvalidArgument)
+
+	// truncated message
+	f([]byte{0, 0, 0, 0, 3, 'f', 'o'}, grpcCodeInvalidArgument)
+
+	// too big message
+	f([]byte{0, 0xff, 0xff, 0xff, 0xff}, grpcCodeResourceExhausted)
+}
+
+func TestExportLogsServiceResponseMarshalProtobuf(t *testing.T) {
+	f := func(resp *exportLogsServiceResponse, resultExpected []byte) {
+		t.Helper()
+
+		result := appendGRPCMessage(nil, resp.marshalProtobuf)
+		if !bytes.Equal(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	f(&exportLogsServiceResponse{}, []byte{0, 0, 0, 0, 0})
+	f(&exportLogsServiceResponse{
+		rejectedLogRecords: 2,
+		errorMessage:       "foo",
+	}, []byte{0, 0, 0, 0, 9, 0x0a, 7, 0x08, 2, 0x12, 3, 'f', 'o', 'o'})
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	f := func(msg, resultExpected string) {
+		t.Helper()
+
+		result := encodeGRPCMessage(msg)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f("", "")
+	f("cannot parse data", "cannot parse data")
+	f("100% done\n", "100%25 done%0A")
+	f("привет", "%D0%BF%D1%80%D0%B8%D0%B2%D0%B5%D1%82")
+}
+
+func TestGRPCRequestHandler(t *testing.T) {
+	f := func(method, path, contentType string, statusCodeExpected int, grpcStatusExpected string) {
+		t.Helper()
+
+		r := httptest.NewRequest(method, path, strings.NewReader(""))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		grpcRequestHandler(w, r)
+
+		resp := w.Result()
+		if resp.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", resp.StatusCode, statusCodeExpected)
+		}
+		grpcStatus := resp.Trailer.Get("Grpc-Status")
+		if grpcStatus != grpcStatusExpected {
+			t.Fatalf("unexpected grpc-status; got %q; want %q", grpcStatus, grpcStatusExpected)
+		}
+	}
+
+	// non-gRPC requests
+	f(http.MethodGet, grpcExportLogsPath, "application/grpc", http.StatusUnsupportedMediaType, "")
+	f(http.MethodPost, grpcExportLogsPath, "application/json", http.StatusUnsupportedMediaType, "")
+
+	// unknown method
+	f(http.MethodPost, "/opentelemetry.proto.collector.trace.v1.TraceService/Export", "application/grpc", http.StatusOK, "12")
+}
@@ -1,20 +1,38 @@
 package opentelemetry
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
 	"github.com/VictoriaMetrics/metrics"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
-var maxRequestSize = flagutil.NewBytes("opentelemetry.maxRequestSize", 64*1024*1024, "The maximum size in bytes of a single OpenTelemetry request")
+var (
+	maxRequestSize = flagutil.NewBytes("opentelemetry.maxRequestSize", 64*1024*1024, "The maximum size in bytes of a single OpenTelemetry request")
+	levelField     = flag.String("opentelemetry.levelField", "", "Optional name of the field for storing the normalized log level (trace, debug, info, warn, error or fatal) "+
+		"derived from severity_number and severity_text of the ingested OpenTelemetry log records. For example, -opentelemetry.levelField=level. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#log-levels")
+	bodyFieldsPrefix = flag.String("opentelemetry.bodyFieldsPrefix", "", "Optional prefix for the names of fields obtained from OpenTelemetry log records with Map body. "+
+		"For example, -opentelemetry.bodyFieldsPrefix=body stores the 'foo' key of the body in the 'body.foo' field. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#structured-body")
+	mapBodyAsJSON = flag.Bool("opentelemetry.mapBodyAsJSON", false, "Whether to store Map body of OpenTelemetry log records as JSON object in the _msg field "+
+		"instead of storing its keys as separate fields. See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#structured-body")
+	traceIDField = flag.String("opentelemetry.traceIDField", "trace_id", "The name of the field for storing trace_id of the ingested OpenTelemetry log records. "+
+		"trace_id isn't stored if this flag is set to an empty string. See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#trace-context")
+	spanIDField = flag.String("opentelemetry.spanIDField", "span_id", "The name of the field for storing span_id of the ingested OpenTelemetry log records. "+
+		"span_id isn't stored if this flag is set to an empty string. See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#trace-context")
+	traceFlagsField = flag.String("opentelemetry.traceFlagsField", "trace_flags", "The name of the field for storing W3C trace flags of the ingested OpenTelemetry log records. "+
+		"Trace flags aren't stored if this flag is set to an empty string. See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#trace-context")
+	dropSeverity = flag.Bool("opentelemetry.dropSeverity", false, "Whether to drop the severity field from the ingested OpenTelemetry log records if the normalized log level is stored "+
+		"in the field set via -opentelemetry.levelField. See https://docs.victoriametrics.com/victorialogs/data-ingestion/opentelemetry/#log-levels")
+)
 
 // RequestHandler processes Opentelemetry insert requests
 func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
@@ -24,7 +42,7 @@ func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
 	case "/insert/opentelemetry/v1/logs":
 		ct := r.Header.Get("Content-Type")
 		if insertutil.IsJSONContentType(ct) {
-			httpserver.Errorf(w, r, "json encoding isn't supported for opentelemetry format. Use protobuf encoding")
+			handleJSON(r, w)
 			return true
 		}
 		handleProtobuf(r, w)
@@ -48,23 +66,45 @@ func handleProtobuf(r *http.Request, w http.ResponseWriter) {
 		return
 	}
 
+	ao := getAttributesOptions(r)
+
 	encoding := r.Header.Get("Content-Encoding")
-	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
+	im := cp.GetIngestionMetrics("opentelemetry_protobuf")
+	var resp *exportLogsServiceResponse
+	err = insertutil.ReadUncompressedData("opentelemetry_protobuf", im.NewReceivedBytesReader(r.Body), encoding, maxRequestSize, func(data []byte) error {
+		im.AddUncompressedBytes(len(data))
 		lmp := cp.NewLogMessageProcessor("opentelemetry_protobuf", false)
+		rlmp := &rejectsCountingLogMessageProcessor{
+			LogMessageProcessor: lmp,
+		}
 		useDefaultStreamFields := len(cp.StreamFields) == 0
-		err := pushProtobufRequest(data, lmp, cp.MsgFields, useDefaultStreamFields)
+		err := pushProtobufRequest(data, rlmp, cp.MsgFields, useDefaultStreamFields, ao)
 		lmp.MustClose()
+		resp = rlmp.newExportLogsServiceResponse()
+		if err != nil {
+			im.AddParseErrors(1)
+		}
 		return err
 	})
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot read OpenTelemetry protocol data: %s", err)
 		return
 	}
+	if drr := cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return
+	}
 
 	// update requestProtobufDuration only for successfully parsed requests
 	// There is no need in updating requestProtobufDuration for request errors,
 	// since their timings are usually much smaller than the timing for successful request parsing.
 	requestProtobufDuration.UpdateDuration(startTime)
+
+	// Return ExportLogsServiceResponse in the same encoding as the request.
+	// It contains ExportLogsPartialSuccess message if some log records were rejected.
+	// See https://opentelemetry.io/docs/specs/otlp/#partial-success-1
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp.marshalProtobuf(nil))
 }
 
 var (
@@ -74,8 +114,29 @@ var (
 	requestProtobufDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/insert/opentelemetry/v1/logs",format="protobuf"}`)
 )
 
-func pushProtobufRequest(data []byte, lmp insertutil.LogMessageProcessor, msgFields []string, useDefaultStreamFields bool) error {
-	pushLogs := func(timestamp int64, fields []logstorage.Field, streamFieldsLen int) {
+func pushProtobufRequest(data []byte, lmp insertutil.LogMessageProcessor, msgFields []string, useDefaultStreamFields bool, ao *attributesOptions) error {
+	pushLogs := newPushLogsHandler(lmp, msgFields, useDefaultStreamFields)
+	if err := decodeLogsData(data, ao, pushLogs); err != nil {
+		errorsTotal.Inc()
+		return fmt.Errorf("cannot decode LogsData request from %d bytes: %w", len(data), err)
+	}
+	return nil
+}
+
+// PushProtobufLogsData sends logs from OpenTelemetry LogsData message in protobuf format at data to lmp.
+//
+// It is intended for ingesting OpenTelemetry logs received via transports other than HTTP and gRPC such as Kafka.
+// Resource and scope attributes are stored according to -opentelemetry.* command-line flags.
+func PushProtobufLogsData(data []byte, lmp insertutil.LogMessageProcessor, msgFields []string, useDefaultStreamFields bool) error {
+	pushLogs := newPushLogsHandler(lmp, msgFields, useDefaultStreamFields)
+	if err := decodeLogsData(data, getDefaultAttributesOptions(), pushLogs); err != nil {
+		return fmt.Errorf("cannot decode LogsData message from %d bytes: %w", len(data), err)
+	}
+	return nil
+}
+
+func newPushLogsHandler(lmp insertutil.LogMessageProcessor, msgFields []string, useDefaultStreamFields bool) pushLogsHandler {
+	return func(timestamp int64, fields []logstorage.Field, streamFieldsLen int) {
 		logstorage.RenameField(fields[streamFieldsLen:], msgFields, "_msg")
 
 		if !useDefaultStreamFields {
@@ -84,10 +145,4 @@ func pushProtobufRequest(data []byte, lmp insertutil.LogMessageProcessor, msgFie
 
 		lmp.AddRow(timestamp, fields, streamFieldsLen)
 	}
-
-	if err := decodeLogsData(data, pushLogs); err != nil {
-		errorsTotal.Inc()
-		return fmt.Errorf("cannot decode LogsData request from %d bytes: %w", len(data), err)
-	}
-	return nil
 }
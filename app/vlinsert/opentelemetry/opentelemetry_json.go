@@ -0,0 +1,527 @@
+package opentelemetry
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/easyproto"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+func handleJSON(r *http.Request, w http.ResponseWriter) {
+	startTime := time.Now()
+	requestsJSONTotal.Inc()
+
+	cp, err := insertutil.GetCommonParams(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse common params from request: %s", err)
+		return
+	}
+	if err := insertutil.CanWriteData(); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	ao := getAttributesOptions(r)
+
+	encoding := r.Header.Get("Content-Encoding")
+	im := cp.GetIngestionMetrics("opentelemetry_json")
+	var resp *exportLogsServiceResponse
+	err = insertutil.ReadUncompressedData("opentelemetry_json", im.NewReceivedBytesReader(r.Body), encoding, maxRequestSize, func(data []byte) error {
+		im.AddUncompressedBytes(len(data))
+		lmp := cp.NewLogMessageProcessor("opentelemetry_json", false)
+		rlmp := &rejectsCountingLogMessageProcessor{
+			LogMessageProcessor: lmp,
+		}
+		useDefaultStreamFields := len(cp.StreamFields) == 0
+		err := pushJSONRequest(data, rlmp, cp.MsgFields, useDefaultStreamFields, ao)
+		lmp.MustClose()
+		resp = rlmp.newExportLogsServiceResponse()
+		if err != nil {
+			im.AddParseErrors(1)
+		}
+		return err
+	})
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot read OpenTelemetry protocol data: %s", err)
+		return
+	}
+	if drr := cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return
+	}
+
+	// update requestJSONDuration only for successfully parsed requests
+	// There is no need in updating requestJSONDuration for request errors,
+	// since their timings are usually much smaller than the timing for successful request parsing.
+	requestJSONDuration.UpdateDuration(startTime)
+
+	// Return ExportLogsServiceResponse in the same encoding as the request.
+	// It contains ExportLogsPartialSuccess message if some log records were rejected.
+	// See https://opentelemetry.io/docs/specs/otlp/#otlphttp-response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp.marshalJSON(nil))
+}
+
+var (
+	requestsJSONTotal = metrics.NewCounter(`vl_http_requests_total{path="/insert/opentelemetry/v1/logs",format="json"}`)
+	errorsJSONTotal   = metrics.NewCounter(`vl_http_errors_total{path="/insert/opentelemetry/v1/logs",format="json"}`)
+
+	requestJSONDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/insert/opentelemetry/v1/logs",format="json"}`)
+)
+
+// pushJSONRequest pushes OTLP/JSON LogsData message from data to lmp.
+//
+// The message is converted to protobuf, so the same attributes are stored in the same fields as for protobuf requests.
+func pushJSONRequest(data []byte, lmp insertutil.LogMessageProcessor, msgFields []string, useDefaultStreamFields bool, ao *attributesOptions) error {
+	bb := jsonProtobufBufPool.Get()
+	defer jsonProtobufBufPool.Put(bb)
+
+	var err error
+	bb.B, err = marshalLogsDataFromJSON(bb.B[:0], data)
+	if err != nil {
+		errorsJSONTotal.Inc()
+		return fmt.Errorf("cannot parse OTLP/JSON LogsData request from %d bytes: %w", len(data), err)
+	}
+
+	pushLogs := newPushLogsHandler(lmp, msgFields, useDefaultStreamFields)
+	if err := decodeLogsData(bb.B, ao, pushLogs); err != nil {
+		errorsJSONTotal.Inc()
+		return fmt.Errorf("cannot decode LogsData request from %d bytes: %w", len(data), err)
+	}
+	return nil
+}
+
+// PushJSONLogsData sends logs from OpenTelemetry LogsData message in JSON format at data to lmp.
+//
+// See PushProtobufLogsData for details.
+func PushJSONLogsData(data []byte, lmp insertutil.LogMessageProcessor, msgFields []string, useDefaultStreamFields bool) error {
+	bb := jsonProtobufBufPool.Get()
+	defer jsonProtobufBufPool.Put(bb)
+
+	var err error
+	bb.B, err = marshalLogsDataFromJSON(bb.B[:0], data)
+	if err != nil {
+		return fmt.Errorf("cannot parse OTLP/JSON LogsData message from %d bytes: %w", len(data), err)
+	}
+	return PushProtobufLogsData(bb.B, lmp, msgFields, useDefaultStreamFields)
+}
+
+var jsonProtobufBufPool bytesutil.ByteBufferPool
+
+var (
+	jsonParserPool    fastjson.ParserPool
+	jsonMarshalerPool easyproto.MarshalerPool
+)
+
+// marshalLogsDataFromJSON converts OTLP/JSON LogsData message from data to protobuf, appends it to dst and returns the result.
+//
+// See https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+func marshalLogsDataFromJSON(dst, data []byte) ([]byte, error) {
+	p := jsonParserPool.Get()
+	defer jsonParserPool.Put(p)
+
+	v, err := p.ParseBytes(data)
+	if err != nil {
+		return dst, fmt.Errorf("cannot parse JSON: %w", err)
+	}
+
+	m := jsonMarshalerPool.Get()
+	defer jsonMarshalerPool.Put(m)
+
+	if err := marshalLogsDataJSON(m.MessageMarshaler(), v); err != nil {
+		return dst, err
+	}
+	return m.Marshal(dst), nil
+}
+
+func marshalLogsDataJSON(mm *easyproto.MessageMarshaler, v *fastjson.Value) error {
+	// message LogsData {
+	//   repeated ResourceLogs resource_logs = 1;
+	// }
+	return forEachJSONObject(v, "resourceLogs", "resource_logs", func(v *fastjson.Value) error {
+		if err := marshalResourceLogsJSON(mm.AppendMessage(1), v); err != nil {
+			return fmt.Errorf("cannot parse resourceLogs: %w", err)
+		}
+		return nil
+	})
+}
+
+func marshalResourceLogsJSON(mm *easyproto.MessageMarshaler, v *fastjson.Value) error {
+	// message ResourceLogs {
+	//   Resource resource = 1;
+	//   repeated ScopeLogs scope_logs = 2;
+	// }
+	if r := getJSONField(v, "resource", ""); r != nil {
+		// message Resource {
+		//   repeated KeyValue attributes = 1;
+		// }
+		rmm := mm.AppendMessage(1)
+		if err := marshalKeyValuesJSON(rmm, 1, r, "attributes", ""); err != nil {
+			return fmt.Errorf("cannot parse resource: %w", err)
+		}
+	}
+	return forEachJSONObject(v, "scopeLogs", "scope_logs", func(v *fastjson.Value) error {
+		if err := marshalScopeLogsJSON(mm.AppendMessage(2), v); err != nil {
+			return fmt.Errorf("cannot parse scopeLogs: %w", err)
+		}
+		return nil
+	})
+}
+
+func marshalScopeLogsJSON(mm *easyproto.MessageMarshaler, v *fastjson.Value) error {
+	// message ScopeLogs {
+	//   InstrumentationScope scope = 1;
+	//   repeated LogRecord log_records = 2;
+	// }
+	if s := getJSONField(v, "scope", ""); s != nil {
+		// message InstrumentationScope {
+		//   string name = 1;
+		//   string version = 2;
+		//   repeated KeyValue attributes = 3;
+		// }
+		smm := mm.AppendMessage(1)
+		if err := marshalStringJSON(smm, 1, s, "name", ""); err != nil {
+			return fmt.Errorf("cannot parse scope: %w", err)
+		}
+		if err := marshalStringJSON(smm, 2, s, "version", ""); err != nil {
+			return fmt.Errorf("cannot parse scope: %w", err)
+		}
+		if err := marshalKeyValuesJSON(smm, 3, s, "attributes", ""); err != nil {
+			return fmt.Errorf("cannot parse scope: %w", err)
+		}
+	}
+	return forEachJSONObject(v, "logRecords", "log_records", func(v *fastjson.Value) error {
+		if err := marshalLogRecordJSON(mm.AppendMessage(2), v); err != nil {
+			return fmt.Errorf("cannot parse logRecords: %w", err)
+		}
+		return nil
+	})
+}
+
+func marshalLogRecordJSON(mm *easyproto.MessageMarshaler, v *fastjson.Value) error {
+	// message LogRecord {
+	//   fixed64 time_unix_nano = 1;
+	//   SeverityNumber severity_number = 2;
+	//   string severity_text = 3;
+	//   AnyValue body = 5;
+	//   repeated KeyValue attributes = 6;
+	//   fixed32 flags = 8;
+	//   bytes trace_id = 9;
+	//   bytes span_id = 10;
+	//   fixed64 observed_time_unix_nano = 11;
+	//   string event_name = 12;
+	// }
+	if tv := getJSONField(v, "timeUnixNano", "time_unix_nano"); tv != nil {
+		n, err := getJSONUint64(tv)
+		if err != nil {
+			return fmt.Errorf("cannot parse timeUnixNano: %w", err)
+		}
+		mm.AppendFixed64(1, n)
+	}
+	if sv := getJSONField(v, "severityNumber", "severity_number"); sv != nil {
+		n, err := getJSONSeverityNumber(sv)
+		if err != nil {
+			return fmt.Errorf("cannot parse severityNumber: %w", err)
+		}
+		mm.AppendInt32(2, n)
+	}
+	if err := marshalStringJSON(mm, 3, v, "severityText", "severity_text"); err != nil {
+		return err
+	}
+	if bv := getJSONField(v, "body", ""); bv != nil {
+		if err := marshalAnyValueJSON(mm.AppendMessage(5), bv); err != nil {
+			return fmt.Errorf("cannot parse body: %w", err)
+		}
+	}
+	if err := marshalKeyValuesJSON(mm, 6, v, "attributes", ""); err != nil {
+		return err
+	}
+	if fv := getJSONField(v, "flags", ""); fv != nil {
+		n, err := fv.Uint()
+		if err != nil {
+			return fmt.Errorf("cannot parse flags: %w", err)
+		}
+		if n > math.MaxUint32 {
+			return fmt.Errorf("cannot parse flags: %d exceeds %d", n, uint64(math.MaxUint32))
+		}
+		mm.AppendFixed32(8, uint32(n))
+	}
+	if err := marshalHexBytesJSON(mm, 9, v, "traceId", "trace_id"); err != nil {
+		return err
+	}
+	if err := marshalHexBytesJSON(mm, 10, v, "spanId", "span_id"); err != nil {
+		return err
+	}
+	if tv := getJSONField(v, "observedTimeUnixNano", "observed_time_unix_nano"); tv != nil {
+		n, err := getJSONUint64(tv)
+		if err != nil {
+			return fmt.Errorf("cannot parse observedTimeUnixNano: %w", err)
+		}
+		mm.AppendFixed64(11, n)
+	}
+	return marshalStringJSON(mm, 12, v, "eventName", "event_name")
+}
+
+// marshalKeyValuesJSON marshals KeyValue list from the given field of v into fieldNum at mm.
+func marshalKeyValuesJSON(mm *easyproto.MessageMarshaler, fieldNum uint32, v *fastjson.Value, name, protoName string) error {
+	return forEachJSONObject(v, name, protoName, func(v *fastjson.Value) error {
+		if err := marshalKeyValueJSON(mm.AppendMessage(fieldNum), v); err != nil {
+			return fmt.Errorf("cannot parse %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+func marshalKeyValueJSON(mm *easyproto.MessageMarshaler, v *fastjson.Value) error {
+	// message KeyValue {
+	//   string key = 1;
+	//   AnyValue value = 2;
+	// }
+	if err := marshalStringJSON(mm, 1, v, "key", ""); err != nil {
+		return err
+	}
+	if vv := getJSONField(v, "value", ""); vv != nil {
+		if err := marshalAnyValueJSON(mm.AppendMessage(2), vv); err != nil {
+			return fmt.Errorf("cannot parse value: %w", err)
+		}
+	}
+	return nil
+}
+
+func marshalAnyValueJSON(mm *easyproto.MessageMarshaler, v *fastjson.Value) error {
+	// message AnyValue {
+	//   oneof value {
+	//     string string_value = 1;
+	//     bool bool_value = 2;
+	//     int64 int_value = 3;
+	//     double double_value = 4;
+	//     ArrayValue array_value = 5;
+	//     KeyValueList kvlist_value = 6;
+	//     bytes bytes_value = 7;
+	//   }
+	// }
+	if err := marshalStringJSON(mm, 1, v, "stringValue", "string_value"); err != nil {
+		return err
+	}
+	if bv := getJSONField(v, "boolValue", "bool_value"); bv != nil {
+		b, err := bv.Bool()
+		if err != nil {
+			return fmt.Errorf("cannot parse boolValue: %w", err)
+		}
+		mm.AppendBool(2, b)
+	}
+	if iv := getJSONField(v, "intValue", "int_value"); iv != nil {
+		n, err := getJSONInt64(iv)
+		if err != nil {
+			return fmt.Errorf("cannot parse intValue: %w", err)
+		}
+		mm.AppendInt64(3, n)
+	}
+	if dv := getJSONField(v, "doubleValue", "double_value"); dv != nil {
+		f, err := getJSONFloat64(dv)
+		if err != nil {
+			return fmt.Errorf("cannot parse doubleValue: %w", err)
+		}
+		mm.AppendDouble(4, f)
+	}
+	if av := getJSONField(v, "arrayValue", "array_value"); av != nil {
+		// message ArrayValue {
+		//   repeated AnyValue values = 1;
+		// }
+		amm := mm.AppendMessage(5)
+		err := forEachJSONObject(av, "values", "", func(v *fastjson.Value) error {
+			return marshalAnyValueJSON(amm.AppendMessage(1), v)
+		})
+		if err != nil {
+			return fmt.Errorf("cannot parse arrayValue: %w", err)
+		}
+	}
+	if kv := getJSONField(v, "kvlistValue", "kvlist_value"); kv != nil {
+		// message KeyValueList {
+		//   repeated KeyValue values = 1;
+		// }
+		if err := marshalKeyValuesJSON(mm.AppendMessage(6), 1, kv, "values", ""); err != nil {
+			return fmt.Errorf("cannot parse kvlistValue: %w", err)
+		}
+	}
+	if bv := getJSONField(v, "bytesValue", "bytes_value"); bv != nil {
+		s, err := bv.StringBytes()
+		if err != nil {
+			return fmt.Errorf("cannot parse bytesValue: %w", err)
+		}
+		b, err := decodeBase64(bytesutil.ToUnsafeString(s))
+		if err != nil {
+			return fmt.Errorf("cannot parse bytesValue: %w", err)
+		}
+		mm.AppendBytes(7, b)
+	}
+	return nil
+}
+
+// getJSONField returns the field with the given name from v.
+//
+// protoName is the original field name from the protobuf definition. It is accepted in the same way as the official JSON mapping for protobuf does.
+func getJSONField(v *fastjson.Value, name, protoName string) *fastjson.Value {
+	fv := v.Get(name)
+	if fv == nil && protoName != "" {
+		fv = v.Get(protoName)
+	}
+	if fv == nil || fv.Type() == fastjson.TypeNull {
+		return nil
+	}
+	return fv
+}
+
+// forEachJSONObject calls f for every item of the array at the given field of v.
+func forEachJSONObject(v *fastjson.Value, name, protoName string, f func(v *fastjson.Value) error) error {
+	fv := getJSONField(v, name, protoName)
+	if fv == nil {
+		return nil
+	}
+	a, err := fv.Array()
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %w", name, err)
+	}
+	for _, item := range a {
+		if item.Type() != fastjson.TypeObject {
+			return fmt.Errorf("unexpected type for %s item; got %s; want object", name, item.Type())
+		}
+		if err := f(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func marshalStringJSON(mm *easyproto.MessageMarshaler, fieldNum uint32, v *fastjson.Value, name, protoName string) error {
+	fv := getJSONField(v, name, protoName)
+	if fv == nil {
+		return nil
+	}
+	s, err := fv.StringBytes()
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %w", name, err)
+	}
+	mm.AppendString(fieldNum, bytesutil.ToUnsafeString(s))
+	return nil
+}
+
+// marshalHexBytesJSON marshals hex-encoded bytes from the given field of v into fieldNum at mm.
+//
+// OTLP/JSON uses hex encoding for traceId and spanId instead of base64 encoding used for other bytes fields.
+func marshalHexBytesJSON(mm *easyproto.MessageMarshaler, fieldNum uint32, v *fastjson.Value, name, protoName string) error {
+	fv := getJSONField(v, name, protoName)
+	if fv == nil {
+		return nil
+	}
+	s, err := fv.StringBytes()
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %w", name, err)
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	b, err := hex.DecodeString(bytesutil.ToUnsafeString(s))
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %w", name, err)
+	}
+	mm.AppendBytes(fieldNum, b)
+	return nil
+}
+
+// getJSONUint64 returns uint64 from v.
+//
+// 64-bit integers may be encoded either as JSON numbers or as JSON strings according to JSON mapping for protobuf.
+func getJSONUint64(v *fastjson.Value) (uint64, error) {
+	if v.Type() == fastjson.TypeString {
+		return strconv.ParseUint(bytesutil.ToUnsafeString(v.GetStringBytes()), 10, 64)
+	}
+	return v.Uint64()
+}
+
+// getJSONInt64 returns int64 from v.
+//
+// 64-bit integers may be encoded either as JSON numbers or as JSON strings according to JSON mapping for protobuf.
+func getJSONInt64(v *fastjson.Value) (int64, error) {
+	if v.Type() == fastjson.TypeString {
+		return strconv.ParseInt(bytesutil.ToUnsafeString(v.GetStringBytes()), 10, 64)
+	}
+	return v.Int64()
+}
+
+// getJSONFloat64 returns float64 from v.
+//
+// Special values are encoded as "NaN", "Infinity" and "-Infinity" strings according to JSON mapping for protobuf.
+func getJSONFloat64(v *fastjson.Value) (float64, error) {
+	if v.Type() != fastjson.TypeString {
+		return v.Float64()
+	}
+	s := bytesutil.ToUnsafeString(v.GetStringBytes())
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	default:
+		return strconv.ParseFloat(s, 64)
+	}
+}
+
+// getJSONSeverityNumber returns SeverityNumber enum value from v.
+//
+// The value may be encoded either as an integer or as enum value name such as SEVERITY_NUMBER_INFO.
+func getJSONSeverityNumber(v *fastjson.Value) (int32, error) {
+	if v.Type() != fastjson.TypeString {
+		n, err := v.Int()
+		return int32(n), err
+	}
+	s := bytesutil.ToUnsafeString(v.GetStringBytes())
+	n, ok := severityNumberValues[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown severity number %q", s)
+	}
+	return n, nil
+}
+
+// severityNumberValues maps SeverityNumber enum value names to their values.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/v1.5.0/opentelemetry/proto/logs/v1/logs.proto
+var severityNumberValues = func() map[string]int32 {
+	m := map[string]int32{
+		"SEVERITY_NUMBER_UNSPECIFIED": 0,
+	}
+	for i, name := range []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"} {
+		for j, suffix := range []string{"", "2", "3", "4"} {
+			m["SEVERITY_NUMBER_"+name+suffix] = int32(i*4 + j + 1)
+		}
+	}
+	return m
+}()
+
+// decodeBase64 decodes base64-encoded s.
+//
+// Both standard and URL-safe encodings with optional padding are accepted according to JSON mapping for protobuf.
+func decodeBase64(s string) ([]byte, error) {
+	enc := base64.StdEncoding
+	if strings.ContainsAny(s, "-_") {
+		enc = base64.URLEncoding
+	}
+	if len(s)%4 != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	return enc.DecodeString(s)
+}
@@ -0,0 +1,124 @@
+package opentelemetry
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+func TestPushJSONRequest_Success(t *testing.T) {
+	f := func(data string, timestampsExpected []int64, resultExpected string) {
+		t.Helper()
+
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := pushJSONRequest([]byte(data), tlp, nil, false, &attributesOptions{}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := tlp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// empty request
+	f(`{}`, nil, ``)
+	f(`{"resourceLogs":[]}`, nil, ``)
+
+	// request in the format sent by OpenTelemetry collector
+	f(`{
+		"resourceLogs": [{
+			"resource": {
+				"attributes": [
+					{"key": "service.name", "value": {"stringValue": "my.service"}}
+				]
+			},
+			"scopeLogs": [{
+				"scope": {
+					"name": "my.library",
+					"version": "1.0.0",
+					"attributes": [
+						{"key": "my.scope.attribute", "value": {"stringValue": "some scope attribute"}}
+					]
+				},
+				"logRecords": [{
+					"timeUnixNano": "1544712660300000000",
+					"observedTimeUnixNano": "1544712660300000001",
+					"severityNumber": 10,
+					"severityText": "Information",
+					"traceId": "5b8efff798038103d269b633813fc60c",
+					"spanId": "eee19b7ec3c1b174",
+					"flags": 1,
+					"body": {"stringValue": "Example log record"},
+					"attributes": [
+						{"key": "string.attribute", "value": {"stringValue": "some string"}},
+						{"key": "boolean.attribute", "value": {"boolValue": true}},
+						{"key": "int.attribute", "value": {"intValue": "10"}},
+						{"key": "double.attribute", "value": {"doubleValue": 637.704}},
+						{"key": "array.attribute", "value": {"arrayValue": {"values": [{"stringValue": "many"}, {"stringValue": "values"}]}}},
+						{"key": "map.attribute", "value": {"kvlistValue": {"values": [{"key": "some.map.key", "value": {"stringValue": "some value"}}]}}}
+					]
+				}]
+			}]
+		}]
+	}`, []int64{1544712660300000000}, `{"service.name":"my.service","scope.name":"my.library","scope.version":"1.0.0","scope.attributes.my.scope.attribute":"some scope attribute",`+
+		`"_msg":"Example log record","string.attribute":"some string","boolean.attribute":"true","int.attribute":"10","double.attribute":"637.704",`+
+		`"array.attribute":"[\"many\",\"values\"]","map.attribute.some.map.key":"some value","trace_flags":"01","trace_id":"5b8efff798038103d269b633813fc60c","span_id":"eee19b7ec3c1b174","severity":"Information"}`)
+
+	// snake_case field names, numeric 64-bit integers, enum severity and special double values
+	f(`{
+		"resource_logs": [{
+			"scope_logs": [{
+				"log_records": [{
+					"time_unix_nano": 1234,
+					"severity_number": "SEVERITY_NUMBER_ERROR",
+					"body": {"string_value": "foo"},
+					"attributes": [
+						{"key": "a", "value": {"int_value": -5}},
+						{"key": "b", "value": {"double_value": "NaN"}},
+						{"key": "c", "value": {"bytes_value": "Zm9vIGJhcg=="}},
+						{"key": "d", "value": null}
+					]
+				}, {
+					"observedTimeUnixNano": "5678",
+					"eventName": "bar",
+					"unknownField": {"x": "y"},
+					"body": {"stringValue": "bar"}
+				}]
+			}]
+		}]
+	}`, []int64{1234, 5678}, `{"_msg":"foo","a":"-5","b":"NaN","c":"Zm9vIGJhcg==","severity":"Error"}
+{"event_name":"bar","_msg":"bar","severity":"Unspecified"}`)
+}
+
+func TestPushJSONRequest_Failure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := pushJSONRequest([]byte(data), tlp, nil, false, &attributesOptions{}); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid JSON
+	f(``)
+	f(`{"resourceLogs":`)
+
+	// invalid types
+	f(`{"resourceLogs":{}}`)
+	f(`{"resourceLogs":[1]}`)
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"timeUnixNano":"foo"}]}]}]}`)
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"severityNumber":"SEVERITY_NUMBER_FOO"}]}]}]}`)
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"severityText":123}]}]}]}`)
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"boolValue":"true"}}]}]}]}`)
+
+	// invalid traceId
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"traceId":"xyz"}]}]}]}`)
+
+	// invalid flags
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"flags":"foo"}]}]}]}`)
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"flags":-1}]}]}]}`)
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"flags":4294967296}]}]}]}`)
+
+	// invalid bytesValue
+	f(`{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"body":{"bytesValue":"!!!"}}]}]}]}`)
+}
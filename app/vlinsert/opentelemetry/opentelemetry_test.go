@@ -3,12 +3,17 @@ package opentelemetry
 import (
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/VictoriaMetrics/easyproto"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
 )
 
 func TestPushProtobufRequest(t *testing.T) {
@@ -29,7 +34,7 @@ func TestPushProtobufRequest(t *testing.T) {
 
 		pData := lr.marshalProtobuf(nil)
 		tlp := &insertutil.TestLogMessageProcessor{}
-		if err := pushProtobufRequest(pData, tlp, nil, false); err != nil {
+		if err := pushProtobufRequest(pData, tlp, nil, false, &attributesOptions{}); err != nil {
 			t.Fatalf("unexpected error when parsing protobuf data: %s", err)
 		}
 
@@ -376,6 +381,347 @@ func TestPushProtobufRequest(t *testing.T) {
 	f(data, timestampsExpected, resultsExpected)
 }
 
+func TestPushProtobufRequestTraceContext(t *testing.T) {
+	defer func(traceID, spanID, traceFlags string) {
+		*traceIDField = traceID
+		*spanIDField = spanID
+		*traceFlagsField = traceFlags
+	}(*traceIDField, *spanIDField, *traceFlagsField)
+
+	f := func(traceIDFieldValue, spanIDFieldValue, traceFlagsFieldValue string, resultExpected string) {
+		t.Helper()
+
+		*traceIDField = traceIDFieldValue
+		*spanIDField = spanIDFieldValue
+		*traceFlagsField = traceFlagsFieldValue
+
+		data := `[{
+			"scopeLogs": [{
+				"logRecords": [
+					{"timeUnixNano":1234,"body":{"stringValue":"foo"},"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"00f067aa0ba902b7","flags":1},
+					{"timeUnixNano":1235,"body":{"stringValue":"bar"},"traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"00f067aa0ba902b7","flags":768},
+					{"timeUnixNano":1236,"body":{"stringValue":"baz"}}
+				]
+			}]
+		}]`
+		var rls []resourceLogs
+		if err := json.Unmarshal([]byte(data), &rls); err != nil {
+			t.Fatalf("unexpected error when parsing JSON: %s", err)
+		}
+		lr := logsData{
+			ResourceLogs: rls,
+		}
+		pData := lr.marshalProtobuf(nil)
+
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := pushProtobufRequest(pData, tlp, nil, false, &attributesOptions{}); err != nil {
+			t.Fatalf("unexpected error when parsing protobuf data: %s", err)
+		}
+		if err := tlp.Verify([]int64{1234, 1235, 1236}, resultExpected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// default field names
+	f("trace_id", "span_id", "trace_flags", `{"_msg":"foo","trace_flags":"01","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","severity":"Unspecified"}
+{"_msg":"bar","trace_flags":"00","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","severity":"Unspecified"}
+{"_msg":"baz","severity":"Unspecified"}`)
+
+	// custom field names
+	f("traceID", "spanID", "traceFlags", `{"_msg":"foo","traceFlags":"01","traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"00f067aa0ba902b7","severity":"Unspecified"}
+{"_msg":"bar","traceFlags":"00","traceID":"4bf92f3577b34da6a3ce929d0e0e4736","spanID":"00f067aa0ba902b7","severity":"Unspecified"}
+{"_msg":"baz","severity":"Unspecified"}`)
+
+	// disabled fields
+	f("", "", "", `{"_msg":"foo","severity":"Unspecified"}
+{"_msg":"bar","severity":"Unspecified"}
+{"_msg":"baz","severity":"Unspecified"}`)
+}
+
+func TestPushProtobufRequestLevelField(t *testing.T) {
+	defer func(lf string, ds bool) {
+		*levelField = lf
+		*dropSeverity = ds
+	}(*levelField, *dropSeverity)
+
+	f := func(levelFieldValue string, dropSeverityValue bool, resultExpected string) {
+		t.Helper()
+
+		*levelField = levelFieldValue
+		*dropSeverity = dropSeverityValue
+
+		data := `[{
+			"scopeLogs": [{
+				"logRecords": [
+					{"timeUnixNano":1234,"severityNumber":3,"body":{"stringValue":"foo"}},
+					{"timeUnixNano":1235,"severityNumber":10,"severityText":"INFO","body":{"stringValue":"foo"}},
+					{"timeUnixNano":1236,"severityText":"Warning","body":{"stringValue":"foo"}},
+					{"timeUnixNano":1237,"severityNumber":20,"body":{"stringValue":"foo"}},
+					{"timeUnixNano":1238,"severityText":"crit","body":{"stringValue":"foo"}},
+					{"timeUnixNano":1239,"severityText":"unknown","body":{"stringValue":"foo"}}
+				]
+			}]
+		}]`
+		var rls []resourceLogs
+		if err := json.Unmarshal([]byte(data), &rls); err != nil {
+			t.Fatalf("unexpected error when parsing JSON: %s", err)
+		}
+		lr := logsData{
+			ResourceLogs: rls,
+		}
+		pData := lr.marshalProtobuf(nil)
+
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := pushProtobufRequest(pData, tlp, nil, false, &attributesOptions{}); err != nil {
+			t.Fatalf("unexpected error when parsing protobuf data: %s", err)
+		}
+		if err := tlp.Verify([]int64{1234, 1235, 1236, 1237, 1238, 1239}, resultExpected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// level field is disabled
+	f("", true, `{"_msg":"foo","severity":"Trace3"}
+{"_msg":"foo","severity":"INFO"}
+{"_msg":"foo","severity":"Warning"}
+{"_msg":"foo","severity":"Error4"}
+{"_msg":"foo","severity":"crit"}
+{"_msg":"foo","severity":"unknown"}`)
+
+	// level field is enabled
+	f("level", false, `{"_msg":"foo","severity":"Trace3","level":"trace"}
+{"_msg":"foo","severity":"INFO","level":"info"}
+{"_msg":"foo","severity":"Warning","level":"warn"}
+{"_msg":"foo","severity":"Error4","level":"error"}
+{"_msg":"foo","severity":"crit","level":"fatal"}
+{"_msg":"foo","severity":"unknown"}`)
+
+	// level field is enabled and the severity field is dropped
+	f("level", true, `{"_msg":"foo","level":"trace"}
+{"_msg":"foo","level":"info"}
+{"_msg":"foo","level":"warn"}
+{"_msg":"foo","level":"error"}
+{"_msg":"foo","level":"fatal"}
+{"_msg":"foo","severity":"unknown"}`)
+}
+
+func TestDecodeLogsDataAttributesOptions(t *testing.T) {
+	data := `[{
+		"resource": {
+			"attributes": [
+				{"key":"host","value":{"stringValue":"h1"}},
+				{"key":"service.name","value":{"stringValue":"svc"}},
+				{"key":"process.pid","value":{"intValue":123}},
+				{"key":"k8s","value":{"keyValueList":{"values":[{"key":"pod","value":{"stringValue":"p1"}}]}}}
+			]
+		},
+		"scopeLogs": [{
+			"scope": {
+				"name": "foo",
+				"attributes": [
+					{"key":"x","value":{"stringValue":"aaa"}},
+					{"key":"y","value":{"stringValue":"bbb"}}
+				]
+			},
+			"logRecords": [
+				{"timeUnixNano":1234,"eventName":"ev","body":{"stringValue":"msg1"},"attributes":[{"key":"host","value":{"stringValue":"h2"}}]},
+				{"timeUnixNano":1235,"body":{"stringValue":"msg2"}}
+			]
+		}]
+	}]`
+	var rls []resourceLogs
+	if err := json.Unmarshal([]byte(data), &rls); err != nil {
+		t.Fatalf("unexpected error when parsing JSON: %s", err)
+	}
+	lr := logsData{
+		ResourceLogs: rls,
+	}
+	pData := lr.marshalProtobuf(nil)
+
+	f := func(ao *attributesOptions, resultExpected string) {
+		t.Helper()
+
+		var rows []string
+		pushLogs := func(_ int64, fields []logstorage.Field, streamFieldsLen int) {
+			streamFields := logstorage.MarshalFieldsToJSON(nil, fields[:streamFieldsLen])
+			otherFields := logstorage.MarshalFieldsToJSON(nil, fields[streamFieldsLen:])
+			rows = append(rows, fmt.Sprintf("stream=%s fields=%s", streamFields, otherFields))
+		}
+		if err := decodeLogsData(pData, ao, pushLogs); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := strings.Join(rows, "\n")
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// default options
+	f(&attributesOptions{}, `stream={"host":"h1","service.name":"svc","process.pid":"123","k8s.pod":"p1","event_name":"ev"} fields={"scope.name":"foo","scope.version":"unknown","scope.attributes.x":"aaa","scope.attributes.y":"bbb","_msg":"msg1","host":"h2","severity":"Unspecified"}
+stream={"host":"h1","service.name":"svc","process.pid":"123","k8s.pod":"p1"} fields={"scope.name":"foo","scope.version":"unknown","scope.attributes.x":"aaa","scope.attributes.y":"bbb","_msg":"msg2","severity":"Unspecified"}`)
+
+	// resource attributes prefix
+	f(&attributesOptions{
+		resourceAttributesPrefix: "resource",
+	}, `stream={"resource.host":"h1","resource.service.name":"svc","resource.process.pid":"123","resource.k8s.pod":"p1","event_name":"ev"} fields={"scope.name":"foo","scope.version":"unknown","scope.attributes.x":"aaa","scope.attributes.y":"bbb","_msg":"msg1","host":"h2","severity":"Unspecified"}
+stream={"resource.host":"h1","resource.service.name":"svc","resource.process.pid":"123","resource.k8s.pod":"p1"} fields={"scope.name":"foo","scope.version":"unknown","scope.attributes.x":"aaa","scope.attributes.y":"bbb","_msg":"msg2","severity":"Unspecified"}`)
+
+	// resource and scope attributes allowlists
+	f(&attributesOptions{
+		resourceAttributes: newAttributesFilter([]string{"service.*", "k8s"}),
+		scopeAttributes:    newAttributesFilter([]string{"y"}),
+	}, `stream={"service.name":"svc","k8s.pod":"p1","event_name":"ev"} fields={"scope.name":"foo","scope.version":"unknown","scope.attributes.y":"bbb","_msg":"msg1","host":"h2","severity":"Unspecified"}
+stream={"service.name":"svc","k8s.pod":"p1"} fields={"scope.name":"foo","scope.version":"unknown","scope.attributes.y":"bbb","_msg":"msg2","severity":"Unspecified"}`)
+
+	// stream resource attributes
+	f(&attributesOptions{
+		resourceAttributesPrefix: "resource",
+		resourceAttributes:       newAttributesFilter([]string{"host", "service.name", "process.pid"}),
+		streamResourceAttributes: newAttributesFilter([]string{"service.name", "host"}),
+	}, `stream={"resource.host":"h1","resource.service.name":"svc","event_name":"ev"} fields={"resource.process.pid":"123","scope.name":"foo","scope.version":"unknown","scope.attributes.x":"aaa","scope.attributes.y":"bbb","_msg":"msg1","host":"h2","severity":"Unspecified"}
+stream={"resource.host":"h1","resource.service.name":"svc"} fields={"resource.process.pid":"123","scope.name":"foo","scope.version":"unknown","scope.attributes.x":"aaa","scope.attributes.y":"bbb","_msg":"msg2","severity":"Unspecified"}`)
+}
+
+func TestGetAttributesOptions(t *testing.T) {
+	f := func(requestURI string, header map[string]string, prefixExpected string, resourceAttrsExpected, scopeAttrsExpected, streamResourceAttrsExpected []string) {
+		t.Helper()
+
+		r := httptest.NewRequest("POST", requestURI, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		ao := getAttributesOptions(r)
+		if ao.resourceAttributesPrefix != prefixExpected {
+			t.Fatalf("unexpected resourceAttributesPrefix; got %q; want %q", ao.resourceAttributesPrefix, prefixExpected)
+		}
+		checkFilter := func(name string, f *prefixfilter.Filter, filtersExpected []string) {
+			t.Helper()
+			var filters []string
+			if f != nil {
+				filters = f.GetAllowFilters()
+			}
+			if !reflect.DeepEqual(filters, filtersExpected) {
+				t.Fatalf("unexpected %s; got %q; want %q", name, filters, filtersExpected)
+			}
+		}
+		checkFilter("resourceAttributes", ao.resourceAttributes, resourceAttrsExpected)
+		checkFilter("scopeAttributes", ao.scopeAttributes, scopeAttrsExpected)
+		checkFilter("streamResourceAttributes", ao.streamResourceAttributes, streamResourceAttrsExpected)
+	}
+
+	f("/insert/opentelemetry/v1/logs", nil, "", nil, nil, nil)
+	f("/insert/opentelemetry/v1/logs?resource_attributes_prefix=resource&resource_attributes=host,service.*&scope_attributes=x&stream_resource_attributes=service.name", nil,
+		"resource", []string{"host", "service.*"}, []string{"x"}, []string{"service.name"})
+	f("/insert/opentelemetry/v1/logs", map[string]string{
+		"VL-Resource-Attributes-Prefix": "res",
+		"VL-Stream-Resource-Attributes": "host",
+	}, "res", nil, nil, []string{"host"})
+}
+
+func TestPushProtobufRequestMapBody(t *testing.T) {
+	defer func(prefix string, asJSON bool) {
+		*bodyFieldsPrefix = prefix
+		*mapBodyAsJSON = asJSON
+	}(*bodyFieldsPrefix, *mapBodyAsJSON)
+
+	f := func(prefix string, asJSON bool, resultExpected string) {
+		t.Helper()
+
+		*bodyFieldsPrefix = prefix
+		*mapBodyAsJSON = asJSON
+
+		data := `[{
+			"scopeLogs": [{
+				"logRecords": [
+					{"timeUnixNano":1234,"body":{"keyValueList":{"values":[
+						{"key":"msg","value":{"stringValue":"foo"}},
+						{"key":"user","value":{"keyValueList":{"values":[{"key":"id","value":{"intValue":42}}]}}},
+						{"key":"tags","value":{"arrayValue":{"values":[{"stringValue":"a"},{"boolValue":true}]}}}
+					]}},"attributes":[{"key":"msg","value":{"stringValue":"attr"}}]},
+					{"timeUnixNano":1235,"body":{"stringValue":"bar"}},
+					{"timeUnixNano":1236,"body":{"arrayValue":{"values":[{"intValue":1},{"stringValue":"x"}]}}}
+				]
+			}]
+		}]`
+		var rls []resourceLogs
+		if err := json.Unmarshal([]byte(data), &rls); err != nil {
+			t.Fatalf("unexpected error when parsing JSON: %s", err)
+		}
+		lr := logsData{
+			ResourceLogs: rls,
+		}
+		pData := lr.marshalProtobuf(nil)
+
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := pushProtobufRequest(pData, tlp, nil, false, &attributesOptions{}); err != nil {
+			t.Fatalf("unexpected error when parsing protobuf data: %s", err)
+		}
+		if err := tlp.Verify([]int64{1234, 1235, 1236}, resultExpected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// flatten Map body into top-level fields
+	f("", false, `{"msg":"foo","user.id":"42","tags":"[\"a\",true]","msg":"attr","severity":"Unspecified"}
+{"_msg":"bar","severity":"Unspecified"}
+{"_msg":"[1,\"x\"]","severity":"Unspecified"}`)
+
+	// flatten Map body into prefixed fields
+	f("body", false, `{"body.msg":"foo","body.user.id":"42","body.tags":"[\"a\",true]","msg":"attr","severity":"Unspecified"}
+{"_msg":"bar","severity":"Unspecified"}
+{"_msg":"[1,\"x\"]","severity":"Unspecified"}`)
+
+	// store Map body as JSON
+	f("body", true, `{"_msg":"{\"msg\":\"foo\",\"user\":{\"id\":42},\"tags\":[\"a\",true]}","msg":"attr","severity":"Unspecified"}
+{"_msg":"bar","severity":"Unspecified"}
+{"_msg":"[1,\"x\"]","severity":"Unspecified"}`)
+}
+
+func TestGetNormalizedLevel(t *testing.T) {
+	f := func(severityNumber int32, severityText, levelExpected string) {
+		t.Helper()
+
+		level := getNormalizedLevel(severityNumber, severityText)
+		if level != levelExpected {
+			t.Fatalf("unexpected level for severityNumber=%d, severityText=%q; got %q; want %q", severityNumber, severityText, level, levelExpected)
+		}
+	}
+
+	// unknown level
+	f(0, "", "")
+	f(0, "foo", "")
+	f(-1, "", "")
+	f(25, "", "")
+
+	// severity number
+	f(1, "", "trace")
+	f(4, "", "trace")
+	f(5, "", "debug")
+	f(9, "", "info")
+	f(13, "", "warn")
+	f(17, "", "error")
+	f(21, "", "fatal")
+	f(24, "", "fatal")
+
+	// severity number has priority over severity text
+	f(9, "error", "info")
+
+	// severity text
+	f(0, "TRACE", "trace")
+	f(0, "Debug", "debug")
+	f(0, "info", "info")
+	f(0, "Notice", "info")
+	f(0, "WARNING", "warn")
+	f(0, "warn", "warn")
+	f(0, "ERROR", "error")
+	f(0, "err", "error")
+	f(0, "critical", "fatal")
+	f(0, "alert", "fatal")
+	f(0, "emerg", "fatal")
+	f(0, "FATAL", "fatal")
+	f(0, "panic", "fatal")
+}
+
 var mp easyproto.MarshalerPool
 
 // logsData represents the corresponding OTEL protobuf message.
@@ -556,6 +902,7 @@ type logRecord struct {
 	SeverityText   string      `json:"severityText,omitzero"`
 	Body           anyValue    `json:"body"`
 	Attributes     []*keyValue `json:"attributes,omitzero"`
+	Flags          uint32      `json:"flags,omitzero"`
 	TraceID        string      `json:"traceID,omitzero"`
 	SpanID         string      `json:"spanID,omitzero"`
 	EventName      string      `json:"eventName,omitzero"`
@@ -570,6 +917,8 @@ func (lr *logRecord) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 		a.marshalProtobuf(mm.AppendMessage(6))
 	}
 
+	mm.AppendFixed32(8, lr.Flags)
+
 	traceID, err := hex.DecodeString(lr.TraceID)
 	if err != nil {
 		traceID = []byte(lr.TraceID)
@@ -586,3 +935,55 @@ func (lr *logRecord) marshalProtobuf(mm *easyproto.MessageMarshaler) {
 
 	mm.AppendString(12, lr.EventName)
 }
+
+func FuzzPushProtobufRequest(f *testing.F) {
+	seeds := []string{
+		`[]`,
+		`[{"scopeLogs":[{"logRecords":[{"timeUnixNano":1234,"severityNumber":1,"body":{"stringValue":"log-line-message"}}]}]}]`,
+		`[{
+			"resource": {
+				"attributes": [
+					{"key":"service.name","value":{"stringValue":"foo"}},
+					{"key":"int","value":{"intValue":-123}},
+					{"key":"float","value":{"doubleValue":1.5}},
+					{"key":"bool","value":{"boolValue":true}},
+					{"key":"bytes","value":{"bytesValue":"AQID"}},
+					{"key":"array","value":{"arrayValue":{"values":[{"stringValue":"a"},{"intValue":1}]}}},
+					{"key":"kvlist","value":{"keyValueList":{"values":[{"key":"a","value":{"stringValue":"b"}}]}}}
+				]
+			},
+			"scopeLogs": [{
+				"scope": {"name":"scope","version":"1.0","attributes":[{"key":"x","value":{"stringValue":"y"}}]},
+				"logRecords": [{
+					"timeUnixNano": 1234,
+					"observedTimeUnixNano": 5678,
+					"severityNumber": 9,
+					"severityText": "INFO",
+					"traceId": "0102030405060708090a0b0c0d0e0f10",
+					"spanId": "0102030405060708",
+					"body": {"keyValueList":{"values":[{"key":"msg","value":{"stringValue":"foo"}}]}},
+					"attributes": [{"key":"a","value":{"arrayValue":{"values":[{"arrayValue":{"values":[]}}]}}}]
+				}]
+			}]
+		}]`,
+	}
+	for _, seed := range seeds {
+		var rls []resourceLogs
+		dec := json.NewDecoder(strings.NewReader(seed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rls); err != nil {
+			f.Fatalf("cannot parse seed %s: %s", seed, err)
+		}
+		lr := logsData{
+			ResourceLogs: rls,
+		}
+		f.Add(lr.marshalProtobuf(nil))
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0x0f})
+
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		tlp := &insertutil.TestLogMessageProcessor{}
+		_ = pushProtobufRequest(data, tlp, []string{"msg"}, false, &attributesOptions{})
+	})
+}
@@ -27,7 +27,7 @@ func benchmarkPushProtobufRequest(b *testing.B, streams, rows, labels int) {
 	b.SetBytes(int64(len(body)))
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			if err := pushProtobufRequest(body, blp, nil, false); err != nil {
+			if err := pushProtobufRequest(body, blp, nil, false, &attributesOptions{}); err != nil {
 				panic(fmt.Errorf("unexpected error: %w", err))
 			}
 		}
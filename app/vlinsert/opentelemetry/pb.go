@@ -3,6 +3,7 @@ package opentelemetry
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
@@ -18,7 +19,7 @@ type pushLogsHandler func(timestamp int64, fields []logstorage.Field, streamFiel
 // decodeLogsData parses a LogsData protobuf message from src and calls the provided pushLogs for each decoded log record.
 //
 // See https://github.com/open-telemetry/opentelemetry-proto/blob/a5f0eac5b802f7ae51dfe41e5116fe5548955e64/opentelemetry/proto/logs/v1/logs.proto#L38
-func decodeLogsData(src []byte, pushLogs pushLogsHandler) (err error) {
+func decodeLogsData(src []byte, ao *attributesOptions, pushLogs pushLogsHandler) (err error) {
 	// message LogsData {
 	//   repeated ResourceLogs resource_logs = 1;
 	// }
@@ -36,7 +37,7 @@ func decodeLogsData(src []byte, pushLogs pushLogsHandler) (err error) {
 				return fmt.Errorf("cannot read ResourceLogs data")
 			}
 
-			if err := decodeResourceLogs(data, pushLogs); err != nil {
+			if err := decodeResourceLogs(data, ao, pushLogs); err != nil {
 				return fmt.Errorf("cannot decode ResourceLogs: %w", err)
 			}
 		}
@@ -44,7 +45,7 @@ func decodeLogsData(src []byte, pushLogs pushLogsHandler) (err error) {
 	return nil
 }
 
-func decodeResourceLogs(src []byte, pushLogs pushLogsHandler) (err error) {
+func decodeResourceLogs(src []byte, ao *attributesOptions, pushLogs pushLogsHandler) (err error) {
 	// message ResourceLogs {
 	//   Resource resource = 1;
 	//   repeated ScopeLogs scope_logs = 2;
@@ -66,13 +67,15 @@ func decodeResourceLogs(src []byte, pushLogs pushLogsHandler) (err error) {
 	if err != nil {
 		return fmt.Errorf("cannot find Resource: %w", err)
 	}
+	streamFieldsLen := 0
 	if ok {
-		if err = decodeResource(resourceData, fs, fb); err != nil {
+		streamFieldsLen, err = decodeResource(resourceData, fs, fb, ao)
+		if err != nil {
 			return fmt.Errorf("cannot decode Resource: %w", err)
 		}
 	}
 
-	streamFieldsLen := len(fs.Fields)
+	resourceFieldsLen := len(fs.Fields)
 	fbLen := len(fb.buf)
 
 	// Decode scope_logs
@@ -89,11 +92,11 @@ func decodeResourceLogs(src []byte, pushLogs pushLogsHandler) (err error) {
 				return fmt.Errorf("cannot read ScopeLogs data")
 			}
 
-			if err := decodeScopeLogs(data, fs, fb, pushLogs); err != nil {
+			if err := decodeScopeLogs(data, fs, fb, streamFieldsLen, ao, pushLogs); err != nil {
 				return fmt.Errorf("cannot decode ScopeLogs: %w", err)
 			}
 
-			fs.Fields = fs.Fields[:streamFieldsLen]
+			fs.Fields = fs.Fields[:resourceFieldsLen]
 			fb.buf = fb.buf[:fbLen]
 		}
 	}
@@ -101,11 +104,32 @@ func decodeResourceLogs(src []byte, pushLogs pushLogsHandler) (err error) {
 	return nil
 }
 
-func decodeResource(src []byte, fs *logstorage.Fields, fb *fmtBuffer) (err error) {
+// decodeResource decodes resource attributes from src and adds them to fs.
+//
+// Resource attributes, which must be used as log stream fields, are added in front of the remaining attributes.
+// The number of these attributes is returned.
+func decodeResource(src []byte, fs *logstorage.Fields, fb *fmtBuffer, ao *attributesOptions) (int, error) {
 	// message Resource {
 	//   repeated KeyValue attributes = 1;
 	// }
 
+	if err := decodeResourceAttributes(src, fs, fb, ao, true); err != nil {
+		return 0, err
+	}
+	streamFieldsLen := len(fs.Fields)
+	if ao.streamResourceAttributes != nil {
+		if err := decodeResourceAttributes(src, fs, fb, ao, false); err != nil {
+			return 0, err
+		}
+	}
+	return streamFieldsLen, nil
+}
+
+// decodeResourceAttributes adds resource attributes from src to fs.
+//
+// Only attributes matching ao.streamResourceAttributes are added if isStream is set.
+// Only attributes not matching ao.streamResourceAttributes are added otherwise.
+func decodeResourceAttributes(src []byte, fs *logstorage.Fields, fb *fmtBuffer, ao *attributesOptions, isStream bool) (err error) {
 	var fc easyproto.FieldContext
 	for len(src) > 0 {
 		src, err = fc.NextField(src)
@@ -119,7 +143,17 @@ func decodeResource(src []byte, fs *logstorage.Fields, fb *fmtBuffer) (err error
 				return fmt.Errorf("cannot read Attributes data")
 			}
 
-			if err := decodeKeyValue(data, fs, fb, ""); err != nil {
+			if ao.resourceAttributes != nil || ao.streamResourceAttributes != nil {
+				key, err := getKeyValueKey(data)
+				if err != nil {
+					return err
+				}
+				if !matchAttribute(ao.resourceAttributes, key) || (isStream != matchAttribute(ao.streamResourceAttributes, key)) {
+					continue
+				}
+			}
+
+			if err := decodeKeyValue(data, fs, fb, ao.resourceAttributesPrefix); err != nil {
 				return fmt.Errorf("cannot decode Attributes: %w", err)
 			}
 		}
@@ -127,20 +161,18 @@ func decodeResource(src []byte, fs *logstorage.Fields, fb *fmtBuffer) (err error
 	return nil
 }
 
-func decodeScopeLogs(src []byte, fs *logstorage.Fields, fb *fmtBuffer, pushLogs pushLogsHandler) (err error) {
+func decodeScopeLogs(src []byte, fs *logstorage.Fields, fb *fmtBuffer, streamFieldsLen int, ao *attributesOptions, pushLogs pushLogsHandler) (err error) {
 	// message ScopeLogs {
 	//   InstrumentationScope scope = 1;
 	//   repeated LogRecord log_records = 2;
 	// }
 
-	streamFieldsLen := len(fs.Fields)
-
 	scopeData, ok, err := easyproto.GetMessageData(src, 1)
 	if err != nil {
 		return fmt.Errorf("cannot read InstrumentationScope: %w", err)
 	}
 	if ok {
-		if err := decodeInstrumentationScope(scopeData, fs, fb); err != nil {
+		if err := decodeInstrumentationScope(scopeData, fs, fb, ao); err != nil {
 			return fmt.Errorf("cannot decode InstrumentationScope: %w", err)
 		}
 	}
@@ -191,7 +223,7 @@ func decodeScopeLogs(src []byte, fs *logstorage.Fields, fb *fmtBuffer, pushLogs
 	return nil
 }
 
-func decodeInstrumentationScope(src []byte, fs *logstorage.Fields, fb *fmtBuffer) error {
+func decodeInstrumentationScope(src []byte, fs *logstorage.Fields, fb *fmtBuffer, ao *attributesOptions) error {
 	// See https://github.com/open-telemetry/opentelemetry-proto/blob/a5f0eac5b802f7ae51dfe41e5116fe5548955e64/opentelemetry/proto/common/v1/common.proto#L76
 	//
 	// message InstrumentationScope {
@@ -232,6 +264,15 @@ func decodeInstrumentationScope(src []byte, fs *logstorage.Fields, fb *fmtBuffer
 			if !ok {
 				return fmt.Errorf("cannot read Attributes data")
 			}
+			if ao.scopeAttributes != nil {
+				key, err := getKeyValueKey(attributesData)
+				if err != nil {
+					return err
+				}
+				if !matchAttribute(ao.scopeAttributes, key) {
+					continue
+				}
+			}
 			if err := decodeKeyValue(attributesData, fs, fb, "scope.attributes"); err != nil {
 				return fmt.Errorf("cannot decode Attributes: %w", err)
 			}
@@ -251,6 +292,7 @@ func decodeLogRecord(src []byte, fs *logstorage.Fields, fb *fmtBuffer) (string,
 	//   string severity_text = 3;
 	//   AnyValue body = 5;
 	//   repeated KeyValue attributes = 6;
+	//   fixed32 flags = 8;
 	//   bytes trace_id = 9;
 	//   bytes span_id = 10;
 	//   string event_name = 12;
@@ -298,7 +340,7 @@ func decodeLogRecord(src []byte, fs *logstorage.Fields, fb *fmtBuffer) (string,
 			if !ok {
 				return "", 0, fmt.Errorf("cannot read Body")
 			}
-			if err := decodeAnyValue(body, fs, fb, ""); err != nil {
+			if err := decodeBody(body, fs, fb); err != nil {
 				return "", 0, fmt.Errorf("cannot decode Body: %w", err)
 			}
 		case 6:
@@ -309,20 +351,35 @@ func decodeLogRecord(src []byte, fs *logstorage.Fields, fb *fmtBuffer) (string,
 			if err := decodeKeyValue(attributesData, fs, fb, ""); err != nil {
 				return "", 0, fmt.Errorf("cannot decode Attributes: %w", err)
 			}
+		case 8:
+			flags, ok := fc.Fixed32()
+			if !ok {
+				return "", 0, fmt.Errorf("cannot read flags")
+			}
+			if *traceFlagsField != "" && flags != 0 {
+				// The lower 8 bits contain W3C trace flags. They are stored as two hex digits in the same way as in the traceparent header.
+				// See https://opentelemetry.io/docs/specs/otel/logs/data-model/#field-traceflags
+				traceFlagsHex := fb.formatHex([]byte{byte(flags)})
+				fs.Add(*traceFlagsField, traceFlagsHex)
+			}
 		case 9:
 			traceID, ok := fc.Bytes()
 			if !ok {
 				return "", 0, fmt.Errorf("cannot read trace id")
 			}
-			traceIDHex := fb.formatHex(traceID)
-			fs.Add("trace_id", traceIDHex)
+			if *traceIDField != "" {
+				traceIDHex := fb.formatHex(traceID)
+				fs.Add(*traceIDField, traceIDHex)
+			}
 		case 10:
 			spanID, ok := fc.Bytes()
 			if !ok {
 				return "", 0, fmt.Errorf("cannot read span id")
 			}
-			spanIDHex := fb.formatHex(spanID)
-			fs.Add("span_id", spanIDHex)
+			if *spanIDField != "" {
+				spanIDHex := fb.formatHex(spanID)
+				fs.Add(*spanIDField, spanIDHex)
+			}
 		case 12:
 			eventName, ok = fc.String()
 			if !ok {
@@ -331,10 +388,19 @@ func decodeLogRecord(src []byte, fs *logstorage.Fields, fb *fmtBuffer) (string,
 		}
 	}
 
-	if severityText == "" {
-		severityText = formatSeverity(severityNumber)
+	level := ""
+	if *levelField != "" {
+		level = getNormalizedLevel(severityNumber, severityText)
+	}
+	if level == "" || !*dropSeverity {
+		if severityText == "" {
+			severityText = formatSeverity(severityNumber)
+		}
+		fs.Add("severity", severityText)
+	}
+	if level != "" {
+		fs.Add(*levelField, level)
 	}
-	fs.Add("severity", severityText)
 
 	var timestamp int64
 	switch {
@@ -349,6 +415,53 @@ func decodeLogRecord(src []byte, fs *logstorage.Fields, fb *fmtBuffer) (string,
 	return eventName, timestamp, nil
 }
 
+// getKeyValueKey returns the key from KeyValue message at src.
+func getKeyValueKey(src []byte) (string, error) {
+	key, _, err := easyproto.GetString(src, 1)
+	if err != nil {
+		return "", fmt.Errorf("cannot find Key in KeyValue: %w", err)
+	}
+	return key, nil
+}
+
+// decodeBody decodes log record body from src and adds it to fs.
+//
+// Body of Map type is stored either as separate fields with -opentelemetry.bodyFieldsPrefix or as JSON object in the _msg field
+// depending on -opentelemetry.mapBodyAsJSON. Bodies of other types are stored in the _msg field.
+func decodeBody(src []byte, fs *logstorage.Fields, fb *fmtBuffer) error {
+	// message AnyValue {
+	//   oneof value {
+	//     ...
+	//     KeyValueList kvlist_value = 6;
+	//     ...
+	//   }
+	// }
+	kvlistData, ok, err := easyproto.GetMessageData(src, 6)
+	if err != nil {
+		return fmt.Errorf("cannot read KeyValueList: %w", err)
+	}
+	if !ok {
+		return decodeAnyValue(src, fs, fb, "")
+	}
+
+	if !*mapBodyAsJSON {
+		if err := decodeKeyValueList(kvlistData, fs, fb, *bodyFieldsPrefix); err != nil {
+			return fmt.Errorf("cannot decode KeyValueList: %w", err)
+		}
+		return nil
+	}
+
+	a := jsonArenaPool.Get()
+	defer jsonArenaPool.Put(a)
+
+	obj, err := decodeKeyValueListToJSON(kvlistData, a, fb)
+	if err != nil {
+		return fmt.Errorf("cannot decode KeyValueList: %w", err)
+	}
+	fs.Add("", fb.encodeJSONValue(obj))
+	return nil
+}
+
 func decodeKeyValue(src []byte, fs *logstorage.Fields, fb *fmtBuffer, fieldNamePrefix string) error {
 	// message KeyValue {
 	//   string key = 1;
@@ -500,6 +613,53 @@ func formatSeverity(severity int32) string {
 	return logSeverities[severity]
 }
 
+// getNormalizedLevel returns normalized log level - trace, debug, info, warn, error or fatal - for the given severityNumber and severityText.
+//
+// severityText is used only if severityNumber is unspecified. It may contain syslog severities such as crit or notice.
+// An empty string is returned if the level cannot be determined.
+//
+// See https://opentelemetry.io/docs/specs/otel/logs/data-model/#field-severitynumber
+func getNormalizedLevel(severityNumber int32, severityText string) string {
+	if severityNumber > 0 && severityNumber < int32(len(logSeverities)) {
+		return normalizedLevels[(severityNumber-1)/4]
+	}
+	for _, lp := range levelPrefixes {
+		if len(severityText) >= len(lp.prefix) && strings.EqualFold(severityText[:len(lp.prefix)], lp.prefix) {
+			return lp.level
+		}
+	}
+	return ""
+}
+
+var normalizedLevels = []string{
+	"trace",
+	"debug",
+	"info",
+	"warn",
+	"error",
+	"fatal",
+}
+
+// levelPrefixes maps severity text prefixes to normalized levels.
+//
+// Syslog severities are mapped in the same way as OpenTelemetry Collector does.
+var levelPrefixes = []struct {
+	prefix string
+	level  string
+}{
+	{"trace", "trace"},
+	{"debug", "debug"},
+	{"info", "info"},
+	{"notice", "info"},
+	{"warn", "warn"},
+	{"err", "error"},
+	{"crit", "fatal"},
+	{"alert", "fatal"},
+	{"emerg", "fatal"},
+	{"fatal", "fatal"},
+	{"panic", "fatal"},
+}
+
 // See https://github.com/open-telemetry/opentelemetry-collector/blob/a0cbea73c189551d751d09659e306f48f594fd62/pdata/plog/severity_number.go#L41
 var logSeverities = []string{
 	"Unspecified",
@@ -0,0 +1,245 @@
+package pubsub
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// googleIssuers contains valid issuers for OIDC tokens sent by Pub/Sub push subscriptions.
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// maxClockSkew is the maximum allowed clock skew when verifying token expiration time.
+const maxClockSkew = time.Minute
+
+// tokenVerifier verifies OIDC tokens sent by Pub/Sub push subscriptions with enabled authentication.
+//
+// See https://cloud.google.com/pubsub/docs/authenticate-push-subscriptions
+type tokenVerifier struct {
+	audiences []string
+	emails    []string
+	keys      *keySet
+}
+
+// tokenHeader is JWT header.
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// tokenClaims contains JWT claims sent by Pub/Sub.
+type tokenClaims struct {
+	Iss           string          `json:"iss"`
+	Aud           json.RawMessage `json:"aud"`
+	Exp           int64           `json:"exp"`
+	Email         string          `json:"email"`
+	EmailVerified bool            `json:"email_verified"`
+}
+
+// audiences returns audiences from aud claim, which may be either a string or an array of strings.
+func (tc *tokenClaims) audiences() []string {
+	var s string
+	if err := json.Unmarshal(tc.Aud, &s); err == nil {
+		return []string{s}
+	}
+	var a []string
+	if err := json.Unmarshal(tc.Aud, &a); err == nil {
+		return a
+	}
+	return nil
+}
+
+// verify verifies the given token and returns an error if it is invalid.
+func (tv *tokenVerifier) verify(token string, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("unexpected number of JWT parts; got %d; want 3", len(parts))
+	}
+
+	var hdr tokenHeader
+	if err := unmarshalTokenPart(parts[0], &hdr); err != nil {
+		return fmt.Errorf("cannot parse JWT header: %w", err)
+	}
+	if hdr.Alg != "RS256" {
+		return fmt.Errorf("unsupported JWT algorithm %q; want RS256", hdr.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("cannot decode JWT signature: %w", err)
+	}
+	key, err := tv.keys.getKey(hdr.Kid, now)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig); err != nil {
+		return fmt.Errorf("invalid JWT signature: %w", err)
+	}
+
+	var claims tokenClaims
+	if err := unmarshalTokenPart(parts[1], &claims); err != nil {
+		return fmt.Errorf("cannot parse JWT claims: %w", err)
+	}
+	if !slices.Contains(googleIssuers, claims.Iss) {
+		return fmt.Errorf("unexpected JWT issuer %q", claims.Iss)
+	}
+	if now.After(time.Unix(claims.Exp, 0).Add(maxClockSkew)) {
+		return fmt.Errorf("JWT has been expired at %s", time.Unix(claims.Exp, 0).UTC().Format(time.RFC3339))
+	}
+	auds := claims.audiences()
+	if !slices.ContainsFunc(auds, func(aud string) bool {
+		return slices.Contains(tv.audiences, aud)
+	}) {
+		return fmt.Errorf("unexpected JWT audience %q; see -pubsub.audience", auds)
+	}
+	if len(tv.emails) > 0 {
+		if !claims.EmailVerified || !slices.Contains(tv.emails, claims.Email) {
+			return fmt.Errorf("unexpected JWT email %q; see -pubsub.serviceAccountEmail", claims.Email)
+		}
+	}
+	return nil
+}
+
+func unmarshalTokenPart(s string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// keySet holds public keys for verifying JWT signatures, which are obtained from JWKS url.
+type keySet struct {
+	url string
+	hc  *http.Client
+
+	// mu protects the fields below
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchTime time.Time
+}
+
+const (
+	// keySetRefreshInterval is the interval for refreshing the keys from JWKS url.
+	keySetRefreshInterval = time.Hour
+
+	// keySetMinRefreshInterval is the minimum interval between refreshes when a token with unknown key id is received.
+	keySetMinRefreshInterval = 10 * time.Second
+)
+
+func newKeySet(url string) *keySet {
+	return &keySet{
+		url: url,
+		hc: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// getKey returns the public key with the given kid.
+//
+// The keys are re-fetched from ks.url if they are outdated or if the kid is missing.
+func (ks *keySet) getKey(kid string, now time.Time) (*rsa.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key := ks.keys[kid]
+	age := now.Sub(ks.fetchTime)
+	if (key != nil && age < keySetRefreshInterval) || (key == nil && age < keySetMinRefreshInterval) {
+		if key == nil {
+			return nil, fmt.Errorf("cannot find JWT key with kid=%q at %s", kid, ks.url)
+		}
+		return key, nil
+	}
+
+	keys, err := ks.fetchKeys()
+	if err != nil {
+		if key != nil {
+			// Use the previously fetched key if the JWKS url is temporarily unavailable
+			// and retry fetching the keys after keySetMinRefreshInterval.
+			ks.fetchTime = now.Add(keySetMinRefreshInterval - keySetRefreshInterval)
+			return key, nil
+		}
+		return nil, err
+	}
+	ks.keys = keys
+	ks.fetchTime = now
+
+	key = keys[kid]
+	if key == nil {
+		return nil, fmt.Errorf("cannot find JWT key with kid=%q at %s", kid, ks.url)
+	}
+	return key, nil
+}
+
+func (ks *keySet) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	resp, err := ks.hc.Get(ks.url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch JWT keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read JWT keys from %s: %w", ks.url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code when fetching JWT keys from %s: %d; response: %q", ks.url, resp.StatusCode, data)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse JWT keys from %s: %w", ks.url, err)
+	}
+	return keys, nil
+}
+
+// parseJWKS parses RSA public keys from JSON Web Key Set.
+//
+// See https://datatracker.ietf.org/doc/html/rfc7517#section-5
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode modulus for kid=%q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode exponent for kid=%q: %w", k.Kid, err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() <= 1 || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent for kid=%q", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exp.Int64()),
+		}
+	}
+	return keys, nil
+}
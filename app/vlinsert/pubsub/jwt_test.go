@@ -0,0 +1,141 @@
+package pubsub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate RSA key: %s", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate RSA key: %s", err)
+	}
+
+	var fetches atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"key1","alg":"RS256","n":%q,"e":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()), base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	}))
+	defer srv.Close()
+
+	tv := &tokenVerifier{
+		audiences: []string{"https://logs.example.com/insert/pubsub/push"},
+		emails:    []string{"pusher@project.iam.gserviceaccount.com"},
+		keys:      newKeySet(srv.URL),
+	}
+	now := time.Unix(1700000000, 0)
+
+	validClaims := map[string]any{
+		"iss":            "https://accounts.google.com",
+		"aud":            "https://logs.example.com/insert/pubsub/push",
+		"exp":            now.Unix() + 3600,
+		"email":          "pusher@project.iam.gserviceaccount.com",
+		"email_verified": true,
+	}
+	withClaim := func(name string, value any) map[string]any {
+		m := make(map[string]any, len(validClaims))
+		for k, v := range validClaims {
+			m[k] = v
+		}
+		m[name] = value
+		return m
+	}
+
+	f := func(token string, resultExpected bool) {
+		t.Helper()
+
+		err := tv.verify(token, now)
+		if resultExpected && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !resultExpected && err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// valid token
+	f(signToken(t, key, "RS256", "key1", validClaims), true)
+	f(signToken(t, key, "RS256", "key1", withClaim("aud", []string{"foo", "https://logs.example.com/insert/pubsub/push"})), true)
+	f(signToken(t, key, "RS256", "key1", withClaim("iss", "accounts.google.com")), true)
+
+	// invalid signature
+	f(signToken(t, otherKey, "RS256", "key1", validClaims), false)
+
+	// unknown key id
+	f(signToken(t, key, "RS256", "key2", validClaims), false)
+
+	// unsupported algorithm
+	f(signToken(t, key, "HS256", "key1", validClaims), false)
+
+	// invalid claims
+	f(signToken(t, key, "RS256", "key1", withClaim("aud", "https://other.example.com")), false)
+	f(signToken(t, key, "RS256", "key1", withClaim("iss", "https://evil.example.com")), false)
+	f(signToken(t, key, "RS256", "key1", withClaim("exp", now.Unix()-3600)), false)
+	f(signToken(t, key, "RS256", "key1", withClaim("email", "other@project.iam.gserviceaccount.com")), false)
+	f(signToken(t, key, "RS256", "key1", withClaim("email_verified", false)), false)
+
+	// malformed token
+	f("", false)
+	f("foo.bar", false)
+	f("foo.bar.baz", false)
+
+	// The keys must be fetched once, since the unknown key id doesn't trigger re-fetching during keySetMinRefreshInterval.
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("unexpected number of JWKS fetches; got %d; want 1", n)
+	}
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, alg, kid string, claims map[string]any) string {
+	t.Helper()
+
+	hdr, err := json.Marshal(map[string]string{
+		"alg": alg,
+		"kid": kid,
+		"typ": "JWT",
+	})
+	if err != nil {
+		t.Fatalf("cannot marshal JWT header: %s", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("cannot marshal JWT claims: %s", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatalf("cannot sign JWT: %s", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestParseJWKSFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		if _, err := parseJWKS([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f(`foo`)
+	f(`{"keys":[{"kty":"RSA","kid":"a","n":"!!!","e":"AQAB"}]}`)
+	f(`{"keys":[{"kty":"RSA","kid":"a","n":"AQAB","e":"!!!"}]}`)
+	f(`{"keys":[{"kty":"RSA","kid":"a","n":"AQAB","e":"AQ"}]}`)
+}
@@ -0,0 +1,281 @@
+package pubsub
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	audiences = flagutil.NewArrayString("pubsub.audience", "Optional list of allowed audiences for OIDC tokens sent by Google Cloud Pub/Sub push subscriptions "+
+		"in 'Authorization: Bearer <token>' header. Tokens aren't verified if this flag isn't set. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#google-cloud-pubsub")
+	serviceAccountEmails = flagutil.NewArrayString("pubsub.serviceAccountEmail", "Optional list of allowed service account emails for OIDC tokens sent by Google Cloud Pub/Sub push subscriptions. "+
+		"It is used only if -pubsub.audience is set. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#google-cloud-pubsub")
+	jwksURL = flag.String("pubsub.jwksURL", "https://www.googleapis.com/oauth2/v3/certs", "URL for obtaining public keys for verifying OIDC tokens "+
+		"sent by Google Cloud Pub/Sub push subscriptions. It is used only if -pubsub.audience is set")
+	streamFields = flagutil.NewArrayString("pubsub.streamFields", "Comma-separated list of fields to use as log stream fields for logs ingested via Google Cloud Pub/Sub push subscriptions. "+
+		"By default pubsub.subscription, logName and resource.type fields are used. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#google-cloud-pubsub")
+
+	maxRequestSize = flagutil.NewBytes("pubsub.maxRequestSize", 16*1024*1024, "The maximum size in bytes of a single Google Cloud Pub/Sub push request")
+)
+
+// defaultStreamFields contains the log stream fields for logs ingested via Pub/Sub push subscriptions if neither -pubsub.streamFields nor _stream_fields are set.
+//
+// logName and resource.type fields are set for Google Cloud Logging entries routed via Pub/Sub log sinks.
+var defaultStreamFields = []string{"pubsub.subscription", "logName", "resource.type"}
+
+// defaultMsgFields contains the fields to use as _msg field for Google Cloud Logging entries if _msg_field isn't set.
+var defaultMsgFields = []string{"textPayload", "jsonPayload.message", "message", "_msg"}
+
+// defaultTimeFields contains the fields to use as _time field for Google Cloud Logging entries if _time_field isn't set.
+//
+// The publish time of Pub/Sub message is used if these fields are missing.
+var defaultTimeFields = []string{"timestamp", "_time", "pubsub.publish_time"}
+
+// RequestHandler processes Google Cloud Pub/Sub push requests.
+//
+// See https://cloud.google.com/pubsub/docs/push
+func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
+	switch path {
+	case "/insert/pubsub/push":
+		handlePush(w, r)
+		return true
+	default:
+		return false
+	}
+}
+
+func handlePush(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	pushRequestsTotal.Inc()
+
+	if len(*audiences) > 0 {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			authErrorsTotal.Inc()
+			httpserver.Errorf(w, r, "%s", &httpserver.ErrorWithStatusCode{
+				Err:        fmt.Errorf("missing 'Authorization: Bearer <token>' header; it is required when -pubsub.audience is set"),
+				StatusCode: http.StatusUnauthorized,
+			})
+			return
+		}
+		if err := getTokenVerifier().verify(token, time.Now()); err != nil {
+			authErrorsTotal.Inc()
+			httpserver.Errorf(w, r, "%s", &httpserver.ErrorWithStatusCode{
+				Err:        fmt.Errorf("cannot verify Pub/Sub token: %w", err),
+				StatusCode: http.StatusForbidden,
+			})
+			return
+		}
+	}
+
+	// Prevent from consuming the request body by form parsing when reading query args,
+	// since the request may be sent with 'Content-Type: application/x-www-form-urlencoded' header.
+	r.PostForm = url.Values{}
+
+	cp, err := insertutil.GetCommonParams(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if len(cp.StreamFields) == 0 {
+		cp.StreamFields = *streamFields
+		if len(cp.StreamFields) == 0 {
+			cp.StreamFields = defaultStreamFields
+		}
+	}
+	if len(cp.MsgFields) == 0 {
+		cp.MsgFields = defaultMsgFields
+	}
+	if !cp.IsTimeFieldSet {
+		cp.TimeFields = defaultTimeFields
+	}
+
+	if err := insertutil.CanWriteData(); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	encoding := r.Header.Get("Content-Encoding")
+	im := cp.GetIngestionMetrics("pubsub")
+	err = insertutil.ReadUncompressedData("pubsub", im.NewReceivedBytesReader(r.Body), encoding, maxRequestSize, func(data []byte) error {
+		im.AddUncompressedBytes(len(data))
+		lmp := cp.NewLogMessageProcessor("pubsub", false)
+		err := readPushMessage(data, cp, lmp)
+		lmp.MustClose()
+		if err != nil {
+			im.AddParseErrors(1)
+		}
+		return err
+	})
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse Pub/Sub push request: %s", err)
+		return
+	}
+	if drr := cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return
+	}
+
+	// update pushRequestDuration only for successfully parsed requests
+	// There is no need in updating pushRequestDuration for request errors,
+	// since their timings are usually much smaller than the timing for successful request parsing.
+	pushRequestDuration.UpdateDuration(startTime)
+
+	// Pub/Sub treats 204 response as message acknowledgement.
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var (
+	tokenVerifierOnce sync.Once
+	tokenVerifierV    *tokenVerifier
+)
+
+func getTokenVerifier() *tokenVerifier {
+	tokenVerifierOnce.Do(func() {
+		tokenVerifierV = &tokenVerifier{
+			audiences: *audiences,
+			emails:    *serviceAccountEmails,
+			keys:      newKeySet(*jwksURL),
+		}
+		logger.Infof("verifying OIDC tokens for Pub/Sub push requests with -pubsub.audience=%q; obtaining public keys from -pubsub.jwksURL=%s", *audiences, *jwksURL)
+	})
+	return tokenVerifierV
+}
+
+var (
+	pushRequestsTotal   = metrics.NewCounter(`vl_http_requests_total{path="/insert/pubsub/push"}`)
+	pushRequestDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/insert/pubsub/push"}`)
+	authErrorsTotal     = metrics.NewCounter(`vl_http_request_errors_total{path="/insert/pubsub/push",reason="auth"}`)
+)
+
+// readPushMessage parses Pub/Sub push request data and passes the log entry from it to lmp.
+//
+// See https://cloud.google.com/pubsub/docs/push#receive_push
+func readPushMessage(data []byte, cp *insertutil.CommonParams, lmp insertutil.LogMessageProcessor) error {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(data)
+	if err != nil {
+		return err
+	}
+	msg := v.Get("message")
+	if msg == nil || msg.Type() != fastjson.TypeObject {
+		return fmt.Errorf("missing 'message' object")
+	}
+
+	var fields []logstorage.Field
+	if subscription := v.GetStringBytes("subscription"); len(subscription) > 0 {
+		fields = appendField(fields, "pubsub.subscription", subscription)
+	}
+	messageID := msg.GetStringBytes("messageId")
+	if len(messageID) == 0 {
+		messageID = msg.GetStringBytes("message_id")
+	}
+	if len(messageID) > 0 {
+		fields = appendField(fields, "pubsub.message_id", messageID)
+	}
+	publishTime := msg.GetStringBytes("publishTime")
+	if len(publishTime) == 0 {
+		publishTime = msg.GetStringBytes("publish_time")
+	}
+	if len(publishTime) > 0 {
+		fields = appendField(fields, "pubsub.publish_time", publishTime)
+	}
+	if attrs := msg.Get("attributes"); attrs != nil {
+		o, err := attrs.Object()
+		if err != nil {
+			return fmt.Errorf("unexpected type for 'attributes'; want JSON object: %w", err)
+		}
+		o.Visit(func(k []byte, v *fastjson.Value) {
+			if err != nil {
+				return
+			}
+			value, errLocal := v.StringBytes()
+			if errLocal != nil {
+				err = fmt.Errorf("unexpected type for attribute %q; want string: %w", k, errLocal)
+				return
+			}
+			fields = appendField(fields, "pubsub.attributes."+string(k), value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	payload, err := decodeData(msg.Get("data"))
+	if err != nil {
+		return err
+	}
+
+	jp := logstorage.GetJSONParser()
+	defer logstorage.PutJSONParser(jp)
+
+	if isJSONObject(payload) {
+		if err := jp.ParseLogMessage(payload); err != nil {
+			return fmt.Errorf("cannot parse message data: %w", err)
+		}
+		fields = append(fields, jp.Fields...)
+	} else if len(payload) > 0 {
+		fields = append(fields, logstorage.Field{
+			Name:  "_msg",
+			Value: bytesutil.ToUnsafeString(payload),
+		})
+	}
+
+	ts, err := insertutil.ExtractTimestampFromFields(cp.TimeFields, fields)
+	if err != nil {
+		return err
+	}
+	logstorage.RenameField(fields, cp.MsgFields, "_msg")
+
+	lmp.AddRow(ts, fields, -1)
+	return nil
+}
+
+// decodeData decodes base64-encoded 'data' field of Pub/Sub message.
+func decodeData(v *fastjson.Value) ([]byte, error) {
+	if v == nil || v.Type() == fastjson.TypeNull {
+		return nil, nil
+	}
+	s, err := v.StringBytes()
+	if err != nil {
+		return nil, fmt.Errorf("unexpected type for 'data'; want base64-encoded string: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(bytesutil.ToUnsafeString(s))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode base64-encoded 'data': %w", err)
+	}
+	return data, nil
+}
+
+func isJSONObject(data []byte) bool {
+	s := strings.TrimSpace(bytesutil.ToUnsafeString(data))
+	return strings.HasPrefix(s, "{")
+}
+
+func appendField(dst []logstorage.Field, name string, value []byte) []logstorage.Field {
+	return append(dst, logstorage.Field{
+		Name:  name,
+		Value: bytesutil.ToUnsafeString(value),
+	})
+}
+
+var parserPool fastjson.ParserPool
@@ -0,0 +1,73 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+func TestReadPushMessageSuccess(t *testing.T) {
+	f := func(data string, timestampsExpected []int64, resultExpected string) {
+		t.Helper()
+
+		cp := &insertutil.CommonParams{
+			TimeFields: defaultTimeFields,
+			MsgFields:  defaultMsgFields,
+		}
+		lmp := &insertutil.TestLogMessageProcessor{}
+		if err := readPushMessage([]byte(data), cp, lmp); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := lmp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// Google Cloud Logging entry routed via Pub/Sub log sink
+	f(`{"message":{"attributes":{"logging.googleapis.com/timestamp":"2024-01-02T03:04:05Z"},`+
+		`"data":"eyJ0ZXh0UGF5bG9hZCI6ImZvbyBiYXIiLCJ0aW1lc3RhbXAiOiIyMDI0LTAxLTAyVDAzOjA0OjA1WiIsImxvZ05hbWUiOiJwcm9qZWN0cy9wL2xvZ3Mvc3lzbG9nIiwicmVzb3VyY2UiOnsidHlwZSI6ImdjZV9pbnN0YW5jZSIsImxhYmVscyI6eyJ6b25lIjoidXMxIn19LCJzZXZlcml0eSI6IklORk8ifQ==",`+
+		`"messageId":"123","publishTime":"2024-01-02T03:04:06Z"},"subscription":"projects/p/subscriptions/logs"}`,
+		[]int64{1704164645000000000},
+		`{"pubsub.subscription":"projects/p/subscriptions/logs","pubsub.message_id":"123","pubsub.publish_time":"2024-01-02T03:04:06Z",`+
+			`"pubsub.attributes.logging.googleapis.com/timestamp":"2024-01-02T03:04:05Z","_msg":"foo bar","logName":"projects/p/logs/syslog",`+
+			`"resource.type":"gce_instance","resource.labels.zone":"us1","severity":"INFO"}`)
+
+	// plain text data without time fields uses the publish time
+	f(`{"message":{"data":"cGxhaW4gdGV4dA==","message_id":"1","publish_time":"2024-01-02T03:04:06.5Z"},"subscription":"s"}`,
+		[]int64{1704164646500000000},
+		`{"pubsub.subscription":"s","pubsub.message_id":"1","_msg":"plain text"}`)
+}
+
+func TestReadPushMessageFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		cp := &insertutil.CommonParams{
+			TimeFields: defaultTimeFields,
+			MsgFields:  defaultMsgFields,
+		}
+		lmp := &insertutil.TestLogMessageProcessor{}
+		if err := readPushMessage([]byte(data), cp, lmp); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid JSON
+	f(`foo`)
+	f(`{"message":`)
+
+	// missing message
+	f(`{}`)
+	f(`{"message":"foo"}`)
+
+	// invalid attributes
+	f(`{"message":{"attributes":"foo"}}`)
+	f(`{"message":{"attributes":{"foo":1}}}`)
+
+	// invalid data
+	f(`{"message":{"data":123}}`)
+	f(`{"message":{"data":"!!!"}}`)
+
+	// invalid publish time
+	f(`{"message":{"data":"cGxhaW4gdGV4dA==","publishTime":"foo"}}`)
+}
@@ -0,0 +1,647 @@
+package sigma
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// rule is a Sigma detection rule compiled to LogsQL filter.
+//
+// See https://sigmahq.io/docs/basics/rules.html
+type rule struct {
+	// title is the rule title
+	title string
+
+	// id is an optional rule id
+	id string
+
+	// level is an optional rule level such as low, medium, high or critical
+	level string
+
+	// tags contains optional rule tags
+	tags []string
+
+	// filter is LogsQL filter for the rule
+	filter string
+
+	f *logstorage.Filter
+}
+
+// sigmaRule is a Sigma rule in YAML format.
+type sigmaRule struct {
+	Title     string            `yaml:"title"`
+	ID        string            `yaml:"id"`
+	Level     string            `yaml:"level"`
+	Tags      []string          `yaml:"tags"`
+	LogSource map[string]string `yaml:"logsource"`
+	Detection map[string]any    `yaml:"detection"`
+}
+
+// fieldMapping contains mapping from Sigma rules to log fields.
+type fieldMapping struct {
+	// Fields contains mapping from Sigma field names to log field names
+	Fields map[string]string `yaml:"fields"`
+
+	// LogSources contains mapping from logsource items in the form 'product:windows', 'category:process_creation' or 'service:sshd'
+	// to LogsQL filters, which select logs for the given logsource.
+	LogSources map[string]string `yaml:"logsources"`
+}
+
+func parseFieldMapping(data []byte) (*fieldMapping, error) {
+	var fm fieldMapping
+	if err := yaml.UnmarshalStrict(data, &fm); err != nil {
+		return nil, err
+	}
+	for k, v := range fm.LogSources {
+		if _, err := logstorage.ParseFilter(v); err != nil {
+			return nil, fmt.Errorf("cannot parse filter for the logsource %q: %w", k, err)
+		}
+	}
+	return &fm, nil
+}
+
+// parseRules parses Sigma rules from data.
+//
+// data may contain multiple YAML documents - one rule per document.
+func parseRules(data []byte, fm *fieldMapping) ([]*rule, error) {
+	var rules []*rule
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var sr sigmaRule
+		if err := d.Decode(&sr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return rules, nil
+			}
+			return nil, fmt.Errorf("cannot parse YAML: %w", err)
+		}
+		r, err := compileRule(&sr, fm)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile rule %q: %w", sr.Title, err)
+		}
+		rules = append(rules, r)
+	}
+}
+
+func compileRule(sr *sigmaRule, fm *fieldMapping) (*rule, error) {
+	if sr.Title == "" {
+		return nil, fmt.Errorf("missing title")
+	}
+	if len(sr.Detection) == 0 {
+		return nil, fmt.Errorf("missing detection")
+	}
+
+	c := &compiler{
+		fm:         fm,
+		selections: make(map[string]string),
+	}
+	var conditions []string
+	for name, v := range sr.Detection {
+		if name == "condition" {
+			cs, err := getConditions(v)
+			if err != nil {
+				return nil, err
+			}
+			conditions = cs
+			continue
+		}
+		if name == "timeframe" {
+			return nil, fmt.Errorf("timeframe isn't supported")
+		}
+		s, err := c.compileSelection(v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile selection %q: %w", name, err)
+		}
+		c.selections[name] = s
+	}
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("missing condition")
+	}
+
+	var a []string
+	for _, cond := range conditions {
+		s, err := c.compileCondition(cond)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile condition %q: %w", cond, err)
+		}
+		a = append(a, s)
+	}
+	filter := joinFilters(a, "or")
+
+	if logSourceFilter := getLogSourceFilter(sr.LogSource, fm); logSourceFilter != "" {
+		filter = joinFilters([]string{logSourceFilter, filter}, "")
+	}
+
+	f, err := logstorage.ParseFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the compiled filter [%s]: %w", filter, err)
+	}
+
+	r := &rule{
+		title:  sr.Title,
+		id:     sr.ID,
+		level:  sr.Level,
+		tags:   sr.Tags,
+		filter: f.String(),
+		f:      f,
+	}
+	return r, nil
+}
+
+func getConditions(v any) ([]string, error) {
+	switch t := v.(type) {
+	case string:
+		return []string{t}, nil
+	case []any:
+		a := make([]string, 0, len(t))
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected condition type %T; want string", item)
+			}
+			a = append(a, s)
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("unexpected condition type %T; want string or list of strings", v)
+	}
+}
+
+func getLogSourceFilter(logSource map[string]string, fm *fieldMapping) string {
+	if fm == nil || len(fm.LogSources) == 0 {
+		return ""
+	}
+	var a []string
+	for _, k := range []string{"product", "category", "service"} {
+		v := logSource[k]
+		if v == "" {
+			continue
+		}
+		if filter := fm.LogSources[k+":"+v]; filter != "" {
+			a = append(a, filter)
+		}
+	}
+	return joinFilters(a, "")
+}
+
+// compiler compiles Sigma detections to LogsQL filters.
+type compiler struct {
+	fm *fieldMapping
+
+	// selections contains compiled selections by name
+	selections map[string]string
+}
+
+func (c *compiler) getFieldName(name string) string {
+	if c.fm != nil {
+		if s := c.fm.Fields[name]; s != "" {
+			return s
+		}
+	}
+	return name
+}
+
+// compileSelection compiles Sigma selection v.
+//
+// The selection may be a map with field matchers, a list of such maps or a list of keywords.
+func (c *compiler) compileSelection(v any) (string, error) {
+	switch t := v.(type) {
+	case map[any]any:
+		return c.compileFieldMatchers(t)
+	case []any:
+		if len(t) == 0 {
+			return "", fmt.Errorf("selection cannot be empty")
+		}
+		a := make([]string, 0, len(t))
+		for _, item := range t {
+			var s string
+			var err error
+			if m, ok := item.(map[any]any); ok {
+				s, err = c.compileFieldMatchers(m)
+			} else {
+				s, err = compileValue("_msg", []string{"contains"}, item)
+			}
+			if err != nil {
+				return "", err
+			}
+			a = append(a, s)
+		}
+		return joinFilters(a, "or"), nil
+	default:
+		return compileValue("_msg", []string{"contains"}, v)
+	}
+}
+
+// compileFieldMatchers compiles the map with field matchers into a filter, which matches all the matchers.
+func (c *compiler) compileFieldMatchers(m map[any]any) (string, error) {
+	if len(m) == 0 {
+		return "", fmt.Errorf("selection cannot be empty")
+	}
+	keys := make([]string, 0, len(m))
+	values := make(map[string]any, len(m))
+	for k, v := range m {
+		key := fmt.Sprintf("%v", k)
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+
+	a := make([]string, 0, len(keys))
+	for _, key := range keys {
+		s, err := c.compileFieldMatcher(key, values[key])
+		if err != nil {
+			return "", err
+		}
+		a = append(a, s)
+	}
+	return joinFilters(a, ""), nil
+}
+
+// compileFieldMatcher compiles matcher for the given key in the form 'field|modifier1|...|modifierN' and the value v.
+func (c *compiler) compileFieldMatcher(key string, v any) (string, error) {
+	modifiers := strings.Split(key, "|")
+	fieldName := modifiers[0]
+	modifiers = modifiers[1:]
+	if fieldName == "" {
+		fieldName = "_msg"
+	} else {
+		fieldName = c.getFieldName(fieldName)
+	}
+
+	values, ok := v.([]any)
+	if !ok {
+		values = []any{v}
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("missing values for %q", key)
+	}
+
+	op := "or"
+	if slices.Contains(modifiers, "all") {
+		op = ""
+	}
+	a := make([]string, 0, len(values))
+	for _, value := range values {
+		s, err := compileValue(fieldName, modifiers, value)
+		if err != nil {
+			return "", fmt.Errorf("cannot compile %q: %w", key, err)
+		}
+		a = append(a, s)
+	}
+	return joinFilters(a, op), nil
+}
+
+// compileValue compiles the matcher for the given fieldName, Sigma value modifiers and the value v.
+//
+// See https://sigmahq.io/docs/basics/modifiers.html
+func compileValue(fieldName string, modifiers []string, v any) (string, error) {
+	var isContains, isStartsWith, isEndsWith, isCased, isRegexp bool
+	var cmpOp, regexpFlags string
+	for _, m := range modifiers {
+		switch m {
+		case "all":
+		case "contains":
+			isContains = true
+		case "startswith":
+			isStartsWith = true
+		case "endswith":
+			isEndsWith = true
+		case "cased":
+			isCased = true
+		case "re":
+			isRegexp = true
+		case "i", "m", "s":
+			regexpFlags += m
+		case "exists":
+			b, ok := v.(bool)
+			if !ok {
+				return "", fmt.Errorf("unexpected value for exists modifier: %v; want true or false", v)
+			}
+			if b {
+				return quoteFieldName(fieldName) + "*", nil
+			}
+			return quoteFieldName(fieldName) + `""`, nil
+		case "cidr":
+			s := fmt.Sprintf("%v", v)
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return "", fmt.Errorf("cannot parse cidr %q: %w", s, err)
+			}
+			if !p.Addr().Is4() {
+				return "", fmt.Errorf("unsupported cidr %q; only IPv4 subnets are supported", s)
+			}
+			return quoteFieldName(fieldName) + "ipv4_range(" + strconv.Quote(p.Masked().String()) + ")", nil
+		case "gt", "gte", "lt", "lte":
+			cmpOp = map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<="}[m]
+		default:
+			return "", fmt.Errorf("unsupported modifier %q", m)
+		}
+	}
+
+	if v == nil {
+		return quoteFieldName(fieldName) + `""`, nil
+	}
+	s := formatValue(v)
+
+	if cmpOp != "" {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return "", fmt.Errorf("unexpected value for %s comparison: %q; want number", cmpOp, s)
+		}
+		return quoteFieldName(fieldName) + cmpOp + s, nil
+	}
+	if isRegexp {
+		if regexpFlags != "" {
+			s = "(?" + regexpFlags + ")" + s
+		}
+		if _, err := regexp.Compile(s); err != nil {
+			return "", fmt.Errorf("cannot parse regexp %q: %w", s, err)
+		}
+		return quoteFieldName(fieldName) + "~" + strconv.Quote(s), nil
+	}
+
+	if isContains {
+		s = "*" + s + "*"
+	} else if isStartsWith {
+		s += "*"
+	} else if isEndsWith {
+		s = "*" + s
+	}
+	return compileWildcardValue(fieldName, s, isCased), nil
+}
+
+// compileWildcardValue compiles the value s with Sigma wildcards.
+//
+// Sigma values are case-insensitive by default, so they are compiled to regexp filters
+// unless isCased is set or the value doesn't contain letters.
+func compileWildcardValue(fieldName, s string, isCased bool) string {
+	// Split s into literals separated by '*' and '?' wildcards.
+	var tokens []string
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '\\' && i+1 < len(s) && (s[i+1] == '*' || s[i+1] == '?' || s[i+1] == '\\'):
+			buf.WriteByte(s[i+1])
+			i++
+		case ch == '*' && buf.Len() == 0 && len(tokens) > 0 && tokens[len(tokens)-1] == "*":
+			// Collapse repeated '*' wildcards.
+		case ch == '*' || ch == '?':
+			tokens = append(tokens, buf.String(), string(ch))
+			buf.Reset()
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	tokens = append(tokens, buf.String())
+
+	hasPrefixWildcard := len(tokens) > 1 && tokens[0] == "" && tokens[1] == "*"
+	if hasPrefixWildcard {
+		tokens = tokens[2:]
+	}
+	hasSuffixWildcard := len(tokens) > 1 && tokens[len(tokens)-1] == "" && tokens[len(tokens)-2] == "*"
+	if hasSuffixWildcard {
+		tokens = tokens[:len(tokens)-2]
+	}
+	if hasPrefixWildcard && len(tokens) == 1 && tokens[0] == "" {
+		// The value consists only of '*' wildcards.
+		hasSuffixWildcard = true
+	}
+
+	if len(tokens) == 1 && (isCased || strings.ToLower(tokens[0]) == strings.ToUpper(tokens[0])) {
+		// Use fast case-sensitive filters.
+		v := strconv.Quote(tokens[0])
+		switch {
+		case hasPrefixWildcard && hasSuffixWildcard:
+			if tokens[0] == "" {
+				return quoteFieldName(fieldName) + "*"
+			}
+			return quoteFieldName(fieldName) + "*" + v + "*"
+		case hasSuffixWildcard:
+			return quoteFieldName(fieldName) + "=" + v + "*"
+		case !hasPrefixWildcard:
+			return quoteFieldName(fieldName) + "=" + v
+		}
+	}
+
+	var re strings.Builder
+	if !isCased {
+		re.WriteString("(?i)")
+	}
+	if !hasPrefixWildcard {
+		re.WriteString("^")
+	}
+	for i, token := range tokens {
+		switch {
+		case i%2 == 0:
+			re.WriteString(regexp.QuoteMeta(token))
+		case token == "*":
+			re.WriteString(".*")
+		default:
+			re.WriteString(".")
+		}
+	}
+	if !hasSuffixWildcard {
+		re.WriteString("$")
+	}
+	return quoteFieldName(fieldName) + "~" + strconv.Quote(re.String())
+}
+
+func formatValue(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func quoteFieldName(name string) string {
+	if name == "_msg" {
+		return "_msg:"
+	}
+	return strconv.Quote(name) + ":"
+}
+
+// joinFilters joins filters in a with the given op.
+//
+// Empty op means 'and'.
+func joinFilters(a []string, op string) string {
+	if len(a) == 0 {
+		return ""
+	}
+	if len(a) == 1 {
+		return a[0]
+	}
+	sep := " "
+	if op != "" {
+		sep = " " + op + " "
+	}
+	return "(" + strings.Join(a, sep) + ")"
+}
+
+// compileCondition compiles Sigma condition cond into LogsQL filter.
+//
+// See https://sigmahq.io/docs/basics/conditions.html
+func (c *compiler) compileCondition(cond string) (string, error) {
+	if strings.Contains(cond, "|") {
+		return "", fmt.Errorf("aggregations aren't supported")
+	}
+	cp := &conditionParser{
+		c:      c,
+		tokens: tokenizeCondition(cond),
+	}
+	s, err := cp.parseOr()
+	if err != nil {
+		return "", err
+	}
+	if len(cp.tokens) > 0 {
+		return "", fmt.Errorf("unexpected tail: %q", strings.Join(cp.tokens, " "))
+	}
+	return s, nil
+}
+
+func tokenizeCondition(s string) []string {
+	s = strings.ReplaceAll(s, "(", " ( ")
+	s = strings.ReplaceAll(s, ")", " ) ")
+	return strings.Fields(s)
+}
+
+type conditionParser struct {
+	c      *compiler
+	tokens []string
+}
+
+func (cp *conditionParser) peek() string {
+	if len(cp.tokens) == 0 {
+		return ""
+	}
+	return strings.ToLower(cp.tokens[0])
+}
+
+func (cp *conditionParser) next() string {
+	token := cp.tokens[0]
+	cp.tokens = cp.tokens[1:]
+	return token
+}
+
+func (cp *conditionParser) parseOr() (string, error) {
+	s, err := cp.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	a := []string{s}
+	for cp.peek() == "or" {
+		cp.next()
+		s, err := cp.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		a = append(a, s)
+	}
+	return joinFilters(a, "or"), nil
+}
+
+func (cp *conditionParser) parseAnd() (string, error) {
+	s, err := cp.parseNot()
+	if err != nil {
+		return "", err
+	}
+	a := []string{s}
+	for cp.peek() == "and" {
+		cp.next()
+		s, err := cp.parseNot()
+		if err != nil {
+			return "", err
+		}
+		a = append(a, s)
+	}
+	return joinFilters(a, ""), nil
+}
+
+func (cp *conditionParser) parseNot() (string, error) {
+	if cp.peek() != "not" {
+		return cp.parsePrimary()
+	}
+	cp.next()
+	s, err := cp.parseNot()
+	if err != nil {
+		return "", err
+	}
+	return "!(" + s + ")", nil
+}
+
+func (cp *conditionParser) parsePrimary() (string, error) {
+	switch token := cp.peek(); token {
+	case "":
+		return "", fmt.Errorf("missing selection name")
+	case "(":
+		cp.next()
+		s, err := cp.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if cp.peek() != ")" {
+			return "", fmt.Errorf("missing ')'")
+		}
+		cp.next()
+		return s, nil
+	case ")", "and", "or", "of":
+		return "", fmt.Errorf("unexpected token %q", token)
+	case "1", "all":
+		if len(cp.tokens) > 2 && strings.ToLower(cp.tokens[1]) == "of" {
+			cp.next()
+			cp.next()
+			return cp.compileOf(token, cp.next())
+		}
+	}
+	name := cp.next()
+	s, ok := cp.c.selections[name]
+	if !ok {
+		return "", fmt.Errorf("unknown selection %q", name)
+	}
+	return s, nil
+}
+
+// compileOf compiles '1 of pattern' and 'all of pattern' expressions.
+func (cp *conditionParser) compileOf(quantifier, pattern string) (string, error) {
+	var names []string
+	for name := range cp.c.selections {
+		if pattern == "them" {
+			if !strings.HasPrefix(name, "_") {
+				names = append(names, name)
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no selections match %q", pattern)
+	}
+	sort.Strings(names)
+
+	a := make([]string, 0, len(names))
+	for _, name := range names {
+		a = append(a, cp.c.selections[name])
+	}
+	op := "or"
+	if quantifier == "all" {
+		op = ""
+	}
+	return joinFilters(a, op), nil
+}
@@ -0,0 +1,202 @@
+package sigma
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRules_Success(t *testing.T) {
+	f := func(data string, fm *fieldMapping, filtersExpected []string) {
+		t.Helper()
+
+		rules, err := parseRules([]byte(data), fm)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var filters []string
+		for _, r := range rules {
+			filters = append(filters, r.filter)
+		}
+		if !reflect.DeepEqual(filters, filtersExpected) {
+			t.Fatalf("unexpected filters\ngot\n%q\nwant\n%q", filters, filtersExpected)
+		}
+	}
+
+	// empty data
+	f("", nil, nil)
+
+	// exact match
+	f(`
+title: exact
+detection:
+  selection:
+    EventID: 4625
+    LogonType: [3, 10]
+  condition: selection
+`, nil, []string{`EventID:=4625 (LogonType:=3 or LogonType:=10)`})
+
+	// case-insensitive values and modifiers
+	f(`
+title: modifiers
+detection:
+  selection:
+    Image|endswith: '\cmd.exe'
+    CommandLine|contains|all: ['whoami', ' -1 ']
+    User|startswith: admin
+    Host: web-??
+  condition: selection
+`, nil, []string{`CommandLine:~"(?i)whoami" CommandLine:*" -1 "* Host:~"(?i)^web-..$" Image:~"(?i)\\\\cmd\\.exe$" User:~"(?i)^admin"`})
+
+	// cased, regexp, cidr, exists, null and numeric comparisons
+	f(`
+title: misc
+detection:
+  selection:
+    Path|cased|startswith: /usr/Bin
+    Agent|re|i: 'curl/[0-9]+'
+    SrcIP|cidr: 10.20.30.40/16
+    Token|exists: true
+    Session: '*'
+    Proxy: null
+    Size|gte: 1024
+  condition: selection
+`, nil, []string{`Agent:~"(?i)curl/[0-9]+" Path:="/usr/Bin"* Proxy:"" Session:* Size:>=1024 SrcIP:ipv4_range(10.20.0.0, 10.20.255.255) Token:*`})
+
+	// keywords and conditions with field mapping and logsource mapping
+	fm := &fieldMapping{
+		Fields: map[string]string{
+			"User": "user.name",
+		},
+		LogSources: map[string]string{
+			"product:linux": `{app="linux"}`,
+			"service:sshd":  "service:sshd",
+		},
+	}
+	f(`
+title: conditions
+logsource:
+  product: linux
+  service: sshd
+  category: auth
+detection:
+  keywords:
+    - 'Failed password'
+    - 'Invalid user*'
+  filter_root:
+    User: root
+  filter_admin:
+    User: admin
+  condition: keywords and not 1 of filter_*
+---
+title: all of them
+detection:
+  sel1:
+    - a: 1
+    - b: 2
+  sel2:
+    c: 3
+  _hidden:
+    d: 4
+  condition:
+    - all of them
+    - _hidden
+`, fm, []string{
+		`{app="linux"} service:sshd (~"(?i)Failed password" or ~"(?i)Invalid user") !(user.name:~"(?i)^admin$" or user.name:~"(?i)^root$")`,
+		`(a:=1 or b:=2) c:=3 or d:=4`,
+	})
+}
+
+func TestParseRules_Failure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		if _, err := parseRules([]byte(data), nil); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid YAML
+	f("foo: [")
+
+	// missing title
+	f(`
+detection:
+  selection:
+    foo: bar
+  condition: selection
+`)
+
+	// missing condition
+	f(`
+title: foo
+detection:
+  selection:
+    foo: bar
+`)
+
+	// unknown selection
+	f(`
+title: foo
+detection:
+  selection:
+    foo: bar
+  condition: selection or other
+`)
+
+	// aggregation
+	f(`
+title: foo
+detection:
+  selection:
+    foo: bar
+  condition: selection | count() > 10
+`)
+
+	// unsupported modifier
+	f(`
+title: foo
+detection:
+  selection:
+    foo|base64: bar
+  condition: selection
+`)
+
+	// invalid condition syntax
+	f(`
+title: foo
+detection:
+  selection:
+    foo: bar
+  condition: (selection
+`)
+	f(`
+title: foo
+detection:
+  selection:
+    foo: bar
+  condition: selection and
+`)
+
+	// invalid values
+	f(`
+title: foo
+detection:
+  selection:
+    foo|cidr: 2001:db8::/32
+  condition: selection
+`)
+	f(`
+title: foo
+detection:
+  selection:
+    foo|gt: bar
+  condition: selection
+`)
+	f(`
+title: foo
+detection:
+  selection:
+    foo|re: '(bar'
+  condition: selection
+`)
+}
@@ -0,0 +1,497 @@
+package sigma
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	rulesPaths = flagutil.NewArrayString("sigma.rulesPath", "Optional path to Sigma detection rule file or to directory with *.yml and *.yaml rule files. "+
+		"Http urls to rule files are supported too. See https://docs.victoriametrics.com/victorialogs/#sigma-rules")
+	fieldMappingPath = flag.String("sigma.fieldMapping", "", "Optional path or http url to YAML file with mapping from Sigma field names and logsources "+
+		"to log fields and LogsQL filters. See https://docs.victoriametrics.com/victorialogs/#sigma-rules")
+	mode = flag.String("sigma.mode", "streaming", "Evaluation mode for -sigma.rulesPath. Supported values: streaming, scheduled. "+
+		"In streaming mode the rules are applied to the ingested logs before they are written to the storage. "+
+		"In scheduled mode the rules are executed as LogsQL queries every -sigma.checkInterval")
+	checkInterval = flag.Duration("sigma.checkInterval", time.Minute, "Interval for emitting detections for -sigma.rulesPath. "+
+		"In scheduled mode this is also the time range for the logs to check per every evaluation")
+	webhookURLs = flagutil.NewArrayString("sigma.webhookURL", "Optional URL to send Sigma rule detections to via HTTP POST requests with JSON body; "+
+		"see https://docs.victoriametrics.com/victorialogs/#sigma-rules")
+)
+
+// ruleField is the stream field name for the logs with Sigma rule detections.
+//
+// Logs with this field are excluded from Sigma rules evaluation.
+const ruleField = "vl_sigma_rule"
+
+var (
+	globalEngine *engine
+	stopCh       chan struct{}
+	wg           sync.WaitGroup
+)
+
+// Init loads Sigma rules from -sigma.rulesPath and starts their evaluation.
+//
+// Init must be called before ingesting logs, since streaming evaluation is performed via insertutil.LogRowsWatcher.
+func Init() {
+	if len(*rulesPaths) == 0 {
+		return
+	}
+	rules, err := loadConfig()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	logger.Infof("loaded %d Sigma rules from -sigma.rulesPath", len(rules))
+
+	e := newEngine(rules)
+	globalEngine = e
+	stopCh = make(chan struct{})
+
+	switch *mode {
+	case "streaming":
+		insertutil.AddLogRowsWatcher(e)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runFlusher(e)
+		}()
+	case "scheduled":
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runScheduler(e)
+		}()
+	default:
+		logger.Panicf("BUG: unexpected -sigma.mode=%q", *mode)
+	}
+}
+
+// CheckConfig verifies -sigma.* command-line flags and Sigma rules at -sigma.rulesPath without starting their evaluation.
+func CheckConfig() error {
+	if len(*rulesPaths) == 0 {
+		return nil
+	}
+	_, err := loadConfig()
+	return err
+}
+
+func loadConfig() ([]*rule, error) {
+	if *checkInterval <= 0 {
+		return nil, fmt.Errorf("-sigma.checkInterval must be positive; got %s", *checkInterval)
+	}
+	if *mode != "streaming" && *mode != "scheduled" {
+		return nil, fmt.Errorf("unsupported -sigma.mode=%q; supported values: streaming, scheduled", *mode)
+	}
+	rules, err := loadRules(*rulesPaths, *fieldMappingPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load -sigma.rulesPath: %w", err)
+	}
+	return rules, nil
+}
+
+// Stop stops Sigma rules evaluation.
+func Stop() {
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	wg.Wait()
+	stopCh = nil
+	globalEngine = nil
+}
+
+func loadRules(paths []string, fieldMappingPath string) ([]*rule, error) {
+	var fm *fieldMapping
+	if fieldMappingPath != "" {
+		data, err := fscore.ReadFileOrHTTP(fieldMappingPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read -sigma.fieldMapping: %w", err)
+		}
+		fm, err = parseFieldMapping(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse -sigma.fieldMapping=%q: %w", fieldMappingPath, err)
+		}
+	}
+
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil || !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		for _, pattern := range []string{"*.yml", "*.yaml"} {
+			matches, err := filepath.Glob(filepath.Join(p, pattern))
+			if err != nil {
+				return nil, fmt.Errorf("cannot list rule files at %q: %w", p, err)
+			}
+			files = append(files, matches...)
+		}
+	}
+
+	var rules []*rule
+	for _, path := range files {
+		data, err := fscore.ReadFileOrHTTP(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %q: %w", path, err)
+		}
+		rs, err := parseRules(data, fm)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", path, err)
+		}
+		rules = append(rules, rs...)
+	}
+	return rules, nil
+}
+
+// engine evaluates Sigma rules.
+//
+// It implements insertutil.LogRowsWatcher for streaming evaluation.
+type engine struct {
+	rules []*rule
+
+	// mu protects hits
+	mu   sync.Mutex
+	hits map[hitKey]uint64
+}
+
+// hitKey is the key for counting the logs matching the rule per tenant and log stream.
+type hitKey struct {
+	tenantID logstorage.TenantID
+	rule     *rule
+	stream   string
+}
+
+func newEngine(rules []*rule) *engine {
+	return &engine{
+		rules: rules,
+		hits:  make(map[hitKey]uint64),
+	}
+}
+
+// WatchLogRows counts the logs from lr matching the loaded Sigma rules.
+func (e *engine) WatchLogRows(lr *logstorage.LogRows) {
+	var fields []logstorage.Field
+	var timestampBuf []byte
+	lr.ForEachRow(func(_ uint64, r *logstorage.InsertRow) {
+		if hasRuleField(r.Fields) {
+			return
+		}
+		fields, timestampBuf = insertutil.AppendInsertRowFields(fields[:0], timestampBuf[:0], r)
+		for _, rule := range e.rules {
+			if !rule.f.MatchRow(fields) {
+				continue
+			}
+			k := hitKey{
+				tenantID: r.TenantID,
+				rule:     rule,
+				stream:   fields[1].Value,
+			}
+			e.mu.Lock()
+			e.hits[k]++
+			e.mu.Unlock()
+		}
+	})
+}
+
+func hasRuleField(fields []logstorage.Field) bool {
+	for _, f := range fields {
+		if f.Name == ruleField {
+			return true
+		}
+	}
+	return false
+}
+
+// getDetections returns detections for the logs matched since the previous call.
+func (e *engine) getDetections(timestamp time.Time) []*Detection {
+	e.mu.Lock()
+	hits := e.hits
+	e.hits = make(map[hitKey]uint64)
+	e.mu.Unlock()
+
+	detections := make([]*Detection, 0, len(hits))
+	for k, n := range hits {
+		detections = append(detections, newDetection(k.tenantID, timestamp, k.rule, strings.Clone(k.stream), n))
+	}
+	return detections
+}
+
+func runFlusher(e *engine) {
+	ticker := time.NewTicker(*checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		checksTotal.Inc()
+		detections := e.getDetections(time.Now())
+		emitDetections(detections)
+	}
+}
+
+func runScheduler(e *engine) {
+	ticker := time.NewTicker(*checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		checksTotal.Inc()
+		end := time.Now()
+		start := end.Add(-*checkInterval)
+		detections, err := e.runRules(start.UnixNano(), end.UnixNano())
+		if err != nil {
+			checkErrorsTotal.Inc()
+			logger.Errorf("cannot evaluate Sigma rules: %s", err)
+		}
+		emitDetections(detections)
+	}
+}
+
+// runRules executes the loaded rules as LogsQL queries over logs on the time range [start, end) across all the tenants.
+func (e *engine) runRules(start, end int64) ([]*Detection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *checkInterval)
+	defer cancel()
+
+	tenantIDs, err := vlstorage.GetTenantIDs(ctx, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain tenants: %w", err)
+	}
+
+	timestamp := time.Unix(0, end)
+	var detections []*Detection
+	for _, rule := range e.rules {
+		q := getRuleQuery(rule)
+		for _, tenantID := range tenantIDs {
+			hits, err := getStreamHits(ctx, tenantID, q, start, end)
+			if err != nil {
+				return detections, fmt.Errorf("cannot execute Sigma rule %q for tenant %d:%d: %w", rule.title, tenantID.AccountID, tenantID.ProjectID, err)
+			}
+			for stream, n := range hits {
+				detections = append(detections, newDetection(tenantID, timestamp, rule, stream, n))
+			}
+		}
+	}
+	return detections, nil
+}
+
+func getRuleQuery(r *rule) string {
+	return fmt.Sprintf("(%s) -%s:* | stats by (_stream) count() hits", r.filter, ruleField)
+}
+
+func getStreamHits(ctx context.Context, tenantID logstorage.TenantID, qStr string, start, end int64) (map[string]uint64, error) {
+	q, err := logstorage.ParseQueryAtTimestamp(qStr, end)
+	if err != nil {
+		return nil, err
+	}
+	q.AddTimeFilter(start, end-1)
+
+	var qs logstorage.QueryStats
+	qctx := logstorage.NewQueryContext(ctx, &qs, []logstorage.TenantID{tenantID}, q, false, nil)
+
+	var hitsLock sync.Mutex
+	hits := make(map[string]uint64)
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		var streams, counts []string
+		for _, c := range db.Columns {
+			switch c.Name {
+			case "_stream":
+				streams = c.Values
+			case "hits":
+				counts = c.Values
+			}
+		}
+		if streams == nil || counts == nil {
+			return
+		}
+
+		hitsLock.Lock()
+		defer hitsLock.Unlock()
+
+		for i, stream := range streams {
+			n, _ := strconv.ParseUint(counts[i], 10, 64)
+			hits[strings.Clone(stream)] += n
+		}
+	}
+	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+func emitDetections(detections []*Detection) {
+	if len(detections) == 0 {
+		return
+	}
+	writeDetections(detections)
+	sendDetectionsToWebhooks(detections)
+}
+
+func writeDetections(detections []*Detection) {
+	if err := insertutil.CanWriteData(); err != nil {
+		logger.Errorf("cannot write %d Sigma rule detections: %s", len(detections), err)
+		return
+	}
+
+	m := make(map[logstorage.TenantID]insertutil.LogMessageProcessor)
+	var fields []logstorage.Field
+	for _, d := range detections {
+		lmp := m[d.TenantID]
+		if lmp == nil {
+			cp := &insertutil.CommonParams{
+				TenantID:     d.TenantID,
+				TimeFields:   []string{"_time"},
+				StreamFields: []string{ruleField},
+			}
+			lmp = cp.NewLogMessageProcessor("sigma", false)
+			m[d.TenantID] = lmp
+		}
+		fields = d.appendFields(fields[:0])
+		lmp.AddRow(d.Timestamp.UnixNano(), fields, -1)
+		detectionsTotal.Inc()
+	}
+	for _, lmp := range m {
+		lmp.MustClose()
+	}
+}
+
+func sendDetectionsToWebhooks(detections []*Detection) {
+	if len(*webhookURLs) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"detections": detections,
+	})
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal Sigma rule detections: %s", err)
+	}
+	for _, url := range *webhookURLs {
+		if err := sendToWebhook(url, data); err != nil {
+			webhookErrorsTotal.Inc()
+			logger.Errorf("cannot send %d Sigma rule detections to -sigma.webhookURL=%q: %s", len(detections), url, err)
+		}
+	}
+}
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+func sendToWebhook(url string, data []byte) error {
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+var (
+	checksTotal        = metrics.NewCounter(`vl_sigma_checks_total`)
+	checkErrorsTotal   = metrics.NewCounter(`vl_sigma_check_errors_total`)
+	detectionsTotal    = metrics.NewCounter(`vl_sigma_detections_total`)
+	webhookErrorsTotal = metrics.NewCounter(`vl_sigma_webhook_errors_total`)
+
+	_ = metrics.NewGauge(`vl_sigma_rules`, func() float64 {
+		e := globalEngine
+		if e == nil {
+			return 0
+		}
+		return float64(len(e.rules))
+	})
+)
+
+// Detection is a Sigma rule match for the given log stream.
+type Detection struct {
+	// TenantID is the tenant for the matching logs.
+	TenantID logstorage.TenantID `json:"tenant"`
+
+	// Timestamp is the time when the detection has been emitted.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Rule is the title of the matching Sigma rule.
+	Rule string `json:"rule"`
+
+	// RuleID is an optional id of the matching Sigma rule.
+	RuleID string `json:"rule_id,omitempty"`
+
+	// Level is an optional level of the matching Sigma rule.
+	Level string `json:"level,omitempty"`
+
+	// Tags contains optional tags of the matching Sigma rule.
+	Tags []string `json:"tags,omitempty"`
+
+	// Stream is the log stream with the matching logs.
+	Stream string `json:"stream"`
+
+	// Hits is the number of matching logs during -sigma.checkInterval.
+	Hits uint64 `json:"hits"`
+}
+
+func newDetection(tenantID logstorage.TenantID, timestamp time.Time, r *rule, stream string, hits uint64) *Detection {
+	return &Detection{
+		TenantID:  tenantID,
+		Timestamp: timestamp,
+		Rule:      r.title,
+		RuleID:    r.id,
+		Level:     r.level,
+		Tags:      r.tags,
+		Stream:    stream,
+		Hits:      hits,
+	}
+}
+
+func (d *Detection) message() string {
+	return fmt.Sprintf("Sigma rule %q matched %d logs at the stream %s", d.Rule, d.Hits, d.Stream)
+}
+
+func (d *Detection) appendFields(dst []logstorage.Field) []logstorage.Field {
+	dst = append(dst,
+		logstorage.Field{Name: ruleField, Value: d.Rule},
+		logstorage.Field{Name: "_msg", Value: d.message()},
+		logstorage.Field{Name: "stream", Value: d.Stream},
+		logstorage.Field{Name: "hits", Value: strconv.FormatUint(d.Hits, 10)},
+	)
+	if d.RuleID != "" {
+		dst = append(dst, logstorage.Field{Name: "rule_id", Value: d.RuleID})
+	}
+	if d.Level != "" {
+		dst = append(dst, logstorage.Field{Name: "level", Value: d.Level})
+	}
+	if len(d.Tags) > 0 {
+		dst = append(dst, logstorage.Field{Name: "tags", Value: strings.Join(d.Tags, ",")})
+	}
+	return dst
+}
@@ -0,0 +1,47 @@
+package sigma
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestEngineWatchLogRows(t *testing.T) {
+	rules, err := parseRules([]byte(`
+title: failed login
+level: high
+detection:
+  selection:
+    event: login_failed
+  condition: selection
+`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	e := newEngine(rules)
+
+	lr := logstorage.GetLogRows([]string{"app"}, nil, nil, nil, "")
+	defer logstorage.PutLogRows(lr)
+
+	tenantID := logstorage.TenantID{AccountID: 1}
+	lr.MustAdd(tenantID, 1, []logstorage.Field{{Name: "app", Value: "auth"}, {Name: "event", Value: "LOGIN_FAILED"}}, -1)
+	lr.MustAdd(tenantID, 2, []logstorage.Field{{Name: "app", Value: "auth"}, {Name: "event", Value: "login_failed"}}, -1)
+	lr.MustAdd(tenantID, 3, []logstorage.Field{{Name: "app", Value: "auth"}, {Name: "event", Value: "login_ok"}}, -1)
+	lr.MustAdd(tenantID, 4, []logstorage.Field{{Name: "app", Value: "auth"}, {Name: "event", Value: "login_failed"}, {Name: ruleField, Value: "failed login"}}, -1)
+	e.WatchLogRows(lr)
+
+	detections := e.getDetections(time.Unix(0, 10))
+	if len(detections) != 1 {
+		t.Fatalf("unexpected number of detections; got %d; want 1", len(detections))
+	}
+	d := detections[0]
+	if d.TenantID != tenantID || d.Rule != "failed login" || d.Level != "high" || d.Stream != `{app="auth"}` || d.Hits != 2 {
+		t.Fatalf("unexpected detection: %+v", d)
+	}
+
+	detections = e.getDetections(time.Unix(0, 20))
+	if len(detections) != 0 {
+		t.Fatalf("unexpected detections after the reset: %+v", detections)
+	}
+}
@@ -0,0 +1,307 @@
+package splunk
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	hecTokens = flagutil.NewArrayString("splunk.hecToken", "Optional list of tokens, which must be passed in 'Authorization: Splunk <token>' header "+
+		"to Splunk HTTP Event Collector API. Any token is accepted if this flag isn't set. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#splunk-hec-api")
+	splunkStreamFields = flagutil.NewArrayString("splunk.streamFields", "Comma-separated list of fields to use as log stream fields for logs ingested via Splunk HEC API. "+
+		"By default host, source and sourcetype fields are used. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#splunk-hec-api")
+	splunkIgnoreFields = flagutil.NewArrayString("splunk.ignoreFields", "Comma-separated list of fields to ignore for logs ingested via Splunk HEC API. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#splunk-hec-api")
+
+	maxRequestSize = flagutil.NewBytes("splunk.maxRequestSize", 64*1024*1024, "The maximum size in bytes of a single Splunk HEC request")
+)
+
+// defaultStreamFields contains the log stream fields for logs ingested via Splunk HEC API if neither -splunk.streamFields nor _stream_fields are set.
+var defaultStreamFields = []string{"host", "source", "sourcetype"}
+
+// RequestHandler processes Splunk HTTP Event Collector requests.
+//
+// See https://docs.splunk.com/Documentation/Splunk/latest/Data/HECRESTendpoints
+func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
+	switch path {
+	case "/insert/splunk/services/collector", "/insert/splunk/services/collector/event", "/insert/splunk/services/collector/event/1.0":
+		handleEvents(w, r)
+		return true
+	case "/insert/splunk/services/collector/health", "/insert/splunk/services/collector/health/1.0":
+		writeResponse(w, http.StatusOK, "HEC is healthy", 17)
+		return true
+	default:
+		return false
+	}
+}
+
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	eventRequestsTotal.Inc()
+
+	if statusCode, text, code := checkToken(r); statusCode != http.StatusOK {
+		authErrorsTotal.Inc()
+		writeResponse(w, statusCode, text, code)
+		return
+	}
+
+	// Splunk HEC clients may send events with 'Content-Type: application/x-www-form-urlencoded' header (this is the default for `curl -d`).
+	// Prevent from consuming the request body by form parsing when reading query args.
+	r.PostForm = url.Values{}
+
+	cp, err := insertutil.GetCommonParams(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if len(cp.StreamFields) == 0 {
+		cp.StreamFields = *splunkStreamFields
+		if len(cp.StreamFields) == 0 {
+			cp.StreamFields = defaultStreamFields
+		}
+	}
+	if len(cp.IgnoreFields) == 0 {
+		cp.IgnoreFields = *splunkIgnoreFields
+	}
+
+	if err := insertutil.CanWriteData(); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	encoding := r.Header.Get("Content-Encoding")
+	im := cp.GetIngestionMetrics("splunk")
+	eventsCount := 0
+	err = insertutil.ReadUncompressedData("splunk", im.NewReceivedBytesReader(r.Body), encoding, maxRequestSize, func(data []byte) error {
+		im.AddUncompressedBytes(len(data))
+		lmp := cp.NewLogMessageProcessor("splunk", false)
+		n, err := readEvents(data, cp.MsgFields, lmp)
+		lmp.MustClose()
+		eventsCount = n
+		if err != nil {
+			im.AddParseErrors(1)
+		}
+		return err
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"text":%q,"code":6,"invalid-event-number":%d}`, "Invalid data format: "+err.Error(), eventsCount)
+		return
+	}
+	if eventsCount == 0 {
+		writeResponse(w, http.StatusBadRequest, "No data", 5)
+		return
+	}
+	if drr := cp.DryRun; drr != nil {
+		drr.WriteResponse(w)
+		return
+	}
+
+	// update eventRequestDuration only for successfully parsed requests
+	// There is no need in updating eventRequestDuration for request errors,
+	// since their timings are usually much smaller than the timing for successful request parsing.
+	eventRequestDuration.UpdateDuration(startTime)
+	writeResponse(w, http.StatusOK, "Success", 0)
+}
+
+// checkToken verifies the token in Authorization header of r against -splunk.hecToken.
+//
+// It returns http.StatusOK if the token is valid. Otherwise it returns HTTP status code, text and code for the Splunk HEC error response.
+func checkToken(r *http.Request) (int, string, int) {
+	if len(*hecTokens) == 0 {
+		return http.StatusOK, "", 0
+	}
+
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Splunk ")
+	if !ok {
+		token, ok = strings.CutPrefix(auth, "Bearer ")
+	}
+	if !ok || token == "" {
+		return http.StatusUnauthorized, "Token is required", 2
+	}
+	if !slices.Contains(*hecTokens, token) {
+		return http.StatusForbidden, "Invalid token", 4
+	}
+	return http.StatusOK, "", 0
+}
+
+func writeResponse(w http.ResponseWriter, statusCode int, text string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	fmt.Fprintf(w, `{"text":%q,"code":%d}`, text, code)
+}
+
+var (
+	eventRequestsTotal   = metrics.NewCounter(`vl_http_requests_total{path="/insert/splunk/services/collector/event"}`)
+	eventRequestDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/insert/splunk/services/collector/event"}`)
+	authErrorsTotal      = metrics.NewCounter(`vl_http_request_errors_total{path="/insert/splunk/services/collector/event",reason="auth"}`)
+)
+
+// readEvents parses data with concatenated Splunk HEC events and passes them to lmp.
+//
+// It returns the number of successfully parsed events.
+//
+// See https://docs.splunk.com/Documentation/Splunk/latest/Data/FormateventsforHTTPEventCollector
+func readEvents(data []byte, msgFields []string, lmp insertutil.LogMessageProcessor) (int, error) {
+	var sc fastjson.Scanner
+	sc.InitBytes(data)
+
+	p := logstorage.GetJSONParser()
+	defer logstorage.PutJSONParser(p)
+
+	var fields []logstorage.Field
+	var buf []byte
+	n := 0
+	for sc.Next() {
+		o, err := sc.Value().Object()
+		if err != nil {
+			return n, fmt.Errorf("unexpected event type; want JSON object: %w", err)
+		}
+
+		ts := int64(0)
+		fields = fields[:0]
+		buf = buf[:0]
+		hasEvent := false
+		o.Visit(func(k []byte, v *fastjson.Value) {
+			if err != nil {
+				return
+			}
+			switch string(k) {
+			case "event":
+				hasEvent = true
+				fields, buf, err = appendEventFields(fields, buf, p, v, msgFields)
+			case "time":
+				ts, err = parseTime(v)
+			case "fields":
+				fields, buf, err = appendIndexedFields(fields, buf, v)
+			case "host", "source", "sourcetype", "index":
+				fields, buf = appendField(fields, buf, bytesutil.ToUnsafeString(k), v)
+			}
+		})
+		if err != nil {
+			return n, fmt.Errorf("cannot parse event #%d: %w", n, err)
+		}
+		if !hasEvent {
+			return n, fmt.Errorf("missing 'event' field in event #%d", n)
+		}
+		if ts == 0 {
+			ts = time.Now().UnixNano()
+		}
+
+		lmp.AddRow(ts, fields, -1)
+		n++
+	}
+	if err := sc.Error(); err != nil {
+		return n, fmt.Errorf("cannot parse JSON: %w", err)
+	}
+	return n, nil
+}
+
+// appendEventFields appends fields for the given 'event' value v to dst.
+//
+// String events are stored in the _msg field. Object events are flattened into separate fields.
+// The _msg field for object events is obtained from msgFields. If it is missing, then the whole event is stored in the _msg field.
+func appendEventFields(dst []logstorage.Field, buf []byte, p *logstorage.JSONParser, v *fastjson.Value, msgFields []string) ([]logstorage.Field, []byte, error) {
+	if v.Type() != fastjson.TypeObject {
+		dst, buf = appendField(dst, buf, "_msg", v)
+		return dst, buf, nil
+	}
+
+	bufLen := len(buf)
+	buf = v.MarshalTo(buf)
+	event := buf[bufLen:]
+	if err := p.ParseLogMessage(event); err != nil {
+		return dst, buf, fmt.Errorf("cannot parse event object: %w", err)
+	}
+	logstorage.RenameField(p.Fields, msgFields, "_msg")
+
+	hasMsg := false
+	for _, f := range p.Fields {
+		if f.Name == "_msg" && f.Value != "" {
+			hasMsg = true
+		}
+		dst = append(dst, f)
+	}
+	if !hasMsg {
+		dst = append(dst, logstorage.Field{
+			Name:  "_msg",
+			Value: bytesutil.ToUnsafeString(event),
+		})
+	}
+	return dst, buf, nil
+}
+
+// appendIndexedFields appends fields from the 'fields' object v to dst.
+func appendIndexedFields(dst []logstorage.Field, buf []byte, v *fastjson.Value) ([]logstorage.Field, []byte, error) {
+	o, err := v.Object()
+	if err != nil {
+		return dst, buf, fmt.Errorf("unexpected type for 'fields'; want JSON object: %w", err)
+	}
+	o.Visit(func(k []byte, v *fastjson.Value) {
+		dst, buf = appendField(dst, buf, bytesutil.ToUnsafeString(k), v)
+	})
+	return dst, buf, nil
+}
+
+// appendField appends the field with the given name and value v to dst.
+//
+// Non-string values are stored as JSON.
+func appendField(dst []logstorage.Field, buf []byte, name string, v *fastjson.Value) ([]logstorage.Field, []byte) {
+	var value string
+	switch v.Type() {
+	case fastjson.TypeString:
+		value = bytesutil.ToUnsafeString(v.GetStringBytes())
+	case fastjson.TypeNull:
+		return dst, buf
+	default:
+		bufLen := len(buf)
+		buf = v.MarshalTo(buf)
+		value = bytesutil.ToUnsafeString(buf[bufLen:])
+	}
+	dst = append(dst, logstorage.Field{
+		Name:  name,
+		Value: value,
+	})
+	return dst, buf
+}
+
+// parseTime parses 'time' value v in seconds since Unix epoch with optional fractional part and returns the timestamp in nanoseconds.
+//
+// Zero is returned for empty time, so the caller could substitute it with the current time.
+func parseTime(v *fastjson.Value) (int64, error) {
+	var s string
+	switch v.Type() {
+	case fastjson.TypeNumber:
+		var b [32]byte
+		s = bytesutil.ToUnsafeString(v.MarshalTo(b[:0]))
+	case fastjson.TypeString:
+		s = bytesutil.ToUnsafeString(v.GetStringBytes())
+	default:
+		return 0, fmt.Errorf("unexpected type for time: %s; want number", v.Type())
+	}
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	nsecs, ok := timeutil.TryParseUnixTimestamp(s)
+	if !ok {
+		return 0, fmt.Errorf("cannot parse time %q", s)
+	}
+	return nsecs, nil
+}
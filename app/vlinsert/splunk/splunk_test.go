@@ -0,0 +1,108 @@
+package splunk
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+)
+
+func TestReadEventsFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		lmp := &insertutil.TestLogMessageProcessor{}
+		if _, err := readEvents([]byte(data), nil, lmp); err == nil {
+			t.Fatalf("expecting non-empty error")
+		}
+	}
+
+	f("foobar")
+	f(`[]`)
+	f(`{"time":123}`)
+	f(`{"event":"foo","time":"bar"}`)
+	f(`{"event":"foo","time":[]}`)
+	f(`{"event":"foo","fields":"bar"}`)
+	f(`{"event":"foo"}{"event":`)
+}
+
+func TestReadEventsSuccess(t *testing.T) {
+	f := func(data string, msgFields []string, timestampsExpected []int64, resultExpected string) {
+		t.Helper()
+
+		lmp := &insertutil.TestLogMessageProcessor{}
+		n, err := readEvents([]byte(data), msgFields, lmp)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n != len(timestampsExpected) {
+			t.Fatalf("unexpected number of events; got %d; want %d", n, len(timestampsExpected))
+		}
+		if err := lmp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// empty data
+	f("", nil, nil, "")
+	f("  \n", nil, nil, "")
+
+	// string event with envelope fields
+	f(`{"time":1686026891.735,"host":"host123","source":"/var/log/app.log","sourcetype":"app","index":"main","event":"foo bar"}`, nil,
+		[]int64{1686026891735000000},
+		`{"host":"host123","source":"/var/log/app.log","sourcetype":"app","index":"main","_msg":"foo bar"}`)
+
+	// multiple concatenated events with time as string and indexed fields
+	f(`{"time":"1686026891","event":"foo","fields":{"region":"us-east","code":42,"tags":["a","b"]}}
+{"time":1686026892,"event":"bar"} {"time":1686026893,"event":123}`, nil,
+		[]int64{1686026891000000000, 1686026892000000000, 1686026893000000000},
+		`{"_msg":"foo","region":"us-east","code":"42","tags":"[\"a\",\"b\"]"}
+{"_msg":"bar"}
+{"_msg":"123"}`)
+
+	// object event without message field
+	f(`{"time":1686026891,"event":{"user":"bob","req":{"method":"GET"}}}`, nil,
+		[]int64{1686026891000000000},
+		`{"user":"bob","req.method":"GET","_msg":"{\"user\":\"bob\",\"req\":{\"method\":\"GET\"}}"}`)
+
+	// object event with message field
+	f(`{"time":1686026891,"event":{"message":"hello","user":"bob"}}`, []string{"message"},
+		[]int64{1686026891000000000},
+		`{"_msg":"hello","user":"bob"}`)
+}
+
+func TestCheckToken(t *testing.T) {
+	f := func(tokens []string, authHeader string, statusCodeExpected int) {
+		t.Helper()
+
+		origTokens := *hecTokens
+		*hecTokens = tokens
+		defer func() {
+			*hecTokens = origTokens
+		}()
+
+		r, err := http.NewRequest(http.MethodPost, "http://localhost/insert/splunk/services/collector/event", nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		if authHeader != "" {
+			r.Header.Set("Authorization", authHeader)
+		}
+		statusCode, _, _ := checkToken(r)
+		if statusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code; got %d; want %d", statusCode, statusCodeExpected)
+		}
+	}
+
+	// tokens aren't configured
+	f(nil, "", http.StatusOK)
+	f(nil, "Splunk foo", http.StatusOK)
+
+	// tokens are configured
+	f([]string{"foo", "bar"}, "Splunk bar", http.StatusOK)
+	f([]string{"foo", "bar"}, "Bearer foo", http.StatusOK)
+	f([]string{"foo", "bar"}, "", http.StatusUnauthorized)
+	f([]string{"foo", "bar"}, "Splunk ", http.StatusUnauthorized)
+	f([]string{"foo", "bar"}, "Basic Zm9vOmJhcg==", http.StatusUnauthorized)
+	f([]string{"foo", "bar"}, "Splunk baz", http.StatusForbidden)
+}
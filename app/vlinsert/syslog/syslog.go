@@ -3,12 +3,14 @@ package syslog
 import (
 	"bufio"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -44,7 +46,7 @@ var (
 		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/")
 
 	tlsEnable = flagutil.NewArrayBool("syslog.tls", "Whether to enable TLS for receiving syslog messages at the corresponding -syslog.listenAddr.tcp. "+
-		"The corresponding -syslog.tlsCertFile and -syslog.tlsKeyFile must be set if -syslog.tls is set. See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#security")
+		"The corresponding -syslog.tlsCertFile and -syslog.tlsKeyFile must be set if -syslog.tls is set. See also -syslog.mtls. See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#security")
 	tlsCertFile = flagutil.NewArrayString("syslog.tlsCertFile", "Path to file with TLS certificate for the corresponding -syslog.listenAddr.tcp if the corresponding -syslog.tls is set. "+
 		"Prefer ECDSA certs instead of RSA certs as RSA certs are slower. The provided certificate file is automatically re-read every second, so it can be dynamically updated. "+
 		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#security")
@@ -54,6 +56,12 @@ var (
 	tlsCipherSuites = flagutil.NewArrayString("syslog.tlsCipherSuites", "Optional list of TLS cipher suites for -syslog.listenAddr.tcp if -syslog.tls is set. "+
 		"See the list of supported cipher suites at https://pkg.go.dev/crypto/tls#pkg-constants . "+
 		"See also https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#security")
+	mtlsEnable = flagutil.NewArrayBool("syslog.mtls", "Whether to require valid client certificate for TLS connections to the corresponding -syslog.listenAddr.tcp. "+
+		"This flag works only if -syslog.tls flag is set for the corresponding -syslog.listenAddr.tcp. See also -syslog.mtlsCAFile. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#mtls")
+	mtlsCAFile = flagutil.NewArrayString("syslog.mtlsCAFile", "Optional path to TLS Root CA for verifying client certificates at the corresponding -syslog.listenAddr.tcp "+
+		"when the corresponding -syslog.mtls is enabled. By default the host system TLS Root CA is used for client certificate verification. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#mtls")
 	tlsMinVersion = flag.String("syslog.tlsMinVersion", "TLS13", "The minimum TLS version to use for -syslog.listenAddr.tcp if -syslog.tls is set. "+
 		"Supported values: TLS10, TLS11, TLS12, TLS13. "+
 		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#security")
@@ -100,6 +108,13 @@ var (
 	compressMethodUnix = flagutil.NewArrayString("syslog.compressMethod.unix", "Compression method for syslog messages received at the corresponding -syslog.listenAddr.unix. "+
 		"Supported values: none, gzip, deflate. See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#compression")
 
+	trailerTCP = flagutil.NewArrayString("syslog.trailer.tcp", "Trailer for syslog messages sent with non-transparent framing to the corresponding -syslog.listenAddr.tcp. "+
+		"Supported values: lf, crlf, nul. By default the framing is detected in the way compatible with older releases. See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#message-framing")
+	trailerUDP = flagutil.NewArrayString("syslog.trailer.udp", "Trailer for syslog messages sent with non-transparent framing to the corresponding -syslog.listenAddr.udp. "+
+		"Supported values: lf, crlf, nul. By default the framing is detected in the way compatible with older releases. See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#message-framing")
+	trailerUnix = flagutil.NewArrayString("syslog.trailer.unix", "Trailer for syslog messages sent with non-transparent framing to the corresponding -syslog.listenAddr.unix. "+
+		"Supported values: lf, crlf, nul. By default the framing is detected in the way compatible with older releases. See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#message-framing")
+
 	useLocalTimestampTCP = flagutil.NewArrayBool("syslog.useLocalTimestamp.tcp", "Whether to use local timestamp instead of the original timestamp for the ingested syslog messages "+
 		"at the corresponding -syslog.listenAddr.tcp. See https://docs.victoriametrics.com/victorialogs/data-ingestion/syslog/#log-timestamps")
 	useLocalTimestampUDP = flagutil.NewArrayBool("syslog.useLocalTimestamp.udp", "Whether to use local timestamp instead of the original timestamp for the ingested syslog messages "+
@@ -168,15 +183,54 @@ func MustInit() {
 		}
 	}()
 
-	if *syslogTimezone != "" {
-		tz, err := time.LoadLocation(*syslogTimezone)
-		if err != nil {
-			logger.Fatalf("cannot parse -syslog.timezone=%q: %s", *syslogTimezone, err)
+	tz, err := getTimezone()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	globalTimezone = tz
+}
+
+func getTimezone() (*time.Location, error) {
+	if *syslogTimezone == "" {
+		return time.Local, nil
+	}
+	tz, err := time.LoadLocation(*syslogTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -syslog.timezone=%q: %w", *syslogTimezone, err)
+	}
+	return tz, nil
+}
+
+// IsEnabled returns true if Syslog listeners are configured via -syslog.listenAddr.* command-line flags.
+func IsEnabled() bool {
+	return len(*listenAddrTCP) > 0 || len(*listenAddrUDP) > 0 || len(*listenAddrUnix) > 0
+}
+
+// CheckConfig verifies -syslog.* command-line flags without starting syslog listeners.
+func CheckConfig() error {
+	var errs []error
+	if _, err := getTimezone(); err != nil {
+		errs = append(errs, err)
+	}
+	for argIdx, addr := range *listenAddrTCP {
+		if _, err := getTLSConfig(argIdx); err != nil {
+			errs = append(errs, fmt.Errorf("invalid TLS config for -syslog.listenAddr.tcp=%q: %w", addr, err))
+		}
+		if _, err := getConfigs("tcp", argIdx, streamFieldsTCP, ignoreFieldsTCP, decolorizeFieldsTCP, extraFieldsTCP, tenantIDTCP, compressMethodTCP, trailerTCP, useLocalTimestampTCP, useRemoteIPTCP); err != nil {
+			errs = append(errs, fmt.Errorf("cannot parse configs for -syslog.listenAddr.tcp=%q: %w", addr, err))
 		}
-		globalTimezone = tz
-	} else {
-		globalTimezone = time.Local
 	}
+	for argIdx, addr := range *listenAddrUDP {
+		if _, err := getConfigs("udp", argIdx, streamFieldsUDP, ignoreFieldsUDP, decolorizeFieldsUDP, extraFieldsUDP, tenantIDUDP, compressMethodUDP, trailerUDP, useLocalTimestampUDP, useRemoteIPUDP); err != nil {
+			errs = append(errs, fmt.Errorf("cannot parse configs for -syslog.listenAddr.udp=%q: %w", addr, err))
+		}
+	}
+	for argIdx, addr := range *listenAddrUnix {
+		if _, err := getConfigs("unix", argIdx, streamFieldsUnix, ignoreFieldsUnix, decolorizeFieldsUnix, extraFieldsUnix, tenantIDUnix, compressMethodUnix, trailerUnix, useLocalTimestampUnix, useRemoteIPUnix); err != nil {
+			errs = append(errs, fmt.Errorf("cannot parse configs for -syslog.listenAddr.unix=%q: %w", addr, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 var (
@@ -197,7 +251,7 @@ func MustStop() {
 }
 
 func runUnixListener(addr string, argIdx int) {
-	cfg, err := getConfigs("unix", argIdx, streamFieldsUnix, ignoreFieldsUnix, decolorizeFieldsUnix, extraFieldsUnix, tenantIDUnix, compressMethodUnix, useLocalTimestampUnix, useRemoteIPUnix)
+	cfg, err := getConfigs("unix", argIdx, streamFieldsUnix, ignoreFieldsUnix, decolorizeFieldsUnix, extraFieldsUnix, tenantIDUnix, compressMethodUnix, trailerUnix, useLocalTimestampUnix, useRemoteIPUnix)
 	if err != nil {
 		logger.Fatalf("cannot parse configs for -syslog.listenAddr.unix=%q: %s", addr, err)
 	}
@@ -273,7 +327,7 @@ func runUDPListener(addr string, argIdx int) {
 		logger.Fatalf("cannot start UDP syslog server at %q: %s", addr, err)
 	}
 
-	cfg, err := getConfigs("udp", argIdx, streamFieldsUDP, ignoreFieldsUDP, decolorizeFieldsUDP, extraFieldsUDP, tenantIDUDP, compressMethodUDP, useLocalTimestampUDP, useRemoteIPUDP)
+	cfg, err := getConfigs("udp", argIdx, streamFieldsUDP, ignoreFieldsUDP, decolorizeFieldsUDP, extraFieldsUDP, tenantIDUDP, compressMethodUDP, trailerUDP, useLocalTimestampUDP, useRemoteIPUDP)
 	if err != nil {
 		logger.Fatalf("cannot parse configs for -syslog.listenAddr.udp=%q: %s", addr, err)
 	}
@@ -293,24 +347,40 @@ func runUDPListener(addr string, argIdx int) {
 	logger.Infof("finished accepting syslog messages at -syslog.listenAddr.udp=%q", addr)
 }
 
-func runTCPListener(addr string, argIdx int) {
-	var tlsConfig *tls.Config
-	if tlsEnable.GetOptionalArg(argIdx) {
-		certFile := tlsCertFile.GetOptionalArg(argIdx)
-		keyFile := tlsKeyFile.GetOptionalArg(argIdx)
-		tc, err := netutil.GetServerTLSConfig(certFile, keyFile, *tlsMinVersion, *tlsCipherSuites)
-		if err != nil {
-			logger.Fatalf("cannot load TLS cert from -syslog.tlsCertFile=%q, -syslog.tlsKeyFile=%q, -syslog.tlsMinVersion=%q, -syslog.tlsCipherSuites=%q: %s",
-				certFile, keyFile, *tlsMinVersion, *tlsCipherSuites, err)
+// getTLSConfig returns TLS config for -syslog.listenAddr.tcp at the given argIdx.
+//
+// nil is returned if TLS isn't enabled for the given listener.
+func getTLSConfig(argIdx int) (*tls.Config, error) {
+	if !tlsEnable.GetOptionalArg(argIdx) {
+		return nil, nil
+	}
+	certFile := tlsCertFile.GetOptionalArg(argIdx)
+	keyFile := tlsKeyFile.GetOptionalArg(argIdx)
+	tc, err := netutil.GetServerTLSConfig(certFile, keyFile, *tlsMinVersion, *tlsCipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS cert from -syslog.tlsCertFile=%q, -syslog.tlsKeyFile=%q, -syslog.tlsMinVersion=%q, -syslog.tlsCipherSuites=%q: %w",
+			certFile, keyFile, *tlsMinVersion, *tlsCipherSuites, err)
+	}
+	if mtlsEnable.GetOptionalArg(argIdx) {
+		caFile := mtlsCAFile.GetOptionalArg(argIdx)
+		if err := setClientCertVerification(tc, caFile); err != nil {
+			return nil, fmt.Errorf("cannot set up client certificate verification with -syslog.mtlsCAFile=%q: %w", caFile, err)
 		}
-		tlsConfig = tc
+	}
+	return tc, nil
+}
+
+func runTCPListener(addr string, argIdx int) {
+	tlsConfig, err := getTLSConfig(argIdx)
+	if err != nil {
+		logger.Fatalf("%s", err)
 	}
 	ln, err := netutil.NewTCPListener("syslog", addr, false, tlsConfig)
 	if err != nil {
 		logger.Fatalf("syslog: cannot start TCP listener at %s: %s", addr, err)
 	}
 
-	cfg, err := getConfigs("tcp", argIdx, streamFieldsTCP, ignoreFieldsTCP, decolorizeFieldsTCP, extraFieldsTCP, tenantIDTCP, compressMethodTCP, useLocalTimestampTCP, useRemoteIPTCP)
+	cfg, err := getConfigs("tcp", argIdx, streamFieldsTCP, ignoreFieldsTCP, decolorizeFieldsTCP, extraFieldsTCP, tenantIDTCP, compressMethodTCP, trailerTCP, useLocalTimestampTCP, useRemoteIPTCP)
 	if err != nil {
 		logger.Fatalf("cannot parse configs for -syslog.listenAddr.tcp=%q: %s", addr, err)
 	}
@@ -330,6 +400,27 @@ func runTCPListener(addr string, argIdx int) {
 	logger.Infof("finished accepting syslog messages at -syslog.listenAddr.tcp=%q", addr)
 }
 
+// setClientCertVerification configures tc to require and verify client certificates.
+//
+// Client certificates are verified against root CA certificates from caFile if it isn't empty.
+// Otherwise the host system root CA certificates are used.
+func setClientCertVerification(tc *tls.Config, caFile string) error {
+	tc.ClientAuth = tls.RequireAndVerifyClientCert
+	if caFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("cannot read root CA file: %w", err)
+	}
+	cp := x509.NewCertPool()
+	if !cp.AppendCertsFromPEM(data) {
+		return fmt.Errorf("cannot find PEM-encoded certificates in %q", caFile)
+	}
+	tc.ClientCAs = cp
+	return nil
+}
+
 func servePacketListener(ln net.PacketConn, cfg *configs) {
 	gomaxprocs := cgroup.AvailableCPUs()
 	var wg sync.WaitGroup
@@ -366,7 +457,7 @@ func servePacketListener(ln net.PacketConn, cfg *configs) {
 
 				remoteIP := getRemoteIP(remoteAddr, cfg.useRemoteIP)
 
-				if err := processStream(cfg.typ, bb.NewReader(), cfg.compressMethod, cfg.useLocalTimestamp, remoteIP, cp); err != nil {
+				if err := processStream(cfg.typ, bb.NewReader(), cfg.compressMethod, cfg.trailer, cfg.useLocalTimestamp, remoteIP, cp); err != nil {
 					logger.Errorf("syslog: cannot process %s data from %s at %s: %s", cfg.typ, remoteAddr, localAddr, err)
 				}
 			}
@@ -409,7 +500,7 @@ func serveStreamListener(ln net.Listener, cfg *configs) {
 
 			remoteAddr := c.RemoteAddr()
 			remoteIP := getRemoteIP(remoteAddr, cfg.useRemoteIP)
-			if err := processStream(cfg.typ, c, cfg.compressMethod, cfg.useLocalTimestamp, remoteIP, cp); err != nil {
+			if err := processStream(cfg.typ, c, cfg.compressMethod, cfg.trailer, cfg.useLocalTimestamp, remoteIP, cp); err != nil {
 				logger.Errorf("syslog: cannot process %s data at %q: %s", cfg.typ, addr, err)
 			}
 
@@ -424,33 +515,38 @@ func serveStreamListener(ln net.Listener, cfg *configs) {
 }
 
 // processStream parses a stream of syslog messages from r and ingests them into vlstorage.
-func processStream(protocol string, r io.Reader, compressMethod string, useLocalTimestamp bool, remoteIP string, cp *insertutil.CommonParams) error {
+func processStream(protocol string, r io.Reader, compressMethod string, trailer messageTrailer, useLocalTimestamp bool, remoteIP string, cp *insertutil.CommonParams) error {
 	if err := insertutil.CanWriteData(); err != nil {
 		return err
 	}
 
-	lmp := cp.NewLogMessageProcessor("syslog_"+protocol, true)
-	err := processStreamInternal(r, compressMethod, useLocalTimestamp, remoteIP, lmp)
+	protocolName := "syslog_" + protocol
+	im := cp.GetIngestionMetrics(protocolName)
+	lmp := cp.NewLogMessageProcessor(protocolName, true)
+	err := processStreamInternal(im.NewReceivedBytesReader(r), compressMethod, trailer, useLocalTimestamp, remoteIP, lmp, im)
 	lmp.MustClose()
+	if err != nil {
+		im.AddParseErrors(1)
+	}
 
 	return err
 }
 
-func processStreamInternal(r io.Reader, compressMethod string, useLocalTimestamp bool, remoteIP string, lmp insertutil.LogMessageProcessor) error {
+func processStreamInternal(r io.Reader, compressMethod string, trailer messageTrailer, useLocalTimestamp bool, remoteIP string, lmp insertutil.LogMessageProcessor, im *insertutil.IngestionMetrics) error {
 	reader, err := protoparserutil.GetUncompressedReader(r, compressMethod)
 	if err != nil {
 		return fmt.Errorf("cannot decode syslog data: %w", err)
 	}
 	defer protoparserutil.PutUncompressedReader(reader)
 
-	return processUncompressedStream(reader, useLocalTimestamp, remoteIP, lmp)
+	return processUncompressedStream(im.NewUncompressedBytesReader(reader), trailer, useLocalTimestamp, remoteIP, lmp)
 }
 
-func processUncompressedStream(r io.Reader, useLocalTimestamp bool, remoteIP string, lmp insertutil.LogMessageProcessor) error {
+func processUncompressedStream(r io.Reader, trailer messageTrailer, useLocalTimestamp bool, remoteIP string, lmp insertutil.LogMessageProcessor) error {
 	wcr := writeconcurrencylimiter.GetReader(r)
 	defer writeconcurrencylimiter.PutReader(wcr)
 
-	slr := getSyslogLineReader(wcr)
+	slr := getSyslogLineReader(wcr, trailer)
 	defer putSyslogLineReader(slr)
 
 	n := 0
@@ -472,16 +568,67 @@ func processUncompressedStream(r io.Reader, useLocalTimestamp bool, remoteIP str
 	return slr.Error()
 }
 
+// messageTrailer is the trailer for syslog messages sent with non-transparent framing.
+//
+// See https://datatracker.ietf.org/doc/html/rfc6587#section-3.4.2
+type messageTrailer int
+
+const (
+	// trailerDefault delimits messages with '\n' char in the way compatible with older releases.
+	//
+	// It is used when the trailer isn't set explicitly. See syslogLineReader.nextLineDefault.
+	trailerDefault messageTrailer = iota
+
+	// trailerLF delimits messages with '\n' char.
+	trailerLF
+
+	// trailerCRLF delimits messages with "\r\n" chars.
+	trailerCRLF
+
+	// trailerNUL delimits messages with 0 char.
+	trailerNUL
+)
+
+func parseMessageTrailer(s string) (messageTrailer, error) {
+	switch s {
+	case "":
+		return trailerDefault, nil
+	case "lf":
+		return trailerLF, nil
+	case "crlf":
+		return trailerCRLF, nil
+	case "nul":
+		return trailerNUL, nil
+	default:
+		return 0, fmt.Errorf("unsupported trailer %q; supported values: 'lf', 'crlf', 'nul'", s)
+	}
+}
+
+// delimiter returns the char, which ends messages with the given mt trailer.
+func (mt messageTrailer) delimiter() byte {
+	if mt == trailerNUL {
+		return 0
+	}
+	return '\n'
+}
+
+// isFrameSeparator returns true if c may be skipped between messages with the given mt trailer.
+func (mt messageTrailer) isFrameSeparator(c byte) bool {
+	return c == '\n' || c == mt.delimiter() || (mt == trailerCRLF && c == '\r')
+}
+
 type syslogLineReader struct {
 	line []byte
 
-	br  *bufio.Reader
-	err error
+	br      *bufio.Reader
+	trailer messageTrailer
+	err     error
 }
 
-func (slr *syslogLineReader) reset(r io.Reader) {
+func (slr *syslogLineReader) reset(r io.Reader, trailer messageTrailer) {
 	slr.line = slr.line[:0]
 	slr.br.Reset(r)
+	slr.trailer = trailer
 	slr.err = nil
 }
 
@@ -495,13 +642,68 @@ func (slr *syslogLineReader) Error() error {
 
 // nextLine reads the next syslog line from slr and stores it at slr.line.
 //
+// Both octet-counting and non-transparent framing are supported, and they can be mixed in a single stream.
+// See https://datatracker.ietf.org/doc/html/rfc6587#section-3.4
+//
 // false is returned if the next line cannot be read. Error() must be called in this case
 // in order to verify whether there is an error or just slr stream has been finished.
 func (slr *syslogLineReader) nextLine() bool {
 	if slr.err != nil {
 		return false
 	}
+	if slr.trailer == trailerDefault {
+		return slr.nextLineDefault()
+	}
 
+	// Skip empty lines and trailers between messages.
+	for {
+		c, err := slr.br.ReadByte()
+		if err != nil {
+			slr.err = err
+			return false
+		}
+		if !slr.trailer.isFrameSeparator(c) {
+			_ = slr.br.UnreadByte()
+			break
+		}
+	}
+
+	if slr.hasOctetCountingPrefix() {
+		// This is octet-counting method. See https://datatracker.ietf.org/doc/html/rfc6587#section-3.4.1
+		return slr.readOctetCountingMessage()
+	}
+
+	// This is non-transparent framing method. See https://datatracker.ietf.org/doc/html/rfc6587#section-3.4.2
+	delimiter := slr.trailer.delimiter()
+	slr.line = slr.line[:0]
+	for {
+		line, err := slr.br.ReadSlice(delimiter)
+		if err == nil {
+			slr.line = append(slr.line, line[:len(line)-1]...)
+			break
+		}
+		if err == io.EOF {
+			slr.line = append(slr.line, line...)
+			break
+		}
+		if err == bufio.ErrBufferFull {
+			slr.line = append(slr.line, line...)
+			continue
+		}
+		slr.err = fmt.Errorf("cannot read message in non-transparent framing method: %w", err)
+		return false
+	}
+	if slr.trailer == trailerCRLF && len(slr.line) > 0 && slr.line[len(slr.line)-1] == '\r' {
+		slr.line = slr.line[:len(slr.line)-1]
+	}
+	return true
+}
+
+// nextLineDefault reads the next syslog line in the way compatible with older releases.
+//
+// The message length for octet-counting framing is read until the first space, while messages with non-transparent framing end with '\n'.
+// Empty lines between messages are skipped.
+func (slr *syslogLineReader) nextLineDefault() bool {
 again:
 	prefix, err := slr.br.ReadSlice(' ')
 	if err != nil {
@@ -524,7 +726,7 @@ again:
 	}
 
 	if prefix[0] >= '0' && prefix[0] <= '9' {
-		// This is octet-counting method. See https://www.ietf.org/archive/id/draft-gerhards-syslog-plain-tcp-07.html#msgxfer
+		// This is octet-counting method. See https://datatracker.ietf.org/doc/html/rfc6587#section-3.4.1
 		msgLenStr := bytesutil.ToUnsafeString(prefix[:len(prefix)-1])
 		msgLen, err := strconv.ParseUint(msgLenStr, 10, 64)
 		if err != nil {
@@ -543,7 +745,7 @@ again:
 		return true
 	}
 
-	// This is octet-stuffing method. See https://www.ietf.org/archive/id/draft-gerhards-syslog-plain-tcp-07.html#octet-stuffing-legacy
+	// This is non-transparent framing method. See https://datatracker.ietf.org/doc/html/rfc6587#section-3.4.2
 	slr.line = append(slr.line[:0], prefix...)
 	for {
 		line, err := slr.br.ReadSlice('\n')
@@ -559,21 +761,90 @@ again:
 			slr.line = append(slr.line, line...)
 			continue
 		}
-		slr.err = fmt.Errorf("cannot read message in octet-stuffing method: %w", err)
+		slr.err = fmt.Errorf("cannot read message in non-transparent framing method: %w", err)
+		return false
+	}
+}
+
+// maxMsgLenDigits is the maximum number of digits in the message length for octet-counting framing.
+const maxMsgLenDigits = 10
+
+// hasOctetCountingPrefix returns true if the next message at slr starts with "MSG-LEN SP <" prefix used in octet-counting framing.
+//
+// Messages without PRI part may start with digits, so they are read with non-transparent framing if the prefix is missing.
+// See https://datatracker.ietf.org/doc/html/rfc6587#section-3.4.1
+func (slr *syslogLineReader) hasOctetCountingPrefix() bool {
+	// Peek the prefix char by char, since Peek blocks until the requested number of bytes is read.
+	for i := 1; i <= maxMsgLenDigits+1; i++ {
+		b, err := slr.br.Peek(i)
+		if err != nil {
+			return false
+		}
+		c := b[i-1]
+		if c >= '0' && c <= '9' {
+			continue
+		}
+		if c != ' ' || i == 1 {
+			return false
+		}
+		b, err = slr.br.Peek(i + 1)
+		return err == nil && b[i] == '<'
+	}
+	return false
+}
+
+func (slr *syslogLineReader) readOctetCountingMessage() bool {
+	// Do not use ReadSlice(' ') for reading the message length, since it may read the whole message
+	// if the message length is invalid.
+	var prefix []byte
+	for i := 1; ; i++ {
+		b, err := slr.br.Peek(i)
+		if err != nil {
+			slr.err = fmt.Errorf("cannot read message length from %q: %w", b, err)
+			return false
+		}
+		c := b[i-1]
+		if c == ' ' {
+			prefix = b[:i-1]
+			break
+		}
+		if c < '0' || c > '9' || i > maxMsgLenDigits {
+			slr.err = fmt.Errorf("cannot parse message length from %q", b)
+			return false
+		}
+	}
+
+	msgLenStr := bytesutil.ToUnsafeString(prefix)
+	msgLen, err := strconv.ParseUint(msgLenStr, 10, 64)
+	if err != nil {
+		slr.err = fmt.Errorf("cannot parse message length from %q: %w", msgLenStr, err)
 		return false
 	}
+	if maxMsgLen := insertutil.MaxLineSizeBytes.IntN(); msgLen > uint64(maxMsgLen) {
+		slr.err = fmt.Errorf("cannot read message longer than %d bytes; msgLen=%d", maxMsgLen, msgLen)
+		return false
+	}
+	_, _ = slr.br.Discard(len(prefix) + 1)
+
+	slr.line = slicesutil.SetLength(slr.line, int(msgLen))
+	if _, err := io.ReadFull(slr.br, slr.line); err != nil {
+		slr.err = fmt.Errorf("cannot read message with size %d bytes: %w", msgLen, err)
+		return false
+	}
+	return true
 }
 
-func getSyslogLineReader(r io.Reader) *syslogLineReader {
+func getSyslogLineReader(r io.Reader, trailer messageTrailer) *syslogLineReader {
 	v := syslogLineReaderPool.Get()
 	if v == nil {
 		br := bufio.NewReaderSize(r, 64*1024)
 		return &syslogLineReader{
-			br: br,
+			br:      br,
+			trailer: trailer,
 		}
 	}
 	slr := v.(*syslogLineReader)
-	slr.reset(r)
+	slr.reset(r, trailer)
 	return slr
 }
 
@@ -684,11 +955,12 @@ type configs struct {
 	extraFields       []logstorage.Field
 	tenantID          logstorage.TenantID
 	compressMethod    string
+	trailer           messageTrailer
 	useLocalTimestamp bool
 	useRemoteIP       bool
 }
 
-func getConfigs(typ string, argIdx int, streamFieldsArg, ignoreFieldsArg, decolorizeFieldsArg, extraFieldsArg, tenantIDArg, compressMethodArg *flagutil.ArrayString,
+func getConfigs(typ string, argIdx int, streamFieldsArg, ignoreFieldsArg, decolorizeFieldsArg, extraFieldsArg, tenantIDArg, compressMethodArg, trailerArg *flagutil.ArrayString,
 	useLocalTimestampArg, useRemoteIPArg *flagutil.ArrayBool) (*configs, error) {
 
 	streamFieldsStr := streamFieldsArg.GetOptionalArg(argIdx)
@@ -729,6 +1001,12 @@ func getConfigs(typ string, argIdx int, streamFieldsArg, ignoreFieldsArg, decolo
 		return nil, fmt.Errorf("unsupported -syslog.compressMethod.%s=%q; supported values: 'none', 'zstd', 'gzip', 'deflate'", typ, compressMethod)
 	}
 
+	trailerStr := trailerArg.GetOptionalArg(argIdx)
+	trailer, err := parseMessageTrailer(trailerStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -syslog.trailer.%s=%q: %w", typ, trailerStr, err)
+	}
+
 	useLocalTimestamp := useLocalTimestampArg.GetOptionalArg(argIdx)
 	useRemoteIP := useRemoteIPArg.GetOptionalArg(argIdx)
 
@@ -740,6 +1018,7 @@ func getConfigs(typ string, argIdx int, streamFieldsArg, ignoreFieldsArg, decolo
 		extraFields:       extraFields,
 		tenantID:          tenantID,
 		compressMethod:    compressMethod,
+		trailer:           trailer,
 		useLocalTimestamp: useLocalTimestamp,
 		useRemoteIP:       useRemoteIP,
 	}, nil
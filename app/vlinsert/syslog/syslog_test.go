@@ -7,14 +7,17 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
+var testIngestionMetrics = insertutil.GetIngestionMetrics("test", logstorage.TenantID{})
+
 func TestSyslogLineReader_Success(t *testing.T) {
 	f := func(data string, linesExpected []string) {
 		t.Helper()
 
 		r := bytes.NewBufferString(data)
-		slr := getSyslogLineReader(r)
+		slr := getSyslogLineReader(r, trailerDefault)
 		defer putSyslogLineReader(slr)
 
 		var lines []string
@@ -50,28 +53,110 @@ func TestSyslogLineReader_Success(t *testing.T) {
 	})
 }
 
-func TestSyslogLineReader_Failure(t *testing.T) {
-	f := func(data string) {
+func TestSyslogLineReader_Trailer(t *testing.T) {
+	f := func(data string, trailer messageTrailer, linesExpected []string) {
 		t.Helper()
 
 		r := bytes.NewBufferString(data)
-		slr := getSyslogLineReader(r)
+		slr := getSyslogLineReader(r, trailer)
 		defer putSyslogLineReader(slr)
 
-		if slr.nextLine() {
-			t.Fatalf("expecting failure to read the first line")
+		var lines []string
+		for slr.nextLine() {
+			lines = append(lines, string(slr.line))
 		}
-		if err := slr.Error(); err == nil {
-			t.Fatalf("expecting non-nil error")
+		if err := slr.Error(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(lines, linesExpected) {
+			t.Fatalf("unexpected lines read;\ngot\n%q\nwant\n%q", lines, linesExpected)
+		}
+	}
+
+	// lf trailer
+	f("<13>foo bar\n<14>baz\r\n", trailerLF, []string{"<13>foo bar", "<14>baz\r"})
+	f("foobar\n", trailerLF, []string{"foobar"})
+	f("\n\nfoo\n\nbar\n\n", trailerLF, []string{"foo", "bar"})
+
+	// crlf trailer
+	f("<13>foo bar\r\n\r\n<14>baz\r\n", trailerCRLF, []string{"<13>foo bar", "<14>baz"})
+	f("<13>foo\n<14>bar", trailerCRLF, []string{"<13>foo", "<14>bar"})
+
+	// nul trailer
+	f("<13>foo\nbar\x00\x00<14>baz\x00", trailerNUL, []string{"<13>foo\nbar", "<14>baz"})
+
+	// mixed octet-counting and non-transparent framing
+	f("7 <13>foo<14>bar\x009 <15>a\x00bcd", trailerNUL, []string{"<13>foo", "<14>bar", "<15>a\x00bcd"})
+	f("<13>foo\n7 <14>bar\n<15>baz", trailerLF, []string{"<13>foo", "<14>bar", "<15>baz"})
+
+	// messages without PRI part, which start with digits, are read with non-transparent framing
+	f("2024-01-02T03:04:05Z host app: foo\n<13>bar\n", trailerLF, []string{"2024-01-02T03:04:05Z host app: foo", "<13>bar"})
+	f("12 foo bar\n7 <14>baz", trailerLF, []string{"12 foo bar", "<14>baz"})
+	f("123\n12foo bar\n", trailerLF, []string{"123", "12foo bar"})
+	f("12345678901 <13>foo\x00", trailerNUL, []string{"12345678901 <13>foo"})
+}
+
+func TestParseMessageTrailer(t *testing.T) {
+	f := func(s string, trailerExpected messageTrailer) {
+		t.Helper()
+
+		trailer, err := parseMessageTrailer(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if trailer != trailerExpected {
+			t.Fatalf("unexpected trailer; got %d; want %d", trailer, trailerExpected)
 		}
 	}
 
+	f("", trailerDefault)
+	f("lf", trailerLF)
+	f("crlf", trailerCRLF)
+	f("nul", trailerNUL)
+
+	if _, err := parseMessageTrailer("foo"); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported trailer")
+	}
+}
+
+func TestSyslogLineReader_Failure(t *testing.T) {
+	fTrailers := func(data string, trailers ...messageTrailer) {
+		t.Helper()
+
+		for _, trailer := range trailers {
+			r := bytes.NewBufferString(data)
+			slr := getSyslogLineReader(r, trailer)
+
+			if slr.nextLine() {
+				t.Fatalf("expecting failure to read the first line for trailer %d", trailer)
+			}
+			if err := slr.Error(); err == nil {
+				t.Fatalf("expecting non-nil error for trailer %d", trailer)
+			}
+			putSyslogLineReader(slr)
+		}
+	}
+	f := func(data string) {
+		t.Helper()
+		fTrailers(data, trailerDefault, trailerLF)
+	}
+
+	// Messages without "MSG-LEN SP <" prefix are read with non-transparent framing if the trailer is set.
+	fDefault := func(data string) {
+		t.Helper()
+		fTrailers(data, trailerDefault)
+	}
+
 	// invalid format for message size
-	f("12foo bar")
+	fDefault("12foo bar")
+	fDefault("12345678901 foo")
+	fDefault("123")
 
 	// too big message size
-	f("123 aa")
-	f("1233423432 abc")
+	fDefault("123 aa")
+	fDefault("1233423432 abc")
+	f("123 <13>aa")
+	f("1233423432 <13>abc")
 }
 
 func TestProcessStreamInternal_Success(t *testing.T) {
@@ -86,7 +171,7 @@ func TestProcessStreamInternal_Success(t *testing.T) {
 
 		tlp := &insertutil.TestLogMessageProcessor{}
 		r := bytes.NewBufferString(data)
-		if err := processStreamInternal(r, "", false, "1.2.3.4", tlp); err != nil {
+		if err := processStreamInternal(r, "", trailerDefault, false, "1.2.3.4", tlp, testIngestionMetrics); err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
 		if err := tlp.Verify(timestampsExpected, resultExpected); err != nil {
@@ -117,7 +202,7 @@ func TestProcessStreamInternal_Failure(t *testing.T) {
 
 		tlp := &insertutil.TestLogMessageProcessor{}
 		r := bytes.NewBufferString(data)
-		if err := processStreamInternal(r, "", false, "1.2.3.4", tlp); err == nil {
+		if err := processStreamInternal(r, "", trailerDefault, false, "1.2.3.4", tlp, testIngestionMetrics); err == nil {
 			t.Fatalf("expecting non-nil error")
 		}
 	}
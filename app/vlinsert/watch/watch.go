@@ -0,0 +1,647 @@
+package watch
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	watchPath = flag.String("watch.path", "", "Path to a file for storing watches created via /insert/watches API. "+
+		"The /insert/watches API is disabled if this flag is empty; see https://docs.victoriametrics.com/victorialogs/data-ingestion/#watches")
+	maxWatches = flag.Int("watch.maxWatches", 100, "The maximum number of watches, which can be created via /insert/watches API. "+
+		"Every watch is evaluated against every ingested log, so big number of watches may slow down data ingestion")
+	webhookFlushInterval = flag.Duration("watch.webhookFlushInterval", time.Second, "The maximum interval between sending matching logs to webhook_url of watches")
+)
+
+// maxWatchSize is the maximum size of a watch in JSON, which can be passed to /insert/watches API.
+const maxWatchSize = 64 * 1024
+
+// subscriberBufferSize is the maximum number of pending matching logs per every subscriber.
+//
+// Matching logs are dropped if the subscriber cannot keep up with them.
+const subscriberBufferSize = 1024
+
+// webhookBatchSize is the maximum number of matching logs to send in a single request to webhook_url.
+const webhookBatchSize = 1000
+
+var (
+	storagePath string
+
+	// watchersLock serializes modifications of watchers.
+	watchersLock sync.Mutex
+
+	// watchers contains the currently active watchers. It is read without locks at data ingestion path.
+	watchers atomic.Pointer[[]*watcher]
+)
+
+// Init initializes watches.
+//
+// Watches are loaded from -watch.path if it is set.
+func Init() {
+	if *watchPath == "" {
+		return
+	}
+	ws, err := loadWatches(*watchPath)
+	if err != nil {
+		logger.Fatalf("cannot load watches from -watch.path=%q: %s", *watchPath, err)
+	}
+
+	storagePath = *watchPath
+	a := make([]*watcher, 0, len(ws))
+	for _, w := range ws {
+		wr, err := newWatcher(w)
+		if err != nil {
+			logger.Fatalf("cannot initialize watch from -watch.path=%q: %s", *watchPath, err)
+		}
+		a = append(a, wr)
+	}
+	watchers.Store(&a)
+
+	insertutil.AddLogRowsWatcher(&logRowsWatcher{})
+}
+
+// CheckConfig verifies watches persisted at -watch.path without starting them.
+func CheckConfig() error {
+	if *watchPath == "" {
+		return nil
+	}
+	ws, err := loadWatches(*watchPath)
+	if err != nil {
+		return fmt.Errorf("cannot load watches from -watch.path=%q: %w", *watchPath, err)
+	}
+	for _, w := range ws {
+		if _, err := w.parseFilter(); err != nil {
+			return fmt.Errorf("cannot initialize watch %q from -watch.path=%q: %w", w.ID, *watchPath, err)
+		}
+	}
+	return nil
+}
+
+// Stop stops watches.
+func Stop() {
+	if storagePath == "" {
+		return
+	}
+
+	watchersLock.Lock()
+	defer watchersLock.Unlock()
+
+	for _, wr := range getWatchers() {
+		wr.stop()
+	}
+	watchers.Store(nil)
+	storagePath = ""
+}
+
+func getWatchers() []*watcher {
+	p := watchers.Load()
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// RequestHandler handles /insert/watches requests.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#watches
+func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
+	if path != "/insert/watches" && !strings.HasPrefix(path, "/insert/watches/") {
+		return false
+	}
+	watchRequests.Inc()
+
+	if storagePath == "" {
+		httpserver.Errorf(w, r, "/insert/watches API is disabled; pass -watch.path command-line flag for enabling it; "+
+			"see https://docs.victoriametrics.com/victorialogs/data-ingestion/#watches")
+		return true
+	}
+
+	tenantID, err := logstorage.GetTenantIDFromRequest(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain tenantID: %s", err)
+		return true
+	}
+
+	id := strings.TrimPrefix(path, "/insert/watches")
+	id = strings.TrimPrefix(id, "/")
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{
+				"watches": listWatches(tenantID),
+			})
+		case http.MethodPost:
+			wt, err := readWatch(r)
+			if err != nil {
+				httpserver.Errorf(w, r, "%s", err)
+				return true
+			}
+			wt, err = createWatch(tenantID, wt)
+			if err != nil {
+				httpserver.Errorf(w, r, "cannot create watch: %s", err)
+				return true
+			}
+			writeJSON(w, http.StatusCreated, wt)
+		default:
+			writeMethodNotAllowed(w, r)
+		}
+		return true
+	}
+
+	if n := strings.IndexByte(id, '/'); n >= 0 {
+		if id[n+1:] != "stream" {
+			return false
+		}
+		id = id[:n]
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r)
+			return true
+		}
+		wr := getWatcher(tenantID, id)
+		if wr == nil {
+			httpserver.Errorf(w, r, "%s", newNotFoundError(id))
+			return true
+		}
+		streamMatches(w, r, wr)
+		return true
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		wr := getWatcher(tenantID, id)
+		if wr == nil {
+			httpserver.Errorf(w, r, "%s", newNotFoundError(id))
+			return true
+		}
+		writeJSON(w, http.StatusOK, wr.w)
+	case http.MethodDelete:
+		if err := deleteWatch(tenantID, id); err != nil {
+			httpserver.Errorf(w, r, "cannot delete watch: %s", err)
+			return true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+	return true
+}
+
+func streamMatches(w http.ResponseWriter, r *http.Request, wr *watcher) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logger.Panicf("BUG: it is expected that http.ResponseWriter (%T) supports http.Flusher interface", w)
+	}
+
+	ch := wr.subscribe()
+	if ch == nil {
+		httpserver.Errorf(w, r, "%s", newNotFoundError(wr.w.ID))
+		return
+	}
+	defer wr.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctxDone := r.Context().Done()
+	for {
+		select {
+		case <-ctxDone:
+			return
+		case line, ok := <-ch:
+			if !ok {
+				// The watch has been deleted.
+				return
+			}
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+var (
+	watchRequests = metrics.NewCounter(`vl_http_requests_total{path="/insert/watches"}`)
+
+	matchesTotal        = metrics.NewCounter(`vl_watch_matches_total`)
+	droppedMatchesTotal = metrics.NewCounter(`vl_watch_dropped_matches_total`)
+	webhookErrorsTotal  = metrics.NewCounter(`vl_watch_webhook_errors_total`)
+	_                   = metrics.NewGauge(`vl_watch_subscribers`, func() float64 {
+		n := 0
+		for _, wr := range getWatchers() {
+			n += wr.subscribersCount()
+		}
+		return float64(n)
+	})
+)
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal %T to JSON: %s", v, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(data)
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	err := &httpserver.ErrorWithStatusCode{
+		Err:        fmt.Errorf("method %q isn't allowed", r.Method),
+		StatusCode: http.StatusMethodNotAllowed,
+	}
+	httpserver.Errorf(w, r, "%s", err)
+}
+
+func newNotFoundError(id string) error {
+	return &httpserver.ErrorWithStatusCode{
+		Err:        fmt.Errorf("cannot find watch with id=%q", id),
+		StatusCode: http.StatusNotFound,
+	}
+}
+
+func readWatch(r *http.Request) (*Watch, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxWatchSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read watch from request body: %w", err)
+	}
+	if len(data) > maxWatchSize {
+		return nil, fmt.Errorf("too big watch; it mustn't exceed %d bytes", maxWatchSize)
+	}
+
+	var wt Watch
+	if err := json.Unmarshal(data, &wt); err != nil {
+		return nil, fmt.Errorf("cannot parse watch: %w", err)
+	}
+	if _, err := wt.parseFilter(); err != nil {
+		return nil, fmt.Errorf("invalid watch: %w", err)
+	}
+	return &wt, nil
+}
+
+// Watch is a persistent LogsQL filter, which is evaluated against the ingested logs.
+type Watch struct {
+	// ID is an unique id of the watch. It is generated when the watch is created.
+	ID string `json:"id"`
+
+	// AccountID and ProjectID is the tenant for the watch. The watch is evaluated only against logs for this tenant.
+	AccountID uint32 `json:"account_id"`
+	ProjectID uint32 `json:"project_id"`
+
+	// Name is an optional name for the watch.
+	Name string `json:"name,omitempty"`
+
+	// Filter is LogsQL filter for selecting the matching logs.
+	Filter string `json:"filter"`
+
+	// WebhookURL is an optional url to send the matching logs to.
+	WebhookURL string `json:"webhook_url,omitempty"`
+
+	// CreatedAt is the time when the watch has been created.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (wt *Watch) parseFilter() (*logstorage.Filter, error) {
+	if wt.Filter == "" {
+		return nil, fmt.Errorf("missing filter")
+	}
+	f, err := logstorage.ParseFilter(wt.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse filter %q: %w", wt.Filter, err)
+	}
+	return f, nil
+}
+
+func (wt *Watch) tenantID() logstorage.TenantID {
+	return logstorage.TenantID{
+		AccountID: wt.AccountID,
+		ProjectID: wt.ProjectID,
+	}
+}
+
+func loadWatches(path string) ([]*Watch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ws []*Watch
+	if err := json.Unmarshal(data, &ws); err != nil {
+		return nil, fmt.Errorf("cannot parse watches: %w", err)
+	}
+	return ws, nil
+}
+
+// mustSaveWatchesLocked persists watches to storagePath.
+//
+// watchersLock must be locked by the caller.
+func mustSaveWatchesLocked(wrs []*watcher) {
+	ws := make([]*Watch, len(wrs))
+	for i, wr := range wrs {
+		ws[i] = wr.w
+	}
+	data, err := json.MarshalIndent(ws, "", "  ")
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal watches: %s", err)
+	}
+	fs.MustMkdirIfNotExist(filepath.Dir(storagePath))
+	fs.MustWriteAtomic(storagePath, data, true)
+}
+
+func listWatches(tenantID logstorage.TenantID) []*Watch {
+	ws := []*Watch{}
+	for _, wr := range getWatchers() {
+		if wr.tenantID == tenantID {
+			ws = append(ws, wr.w)
+		}
+	}
+	return ws
+}
+
+func getWatcher(tenantID logstorage.TenantID, id string) *watcher {
+	for _, wr := range getWatchers() {
+		if wr.tenantID == tenantID && wr.w.ID == id {
+			return wr
+		}
+	}
+	return nil
+}
+
+func createWatch(tenantID logstorage.TenantID, wt *Watch) (*Watch, error) {
+	watchersLock.Lock()
+	defer watchersLock.Unlock()
+
+	wrs := getWatchers()
+	if len(wrs) >= *maxWatches {
+		return nil, fmt.Errorf("cannot create more than -watch.maxWatches=%d watches", *maxWatches)
+	}
+
+	wt.ID = newWatchID()
+	wt.AccountID = tenantID.AccountID
+	wt.ProjectID = tenantID.ProjectID
+	wt.CreatedAt = time.Now().UTC()
+	wr, err := newWatcher(wt)
+	if err != nil {
+		return nil, err
+	}
+
+	// The watchers are updated in copy-on-write manner, since they are read without locks at data ingestion path.
+	wrsNew := append(slices.Clone(wrs), wr)
+	mustSaveWatchesLocked(wrsNew)
+	watchers.Store(&wrsNew)
+
+	return wt, nil
+}
+
+func deleteWatch(tenantID logstorage.TenantID, id string) error {
+	watchersLock.Lock()
+	defer watchersLock.Unlock()
+
+	wrs := getWatchers()
+	idx := slices.IndexFunc(wrs, func(wr *watcher) bool {
+		return wr.tenantID == tenantID && wr.w.ID == id
+	})
+	if idx < 0 {
+		return newNotFoundError(id)
+	}
+	wr := wrs[idx]
+
+	wrsNew := slices.Delete(slices.Clone(wrs), idx, idx+1)
+	mustSaveWatchesLocked(wrsNew)
+	watchers.Store(&wrsNew)
+
+	wr.stop()
+	return nil
+}
+
+func newWatchID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		logger.Panicf("FATAL: cannot generate random watch id: %s", err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// logRowsWatcher implements insertutil.LogRowsWatcher
+type logRowsWatcher struct{}
+
+// WatchLogRows sends logs from lr matching the registered watches to the watch subscribers.
+func (lrw *logRowsWatcher) WatchLogRows(lr *logstorage.LogRows) {
+	wrs := getWatchers()
+	if len(wrs) == 0 {
+		return
+	}
+	matchLogRows(wrs, lr)
+}
+
+func matchLogRows(wrs []*watcher, lr *logstorage.LogRows) {
+	var fields []logstorage.Field
+	var timestampBuf []byte
+	var line []byte
+	lr.ForEachRow(func(_ uint64, r *logstorage.InsertRow) {
+		fields = fields[:0]
+		for _, wr := range wrs {
+			if wr.tenantID != r.TenantID {
+				continue
+			}
+			if len(fields) == 0 {
+				fields, timestampBuf = insertutil.AppendInsertRowFields(fields, timestampBuf[:0], r)
+			}
+			if !wr.f.MatchRow(fields) {
+				continue
+			}
+			line = logstorage.MarshalFieldsToJSON(line[:0], fields)
+			line = append(line, '\n')
+			wr.sendMatch(line)
+		}
+	})
+}
+
+// watcher evaluates a single Watch against the ingested logs.
+type watcher struct {
+	w        *Watch
+	tenantID logstorage.TenantID
+	f        *logstorage.Filter
+
+	// mu protects subscribers
+	mu          sync.Mutex
+	subscribers map[chan []byte]struct{}
+	stopped     bool
+
+	// webhookCh is used for sending matching logs to Watch.WebhookURL
+	webhookCh chan []byte
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newWatcher(wt *Watch) (*watcher, error) {
+	f, err := wt.parseFilter()
+	if err != nil {
+		return nil, err
+	}
+	wr := &watcher{
+		w:           wt,
+		tenantID:    wt.tenantID(),
+		f:           f,
+		subscribers: make(map[chan []byte]struct{}),
+		stopCh:      make(chan struct{}),
+	}
+	if wt.WebhookURL != "" {
+		wr.webhookCh = make(chan []byte, webhookBatchSize)
+		wr.wg.Add(1)
+		go func() {
+			defer wr.wg.Done()
+			wr.runWebhookSender()
+		}()
+	}
+	return wr, nil
+}
+
+func (wr *watcher) stop() {
+	close(wr.stopCh)
+	wr.wg.Wait()
+
+	wr.mu.Lock()
+	for ch := range wr.subscribers {
+		close(ch)
+	}
+	wr.subscribers = nil
+	wr.stopped = true
+	wr.mu.Unlock()
+}
+
+func (wr *watcher) subscribe() chan []byte {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.stopped {
+		return nil
+	}
+	ch := make(chan []byte, subscriberBufferSize)
+	wr.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (wr *watcher) unsubscribe(ch chan []byte) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if _, ok := wr.subscribers[ch]; ok {
+		delete(wr.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (wr *watcher) subscribersCount() int {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	return len(wr.subscribers)
+}
+
+// sendMatch sends the matching log line to subscribers and to the webhook.
+//
+// The line is dropped for subscribers, which cannot keep up with the matching logs, so they do not slow down data ingestion.
+func (wr *watcher) sendMatch(line []byte) {
+	matchesTotal.Inc()
+
+	wr.mu.Lock()
+	if len(wr.subscribers) == 0 && wr.webhookCh == nil {
+		wr.mu.Unlock()
+		return
+	}
+	line = bytes.Clone(line)
+	for ch := range wr.subscribers {
+		select {
+		case ch <- line:
+		default:
+			droppedMatchesTotal.Inc()
+		}
+	}
+	wr.mu.Unlock()
+
+	if wr.webhookCh != nil {
+		select {
+		case wr.webhookCh <- line:
+		default:
+			droppedMatchesTotal.Inc()
+		}
+	}
+}
+
+func (wr *watcher) runWebhookSender() {
+	ticker := time.NewTicker(*webhookFlushInterval)
+	defer ticker.Stop()
+
+	var buf []byte
+	lines := 0
+	flush := func() {
+		if lines == 0 {
+			return
+		}
+		if err := sendToWebhook(wr.w.WebhookURL, buf); err != nil {
+			webhookErrorsTotal.Inc()
+			logger.Errorf("cannot send %d matching logs for watch %q to webhook_url=%q: %s", lines, wr.w.ID, wr.w.WebhookURL, err)
+		}
+		buf = buf[:0]
+		lines = 0
+	}
+
+	for {
+		select {
+		case <-wr.stopCh:
+			flush()
+			return
+		case <-ticker.C:
+			flush()
+		case line := <-wr.webhookCh:
+			buf = append(buf, line...)
+			lines++
+			if lines >= webhookBatchSize {
+				flush()
+			}
+		}
+	}
+}
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+func sendToWebhook(url string, data []byte) error {
+	resp, err := webhookClient.Post(url, "application/x-ndjson", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package watch
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestMatchLogRows(t *testing.T) {
+	f := func(filter string, tenantID logstorage.TenantID, linesExpected []string) {
+		t.Helper()
+
+		wr, err := newWatcher(&Watch{
+			ID:        "test",
+			AccountID: tenantID.AccountID,
+			ProjectID: tenantID.ProjectID,
+			Filter:    filter,
+		})
+		if err != nil {
+			t.Fatalf("cannot create watcher: %s", err)
+		}
+		defer wr.stop()
+
+		ch := wr.subscribe()
+
+		lr := logstorage.GetLogRows([]string{"app"}, nil, nil, nil, "")
+		defer logstorage.PutLogRows(lr)
+
+		ts := time.Date(2025, 1, 10, 12, 34, 56, 0, time.UTC).UnixNano()
+		lr.MustAdd(logstorage.TenantID{}, ts, []logstorage.Field{
+			{Name: "_msg", Value: "GET /foo 200"},
+			{Name: "app", Value: "nginx"},
+		}, -1)
+		lr.MustAdd(logstorage.TenantID{}, ts+1, []logstorage.Field{
+			{Name: "_msg", Value: "failed password for root"},
+			{Name: "app", Value: "sshd"},
+			{Name: "user", Value: "root"},
+		}, -1)
+		lr.MustAdd(logstorage.TenantID{AccountID: 1}, ts+2, []logstorage.Field{
+			{Name: "_msg", Value: "failed password for admin"},
+			{Name: "app", Value: "sshd"},
+		}, -1)
+
+		matchLogRows([]*watcher{wr}, lr)
+
+		var lines []string
+		for len(ch) > 0 {
+			lines = append(lines, string(<-ch))
+		}
+		if len(lines) != len(linesExpected) {
+			t.Fatalf("unexpected number of matching lines; got %d; want %d\ngot\n%q\nwant\n%q", len(lines), len(linesExpected), lines, linesExpected)
+		}
+		for i := range lines {
+			if lines[i] != linesExpected[i] {
+				t.Fatalf("unexpected line #%d\ngot\n%s\nwant\n%s", i, lines[i], linesExpected[i])
+			}
+		}
+	}
+
+	// word filter
+	f(`"failed password"`, logstorage.TenantID{}, []string{
+		`{"_time":"2025-01-10T12:34:56.000000001Z","_stream":"{app=\"sshd\"}","_msg":"failed password for root","app":"sshd","user":"root"}` + "\n",
+	})
+
+	// stream filter
+	f(`{app="nginx"}`, logstorage.TenantID{}, []string{
+		`{"_time":"2025-01-10T12:34:56Z","_stream":"{app=\"nginx\"}","_msg":"GET /foo 200","app":"nginx"}` + "\n",
+	})
+
+	// field filter
+	f(`user:root or app:nginx`, logstorage.TenantID{}, []string{
+		`{"_time":"2025-01-10T12:34:56Z","_stream":"{app=\"nginx\"}","_msg":"GET /foo 200","app":"nginx"}` + "\n",
+		`{"_time":"2025-01-10T12:34:56.000000001Z","_stream":"{app=\"sshd\"}","_msg":"failed password for root","app":"sshd","user":"root"}` + "\n",
+	})
+
+	// another tenant
+	f(`"failed password"`, logstorage.TenantID{AccountID: 1}, []string{
+		`{"_time":"2025-01-10T12:34:56.000000002Z","_stream":"{app=\"sshd\"}","_msg":"failed password for admin","app":"sshd"}` + "\n",
+	})
+
+	// missing tenant
+	f(`*`, logstorage.TenantID{AccountID: 2}, nil)
+
+	// no matches
+	f(`error`, logstorage.TenantID{}, nil)
+}
+
+func TestWatchesPersistence(t *testing.T) {
+	storagePath = filepath.Join(t.TempDir(), "watches", "watches.json")
+	defer func() {
+		for _, wr := range getWatchers() {
+			wr.stop()
+		}
+		watchers.Store(nil)
+		storagePath = ""
+	}()
+
+	tenantID := logstorage.TenantID{AccountID: 1, ProjectID: 2}
+	w1, err := createWatch(tenantID, &Watch{Name: "ssh", Filter: `"failed password"`})
+	if err != nil {
+		t.Fatalf("cannot create watch: %s", err)
+	}
+	w2, err := createWatch(logstorage.TenantID{}, &Watch{Filter: `error`})
+	if err != nil {
+		t.Fatalf("cannot create watch: %s", err)
+	}
+	if _, err := createWatch(tenantID, &Watch{Filter: `foo(`}); err == nil {
+		t.Fatalf("expecting non-nil error for invalid filter")
+	}
+
+	ws := listWatches(tenantID)
+	if len(ws) != 1 || ws[0].ID != w1.ID || ws[0].AccountID != 1 || ws[0].ProjectID != 2 {
+		t.Fatalf("unexpected watches: %v", ws)
+	}
+
+	// Watches for other tenants cannot be deleted
+	if err := deleteWatch(tenantID, w2.ID); err == nil {
+		t.Fatalf("expecting non-nil error when deleting watch from another tenant")
+	}
+
+	// The deleted watch must close its subscribers
+	ch := getWatcher(logstorage.TenantID{}, w2.ID).subscribe()
+	if err := deleteWatch(logstorage.TenantID{}, w2.ID); err != nil {
+		t.Fatalf("cannot delete watch: %s", err)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatalf("expecting closed subscriber channel")
+	}
+
+	ws, err = loadWatches(storagePath)
+	if err != nil {
+		t.Fatalf("cannot load watches: %s", err)
+	}
+	if len(ws) != 1 || ws[0].ID != w1.ID || ws[0].Name != "ssh" || ws[0].Filter != `"failed password"` || ws[0].AccountID != 1 || ws[0].ProjectID != 2 {
+		t.Fatalf("unexpected watches loaded from file: %v", ws)
+	}
+}
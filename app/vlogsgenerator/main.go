@@ -35,6 +35,8 @@ var (
 		"see https://docs.victoriametrics.com/victorialogs/keyconcepts/#data-model")
 	varFieldsPerLog = flag.Int("varFieldsPerLog", 1, "The number of fields with variable values to generate per each log entry; "+
 		"see https://docs.victoriametrics.com/victorialogs/keyconcepts/#data-model")
+	varFieldsCardinality = flag.Int64("varFieldsCardinality", 0, "The maximum number of unique values per each field with variable values. "+
+		"By default the number of unique values isn't limited")
 	dictFieldsPerLog = flag.Int("dictFieldsPerLog", 2, "The number of fields with up to 8 different values to generate per each log entry; "+
 		"see https://docs.victoriametrics.com/victorialogs/keyconcepts/#data-model")
 	u8FieldsPerLog = flag.Int("u8FieldsPerLog", 1, "The number of fields with uint8 values to generate per each log entry; "+
@@ -57,8 +59,14 @@ var (
 		"see https://docs.victoriametrics.com/victorialogs/keyconcepts/#data-model")
 
 	statInterval = flag.Duration("statInterval", 10*time.Second, "The interval between publishing the stats")
+
+	rate     = flag.Float64("rate", 0, "The target number of log entries per second to generate with the current timestamps. If it is set, then -start, -end and -logsPerStream are ignored")
+	duration = flag.Duration("duration", 0, "The duration for generating logs at -rate. Logs are generated until the process is stopped if -duration isn't set")
 )
 
+// rateTickInterval is the interval for generating logs at -rate.
+const rateTickInterval = 100 * time.Millisecond
+
 func main() {
 	// Write flags and help message to stdout, since it is easier to grep or pipe.
 	flag.CommandLine.SetOutput(os.Stdout)
@@ -81,7 +89,10 @@ func main() {
 		remoteWriteURL = urlParsed
 	}
 
-	if start.nsec >= end.nsec {
+	if *rate < 0 {
+		logger.Fatalf("-rate cannot be negative; got %v", *rate)
+	}
+	if *rate == 0 && start.nsec >= end.nsec {
 		logger.Fatalf("-start=%s must be smaller than -end=%s", start, end)
 	}
 	if *activeStreams <= 0 {
@@ -110,8 +121,14 @@ func main() {
 	cfg.activeStreams /= *workers
 	cfg.totalStreams /= *workers
 
-	logger.Infof("start -workers=%d workers for ingesting -logsPerStream=%d log entries per each -totalStreams=%d (-activeStreams=%d) on a time range -start=%s, -end=%s to -addr=%s",
-		*workers, *logsPerStream, *totalStreams, *activeStreams, toRFC3339(start.nsec), toRFC3339(end.nsec), *addr)
+	if *rate > 0 {
+		cfg.rate = *rate / float64(*workers)
+		logger.Infof("start -workers=%d workers for ingesting -rate=%v log entries per second for -totalStreams=%d (-activeStreams=%d) during -duration=%s to -addr=%s",
+			*workers, *rate, *totalStreams, *activeStreams, *duration, *addr)
+	} else {
+		logger.Infof("start -workers=%d workers for ingesting -logsPerStream=%d log entries per each -totalStreams=%d (-activeStreams=%d) on a time range -start=%s, -end=%s to -addr=%s",
+			*workers, *logsPerStream, *totalStreams, *activeStreams, toRFC3339(start.nsec), toRFC3339(end.nsec), *addr)
+	}
 
 	startTime := time.Now()
 	var wg sync.WaitGroup
@@ -161,6 +178,11 @@ type workerConfig struct {
 	url           *url.URL
 	activeStreams int
 	totalStreams  int
+
+	// rate is the number of log entries per second to generate by a single worker.
+	//
+	// Logs are generated on the [-start ... -end] time range if rate is zero.
+	rate float64
 }
 
 type statWriter struct {
@@ -183,7 +205,11 @@ func generateAndPushLogs(cfg *workerConfig, workerID int) {
 
 	doneCh := make(chan struct{})
 	go func() {
-		generateLogs(bw, workerID, cfg.activeStreams, cfg.totalStreams)
+		if cfg.rate > 0 {
+			generateLogsAtRate(bw, workerID, cfg.activeStreams, cfg.totalStreams, cfg.rate)
+		} else {
+			generateLogs(bw, workerID, cfg.activeStreams, cfg.totalStreams)
+		}
 		_ = bw.Flush()
 		_ = pw.Close()
 		close(doneCh)
@@ -229,12 +255,56 @@ func generateLogs(bw *bufio.Writer, workerID, activeStreams, totalStreams int) {
 	}
 }
 
+// generateLogsAtRate generates logs with the current timestamps at the given rate per second until -duration is reached.
+//
+// Active streams are substituted with new streams during -duration if totalStreams > activeStreams.
+func generateLogsAtRate(bw *bufio.Writer, workerID, activeStreams, totalStreams int, rate float64) {
+	t := time.NewTicker(rateTickInterval)
+	defer t.Stop()
+
+	startTime := time.Now()
+	generated := 0
+	streamIdx := 0
+	for {
+		<-t.C
+		elapsed := time.Since(startTime)
+		if *duration > 0 && elapsed > *duration {
+			elapsed = *duration
+		}
+
+		firstStreamID := 0
+		if *duration > 0 && totalStreams > activeStreams {
+			firstStreamID = int(float64(totalStreams-activeStreams) * elapsed.Seconds() / duration.Seconds())
+		}
+
+		timeStr := toRFC3339(time.Now().UnixNano())
+		n := int(rate*elapsed.Seconds()) - generated
+		for i := 0; i < n; i++ {
+			generateLogEntry(bw, workerID, timeStr, firstStreamID+streamIdx)
+			streamIdx = (streamIdx + 1) % activeStreams
+		}
+		generated += n
+
+		// Flush the generated logs, so they are sent to -addr in real time.
+		_ = bw.Flush()
+
+		if *duration > 0 && elapsed >= *duration {
+			return
+		}
+	}
+}
+
 var runID = toUUID(rand.Uint64(), rand.Uint64())
 
 func generateLogsAtTimestamp(bw *bufio.Writer, workerID int, ts int64, firstStreamID, activeStreams int) {
-	streamID := firstStreamID
 	timeStr := toRFC3339(ts)
 	for i := 0; i < activeStreams; i++ {
+		generateLogEntry(bw, workerID, timeStr, firstStreamID+i)
+	}
+}
+
+func generateLogEntry(bw *bufio.Writer, workerID int, timeStr string, streamID int) {
+	{
 		ip := toIPv4(rand.Uint32())
 		uuid := toUUID(rand.Uint64(), rand.Uint64())
 		fmt.Fprintf(bw, `{"_time":"%s","_msg":"message for the stream %d and worker %d; ip=%s; uuid=%s; u64=%d","host":"host_%d","worker_id":"%d"`,
@@ -244,7 +314,7 @@ func generateLogsAtTimestamp(bw *bufio.Writer, workerID int, ts int64, firstStre
 			fmt.Fprintf(bw, `,"const_%d":"some value %d %d"`, j, j, streamID)
 		}
 		for j := 0; j < *varFieldsPerLog; j++ {
-			fmt.Fprintf(bw, `,"var_%d":"some value %d %d"`, j, j, rand.Uint64())
+			fmt.Fprintf(bw, `,"var_%d":"some value %d %d"`, j, j, getVarFieldValue())
 		}
 		for j := 0; j < *dictFieldsPerLog; j++ {
 			fmt.Fprintf(bw, `,"dict_%d":"%s"`, j, dictValues[rand.Intn(len(dictValues))])
@@ -281,10 +351,17 @@ func generateLogsAtTimestamp(bw *bufio.Writer, workerID int, ts int64, firstStre
 		fmt.Fprintf(bw, "}\n")
 
 		logEntriesCount.Add(1)
-		streamID++
 	}
 }
 
+// getVarFieldValue returns a random value for the field with variable values according to -varFieldsCardinality.
+func getVarFieldValue() uint64 {
+	if *varFieldsCardinality <= 0 {
+		return rand.Uint64()
+	}
+	return uint64(rand.Int63n(*varFieldsCardinality))
+}
+
 var dictValues = []string{
 	"debug",
 	"info",
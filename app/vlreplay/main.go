@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	queryLog = flag.String("queryLog", "-", "Path to file with VictoriaLogs logs containing slow queries or with request uris per each line; "+
+		"stdin is used if it is set to '-'; see https://docs.victoriametrics.com/victorialogs/querying/vlreplay/")
+	targetURL = flag.String("targetURL", "http://localhost:9428", "URL of VictoriaLogs instance to replay queries to. Request uris from -queryLog are appended to this URL")
+	speed     = flag.Float64("speed", 1, "Replay speed compared to the original speed of queries at -queryLog. For example, -speed=2 replays queries two times faster. "+
+		"Queries are replayed as fast as possible with the given -concurrency if -speed=0 or if -queryLog doesn't contain timestamps")
+	concurrency    = flag.Int("concurrency", 8, "The maximum number of concurrently executed queries")
+	requestTimeout = flag.Duration("requestTimeout", time.Minute, "Timeout for every replayed query")
+	outputFile     = flag.String("outputFile", "", "Optional path to file for writing per-query replay results in JSON lines format")
+
+	header    = flagutil.NewArrayString("header", "Optional header to pass in requests to -targetURL in the form 'HeaderName: value'")
+	accountID = flag.Int("accountID", 0, "Account ID to query; see https://docs.victoriametrics.com/victorialogs/#multitenancy")
+	projectID = flag.Int("projectID", 0, "Project ID to query; see https://docs.victoriametrics.com/victorialogs/#multitenancy")
+
+	statInterval = flag.Duration("statInterval", 10*time.Second, "The interval between publishing the replay progress")
+)
+
+func main() {
+	// Write flags and help message to stdout, since it is easier to grep or pipe.
+	flag.CommandLine.SetOutput(os.Stdout)
+	envflag.Parse()
+	buildinfo.Init()
+	logger.Init()
+
+	if *concurrency <= 0 {
+		logger.Fatalf("-concurrency must be bigger than 0; got %d", *concurrency)
+	}
+	if *speed < 0 {
+		logger.Fatalf("-speed cannot be negative; got %v", *speed)
+	}
+	hes, err := parseHeaders(*header)
+	if err != nil {
+		logger.Fatalf("cannot parse -header command-line flag: %s", err)
+	}
+
+	entries := mustReadQueryLog(*queryLog)
+	if len(entries) == 0 {
+		logger.Fatalf("-queryLog=%q doesn't contain queries", *queryLog)
+	}
+
+	var ow *outputWriter
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			logger.Fatalf("cannot create -outputFile: %s", err)
+		}
+		ow = &outputWriter{
+			bw: bufio.NewWriter(f),
+		}
+		defer func() {
+			if err := ow.bw.Flush(); err != nil {
+				logger.Fatalf("cannot write -outputFile=%q: %s", *outputFile, err)
+			}
+			if err := f.Close(); err != nil {
+				logger.Fatalf("cannot close -outputFile=%q: %s", *outputFile, err)
+			}
+		}()
+	}
+
+	rp := &replayer{
+		targetURL: strings.TrimSuffix(*targetURL, "/"),
+		headers:   hes,
+		client: &http.Client{
+			Timeout: *requestTimeout,
+		},
+		ow:    ow,
+		stats: newReplayStats(),
+	}
+
+	logger.Infof("replaying %d queries from -queryLog=%q to -targetURL=%q with -speed=%v and -concurrency=%d", len(entries), *queryLog, *targetURL, *speed, *concurrency)
+
+	stopCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(*statInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				logger.Infof("replayed %d queries out of %d; errors: %d", rp.stats.queries.Load(), len(entries), rp.stats.errors.Load())
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	startTime := time.Now()
+	rp.replay(entries)
+	close(stopCh)
+
+	rp.stats.logSummary(time.Since(startTime))
+}
+
+func mustReadQueryLog(path string) []queryEntry {
+	var r io.Reader
+	if path == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Fatalf("cannot open -queryLog: %s", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	entries, err := readQueryLog(r)
+	if err != nil {
+		logger.Fatalf("cannot read -queryLog=%q: %s", path, err)
+	}
+	return entries
+}
+
+type replayer struct {
+	targetURL string
+	headers   []headerEntry
+	client    *http.Client
+	ow        *outputWriter
+	stats     *replayStats
+}
+
+// replay replays entries according to -speed and -concurrency.
+func (rp *replayer) replay(entries []queryEntry) {
+	concurrencyCh := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+
+	startTime := time.Now()
+	firstQueryTime := entries[0].startTime
+	for i := range entries {
+		qe := &entries[i]
+
+		if *speed > 0 && !firstQueryTime.IsZero() {
+			offset := time.Duration(float64(qe.startTime.Sub(firstQueryTime)) / *speed)
+			deadline := startTime.Add(offset)
+			if d := time.Until(deadline); d > 0 {
+				time.Sleep(d)
+			}
+			concurrencyCh <- struct{}{}
+			if time.Since(deadline) > time.Second {
+				rp.stats.delayed.Add(1)
+			}
+		} else {
+			concurrencyCh <- struct{}{}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-concurrencyCh
+				wg.Done()
+			}()
+			rp.replayQuery(qe)
+		}()
+	}
+	wg.Wait()
+}
+
+func (rp *replayer) replayQuery(qe *queryEntry) {
+	startTime := time.Now()
+	statusCode, responseBytes, err := rp.doRequest(qe.requestURI)
+	d := time.Since(startTime)
+	if err == nil && statusCode/100 != 2 {
+		err = fmt.Errorf("unexpected status code: %d; want 2xx", statusCode)
+	}
+	if err != nil {
+		logger.WithThrottler("replayQuery", 5*time.Second).Warnf("cannot replay query %q: %s", qe.requestURI, err)
+	}
+
+	rp.stats.add(qe, d, responseBytes, err)
+
+	if rp.ow != nil {
+		rp.ow.write(qe, statusCode, d, responseBytes, err)
+	}
+}
+
+func (rp *replayer) doRequest(requestURI string) (int, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rp.targetURL+requestURI, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot create request: %w", err)
+	}
+	for _, h := range rp.headers {
+		req.Header.Set(h.Name, h.Value)
+	}
+	if *accountID > 0 || *projectID > 0 {
+		req.Header.Set("AccountID", strconv.Itoa(*accountID))
+		req.Header.Set("ProjectID", strconv.Itoa(*projectID))
+	}
+
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return resp.StatusCode, n, fmt.Errorf("cannot read response body: %w", err)
+	}
+	return resp.StatusCode, n, nil
+}
+
+// replayStats holds replay stats.
+type replayStats struct {
+	queries atomic.Uint64
+	errors  atomic.Uint64
+	delayed atomic.Uint64
+
+	mu               sync.Mutex
+	perPath          map[string]*pathStats
+	originalDuration time.Duration
+	replayDuration   time.Duration
+}
+
+type pathStats struct {
+	durations     []time.Duration
+	errors        int
+	responseBytes int64
+}
+
+func newReplayStats() *replayStats {
+	return &replayStats{
+		perPath: make(map[string]*pathStats),
+	}
+}
+
+func (rs *replayStats) add(qe *queryEntry, d time.Duration, responseBytes int64, err error) {
+	rs.queries.Add(1)
+	if err != nil {
+		rs.errors.Add(1)
+	}
+
+	path, _, _ := strings.Cut(qe.requestURI, "?")
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	ps := rs.perPath[path]
+	if ps == nil {
+		ps = &pathStats{}
+		rs.perPath[path] = ps
+	}
+	ps.durations = append(ps.durations, d)
+	if err != nil {
+		ps.errors++
+	}
+	ps.responseBytes += responseBytes
+
+	if qe.duration > 0 {
+		rs.originalDuration += qe.duration
+		rs.replayDuration += d
+	}
+}
+
+func (rs *replayStats) logSummary(d time.Duration) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	logger.Infof("replayed %d queries in %.3f seconds; errors: %d; queries delayed because of -concurrency limit: %d",
+		rs.queries.Load(), d.Seconds(), rs.errors.Load(), rs.delayed.Load())
+
+	paths := make([]string, 0, len(rs.perPath))
+	for path := range rs.perPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		ps := rs.perPath[path]
+		durations := ps.durations
+		sort.Slice(durations, func(i, j int) bool {
+			return durations[i] < durations[j]
+		})
+		logger.Infof("%s: queries: %d, errors: %d, response bytes: %d, duration p50: %.3fs, p90: %.3fs, p99: %.3fs, max: %.3fs",
+			path, len(durations), ps.errors, ps.responseBytes, getQuantile(durations, 0.5).Seconds(), getQuantile(durations, 0.9).Seconds(),
+			getQuantile(durations, 0.99).Seconds(), durations[len(durations)-1].Seconds())
+	}
+
+	if rs.originalDuration > 0 {
+		logger.Infof("the total duration of queries with known original duration: original: %.3f seconds, replayed: %.3f seconds (%.2fx)",
+			rs.originalDuration.Seconds(), rs.replayDuration.Seconds(), rs.replayDuration.Seconds()/rs.originalDuration.Seconds())
+	}
+}
+
+// getQuantile returns phi quantile for the sorted durations.
+func getQuantile(durations []time.Duration, phi float64) time.Duration {
+	n := int(phi * float64(len(durations)-1))
+	return durations[n]
+}
+
+// outputWriter writes per-query replay results in JSON lines format.
+type outputWriter struct {
+	mu sync.Mutex
+	bw *bufio.Writer
+}
+
+type outputEntry struct {
+	RequestURI              string  `json:"request_uri"`
+	StatusCode              int     `json:"status_code"`
+	DurationSeconds         float64 `json:"duration_seconds"`
+	OriginalDurationSeconds float64 `json:"original_duration_seconds,omitempty"`
+	ResponseBytes           int64   `json:"response_bytes"`
+	Error                   string  `json:"error,omitempty"`
+}
+
+func (ow *outputWriter) write(qe *queryEntry, statusCode int, d time.Duration, responseBytes int64, err error) {
+	oe := &outputEntry{
+		RequestURI:              qe.requestURI,
+		StatusCode:              statusCode,
+		DurationSeconds:         d.Seconds(),
+		OriginalDurationSeconds: qe.duration.Seconds(),
+		ResponseBytes:           responseBytes,
+	}
+	if err != nil {
+		oe.Error = err.Error()
+	}
+	data, err := json.Marshal(oe)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal output entry: %s", err)
+	}
+	data = append(data, '\n')
+
+	ow.mu.Lock()
+	_, _ = ow.bw.Write(data)
+	ow.mu.Unlock()
+}
+
+type headerEntry struct {
+	Name  string
+	Value string
+}
+
+func parseHeaders(a []string) ([]headerEntry, error) {
+	hes := make([]headerEntry, len(a))
+	for i, s := range a {
+		a := strings.SplitN(s, ":", 2)
+		if len(a) != 2 {
+			return nil, fmt.Errorf("cannot parse header=%q; it must contain at least one ':'; for example, 'Cookie: foo'", s)
+		}
+		hes[i] = headerEntry{
+			Name:  strings.TrimSpace(a[0]),
+			Value: strings.TrimSpace(a[1]),
+		}
+	}
+	return hes, nil
+}
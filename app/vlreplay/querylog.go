@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryEntry is a query read from the query log.
+type queryEntry struct {
+	// requestURI is the request uri of the query including query args, e.g. /select/logsql/query?query=error
+	requestURI string
+
+	// startTime is the time when the query has been started.
+	//
+	// It is zero if the query log doesn't contain timestamps.
+	startTime time.Time
+
+	// duration is the original query duration.
+	//
+	// It is zero if the query log doesn't contain query durations.
+	duration time.Duration
+}
+
+// slowQueryRE matches the message logged by VictoriaLogs for queries exceeding -search.logSlowQueryDuration.
+var slowQueryRE = regexp.MustCompile(`slow query according to -search\.logSlowQueryDuration=[^:]+: .*?, duration=([0-9.]+) seconds; requestURI: ("(?:[^"\\]|\\.)*")`)
+
+// readQueryLog reads queries from r.
+//
+// The following line formats are supported:
+//
+//   - VictoriaLogs log lines with slow queries in the default text format (-loggerFormat=default).
+//   - VictoriaLogs log lines with slow queries in JSON format (-loggerFormat=json).
+//   - Plain request uris starting with '/', e.g. /select/logsql/query?query=error
+//
+// Other lines are skipped. The returned entries are sorted by startTime.
+func readQueryLog(r io.Reader) ([]queryEntry, error) {
+	var entries []queryEntry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16*1024*1024)
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(sc.Text())
+		qe, ok, err := parseQueryLogLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse line #%d: %w; line contents: %q", lineNum, err, line)
+		}
+		if ok {
+			entries = append(entries, qe)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read query log: %w", err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].startTime.Before(entries[j].startTime)
+	})
+	return entries, nil
+}
+
+// parseQueryLogLine parses a single query log line.
+//
+// It returns false if the line doesn't contain a query.
+func parseQueryLogLine(line string) (queryEntry, bool, error) {
+	var qe queryEntry
+
+	if strings.HasPrefix(line, "/") {
+		qe.requestURI = line
+		return qe, true, nil
+	}
+
+	var tsStr, msg string
+	if strings.HasPrefix(line, "{") {
+		// JSON log format
+		var le struct {
+			Ts  string `json:"ts"`
+			Msg string `json:"msg"`
+		}
+		if err := json.Unmarshal([]byte(line), &le); err != nil {
+			return qe, false, nil
+		}
+		tsStr = le.Ts
+		msg = le.Msg
+	} else {
+		// The default log format: <ts>\t<level>\t<caller>\t<msg>
+		n := strings.IndexByte(line, '\t')
+		if n < 0 {
+			return qe, false, nil
+		}
+		tsStr = line[:n]
+		msg = line[n+1:]
+	}
+
+	m := slowQueryRE.FindStringSubmatch(msg)
+	if m == nil {
+		return qe, false, nil
+	}
+
+	secs, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return qe, false, fmt.Errorf("cannot parse query duration %q: %w", m[1], err)
+	}
+	requestURI, err := strconv.Unquote(m[2])
+	if err != nil {
+		return qe, false, fmt.Errorf("cannot unquote requestURI %s: %w", m[2], err)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, tsStr)
+	if err != nil {
+		return qe, false, fmt.Errorf("cannot parse log timestamp %q: %w", tsStr, err)
+	}
+
+	qe.requestURI = requestURI
+	qe.duration = time.Duration(secs * float64(time.Second))
+
+	// The slow query is logged after its completion, so subtract its duration in order to obtain the query start time.
+	qe.startTime = ts.Add(-qe.duration)
+
+	return qe, true, nil
+}
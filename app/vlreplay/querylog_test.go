@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadQueryLog(t *testing.T) {
+	f := func(data string, entriesExpected []queryEntry) {
+		t.Helper()
+
+		entries, err := readQueryLog(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(entries, entriesExpected) {
+			t.Fatalf("unexpected entries\ngot\n%+v\nwant\n%+v", entries, entriesExpected)
+		}
+	}
+
+	mustParseTime := func(s string) time.Time {
+		t.Helper()
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatalf("cannot parse time %q: %s", s, err)
+		}
+		return ts
+	}
+
+	// empty log
+	f("", nil)
+
+	// log without slow queries
+	f(`2025-01-01T00:00:00.000Z	info	app/victoria-logs/main.go:55	started VictoriaLogs in 0.001 seconds
+{"ts":"2025-01-01T00:00:00.000Z","level":"info","caller":"app/victoria-logs/main.go:55","msg":"started VictoriaLogs"}
+foo bar`, nil)
+
+	// the default log format
+	f(`2025-01-01T00:00:10.500Z	warn	app/vlselect/main.go:281	slow query according to -search.logSlowQueryDuration=5s: remoteAddr="127.0.0.1:54744", duration=6.500 seconds; requestURI: "/select/logsql/query?query=error+%7C+stats+count%28%29"
+2025-01-01T00:00:07.000Z	warn	app/vlselect/main.go:281	slow query according to -search.logSlowQueryDuration=5s: remoteAddr="127.0.0.1:54745", duration=5.000 seconds; requestURI: "/select/logsql/hits?query=\"foo\""`, []queryEntry{
+		{
+			requestURI: `/select/logsql/hits?query="foo"`,
+			startTime:  mustParseTime("2025-01-01T00:00:02Z"),
+			duration:   5 * time.Second,
+		},
+		{
+			requestURI: "/select/logsql/query?query=error+%7C+stats+count%28%29",
+			startTime:  mustParseTime("2025-01-01T00:00:04Z"),
+			duration:   6500 * time.Millisecond,
+		},
+	})
+
+	// JSON log format
+	f(`{"ts":"2025-01-01T00:00:10Z","level":"warn","caller":"app/vlselect/main.go:281","msg":"slow query according to -search.logSlowQueryDuration=5s: remoteAddr=\"127.0.0.1:54744\", duration=10.000 seconds; requestURI: \"/select/logsql/query?query=%2A\""}`, []queryEntry{
+		{
+			requestURI: "/select/logsql/query?query=%2A",
+			startTime:  mustParseTime("2025-01-01T00:00:00Z"),
+			duration:   10 * time.Second,
+		},
+	})
+
+	// plain request uris
+	f(`/select/logsql/query?query=error
+
+/select/logsql/stats_query?query=*+%7C+count%28%29&time=2025-01-01T00:00:00Z`, []queryEntry{
+		{
+			requestURI: "/select/logsql/query?query=error",
+		},
+		{
+			requestURI: "/select/logsql/stats_query?query=*+%7C+count%28%29&time=2025-01-01T00:00:00Z",
+		},
+	})
+}
+
+func TestReadQueryLogFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		_, err := readQueryLog(strings.NewReader(data))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid timestamp
+	f(`foo	warn	app/vlselect/main.go:281	slow query according to -search.logSlowQueryDuration=5s: remoteAddr="127.0.0.1:54744", duration=6.500 seconds; requestURI: "/select/logsql/query?query=error"`)
+
+	// invalid requestURI quoting
+	f(`2025-01-01T00:00:10Z	warn	app/vlselect/main.go:281	slow query according to -search.logSlowQueryDuration=5s: remoteAddr="127.0.0.1:54744", duration=6.500 seconds; requestURI: "/select/logsql/query?query=\x"`)
+}
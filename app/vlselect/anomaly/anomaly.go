@@ -0,0 +1,528 @@
+package anomaly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	checkInterval = flag.Duration("anomaly.checkInterval", 0, "Interval for detecting anomalies in per-stream log rates and error rates. "+
+		"Anomaly detection is disabled if this flag is zero; see https://docs.victoriametrics.com/victorialogs/#anomaly-detection")
+	anomalyQuery = flag.String("anomaly.query", "*", "LogsQL filter for selecting logs for anomaly detection; "+
+		"see https://docs.victoriametrics.com/victorialogs/#anomaly-detection")
+	errorFilter = flag.String("anomaly.errorFilter", "i(error)", "LogsQL filter for selecting error logs for anomaly detection of per-stream error rates; "+
+		"see https://docs.victoriametrics.com/victorialogs/#anomaly-detection")
+	seasonalPeriod = flag.Duration("anomaly.seasonalPeriod", 24*time.Hour, "Seasonal period for the learned per-stream baselines; "+
+		"see also -anomaly.seasonalBuckets")
+	seasonalBuckets = flag.Int("anomaly.seasonalBuckets", 24, "The number of independent baselines per -anomaly.seasonalPeriod. "+
+		"For example, the default values for -anomaly.seasonalPeriod and -anomaly.seasonalBuckets result in a separate baseline per every hour of the day")
+	alpha = flag.Float64("anomaly.alpha", 0.1, "Smoothing factor in the range (0..1] for exponentially weighted moving average of per-stream rates. "+
+		"Higher values adapt faster to changes")
+	threshold    = flag.Float64("anomaly.threshold", 3, "Anomaly is detected when the observed rate deviates from the baseline by more than the given number of standard deviations")
+	minDeviation = flag.Float64("anomaly.minDeviation", 10, "The minimum absolute difference between the observed number of logs per -anomaly.checkInterval and the baseline "+
+		"for detecting anomalies. This prevents from false positives for streams with low log rates")
+	minSamples  = flag.Int("anomaly.minSamples", 10, "The minimum number of samples per seasonal bucket before anomalies can be detected for it")
+	maxStreams  = flag.Int("anomaly.maxStreams", 100_000, "The maximum number of log streams to track for anomaly detection. Baselines for new streams aren't learned when the limit is reached")
+	webhookURLs = flagutil.NewArrayString("anomaly.webhookURL", "Optional URL to send detected anomalies to via HTTP POST requests with JSON body; "+
+		"see https://docs.victoriametrics.com/victorialogs/#anomaly-detection")
+)
+
+// anomalyTypeField is the stream field name for the logs with anomaly events.
+//
+// Logs with this field are excluded from anomaly detection.
+const anomalyTypeField = "vl_anomaly_type"
+
+var (
+	det    *detector
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+)
+
+// IsEnabled returns true if anomaly detection is enabled via -anomaly.checkInterval command-line flag.
+func IsEnabled() bool {
+	return *checkInterval > 0
+}
+
+// CheckConfig verifies anomaly detection command-line flags without starting anomaly detection.
+func CheckConfig() error {
+	if *checkInterval <= 0 {
+		return nil
+	}
+	_, _, err := loadConfig()
+	return err
+}
+
+func loadConfig() (*detectorConfig, string, error) {
+	cfg, err := newDetectorConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid anomaly detection config: %w", err)
+	}
+	q, err := getAnomalyDetectionQuery(*anomalyQuery, *errorFilter)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot initialize anomaly detection: %w", err)
+	}
+	return cfg, q, nil
+}
+
+// Init starts anomaly detection if -anomaly.checkInterval is set.
+func Init() {
+	if *checkInterval <= 0 {
+		return
+	}
+	cfg, q, err := loadConfig()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	det = newDetector(cfg)
+	stopCh = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runDetector(det, q)
+	}()
+}
+
+// Stop stops anomaly detection.
+func Stop() {
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	wg.Wait()
+	stopCh = nil
+	det = nil
+}
+
+func newDetectorConfig() (*detectorConfig, error) {
+	if *seasonalPeriod <= 0 {
+		return nil, fmt.Errorf("-anomaly.seasonalPeriod must be positive; got %s", *seasonalPeriod)
+	}
+	if *seasonalBuckets <= 0 {
+		return nil, fmt.Errorf("-anomaly.seasonalBuckets must be positive; got %d", *seasonalBuckets)
+	}
+	if *alpha <= 0 || *alpha > 1 {
+		return nil, fmt.Errorf("-anomaly.alpha must be in the range (0..1]; got %v", *alpha)
+	}
+	cfg := &detectorConfig{
+		seasonalPeriod:  seasonalPeriod.Nanoseconds(),
+		seasonalBuckets: *seasonalBuckets,
+		alpha:           *alpha,
+		threshold:       *threshold,
+		minDeviation:    *minDeviation,
+		minSamples:      *minSamples,
+		maxStreams:      *maxStreams,
+	}
+	return cfg, nil
+}
+
+func getAnomalyDetectionQuery(query, errorFilter string) (string, error) {
+	if _, err := logstorage.ParseFilter(query); err != nil {
+		return "", fmt.Errorf("cannot parse -anomaly.query=%q: %w", query, err)
+	}
+	if _, err := logstorage.ParseFilter(errorFilter); err != nil {
+		return "", fmt.Errorf("cannot parse -anomaly.errorFilter=%q: %w", errorFilter, err)
+	}
+	q := fmt.Sprintf("(%s) -%s:* | stats by (_stream) count() rows, count() if (%s) errors", query, anomalyTypeField, errorFilter)
+	if _, err := logstorage.ParseQuery(q); err != nil {
+		return "", fmt.Errorf("cannot parse anomaly detection query %q: %w", q, err)
+	}
+	return q, nil
+}
+
+func runDetector(d *detector, q string) {
+	ticker := time.NewTicker(*checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		checksTotal.Inc()
+		end := time.Now()
+		start := end.Add(-*checkInterval)
+		if err := checkAnomalies(d, q, start.UnixNano(), end.UnixNano()); err != nil {
+			checkErrorsTotal.Inc()
+			logger.Errorf("cannot detect anomalies: %s", err)
+		}
+	}
+}
+
+func checkAnomalies(d *detector, q string, start, end int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *checkInterval)
+	defer cancel()
+
+	tenantIDs, err := vlstorage.GetTenantIDs(ctx, start, end)
+	if err != nil {
+		return fmt.Errorf("cannot obtain tenants: %w", err)
+	}
+
+	var events []*Event
+	for _, tenantID := range tenantIDs {
+		obs, err := getObservations(ctx, tenantID, q, start, end)
+		if err != nil {
+			return fmt.Errorf("cannot obtain per-stream log rates for tenant %d:%d: %w", tenantID.AccountID, tenantID.ProjectID, err)
+		}
+		events = append(events, d.processObservations(tenantID, end, obs)...)
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+	writeEvents(events)
+	sendEventsToWebhooks(events)
+	return nil
+}
+
+func getObservations(ctx context.Context, tenantID logstorage.TenantID, qStr string, start, end int64) (map[string]observation, error) {
+	q, err := logstorage.ParseQueryAtTimestamp(qStr, end)
+	if err != nil {
+		return nil, err
+	}
+	q.AddTimeFilter(start, end-1)
+
+	var qs logstorage.QueryStats
+	qctx := logstorage.NewQueryContext(ctx, &qs, []logstorage.TenantID{tenantID}, q, false, nil)
+
+	var obsLock sync.Mutex
+	obs := make(map[string]observation)
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		var streams, rows, errors []string
+		for _, c := range db.Columns {
+			switch c.Name {
+			case "_stream":
+				streams = c.Values
+			case "rows":
+				rows = c.Values
+			case "errors":
+				errors = c.Values
+			}
+		}
+		if streams == nil || rows == nil || errors == nil {
+			return
+		}
+
+		obsLock.Lock()
+		defer obsLock.Unlock()
+
+		for i, stream := range streams {
+			rowsCount, _ := strconv.ParseUint(rows[i], 10, 64)
+			errorsCount, _ := strconv.ParseUint(errors[i], 10, 64)
+			obs[strings.Clone(stream)] = observation{
+				rows:   float64(rowsCount),
+				errors: float64(errorsCount),
+			}
+		}
+	}
+	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+		return nil, err
+	}
+	return obs, nil
+}
+
+func writeEvents(events []*Event) {
+	if err := insertutil.CanWriteData(); err != nil {
+		logger.Errorf("cannot write %d anomaly events: %s", len(events), err)
+		return
+	}
+
+	m := make(map[logstorage.TenantID]insertutil.LogMessageProcessor)
+	var fields []logstorage.Field
+	for _, e := range events {
+		lmp := m[e.TenantID]
+		if lmp == nil {
+			cp := &insertutil.CommonParams{
+				TenantID:     e.TenantID,
+				TimeFields:   []string{"_time"},
+				StreamFields: []string{anomalyTypeField},
+			}
+			lmp = cp.NewLogMessageProcessor("anomaly", false)
+			m[e.TenantID] = lmp
+		}
+		fields = e.appendFields(fields[:0])
+		lmp.AddRow(e.Timestamp.UnixNano(), fields, -1)
+		eventsTotal.Inc()
+	}
+	for _, lmp := range m {
+		lmp.MustClose()
+	}
+}
+
+func sendEventsToWebhooks(events []*Event) {
+	if len(*webhookURLs) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"events": events,
+	})
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal anomaly events: %s", err)
+	}
+	for _, url := range *webhookURLs {
+		if err := sendToWebhook(url, data); err != nil {
+			webhookErrorsTotal.Inc()
+			logger.Errorf("cannot send %d anomaly events to -anomaly.webhookURL=%q: %s", len(events), url, err)
+		}
+	}
+}
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+func sendToWebhook(url string, data []byte) error {
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+var (
+	checksTotal        = metrics.NewCounter(`vl_anomaly_checks_total`)
+	checkErrorsTotal   = metrics.NewCounter(`vl_anomaly_check_errors_total`)
+	eventsTotal        = metrics.NewCounter(`vl_anomaly_events_total`)
+	webhookErrorsTotal = metrics.NewCounter(`vl_anomaly_webhook_errors_total`)
+
+	_ = metrics.NewGauge(`vl_anomaly_tracked_streams`, func() float64 {
+		d := det
+		if d == nil {
+			return 0
+		}
+		return float64(d.streamsCount())
+	})
+)
+
+// Event is a detected anomaly.
+type Event struct {
+	// TenantID is the tenant for the stream with the anomaly.
+	TenantID logstorage.TenantID `json:"tenant"`
+
+	// Timestamp is the time when the anomaly has been detected.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Type is the anomaly type - either log_rate or error_rate.
+	Type string `json:"type"`
+
+	// Stream is the log stream with the anomaly.
+	Stream string `json:"stream"`
+
+	// Observed is the observed number of logs during the check interval.
+	Observed float64 `json:"observed"`
+
+	// Expected is the expected number of logs during the check interval according to the learned baseline.
+	Expected float64 `json:"expected"`
+
+	// Stddev is the standard deviation for the learned baseline.
+	Stddev float64 `json:"stddev"`
+}
+
+func (e *Event) message() string {
+	what := "logs"
+	if e.Type == "error_rate" {
+		what = "error logs"
+	}
+	return fmt.Sprintf("unusual number of %s for the stream %s: observed %.0f, expected %.1f ± %.1f", what, e.Stream, e.Observed, e.Expected, e.Stddev)
+}
+
+func (e *Event) appendFields(dst []logstorage.Field) []logstorage.Field {
+	return append(dst,
+		logstorage.Field{Name: anomalyTypeField, Value: e.Type},
+		logstorage.Field{Name: "_msg", Value: e.message()},
+		logstorage.Field{Name: "stream", Value: e.Stream},
+		logstorage.Field{Name: "observed", Value: formatFloat(e.Observed)},
+		logstorage.Field{Name: "expected", Value: formatFloat(e.Expected)},
+		logstorage.Field{Name: "stddev", Value: formatFloat(e.Stddev)},
+	)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// observation contains the observed number of logs and error logs per stream during the check interval.
+type observation struct {
+	rows   float64
+	errors float64
+}
+
+type detectorConfig struct {
+	seasonalPeriod  int64
+	seasonalBuckets int
+	alpha           float64
+	threshold       float64
+	minDeviation    float64
+	minSamples      int
+	maxStreams      int
+}
+
+// detector learns seasonal baselines for per-stream log rates and detects deviations from these baselines.
+type detector struct {
+	cfg *detectorConfig
+
+	mu      sync.Mutex
+	streams map[detectorKey]*streamBaselines
+}
+
+type detectorKey struct {
+	tenantID logstorage.TenantID
+	stream   string
+}
+
+type streamBaselines struct {
+	rows   seasonalEWMA
+	errors seasonalEWMA
+
+	// lastSeen is the last timestamp when logs for the stream have been observed.
+	lastSeen int64
+}
+
+func newDetector(cfg *detectorConfig) *detector {
+	return &detector{
+		cfg:     cfg,
+		streams: make(map[detectorKey]*streamBaselines),
+	}
+}
+
+func (d *detector) streamsCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.streams)
+}
+
+// processObservations updates baselines for the given tenantID with the observations obs made at the given timestamp and returns the detected anomalies.
+//
+// Streams with baselines, which are missing in obs, are treated as streams with zero logs, so sudden drops in log volume are detected too.
+func (d *detector) processObservations(tenantID logstorage.TenantID, timestamp int64, obs map[string]observation) []*Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cfg := d.cfg
+	bucketDuration := cfg.seasonalPeriod / int64(cfg.seasonalBuckets)
+	bucketIdx := int((timestamp % cfg.seasonalPeriod) / max(bucketDuration, 1))
+	if bucketIdx >= cfg.seasonalBuckets {
+		bucketIdx = cfg.seasonalBuckets - 1
+	}
+
+	var events []*Event
+	addEvent := func(typ, stream string, observed, expected, stddev float64) {
+		events = append(events, &Event{
+			TenantID:  tenantID,
+			Timestamp: time.Unix(0, timestamp).UTC(),
+			Type:      typ,
+			Stream:    stream,
+			Observed:  observed,
+			Expected:  expected,
+			Stddev:    stddev,
+		})
+	}
+	update := func(k detectorKey, sb *streamBaselines, o observation) {
+		if ok, expected, stddev := sb.rows.update(cfg, bucketIdx, o.rows); ok {
+			addEvent("log_rate", k.stream, o.rows, expected, stddev)
+		}
+		if ok, expected, stddev := sb.errors.update(cfg, bucketIdx, o.errors); ok {
+			addEvent("error_rate", k.stream, o.errors, expected, stddev)
+		}
+	}
+
+	for stream, o := range obs {
+		k := detectorKey{
+			tenantID: tenantID,
+			stream:   stream,
+		}
+		sb := d.streams[k]
+		if sb == nil {
+			if len(d.streams) >= cfg.maxStreams {
+				continue
+			}
+			sb = &streamBaselines{
+				rows:   newSeasonalEWMA(cfg.seasonalBuckets),
+				errors: newSeasonalEWMA(cfg.seasonalBuckets),
+			}
+			d.streams[k] = sb
+		}
+		sb.lastSeen = timestamp
+		update(k, sb, o)
+	}
+
+	// Process streams without logs during the check interval.
+	for k, sb := range d.streams {
+		if k.tenantID != tenantID || sb.lastSeen == timestamp {
+			continue
+		}
+		if timestamp-sb.lastSeen > cfg.seasonalPeriod {
+			// Drop baselines for streams without logs during the last seasonal period.
+			delete(d.streams, k)
+			continue
+		}
+		update(k, sb, observation{})
+	}
+
+	return events
+}
+
+// seasonalEWMA contains exponentially weighted moving average and variance per every seasonal bucket.
+type seasonalEWMA struct {
+	buckets []ewmaBucket
+}
+
+type ewmaBucket struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+func newSeasonalEWMA(buckets int) seasonalEWMA {
+	return seasonalEWMA{
+		buckets: make([]ewmaBucket, buckets),
+	}
+}
+
+// update updates the bucket at bucketIdx with the value v.
+//
+// It returns true if v deviates from the learned baseline together with the expected value and the standard deviation for the baseline.
+func (se *seasonalEWMA) update(cfg *detectorConfig, bucketIdx int, v float64) (bool, float64, float64) {
+	b := &se.buckets[bucketIdx]
+	if b.samples == 0 {
+		b.mean = v
+		b.samples = 1
+		return false, 0, 0
+	}
+
+	expected := b.mean
+	stddev := math.Sqrt(b.variance)
+	diff := v - b.mean
+	isAnomaly := b.samples >= cfg.minSamples && math.Abs(diff) >= cfg.minDeviation && math.Abs(diff) > cfg.threshold*stddev
+
+	b.mean += cfg.alpha * diff
+	b.variance = (1 - cfg.alpha) * (b.variance + cfg.alpha*diff*diff)
+	b.samples++
+
+	return isAnomaly, expected, stddev
+}
@@ -0,0 +1,170 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestGetAnomalyDetectionQuery_Success(t *testing.T) {
+	f := func(query, errorFilter, resultExpected string) {
+		t.Helper()
+
+		result, err := getAnomalyDetectionQuery(query, errorFilter)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f("*", "i(error)", "(*) -vl_anomaly_type:* | stats by (_stream) count() rows, count() if (i(error)) errors")
+	f(`{app="nginx"} or foo`, "error or fatal", `({app="nginx"} or foo) -vl_anomaly_type:* | stats by (_stream) count() rows, count() if (error or fatal) errors`)
+}
+
+func TestGetAnomalyDetectionQuery_Failure(t *testing.T) {
+	f := func(query, errorFilter string) {
+		t.Helper()
+
+		_, err := getAnomalyDetectionQuery(query, errorFilter)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f("", "error")
+	f("foo | count()", "error")
+	f("*", "")
+	f("*", "error)")
+}
+
+func TestDetectorProcessObservations(t *testing.T) {
+	cfg := &detectorConfig{
+		seasonalPeriod:  (24 * time.Hour).Nanoseconds(),
+		seasonalBuckets: 24,
+		alpha:           0.1,
+		threshold:       3,
+		minDeviation:    10,
+		minSamples:      5,
+		maxStreams:      2,
+	}
+	d := newDetector(cfg)
+
+	tenantID := logstorage.TenantID{AccountID: 1}
+	ts := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC).UnixNano()
+
+	process := func(obs map[string]observation) []*Event {
+		t.Helper()
+		events := d.processObservations(tenantID, ts, obs)
+		ts += time.Minute.Nanoseconds()
+		return events
+	}
+
+	// Learn the baseline
+	for i := 0; i < 20; i++ {
+		events := process(map[string]observation{
+			`{app="foo"}`: {
+				rows:   float64(100 + i%3),
+				errors: 1,
+			},
+			`{app="bar"}`: {
+				rows: 50,
+			},
+		})
+		if len(events) > 0 {
+			t.Fatalf("unexpected events during learning: %v", events)
+		}
+	}
+	if n := d.streamsCount(); n != 2 {
+		t.Fatalf("unexpected number of tracked streams; got %d; want 2", n)
+	}
+
+	// Small deviations must be ignored
+	events := process(map[string]observation{
+		`{app="foo"}`: {
+			rows:   105,
+			errors: 3,
+		},
+		`{app="bar"}`: {
+			rows: 55,
+		},
+	})
+	if len(events) > 0 {
+		t.Fatalf("unexpected events for small deviations: %v", events)
+	}
+
+	// Spike in error logs and a drop in log volume for the missing stream.
+	// The new stream must be ignored, since -anomaly.maxStreams is reached.
+	events = process(map[string]observation{
+		`{app="foo"}`: {
+			rows:   101,
+			errors: 100,
+		},
+		`{app="baz"}`: {
+			rows: 1000,
+		},
+	})
+	if len(events) != 2 {
+		t.Fatalf("unexpected number of events; got %d; want 2; events: %v", len(events), events)
+	}
+	for _, e := range events {
+		switch e.Stream {
+		case `{app="foo"}`:
+			if e.Type != "error_rate" || e.Observed != 100 || e.Expected < 1 || e.Expected > 2 {
+				t.Fatalf("unexpected event for {app=\"foo\"}: %+v", e)
+			}
+		case `{app="bar"}`:
+			if e.Type != "log_rate" || e.Observed != 0 || e.Expected < 50 || e.Expected > 51 {
+				t.Fatalf("unexpected event for {app=\"bar\"}: %+v", e)
+			}
+		default:
+			t.Fatalf("unexpected event: %+v", e)
+		}
+		if e.TenantID != tenantID {
+			t.Fatalf("unexpected tenant for event: %+v", e)
+		}
+	}
+
+	// Observations for other tenants must not affect the baselines for the given tenant
+	events = d.processObservations(logstorage.TenantID{AccountID: 2}, ts, nil)
+	if len(events) > 0 {
+		t.Fatalf("unexpected events for another tenant: %v", events)
+	}
+
+	// Baselines for streams without logs during the seasonal period must be dropped
+	ts += cfg.seasonalPeriod + 1
+	process(nil)
+	if n := d.streamsCount(); n != 0 {
+		t.Fatalf("unexpected number of tracked streams; got %d; want 0", n)
+	}
+}
+
+func TestSeasonalEWMAUpdate(t *testing.T) {
+	cfg := &detectorConfig{
+		alpha:        0.5,
+		threshold:    3,
+		minDeviation: 1,
+		minSamples:   3,
+	}
+	se := newSeasonalEWMA(2)
+
+	// Buckets must be independent
+	for i := 0; i < 10; i++ {
+		if ok, _, _ := se.update(cfg, 0, 10); ok {
+			t.Fatalf("unexpected anomaly at bucket 0")
+		}
+		if ok, _, _ := se.update(cfg, 1, 1000); ok {
+			t.Fatalf("unexpected anomaly at bucket 1")
+		}
+	}
+
+	ok, expected, stddev := se.update(cfg, 0, 1000)
+	if !ok {
+		t.Fatalf("expecting anomaly at bucket 0")
+	}
+	if expected != 10 || stddev != 0 {
+		t.Fatalf("unexpected baseline; got %v ± %v; want 10 ± 0", expected, stddev)
+	}
+}
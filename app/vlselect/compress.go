@@ -0,0 +1,146 @@
+package vlselect
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// isResponseCompressionDisabled is set to true if -http.disableResponseCompression command-line flag is set.
+var isResponseCompressionDisabled bool
+
+func initResponseCompression() {
+	f := flag.Lookup("http.disableResponseCompression")
+	isResponseCompressionDisabled = f != nil && f.Value.String() == "true"
+}
+
+// getZstdResponseWriter returns a writer, which compresses the response with zstd if the client prefers zstd according to Accept-Encoding request header.
+//
+// Otherwise w is returned as is. gzip compression is applied by the http server for such responses if the client accepts gzip.
+//
+// The returned writer must be closed via closeZstdResponseWriter after the response is written.
+func getZstdResponseWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if isResponseCompressionDisabled || r.Method == http.MethodHead || !isZstdPreferred(r.Header.Get("Accept-Encoding")) {
+		return w
+	}
+
+	h := w.Header()
+	h.Set("Content-Encoding", "zstd")
+
+	zrw := zstdResponseWriterPool.Get().(*zstdResponseWriter)
+	zrw.w = w
+	zrw.zw.Reset(w)
+	return zrw
+}
+
+// closeZstdResponseWriter finishes the response written to w if w has been obtained via getZstdResponseWriter.
+func closeZstdResponseWriter(w http.ResponseWriter) {
+	zrw, ok := w.(*zstdResponseWriter)
+	if !ok {
+		return
+	}
+	if zrw.wroteHeader {
+		// Ignore the error, since it is returned only when the client closes the connection.
+		_ = zrw.zw.Close()
+	} else {
+		// Nothing has been written to the response, so it may be written by the caller without compression.
+		zrw.w.Header().Del("Content-Encoding")
+	}
+	zrw.zw.Reset(nil)
+	zrw.w = nil
+	zrw.wroteHeader = false
+	zstdResponseWriterPool.Put(zrw)
+}
+
+var zstdResponseWriterPool = sync.Pool{
+	New: func() any {
+		zw, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+		if err != nil {
+			panic(err)
+		}
+		return &zstdResponseWriter{
+			zw: zw,
+		}
+	},
+}
+
+// zstdResponseWriter compresses the response with zstd in a streaming manner.
+type zstdResponseWriter struct {
+	w  http.ResponseWriter
+	zw *zstd.Encoder
+
+	wroteHeader bool
+}
+
+// Header implements http.ResponseWriter interface.
+func (zrw *zstdResponseWriter) Header() http.Header {
+	return zrw.w.Header()
+}
+
+// WriteHeader implements http.ResponseWriter interface.
+func (zrw *zstdResponseWriter) WriteHeader(statusCode int) {
+	if zrw.wroteHeader {
+		return
+	}
+	zrw.wroteHeader = true
+
+	// The length of compressed response is unknown in advance.
+	zrw.w.Header().Del("Content-Length")
+	zrw.w.WriteHeader(statusCode)
+}
+
+// Write implements io.Writer interface.
+func (zrw *zstdResponseWriter) Write(p []byte) (int, error) {
+	if !zrw.wroteHeader {
+		zrw.WriteHeader(http.StatusOK)
+	}
+	return zrw.zw.Write(p)
+}
+
+// Flush implements http.Flusher interface.
+//
+// It sends all the buffered data to the client, so it could be decompressed at client side.
+// This is needed for streaming responses such as live tailing.
+func (zrw *zstdResponseWriter) Flush() {
+	if !zrw.wroteHeader {
+		zrw.WriteHeader(http.StatusOK)
+	}
+	_ = zrw.zw.Flush()
+	if f, ok := zrw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// isZstdPreferred returns true if acceptEncoding allows zstd encoding with the priority not lower than gzip encoding.
+//
+// See https://developer.mozilla.org/en-US/docs/Web/HTTP/Reference/Headers/Accept-Encoding
+func isZstdPreferred(acceptEncoding string) bool {
+	if acceptEncoding == "" {
+		return false
+	}
+	zstdQ := -1.0
+	gzipQ := -1.0
+	for _, s := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(s, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		switch name {
+		case "zstd":
+			zstdQ = q
+		case "gzip":
+			gzipQ = q
+		}
+	}
+	return zstdQ > 0 && zstdQ >= gzipQ
+}
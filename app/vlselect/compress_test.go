@@ -0,0 +1,105 @@
+package vlselect
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestIsZstdPreferred(t *testing.T) {
+	f := func(acceptEncoding string, resultExpected bool) {
+		t.Helper()
+
+		result := isZstdPreferred(acceptEncoding)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for Accept-Encoding: %q; got %v; want %v", acceptEncoding, result, resultExpected)
+		}
+	}
+
+	f("", false)
+	f("gzip", false)
+	f("gzip, deflate, br", false)
+	f("zstd", true)
+	f("ZSTD", true)
+	f("gzip, zstd", true)
+	f("deflate, gzip, br, zstd", true)
+	f("gzip;q=1.0, zstd;q=0.8", false)
+	f("gzip;q=0.5, zstd;q=0.8", true)
+	f("zstd;q=0", false)
+	f("zstd;q=foo", false)
+}
+
+func TestZstdResponseWriter(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/select/logsql/query", nil)
+	r.Header.Set("Accept-Encoding", "gzip, zstd")
+	rec := httptest.NewRecorder()
+
+	w := getZstdResponseWriter(rec, r)
+	if _, ok := w.(*zstdResponseWriter); !ok {
+		t.Fatalf("expecting zstd response writer; got %T", w)
+	}
+
+	// Verify that the flushed data can be decompressed before the response is finished.
+	chunk := []byte("foo bar\n")
+	if _, err := w.Write(chunk); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w.(http.Flusher).Flush()
+	if !rec.Flushed {
+		t.Fatalf("expecting flushed response")
+	}
+	zr, err := zstd.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("cannot create zstd reader: %s", err)
+	}
+	result := make([]byte, len(chunk))
+	if _, err := io.ReadFull(zr, result); err != nil {
+		t.Fatalf("cannot read flushed data: %s", err)
+	}
+	zr.Close()
+	if !bytes.Equal(result, chunk) {
+		t.Fatalf("unexpected flushed data; got %q; want %q", result, chunk)
+	}
+
+	if _, err := w.Write([]byte("baz\n")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	closeZstdResponseWriter(w)
+
+	if ce := rec.Header().Get("Content-Encoding"); ce != "zstd" {
+		t.Fatalf("unexpected Content-Encoding; got %q; want %q", ce, "zstd")
+	}
+	zr, err = zstd.NewReader(nil)
+	if err != nil {
+		t.Fatalf("cannot create zstd reader: %s", err)
+	}
+	defer zr.Close()
+	data, err := zr.DecodeAll(rec.Body.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("cannot decompress response: %s", err)
+	}
+	if string(data) != "foo bar\nbaz\n" {
+		t.Fatalf("unexpected response; got %q; want %q", data, "foo bar\nbaz\n")
+	}
+}
+
+func TestZstdResponseWriter_Empty(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/select/logsql/query", nil)
+	r.Header.Set("Accept-Encoding", "zstd")
+	rec := httptest.NewRecorder()
+
+	w := getZstdResponseWriter(rec, r)
+	closeZstdResponseWriter(w)
+
+	// The response must remain uncompressed if nothing has been written to it.
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Fatalf("unexpected Content-Encoding; got %q; want empty", ce)
+	}
+	if rec.Body.Len() > 0 {
+		t.Fatalf("unexpected non-empty response: %q", rec.Body.Bytes())
+	}
+}
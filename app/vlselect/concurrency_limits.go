@@ -0,0 +1,352 @@
+package vlselect
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/logsql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	maxConcurrentRequestsPerTenant = flag.Int("search.maxConcurrentRequestsPerTenant", 0, "The maximum number of concurrent search requests per tenant. "+
+		"Other requests for the tenant wait in the queue for up to -search.maxQueueDuration. By default there is no limit. "+
+		"See also -search.tenantMaxConcurrentRequests and https://docs.victoriametrics.com/victorialogs/querying/#per-tenant-and-per-user-concurrency-limits")
+	tenantMaxConcurrentRequests = flagutil.NewArrayString("search.tenantMaxConcurrentRequests", "Optional per-tenant limits on the number of concurrent search requests "+
+		"in the form 'accountID:projectID=N'. It overrides -search.maxConcurrentRequestsPerTenant for the given tenant. Zero N means no limit. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#per-tenant-and-per-user-concurrency-limits")
+	maxConcurrentRequestsPerUser = flag.Int("search.maxConcurrentRequestsPerUser", 0, "The maximum number of concurrent search requests per user. "+
+		"The user is obtained from -search.userHeader request header or from Basic Auth username. "+
+		"Other requests for the user wait in the queue for up to -search.maxQueueDuration. By default there is no limit. "+
+		"See also -search.userMaxConcurrentRequests and https://docs.victoriametrics.com/victorialogs/querying/#per-tenant-and-per-user-concurrency-limits")
+	userMaxConcurrentRequests = flagutil.NewArrayString("search.userMaxConcurrentRequests", "Optional per-user limits on the number of concurrent search requests "+
+		"in the form 'user=N'. It overrides -search.maxConcurrentRequestsPerUser for the given user. Zero N means no limit. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#per-tenant-and-per-user-concurrency-limits")
+	concurrencyLimitsAuthKey = flagutil.NewPassword("concurrencyLimitsAuthKey", "authKey, which must be passed in query string to /internal/concurrency_limits . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#per-tenant-and-per-user-concurrency-limits")
+)
+
+var (
+	tenantConcurrencyLimiter = newKeyedConcurrencyLimiter("tenant", maxConcurrentRequestsPerTenant)
+	userConcurrencyLimiter   = newKeyedConcurrencyLimiter("user", maxConcurrentRequestsPerUser)
+)
+
+func mustInitConcurrencyLimits() {
+	tenantLimits, userLimits, err := parseConcurrencyLimitsFlags()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	tenantConcurrencyLimiter.setOverrides(tenantLimits)
+	userConcurrencyLimiter.setOverrides(userLimits)
+}
+
+func parseConcurrencyLimitsFlags() (map[string]int, map[string]int, error) {
+	tenantLimits, err := parseConcurrencyLimits(*tenantMaxConcurrentRequests, "accountID:projectID", normalizeTenant)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse -search.tenantMaxConcurrentRequests: %w", err)
+	}
+	userLimits, err := parseConcurrencyLimits(*userMaxConcurrentRequests, "user", normalizeUser)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse -search.userMaxConcurrentRequests: %w", err)
+	}
+	return tenantLimits, userLimits, nil
+}
+
+// parseConcurrencyLimits parses limits in the form 'key=N' from a.
+//
+// normalizeKey is used for validating and normalizing keys.
+func parseConcurrencyLimits(a []string, keyName string, normalizeKey func(s string) (string, error)) (map[string]int, error) {
+	m := make(map[string]int, len(a))
+	for _, s := range a {
+		n := strings.LastIndexByte(s, '=')
+		if n < 0 {
+			return nil, fmt.Errorf("missing '=' in %q; expecting '%s=N'", s, keyName)
+		}
+		key, err := normalizeKey(s[:n])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s at %q: %w", keyName, s, err)
+		}
+		limit, err := strconv.Atoi(s[n+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse limit at %q: %w", s, err)
+		}
+		if limit < 0 {
+			return nil, fmt.Errorf("limit at %q cannot be negative", s)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("duplicate limit for %s %q", keyName, key)
+		}
+		m[key] = limit
+	}
+	return m, nil
+}
+
+func normalizeTenant(s string) (string, error) {
+	tenantID, err := logstorage.ParseTenantID(s)
+	if err != nil {
+		return "", err
+	}
+	return getTenantKey(tenantID), nil
+}
+
+func normalizeUser(s string) (string, error) {
+	if s == "" {
+		return "", fmt.Errorf("user cannot be empty")
+	}
+	return s, nil
+}
+
+func getTenantKey(tenantID logstorage.TenantID) string {
+	return fmt.Sprintf("%d:%d", tenantID.AccountID, tenantID.ProjectID)
+}
+
+// acquirePerTenantAndUserConcurrency waits until the request r can be executed according to per-tenant and per-user concurrency limits.
+//
+// The returned release func must be called when the request is finished.
+func acquirePerTenantAndUserConcurrency(ctx context.Context, r *http.Request) (func(), error) {
+	// Ignore the error, since the request is rejected later if the tenant cannot be obtained from r.
+	var tenantKey string
+	if tenantID, err := logstorage.GetTenantIDFromRequest(r); err == nil {
+		tenantKey = getTenantKey(tenantID)
+	}
+	user := logsql.GetRequestUser(r)
+
+	// Limit the time spent in the queue by -search.maxQueueDuration.
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, *maxQueueDuration)
+	defer cancel()
+
+	if err := tenantConcurrencyLimiter.acquire(ctx, ctxWithTimeout, tenantKey); err != nil {
+		return nil, err
+	}
+	if err := userConcurrencyLimiter.acquire(ctx, ctxWithTimeout, user); err != nil {
+		tenantConcurrencyLimiter.release(tenantKey)
+		return nil, err
+	}
+
+	release := func() {
+		userConcurrencyLimiter.release(user)
+		tenantConcurrencyLimiter.release(tenantKey)
+	}
+	return release, nil
+}
+
+// keyedConcurrencyLimiter limits the number of concurrent requests per key.
+type keyedConcurrencyLimiter struct {
+	// scope is the name of the limited entity such as tenant or user.
+	scope string
+
+	// defaultLimit is the limit for keys without overrides. Zero means no limit.
+	defaultLimit *int
+
+	limitReached *metrics.Counter
+	limitTimeout *metrics.Counter
+
+	mu sync.Mutex
+
+	// overrides contains per-key limits, which override defaultLimit.
+	overrides map[string]int
+
+	// current contains the number of currently executed requests per key.
+	current map[string]int
+
+	// waitChs contains channels per key, which are closed when the number of currently executed requests for the key is decreased.
+	waitChs map[string]chan struct{}
+}
+
+func newKeyedConcurrencyLimiter(scope string, defaultLimit *int) *keyedConcurrencyLimiter {
+	return &keyedConcurrencyLimiter{
+		scope:        scope,
+		defaultLimit: defaultLimit,
+
+		limitReached: metrics.NewCounter(fmt.Sprintf(`vl_concurrent_select_limit_reached_total{scope=%q}`, scope)),
+		limitTimeout: metrics.NewCounter(fmt.Sprintf(`vl_concurrent_select_limit_timeout_total{scope=%q}`, scope)),
+
+		overrides: make(map[string]int),
+		current:   make(map[string]int),
+		waitChs:   make(map[string]chan struct{}),
+	}
+}
+
+func (cl *keyedConcurrencyLimiter) getLimitLocked(key string) int {
+	if limit, ok := cl.overrides[key]; ok {
+		return limit
+	}
+	return *cl.defaultLimit
+}
+
+// acquire waits until the request for the given key can be executed.
+//
+// ctx is the request context, while ctxWithTimeout limits the wait time in the queue.
+// Requests with empty key are executed without limits.
+func (cl *keyedConcurrencyLimiter) acquire(ctx, ctxWithTimeout context.Context, key string) error {
+	if key == "" {
+		return nil
+	}
+
+	startTime := time.Now()
+	limitReached := false
+	for {
+		cl.mu.Lock()
+		limit := cl.getLimitLocked(key)
+		if limit <= 0 || cl.current[key] < limit {
+			cl.current[key]++
+			cl.mu.Unlock()
+			return nil
+		}
+		ch := cl.waitChs[key]
+		if ch == nil {
+			ch = make(chan struct{})
+			cl.waitChs[key] = ch
+		}
+		cl.mu.Unlock()
+
+		if !limitReached {
+			limitReached = true
+			cl.limitReached.Inc()
+		}
+
+		select {
+		case <-ch:
+		case <-ctxWithTimeout.Done():
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			cl.limitTimeout.Inc()
+			return &httpserver.ErrorWithStatusCode{
+				Err: fmt.Errorf("couldn't start executing the request in %.3f seconds, since the limit of %d concurrent requests is reached for the %s %q; "+
+					"possible solutions: to reduce query load for the %s; to increase the limit; to increase -search.maxQueueDuration=%s",
+					time.Since(startTime).Seconds(), limit, cl.scope, key, cl.scope, maxQueueDuration),
+				StatusCode: http.StatusTooManyRequests,
+			}
+		}
+	}
+}
+
+// release must be called when the request for the given key acquired via acquire is finished.
+func (cl *keyedConcurrencyLimiter) release(key string) {
+	if key == "" {
+		return
+	}
+
+	cl.mu.Lock()
+	cl.current[key]--
+	if cl.current[key] <= 0 {
+		delete(cl.current, key)
+	}
+	cl.notifyWaitersLocked(key)
+	cl.mu.Unlock()
+}
+
+func (cl *keyedConcurrencyLimiter) notifyWaitersLocked(key string) {
+	if ch := cl.waitChs[key]; ch != nil {
+		close(ch)
+		delete(cl.waitChs, key)
+	}
+}
+
+// setOverrides replaces all the per-key limits with m.
+func (cl *keyedConcurrencyLimiter) setOverrides(m map[string]int) {
+	cl.mu.Lock()
+	cl.overrides = m
+	for key := range cl.waitChs {
+		cl.notifyWaitersLocked(key)
+	}
+	cl.mu.Unlock()
+}
+
+// setOverride sets the limit for the given key. Negative limit removes the override for the key.
+func (cl *keyedConcurrencyLimiter) setOverride(key string, limit int) {
+	cl.mu.Lock()
+	if limit < 0 {
+		delete(cl.overrides, key)
+	} else {
+		cl.overrides[key] = limit
+	}
+	cl.notifyWaitersLocked(key)
+	cl.mu.Unlock()
+}
+
+// concurrencyLimitsStatus is the JSON representation of keyedConcurrencyLimiter returned from /internal/concurrency_limits.
+type concurrencyLimitsStatus struct {
+	DefaultLimit int            `json:"default_limit"`
+	Overrides    map[string]int `json:"overrides"`
+	Current      map[string]int `json:"current"`
+}
+
+func (cl *keyedConcurrencyLimiter) getStatus() *concurrencyLimitsStatus {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	st := &concurrencyLimitsStatus{
+		DefaultLimit: *cl.defaultLimit,
+		Overrides:    make(map[string]int, len(cl.overrides)),
+		Current:      make(map[string]int, len(cl.current)),
+	}
+	for k, v := range cl.overrides {
+		st.Overrides[k] = v
+	}
+	for k, v := range cl.current {
+		st.Current[k] = v
+	}
+	return st
+}
+
+// processConcurrencyLimitsRequest processes /internal/concurrency_limits request.
+//
+// The request returns the current per-tenant and per-user concurrency limits.
+// The limit for the given tenant or user can be overridden via tenant or user query arg plus limit query arg.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#per-tenant-and-per-user-concurrency-limits
+func processConcurrencyLimitsRequest(w http.ResponseWriter, r *http.Request) {
+	if !httpserver.CheckAuthFlag(w, r, concurrencyLimitsAuthKey) {
+		return
+	}
+
+	if limitStr := r.FormValue("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot parse limit=%q: %s", limitStr, err)
+			return
+		}
+
+		tenant := r.FormValue("tenant")
+		user := r.FormValue("user")
+		switch {
+		case tenant != "" && user == "":
+			key, err := normalizeTenant(tenant)
+			if err != nil {
+				httpserver.Errorf(w, r, "cannot parse tenant=%q: %s", tenant, err)
+				return
+			}
+			tenantConcurrencyLimiter.setOverride(key, limit)
+		case user != "" && tenant == "":
+			userConcurrencyLimiter.setOverride(user, limit)
+		default:
+			httpserver.Errorf(w, r, "exactly one of tenant or user query args must be set together with limit query arg")
+			return
+		}
+		logger.Infof("updated concurrency limit for tenant=%q, user=%q to %d by the request from %s", tenant, user, limit, httpserver.GetQuotedRemoteAddr(r))
+	}
+
+	data, err := json.Marshal(map[string]*concurrencyLimitsStatus{
+		"tenants": tenantConcurrencyLimiter.getStatus(),
+		"users":   userConcurrencyLimiter.getStatus(),
+	})
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal concurrency limits to JSON: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s", data)
+}
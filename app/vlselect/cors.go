@@ -0,0 +1,90 @@
+package vlselect
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+var (
+	corsAllowedOrigins = flagutil.NewArrayString("select.corsAllowedOrigins", "Optional list of origins allowed to send cross-origin requests to /select/* endpoints, "+
+		"for example, https://logs-ui.example.com . An origin may be set to '*' in order to allow all the origins. "+
+		"By default all the origins are allowed via 'Access-Control-Allow-Origin: *' response header unless -http.disableCORS is set. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#cors")
+	corsAllowedMethods = flagutil.NewArrayString("select.corsAllowedMethods", "Optional list of HTTP methods allowed in cross-origin requests to /select/* endpoints. "+
+		"By default GET and POST methods are allowed. See https://docs.victoriametrics.com/victorialogs/querying/#cors")
+	corsAllowedHeaders = flagutil.NewArrayString("select.corsAllowedHeaders", "Optional list of HTTP request headers allowed in cross-origin requests to /select/* endpoints. "+
+		"By default all the headers requested by the browser are allowed. See https://docs.victoriametrics.com/victorialogs/querying/#cors")
+	corsAllowCredentials = flag.Bool("select.corsAllowCredentials", false, "Whether to allow cross-origin requests with credentials such as cookies and Authorization header "+
+		"to /select/* endpoints from -select.corsAllowedOrigins. See https://docs.victoriametrics.com/victorialogs/querying/#cors")
+	corsMaxAge = flag.Duration("select.corsMaxAge", 0, "The duration for caching the results of CORS preflight requests to /select/* endpoints by browsers. "+
+		"The default browser duration is used if it is set to 0. See https://docs.victoriametrics.com/victorialogs/querying/#cors")
+)
+
+// enableCORS sets CORS response headers for the request r according to -select.cors* command-line flags.
+func enableCORS(w http.ResponseWriter, r *http.Request) {
+	if len(*corsAllowedOrigins) == 0 {
+		httpserver.EnableCORS(w, r)
+		return
+	}
+
+	origin := r.Header.Get("Origin")
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	if origin == "" || !isAllowedOrigin(origin) {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if *corsAllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// processPreflightRequest processes CORS preflight request r.
+//
+// It returns false if r isn't a CORS preflight request.
+//
+// See https://developer.mozilla.org/en-US/docs/Glossary/Preflight_request
+func processPreflightRequest(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+
+	enableCORS(w, r)
+
+	h := w.Header()
+	if h.Get("Access-Control-Allow-Origin") != "" {
+		allowedMethods := *corsAllowedMethods
+		if len(allowedMethods) == 0 {
+			allowedMethods = []string{http.MethodGet, http.MethodPost}
+		}
+		h.Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+
+		if len(*corsAllowedHeaders) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(*corsAllowedHeaders, ", "))
+		} else if requestHeaders := r.Header.Get("Access-Control-Request-Headers"); requestHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", requestHeaders)
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if *corsMaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(*corsMaxAge/time.Second)))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func isAllowedOrigin(origin string) bool {
+	for _, allowedOrigin := range *corsAllowedOrigins {
+		if allowedOrigin == "*" || strings.EqualFold(allowedOrigin, origin) {
+			return true
+		}
+	}
+	return false
+}
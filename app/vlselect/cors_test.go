@@ -0,0 +1,118 @@
+package vlselect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEnableCORS(t *testing.T) {
+	defer func() {
+		*corsAllowedOrigins = nil
+		*corsAllowCredentials = false
+	}()
+
+	f := func(origin, allowOriginExpected, allowCredentialsExpected string) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/select/logsql/query", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		enableCORS(w, r)
+
+		if v := w.Header().Get("Access-Control-Allow-Origin"); v != allowOriginExpected {
+			t.Fatalf("unexpected Access-Control-Allow-Origin for origin=%q; got %q; want %q", origin, v, allowOriginExpected)
+		}
+		if v := w.Header().Get("Access-Control-Allow-Credentials"); v != allowCredentialsExpected {
+			t.Fatalf("unexpected Access-Control-Allow-Credentials for origin=%q; got %q; want %q", origin, v, allowCredentialsExpected)
+		}
+	}
+
+	// all the origins are allowed by default
+	f("", "*", "")
+	f("https://foo.example.com", "*", "")
+
+	// only the configured origins are allowed
+	*corsAllowedOrigins = []string{"https://foo.example.com", "https://bar.example.com"}
+	f("", "", "")
+	f("https://foo.example.com", "https://foo.example.com", "")
+	f("https://BAR.example.com", "https://BAR.example.com", "")
+	f("https://baz.example.com", "", "")
+
+	*corsAllowCredentials = true
+	f("https://foo.example.com", "https://foo.example.com", "true")
+	f("https://baz.example.com", "", "")
+
+	// wildcard origin
+	*corsAllowedOrigins = []string{"*"}
+	f("https://baz.example.com", "https://baz.example.com", "true")
+}
+
+func TestProcessPreflightRequest(t *testing.T) {
+	defer func() {
+		*corsAllowedOrigins = nil
+		*corsAllowedMethods = nil
+		*corsAllowedHeaders = nil
+		*corsMaxAge = 0
+	}()
+
+	f := func(origin, requestHeaders, allowOriginExpected, allowMethodsExpected, allowHeadersExpected, maxAgeExpected string) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodOptions, "/select/logsql/query", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		if requestHeaders != "" {
+			r.Header.Set("Access-Control-Request-Headers", requestHeaders)
+		}
+		w := httptest.NewRecorder()
+		if !processPreflightRequest(w, r) {
+			t.Fatalf("expecting preflight request to be processed")
+		}
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("unexpected status code; got %d; want %d", w.Code, http.StatusNoContent)
+		}
+
+		h := w.Header()
+		if v := h.Get("Access-Control-Allow-Origin"); v != allowOriginExpected {
+			t.Fatalf("unexpected Access-Control-Allow-Origin; got %q; want %q", v, allowOriginExpected)
+		}
+		if v := h.Get("Access-Control-Allow-Methods"); v != allowMethodsExpected {
+			t.Fatalf("unexpected Access-Control-Allow-Methods; got %q; want %q", v, allowMethodsExpected)
+		}
+		if v := h.Get("Access-Control-Allow-Headers"); v != allowHeadersExpected {
+			t.Fatalf("unexpected Access-Control-Allow-Headers; got %q; want %q", v, allowHeadersExpected)
+		}
+		if v := h.Get("Access-Control-Max-Age"); v != maxAgeExpected {
+			t.Fatalf("unexpected Access-Control-Max-Age; got %q; want %q", v, maxAgeExpected)
+		}
+	}
+
+	// default settings
+	f("https://foo.example.com", "", "*", "GET, POST", "", "")
+	f("https://foo.example.com", "Authorization, AccountID", "*", "GET, POST", "Authorization, AccountID", "")
+
+	// custom settings
+	*corsAllowedOrigins = []string{"https://foo.example.com"}
+	*corsAllowedMethods = []string{"GET"}
+	*corsAllowedHeaders = []string{"Authorization", "Content-Type"}
+	*corsMaxAge = 10 * time.Minute
+	f("https://foo.example.com", "AccountID", "https://foo.example.com", "GET", "Authorization, Content-Type", "600")
+
+	// disallowed origin
+	f("https://bar.example.com", "AccountID", "", "", "", "")
+
+	// non-preflight requests
+	r := httptest.NewRequest(http.MethodOptions, "/select/logsql/query", nil)
+	if processPreflightRequest(httptest.NewRecorder(), r) {
+		t.Fatalf("unexpected processing of OPTIONS request without Access-Control-Request-Method header")
+	}
+	r = httptest.NewRequest(http.MethodGet, "/select/logsql/query", nil)
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	if processPreflightRequest(httptest.NewRecorder(), r) {
+		t.Fatalf("unexpected processing of GET request")
+	}
+}
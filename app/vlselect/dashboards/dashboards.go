@@ -0,0 +1,449 @@
+package dashboards
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	dashboardsPath = flag.String("dashboards.path", "", "Path to a file for storing dashboards created via /select/dashboards API. "+
+		"The /select/dashboards API is disabled if this flag is empty; see https://docs.victoriametrics.com/victorialogs/querying/#dashboards")
+	maxDashboardsPerTenant = flag.Int("dashboards.maxPerTenant", 1000, "The maximum number of dashboards per tenant, which can be created via /select/dashboards API")
+)
+
+// maxDashboardSize is the maximum size of a dashboard in JSON, which can be passed to /select/dashboards API.
+const maxDashboardSize = 1024 * 1024
+
+// maxPanelsPerDashboard is the maximum number of panels per dashboard.
+const maxPanelsPerDashboard = 100
+
+var ds *dashboardsStorage
+
+// IsEnabled returns true if dashboards storage is enabled via -dashboards.path command-line flag.
+func IsEnabled() bool {
+	return *dashboardsPath != ""
+}
+
+// CheckConfig verifies dashboards file set via -dashboards.path.
+func CheckConfig() error {
+	if *dashboardsPath == "" {
+		return nil
+	}
+	if _, err := loadDashboardsStorage(*dashboardsPath); err != nil {
+		return fmt.Errorf("cannot load dashboards from -dashboards.path=%q: %w", *dashboardsPath, err)
+	}
+	return nil
+}
+
+// Init initializes dashboards storage.
+//
+// Dashboards are loaded from -dashboards.path if it is set.
+func Init() {
+	if *dashboardsPath == "" {
+		return
+	}
+	s, err := loadDashboardsStorage(*dashboardsPath)
+	if err != nil {
+		logger.Fatalf("cannot load dashboards from -dashboards.path=%q: %s", *dashboardsPath, err)
+	}
+	ds = s
+}
+
+// Stop stops dashboards storage.
+func Stop() {
+	ds = nil
+}
+
+// RequestHandler handles /select/dashboards requests.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#dashboards
+func RequestHandler(w http.ResponseWriter, r *http.Request, path string) {
+	dashboardsRequests.Inc()
+
+	if ds == nil {
+		httpserver.Errorf(w, r, "/select/dashboards API is disabled; pass -dashboards.path command-line flag for enabling it; "+
+			"see https://docs.victoriametrics.com/victorialogs/querying/#dashboards")
+		return
+	}
+
+	tenantID, err := logstorage.GetTenantIDFromRequest(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain tenantID: %s", err)
+		return
+	}
+
+	id := strings.TrimPrefix(path, "/select/dashboards")
+	id = strings.TrimPrefix(id, "/")
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{
+				"dashboards": ds.list(tenantID),
+			})
+		case http.MethodPost:
+			d, err := readDashboard(r)
+			if err != nil {
+				httpserver.Errorf(w, r, "%s", err)
+				return
+			}
+			d, err = ds.create(tenantID, d)
+			if err != nil {
+				httpserver.Errorf(w, r, "cannot create dashboard: %s", err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, d)
+		default:
+			writeMethodNotAllowed(w, r)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		d, err := ds.get(tenantID, id)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, d)
+	case http.MethodPut:
+		d, err := readDashboard(r)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		d, err = ds.update(tenantID, id, d)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot update dashboard: %s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, d)
+	case http.MethodDelete:
+		if err := ds.delete(tenantID, id); err != nil {
+			httpserver.Errorf(w, r, "cannot delete dashboard: %s", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, r)
+	}
+}
+
+var dashboardsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/dashboards"}`)
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal %T to JSON: %s", v, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(data)
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	err := &httpserver.ErrorWithStatusCode{
+		Err:        fmt.Errorf("method %q isn't allowed", r.Method),
+		StatusCode: http.StatusMethodNotAllowed,
+	}
+	httpserver.Errorf(w, r, "%s", err)
+}
+
+func readDashboard(r *http.Request) (*Dashboard, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxDashboardSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read dashboard from request body: %w", err)
+	}
+	if len(data) > maxDashboardSize {
+		return nil, fmt.Errorf("too big dashboard; it mustn't exceed %d bytes", maxDashboardSize)
+	}
+
+	var d Dashboard
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("cannot parse dashboard: %w", err)
+	}
+	if err := d.validate(); err != nil {
+		return nil, fmt.Errorf("invalid dashboard: %w", err)
+	}
+	if d.Panels == nil {
+		d.Panels = []Panel{}
+	}
+	return &d, nil
+}
+
+// Dashboard is a dashboard with log panels.
+type Dashboard struct {
+	// ID is an unique id of the dashboard. It is generated when the dashboard is created.
+	ID string `json:"id"`
+
+	// Title is the dashboard title.
+	Title string `json:"title"`
+
+	// Description is an optional dashboard description.
+	Description string `json:"description,omitempty"`
+
+	// Panels contains dashboard panels.
+	Panels []Panel `json:"panels"`
+
+	// CreatedAt is the time when the dashboard has been created.
+	CreatedAt time.Time `json:"created_at"`
+
+	// UpdatedAt is the time when the dashboard has been updated last time.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Panel is a single panel at the Dashboard.
+type Panel struct {
+	// Title is the panel title.
+	Title string `json:"title,omitempty"`
+
+	// Query is LogsQL query for the panel.
+	Query string `json:"query"`
+
+	// Type is the visualization type for the panel.
+	Type string `json:"type"`
+
+	// Layout is the panel position and size at the dashboard.
+	Layout PanelLayout `json:"layout"`
+}
+
+// PanelLayout is the position and size of the Panel at the Dashboard grid.
+type PanelLayout struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// panelTypes contains the supported visualization types for panels.
+var panelTypes = []string{"logs", "table", "json", "hits", "stats"}
+
+func (d *Dashboard) validate() error {
+	if d.Title == "" {
+		return fmt.Errorf("missing title")
+	}
+	if len(d.Panels) > maxPanelsPerDashboard {
+		return fmt.Errorf("too many panels: %d; mustn't exceed %d", len(d.Panels), maxPanelsPerDashboard)
+	}
+	for i := range d.Panels {
+		if err := d.Panels[i].validate(); err != nil {
+			return fmt.Errorf("invalid panel #%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (p *Panel) validate() error {
+	if p.Query == "" {
+		return fmt.Errorf("missing query")
+	}
+	if _, err := logstorage.ParseQuery(p.Query); err != nil {
+		return fmt.Errorf("cannot parse query %q: %w", p.Query, err)
+	}
+	if !slices.Contains(panelTypes, p.Type) {
+		return fmt.Errorf("unsupported type %q; supported types: %q", p.Type, panelTypes)
+	}
+	l := &p.Layout
+	if l.X < 0 || l.Y < 0 || l.W < 0 || l.H < 0 {
+		return fmt.Errorf("layout cannot contain negative values; got x=%d, y=%d, w=%d, h=%d", l.X, l.Y, l.W, l.H)
+	}
+	return nil
+}
+
+// dashboardsStorage holds dashboards in memory and persists them to the file at path on every change.
+type dashboardsStorage struct {
+	path string
+
+	mu sync.Mutex
+	m  map[logstorage.TenantID][]*Dashboard
+}
+
+// tenantDashboards is used for persisting dashboards for a single tenant.
+type tenantDashboards struct {
+	AccountID  uint32       `json:"account_id"`
+	ProjectID  uint32       `json:"project_id"`
+	Dashboards []*Dashboard `json:"dashboards"`
+}
+
+func loadDashboardsStorage(path string) (*dashboardsStorage, error) {
+	s := &dashboardsStorage{
+		path: path,
+		m:    make(map[logstorage.TenantID][]*Dashboard),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var tds []tenantDashboards
+	if err := json.Unmarshal(data, &tds); err != nil {
+		return nil, fmt.Errorf("cannot parse dashboards: %w", err)
+	}
+	for _, td := range tds {
+		tenantID := logstorage.TenantID{
+			AccountID: td.AccountID,
+			ProjectID: td.ProjectID,
+		}
+		s.m[tenantID] = append(s.m[tenantID], td.Dashboards...)
+	}
+	return s, nil
+}
+
+// mustSaveLocked persists s to s.path.
+//
+// s.mu must be locked by the caller.
+func (s *dashboardsStorage) mustSaveLocked() {
+	tds := make([]tenantDashboards, 0, len(s.m))
+	for tenantID, dashboards := range s.m {
+		tds = append(tds, tenantDashboards{
+			AccountID:  tenantID.AccountID,
+			ProjectID:  tenantID.ProjectID,
+			Dashboards: dashboards,
+		})
+	}
+	slices.SortFunc(tds, func(a, b tenantDashboards) int {
+		if a.AccountID != b.AccountID {
+			return cmp.Compare(a.AccountID, b.AccountID)
+		}
+		return cmp.Compare(a.ProjectID, b.ProjectID)
+	})
+
+	data, err := json.MarshalIndent(tds, "", "  ")
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal dashboards: %s", err)
+	}
+	fs.MustMkdirIfNotExist(filepath.Dir(s.path))
+	fs.MustWriteAtomic(s.path, data, true)
+}
+
+func (s *dashboardsStorage) list(tenantID logstorage.TenantID) []*Dashboard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dashboards := slices.Clone(s.m[tenantID])
+	slices.SortFunc(dashboards, func(a, b *Dashboard) int {
+		if n := strings.Compare(a.Title, b.Title); n != 0 {
+			return n
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	if dashboards == nil {
+		dashboards = []*Dashboard{}
+	}
+	return dashboards
+}
+
+func (s *dashboardsStorage) get(tenantID logstorage.TenantID, id string) (*Dashboard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.indexLocked(tenantID, id)
+	if idx < 0 {
+		return nil, newNotFoundError(id)
+	}
+	return s.m[tenantID][idx], nil
+}
+
+func (s *dashboardsStorage) create(tenantID logstorage.TenantID, d *Dashboard) (*Dashboard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dashboards := s.m[tenantID]
+	if len(dashboards) >= *maxDashboardsPerTenant {
+		return nil, fmt.Errorf("cannot create more than -dashboards.maxPerTenant=%d dashboards per tenant", *maxDashboardsPerTenant)
+	}
+
+	d.ID = newDashboardID()
+	d.CreatedAt = time.Now().UTC()
+	d.UpdatedAt = d.CreatedAt
+	s.m[tenantID] = append(dashboards, d)
+	s.mustSaveLocked()
+
+	return d, nil
+}
+
+func (s *dashboardsStorage) update(tenantID logstorage.TenantID, id string, d *Dashboard) (*Dashboard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.indexLocked(tenantID, id)
+	if idx < 0 {
+		return nil, newNotFoundError(id)
+	}
+
+	// Dashboards are updated in copy-on-write manner, since the returned dashboards can be accessed concurrently.
+	dashboards := slices.Clone(s.m[tenantID])
+	d.ID = id
+	d.CreatedAt = dashboards[idx].CreatedAt
+	d.UpdatedAt = time.Now().UTC()
+	dashboards[idx] = d
+	s.m[tenantID] = dashboards
+	s.mustSaveLocked()
+
+	return d, nil
+}
+
+func (s *dashboardsStorage) delete(tenantID logstorage.TenantID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.indexLocked(tenantID, id)
+	if idx < 0 {
+		return newNotFoundError(id)
+	}
+
+	dashboards := slices.Delete(slices.Clone(s.m[tenantID]), idx, idx+1)
+	if len(dashboards) == 0 {
+		delete(s.m, tenantID)
+	} else {
+		s.m[tenantID] = dashboards
+	}
+	s.mustSaveLocked()
+
+	return nil
+}
+
+func (s *dashboardsStorage) indexLocked(tenantID logstorage.TenantID, id string) int {
+	return slices.IndexFunc(s.m[tenantID], func(d *Dashboard) bool {
+		return d.ID == id
+	})
+}
+
+func newNotFoundError(id string) error {
+	return &httpserver.ErrorWithStatusCode{
+		Err:        fmt.Errorf("cannot find dashboard with id=%q", id),
+		StatusCode: http.StatusNotFound,
+	}
+}
+
+func newDashboardID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		logger.Panicf("FATAL: cannot generate random dashboard id: %s", err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,181 @@
+package dashboards
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestDashboardValidate_Success(t *testing.T) {
+	f := func(d *Dashboard) {
+		t.Helper()
+
+		if err := d.validate(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// dashboard without panels
+	f(&Dashboard{
+		Title: "foo",
+	})
+
+	// dashboard with panels
+	f(&Dashboard{
+		Title:       "foo",
+		Description: "bar",
+		Panels: []Panel{
+			{
+				Query: "error",
+				Type:  "logs",
+			},
+			{
+				Title: "errors per host",
+				Query: "error | stats by (host) count()",
+				Type:  "stats",
+				Layout: PanelLayout{
+					X: 6,
+					W: 6,
+					H: 4,
+				},
+			},
+		},
+	})
+}
+
+func TestDashboardValidate_Failure(t *testing.T) {
+	f := func(d *Dashboard) {
+		t.Helper()
+
+		if err := d.validate(); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// missing title
+	f(&Dashboard{})
+
+	// missing query
+	f(&Dashboard{
+		Title: "foo",
+		Panels: []Panel{
+			{
+				Type: "logs",
+			},
+		},
+	})
+
+	// invalid query
+	f(&Dashboard{
+		Title: "foo",
+		Panels: []Panel{
+			{
+				Query: "foo | stats count(",
+				Type:  "logs",
+			},
+		},
+	})
+
+	// unsupported type
+	f(&Dashboard{
+		Title: "foo",
+		Panels: []Panel{
+			{
+				Query: "*",
+				Type:  "pie",
+			},
+		},
+	})
+
+	// negative layout
+	f(&Dashboard{
+		Title: "foo",
+		Panels: []Panel{
+			{
+				Query: "*",
+				Type:  "logs",
+				Layout: PanelLayout{
+					X: -1,
+				},
+			},
+		},
+	})
+}
+
+func TestDashboardsStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dashboards", "dashboards.json")
+
+	s, err := loadDashboardsStorage(path)
+	if err != nil {
+		t.Fatalf("cannot load empty dashboards storage: %s", err)
+	}
+
+	tenant1 := logstorage.TenantID{AccountID: 1}
+	tenant2 := logstorage.TenantID{AccountID: 2, ProjectID: 3}
+
+	d1, err := s.create(tenant1, &Dashboard{Title: "b"})
+	if err != nil {
+		t.Fatalf("cannot create dashboard: %s", err)
+	}
+	d2, err := s.create(tenant1, &Dashboard{Title: "a"})
+	if err != nil {
+		t.Fatalf("cannot create dashboard: %s", err)
+	}
+	d3, err := s.create(tenant2, &Dashboard{Title: "c"})
+	if err != nil {
+		t.Fatalf("cannot create dashboard: %s", err)
+	}
+	if d1.ID == "" || d1.ID == d2.ID {
+		t.Fatalf("unexpected dashboard ids: %q, %q", d1.ID, d2.ID)
+	}
+
+	// Dashboards must be isolated per tenant
+	if _, err := s.get(tenant2, d1.ID); err == nil {
+		t.Fatalf("expecting non-nil error when obtaining dashboard from another tenant")
+	}
+	if err := s.delete(tenant1, d3.ID); err == nil {
+		t.Fatalf("expecting non-nil error when deleting dashboard from another tenant")
+	}
+
+	// Dashboards must be sorted by title
+	dashboards := s.list(tenant1)
+	if len(dashboards) != 2 || dashboards[0].ID != d2.ID || dashboards[1].ID != d1.ID {
+		t.Fatalf("unexpected dashboards: %v", dashboards)
+	}
+
+	// Update the dashboard
+	d, err := s.update(tenant1, d1.ID, &Dashboard{Title: "c", ID: "ignored"})
+	if err != nil {
+		t.Fatalf("cannot update dashboard: %s", err)
+	}
+	if d.ID != d1.ID || d.Title != "c" || !d.CreatedAt.Equal(d1.CreatedAt) {
+		t.Fatalf("unexpected dashboard after the update: %+v", d)
+	}
+	if _, err := s.update(tenant1, "missing", &Dashboard{Title: "c"}); err == nil {
+		t.Fatalf("expecting non-nil error when updating missing dashboard")
+	}
+
+	// Delete the dashboard
+	if err := s.delete(tenant1, d2.ID); err != nil {
+		t.Fatalf("cannot delete dashboard: %s", err)
+	}
+
+	// Re-open the storage and verify dashboards are persisted
+	s, err = loadDashboardsStorage(path)
+	if err != nil {
+		t.Fatalf("cannot load dashboards storage: %s", err)
+	}
+	dashboards = s.list(tenant1)
+	if len(dashboards) != 1 || dashboards[0].ID != d1.ID || dashboards[0].Title != "c" {
+		t.Fatalf("unexpected dashboards for tenant1: %v", dashboards)
+	}
+	dashboards = s.list(tenant2)
+	if len(dashboards) != 1 || dashboards[0].ID != d3.ID {
+		t.Fatalf("unexpected dashboards for tenant2: %v", dashboards)
+	}
+	dashboards = s.list(logstorage.TenantID{})
+	if len(dashboards) != 0 {
+		t.Fatalf("unexpected dashboards for the default tenant: %v", dashboards)
+	}
+}
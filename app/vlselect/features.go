@@ -0,0 +1,88 @@
+package vlselect
+
+import (
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/anomaly"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/dashboards"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/logsql"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/threatintel"
+)
+
+// queryEndpoints contains querying endpoints served at /select/* paths.
+var queryEndpoints = []string{
+	"/select/logsql/query",
+	"/select/logsql/export",
+	"/select/logsql/tail",
+	"/select/logsql/hits",
+	"/select/logsql/facets",
+	"/select/logsql/field_names",
+	"/select/logsql/field_values",
+	"/select/logsql/stream_field_names",
+	"/select/logsql/stream_field_values",
+	"/select/logsql/stream_ids",
+	"/select/logsql/streams",
+	"/select/logsql/stale_streams",
+	"/select/logsql/stats_query",
+	"/select/logsql/stats_query_range",
+	"/select/logsql/query_time_range",
+	"/select/logsql/metric_hints",
+	"/select/logsql/pin_view",
+	"/select/logsql/unpin_view",
+	"/select/logsql/active_queries",
+	"/select/logsql/cancel",
+	"/select/tenant_ids",
+	"/select/vmui/",
+}
+
+// Features contains querying capabilities of the current VictoriaLogs instance.
+type Features struct {
+	// Endpoints contains the enabled querying endpoints.
+	Endpoints []string `json:"endpoints"`
+
+	// DeleteEnabled is set to true when /delete/* endpoints are enabled via -delete.enable command-line flag.
+	DeleteEnabled bool `json:"delete_enabled"`
+
+	// AnomalyDetectionEnabled is set to true when anomaly detection is enabled via -anomaly.checkInterval command-line flag.
+	AnomalyDetectionEnabled bool `json:"anomaly_detection_enabled"`
+
+	// ThreatIntelEnabled is set to true when threat intel feeds are set via -threatIntel.feed command-line flag.
+	ThreatIntelEnabled bool `json:"threat_intel_enabled"`
+
+	// MaxConcurrentRequests is the value of -search.maxConcurrentRequests command-line flag.
+	MaxConcurrentRequests int `json:"max_concurrent_requests"`
+
+	// MaxQueueDuration is the value of -search.maxQueueDuration command-line flag.
+	MaxQueueDuration string `json:"max_queue_duration"`
+
+	// MaxQueryDuration is the value of -search.maxQueryDuration command-line flag.
+	MaxQueryDuration string `json:"max_query_duration"`
+}
+
+// GetFeatures returns querying capabilities of the current VictoriaLogs instance.
+func GetFeatures() *Features {
+	endpoints := []string{}
+	if !*disableSelect {
+		endpoints = append(endpoints, queryEndpoints...)
+		if dashboards.IsEnabled() {
+			endpoints = append(endpoints, "/select/dashboards")
+		}
+		if logsql.IsHiddenStreamsUpdateEnabled() {
+			endpoints = append(endpoints, "/select/logsql/hide_stream", "/select/logsql/unhide_stream")
+		}
+		if logsql.IsHiddenStreamsEnabled() {
+			endpoints = append(endpoints, "/select/logsql/hidden_streams")
+		}
+	}
+	if *enableDelete {
+		endpoints = append(endpoints, "/delete/run_task", "/delete/stop_task", "/delete/active_tasks")
+	}
+
+	return &Features{
+		Endpoints:               endpoints,
+		DeleteEnabled:           *enableDelete,
+		AnomalyDetectionEnabled: anomaly.IsEnabled(),
+		ThreatIntelEnabled:      threatintel.IsEnabled(),
+		MaxConcurrentRequests:   *maxConcurrentRequests,
+		MaxQueueDuration:        maxQueueDuration.String(),
+		MaxQueryDuration:        maxQueryDuration.String(),
+	}
+}
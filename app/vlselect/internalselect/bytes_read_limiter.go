@@ -0,0 +1,113 @@
+package internalselect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// bytesReadLimiterCheckInterval is the interval for checking the number of bytes read by the query.
+const bytesReadLimiterCheckInterval = 100 * time.Millisecond
+
+var bytesReadLimitExceeded = metrics.NewCounter(`vl_internalselect_max_bytes_read_exceeded_total`)
+
+// bytesReadLimiter stops the query execution when the query reads more than maxBytesRead bytes.
+//
+// The limit is passed by vlselect via max_bytes_read arg. See https://docs.victoriametrics.com/victorialogs/cluster/#cold-tier-limits
+type bytesReadLimiter struct {
+	maxBytesRead uint64
+	cancel       context.CancelCauseFunc
+
+	exceeded atomic.Bool
+}
+
+type bytesReadLimiterKey struct{}
+
+// withBytesReadLimiter returns ctx, which is canceled when the query started via commonParams.NewQueryContext reads more than maxBytesRead bytes.
+//
+// The returned cancel func must be called when the request is processed.
+func withBytesReadLimiter(ctx context.Context, maxBytesRead uint64) (context.Context, *bytesReadLimiter, func()) {
+	ctxWithCancel, cancel := context.WithCancelCause(ctx)
+	brl := &bytesReadLimiter{
+		maxBytesRead: maxBytesRead,
+		cancel:       cancel,
+	}
+	ctxWithCancel = context.WithValue(ctxWithCancel, bytesReadLimiterKey{}, brl)
+	return ctxWithCancel, brl, func() { cancel(nil) }
+}
+
+func getBytesReadLimiter(ctx context.Context) *bytesReadLimiter {
+	brl, _ := ctx.Value(bytesReadLimiterKey{}).(*bytesReadLimiter)
+	return brl
+}
+
+// watch periodically checks the number of bytes read according to qs until ctx is done.
+func (brl *bytesReadLimiter) watch(ctx context.Context, qs *logstorage.QueryStats) {
+	go func() {
+		t := time.NewTicker(bytesReadLimiterCheckInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				qsCopy := qs.LoadAtomic()
+				if qsCopy.GetBytesReadTotal() > brl.maxBytesRead {
+					bytesReadLimitExceeded.Inc()
+					brl.exceeded.Store(true)
+					brl.cancel(brl.err())
+					return
+				}
+			}
+		}
+	}()
+}
+
+// checkBytesReadLimit returns an error if the query executed with the given qctx exceeded the max_bytes_read limit.
+//
+// It must be called before sending the query results to vlselect, since the query may return incomplete results after being stopped by the limiter.
+func checkBytesReadLimit(qctx *logstorage.QueryContext) error {
+	brl := getBytesReadLimiter(qctx.Context)
+	if brl == nil {
+		return nil
+	}
+	if brl.exceeded.Load() {
+		return brl.err()
+	}
+	qs := qctx.QueryStats.LoadAtomic()
+	if qs.GetBytesReadTotal() > brl.maxBytesRead {
+		bytesReadLimitExceeded.Inc()
+		brl.exceeded.Store(true)
+		return brl.err()
+	}
+	return nil
+}
+
+func (brl *bytesReadLimiter) err() error {
+	return fmt.Errorf("the query has been stopped, since it read more than max_bytes_read=%d bytes; "+
+		"possible solutions: to narrow down the query time range; to add more specific filters to the query; "+
+		"to increase -select.coldTierMaxBytesReadPerQuery at vlselect", brl.maxBytesRead)
+}
+
+// getMaxBytesReadFromRequest returns the optional limit on the number of bytes read by the query passed via max_bytes_read arg.
+//
+// Zero is returned if the arg isn't set.
+func getMaxBytesReadFromRequest(r *http.Request) (uint64, error) {
+	s := r.FormValue("max_bytes_read")
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse max_bytes_read=%q: %w", s, err)
+	}
+	return n, nil
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netclient"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netselect"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
@@ -68,7 +69,38 @@ func requestHandler(ctx context.Context, w http.ResponseWriter, r *http.Request,
 	}
 
 	metrics.GetOrCreateCounter(fmt.Sprintf(`vl_http_requests_total{path=%q}`, path)).Inc()
-	if err := rh(ctx, w, r); err != nil && !netutil.IsTrivialNetworkError(err) {
+
+	// Stop the request execution after the timeout passed by vlselect. This guarantees that the query execution is stopped
+	// at the query deadline even if vlselect couldn't close the connection to vlstorage in time.
+	timeout, err := getTimeoutFromRequest(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if timeout > 0 {
+		ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		ctx = ctxWithTimeout
+	}
+
+	maxBytesRead, err := getMaxBytesReadFromRequest(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	var brl *bytesReadLimiter
+	if maxBytesRead > 0 {
+		ctxWithLimiter, limiter, cancel := withBytesReadLimiter(ctx, maxBytesRead)
+		defer cancel()
+		ctx = ctxWithLimiter
+		brl = limiter
+	}
+
+	err = rh(ctx, w, r)
+	if err != nil && brl != nil && brl.exceeded.Load() {
+		err = brl.err()
+	}
+	if err != nil && !netutil.IsTrivialNetworkError(err) {
 		metrics.GetOrCreateCounter(fmt.Sprintf(`vl_http_request_errors_total{path=%q}`, path)).Inc()
 		httpserver.Errorf(w, r, "%s", err)
 		// The return is skipped intentionally in order to track the duration of failed queries.
@@ -84,7 +116,15 @@ var requestHandlers = map[string]func(ctx context.Context, w http.ResponseWriter
 	"/internal/select/stream_field_values": processStreamFieldValuesRequest,
 	"/internal/select/streams":             processStreamsRequest,
 	"/internal/select/stream_ids":          processStreamIDsRequest,
+	"/internal/select/streams_last_seen":   processStreamsLastSeenRequest,
+	"/internal/select/hits_preaggregated":  processHitsPreaggregatedRequest,
+	"/internal/select/approx_count":        processApproxCountRequest,
 	"/internal/select/tenant_ids":          processTenantIDsRequest,
+	"/internal/select/pin_view":            processPinViewRequest,
+	"/internal/select/unpin_view":          processUnpinViewRequest,
+
+	"/internal/select/max_ingested_timestamp": processMaxIngestedTimestampRequest,
+	"/internal/select/node_status":            processNodeStatusRequest,
 
 	"/internal/delete/run_task":     processDeleteRunTask,
 	"/internal/delete/stop_task":    processDeleteStopTask,
@@ -97,6 +137,13 @@ func processQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return err
 	}
 
+	annotateRows, err := getBoolFromRequest(r, "annotate_rows")
+	if err != nil {
+		return err
+	}
+
+	viewID := r.FormValue("view_id")
+
 	w.Header().Set("Content-Type", "application/octet-stream")
 
 	var wLock sync.Mutex
@@ -110,7 +157,7 @@ func processQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 		data := bb.B
 		if !cp.DisableCompression {
 			bufLen := len(bb.B)
-			bb.B = zstd.CompressLevel(bb.B, bb.B, 1)
+			bb.B = zstd.CompressLevel(bb.B, bb.B, cp.CompressionLevel)
 			data = bb.B[bufLen:]
 		}
 
@@ -157,6 +204,8 @@ func processQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 
 	qctx := cp.NewQueryContext(ctx)
+	qctx.AnnotateRows = annotateRows
+	qctx.ViewID = viewID
 	defer cp.UpdatePerQueryStatsMetrics()
 
 	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
@@ -165,6 +214,9 @@ func processQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 	if errP := errGlobal.Load(); errP != nil {
 		return *errP
 	}
+	if err := checkBytesReadLimit(qctx); err != nil {
+		return err
+	}
 
 	// Send the remaining data
 	for _, bb := range bufs.All() {
@@ -196,7 +248,7 @@ func processFieldNamesRequest(ctx context.Context, w http.ResponseWriter, r *htt
 		return fmt.Errorf("cannot obtain field names: %w", err)
 	}
 
-	return writeValuesWithHits(w, qctx, fieldNames, cp.DisableCompression)
+	return writeValuesWithHits(w, qctx, fieldNames, cp)
 }
 
 func processFieldValuesRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -220,7 +272,7 @@ func processFieldValuesRequest(ctx context.Context, w http.ResponseWriter, r *ht
 		return fmt.Errorf("cannot obtain field values: %w", err)
 	}
 
-	return writeValuesWithHits(w, qctx, fieldValues, cp.DisableCompression)
+	return writeValuesWithHits(w, qctx, fieldValues, cp)
 }
 
 func processStreamFieldNamesRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -237,7 +289,7 @@ func processStreamFieldNamesRequest(ctx context.Context, w http.ResponseWriter,
 		return fmt.Errorf("cannot obtain stream field names: %w", err)
 	}
 
-	return writeValuesWithHits(w, qctx, fieldNames, cp.DisableCompression)
+	return writeValuesWithHits(w, qctx, fieldNames, cp)
 }
 
 func processStreamFieldValuesRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -261,7 +313,7 @@ func processStreamFieldValuesRequest(ctx context.Context, w http.ResponseWriter,
 		return fmt.Errorf("cannot obtain stream field values: %w", err)
 	}
 
-	return writeValuesWithHits(w, qctx, fieldValues, cp.DisableCompression)
+	return writeValuesWithHits(w, qctx, fieldValues, cp)
 }
 
 func processStreamsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -283,7 +335,7 @@ func processStreamsRequest(ctx context.Context, w http.ResponseWriter, r *http.R
 		return fmt.Errorf("cannot obtain streams: %w", err)
 	}
 
-	return writeValuesWithHits(w, qctx, streams, cp.DisableCompression)
+	return writeValuesWithHits(w, qctx, streams, cp)
 }
 
 func processStreamIDsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -305,7 +357,175 @@ func processStreamIDsRequest(ctx context.Context, w http.ResponseWriter, r *http
 		return fmt.Errorf("cannot obtain streams: %w", err)
 	}
 
-	return writeValuesWithHits(w, qctx, streamIDs, cp.DisableCompression)
+	return writeValuesWithHits(w, qctx, streamIDs, cp)
+}
+
+func processStreamsLastSeenRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	cp, err := getCommonParams(r, netselect.StreamsLastSeenProtocolVersion)
+	if err != nil {
+		return err
+	}
+
+	qctx := cp.NewQueryContext(ctx)
+	defer cp.UpdatePerQueryStatsMetrics()
+
+	slss, err := vlstorage.GetStreamsLastSeen(qctx)
+	if err != nil {
+		return fmt.Errorf("cannot obtain streams last seen time: %w", err)
+	}
+
+	var b []byte
+
+	// Marshal slss at first
+	b = encoding.MarshalUint64(b, uint64(len(slss)))
+	for i := range slss {
+		b = slss[i].Marshal(b)
+	}
+
+	if err := checkBytesReadLimit(qctx); err != nil {
+		return err
+	}
+
+	// Marshal query stats block after that
+	b = marshalQueryStatsBlock(b, qctx)
+
+	if !cp.DisableCompression {
+		b = zstd.CompressLevel(nil, b, cp.CompressionLevel)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("cannot send response to the client: %w", err)
+	}
+
+	return nil
+}
+
+func processHitsPreaggregatedRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	cp, err := getCommonParams(r, netselect.HitsPreaggregatedProtocolVersion)
+	if err != nil {
+		return err
+	}
+
+	step, err := getInt64FromRequest(r, "step")
+	if err != nil {
+		return err
+	}
+	offset, err := getInt64FromRequest(r, "offset")
+	if err != nil {
+		return err
+	}
+
+	qctx := cp.NewQueryContext(ctx)
+	defer cp.UpdatePerQueryStatsMetrics()
+
+	timestamps, hits, ok, err := vlstorage.GetHitsPreaggregated(qctx, step, offset)
+	if err != nil {
+		return fmt.Errorf("cannot obtain pre-aggregated hits: %w", err)
+	}
+
+	var b []byte
+
+	// Marshal hits at first
+	if ok {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = encoding.MarshalUint64(b, uint64(len(timestamps)))
+	for i, ts := range timestamps {
+		b = encoding.MarshalInt64(b, ts)
+		b = encoding.MarshalUint64(b, hits[i])
+	}
+
+	if err := checkBytesReadLimit(qctx); err != nil {
+		return err
+	}
+
+	// Marshal query stats block after that
+	b = marshalQueryStatsBlock(b, qctx)
+
+	if !cp.DisableCompression {
+		b = zstd.CompressLevel(nil, b, cp.CompressionLevel)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("cannot send response to the client: %w", err)
+	}
+
+	return nil
+}
+
+func processApproxCountRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	cp, err := getCommonParams(r, netselect.ApproxCountProtocolVersion)
+	if err != nil {
+		return err
+	}
+
+	qctx := cp.NewQueryContext(ctx)
+	defer cp.UpdatePerQueryStatsMetrics()
+
+	ac, err := vlstorage.GetApproxCount(qctx)
+	if err != nil {
+		return fmt.Errorf("cannot obtain approximate count: %w", err)
+	}
+
+	// Marshal ac at first
+	b := ac.Marshal(nil)
+
+	if err := checkBytesReadLimit(qctx); err != nil {
+		return err
+	}
+
+	// Marshal query stats block after that
+	b = marshalQueryStatsBlock(b, qctx)
+
+	if !cp.DisableCompression {
+		b = zstd.CompressLevel(nil, b, cp.CompressionLevel)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("cannot send response to the client: %w", err)
+	}
+
+	return nil
+}
+
+func processPinViewRequest(ctx context.Context, _ http.ResponseWriter, r *http.Request) error {
+	if err := checkProtocolVersion(r, netselect.PinViewProtocolVersion); err != nil {
+		return err
+	}
+
+	viewID := r.FormValue("view_id")
+	if viewID == "" {
+		return fmt.Errorf("missing view_id arg")
+	}
+
+	ttlStr := r.FormValue("ttl")
+	ttl, err := time.ParseDuration(ttlStr)
+	if err != nil {
+		return fmt.Errorf("cannot parse ttl=%q: %w", ttlStr, err)
+	}
+
+	return vlstorage.PinView(ctx, viewID, ttl)
+}
+
+func processUnpinViewRequest(ctx context.Context, _ http.ResponseWriter, r *http.Request) error {
+	if err := checkProtocolVersion(r, netselect.UnpinViewProtocolVersion); err != nil {
+		return err
+	}
+
+	viewID := r.FormValue("view_id")
+	if viewID == "" {
+		return fmt.Errorf("missing view_id arg")
+	}
+
+	return vlstorage.UnpinView(ctx, viewID)
 }
 
 func processDeleteRunTask(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -403,6 +623,41 @@ func processTenantIDsRequest(ctx context.Context, w http.ResponseWriter, r *http
 	return nil
 }
 
+func processMaxIngestedTimestampRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := checkProtocolVersion(r, netselect.MaxIngestedTimestampProtocolVersion); err != nil {
+		return err
+	}
+
+	timestamp, err := vlstorage.GetMaxIngestedTimestamp(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot obtain max ingested timestamp: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	if _, err := fmt.Fprintf(w, "%d", timestamp); err != nil {
+		return fmt.Errorf("cannot send response to the client: %w", err)
+	}
+	return nil
+}
+
+func processNodeStatusRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := checkProtocolVersion(r, netselect.NodeStatusProtocolVersion); err != nil {
+		return err
+	}
+
+	ns := vlstorage.GetNodeStatus(ctx)
+	data, err := json.Marshal(ns)
+	if err != nil {
+		return fmt.Errorf("cannot marshal node status: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("cannot send response to the client: %w", err)
+	}
+	return nil
+}
+
 type commonParams struct {
 	TenantIDs []logstorage.TenantID
 	Query     *logstorage.Query
@@ -410,6 +665,9 @@ type commonParams struct {
 	// Whether to disable compression of the response sent to the vlselect.
 	DisableCompression bool
 
+	// zstd compression level for the response sent to the vlselect.
+	CompressionLevel int
+
 	// Whether to allow partial response when some of vlstorage nodes are unavailable.
 	AllowPartialResponse bool
 
@@ -421,6 +679,9 @@ type commonParams struct {
 }
 
 func (cp *commonParams) NewQueryContext(ctx context.Context) *logstorage.QueryContext {
+	if brl := getBytesReadLimiter(ctx); brl != nil {
+		brl.watch(ctx, &cp.qs)
+	}
 	return logstorage.NewQueryContext(ctx, &cp.qs, cp.TenantIDs, cp.Query, cp.AllowPartialResponse, cp.HiddenFieldsFilters)
 }
 
@@ -455,6 +716,11 @@ func getCommonParams(r *http.Request, expectedProtocolVersion string) (*commonPa
 		return nil, err
 	}
 
+	compressionLevel, err := getCompressionLevelFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
 	allowPartialResponse, err := getBoolFromRequest(r, "allow_partial_response")
 	if err != nil {
 		return nil, err
@@ -470,6 +736,7 @@ func getCommonParams(r *http.Request, expectedProtocolVersion string) (*commonPa
 		Query:     q,
 
 		DisableCompression: disableCompression,
+		CompressionLevel:   compressionLevel,
 
 		AllowPartialResponse: allowPartialResponse,
 		HiddenFieldsFilters:  hiddenFieldsFilters,
@@ -479,14 +746,14 @@ func getCommonParams(r *http.Request, expectedProtocolVersion string) (*commonPa
 
 func checkProtocolVersion(r *http.Request, expectedProtocolVersion string) error {
 	version := r.FormValue("version")
-	if version != expectedProtocolVersion {
-		return fmt.Errorf("unexpected protocol version=%q; want %q; the most likely cause of this error is different versions of VictoriaLogs cluster components; "+
-			"make sure VictoriaLogs compoments have the same release version", version, expectedProtocolVersion)
+	if version == expectedProtocolVersion || netselect.SupportedProtocolVersions.IsSupported(r.URL.Path, version) {
+		return nil
 	}
-	return nil
+	return fmt.Errorf("unsupported protocol version=%q; supported versions: %q; the most likely cause of this error is too big difference between release versions "+
+		"of VictoriaLogs cluster components; see https://docs.victoriametrics.com/victorialogs/cluster/#upgrading", version, netselect.SupportedProtocolVersions[r.URL.Path])
 }
 
-func writeValuesWithHits(w http.ResponseWriter, qctx *logstorage.QueryContext, vhs []logstorage.ValueWithHits, disableCompression bool) error {
+func writeValuesWithHits(w http.ResponseWriter, qctx *logstorage.QueryContext, vhs []logstorage.ValueWithHits, cp *commonParams) error {
 	var b []byte
 
 	// Marshal vhs at first
@@ -495,11 +762,15 @@ func writeValuesWithHits(w http.ResponseWriter, qctx *logstorage.QueryContext, v
 		b = vhs[i].Marshal(b)
 	}
 
+	if err := checkBytesReadLimit(qctx); err != nil {
+		return err
+	}
+
 	// Marshal query stats block after that
 	b = marshalQueryStatsBlock(b, qctx)
 
-	if !disableCompression {
-		b = zstd.CompressLevel(nil, b, 1)
+	if !cp.DisableCompression {
+		b = zstd.CompressLevel(nil, b, cp.CompressionLevel)
 	}
 
 	w.Header().Set("Content-Type", "application/octet-stream")
@@ -530,6 +801,42 @@ func getInt64FromRequest(r *http.Request, argName string) (int64, error) {
 	return n, nil
 }
 
+// getTimeoutFromRequest returns the optional timeout passed in milliseconds via timeout arg.
+//
+// Zero is returned if the timeout isn't set.
+func getTimeoutFromRequest(r *http.Request) (time.Duration, error) {
+	s := r.FormValue("timeout")
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse timeout=%q: %w", s, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("timeout=%q cannot be negative", s)
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
+
+// getCompressionLevelFromRequest returns the optional zstd compression level passed via compression_level arg.
+//
+// The default compression level is returned if the arg isn't set.
+func getCompressionLevelFromRequest(r *http.Request) (int, error) {
+	s := r.FormValue("compression_level")
+	if s == "" {
+		return netclient.DefaultCompressionLevel, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse compression_level=%q: %w", s, err)
+	}
+	if err := netclient.CheckCompressionLevel(n); err != nil {
+		return 0, fmt.Errorf("invalid compression_level: %w", err)
+	}
+	return n, nil
+}
+
 func getBoolFromRequest(r *http.Request, argName string) (bool, error) {
 	s := r.FormValue(argName)
 	if s == "" {
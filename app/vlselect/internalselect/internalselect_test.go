@@ -0,0 +1,40 @@
+package internalselect
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netselect"
+)
+
+func TestCheckProtocolVersion(t *testing.T) {
+	f := func(path, version, expectedProtocolVersion string, resultExpected bool) {
+		t.Helper()
+
+		args := url.Values{}
+		args.Set("version", version)
+		r := httptest.NewRequest("POST", path, strings.NewReader(args.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		err := checkProtocolVersion(r, expectedProtocolVersion)
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for version=%q at %s; got %v; want %v; error: %v", version, path, result, resultExpected, err)
+		}
+	}
+
+	// the current protocol version
+	f("/internal/select/query", netselect.QueryProtocolVersion, netselect.QueryProtocolVersion, true)
+	f("/internal/select/field_names", netselect.FieldNamesProtocolVersion, netselect.FieldNamesProtocolVersion, true)
+
+	// the protocol version of the previous release, which doesn't support protocol negotiation
+	f("/internal/select/query", "v4", netselect.QueryProtocolVersion, true)
+	f("/internal/select/field_values", "v4", netselect.FieldValuesProtocolVersion, true)
+	f("/internal/select/streams", "v4", netselect.StreamsProtocolVersion, true)
+
+	// unsupported protocol versions
+	f("/internal/select/query", "v3", netselect.QueryProtocolVersion, false)
+	f("/internal/select/query", "", netselect.QueryProtocolVersion, false)
+	f("/internal/select/pin_view", "v0", netselect.PinViewProtocolVersion, false)
+}
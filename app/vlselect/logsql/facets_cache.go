@@ -0,0 +1,533 @@
+package logsql
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	facetsCacheFields = flagutil.NewArrayString("search.facetsCacheFields", "Optional list of log fields to maintain incrementally updated facets for. "+
+		"Such facets are returned by /select/logsql/facets for queries without filters over the last -search.facetsCacheWindow without scanning the stored logs. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#facets-cache")
+	facetsCacheWindow = flag.Duration("search.facetsCacheWindow", time.Hour, "Sliding time window for facets maintained for -search.facetsCacheFields. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#facets-cache")
+	facetsCacheUpdateInterval = flag.Duration("search.facetsCacheUpdateInterval", time.Minute, "Interval for updating facets maintained for -search.facetsCacheFields. "+
+		"It also determines the precision of -search.facetsCacheWindow. See https://docs.victoriametrics.com/victorialogs/querying/#facets-cache")
+)
+
+const (
+	// facetsCacheMaxValuesPerField is the maximum number of unique values per field tracked by the facets cache.
+	//
+	// It matches the default max_values_per_field for /select/logsql/facets.
+	facetsCacheMaxValuesPerField = 1000
+
+	// facetsCacheMaxValueLen is the maximum length of field values tracked by the facets cache.
+	//
+	// It matches the default max_value_len for /select/logsql/facets.
+	facetsCacheMaxValueLen = 128
+
+	// facetsDefaultLimit is the default limit for /select/logsql/facets.
+	facetsDefaultLimit = 10
+
+	// facetsCacheIdleTimeout is the duration after the last request for the given tenant, when the facets cache entry is dropped.
+	facetsCacheIdleTimeout = 10 * time.Minute
+
+	// facetsCacheMaxEntries is the maximum number of tenants to maintain facets for.
+	facetsCacheMaxEntries = 1000
+)
+
+var (
+	facetsCacheRequests     = metrics.NewCounter(`vl_facets_cache_requests_total`)
+	facetsCacheMisses       = metrics.NewCounter(`vl_facets_cache_misses_total`)
+	facetsCacheUpdates      = metrics.NewCounter(`vl_facets_cache_updates_total`)
+	facetsCacheUpdateErrors = metrics.NewCounter(`vl_facets_cache_update_errors_total`)
+
+	_ = metrics.NewGauge(`vl_facets_cache_entries`, func() float64 {
+		fc := facetsCacheGlobal
+		if fc == nil {
+			return 0
+		}
+		fc.mu.Lock()
+		n := len(fc.m)
+		fc.mu.Unlock()
+		return float64(n)
+	})
+)
+
+var (
+	facetsCacheGlobal *facetsCache
+	facetsCacheStopCh chan struct{}
+	facetsCacheWG     sync.WaitGroup
+)
+
+func checkFacetsCacheConfig() error {
+	if len(*facetsCacheFields) == 0 {
+		return nil
+	}
+	return checkFacetsCacheFlags()
+}
+
+func checkFacetsCacheFlags() error {
+	if *facetsCacheUpdateInterval < time.Second {
+		return fmt.Errorf("-search.facetsCacheUpdateInterval must be at least 1s; got %s", *facetsCacheUpdateInterval)
+	}
+	if *facetsCacheWindow < *facetsCacheUpdateInterval {
+		return fmt.Errorf("-search.facetsCacheWindow=%s cannot be smaller than -search.facetsCacheUpdateInterval=%s", *facetsCacheWindow, *facetsCacheUpdateInterval)
+	}
+	return nil
+}
+
+func initFacetsCache() {
+	if len(*facetsCacheFields) == 0 {
+		return
+	}
+	if err := checkFacetsCacheFlags(); err != nil {
+		logger.Fatalf("%s", err)
+	}
+
+	fc := newFacetsCache(*facetsCacheFields, facetsCacheWindow.Nanoseconds(), facetsCacheUpdateInterval.Nanoseconds())
+	facetsCacheGlobal = fc
+	facetsCacheStopCh = make(chan struct{})
+	facetsCacheWG.Add(1)
+	go func() {
+		defer facetsCacheWG.Done()
+		fc.runUpdater(facetsCacheStopCh)
+	}()
+}
+
+func stopFacetsCache() {
+	if facetsCacheStopCh == nil {
+		return
+	}
+	close(facetsCacheStopCh)
+	facetsCacheWG.Wait()
+	facetsCacheStopCh = nil
+	facetsCacheGlobal = nil
+}
+
+// facetsCache maintains incrementally updated per-tenant facets for the configured fields over the sliding time window.
+//
+// The facets are stored in per-step buckets, so only the last buckets must be re-calculated on every update,
+// while the buckets outside the window are dropped.
+type facetsCache struct {
+	fields []string
+
+	// window is the sliding time window in nanoseconds.
+	window int64
+
+	// step is the update interval and the bucket duration in nanoseconds.
+	step int64
+
+	mu sync.Mutex
+	m  map[logstorage.TenantID]*facetsCacheEntry
+}
+
+func newFacetsCache(fields []string, window, step int64) *facetsCache {
+	return &facetsCache{
+		fields: fields,
+		window: window,
+		step:   step,
+		m:      make(map[logstorage.TenantID]*facetsCacheEntry),
+	}
+}
+
+// facetsCacheEntry contains facets for a single tenant.
+type facetsCacheEntry struct {
+	// lastAccess is the unix timestamp in nanoseconds for the last request to the entry.
+	lastAccess atomic.Int64
+
+	mu sync.Mutex
+
+	// lastUpdate is the timestamp in nanoseconds for the last successful update of the entry.
+	//
+	// Zero lastUpdate means the entry isn't filled yet.
+	lastUpdate int64
+
+	// buckets contains facets per each bucket start.
+	buckets map[int64]*facetsCacheBucket
+}
+
+// facetsCacheBucket contains facets for logs on the [start ... start+step) time range.
+type facetsCacheBucket struct {
+	// rows is the number of logs in the bucket.
+	rows uint64
+
+	fields map[string]*facetsCacheFieldHits
+}
+
+// facetsCacheFieldHits contains per-value hits for a single field in the bucket.
+type facetsCacheFieldHits struct {
+	hits map[string]uint64
+
+	// ignored is set if the field has too many unique values or too long values in the bucket.
+	ignored bool
+}
+
+func (fc *facetsCache) alignBucket(timestamp int64) int64 {
+	n := timestamp % fc.step
+	if n < 0 {
+		n += fc.step
+	}
+	return timestamp - n
+}
+
+// canServeTimeRange returns true if the [start ... end] time range matches the cache window at the given timestamp.
+func (fc *facetsCache) canServeTimeRange(start, end, timestamp int64) bool {
+	if end < timestamp-fc.step || end > timestamp+fc.step {
+		return false
+	}
+	d := end - start - fc.window
+	return d >= -fc.step && d <= fc.step
+}
+
+// tryWriteResponse writes facets response for ca from the cache.
+//
+// It returns false if the response cannot be obtained from the cache.
+func (fc *facetsCache) tryWriteResponse(w http.ResponseWriter, ca *commonArgs, limit, maxValuesPerField, maxValueLen int, keepConstFields bool) bool {
+	if len(ca.tenantIDs) != 1 || len(ca.hiddenFieldsFilters) > 0 || ca.ensureFresh || !ca.q.HasOnlyTimeFilters() {
+		return false
+	}
+
+	if limit <= 0 {
+		limit = facetsDefaultLimit
+	}
+	if maxValuesPerField <= 0 {
+		maxValuesPerField = facetsCacheMaxValuesPerField
+	}
+	if maxValueLen <= 0 {
+		maxValueLen = facetsCacheMaxValueLen
+	}
+	if maxValuesPerField > facetsCacheMaxValuesPerField || maxValueLen > facetsCacheMaxValueLen {
+		return false
+	}
+
+	startTime := time.Now()
+	timestamp := startTime.UnixNano()
+	start, end := ca.q.GetFilterTimeRange()
+	if !fc.canServeTimeRange(start, end, timestamp) {
+		return false
+	}
+
+	facetsCacheRequests.Inc()
+	e := fc.getEntry(ca.tenantIDs[0], timestamp)
+	if e == nil {
+		facetsCacheMisses.Inc()
+		return false
+	}
+	m, ok := e.getFacets(fc.alignBucket(timestamp-fc.window), timestamp-2*fc.step, limit, maxValuesPerField, maxValueLen, keepConstFields)
+	if !ok {
+		facetsCacheMisses.Inc()
+		return false
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	ca.writeResponseHeaders(h, startTime)
+	WriteFacetsResponse(w, m)
+	return true
+}
+
+// getEntry returns the entry for the given tenantID and marks it as accessed at the given timestamp.
+//
+// The entry is registered for filling on the next update if it is missing.
+// nil is returned if the entry cannot be registered because of too many entries.
+func (fc *facetsCache) getEntry(tenantID logstorage.TenantID, timestamp int64) *facetsCacheEntry {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	e := fc.m[tenantID]
+	if e == nil {
+		if len(fc.m) >= facetsCacheMaxEntries {
+			return nil
+		}
+		e = &facetsCacheEntry{}
+		fc.m[tenantID] = e
+	}
+	e.lastAccess.Store(timestamp)
+	return e
+}
+
+// getFacets returns facets from e for buckets starting from minBucketStart.
+//
+// false is returned if e wasn't updated since minLastUpdate.
+func (e *facetsCacheEntry) getFacets(minBucketStart, minLastUpdate int64, limit, maxValuesPerField, maxValueLen int, keepConstFields bool) (map[string][]facetEntry, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lastUpdate == 0 || e.lastUpdate < minLastUpdate {
+		return nil, false
+	}
+
+	rowsTotal := uint64(0)
+	ignoreFields := make(map[string]bool)
+	hitsByField := make(map[string]map[string]uint64)
+	for bucketStart, b := range e.buckets {
+		if bucketStart < minBucketStart {
+			continue
+		}
+		rowsTotal += b.rows
+		for fieldName, fh := range b.fields {
+			if ignoreFields[fieldName] {
+				continue
+			}
+			if fh.ignored {
+				ignoreFields[fieldName] = true
+				delete(hitsByField, fieldName)
+				continue
+			}
+			hits := hitsByField[fieldName]
+			if hits == nil {
+				hits = make(map[string]uint64)
+				hitsByField[fieldName] = hits
+			}
+			for v, n := range fh.hits {
+				hits[v] += n
+			}
+		}
+	}
+
+	m := make(map[string][]facetEntry)
+	for fieldName, hits := range hitsByField {
+		if len(hits) > maxValuesPerField {
+			continue
+		}
+
+		vs := make([]facetEntry, 0, len(hits))
+		hasLongValues := false
+		for v, n := range hits {
+			if len(v) > maxValueLen {
+				hasLongValues = true
+				break
+			}
+			vs = append(vs, facetEntry{
+				value: v,
+				hits:  strconv.FormatUint(n, 10),
+			})
+		}
+		if hasLongValues {
+			continue
+		}
+		if len(vs) == 1 && hits[vs[0].value] == rowsTotal && !keepConstFields {
+			// Skip field with constant value.
+			continue
+		}
+
+		sort.Slice(vs, func(i, j int) bool {
+			a, b := hits[vs[i].value], hits[vs[j].value]
+			if a != b {
+				return a > b
+			}
+			return vs[i].value < vs[j].value
+		})
+		if len(vs) > limit {
+			vs = vs[:limit]
+		}
+		m[fieldName] = vs
+	}
+	return m, true
+}
+
+func (fc *facetsCache) runUpdater(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(fc.step))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		fc.updateEntries(stopCh)
+	}
+}
+
+func (fc *facetsCache) updateEntries(stopCh <-chan struct{}) {
+	timestamp := time.Now().UnixNano()
+
+	fc.mu.Lock()
+	tenantIDs := make([]logstorage.TenantID, 0, len(fc.m))
+	entries := make([]*facetsCacheEntry, 0, len(fc.m))
+	for tenantID, e := range fc.m {
+		if timestamp-e.lastAccess.Load() > facetsCacheIdleTimeout.Nanoseconds() {
+			delete(fc.m, tenantID)
+			continue
+		}
+		tenantIDs = append(tenantIDs, tenantID)
+		entries = append(entries, e)
+	}
+	fc.mu.Unlock()
+
+	for i, e := range entries {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		facetsCacheUpdates.Inc()
+		tenantID := tenantIDs[i]
+		if err := fc.updateEntry(tenantID, e, timestamp); err != nil {
+			facetsCacheUpdateErrors.Inc()
+			logger.Errorf("cannot update facets cache for tenant %d:%d: %s", tenantID.AccountID, tenantID.ProjectID, err)
+
+			// Reset the entry, so it is filled from scratch on the next update.
+			e.mu.Lock()
+			e.lastUpdate = 0
+			e.buckets = nil
+			e.mu.Unlock()
+		}
+	}
+}
+
+// updateEntry re-calculates facets in e for the buckets since the last update of e till the given timestamp.
+func (fc *facetsCache) updateEntry(tenantID logstorage.TenantID, e *facetsCacheEntry, timestamp int64) error {
+	e.mu.Lock()
+	lastUpdate := e.lastUpdate
+	e.mu.Unlock()
+
+	minBucketStart := fc.alignBucket(timestamp - fc.window)
+	start := minBucketStart
+	if lastUpdate > 0 {
+		// Re-calculate the bucket with the last update, since it may contain logs ingested after the last update.
+		start = max(start, fc.alignBucket(lastUpdate))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(fc.step))
+	defer cancel()
+
+	buckets := make(map[int64]*facetsCacheBucket)
+	for _, fieldName := range fc.fields {
+		if err := fc.fetchFieldHits(ctx, tenantID, fieldName, start, timestamp, buckets); err != nil {
+			return fmt.Errorf("cannot obtain facets for the field %q: %w", fieldName, err)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.buckets == nil {
+		e.buckets = make(map[int64]*facetsCacheBucket)
+	}
+	for bucketStart := range e.buckets {
+		if bucketStart < minBucketStart || bucketStart >= start {
+			delete(e.buckets, bucketStart)
+		}
+	}
+	for bucketStart, b := range buckets {
+		e.buckets[bucketStart] = b
+	}
+	e.lastUpdate = timestamp
+	return nil
+}
+
+// fetchFieldHits fetches per-bucket hits for the given fieldName on the [start ... end] time range and stores them to buckets.
+func (fc *facetsCache) fetchFieldHits(ctx context.Context, tenantID logstorage.TenantID, fieldName string, start, end int64, buckets map[int64]*facetsCacheBucket) error {
+	qStr := fmt.Sprintf("* | stats by (_time:%dms, %s) count() facets_cache_hits "+
+		"| total_stats by (_time) count() facets_cache_values, sum(facets_cache_hits) facets_cache_rows "+
+		"| sort by (facets_cache_hits desc) limit %d partition by (_time)",
+		fc.step/1e6, strconv.Quote(fieldName), facetsCacheMaxValuesPerField+1)
+	q, err := logstorage.ParseQueryAtTimestamp(qStr, end)
+	if err != nil {
+		return fmt.Errorf("cannot parse query [%s]: %w", qStr, err)
+	}
+	q.AddTimeFilter(start, end)
+
+	var qs logstorage.QueryStats
+	qctx := logstorage.NewQueryContext(ctx, &qs, []logstorage.TenantID{tenantID}, q, false, nil)
+
+	var bucketsLock sync.Mutex
+	var parseErr error
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		if db.RowsCount() == 0 {
+			return
+		}
+
+		cTime := db.GetColumnByName("_time")
+		cValue := db.GetColumnByName(fieldName)
+		cHits := db.GetColumnByName("facets_cache_hits")
+		cValues := db.GetColumnByName("facets_cache_values")
+		cRows := db.GetColumnByName("facets_cache_rows")
+		if cTime == nil || cValue == nil || cHits == nil || cValues == nil || cRows == nil {
+			return
+		}
+
+		bucketsLock.Lock()
+		defer bucketsLock.Unlock()
+
+		for i, timeStr := range cTime.Values {
+			bucketStart, ok := logstorage.TryParseTimestampRFC3339Nano(timeStr)
+			if !ok {
+				parseErr = fmt.Errorf("cannot parse _time=%q", timeStr)
+				return
+			}
+			hits, err := strconv.ParseUint(cHits.Values[i], 10, 64)
+			if err != nil {
+				parseErr = fmt.Errorf("cannot parse hits=%q: %w", cHits.Values[i], err)
+				return
+			}
+			valuesCount, err := strconv.ParseUint(cValues.Values[i], 10, 64)
+			if err != nil {
+				parseErr = fmt.Errorf("cannot parse values count=%q: %w", cValues.Values[i], err)
+				return
+			}
+			rows, err := strconv.ParseUint(cRows.Values[i], 10, 64)
+			if err != nil {
+				parseErr = fmt.Errorf("cannot parse rows=%q: %w", cRows.Values[i], err)
+				return
+			}
+
+			b := buckets[bucketStart]
+			if b == nil {
+				b = &facetsCacheBucket{
+					fields: make(map[string]*facetsCacheFieldHits),
+				}
+				buckets[bucketStart] = b
+			}
+			b.rows = rows
+
+			fh := b.fields[fieldName]
+			if fh == nil {
+				fh = &facetsCacheFieldHits{
+					hits: make(map[string]uint64),
+				}
+				b.fields[fieldName] = fh
+			}
+			if fh.ignored {
+				continue
+			}
+
+			v := cValue.Values[i]
+			if v == "" {
+				// Empty values are ignored in the same way as the facets pipe does.
+				continue
+			}
+			if valuesCount > facetsCacheMaxValuesPerField+1 || len(v) > facetsCacheMaxValueLen {
+				fh.ignored = true
+				fh.hits = nil
+				continue
+			}
+			fh.hits[strings.Clone(v)] = hits
+		}
+	}
+
+	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+		return err
+	}
+	return parseErr
+}
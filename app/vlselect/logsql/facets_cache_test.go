@@ -0,0 +1,116 @@
+package logsql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFacetsCacheCanServeTimeRange(t *testing.T) {
+	fc := newFacetsCache([]string{"level"}, time.Hour.Nanoseconds(), time.Minute.Nanoseconds())
+
+	f := func(start, end time.Duration, resultExpected bool) {
+		t.Helper()
+
+		timestamp := int64(1e18)
+		result := fc.canServeTimeRange(timestamp+start.Nanoseconds(), timestamp+end.Nanoseconds(), timestamp)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for [%s, %s]; got %v; want %v", start, end, result, resultExpected)
+		}
+	}
+
+	f(-time.Hour, 0, true)
+	f(-time.Hour-30*time.Second, -30*time.Second, true)
+	f(-time.Hour+30*time.Second, 0, true)
+	f(-time.Hour, -2*time.Minute, false)
+	f(-2*time.Hour, 0, false)
+	f(-5*time.Minute, 0, false)
+}
+
+func TestFacetsCacheEntryGetFacets(t *testing.T) {
+	newBucket := func(rows uint64, fields map[string]map[string]uint64) *facetsCacheBucket {
+		b := &facetsCacheBucket{
+			rows:   rows,
+			fields: make(map[string]*facetsCacheFieldHits),
+		}
+		for fieldName, hits := range fields {
+			fh := &facetsCacheFieldHits{
+				hits:    hits,
+				ignored: hits == nil,
+			}
+			b.fields[fieldName] = fh
+		}
+		return b
+	}
+
+	e := &facetsCacheEntry{
+		lastUpdate: 300,
+		buckets: map[int64]*facetsCacheBucket{
+			// This bucket is outside the window.
+			0: newBucket(100, map[string]map[string]uint64{
+				"level": {"fatal": 100},
+				"host":  nil,
+			}),
+			100: newBucket(10, map[string]map[string]uint64{
+				"level": {"info": 7, "error": 3},
+				"app":   {"foo": 10},
+				"host":  {"h1": 10},
+			}),
+			200: newBucket(5, map[string]map[string]uint64{
+				"level":    {"info": 1, "warn": 2, "error": 2},
+				"app":      {"foo": 5},
+				"host":     nil,
+				"trace_id": {"abcdef": 5},
+			}),
+		},
+	}
+
+	f := func(minLastUpdate int64, limit, maxValuesPerField, maxValueLen int, keepConstFields bool, resultExpected map[string][]facetEntry) {
+		t.Helper()
+
+		result, ok := e.getFacets(100, minLastUpdate, limit, maxValuesPerField, maxValueLen, keepConstFields)
+		if resultExpected == nil {
+			if ok {
+				t.Fatalf("expecting cache miss; got %v", result)
+			}
+			return
+		}
+		if !ok {
+			t.Fatalf("unexpected cache miss")
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	// stale entry
+	f(400, 10, 1000, 128, false, nil)
+
+	// const fields are skipped by default
+	f(0, 10, 1000, 128, false, map[string][]facetEntry{
+		"level": {
+			{value: "info", hits: "8"},
+			{value: "error", hits: "5"},
+			{value: "warn", hits: "2"},
+		},
+		"trace_id": {
+			{value: "abcdef", hits: "5"},
+		},
+	})
+
+	// keep const fields and apply limit
+	f(0, 1, 1000, 128, true, map[string][]facetEntry{
+		"app": {
+			{value: "foo", hits: "15"},
+		},
+		"level": {
+			{value: "info", hits: "8"},
+		},
+		"trace_id": {
+			{value: "abcdef", hits: "5"},
+		},
+	})
+
+	// skip fields with too many unique values and too long values
+	f(0, 10, 2, 5, false, map[string][]facetEntry{})
+}
@@ -0,0 +1,407 @@
+package logsql
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	hiddenStreamsPath = flag.String("search.hiddenStreamsPath", "", "Path to a file for storing streams hidden via /select/logsql/hide_stream API. "+
+		"Hidden streams are excluded from query results, facets and stream listings without deleting the stored logs. "+
+		"The API is disabled if this flag is empty. The file isn't replicated, so the identical file must be put to every vlselect node in VictoriaLogs cluster, "+
+		"where updates via API are rejected; see https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams")
+	maxHiddenStreamsPerTenant = flag.Int("search.maxHiddenStreamsPerTenant", 1000, "The maximum number of hidden streams per tenant, "+
+		"which can be registered via /select/logsql/hide_stream API")
+	hiddenStreamsAuthKey = flagutil.NewPassword("hiddenStreamsAuthKey", "authKey, which must be passed in query string to /select/logsql/hide_stream "+
+		"and /select/logsql/unhide_stream . It overrides -httpAuth.* . See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams")
+)
+
+var hss *hiddenStreamsStorage
+
+// IsHiddenStreamsEnabled returns true if hidden streams API is enabled via -search.hiddenStreamsPath command-line flag.
+func IsHiddenStreamsEnabled() bool {
+	return *hiddenStreamsPath != ""
+}
+
+// IsHiddenStreamsUpdateEnabled returns true if hidden streams can be updated via /select/logsql/hide_stream and /select/logsql/unhide_stream.
+//
+// Updates are disabled in VictoriaLogs cluster, since they cannot reach other vlselect nodes.
+func IsHiddenStreamsUpdateEnabled() bool {
+	return IsHiddenStreamsEnabled() && vlstorage.IsLocalStorage()
+}
+
+func checkHiddenStreamsConfig() error {
+	if *hiddenStreamsPath == "" {
+		return nil
+	}
+	if _, err := loadHiddenStreamsStorage(*hiddenStreamsPath); err != nil {
+		return fmt.Errorf("cannot load hidden streams from -search.hiddenStreamsPath=%q: %w", *hiddenStreamsPath, err)
+	}
+	return nil
+}
+
+func initHiddenStreams() {
+	if *hiddenStreamsPath == "" {
+		return
+	}
+	s, err := loadHiddenStreamsStorage(*hiddenStreamsPath)
+	if err != nil {
+		logger.Fatalf("cannot load hidden streams from -search.hiddenStreamsPath=%q: %s", *hiddenStreamsPath, err)
+	}
+	hss = s
+}
+
+func stopHiddenStreams() {
+	hss = nil
+}
+
+// ProcessHideStreamRequest processes /select/logsql/hide_stream request.
+//
+// It hides logs streams matching the `stream` query arg from query results until they are unhidden via /select/logsql/unhide_stream.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+func ProcessHideStreamRequest(w http.ResponseWriter, r *http.Request) {
+	s, tenantID, stream, ok := getHiddenStreamsArgs(w, r, true)
+	if !ok {
+		return
+	}
+	hs, err := s.hide(tenantID, stream, r.FormValue("reason"))
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot hide stream %s: %s", stream, err)
+		return
+	}
+
+	remoteAddr := httpserver.GetQuotedRemoteAddr(r)
+	logger.Infof("hid the stream %s for tenant %s by the request from remoteAddr=%s", stream, tenantID, remoteAddr)
+
+	writeHiddenStreamsJSON(w, hs)
+}
+
+// ProcessUnhideStreamRequest processes /select/logsql/unhide_stream request.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+func ProcessUnhideStreamRequest(w http.ResponseWriter, r *http.Request) {
+	s, tenantID, stream, ok := getHiddenStreamsArgs(w, r, true)
+	if !ok {
+		return
+	}
+	if err := s.unhide(tenantID, stream); err != nil {
+		httpserver.Errorf(w, r, "cannot unhide stream %s: %s", stream, err)
+		return
+	}
+
+	remoteAddr := httpserver.GetQuotedRemoteAddr(r)
+	logger.Infof("unhid the stream %s for tenant %s by the request from remoteAddr=%s", stream, tenantID, remoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
+
+// ProcessHiddenStreamsRequest processes /select/logsql/hidden_streams request.
+//
+// It returns the list of hidden streams for the given tenant.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+func ProcessHiddenStreamsRequest(w http.ResponseWriter, r *http.Request) {
+	s, tenantID, _, ok := getHiddenStreamsArgs(w, r, false)
+	if !ok {
+		return
+	}
+	writeHiddenStreamsJSON(w, map[string]any{
+		"hidden_streams": s.list(tenantID),
+	})
+}
+
+func getHiddenStreamsArgs(w http.ResponseWriter, r *http.Request, needStream bool) (*hiddenStreamsStorage, logstorage.TenantID, string, bool) {
+	var zeroTenantID logstorage.TenantID
+
+	s := hss
+	if s == nil {
+		httpserver.Errorf(w, r, "hidden streams API is disabled; pass -search.hiddenStreamsPath command-line flag for enabling it; "+
+			"see https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams")
+		return nil, zeroTenantID, "", false
+	}
+	if needStream && !httpserver.CheckAuthFlag(w, r, hiddenStreamsAuthKey) {
+		return nil, zeroTenantID, "", false
+	}
+	if needStream && !IsHiddenStreamsUpdateEnabled() {
+		// Every vlselect node in VictoriaLogs cluster has its own -search.hiddenStreamsPath file,
+		// so the update cannot be propagated to the remaining vlselect nodes.
+		httpserver.Errorf(w, r, "hidden streams cannot be updated via API in VictoriaLogs cluster, since the update cannot reach other vlselect nodes; "+
+			"put identical -search.hiddenStreamsPath file to every vlselect node and restart them instead; "+
+			"see https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams")
+		return nil, zeroTenantID, "", false
+	}
+
+	tenantID, err := logstorage.GetTenantIDFromRequest(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain tenantID: %s", err)
+		return nil, zeroTenantID, "", false
+	}
+	if !needStream {
+		return s, tenantID, "", true
+	}
+
+	streamStr := r.FormValue("stream")
+	if streamStr == "" {
+		httpserver.Errorf(w, r, "missing 'stream' arg; it must contain stream filter such as {app=\"foo\"}")
+		return nil, zeroTenantID, "", false
+	}
+	sf, err := logstorage.ParseStreamFilter(streamStr)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse 'stream' arg [%s]: %s", streamStr, err)
+		return nil, zeroTenantID, "", false
+	}
+	return s, tenantID, sf.String(), true
+}
+
+func writeHiddenStreamsJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal %T to JSON: %s", v, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// getHiddenStreamsFilter returns the filter, which excludes hidden streams for the given tenantID.
+//
+// nil is returned if there are no hidden streams for the given tenantID.
+func getHiddenStreamsFilter(tenantID logstorage.TenantID) (*logstorage.Filter, error) {
+	s := hss
+	if s == nil {
+		return nil, nil
+	}
+	filterStr := s.getFilterString(tenantID)
+	if filterStr == "" {
+		return nil, nil
+	}
+
+	// The filter is parsed on every call, since the parsed filter holds query-specific state and cannot be shared among concurrently executed queries.
+	f, err := logstorage.ParseFilter(filterStr)
+	if err != nil {
+		return nil, fmt.Errorf("BUG: cannot parse hidden streams filter [%s]: %w", filterStr, err)
+	}
+	return f, nil
+}
+
+// HiddenStream is a log stream hidden from query results via /select/logsql/hide_stream.
+type HiddenStream struct {
+	// Stream is the stream filter, which matches hidden streams.
+	Stream string `json:"stream"`
+
+	// Reason is an optional reason for hiding the stream.
+	Reason string `json:"reason,omitempty"`
+
+	// HiddenAt is the time when the stream has been hidden.
+	HiddenAt time.Time `json:"hidden_at"`
+}
+
+// hiddenStreamsStorage holds hidden streams in memory and persists them to the file at path on every change.
+type hiddenStreamsStorage struct {
+	path string
+
+	mu sync.Mutex
+	m  map[logstorage.TenantID][]*HiddenStream
+
+	// filters contains the cached filters excluding hidden streams per each tenant.
+	filters map[logstorage.TenantID]string
+}
+
+// tenantHiddenStreams is used for persisting hidden streams for a single tenant.
+type tenantHiddenStreams struct {
+	AccountID uint32          `json:"account_id"`
+	ProjectID uint32          `json:"project_id"`
+	Streams   []*HiddenStream `json:"streams"`
+}
+
+func loadHiddenStreamsStorage(path string) (*hiddenStreamsStorage, error) {
+	s := &hiddenStreamsStorage{
+		path:    path,
+		m:       make(map[logstorage.TenantID][]*HiddenStream),
+		filters: make(map[logstorage.TenantID]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var ths []tenantHiddenStreams
+	if err := json.Unmarshal(data, &ths); err != nil {
+		return nil, fmt.Errorf("cannot parse hidden streams: %w", err)
+	}
+	for _, th := range ths {
+		tenantID := logstorage.TenantID{
+			AccountID: th.AccountID,
+			ProjectID: th.ProjectID,
+		}
+		for _, hs := range th.Streams {
+			if _, err := logstorage.ParseStreamFilter(hs.Stream); err != nil {
+				return nil, fmt.Errorf("cannot parse hidden stream filter %q for tenant %s: %w", hs.Stream, tenantID, err)
+			}
+		}
+		s.m[tenantID] = append(s.m[tenantID], th.Streams...)
+		s.updateFilterLocked(tenantID)
+	}
+	return s, nil
+}
+
+// mustSaveLocked persists s to s.path.
+//
+// s.mu must be locked by the caller.
+func (s *hiddenStreamsStorage) mustSaveLocked() {
+	ths := make([]tenantHiddenStreams, 0, len(s.m))
+	for tenantID, streams := range s.m {
+		ths = append(ths, tenantHiddenStreams{
+			AccountID: tenantID.AccountID,
+			ProjectID: tenantID.ProjectID,
+			Streams:   streams,
+		})
+	}
+	slices.SortFunc(ths, func(a, b tenantHiddenStreams) int {
+		if a.AccountID != b.AccountID {
+			return cmp.Compare(a.AccountID, b.AccountID)
+		}
+		return cmp.Compare(a.ProjectID, b.ProjectID)
+	})
+
+	data, err := json.MarshalIndent(ths, "", "  ")
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal hidden streams: %s", err)
+	}
+	fs.MustMkdirIfNotExist(filepath.Dir(s.path))
+	fs.MustWriteAtomic(s.path, data, true)
+}
+
+// updateFilterLocked updates the cached filter for the given tenantID.
+//
+// s.mu must be locked by the caller.
+func (s *hiddenStreamsStorage) updateFilterLocked(tenantID logstorage.TenantID) {
+	streams := s.m[tenantID]
+	if len(streams) == 0 {
+		delete(s.filters, tenantID)
+		return
+	}
+	a := make([]string, len(streams))
+	for i, hs := range streams {
+		a[i] = "!_stream:" + hs.Stream
+	}
+	s.filters[tenantID] = strings.Join(a, " ")
+}
+
+func (s *hiddenStreamsStorage) getFilterString(tenantID logstorage.TenantID) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.filters[tenantID]
+}
+
+func (s *hiddenStreamsStorage) list(tenantID logstorage.TenantID) []*HiddenStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streams := slices.Clone(s.m[tenantID])
+	slices.SortFunc(streams, func(a, b *HiddenStream) int {
+		return strings.Compare(a.Stream, b.Stream)
+	})
+	if streams == nil {
+		streams = []*HiddenStream{}
+	}
+	return streams
+}
+
+// hide hides the given stream for the given tenantID.
+//
+// The existing hidden stream is returned if the stream is already hidden.
+func (s *hiddenStreamsStorage) hide(tenantID logstorage.TenantID, stream, reason string) (*HiddenStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	streams := s.m[tenantID]
+	if idx := indexHiddenStream(streams, stream); idx >= 0 {
+		return streams[idx], nil
+	}
+	if len(streams) >= *maxHiddenStreamsPerTenant {
+		return nil, fmt.Errorf("cannot hide more than -search.maxHiddenStreamsPerTenant=%d streams per tenant", *maxHiddenStreamsPerTenant)
+	}
+
+	hs := &HiddenStream{
+		Stream:   stream,
+		Reason:   reason,
+		HiddenAt: time.Now().UTC(),
+	}
+	s.m[tenantID] = append(streams, hs)
+	s.updateFilterLocked(tenantID)
+	s.mustSaveLocked()
+
+	return hs, nil
+}
+
+func (s *hiddenStreamsStorage) unhide(tenantID logstorage.TenantID, stream string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := indexHiddenStream(s.m[tenantID], stream)
+	if idx < 0 {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("the stream isn't hidden"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	// Hidden streams are updated in copy-on-write manner, since the returned hidden streams can be accessed concurrently.
+	streams := slices.Delete(slices.Clone(s.m[tenantID]), idx, idx+1)
+	if len(streams) == 0 {
+		delete(s.m, tenantID)
+	} else {
+		s.m[tenantID] = streams
+	}
+	s.updateFilterLocked(tenantID)
+	s.mustSaveLocked()
+
+	return nil
+}
+
+func indexHiddenStream(streams []*HiddenStream, stream string) int {
+	return slices.IndexFunc(streams, func(hs *HiddenStream) bool {
+		return hs.Stream == stream
+	})
+}
+
+var _ = metrics.NewGauge(`vl_hidden_streams`, func() float64 {
+	s := hss
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, streams := range s.m {
+		n += len(streams)
+	}
+	return float64(n)
+})
@@ -0,0 +1,121 @@
+package logsql
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestHiddenStreamsStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hidden", "hidden-streams.json")
+
+	s, err := loadHiddenStreamsStorage(path)
+	if err != nil {
+		t.Fatalf("cannot load empty hidden streams storage: %s", err)
+	}
+
+	tenant1 := logstorage.TenantID{AccountID: 1}
+	tenant2 := logstorage.TenantID{AccountID: 2, ProjectID: 3}
+
+	if filterStr := s.getFilterString(tenant1); filterStr != "" {
+		t.Fatalf("unexpected filter for empty storage: %q", filterStr)
+	}
+
+	hs1, err := s.hide(tenant1, `{app="foo"}`, "decommissioned")
+	if err != nil {
+		t.Fatalf("cannot hide stream: %s", err)
+	}
+	if _, err := s.hide(tenant1, `{app="bar",env="dev"}`, ""); err != nil {
+		t.Fatalf("cannot hide stream: %s", err)
+	}
+	if _, err := s.hide(tenant2, `{app="baz"}`, ""); err != nil {
+		t.Fatalf("cannot hide stream: %s", err)
+	}
+
+	// Hiding already hidden stream must return the existing entry
+	hs, err := s.hide(tenant1, `{app="foo"}`, "another reason")
+	if err != nil {
+		t.Fatalf("cannot hide stream: %s", err)
+	}
+	if hs != hs1 {
+		t.Fatalf("unexpected hidden stream for already hidden stream; got %+v; want %+v", hs, hs1)
+	}
+
+	// Hidden streams must be sorted by stream filter
+	streams := s.list(tenant1)
+	if len(streams) != 2 || streams[0].Stream != `{app="bar",env="dev"}` || streams[1].Stream != `{app="foo"}` || streams[1].Reason != "decommissioned" {
+		t.Fatalf("unexpected hidden streams: %+v", streams)
+	}
+
+	filterStr := s.getFilterString(tenant1)
+	filterStrExpected := `!_stream:{app="foo"} !_stream:{app="bar",env="dev"}`
+	if filterStr != filterStrExpected {
+		t.Fatalf("unexpected filter; got %q; want %q", filterStr, filterStrExpected)
+	}
+	if _, err := logstorage.ParseFilter(filterStr); err != nil {
+		t.Fatalf("cannot parse filter %q: %s", filterStr, err)
+	}
+
+	// Hidden streams must be isolated per tenant
+	if err := s.unhide(tenant2, `{app="foo"}`); err == nil {
+		t.Fatalf("expecting non-nil error when unhiding stream from another tenant")
+	}
+
+	if err := s.unhide(tenant1, `{app="bar",env="dev"}`); err != nil {
+		t.Fatalf("cannot unhide stream: %s", err)
+	}
+	if err := s.unhide(tenant1, `{app="bar",env="dev"}`); err == nil {
+		t.Fatalf("expecting non-nil error when unhiding missing stream")
+	}
+
+	// Re-open the storage and verify hidden streams are persisted
+	s, err = loadHiddenStreamsStorage(path)
+	if err != nil {
+		t.Fatalf("cannot load hidden streams storage: %s", err)
+	}
+	streams = s.list(tenant1)
+	if len(streams) != 1 || streams[0].Stream != `{app="foo"}` || streams[0].Reason != "decommissioned" {
+		t.Fatalf("unexpected hidden streams for tenant1: %+v", streams)
+	}
+	if filterStr := s.getFilterString(tenant1); filterStr != `!_stream:{app="foo"}` {
+		t.Fatalf("unexpected filter for tenant1: %q", filterStr)
+	}
+	streams = s.list(tenant2)
+	if len(streams) != 1 || streams[0].Stream != `{app="baz"}` {
+		t.Fatalf("unexpected hidden streams for tenant2: %+v", streams)
+	}
+	streams = s.list(logstorage.TenantID{})
+	if len(streams) != 0 {
+		t.Fatalf("unexpected hidden streams for the default tenant: %+v", streams)
+	}
+
+	// Unhide the last stream for tenant2
+	if err := s.unhide(tenant2, `{app="baz"}`); err != nil {
+		t.Fatalf("cannot unhide stream: %s", err)
+	}
+	if filterStr := s.getFilterString(tenant2); filterStr != "" {
+		t.Fatalf("unexpected filter for tenant2 without hidden streams: %q", filterStr)
+	}
+}
+
+func TestLoadHiddenStreamsStorage_Failure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		path := filepath.Join(t.TempDir(), "hidden-streams.json")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("cannot write %q: %s", path, err)
+		}
+		if _, err := loadHiddenStreamsStorage(path); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid JSON
+	f(`{`)
+
+	// invalid stream filter
+	f(`[{"account_id":0,"project_id":0,"streams":[{"stream":"app=foo"}]}]`)
+}
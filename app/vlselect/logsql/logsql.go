@@ -3,6 +3,7 @@ package logsql
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
@@ -37,8 +39,41 @@ var (
 	allowPartialResponseFlag = flag.Bool("search.allowPartialResponse", false, "Whether to allow returning partial responses when some of vlstorage nodes "+
 		"from the -storageNode list are unavailable for querying. This flag works only for cluster setup of VictoriaLogs. "+
 		"See https://docs.victoriametrics.com/victorialogs/querying/#partial-responses")
+
+	disableHitsPreaggregation = flag.Bool("search.disableHitsPreaggregation", false, "Whether to disable answering /select/logsql/hits queries from per-stream per-minute hits "+
+		"maintained during data ingestion. See https://docs.victoriametrics.com/victorialogs/querying/#pre-aggregated-hits")
+
+	maxPinnedViewTTL = flag.Duration("search.maxPinnedViewTTL", time.Hour, "The maximum ttl, which can be passed to /select/logsql/pin_view. "+
+		"Pinned views prevent from deleting the pinned logs from disk, so big ttl values may increase disk space usage. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#consistent-exports")
 )
 
+// CheckConfig verifies command-line flags for the logsql package.
+func CheckConfig() error {
+	if err := checkHiddenStreamsConfig(); err != nil {
+		return err
+	}
+	if err := checkTimeBoundsConfig(); err != nil {
+		return err
+	}
+	return checkFacetsCacheConfig()
+}
+
+// Init initializes the logsql package.
+//
+// Stop must be called when the logsql package is no longer needed.
+func Init() {
+	initHiddenStreams()
+	initTimeBounds()
+	initFacetsCache()
+}
+
+// Stop stops the logsql package.
+func Stop() {
+	stopFacetsCache()
+	stopHiddenStreams()
+}
+
 // ProcessQueryTimeRangeRequest handles /select/logsql/query_time_range request.
 //
 // This request returns JSON object with "start" and "end" fields containing
@@ -135,6 +170,11 @@ func ProcessFacetsRequest(ctx context.Context, w http.ResponseWriter, r *http.Re
 	}
 	keepConstFields := httputil.GetBool(r, "keep_const_fields")
 
+	if fc := facetsCacheGlobal; fc != nil && fc.tryWriteResponse(w, ca, limit, maxValuesPerField, maxValueLen, keepConstFields) {
+		// The response has been obtained from the facets cache without scanning the stored logs.
+		return
+	}
+
 	// Pipes must be dropped, since it is expected facets are obtained
 	// from the real logs stored in the database.
 	ca.q.DropAllPipes()
@@ -255,6 +295,13 @@ func ProcessHitsRequest(ctx context.Context, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if len(fields) == 0 && !*disableHitsPreaggregation {
+		// Try obtaining hits from the pre-aggregated per-stream hits without scanning the stored logs.
+		if processHitsPreaggregatedRequest(ctx, w, r, ca, int64(step), int64(offset)) {
+			return
+		}
+	}
+
 	// Add a pipe, which calculates hits over time with the given step and offset for the given fields.
 	ca.q.AddCountByTimePipe(int64(step), int64(offset), fields)
 	start, end := ca.q.GetFilterTimeRange()
@@ -324,6 +371,120 @@ func ProcessHitsRequest(ctx context.Context, w http.ResponseWriter, r *http.Requ
 	WriteHitsSeries(w, m)
 }
 
+// processHitsPreaggregatedRequest writes hits for ca to w if they can be obtained from the pre-aggregated per-stream hits.
+//
+// The pre-aggregated hits have minute precision, so hits for the partial minutes at the edges of the selected time range
+// are obtained by scanning the stored logs.
+//
+// false is returned if the hits cannot be obtained from the pre-aggregated data, so the query must be executed in the regular way.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#pre-aggregated-hits
+func processHitsPreaggregatedRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, ca *commonArgs, step, offset int64) bool {
+	const minuteNsecs = int64(time.Minute)
+
+	start, end := ca.q.GetFilterTimeRange()
+	innerStart, innerEnd := start, end
+	if start != math.MinInt64 && start%minuteNsecs != 0 {
+		innerStart = start - start%minuteNsecs + minuteNsecs
+	}
+	if end != math.MaxInt64 && (end+1)%minuteNsecs != 0 {
+		innerEnd = end - (end+1)%minuteNsecs
+	}
+	if innerStart > innerEnd {
+		// The selected time range is too small for the pre-aggregated hits.
+		return false
+	}
+
+	timestamp := ca.q.GetTimestamp()
+	qctx := ca.newQueryContext(ctx)
+
+	startTime := time.Now()
+	qInner := ca.q.CloneWithTimeFilter(timestamp, innerStart, innerEnd)
+	timestamps, hits, ok, err := vlstorage.GetHitsPreaggregated(qctx.WithQuery(qInner), step, offset)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain pre-aggregated hits for query [%s]: %s", ca.q, err)
+		return true
+	}
+	if !ok {
+		return false
+	}
+	defer ca.updatePerQueryStatsMetrics()
+
+	hm := make(map[int64]uint64, len(timestamps))
+	for i, ts := range timestamps {
+		hm[ts] += hits[i]
+	}
+
+	// Obtain hits for the partial minutes at the edges of the selected time range.
+	var mLock sync.Mutex
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		rowsCount := db.RowsCount()
+		if rowsCount == 0 {
+			return
+		}
+
+		columns := db.Columns
+		timestampValues := columns[0].Values
+		hitsValues := columns[len(columns)-1].Values
+
+		mLock.Lock()
+		for i := 0; i < rowsCount; i++ {
+			timestampNsec, ok := logstorage.TryParseTimestampRFC3339Nano(timestampValues[i])
+			if !ok {
+				logger.Panicf("BUG: cannot parse timestamp=%q", timestampValues[i])
+			}
+			n, err := strconv.ParseUint(hitsValues[i], 10, 64)
+			if err != nil {
+				logger.Panicf("BUG: cannot parse hits=%q: %s", hitsValues[i], err)
+			}
+			hm[timestampNsec] += n
+		}
+		mLock.Unlock()
+	}
+	edges := [][2]int64{
+		{start, innerStart - 1},
+		{innerEnd + 1, end},
+	}
+	for _, edge := range edges {
+		if edge[0] > edge[1] {
+			continue
+		}
+		qEdge := ca.q.CloneWithTimeFilter(timestamp, edge[0], edge[1])
+		qEdge.AddCountByTimePipe(step, offset, nil)
+		if err := vlstorage.RunQuery(qctx.WithQuery(qEdge), writeBlock); err != nil {
+			httpserver.Errorf(w, r, "cannot execute query [%s]: %s", qEdge, err)
+			return true
+		}
+	}
+
+	m := make(map[string]*hitsSeries)
+	if len(hm) > 0 {
+		hs := &hitsSeries{}
+		for ts := range hm {
+			hs.timestamps = append(hs.timestamps, ts)
+		}
+		slices.Sort(hs.timestamps)
+		for _, ts := range hs.timestamps {
+			n := hm[ts]
+			hs.hits = append(hs.hits, n)
+			hs.hitsTotal += n
+		}
+		m["{}"] = hs
+	}
+	addMissingZeroHits(m, start, end, step, offset)
+
+	// Write response headers
+	h := w.Header()
+
+	h.Set("Content-Type", "application/json")
+	ca.writeResponseHeaders(h, startTime)
+
+	// Write response
+	WriteHitsSeries(w, m)
+
+	return true
+}
+
 func addMissingZeroHits(m map[string]*hitsSeries, start, end, step, offset int64) {
 	if start == math.MinInt64 {
 		start = math.MaxInt64
@@ -660,6 +821,76 @@ func ProcessStreamsRequest(ctx context.Context, w http.ResponseWriter, r *http.R
 	WriteValuesWithHitsJSON(w, streams)
 }
 
+// ProcessStaleStreamsRequest processes /select/logsql/stale_streams request.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-stale-streams
+func ProcessStaleStreamsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	// The query arg is optional for this endpoint - all the streams are checked if it is missing.
+	if r.FormValue("query") == "" {
+		r.Form.Set("query", "*")
+	}
+
+	ca, err := parseCommonArgs(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	// Obtain threshold
+	thresholdStr := r.FormValue("threshold")
+	if thresholdStr == "" {
+		httpserver.Errorf(w, r, "missing 'threshold' arg")
+		return
+	}
+	threshold, err := timeutil.ParseDuration(thresholdStr)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse 'threshold' arg: %s", err)
+		return
+	}
+	if threshold <= 0 {
+		httpserver.Errorf(w, r, "'threshold' must be bigger than zero")
+		return
+	}
+
+	// Parse limit query arg
+	limit, err := getPositiveInt(r, "limit")
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	qctx := ca.newQueryContext(ctx)
+	defer ca.updatePerQueryStatsMetrics()
+
+	// Obtain the last seen time for streams matching the given query
+	startTime := time.Now()
+	streams, err := vlstorage.GetStreamsLastSeen(qctx)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain stale streams: %s", err)
+		return
+	}
+
+	// Leave only streams without new logs during the last threshold.
+	// The streams are sorted by the last seen time, so the stale streams go first.
+	maxLastSeen := startTime.UnixNano() - threshold.Nanoseconds()
+	n := sort.Search(len(streams), func(i int) bool {
+		return streams[i].LastSeen > maxLastSeen
+	})
+	streams = streams[:n]
+	if limit > 0 && len(streams) > limit {
+		streams = streams[:limit]
+	}
+
+	// Write response headers
+	h := w.Header()
+
+	h.Set("Content-Type", "application/json")
+	ca.writeResponseHeaders(h, startTime)
+
+	// Write results
+	WriteStaleStreamsJSON(w, streams)
+}
+
 // ProcessLiveTailRequest processes live tailing request to /select/logsq/tail
 //
 // See https://docs.victoriametrics.com/victorialogs/querying/#live-tailing
@@ -714,7 +945,6 @@ func ProcessLiveTailRequest(ctx context.Context, w http.ResponseWriter, r *http.
 	}
 
 	w.Header().Set("Content-Type", "application/x-ndjson")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	flusher.Flush()
 
 	qctx := ca.newQueryContext(ctxWithCancel)
@@ -1014,11 +1244,19 @@ func ProcessStatsQueryRangeRequest(ctx context.Context, w http.ResponseWriter, r
 	// Write response headers
 	h := w.Header()
 
-	h.Set("Content-Type", "application/json")
+	re := getResponseEncoding(r)
+	h.Set("Content-Type", re.contentType("application/json"))
 	ca.writeResponseHeaders(h, startTime)
 
 	// Write response
-	WriteStatsQueryRangeResponse(w, rows)
+	switch re {
+	case responseEncodingProtobuf:
+		_, _ = w.Write(marshalProtobufStatsSeries(nil, rows))
+	case responseEncodingMsgpack:
+		_, _ = w.Write(marshalMsgpackStatsSeries(nil, rows))
+	default:
+		WriteStatsQueryRangeResponse(w, rows)
+	}
 }
 
 type statsSeries struct {
@@ -1136,11 +1374,19 @@ func ProcessStatsQueryRequest(ctx context.Context, w http.ResponseWriter, r *htt
 	// Write response headers
 	h := w.Header()
 
-	h.Set("Content-Type", "application/json")
+	re := getResponseEncoding(r)
+	h.Set("Content-Type", re.contentType("application/json"))
 	ca.writeResponseHeaders(h, startTime)
 
 	// Write response
-	WriteStatsQueryResponse(w, rows)
+	switch re {
+	case responseEncodingProtobuf:
+		_, _ = w.Write(marshalProtobufStatsSeries(nil, statsRowsToSeries(rows)))
+	case responseEncodingMsgpack:
+		_, _ = w.Write(marshalMsgpackStatsSeries(nil, statsRowsToSeries(rows)))
+	default:
+		WriteStatsQueryResponse(w, rows)
+	}
 }
 
 type statsRow struct {
@@ -1159,6 +1405,22 @@ type histogramBucket struct {
 //
 // See https://docs.victoriametrics.com/victorialogs/querying/#querying-logs
 func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	processQueryRequest(ctx, w, r, maxQueryResponseSize.IntN())
+}
+
+// ProcessExportRequest handles /select/logsql/export request.
+//
+// It is equivalent to /select/logsql/query, except of it always streams the response without -search.maxQueryResponseSize limit.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#response-size-limit
+func ProcessExportRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	processQueryRequest(ctx, w, r, 0)
+}
+
+// processQueryRequest executes the query from r and writes the results to w.
+//
+// If maxResponseSize > 0, then the response is buffered in memory and the error is returned instead of the response if its size exceeds maxResponseSize.
+func processQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, maxResponseSize int) {
 	ca, err := parseCommonArgs(r)
 	if err != nil {
 		httpserver.Errorf(w, r, "%s", err)
@@ -1179,6 +1441,42 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Parse output options
+	opts, err := parseQueryOutputOptions(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	transformColumns := !opts.isDefault()
+
+	format, err := parseQueryFormat(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	tmpl, err := parseQueryTemplate(r, format)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	// Parse annotate_rows query arg
+	annotateRows := false
+	if err := getBoolFromRequest(&annotateRows, r, "annotate_rows"); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	// Parse view_id query arg. See https://docs.victoriametrics.com/victorialogs/querying/#consistent-exports
+	viewID := r.FormValue("view_id")
+
+	// Parse approx query arg
+	approx := false
+	if err := getBoolFromRequest(&approx, r, "approx"); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
 	sw := &syncWriter{
 		w: w,
 	}
@@ -1194,7 +1492,35 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 		}
 	}()
 
-	if limit > 0 {
+	var qobShards atomicutil.Slice[queryOutputBuf]
+	var qfbShards atomicutil.Slice[queryFormatBuf]
+
+	// Obtain the approximate count before adding offset and limit pipes to the query, since they do not change the count() results.
+	var approxResultName string
+	if approx {
+		resultName, ok := ca.q.GetApproxCountResultName()
+		if ok {
+			approxResultName = resultName
+		} else {
+			// The query cannot be answered from the index metadata, so execute it in the regular way.
+			approx = false
+		}
+	}
+
+	// Buffer the response in order to return the error instead of the response if its size exceeds maxResponseSize.
+	var rl *responseSizeLimiter
+	if maxResponseSize > 0 && !approx {
+		var cancel func()
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		rl = &responseSizeLimiter{
+			maxSize: maxResponseSize,
+			cancel:  cancel,
+		}
+		sw.w = rl
+	}
+
+	if limit > 0 && !approx {
 		// Add '| sort by (_time) desc | offset <offset> | limit <limit>' to the end of the query.
 		// This pattern is automatically optimized during query execution - see https://github.com/VictoriaMetrics/VictoriaLogs/issues/96 .
 		if ca.q.CanReturnLastNResults() {
@@ -1203,12 +1529,20 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 		ca.q.AddPipeOffsetLimit(uint64(offset), uint64(limit))
 	}
 
+	re := getResponseEncoding(r)
+	contentType := re.contentType("application/stream+json")
+	if format != queryFormatJSON {
+		// The format query arg takes precedence over Accept header.
+		re = responseEncodingJSON
+		contentType = format.contentType()
+	}
+
 	startTime := time.Now()
 	writeResponseHeadersOnce := sync.OnceFunc(func() {
 		// Write response headers
 		h := w.Header()
 
-		h.Set("Content-Type", "application/stream+json")
+		h.Set("Content-Type", contentType)
 		ca.writeResponseHeaders(h, startTime)
 	})
 
@@ -1219,10 +1553,31 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 			return
 		}
 		columns := db.Columns
+		if transformColumns {
+			columns = opts.transformColumns(qobShards.Get(workerID), columns)
+		}
 
 		bw := bwShards.Get(workerID)
+		switch format {
+		case queryFormatNDJSONSchema:
+			writeSchemaRows(bw, qfbShards.Get(workerID), columns, rowsCount)
+			return
+		case queryFormatLogfmt:
+			writeLogfmtRows(bw, qfbShards.Get(workerID), columns, rowsCount)
+			return
+		case queryFormatTemplate:
+			writeTemplateRows(bw, qfbShards.Get(workerID), tmpl, columns, rowsCount)
+			return
+		}
 		for i := 0; i < rowsCount; i++ {
-			WriteJSONRow(bw, columns, i)
+			switch re {
+			case responseEncodingProtobuf:
+				bw.buf = appendProtobufLogRow(bw.buf, columns, i)
+			case responseEncodingMsgpack:
+				bw.buf = appendMsgpackLogRow(bw.buf, columns, i)
+			default:
+				WriteJSONRow(bw, columns, i)
+			}
 			if len(bw.buf) > 16*1024 {
 				bw.FlushIgnoreErrors()
 			}
@@ -1230,27 +1585,70 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 
 	qctx := ca.newQueryContext(ctx)
+	qctx.AnnotateRows = annotateRows
+	qctx.ViewID = viewID
 	defer ca.updatePerQueryStatsMetrics()
 
+	if approx {
+		ac, err := vlstorage.GetApproxCount(qctx)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot obtain approximate count for query [%s]: %s", ca.q, err)
+			return
+		}
+		writeBlock(0, &logstorage.DataBlock{
+			Columns: []logstorage.BlockColumn{
+				{
+					Name:   approxResultName,
+					Values: []string{strconv.FormatUint(ac.Count, 10)},
+				},
+				{
+					Name:   approxResultName + "_lower_bound",
+					Values: []string{strconv.FormatUint(ac.LowerBound, 10)},
+				},
+				{
+					Name:   approxResultName + "_upper_bound",
+					Values: []string{strconv.FormatUint(ac.UpperBound, 10)},
+				},
+			},
+		})
+		return
+	}
+
 	// Execute the query
-	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+	err = vlstorage.RunQuery(qctx, writeBlock)
+	if rl != nil {
+		// Send the pending data from bwShards to rl in order to check whether the response size exceeds the limit.
+		for _, shard := range bwShards.All() {
+			shard.FlushIgnoreErrors()
+		}
+		if rl.exceeded {
+			writeResponseTooBigError(r.Context(), w, r, viewID)
+			return
+		}
+	}
+	if err != nil {
 		httpserver.Errorf(w, r, "cannot execute query [%s]: %s", ca.q, err)
 		return
 	}
 
 	// This call is needed for the case when the response didn't return any results.
 	writeResponseHeadersOnce()
+
+	if rl != nil {
+		if _, err := w.Write(rl.buf); err != nil {
+			httpserver.Errorf(w, r, "cannot send response to the client: %s", err)
+		}
+	}
 }
 
 // ProcessTenantIDsRequest processes /select/tenant_ids request.
 func ProcessTenantIDsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	accountID := r.Header.Get("AccountID")
-	if accountID != "" {
+	if logstorage.HasTenantInRequest(r) {
 		// Security measure - prevent from requesting tenant_ids for requests with the already specified tenant.
 		// This allows enforcing the needed tenants at vmauth side, so they won't have access to /select/tenant_ids endpoint.
 		// See https://docs.victoriametrics.com/victoriametrics/vmauth/#modifying-http-headers
 		err := &httpserver.ErrorWithStatusCode{
-			Err:        fmt.Errorf("the /select/tenant_ids endpoint cannot be requested with non-empty AccountID=%q header", accountID),
+			Err:        errors.New("the /select/tenant_ids endpoint cannot be requested with non-empty AccountID, ProjectID or X-Scope-OrgID headers"),
 			StatusCode: http.StatusForbidden,
 		}
 		httpserver.Errorf(w, r, "%s", err)
@@ -1308,6 +1706,9 @@ func ProcessTenantIDsRequest(ctx context.Context, w http.ResponseWriter, r *http
 type syncWriter struct {
 	mu sync.Mutex
 	w  io.Writer
+
+	// lastSchema is the last schema record written to w in format=ndjson_schema.
+	lastSchema []byte
 }
 
 func (sw *syncWriter) Write(p []byte) (int, error) {
@@ -1317,9 +1718,37 @@ func (sw *syncWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// writeWithSchema writes p to sw after the given schema record if it differs from the previously written schema record.
+func (sw *syncWriter) writeWithSchema(schema, p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if string(schema) != string(sw.lastSchema) {
+		if _, err := sw.w.Write(schema); err != nil {
+			return 0, err
+		}
+		sw.lastSchema = append(sw.lastSchema[:0], schema...)
+	}
+	return sw.w.Write(p)
+}
+
 type bufferedWriter struct {
 	buf []byte
 	sw  *syncWriter
+
+	// schema is the schema record for the rows at buf in format=ndjson_schema.
+	schema []byte
+}
+
+// setSchema sets the schema record for the rows written to bw after the call.
+func (bw *bufferedWriter) setSchema(schema []byte) {
+	if string(schema) == string(bw.schema) {
+		return
+	}
+	if len(bw.buf) > 0 {
+		bw.FlushIgnoreErrors()
+	}
+	bw.schema = append(bw.schema[:0], schema...)
 }
 
 func (bw *bufferedWriter) Write(p []byte) (int, error) {
@@ -1331,7 +1760,13 @@ func (bw *bufferedWriter) Write(p []byte) (int, error) {
 }
 
 func (bw *bufferedWriter) FlushIgnoreErrors() {
-	_, _ = bw.sw.Write(bw.buf)
+	if len(bw.schema) > 0 {
+		if len(bw.buf) > 0 {
+			_, _ = bw.sw.writeWithSchema(bw.schema, bw.buf)
+		}
+	} else {
+		_, _ = bw.sw.Write(bw.buf)
+	}
 	bw.buf = bw.buf[:0]
 }
 
@@ -1349,12 +1784,44 @@ type commonArgs struct {
 	// Optional fields and field prefixes to hide during query execution.
 	hiddenFieldsFilters []string
 
+	// Whether to make all the pending data available for querying before executing the query.
+	// This provides read-after-write consistency for the logs ingested before the query.
+	ensureFresh bool
+
+	// The preference for choosing vlstorage replicas for querying.
+	// This option makes sense only for cluster setup when vlselect queries vlstorage nodes with replicas.
+	readPreference string
+
 	// qs contains query execution statistics.
 	qs logstorage.QueryStats
 }
 
 func (ca *commonArgs) newQueryContext(ctx context.Context) *logstorage.QueryContext {
-	return logstorage.NewQueryContext(ctx, &ca.qs, ca.tenantIDs, ca.q, ca.allowPartialResponse, ca.hiddenFieldsFilters)
+	if ca.ensureFresh {
+		// Flush the pending data only once per request.
+		vlstorage.EnsureFresh()
+		ca.ensureFresh = false
+	}
+	ca.publishQueryStats(ctx)
+	qctx := logstorage.NewQueryContext(ctx, &ca.qs, ca.tenantIDs, ca.q, ca.allowPartialResponse, ca.hiddenFieldsFilters)
+	qctx.ReadPreference = ca.readPreference
+	return qctx
+}
+
+type queryStatsPtrKey struct{}
+
+// WithQueryStatsPtr returns ctx, which instructs Process* functions to store the pointer to query execution stats at p.
+//
+// The stored stats are updated while the query is executed, so they must be read via logstorage.QueryStats.LoadAtomic.
+func WithQueryStatsPtr(ctx context.Context, p *atomic.Pointer[logstorage.QueryStats]) context.Context {
+	return context.WithValue(ctx, queryStatsPtrKey{}, p)
+}
+
+func (ca *commonArgs) publishQueryStats(ctx context.Context) {
+	p, ok := ctx.Value(queryStatsPtrKey{}).(*atomic.Pointer[logstorage.QueryStats])
+	if ok {
+		p.Store(&ca.qs)
+	}
 }
 
 func (ca *commonArgs) updatePerQueryStatsMetrics() {
@@ -1446,6 +1913,27 @@ func parseCommonArgsWithConfig(r *http.Request, skipMaxRangeCheck bool) (*common
 		q.AddExtraFilters(extraStreamFilters)
 	}
 
+	// Exclude hidden streams unless include_hidden_streams=1 query arg is set.
+	// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+	includeHiddenStreams := false
+	if err := getBoolFromRequest(&includeHiddenStreams, r, "include_hidden_streams"); err != nil {
+		return nil, err
+	}
+	if !includeHiddenStreams {
+		hiddenStreamsFilter, err := getHiddenStreamsFilter(tenantID)
+		if err != nil {
+			return nil, err
+		}
+		q.AddExtraFilters(hiddenStreamsFilter)
+	}
+
+	if !skipMaxRangeCheck {
+		// Apply time bounds to the query. See https://docs.victoriametrics.com/victorialogs/querying/#query-time-bounds
+		if err := applyQueryTimeBounds(q, GetRequestUser(r), currTimestamp); err != nil {
+			return nil, err
+		}
+	}
+
 	if maxRange := maxQueryTimeRange.Duration(); maxRange > 0 && !skipMaxRangeCheck {
 		start, end := q.GetFilterTimeRange()
 		if end > start {
@@ -1468,12 +1956,25 @@ func parseCommonArgsWithConfig(r *http.Request, skipMaxRangeCheck bool) (*common
 		return nil, err
 	}
 
+	ensureFresh := false
+	if err := getBoolFromRequest(&ensureFresh, r, "ensure_fresh"); err != nil {
+		return nil, err
+	}
+
+	// Parse read_preference query arg. See https://docs.victoriametrics.com/victorialogs/cluster/#read-preference
+	readPreference := r.FormValue("read_preference")
+	if !logstorage.IsValidReadPreference(readPreference) {
+		return nil, fmt.Errorf("unsupported read_preference=%q; supported values: any, freshest, zone-local", readPreference)
+	}
+
 	ca := &commonArgs{
 		q:         q,
 		tenantIDs: tenantIDs,
 
 		allowPartialResponse: allowPartialResponse,
 		hiddenFieldsFilters:  hiddenFieldsFilters,
+		ensureFresh:          ensureFresh,
+		readPreference:       readPreference,
 	}
 	return ca, nil
 }
@@ -1665,6 +2166,11 @@ func (ca *commonArgs) writeResponseHeaders(h http.Header, startTime time.Time) {
 		h.Set("ProjectID", fmt.Sprintf("%d", tenantID.ProjectID))
 	}
 
+	if h.Get("VL-Query-ID") != "" {
+		// Expose the query id set by vlselect, so the client could cancel the query via /select/logsql/cancel.
+		accessControlExposeHeaders = append(accessControlExposeHeaders, "VL-Query-ID")
+	}
+
 	for i, v := range accessControlExposeHeaders {
 		accessControlExposeHeaders[i] = http.CanonicalHeaderKey(v)
 	}
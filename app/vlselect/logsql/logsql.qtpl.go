@@ -150,3 +150,64 @@ func valueWithHitsJSON(v logstorage.ValueWithHits) string {
 	return qs422016
 //line app/vlselect/logsql/logsql.qtpl:30
 }
+
+// StaleStreamsJSON generates JSON from the given streams.
+
+//line app/vlselect/logsql/logsql.qtpl:33
+func StreamStaleStreamsJSON(qw422016 *qt422016.Writer, streams []logstorage.StreamLastSeen) {
+//line app/vlselect/logsql/logsql.qtpl:33
+	qw422016.N().S(`{"streams":[`)
+//line app/vlselect/logsql/logsql.qtpl:36
+	for i, s := range streams {
+//line app/vlselect/logsql/logsql.qtpl:37
+		if i > 0 {
+//line app/vlselect/logsql/logsql.qtpl:37
+			qw422016.N().S(`,`)
+//line app/vlselect/logsql/logsql.qtpl:37
+		}
+//line app/vlselect/logsql/logsql.qtpl:37
+		qw422016.N().S(`{"stream":`)
+//line app/vlselect/logsql/logsql.qtpl:39
+		qw422016.N().Q(s.Stream)
+//line app/vlselect/logsql/logsql.qtpl:39
+		qw422016.N().S(`,"stream_id":`)
+//line app/vlselect/logsql/logsql.qtpl:40
+		qw422016.N().Q(s.StreamID)
+//line app/vlselect/logsql/logsql.qtpl:40
+		qw422016.N().S(`,"last_seen":`)
+//line app/vlselect/logsql/logsql.qtpl:41
+		qw422016.N().Q(timestampToString(s.LastSeen))
+//line app/vlselect/logsql/logsql.qtpl:41
+		qw422016.N().S(`}`)
+//line app/vlselect/logsql/logsql.qtpl:43
+	}
+//line app/vlselect/logsql/logsql.qtpl:43
+	qw422016.N().S(`]}`)
+//line app/vlselect/logsql/logsql.qtpl:46
+}
+
+//line app/vlselect/logsql/logsql.qtpl:46
+func WriteStaleStreamsJSON(qq422016 qtio422016.Writer, streams []logstorage.StreamLastSeen) {
+//line app/vlselect/logsql/logsql.qtpl:46
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vlselect/logsql/logsql.qtpl:46
+	StreamStaleStreamsJSON(qw422016, streams)
+//line app/vlselect/logsql/logsql.qtpl:46
+	qt422016.ReleaseWriter(qw422016)
+//line app/vlselect/logsql/logsql.qtpl:46
+}
+
+//line app/vlselect/logsql/logsql.qtpl:46
+func StaleStreamsJSON(streams []logstorage.StreamLastSeen) string {
+//line app/vlselect/logsql/logsql.qtpl:46
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vlselect/logsql/logsql.qtpl:46
+	WriteStaleStreamsJSON(qb422016, streams)
+//line app/vlselect/logsql/logsql.qtpl:46
+	qs422016 := string(qb422016.B)
+//line app/vlselect/logsql/logsql.qtpl:46
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vlselect/logsql/logsql.qtpl:46
+	return qs422016
+//line app/vlselect/logsql/logsql.qtpl:46
+}
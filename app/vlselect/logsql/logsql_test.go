@@ -1,6 +1,7 @@
 package logsql
 
 import (
+	"net/http"
 	"testing"
 )
 
@@ -101,3 +102,35 @@ func TestParseExtraStreamFilters_Failure(t *testing.T) {
 	// excess pipe
 	f(`foo | count()`)
 }
+
+func TestParseCommonArgsEnsureFresh(t *testing.T) {
+	f := func(args string, resultExpected bool) {
+		t.Helper()
+
+		r, err := http.NewRequest(http.MethodGet, "http://localhost/select/logsql/query?query=*&"+args, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		ca, err := parseCommonArgs(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ca.ensureFresh != resultExpected {
+			t.Fatalf("unexpected ensureFresh for %q; got %v; want %v", args, ca.ensureFresh, resultExpected)
+		}
+	}
+
+	f("", false)
+	f("ensure_fresh=0", false)
+	f("ensure_fresh=1", true)
+	f("ensure_fresh=true", true)
+
+	// invalid value
+	r, err := http.NewRequest(http.MethodGet, "http://localhost/select/logsql/query?query=*&ensure_fresh=foo", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := parseCommonArgs(r); err == nil {
+		t.Fatalf("expecting non-nil error for invalid ensure_fresh value")
+	}
+}
@@ -0,0 +1,303 @@
+package logsql
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// ProcessMetricHintsRequest processes /select/logsql/metric_hints request.
+//
+// It returns LogsQL stream filters and sample logs, which are likely related to the metric passed in `metric` query arg.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-metric-hints
+func ProcessMetricHintsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	// The query arg is optional for this endpoint.
+	if r.FormValue("query") == "" {
+		r.Form.Set("query", "*")
+	}
+	ca, err := parseCommonArgs(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	// Parse metric query arg
+	metric := r.FormValue("metric")
+	if metric == "" {
+		httpserver.Errorf(w, r, "missing 'metric' query arg")
+		return
+	}
+	metricName, matchers, err := parseMetricSelector(metric)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse metric=%q: %s", metric, err)
+		return
+	}
+
+	// Parse limit query arg
+	limit, err := getPositiveInt(r, "limit")
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if limit == 0 {
+		limit = 10
+	}
+
+	// Parse streams_limit query arg
+	streamsLimit, err := getPositiveInt(r, "streams_limit")
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if streamsLimit == 0 {
+		streamsLimit = 100
+	}
+
+	defer ca.updatePerQueryStatsMetrics()
+	startTime := time.Now()
+
+	// Obtain stream fields, which are shared with the metric labels
+	qctx := ca.newQueryContext(ctx)
+	streamFieldNames, err := vlstorage.GetStreamFieldNames(qctx)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain stream field names: %s", err)
+		return
+	}
+	var sharedMatchers []metricLabelMatcher
+	for _, m := range matchers {
+		ok := slices.ContainsFunc(streamFieldNames, func(v logstorage.ValueWithHits) bool {
+			return v.Value == m.label
+		})
+		if ok {
+			sharedMatchers = append(sharedMatchers, m)
+		}
+	}
+
+	// Obtain streams for candidate filters starting from the most specific one
+	var hints []metricHint
+	for _, filterStr := range getMetricHintFilters(sharedMatchers) {
+		qctxHint, err := ca.newQueryContextWithStreamFilter(ctx, filterStr)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		streams, err := vlstorage.GetStreams(qctxHint, uint64(streamsLimit))
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot obtain streams for %s: %s", filterStr, err)
+			return
+		}
+		if len(streams) == 0 {
+			continue
+		}
+		hints = append(hints, metricHint{
+			filter:  filterStr,
+			streams: streams,
+		})
+	}
+
+	// Obtain sample logs for the most specific filter
+	var rows [][]logstorage.Field
+	if len(hints) > 0 {
+		rows, err = ca.getMetricHintSampleLogs(ctx, hints[0].filter, limit)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot obtain sample logs for %s: %s", hints[0].filter, err)
+			return
+		}
+	}
+
+	sharedLabels := make([]string, len(sharedMatchers))
+	for i, m := range sharedMatchers {
+		sharedLabels[i] = m.label
+	}
+
+	// Write response headers
+	h := w.Header()
+
+	h.Set("Content-Type", "application/json")
+	ca.writeResponseHeaders(h, startTime)
+
+	// Write results
+	WriteMetricHintsResponse(w, metricName, sharedLabels, hints, rows)
+}
+
+type metricHint struct {
+	// filter is LogsQL stream filter for logs related to the metric
+	filter string
+
+	// streams contains log streams matching the filter
+	streams []logstorage.ValueWithHits
+}
+
+func (mh *metricHint) hits() uint64 {
+	n := uint64(0)
+	for _, s := range mh.streams {
+		n += s.Hits
+	}
+	return n
+}
+
+func (ca *commonArgs) newQueryContextWithStreamFilter(ctx context.Context, filterStr string) (*logstorage.QueryContext, error) {
+	f, err := logstorage.ParseFilter(filterStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse stream filter %s: %w", filterStr, err)
+	}
+	q := ca.q.Clone(ca.q.GetTimestamp())
+	q.AddExtraFilters(f)
+	ca.publishQueryStats(ctx)
+	return logstorage.NewQueryContext(ctx, &ca.qs, ca.tenantIDs, q, ca.allowPartialResponse, ca.hiddenFieldsFilters), nil
+}
+
+func (ca *commonArgs) getMetricHintSampleLogs(ctx context.Context, filterStr string, limit int) ([][]logstorage.Field, error) {
+	qctx, err := ca.newQueryContextWithStreamFilter(ctx, filterStr)
+	if err != nil {
+		return nil, err
+	}
+	qctx.Query.AddPipeSortByTimeDesc()
+	qctx.Query.AddPipeOffsetLimit(0, uint64(limit))
+
+	var rowsLock sync.Mutex
+	var rows [][]logstorage.Field
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		rowsCount := db.RowsCount()
+
+		rowsLock.Lock()
+		defer rowsLock.Unlock()
+
+		for i := 0; i < rowsCount; i++ {
+			fields := make([]logstorage.Field, len(db.Columns))
+			for j, c := range db.Columns {
+				fields[j] = logstorage.Field{
+					Name:  strings.Clone(c.Name),
+					Value: strings.Clone(c.Values[i]),
+				}
+			}
+			rows = append(rows, fields)
+		}
+	}
+	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// getMetricHintFilters returns LogsQL stream filters for the given matchers starting from the most specific filter.
+func getMetricHintFilters(matchers []metricLabelMatcher) []string {
+	if len(matchers) == 0 {
+		return nil
+	}
+
+	filters := []string{marshalMetricLabelMatchers(matchers)}
+	if len(matchers) > 1 {
+		for _, m := range matchers {
+			filters = append(filters, marshalMetricLabelMatchers([]metricLabelMatcher{m}))
+		}
+	}
+	return filters
+}
+
+func marshalMetricLabelMatchers(matchers []metricLabelMatcher) string {
+	a := make([]string, len(matchers))
+	for i, m := range matchers {
+		a[i] = strconv.Quote(m.label) + m.op + strconv.Quote(m.value)
+	}
+	return "{" + strings.Join(a, ",") + "}"
+}
+
+// metricLabelMatcher is a label matcher from Prometheus series selector.
+type metricLabelMatcher struct {
+	label string
+	op    string
+	value string
+}
+
+// parseMetricSelector parses Prometheus series selector such as `metric_name{label1="value1",...,labelN=~"regexpN"}`.
+//
+// It returns the metric name and label matchers except of the matcher for `__name__` label.
+func parseMetricSelector(s string) (string, []metricLabelMatcher, error) {
+	s = strings.TrimSpace(s)
+	n := strings.IndexByte(s, '{')
+	if n < 0 {
+		return s, nil, nil
+	}
+	metricName := strings.TrimSpace(s[:n])
+	s = s[n+1:]
+
+	var matchers []metricLabelMatcher
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if strings.HasPrefix(s, "}") {
+			if tail := strings.TrimSpace(s[1:]); tail != "" {
+				return "", nil, fmt.Errorf("unexpected tail after '}': %q", tail)
+			}
+			return metricName, matchers, nil
+		}
+
+		// Parse label name
+		n := strings.IndexAny(s, "=!")
+		if n <= 0 {
+			return "", nil, fmt.Errorf("missing label name at %q", s)
+		}
+		label := strings.TrimSpace(s[:n])
+		if strings.HasPrefix(label, `"`) {
+			l, err := strconv.Unquote(label)
+			if err != nil {
+				return "", nil, fmt.Errorf("cannot unquote label name %s: %w", label, err)
+			}
+			label = l
+		}
+		s = s[n:]
+
+		// Parse matcher operation
+		op := ""
+		for _, o := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(s, o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return "", nil, fmt.Errorf("missing matcher operation for label %q", label)
+		}
+		s = strings.TrimLeft(s[len(op):], " \t\n")
+
+		// Parse label value
+		valueQuoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot parse value for label %q at %q: %w", label, s, err)
+		}
+		value, err := strconv.Unquote(valueQuoted)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot unquote value for label %q: %w", label, err)
+		}
+		s = strings.TrimLeft(s[len(valueQuoted):], " \t\n")
+
+		if label == "__name__" {
+			if op == "=" && metricName == "" {
+				metricName = value
+			}
+		} else {
+			matchers = append(matchers, metricLabelMatcher{
+				label: label,
+				op:    op,
+				value: value,
+			})
+		}
+
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if !strings.HasPrefix(s, "}") {
+			return "", nil, fmt.Errorf("missing ',' or '}' after the value for label %q", label)
+		}
+	}
+}
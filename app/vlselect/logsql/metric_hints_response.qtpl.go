@@ -0,0 +1,221 @@
+// Code generated by qtc from "metric_hints_response.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:1
+package logsql
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:1
+import (
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// MetricHintsResponse generates response for /select/logsql/metric_hints
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:8
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:8
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:8
+func StreamMetricHintsResponse(qw422016 *qt422016.Writer, metricName string, sharedLabels []string, hints []metricHint, rows [][]logstorage.Field) {
+//line app/vlselect/logsql/metric_hints_response.qtpl:8
+	qw422016.N().S(`{"metric":`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:10
+	qw422016.N().Q(metricName)
+//line app/vlselect/logsql/metric_hints_response.qtpl:10
+	qw422016.N().S(`,"shared_labels":[`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:12
+	if len(sharedLabels) > 0 {
+//line app/vlselect/logsql/metric_hints_response.qtpl:13
+		qw422016.N().Q(sharedLabels[0])
+//line app/vlselect/logsql/metric_hints_response.qtpl:14
+		for _, label := range sharedLabels[1:] {
+//line app/vlselect/logsql/metric_hints_response.qtpl:14
+			qw422016.N().S(`,`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:15
+			qw422016.N().Q(label)
+//line app/vlselect/logsql/metric_hints_response.qtpl:16
+		}
+//line app/vlselect/logsql/metric_hints_response.qtpl:17
+	}
+//line app/vlselect/logsql/metric_hints_response.qtpl:17
+	qw422016.N().S(`],"hints":[`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:20
+	if len(hints) > 0 {
+//line app/vlselect/logsql/metric_hints_response.qtpl:21
+		streammetricHintJSON(qw422016, &hints[0])
+//line app/vlselect/logsql/metric_hints_response.qtpl:22
+		for i := range hints[1:] {
+//line app/vlselect/logsql/metric_hints_response.qtpl:22
+			qw422016.N().S(`,`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:23
+			streammetricHintJSON(qw422016, &hints[i+1])
+//line app/vlselect/logsql/metric_hints_response.qtpl:24
+		}
+//line app/vlselect/logsql/metric_hints_response.qtpl:25
+	}
+//line app/vlselect/logsql/metric_hints_response.qtpl:25
+	qw422016.N().S(`],"logs":[`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:28
+	if len(rows) > 0 {
+//line app/vlselect/logsql/metric_hints_response.qtpl:29
+		streammetricHintLogJSON(qw422016, rows[0])
+//line app/vlselect/logsql/metric_hints_response.qtpl:30
+		for _, fields := range rows[1:] {
+//line app/vlselect/logsql/metric_hints_response.qtpl:30
+			qw422016.N().S(`,`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:31
+			streammetricHintLogJSON(qw422016, fields)
+//line app/vlselect/logsql/metric_hints_response.qtpl:32
+		}
+//line app/vlselect/logsql/metric_hints_response.qtpl:33
+	}
+//line app/vlselect/logsql/metric_hints_response.qtpl:33
+	qw422016.N().S(`]}`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+}
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+func WriteMetricHintsResponse(qq422016 qtio422016.Writer, metricName string, sharedLabels []string, hints []metricHint, rows [][]logstorage.Field) {
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+	StreamMetricHintsResponse(qw422016, metricName, sharedLabels, hints, rows)
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+	qt422016.ReleaseWriter(qw422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+}
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+func MetricHintsResponse(metricName string, sharedLabels []string, hints []metricHint, rows [][]logstorage.Field) string {
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+	WriteMetricHintsResponse(qb422016, metricName, sharedLabels, hints, rows)
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+	qs422016 := string(qb422016.B)
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+	return qs422016
+//line app/vlselect/logsql/metric_hints_response.qtpl:36
+}
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:38
+func streammetricHintJSON(qw422016 *qt422016.Writer, mh *metricHint) {
+//line app/vlselect/logsql/metric_hints_response.qtpl:38
+	qw422016.N().S(`{"filter":`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:40
+	qw422016.N().Q(mh.filter)
+//line app/vlselect/logsql/metric_hints_response.qtpl:40
+	qw422016.N().S(`,"hits":`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:41
+	qw422016.N().DUL(mh.hits())
+//line app/vlselect/logsql/metric_hints_response.qtpl:41
+	qw422016.N().S(`,"streams":`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:42
+	streamvaluesWithHitsJSONArray(qw422016, mh.streams)
+//line app/vlselect/logsql/metric_hints_response.qtpl:42
+	qw422016.N().S(`}`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+}
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+func writemetricHintJSON(qq422016 qtio422016.Writer, mh *metricHint) {
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+	streammetricHintJSON(qw422016, mh)
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+	qt422016.ReleaseWriter(qw422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+}
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+func metricHintJSON(mh *metricHint) string {
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+	writemetricHintJSON(qb422016, mh)
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+	qs422016 := string(qb422016.B)
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+	return qs422016
+//line app/vlselect/logsql/metric_hints_response.qtpl:44
+}
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:46
+func streammetricHintLogJSON(qw422016 *qt422016.Writer, fields []logstorage.Field) {
+//line app/vlselect/logsql/metric_hints_response.qtpl:46
+	qw422016.N().S(`{`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:48
+	fields = logstorage.SkipLeadingFieldsWithoutValues(fields)
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:49
+	if len(fields) > 0 {
+//line app/vlselect/logsql/metric_hints_response.qtpl:50
+		qw422016.N().Q(fields[0].Name)
+//line app/vlselect/logsql/metric_hints_response.qtpl:50
+		qw422016.N().S(`:`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:50
+		qw422016.N().Q(fields[0].Value)
+//line app/vlselect/logsql/metric_hints_response.qtpl:51
+		for _, f := range fields[1:] {
+//line app/vlselect/logsql/metric_hints_response.qtpl:52
+			if f.Value == "" {
+//line app/vlselect/logsql/metric_hints_response.qtpl:53
+				continue
+//line app/vlselect/logsql/metric_hints_response.qtpl:54
+			}
+//line app/vlselect/logsql/metric_hints_response.qtpl:54
+			qw422016.N().S(`,`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:55
+			qw422016.N().Q(f.Name)
+//line app/vlselect/logsql/metric_hints_response.qtpl:55
+			qw422016.N().S(`:`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:55
+			qw422016.N().Q(f.Value)
+//line app/vlselect/logsql/metric_hints_response.qtpl:56
+		}
+//line app/vlselect/logsql/metric_hints_response.qtpl:57
+	}
+//line app/vlselect/logsql/metric_hints_response.qtpl:57
+	qw422016.N().S(`}`)
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+}
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+func writemetricHintLogJSON(qq422016 qtio422016.Writer, fields []logstorage.Field) {
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+	streammetricHintLogJSON(qw422016, fields)
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+	qt422016.ReleaseWriter(qw422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+}
+
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+func metricHintLogJSON(fields []logstorage.Field) string {
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+	qb422016 := qt422016.AcquireByteBuffer()
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+	writemetricHintLogJSON(qb422016, fields)
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+	qs422016 := string(qb422016.B)
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+	qt422016.ReleaseByteBuffer(qb422016)
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+	return qs422016
+//line app/vlselect/logsql/metric_hints_response.qtpl:59
+}
@@ -0,0 +1,78 @@
+package logsql
+
+import (
+	"testing"
+)
+
+func TestParseMetricSelector_Success(t *testing.T) {
+	f := func(s, metricNameExpected, filtersExpected string) {
+		t.Helper()
+
+		metricName, matchers, err := parseMetricSelector(s)
+		if err != nil {
+			t.Fatalf("unexpected error in parseMetricSelector: %s", err)
+		}
+		if metricName != metricNameExpected {
+			t.Fatalf("unexpected metric name\ngot\n%s\nwant\n%s", metricName, metricNameExpected)
+		}
+		filters := ""
+		if len(matchers) > 0 {
+			filters = marshalMetricLabelMatchers(matchers)
+		}
+		if filters != filtersExpected {
+			t.Fatalf("unexpected filters\ngot\n%s\nwant\n%s", filters, filtersExpected)
+		}
+	}
+
+	f(``, ``, ``)
+	f(`foo`, `foo`, ``)
+	f(`foo{}`, `foo`, ``)
+	f(`{__name__="foo"}`, `foo`, ``)
+	f(`foo{job="bar"}`, `foo`, `{"job"="bar"}`)
+	f(` foo { job = "bar" , instance=~"host-.+", env!="dev", "a.b"!~'x' , } `, `foo`, `{"job"="bar","instance"=~"host-.+","env"!="dev","a.b"!~"x"}`)
+	f(`{__name__="foo",job="a\"b"}`, `foo`, `{"job"="a\"b"}`)
+}
+
+func TestParseMetricSelector_Failure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		_, _, err := parseMetricSelector(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f(`foo{`)
+	f(`foo{job}`)
+	f(`foo{job="bar"`)
+	f(`foo{job=bar}`)
+	f(`foo{job<"bar"}`)
+	f(`foo{job="bar" instance="x"}`)
+	f(`foo{job="bar"} baz`)
+	f(`foo{="bar"}`)
+}
+
+func TestGetMetricHintFilters(t *testing.T) {
+	f := func(s string, filtersExpected []string) {
+		t.Helper()
+
+		_, matchers, err := parseMetricSelector(s)
+		if err != nil {
+			t.Fatalf("unexpected error in parseMetricSelector: %s", err)
+		}
+		filters := getMetricHintFilters(matchers)
+		if len(filters) != len(filtersExpected) {
+			t.Fatalf("unexpected filters\ngot\n%q\nwant\n%q", filters, filtersExpected)
+		}
+		for i := range filters {
+			if filters[i] != filtersExpected[i] {
+				t.Fatalf("unexpected filters\ngot\n%q\nwant\n%q", filters, filtersExpected)
+			}
+		}
+	}
+
+	f(`foo`, nil)
+	f(`foo{job="bar"}`, []string{`{"job"="bar"}`})
+	f(`foo{job="bar",instance=~"x.+"}`, []string{`{"job"="bar","instance"=~"x.+"}`, `{"job"="bar"}`, `{"instance"=~"x.+"}`})
+}
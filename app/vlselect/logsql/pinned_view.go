@@ -0,0 +1,87 @@
+package logsql
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+)
+
+// ProcessPinViewRequest handles /select/logsql/pin_view request.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#consistent-exports
+func ProcessPinViewRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ttl := 5 * time.Minute
+	if ttlStr := r.FormValue("ttl"); ttlStr != "" {
+		d, err := timeutil.ParseDuration(ttlStr)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot parse 'ttl' arg: %s", err)
+			return
+		}
+		ttl = d
+	}
+	if ttl <= 0 {
+		httpserver.Errorf(w, r, "'ttl' must be bigger than zero")
+		return
+	}
+	if ttl > *maxPinnedViewTTL {
+		httpserver.Errorf(w, r, "'ttl'=%s cannot exceed -search.maxPinnedViewTTL=%s", ttl, *maxPinnedViewTTL)
+		return
+	}
+
+	viewID, expiresAt, err := pinView(ctx, ttl)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	remoteAddr := httpserver.GetQuotedRemoteAddr(r)
+	logger.Infof("pinned the view with view_id=%q for ttl=%s by the request from remoteAddr=%s", viewID, ttl, remoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"view_id":%q,"expires_at":%q}`, viewID, expiresAt.UTC().Format(time.RFC3339))
+}
+
+// pinView pins the currently stored logs for the given ttl.
+//
+// It returns the id of the pinned view and the time when it expires.
+func pinView(ctx context.Context, ttl time.Duration) (string, time.Time, error) {
+	// Generate random view id, so it doesn't clash with view ids generated by other vlselect instances.
+	viewID := fmt.Sprintf("%016X%016X", time.Now().UnixNano(), rand.Uint64())
+	expiresAt := time.Now().Add(ttl)
+
+	if err := vlstorage.PinView(ctx, viewID, ttl); err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot pin view: %w", err)
+	}
+	pinnedViewsCreated.Inc()
+	return viewID, expiresAt, nil
+}
+
+// ProcessUnpinViewRequest handles /select/logsql/unpin_view request.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#consistent-exports
+func ProcessUnpinViewRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	viewID := r.FormValue("view_id")
+	if viewID == "" {
+		httpserver.Errorf(w, r, "missing view_id arg")
+		return
+	}
+
+	if err := vlstorage.UnpinView(ctx, viewID); err != nil {
+		httpserver.Errorf(w, r, "cannot unpin view with view_id=%q: %s", viewID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
+
+var pinnedViewsCreated = metrics.NewCounter(`vl_select_pinned_views_created_total`)
@@ -0,0 +1,401 @@
+package logsql
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/valyala/quicktemplate"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// queryFormat is the format of rows returned from /select/logsql/query.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#output-formats
+type queryFormat int
+
+const (
+	// queryFormatJSON returns every row as JSON object.
+	queryFormatJSON queryFormat = iota
+
+	// queryFormatNDJSONSchema returns rows as JSON arrays prefixed with schema records.
+	queryFormatNDJSONSchema
+
+	// queryFormatLogfmt returns every row in logfmt format.
+	queryFormatLogfmt
+
+	// queryFormatTemplate returns every row formatted with the template from template query arg.
+	queryFormatTemplate
+)
+
+// parseQueryFormat parses format query arg at r.
+func parseQueryFormat(r *http.Request) (queryFormat, error) {
+	switch format := r.FormValue("format"); format {
+	case "", "json":
+		return queryFormatJSON, nil
+	case "ndjson_schema":
+		return queryFormatNDJSONSchema, nil
+	case "logfmt":
+		return queryFormatLogfmt, nil
+	case "template":
+		return queryFormatTemplate, nil
+	default:
+		return 0, fmt.Errorf("unsupported format=%q; supported values: json, ndjson_schema, logfmt, template", format)
+	}
+}
+
+// maxQueryTemplateLen is the maximum length of the template query arg.
+const maxQueryTemplateLen = 16 * 1024
+
+// parseQueryTemplate parses template query arg at r for the given format.
+//
+// nil is returned if the format isn't queryFormatTemplate.
+func parseQueryTemplate(r *http.Request, format queryFormat) (*template.Template, error) {
+	s := r.FormValue("template")
+	if format != queryFormatTemplate {
+		if s != "" {
+			return nil, fmt.Errorf("template query arg can be used only with format=template")
+		}
+		return nil, nil
+	}
+	if s == "" {
+		return nil, fmt.Errorf("missing template query arg for format=template")
+	}
+	if len(s) > maxQueryTemplateLen {
+		return nil, fmt.Errorf("too long template query arg; got %d bytes; mustn't exceed %d bytes", len(s), maxQueryTemplateLen)
+	}
+
+	// Missing fields are substituted with empty strings in the same way as empty fields are treated in LogsQL.
+	tmpl, err := template.New("template").Option("missingkey=zero").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse template=%q: %w", s, err)
+	}
+
+	// Verify the template on an empty row, so the most of errors are returned to the client before the query execution.
+	if err := tmpl.Execute(io.Discard, map[string]string{}); err != nil {
+		return nil, fmt.Errorf("cannot execute template=%q: %w", s, err)
+	}
+	return tmpl, nil
+}
+
+// contentType returns Content-Type header value for the response in the given format.
+func (qf queryFormat) contentType() string {
+	switch qf {
+	case queryFormatLogfmt, queryFormatTemplate:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/stream+json"
+	}
+}
+
+// logfmtLeadingFields contains fields, which are written first in format=logfmt.
+var logfmtLeadingFields = []string{"_time", "_stream", "_msg"}
+
+// writeLogfmtRows writes rows from columns to bw in format=logfmt.
+//
+// _time, _stream and _msg fields are written first, while the remaining fields are written in the order of columns.
+// Fields with empty values are skipped in the same way as for JSON rows.
+func writeLogfmtRows(bw *bufferedWriter, qfb *queryFormatBuf, columns []logstorage.BlockColumn, rowsCount int) {
+	cs := qfb.columns[:0]
+	for _, name := range logfmtLeadingFields {
+		for _, c := range columns {
+			if c.Name == name {
+				cs = append(cs, c)
+				break
+			}
+		}
+	}
+	for _, c := range columns {
+		if !slices.Contains(logfmtLeadingFields, c.Name) {
+			cs = append(cs, c)
+		}
+	}
+	qfb.columns = cs
+
+	for i := 0; i < rowsCount; i++ {
+		fields := qfb.fields[:0]
+		for _, c := range cs {
+			if v := c.Values[i]; v != "" {
+				fields = append(fields, logstorage.Field{
+					Name:  c.Name,
+					Value: v,
+				})
+			}
+		}
+		qfb.fields = fields
+		if len(fields) == 0 {
+			continue
+		}
+
+		bw.buf = logstorage.MarshalFieldsToLogfmt(bw.buf, fields)
+		bw.buf = append(bw.buf, '\n')
+		if len(bw.buf) > 16*1024 {
+			bw.FlushIgnoreErrors()
+		}
+	}
+}
+
+var templateErrorsLogger = logger.WithThrottler("query_template_errors", 5*time.Second)
+
+// writeTemplateRows writes rows from columns to bw in format=template.
+//
+// Every row is passed to tmpl as a map from field names to field values. A newline is written after every row.
+// Rows, which cannot be formatted with tmpl, are skipped.
+func writeTemplateRows(bw *bufferedWriter, qfb *queryFormatBuf, tmpl *template.Template, columns []logstorage.BlockColumn, rowsCount int) {
+	if qfb.row == nil {
+		qfb.row = make(map[string]string)
+	}
+	row := qfb.row
+
+	for i := 0; i < rowsCount; i++ {
+		clear(row)
+		for _, c := range columns {
+			if v := c.Values[i]; v != "" {
+				row[c.Name] = v
+			}
+		}
+
+		bufLen := len(bw.buf)
+		if err := tmpl.Execute(bw, row); err != nil {
+			bw.buf = bw.buf[:bufLen]
+			templateErrorsLogger.Warnf("cannot format row with template=%q: %s", tmpl.Root.String(), err)
+			continue
+		}
+		bw.buf = append(bw.buf, '\n')
+		if len(bw.buf) > 16*1024 {
+			bw.FlushIgnoreErrors()
+		}
+	}
+}
+
+// columnType is the type of column values detected for format=ndjson_schema.
+type columnType int
+
+const (
+	columnTypeString columnType = iota
+	columnTypeBool
+	columnTypeInt64
+	columnTypeFloat64
+	columnTypeTimestamp
+)
+
+func (ct columnType) String() string {
+	switch ct {
+	case columnTypeBool:
+		return "bool"
+	case columnTypeInt64:
+		return "int64"
+	case columnTypeFloat64:
+		return "float64"
+	case columnTypeTimestamp:
+		return "timestamp"
+	default:
+		return "string"
+	}
+}
+
+// queryFormatBuf holds buffers for writing rows in the formats other than json.
+type queryFormatBuf struct {
+	columns []logstorage.BlockColumn
+	types   []columnType
+	schema  []byte
+	fields  []logstorage.Field
+	row     map[string]string
+}
+
+// writeSchemaRows writes rows from columns to bw in format=ndjson_schema.
+//
+// The schema record is written before the rows if it differs from the previously written schema record.
+// Columns with empty values across all the rows are skipped in the same way as empty fields are skipped in JSON rows.
+func writeSchemaRows(bw *bufferedWriter, qfb *queryFormatBuf, columns []logstorage.BlockColumn, rowsCount int) {
+	cs := qfb.columns[:0]
+	for _, c := range columns {
+		if !isEmptyColumn(c.Values) {
+			cs = append(cs, c)
+		}
+	}
+	qfb.columns = cs
+	columns = cs
+	if len(columns) == 0 {
+		return
+	}
+
+	types := qfb.types[:0]
+	for _, c := range columns {
+		types = append(types, detectColumnType(c.Values))
+	}
+	qfb.types = types
+
+	qfb.schema = appendSchemaRecord(qfb.schema[:0], columns, types)
+	bw.setSchema(qfb.schema)
+
+	for i := 0; i < rowsCount; i++ {
+		bw.buf = appendSchemaRow(bw.buf, columns, types, i)
+		if len(bw.buf) > 16*1024 {
+			bw.FlushIgnoreErrors()
+		}
+	}
+}
+
+func isEmptyColumn(values []string) bool {
+	for _, v := range values {
+		if v != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// appendSchemaRecord appends schema record for the given columns with the given types to dst and returns the result.
+//
+// The schema record has the following format: {"schema":[{"name":"...","type":"..."},...]}
+func appendSchemaRecord(dst []byte, columns []logstorage.BlockColumn, types []columnType) []byte {
+	dst = append(dst, `{"schema":[`...)
+	for i, c := range columns {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, `{"name":`...)
+		dst = quicktemplate.AppendJSONString(dst, c.Name, true)
+		dst = append(dst, `,"type":"`...)
+		dst = append(dst, types[i].String()...)
+		dst = append(dst, `"}`...)
+	}
+	dst = append(dst, "]}\n"...)
+	return dst
+}
+
+// appendSchemaRow appends the row at rowIdx in columns as JSON array to dst and returns the result.
+//
+// Empty values are written as null. Values of bool, int64 and float64 types are written as is, since they are valid JSON booleans and numbers.
+func appendSchemaRow(dst []byte, columns []logstorage.BlockColumn, types []columnType, rowIdx int) []byte {
+	dst = append(dst, '[')
+	for i, c := range columns {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		v := c.Values[rowIdx]
+		if v == "" {
+			dst = append(dst, "null"...)
+			continue
+		}
+		switch types[i] {
+		case columnTypeBool, columnTypeInt64, columnTypeFloat64:
+			dst = append(dst, v...)
+		default:
+			dst = quicktemplate.AppendJSONString(dst, v, true)
+		}
+	}
+	dst = append(dst, "]\n"...)
+	return dst
+}
+
+// detectColumnType returns the narrowest type, which fits all the non-empty values.
+//
+// columnTypeString is returned if all the values are empty.
+func detectColumnType(values []string) columnType {
+	const (
+		maskBool = 1 << iota
+		maskInt64
+		maskFloat64
+		maskTimestamp
+	)
+
+	mask := maskBool | maskInt64 | maskFloat64 | maskTimestamp
+	hasValues := false
+	for i, v := range values {
+		if v == "" || (i > 0 && v == values[i-1]) {
+			continue
+		}
+		hasValues = true
+		if mask&maskBool != 0 && v != "true" && v != "false" {
+			mask &^= maskBool
+		}
+		if mask&(maskInt64|maskFloat64) != 0 && !isJSONNumber(v) {
+			mask &^= maskInt64 | maskFloat64
+		}
+		if mask&maskInt64 != 0 {
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				mask &^= maskInt64
+			}
+		}
+		if mask&maskFloat64 != 0 {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				mask &^= maskFloat64
+			}
+		}
+		if mask&maskTimestamp != 0 {
+			if _, ok := logstorage.TryParseTimestampRFC3339Nano(v); !ok {
+				mask &^= maskTimestamp
+			}
+		}
+		if mask == 0 {
+			return columnTypeString
+		}
+	}
+
+	switch {
+	case !hasValues:
+		return columnTypeString
+	case mask&maskBool != 0:
+		return columnTypeBool
+	case mask&maskInt64 != 0:
+		return columnTypeInt64
+	case mask&maskFloat64 != 0:
+		return columnTypeFloat64
+	case mask&maskTimestamp != 0:
+		return columnTypeTimestamp
+	default:
+		return columnTypeString
+	}
+}
+
+// isJSONNumber returns true if s is a valid JSON number.
+//
+// Such values can be written as JSON numbers without changing their original representation.
+// Numbers with leading zeros, plus sign, hex numbers and special values such as Inf and NaN aren't valid JSON numbers.
+func isJSONNumber(s string) bool {
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	}
+	n := countDigits(s)
+	if n == 0 || (n > 1 && s[0] == '0') {
+		return false
+	}
+	s = s[n:]
+	if strings.HasPrefix(s, ".") {
+		s = s[1:]
+		n := countDigits(s)
+		if n == 0 {
+			return false
+		}
+		s = s[n:]
+	}
+	if strings.HasPrefix(s, "e") || strings.HasPrefix(s, "E") {
+		s = s[1:]
+		if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+			s = s[1:]
+		}
+		n := countDigits(s)
+		if n == 0 {
+			return false
+		}
+		s = s[n:]
+	}
+	return s == ""
+}
+
+func countDigits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
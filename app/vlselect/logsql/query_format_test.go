@@ -0,0 +1,421 @@
+package logsql
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParseQueryFormat(t *testing.T) {
+	f := func(args string, formatExpected queryFormat) {
+		t.Helper()
+
+		r := httptest.NewRequest("GET", "/select/logsql/query?"+args, nil)
+		format, err := parseQueryFormat(r)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", args, err)
+		}
+		if format != formatExpected {
+			t.Fatalf("unexpected format for %q; got %d; want %d", args, format, formatExpected)
+		}
+	}
+
+	f("", queryFormatJSON)
+	f("format=json", queryFormatJSON)
+	f("format=ndjson_schema", queryFormatNDJSONSchema)
+	f("format=logfmt", queryFormatLogfmt)
+	f("format=template", queryFormatTemplate)
+
+	r := httptest.NewRequest("GET", "/select/logsql/query?format=foo", nil)
+	if _, err := parseQueryFormat(r); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported format")
+	}
+}
+
+func TestDetectColumnType(t *testing.T) {
+	f := func(values []string, typeExpected columnType) {
+		t.Helper()
+
+		if ct := detectColumnType(values); ct != typeExpected {
+			t.Fatalf("unexpected type for %q; got %s; want %s", values, ct, typeExpected)
+		}
+	}
+
+	f(nil, columnTypeString)
+	f([]string{"", ""}, columnTypeString)
+	f([]string{"foo", "123"}, columnTypeString)
+	f([]string{"true", "", "false", "false"}, columnTypeBool)
+	f([]string{"true", "1"}, columnTypeString)
+	f([]string{"123", "-45", "", "0"}, columnTypeInt64)
+	f([]string{"123", "-4.5", "1e10", "0.5E-3"}, columnTypeFloat64)
+	f([]string{"99999999999999999999"}, columnTypeFloat64)
+
+	// values, which cannot be represented as JSON numbers without changing them
+	f([]string{"007"}, columnTypeString)
+	f([]string{"+5"}, columnTypeString)
+	f([]string{"1."}, columnTypeString)
+	f([]string{".5"}, columnTypeString)
+	f([]string{"-"}, columnTypeString)
+	f([]string{"1e"}, columnTypeString)
+	f([]string{"1", "Inf"}, columnTypeString)
+	f([]string{"NaN"}, columnTypeString)
+	f([]string{"0x10"}, columnTypeString)
+	f([]string{"1_000"}, columnTypeString)
+	f([]string{"1e400"}, columnTypeString)
+
+	f([]string{"2025-01-02T03:04:05Z", "2025-01-02T03:04:05.123+02:00"}, columnTypeTimestamp)
+	f([]string{"2025-01-02T03:04:05Z", "2025-01-02"}, columnTypeString)
+}
+
+func TestWriteSchemaRows(t *testing.T) {
+	f := func(blocks [][]logstorage.BlockColumn, resultExpected string) {
+		t.Helper()
+
+		var out bytes.Buffer
+		sw := &syncWriter{
+			w: &out,
+		}
+		bw := &bufferedWriter{
+			sw: sw,
+		}
+		var qfb queryFormatBuf
+		for _, columns := range blocks {
+			rowsCount := 0
+			if len(columns) > 0 {
+				rowsCount = len(columns[0].Values)
+			}
+			writeSchemaRows(bw, &qfb, columns, rowsCount)
+		}
+		bw.FlushIgnoreErrors()
+
+		if result := out.String(); result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// empty blocks
+	f(nil, "")
+	f([][]logstorage.BlockColumn{
+		{
+			{
+				Name:   "foo",
+				Values: []string{"", ""},
+			},
+		},
+	}, "")
+
+	// single block
+	f([][]logstorage.BlockColumn{
+		{
+			{
+				Name:   "_time",
+				Values: []string{"2025-01-02T03:04:05Z", "2025-01-02T03:04:06Z"},
+			},
+			{
+				Name:   "_msg",
+				Values: []string{`foo "bar"`, ""},
+			},
+			{
+				Name:   "empty",
+				Values: []string{"", ""},
+			},
+			{
+				Name:   "n",
+				Values: []string{"12", "-3"},
+			},
+			{
+				Name:   "f",
+				Values: []string{"1.50", ""},
+			},
+			{
+				Name:   "ok",
+				Values: []string{"true", "false"},
+			},
+		},
+	}, `{"schema":[{"name":"_time","type":"timestamp"},{"name":"_msg","type":"string"},{"name":"n","type":"int64"},{"name":"f","type":"float64"},{"name":"ok","type":"bool"}]}
+["2025-01-02T03:04:05Z","foo \"bar\"",12,1.50,true]
+["2025-01-02T03:04:06Z",null,-3,null,false]
+`)
+
+	// multiple blocks with the same schema
+	f([][]logstorage.BlockColumn{
+		{
+			{
+				Name:   "_msg",
+				Values: []string{"foo"},
+			},
+			{
+				Name:   "n",
+				Values: []string{"1"},
+			},
+		},
+		{
+			{
+				Name:   "_msg",
+				Values: []string{"bar"},
+			},
+			{
+				Name:   "n",
+				Values: []string{"2"},
+			},
+		},
+	}, `{"schema":[{"name":"_msg","type":"string"},{"name":"n","type":"int64"}]}
+["foo",1]
+["bar",2]
+`)
+
+	// multiple blocks with distinct schemas
+	f([][]logstorage.BlockColumn{
+		{
+			{
+				Name:   "_msg",
+				Values: []string{"foo"},
+			},
+			{
+				Name:   "n",
+				Values: []string{"1"},
+			},
+		},
+		{
+			{
+				Name:   "_msg",
+				Values: []string{"bar"},
+			},
+			{
+				Name:   "n",
+				Values: []string{"abc"},
+			},
+		},
+		{
+			{
+				Name:   "_msg",
+				Values: []string{"baz"},
+			},
+			{
+				Name:   "n",
+				Values: []string{"xyz"},
+			},
+		},
+	}, `{"schema":[{"name":"_msg","type":"string"},{"name":"n","type":"int64"}]}
+["foo",1]
+{"schema":[{"name":"_msg","type":"string"},{"name":"n","type":"string"}]}
+["bar","abc"]
+["baz","xyz"]
+`)
+}
+
+func TestSyncWriterWriteWithSchema(t *testing.T) {
+	var out bytes.Buffer
+	sw := &syncWriter{
+		w: &out,
+	}
+
+	// Rows from distinct workers with the same schema must share a single schema record.
+	bw1 := &bufferedWriter{
+		sw: sw,
+	}
+	bw2 := &bufferedWriter{
+		sw: sw,
+	}
+	bw1.setSchema([]byte("schema1\n"))
+	bw1.buf = append(bw1.buf, "row1\n"...)
+	bw2.setSchema([]byte("schema1\n"))
+	bw2.buf = append(bw2.buf, "row2\n"...)
+	bw1.FlushIgnoreErrors()
+	bw2.FlushIgnoreErrors()
+
+	// The schema change must flush the pending rows with the previous schema.
+	bw1.buf = append(bw1.buf, "row3\n"...)
+	bw1.setSchema([]byte("schema2\n"))
+	bw1.buf = append(bw1.buf, "row4\n"...)
+	bw2.buf = append(bw2.buf, "row5\n"...)
+	bw1.FlushIgnoreErrors()
+	bw2.FlushIgnoreErrors()
+
+	resultExpected := "schema1\nrow1\nrow2\nrow3\nschema2\nrow4\nschema1\nrow5\n"
+	if result := out.String(); result != resultExpected {
+		t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+}
+
+func TestWriteLogfmtRows(t *testing.T) {
+	f := func(columns []logstorage.BlockColumn, resultExpected string) {
+		t.Helper()
+
+		var out bytes.Buffer
+		bw := &bufferedWriter{
+			sw: &syncWriter{
+				w: &out,
+			},
+		}
+		var qfb queryFormatBuf
+		rowsCount := 0
+		if len(columns) > 0 {
+			rowsCount = len(columns[0].Values)
+		}
+		writeLogfmtRows(bw, &qfb, columns, rowsCount)
+		bw.FlushIgnoreErrors()
+
+		if result := out.String(); result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(nil, "")
+
+	// _time, _stream and _msg fields are written first
+	f([]logstorage.BlockColumn{
+		{
+			Name:   "level",
+			Values: []string{"info", "", ""},
+		},
+		{
+			Name:   "_msg",
+			Values: []string{"foo bar", "baz", ""},
+		},
+		{
+			Name:   "_stream_id",
+			Values: []string{"id1", "id1", ""},
+		},
+		{
+			Name:   "_stream",
+			Values: []string{`{app="a"}`, `{app="a"}`, ""},
+		},
+		{
+			Name:   "_time",
+			Values: []string{"2025-01-02T03:04:05Z", "2025-01-02T03:04:06Z", ""},
+		},
+		{
+			Name:   "path",
+			Values: []string{"/foo", `C:\bar`, ""},
+		},
+	}, `_time=2025-01-02T03:04:05Z _stream="{app=\"a\"}" _msg="foo bar" level=info _stream_id=id1 path=/foo
+_time=2025-01-02T03:04:06Z _stream="{app=\"a\"}" _msg=baz _stream_id=id1 path="C:\\bar"
+`)
+
+	// missing leading fields
+	f([]logstorage.BlockColumn{
+		{
+			Name:   "x",
+			Values: []string{"1"},
+		},
+		{
+			Name:   "_msg",
+			Values: []string{"foo"},
+		},
+	}, `_msg=foo x=1
+`)
+}
+
+func TestParseQueryTemplateFailure(t *testing.T) {
+	f := func(args string) {
+		t.Helper()
+
+		q, err := url.ParseQuery(args)
+		if err != nil {
+			t.Fatalf("cannot parse args: %s", err)
+		}
+		r := httptest.NewRequest("GET", "/select/logsql/query?"+q.Encode(), nil)
+		format, err := parseQueryFormat(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := parseQueryTemplate(r, format); err == nil {
+			t.Fatalf("expecting non-nil error for %q", args)
+		}
+	}
+
+	// missing template
+	f("format=template")
+
+	// template without format=template
+	f("template={{._msg}}")
+	f("format=logfmt&template={{._msg}}")
+
+	// invalid template
+	f("format=template&template={{._msg")
+	f("format=template&template={{foo}}")
+
+	// template, which cannot be executed
+	f("format=template&template={{index ._msg 1 2}}")
+
+	// too long template
+	f("format=template&template=" + strings.Repeat("x", maxQueryTemplateLen+1))
+}
+
+func TestWriteTemplateRows(t *testing.T) {
+	f := func(template string, columns []logstorage.BlockColumn, resultExpected string) {
+		t.Helper()
+
+		q := url.Values{
+			"format":   {"template"},
+			"template": {template},
+		}
+		r := httptest.NewRequest("GET", "/select/logsql/query?"+q.Encode(), nil)
+		tmpl, err := parseQueryTemplate(r, queryFormatTemplate)
+		if err != nil {
+			t.Fatalf("cannot parse template: %s", err)
+		}
+
+		var out bytes.Buffer
+		bw := &bufferedWriter{
+			sw: &syncWriter{
+				w: &out,
+			},
+		}
+		var qfb queryFormatBuf
+		rowsCount := 0
+		if len(columns) > 0 {
+			rowsCount = len(columns[0].Values)
+		}
+		writeTemplateRows(bw, &qfb, tmpl, columns, rowsCount)
+		bw.FlushIgnoreErrors()
+
+		if result := out.String(); result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	columns := []logstorage.BlockColumn{
+		{
+			Name:   "_time",
+			Values: []string{"2025-01-02T03:04:05Z", "2025-01-02T03:04:06Z"},
+		},
+		{
+			Name:   "client.ip",
+			Values: []string{"1.2.3.4", "5.6.7.8"},
+		},
+		{
+			Name:   "method",
+			Values: []string{"GET", "POST"},
+		},
+		{
+			Name:   "path",
+			Values: []string{"/foo", "/bar"},
+		},
+		{
+			Name:   "status",
+			Values: []string{"200", ""},
+		},
+	}
+
+	f(`{{._time}} {{.method}}`, nil, "")
+
+	// Apache-like lines
+	f(`{{index . "client.ip"}} - - [{{._time}}] "{{.method}} {{.path}}" {{.status}}`, columns, `1.2.3.4 - - [2025-01-02T03:04:05Z] "GET /foo" 200
+5.6.7.8 - - [2025-01-02T03:04:06Z] "POST /bar" 
+`)
+
+	// missing fields and conditions
+	f(`{{.method}}{{if .status}} status={{.status}}{{end}} missing={{.missing}}`, columns, `GET status=200 missing=
+POST missing=
+`)
+
+	// rows, which cannot be formatted, are skipped
+	f(`{{.method}} {{len (index . "status")}}{{if eq .method "POST"}}{{index .path 10}}{{end}}`, columns, `GET 3
+`)
+}
@@ -0,0 +1,140 @@
+package logsql
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// queryOutputOptions contains options for the rows returned from /select/logsql/query.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#output-options
+type queryOutputOptions struct {
+	// sortFields instructs returning fields sorted by name instead of the order returned by the query.
+	sortFields bool
+
+	// timeUnixNano instructs returning _time values as unix timestamps in nanoseconds.
+	timeUnixNano bool
+
+	// timeLoc is the location for RFC3339 _time values. UTC is used if it is nil.
+	timeLoc *time.Location
+
+	// skipStreamFields instructs dropping _stream and _stream_id fields from the returned rows.
+	skipStreamFields bool
+}
+
+// parseQueryOutputOptions parses output options from fields_order, time_format, time_tz and stream_fields query args at r.
+func parseQueryOutputOptions(r *http.Request) (*queryOutputOptions, error) {
+	var opts queryOutputOptions
+
+	switch fieldsOrder := r.FormValue("fields_order"); fieldsOrder {
+	case "", "query":
+	case "alpha":
+		opts.sortFields = true
+	default:
+		return nil, fmt.Errorf("unsupported fields_order=%q; supported values: query, alpha", fieldsOrder)
+	}
+
+	switch timeFormat := r.FormValue("time_format"); timeFormat {
+	case "", "rfc3339":
+	case "unix_nano":
+		opts.timeUnixNano = true
+	default:
+		return nil, fmt.Errorf("unsupported time_format=%q; supported values: rfc3339, unix_nano", timeFormat)
+	}
+
+	if tz := r.FormValue("time_tz"); tz != "" {
+		if opts.timeUnixNano {
+			return nil, fmt.Errorf("time_tz=%q cannot be used together with time_format=unix_nano", tz)
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse time_tz=%q: %w", tz, err)
+		}
+		if loc != time.UTC {
+			opts.timeLoc = loc
+		}
+	}
+
+	streamFields := true
+	if err := getBoolFromRequest(&streamFields, r, "stream_fields"); err != nil {
+		return nil, err
+	}
+	opts.skipStreamFields = !streamFields
+
+	return &opts, nil
+}
+
+// isDefault returns true if opts doesn't change the returned rows.
+func (opts *queryOutputOptions) isDefault() bool {
+	return !opts.sortFields && !opts.timeUnixNano && opts.timeLoc == nil && !opts.skipStreamFields
+}
+
+// queryOutputBuf holds buffers for queryOutputOptions.transformColumns.
+type queryOutputBuf struct {
+	columns []logstorage.BlockColumn
+	values  []string
+	buf     []byte
+	ends    []int
+}
+
+// transformColumns returns columns transformed according to opts.
+//
+// The returned columns are valid until the next call to transformColumns with the same qob.
+func (opts *queryOutputOptions) transformColumns(qob *queryOutputBuf, columns []logstorage.BlockColumn) []logstorage.BlockColumn {
+	dst := qob.columns[:0]
+	for _, c := range columns {
+		if opts.skipStreamFields && (c.Name == "_stream" || c.Name == "_stream_id") {
+			continue
+		}
+		if c.Name == "_time" && (opts.timeUnixNano || opts.timeLoc != nil) {
+			c.Values = opts.formatTimes(qob, c.Values)
+		}
+		dst = append(dst, c)
+	}
+	if opts.sortFields {
+		sort.SliceStable(dst, func(i, j int) bool {
+			return dst[i].Name < dst[j].Name
+		})
+	}
+	qob.columns = dst
+	return dst
+}
+
+// formatTimes returns values formatted according to opts.
+//
+// Values, which cannot be parsed as RFC3339 timestamps, are returned as is.
+func (opts *queryOutputOptions) formatTimes(qob *queryOutputBuf, values []string) []string {
+	buf := qob.buf[:0]
+	ends := qob.ends[:0]
+	for _, v := range values {
+		ts, ok := logstorage.TryParseTimestampRFC3339Nano(v)
+		switch {
+		case !ok:
+			buf = append(buf, v...)
+		case opts.timeUnixNano:
+			buf = strconv.AppendInt(buf, ts, 10)
+		default:
+			buf = time.Unix(0, ts).In(opts.timeLoc).AppendFormat(buf, time.RFC3339Nano)
+		}
+		ends = append(ends, len(buf))
+	}
+	qob.buf = buf
+	qob.ends = ends
+
+	// Construct the values after buf is fully filled, since buf may be re-allocated above.
+	result := qob.values[:0]
+	start := 0
+	for _, end := range ends {
+		result = append(result, bytesutil.ToUnsafeString(buf[start:end]))
+		start = end
+	}
+	qob.values = result
+	return result
+}
@@ -0,0 +1,105 @@
+package logsql
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParseQueryOutputOptionsFailure(t *testing.T) {
+	f := func(args string) {
+		t.Helper()
+
+		r := httptest.NewRequest("GET", "/select/logsql/query?"+args, nil)
+		if _, err := parseQueryOutputOptions(r); err == nil {
+			t.Fatalf("expecting non-nil error for %q", args)
+		}
+	}
+
+	f("fields_order=foo")
+	f("time_format=unix")
+	f("time_tz=Foo/Bar")
+	f("time_format=unix_nano&time_tz=Europe/Berlin")
+	f("stream_fields=foo")
+}
+
+func TestQueryOutputOptionsTransformColumns(t *testing.T) {
+	columns := []logstorage.BlockColumn{
+		{
+			Name:   "_time",
+			Values: []string{"2025-01-02T03:04:05.123456789Z", "2025-01-02T03:04:06Z", "foo"},
+		},
+		{
+			Name:   "_stream_id",
+			Values: []string{"id1", "id1", "id2"},
+		},
+		{
+			Name:   "_stream",
+			Values: []string{`{app="a"}`, `{app="a"}`, `{app="b"}`},
+		},
+		{
+			Name:   "level",
+			Values: []string{"info", "", "error"},
+		},
+		{
+			Name:   "_msg",
+			Values: []string{"foo", "bar", "baz"},
+		},
+	}
+
+	f := func(args string, isDefaultExpected bool, resultExpected []logstorage.BlockColumn) {
+		t.Helper()
+
+		q, err := url.ParseQuery(args)
+		if err != nil {
+			t.Fatalf("cannot parse args: %s", err)
+		}
+		r := httptest.NewRequest("GET", "/select/logsql/query?"+q.Encode(), nil)
+		opts, err := parseQueryOutputOptions(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if isDefault := opts.isDefault(); isDefault != isDefaultExpected {
+			t.Fatalf("unexpected isDefault(); got %v; want %v", isDefault, isDefaultExpected)
+		}
+
+		var qob queryOutputBuf
+		result := opts.transformColumns(&qob, columns)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	// default options
+	f("", true, columns)
+	f("fields_order=query&time_format=rfc3339&time_tz=UTC&stream_fields=1", true, columns)
+
+	// sort fields by name
+	f("fields_order=alpha", false, []logstorage.BlockColumn{columns[4], columns[2], columns[1], columns[0], columns[3]})
+
+	// drop stream fields
+	f("stream_fields=0", false, []logstorage.BlockColumn{columns[0], columns[3], columns[4]})
+
+	// unix timestamps in nanoseconds
+	f("time_format=unix_nano&stream_fields=false", false, []logstorage.BlockColumn{
+		{
+			Name:   "_time",
+			Values: []string{"1735787045123456789", "1735787046000000000", "foo"},
+		},
+		columns[3],
+		columns[4],
+	})
+
+	// RFC3339 timestamps in the given timezone
+	f("time_tz=Asia/Kolkata&fields_order=alpha&stream_fields=false", false, []logstorage.BlockColumn{
+		columns[4],
+		{
+			Name:   "_time",
+			Values: []string{"2025-01-02T08:34:05.123456789+05:30", "2025-01-02T08:34:06+05:30", "foo"},
+		},
+		columns[3],
+	})
+}
@@ -0,0 +1,253 @@
+package logsql
+
+import (
+	"encoding/binary"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/easyproto"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// responseEncoding is the encoding for responses negotiated via Accept request header.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#response-encoding
+type responseEncoding int
+
+const (
+	responseEncodingJSON responseEncoding = iota
+	responseEncodingProtobuf
+	responseEncodingMsgpack
+)
+
+// getResponseEncoding returns the response encoding for r according to its Accept header.
+//
+// The first supported media type from the Accept header is used. JSON is used if the Accept header doesn't contain supported media types.
+func getResponseEncoding(r *http.Request) responseEncoding {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, s := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(s))
+			if err != nil {
+				continue
+			}
+			switch mediaType {
+			case "application/json", "application/stream+json", "application/x-ndjson":
+				return responseEncodingJSON
+			case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf":
+				return responseEncodingProtobuf
+			case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+				return responseEncodingMsgpack
+			}
+		}
+	}
+	return responseEncodingJSON
+}
+
+// contentType returns Content-Type header value for the given re.
+//
+// jsonContentType is returned for JSON encoding.
+func (re responseEncoding) contentType(jsonContentType string) string {
+	switch re {
+	case responseEncodingProtobuf:
+		return "application/x-protobuf"
+	case responseEncodingMsgpack:
+		return "application/msgpack"
+	default:
+		return jsonContentType
+	}
+}
+
+var responseMarshalerPool easyproto.MarshalerPool
+
+// appendProtobufLogRow appends the row at rowIdx in columns to dst as length-delimited protobuf LogRow message.
+//
+//	message Field {
+//	  string name = 1;
+//	  string value = 2;
+//	}
+//
+//	message LogRow {
+//	  repeated Field fields = 1;
+//	}
+//
+// Fields with empty values are skipped in the same way as for JSON responses.
+func appendProtobufLogRow(dst []byte, columns []logstorage.BlockColumn, rowIdx int) []byte {
+	m := responseMarshalerPool.Get()
+	mm := m.MessageMarshaler()
+	for i := range columns {
+		c := &columns[i]
+		v := c.Values[rowIdx]
+		if v == "" {
+			continue
+		}
+		appendProtobufField(mm, 1, c.Name, v)
+	}
+	dst = m.MarshalWithLen(dst)
+	responseMarshalerPool.Put(m)
+	return dst
+}
+
+// marshalProtobufStatsSeries marshals ss to protobuf StatsResponse message.
+//
+//	message Sample {
+//	  int64 timestamp = 1;
+//	  string value = 2;
+//	}
+//
+//	message Series {
+//	  string name = 1;
+//	  repeated Field labels = 2;
+//	  repeated Sample samples = 3;
+//	}
+//
+//	message StatsResponse {
+//	  repeated Series series = 1;
+//	}
+//
+// The timestamp is a Unix timestamp in nanoseconds.
+func marshalProtobufStatsSeries(dst []byte, ss []*statsSeries) []byte {
+	m := responseMarshalerPool.Get()
+	mm := m.MessageMarshaler()
+	for _, s := range ss {
+		mmSeries := mm.AppendMessage(1)
+		mmSeries.AppendString(1, s.Name)
+		for _, label := range s.Labels {
+			appendProtobufField(mmSeries, 2, label.Name, label.Value)
+		}
+		for _, p := range s.Points {
+			mmSample := mmSeries.AppendMessage(3)
+			mmSample.AppendInt64(1, p.Timestamp)
+			mmSample.AppendString(2, p.Value)
+		}
+	}
+	dst = m.Marshal(dst)
+	responseMarshalerPool.Put(m)
+	return dst
+}
+
+func appendProtobufField(mm *easyproto.MessageMarshaler, fieldNum uint32, name, value string) {
+	mmField := mm.AppendMessage(fieldNum)
+	mmField.AppendString(1, name)
+	mmField.AppendString(2, value)
+}
+
+// appendMsgpackLogRow appends the row at rowIdx in columns to dst as msgpack map with string keys and string values.
+//
+// Fields with empty values are skipped in the same way as for JSON responses.
+func appendMsgpackLogRow(dst []byte, columns []logstorage.BlockColumn, rowIdx int) []byte {
+	n := 0
+	for i := range columns {
+		if columns[i].Values[rowIdx] != "" {
+			n++
+		}
+	}
+	dst = appendMsgpackMapHeader(dst, n)
+	for i := range columns {
+		c := &columns[i]
+		v := c.Values[rowIdx]
+		if v == "" {
+			continue
+		}
+		dst = appendMsgpackString(dst, c.Name)
+		dst = appendMsgpackString(dst, v)
+	}
+	return dst
+}
+
+// marshalMsgpackStatsSeries marshals ss to msgpack map in the following form:
+//
+//	{"series":[{"name":"...","labels":{"...":"..."},"samples":[[timestamp,"value"],...]},...]}
+//
+// The timestamp is a Unix timestamp in nanoseconds.
+func marshalMsgpackStatsSeries(dst []byte, ss []*statsSeries) []byte {
+	dst = appendMsgpackMapHeader(dst, 1)
+	dst = appendMsgpackString(dst, "series")
+	dst = appendMsgpackArrayHeader(dst, len(ss))
+	for _, s := range ss {
+		dst = appendMsgpackMapHeader(dst, 3)
+		dst = appendMsgpackString(dst, "name")
+		dst = appendMsgpackString(dst, s.Name)
+		dst = appendMsgpackString(dst, "labels")
+		dst = appendMsgpackMapHeader(dst, len(s.Labels))
+		for _, label := range s.Labels {
+			dst = appendMsgpackString(dst, label.Name)
+			dst = appendMsgpackString(dst, label.Value)
+		}
+		dst = appendMsgpackString(dst, "samples")
+		dst = appendMsgpackArrayHeader(dst, len(s.Points))
+		for _, p := range s.Points {
+			dst = appendMsgpackArrayHeader(dst, 2)
+			dst = appendMsgpackInt64(dst, p.Timestamp)
+			dst = appendMsgpackString(dst, p.Value)
+		}
+	}
+	return dst
+}
+
+// statsRowsToSeries converts rows returned from /select/logsql/stats_query to series with a single sample.
+func statsRowsToSeries(rows []statsRow) []*statsSeries {
+	ss := make([]*statsSeries, len(rows))
+	for i := range rows {
+		r := &rows[i]
+		ss[i] = &statsSeries{
+			Name:   r.Name,
+			Labels: r.Labels,
+			Points: []statsPoint{{
+				Timestamp: r.Timestamp,
+				Value:     r.Value,
+			}},
+		}
+	}
+	return ss
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = append(dst, 0xda)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(n))
+	default:
+		dst = append(dst, 0xdb)
+		dst = binary.BigEndian.AppendUint32(dst, uint32(n))
+	}
+	return append(dst, s...)
+}
+
+func appendMsgpackMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		dst = append(dst, 0xde)
+		return binary.BigEndian.AppendUint16(dst, uint16(n))
+	default:
+		dst = append(dst, 0xdf)
+		return binary.BigEndian.AppendUint32(dst, uint32(n))
+	}
+}
+
+func appendMsgpackArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		dst = append(dst, 0xdc)
+		return binary.BigEndian.AppendUint16(dst, uint16(n))
+	default:
+		dst = append(dst, 0xdd)
+		return binary.BigEndian.AppendUint32(dst, uint32(n))
+	}
+}
+
+func appendMsgpackInt64(dst []byte, n int64) []byte {
+	dst = append(dst, 0xd3)
+	return binary.BigEndian.AppendUint64(dst, uint64(n))
+}
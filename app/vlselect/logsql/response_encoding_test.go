@@ -0,0 +1,293 @@
+package logsql
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/easyproto"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestGetResponseEncoding(t *testing.T) {
+	f := func(accept string, reExpected responseEncoding) {
+		t.Helper()
+
+		r := httptest.NewRequest("GET", "/select/logsql/query", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		re := getResponseEncoding(r)
+		if re != reExpected {
+			t.Fatalf("unexpected response encoding for Accept=%q; got %d; want %d", accept, re, reExpected)
+		}
+	}
+
+	f("", responseEncodingJSON)
+	f("*/*", responseEncodingJSON)
+	f("text/html", responseEncodingJSON)
+	f("application/json", responseEncodingJSON)
+	f("application/x-protobuf", responseEncodingProtobuf)
+	f("application/vnd.google.protobuf; proto=LogRow", responseEncodingProtobuf)
+	f("application/msgpack", responseEncodingMsgpack)
+	f("text/html, application/x-msgpack;q=0.9, */*;q=0.1", responseEncodingMsgpack)
+
+	// the first supported media type is used
+	f("application/json, application/x-protobuf", responseEncodingJSON)
+	f("application/x-protobuf, application/json", responseEncodingProtobuf)
+}
+
+func TestAppendProtobufLogRow(t *testing.T) {
+	columns := []logstorage.BlockColumn{
+		{
+			Name:   "_msg",
+			Values: []string{"foo", "bar"},
+		},
+		{
+			Name:   "level",
+			Values: []string{"", "error"},
+		},
+	}
+
+	var data []byte
+	for i := 0; i < 2; i++ {
+		data = appendProtobufLogRow(data, columns, i)
+	}
+
+	var rows [][]logstorage.Field
+	for len(data) > 0 {
+		n, tail := unmarshalVarint(t, data)
+		rows = append(rows, unmarshalProtobufFields(t, tail[:n], 1))
+		data = tail[n:]
+	}
+
+	rowsExpected := [][]logstorage.Field{
+		{
+			{Name: "_msg", Value: "foo"},
+		},
+		{
+			{Name: "_msg", Value: "bar"},
+			{Name: "level", Value: "error"},
+		},
+	}
+	if !reflect.DeepEqual(rows, rowsExpected) {
+		t.Fatalf("unexpected rows\ngot\n%v\nwant\n%v", rows, rowsExpected)
+	}
+}
+
+func TestMarshalProtobufStatsSeries(t *testing.T) {
+	ss := []*statsSeries{
+		{
+			Name: "count(*)",
+			Labels: []logstorage.Field{
+				{Name: "level", Value: "error"},
+			},
+			Points: []statsPoint{
+				{Timestamp: 1e9, Value: "12"},
+				{Timestamp: 2e9, Value: "34"},
+			},
+		},
+	}
+	data := marshalProtobufStatsSeries(nil, ss)
+
+	var fc easyproto.FieldContext
+	var series []*statsSeries
+	for len(data) > 0 {
+		tail, err := fc.NextField(data)
+		if err != nil {
+			t.Fatalf("cannot read field: %s", err)
+		}
+		data = tail
+		if fc.FieldNum != 1 {
+			t.Fatalf("unexpected field number; got %d; want 1", fc.FieldNum)
+		}
+		seriesData, ok := fc.MessageData()
+		if !ok {
+			t.Fatalf("cannot read series")
+		}
+		series = append(series, unmarshalProtobufStatsSeries(t, seriesData))
+	}
+	if !reflect.DeepEqual(series, ss) {
+		t.Fatalf("unexpected series\ngot\n%v\nwant\n%v", series, ss)
+	}
+}
+
+func TestAppendMsgpackLogRow(t *testing.T) {
+	columns := []logstorage.BlockColumn{
+		{
+			Name:   "_msg",
+			Values: []string{"foo"},
+		},
+		{
+			Name:   "level",
+			Values: []string{""},
+		},
+		{
+			Name:   "n",
+			Values: []string{"1"},
+		},
+	}
+	data := appendMsgpackLogRow(nil, columns, 0)
+	dataExpected := []byte("\x82\xa4_msg\xa3foo\xa1n\xa11")
+	if string(data) != string(dataExpected) {
+		t.Fatalf("unexpected msgpack data\ngot\n%q\nwant\n%q", data, dataExpected)
+	}
+}
+
+func TestMarshalMsgpackStatsSeries(t *testing.T) {
+	ss := []*statsSeries{
+		{
+			Name: "hits",
+			Labels: []logstorage.Field{
+				{Name: "a", Value: "b"},
+			},
+			Points: []statsPoint{
+				{Timestamp: 1, Value: "5"},
+			},
+		},
+	}
+	data := marshalMsgpackStatsSeries(nil, ss)
+	dataExpected := []byte("\x81\xa6series\x91\x83\xa4name\xa4hits\xa6labels\x81\xa1a\xa1b\xa7samples\x91\x92\xd3\x00\x00\x00\x00\x00\x00\x00\x01\xa15")
+	if string(data) != string(dataExpected) {
+		t.Fatalf("unexpected msgpack data\ngot\n%q\nwant\n%q", data, dataExpected)
+	}
+}
+
+func TestAppendMsgpackString(t *testing.T) {
+	f := func(n int, prefixExpected string) {
+		t.Helper()
+
+		s := string(make([]byte, n))
+		data := appendMsgpackString(nil, s)
+		if len(data) != len(prefixExpected)+n {
+			t.Fatalf("unexpected data length for string with length %d; got %d; want %d", n, len(data), len(prefixExpected)+n)
+		}
+		if prefix := string(data[:len(prefixExpected)]); prefix != prefixExpected {
+			t.Fatalf("unexpected prefix for string with length %d; got %q; want %q", n, prefix, prefixExpected)
+		}
+	}
+
+	f(0, "\xa0")
+	f(31, "\xbf")
+	f(32, "\xd9\x20")
+	f(255, "\xd9\xff")
+	f(256, "\xda\x01\x00")
+	f(65536, "\xdb\x00\x01\x00\x00")
+}
+
+func unmarshalVarint(t *testing.T, data []byte) (int, []byte) {
+	t.Helper()
+
+	n := uint64(0)
+	for i, b := range data {
+		n |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return int(n), data[i+1:]
+		}
+	}
+	t.Fatalf("cannot unmarshal varint from %q", data)
+	return 0, nil
+}
+
+func unmarshalProtobufFields(t *testing.T, data []byte, fieldNum uint32) []logstorage.Field {
+	t.Helper()
+
+	var fields []logstorage.Field
+	var fc easyproto.FieldContext
+	for len(data) > 0 {
+		tail, err := fc.NextField(data)
+		if err != nil {
+			t.Fatalf("cannot read field: %s", err)
+		}
+		data = tail
+		if fc.FieldNum != fieldNum {
+			continue
+		}
+		fieldData, ok := fc.MessageData()
+		if !ok {
+			t.Fatalf("cannot read field data")
+		}
+		fields = append(fields, unmarshalProtobufField(t, fieldData))
+	}
+	return fields
+}
+
+func unmarshalProtobufField(t *testing.T, data []byte) logstorage.Field {
+	t.Helper()
+
+	var f logstorage.Field
+	var fc easyproto.FieldContext
+	for len(data) > 0 {
+		tail, err := fc.NextField(data)
+		if err != nil {
+			t.Fatalf("cannot read field: %s", err)
+		}
+		data = tail
+		s, ok := fc.String()
+		if !ok {
+			t.Fatalf("cannot read string")
+		}
+		switch fc.FieldNum {
+		case 1:
+			f.Name = s
+		case 2:
+			f.Value = s
+		}
+	}
+	return f
+}
+
+func unmarshalProtobufStatsSeries(t *testing.T, data []byte) *statsSeries {
+	t.Helper()
+
+	ss := &statsSeries{}
+	ss.Labels = unmarshalProtobufFields(t, data, 2)
+
+	var fc easyproto.FieldContext
+	for len(data) > 0 {
+		tail, err := fc.NextField(data)
+		if err != nil {
+			t.Fatalf("cannot read field: %s", err)
+		}
+		data = tail
+		switch fc.FieldNum {
+		case 1:
+			s, ok := fc.String()
+			if !ok {
+				t.Fatalf("cannot read series name")
+			}
+			ss.Name = s
+		case 3:
+			sampleData, ok := fc.MessageData()
+			if !ok {
+				t.Fatalf("cannot read sample")
+			}
+			var p statsPoint
+			var fcSample easyproto.FieldContext
+			for len(sampleData) > 0 {
+				tail, err := fcSample.NextField(sampleData)
+				if err != nil {
+					t.Fatalf("cannot read sample field: %s", err)
+				}
+				sampleData = tail
+				switch fcSample.FieldNum {
+				case 1:
+					ts, ok := fcSample.Int64()
+					if !ok {
+						t.Fatalf("cannot read sample timestamp")
+					}
+					p.Timestamp = ts
+				case 2:
+					v, ok := fcSample.String()
+					if !ok {
+						t.Fatalf("cannot read sample value")
+					}
+					p.Value = v
+				}
+			}
+			ss.Points = append(ss.Points, p)
+		}
+	}
+	return ss
+}
@@ -0,0 +1,82 @@
+package logsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var maxQueryResponseSize = flagutil.NewBytes("search.maxQueryResponseSize", 0, "The maximum size of the response for /select/logsql/query. "+
+	"Responses are buffered in memory until they are complete, so this limit also limits memory usage per query. "+
+	"Queries with bigger responses are rejected with the error suggesting to use /select/logsql/export instead. "+
+	"By default the response size isn't limited. See https://docs.victoriametrics.com/victorialogs/querying/#response-size-limit")
+
+// errResponseTooBig is returned from responseSizeLimiter.Write when the response size exceeds the limit.
+var errResponseTooBig = errors.New("response size limit exceeded")
+
+// responseSizeLimiter buffers the response until it is complete or until its size exceeds maxSize.
+//
+// It isn't safe for concurrent use, so it must be wrapped into syncWriter.
+type responseSizeLimiter struct {
+	maxSize int
+
+	// cancel is called when the response size exceeds maxSize in order to stop the query execution.
+	cancel func()
+
+	buf      []byte
+	exceeded bool
+}
+
+func (rl *responseSizeLimiter) Write(p []byte) (int, error) {
+	if rl.exceeded {
+		return 0, errResponseTooBig
+	}
+	if len(rl.buf)+len(p) > rl.maxSize {
+		rl.exceeded = true
+		rl.buf = nil
+		rl.cancel()
+		return 0, errResponseTooBig
+	}
+	rl.buf = append(rl.buf, p...)
+	return len(p), nil
+}
+
+// writeResponseTooBigError writes the error for the response exceeding -search.maxQueryResponseSize to w.
+//
+// The error contains view_id of the pinned view, so the client could export the same logs via /select/logsql/export.
+// The existing viewID from the request is used if it isn't empty.
+func writeResponseTooBigError(ctx context.Context, w http.ResponseWriter, r *http.Request, viewID string) {
+	responseTooBigErrors.Inc()
+
+	expiresAt := ""
+	if viewID == "" {
+		ttl := min(5*time.Minute, *maxPinnedViewTTL)
+		id, t, err := pinView(ctx, ttl)
+		if err != nil {
+			logger.Warnf("cannot pin the view for exporting the response exceeding -search.maxQueryResponseSize: %s", err)
+		} else {
+			viewID = id
+			expiresAt = t.UTC().Format(time.RFC3339)
+		}
+	}
+
+	remoteAddr := httpserver.GetQuotedRemoteAddr(r)
+	logger.Warnf("rejecting the query from remoteAddr=%s, since its response exceeds -search.maxQueryResponseSize=%d bytes; requestURI: %s",
+		remoteAddr, maxQueryResponseSize.N, httpserver.GetRequestURI(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	errMsg := fmt.Sprintf("the response size exceeds -search.maxQueryResponseSize=%d bytes; use /select/logsql/export with the same args for obtaining the full response "+
+		"or reduce the response size with the limit arg; see https://docs.victoriametrics.com/victorialogs/querying/#response-size-limit", maxQueryResponseSize.N)
+	fmt.Fprintf(w, `{"error":%q,"max_response_size":%d,"export_path":"/select/logsql/export","view_id":%q,"view_expires_at":%q}`,
+		errMsg, maxQueryResponseSize.N, viewID, expiresAt)
+}
+
+var responseTooBigErrors = metrics.NewCounter(`vl_select_response_too_big_errors_total`)
@@ -0,0 +1,59 @@
+package logsql
+
+import (
+	"testing"
+)
+
+func TestResponseSizeLimiter(t *testing.T) {
+	cancelCalls := 0
+	rl := &responseSizeLimiter{
+		maxSize: 10,
+		cancel: func() {
+			cancelCalls++
+		},
+	}
+
+	f := func(s string, okExpected bool) {
+		t.Helper()
+
+		n, err := rl.Write([]byte(s))
+		if okExpected {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if n != len(s) {
+				t.Fatalf("unexpected number of written bytes; got %d; want %d", n, len(s))
+			}
+		} else if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f("foo", true)
+	f("barbaz", true)
+	f("x", true)
+	if string(rl.buf) != "foobarbazx" {
+		t.Fatalf("unexpected buffered response; got %q; want %q", rl.buf, "foobarbazx")
+	}
+	if rl.exceeded || cancelCalls != 0 {
+		t.Fatalf("the limit mustn't be exceeded")
+	}
+
+	// The limit is exceeded
+	f("y", false)
+	if !rl.exceeded {
+		t.Fatalf("the limit must be exceeded")
+	}
+	if len(rl.buf) != 0 {
+		t.Fatalf("the buffered response must be dropped; got %q", rl.buf)
+	}
+	if cancelCalls != 1 {
+		t.Fatalf("unexpected number of cancel calls; got %d; want 1", cancelCalls)
+	}
+
+	// Subsequent writes must fail without canceling the query again
+	f("z", false)
+	if cancelCalls != 1 {
+		t.Fatalf("unexpected number of cancel calls; got %d; want 1", cancelCalls)
+	}
+}
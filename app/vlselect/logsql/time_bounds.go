@@ -0,0 +1,125 @@
+package logsql
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	requireTimeFilter = flag.Bool("search.requireTimeFilter", false, "Whether to reject queries without the lower time bound set via 'start' query arg or via _time filter. "+
+		"Queries without the lower time bound select all the stored logs, so they may be very slow on big volumes of logs. "+
+		"See also -search.defaultQueryTimeRange and https://docs.victoriametrics.com/victorialogs/querying/#query-time-bounds")
+	defaultQueryTimeRange = flagutil.NewExtendedDuration("search.defaultQueryTimeRange", "0", "The time range to query if the query doesn't contain the lower time bound "+
+		"set via 'start' query arg or via _time filter. For example, -search.defaultQueryTimeRange=1h limits such queries to the last hour. "+
+		"By default such queries select all the stored logs. See https://docs.victoriametrics.com/victorialogs/querying/#query-time-bounds")
+	maxLookback = flagutil.NewExtendedDuration("search.maxLookback", "0", "The maximum lookback period for queries. Queries are limited to logs newer than now-maxLookback. "+
+		"By default there is no limit. See also -search.userMaxLookback and https://docs.victoriametrics.com/victorialogs/querying/#query-time-bounds")
+	userMaxLookback = flagutil.NewArrayString("search.userMaxLookback", "Optional per-user limits on the maximum lookback period for queries in the form 'user=duration'. "+
+		"It overrides -search.maxLookback for the given user. Zero duration means no limit. The user is obtained from -search.userHeader request header or from Basic Auth username. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#query-time-bounds")
+
+	userHeader = flag.String("search.userHeader", "", "Optional request header with the user name for -search.maxConcurrentRequestsPerUser, -search.userMaxConcurrentRequests "+
+		"and -search.userMaxLookback. For example, X-Forwarded-User. Basic Auth username is used if the header isn't set. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#per-tenant-and-per-user-concurrency-limits")
+)
+
+// userMaxLookbacks contains per-user lookback limits in nanoseconds from -search.userMaxLookback
+var userMaxLookbacks map[string]int64
+
+func checkTimeBoundsConfig() error {
+	_, err := parseUserMaxLookbacks(*userMaxLookback)
+	return err
+}
+
+func initTimeBounds() {
+	m, err := parseUserMaxLookbacks(*userMaxLookback)
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	userMaxLookbacks = m
+}
+
+// parseUserMaxLookbacks parses per-user lookback limits in the form 'user=duration' from a.
+func parseUserMaxLookbacks(a []string) (map[string]int64, error) {
+	m := make(map[string]int64, len(a))
+	for _, s := range a {
+		n := strings.LastIndexByte(s, '=')
+		if n < 0 {
+			return nil, fmt.Errorf("missing '=' in -search.userMaxLookback=%q; expecting 'user=duration'", s)
+		}
+		user := s[:n]
+		if user == "" {
+			return nil, fmt.Errorf("user cannot be empty in -search.userMaxLookback=%q", s)
+		}
+		d, err := timeutil.ParseDuration(s[n+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse duration at -search.userMaxLookback=%q: %w", s, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("duration at -search.userMaxLookback=%q cannot be negative", s)
+		}
+		if _, ok := m[user]; ok {
+			return nil, fmt.Errorf("duplicate -search.userMaxLookback for user %q", user)
+		}
+		m[user] = d.Nanoseconds()
+	}
+	return m, nil
+}
+
+// GetRequestUser returns the user for r according to -search.userHeader.
+//
+// Basic Auth username is returned if -search.userHeader isn't set.
+func GetRequestUser(r *http.Request) string {
+	if *userHeader != "" {
+		return r.Header.Get(*userHeader)
+	}
+	username, _, _ := r.BasicAuth()
+	return username
+}
+
+// getMaxLookback returns the maximum lookback in nanoseconds for the given user.
+//
+// Zero is returned if there is no limit.
+func getMaxLookback(user string) int64 {
+	if d, ok := userMaxLookbacks[user]; ok && user != "" {
+		return d
+	}
+	return maxLookback.Duration().Nanoseconds()
+}
+
+// applyQueryTimeBounds applies -search.requireTimeFilter, -search.defaultQueryTimeRange and -search.maxLookback to q.
+//
+// currTimestamp must contain the current time in nanoseconds.
+func applyQueryTimeBounds(q *logstorage.Query, user string, currTimestamp int64) error {
+	start, end := q.GetFilterTimeRange()
+	if start == math.MinInt64 {
+		if d := defaultQueryTimeRange.Duration(); d > 0 {
+			upper := end
+			if upper == math.MaxInt64 {
+				upper = q.GetTimestamp()
+			}
+			start = upper - d.Nanoseconds()
+			q.AddTimeFilter(start, end)
+		} else if *requireTimeFilter {
+			return fmt.Errorf("the query [%s] must have the lower time bound set via 'start' query arg or via _time filter according to -search.requireTimeFilter; "+
+				"see https://docs.victoriametrics.com/victorialogs/querying/#query-time-bounds", q)
+		}
+	}
+
+	if lookback := getMaxLookback(user); lookback > 0 {
+		minStart := currTimestamp - lookback
+		if start < minStart {
+			q.AddTimeFilter(minStart, math.MaxInt64)
+		}
+	}
+	return nil
+}
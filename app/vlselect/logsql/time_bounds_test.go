@@ -0,0 +1,134 @@
+package logsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParseUserMaxLookbacks_Success(t *testing.T) {
+	m, err := parseUserMaxLookbacks([]string{"alice=1h", "bob=7d", "svc=team=0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]int64{
+		"alice":    time.Hour.Nanoseconds(),
+		"bob":      7 * 24 * time.Hour.Nanoseconds(),
+		"svc=team": 0,
+	}
+	if len(m) != len(expected) {
+		t.Fatalf("unexpected result; got %v; want %v", m, expected)
+	}
+	for user, d := range expected {
+		if m[user] != d {
+			t.Fatalf("unexpected lookback for user %q; got %d; want %d", user, m[user], d)
+		}
+	}
+}
+
+func TestParseUserMaxLookbacks_Failure(t *testing.T) {
+	f := func(a []string) {
+		t.Helper()
+
+		if _, err := parseUserMaxLookbacks(a); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// missing '='
+	f([]string{"alice"})
+
+	// empty user
+	f([]string{"=1h"})
+
+	// invalid duration
+	f([]string{"alice=foo"})
+
+	// negative duration
+	f([]string{"alice=-1h"})
+
+	// duplicate user
+	f([]string{"alice=1h", "alice=2h"})
+}
+
+func TestApplyQueryTimeBounds(t *testing.T) {
+	defer func() {
+		*requireTimeFilter = false
+		if err := defaultQueryTimeRange.Set("0"); err != nil {
+			t.Fatalf("cannot reset -search.defaultQueryTimeRange: %s", err)
+		}
+		if err := maxLookback.Set("0"); err != nil {
+			t.Fatalf("cannot reset -search.maxLookback: %s", err)
+		}
+		userMaxLookbacks = nil
+	}()
+
+	currTimestamp := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC).UnixNano()
+
+	f := func(qStr, user, resultExpected string) {
+		t.Helper()
+
+		q, err := logstorage.ParseQueryAtTimestamp(qStr, currTimestamp)
+		if err != nil {
+			t.Fatalf("cannot parse query [%s]: %s", qStr, err)
+		}
+		if err := applyQueryTimeBounds(q, user, currTimestamp); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := q.String(); result != resultExpected {
+			t.Fatalf("unexpected result for query [%s]\ngot\n%s\nwant\n%s", qStr, result, resultExpected)
+		}
+	}
+
+	fFailure := func(qStr string) {
+		t.Helper()
+
+		q, err := logstorage.ParseQueryAtTimestamp(qStr, currTimestamp)
+		if err != nil {
+			t.Fatalf("cannot parse query [%s]: %s", qStr, err)
+		}
+		if err := applyQueryTimeBounds(q, "", currTimestamp); err == nil {
+			t.Fatalf("expecting non-nil error for query [%s]", qStr)
+		}
+	}
+
+	// No time bounds are applied by default
+	f(`error`, "", `error`)
+
+	// Queries without the lower time bound are rejected if -search.requireTimeFilter is set
+	*requireTimeFilter = true
+	fFailure(`error`)
+	fFailure(`_time:<2025-06-10Z error`)
+	f(`_time:5m error`, "", `_time:5m error`)
+	f(`_time:>2025-06-10Z error`, "", `_time:>2025-06-10Z error`)
+
+	// -search.defaultQueryTimeRange is applied to queries without the lower time bound
+	if err := defaultQueryTimeRange.Set("1h"); err != nil {
+		t.Fatalf("cannot set -search.defaultQueryTimeRange: %s", err)
+	}
+	f(`error`, "", `_time:[2025-06-10T11:00:00.000000000Z,2262-04-11T23:47:16.854775807Z] error`)
+	f(`_time:<2025-06-10Z error`, "", `_time:[2025-06-09T22:59:59.999999999Z,2025-06-09T23:59:59.999999999Z] _time:<2025-06-10Z error`)
+	f(`_time:5m error`, "", `_time:5m error`)
+
+	// -search.maxLookback limits queries to the given lookback period
+	*requireTimeFilter = false
+	if err := defaultQueryTimeRange.Set("0"); err != nil {
+		t.Fatalf("cannot reset -search.defaultQueryTimeRange: %s", err)
+	}
+	if err := maxLookback.Set("1d"); err != nil {
+		t.Fatalf("cannot set -search.maxLookback: %s", err)
+	}
+	f(`error`, "", `_time:[2025-06-09T12:00:00.000000000Z,2262-04-11T23:47:16.854775807Z] error`)
+	f(`_time:>2025-06-01Z error`, "", `_time:[2025-06-09T12:00:00.000000000Z,2262-04-11T23:47:16.854775807Z] _time:>2025-06-01Z error`)
+	f(`_time:5m error`, "", `_time:5m error`)
+
+	// -search.userMaxLookback overrides -search.maxLookback for the given user
+	userMaxLookbacks = map[string]int64{
+		"alice": time.Hour.Nanoseconds(),
+		"bob":   0,
+	}
+	f(`error`, "alice", `_time:[2025-06-10T11:00:00.000000000Z,2262-04-11T23:47:16.854775807Z] error`)
+	f(`error`, "bob", `error`)
+	f(`error`, "", `_time:[2025-06-09T12:00:00.000000000Z,2262-04-11T23:47:16.854775807Z] error`)
+}
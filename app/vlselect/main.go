@@ -3,6 +3,7 @@ package vlselect
 import (
 	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -11,13 +12,18 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/metrics"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/anomaly"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/dashboards"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/internalselect"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/logsql"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/threatintel"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/wasmfuncs"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
@@ -38,6 +44,11 @@ var (
 		"via delete API at vlstorage nodes; see https://docs.victoriametrics.com/victorialogs/#how-to-delete-logs")
 	logSlowQueryDuration = flag.Duration("search.logSlowQueryDuration", 5*time.Second,
 		"Log queries with execution time exceeding this value. Zero disables slow query logging")
+
+	spillDir = flag.String("search.spillDir", "", "Path to the directory for temporary files, which are used by sort and uniq pipes when their state doesn't fit the memory limits. "+
+		"Such queries fail when this flag isn't set; see https://docs.victoriametrics.com/victorialogs/querying/#spilling-to-disk")
+	maxSpillSize = flagutil.NewBytes("search.maxSpillSize", 10<<30, "The maximum size of temporary files at -search.spillDir per every sort or uniq pipe in the query; "+
+		"see https://docs.victoriametrics.com/victorialogs/querying/#spilling-to-disk")
 )
 
 func getDefaultMaxConcurrentRequests() int {
@@ -57,13 +68,38 @@ func getDefaultMaxConcurrentRequests() int {
 // Init initializes vlselect
 func Init() {
 	concurrencyLimitCh = make(chan struct{}, *maxConcurrentRequests)
+	mustInitConcurrencyLimits()
+
+	initResponseCompression()
 
+	logstorage.SetSpillToDisk(*spillDir, maxSpillSize.N)
+
+	wasmfuncs.Init()
 	internalselect.Init()
+	logsql.Init()
+	dashboards.Init()
+	anomaly.Init()
+	threatintel.Init()
+}
+
+// CheckConfig verifies command-line flags and config files for querying without initializing vlselect.
+func CheckConfig() error {
+	var errs []error
+	if _, _, err := parseConcurrencyLimitsFlags(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, logsql.CheckConfig(), dashboards.CheckConfig(), anomaly.CheckConfig(), threatintel.CheckConfig(), wasmfuncs.CheckConfig())
+	return errors.Join(errs...)
 }
 
 // Stop stops vlselect
 func Stop() {
+	threatintel.Stop()
+	anomaly.Stop()
+	dashboards.Stop()
+	logsql.Stop()
 	internalselect.Stop()
+	wasmfuncs.Stop()
 
 	concurrencyLimitCh = nil
 }
@@ -97,6 +133,11 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 				"see https://docs.victoriametrics.com/victorialogs/#how-to-delete-logs")
 			return true
 		}
+		path, err := logstorage.StripTenantFromPath(r, path, "/delete/")
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
 		deleteHandler(w, r, path)
 		return true
 	}
@@ -106,10 +147,24 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			httpserver.Errorf(w, r, "requests to /select/* are disabled with -select.disable command-line flag")
 			return true
 		}
+		if processPreflightRequest(w, r) {
+			return true
+		}
+		path, err := logstorage.StripTenantFromPath(r, path, "/select/")
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
 
 		return selectHandler(w, r, path)
 	}
 
+	if path == "/internal/concurrency_limits" {
+		concurrencyLimitsRequests.Inc()
+		processConcurrencyLimitsRequest(w, r)
+		return true
+	}
+
 	if strings.HasPrefix(path, "/internal/delete/") {
 		if !*enableInternalDelete {
 			httpserver.Errorf(w, r, "requests to /internal/delete/*` are disabled; pass -internaldelete.enable command-line flag for enabling them; "+
@@ -140,7 +195,7 @@ func selectHandler(w http.ResponseWriter, r *http.Request, path string) bool {
 	ctx := r.Context()
 
 	if path == "/select/buildinfo" {
-		httpserver.EnableCORS(w, r)
+		enableCORS(w, r)
 
 		if r.Method != http.MethodGet {
 			w.Header().Set("Content-Type", "application/json")
@@ -170,6 +225,7 @@ func selectHandler(w http.ResponseWriter, r *http.Request, path string) bool {
 		return true
 	}
 	if strings.HasPrefix(path, "/select/vmui/") {
+		enableCORS(w, r)
 		if strings.HasPrefix(path, "/select/vmui/static/") {
 			// Allow clients caching static contents for long period of time, since it shouldn't change over time.
 			// Path to static contents (such as js and css) must be changed whenever its contents is changed.
@@ -181,20 +237,88 @@ func selectHandler(w http.ResponseWriter, r *http.Request, path string) bool {
 		return true
 	}
 
+	if path == "/select/dashboards" || strings.HasPrefix(path, "/select/dashboards/") {
+		// Do not apply concurrency limit to dashboards requests, since they do not execute queries.
+		enableCORS(w, r)
+		dashboards.RequestHandler(w, r, path)
+		return true
+	}
+
+	// Compress responses with zstd if the client prefers it over gzip.
+	w = getZstdResponseWriter(w, r)
+	defer closeZstdResponseWriter(w)
+
 	if path == "/select/logsql/tail" {
 		logsqlTailRequests.Inc()
+		enableCORS(w, r)
 		// Process live tailing request without timeout, since it is OK to run live tailing requests for very long time.
 		// Also do not apply concurrency limit to tail requests, since these limits are intended for non-tail requests.
 		logsql.ProcessLiveTailRequest(ctx, w, r)
 		return true
 	}
 
+	if path == "/select/logsql/cancel" {
+		// Do not apply concurrency limit to cancel requests, since they must be executed when the limit is reached because of runaway queries.
+		logsqlCancelRequests.Inc()
+		enableCORS(w, r)
+		processCancelRequest(w, r)
+		return true
+	}
+	if path == "/select/logsql/active_queries" {
+		// Do not apply concurrency limit to active_queries requests, since they are used for investigating the reasons of high load.
+		logsqlActiveQueriesRequests.Inc()
+		enableCORS(w, r)
+		processActiveQueriesRequest(w, r)
+		return true
+	}
+
+	switch path {
+	case "/select/logsql/hide_stream":
+		// Do not apply concurrency limit to hidden streams requests, since they do not execute queries.
+		logsqlHideStreamRequests.Inc()
+		enableCORS(w, r)
+		logsql.ProcessHideStreamRequest(w, r)
+		return true
+	case "/select/logsql/unhide_stream":
+		logsqlUnhideStreamRequests.Inc()
+		enableCORS(w, r)
+		logsql.ProcessUnhideStreamRequest(w, r)
+		return true
+	case "/select/logsql/hidden_streams":
+		logsqlHiddenStreamsRequests.Inc()
+		enableCORS(w, r)
+		logsql.ProcessHiddenStreamsRequest(w, r)
+		return true
+	}
+
 	// Limit the number of concurrent queries, which can consume big amounts of CPU time.
 	startTime := time.Now()
 	d := getMaxQueryDuration(r)
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, d)
 	defer cancel()
 
+	// Register the query, so it could be canceled via /select/logsql/cancel.
+	ctxWithTimeout, rq, err := rqs.register(ctxWithTimeout, r, path)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+	defer rqs.unregister(rq)
+	w.Header().Set("VL-Query-ID", rq.id)
+
+	// Apply per-tenant and per-user concurrency limits before the global concurrency limit,
+	// so the requests waiting for per-tenant and per-user limits do not occupy global concurrency slots.
+	release, err := acquirePerTenantAndUserConcurrency(ctxWithTimeout, r)
+	if err != nil {
+		if ctxWithTimeout.Err() != nil {
+			logRequestErrorIfNeeded(ctxWithTimeout, w, r, startTime)
+		} else {
+			httpserver.Errorf(w, r, "%s", err)
+		}
+		return true
+	}
+	defer release()
+
 	if !incRequestConcurrency(ctxWithTimeout, w, r) {
 		return true
 	}
@@ -227,7 +351,14 @@ func logRequestErrorIfNeeded(ctx context.Context, w http.ResponseWriter, r *http
 	case nil:
 		// nothing to do
 	case context.Canceled:
-		// do not log canceled requests, since they are expected and legal.
+		if context.Cause(ctx) == errQueryCanceled {
+			err = &httpserver.ErrorWithStatusCode{
+				Err:        fmt.Errorf("the request has been canceled after %.3f seconds via /select/logsql/cancel", time.Since(startTime).Seconds()),
+				StatusCode: http.StatusServiceUnavailable,
+			}
+			httpserver.Errorf(w, r, "%s", err)
+		}
+		// do not log requests canceled by clients, since they are expected and legal.
 	case context.DeadlineExceeded:
 		err = &httpserver.ErrorWithStatusCode{
 			Err: fmt.Errorf("the request couldn't be executed in %.3f seconds; possible solutions: "+
@@ -255,6 +386,10 @@ func incRequestConcurrency(ctx context.Context, w http.ResponseWriter, r *http.R
 		case <-stopCh:
 			switch ctx.Err() {
 			case context.Canceled:
+				if context.Cause(ctx) == errQueryCanceled {
+					httpserver.Errorf(w, r, "the pending request has been canceled after %.3f seconds via /select/logsql/cancel", time.Since(startTime).Seconds())
+					return false
+				}
 				remoteAddr := httpserver.GetQuotedRemoteAddr(r)
 				requestURI := httpserver.GetRequestURI(r)
 				logger.Infof("client has canceled the pending request after %.3f seconds: remoteAddr=%s, requestURI: %q",
@@ -281,7 +416,7 @@ func decRequestConcurrency() {
 }
 
 func processSelectRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) bool {
-	httpserver.EnableCORS(w, r)
+	enableCORS(w, r)
 	startTime := time.Now()
 	switch path {
 	case "/select/logsql/query_time_range":
@@ -308,11 +443,21 @@ func processSelectRequest(ctx context.Context, w http.ResponseWriter, r *http.Re
 		logsql.ProcessHitsRequest(ctx, w, r)
 		logsqlHitsDuration.UpdateDuration(startTime)
 		return true
+	case "/select/logsql/metric_hints":
+		logsqlMetricHintsRequests.Inc()
+		logsql.ProcessMetricHintsRequest(ctx, w, r)
+		logsqlMetricHintsDuration.UpdateDuration(startTime)
+		return true
 	case "/select/logsql/query":
 		logsqlQueryRequests.Inc()
 		logsql.ProcessQueryRequest(ctx, w, r)
 		logsqlQueryDuration.UpdateDuration(startTime)
 		return true
+	case "/select/logsql/export":
+		logsqlExportRequests.Inc()
+		logsql.ProcessExportRequest(ctx, w, r)
+		logsqlExportDuration.UpdateDuration(startTime)
+		return true
 	case "/select/logsql/stats_query":
 		logsqlStatsQueryRequests.Inc()
 		logsql.ProcessStatsQueryRequest(ctx, w, r)
@@ -323,6 +468,19 @@ func processSelectRequest(ctx context.Context, w http.ResponseWriter, r *http.Re
 		logsql.ProcessStatsQueryRangeRequest(ctx, w, r)
 		logsqlStatsQueryRangeDuration.UpdateDuration(startTime)
 		return true
+	case "/select/logsql/pin_view":
+		logsqlPinViewRequests.Inc()
+		logsql.ProcessPinViewRequest(ctx, w, r)
+		return true
+	case "/select/logsql/unpin_view":
+		logsqlUnpinViewRequests.Inc()
+		logsql.ProcessUnpinViewRequest(ctx, w, r)
+		return true
+	case "/select/logsql/stale_streams":
+		logsqlStaleStreamsRequests.Inc()
+		logsql.ProcessStaleStreamsRequest(ctx, w, r)
+		logsqlStaleStreamsDuration.UpdateDuration(startTime)
+		return true
 	case "/select/logsql/stream_field_names":
 		logsqlStreamFieldNamesRequests.Inc()
 		logsql.ProcessStreamFieldNamesRequest(ctx, w, r)
@@ -454,15 +612,27 @@ var (
 	logsqlHitsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/hits"}`)
 	logsqlHitsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/hits"}`)
 
+	logsqlMetricHintsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/metric_hints"}`)
+	logsqlMetricHintsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/metric_hints"}`)
+
 	logsqlQueryRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/query"}`)
 	logsqlQueryDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/query"}`)
 
+	logsqlExportRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/export"}`)
+	logsqlExportDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/export"}`)
+
 	logsqlStatsQueryRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/stats_query"}`)
 	logsqlStatsQueryDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/stats_query"}`)
 
 	logsqlStatsQueryRangeRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/stats_query_range"}`)
 	logsqlStatsQueryRangeDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/stats_query_range"}`)
 
+	logsqlStaleStreamsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/stale_streams"}`)
+	logsqlStaleStreamsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/stale_streams"}`)
+
+	logsqlPinViewRequests   = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/pin_view"}`)
+	logsqlUnpinViewRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/unpin_view"}`)
+
 	logsqlStreamFieldNamesRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/stream_field_names"}`)
 	logsqlStreamFieldNamesDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/stream_field_names"}`)
 
@@ -481,6 +651,15 @@ var (
 	// no need to track duration for tail requests, as they usually take long time
 	logsqlTailRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/tail"}`)
 
+	logsqlCancelRequests        = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/cancel"}`)
+	logsqlActiveQueriesRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/active_queries"}`)
+
+	logsqlHideStreamRequests    = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/hide_stream"}`)
+	logsqlUnhideStreamRequests  = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/unhide_stream"}`)
+	logsqlHiddenStreamsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/hidden_streams"}`)
+
+	concurrencyLimitsRequests = metrics.NewCounter(`vl_http_requests_total{path="/internal/concurrency_limits"}`)
+
 	// no need to track the duration for query_time_range requests, since they are instant
 	logsqlQueryTimeRangeRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/query_time_range"}`)
 
@@ -0,0 +1,292 @@
+package vlselect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/logsql"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// maxQueryIDLen is the maximum length of query_id arg, which can be passed by the client.
+const maxQueryIDLen = 128
+
+// errQueryCanceled is the cancellation cause for queries canceled via /select/logsql/cancel.
+var errQueryCanceled = errors.New("the query has been canceled via /select/logsql/cancel")
+
+// runningQuery contains information about the query, which is executed at the moment.
+type runningQuery struct {
+	// id is the unique id of the query. It is returned to the client in the VL-Query-ID response header.
+	id string
+
+	// path is the requested HTTP path.
+	path string
+
+	// query is the LogsQL query passed to the path.
+	query string
+
+	// remoteAddr is the address of the client.
+	remoteAddr string
+
+	// userAgent is the User-Agent header of the client.
+	userAgent string
+
+	// tenantID is the tenant the query is executed for.
+	tenantID logstorage.TenantID
+
+	// startTime is the time when the query has been started.
+	startTime time.Time
+
+	// cancel cancels the query execution.
+	cancel context.CancelCauseFunc
+
+	// qs points to the query execution stats. It is set when the query execution starts.
+	qs atomic.Pointer[logstorage.QueryStats]
+}
+
+type runningQueries struct {
+	mu sync.Mutex
+	m  map[string]*runningQuery
+}
+
+var rqs = &runningQueries{
+	m: make(map[string]*runningQuery),
+}
+
+// queryIDGenerator is used for generating unique ids for queries without query_id arg.
+//
+// It is initialized with the current timestamp in order to reduce chances of the same ids after the restart.
+var queryIDGenerator = func() *atomic.Uint64 {
+	var n atomic.Uint64
+	n.Store(uint64(time.Now().UnixNano()))
+	return &n
+}()
+
+var (
+	queriesCanceled = metrics.NewCounter(`vl_select_queries_canceled_total`)
+
+	_ = metrics.NewGauge(`vl_select_running_queries`, func() float64 {
+		rqs.mu.Lock()
+		n := len(rqs.m)
+		rqs.mu.Unlock()
+		return float64(n)
+	})
+)
+
+// register registers the query from r at the given path, so it could be canceled via /select/logsql/cancel.
+//
+// The returned context must be used for the query execution. The returned query must be unregistered via rqs.unregister() when it is finished.
+func (rqs *runningQueries) register(ctx context.Context, r *http.Request, path string) (context.Context, *runningQuery, error) {
+	id := r.FormValue("query_id")
+	if len(id) > maxQueryIDLen {
+		return nil, nil, fmt.Errorf("too long query_id arg; it mustn't exceed %d bytes", maxQueryIDLen)
+	}
+	if id == "" {
+		id = fmt.Sprintf("%016X", queryIDGenerator.Add(1))
+	}
+
+	// Ignore the error, since the query is rejected later if the tenant cannot be obtained from r.
+	tenantID, _ := logstorage.GetTenantIDFromRequest(r)
+
+	ctxWithCancel, cancel := context.WithCancelCause(ctx)
+	rq := &runningQuery{
+		id:         id,
+		path:       path,
+		query:      r.FormValue("query"),
+		remoteAddr: getRemoteAddr(r),
+		userAgent:  r.UserAgent(),
+		tenantID:   tenantID,
+		startTime:  time.Now(),
+		cancel:     cancel,
+	}
+
+	rqs.mu.Lock()
+	_, ok := rqs.m[id]
+	if !ok {
+		rqs.m[id] = rq
+	}
+	rqs.mu.Unlock()
+
+	if ok {
+		cancel(nil)
+		return nil, nil, &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("the query with query_id=%q is already running; pass unique query_id arg", id),
+			StatusCode: http.StatusConflict,
+		}
+	}
+	ctxWithCancel = logsql.WithQueryStatsPtr(ctxWithCancel, &rq.qs)
+	return ctxWithCancel, rq, nil
+}
+
+// unregister unregisters rq registered via register().
+func (rqs *runningQueries) unregister(rq *runningQuery) {
+	rqs.mu.Lock()
+	delete(rqs.m, rq.id)
+	rqs.mu.Unlock()
+
+	rq.cancel(nil)
+}
+
+// cancel cancels the query with the given id.
+//
+// If tenantID isn't nil, then only the query for the given tenantID can be canceled.
+//
+// It returns false if there is no running query with the given id.
+func (rqs *runningQueries) cancel(id string, tenantID *logstorage.TenantID) bool {
+	rqs.mu.Lock()
+	rq, ok := rqs.m[id]
+	rqs.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	if tenantID != nil && rq.tenantID != *tenantID {
+		return false
+	}
+	rq.cancel(errQueryCanceled)
+	return true
+}
+
+// getAll returns all the running queries.
+//
+// If tenantID isn't nil, then only queries for the given tenantID are returned.
+func (rqs *runningQueries) getAll(tenantID *logstorage.TenantID) []*runningQuery {
+	rqs.mu.Lock()
+	a := make([]*runningQuery, 0, len(rqs.m))
+	for _, rq := range rqs.m {
+		if tenantID == nil || rq.tenantID == *tenantID {
+			a = append(a, rq)
+		}
+	}
+	rqs.mu.Unlock()
+
+	// Return the longest running queries first.
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].startTime.Before(a[j].startTime)
+	})
+	return a
+}
+
+// processCancelRequest processes /select/logsql/cancel request.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#query-cancellation
+func processCancelRequest(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("query_id")
+	if id == "" {
+		httpserver.Errorf(w, r, "missing query_id arg")
+		return
+	}
+
+	// Allow canceling queries only for the given tenant if the tenant is passed in the request.
+	tenantID, err := getOptionalTenantID(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	if !rqs.cancel(id, tenantID) {
+		err := &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("cannot find running query with query_id=%q", id),
+			StatusCode: http.StatusNotFound,
+		}
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	queriesCanceled.Inc()
+
+	remoteAddr := httpserver.GetQuotedRemoteAddr(r)
+	logger.Infof("canceled the query with query_id=%q by the request from remoteAddr=%s", id, remoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok"}`)
+}
+
+// activeQuery is the JSON representation of runningQuery returned from /select/logsql/active_queries.
+type activeQuery struct {
+	ID         string `json:"id"`
+	Path       string `json:"path"`
+	Query      string `json:"query"`
+	Tenant     string `json:"tenant"`
+	RemoteAddr string `json:"remote_addr"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	StartTime  string `json:"start_time"`
+	Duration   string `json:"duration"`
+
+	BytesRead     uint64 `json:"bytes_read"`
+	RowsProcessed uint64 `json:"rows_processed"`
+	RowsFound     uint64 `json:"rows_found"`
+}
+
+// processActiveQueriesRequest processes /select/logsql/active_queries request.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#active-queries
+func processActiveQueriesRequest(w http.ResponseWriter, r *http.Request) {
+	// Return only queries for the given tenant if the tenant is passed in the request.
+	tenantID, err := getOptionalTenantID(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	currentTime := time.Now()
+	rqsLocal := rqs.getAll(tenantID)
+	aqs := make([]activeQuery, len(rqsLocal))
+	for i, rq := range rqsLocal {
+		aq := &aqs[i]
+		aq.ID = rq.id
+		aq.Path = rq.path
+		aq.Query = rq.query
+		aq.Tenant = fmt.Sprintf("%d:%d", rq.tenantID.AccountID, rq.tenantID.ProjectID)
+		aq.RemoteAddr = rq.remoteAddr
+		aq.UserAgent = rq.userAgent
+		aq.StartTime = rq.startTime.UTC().Format(time.RFC3339Nano)
+		aq.Duration = fmt.Sprintf("%.3fs", currentTime.Sub(rq.startTime).Seconds())
+
+		if qs := rq.qs.Load(); qs != nil {
+			qsLocal := qs.LoadAtomic()
+			aq.BytesRead = qsLocal.GetBytesReadTotal()
+			aq.RowsProcessed = qsLocal.RowsProcessed
+			aq.RowsFound = qsLocal.RowsFound
+		}
+	}
+
+	data, err := json.Marshal(aqs)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal active queries to JSON: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok","data":%s}`, data)
+}
+
+// getOptionalTenantID returns tenantID from r if it is set there. Otherwise nil is returned.
+func getOptionalTenantID(r *http.Request) (*logstorage.TenantID, error) {
+	if !logstorage.HasTenantInRequest(r) {
+		return nil, nil
+	}
+	tenantID, err := logstorage.GetTenantIDFromRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain tenantID: %w", err)
+	}
+	return &tenantID, nil
+}
+
+// getRemoteAddr returns the address of the client for r including X-Forwarded-For header if it is set.
+func getRemoteAddr(r *http.Request) string {
+	remoteAddr := r.RemoteAddr
+	if addr := r.Header.Get("X-Forwarded-For"); addr != "" {
+		remoteAddr += ", X-Forwarded-For: " + addr
+	}
+	return remoteAddr
+}
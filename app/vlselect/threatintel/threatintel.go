@@ -0,0 +1,371 @@
+package threatintel
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs/fscore"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	feedPaths = flagutil.NewArrayString("threatIntel.feed", "Optional path or http url to threat intel feed with indicators such as IP addresses, "+
+		"subnets, domains and file hashes. Feeds with .json extension must contain STIX 2.x bundle, other feeds must be in CSV format. "+
+		"Log fields can be matched against the loaded indicators with threat_intel pipe; see https://docs.victoriametrics.com/victorialogs/#threat-intel-enrichment")
+	reloadInterval = flag.Duration("threatIntel.reloadInterval", time.Hour, "Interval for reloading -threatIntel.feed. Feeds aren't reloaded if this flag is zero")
+)
+
+// Names of the fields added to the logs matching threat intel indicators.
+const (
+	matchFieldName       = "threat_intel.match"
+	fieldFieldName       = "threat_intel.field"
+	feedFieldName        = "threat_intel.feed"
+	descriptionFieldName = "threat_intel.description"
+)
+
+func init() {
+	logstorage.RegisterCustomPipe("threat_intel", &threatIntelPipe{})
+}
+
+var (
+	currentIndicators atomic.Pointer[indicators]
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+)
+
+// IsEnabled returns true if threat intel feeds are configured via -threatIntel.feed command-line flag.
+func IsEnabled() bool {
+	return len(*feedPaths) > 0
+}
+
+// CheckConfig verifies threat intel feeds set via -threatIntel.feed.
+func CheckConfig() error {
+	if len(*feedPaths) == 0 {
+		return nil
+	}
+	if _, err := loadFeeds(*feedPaths); err != nil {
+		return fmt.Errorf("cannot load -threatIntel.feed: %w", err)
+	}
+	return nil
+}
+
+// Init loads threat intel feeds from -threatIntel.feed and starts their periodic reloading.
+func Init() {
+	if len(*feedPaths) == 0 {
+		return
+	}
+	is, err := loadFeeds(*feedPaths)
+	if err != nil {
+		logger.Fatalf("cannot load -threatIntel.feed: %s", err)
+	}
+	currentIndicators.Store(is)
+	logger.Infof("loaded %d threat intel indicators from -threatIntel.feed", is.len())
+
+	if *reloadInterval <= 0 {
+		return
+	}
+	stopCh = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runFeedsReloader()
+	}()
+}
+
+// Stop stops periodic reloading of threat intel feeds.
+func Stop() {
+	if stopCh != nil {
+		close(stopCh)
+		wg.Wait()
+		stopCh = nil
+	}
+	currentIndicators.Store(nil)
+}
+
+func runFeedsReloader() {
+	ticker := time.NewTicker(*reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		reloadsTotal.Inc()
+		is, err := loadFeeds(*feedPaths)
+		if err != nil {
+			reloadErrorsTotal.Inc()
+			logger.Errorf("cannot reload -threatIntel.feed; continuing using the previously loaded indicators; error: %s", err)
+			continue
+		}
+		currentIndicators.Store(is)
+	}
+}
+
+// threatIntelPipe implements `| threat_intel(field1, ..., fieldN)` pipe.
+//
+// It adds threat_intel.* fields to logs with the given fields matching the loaded indicators.
+type threatIntelPipe struct{}
+
+// NeededFields implements logstorage.CustomPipe interface.
+func (tp *threatIntelPipe) NeededFields(args []string) []string {
+	if len(args) == 0 {
+		return []string{"*"}
+	}
+	return args
+}
+
+// ProcessRow implements logstorage.CustomPipe interface.
+func (tp *threatIntelPipe) ProcessRow(dst []logstorage.Field, args []string, fields []logstorage.Field) []logstorage.Field {
+	is := currentIndicators.Load()
+	if is == nil {
+		return dst
+	}
+
+	for _, f := range fields {
+		if len(args) > 0 && !slices.Contains(args, f.Name) {
+			continue
+		}
+		ind := is.lookup(f.Value)
+		if ind == nil {
+			continue
+		}
+
+		matchesTotal.Inc()
+		dst = append(dst, logstorage.Field{
+			Name:  matchFieldName,
+			Value: strings.Clone(f.Value),
+		}, logstorage.Field{
+			Name:  fieldFieldName,
+			Value: strings.Clone(f.Name),
+		}, logstorage.Field{
+			Name:  feedFieldName,
+			Value: ind.feed,
+		})
+		if ind.description != "" {
+			dst = append(dst, logstorage.Field{
+				Name:  descriptionFieldName,
+				Value: ind.description,
+			})
+		}
+		return dst
+	}
+	return dst
+}
+
+type indicator struct {
+	// feed is the name of the feed the indicator was loaded from
+	feed string
+
+	// description is an optional description of the indicator
+	description string
+}
+
+// indicators holds indicators loaded from threat intel feeds.
+type indicators struct {
+	// values contains lowercased values such as IP addresses, domains and hashes
+	values map[string]*indicator
+
+	// prefixes contains subnets
+	prefixes map[netip.Prefix]*indicator
+
+	// prefixBits contains unique prefix lengths for prefixes
+	prefixBits []int
+}
+
+func newIndicators() *indicators {
+	return &indicators{
+		values:   make(map[string]*indicator),
+		prefixes: make(map[netip.Prefix]*indicator),
+	}
+}
+
+func (is *indicators) len() int {
+	return len(is.values) + len(is.prefixes)
+}
+
+func (is *indicators) add(value string, ind *indicator) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if strings.Contains(value, "/") {
+		if p, err := netip.ParsePrefix(value); err == nil {
+			p = p.Masked()
+			if _, ok := is.prefixes[p]; !ok {
+				is.prefixes[p] = ind
+				if !slices.Contains(is.prefixBits, p.Bits()) {
+					is.prefixBits = append(is.prefixBits, p.Bits())
+				}
+			}
+			return
+		}
+	}
+	value = strings.ToLower(value)
+	if _, ok := is.values[value]; !ok {
+		is.values[value] = ind
+	}
+}
+
+func (is *indicators) lookup(v string) *indicator {
+	if v == "" {
+		return nil
+	}
+	if ind := is.values[v]; ind != nil {
+		return ind
+	}
+	if ind := is.values[strings.ToLower(v)]; ind != nil {
+		return ind
+	}
+	if len(is.prefixBits) == 0 {
+		return nil
+	}
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return nil
+	}
+	for _, bits := range is.prefixBits {
+		p, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if ind := is.prefixes[p]; ind != nil {
+			return ind
+		}
+	}
+	return nil
+}
+
+func loadFeeds(paths []string) (*indicators, error) {
+	is := newIndicators()
+	for _, p := range paths {
+		data, err := fscore.ReadFileOrHTTP(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %q: %w", p, err)
+		}
+		if err := is.addFeed(getFeedName(p), data, strings.HasSuffix(strings.ToLower(p), ".json")); err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", p, err)
+		}
+	}
+	indicatorsLoaded.Store(uint64(is.len()))
+	return is, nil
+}
+
+func getFeedName(feedPath string) string {
+	if n := strings.IndexByte(feedPath, '?'); n >= 0 {
+		feedPath = feedPath[:n]
+	}
+	return path.Base(feedPath)
+}
+
+func (is *indicators) addFeed(feedName string, data []byte, isSTIX bool) error {
+	if isSTIX {
+		return is.addSTIXFeed(feedName, data)
+	}
+	return is.addCSVFeed(feedName, data)
+}
+
+// addCSVFeed adds indicators from data in CSV format.
+//
+// Every line must contain an indicator in the first column and an optional description in the second column.
+// Lines starting with '#' are ignored.
+func (is *indicators) addCSVFeed(feedName string, data []byte) error {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.ReuseRecord = true
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) == 0 || strings.EqualFold(record[0], "indicator") {
+			// Skip the header
+			continue
+		}
+		ind := &indicator{
+			feed: feedName,
+		}
+		if len(record) > 1 {
+			ind.description = strings.TrimSpace(record[1])
+		}
+		is.add(record[0], ind)
+	}
+}
+
+// stixPatternValueRe matches values in comparison expressions of STIX patterns such as [ipv4-addr:value = '1.2.3.4']
+var stixPatternValueRe = regexp.MustCompile(`[a-z0-9-]+:[^=\[\]]+?\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// addSTIXFeed adds indicators from data containing STIX 2.x bundle.
+//
+// Only values from equality comparisons in patterns of `indicator` objects are used.
+func (is *indicators) addSTIXFeed(feedName string, data []byte) error {
+	var bundle struct {
+		Objects []struct {
+			Type        string `json:"type"`
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Pattern     string `json:"pattern"`
+			PatternType string `json:"pattern_type"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("cannot parse STIX bundle: %w", err)
+	}
+	for _, o := range bundle.Objects {
+		if o.Type != "indicator" {
+			continue
+		}
+		if o.PatternType != "" && o.PatternType != "stix" {
+			continue
+		}
+		ind := &indicator{
+			feed:        feedName,
+			description: o.Name,
+		}
+		if ind.description == "" {
+			ind.description = o.Description
+		}
+		for _, m := range stixPatternValueRe.FindAllStringSubmatch(o.Pattern, -1) {
+			v := strings.ReplaceAll(m[1], `\'`, `'`)
+			v = strings.ReplaceAll(v, `\\`, `\`)
+			is.add(v, ind)
+		}
+	}
+	return nil
+}
+
+var (
+	reloadsTotal      = metrics.NewCounter(`vl_threat_intel_reloads_total`)
+	reloadErrorsTotal = metrics.NewCounter(`vl_threat_intel_reload_errors_total`)
+	matchesTotal      = metrics.NewCounter(`vl_threat_intel_matches_total`)
+
+	indicatorsLoaded atomic.Uint64
+	_                = metrics.NewGauge(`vl_threat_intel_indicators`, func() float64 {
+		return float64(indicatorsLoaded.Load())
+	})
+)
@@ -0,0 +1,162 @@
+package threatintel
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestIndicatorsAddFeedFailure(t *testing.T) {
+	f := func(data string, isSTIX bool) {
+		t.Helper()
+
+		is := newIndicators()
+		if err := is.addFeed("test", []byte(data), isSTIX); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f(`"foo`, false)
+	f(`{"objects":`, true)
+	f(`[1,2]`, true)
+}
+
+func TestIndicatorsLookup(t *testing.T) {
+	const csvFeed = `# comment
+indicator,description
+1.2.3.4,scanner
+10.20.0.0/16, botnet
+Evil.Example.COM
+2001:db8::/32,ipv6 range
+`
+	const stixFeed = `{
+  "type": "bundle",
+  "objects": [
+    {"type": "identity", "name": "foo"},
+    {"type": "indicator", "name": "Malicious file", "pattern_type": "stix", "pattern": "[file:hashes.'SHA-256' = 'AEC070645FE53EE3B3763059376134F058CC337247C978ADD178B6CCDFB0019F']"},
+    {"type": "indicator", "description": "C2 servers", "pattern": "[ipv4-addr:value = '5.6.7.8'] OR [domain-name:value = 'c2.example.org']"},
+    {"type": "indicator", "name": "yara rule", "pattern_type": "yara", "pattern": "[domain-name:value = 'yara.example.org']"}
+  ]
+}`
+
+	is := newIndicators()
+	if err := is.addFeed("feed.csv", []byte(csvFeed), false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := is.addFeed("feed.json", []byte(stixFeed), true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := is.len(); n != 7 {
+		t.Fatalf("unexpected number of indicators; got %d; want 7", n)
+	}
+
+	f := func(v string, indExpected *indicator) {
+		t.Helper()
+
+		ind := is.lookup(v)
+		if !reflect.DeepEqual(ind, indExpected) {
+			t.Fatalf("unexpected indicator for %q; got %#v; want %#v", v, ind, indExpected)
+		}
+	}
+
+	f("", nil)
+	f("foo", nil)
+	f("1.2.3.5", nil)
+	f("10.21.0.1", nil)
+	f("yara.example.org", nil)
+	f("indicator", nil)
+
+	f("1.2.3.4", &indicator{
+		feed:        "feed.csv",
+		description: "scanner",
+	})
+	f("10.20.30.40", &indicator{
+		feed:        "feed.csv",
+		description: "botnet",
+	})
+	f("evil.example.com", &indicator{
+		feed: "feed.csv",
+	})
+	f("2001:db8:1::1", &indicator{
+		feed:        "feed.csv",
+		description: "ipv6 range",
+	})
+	f("aec070645fe53ee3b3763059376134f058cc337247c978add178b6ccdfb0019f", &indicator{
+		feed:        "feed.json",
+		description: "Malicious file",
+	})
+	f("5.6.7.8", &indicator{
+		feed:        "feed.json",
+		description: "C2 servers",
+	})
+	f("c2.example.org", &indicator{
+		feed:        "feed.json",
+		description: "C2 servers",
+	})
+}
+
+func TestThreatIntelPipeProcessRow(t *testing.T) {
+	is := newIndicators()
+	if err := is.addFeed("bad_ips.csv", []byte("1.2.3.4,scanner\n5.6.7.8\n"), false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	currentIndicators.Store(is)
+	defer currentIndicators.Store(nil)
+
+	f := func(args []string, fields, resultExpected []logstorage.Field) {
+		t.Helper()
+
+		var tp threatIntelPipe
+		result := tp.ProcessRow(nil, args, fields)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	// no matches
+	f(nil, []logstorage.Field{
+		{Name: "ip", Value: "1.1.1.1"},
+	}, nil)
+
+	// match at the field missing in args
+	f([]string{"src_ip"}, []logstorage.Field{
+		{Name: "ip", Value: "1.2.3.4"},
+	}, nil)
+
+	// match with description
+	f([]string{"src_ip", "dst_ip"}, []logstorage.Field{
+		{Name: "src_ip", Value: "10.0.0.1"},
+		{Name: "dst_ip", Value: "1.2.3.4"},
+	}, []logstorage.Field{
+		{Name: "threat_intel.match", Value: "1.2.3.4"},
+		{Name: "threat_intel.field", Value: "dst_ip"},
+		{Name: "threat_intel.feed", Value: "bad_ips.csv"},
+		{Name: "threat_intel.description", Value: "scanner"},
+	})
+
+	// match without description at all the fields
+	f(nil, []logstorage.Field{
+		{Name: "_msg", Value: "foo"},
+		{Name: "client", Value: "5.6.7.8"},
+	}, []logstorage.Field{
+		{Name: "threat_intel.match", Value: "5.6.7.8"},
+		{Name: "threat_intel.field", Value: "client"},
+		{Name: "threat_intel.feed", Value: "bad_ips.csv"},
+	})
+}
+
+func TestGetFeedName(t *testing.T) {
+	f := func(feedPath, nameExpected string) {
+		t.Helper()
+
+		name := getFeedName(feedPath)
+		if name != nameExpected {
+			t.Fatalf("unexpected feed name for %q; got %q; want %q", feedPath, name, nameExpected)
+		}
+	}
+
+	f("bad_ips.csv", "bad_ips.csv")
+	f("/etc/feeds/bad_ips.csv", "bad_ips.csv")
+	f("https://example.com/feeds/stix.json?key=abc", "stix.json")
+}
@@ -0,0 +1,70 @@
+package wasmfuncs
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/quicktemplate"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/wasmplugin"
+)
+
+// wasmPipeProcessRowFunc is the name of the function, which must be exported by WebAssembly modules with custom pipes.
+//
+// The function accepts a JSON object with `args` and `fields` keys and must return a JSON object with the fields to set.
+const wasmPipeProcessRowFunc = "vl_process_pipe_row"
+
+var wasmPipeFuncs = []funcSignature{
+	{
+		name:      wasmPipeProcessRowFunc,
+		argsCount: 1,
+	},
+}
+
+// wasmPipe is logstorage.CustomPipe, which runs vl_process_pipe_row function from WebAssembly module.
+type wasmPipe struct {
+	m *wasmplugin.Module
+}
+
+// NeededFields implements logstorage.CustomPipe interface.
+func (wp *wasmPipe) NeededFields(_ []string) []string {
+	// The module may need arbitrary fields, so pass all of them.
+	return []string{"*"}
+}
+
+// ProcessRow implements logstorage.CustomPipe interface.
+func (wp *wasmPipe) ProcessRow(dst []logstorage.Field, args []string, fields []logstorage.Field) []logstorage.Field {
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+
+	b := append(bb.B[:0], `{"args":[`...)
+	for i, arg := range args {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = quicktemplate.AppendJSONString(b, arg, true)
+	}
+	b = append(b, `],"fields":`...)
+	b = logstorage.MarshalFieldsToJSON(b, fields)
+	b = append(b, '}')
+	inputLen := len(b)
+
+	b, err := wp.m.Call(b, wasmPipeProcessRowFunc, b)
+	bb.B = b
+	if err == nil {
+		dstLen := len(dst)
+		dst, err = appendFieldsFromJSON(dst, b[inputLen:])
+		if err != nil {
+			dst = dst[:dstLen]
+			err = fmt.Errorf("cannot parse the result returned by %q from WebAssembly module %q: %w", wasmPipeProcessRowFunc, wp.m.Path(), err)
+		}
+	}
+	if err != nil {
+		wasmPipeErrors.Inc()
+		errorsLogger.Warnf("leaving the log entry without changes in custom pipe: %s", err)
+	}
+	return dst
+}
+
+var wasmPipeErrors = metrics.NewCounter(`vl_custom_pipe_errors_total{type="wasm"}`)
@@ -0,0 +1,124 @@
+package wasmfuncs
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/wasmplugin"
+)
+
+// Names of the functions, which must be exported by WebAssembly modules with custom stats functions.
+//
+// The state is opaque for VictoriaLogs. The initial state is empty.
+const (
+	// wasmStatsUpdateFunc accepts the state and JSON object with log fields and must return the updated state.
+	wasmStatsUpdateFunc = "vl_stats_update"
+
+	// wasmStatsMergeFunc accepts two states and must return the merged state.
+	wasmStatsMergeFunc = "vl_stats_merge"
+
+	// wasmStatsFinalizeFunc accepts the state and must return the stats result.
+	wasmStatsFinalizeFunc = "vl_stats_finalize"
+)
+
+var wasmStatsFuncFuncs = []funcSignature{
+	{
+		name:      wasmStatsUpdateFunc,
+		argsCount: 2,
+	},
+	{
+		name:      wasmStatsMergeFunc,
+		argsCount: 2,
+	},
+	{
+		name:      wasmStatsFinalizeFunc,
+		argsCount: 1,
+	},
+}
+
+// wasmStatsFunc is logstorage.CustomStatsFunc, which runs stats functions from WebAssembly module.
+type wasmStatsFunc struct {
+	m *wasmplugin.Module
+}
+
+// NewState implements logstorage.CustomStatsFunc interface.
+func (wsf *wasmStatsFunc) NewState(_ []string) logstorage.CustomStatsState {
+	return &wasmStatsState{
+		m: wsf.m,
+	}
+}
+
+type wasmStatsState struct {
+	m *wasmplugin.Module
+
+	state []byte
+}
+
+// Update implements logstorage.CustomStatsState interface.
+func (ws *wasmStatsState) Update(fields []logstorage.Field) int {
+	bb := bbPool.Get()
+	bb.B = logstorage.MarshalFieldsToJSON(bb.B[:0], fields)
+	stateSizeIncrease := ws.call(wasmStatsUpdateFunc, ws.state, bb.B)
+	bbPool.Put(bb)
+	return stateSizeIncrease
+}
+
+// Merge implements logstorage.CustomStatsState interface.
+func (ws *wasmStatsState) Merge(src logstorage.CustomStatsState) {
+	wsSrc := src.(*wasmStatsState)
+	ws.call(wasmStatsMergeFunc, ws.state, wsSrc.state)
+}
+
+// call replaces ws.state with the result of the given function called with the given args.
+//
+// It returns the state size change. The state remains unchanged on errors.
+func (ws *wasmStatsState) call(name string, args ...[]byte) int {
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+
+	result, err := ws.m.Call(bb.B[:0], name, args...)
+	bb.B = result
+	if err != nil {
+		wasmStatsFuncErrors.Inc()
+		errorsLogger.Warnf("leaving custom stats function state without changes: %s", err)
+		return 0
+	}
+	prevLen := len(ws.state)
+	ws.state = append(ws.state[:0], result...)
+	return len(ws.state) - prevLen
+}
+
+// Marshal implements logstorage.CustomStatsState interface.
+func (ws *wasmStatsState) Marshal(dst []byte) []byte {
+	return encoding.MarshalBytes(dst, ws.state)
+}
+
+// Unmarshal implements logstorage.CustomStatsState interface.
+func (ws *wasmStatsState) Unmarshal(src []byte) (int, error) {
+	state, n := encoding.UnmarshalBytes(src)
+	if n <= 0 {
+		return 0, fmt.Errorf("cannot unmarshal state")
+	}
+	src = src[n:]
+	if len(src) > 0 {
+		return 0, fmt.Errorf("unexpected non-empty tail left after unmarshaling state; len(tail)=%d", len(src))
+	}
+	ws.state = append(ws.state[:0], state...)
+	return len(ws.state), nil
+}
+
+// Finalize implements logstorage.CustomStatsState interface.
+func (ws *wasmStatsState) Finalize() string {
+	result, err := ws.m.Call(nil, wasmStatsFinalizeFunc, ws.state)
+	if err != nil {
+		wasmStatsFuncErrors.Inc()
+		errorsLogger.Warnf("returning empty result from custom stats function: %s", err)
+		return ""
+	}
+	return string(result)
+}
+
+var wasmStatsFuncErrors = metrics.NewCounter(`vl_custom_stats_func_errors_total{type="wasm"}`)
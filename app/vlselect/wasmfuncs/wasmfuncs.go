@@ -0,0 +1,211 @@
+package wasmfuncs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/wasmplugin"
+)
+
+var (
+	wasmPipes = flagutil.NewArrayString("search.wasmPipe", "Optional custom pipes to load from WebAssembly modules in the form 'name=/path/to/module.wasm'. "+
+		"The loaded pipes can be used in queries as '| name(arg1, ..., argN)'; see https://docs.victoriametrics.com/victorialogs/logsql/#webassembly-functions")
+	wasmStatsFuncs = flagutil.NewArrayString("search.wasmStatsFunc", "Optional custom stats functions to load from WebAssembly modules in the form 'name=/path/to/module.wasm'. "+
+		"The loaded functions can be used in queries as '| stats name(field1, ..., fieldN)'. They must be configured at both vlselect and vlstorage nodes in VictoriaLogs cluster; "+
+		"see https://docs.victoriametrics.com/victorialogs/logsql/#webassembly-functions")
+)
+
+// loadedModules contains modules loaded by Init.
+var loadedModules []*wasmplugin.Module
+
+// CheckConfig verifies -search.wasmPipe and -search.wasmStatsFunc command-line flags.
+func CheckConfig() error {
+	ms, err := loadFuncs(false)
+	if err != nil {
+		return err
+	}
+	mustCloseModules(ms)
+	return nil
+}
+
+// Init loads custom pipes and stats functions from WebAssembly modules set via -search.wasmPipe and -search.wasmStatsFunc command-line flags.
+//
+// Init must be called at most once.
+func Init() {
+	ms, err := loadFuncs(true)
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	loadedModules = ms
+}
+
+// Stop releases resources occupied by WebAssembly modules loaded by Init.
+func Stop() {
+	mustCloseModules(loadedModules)
+	loadedModules = nil
+}
+
+// loadFuncs loads WebAssembly modules from -search.wasmPipe and -search.wasmStatsFunc.
+//
+// The loaded functions are registered in logstorage if mustRegister is set.
+func loadFuncs(mustRegister bool) ([]*wasmplugin.Module, error) {
+	pipes, err := parseFuncConfigs("search.wasmPipe", *wasmPipes)
+	if err != nil {
+		return nil, err
+	}
+	statsFuncs, err := parseFuncConfigs("search.wasmStatsFunc", *wasmStatsFuncs)
+	if err != nil {
+		return nil, err
+	}
+
+	var ms []*wasmplugin.Module
+	for _, fc := range pipes {
+		if err := logstorage.CheckCustomPipeName(fc.name); err != nil {
+			mustCloseModules(ms)
+			return nil, fmt.Errorf("cannot load -search.wasmPipe=%q: %w", fc.String(), err)
+		}
+		m, err := loadModule(fc.path, wasmPipeFuncs)
+		if err != nil {
+			mustCloseModules(ms)
+			return nil, fmt.Errorf("cannot load -search.wasmPipe=%q: %w", fc.String(), err)
+		}
+		ms = append(ms, m)
+		if mustRegister {
+			logstorage.RegisterCustomPipe(fc.name, &wasmPipe{
+				m: m,
+			})
+		}
+	}
+	for _, fc := range statsFuncs {
+		err := logstorage.CheckCustomStatsFuncName(fc.name)
+		if err == nil && !mustRegister && pipes.contains(fc.name) {
+			err = fmt.Errorf("cannot register custom stats function %q, since it clashes with the pipe", fc.name)
+		}
+		if err != nil {
+			mustCloseModules(ms)
+			return nil, fmt.Errorf("cannot load -search.wasmStatsFunc=%q: %w", fc.String(), err)
+		}
+		m, err := loadModule(fc.path, wasmStatsFuncFuncs)
+		if err != nil {
+			mustCloseModules(ms)
+			return nil, fmt.Errorf("cannot load -search.wasmStatsFunc=%q: %w", fc.String(), err)
+		}
+		ms = append(ms, m)
+		if mustRegister {
+			logstorage.RegisterCustomStatsFunc(fc.name, &wasmStatsFunc{
+				m: m,
+			})
+		}
+	}
+	return ms, nil
+}
+
+// funcConfig is a single item from -search.wasmPipe or -search.wasmStatsFunc command-line flags.
+type funcConfig struct {
+	name string
+	path string
+}
+
+func (fc *funcConfig) String() string {
+	return fc.name + "=" + fc.path
+}
+
+type funcConfigs []*funcConfig
+
+func (fcs funcConfigs) contains(name string) bool {
+	for _, fc := range fcs {
+		if fc.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseFuncConfigs(flagName string, items []string) (funcConfigs, error) {
+	var fcs funcConfigs
+	for _, item := range items {
+		name, path, ok := strings.Cut(item, "=")
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("cannot parse -%s=%q: missing 'name=/path/to/module.wasm'", flagName, item)
+		}
+		name = strings.ToLower(name)
+		if fcs.contains(name) {
+			return nil, fmt.Errorf("cannot parse -%s=%q: duplicate name %q", flagName, item, name)
+		}
+		fcs = append(fcs, &funcConfig{
+			name: name,
+			path: path,
+		})
+	}
+	return fcs, nil
+}
+
+// funcSignature is the function, which must be exported by WebAssembly module.
+type funcSignature struct {
+	name      string
+	argsCount int
+}
+
+func loadModule(path string, funcs []funcSignature) (*wasmplugin.Module, error) {
+	m, err := wasmplugin.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range funcs {
+		if err := m.CheckFunction(f.name, f.argsCount); err != nil {
+			m.MustClose()
+			return nil, fmt.Errorf("unexpected WebAssembly module %q: %w", path, err)
+		}
+	}
+	return m, nil
+}
+
+func mustCloseModules(ms []*wasmplugin.Module) {
+	for _, m := range ms {
+		m.MustClose()
+	}
+}
+
+// appendFieldsFromJSON parses JSON object from data and appends its items to dst.
+//
+// Non-string values are stored as JSON.
+func appendFieldsFromJSON(dst []logstorage.Field, data []byte) ([]logstorage.Field, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(data)
+	if err != nil {
+		return dst, err
+	}
+	o, err := v.Object()
+	if err != nil {
+		return dst, err
+	}
+	o.Visit(func(k []byte, v *fastjson.Value) {
+		var value string
+		if v.Type() == fastjson.TypeString {
+			value = string(v.GetStringBytes())
+		} else {
+			value = string(v.MarshalTo(nil))
+		}
+		dst = append(dst, logstorage.Field{
+			Name:  string(k),
+			Value: value,
+		})
+	})
+	return dst, nil
+}
+
+var (
+	bbPool     bytesutil.ByteBufferPool
+	parserPool fastjson.ParserPool
+
+	errorsLogger = logger.WithThrottler("wasm_funcs", 5*time.Second)
+)
@@ -0,0 +1,276 @@
+package wasmfuncs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/wasmplugin"
+)
+
+func writeTestModule(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("cannot write WebAssembly module: %s", err)
+	}
+	return path
+}
+
+// appendLoadCounter appends the code, which pushes i32 counter from the state passed in (ptrLocal, lenLocal) params to the stack.
+//
+// Empty state is treated as zero counter.
+func appendLoadCounter(dst []byte, ptrLocal, lenLocal byte) []byte {
+	return append(dst,
+		0x20, lenLocal, // local.get lenLocal
+		0x45,       // i32.eqz
+		0x04, 0x7f, // if (result i32)
+		0x41, 0x00, // i32.const 0
+		0x05,           // else
+		0x20, ptrLocal, // local.get ptrLocal
+		0x2d, 0x00, 0x00, // i32.load8_u
+		0x0b, // end
+	)
+}
+
+// newTestCountStatsModule returns WebAssembly module with stats functions, which count the number of rows.
+//
+// The state is a single byte with the counter at 512 offset.
+func newTestCountStatsModule() []byte {
+	storePrefix := []byte{
+		0x41, 0x80, 0x04, // i32.const 512
+	}
+	storeSuffix := []byte{
+		0x3a, 0x00, 0x00, // i32.store8
+
+		// return 512<<32 | 1
+		0x42, 0x80, 0x04, // i64.const 512
+		0x42, 0x20, // i64.const 32
+		0x86,       // i64.shl
+		0x42, 0x01, // i64.const 1
+		0x84, // i64.or
+	}
+
+	update := append([]byte{}, storePrefix...)
+	update = appendLoadCounter(update, 0, 1)
+	update = append(update,
+		0x41, 0x01, // i32.const 1
+		0x6a, // i32.add
+	)
+	update = append(update, storeSuffix...)
+
+	merge := append([]byte{}, storePrefix...)
+	merge = appendLoadCounter(merge, 0, 1)
+	merge = appendLoadCounter(merge, 2, 3)
+	merge = append(merge, 0x6a) // i32.add
+	merge = append(merge, storeSuffix...)
+
+	finalize := append([]byte{}, storePrefix...)
+	finalize = appendLoadCounter(finalize, 0, 1)
+	finalize = append(finalize,
+		0x41, 0x30, // i32.const '0'
+		0x6a, // i32.add
+	)
+	finalize = append(finalize, storeSuffix...)
+
+	return wasmplugin.NewTestModule("",
+		wasmplugin.TestFunc{
+			Name:      wasmStatsUpdateFunc,
+			ArgsCount: 2,
+			Code:      update,
+		},
+		wasmplugin.TestFunc{
+			Name:      wasmStatsMergeFunc,
+			ArgsCount: 2,
+			Code:      merge,
+		},
+		wasmplugin.TestFunc{
+			Name:      wasmStatsFinalizeFunc,
+			ArgsCount: 1,
+			Code:      finalize,
+		},
+	)
+}
+
+func newTestPipeModule(result string) []byte {
+	return wasmplugin.NewTestModule(result, wasmplugin.NewTestFuncReturningData(wasmPipeProcessRowFunc, 1, len(result)))
+}
+
+func TestParseFuncConfigsFailure(t *testing.T) {
+	f := func(items ...string) {
+		t.Helper()
+
+		if _, err := parseFuncConfigs("search.wasmPipe", items); err == nil {
+			t.Fatalf("expecting non-nil error for %q", items)
+		}
+	}
+
+	f("foo")
+	f("=/path/to/foo.wasm")
+	f("foo=")
+	f("foo=/path/to/foo.wasm", "FOO=/path/to/bar.wasm")
+}
+
+func TestParseFuncConfigsSuccess(t *testing.T) {
+	fcs, err := parseFuncConfigs("search.wasmPipe", []string{"Foo=/path/to/foo.wasm", "bar=/path/to/a=b.wasm"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(fcs) != 2 {
+		t.Fatalf("unexpected number of items; got %d; want 2", len(fcs))
+	}
+	if s := fcs[0].String(); s != "foo=/path/to/foo.wasm" {
+		t.Fatalf("unexpected first item; got %q; want %q", s, "foo=/path/to/foo.wasm")
+	}
+	if s := fcs[1].String(); s != "bar=/path/to/a=b.wasm" {
+		t.Fatalf("unexpected second item; got %q; want %q", s, "bar=/path/to/a=b.wasm")
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	pipePath := writeTestModule(t, "pipe.wasm", newTestPipeModule("{}"))
+	statsPath := writeTestModule(t, "stats.wasm", newTestCountStatsModule())
+
+	f := func(pipes, statsFuncs []string, resultExpected bool) {
+		t.Helper()
+
+		origPipes, origStatsFuncs := *wasmPipes, *wasmStatsFuncs
+		*wasmPipes, *wasmStatsFuncs = pipes, statsFuncs
+		defer func() {
+			*wasmPipes, *wasmStatsFuncs = origPipes, origStatsFuncs
+		}()
+
+		err := CheckConfig()
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v; error: %v", result, resultExpected, err)
+		}
+	}
+
+	f(nil, nil, true)
+	f([]string{"my_pipe=" + pipePath}, []string{"my_count=" + statsPath}, true)
+
+	// clash with builtin pipe and stats function
+	f([]string{"fields=" + pipePath}, nil, false)
+	f(nil, []string{"count=" + statsPath}, false)
+
+	// clash between pipe and stats function
+	f([]string{"foo=" + pipePath}, []string{"foo=" + statsPath}, false)
+
+	// missing module
+	f([]string{"my_pipe=" + filepath.Join(t.TempDir(), "missing.wasm")}, nil, false)
+
+	// the module without the needed functions
+	f([]string{"my_pipe=" + statsPath}, nil, false)
+	f(nil, []string{"my_count=" + pipePath}, false)
+}
+
+func TestWASMPipe(t *testing.T) {
+	f := func(result string, resultExpected string) {
+		t.Helper()
+
+		m, err := loadModule(writeTestModule(t, "pipe.wasm", newTestPipeModule(result)), wasmPipeFuncs)
+		if err != nil {
+			t.Fatalf("cannot load module: %s", err)
+		}
+		defer m.MustClose()
+
+		wp := &wasmPipe{
+			m: m,
+		}
+		if nf := wp.NeededFields([]string{"foo"}); len(nf) != 1 || nf[0] != "*" {
+			t.Fatalf("unexpected needed fields: %q", nf)
+		}
+
+		fields := []logstorage.Field{
+			{
+				Name:  "_msg",
+				Value: "abc",
+			},
+		}
+		prefix := []logstorage.Field{
+			{
+				Name:  "prefix",
+				Value: "x",
+			},
+		}
+		dst := wp.ProcessRow(prefix, []string{"foo", "bar"}, fields)
+		data := logstorage.MarshalFieldsToJSON(nil, dst)
+		if string(data) != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", data, resultExpected)
+		}
+	}
+
+	f(`{}`, `{"prefix":"x"}`)
+	f(`{"score":"high","n":12,"tags":["a","b"]}`, `{"prefix":"x","score":"high","n":"12","tags":"[\"a\",\"b\"]"}`)
+
+	// invalid results are ignored
+	f(`foo`, `{"prefix":"x"}`)
+	f(`null`, `{"prefix":"x"}`)
+}
+
+func TestWASMStatsFunc(t *testing.T) {
+	m, err := loadModule(writeTestModule(t, "stats.wasm", newTestCountStatsModule()), wasmStatsFuncFuncs)
+	if err != nil {
+		t.Fatalf("cannot load module: %s", err)
+	}
+	defer m.MustClose()
+
+	wsf := &wasmStatsFunc{
+		m: m,
+	}
+	fields := []logstorage.Field{
+		{
+			Name:  "_msg",
+			Value: "abc",
+		},
+	}
+
+	s1 := wsf.NewState([]string{"*"})
+	if result := s1.Finalize(); result != "0" {
+		t.Fatalf("unexpected result for empty state; got %q; want %q", result, "0")
+	}
+	stateSize := 0
+	for i := 0; i < 3; i++ {
+		stateSize += s1.Update(fields)
+	}
+	if stateSize != 1 {
+		t.Fatalf("unexpected state size; got %d; want 1", stateSize)
+	}
+	if result := s1.Finalize(); result != "3" {
+		t.Fatalf("unexpected result; got %q; want %q", result, "3")
+	}
+
+	s2 := wsf.NewState([]string{"*"})
+	s2.Update(fields)
+	s2.Update(fields)
+
+	// export and import the state
+	data := s2.Marshal(nil)
+	s3 := wsf.NewState([]string{"*"})
+	n, err := s3.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal state: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("unexpected state size after unmarshal; got %d; want 1", n)
+	}
+	if _, err := s3.Unmarshal(append(data, 'x')); err == nil {
+		t.Fatalf("expecting non-nil error when unmarshaling state with the tail")
+	}
+	if _, err := s3.Unmarshal(nil); err == nil {
+		t.Fatalf("expecting non-nil error when unmarshaling empty data")
+	}
+
+	s1.Merge(s3)
+	if result := s1.Finalize(); result != "5" {
+		t.Fatalf("unexpected result after merge; got %q; want %q", result, "5")
+	}
+
+	// merge with empty state
+	s1.Merge(wsf.NewState([]string{"*"}))
+	if result := s1.Finalize(); result != "5" {
+		t.Fatalf("unexpected result after merge with empty state; got %q; want %q", result, "5")
+	}
+}
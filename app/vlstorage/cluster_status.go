@@ -0,0 +1,167 @@
+package vlstorage
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netselect"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var processStartTime = time.Now()
+
+// GetNodeStatus returns the status of the current node.
+//
+// In cluster setup the returned status is aggregated across all the -storageNode nodes.
+func GetNodeStatus(ctx context.Context) *netselect.NodeStatus {
+	ns := &netselect.NodeStatus{
+		Healthy:       true,
+		Version:       buildinfo.Version,
+		UptimeSeconds: time.Since(processStartTime).Seconds(),
+	}
+
+	if localStorage == nil {
+		for _, sns := range netstorageSelect.GetClusterStatus(ctx) {
+			if !sns.Healthy {
+				continue
+			}
+			ns.IsReadOnly = ns.IsReadOnly || sns.IsReadOnly
+			ns.FreeDiskSpaceBytes += sns.FreeDiskSpaceBytes
+			ns.TotalDiskSpaceBytes += sns.TotalDiskSpaceBytes
+			ns.DataSizeBytes += sns.DataSizeBytes
+			ns.RowsCount += sns.RowsCount
+			ns.IngestionRate += sns.IngestionRate
+			ns.MaxIngestedTimestamp = max(ns.MaxIngestedTimestamp, sns.MaxIngestedTimestamp)
+			ns.LagSeconds = max(ns.LagSeconds, sns.LagSeconds)
+		}
+		return ns
+	}
+
+	var ss logstorage.StorageStats
+	localStorage.UpdateStats(&ss)
+
+	ns.IsReadOnly = ss.IsReadOnly
+	ns.FreeDiskSpaceBytes = fs.MustGetFreeSpace(*storageDataPath)
+	ns.TotalDiskSpaceBytes = fs.MustGetTotalSpace(*storageDataPath)
+	ns.DataSizeBytes = ss.CompressedInmemorySize + ss.CompressedSmallPartSize + ss.CompressedBigPartSize
+	ns.RowsCount = ss.InmemoryRowsCount + ss.SmallPartRowsCount + ss.BigPartRowsCount
+	ns.IngestionRate = localIngestionRate.get(ss.RowsIngested)
+	ns.MaxIngestedTimestamp = ss.MaxIngestedTimestamp
+	return ns
+}
+
+// ingestionRateTracker calculates the ingestion rate for the local storage.
+//
+// The rate is re-calculated on status requests if at least ingestionRateMinInterval passed since the previous calculation.
+type ingestionRateTracker struct {
+	mu sync.Mutex
+
+	prevTime time.Time
+	prevRows uint64
+	rate     float64
+}
+
+// ingestionRateMinInterval is the minimum interval for calculating the ingestion rate.
+const ingestionRateMinInterval = 10 * time.Second
+
+var localIngestionRate ingestionRateTracker
+
+func (rt *ingestionRateTracker) get(rows uint64) float64 {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.prevTime.IsZero() {
+		rt.prevTime = processStartTime
+	}
+
+	now := time.Now()
+	if d := now.Sub(rt.prevTime); d >= ingestionRateMinInterval {
+		if rows >= rt.prevRows {
+			rt.rate = float64(rows-rt.prevRows) / d.Seconds()
+		}
+		rt.prevTime = now
+		rt.prevRows = rows
+	}
+	return rt.rate
+}
+
+// clusterStatusResponse is the response for /admin/cluster/status
+type clusterStatusResponse struct {
+	HealthyNodes   int                     `json:"healthy_nodes"`
+	UnhealthyNodes int                     `json:"unhealthy_nodes"`
+	Nodes          []*netselect.NodeStatus `json:"nodes"`
+}
+
+func processClusterStatus(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage != nil {
+		// Cluster status is available only in cluster mode
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, clusterStatusAuthKey) {
+		return true
+	}
+
+	nodes := netstorageSelect.GetClusterStatus(r.Context())
+	resp := &clusterStatusResponse{
+		Nodes: nodes,
+	}
+	for _, ns := range nodes {
+		if ns.Healthy {
+			resp.HealthyNodes++
+		} else {
+			resp.UnhealthyNodes++
+		}
+	}
+
+	switch format := r.FormValue("format"); format {
+	case "", "json":
+		writeJSONResponse(w, resp)
+	case "html":
+		writeClusterStatusHTML(w, resp)
+	default:
+		httpserver.Errorf(w, r, "unsupported format=%q; supported values: json, html", format)
+	}
+	return true
+}
+
+func writeClusterStatusHTML(w http.ResponseWriter, resp *clusterStatusResponse) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	fmt.Fprintf(w, "<h2>VictoriaLogs cluster status</h2>")
+	fmt.Fprintf(w, "Healthy nodes: %d, unhealthy nodes: %d<br>", resp.HealthyNodes, resp.UnhealthyNodes)
+	fmt.Fprintf(w, "See docs at <a href='https://docs.victoriametrics.com/victorialogs/cluster/#cluster-status'>https://docs.victoriametrics.com/victorialogs/cluster/#cluster-status</a><br>")
+	fmt.Fprintf(w, "<table border='1' cellpadding='4' style='border-collapse: collapse'>")
+	fmt.Fprintf(w, "<tr><th>Address</th><th>Zone</th><th>Status</th><th>Version</th><th>Uptime</th><th>Disk usage</th><th>Data size</th><th>Rows</th>"+
+		"<th>Ingestion rate</th><th>Max ingested timestamp</th><th>Lag</th><th>Response time</th></tr>")
+	for _, ns := range resp.Nodes {
+		status := "healthy"
+		if !ns.Healthy {
+			status = "unhealthy: " + ns.Error
+		} else if ns.IsReadOnly {
+			status = "read-only"
+		}
+		diskUsage := "-"
+		if ns.TotalDiskSpaceBytes > 0 {
+			usedBytes := ns.TotalDiskSpaceBytes - min(ns.FreeDiskSpaceBytes, ns.TotalDiskSpaceBytes)
+			diskUsage = fmt.Sprintf("%.1f%% of %.1f GiB", 100*float64(usedBytes)/float64(ns.TotalDiskSpaceBytes), float64(ns.TotalDiskSpaceBytes)/(1<<30))
+		}
+		maxIngestedTimestamp := "-"
+		if ns.MaxIngestedTimestamp > 0 {
+			maxIngestedTimestamp = time.Unix(0, ns.MaxIngestedTimestamp).UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%.1f MiB</td><td>%d</td><td>%.1f/s</td><td>%s</td><td>%.1fs</td><td>%.3fs</td></tr>",
+			html.EscapeString(ns.Addr), html.EscapeString(ns.Zone), html.EscapeString(status), html.EscapeString(ns.Version),
+			time.Duration(ns.UptimeSeconds)*time.Second, diskUsage, float64(ns.DataSizeBytes)/(1<<20), ns.RowsCount,
+			ns.IngestionRate, maxIngestedTimestamp, ns.LagSeconds, ns.ResponseTimeSeconds)
+	}
+	fmt.Fprintf(w, "</table>")
+}
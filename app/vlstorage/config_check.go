@@ -0,0 +1,77 @@
+package vlstorage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+// CheckConfig verifies storage command-line flags without opening the storage and without connecting to -storageNode addresses.
+//
+// For local storage it also verifies that -storageDataPath and -storage.extraDataPaths are writable
+// and have at least -storage.minFreeDiskSpaceBytes of free space.
+func CheckConfig() error {
+	if len(*storageNodeAddrs) > 0 {
+		_, _, _, err := getStorageNodesConfig()
+		return err
+	}
+
+	var errs []error
+	if _, err := getStorageConfig(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkDataPath(*storageDataPath, minFreeDiskSpaceBytes.N); err != nil {
+		errs = append(errs, fmt.Errorf("invalid -storageDataPath=%q: %w", *storageDataPath, err))
+	}
+	for _, path := range *extraDataPaths {
+		if err := checkDataPath(path, minFreeDiskSpaceBytes.N); err != nil {
+			errs = append(errs, fmt.Errorf("invalid -storage.extraDataPaths=%q: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkDataPath verifies that the directory at path can be used for storing data.
+//
+// The directory at path is created on storage start if it is missing, so the nearest existing parent directory is verified in this case.
+func checkDataPath(path string, minFreeSpace int64) error {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("cannot obtain absolute path: %w", err)
+	}
+	for {
+		fi, err := os.Stat(dir)
+		if err == nil {
+			if !fi.IsDir() {
+				return fmt.Errorf("%q isn't a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("cannot find existing parent directory")
+		}
+		dir = parent
+	}
+
+	f, err := os.CreateTemp(dir, ".config-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %q isn't writable: %w", dir, err)
+	}
+	_ = f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("cannot remove temporary file: %w", err)
+	}
+
+	freeSpace := fs.MustGetFreeSpace(dir)
+	if minFreeSpace > 0 && freeSpace < uint64(minFreeSpace) {
+		return fmt.Errorf("free disk space at %q is %d bytes, which is smaller than -storage.minFreeDiskSpaceBytes=%d", dir, freeSpace, minFreeSpace)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package vlstorage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDataPathSuccess(t *testing.T) {
+	dir := t.TempDir()
+
+	f := func(path string) {
+		t.Helper()
+
+		if err := checkDataPath(path, 1); err != nil {
+			t.Fatalf("unexpected error for %q: %s", path, err)
+		}
+	}
+
+	// existing directory
+	f(dir)
+
+	// missing directory inside existing directory
+	f(filepath.Join(dir, "foo", "bar"))
+
+	// temporary files must be removed after the check
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("cannot read %q: %s", dir, err)
+	}
+	if len(des) != 0 {
+		t.Fatalf("unexpected entries left at %q: %d", dir, len(des))
+	}
+}
+
+func TestCheckDataPathFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	f := func(path string, minFreeSpace int64) {
+		t.Helper()
+
+		if err := checkDataPath(path, minFreeSpace); err == nil {
+			t.Fatalf("expecting non-nil error for %q", path)
+		}
+	}
+
+	// path points to a file
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("cannot create %q: %s", file, err)
+	}
+	f(file, 0)
+	f(filepath.Join(file, "foo"), 0)
+
+	// not enough free disk space
+	f(dir, 1<<62)
+}
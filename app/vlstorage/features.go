@@ -0,0 +1,35 @@
+package vlstorage
+
+// Features contains storage capabilities of the current VictoriaLogs instance.
+type Features struct {
+	// Mode is set to "local" when logs are stored at -storageDataPath and to "cluster" when logs are stored at -storageNode nodes.
+	Mode string `json:"mode"`
+
+	// StorageNodes is the number of -storageNode nodes in cluster mode.
+	StorageNodes int `json:"storage_nodes,omitempty"`
+
+	// RetentionPeriod is the value of -retentionPeriod command-line flag in local mode.
+	RetentionPeriod string `json:"retention_period,omitempty"`
+
+	// FutureRetention is the value of -futureRetention command-line flag in local mode.
+	FutureRetention string `json:"future_retention,omitempty"`
+
+	// WALEnabled is set to true when write-ahead log is enabled via -storage.walEnable command-line flag in local mode.
+	WALEnabled bool `json:"wal_enabled"`
+}
+
+// GetFeatures returns storage capabilities of the current VictoriaLogs instance.
+func GetFeatures() *Features {
+	if len(*storageNodeAddrs) > 0 {
+		return &Features{
+			Mode:         "cluster",
+			StorageNodes: len(*storageNodeAddrs),
+		}
+	}
+	return &Features{
+		Mode:            "local",
+		RetentionPeriod: retentionPeriod.String(),
+		FutureRetention: futureRetention.String(),
+		WALEnabled:      *walEnable,
+	}
+}
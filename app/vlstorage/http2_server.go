@@ -0,0 +1,116 @@
+package vlstorage
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	http2ListenAddr = flag.String("internal.http2ListenAddr", "", "Optional TCP address to listen for internal cluster requests from vlinsert and vlselect over HTTP/2 without TLS. "+
+		"HTTP/2 multiplexes concurrent requests over a small number of connections, which reduces connection churn in clusters with big number of nodes. "+
+		"vlinsert and vlselect must be configured with -storageNode.http2 for using this address. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#http2-for-internal-communications")
+	http2MaxConcurrentStreams = flag.Int("internal.http2MaxConcurrentStreams", 1000, "The maximum number of concurrent requests per every HTTP/2 connection accepted at -internal.http2ListenAddr")
+)
+
+var http2Server *http.Server
+
+var http2Requests = metrics.NewCounter(`vl_http2_internal_requests_total`)
+
+// MustStartHTTP2Server starts serving internal cluster requests via rh at -internal.http2ListenAddr if it is set.
+//
+// Only /internal/insert, /internal/select/* and /internal/delete/* requests are served.
+// MustStopHTTP2Server must be called when the server is no longer needed.
+func MustStartHTTP2Server(rh httpserver.RequestHandler) {
+	if *http2ListenAddr == "" {
+		return
+	}
+
+	ln, err := net.Listen("tcp", *http2ListenAddr)
+	if err != nil {
+		logger.Fatalf("cannot start listening at -internal.http2ListenAddr=%q: %s", *http2ListenAddr, err)
+	}
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	s := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleHTTP2Request(w, r, rh)
+		}),
+		Protocols: &protocols,
+		HTTP2: &http.HTTP2Config{
+			MaxConcurrentStreams: *http2MaxConcurrentStreams,
+		},
+		ReadHeaderTimeout: 5 * time.Second,
+		ErrorLog:          logger.StdErrorLogger(),
+	}
+	http2Server = s
+
+	logger.Infof("started serving internal cluster requests over HTTP/2 at -internal.http2ListenAddr=%q", *http2ListenAddr)
+	go func() {
+		if err := s.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("cannot serve internal cluster requests at -internal.http2ListenAddr=%q: %s", *http2ListenAddr, err)
+		}
+	}()
+}
+
+// MustStopHTTP2Server stops the server started via MustStartHTTP2Server.
+func MustStopHTTP2Server() {
+	if http2Server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := http2Server.Shutdown(ctx); err != nil {
+		logger.Errorf("cannot gracefully stop the server at -internal.http2ListenAddr=%q: %s", *http2ListenAddr, err)
+	}
+	http2Server = nil
+}
+
+func handleHTTP2Request(w http.ResponseWriter, r *http.Request, rh httpserver.RequestHandler) {
+	// Stop the process on panic in the same way as httpserver does,
+	// since the state can become inconsistent after the recovered panic.
+	defer func() {
+		if err := recover(); err != nil {
+			buf := make([]byte, 1<<20)
+			n := runtime.Stack(buf, false)
+			fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", err, buf[:n])
+			os.Exit(1)
+		}
+	}()
+
+	http2Requests.Inc()
+
+	path := r.URL.Path
+	if path != "/internal/insert" && !strings.HasPrefix(path, "/internal/select/") && !strings.HasPrefix(path, "/internal/delete/") {
+		err := &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("unsupported path requested at -internal.http2ListenAddr: %q; only /internal/insert, /internal/select/* and /internal/delete/* paths are supported", path),
+			StatusCode: http.StatusNotFound,
+		}
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if !httpserver.CheckBasicAuth(w, r) {
+		return
+	}
+	if !rh(w, r) {
+		err := &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("unsupported path requested: %q", path),
+			StatusCode: http.StatusNotFound,
+		}
+		httpserver.Errorf(w, r, "%s", err)
+	}
+}
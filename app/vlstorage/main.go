@@ -8,8 +8,10 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
@@ -17,8 +19,10 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
 	"github.com/VictoriaMetrics/metrics"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netclient"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netinsert"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netselect"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
@@ -42,16 +46,49 @@ var (
 		"see https://docs.victoriametrics.com/victorialogs/#backfilling")
 	storageDataPath = flag.String("storageDataPath", "victoria-logs-data", "Path to directory where to store VictoriaLogs data; "+
 		"see https://docs.victoriametrics.com/victorialogs/#storage")
+	extraDataPaths = flagutil.NewArrayString("storage.extraDataPaths", "Optional list of additional directories for storing per-day partitions in addition to -storageDataPath. "+
+		"New partitions are created at the directory with the biggest amount of free disk space, while queries read partitions from all the directories. "+
+		"This allows using multiple local disks without RAID or LVM; see https://docs.victoriametrics.com/victorialogs/#multiple-disks")
 	inmemoryDataFlushInterval = flag.Duration("inmemoryDataFlushInterval", 5*time.Second, "The interval for guaranteed saving of in-memory data to disk. "+
 		"The saved data survives unclean shutdowns such as OOM crash, hardware reset, SIGKILL, etc. "+
 		"Bigger intervals may help increase the lifetime of flash storage with limited write cycles (e.g. Raspberry PI). "+
-		"Smaller intervals increase disk IO load. Minimum supported value is 1s")
+		"Smaller intervals increase disk IO load. Minimum supported value is 1s. See https://docs.victoriametrics.com/victorialogs/#flush-tuning")
 	logNewStreams = flag.Bool("logNewStreams", false, "Whether to log creation of new streams; this can be useful for debugging of high cardinality issues with log streams; "+
 		"see https://docs.victoriametrics.com/victorialogs/keyconcepts/#stream-fields ; see also -logIngestedRows")
 	logIngestedRows = flag.Bool("logIngestedRows", false, "Whether to log all the ingested log entries; this can be useful for debugging of data ingestion; "+
 		"see https://docs.victoriametrics.com/victorialogs/data-ingestion/ ; see also -logNewStreams")
+	tokenPositionsMaxDistance = flag.Int("storage.tokenPositionsMaxDistance", 0, "The maximum distance between words in log messages, which pairs are stored in bloom filters. "+
+		"This allows skipping data blocks without the needed adjacent words for multi-word phrase filters and without the needed nearby words for near() filters "+
+		"at the cost of bigger bloom filters for newly ingested logs. Zero value disables storing word pairs. The maximum supported value is 8; "+
+		"see https://docs.victoriametrics.com/victorialogs/logsql/#near-filter")
+	indexedFields = flagutil.NewArrayString("storage.indexedFields", "Optional list of log fields with many unique values such as trace_id or user_id, "+
+		"which must be indexed for speeding up exact and in() filters on these fields. The index is created only for newly ingested logs; "+
+		"see https://docs.victoriametrics.com/victorialogs/#indexed-fields")
+	enableHitsPreaggregation = flag.Bool("storage.enableHitsPreaggregation", false, "Whether to maintain per-stream per-minute hits for newly ingested logs. "+
+		"This allows answering /select/logsql/hits queries over long time ranges without scanning the stored logs at the cost of an additional file per data part; "+
+		"see https://docs.victoriametrics.com/victorialogs/querying/#pre-aggregated-hits")
 	minFreeDiskSpaceBytes = flagutil.NewBytes("storage.minFreeDiskSpaceBytes", 10e6, "The minimum free disk space at -storageDataPath after which "+
 		"the storage stops accepting new data")
+	pendingRowsFlushInterval = flag.Duration("storage.pendingRowsFlushInterval", time.Second, "The maximum duration the ingested logs may stay in in-memory buffers "+
+		"before becoming available for querying. Smaller values reduce the delay before the ingested logs become visible in query results at the cost of higher CPU usage. "+
+		"The value cannot exceed -inmemoryDataFlushInterval. See https://docs.victoriametrics.com/victorialogs/#flush-tuning")
+	maxPendingRowsSize = flagutil.NewBytes("storage.maxPendingRowsSize", logstorage.MaxPendingRowsSize, "The maximum size of in-memory buffer for the ingested logs per CPU core. "+
+		"The buffer is converted to a searchable in-memory part when its size exceeds this limit. Smaller values reduce memory usage at the cost of more frequent background merges. "+
+		"See https://docs.victoriametrics.com/victorialogs/#flush-tuning")
+	maxInmemoryPartSize = flagutil.NewBytes("storage.maxInmemoryPartSize", 0, "The maximum size of in-memory parts with the recently ingested logs. Bigger parts are written to disk "+
+		"without waiting for -inmemoryDataFlushInterval. By default the limit depends on the available memory; see -memory.allowedPercent and -memory.allowedBytes . "+
+		"See https://docs.victoriametrics.com/victorialogs/#flush-tuning")
+	mergeConcurrency = flag.Int("storage.mergeConcurrency", 0, "The maximum number of concurrent background merges per every part type. "+
+		"By default it equals to the number of available CPU cores, which takes into account cgroup CPU limits. "+
+		"Smaller values reduce CPU usage by background merges at the cost of higher number of unmerged parts; "+
+		"see https://docs.victoriametrics.com/victorialogs/#resource-autotuning")
+	walEnable = flag.Bool("storage.walEnable", false, "Whether to write the ingested logs to write-ahead log before adding them to the storage. "+
+		"This allows recovering recently ingested logs, which weren't written to disk yet, after unclean shutdown at the cost of additional disk IO; "+
+		"see https://docs.victoriametrics.com/victorialogs/#write-ahead-log")
+	walSyncPolicy = flag.String("storage.walSyncPolicy", "interval", "The policy for syncing write-ahead log to disk if -storage.walEnable is set. "+
+		"Supported values: interval, always, none. See https://docs.victoriametrics.com/victorialogs/#write-ahead-log ; see also -storage.walSyncInterval")
+	walSyncInterval = flag.Duration("storage.walSyncInterval", time.Second, "The interval for syncing write-ahead log to disk if -storage.walEnable is set "+
+		"and -storage.walSyncPolicy=interval. See https://docs.victoriametrics.com/victorialogs/#write-ahead-log")
 
 	logNewStreamsAuthKey = flagutil.NewPassword("logNewStreamsAuthKey", "authKey, which must be passed in query string to /internal/log_new_streams . It overrides -httpAuth.* . "+
 		"See https://docs.victoriametrics.com/victorialogs/#logging-new-streams")
@@ -60,16 +97,40 @@ var (
 	forceFlushAuthKey = flagutil.NewPassword("forceFlushAuthKey", "authKey, which must be passed in query string to /internal/force_flush . It overrides -httpAuth.* . "+
 		"See https://docs.victoriametrics.com/victorialogs/#forced-flush")
 
+	tenantRetentionPeriods = flagutil.NewArrayString("retention.tenantPeriod", "Optional per-tenant retention in the form 'accountID:projectID=duration'. "+
+		"Logs for the given tenant older than the given duration are automatically deleted. The duration cannot exceed -retentionPeriod; "+
+		"see https://docs.victoriametrics.com/victorialogs/#per-tenant-retention")
+	inactiveTenantPeriod = flagutil.NewRetentionDuration("retention.inactiveTenantPeriod", "0", "All the logs for tenants without newly ingested logs "+
+		"during the given period are automatically deleted. Zero value disables automatic deletion of inactive tenants; "+
+		"see https://docs.victoriametrics.com/victorialogs/#per-tenant-retention")
+	tenantRetentionAuthKey = flagutil.NewPassword("tenantRetentionAuthKey", "authKey, which must be passed in query string to /internal/tenant_retention/report . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/#per-tenant-retention")
+
 	partitionManageAuthKey = flagutil.NewPassword("partitionManageAuthKey", "authKey, which must be passed in query string to /internal/partition/* . It overrides -httpAuth.* . "+
 		"See https://docs.victoriametrics.com/victorialogs/#partitions-lifecycle")
 
+	legalHoldAuthKey = flagutil.NewPassword("legalHoldAuthKey", "authKey, which must be passed in query string to /internal/legal_hold/* . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/#legal-hold")
+
+	streamsRelabelAuthKey = flagutil.NewPassword("streamsRelabelAuthKey", "authKey, which must be passed in query string to /internal/streams/relabel . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/#stream-labels-migration")
+
+	clusterStatusAuthKey = flagutil.NewPassword("clusterStatusAuthKey", "authKey, which must be passed in query string to /admin/cluster/status . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#cluster-status")
+
 	storageNodeAddrs = flagutil.NewArrayString("storageNode", "Comma-separated list of TCP addresses for storage nodes to route the ingested logs to and to send select queries to. "+
+		"Every address may contain multiple replicas delimited by '|' such as 'vlstorage-a:9428|vlstorage-b:9428'; the ingested logs are replicated to all of them, "+
+		"while select queries are sent to the first available replica. See https://docs.victoriametrics.com/victorialogs/cluster/#hedged-requests . "+
 		"If the list is empty, then the ingested logs are stored and queried locally from -storageDataPath")
 	insertConcurrency        = flag.Int("insert.concurrency", 2, "The average number of concurrent data ingestion requests, which can be sent to every -storageNode")
 	insertDisableCompression = flag.Bool("insert.disableCompression", false, "Whether to disable compression when sending the ingested data to -storageNode nodes. "+
 		"Disabled compression reduces CPU usage at the cost of higher network usage")
 	selectDisableCompression = flag.Bool("select.disableCompression", false, "Whether to disable compression for select query responses received from -storageNode nodes. "+
 		"Disabled compression reduces CPU usage at the cost of higher network usage")
+	insertCompressionLevel = flag.Int("insert.compressionLevel", netclient.DefaultCompressionLevel, "zstd compression level to use when sending the ingested data to -storageNode nodes. "+
+		"Higher levels reduce network usage at the cost of higher CPU usage. Supported range: [1...22]. See https://docs.victoriametrics.com/victorialogs/cluster/#compression")
+	selectCompressionLevel = flag.Int("select.compressionLevel", netclient.DefaultCompressionLevel, "zstd compression level, which must be used by -storageNode nodes when sending select query responses. "+
+		"Higher levels reduce network usage at the cost of higher CPU usage at -storageNode nodes. Supported range: [1...22]. See https://docs.victoriametrics.com/victorialogs/cluster/#compression")
 
 	storageNodeUsername     = flagutil.NewArrayString("storageNode.username", "Optional basic auth username to use for the corresponding -storageNode")
 	storageNodeUsernameFile = flagutil.NewArrayString("storageNode.usernameFile", "Optional path to basic auth username to use for the corresponding -storageNode. "+
@@ -91,6 +152,13 @@ var (
 	storageNodeTLSServerName = flagutil.NewArrayString("storageNode.tlsServerName", "Optional TLS server name to use for connections to the corresponding -storageNode. "+
 		"By default, the server name from -storageNode is used")
 	storageNodeTLSInsecureSkipVerify = flagutil.NewArrayBool("storageNode.tlsInsecureSkipVerify", "Whether to skip tls verification when connecting to the corresponding -storageNode")
+	storageNodeHTTP2                 = flagutil.NewArrayBool("storageNode.http2", "Whether to use HTTP/2 without TLS for communicating with the corresponding -storageNode. "+
+		"The -storageNode must point to -internal.http2ListenAddr at the storage node in this case. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#http2-for-internal-communications")
+	storageNodeZone = flagutil.NewArrayString("storageNode.zone", "Optional zone for the corresponding -storageNode. Zones for replicas must be delimited by '|' "+
+		"in the same order as replica addresses at -storageNode, e.g. 'zone-a|zone-b'. See -select.zone and https://docs.victoriametrics.com/victorialogs/cluster/#read-preference")
+	storageNodeTier = flagutil.NewArrayString("storageNode.tier", "Optional retention tier for the corresponding -storageNode. Supported values: hot, cold. "+
+		"See -select.hotTierRetention and https://docs.victoriametrics.com/victorialogs/cluster/#retention-tiers")
 )
 
 var localStorage *logstorage.Storage
@@ -111,20 +179,82 @@ func Init() {
 	}
 }
 
+// IsLocalStorage returns true if the logs are stored locally instead of being sent to -storageNode nodes.
+func IsLocalStorage() bool {
+	return len(*storageNodeAddrs) == 0
+}
+
 func initLocalStorage() {
 	if localStorage != nil {
 		logger.Panicf("BUG: initLocalStorage() has been already called")
 	}
 
+	cfg, err := getStorageConfig()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	logstorage.SetMergeConcurrency(*mergeConcurrency)
+	logResources(logstorage.GetMergeConcurrency())
+
+	logger.Infof("opening storage at -storageDataPath=%s", *storageDataPath)
+	startTime := time.Now()
+	localStorage = logstorage.MustOpenStorage(*storageDataPath, cfg)
+
+	var ss logstorage.StorageStats
+	localStorage.UpdateStats(&ss)
+	logger.Infof("successfully opened storage in %.3f seconds; smallParts: %d; bigParts: %d; smallPartBlocks: %d; bigPartBlocks: %d; smallPartRows: %d; bigPartRows: %d; "+
+		"smallPartSize: %d bytes; bigPartSize: %d bytes",
+		time.Since(startTime).Seconds(), ss.SmallParts, ss.BigParts, ss.SmallPartBlocks, ss.BigPartBlocks, ss.SmallPartRowsCount, ss.BigPartRowsCount,
+		ss.CompressedSmallPartSize, ss.CompressedBigPartSize)
+
+	// register local storage metrics
+	localStorageMetrics = metrics.NewSet()
+	localStorageMetrics.RegisterMetricsWriter(func(w io.Writer) {
+		writeStorageMetrics(w, localStorage)
+	})
+	metrics.RegisterSet(localStorageMetrics)
+}
+
+// getStorageConfig returns local storage config obtained from command-line flags.
+func getStorageConfig() (*logstorage.StorageConfig, error) {
 	if retentionPeriod.Duration() < 24*time.Hour {
-		logger.Fatalf("-retentionPeriod cannot be smaller than a day; got %s", retentionPeriod)
+		return nil, fmt.Errorf("-retentionPeriod cannot be smaller than a day; got %s", retentionPeriod)
 	}
 	// Validate mutually exclusive retention flags and their values
 	if maxDiskSpaceUsageBytes.N > 0 && *maxDiskUsagePercent > 0 {
-		logger.Fatalf("-retention.maxDiskSpaceUsageBytes and -retention.maxDiskUsagePercent cannot be set simultaneously")
+		return nil, fmt.Errorf("-retention.maxDiskSpaceUsageBytes and -retention.maxDiskUsagePercent cannot be set simultaneously")
 	}
 	if *maxDiskUsagePercent < 0 || *maxDiskUsagePercent > 100 {
-		logger.Fatalf("-retention.maxDiskUsagePercent must be between 1 and 100; got %d", *maxDiskUsagePercent)
+		return nil, fmt.Errorf("-retention.maxDiskUsagePercent must be between 1 and 100; got %d", *maxDiskUsagePercent)
+	}
+	if *tokenPositionsMaxDistance < 0 || *tokenPositionsMaxDistance > logstorage.MaxTokenPositionsDistance {
+		return nil, fmt.Errorf("-storage.tokenPositionsMaxDistance must be in the range [0..%d]; got %d", logstorage.MaxTokenPositionsDistance, *tokenPositionsMaxDistance)
+	}
+	tenantRetentions, err := parseTenantRetentions(*tenantRetentionPeriods, retentionPeriod.Duration())
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -retention.tenantPeriod: %w", err)
+	}
+	if *inmemoryDataFlushInterval < time.Second {
+		return nil, fmt.Errorf("-inmemoryDataFlushInterval cannot be smaller than 1s; got %s", *inmemoryDataFlushInterval)
+	}
+	if *pendingRowsFlushInterval < 10*time.Millisecond || *pendingRowsFlushInterval > *inmemoryDataFlushInterval {
+		return nil, fmt.Errorf("-storage.pendingRowsFlushInterval must be in the range [10ms..%s]; got %s; see -inmemoryDataFlushInterval", *inmemoryDataFlushInterval, *pendingRowsFlushInterval)
+	}
+	if maxPendingRowsSize.N < logstorage.MinPendingRowsSize || maxPendingRowsSize.N > logstorage.MaxPendingRowsSize {
+		return nil, fmt.Errorf("-storage.maxPendingRowsSize must be in the range [%d..%d] bytes; got %d bytes", logstorage.MinPendingRowsSize, logstorage.MaxPendingRowsSize, maxPendingRowsSize.N)
+	}
+	if maxInmemoryPartSize.N != 0 && maxInmemoryPartSize.N < 1e6 {
+		return nil, fmt.Errorf("-storage.maxInmemoryPartSize cannot be smaller than 1MB; got %d bytes", maxInmemoryPartSize.N)
+	}
+	if *mergeConcurrency < 0 {
+		return nil, fmt.Errorf("-storage.mergeConcurrency cannot be negative; got %d", *mergeConcurrency)
+	}
+	walPolicy, err := logstorage.ParseWALSyncPolicy(*walSyncPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -storage.walSyncPolicy: %w", err)
+	}
+	if *walSyncInterval <= 0 {
+		return nil, fmt.Errorf("-storage.walSyncInterval must be positive; got %s", *walSyncInterval)
 	}
 	cfg := &logstorage.StorageConfig{
 		Retention:              retentionPeriod.Duration(),
@@ -137,24 +267,58 @@ func initLocalStorage() {
 		LogNewStreams:          *logNewStreams,
 		LogIngestedRows:        *logIngestedRows,
 		MinFreeDiskSpaceBytes:  minFreeDiskSpaceBytes.N,
+
+		TenantRetentions:        tenantRetentions,
+		InactiveTenantRetention: inactiveTenantPeriod.Duration(),
+
+		TokenPositionsMaxDistance: *tokenPositionsMaxDistance,
+		IndexedFields:             *indexedFields,
+		EnableHitsPreaggregation:  *enableHitsPreaggregation,
+
+		ExtraPaths:               *extraDataPaths,
+		PendingRowsFlushInterval: *pendingRowsFlushInterval,
+		MaxPendingRowsSize:       int(maxPendingRowsSize.N),
+		MaxInmemoryPartSize:      maxInmemoryPartSize.N,
+
+		EnableWAL:       *walEnable,
+		WALSyncPolicy:   walPolicy,
+		WALSyncInterval: *walSyncInterval,
 	}
-	logger.Infof("opening storage at -storageDataPath=%s", *storageDataPath)
-	startTime := time.Now()
-	localStorage = logstorage.MustOpenStorage(*storageDataPath, cfg)
+	return cfg, nil
+}
 
-	var ss logstorage.StorageStats
-	localStorage.UpdateStats(&ss)
-	logger.Infof("successfully opened storage in %.3f seconds; smallParts: %d; bigParts: %d; smallPartBlocks: %d; bigPartBlocks: %d; smallPartRows: %d; bigPartRows: %d; "+
-		"smallPartSize: %d bytes; bigPartSize: %d bytes",
-		time.Since(startTime).Seconds(), ss.SmallParts, ss.BigParts, ss.SmallPartBlocks, ss.BigPartBlocks, ss.SmallPartRowsCount, ss.BigPartRowsCount,
-		ss.CompressedSmallPartSize, ss.CompressedBigPartSize)
+// parseTenantRetentions parses per-tenant retentions in the form 'accountID:projectID=duration'.
+func parseTenantRetentions(a []string, maxRetention time.Duration) (map[logstorage.TenantID]time.Duration, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
 
-	// register local storage metrics
-	localStorageMetrics = metrics.NewSet()
-	localStorageMetrics.RegisterMetricsWriter(func(w io.Writer) {
-		writeStorageMetrics(w, localStorage)
-	})
-	metrics.RegisterSet(localStorageMetrics)
+	m := make(map[logstorage.TenantID]time.Duration, len(a))
+	for _, s := range a {
+		n := strings.LastIndexByte(s, '=')
+		if n < 0 {
+			return nil, fmt.Errorf("missing '=' in %q; expecting 'accountID:projectID=duration'", s)
+		}
+		tenantID, err := logstorage.ParseTenantID(s[:n])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse tenant at %q: %w", s, err)
+		}
+		d, err := timeutil.ParseDuration(s[n+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse retention at %q: %w", s, err)
+		}
+		if d < 24*time.Hour {
+			return nil, fmt.Errorf("retention at %q cannot be smaller than a day", s)
+		}
+		if d > maxRetention {
+			return nil, fmt.Errorf("retention at %q cannot exceed -retentionPeriod=%s", s, retentionPeriod)
+		}
+		if _, ok := m[tenantID]; ok {
+			return nil, fmt.Errorf("duplicate retention for tenant %s", tenantID)
+		}
+		m[tenantID] = d
+	}
+	return m, nil
 }
 
 func initNetworkStorage() {
@@ -162,23 +326,67 @@ func initNetworkStorage() {
 		logger.Panicf("BUG: initNetworkStorage() has been already called")
 	}
 
-	authCfgs := make([]*promauth.Config, len(*storageNodeAddrs))
-	isTLSs := make([]bool, len(*storageNodeAddrs))
-	for i := range authCfgs {
-		authCfgs[i] = newAuthConfigForStorageNode(i)
-		isTLSs[i] = storageNodeTLS.GetOptionalArg(i)
+	authCfgs, isTLSs, useHTTP2s, err := getStorageNodesConfig()
+	if err != nil {
+		logger.Fatalf("%s", err)
 	}
 
 	logger.Infof("starting insert service for nodes %s", *storageNodeAddrs)
-	netstorageInsert = netinsert.NewStorage(*storageNodeAddrs, authCfgs, isTLSs, *insertConcurrency, *insertDisableCompression)
+	netstorageInsert = netinsert.NewStorage(*storageNodeAddrs, authCfgs, isTLSs, useHTTP2s, *insertConcurrency, *insertDisableCompression, *insertCompressionLevel)
 
 	logger.Infof("initializing select service for nodes %s", *storageNodeAddrs)
-	netstorageSelect = netselect.NewStorage(*storageNodeAddrs, authCfgs, isTLSs, *selectDisableCompression)
+	zones := make([]string, len(*storageNodeAddrs))
+	for i := range zones {
+		zones[i] = storageNodeZone.GetOptionalArg(i)
+	}
+	tiers := getStorageNodeTiers()
+	netstorageSelect = netselect.NewStorage(*storageNodeAddrs, authCfgs, isTLSs, useHTTP2s, zones, tiers, *selectDisableCompression, *selectCompressionLevel)
 
 	logger.Infof("initialized all the network services")
 }
 
-func newAuthConfigForStorageNode(argIdx int) *promauth.Config {
+// getStorageNodesConfig returns auth configs, TLS and HTTP/2 settings for -storageNode addresses obtained from command-line flags.
+func getStorageNodesConfig() ([]*promauth.Config, []bool, []bool, error) {
+	authCfgs := make([]*promauth.Config, len(*storageNodeAddrs))
+	isTLSs := make([]bool, len(*storageNodeAddrs))
+	useHTTP2s := make([]bool, len(*storageNodeAddrs))
+	for i := range authCfgs {
+		ac, err := newAuthConfigForStorageNode(i)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("cannot populate auth config for -storageNode=%q: %w", (*storageNodeAddrs)[i], err)
+		}
+		authCfgs[i] = ac
+		isTLSs[i] = storageNodeTLS.GetOptionalArg(i)
+		useHTTP2s[i] = storageNodeHTTP2.GetOptionalArg(i)
+		if isTLSs[i] && useHTTP2s[i] {
+			return nil, nil, nil, fmt.Errorf("-storageNode.http2 cannot be used together with -storageNode.tls for -storageNode=%q", (*storageNodeAddrs)[i])
+		}
+		if len(netclient.SplitReplicaAddrs((*storageNodeAddrs)[i])) == 0 {
+			return nil, nil, nil, fmt.Errorf("-storageNode=%q must contain at least a single address", (*storageNodeAddrs)[i])
+		}
+	}
+
+	if err := netclient.CheckCompressionLevel(*insertCompressionLevel); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid -insert.compressionLevel: %w", err)
+	}
+	if err := netclient.CheckCompressionLevel(*selectCompressionLevel); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid -select.compressionLevel: %w", err)
+	}
+	if err := netselect.CheckTiers(getStorageNodeTiers()); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid -storageNode.tier: %w", err)
+	}
+	return authCfgs, isTLSs, useHTTP2s, nil
+}
+
+func getStorageNodeTiers() []string {
+	tiers := make([]string, len(*storageNodeAddrs))
+	for i := range tiers {
+		tiers[i] = storageNodeTier.GetOptionalArg(i)
+	}
+	return tiers
+}
+
+func newAuthConfigForStorageNode(argIdx int) (*promauth.Config, error) {
 	username := storageNodeUsername.GetOptionalArg(argIdx)
 	usernameFile := storageNodeUsernameFile.GetOptionalArg(argIdx)
 	password := storageNodePassword.GetOptionalArg(argIdx)
@@ -210,12 +418,7 @@ func newAuthConfigForStorageNode(argIdx int) *promauth.Config {
 		BearerTokenFile: tokenFile,
 		TLSConfig:       tlsCfg,
 	}
-	ac, err := opts.NewConfig()
-	if err != nil {
-		logger.Panicf("FATAL: cannot populate auth config for storage node #%d: %s", argIdx, err)
-	}
-
-	return ac
+	return opts.NewConfig()
 }
 
 // Stop stops vlstorage.
@@ -255,10 +458,43 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return processPartitionSnapshotCreate(w, r)
 	case "/internal/partition/snapshot/list":
 		return processPartitionSnapshotList(w, r)
+	case "/internal/partition/seal":
+		return processPartitionSeal(w, r)
+	case "/internal/partition/hash/list":
+		return processPartitionHashList(w, r)
+	case "/internal/partition/hash/verify":
+		return processPartitionHashVerify(w, r)
+	case "/internal/tenant_retention/report":
+		return processTenantRetentionReport(w, r)
+	case "/internal/legal_hold/place":
+		return processLegalHoldPlace(w, r)
+	case "/internal/legal_hold/release":
+		return processLegalHoldRelease(w, r)
+	case "/internal/legal_hold/list":
+		return processLegalHoldList(w, r)
+	case "/internal/streams/relabel":
+		return processStreamsRelabel(w, r)
+	case "/admin/cluster/status":
+		return processClusterStatus(w, r)
+	case netclient.ProtocolVersionsPath:
+		return processProtocolVersions(w)
 	}
 	return false
 }
 
+// processProtocolVersions returns protocol versions supported by the current node for internal HTTP endpoints.
+//
+// It is used by vlinsert and vlselect for negotiating protocol versions with -storageNode nodes.
+// See https://docs.victoriametrics.com/victorialogs/cluster/#upgrading
+func processProtocolVersions(w http.ResponseWriter) bool {
+	pvs := netselect.SupportedProtocolVersions.Merge(netinsert.SupportedProtocolVersions)
+	data := netclient.MarshalProtocolVersionsResponse(buildinfo.Version, pvs)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+	return true
+}
+
 func processLogNewStreams(w http.ResponseWriter, r *http.Request) bool {
 	if localStorage == nil {
 		// logging of new streams is available only at local storage
@@ -420,6 +656,248 @@ func processPartitionSnapshotList(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
+func processPartitionSeal(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage == nil {
+		// There are no partitions in non-local storage
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, partitionManageAuthKey) {
+		return true
+	}
+
+	name := r.FormValue("name")
+	ph, err := localStorage.PartitionSeal(name)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+
+	writeJSONResponse(w, ph)
+	return true
+}
+
+func processPartitionHashList(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage == nil {
+		// There are no partitions in non-local storage
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, partitionManageAuthKey) {
+		return true
+	}
+
+	hashes := localStorage.PartitionHashList()
+	data := logstorage.MarshalPartitionHashesToJSON(hashes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+	return true
+}
+
+func processPartitionHashVerify(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage == nil {
+		// There are no partitions in non-local storage
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, partitionManageAuthKey) {
+		return true
+	}
+
+	name := r.FormValue("name")
+	results, err := localStorage.PartitionHashVerify(name)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+
+	writeJSONResponse(w, results)
+	return true
+}
+
+func processTenantRetentionReport(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage == nil {
+		// Per-tenant retention is applied at vlstorage nodes
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, tenantRetentionAuthKey) {
+		return true
+	}
+
+	tasks, err := localStorage.GetTenantRetentionTasks(r.Context(), time.Now().UnixNano())
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+
+	data := logstorage.MarshalTenantRetentionTasksToJSON(tasks)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+	return true
+}
+
+func processLegalHoldPlace(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage == nil {
+		// Legal holds are applied at vlstorage nodes
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, legalHoldAuthKey) {
+		return true
+	}
+
+	tenantID, err := logstorage.GetTenantIDFromRequest(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain tenantID: %s", err)
+		return true
+	}
+
+	filter := r.FormValue("filter")
+	if filter == "" {
+		filter = "*"
+	}
+	f, err := logstorage.ParseFilter(filter)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse filter [%s]: %s", filter, err)
+		return true
+	}
+
+	timestamp := time.Now().UnixNano()
+	holdID := r.FormValue("hold_id")
+	if holdID == "" {
+		holdID = fmt.Sprintf("%016X", timestamp)
+	}
+	reason := r.FormValue("reason")
+
+	if err := localStorage.LegalHoldPlace(r.Context(), holdID, timestamp, []logstorage.TenantID{tenantID}, f, reason); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+
+	logger.Infof("placed the legal hold with hold_id=%q for tenant %s and filter [%s] by the request from remoteAddr=%s", holdID, tenantID, f, httpserver.GetQuotedRemoteAddr(r))
+
+	writeJSONResponse(w, map[string]string{
+		"hold_id": holdID,
+	})
+	return true
+}
+
+func processLegalHoldRelease(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage == nil {
+		// Legal holds are applied at vlstorage nodes
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, legalHoldAuthKey) {
+		return true
+	}
+
+	holdID := r.FormValue("hold_id")
+	if holdID == "" {
+		httpserver.Errorf(w, r, "missing hold_id arg")
+		return true
+	}
+
+	if err := localStorage.LegalHoldRelease(r.Context(), holdID); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+
+	logger.Infof("released the legal hold with hold_id=%q by the request from remoteAddr=%s", holdID, httpserver.GetQuotedRemoteAddr(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"status":"ok"}`)
+	return true
+}
+
+func processLegalHoldList(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage == nil {
+		// Legal holds are applied at vlstorage nodes
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, legalHoldAuthKey) {
+		return true
+	}
+
+	holds, err := localStorage.LegalHoldList(r.Context())
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+
+	data := logstorage.MarshalLegalHoldsToJSON(holds)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+	return true
+}
+
+func processStreamsRelabel(w http.ResponseWriter, r *http.Request) bool {
+	if localStorage == nil {
+		// Streams are relabeled at vlstorage nodes
+		return false
+	}
+
+	if !httpserver.CheckAuthFlag(w, r, streamsRelabelAuthKey) {
+		return true
+	}
+
+	tenantID, err := logstorage.GetTenantIDFromRequest(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain tenantID: %s", err)
+		return true
+	}
+
+	filter := r.FormValue("filter")
+	if filter == "" {
+		filter = "*"
+	}
+	f, err := logstorage.ParseFilter(filter)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse filter [%s]: %s", filter, err)
+		return true
+	}
+
+	if err := r.ParseForm(); err != nil {
+		httpserver.Errorf(w, r, "cannot parse request args: %s", err)
+		return true
+	}
+	var renames []logstorage.StreamLabelRename
+	for _, rename := range r.Form["rename"] {
+		n := strings.LastIndexByte(rename, ':')
+		if n < 0 {
+			httpserver.Errorf(w, r, "missing ':' in rename=%q; it must be in the form old_name:new_name", rename)
+			return true
+		}
+		renames = append(renames, logstorage.StreamLabelRename{
+			OldName: rename[:n],
+			NewName: rename[n+1:],
+		})
+	}
+
+	timestamp := time.Now().UnixNano()
+	taskID := fmt.Sprintf("%d", timestamp)
+
+	logger.Infof("started relabeling streams for tenant %s and filter [%s] with renames %q by the request from remoteAddr=%s", tenantID, f, strings.Join(r.Form["rename"], ","), httpserver.GetQuotedRemoteAddr(r))
+	startTime := time.Now()
+
+	rr, err := localStorage.StreamsRelabel(r.Context(), taskID, timestamp, tenantID, f, renames)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot relabel streams: %s", err)
+		return true
+	}
+
+	logger.Infof("relabeled %d logs across %d streams for tenant %s and filter [%s] in %.3f seconds; skipped %d streams; task_id=%q",
+		rr.RowsRelabeled, rr.StreamsRelabeled, tenantID, f, time.Since(startTime).Seconds(), rr.StreamsSkipped, rr.TaskID)
+
+	writeJSONResponse(w, rr)
+	return true
+}
+
 func writeJSONResponse(w http.ResponseWriter, response any) {
 	responseBody, err := json.Marshal(response)
 	if err != nil {
@@ -441,9 +919,13 @@ func (*Storage) CanWriteData() error {
 	}
 
 	if localStorage.IsReadOnly() {
+		pathsDesc := fmt.Sprintf("-storageDataPath=%s", *storageDataPath)
+		if len(*extraDataPaths) > 0 {
+			pathsDesc += fmt.Sprintf(" or at -storage.extraDataPaths=%s", extraDataPaths)
+		}
 		return &httpserver.ErrorWithStatusCode{
 			Err: fmt.Errorf("cannot add rows into storage in read-only mode; the storage can be in read-only mode "+
-				"because of lack of free disk space at -storageDataPath=%s", *storageDataPath),
+				"because of lack of free disk space at %s", pathsDesc),
 			StatusCode: http.StatusTooManyRequests,
 		}
 	}
@@ -463,6 +945,37 @@ func (*Storage) MustAddRows(lr *logstorage.LogRows) {
 	}
 }
 
+// FlushPendingData waits until the logs added via MustAddRows are accepted by the remote storage nodes.
+//
+// Logs are added directly to the local storage, so there is nothing to flush in this case.
+func (*Storage) FlushPendingData() {
+	if localStorage == nil {
+		netstorageInsert.FlushPendingData()
+	}
+}
+
+// IsTimestampAllowed returns true if logs with the given timestamp in nanoseconds are accepted by vlstorage.
+//
+// It always returns true in non-local mode, since the retention is controlled by the remote storage nodes.
+func (*Storage) IsTimestampAllowed(timestamp int64) bool {
+	if localStorage == nil {
+		return true
+	}
+	return localStorage.IsTimestampAllowed(timestamp)
+}
+
+// EnsureFresh makes all the pending data available for querying.
+//
+// This provides read-after-write consistency for the logs ingested before the call.
+// In cluster mode the pending data is flushed to all the storage nodes, which then make it searchable.
+func EnsureFresh() {
+	if localStorage != nil {
+		localStorage.DebugFlush()
+		return
+	}
+	netstorageInsert.DebugFlush()
+}
+
 // RunQuery runs the given qctx and calls writeBlock for the returned data blocks
 func RunQuery(qctx *logstorage.QueryContext, writeBlock logstorage.WriteDataBlockFunc) error {
 	qOpt, offset, limit := qctx.Query.GetLastNResultsQuery()
@@ -533,6 +1046,60 @@ func GetStreamIDs(qctx *logstorage.QueryContext, limit uint64) ([]logstorage.Val
 	return netstorageSelect.GetStreamIDs(qctx, limit)
 }
 
+// GetStreamsLastSeen returns the last time when logs were received for streams matching the given qctx.
+func GetStreamsLastSeen(qctx *logstorage.QueryContext) ([]logstorage.StreamLastSeen, error) {
+	if localStorage != nil {
+		return localStorage.GetStreamsLastSeen(qctx)
+	}
+	return netstorageSelect.GetStreamsLastSeen(qctx)
+}
+
+// GetHitsPreaggregated returns the number of logs matching qctx grouped into time buckets with the given step and offset.
+//
+// false is returned if the hits cannot be obtained from the pre-aggregated data.
+func GetHitsPreaggregated(qctx *logstorage.QueryContext, step, offset int64) ([]int64, []uint64, bool, error) {
+	if localStorage != nil {
+		return localStorage.GetHitsPreaggregated(qctx, step, offset)
+	}
+	return netstorageSelect.GetHitsPreaggregated(qctx, step, offset)
+}
+
+// GetApproxCount returns an estimated number of logs matching qctx.
+func GetApproxCount(qctx *logstorage.QueryContext) (*logstorage.ApproxCount, error) {
+	if localStorage != nil {
+		return localStorage.GetApproxCount(qctx)
+	}
+	return netstorageSelect.GetApproxCount(qctx)
+}
+
+// PinView pins the current set of logs under the given viewID for the given ttl.
+//
+// The pinned logs can be queried by passing the viewID to QueryContext.ViewID until the view is unpinned via UnpinView or until the ttl expires.
+func PinView(ctx context.Context, viewID string, ttl time.Duration) error {
+	if localStorage != nil {
+		return localStorage.PinView(ctx, viewID, ttl)
+	}
+	return netstorageSelect.PinView(ctx, viewID, ttl)
+}
+
+// GetMaxIngestedTimestamp returns the maximum timestamp in nanoseconds across the ingested logs.
+//
+// In cluster setup the maximum timestamp across all the -storageNode nodes is returned.
+func GetMaxIngestedTimestamp(ctx context.Context) (int64, error) {
+	if localStorage != nil {
+		return localStorage.GetMaxIngestedTimestamp(), nil
+	}
+	return netstorageSelect.GetMaxIngestedTimestamp(ctx)
+}
+
+// UnpinView unpins the view with the given viewID pinned via PinView.
+func UnpinView(ctx context.Context, viewID string) error {
+	if localStorage != nil {
+		return localStorage.UnpinView(ctx, viewID)
+	}
+	return netstorageSelect.UnpinView(ctx, viewID)
+}
+
 // DeleteRunTask starts deletion of logs for the given filter f for the given tenantIDs.
 //
 // The taskID and timestamp are tracked in the list of tasks returned by DeleteActiveTasks().
@@ -584,8 +1151,10 @@ func writeStorageMetrics(w io.Writer, strg *logstorage.Storage) {
 	if ss.MaxDiskSpaceUsageBytes > 0 {
 		metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_max_disk_space_usage_bytes{path=%q}`, *storageDataPath), uint64(ss.MaxDiskSpaceUsageBytes))
 	}
-	metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_free_disk_space_bytes{path=%q}`, *storageDataPath), fs.MustGetFreeSpace(*storageDataPath))
-	metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_total_disk_space_bytes{path=%q}`, *storageDataPath), fs.MustGetTotalSpace(*storageDataPath))
+	for _, path := range append([]string{*storageDataPath}, *extraDataPaths...) {
+		metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_free_disk_space_bytes{path=%q}`, path), fs.MustGetFreeSpace(path))
+		metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_total_disk_space_bytes{path=%q}`, path), fs.MustGetTotalSpace(path))
+	}
 
 	isReadOnly := uint64(0)
 	if ss.IsReadOnly {
@@ -593,6 +1162,11 @@ func writeStorageMetrics(w io.Writer, strg *logstorage.Storage) {
 	}
 	metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_storage_is_read_only{path=%q}`, *storageDataPath), isReadOnly)
 
+	metrics.WriteCounterUint64(w, `vl_storage_rows_ingested_total`, ss.RowsIngested)
+	if ss.MaxIngestedTimestamp > 0 {
+		metrics.WriteGaugeFloat64(w, `vl_storage_max_ingested_timestamp_seconds`, float64(ss.MaxIngestedTimestamp)/1e9)
+	}
+
 	metrics.WriteGaugeUint64(w, `vl_active_merges{type="storage/inmemory"}`, ss.ActiveInmemoryMerges)
 	metrics.WriteGaugeUint64(w, `vl_active_merges{type="storage/small"}`, ss.ActiveSmallMerges)
 	metrics.WriteGaugeUint64(w, `vl_active_merges{type="storage/big"}`, ss.ActiveBigMerges)
@@ -627,6 +1201,10 @@ func writeStorageMetrics(w io.Writer, strg *logstorage.Storage) {
 	metrics.WriteGaugeUint64(w, `vl_pending_rows{type="indexdb"}`, ss.IndexdbPendingItems)
 
 	metrics.WriteGaugeUint64(w, `vl_partitions`, ss.PartitionsCount)
+	metrics.WriteGaugeUint64(w, `vl_numa_nodes`, uint64(len(numaNodes)))
+	metrics.WriteGaugeUint64(w, `vl_pinned_views`, ss.PinnedViewsCount)
+	metrics.WriteCounterUint64(w, `vl_wal_bytes_written_total`, ss.WALBytesWritten)
+	metrics.WriteCounterUint64(w, `vl_wal_syncs_total`, ss.WALSyncs)
 	metrics.WriteCounterUint64(w, `vl_streams_created_total`, ss.StreamsCreatedTotal)
 
 	metrics.WriteGaugeUint64(w, `vl_indexdb_rows`, ss.IndexdbItemsCount)
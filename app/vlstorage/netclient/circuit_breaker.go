@@ -0,0 +1,48 @@
+package netclient
+
+import (
+	"flag"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	circuitBreakerMaxErrors = flag.Int("storageNode.circuitBreakerMaxErrors", 0, "The number of consecutive connection errors to -storageNode after which queries to this node fail fast "+
+		"during -storageNode.circuitBreakerCooldown. This reduces query latency when some of storage nodes are unavailable and partial responses are allowed. "+
+		"By default the circuit breaker is disabled. See https://docs.victoriametrics.com/victorialogs/cluster/#http2-for-internal-communications")
+	circuitBreakerCooldown = flag.Duration("storageNode.circuitBreakerCooldown", 5*time.Second, "The duration for failing queries fast to -storageNode "+
+		"after -storageNode.circuitBreakerMaxErrors consecutive connection errors. A single probe query is sent to the node after the cooldown")
+)
+
+// CircuitBreaker prevents from sending requests to a storage node after too many consecutive connection errors.
+//
+// The zero value is ready to use. It is configured via -storageNode.circuitBreaker* command-line flags.
+type CircuitBreaker struct {
+	consecutiveErrors atomic.Int64
+
+	// openUntil is the unix timestamp in nanoseconds until requests to the storage node must fail fast.
+	openUntil atomic.Int64
+}
+
+// IsOpen returns true if requests to the storage node must fail fast.
+func (cb *CircuitBreaker) IsOpen() bool {
+	return time.Now().UnixNano() < cb.openUntil.Load()
+}
+
+// RegisterError must be called on connection error to the storage node.
+func (cb *CircuitBreaker) RegisterError() {
+	maxErrors := int64(*circuitBreakerMaxErrors)
+	if maxErrors <= 0 {
+		return
+	}
+	if n := cb.consecutiveErrors.Add(1); n >= maxErrors {
+		cb.openUntil.Store(time.Now().Add(*circuitBreakerCooldown).UnixNano())
+	}
+}
+
+// RegisterSuccess must be called on successful request to the storage node.
+func (cb *CircuitBreaker) RegisterSuccess() {
+	if cb.consecutiveErrors.Load() != 0 {
+		cb.consecutiveErrors.Store(0)
+	}
+}
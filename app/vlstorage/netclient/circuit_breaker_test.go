@@ -0,0 +1,50 @@
+package netclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	defer func(maxErrors int, cooldown time.Duration) {
+		*circuitBreakerMaxErrors = maxErrors
+		*circuitBreakerCooldown = cooldown
+	}(*circuitBreakerMaxErrors, *circuitBreakerCooldown)
+
+	// disabled circuit breaker
+	*circuitBreakerMaxErrors = 0
+	var cb CircuitBreaker
+	for i := 0; i < 10; i++ {
+		cb.RegisterError()
+	}
+	if cb.IsOpen() {
+		t.Fatalf("disabled circuit breaker mustn't be open")
+	}
+
+	// enabled circuit breaker
+	*circuitBreakerMaxErrors = 3
+	*circuitBreakerCooldown = time.Hour
+	cb = CircuitBreaker{}
+	cb.RegisterError()
+	cb.RegisterError()
+	if cb.IsOpen() {
+		t.Fatalf("circuit breaker mustn't be open before reaching the maximum number of errors")
+	}
+	cb.RegisterSuccess()
+	cb.RegisterError()
+	cb.RegisterError()
+	if cb.IsOpen() {
+		t.Fatalf("circuit breaker mustn't be open, since successful request resets the number of consecutive errors")
+	}
+	cb.RegisterError()
+	if !cb.IsOpen() {
+		t.Fatalf("circuit breaker must be open after reaching the maximum number of consecutive errors")
+	}
+
+	// cooldown
+	*circuitBreakerCooldown = 0
+	cb.RegisterError()
+	if cb.IsOpen() {
+		t.Fatalf("circuit breaker must be closed after the cooldown")
+	}
+}
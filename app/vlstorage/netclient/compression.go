@@ -0,0 +1,23 @@
+package netclient
+
+import (
+	"fmt"
+)
+
+const (
+	// DefaultCompressionLevel is the default zstd compression level for the data sent between cluster components.
+	//
+	// It provides good compression ratio at low CPU usage.
+	DefaultCompressionLevel = 1
+
+	// MaxCompressionLevel is the maximum zstd compression level for the data sent between cluster components.
+	MaxCompressionLevel = 22
+)
+
+// CheckCompressionLevel returns an error if the given zstd compression level isn't supported.
+func CheckCompressionLevel(level int) error {
+	if level < 1 || level > MaxCompressionLevel {
+		return fmt.Errorf("unsupported zstd compression level %d; supported range: [1...%d]", level, MaxCompressionLevel)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package netclient
+
+import (
+	"testing"
+)
+
+func TestCheckCompressionLevel(t *testing.T) {
+	f := func(level int, resultExpected bool) {
+		t.Helper()
+
+		err := CheckCompressionLevel(level)
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for CheckCompressionLevel(%d); got %v; want %v; err: %v", level, result, resultExpected, err)
+		}
+	}
+
+	f(-1, false)
+	f(0, false)
+	f(1, true)
+	f(DefaultCompressionLevel, true)
+	f(10, true)
+	f(MaxCompressionLevel, true)
+	f(MaxCompressionLevel+1, false)
+}
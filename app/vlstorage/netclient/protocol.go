@@ -0,0 +1,185 @@
+package netclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// ProtocolVersionsPath is the path to HTTP endpoint, which returns ProtocolVersions supported by the storage node.
+const ProtocolVersionsPath = "/internal/protocol_versions"
+
+// ProtocolVersions contains supported protocol versions per every internal HTTP endpoint path.
+//
+// Versions for every path are ordered from the newest to the oldest. The previous protocol version must be kept
+// in the list after the protocol change for at least a single release, since this allows rolling upgrades
+// of cluster components. See https://docs.victoriametrics.com/victorialogs/cluster/#upgrading
+type ProtocolVersions map[string][]string
+
+// IsSupported returns true if the given version is supported for the given path.
+func (pvs ProtocolVersions) IsSupported(path, version string) bool {
+	return slices.Contains(pvs[path], version)
+}
+
+// Merge returns ProtocolVersions containing versions from pvs and a.
+func (pvs ProtocolVersions) Merge(a ProtocolVersions) ProtocolVersions {
+	m := make(ProtocolVersions, len(pvs)+len(a))
+	for path, versions := range pvs {
+		m[path] = versions
+	}
+	for path, versions := range a {
+		m[path] = versions
+	}
+	return m
+}
+
+// Negotiate returns the newest protocol version for the given path, which is supported by both pvs and remote.
+//
+// If remote is nil, then the remote storage node doesn't support protocol negotiation, so the oldest version from pvs is returned.
+// Such a storage node belongs to the previous release, which accepts only its own protocol version - the oldest version kept in pvs.
+//
+// An error is returned if pvs and remote have no common protocol versions for the given path.
+func (pvs ProtocolVersions) Negotiate(remote ProtocolVersions, path string) (string, error) {
+	local := pvs[path]
+	if len(local) == 0 {
+		return "", fmt.Errorf("BUG: missing local protocol versions for %s", path)
+	}
+	if remote == nil {
+		return local[len(local)-1], nil
+	}
+
+	remoteVersions := remote[path]
+	if len(remoteVersions) == 0 {
+		return "", fmt.Errorf("%s endpoint isn't supported by the storage node; the most likely cause of this error is an older release of the storage node; "+
+			"upgrade the storage node to the release of the current node", path)
+	}
+	for _, version := range local {
+		if slices.Contains(remoteVersions, version) {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("incompatible protocol versions for %s endpoint; the current node supports %q, while the storage node supports %q; "+
+		"make sure the difference between release versions of cluster components doesn't exceed a single release; "+
+		"see https://docs.victoriametrics.com/victorialogs/cluster/#upgrading", path, local, remoteVersions)
+}
+
+// MarshalProtocolVersionsResponse marshals pvs together with the given appVersion into JSON response for ProtocolVersionsPath.
+func MarshalProtocolVersionsResponse(appVersion string, pvs ProtocolVersions) []byte {
+	resp := protocolVersionsResponse{
+		AppVersion: appVersion,
+		Endpoints:  pvs,
+	}
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal protocol versions: %s", err)
+	}
+	return data
+}
+
+type protocolVersionsResponse struct {
+	AppVersion string           `json:"app_version"`
+	Endpoints  ProtocolVersions `json:"endpoints"`
+}
+
+// protocolVersionsRefreshInterval is the interval for refreshing protocol versions supported by the storage node.
+//
+// The refresh is needed for detecting protocol changes after the storage node upgrade.
+const protocolVersionsRefreshInterval = time.Minute
+
+// ProtocolNegotiator negotiates protocol versions with a remote storage node.
+//
+// The zero value is ready to use.
+type ProtocolNegotiator struct {
+	mu sync.Mutex
+
+	// remote contains protocol versions supported by the remote storage node.
+	//
+	// It is nil if the remote storage node doesn't support protocol negotiation.
+	remote ProtocolVersions
+
+	// appVersion is the release version of the remote storage node.
+	appVersion string
+
+	// lastFetchTime is the last time remote protocol versions were successfully fetched.
+	lastFetchTime time.Time
+
+	// fetchInProgress is set to true while remote protocol versions are fetched.
+	fetchInProgress bool
+}
+
+// FetchFunc must perform GET request to ProtocolVersionsPath at the remote storage node and return the response status code and body.
+//
+// It must return non-nil error only if the request couldn't be sent to the remote storage node.
+type FetchFunc func(ctx context.Context) (statusCode int, data []byte, err error)
+
+// GetProtocolVersion returns the protocol version for the given path, which is supported by both local and the remote storage node.
+//
+// fetch is used for obtaining protocol versions supported by the remote storage node.
+func (pn *ProtocolNegotiator) GetProtocolVersion(ctx context.Context, local ProtocolVersions, path string, fetch FetchFunc) (string, error) {
+	pn.mu.Lock()
+	needFetch := !pn.fetchInProgress && (pn.lastFetchTime.IsZero() || time.Since(pn.lastFetchTime) > protocolVersionsRefreshInterval)
+	if !needFetch {
+		// Concurrent callers use the previously obtained remote versions while they are fetched by another goroutine.
+		defer pn.mu.Unlock()
+		return local.Negotiate(pn.remote, path)
+	}
+	pn.fetchInProgress = true
+	pn.mu.Unlock()
+
+	// Fetch remote versions without holding pn.mu, so a slow storage node doesn't block concurrent callers.
+	statusCode, data, err := fetch(ctx)
+
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+
+	pn.fetchInProgress = false
+	if err != nil {
+		if pn.lastFetchTime.IsZero() {
+			// The storage node is unavailable. Use the oldest local version, since the request will fail anyway.
+			return local.Negotiate(nil, path)
+		}
+		// Use the previously obtained remote versions until the storage node becomes available.
+		return local.Negotiate(pn.remote, path)
+	}
+	pn.updateLocked(statusCode, data)
+	return local.Negotiate(pn.remote, path)
+}
+
+// AppVersion returns the release version of the remote storage node obtained during the last protocol negotiation.
+//
+// An empty string is returned if the version is unknown.
+func (pn *ProtocolNegotiator) AppVersion() string {
+	pn.mu.Lock()
+	defer pn.mu.Unlock()
+
+	return pn.appVersion
+}
+
+// Reset resets the negotiated protocol versions, so they are re-negotiated on the next GetProtocolVersion call.
+//
+// It must be called when the remote storage node may be restarted with another release, e.g. after connection errors.
+func (pn *ProtocolNegotiator) Reset() {
+	pn.mu.Lock()
+	pn.lastFetchTime = time.Time{}
+	pn.mu.Unlock()
+}
+
+func (pn *ProtocolNegotiator) updateLocked(statusCode int, data []byte) {
+	pn.lastFetchTime = time.Now()
+
+	var resp protocolVersionsResponse
+	if statusCode != http.StatusOK || json.Unmarshal(data, &resp) != nil || resp.Endpoints == nil {
+		// The storage node doesn't support protocol negotiation.
+		pn.remote = nil
+		pn.appVersion = ""
+		return
+	}
+	pn.remote = resp.Endpoints
+	pn.appVersion = resp.AppVersion
+}
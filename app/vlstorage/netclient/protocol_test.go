@@ -0,0 +1,202 @@
+package netclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProtocolVersionsNegotiate(t *testing.T) {
+	local := ProtocolVersions{
+		"/internal/select/query": {"v3", "v2"},
+	}
+
+	f := func(remote ProtocolVersions, versionExpected string) {
+		t.Helper()
+
+		version, err := local.Negotiate(remote, "/internal/select/query")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if version != versionExpected {
+			t.Fatalf("unexpected version; got %q; want %q", version, versionExpected)
+		}
+	}
+
+	// the remote node doesn't support negotiation, so it belongs to the previous release
+	f(nil, "v2")
+
+	// the remote node has the same release
+	f(ProtocolVersions{"/internal/select/query": {"v3", "v2"}}, "v3")
+
+	// the remote node has the previous release
+	f(ProtocolVersions{"/internal/select/query": {"v2", "v1"}}, "v2")
+
+	// the remote node has the next release
+	f(ProtocolVersions{"/internal/select/query": {"v4", "v3"}}, "v3")
+
+	fError := func(remote ProtocolVersions, path string) {
+		t.Helper()
+
+		if _, err := local.Negotiate(remote, path); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// incompatible versions
+	fError(ProtocolVersions{"/internal/select/query": {"v1"}}, "/internal/select/query")
+
+	// the endpoint is missing at the remote node
+	fError(ProtocolVersions{"/internal/select/field_names": {"v1"}}, "/internal/select/query")
+
+	// the endpoint is missing at the local node
+	fError(ProtocolVersions{"/internal/select/field_names": {"v1"}}, "/internal/select/field_names")
+}
+
+func TestProtocolNegotiator(t *testing.T) {
+	local := ProtocolVersions{
+		"/internal/insert": {"v2", "v1"},
+	}
+
+	f := func(statusCode int, data string, fetchErr error, versionExpected, appVersionExpected string, errExpected bool) {
+		t.Helper()
+
+		var pn ProtocolNegotiator
+		fetch := func(_ context.Context) (int, []byte, error) {
+			return statusCode, []byte(data), fetchErr
+		}
+		version, err := pn.GetProtocolVersion(context.Background(), local, "/internal/insert", fetch)
+		if err != nil {
+			if !errExpected {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+		if errExpected {
+			t.Fatalf("expecting non-nil error")
+		}
+		if version != versionExpected {
+			t.Fatalf("unexpected version; got %q; want %q", version, versionExpected)
+		}
+		if appVersion := pn.AppVersion(); appVersion != appVersionExpected {
+			t.Fatalf("unexpected app version; got %q; want %q", appVersion, appVersionExpected)
+		}
+	}
+
+	// the remote node is unavailable
+	f(0, "", fmt.Errorf("connection refused"), "v1", "", false)
+
+	// the remote node doesn't support negotiation
+	f(http.StatusBadRequest, "unsupported path", nil, "v1", "", false)
+	f(http.StatusOK, `{"version":"v1.2.3"}`, nil, "v1", "", false)
+
+	// the remote node supports negotiation
+	f(http.StatusOK, `{"app_version":"v1.2.3","endpoints":{"/internal/insert":["v2","v1"]}}`, nil, "v2", "v1.2.3", false)
+	f(http.StatusOK, `{"app_version":"v1.2.2","endpoints":{"/internal/insert":["v1"]}}`, nil, "v1", "v1.2.2", false)
+
+	// incompatible versions
+	f(http.StatusOK, `{"app_version":"v1.0.0","endpoints":{"/internal/insert":["v0"]}}`, nil, "", "", true)
+	f(http.StatusOK, `{"app_version":"v1.0.0","endpoints":{}}`, nil, "", "", true)
+}
+
+func TestProtocolNegotiatorReset(t *testing.T) {
+	local := ProtocolVersions{
+		"/internal/insert": {"v2", "v1"},
+	}
+
+	data := `{"app_version":"v1.2.2","endpoints":{"/internal/insert":["v1"]}}`
+	fetches := 0
+	fetch := func(_ context.Context) (int, []byte, error) {
+		fetches++
+		return http.StatusOK, []byte(data), nil
+	}
+
+	var pn ProtocolNegotiator
+	for i := 0; i < 3; i++ {
+		version, err := pn.GetProtocolVersion(context.Background(), local, "/internal/insert", fetch)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if version != "v1" {
+			t.Fatalf("unexpected version; got %q; want %q", version, "v1")
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("unexpected number of fetches; got %d; want 1", fetches)
+	}
+
+	// The remote node is upgraded.
+	data = `{"app_version":"v1.2.3","endpoints":{"/internal/insert":["v2","v1"]}}`
+	pn.Reset()
+	version, err := pn.GetProtocolVersion(context.Background(), local, "/internal/insert", fetch)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if version != "v2" {
+		t.Fatalf("unexpected version; got %q; want %q", version, "v2")
+	}
+	if fetches != 2 {
+		t.Fatalf("unexpected number of fetches; got %d; want 2", fetches)
+	}
+}
+
+func TestProtocolNegotiatorConcurrentFetch(t *testing.T) {
+	local := ProtocolVersions{
+		"/internal/insert": {"v2", "v1"},
+	}
+
+	fetchStartedCh := make(chan struct{})
+	fetchUnblockCh := make(chan struct{})
+	slowFetch := func(_ context.Context) (int, []byte, error) {
+		close(fetchStartedCh)
+		<-fetchUnblockCh
+		return http.StatusOK, []byte(`{"app_version":"v1.2.3","endpoints":{"/internal/insert":["v2","v1"]}}`), nil
+	}
+
+	var pn ProtocolNegotiator
+	resultCh := make(chan string, 1)
+	go func() {
+		version, err := pn.GetProtocolVersion(context.Background(), local, "/internal/insert", slowFetch)
+		if err != nil {
+			panic(fmt.Errorf("unexpected error: %w", err))
+		}
+		resultCh <- version
+	}()
+	<-fetchStartedCh
+
+	// Concurrent callers mustn't be blocked by the slow fetch. They must use the previous protocol version until the fetch is complete.
+	fetch := func(_ context.Context) (int, []byte, error) {
+		panic(fmt.Errorf("BUG: unexpected concurrent fetch"))
+	}
+	doneCh := make(chan string, 1)
+	go func() {
+		version, err := pn.GetProtocolVersion(context.Background(), local, "/internal/insert", fetch)
+		if err != nil {
+			panic(fmt.Errorf("unexpected error: %w", err))
+		}
+		doneCh <- version
+	}()
+	select {
+	case version := <-doneCh:
+		if version != "v1" {
+			t.Fatalf("unexpected version during the fetch; got %q; want %q", version, "v1")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout while waiting for the protocol version during the slow fetch")
+	}
+
+	close(fetchUnblockCh)
+	if version := <-resultCh; version != "v2" {
+		t.Fatalf("unexpected version after the fetch; got %q; want %q", version, "v2")
+	}
+
+	version, err := pn.GetProtocolVersion(context.Background(), local, "/internal/insert", fetch)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if version != "v2" {
+		t.Fatalf("unexpected version; got %q; want %q", version, "v2")
+	}
+}
@@ -0,0 +1,21 @@
+package netclient
+
+import (
+	"strings"
+)
+
+// SplitReplicaAddrs splits the given -storageNode entry into addresses of storage nodes, which hold the same data.
+//
+// Replicas are delimited by '|' in the -storageNode entry, e.g. `vlstorage-a:9428|vlstorage-b:9428`.
+// The first address is the primary replica.
+func SplitReplicaAddrs(addr string) []string {
+	a := strings.Split(addr, "|")
+	addrs := a[:0]
+	for _, s := range a {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			addrs = append(addrs, s)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,42 @@
+package netclient
+
+import (
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+)
+
+var (
+	maxIdleConnsPerHost = flag.Int("storageNode.maxIdleConnsPerHost", 64, "The maximum number of idle keep-alive connections per every -storageNode. "+
+		"Bigger values reduce connection churn under high query and ingestion load")
+	idleConnTimeout   = flag.Duration("storageNode.idleConnTimeout", 90*time.Second, "The maximum duration an idle keep-alive connection to -storageNode is kept open")
+	http2PingInterval = flag.Duration("storageNode.http2PingInterval", 30*time.Second, "The interval for sending HTTP/2 health check pings over idle connections "+
+		"to -storageNode with enabled -storageNode.http2")
+)
+
+// NewTransport returns new transport for communicating with storage nodes.
+//
+// If useHTTP2 is set, then HTTP/2 without TLS is used for multiplexing concurrent requests over a single connection.
+// Storage nodes must accept such connections at -internal.http2ListenAddr.
+// See https://docs.victoriametrics.com/victorialogs/cluster/#http2-for-internal-communications
+func NewTransport(metricsPrefix string, useHTTP2 bool) *http.Transport {
+	tr := httputil.NewTransport(false, metricsPrefix)
+	tr.TLSHandshakeTimeout = 20 * time.Second
+	tr.DisableCompression = true
+	tr.MaxIdleConnsPerHost = *maxIdleConnsPerHost
+	tr.MaxIdleConns = 0
+	tr.IdleConnTimeout = *idleConnTimeout
+
+	if useHTTP2 {
+		var protocols http.Protocols
+		protocols.SetUnencryptedHTTP2(true)
+		tr.Protocols = &protocols
+		tr.HTTP2 = &http.HTTP2Config{
+			SendPingTimeout: *http2PingInterval,
+			PingTimeout:     15 * time.Second,
+		}
+	}
+	return tr
+}
@@ -1,7 +1,9 @@
 package netinsert
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,30 +16,63 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/contextutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/valyala/fastrand"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netclient"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
-// the maximum size of a single data block sent to storage node.
-const maxInsertBlockSize = 2 * 1024 * 1024
+var (
+	maxBlockSize = flagutil.NewBytes("insert.maxBlockSize", 2*1024*1024, "The maximum size of a single data block sent to every -storageNode. "+
+		"Bigger blocks reduce the number of requests to -storageNode at the cost of higher RAM usage. "+
+		"The block size mustn't exceed -internalinsert.maxRequestSize at -storageNode. See https://docs.victoriametrics.com/victorialogs/cluster/#ingestion-tuning")
+	flushInterval = flag.Duration("insert.flushInterval", time.Second, "The interval for sending incomplete data blocks to -storageNode nodes. "+
+		"Lower intervals reduce the delay before the ingested logs become visible for querying at the cost of higher number of requests to -storageNode. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#ingestion-tuning")
+	maxInflightRequestsPerNode = flag.Int("insert.maxInflightRequestsPerNode", 0, "The maximum number of concurrent data ingestion requests to every -storageNode. "+
+		"By default the number of concurrent requests is limited only by -insert.concurrency. See https://docs.victoriametrics.com/victorialogs/cluster/#ingestion-tuning")
+	retryMinInterval = flag.Duration("insert.retryMinInterval", 10*time.Second, "The initial duration for stopping data sending to -storageNode after the failed request. "+
+		"The data is re-routed to the remaining -storageNode nodes during this time. The duration is doubled after every subsequent failure "+
+		"up to -insert.retryMaxInterval. See https://docs.victoriametrics.com/victorialogs/cluster/#ingestion-tuning")
+	retryMaxInterval = flag.Duration("insert.retryMaxInterval", time.Minute, "The maximum duration for stopping data sending to -storageNode after failed requests. "+
+		"See -insert.retryMinInterval")
+	replicaRetryBufferSize = flagutil.NewBytes("insert.replicaRetryBufferSize", 64*1024*1024, "The maximum size of data buffered for every unavailable -storageNode replica. "+
+		"The buffered data is re-sent only to this replica when it becomes available, since the remaining replicas in the group already received it. "+
+		"The oldest buffered data is dropped when the buffer is full. See https://docs.victoriametrics.com/victorialogs/cluster/#hedged-requests")
+)
 
 // ProtocolVersion is the version of the data ingestion protocol.
 //
 // It must be changed every time the data encoding at /internal/insert HTTP endpoint is changed.
 const ProtocolVersion = "v1"
 
+// SupportedProtocolVersions contains protocol versions supported by /internal/insert endpoint.
+//
+// See netselect.SupportedProtocolVersions for details.
+var SupportedProtocolVersions = netclient.ProtocolVersions{
+	"/internal/insert": {ProtocolVersion},
+}
+
 // Storage is a network storage for sending data to remote storage nodes in the cluster.
 type Storage struct {
+	// sns contains all the storage nodes including replicas.
 	sns []*storageNode
 
+	// replicaGroups contains groups of storage nodes, which must contain the same data.
+	//
+	// Every ingested log row is sent to all the storage nodes in the selected group.
+	replicaGroups [][]*storageNode
+
 	disableCompression bool
 
+	// compressionLevel is zstd compression level for the data sent to storage nodes.
+	compressionLevel int
+
 	srt *streamRowsTracker
 
 	pendingDataBuffers chan *bytesutil.ByteBuffer
@@ -62,11 +97,19 @@ type storageNode struct {
 	// ac is auth config used for setting request headers such as Authorization and Host.
 	ac *promauth.Config
 
+	// pn negotiates protocol versions with the storage node.
+	pn netclient.ProtocolNegotiator
+
 	// pendingData contains pending data, which must be sent to the storage node at the addr.
 	pendingDataMu        sync.Mutex
 	pendingData          *bytesutil.ByteBuffer
 	pendingDataLastFlush time.Time
 
+	// sendsMu is read-locked while the grabbed pendingData is sent to the storage node.
+	//
+	// It is write-locked by waitForSends in order to wait until the previously grabbed pendingData is sent.
+	sendsMu sync.RWMutex
+
 	// sendErrors counts failed send attempts for this storage node.
 	sendErrors *metrics.Counter
 
@@ -75,12 +118,48 @@ type storageNode struct {
 
 	// isReachable is set to true if the given storageNode is available for data writing.
 	isReachable atomic.Bool
+
+	// consecutiveFailures is the number of consecutive failed requests to the storage node.
+	//
+	// It is used for calculating the duration for disabling the storage node.
+	consecutiveFailures atomic.Uint32
+
+	// inflightCh limits the number of concurrent data ingestion requests to the storage node.
+	//
+	// It is nil if the number of concurrent requests isn't limited via -insert.maxInflightRequestsPerNode.
+	inflightCh chan struct{}
+
+	// inflightRequests is the number of data ingestion requests to the storage node in flight.
+	inflightRequests atomic.Int64
+
+	requestsTotal   *metrics.Counter
+	sentBytesTotal  *metrics.Counter
+	requestDuration *metrics.Histogram
+
+	// hasReplicas is set to true if the replica group for the given storageNode contains other replicas.
+	//
+	// Such replicas receive the same data, so the data, which couldn't be sent to the given storageNode,
+	// is buffered at replicaRetryBlocks instead of re-routing it to other groups.
+	hasReplicas bool
+
+	// replicaResendMu prevents from concurrent re-sending of the same replicaRetryBlocks.
+	replicaResendMu sync.Mutex
+
+	// replicaRetryMu protects replicaRetryBlocks and replicaRetryBlocksSize.
+	replicaRetryMu sync.Mutex
+
+	// replicaRetryBlocks contains data blocks, which couldn't be sent to the storage node with replicas.
+	//
+	// The blocks are re-sent only to the given storageNode when it becomes available.
+	replicaRetryBlocks     []*bytesutil.ByteBuffer
+	replicaRetryBlocksSize int
+
+	// replicaRetryDroppedBytes counts bytes dropped from replicaRetryBlocks because of -insert.replicaRetryBufferSize limit.
+	replicaRetryDroppedBytes *metrics.Counter
 }
 
-func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS bool) *storageNode {
-	tr := httputil.NewTransport(false, "vlinsert_backend")
-	tr.TLSHandshakeTimeout = 20 * time.Second
-	tr.DisableCompression = true
+func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS, useHTTP2, hasReplicas bool) *storageNode {
+	tr := netclient.NewTransport("vlinsert_backend", useHTTP2)
 
 	scheme := "http"
 	if isTLS {
@@ -96,13 +175,23 @@ func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS bool) *s
 		},
 		ac: ac,
 
-		sendErrors: metrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_remote_send_errors_total{addr=%q}`, addr)),
+		sendErrors:      metrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_remote_send_errors_total{addr=%q}`, addr)),
+		requestsTotal:   metrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_remote_requests_total{addr=%q}`, addr)),
+		sentBytesTotal:  metrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_remote_sent_bytes_total{addr=%q}`, addr)),
+		requestDuration: metrics.GetOrCreateHistogram(fmt.Sprintf(`vl_insert_remote_request_duration_seconds{addr=%q}`, addr)),
 
 		pendingData: &bytesutil.ByteBuffer{},
+
+		hasReplicas:              hasReplicas,
+		replicaRetryDroppedBytes: metrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_remote_replica_retry_dropped_bytes_total{addr=%q}`, addr)),
 	}
 
 	sn.isReachable.Store(true)
 
+	if n := *maxInflightRequestsPerNode; n > 0 {
+		sn.inflightCh = make(chan struct{}, n)
+	}
+
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
@@ -115,28 +204,39 @@ func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS bool) *s
 		}
 		return 0
 	})
+	_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vl_insert_remote_inflight_requests{addr=%q}`, addr), func() float64 {
+		return float64(sn.inflightRequests.Load())
+	})
+	_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vl_insert_remote_replica_retry_buffer_bytes{addr=%q}`, addr), func() float64 {
+		sn.replicaRetryMu.Lock()
+		n := sn.replicaRetryBlocksSize
+		sn.replicaRetryMu.Unlock()
+		return float64(n)
+	})
 
 	return sn
 }
 
 func (sn *storageNode) backgroundFlusher() {
-	t := time.NewTicker(time.Second)
+	t := time.NewTicker(*flushInterval)
 	defer t.Stop()
 
 	for {
 		select {
 		case <-sn.s.stopCh:
 			sn.flushPendingData(true)
+			sn.dropReplicaRetryBlocks()
 			return
 		case <-t.C:
 			sn.flushPendingData(false)
+			sn.resendReplicaRetryBlocks()
 		}
 	}
 }
 
 func (sn *storageNode) flushPendingData(force bool) {
 	sn.pendingDataMu.Lock()
-	if !force && time.Since(sn.pendingDataLastFlush) < time.Second {
+	if !force && time.Since(sn.pendingDataLastFlush) < *flushInterval {
 		// nothing to flush
 		sn.pendingDataMu.Unlock()
 		return
@@ -148,6 +248,12 @@ func (sn *storageNode) flushPendingData(force bool) {
 	sn.mustSendInsertRequest(pendingData)
 }
 
+// waitForSends waits until the pendingData grabbed before the call is sent to the storage node.
+func (sn *storageNode) waitForSends() {
+	sn.sendsMu.Lock()
+	sn.sendsMu.Unlock()
+}
+
 func (sn *storageNode) debugFlush() {
 	// Send pending samples to sn.
 	sn.flushPendingData(true)
@@ -164,15 +270,16 @@ func (sn *storageNode) addRow(r *logstorage.InsertRow) {
 
 	b = r.Marshal(b)
 
-	if len(b) > maxInsertBlockSize {
-		logger.Warnf("skipping too long log entry, since its length exceeds %d bytes; the actual log entry length is %d bytes; log entry contents: %s", maxInsertBlockSize, len(b), b)
+	maxSize := maxBlockSize.IntN()
+	if len(b) > maxSize {
+		logger.Warnf("skipping too long log entry, since its length exceeds -insert.maxBlockSize=%d bytes; the actual log entry length is %d bytes; log entry contents: %s", maxSize, len(b), b)
 		bbPool.Put(bb)
 		return
 	}
 
 	var pendingData *bytesutil.ByteBuffer
 	sn.pendingDataMu.Lock()
-	if sn.pendingData.Len()+len(b) > maxInsertBlockSize {
+	if sn.pendingData.Len()+len(b) > maxSize {
 		pendingData = sn.grabPendingDataForFlushLocked()
 	}
 	sn.pendingData.MustWrite(b)
@@ -189,6 +296,9 @@ func (sn *storageNode) addRow(r *logstorage.InsertRow) {
 var bbPool bytesutil.ByteBufferPool
 
 func (sn *storageNode) grabPendingDataForFlushLocked() *bytesutil.ByteBuffer {
+	// The lock is released by mustSendInsertRequest after sending the pendingData.
+	sn.sendsMu.RLock()
+
 	sn.pendingDataLastFlush = time.Now()
 	pendingData := sn.pendingData
 	sn.pendingData = <-sn.s.pendingDataBuffers
@@ -200,6 +310,7 @@ func (sn *storageNode) mustSendInsertRequest(pendingData *bytesutil.ByteBuffer)
 	defer func() {
 		pendingData.Reset()
 		sn.s.pendingDataBuffers <- pendingData
+		sn.sendsMu.RUnlock()
 	}()
 
 	err := sn.sendInsertRequest(pendingData)
@@ -207,6 +318,17 @@ func (sn *storageNode) mustSendInsertRequest(pendingData *bytesutil.ByteBuffer)
 		return
 	}
 
+	if sn.hasReplicas {
+		// The remaining replicas in the group already received pendingData, so re-routing it to other groups
+		// would result in duplicate logs. Buffer the data and re-send it only to sn when it becomes available.
+		// This releases pendingData to the shared pool, so the data ingestion to the remaining nodes isn't blocked.
+		if !errors.Is(err, errTemporarilyDisabled) {
+			logger.Warnf("%s; buffering the data block until the replica becomes available", err)
+		}
+		sn.addReplicaRetryBlock(pendingData.B)
+		return
+	}
+
 	if !errors.Is(err, errTemporarilyDisabled) {
 		logger.Warnf("%s; re-routing the data block to the remaining nodes", err)
 	}
@@ -225,6 +347,85 @@ func (sn *storageNode) mustSendInsertRequest(pendingData *bytesutil.ByteBuffer)
 	}
 }
 
+// addReplicaRetryBlock adds a copy of data to the blocks, which must be re-sent to sn when it becomes available.
+//
+// The oldest blocks are dropped if their total size exceeds -insert.replicaRetryBufferSize.
+func (sn *storageNode) addReplicaRetryBlock(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	bb := &bytesutil.ByteBuffer{}
+	bb.MustWrite(data)
+
+	maxSize := replicaRetryBufferSize.IntN()
+	droppedBytes := 0
+
+	sn.replicaRetryMu.Lock()
+	sn.replicaRetryBlocks = append(sn.replicaRetryBlocks, bb)
+	sn.replicaRetryBlocksSize += bb.Len()
+	for sn.replicaRetryBlocksSize > maxSize {
+		n := sn.replicaRetryBlocks[0].Len()
+		sn.replicaRetryBlocks[0] = nil
+		sn.replicaRetryBlocks = sn.replicaRetryBlocks[1:]
+		sn.replicaRetryBlocksSize -= n
+		droppedBytes += n
+	}
+	sn.replicaRetryMu.Unlock()
+
+	if droppedBytes > 0 {
+		sn.replicaRetryDroppedBytes.Add(droppedBytes)
+		logger.Warnf("dropping %d bytes of the oldest data buffered for the unavailable replica %q, since the buffer size exceeds -insert.replicaRetryBufferSize=%d; "+
+			"the remaining replicas in the group hold this data", droppedBytes, sn.addr, maxSize)
+	}
+}
+
+// resendReplicaRetryBlocks re-sends the buffered blocks to sn until all of them are sent or sn becomes unavailable.
+func (sn *storageNode) resendReplicaRetryBlocks() {
+	sn.replicaResendMu.Lock()
+	defer sn.replicaResendMu.Unlock()
+
+	for {
+		sn.replicaRetryMu.Lock()
+		if len(sn.replicaRetryBlocks) == 0 {
+			sn.replicaRetryMu.Unlock()
+			return
+		}
+		bb := sn.replicaRetryBlocks[0]
+		sn.replicaRetryMu.Unlock()
+
+		if err := sn.sendInsertRequest(bb); err != nil {
+			if !errors.Is(err, errTemporarilyDisabled) {
+				logger.Warnf("cannot re-send the buffered data block to the replica: %s; re-trying later", err)
+			}
+			return
+		}
+
+		sn.replicaRetryMu.Lock()
+		// The block could be dropped by addReplicaRetryBlock while it was sent.
+		if len(sn.replicaRetryBlocks) > 0 && sn.replicaRetryBlocks[0] == bb {
+			sn.replicaRetryBlocks[0] = nil
+			sn.replicaRetryBlocks = sn.replicaRetryBlocks[1:]
+			sn.replicaRetryBlocksSize -= bb.Len()
+		}
+		sn.replicaRetryMu.Unlock()
+	}
+}
+
+// dropReplicaRetryBlocks drops the buffered blocks, which couldn't be sent to sn before the storage is stopped.
+func (sn *storageNode) dropReplicaRetryBlocks() {
+	sn.replicaRetryMu.Lock()
+	n := sn.replicaRetryBlocksSize
+	sn.replicaRetryBlocks = nil
+	sn.replicaRetryBlocksSize = 0
+	sn.replicaRetryMu.Unlock()
+
+	if n > 0 {
+		sn.replicaRetryDroppedBytes.Add(n)
+		logger.Warnf("dropping %d bytes of data buffered for the unavailable replica %q on shutdown; the remaining replicas in the group hold this data", n, sn.addr)
+	}
+}
+
 func (sn *storageNode) sendInsertRequest(pendingData *bytesutil.ByteBuffer) error {
 	dataLen := pendingData.Len()
 	if dataLen == 0 {
@@ -237,24 +438,56 @@ func (sn *storageNode) sendInsertRequest(pendingData *bytesutil.ByteBuffer) erro
 		return errTemporarilyDisabled
 	}
 
-	var body io.Reader
+	var body *bytesutil.ByteBuffer
 	if !sn.s.disableCompression {
 		bb := zstdBufPool.Get()
 		defer zstdBufPool.Put(bb)
 
-		bb.B = zstd.CompressLevel(bb.B[:0], pendingData.B, 1)
-		body = bb.NewReader()
+		bb.B = zstd.CompressLevel(bb.B[:0], pendingData.B, sn.s.compressionLevel)
+		body = bb
 	} else {
-		body = pendingData.NewReader()
+		body = pendingData
+	}
+
+	if !sn.acquireInflightSlot() {
+		return fmt.Errorf("cannot send data block with the length %d, since the storage is stopped", dataLen)
 	}
+	defer sn.releaseInflightSlot()
 
-	if err := sn.doRequest("/internal/insert", body); err != nil {
-		return fmt.Errorf("cannot send data block with the length %d: %w", pendingData.Len(), err)
+	startTime := time.Now()
+	err := sn.doRequest("/internal/insert", body.NewReader())
+	sn.requestDuration.UpdateDuration(startTime)
+	sn.requestsTotal.Inc()
+	if err != nil {
+		return fmt.Errorf("cannot send data block with the length %d: %w", dataLen, err)
 	}
+	sn.sentBytesTotal.Add(body.Len())
 
 	return nil
 }
 
+// acquireInflightSlot waits until the number of concurrent requests to sn drops below -insert.maxInflightRequestsPerNode.
+//
+// It returns false if the storage is stopped while waiting.
+func (sn *storageNode) acquireInflightSlot() bool {
+	if sn.inflightCh != nil {
+		select {
+		case sn.inflightCh <- struct{}{}:
+		case <-sn.s.stopCh:
+			return false
+		}
+	}
+	sn.inflightRequests.Add(1)
+	return true
+}
+
+func (sn *storageNode) releaseInflightSlot() {
+	sn.inflightRequests.Add(-1)
+	if sn.inflightCh != nil {
+		<-sn.inflightCh
+	}
+}
+
 func (sn *storageNode) doRequest(path string, body io.Reader) error {
 	ctx, cancel := contextutil.NewStopChanContext(sn.s.stopCh)
 	defer cancel()
@@ -264,7 +497,17 @@ func (sn *storageNode) doRequest(path string, body io.Reader) error {
 		method = "POST"
 	}
 
-	reqURL := sn.getRequestURL(path)
+	version := ProtocolVersion
+	if SupportedProtocolVersions[path] != nil {
+		v, err := sn.pn.GetProtocolVersion(ctx, SupportedProtocolVersions, path, sn.fetchProtocolVersions)
+		if err != nil {
+			sn.setDisableTemporarily()
+			return fmt.Errorf("cannot send http %s request to %s: %w", method, sn.getRequestURL(path, version), err)
+		}
+		version = v
+	}
+
+	reqURL := sn.getRequestURL(path, version)
 	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
 	if err != nil {
 		return fmt.Errorf("cannot create http %s request for %s: %w", method, reqURL, err)
@@ -283,11 +526,15 @@ func (sn *storageNode) doRequest(path string, body io.Reader) error {
 	resp, err := sn.c.Do(req)
 	if err != nil {
 		sn.setDisableTemporarily()
+
+		// The storage node may be restarted with another release, so re-negotiate protocol versions with it.
+		sn.pn.Reset()
 		return fmt.Errorf("cannot send http request to %s: %s", reqURL, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode/100 == 2 {
+		sn.consecutiveFailures.Store(0)
 		sn.isReachable.Store(true)
 		return nil
 	}
@@ -302,47 +549,106 @@ func (sn *storageNode) doRequest(path string, body io.Reader) error {
 	return fmt.Errorf("unexpected response status code for request to %s: %d; want 2xx; response body: %q", reqURL, resp.StatusCode, respBody)
 }
 
-func (sn *storageNode) getRequestURL(path string) string {
-	return fmt.Sprintf("%s://%s%s?version=%s", sn.scheme, sn.addr, path, url.QueryEscape(ProtocolVersion))
+func (sn *storageNode) fetchProtocolVersions(ctx context.Context) (int, []byte, error) {
+	reqURL := fmt.Sprintf("%s://%s%s", sn.scheme, sn.addr, netclient.ProtocolVersionsPath)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot create http request for %s: %w", reqURL, err)
+	}
+	if err := sn.ac.SetHeaders(req, true); err != nil {
+		return 0, nil, fmt.Errorf("cannot set auth headers for %s: %w", reqURL, err)
+	}
+	resp, err := sn.c.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot send http request to %s: %w", reqURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot read response from %s: %w", reqURL, err)
+	}
+	return resp.StatusCode, data, nil
+}
+
+func (sn *storageNode) getRequestURL(path, version string) string {
+	return fmt.Sprintf("%s://%s%s?version=%s", sn.scheme, sn.addr, path, url.QueryEscape(version))
 }
 
 func (sn *storageNode) setDisableTemporarily() {
-	// Disable sending data to this sn for 10 seconds.
-	sn.disabledUntil.Store(fasttime.UnixTimestamp() + 10)
+	// Disable sending data to this sn with exponential backoff.
+	failures := sn.consecutiveFailures.Add(1)
+	d := getRetryInterval(failures, *retryMinInterval, *retryMaxInterval)
+	sn.disabledUntil.Store(fasttime.UnixTimestamp() + uint64(max(d.Seconds(), 1)))
 
 	sn.sendErrors.Inc()
 	sn.isReachable.Store(false)
 }
 
+// getRetryInterval returns the duration for disabling the storage node after the given number of consecutive failures.
+//
+// The duration starts from minInterval and is doubled after every subsequent failure up to maxInterval.
+func getRetryInterval(failures uint32, minInterval, maxInterval time.Duration) time.Duration {
+	d := minInterval
+	for i := uint32(1); i < failures && d < maxInterval; i++ {
+		d *= 2
+	}
+	return min(d, max(minInterval, maxInterval))
+}
+
 var zstdBufPool bytesutil.ByteBufferPool
 
 // NewStorage returns new Storage for the given addrs with the given authCfgs.
 //
+// Every addr may contain multiple replicas delimited by '|'. The ingested logs are replicated to all of them.
+//
 // The concurrency is the average number of concurrent connections per every addr.
 //
+// useHTTP2s enables HTTP/2 without TLS for the corresponding addrs.
+//
 // If disableCompression is set, then the data is sent uncompressed to the remote storage.
+// Otherwise the data is compressed with the given zstd compressionLevel.
 //
 // Call MustStop on the returned storage when it is no longer needed.
-func NewStorage(addrs []string, authCfgs []*promauth.Config, isTLSs []bool, concurrency int, disableCompression bool) *Storage {
-	pendingDataBuffers := make(chan *bytesutil.ByteBuffer, concurrency*len(addrs))
+func NewStorage(addrs []string, authCfgs []*promauth.Config, isTLSs, useHTTP2s []bool, concurrency int, disableCompression bool, compressionLevel int) *Storage {
+	if *flushInterval <= 0 {
+		logger.Fatalf("-insert.flushInterval must be positive; got %s", *flushInterval)
+	}
+	if maxBlockSize.IntN() <= 0 {
+		logger.Fatalf("-insert.maxBlockSize must be positive; got %d", maxBlockSize.IntN())
+	}
+
+	nodesCount := 0
+	for _, addr := range addrs {
+		nodesCount += len(netclient.SplitReplicaAddrs(addr))
+	}
+	pendingDataBuffers := make(chan *bytesutil.ByteBuffer, concurrency*nodesCount)
 	for i := 0; i < cap(pendingDataBuffers); i++ {
 		pendingDataBuffers <- &bytesutil.ByteBuffer{}
 	}
 
 	s := &Storage{
 		disableCompression: disableCompression,
+		compressionLevel:   compressionLevel,
 		pendingDataBuffers: pendingDataBuffers,
 		stopCh:             make(chan struct{}),
 	}
 
-	sns := make([]*storageNode, len(addrs))
+	var sns []*storageNode
+	replicaGroups := make([][]*storageNode, len(addrs))
 	for i, addr := range addrs {
-		sns[i] = newStorageNode(s, addr, authCfgs[i], isTLSs[i])
+		replicaAddrs := netclient.SplitReplicaAddrs(addr)
+		for _, replicaAddr := range replicaAddrs {
+			sn := newStorageNode(s, replicaAddr, authCfgs[i], isTLSs[i], useHTTP2s[i], len(replicaAddrs) > 1)
+			replicaGroups[i] = append(replicaGroups[i], sn)
+			sns = append(sns, sn)
+		}
 	}
 	s.sns = sns
+	s.replicaGroups = replicaGroups
 
 	// active streams tracker
-	s.srt = newStreamRowsTracker(len(sns))
+	s.srt = newStreamRowsTracker(len(replicaGroups))
 	_ = metrics.GetOrCreateGauge(`vl_insert_active_streams`, func() float64 {
 		return float64(s.getActiveStreams())
 	})
@@ -379,13 +685,32 @@ func (s *Storage) DebugFlush() {
 	wg.Wait()
 }
 
+// FlushPendingData sends the pending data to storage nodes and waits until it is accepted by them.
+func (s *Storage) FlushPendingData() {
+	var wg sync.WaitGroup
+	for _, sn := range s.sns {
+		wg.Add(1)
+		go func(sn *storageNode) {
+			defer wg.Done()
+			sn.flushPendingData(true)
+			sn.waitForSends()
+		}(sn)
+	}
+	wg.Wait()
+}
+
 // AddRow adds the given log row into s.
 func (s *Storage) AddRow(streamHash uint64, r *logstorage.InsertRow) {
 	idx := s.srt.getNodeIdx(streamHash)
-	sn := s.sns[idx]
-	sn.addRow(r)
+	for _, sn := range s.replicaGroups[idx] {
+		sn.addRow(r)
+	}
 }
 
+// sendInsertRequestToAnyNode sends pendingData to any available storage node.
+//
+// It must be called only for pendingData from storage nodes without replicas, since data from storage nodes
+// with replicas is re-sent only to the origin storage node in order to avoid duplicate logs.
 func (s *Storage) sendInsertRequestToAnyNode(pendingData *bytesutil.ByteBuffer) bool {
 	startIdx := int(fastrand.Uint32n(uint32(len(s.sns))))
 	for i := range s.sns {
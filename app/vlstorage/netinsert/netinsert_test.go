@@ -2,11 +2,20 @@ package netinsert
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
 func TestStreamRowsTracker(t *testing.T) {
@@ -55,3 +64,132 @@ func TestStreamRowsTracker(t *testing.T) {
 	nodesCount = 9
 	f(rowsCount, streamsCount, nodesCount)
 }
+
+func TestGetRetryInterval(t *testing.T) {
+	f := func(failures uint32, minInterval, maxInterval, resultExpected time.Duration) {
+		t.Helper()
+
+		result := getRetryInterval(failures, minInterval, maxInterval)
+		if result != resultExpected {
+			t.Fatalf("unexpected retry interval for failures=%d, minInterval=%s, maxInterval=%s; got %s; want %s",
+				failures, minInterval, maxInterval, result, resultExpected)
+		}
+	}
+
+	f(1, 10*time.Second, time.Minute, 10*time.Second)
+	f(2, 10*time.Second, time.Minute, 20*time.Second)
+	f(3, 10*time.Second, time.Minute, 40*time.Second)
+	f(4, 10*time.Second, time.Minute, time.Minute)
+	f(100, 10*time.Second, time.Minute, time.Minute)
+
+	// backoff is disabled
+	f(5, 10*time.Second, 10*time.Second, 10*time.Second)
+
+	// maxInterval is smaller than minInterval
+	f(5, 10*time.Second, time.Second, 10*time.Second)
+}
+
+func TestStorageReplicaDown(t *testing.T) {
+	type testServer struct {
+		*httptest.Server
+
+		isDown        atomic.Bool
+		receivedBytes atomic.Int64
+	}
+	newServer := func() *testServer {
+		ts := &testServer{}
+		ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/internal/insert" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			data, err := io.ReadAll(r.Body)
+			if err != nil || ts.isDown.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			ts.receivedBytes.Add(int64(len(data)))
+		}))
+		return ts
+	}
+
+	healthy := newServer()
+	defer healthy.Close()
+	broken := newServer()
+	defer broken.Close()
+	broken.isDown.Store(true)
+
+	ac, err := (&promauth.Options{}).NewConfig()
+	if err != nil {
+		t.Fatalf("cannot create auth config: %s", err)
+	}
+
+	// A single replica group with two replicas.
+	addr := strings.TrimPrefix(healthy.URL, "http://") + "|" + strings.TrimPrefix(broken.URL, "http://")
+	s := NewStorage([]string{addr}, []*promauth.Config{ac}, []bool{false}, []bool{false}, 1, true, 0)
+	defer s.MustStop()
+
+	r := &logstorage.InsertRow{
+		Timestamp: 123,
+		Fields: []logstorage.Field{
+			{
+				Name:  "_msg",
+				Value: strings.Repeat("foo bar baz ", 100),
+			},
+		},
+	}
+	rowLen := len(r.Marshal(nil))
+	rowsCount := 3 * maxBlockSize.IntN() / rowLen
+
+	// The ingestion mustn't be blocked by the unavailable replica.
+	doneCh := make(chan struct{})
+	go func() {
+		for i := 0; i < rowsCount; i++ {
+			s.AddRow(0, r)
+		}
+		s.FlushPendingData()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout while ingesting data with the unavailable replica")
+	}
+
+	expectedBytes := int64(rowsCount * rowLen)
+	if n := healthy.receivedBytes.Load(); n != expectedBytes {
+		t.Fatalf("unexpected number of bytes received by the healthy replica; got %d; want %d", n, expectedBytes)
+	}
+	if n := broken.receivedBytes.Load(); n != 0 {
+		t.Fatalf("unexpected number of bytes received by the unavailable replica; got %d; want 0", n)
+	}
+	if n := len(s.pendingDataBuffers); n != cap(s.pendingDataBuffers) {
+		t.Fatalf("unexpected number of free pending data buffers; got %d; want %d", n, cap(s.pendingDataBuffers))
+	}
+
+	sn := s.replicaGroups[0][1]
+	sn.replicaRetryMu.Lock()
+	bufferedBytes := sn.replicaRetryBlocksSize
+	sn.replicaRetryMu.Unlock()
+	if int64(bufferedBytes) != expectedBytes {
+		t.Fatalf("unexpected number of bytes buffered for the unavailable replica; got %d; want %d", bufferedBytes, expectedBytes)
+	}
+
+	// The buffered data must be sent only to the replica when it becomes available.
+	broken.isDown.Store(false)
+	sn.disabledUntil.Store(0)
+	sn.resendReplicaRetryBlocks()
+
+	if n := broken.receivedBytes.Load(); n != expectedBytes {
+		t.Fatalf("unexpected number of bytes received by the recovered replica; got %d; want %d", n, expectedBytes)
+	}
+	if n := healthy.receivedBytes.Load(); n != expectedBytes {
+		t.Fatalf("unexpected number of bytes received by the healthy replica after the recovery; got %d; want %d", n, expectedBytes)
+	}
+	sn.replicaRetryMu.Lock()
+	bufferedBytes = sn.replicaRetryBlocksSize
+	sn.replicaRetryMu.Unlock()
+	if bufferedBytes != 0 {
+		t.Fatalf("unexpected number of bytes buffered after the recovery; got %d; want 0", bufferedBytes)
+	}
+}
@@ -0,0 +1,134 @@
+package netselect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// NodeStatusProtocolVersion is the version of the protocol used for /internal/select/node_status HTTP endpoint.
+//
+// It must be updated every time the protocol changes.
+const NodeStatusProtocolVersion = "v1"
+
+// NodeStatus contains the status of a storage node.
+type NodeStatus struct {
+	// Addr is the address of the storage node from -storageNode.
+	Addr string `json:"addr,omitempty"`
+
+	// Zone is an optional zone of the storage node from -storageNode.zone.
+	Zone string `json:"zone,omitempty"`
+
+	// Healthy is set to true if the storage node successfully returned its status.
+	Healthy bool `json:"healthy"`
+
+	// Error contains an error returned by the storage node if it isn't healthy.
+	Error string `json:"error,omitempty"`
+
+	// ResponseTimeSeconds is the duration of the status request to the storage node.
+	ResponseTimeSeconds float64 `json:"response_time_seconds"`
+
+	// Version is the version of the storage node.
+	Version string `json:"version,omitempty"`
+
+	// UptimeSeconds is the uptime of the storage node.
+	UptimeSeconds float64 `json:"uptime_seconds"`
+
+	// IsReadOnly is set to true if the storage node doesn't accept new logs because of low free disk space.
+	IsReadOnly bool `json:"is_read_only"`
+
+	// FreeDiskSpaceBytes is the free disk space at the storage node.
+	FreeDiskSpaceBytes uint64 `json:"free_disk_space_bytes"`
+
+	// TotalDiskSpaceBytes is the total disk space at the storage node.
+	TotalDiskSpaceBytes uint64 `json:"total_disk_space_bytes"`
+
+	// DataSizeBytes is the compressed size of the logs stored at the storage node.
+	DataSizeBytes uint64 `json:"data_size_bytes"`
+
+	// RowsCount is the number of logs stored at the storage node.
+	RowsCount uint64 `json:"rows_count"`
+
+	// IngestionRate is the number of logs per second ingested into the storage node.
+	IngestionRate float64 `json:"ingestion_rate"`
+
+	// MaxIngestedTimestamp is the maximum timestamp in nanoseconds for the logs ingested into the storage node since its start.
+	MaxIngestedTimestamp int64 `json:"max_ingested_timestamp"`
+
+	// LagSeconds is the lag of the ingested logs at the storage node comparing to the freshest replica with the same data.
+	//
+	// It is always zero for storage nodes without replicas.
+	LagSeconds float64 `json:"lag_seconds"`
+}
+
+// GetClusterStatus returns statuses for all the storage nodes and their replicas.
+//
+// The returned statuses are in the order of storage nodes at -storageNode. Unavailable storage nodes are returned with Healthy=false.
+func (s *Storage) GetClusterStatus(ctx context.Context) []*NodeStatus {
+	statuses := make([]*NodeStatus, len(s.allNodes))
+
+	var wg sync.WaitGroup
+	for i := range s.allNodes {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.allNodes[nodeIdx]
+			startTime := time.Now()
+			ns, err := sn.getNodeStatus(ctx)
+			if err != nil {
+				ns = &NodeStatus{
+					Error: err.Error(),
+				}
+			} else {
+				ns.Healthy = true
+			}
+			ns.Addr = sn.addr
+			ns.Zone = sn.zone
+			ns.ResponseTimeSeconds = time.Since(startTime).Seconds()
+			statuses[nodeIdx] = ns
+		}(i)
+	}
+	wg.Wait()
+
+	// Calculate the lag for replicas. Replicas for every storage node are located next to it at s.allNodes.
+	nodeIdx := 0
+	for _, sn := range s.sns {
+		group := statuses[nodeIdx : nodeIdx+1+len(sn.replicas)]
+		nodeIdx += len(group)
+		if len(group) == 1 {
+			continue
+		}
+
+		freshestTimestamp := int64(0)
+		for _, ns := range group {
+			freshestTimestamp = max(freshestTimestamp, ns.MaxIngestedTimestamp)
+		}
+		for _, ns := range group {
+			if ns.Healthy && ns.MaxIngestedTimestamp > 0 {
+				ns.LagSeconds = float64(freshestTimestamp-ns.MaxIngestedTimestamp) / 1e9
+			}
+		}
+	}
+
+	return statuses
+}
+
+func (sn *storageNode) getNodeStatus(ctx context.Context) (*NodeStatus, error) {
+	args := url.Values{}
+	args.Set("version", NodeStatusProtocolVersion)
+
+	data, reqURL, err := sn.getPlainResponseBodyForPathAndArgs(ctx, "/internal/select/node_status", args)
+	if err != nil {
+		return nil, err
+	}
+
+	var ns NodeStatus
+	if err := json.Unmarshal(data, &ns); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal node status received from %q; data=%q: %w", reqURL, data, err)
+	}
+	return &ns, nil
+}
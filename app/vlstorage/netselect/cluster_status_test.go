@@ -0,0 +1,84 @@
+package netselect
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+)
+
+func TestStorageGetClusterStatus(t *testing.T) {
+	newServer := func(maxIngestedTimestamp int64) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			if maxIngestedTimestamp < 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintf(w, `{"version":"v1.2.3","rows_count":10,"max_ingested_timestamp":%d}`, maxIngestedTimestamp)
+		}))
+	}
+
+	s1 := newServer(5e9)
+	defer s1.Close()
+	s2 := newServer(2e9)
+	defer s2.Close()
+	s3 := newServer(-1)
+	defer s3.Close()
+	s4 := newServer(1e9)
+	defer s4.Close()
+
+	addr := func(s *httptest.Server) string {
+		return strings.TrimPrefix(s.URL, "http://")
+	}
+	addrs := []string{
+		addr(s1) + "|" + addr(s2) + "|" + addr(s3),
+		addr(s4),
+	}
+
+	ac, err := (&promauth.Options{}).NewConfig()
+	if err != nil {
+		t.Fatalf("cannot create auth config: %s", err)
+	}
+	acs := []*promauth.Config{ac, ac}
+	s := NewStorage(addrs, acs, []bool{false, false}, []bool{false, false}, []string{"a|b|c", ""}, []string{"", ""}, true, 1)
+	defer s.MustStop()
+
+	statuses := s.GetClusterStatus(t.Context())
+	if len(statuses) != 4 {
+		t.Fatalf("unexpected number of statuses; got %d; want 4", len(statuses))
+	}
+
+	f := func(idx int, addrExpected, zoneExpected string, healthyExpected bool, lagSecondsExpected float64) {
+		t.Helper()
+
+		ns := statuses[idx]
+		if ns.Addr != addrExpected {
+			t.Fatalf("unexpected addr for status #%d; got %q; want %q", idx, ns.Addr, addrExpected)
+		}
+		if ns.Zone != zoneExpected {
+			t.Fatalf("unexpected zone for status #%d; got %q; want %q", idx, ns.Zone, zoneExpected)
+		}
+		if ns.Healthy != healthyExpected {
+			t.Fatalf("unexpected healthy for status #%d; got %v; want %v; error: %s", idx, ns.Healthy, healthyExpected, ns.Error)
+		}
+		if ns.LagSeconds != lagSecondsExpected {
+			t.Fatalf("unexpected lag for status #%d; got %v; want %v", idx, ns.LagSeconds, lagSecondsExpected)
+		}
+		if healthyExpected && (ns.Version != "v1.2.3" || ns.RowsCount != 10) {
+			t.Fatalf("unexpected status #%d: %#v", idx, ns)
+		}
+		if !healthyExpected && ns.Error == "" {
+			t.Fatalf("expecting non-empty error for status #%d", idx)
+		}
+	}
+
+	f(0, addr(s1), "a", true, 0)
+	f(1, addr(s2), "b", true, 3)
+	f(2, addr(s3), "c", false, 0)
+	f(3, addr(s4), "", true, 0)
+}
@@ -0,0 +1,190 @@
+package netselect
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	hedgedRequestsPercentile = flag.Float64("select.hedgedRequestsPercentile", 0.95, "The response time percentile for -storageNode replicas, "+
+		"after which the request is additionally sent to the next replica. The first received response is used. "+
+		"Hedged requests are sent only to -storageNode entries with multiple replicas delimited by '|'. Set to 0 for disabling hedged requests. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#hedged-requests")
+	hedgedRequestsMinDelay = flag.Duration("select.hedgedRequestsMinDelay", 50*time.Millisecond, "The minimum delay before sending hedged request "+
+		"to the next -storageNode replica. See -select.hedgedRequestsPercentile")
+)
+
+var (
+	hedgedRequestsTotal    = metrics.NewCounter(`vl_select_hedged_requests_total`)
+	hedgedRequestsWonTotal = metrics.NewCounter(`vl_select_hedged_requests_won_total`)
+)
+
+// getResponseBodyForPathAndArgs sends the request to sn and returns the response body.
+//
+// If sn has replicas, then the request is sent to the next replica when the current replica doesn't respond
+// during the hedge delay or returns an error. The first successful response is returned, while the remaining requests are canceled.
+// Replicas are queried in the order defined by readPreference. See getReplicasForReadPreference.
+func (sn *storageNode) getResponseBodyForPathAndArgs(ctx context.Context, readPreference, path string, args url.Values) (io.ReadCloser, string, error) {
+	nodes := sn.getReplicasForReadPreference(readPreference)
+	if len(nodes) == 1 || *hedgedRequestsPercentile <= 0 {
+		return nodes[0].sendRequest(ctx, path, args)
+	}
+
+	delay := sn.latency.getPercentile(*hedgedRequestsPercentile, *hedgedRequestsMinDelay)
+
+	type response struct {
+		nodeIdx int
+		body    io.ReadCloser
+		reqURL  string
+		err     error
+	}
+	resultCh := make(chan response, len(nodes))
+	cancels := make([]func(), 0, len(nodes))
+
+	startRequest := func() {
+		nodeIdx := len(cancels)
+		ctxLocal, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			startTime := time.Now()
+			body, reqURL, err := nodes[nodeIdx].sendRequest(ctxLocal, path, args)
+			if err == nil {
+				sn.latency.update(time.Since(startTime))
+			}
+			resultCh <- response{
+				nodeIdx: nodeIdx,
+				body:    body,
+				reqURL:  reqURL,
+				err:     err,
+			}
+		}()
+	}
+
+	t := timerpool.Get(delay)
+	defer timerpool.Put(t)
+
+	startRequest()
+	pending := 1
+	var firstErr error
+	for {
+		select {
+		case r := <-resultCh:
+			pending--
+			if r.err == nil {
+				if r.nodeIdx > 0 {
+					hedgedRequestsWonTotal.Inc()
+				}
+				for i, cancel := range cancels {
+					if i != r.nodeIdx {
+						cancel()
+					}
+				}
+				if pending > 0 {
+					// Close responses, which may be received from other replicas after the cancellation.
+					go func() {
+						for range pending {
+							r := <-resultCh
+							if r.err == nil {
+								_ = r.body.Close()
+							}
+						}
+					}()
+				}
+				body := &cancelOnCloseReader{
+					ReadCloser: r.body,
+					cancel:     cancels[r.nodeIdx],
+				}
+				return body, r.reqURL, nil
+			}
+
+			cancels[r.nodeIdx]()
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if len(cancels) < len(nodes) && ctx.Err() == nil {
+				// Send the request to the next replica without waiting for the hedge delay,
+				// since the current replica returned an error.
+				startRequest()
+				pending++
+				continue
+			}
+			if pending == 0 {
+				return nil, "", firstErr
+			}
+		case <-t.C:
+			if len(cancels) < len(nodes) {
+				hedgedRequestsTotal.Inc()
+				startRequest()
+				pending++
+				t.Reset(delay)
+			}
+		}
+	}
+}
+
+// cancelOnCloseReader cancels the request context when the response body is closed.
+type cancelOnCloseReader struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (r *cancelOnCloseReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
+
+// latencyTracker tracks the response times for the recent requests.
+type latencyTracker struct {
+	mu sync.Mutex
+
+	// samples contains the recent response times. It is used as a ring buffer.
+	samples []time.Duration
+
+	// nextIdx is the index of the next sample to overwrite at samples after the buffer is full.
+	nextIdx int
+
+	// buf is a temporary buffer used by getPercentile.
+	buf []time.Duration
+}
+
+// latencyTrackerMaxSamples is the maximum number of recent response times to track.
+const latencyTrackerMaxSamples = 1024
+
+func (lt *latencyTracker) update(d time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if len(lt.samples) < latencyTrackerMaxSamples {
+		lt.samples = append(lt.samples, d)
+		return
+	}
+	lt.samples[lt.nextIdx] = d
+	lt.nextIdx = (lt.nextIdx + 1) % len(lt.samples)
+}
+
+// getPercentile returns the given percentile phi (0..1) for the tracked response times.
+//
+// minDelay is returned if the percentile is smaller than minDelay or if there are no tracked response times.
+func (lt *latencyTracker) getPercentile(phi float64, minDelay time.Duration) time.Duration {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if len(lt.samples) == 0 {
+		return minDelay
+	}
+
+	lt.buf = append(lt.buf[:0], lt.samples...)
+	slices.Sort(lt.buf)
+	idx := int(phi * float64(len(lt.buf)))
+	idx = min(max(idx, 0), len(lt.buf)-1)
+	return max(lt.buf[idx], minDelay)
+}
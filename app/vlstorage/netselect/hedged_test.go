@@ -0,0 +1,103 @@
+package netselect
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+)
+
+func TestLatencyTrackerGetPercentile(t *testing.T) {
+	var lt latencyTracker
+
+	// no samples
+	if d := lt.getPercentile(0.9, time.Millisecond); d != time.Millisecond {
+		t.Fatalf("unexpected percentile for empty tracker; got %s; want %s", d, time.Millisecond)
+	}
+
+	for i := 1; i <= 100; i++ {
+		lt.update(time.Duration(i) * time.Millisecond)
+	}
+	if d := lt.getPercentile(0.9, time.Millisecond); d != 91*time.Millisecond {
+		t.Fatalf("unexpected 0.9 percentile; got %s; want %s", d, 91*time.Millisecond)
+	}
+	if d := lt.getPercentile(0.9, time.Second); d != time.Second {
+		t.Fatalf("unexpected 0.9 percentile with minDelay; got %s; want %s", d, time.Second)
+	}
+
+	// old samples must be overwritten
+	for i := 0; i < latencyTrackerMaxSamples; i++ {
+		lt.update(time.Hour)
+	}
+	if d := lt.getPercentile(0, time.Millisecond); d != time.Hour {
+		t.Fatalf("unexpected percentile after overwriting samples; got %s; want %s", d, time.Hour)
+	}
+}
+
+func TestStorageNodeGetResponseBodyForPathAndArgsHedged(t *testing.T) {
+	newServer := func(delay time.Duration, statusCode int, response string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Read the request body, so the request context is canceled when the client closes the connection.
+			_, _ = io.Copy(io.Discard, r.Body)
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			w.WriteHeader(statusCode)
+			_, _ = w.Write([]byte(response))
+		}))
+	}
+
+	f := func(servers []*httptest.Server, responseExpected string) {
+		t.Helper()
+
+		var addrs []string
+		for _, s := range servers {
+			addrs = append(addrs, strings.TrimPrefix(s.URL, "http://"))
+		}
+
+		ac, err := (&promauth.Options{}).NewConfig()
+		if err != nil {
+			t.Fatalf("cannot create auth config: %s", err)
+		}
+		s := NewStorage([]string{strings.Join(addrs, "|")}, []*promauth.Config{ac}, []bool{false}, []bool{false}, []string{""}, []string{""}, true, 1)
+		defer s.MustStop()
+
+		body, _, err := s.sns[0].getResponseBodyForPathAndArgs(context.Background(), "", "/foo", url.Values{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		data, err := io.ReadAll(body)
+		_ = body.Close()
+		if err != nil {
+			t.Fatalf("cannot read response: %s", err)
+		}
+		if string(data) != responseExpected {
+			t.Fatalf("unexpected response; got %q; want %q", data, responseExpected)
+		}
+	}
+
+	fast := newServer(0, http.StatusOK, "fast")
+	defer fast.Close()
+	slow := newServer(10*time.Second, http.StatusOK, "slow")
+	defer slow.Close()
+	broken := newServer(0, http.StatusInternalServerError, "error")
+	defer broken.Close()
+
+	// the primary replica responds in time
+	f([]*httptest.Server{fast, slow}, "fast")
+
+	// the primary replica is slow, so the hedged request to the next replica wins
+	f([]*httptest.Server{slow, fast}, "fast")
+
+	// the primary replica returns an error, so the next replica is queried
+	f([]*httptest.Server{broken, fast}, "fast")
+	f([]*httptest.Server{broken, slow, fast}, "fast")
+}
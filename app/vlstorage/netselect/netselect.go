@@ -6,23 +6,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"math"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/contextutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
 	"github.com/VictoriaMetrics/metrics"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netclient"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
@@ -57,10 +60,35 @@ const (
 	// It must be updated every time the protocol changes.
 	StreamIDsProtocolVersion = "v4"
 
+	// StreamsLastSeenProtocolVersion is the version of the protocol used for /internal/select/streams_last_seen HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	StreamsLastSeenProtocolVersion = "v1"
+
+	// HitsPreaggregatedProtocolVersion is the version of the protocol used for /internal/select/hits_preaggregated HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	HitsPreaggregatedProtocolVersion = "v1"
+
+	// ApproxCountProtocolVersion is the version of the protocol used for /internal/select/approx_count HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	ApproxCountProtocolVersion = "v1"
+
 	// QueryProtocolVersion is the version of the protocol used for /internal/select/query HTTP endpoint.
 	//
 	// It must be updated every time the protocol changes.
-	QueryProtocolVersion = "v4"
+	QueryProtocolVersion = "v6"
+
+	// PinViewProtocolVersion is the version of the protocol used for /internal/select/pin_view HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	PinViewProtocolVersion = "v1"
+
+	// UnpinViewProtocolVersion is the version of the protocol used for /internal/select/unpin_view HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	UnpinViewProtocolVersion = "v1"
 
 	// DeleteRunTaskProtocolVersion is the version of the protocol used for /internal/delete/run_task HTTP endpoint.
 	//
@@ -78,11 +106,58 @@ const (
 	DeleteActiveTasksProtocolVersion = "v1"
 )
 
+// SupportedProtocolVersions contains protocol versions supported by /internal/select/* and /internal/delete/* endpoints.
+//
+// The newest version for every endpoint is sent by vlselect, while the older versions are accepted by vlstorage.
+// The previous version must be kept in the list after backwards-compatible protocol changes, such as adding optional args.
+// This allows rolling upgrades of cluster components. See https://docs.victoriametrics.com/victorialogs/cluster/#upgrading
+//
+// The oldest version in the list is sent to storage nodes without protocol negotiation support,
+// so it must match the version used by the previous release.
+var SupportedProtocolVersions = netclient.ProtocolVersions{
+	"/internal/select/query":                  {QueryProtocolVersion, "v4"},
+	"/internal/select/field_names":            {FieldNamesProtocolVersion},
+	"/internal/select/field_values":           {FieldValuesProtocolVersion},
+	"/internal/select/stream_field_names":     {StreamFieldNamesProtocolVersion},
+	"/internal/select/stream_field_values":    {StreamFieldValuesProtocolVersion},
+	"/internal/select/streams":                {StreamsProtocolVersion},
+	"/internal/select/stream_ids":             {StreamIDsProtocolVersion},
+	"/internal/select/streams_last_seen":      {StreamsLastSeenProtocolVersion},
+	"/internal/select/hits_preaggregated":     {HitsPreaggregatedProtocolVersion},
+	"/internal/select/approx_count":           {ApproxCountProtocolVersion},
+	"/internal/select/pin_view":               {PinViewProtocolVersion},
+	"/internal/select/unpin_view":             {UnpinViewProtocolVersion},
+	"/internal/select/max_ingested_timestamp": {MaxIngestedTimestampProtocolVersion},
+	"/internal/select/node_status":            {NodeStatusProtocolVersion},
+	"/internal/delete/run_task":               {DeleteRunTaskProtocolVersion},
+	"/internal/delete/stop_task":              {DeleteStopTaskProtocolVersion},
+	"/internal/delete/active_tasks":           {DeleteActiveTasksProtocolVersion},
+}
+
 // Storage is a network storage for querying remote storage nodes in the cluster.
 type Storage struct {
 	sns []*storageNode
 
+	// allNodes contains sns and their replicas.
+	//
+	// It is used for requests, which must be sent to all the replicas.
+	allNodes []*storageNode
+
 	disableCompression bool
+
+	// compressionLevel is zstd compression level, which must be used by storage nodes for compressing responses.
+	compressionLevel int
+
+	// coldTierConcurrencyCh limits the number of concurrent requests to the cold tier. See -select.coldTierMaxConcurrentRequests.
+	//
+	// It is nil if there is no limit.
+	coldTierConcurrencyCh chan struct{}
+
+	// stopCh is closed when the storage must be stopped.
+	stopCh chan struct{}
+
+	// wg tracks background workers such as replica status checker.
+	wg sync.WaitGroup
 }
 
 type storageNode struct {
@@ -103,12 +178,38 @@ type storageNode struct {
 
 	// sendErrors counts failed send attempts for this storage node.
 	sendErrors *metrics.Counter
+
+	// cb prevents from sending requests to the storage node after too many consecutive connection errors.
+	cb netclient.CircuitBreaker
+
+	// replicas contains storage nodes with the same data as the given storage node.
+	//
+	// Requests are sent to the next replica if the storage node doesn't respond in time. See -select.hedgedRequestsPercentile.
+	replicas []*storageNode
+
+	// latency tracks response times for the storage node and its replicas.
+	latency latencyTracker
+
+	// pn negotiates protocol versions with the storage node.
+	pn netclient.ProtocolNegotiator
+
+	// zone is an optional zone for the storage node. See -storageNode.zone.
+	zone string
+
+	// tier is an optional retention tier for the storage node and its replicas. See -storageNode.tier.
+	tier string
+
+	// tierStats contains metrics for the tier. It is nil if the tier isn't set.
+	tierStats *tierStats
+
+	// maxIngestedTimestamp is the maximum timestamp for the logs ingested into the storage node.
+	//
+	// It is updated periodically for storage nodes with replicas. See -select.replicaStatusCheckInterval.
+	maxIngestedTimestamp atomic.Int64
 }
 
-func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS bool) *storageNode {
-	tr := httputil.NewTransport(false, "vlselect_backend")
-	tr.TLSHandshakeTimeout = 20 * time.Second
-	tr.DisableCompression = true
+func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS, useHTTP2 bool) *storageNode {
+	tr := netclient.NewTransport("vlselect_backend", useHTTP2)
 
 	scheme := "http"
 	if isTLS {
@@ -126,17 +227,27 @@ func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS bool) *s
 
 		sendErrors: metrics.GetOrCreateCounter(fmt.Sprintf(`vl_select_remote_send_errors_total{addr=%q}`, addr)),
 	}
+
+	_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vl_select_remote_circuit_breaker_open{addr=%q}`, addr), func() float64 {
+		if sn.cb.IsOpen() {
+			return 1
+		}
+		return 0
+	})
+
 	return sn
 }
 
 func (sn *storageNode) runQuery(qctx *logstorage.QueryContext, processBlock func(db *logstorage.DataBlock)) error {
 	args := sn.getCommonArgs(QueryProtocolVersion, qctx)
+	args.Set("annotate_rows", fmt.Sprintf("%v", qctx.AnnotateRows))
+	args.Set("view_id", qctx.ViewID)
 
 	qsLocal := &logstorage.QueryStats{}
 	defer qctx.QueryStats.UpdateAtomic(qsLocal)
 
 	path := "/internal/select/query"
-	responseBody, reqURL, err := sn.getResponseBodyForPathAndArgs(qctx.Context, path, args)
+	responseBody, reqURL, err := sn.getResponseBodyForPathAndArgs(qctx.Context, qctx.GetReadPreference(), path, args)
 	if err != nil {
 		return err
 	}
@@ -147,6 +258,8 @@ func (sn *storageNode) runQuery(qctx *logstorage.QueryContext, processBlock func
 	var buf []byte
 	var db logstorage.DataBlock
 	var valuesBuf []string
+	var nodeValues []string
+	var tierValues []string
 	for {
 		if _, err := io.ReadFull(responseBody, dataLenBuf[:]); err != nil {
 			if errors.Is(err, io.EOF) {
@@ -196,6 +309,29 @@ func (sn *storageNode) runQuery(qctx *logstorage.QueryContext, processBlock func
 			valuesBuf = vb
 			src = tail
 
+			if qctx.AnnotateRows && db.GetColumnByName("_debug_partition") != nil {
+				// Add the address of the storage node to the logs annotated by vlstorage.
+				// Blocks without _debug_partition column are generated by pipes at vlstorage, so they aren't annotated.
+				nodeValues = slicesutil.SetLength(nodeValues, db.RowsCount())
+				for i := range nodeValues {
+					nodeValues[i] = sn.addr
+				}
+				db.Columns = append(db.Columns, logstorage.BlockColumn{
+					Name:   "_debug_node",
+					Values: nodeValues,
+				})
+				if sn.tier != "" {
+					tierValues = slicesutil.SetLength(tierValues, db.RowsCount())
+					for i := range tierValues {
+						tierValues[i] = sn.tier
+					}
+					db.Columns = append(db.Columns, logstorage.BlockColumn{
+						Name:   "_debug_tier",
+						Values: tierValues,
+					})
+				}
+			}
+
 			processBlock(&db)
 
 			clear(valuesBuf)
@@ -245,16 +381,54 @@ func (sn *storageNode) getStreamIDs(qctx *logstorage.QueryContext, limit uint64)
 	return sn.getValuesWithHits(qctx, "/internal/select/stream_ids", args)
 }
 
+func (sn *storageNode) getStreamsLastSeen(qctx *logstorage.QueryContext) ([]logstorage.StreamLastSeen, error) {
+	args := sn.getCommonArgs(StreamsLastSeenProtocolVersion, qctx)
+
+	data, err := sn.getResponseForPathAndArgs(qctx, "/internal/select/streams_last_seen", args)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalStreamsLastSeen(qctx, data)
+}
+
+func (sn *storageNode) getHitsPreaggregated(qctx *logstorage.QueryContext, step, offset int64) ([]int64, []uint64, bool, error) {
+	args := sn.getCommonArgs(HitsPreaggregatedProtocolVersion, qctx)
+	args.Set("step", fmt.Sprintf("%d", step))
+	args.Set("offset", fmt.Sprintf("%d", offset))
+
+	data, err := sn.getResponseForPathAndArgs(qctx, "/internal/select/hits_preaggregated", args)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return unmarshalHitsPreaggregated(qctx, data)
+}
+
+func (sn *storageNode) getApproxCount(qctx *logstorage.QueryContext) (*logstorage.ApproxCount, error) {
+	args := sn.getCommonArgs(ApproxCountProtocolVersion, qctx)
+
+	data, err := sn.getResponseForPathAndArgs(qctx, "/internal/select/approx_count", args)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalApproxCount(qctx, data)
+}
+
 func (sn *storageNode) getTenantIDs(ctx context.Context, start, end int64) ([]logstorage.TenantID, error) {
 	args := url.Values{}
 	args.Set("start", fmt.Sprintf("%d", start))
 	args.Set("end", fmt.Sprintf("%d", end))
 
 	path := "/internal/select/tenant_ids"
-	data, reqURL, err := sn.getPlainResponseBodyForPathAndArgs(ctx, path, args)
+	responseBody, reqURL, err := sn.getResponseBodyForPathAndArgs(ctx, "", path, args)
 	if err != nil {
 		return nil, err
 	}
+	defer responseBody.Close()
+
+	data, err := io.ReadAll(responseBody)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response from %q: %w", reqURL, err)
+	}
 	var tenantIDs []logstorage.TenantID
 	if err := json.Unmarshal(data, &tenantIDs); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal tenantIDs received from %q; data=%q: %w", reqURL, data, err)
@@ -268,10 +442,28 @@ func (sn *storageNode) getCommonArgs(version string, qctx *logstorage.QueryConte
 	args := url.Values{}
 	args.Set("version", version)
 	args.Set("tenant_ids", string(logstorage.MarshalTenantIDsToJSON(qctx.TenantIDs)))
-	args.Set("query", qctx.Query.String())
+	args.Set("query", sn.getTierQuery(qctx.Query).String())
 	args.Set("timestamp", fmt.Sprintf("%d", qctx.Query.GetTimestamp()))
 	args.Set("disable_compression", fmt.Sprintf("%v", sn.s.disableCompression))
+	// compression_level is optional, so it is ignored by older storage nodes, which compress responses with the default level.
+	// That's why it doesn't need protocol version change.
+	args.Set("compression_level", fmt.Sprintf("%d", sn.s.compressionLevel))
 	args.Set("allow_partial_response", fmt.Sprintf("%v", qctx.AllowPartialResponse))
+	if n := sn.getMaxBytesRead(); n > 0 {
+		// max_bytes_read is optional, so it doesn't need protocol version change.
+		// Older storage nodes ignore it.
+		args.Set("max_bytes_read", fmt.Sprintf("%d", n))
+	}
+
+	// Pass the remaining time until the query deadline, so vlstorage stops the query execution at the deadline
+	// even if the connection to it isn't closed in time. The relative duration is passed instead of the deadline itself
+	// in order to be resilient to clock skew between vlselect and vlstorage nodes.
+	// timeout is optional, so it doesn't need protocol version change. Older storage nodes ignore it.
+	timeoutMsecs := int64(0)
+	if deadline, ok := qctx.Context.Deadline(); ok {
+		timeoutMsecs = max(time.Until(deadline).Milliseconds(), 1)
+	}
+	args.Set("timeout", fmt.Sprintf("%d", timeoutMsecs))
 
 	hiddenFieldsFilters, err := json.Marshal(qctx.HiddenFieldsFilters)
 	if err != nil {
@@ -283,15 +475,15 @@ func (sn *storageNode) getCommonArgs(version string, qctx *logstorage.QueryConte
 }
 
 func (sn *storageNode) getValuesWithHits(qctx *logstorage.QueryContext, path string, args url.Values) ([]logstorage.ValueWithHits, error) {
-	data, err := sn.getResponseForPathAndArgs(qctx.Context, path, args)
+	data, err := sn.getResponseForPathAndArgs(qctx, path, args)
 	if err != nil {
 		return nil, err
 	}
 	return unmarshalValuesWithHits(qctx, data)
 }
 
-func (sn *storageNode) getResponseForPathAndArgs(ctx context.Context, path string, args url.Values) ([]byte, error) {
-	responseBody, reqURL, err := sn.getResponseBodyForPathAndArgs(ctx, path, args)
+func (sn *storageNode) getResponseForPathAndArgs(qctx *logstorage.QueryContext, path string, args url.Values) ([]byte, error) {
+	responseBody, reqURL, err := sn.getResponseBodyForPathAndArgs(qctx.Context, qctx.GetReadPreference(), path, args)
 	if err != nil {
 		return nil, err
 	}
@@ -315,8 +507,29 @@ func (sn *storageNode) getResponseForPathAndArgs(ctx context.Context, path strin
 	return bb.B[bbLen:], nil
 }
 
-func (sn *storageNode) getResponseBodyForPathAndArgs(ctx context.Context, path string, args url.Values) (io.ReadCloser, string, error) {
+// sendRequest sends the request to sn without hedging. Use getResponseBodyForPathAndArgs for sending requests to storage nodes with replicas.
+func (sn *storageNode) sendRequest(ctx context.Context, path string, args url.Values) (io.ReadCloser, string, error) {
 	reqURL := sn.getRequestURL(path)
+
+	if sn.cb.IsOpen() {
+		return nil, "", &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf("storage node at %q is temporarily unavailable because of consecutive connection errors; see -storageNode.circuitBreakerMaxErrors", sn.addr),
+			StatusCode: http.StatusBadGateway,
+		}
+	}
+
+	if version := args.Get("version"); version != "" {
+		negotiatedVersion, err := sn.pn.GetProtocolVersion(ctx, SupportedProtocolVersions, path, sn.fetchProtocolVersions)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot send request to %q: %w", reqURL, err)
+		}
+		if negotiatedVersion != version {
+			// Do not modify the original args, since they may be used concurrently for requests to replicas.
+			args = maps.Clone(args)
+			args.Set("version", negotiatedVersion)
+		}
+	}
+
 	reqBody := strings.NewReader(args.Encode())
 	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, reqBody)
 	if err != nil {
@@ -330,6 +543,13 @@ func (sn *storageNode) getResponseBodyForPathAndArgs(ctx context.Context, path s
 	// send the request to the storage node
 	resp, err := sn.c.Do(req)
 	if err != nil {
+		if ctx.Err() == nil {
+			sn.cb.RegisterError()
+
+			// The storage node may be restarted with another release, so re-negotiate protocol versions with it.
+			sn.pn.Reset()
+		}
+
 		// Wrap the error into httpserver.ErrorWithStatusCode in order to return the proper status code to the client.
 		// See https://github.com/VictoriaMetrics/VictoriaLogs/issues/576
 		//
@@ -341,6 +561,8 @@ func (sn *storageNode) getResponseBodyForPathAndArgs(ctx context.Context, path s
 		}
 	}
 
+	sn.cb.RegisterSuccess()
+
 	if resp.StatusCode != http.StatusOK {
 		responseBody, err := io.ReadAll(resp.Body)
 		if err != nil {
@@ -353,32 +575,90 @@ func (sn *storageNode) getResponseBodyForPathAndArgs(ctx context.Context, path s
 	return resp.Body, reqURL, nil
 }
 
+func (sn *storageNode) fetchProtocolVersions(ctx context.Context) (int, []byte, error) {
+	reqURL := sn.getRequestURL(netclient.ProtocolVersionsPath)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot create a request for %q: %w", reqURL, err)
+	}
+	if err := sn.ac.SetHeaders(req, true); err != nil {
+		return 0, nil, fmt.Errorf("cannot set auth headers at %q: %w", reqURL, err)
+	}
+	resp, err := sn.c.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot connect to storage node at %q: %w", reqURL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot read response from %q: %w", reqURL, err)
+	}
+	return resp.StatusCode, data, nil
+}
+
 func (sn *storageNode) getRequestURL(path string) string {
 	return fmt.Sprintf("%s://%s%s", sn.scheme, sn.addr, path)
 }
 
 // NewStorage returns new Storage for the given addrs and the given authCfgs.
 //
+// Every addr may contain multiple replicas delimited by '|'. Replicas must contain the same data.
+//
+// useHTTP2s enables HTTP/2 without TLS for the corresponding addrs.
+//
+// zones contains optional zones for the corresponding addrs. Zones for replicas are delimited by '|'.
+//
+// tiers contains optional retention tiers for the corresponding addrs. See -storageNode.tier.
+//
 // If disableCompression is set, then uncompressed responses are received from storage nodes.
+// Otherwise storage nodes compress responses with the given zstd compressionLevel.
 //
 // Call MustStop on the returned storage when it is no longer needed.
-func NewStorage(addrs []string, authCfgs []*promauth.Config, isTLSs []bool, disableCompression bool) *Storage {
+func NewStorage(addrs []string, authCfgs []*promauth.Config, isTLSs, useHTTP2s []bool, zones, tiers []string, disableCompression bool, compressionLevel int) *Storage {
 	s := &Storage{
 		disableCompression: disableCompression,
+		compressionLevel:   compressionLevel,
+		stopCh:             make(chan struct{}),
 	}
 
 	sns := make([]*storageNode, len(addrs))
 	for i, addr := range addrs {
-		sns[i] = newStorageNode(s, addr, authCfgs[i], isTLSs[i])
+		replicaAddrs := netclient.SplitReplicaAddrs(addr)
+		replicaZones := splitReplicaZones(zones[i], len(replicaAddrs))
+		sn := newStorageNode(s, replicaAddrs[0], authCfgs[i], isTLSs[i], useHTTP2s[i])
+		sn.zone = replicaZones[0]
+		sn.tier = tiers[i]
+		sn.tierStats = newTierStats(tiers[i])
+		for j, replicaAddr := range replicaAddrs[1:] {
+			replica := newStorageNode(s, replicaAddr, authCfgs[i], isTLSs[i], useHTTP2s[i])
+			replica.zone = replicaZones[j+1]
+			replica.tier = sn.tier
+			replica.tierStats = sn.tierStats
+			sn.replicas = append(sn.replicas, replica)
+		}
+		sns[i] = sn
+		s.allNodes = append(s.allNodes, sn)
+		s.allNodes = append(s.allNodes, sn.replicas...)
 	}
 	s.sns = sns
 
+	if *coldTierMaxConcurrentRequests > 0 && slices.Contains(tiers, tierCold) {
+		s.coldTierConcurrencyCh = make(chan struct{}, *coldTierMaxConcurrentRequests)
+	}
+
+	s.startReplicaStatusChecker()
+
 	return s
 }
 
 // MustStop stops the s.
 func (s *Storage) MustStop() {
+	close(s.stopCh)
+	s.wg.Wait()
+
 	s.sns = nil
+	s.allNodes = nil
 }
 
 // RunQuery runs the given qctx and calls writeBlock for the returned data blocks
@@ -403,6 +683,12 @@ func (s *Storage) runQuery(stopCh <-chan struct{}, qctx *logstorage.QueryContext
 
 	qctxLocal := qctx.WithContext(ctxWithCancel)
 
+	release, err := s.acquireColdTier(ctxWithCancel, qctx.Query)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	errs := make([]error, len(s.sns))
 
 	var wg sync.WaitGroup
@@ -412,6 +698,9 @@ func (s *Storage) runQuery(stopCh <-chan struct{}, qctx *logstorage.QueryContext
 			defer wg.Done()
 
 			sn := s.sns[nodeIdx]
+			if sn.skipTier(qctx.Query) {
+				return
+			}
 			err := sn.runQuery(qctxLocal, func(db *logstorage.DataBlock) {
 				writeBlock(uint(nodeIdx), db)
 			})
@@ -479,12 +768,233 @@ func (s *Storage) GetStreamIDs(qctx *logstorage.QueryContext, limit uint64) ([]l
 	})
 }
 
+// GetStreamsLastSeen returns the last time when logs were received for streams matching qctx.
+//
+// The last seen time is merged among all the storage nodes, since logs for the same stream may be spread among multiple storage nodes.
+func (s *Storage) GetStreamsLastSeen(qctx *logstorage.QueryContext) ([]logstorage.StreamLastSeen, error) {
+	ctxWithCancel, cancel := context.WithCancel(qctx.Context)
+	defer cancel()
+
+	release, err := s.acquireColdTier(ctxWithCancel, qctx.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	results := make([][]logstorage.StreamLastSeen, len(s.sns))
+	errs := make([]error, len(s.sns))
+
+	var wg sync.WaitGroup
+	for i := range s.sns {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.sns[nodeIdx]
+			if sn.skipTier(qctx.Query) {
+				return
+			}
+			qctxLocal := qctx.WithContext(ctxWithCancel)
+			slss, err := sn.getStreamsLastSeen(qctxLocal)
+			results[nodeIdx] = slss
+			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, qctx.AllowPartialResponse)
+		}(i)
+	}
+	wg.Wait()
+
+	if err := getFirstError(errs, qctx.AllowPartialResponse); err != nil {
+		return nil, err
+	}
+
+	slss := logstorage.MergeStreamsLastSeen(results)
+
+	return slss, nil
+}
+
+// GetHitsPreaggregated returns the number of logs matching qctx grouped into time buckets with the given step and offset.
+//
+// false is returned if at least a single storage node cannot obtain the hits from the pre-aggregated data.
+//
+// See logstorage.Storage.GetHitsPreaggregated for details.
+func (s *Storage) GetHitsPreaggregated(qctx *logstorage.QueryContext, step, offset int64) ([]int64, []uint64, bool, error) {
+	ctxWithCancel, cancel := context.WithCancel(qctx.Context)
+	defer cancel()
+
+	release, err := s.acquireColdTier(ctxWithCancel, qctx.Query)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer release()
+
+	timestampsResults := make([][]int64, len(s.sns))
+	hitsResults := make([][]uint64, len(s.sns))
+	oks := make([]bool, len(s.sns))
+	errs := make([]error, len(s.sns))
+
+	var wg sync.WaitGroup
+	for i := range s.sns {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.sns[nodeIdx]
+			if sn.skipTier(qctx.Query) {
+				oks[nodeIdx] = true
+				return
+			}
+			qctxLocal := qctx.WithContext(ctxWithCancel)
+			timestamps, hits, ok, err := sn.getHitsPreaggregated(qctxLocal, step, offset)
+			timestampsResults[nodeIdx] = timestamps
+			hitsResults[nodeIdx] = hits
+			oks[nodeIdx] = ok
+			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, qctx.AllowPartialResponse)
+		}(i)
+	}
+	wg.Wait()
+
+	if err := getFirstError(errs, qctx.AllowPartialResponse); err != nil {
+		return nil, nil, false, err
+	}
+
+	// Logs for the same time bucket may be spread among multiple storage nodes, so sum the hits across nodes.
+	m := make(map[int64]uint64)
+	for i := range s.sns {
+		if !oks[i] {
+			// Fall back to the regular query execution if some storage node cannot return pre-aggregated hits
+			// or if it is unavailable and partial responses are allowed.
+			return nil, nil, false, nil
+		}
+		hits := hitsResults[i]
+		for j, ts := range timestampsResults[i] {
+			m[ts] += hits[j]
+		}
+	}
+
+	timestamps := make([]int64, 0, len(m))
+	for ts := range m {
+		timestamps = append(timestamps, ts)
+	}
+	slices.Sort(timestamps)
+	hits := make([]uint64, len(timestamps))
+	for i, ts := range timestamps {
+		hits[i] = m[ts]
+	}
+	return timestamps, hits, true, nil
+}
+
+// GetApproxCount returns an estimated number of logs matching qctx.
+//
+// See logstorage.Storage.GetApproxCount for details.
+func (s *Storage) GetApproxCount(qctx *logstorage.QueryContext) (*logstorage.ApproxCount, error) {
+	ctxWithCancel, cancel := context.WithCancel(qctx.Context)
+	defer cancel()
+
+	release, err := s.acquireColdTier(ctxWithCancel, qctx.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	results := make([]*logstorage.ApproxCount, len(s.sns))
+	errs := make([]error, len(s.sns))
+
+	var wg sync.WaitGroup
+	for i := range s.sns {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.sns[nodeIdx]
+			if sn.skipTier(qctx.Query) {
+				return
+			}
+			qctxLocal := qctx.WithContext(ctxWithCancel)
+			ac, err := sn.getApproxCount(qctxLocal)
+			results[nodeIdx] = ac
+			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, qctx.AllowPartialResponse)
+		}(i)
+	}
+	wg.Wait()
+
+	if err := getFirstError(errs, qctx.AllowPartialResponse); err != nil {
+		return nil, err
+	}
+
+	// Logs are spread among storage nodes, so sum the estimations across nodes.
+	var ac logstorage.ApproxCount
+	for _, a := range results {
+		if a != nil {
+			ac.Add(a)
+		}
+	}
+	return &ac, nil
+}
+
+// PinView pins the current set of logs at all the storage nodes and their replicas under the given viewID for the given ttl.
+func (s *Storage) PinView(ctx context.Context, viewID string, ttl time.Duration) error {
+	ctxWithCancel, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(s.allNodes))
+
+	// The view must be pinned at all the storage nodes, since otherwise queries over the view return errors.
+	allowPartialResponse := false
+
+	var wg sync.WaitGroup
+	for i := range s.allNodes {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.allNodes[nodeIdx]
+			err := sn.pinView(ctxWithCancel, viewID, ttl)
+			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, allowPartialResponse)
+		}(i)
+	}
+	wg.Wait()
+
+	if err := getFirstError(errs, allowPartialResponse); err != nil {
+		// Release the view at the storage nodes where it has been pinned successfully.
+		// Use the original ctx, since ctxWithCancel may be already canceled.
+		_ = s.UnpinView(ctx, viewID)
+		return err
+	}
+	return nil
+}
+
+// UnpinView unpins the view with the given viewID at all the storage nodes.
+func (s *Storage) UnpinView(ctx context.Context, viewID string) error {
+	ctxWithCancel, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(s.allNodes))
+
+	// Return an error to the caller when at least a single storage node is unavailable.
+	// The view is automatically unpinned at such nodes when its ttl expires.
+	allowPartialResponse := false
+
+	var wg sync.WaitGroup
+	for i := range s.allNodes {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.allNodes[nodeIdx]
+			err := sn.unpinView(ctxWithCancel, viewID)
+			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, allowPartialResponse)
+		}(i)
+	}
+	wg.Wait()
+
+	return getFirstError(errs, allowPartialResponse)
+}
+
 // DeleteRunTask starts deletion of logs for the given filter f at the given tenantIDs.
 func (s *Storage) DeleteRunTask(ctx context.Context, taskID string, timestamp int64, tenantIDs []logstorage.TenantID, f *logstorage.Filter) error {
 	ctxWithCancel, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	errs := make([]error, len(s.sns))
+	errs := make([]error, len(s.allNodes))
 
 	// Return an error to the caller when at least a single storage node is unavailable.
 	// This improves awarenes of the caller about unavailable storage nodes.
@@ -494,12 +1004,12 @@ func (s *Storage) DeleteRunTask(ctx context.Context, taskID string, timestamp in
 	allowPartialResponse := false
 
 	var wg sync.WaitGroup
-	for i := range s.sns {
+	for i := range s.allNodes {
 		wg.Add(1)
 		go func(nodeIdx int) {
 			defer wg.Done()
 
-			sn := s.sns[nodeIdx]
+			sn := s.allNodes[nodeIdx]
 			err := sn.deleteRunTask(ctxWithCancel, taskID, timestamp, tenantIDs, f)
 			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, allowPartialResponse)
 		}(i)
@@ -514,7 +1024,7 @@ func (s *Storage) DeleteStopTask(ctx context.Context, taskID string) error {
 	ctxWithCancel, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	errs := make([]error, len(s.sns))
+	errs := make([]error, len(s.allNodes))
 
 	// Return an error to the caller when at least a single storage node is unavailable.
 	// This improves awarenes of the caller about unavailable storage nodes.
@@ -523,12 +1033,12 @@ func (s *Storage) DeleteStopTask(ctx context.Context, taskID string) error {
 	allowPartialResponse := false
 
 	var wg sync.WaitGroup
-	for i := range s.sns {
+	for i := range s.allNodes {
 		wg.Add(1)
 		go func(nodeIdx int) {
 			defer wg.Done()
 
-			sn := s.sns[nodeIdx]
+			sn := s.allNodes[nodeIdx]
 			err := sn.deleteStopTask(ctxWithCancel, taskID)
 			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, allowPartialResponse)
 		}(i)
@@ -543,20 +1053,20 @@ func (s *Storage) DeleteActiveTasks(ctx context.Context) ([]*logstorage.DeleteTa
 	ctxWithCancel, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	errs := make([]error, len(s.sns))
-	results := make([][]*logstorage.DeleteTask, len(s.sns))
+	errs := make([]error, len(s.allNodes))
+	results := make([][]*logstorage.DeleteTask, len(s.allNodes))
 
 	// Return an error to the caller when at least a single storage node is unavailable,
 	// since this prevents from returning the full list of active delete tasks.
 	allowPartialResponse := false
 
 	var wg sync.WaitGroup
-	for i := range s.sns {
+	for i := range s.allNodes {
 		wg.Add(1)
 		go func(nodeIdx int) {
 			defer wg.Done()
 
-			sn := s.sns[nodeIdx]
+			sn := s.allNodes[nodeIdx]
 			tasks, err := sn.deleteActiveTasks(ctxWithCancel)
 			results[nodeIdx] = tasks
 			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, allowPartialResponse)
@@ -648,6 +1158,12 @@ func (s *Storage) getValuesWithHits(qctx *logstorage.QueryContext, limit uint64,
 	ctxWithCancel, cancel := context.WithCancel(qctx.Context)
 	defer cancel()
 
+	release, err := s.acquireColdTier(ctxWithCancel, qctx.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	results := make([][]logstorage.ValueWithHits, len(s.sns))
 	errs := make([]error, len(s.sns))
 
@@ -658,6 +1174,9 @@ func (s *Storage) getValuesWithHits(qctx *logstorage.QueryContext, limit uint64,
 			defer wg.Done()
 
 			sn := s.sns[nodeIdx]
+			if sn.skipTier(qctx.Query) {
+				return
+			}
 			vhs, err := callback(ctxWithCancel, sn)
 			results[nodeIdx] = vhs
 			errs[nodeIdx] = sn.handleError(ctxWithCancel, cancel, err, qctx.AllowPartialResponse)
@@ -674,6 +1193,41 @@ func (s *Storage) getValuesWithHits(qctx *logstorage.QueryContext, limit uint64,
 	return vhs, nil
 }
 
+func (sn *storageNode) pinView(ctx context.Context, viewID string, ttl time.Duration) error {
+	args := url.Values{}
+	args.Set("version", PinViewProtocolVersion)
+	args.Set("view_id", viewID)
+	args.Set("ttl", ttl.String())
+
+	path := "/internal/select/pin_view"
+	data, reqURL, err := sn.getPlainResponseBodyForPathAndArgs(ctx, path, args)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("unexpected response body received from %q: %q", reqURL, data)
+	}
+
+	return nil
+}
+
+func (sn *storageNode) unpinView(ctx context.Context, viewID string) error {
+	args := url.Values{}
+	args.Set("version", UnpinViewProtocolVersion)
+	args.Set("view_id", viewID)
+
+	path := "/internal/select/unpin_view"
+	data, reqURL, err := sn.getPlainResponseBodyForPathAndArgs(ctx, path, args)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("unexpected response body received from %q: %q", reqURL, data)
+	}
+
+	return nil
+}
+
 func (sn *storageNode) deleteRunTask(ctx context.Context, taskID string, timestamp int64, tenantIDs []logstorage.TenantID, f *logstorage.Filter) error {
 	args := url.Values{}
 	args.Set("version", DeleteRunTaskProtocolVersion)
@@ -729,8 +1283,11 @@ func (sn *storageNode) deleteActiveTasks(ctx context.Context) ([]*logstorage.Del
 	return tasks, nil
 }
 
+// getPlainResponseBodyForPathAndArgs sends the request to sn without hedging and returns the response body.
+//
+// It is used for requests, which must be sent to all the replicas, such as pinning views and managing delete tasks.
 func (sn *storageNode) getPlainResponseBodyForPathAndArgs(ctx context.Context, path string, args url.Values) ([]byte, string, error) {
-	responseBody, reqURL, err := sn.getResponseBodyForPathAndArgs(ctx, path, args)
+	responseBody, reqURL, err := sn.sendRequest(ctx, path, args)
 	if err != nil {
 		return nil, reqURL, err
 	}
@@ -841,6 +1398,108 @@ func unmarshalValuesWithHits(qctx *logstorage.QueryContext, src []byte) ([]logst
 	return vhs, nil
 }
 
+func unmarshalStreamsLastSeen(qctx *logstorage.QueryContext, src []byte) ([]logstorage.StreamLastSeen, error) {
+	// Unmarshal StreamLastSeen entries at first
+	if len(src) < 8 {
+		return nil, fmt.Errorf("missing length of StreamLastSeen entries")
+	}
+	slssLen := encoding.UnmarshalUint64(src[:8])
+	src = src[8:]
+
+	slss := make([]logstorage.StreamLastSeen, slssLen)
+	for i := range slss {
+		sls := &slss[i]
+
+		tail, err := sls.UnmarshalInplace(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal StreamLastSeen #%d out of %d: %w", i, len(slss), err)
+		}
+		src = tail
+
+		// Clone sls.StreamID and sls.Stream, since they point to src.
+		sls.StreamID = strings.Clone(sls.StreamID)
+		sls.Stream = strings.Clone(sls.Stream)
+	}
+
+	// Unmarshal query stats
+	qsLocal := &logstorage.QueryStats{}
+	defer qctx.QueryStats.UpdateAtomic(qsLocal)
+
+	tail, err := unmarshalQueryStats(qsLocal, src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal query stats: %w", err)
+	}
+	if len(tail) > 0 {
+		return nil, fmt.Errorf("unexpected tail left after query stats; len(tail)=%d", len(tail))
+	}
+
+	return slss, nil
+}
+
+func unmarshalHitsPreaggregated(qctx *logstorage.QueryContext, src []byte) ([]int64, []uint64, bool, error) {
+	// Unmarshal hits at first
+	if len(src) < 1 {
+		return nil, nil, false, fmt.Errorf("missing ok flag")
+	}
+	ok := src[0] == 1
+	src = src[1:]
+
+	if len(src) < 8 {
+		return nil, nil, false, fmt.Errorf("missing the number of time buckets")
+	}
+	n := encoding.UnmarshalUint64(src[:8])
+	src = src[8:]
+
+	if uint64(len(src)) < 16*n {
+		return nil, nil, false, fmt.Errorf("too short data for %d time buckets; got %d bytes; want at least %d bytes", n, len(src), 16*n)
+	}
+	timestamps := make([]int64, n)
+	hits := make([]uint64, n)
+	for i := range timestamps {
+		timestamps[i] = encoding.UnmarshalInt64(src)
+		hits[i] = encoding.UnmarshalUint64(src[8:])
+		src = src[16:]
+	}
+
+	// Unmarshal query stats
+	qsLocal := &logstorage.QueryStats{}
+	defer qctx.QueryStats.UpdateAtomic(qsLocal)
+
+	tail, err := unmarshalQueryStats(qsLocal, src)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("cannot unmarshal query stats: %w", err)
+	}
+	if len(tail) > 0 {
+		return nil, nil, false, fmt.Errorf("unexpected tail left after query stats; len(tail)=%d", len(tail))
+	}
+
+	return timestamps, hits, ok, nil
+}
+
+func unmarshalApproxCount(qctx *logstorage.QueryContext, src []byte) (*logstorage.ApproxCount, error) {
+	// Unmarshal ApproxCount at first
+	var ac logstorage.ApproxCount
+	tail, err := ac.Unmarshal(src)
+	if err != nil {
+		return nil, err
+	}
+	src = tail
+
+	// Unmarshal query stats
+	qsLocal := &logstorage.QueryStats{}
+	defer qctx.QueryStats.UpdateAtomic(qsLocal)
+
+	tail, err = unmarshalQueryStats(qsLocal, src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal query stats: %w", err)
+	}
+	if len(tail) > 0 {
+		return nil, fmt.Errorf("unexpected tail left after query stats; len(tail)=%d", len(tail))
+	}
+
+	return &ac, nil
+}
+
 func unmarshalQueryStats(qs *logstorage.QueryStats, src []byte) ([]byte, error) {
 	var db logstorage.DataBlock
 	tail, _, err := db.UnmarshalInplace(src, nil)
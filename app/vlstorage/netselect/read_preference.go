@@ -0,0 +1,230 @@
+package netselect
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/contextutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	selectZone = flag.String("select.zone", "", "Optional zone for the given vlselect. It is used for preferring -storageNode replicas from the same zone "+
+		"for queries with read_preference=zone-local. See -storageNode.zone and https://docs.victoriametrics.com/victorialogs/cluster/#read-preference")
+	maxReplicaLag = flag.Duration("select.maxReplicaLag", 30*time.Second, "The maximum lag for the ingested logs at -storageNode replica comparing to the freshest replica "+
+		"with the same data. Lagging replicas aren't queried for queries with read_preference=freshest. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#read-preference")
+	replicaStatusCheckInterval = flag.Duration("select.replicaStatusCheckInterval", 5*time.Second, "The interval for checking the maximum ingested timestamp "+
+		"at -storageNode replicas. Set to 0 for disabling the check. See https://docs.victoriametrics.com/victorialogs/cluster/#read-preference")
+)
+
+// MaxIngestedTimestampProtocolVersion is the version of the protocol used for /internal/select/max_ingested_timestamp HTTP endpoint.
+//
+// It must be updated every time the protocol changes.
+const MaxIngestedTimestampProtocolVersion = "v1"
+
+// getReplicasForReadPreference returns sn and its replicas in the order they must be queried according to the given readPreference.
+//
+// See logstorage.IsValidReadPreference for the list of supported read preferences.
+func (sn *storageNode) getReplicasForReadPreference(readPreference string) []*storageNode {
+	nodes := make([]*storageNode, 0, 1+len(sn.replicas))
+	nodes = append(nodes, sn)
+	nodes = append(nodes, sn.replicas...)
+	if len(nodes) == 1 {
+		return nodes
+	}
+
+	switch readPreference {
+	case "zone-local":
+		if *selectZone == "" {
+			return nodes
+		}
+		slices.SortStableFunc(nodes, func(a, b *storageNode) int {
+			aLocal := a.zone == *selectZone
+			bLocal := b.zone == *selectZone
+			switch {
+			case aLocal == bLocal:
+				return 0
+			case aLocal:
+				return -1
+			default:
+				return 1
+			}
+		})
+	case "freshest":
+		freshestTimestamp := getFreshestTimestamp(nodes)
+		if freshestTimestamp <= 0 {
+			// There is no information about the ingested logs at replicas yet, so query them in the original order.
+			return nodes
+		}
+		minTimestamp := freshestTimestamp - maxReplicaLag.Nanoseconds()
+		nodes = slices.DeleteFunc(nodes, func(n *storageNode) bool {
+			return n.maxIngestedTimestamp.Load() < minTimestamp
+		})
+	}
+	return nodes
+}
+
+func getFreshestTimestamp(nodes []*storageNode) int64 {
+	freshestTimestamp := int64(0)
+	for _, n := range nodes {
+		freshestTimestamp = max(freshestTimestamp, n.maxIngestedTimestamp.Load())
+	}
+	return freshestTimestamp
+}
+
+// splitReplicaZones splits the given -storageNode.zone entry into zones for the corresponding -storageNode replicas.
+//
+// Zones are delimited by '|' in the same way as replica addresses at -storageNode.
+func splitReplicaZones(zones string, replicasCount int) []string {
+	a := make([]string, replicasCount)
+	if zones == "" {
+		return a
+	}
+	for i, zone := range strings.Split(zones, "|") {
+		if i >= len(a) {
+			break
+		}
+		a[i] = strings.TrimSpace(zone)
+	}
+	return a
+}
+
+// GetMaxIngestedTimestamp returns the maximum timestamp in nanoseconds across the logs ingested into all the storage nodes.
+//
+// Unavailable storage nodes are skipped. An error is returned only if all the storage nodes are unavailable.
+func (s *Storage) GetMaxIngestedTimestamp(ctx context.Context) (int64, error) {
+	timestamps := make([]int64, len(s.allNodes))
+	errs := make([]error, len(s.allNodes))
+
+	var wg sync.WaitGroup
+	for i := range s.allNodes {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			timestamps[nodeIdx], errs[nodeIdx] = s.allNodes[nodeIdx].getMaxIngestedTimestamp(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	var firstErr error
+	maxTimestamp := int64(0)
+	successes := 0
+	for i, err := range errs {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		successes++
+		maxTimestamp = max(maxTimestamp, timestamps[i])
+	}
+	if successes == 0 && firstErr != nil {
+		return 0, firstErr
+	}
+	return maxTimestamp, nil
+}
+
+func (sn *storageNode) getMaxIngestedTimestamp(ctx context.Context) (int64, error) {
+	args := url.Values{}
+	args.Set("version", MaxIngestedTimestampProtocolVersion)
+
+	data, reqURL, err := sn.getPlainResponseBodyForPathAndArgs(ctx, "/internal/select/max_ingested_timestamp", args)
+	if err != nil {
+		return 0, err
+	}
+	timestamp, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse max ingested timestamp received from %q; data=%q: %w", reqURL, data, err)
+	}
+	return timestamp, nil
+}
+
+// startReplicaStatusChecker starts periodic checking of the max ingested timestamp at storage nodes with replicas.
+//
+// The obtained timestamps are used for detecting lagging replicas. See getReplicasForReadPreference.
+func (s *Storage) startReplicaStatusChecker() {
+	if *replicaStatusCheckInterval <= 0 {
+		return
+	}
+
+	var nodes []*storageNode
+	for _, sn := range s.sns {
+		if len(sn.replicas) == 0 {
+			continue
+		}
+		group := append([]*storageNode{sn}, sn.replicas...)
+		for _, n := range group {
+			_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vl_select_remote_replica_lag_seconds{addr=%q}`, n.addr), func() float64 {
+				timestamp := n.maxIngestedTimestamp.Load()
+				if timestamp <= 0 {
+					return 0
+				}
+				return float64(getFreshestTimestamp(group)-timestamp) / 1e9
+			})
+		}
+		nodes = append(nodes, group...)
+	}
+	if len(nodes) == 0 {
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runReplicaStatusChecker(nodes)
+	}()
+}
+
+func (s *Storage) runReplicaStatusChecker(nodes []*storageNode) {
+	t := time.NewTicker(*replicaStatusCheckInterval)
+	defer t.Stop()
+
+	for {
+		s.updateReplicaStatuses(nodes)
+
+		select {
+		case <-s.stopCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+var replicaStatusErrorsLogger = logger.WithThrottler("replica_status_errors", 30*time.Second)
+
+func (s *Storage) updateReplicaStatuses(nodes []*storageNode) {
+	ctx, cancel := contextutil.NewStopChanContext(s.stopCh)
+	defer cancel()
+
+	ctxWithTimeout, cancelTimeout := context.WithTimeout(ctx, *replicaStatusCheckInterval)
+	defer cancelTimeout()
+
+	var wg sync.WaitGroup
+	for _, sn := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			timestamp, err := sn.getMaxIngestedTimestamp(ctxWithTimeout)
+			if err != nil {
+				if ctx.Err() == nil {
+					replicaStatusErrorsLogger.Warnf("cannot check the max ingested timestamp at -storageNode=%q: %s", sn.addr, err)
+				}
+				return
+			}
+			sn.maxIngestedTimestamp.Store(timestamp)
+		}()
+	}
+	wg.Wait()
+}
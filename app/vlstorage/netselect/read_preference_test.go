@@ -0,0 +1,73 @@
+package netselect
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorageNodeGetReplicasForReadPreference(t *testing.T) {
+	newNode := func(addr, zone string, maxIngestedTimestamp int64) *storageNode {
+		sn := &storageNode{
+			addr: addr,
+			zone: zone,
+		}
+		sn.maxIngestedTimestamp.Store(maxIngestedTimestamp)
+		return sn
+	}
+
+	f := func(nodes []*storageNode, readPreference string, resultExpected []string) {
+		t.Helper()
+
+		sn := nodes[0]
+		sn.replicas = nodes[1:]
+
+		var result []string
+		for _, n := range sn.getReplicasForReadPreference(readPreference) {
+			result = append(result, n.addr)
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected replicas for read_preference=%q; got %q; want %q", readPreference, result, resultExpected)
+		}
+	}
+
+	origZone := *selectZone
+	*selectZone = "b"
+	defer func() {
+		*selectZone = origZone
+	}()
+
+	// no replicas
+	f([]*storageNode{newNode("a1", "a", 0)}, "freshest", []string{"a1"})
+
+	// any read preference
+	f([]*storageNode{newNode("a1", "a", 0), newNode("b1", "b", 0)}, "", []string{"a1", "b1"})
+	f([]*storageNode{newNode("a1", "a", 0), newNode("b1", "b", 0)}, "any", []string{"a1", "b1"})
+
+	// zone-local read preference
+	f([]*storageNode{newNode("a1", "a", 0), newNode("b1", "b", 0), newNode("a2", "a", 0), newNode("b2", "b", 0)}, "zone-local", []string{"b1", "b2", "a1", "a2"})
+	f([]*storageNode{newNode("a1", "a", 0), newNode("c1", "c", 0)}, "zone-local", []string{"a1", "c1"})
+
+	// freshest read preference
+	now := time.Now().UnixNano()
+	lag := maxReplicaLag.Nanoseconds()
+	f([]*storageNode{newNode("a1", "a", 0), newNode("b1", "b", 0)}, "freshest", []string{"a1", "b1"})
+	f([]*storageNode{newNode("a1", "a", now-2*lag), newNode("b1", "b", now), newNode("c1", "c", now-lag/2)}, "freshest", []string{"b1", "c1"})
+	f([]*storageNode{newNode("a1", "a", 0), newNode("b1", "b", now)}, "freshest", []string{"b1"})
+}
+
+func TestSplitReplicaZones(t *testing.T) {
+	f := func(zones string, replicasCount int, resultExpected []string) {
+		t.Helper()
+
+		result := splitReplicaZones(zones, replicasCount)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result for splitReplicaZones(%q, %d); got %q; want %q", zones, replicasCount, result, resultExpected)
+		}
+	}
+
+	f("", 2, []string{"", ""})
+	f("a", 2, []string{"a", ""})
+	f("a| b", 2, []string{"a", "b"})
+	f("a|b|c", 2, []string{"a", "b"})
+}
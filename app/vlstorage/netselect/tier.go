@@ -0,0 +1,182 @@
+package netselect
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	hotTierRetention = flag.Duration("select.hotTierRetention", 0, "Logs newer than the given duration are queried only from -storageNode with -storageNode.tier=hot, "+
+		"while older logs are queried only from -storageNode with -storageNode.tier=cold. This must be smaller than -retentionPeriod at hot storage nodes. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#retention-tiers")
+	coldTierMaxConcurrentRequests = flag.Int("select.coldTierMaxConcurrentRequests", 0, "The maximum number of concurrent requests to -storageNode with -storageNode.tier=cold. "+
+		"Other requests wait in the queue for up to -select.coldTierMaxQueueDuration. There is no limit by default. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#cold-tier-limits")
+	coldTierMaxQueueDuration = flag.Duration("select.coldTierMaxQueueDuration", 10*time.Second, "The maximum time the request waits for execution "+
+		"when -select.coldTierMaxConcurrentRequests concurrent requests to the cold tier are executed")
+	coldTierMaxBytesReadPerQuery = flagutil.NewBytes("select.coldTierMaxBytesReadPerQuery", 0, "The maximum number of bytes, which can be read by a single query "+
+		"at every -storageNode with -storageNode.tier=cold. The query is stopped with an error when the limit is exceeded. There is no limit by default. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#cold-tier-limits")
+)
+
+var (
+	coldTierConcurrencyLimitReached = metrics.NewCounter(`vl_select_cold_tier_concurrency_limit_reached_total`)
+	coldTierConcurrencyLimitTimeout = metrics.NewCounter(`vl_select_cold_tier_concurrency_limit_timeout_total`)
+)
+
+const (
+	tierHot  = "hot"
+	tierCold = "cold"
+)
+
+// CheckTiers verifies the given tiers for -storageNode.tier.
+func CheckTiers(tiers []string) error {
+	hasTiers := false
+	for _, tier := range tiers {
+		switch tier {
+		case "":
+		case tierHot, tierCold:
+			hasTiers = true
+		default:
+			return fmt.Errorf("unsupported tier %q; supported values: hot, cold", tier)
+		}
+	}
+	if hasTiers && *hotTierRetention <= 0 {
+		return fmt.Errorf("-select.hotTierRetention must be set to a positive duration if -storageNode.tier is set")
+	}
+	return nil
+}
+
+// tierStats contains per-tier query metrics.
+type tierStats struct {
+	requests        *metrics.Counter
+	requestsSkipped *metrics.Counter
+}
+
+func newTierStats(tier string) *tierStats {
+	if tier == "" {
+		return nil
+	}
+	return &tierStats{
+		requests:        metrics.GetOrCreateCounter(fmt.Sprintf(`vl_select_tier_requests_total{tier=%q}`, tier)),
+		requestsSkipped: metrics.GetOrCreateCounter(fmt.Sprintf(`vl_select_tier_requests_skipped_total{tier=%q}`, tier)),
+	}
+}
+
+// getTierTimeRange returns the time range for logs, which must be queried from the storage node with the given tier
+// for the query executed at the given timestamp.
+//
+// The time range is split at timestamp - -select.hotTierRetention, so hot and cold tiers return non-overlapping logs.
+func getTierTimeRange(tier string, timestamp int64) (int64, int64) {
+	if *hotTierRetention <= 0 {
+		return math.MinInt64, math.MaxInt64
+	}
+	boundary := timestamp - hotTierRetention.Nanoseconds()
+	switch tier {
+	case tierHot:
+		return boundary, math.MaxInt64
+	case tierCold:
+		return math.MinInt64, boundary - 1
+	default:
+		return math.MinInt64, math.MaxInt64
+	}
+}
+
+// getTierQuery returns q limited to the time range of sn tier.
+func (sn *storageNode) getTierQuery(q *logstorage.Query) *logstorage.Query {
+	if sn.tier == "" {
+		return q
+	}
+	timestamp := q.GetTimestamp()
+	tierStart, tierEnd := getTierTimeRange(sn.tier, timestamp)
+	start, end := q.GetFilterTimeRange()
+	return q.CloneWithTimeFilter(timestamp, max(start, tierStart), min(end, tierEnd))
+}
+
+// skipTier returns true if sn mustn't be queried for q, since q time range doesn't intersect with the time range of sn tier.
+func (sn *storageNode) skipTier(q *logstorage.Query) bool {
+	if sn.tier == "" {
+		return false
+	}
+	if sn.isOutsideTier(q) {
+		sn.tierStats.requestsSkipped.Inc()
+		return true
+	}
+	sn.tierStats.requests.Inc()
+	return false
+}
+
+func (sn *storageNode) isOutsideTier(q *logstorage.Query) bool {
+	tierStart, tierEnd := getTierTimeRange(sn.tier, q.GetTimestamp())
+	start, end := q.GetFilterTimeRange()
+	return start > tierEnd || end < tierStart
+}
+
+// getMaxBytesRead returns the maximum number of bytes, which can be read by the query at sn.
+//
+// Zero is returned if there is no limit.
+func (sn *storageNode) getMaxBytesRead() int64 {
+	if sn.tier != tierCold {
+		return 0
+	}
+	return coldTierMaxBytesReadPerQuery.N
+}
+
+// acquireColdTier waits until q can be sent to the cold tier according to -select.coldTierMaxConcurrentRequests.
+//
+// The returned release func must be called after q is executed at the cold tier.
+func (s *Storage) acquireColdTier(ctx context.Context, q *logstorage.Query) (func(), error) {
+	if s.coldTierConcurrencyCh == nil || !s.queriesColdTier(q) {
+		return func() {}, nil
+	}
+	release := func() {
+		<-s.coldTierConcurrencyCh
+	}
+
+	select {
+	case s.coldTierConcurrencyCh <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	coldTierConcurrencyLimitReached.Inc()
+	startTime := time.Now()
+	t := time.NewTimer(*coldTierMaxQueueDuration)
+	defer t.Stop()
+	select {
+	case s.coldTierConcurrencyCh <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.C:
+		coldTierConcurrencyLimitTimeout.Inc()
+		return nil, &httpserver.ErrorWithStatusCode{
+			Err: fmt.Errorf("couldn't start querying the cold tier in %.3f seconds, since -select.coldTierMaxConcurrentRequests=%d concurrent requests to the cold tier are executed; "+
+				"possible solutions: to narrow down the query time range to the last -select.hotTierRetention=%s, which is served by the hot tier; "+
+				"to increase -select.coldTierMaxQueueDuration=%s; to increase -select.coldTierMaxConcurrentRequests",
+				time.Since(startTime).Seconds(), cap(s.coldTierConcurrencyCh), *hotTierRetention, *coldTierMaxQueueDuration),
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+}
+
+// queriesColdTier returns true if q must be sent to at least a single storage node from the cold tier.
+func (s *Storage) queriesColdTier(q *logstorage.Query) bool {
+	for _, sn := range s.sns {
+		if sn.tier == tierCold && !sn.isOutsideTier(q) {
+			return true
+		}
+	}
+	return false
+}
+
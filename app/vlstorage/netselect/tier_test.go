@@ -0,0 +1,149 @@
+package netselect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestCheckTiers(t *testing.T) {
+	origRetention := *hotTierRetention
+	defer func() {
+		*hotTierRetention = origRetention
+	}()
+
+	f := func(tiers []string, retention time.Duration, okExpected bool) {
+		t.Helper()
+
+		*hotTierRetention = retention
+		err := CheckTiers(tiers)
+		if okExpected && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !okExpected && err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f(nil, 0, true)
+	f([]string{"", ""}, 0, true)
+	f([]string{"hot", "cold", ""}, time.Hour, true)
+
+	// missing -select.hotTierRetention
+	f([]string{"hot", "cold"}, 0, false)
+
+	// unsupported tier
+	f([]string{"hot", "warm"}, time.Hour, false)
+}
+
+func TestStorageNodeTier(t *testing.T) {
+	origRetention := *hotTierRetention
+	*hotTierRetention = time.Hour
+	defer func() {
+		*hotTierRetention = origRetention
+	}()
+
+	newNode := func(tier string) *storageNode {
+		return &storageNode{
+			tier:      tier,
+			tierStats: newTierStats(tier),
+		}
+	}
+
+	// The query timestamp is 2025-01-02T10:00:00Z, so the tier boundary is at 2025-01-02T09:00:00Z.
+	timestamp := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC).UnixNano()
+
+	f := func(tier, qStr string, skipExpected bool, qExpected string) {
+		t.Helper()
+
+		q, err := logstorage.ParseQueryAtTimestamp(qStr, timestamp)
+		if err != nil {
+			t.Fatalf("cannot parse query: %s", err)
+		}
+		sn := newNode(tier)
+		if skip := sn.skipTier(q); skip != skipExpected {
+			t.Fatalf("unexpected skipTier result for tier=%q, query=%q; got %v; want %v", tier, qStr, skip, skipExpected)
+		}
+		if skipExpected {
+			return
+		}
+		result := sn.getTierQuery(q).String()
+		if result != qExpected {
+			t.Fatalf("unexpected query for tier=%q;\ngot\n%s\nwant\n%s", tier, result, qExpected)
+		}
+	}
+
+	// storage node without tier
+	f("", "_time:[2025-01-01T00:00:00Z, 2025-01-03T00:00:00Z] error", false, "_time:[2025-01-01T00:00:00Z,2025-01-03T00:00:00Z] error")
+
+	// the query time range covers both tiers
+	f("hot", "_time:[2025-01-01T00:00:00Z, 2025-01-03T00:00:00Z] error", false,
+		"_time:[2025-01-02T09:00:00.000000000Z,2025-01-03T00:00:00.999999999Z] _time:[2025-01-01T00:00:00Z,2025-01-03T00:00:00Z] error")
+	f("cold", "_time:[2025-01-01T00:00:00Z, 2025-01-03T00:00:00Z] error", false,
+		"_time:[2025-01-01T00:00:00.000000000Z,2025-01-02T08:59:59.999999999Z] _time:[2025-01-01T00:00:00Z,2025-01-03T00:00:00Z] error")
+
+	// the query time range covers only the hot tier
+	f("hot", "_time:30m error", false, "_time:[2025-01-02T09:30:00.000000000Z,2025-01-02T10:00:00.000000000Z] _time:30m error")
+	f("cold", "_time:30m error", true, "")
+
+	// the query time range covers only the cold tier
+	f("hot", "_time:[2025-01-01T00:00:00Z, 2025-01-01T12:00:00Z] error", true, "")
+	f("cold", "_time:[2025-01-01T00:00:00Z, 2025-01-01T12:00:00Z] error", false,
+		"_time:[2025-01-01T00:00:00.000000000Z,2025-01-01T12:00:00.999999999Z] _time:[2025-01-01T00:00:00Z,2025-01-01T12:00:00Z] error")
+}
+
+func TestStorageAcquireColdTier(t *testing.T) {
+	origRetention := *hotTierRetention
+	origQueueDuration := *coldTierMaxQueueDuration
+	*hotTierRetention = time.Hour
+	*coldTierMaxQueueDuration = 10 * time.Millisecond
+	defer func() {
+		*hotTierRetention = origRetention
+		*coldTierMaxQueueDuration = origQueueDuration
+	}()
+
+	s := &Storage{
+		sns: []*storageNode{
+			{tier: tierHot},
+			{tier: tierCold},
+		},
+		coldTierConcurrencyCh: make(chan struct{}, 1),
+	}
+
+	timestamp := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC).UnixNano()
+	qCold, err := logstorage.ParseQueryAtTimestamp("_time:1d error", timestamp)
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+	qHot, err := logstorage.ParseQueryAtTimestamp("_time:5m error", timestamp)
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+
+	ctx := context.Background()
+	release, err := s.acquireColdTier(ctx, qCold)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The query, which doesn't touch the cold tier, isn't limited.
+	releaseHot, err := s.acquireColdTier(ctx, qHot)
+	if err != nil {
+		t.Fatalf("unexpected error for the query touching only the hot tier: %s", err)
+	}
+	releaseHot()
+
+	// The concurrency limit is reached.
+	if _, err := s.acquireColdTier(ctx, qCold); err == nil {
+		t.Fatalf("expecting non-nil error when the cold tier concurrency limit is reached")
+	}
+
+	release()
+	release, err = s.acquireColdTier(ctx, qCold)
+	if err != nil {
+		t.Fatalf("unexpected error after releasing the cold tier: %s", err)
+	}
+	release()
+}
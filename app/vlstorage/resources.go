@@ -0,0 +1,124 @@
+package vlstorage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+)
+
+// numaNode contains information about a single NUMA node.
+type numaNode struct {
+	// id is the node id.
+	id int
+
+	// cpus contains ids of online CPUs at the node.
+	cpus []int
+}
+
+// numaNodesPath is the path to NUMA topology on Linux.
+const numaNodesPath = "/sys/devices/system/node"
+
+// getNUMANodes returns NUMA nodes with CPUs on the current host.
+//
+// An empty list is returned if the NUMA topology cannot be determined, e.g. on non-Linux systems.
+func getNUMANodes() []numaNode {
+	return readNUMANodes(numaNodesPath)
+}
+
+func readNUMANodes(path string) []numaNode {
+	des, err := os.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+
+	var nodes []numaNode
+	for _, de := range des {
+		name := de.Name()
+		idStr, ok := strings.CutPrefix(name, "node")
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(path, name, "cpulist"))
+		if err != nil {
+			continue
+		}
+		cpus, err := parseCPUList(strings.TrimSpace(string(data)))
+		if err != nil {
+			logger.Warnf("cannot parse the list of CPUs for NUMA node %d: %s", id, err)
+			continue
+		}
+		if len(cpus) == 0 {
+			// Skip nodes without CPUs such as memory-only nodes.
+			continue
+		}
+		nodes = append(nodes, numaNode{
+			id:   id,
+			cpus: cpus,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].id < nodes[j].id
+	})
+	return nodes
+}
+
+// parseCPUList parses the list of CPUs in Linux format such as `0-3,8,10-11`.
+func parseCPUList(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var cpus []int
+	for _, part := range strings.Split(s, ",") {
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(startStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse CPU id %q: %w", startStr, err)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(endStr)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse CPU id %q: %w", endStr, err)
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid CPU range %q; the end cannot be smaller than the start", part)
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// logResources logs the detected resources VictoriaLogs storage is tuned for.
+func logResources(mergeConcurrency int) {
+	cpus := cgroup.AvailableCPUs()
+	memoryLimit := "none"
+	// cgroup returns huge values if the memory limit isn't set.
+	if n := cgroup.GetMemoryLimit(); n > 0 && n < 1<<62 {
+		memoryLimit = fmt.Sprintf("%d bytes", n)
+	}
+	logger.Infof("detected resources: availableCPUs=%d, cgroupMemoryLimit=%s, allowedMemory=%d bytes, numaNodes=%d; using mergeConcurrency=%d; "+
+		"see https://docs.victoriametrics.com/victorialogs/#resource-autotuning",
+		cpus, memoryLimit, memory.Allowed(), len(numaNodes), mergeConcurrency)
+
+	if len(numaNodes) > 1 && cpus > len(numaNodes[0].cpus) {
+		logger.Warnf("VictoriaLogs uses %d CPUs, which may be located at %d NUMA nodes; this may reduce performance because of slow cross-node memory access; "+
+			"consider binding VictoriaLogs to a single NUMA node; see https://docs.victoriametrics.com/victorialogs/#resource-autotuning", cpus, len(numaNodes))
+	}
+}
+
+var numaNodes = getNUMANodes()
@@ -0,0 +1,81 @@
+package vlstorage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUListSuccess(t *testing.T) {
+	f := func(s string, cpusExpected []int) {
+		t.Helper()
+
+		cpus, err := parseCPUList(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(cpus, cpusExpected) {
+			t.Fatalf("unexpected cpus for %q; got %v; want %v", s, cpus, cpusExpected)
+		}
+	}
+
+	f("", nil)
+	f("0", []int{0})
+	f("0-3", []int{0, 1, 2, 3})
+	f("0-1,8,10-11", []int{0, 1, 8, 10, 11})
+}
+
+func TestParseCPUListFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		if _, err := parseCPUList(s); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+
+	f("foo")
+	f("1-")
+	f("3-1")
+	f("0,,1")
+}
+
+func TestReadNUMANodes(t *testing.T) {
+	path := t.TempDir()
+
+	mustWriteCPUList := func(node, cpulist string) {
+		t.Helper()
+
+		nodePath := filepath.Join(path, node)
+		if err := os.MkdirAll(nodePath, 0o755); err != nil {
+			t.Fatalf("cannot create %q: %s", nodePath, err)
+		}
+		if err := os.WriteFile(filepath.Join(nodePath, "cpulist"), []byte(cpulist+"\n"), 0o644); err != nil {
+			t.Fatalf("cannot write cpulist: %s", err)
+		}
+	}
+	mustWriteCPUList("node1", "4-7")
+	mustWriteCPUList("node0", "0-3")
+	mustWriteCPUList("node2", "")
+	mustWriteCPUList("cpu0", "0")
+
+	nodes := readNUMANodes(path)
+	nodesExpected := []numaNode{
+		{
+			id:   0,
+			cpus: []int{0, 1, 2, 3},
+		},
+		{
+			id:   1,
+			cpus: []int{4, 5, 6, 7},
+		},
+	}
+	if !reflect.DeepEqual(nodes, nodesExpected) {
+		t.Fatalf("unexpected nodes; got %+v; want %+v", nodes, nodesExpected)
+	}
+
+	if nodes := readNUMANodes(filepath.Join(path, "missing")); len(nodes) != 0 {
+		t.Fatalf("expecting empty nodes for missing path; got %+v", nodes)
+	}
+}
@@ -0,0 +1,116 @@
+package apptest
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
+)
+
+// LogsApp is the common interface for VictoriaLogs apps, which accept logs and serve LogsQL queries.
+//
+// It is implemented by Vlsingle and Vlcluster, so the same test can be run against both of them.
+type LogsApp interface {
+	// JSONLineWrite inserts the given records via /insert/jsonline.
+	JSONLineWrite(t *testing.T, records []string, opts IngestOpts)
+
+	// ForceFlush makes the inserted records available for querying.
+	ForceFlush(t *testing.T)
+
+	// LogsQLQuery executes the given query via /select/logsql/query.
+	LogsQLQuery(t *testing.T, query string, opts QueryOpts) *LogsQLQueryResponse
+
+	// StatsQueryRaw executes the given query via /select/logsql/stats_query.
+	StatsQueryRaw(t *testing.T, query string, opts StatsQueryOpts) (string, int)
+
+	// StatsQueryRangeRaw executes the given query via /select/logsql/stats_query_range.
+	StatsQueryRangeRaw(t *testing.T, query string, opts StatsQueryRangeOpts) (string, int)
+
+	// LogsClient returns lib/client.Client for the app.
+	LogsClient(t *testing.T) *client.Client
+}
+
+var (
+	_ LogsApp = (*Vlsingle)(nil)
+	_ LogsApp = (*Vlcluster)(nil)
+)
+
+func mustNewLogsClient(t *testing.T, cfg *client.Config) *client.Client {
+	t.Helper()
+
+	c, err := client.New(cfg)
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+	return c
+}
+
+// logsQLQuery executes the given query via c and returns the response with _stream_id field removed from every row.
+func logsQLQuery(t *testing.T, c *client.Client, query string, opts QueryOpts) *LogsQLQueryResponse {
+	t.Helper()
+
+	rs, err := c.Query(context.Background(), query, opts.asClientOptions(t))
+	if err != nil {
+		t.Fatalf("cannot execute query %q: %s", query, err)
+	}
+	defer rs.Close()
+
+	res := &LogsQLQueryResponse{}
+	for rs.Next() {
+		lv := make(map[string]string)
+		for _, f := range rs.Row() {
+			lv[f.Name] = f.Value
+		}
+		delete(lv, "_stream_id")
+		normalizedLine, err := json.Marshal(lv)
+		if err != nil {
+			t.Fatalf("cannot marshal row %v: %s", rs.Row(), err)
+		}
+		res.LogLines = append(res.LogLines, string(normalizedLine))
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatalf("cannot read response for query %q: %s", query, err)
+	}
+	return res
+}
+
+func (qos *QueryOpts) asClientOptions(t *testing.T) *client.QueryOptions {
+	t.Helper()
+
+	parseTime := func(s string) time.Time {
+		if s == "" {
+			return time.Time{}
+		}
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatalf("cannot parse time %q: %s", s, err)
+		}
+		return ts
+	}
+
+	opts := &client.QueryOptions{
+		Start:        parseTime(qos.Start),
+		End:          parseTime(qos.End),
+		ExtraFilters: qos.ExtraFilters,
+
+		IncludeHiddenStreams: qos.IncludeHiddenStreams,
+	}
+	if qos.Limit != "" {
+		n, err := strconv.Atoi(qos.Limit)
+		if err != nil {
+			t.Fatalf("cannot parse limit %q: %s", qos.Limit, err)
+		}
+		opts.Limit = n
+	}
+	if qos.Timeout != "" {
+		d, err := time.ParseDuration(qos.Timeout)
+		if err != nil {
+			t.Fatalf("cannot parse timeout %q: %s", qos.Timeout, err)
+		}
+		opts.Timeout = d
+	}
+	return opts
+}
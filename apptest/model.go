@@ -1,12 +1,7 @@
 package apptest
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"io"
 	"net/url"
-	"testing"
 )
 
 // QueryOpts contains params used for querying VictoriaLogs via /select/logsq/query
@@ -18,6 +13,8 @@ type QueryOpts struct {
 	End          string
 	Limit        string
 	ExtraFilters []string
+
+	IncludeHiddenStreams bool
 }
 
 func (qos *QueryOpts) asURLValues() url.Values {
@@ -27,6 +24,9 @@ func (qos *QueryOpts) asURLValues() url.Values {
 	addNonEmpty(uv, "end", qos.End)
 	addNonEmpty(uv, "limit", qos.Limit)
 	addNonEmpty(uv, "extra_filters", qos.ExtraFilters...)
+	if qos.IncludeHiddenStreams {
+		uv.Set("include_hidden_streams", "1")
+	}
 	return uv
 }
 
@@ -114,40 +114,45 @@ type LogsQLQueryResponse struct {
 	LogLines []string
 }
 
-// NewLogsQLQueryResponse is a test helper function that creates a new
-// instance of LogsQLQueryResponse by unmarshalling a json string.
-func NewLogsQLQueryResponse(t *testing.T, s string) *LogsQLQueryResponse {
-	t.Helper()
+// StatusFeaturesResponse is an in-memory representation of the
+// /api/v1/status/features response.
+type StatusFeaturesResponse struct {
+	Version string `json:"version"`
+	Insert  struct {
+		HTTPEnabled bool     `json:"http_enabled"`
+		Protocols   []string `json:"protocols"`
+	} `json:"insert"`
+	Select struct {
+		Endpoints     []string `json:"endpoints"`
+		DeleteEnabled bool     `json:"delete_enabled"`
+	} `json:"select"`
+	Storage struct {
+		Mode         string `json:"mode"`
+		StorageNodes int    `json:"storage_nodes"`
+	} `json:"storage"`
+}
 
-	res := &LogsQLQueryResponse{}
-	if len(s) == 0 {
-		return res
-	}
-	bs := bytes.NewBufferString(s)
-	for {
-		logLine, err := bs.ReadString('\n')
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if len(logLine) > 0 {
-					t.Fatalf("BUG: unexpected non-empty line=%q with io.EOF", logLine)
-				}
-				break
-			}
-			t.Fatalf("BUG: cannot read logline from buffer: %s", err)
-		}
-		var lv map[string]any
-		if err := json.Unmarshal([]byte(logLine), &lv); err != nil {
-			t.Fatalf("cannot parse log line=%q: %s", logLine, err)
-		}
-		delete(lv, "_stream_id")
-		normalizedLine, err := json.Marshal(lv)
-		if err != nil {
-			t.Fatalf("cannot marshal parsed logline=%q: %s", logLine, err)
+// StatusConfigResponse is an in-memory representation of the
+// /api/v1/status/config response.
+type StatusConfigResponse struct {
+	Version string `json:"version"`
+	Hash    string `json:"hash"`
+	Flags   []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+		IsSet bool   `json:"is_set"`
+	} `json:"flags"`
+	ScrapeConfig string `json:"scrape_config"`
+}
+
+// FlagValue returns the value for the flag with the given name from r.
+func (r *StatusConfigResponse) FlagValue(name string) (string, bool) {
+	for _, f := range r.Flags {
+		if f.Name == name {
+			return f.Value, true
 		}
-		res.LogLines = append(res.LogLines, string(normalizedLine))
 	}
-
-	return res
+	return "", false
 }
 
 func addNonEmpty(uv url.Values, name string, values ...string) {
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/apptest"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
+)
+
+// TestClientIngestQuery verifies that logs ingested via lib/client can be queried via lib/client at vlsingle and vlcluster.
+func TestClientIngestQuery(t *testing.T) {
+	fs.MustRemoveDir(t.Name())
+	tc := apptest.NewTestCase(t)
+	defer tc.Stop()
+
+	single := tc.MustStartDefaultVlsingle()
+	cluster := tc.MustStartDefaultVlcluster()
+
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := &client.IngestOptions{
+		StreamFields: []string{"app"},
+		ExtraFields: []client.Field{
+			{Name: "env", Value: "test"},
+		},
+	}
+
+	for _, sut := range []apptest.LogsApp{single, cluster} {
+		c := sut.LogsClient(t)
+
+		bw := c.NewBatchWriter(opts, &client.BatchConfig{
+			MaxBatchSize: 1024,
+		})
+		for i := 0; i < 100; i++ {
+			e := client.Entry{
+				Time: start.Add(time.Duration(i) * time.Second),
+				Fields: []client.Field{
+					{Name: "_msg", Value: fmt.Sprintf("message %d", i)},
+					{Name: "app", Value: fmt.Sprintf("app-%d", i%3)},
+				},
+			}
+			if err := bw.Add(ctx, e); err != nil {
+				t.Fatalf("cannot add entry: %s", err)
+			}
+		}
+		if err := bw.Close(ctx); err != nil {
+			t.Fatalf("cannot close batch writer: %s", err)
+		}
+		sut.ForceFlush(t)
+
+		got := sut.LogsQLQuery(t, `env:test | count() rows`, apptest.QueryOpts{})
+		assertLogsQLResponseEqual(t, got, &apptest.LogsQLQueryResponse{
+			LogLines: []string{
+				`{"rows":"100"}`,
+			},
+		})
+
+		rs, err := c.Query(ctx, `app:="app-1" | sort by (_time) | fields _time, _msg`, &client.QueryOptions{
+			Start: start.Add(10 * time.Second),
+			Limit: 2,
+		})
+		if err != nil {
+			t.Fatalf("cannot execute query: %s", err)
+		}
+		var msgs []string
+		for rs.Next() {
+			row := rs.Row()
+			ts, err := row.Time()
+			if err != nil {
+				t.Fatalf("cannot obtain row time: %s", err)
+			}
+			msgs = append(msgs, fmt.Sprintf("%s %s", ts.Format(time.RFC3339), row.Get("_msg")))
+		}
+		if err := rs.Err(); err != nil {
+			t.Fatalf("cannot read rows: %s", err)
+		}
+		_ = rs.Close()
+
+		msgsExpected := []string{
+			"2025-01-01T00:00:10Z message 10",
+			"2025-01-01T00:00:13Z message 13",
+		}
+		if fmt.Sprint(msgs) != fmt.Sprint(msgsExpected) {
+			t.Fatalf("unexpected messages for %s;\ngot\n%q\nwant\n%q", sut, msgs, msgsExpected)
+		}
+	}
+}
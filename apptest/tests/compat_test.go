@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/apptest"
+)
+
+// TestVlsingleVlclusterCompat ingests the same logs into vlsingle and vlcluster
+// and verifies that both of them return the same results for a corpus of LogsQL queries.
+//
+// This helps catching correctness bugs specific to the cluster query path such as wrong ordering or deduplication of the results.
+func TestVlsingleVlclusterCompat(t *testing.T) {
+	fs.MustRemoveDir(t.Name())
+	tc := apptest.NewTestCase(t)
+	defer tc.Stop()
+
+	single := tc.MustStartDefaultVlsingle()
+	cluster := tc.MustStartDefaultVlcluster()
+
+	records := generateCompatRecords(1000)
+	ingestOpts := apptest.IngestOpts{
+		StreamFields: "app,host",
+	}
+	for _, sut := range []apptest.LogsApp{single, cluster} {
+		sut.JSONLineWrite(t, records, ingestOpts)
+		sut.ForceFlush(t)
+	}
+
+	// Sanity check - make sure all the records are ingested, since empty results are always equal.
+	got := single.LogsQLQuery(t, "* | count() rows", apptest.QueryOpts{})
+	assertLogsQLResponseEqual(t, got, &apptest.LogsQLQueryResponse{
+		LogLines: []string{
+			fmt.Sprintf(`{"rows":"%d"}`, len(records)),
+		},
+	})
+
+	// unordered compares the results of the query, which doesn't guarantee the order of the returned rows.
+	unordered := func(query string) {
+		t.Helper()
+		assertCompatQueryResults(t, single, cluster, query, apptest.QueryOpts{}, false)
+	}
+
+	// ordered compares the results of the query, which returns rows in a deterministic order.
+	ordered := func(query string, opts apptest.QueryOpts) {
+		t.Helper()
+		assertCompatQueryResults(t, single, cluster, query, opts, true)
+	}
+
+	// filters
+	unordered("*")
+	unordered("error")
+	unordered("level:error host:host-1")
+	unordered(`_stream:{app="app-1"}`)
+	unordered(`{host=~"host-[12]"} -level:debug`)
+	unordered("duration:>50")
+	unordered("duration:range[10, 20)")
+	unordered("user:in(user-1, user-2) | fields _time, user, level")
+	unordered(`_msg:~"request [0-9]+0 from"`)
+	unordered("_time:[2025-01-01T10:00:00Z, 2025-01-01T12:00:00Z)")
+
+	// stats
+	unordered("* | stats count() rows")
+	unordered("* | stats by (level) count() rows, sum(duration) total, min(duration) min_duration, max(duration) max_duration, avg(duration) avg_duration")
+	unordered("* | stats by (_time:1h) count() rows")
+	unordered("* | stats by (_time:1d, app) count() rows, count_uniq(user) users")
+	unordered("* | stats by (host) count_uniq(user) users, count_uniq(_stream) streams")
+	unordered("* | stats by (user) count() if (level:error) errors, count() rows")
+	unordered("* | filter duration:<10 | stats by (app) count() rows")
+	unordered("* | stats by (level) count() rows | filter rows:>100")
+	unordered(`* | extract "request <id> from" | stats count_uniq(id) ids`)
+
+	// other pipes
+	unordered("* | uniq by (level, host)")
+	unordered("* | uniq by (user) with hits")
+	unordered("* | field_names")
+	unordered("* | field_values level")
+	unordered("* | fields _msg, _time | copy _msg as msg_copy")
+	unordered("* | math duration * 2 as duration2 | fields duration, duration2")
+
+	// sorting and limits
+	ordered("* | sort by (_time desc, user) limit 10", apptest.QueryOpts{})
+	ordered("* | sort by (duration, _time) offset 5 limit 10", apptest.QueryOpts{})
+	ordered("* | sort by (_time) | limit 20", apptest.QueryOpts{})
+	ordered("* | first 5 by (_time)", apptest.QueryOpts{})
+	ordered("* | last 3 by (duration, _time)", apptest.QueryOpts{})
+	ordered("* | stats by (user) count() rows | sort by (rows desc, user)", apptest.QueryOpts{})
+	ordered("error | sort by (_time) limit 7", apptest.QueryOpts{})
+	ordered("*", apptest.QueryOpts{
+		Limit: "7",
+	})
+	ordered("level:warn", apptest.QueryOpts{
+		Start: "2025-01-01T05:00:00Z",
+		End:   "2025-01-01T20:00:00Z",
+		Limit: "15",
+	})
+
+	// stats_query and stats_query_range
+	assertCompatStatsQueryResults(t, single, cluster, "* | stats by (level) count() rows, sum(duration) total", "2025-01-03T00:00:00Z", "")
+	assertCompatStatsQueryResults(t, single, cluster, "* | stats by (app, host) count_uniq(user) users", "2025-01-03T00:00:00Z", "")
+	assertCompatStatsQueryResults(t, single, cluster, "* | stats by (level) count() rows", "", "1h")
+	assertCompatStatsQueryResults(t, single, cluster, "* | stats by (app) max(duration) max_duration", "", "6h")
+}
+
+// generateCompatRecords generates n JSON lines spread across two days.
+//
+// Every 10th record is duplicated in order to verify that the duplicate logs are preserved.
+func generateCompatRecords(n int) []string {
+	levels := []string{"info", "warn", "error", "debug"}
+	startTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var records []string
+	for i := 0; i < n; i++ {
+		ts := startTime.Add(time.Duration(i) * 173 * time.Second)
+		level := levels[(i+i/7)%len(levels)]
+		user := fmt.Sprintf("user-%d", i%13)
+		record := fmt.Sprintf(`{"_time":%q,"_msg":"request %d from %s finished with %s","app":"app-%d","host":"host-%d","level":%q,"user":%q,"duration":"%d"}`,
+			ts.Format(time.RFC3339Nano), i, user, level, i%3, i%5, level, user, i%97)
+		records = append(records, record)
+		if i%10 == 0 {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func assertCompatQueryResults(t *testing.T, single, cluster apptest.LogsApp, query string, opts apptest.QueryOpts, isOrdered bool) {
+	t.Helper()
+
+	singleLines := single.LogsQLQuery(t, query, opts).LogLines
+	clusterLines := cluster.LogsQLQuery(t, query, opts).LogLines
+	if !isOrdered {
+		sort.Strings(singleLines)
+		sort.Strings(clusterLines)
+	}
+	if len(singleLines) == 0 {
+		t.Errorf("unexpected empty results from vlsingle for query [%s]", query)
+		return
+	}
+	assertCompatLinesEqual(t, query, singleLines, clusterLines)
+}
+
+func assertCompatStatsQueryResults(t *testing.T, single, cluster apptest.LogsApp, query, ts, step string) {
+	t.Helper()
+
+	get := func(sut apptest.LogsApp) []string {
+		t.Helper()
+
+		var body string
+		var statusCode int
+		if step == "" {
+			body, statusCode = sut.StatsQueryRaw(t, query, apptest.StatsQueryOpts{
+				Time: ts,
+			})
+		} else {
+			body, statusCode = sut.StatsQueryRangeRaw(t, query, apptest.StatsQueryRangeOpts{
+				Start: "2025-01-01T00:00:00Z",
+				End:   "2025-01-03T00:00:00Z",
+				Step:  step,
+			})
+		}
+		if statusCode != http.StatusOK {
+			t.Fatalf("unexpected status code for query [%s]; got %d; want %d; response body: %s", query, statusCode, http.StatusOK, body)
+		}
+
+		var resp struct {
+			Status string
+			Data   struct {
+				ResultType string
+				Result     []json.RawMessage
+			}
+		}
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatalf("cannot parse response for query [%s]: %s; response body: %s", query, err, body)
+		}
+		lines := []string{
+			fmt.Sprintf("status=%s resultType=%s", resp.Status, resp.Data.ResultType),
+		}
+		for _, r := range resp.Data.Result {
+			lines = append(lines, string(r))
+		}
+		sort.Strings(lines[1:])
+		return lines
+	}
+
+	singleLines := get(single)
+	clusterLines := get(cluster)
+	if len(singleLines) < 2 {
+		t.Errorf("unexpected empty results from vlsingle for stats query [%s]", query)
+		return
+	}
+	assertCompatLinesEqual(t, query, singleLines, clusterLines)
+}
+
+func assertCompatLinesEqual(t *testing.T, query string, singleLines, clusterLines []string) {
+	t.Helper()
+
+	for i := 0; i < len(singleLines) && i < len(clusterLines); i++ {
+		if singleLines[i] != clusterLines[i] {
+			t.Errorf("results mismatch for query [%s] at line #%d\nvlsingle:\n%s\nvlcluster:\n%s", query, i, singleLines[i], clusterLines[i])
+			return
+		}
+	}
+	if len(singleLines) != len(clusterLines) {
+		t.Errorf("unexpected number of results for query [%s]; vlsingle: %d; vlcluster: %d\nvlsingle:\n%s\nvlcluster:\n%s",
+			query, len(singleLines), len(clusterLines), strings.Join(singleLines, "\n"), strings.Join(clusterLines, "\n"))
+	}
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/apptest"
+)
+
+// TestVlsingleHiddenStreams verifies that streams hidden via /select/logsql/hide_stream are excluded from query results.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+func TestVlsingleHiddenStreams(t *testing.T) {
+	fs.MustRemoveDir(t.Name())
+	tc := apptest.NewTestCase(t)
+	defer tc.Stop()
+
+	sut := tc.MustStartVlsingle("vlsingle", []string{
+		"-search.hiddenStreamsPath=" + filepath.Join(tc.Dir(), "hidden-streams.json"),
+	})
+
+	sut.JSONLineWrite(t, []string{
+		`{"_msg":"foo","_time":"2025-06-05T14:30:19.088007Z","app":"billing"}`,
+		`{"_msg":"bar","_time":"2025-06-05T14:30:20.088007Z","app":"legacy"}`,
+	}, apptest.IngestOpts{
+		StreamFields: "app",
+	})
+	sut.ForceFlush(t)
+
+	f := func(opts apptest.QueryOpts, logLinesExpected []string) {
+		t.Helper()
+
+		got := sut.LogsQLQuery(t, "* | fields _msg, app | sort by (_time)", opts)
+		assertLogsQLResponseEqual(t, got, &apptest.LogsQLQueryResponse{
+			LogLines: logLinesExpected,
+		})
+	}
+
+	allLines := []string{
+		`{"_msg":"foo","app":"billing"}`,
+		`{"_msg":"bar","app":"legacy"}`,
+	}
+	f(apptest.QueryOpts{}, allLines)
+
+	// The hidden stream must be excluded from query results
+	sut.HideStream(t, `{app="legacy"}`)
+	if diff := cmp.Diff(sut.HiddenStreams(t), []string{`{app="legacy"}`}); diff != "" {
+		t.Fatalf("unexpected hidden streams (-got;+want):\n%s", diff)
+	}
+	f(apptest.QueryOpts{}, []string{
+		`{"_msg":"foo","app":"billing"}`,
+	})
+
+	// The hidden stream must be returned when include_hidden_streams=1 query arg is set
+	f(apptest.QueryOpts{
+		IncludeHiddenStreams: true,
+	}, allLines)
+
+	// The unhidden stream must be returned in query results again
+	sut.UnhideStream(t, `{app="legacy"}`)
+	if diff := cmp.Diff(sut.HiddenStreams(t), []string{}); diff != "" {
+		t.Fatalf("unexpected hidden streams (-got;+want):\n%s", diff)
+	}
+	f(apptest.QueryOpts{}, allLines)
+}
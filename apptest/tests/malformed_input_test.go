@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/apptest"
+)
+
+// TestVlsingleMalformedInput sends malformed queries and insert payloads to vlsingle
+// and verifies that it continues serving requests.
+//
+// Besides the inputs below, it replays the inputs found by the fuzz targets,
+// which are stored at testdata/fuzz directories of the corresponding packages.
+// See `make fuzz`.
+func TestVlsingleMalformedInput(t *testing.T) {
+	fs.MustRemoveDir(t.Name())
+	tc := apptest.NewTestCase(t)
+	defer tc.Stop()
+
+	sut := tc.MustStartDefaultVlsingle()
+	cli := tc.Client()
+	baseURL := "http://" + sut.HTTPAddr()
+
+	queries := []string{
+		"",
+		"|",
+		"foo |",
+		"((((((((((((((((((((foo",
+		`"unterminated`,
+		`_stream:{foo="bar"`,
+		`_stream_id:in`,
+		`* | stats by (_time:-1h) count()`,
+		`* | uniq *`,
+		`* | sort by (` + strings.Repeat("x,", 1000) + `y)`,
+		`* | extract "<<<>>>"`,
+		`* | math 1/0 as x`,
+		`foo:~"(((("`,
+		`"."`,
+		"\x00\xff\xfe",
+	}
+	queries = append(queries, readFuzzCorpus(t, "../../lib/logstorage/testdata/fuzz/FuzzParseQuery")...)
+	for _, q := range queries {
+		_, statusCode := cli.PostForm(t, baseURL+"/select/logsql/query", url.Values{
+			"query": {q},
+		})
+		if statusCode >= 500 {
+			t.Fatalf("unexpected status code for query %q: %d", q, statusCode)
+		}
+	}
+
+	jsonlinePayloads := []string{
+		"",
+		"{",
+		`{"_msg":`,
+		`{"_msg":"foo","_time":"not a time"}`,
+		`[{"_msg":"foo"}]`,
+		strings.Repeat(`{"a":`, 10000),
+		"\x00\xff\xfe",
+	}
+	jsonlinePayloads = append(jsonlinePayloads, readFuzzCorpus(t, "../../app/vlinsert/jsonline/testdata/fuzz/FuzzProcessStreamInternal")...)
+	for _, data := range jsonlinePayloads {
+		_, statusCode := cli.Post(t, baseURL+"/insert/jsonline", "application/stream+json", []byte(data))
+		if statusCode >= 500 {
+			t.Fatalf("unexpected status code for jsonline payload %q: %d", data, statusCode)
+		}
+	}
+
+	otlpPayloads := []string{
+		"",
+		"\x0a",
+		"\x0a\xff\xff\xff\xff\x0f",
+		"\x0a\x02\x12\x00\x12",
+		"\xff\xff\xff\xff",
+	}
+	otlpPayloads = append(otlpPayloads, readFuzzCorpus(t, "../../app/vlinsert/opentelemetry/testdata/fuzz/FuzzPushProtobufRequest")...)
+	for _, data := range otlpPayloads {
+		_, statusCode := cli.Post(t, baseURL+"/insert/opentelemetry/v1/logs", "application/x-protobuf", []byte(data))
+		if statusCode >= 500 {
+			t.Fatalf("unexpected status code for OpenTelemetry payload %q: %d", data, statusCode)
+		}
+	}
+
+	// Verify the server is still alive and can ingest and query logs.
+	sut.JSONLineWrite(t, []string{
+		`{"_msg":"still alive","_time":"2025-01-01T00:00:00Z"}`,
+	}, apptest.IngestOpts{})
+	sut.ForceFlush(t)
+	got := sut.LogsQLQuery(t, `"still alive"`, apptest.QueryOpts{})
+	assertLogsQLResponseEqual(t, got, &apptest.LogsQLQueryResponse{
+		LogLines: []string{
+			`{"_msg":"still alive","_stream":"{}","_time":"2025-01-01T00:00:00Z"}`,
+		},
+	})
+}
+
+// readFuzzCorpus reads inputs for single-arg fuzz targets from the given dir.
+//
+// The dir contains files in the `go test fuzz v1` format. See https://go.dev/doc/security/fuzz/#corpus-file-format
+// An empty result is returned if the dir doesn't exist.
+func readFuzzCorpus(t *testing.T, dir string) []string {
+	t.Helper()
+
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		t.Fatalf("cannot read fuzz corpus dir: %s", err)
+	}
+
+	var inputs []string
+	for _, de := range des {
+		if de.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, de.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read fuzz corpus file: %s", err)
+		}
+		input, err := parseFuzzCorpusFile(data)
+		if err != nil {
+			t.Fatalf("cannot parse fuzz corpus file %q: %s", path, err)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+func parseFuzzCorpusFile(data []byte) (string, error) {
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 2 || string(lines[0]) != "go test fuzz v1" {
+		return "", fmt.Errorf("unexpected contents; want `go test fuzz v1` header followed by a single value")
+	}
+	v := string(lines[1])
+	for _, prefix := range []string{"string(", "[]byte("} {
+		if s, ok := strings.CutPrefix(v, prefix); ok {
+			s, ok = strings.CutSuffix(s, ")")
+			if !ok {
+				return "", fmt.Errorf("missing closing paren in %q", v)
+			}
+			return strconv.Unquote(s)
+		}
+	}
+	return "", fmt.Errorf("unsupported value %q; want string(...) or []byte(...)", v)
+}
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/apptest"
+)
+
+// TestStatusConfig verifies that /api/v1/status/config returns the effective config with redacted secrets and stable hash.
+func TestStatusConfig(t *testing.T) {
+	fs.MustRemoveDir(t.Name())
+	tc := apptest.NewTestCase(t)
+	defer tc.Stop()
+
+	sut := tc.MustStartVlsingle("vlsingle", []string{
+		"-forceMergeAuthKey=foobar",
+		"-retentionPeriod=30d",
+	})
+
+	resp := sut.StatusConfig(t)
+	if v, ok := resp.FlagValue("retentionPeriod"); !ok || v != "30d" {
+		t.Fatalf("unexpected -retentionPeriod value; got %q; want %q", v, "30d")
+	}
+	if v, ok := resp.FlagValue("forceMergeAuthKey"); !ok || v != "secret" {
+		t.Fatalf("unexpected -forceMergeAuthKey value; got %q; want %q", v, "secret")
+	}
+	if !strings.Contains(resp.ScrapeConfig, sut.HTTPAddr()) {
+		t.Fatalf("scrape config must contain %q; got\n%s", sut.HTTPAddr(), resp.ScrapeConfig)
+	}
+	if resp.Hash == "" {
+		t.Fatalf("expecting non-empty hash")
+	}
+
+	// The hash must remain the same for the same config
+	if hash := sut.StatusConfig(t).Hash; hash != resp.Hash {
+		t.Fatalf("unexpected hash change; got %q; want %q", hash, resp.Hash)
+	}
+
+	// The hash must change for different config
+	other := tc.MustStartVlsingle("vlsingle-other", []string{
+		"-forceMergeAuthKey=foobar",
+		"-retentionPeriod=31d",
+	})
+	if hash := other.StatusConfig(t).Hash; hash == resp.Hash {
+		t.Fatalf("expecting different hash for different config")
+	}
+}
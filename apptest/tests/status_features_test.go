@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/apptest"
+)
+
+// TestStatusFeatures verifies that /api/v1/status/features reflects the capabilities enabled via command-line flags.
+func TestStatusFeatures(t *testing.T) {
+	fs.MustRemoveDir(t.Name())
+	tc := apptest.NewTestCase(t)
+	defer tc.Stop()
+
+	single := tc.MustStartVlsingle("vlsingle", []string{
+		"-delete.enable=true",
+		"-syslog.listenAddr.tcp=127.0.0.1:0",
+	})
+	resp := single.StatusFeatures(t)
+	if resp.Storage.Mode != "local" {
+		t.Fatalf("unexpected storage mode; got %q; want %q", resp.Storage.Mode, "local")
+	}
+	if !resp.Insert.HTTPEnabled {
+		t.Fatalf("expecting enabled HTTP data ingestion")
+	}
+	for _, protocol := range []string{"jsonline", "opentelemetry", "syslog"} {
+		if !slices.Contains(resp.Insert.Protocols, protocol) {
+			t.Fatalf("missing %q protocol in %q", protocol, resp.Insert.Protocols)
+		}
+	}
+	if slices.Contains(resp.Insert.Protocols, "kafka") {
+		t.Fatalf("unexpected kafka protocol in %q", resp.Insert.Protocols)
+	}
+	if !resp.Select.DeleteEnabled || !slices.Contains(resp.Select.Endpoints, "/delete/run_task") {
+		t.Fatalf("expecting enabled /delete/* endpoints; got %q", resp.Select.Endpoints)
+	}
+	if !slices.Contains(resp.Select.Endpoints, "/select/logsql/query") {
+		t.Fatalf("missing /select/logsql/query in %q", resp.Select.Endpoints)
+	}
+
+	cluster := tc.MustStartDefaultVlcluster()
+
+	// The insert node is started with -select.disable
+	resp = cluster.InsertNodeStatusFeatures(t)
+	if resp.Storage.Mode != "cluster" || resp.Storage.StorageNodes != 3 {
+		t.Fatalf("unexpected storage features; got mode=%q, storage_nodes=%d; want mode=%q, storage_nodes=3", resp.Storage.Mode, resp.Storage.StorageNodes, "cluster")
+	}
+	if len(resp.Select.Endpoints) > 0 {
+		t.Fatalf("unexpected querying endpoints at the insert node: %q", resp.Select.Endpoints)
+	}
+
+	// The select node is started with -insert.disable
+	resp = cluster.SelectNodeStatusFeatures(t)
+	if resp.Insert.HTTPEnabled || len(resp.Insert.Protocols) > 0 {
+		t.Fatalf("unexpected data ingestion protocols at the select node: %q", resp.Insert.Protocols)
+	}
+	if !slices.Contains(resp.Select.Endpoints, "/select/logsql/query") {
+		t.Fatalf("missing /select/logsql/query in %q", resp.Select.Endpoints)
+	}
+}
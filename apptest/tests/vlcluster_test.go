@@ -1,11 +1,13 @@
 package tests
 
 import (
+	"context"
 	"testing"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/apptest"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
 )
 
 // TestVlclusterIngestAndQuery verifies that logs are correctly ingested and queried from cluster.
@@ -60,4 +62,33 @@ func TestVlclusterIngestAndQuery(t *testing.T) {
 	if facetsGot != facetsWant {
 		t.Fatalf("unexpected facets\ngot\n%s\nwant\n%s", facetsGot, facetsWant)
 	}
+
+	// Verify annotate_rows query arg
+	rs, err := sut.LogsClient(t).Query(context.Background(), "*", &client.QueryOptions{
+		AnnotateRows: true,
+	})
+	if err != nil {
+		t.Fatalf("cannot execute query: %s", err)
+	}
+	defer rs.Close()
+	rowsCount := 0
+	for rs.Next() {
+		row := rs.Row()
+		if v := row.Get("_debug_partition"); v != "20250101" {
+			t.Fatalf("unexpected _debug_partition in row %v; got %q; want %q", row, v, "20250101")
+		}
+		if row.Get("_debug_part") == "" {
+			t.Fatalf("missing _debug_part in row %v", row)
+		}
+		if row.Get("_debug_node") == "" {
+			t.Fatalf("missing _debug_node in row %v", row)
+		}
+		rowsCount++
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatalf("cannot read query results: %s", err)
+	}
+	if rowsCount != len(ingestRecords) {
+		t.Fatalf("unexpected number of rows; got %d; want %d", rowsCount, len(ingestRecords))
+	}
 }
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
 )
 
 // Vlcluster holds the state of a VictoriaLogs cluster.
@@ -101,22 +103,51 @@ func (app *Vlcluster) JSONLineWrite(t *testing.T, records []string, opts IngestO
 }
 
 // LogsQLQuery is a test helper function that performs
-// PromQL/MetricsQL range query by sending a HTTP POST request to
-// /select/logsql/query endpoint.
+// LogsQL query via /select/logsql/query endpoint at vlselect.
 //
 // See https://docs.victoriametrics.com/victorialogs/querying/#querying-logs
 func (app *Vlcluster) LogsQLQuery(t *testing.T, query string, opts QueryOpts) *LogsQLQueryResponse {
 	t.Helper()
 
+	return logsQLQuery(t, app.LogsClient(t), query, opts)
+}
+
+// LogsClient returns lib/client.Client, which ingests logs via vlinsert and queries them via vlselect.
+func (app *Vlcluster) LogsClient(t *testing.T) *client.Client {
+	t.Helper()
+
+	return mustNewLogsClient(t, &client.Config{
+		InsertURL: "http://" + app.insertNode.httpListenAddr,
+		SelectURL: "http://" + app.selectNode.httpListenAddr,
+	})
+}
+
+// StatsQueryRaw is a test helper function that performs
+// a POST to /select/logsql/stats_query and returns raw body and status code.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-log-stats
+func (app *Vlcluster) StatsQueryRaw(t *testing.T, query string, opts StatsQueryOpts) (string, int) {
+	t.Helper()
+
 	values := opts.asURLValues()
 	values.Add("query", query)
 
-	url := fmt.Sprintf("http://%s/select/logsql/query", app.selectNode.httpListenAddr)
-	res, statusCode := app.selectNode.cli.PostForm(t, url, values)
-	if statusCode != http.StatusOK {
-		t.Fatalf("unexpected status code from %s: %d; want %d", url, statusCode, http.StatusOK)
-	}
-	return NewLogsQLQueryResponse(t, res)
+	url := fmt.Sprintf("http://%s/select/logsql/stats_query", app.selectNode.httpListenAddr)
+	return app.selectNode.cli.PostForm(t, url, values)
+}
+
+// StatsQueryRangeRaw is a test helper function that performs
+// a POST to /select/logsql/stats_query_range and returns raw body and status code.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-log-range-stats
+func (app *Vlcluster) StatsQueryRangeRaw(t *testing.T, query string, opts StatsQueryRangeOpts) (string, int) {
+	t.Helper()
+
+	values := opts.asURLValues()
+	values.Add("query", query)
+
+	url := fmt.Sprintf("http://%s/select/logsql/stats_query_range", app.selectNode.httpListenAddr)
+	return app.selectNode.cli.PostForm(t, url, values)
 }
 
 // Facets sends the given query to /select/logsql/facets and returns the response.
@@ -136,6 +167,24 @@ func (app *Vlcluster) Facets(t *testing.T, query string, opts FacetsOpts) string
 	return res
 }
 
+// InsertNodeStatusFeatures returns capabilities enabled at the insert node of app.
+//
+// See https://docs.victoriametrics.com/victorialogs/#status-features
+func (app *Vlcluster) InsertNodeStatusFeatures(t *testing.T) *StatusFeaturesResponse {
+	t.Helper()
+
+	return app.insertNode.StatusFeatures(t)
+}
+
+// SelectNodeStatusFeatures returns capabilities enabled at the select node of app.
+//
+// See https://docs.victoriametrics.com/victorialogs/#status-features
+func (app *Vlcluster) SelectNodeStatusFeatures(t *testing.T) *StatusFeaturesResponse {
+	t.Helper()
+
+	return app.selectNode.StatusFeatures(t)
+}
+
 // String returns the string representation of the app state.
 func (app *Vlcluster) String() string {
 	return "Vlcluster"
@@ -1,6 +1,7 @@
 package apptest
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/client"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
@@ -80,6 +82,116 @@ func mustStartVlnode(t *testing.T, instance string, flags []string, cli *Client,
 	return node, extracts[1:]
 }
 
+// StatusFeatures returns the response from /api/v1/status/features endpoint of the node.
+//
+// See https://docs.victoriametrics.com/victorialogs/#status-features
+func (node *vlnode) StatusFeatures(t *testing.T) *StatusFeaturesResponse {
+	t.Helper()
+
+	url := fmt.Sprintf("http://%s/api/v1/status/features", node.httpListenAddr)
+	res, statusCode := node.cli.Get(t, url)
+	if statusCode != http.StatusOK {
+		t.Fatalf("unexpected status code from %s: %d; want %d", url, statusCode, http.StatusOK)
+	}
+	var resp StatusFeaturesResponse
+	if err := json.Unmarshal([]byte(res), &resp); err != nil {
+		t.Fatalf("cannot unmarshal response from %s: %s; response: %s", url, err, res)
+	}
+	return &resp
+}
+
+// StatusConfig returns the response from /api/v1/status/config endpoint of the node.
+//
+// See https://docs.victoriametrics.com/victorialogs/#status-config
+func (node *vlnode) StatusConfig(t *testing.T) *StatusConfigResponse {
+	t.Helper()
+
+	url := fmt.Sprintf("http://%s/api/v1/status/config", node.httpListenAddr)
+	res, statusCode := node.cli.Get(t, url)
+	if statusCode != http.StatusOK {
+		t.Fatalf("unexpected status code from %s: %d; want %d", url, statusCode, http.StatusOK)
+	}
+	var resp StatusConfigResponse
+	if err := json.Unmarshal([]byte(res), &resp); err != nil {
+		t.Fatalf("cannot unmarshal response from %s: %s; response: %s", url, err, res)
+	}
+	return &resp
+}
+
+// StatusConfig returns the effective configuration of app.
+//
+// See https://docs.victoriametrics.com/victorialogs/#status-config
+func (app *Vlsingle) StatusConfig(t *testing.T) *StatusConfigResponse {
+	t.Helper()
+
+	return app.node.StatusConfig(t)
+}
+
+// StatusFeatures returns capabilities enabled at app.
+//
+// See https://docs.victoriametrics.com/victorialogs/#status-features
+func (app *Vlsingle) StatusFeatures(t *testing.T) *StatusFeaturesResponse {
+	t.Helper()
+
+	return app.node.StatusFeatures(t)
+}
+
+// HideStream hides logs streams matching the given stream filter from query results at app.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+func (app *Vlsingle) HideStream(t *testing.T, stream string) {
+	t.Helper()
+
+	app.postHiddenStreamsRequest(t, "/select/logsql/hide_stream", stream)
+}
+
+// UnhideStream unhides logs streams previously hidden via HideStream.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+func (app *Vlsingle) UnhideStream(t *testing.T, stream string) {
+	t.Helper()
+
+	app.postHiddenStreamsRequest(t, "/select/logsql/unhide_stream", stream)
+}
+
+func (app *Vlsingle) postHiddenStreamsRequest(t *testing.T, path, stream string) {
+	t.Helper()
+
+	url := fmt.Sprintf("http://%s%s", app.node.httpListenAddr, path)
+	res, statusCode := app.node.cli.PostForm(t, url, map[string][]string{
+		"stream": {stream},
+	})
+	if statusCode != http.StatusOK {
+		t.Fatalf("unexpected status code from %s: got %d, want %d; response: %s", url, statusCode, http.StatusOK, res)
+	}
+}
+
+// HiddenStreams returns stream filters for hidden streams at app.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+func (app *Vlsingle) HiddenStreams(t *testing.T) []string {
+	t.Helper()
+
+	url := fmt.Sprintf("http://%s/select/logsql/hidden_streams", app.node.httpListenAddr)
+	res, statusCode := app.node.cli.Get(t, url)
+	if statusCode != http.StatusOK {
+		t.Fatalf("unexpected status code from %s: got %d, want %d; response: %s", url, statusCode, http.StatusOK, res)
+	}
+	var resp struct {
+		HiddenStreams []struct {
+			Stream string `json:"stream"`
+		} `json:"hidden_streams"`
+	}
+	if err := json.Unmarshal([]byte(res), &resp); err != nil {
+		t.Fatalf("cannot unmarshal response from %s: %s; response: %s", url, err, res)
+	}
+	streams := []string{}
+	for _, hs := range resp.HiddenStreams {
+		streams = append(streams, hs.Stream)
+	}
+	return streams
+}
+
 // ForceFlush is a test helper function that forces the flushing of inserted
 // data, so it becomes available for searching immediately.
 func (app *Vlsingle) ForceFlush(t *testing.T) {
@@ -134,19 +246,22 @@ func (app *Vlsingle) NativeWrite(t *testing.T, records []logstorage.InsertRow, o
 }
 
 // LogsQLQuery is a test helper function that performs
-// PromQL/MetricsQL range query by sending a HTTP POST request to
-// /select/logsql/query endpoint.
+// LogsQL query via /select/logsql/query endpoint.
 //
 // See https://docs.victoriametrics.com/victorialogs/querying/#querying-logs
 func (app *Vlsingle) LogsQLQuery(t *testing.T, query string, opts QueryOpts) *LogsQLQueryResponse {
 	t.Helper()
 
-	values := opts.asURLValues()
-	values.Add("query", query)
+	return logsQLQuery(t, app.LogsClient(t), query, opts)
+}
 
-	url := fmt.Sprintf("http://%s/select/logsql/query", app.node.httpListenAddr)
-	res, _ := app.node.cli.PostForm(t, url, values)
-	return NewLogsQLQueryResponse(t, res)
+// LogsClient returns lib/client.Client for ingesting logs into app and for querying them.
+func (app *Vlsingle) LogsClient(t *testing.T) *client.Client {
+	t.Helper()
+
+	return mustNewLogsClient(t, &client.Config{
+		URL: "http://" + app.node.httpListenAddr,
+	})
 }
 
 // StatsQueryRaw is a test helper function that performs
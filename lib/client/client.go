@@ -0,0 +1,254 @@
+// Package client provides Go client for ingesting logs into VictoriaLogs and for querying them.
+//
+// The client works with both single-node VictoriaLogs and VictoriaLogs cluster.
+//
+// See https://github.com/VictoriaMetrics/VictoriaLogs/tree/master/lib/client
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the default number of retries for failed ingestion requests.
+	DefaultMaxRetries = 5
+
+	// DefaultRetryMinBackoff is the default minimum duration to wait before retrying failed ingestion request.
+	DefaultRetryMinBackoff = 500 * time.Millisecond
+
+	// DefaultRetryMaxBackoff is the default maximum duration to wait before retrying failed ingestion request.
+	DefaultRetryMaxBackoff = 30 * time.Second
+)
+
+// Config is the configuration for the Client.
+type Config struct {
+	// URL is the base url of VictoriaLogs, which is used for both ingestion and querying. For example, http://localhost:9428
+	//
+	// InsertURL and SelectURL can be used instead of URL for VictoriaLogs cluster with distinct vlinsert and vlselect addresses.
+	URL string
+
+	// InsertURL is an optional base url for data ingestion, e.g. the url of vlinsert. It overrides URL for data ingestion.
+	InsertURL string
+
+	// SelectURL is an optional base url for querying, e.g. the url of vlselect. It overrides URL for querying.
+	SelectURL string
+
+	// AccountID is the account id of the tenant to work with.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/#multitenancy
+	AccountID uint32
+
+	// ProjectID is the project id of the tenant to work with.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/#multitenancy
+	ProjectID uint32
+
+	// Headers contains optional headers to send with every request. For example, Authorization header.
+	Headers http.Header
+
+	// HTTPClient is an optional http client to use for requests. http.DefaultClient is used if it isn't set.
+	HTTPClient *http.Client
+
+	// MaxRetries is the maximum number of retries for failed ingestion requests.
+	//
+	// DefaultMaxRetries is used if it is set to 0. Retries are disabled if it is set to negative value.
+	MaxRetries int
+
+	// RetryMinBackoff is the minimum duration to wait before retrying failed ingestion request.
+	// The duration is doubled after every unsuccessful retry until it reaches RetryMaxBackoff.
+	//
+	// DefaultRetryMinBackoff is used if it is set to 0.
+	RetryMinBackoff time.Duration
+
+	// RetryMaxBackoff is the maximum duration to wait before retrying failed ingestion request.
+	//
+	// DefaultRetryMaxBackoff is used if it is set to 0.
+	RetryMaxBackoff time.Duration
+}
+
+// Client is a client for VictoriaLogs.
+//
+// It is safe calling Client methods from concurrently running goroutines.
+type Client struct {
+	insertURL string
+	selectURL string
+
+	accountID uint32
+	projectID uint32
+	headers   http.Header
+
+	hc *http.Client
+
+	maxRetries      int
+	retryMinBackoff time.Duration
+	retryMaxBackoff time.Duration
+}
+
+// New returns new client for the given cfg.
+func New(cfg *Config) (*Client, error) {
+	insertURL := cfg.InsertURL
+	if insertURL == "" {
+		insertURL = cfg.URL
+	}
+	selectURL := cfg.SelectURL
+	if selectURL == "" {
+		selectURL = cfg.URL
+	}
+	if insertURL == "" && selectURL == "" {
+		return nil, fmt.Errorf("missing URL")
+	}
+	for _, u := range []string{insertURL, selectURL} {
+		if u == "" {
+			continue
+		}
+		if _, err := url.Parse(u); err != nil {
+			return nil, fmt.Errorf("cannot parse url %q: %w", u, err)
+		}
+	}
+
+	hc := cfg.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	maxRetries := cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	} else if maxRetries < 0 {
+		maxRetries = 0
+	}
+	retryMinBackoff := cfg.RetryMinBackoff
+	if retryMinBackoff <= 0 {
+		retryMinBackoff = DefaultRetryMinBackoff
+	}
+	retryMaxBackoff := cfg.RetryMaxBackoff
+	if retryMaxBackoff <= 0 {
+		retryMaxBackoff = DefaultRetryMaxBackoff
+	}
+	if retryMaxBackoff < retryMinBackoff {
+		retryMaxBackoff = retryMinBackoff
+	}
+
+	c := &Client{
+		insertURL: strings.TrimSuffix(insertURL, "/"),
+		selectURL: strings.TrimSuffix(selectURL, "/"),
+
+		accountID: cfg.AccountID,
+		projectID: cfg.ProjectID,
+		headers:   cfg.Headers.Clone(),
+
+		hc: hc,
+
+		maxRetries:      maxRetries,
+		retryMinBackoff: retryMinBackoff,
+		retryMaxBackoff: retryMaxBackoff,
+	}
+	return c, nil
+}
+
+// StatusError is returned when VictoriaLogs responds with unexpected status code.
+type StatusError struct {
+	// StatusCode is the response status code.
+	StatusCode int
+
+	// Body is the response body, which usually contains the error message.
+	Body string
+}
+
+// Error implements error interface.
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d; response body: %q", se.StatusCode, se.Body)
+}
+
+// isRetryable returns true if the request failed with err can be retried.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode == http.StatusTooManyRequests || se.StatusCode >= 500
+	}
+	// Network errors are retryable
+	return true
+}
+
+func (c *Client) newRequest(ctx context.Context, method, baseURL, path string, args url.Values, body io.Reader) (*http.Request, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("missing url for %s", path)
+	}
+	u := baseURL + path
+	if len(args) > 0 {
+		u += "?" + args.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request to %q: %w", u, err)
+	}
+	for k, vs := range c.headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if c.accountID != 0 || c.projectID != 0 {
+		req.Header.Set("AccountID", strconv.FormatUint(uint64(c.accountID), 10))
+		req.Header.Set("ProjectID", strconv.FormatUint(uint64(c.projectID), 10))
+	}
+	return req, nil
+}
+
+// doRequest sends req and returns the response with 200 status code.
+//
+// The caller must close the response body.
+func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	// Limit the size of the error message.
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 16*1024))
+	_ = resp.Body.Close()
+	return nil, &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+// doWithRetries calls f until it succeeds, returns non-retryable error or the number of retries exceeds c.maxRetries.
+func (c *Client) doWithRetries(ctx context.Context, f func() error) error {
+	backoff := c.retryMinBackoff
+	for i := 0; ; i++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if i >= c.maxRetries || !isRetryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%w; the last error: %w", ctx.Err(), err)
+		case <-t.C:
+		}
+
+		backoff *= 2
+		if backoff > c.retryMaxBackoff {
+			backoff = c.retryMaxBackoff
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testServer struct {
+	mu       sync.Mutex
+	requests []testRequest
+
+	// statusCodes contains status codes to return for the next requests.
+	statusCodes []int
+
+	// responseBody is the body to return for successful requests.
+	responseBody string
+}
+
+type testRequest struct {
+	path      string
+	args      string
+	accountID string
+	projectID string
+	body      string
+}
+
+func (ts *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	args := r.URL.RawQuery
+	if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		args = string(data)
+		data = nil
+	}
+
+	ts.mu.Lock()
+	ts.requests = append(ts.requests, testRequest{
+		path:      r.URL.Path,
+		args:      args,
+		accountID: r.Header.Get("AccountID"),
+		projectID: r.Header.Get("ProjectID"),
+		body:      string(data),
+	})
+	statusCode := http.StatusOK
+	if len(ts.statusCodes) > 0 {
+		statusCode = ts.statusCodes[0]
+		ts.statusCodes = ts.statusCodes[1:]
+	}
+	ts.mu.Unlock()
+
+	if statusCode != http.StatusOK {
+		http.Error(w, fmt.Sprintf("error with status code %d", statusCode), statusCode)
+		return
+	}
+	fmt.Fprintf(w, "%s", ts.responseBody)
+}
+
+func (ts *testServer) getRequests() []testRequest {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]testRequest{}, ts.requests...)
+}
+
+func newTestClient(t *testing.T, ts *testServer, cfg *Config) *Client {
+	t.Helper()
+
+	s := httptest.NewServer(ts)
+	t.Cleanup(s.Close)
+
+	cfg.URL = s.URL
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+	return c
+}
+
+func TestNew_Failure(t *testing.T) {
+	if _, err := New(&Config{}); err == nil {
+		t.Fatalf("expecting non-nil error for missing url")
+	}
+	if _, err := New(&Config{URL: "http://foo:bar:baz"}); err == nil {
+		t.Fatalf("expecting non-nil error for invalid url")
+	}
+}
+
+func TestClientIngest(t *testing.T) {
+	ts := &testServer{}
+	c := newTestClient(t, ts, &Config{
+		AccountID: 12,
+		ProjectID: 34,
+	})
+
+	entries := []Entry{
+		{
+			Time: time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.UTC),
+			Fields: []Field{
+				{Name: "_msg", Value: `foo "bar"`},
+				{Name: "host", Value: "h1"},
+			},
+		},
+		{
+			Fields: []Field{
+				{Name: "_msg", Value: "baz\nqux"},
+			},
+		},
+	}
+	opts := &IngestOptions{
+		StreamFields: []string{"host", "app"},
+		IgnoreFields: []string{"trace_id"},
+		ExtraFields: []Field{
+			{Name: "env", Value: "prod"},
+		},
+	}
+	if err := c.Ingest(context.Background(), entries, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	requestsExpected := []testRequest{
+		{
+			path:      "/insert/jsonline",
+			args:      "_stream_fields=host%2Capp&extra_fields=env%3Dprod&ignore_fields=trace_id",
+			accountID: "12",
+			projectID: "34",
+			body: `{"_time":"2025-01-02T03:04:05.123456789Z","_msg":"foo \"bar\"","host":"h1"}
+{"_msg":"baz\nqux"}
+`,
+		},
+	}
+	if requests := ts.getRequests(); !reflect.DeepEqual(requests, requestsExpected) {
+		t.Fatalf("unexpected requests;\ngot\n%v\nwant\n%v", requests, requestsExpected)
+	}
+}
+
+func TestClientIngest_Retries(t *testing.T) {
+	ts := &testServer{
+		statusCodes: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+	}
+	c := newTestClient(t, ts, &Config{
+		RetryMinBackoff: time.Millisecond,
+	})
+
+	entries := []Entry{
+		{
+			Fields: []Field{
+				{Name: "_msg", Value: "foo"},
+			},
+		},
+	}
+	if err := c.Ingest(context.Background(), entries, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := len(ts.getRequests()); n != 3 {
+		t.Fatalf("unexpected number of requests; got %d; want 3", n)
+	}
+
+	// Non-retryable error
+	ts.statusCodes = []int{http.StatusBadRequest}
+	err := c.Ingest(context.Background(), entries, nil)
+	var se *StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("expecting StatusError; got %v", err)
+	}
+	if se.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status code; got %d; want %d", se.StatusCode, http.StatusBadRequest)
+	}
+	if n := len(ts.getRequests()); n != 4 {
+		t.Fatalf("unexpected number of requests; got %d; want 4", n)
+	}
+
+	// Too many retries
+	ts.statusCodes = []int{500, 500, 500}
+	c.maxRetries = 2
+	if err := c.Ingest(context.Background(), entries, nil); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if n := len(ts.getRequests()); n != 7 {
+		t.Fatalf("unexpected number of requests; got %d; want 7", n)
+	}
+}
+
+func TestBatchWriter(t *testing.T) {
+	ts := &testServer{}
+	c := newTestClient(t, ts, &Config{})
+
+	bw := c.NewBatchWriter(nil, &BatchConfig{
+		MaxBatchSize:  30,
+		FlushInterval: time.Hour,
+	})
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		e := Entry{
+			Fields: []Field{
+				{Name: "_msg", Value: fmt.Sprintf("message %d", i)},
+			},
+		}
+		if err := bw.Add(ctx, e); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := bw.Close(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var bodies []string
+	for _, r := range ts.getRequests() {
+		bodies = append(bodies, r.body)
+	}
+	bodiesExpected := []string{
+		`{"_msg":"message 0"}` + "\n" + `{"_msg":"message 1"}` + "\n",
+		`{"_msg":"message 2"}` + "\n" + `{"_msg":"message 3"}` + "\n",
+		`{"_msg":"message 4"}` + "\n",
+	}
+	if !reflect.DeepEqual(bodies, bodiesExpected) {
+		t.Fatalf("unexpected bodies;\ngot\n%q\nwant\n%q", bodies, bodiesExpected)
+	}
+}
+
+func TestBatchWriter_FlushInterval(t *testing.T) {
+	ts := &testServer{}
+	c := newTestClient(t, ts, &Config{})
+
+	bw := c.NewBatchWriter(nil, &BatchConfig{
+		FlushInterval: 10 * time.Millisecond,
+	})
+	defer func() {
+		_ = bw.Close(context.Background())
+	}()
+
+	e := Entry{
+		Fields: []Field{
+			{Name: "_msg", Value: "foo"},
+		},
+	}
+	if err := bw.Add(context.Background(), e); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ts.getRequests()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the buffered entry hasn't been sent in 5 seconds")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientQuery(t *testing.T) {
+	ts := &testServer{
+		responseBody: `{"_time":"2025-01-02T03:04:05Z","_msg":"foo","host":"h1"}
+
+{"_msg":"bar","_time":"2025-01-02T03:04:06.5Z"}
+`,
+	}
+	c := newTestClient(t, ts, &Config{})
+
+	opts := &QueryOptions{
+		Start:        time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+		Limit:        10,
+		ExtraFilters: []string{"host:h1"},
+		AnnotateRows: true,
+
+		IncludeHiddenStreams: true,
+	}
+	rs, err := c.Query(context.Background(), "error", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var rows []Row
+	for rs.Next() {
+		rows = append(rows, append(Row{}, rs.Row()...))
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := rs.Close(); err != nil {
+		t.Fatalf("unexpected error when closing rows: %s", err)
+	}
+
+	rowsExpected := []Row{
+		{
+			{Name: "_time", Value: "2025-01-02T03:04:05Z"},
+			{Name: "_msg", Value: "foo"},
+			{Name: "host", Value: "h1"},
+		},
+		{
+			{Name: "_msg", Value: "bar"},
+			{Name: "_time", Value: "2025-01-02T03:04:06.5Z"},
+		},
+	}
+	if !reflect.DeepEqual(rows, rowsExpected) {
+		t.Fatalf("unexpected rows;\ngot\n%v\nwant\n%v", rows, rowsExpected)
+	}
+
+	ts0, err := rows[1].Time()
+	if err != nil {
+		t.Fatalf("cannot get row time: %s", err)
+	}
+	if tsExpected := time.Date(2025, 1, 2, 3, 4, 6, 5e8, time.UTC); !ts0.Equal(tsExpected) {
+		t.Fatalf("unexpected row time; got %s; want %s", ts0, tsExpected)
+	}
+	if v := rows[0].Get("host"); v != "h1" {
+		t.Fatalf("unexpected host; got %q; want %q", v, "h1")
+	}
+	if v := rows[1].Get("host"); v != "" {
+		t.Fatalf("unexpected host; got %q; want empty", v)
+	}
+
+	requests := ts.getRequests()
+	argsExpected := "annotate_rows=1&extra_filters=host%3Ah1&include_hidden_streams=1&limit=10&query=error&start=2025-01-02T00%3A00%3A00Z"
+	if len(requests) != 1 || requests[0].path != "/select/logsql/query" || requests[0].args != argsExpected {
+		t.Fatalf("unexpected requests: %v", requests)
+	}
+}
+
+func TestClientQuery_Failure(t *testing.T) {
+	ts := &testServer{
+		statusCodes: []int{http.StatusBadRequest},
+	}
+	c := newTestClient(t, ts, &Config{})
+
+	_, err := c.Query(context.Background(), "foo(", nil)
+	if err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if !strings.Contains(err.Error(), "error with status code 400") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Invalid response
+	ts.responseBody = "foobar\n"
+	rs, err := c.Query(context.Background(), "*", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer rs.Close()
+	if rs.Next() {
+		t.Fatalf("expecting no rows")
+	}
+	if err := rs.Err(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestParseRow_Failure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		if _, err := parseRow(nil, []byte(s)); err == nil {
+			t.Fatalf("expecting non-nil error for %q", s)
+		}
+	}
+
+	f(`[]`)
+	f(`{"foo":`)
+	f(`{"foo":123}`)
+	f(`"foo"`)
+}
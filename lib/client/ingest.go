@@ -0,0 +1,308 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field is a single log field.
+//
+// See https://docs.victoriametrics.com/victorialogs/keyconcepts/#data-model
+type Field struct {
+	// Name is the field name.
+	Name string
+
+	// Value is the field value.
+	Value string
+}
+
+// Entry is a single log entry to ingest into VictoriaLogs.
+type Entry struct {
+	// Time is the log timestamp. The current time at VictoriaLogs side is used if it is zero.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/keyconcepts/#time-field
+	Time time.Time
+
+	// Fields contains log fields including the log message at the _msg field.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/keyconcepts/#message-field
+	Fields []Field
+}
+
+// IngestOptions contains optional settings for the ingested logs.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#http-parameters
+type IngestOptions struct {
+	// MsgFields contains the names of fields with log message. The first non-empty field is used as _msg.
+	MsgFields []string
+
+	// StreamFields contains the names of log stream fields.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/keyconcepts/#stream-fields
+	StreamFields []string
+
+	// IgnoreFields contains the names of fields to drop during ingestion.
+	IgnoreFields []string
+
+	// ExtraFields contains fields to add to every ingested log entry.
+	ExtraFields []Field
+}
+
+func (o *IngestOptions) asURLValues() url.Values {
+	args := make(url.Values)
+	if o == nil {
+		return args
+	}
+	if len(o.MsgFields) > 0 {
+		args.Set("_msg_field", strings.Join(o.MsgFields, ","))
+	}
+	if len(o.StreamFields) > 0 {
+		args.Set("_stream_fields", strings.Join(o.StreamFields, ","))
+	}
+	if len(o.IgnoreFields) > 0 {
+		args.Set("ignore_fields", strings.Join(o.IgnoreFields, ","))
+	}
+	if len(o.ExtraFields) > 0 {
+		a := make([]string, len(o.ExtraFields))
+		for i, f := range o.ExtraFields {
+			a[i] = f.Name + "=" + f.Value
+		}
+		args.Set("extra_fields", strings.Join(a, ","))
+	}
+	return args
+}
+
+// Ingest ingests entries into VictoriaLogs with the given optional opts.
+//
+// The entries are sent in a single gzip-compressed request to /insert/jsonline. The request is retried on temporary errors
+// according to the client config. Use NewBatchWriter for sending big number of entries in batches.
+func (c *Client) Ingest(ctx context.Context, entries []Entry, opts *IngestOptions) error {
+	var buf []byte
+	for i := range entries {
+		buf = marshalEntry(buf, &entries[i])
+	}
+	data, err := compressGzip(buf)
+	if err != nil {
+		return err
+	}
+	return c.ingestCompressed(ctx, data, opts)
+}
+
+func (c *Client) ingestCompressed(ctx context.Context, data []byte, opts *IngestOptions) error {
+	args := opts.asURLValues()
+	return c.doWithRetries(ctx, func() error {
+		req, err := c.newRequest(ctx, http.MethodPost, c.insertURL, "/insert/jsonline", args, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/stream+json")
+		req.Header.Set("Content-Encoding", "gzip")
+
+		resp, err := c.doRequest(req)
+		if err != nil {
+			return fmt.Errorf("cannot ingest logs: %w", err)
+		}
+		_ = resp.Body.Close()
+		return nil
+	})
+}
+
+// marshalEntry appends JSON representation of e to dst and returns the result.
+func marshalEntry(dst []byte, e *Entry) []byte {
+	dst = append(dst, '{')
+	needComma := false
+	if !e.Time.IsZero() {
+		dst = append(dst, `"_time":"`...)
+		dst = e.Time.UTC().AppendFormat(dst, time.RFC3339Nano)
+		dst = append(dst, '"')
+		needComma = true
+	}
+	for _, f := range e.Fields {
+		if needComma {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, f.Name)
+		dst = append(dst, ':')
+		dst = appendJSONString(dst, f.Value)
+		needComma = true
+	}
+	dst = append(dst, '}', '\n')
+	return dst
+}
+
+func appendJSONString(dst []byte, s string) []byte {
+	// json.Marshal never returns error for strings.
+	b, _ := json.Marshal(s)
+	return append(dst, b...)
+}
+
+func compressGzip(data []byte) ([]byte, error) {
+	var bb bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&bb, gzip.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("cannot compress data: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot compress data: %w", err)
+	}
+	return bb.Bytes(), nil
+}
+
+const (
+	// DefaultMaxBatchSize is the default maximum size of uncompressed data per batch sent by BatchWriter.
+	DefaultMaxBatchSize = 4 * 1024 * 1024
+
+	// DefaultFlushInterval is the default interval for sending the buffered data by BatchWriter.
+	DefaultFlushInterval = time.Second
+)
+
+// BatchConfig is the configuration for BatchWriter.
+type BatchConfig struct {
+	// MaxBatchSize is the maximum size of uncompressed data per batch. DefaultMaxBatchSize is used if it is set to 0.
+	MaxBatchSize int
+
+	// FlushInterval is the interval for sending the buffered data. DefaultFlushInterval is used if it is set to 0.
+	FlushInterval time.Duration
+}
+
+// BatchWriter buffers log entries and sends them to VictoriaLogs in gzip-compressed batches.
+//
+// The buffered entries are sent when their size exceeds BatchConfig.MaxBatchSize, every BatchConfig.FlushInterval and on Flush or Close calls.
+// Failed batches are retried according to the client config.
+//
+// It is safe calling BatchWriter methods from concurrently running goroutines.
+type BatchWriter struct {
+	c    *Client
+	opts *IngestOptions
+
+	maxBatchSize int
+
+	// sendLock serializes sending the batches, so they are ingested in the order they were added.
+	sendLock sync.Mutex
+
+	mu  sync.Mutex
+	buf []byte
+
+	// err is the error occurred during the background flush. It is returned on the next call to Add, Flush or Close.
+	err error
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewBatchWriter returns new BatchWriter for ingesting logs with the given optional opts and cfg.
+//
+// Close must be called when the returned BatchWriter is no longer needed.
+func (c *Client) NewBatchWriter(opts *IngestOptions, cfg *BatchConfig) *BatchWriter {
+	maxBatchSize := DefaultMaxBatchSize
+	flushInterval := DefaultFlushInterval
+	if cfg != nil {
+		if cfg.MaxBatchSize > 0 {
+			maxBatchSize = cfg.MaxBatchSize
+		}
+		if cfg.FlushInterval > 0 {
+			flushInterval = cfg.FlushInterval
+		}
+	}
+
+	bw := &BatchWriter{
+		c:            c,
+		opts:         opts,
+		maxBatchSize: maxBatchSize,
+		stopCh:       make(chan struct{}),
+	}
+	bw.wg.Add(1)
+	go func() {
+		defer bw.wg.Done()
+		bw.runFlusher(flushInterval)
+	}()
+	return bw
+}
+
+func (bw *BatchWriter) runFlusher(flushInterval time.Duration) {
+	t := time.NewTicker(flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-bw.stopCh:
+			return
+		case <-t.C:
+			if err := bw.flush(context.Background()); err != nil {
+				bw.mu.Lock()
+				if bw.err == nil {
+					bw.err = err
+				}
+				bw.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Add adds e to bw.
+//
+// It sends the buffered entries to VictoriaLogs if their size exceeds BatchConfig.MaxBatchSize.
+func (bw *BatchWriter) Add(ctx context.Context, e Entry) error {
+	bw.mu.Lock()
+	if err := bw.err; err != nil {
+		bw.err = nil
+		bw.mu.Unlock()
+		return err
+	}
+	bw.buf = marshalEntry(bw.buf, &e)
+	needFlush := len(bw.buf) >= bw.maxBatchSize
+	bw.mu.Unlock()
+
+	if needFlush {
+		return bw.flush(ctx)
+	}
+	return nil
+}
+
+// Flush sends all the buffered entries to VictoriaLogs.
+func (bw *BatchWriter) Flush(ctx context.Context) error {
+	bw.mu.Lock()
+	err := bw.err
+	bw.err = nil
+	bw.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return bw.flush(ctx)
+}
+
+// Close stops bw and sends the remaining buffered entries to VictoriaLogs.
+func (bw *BatchWriter) Close(ctx context.Context) error {
+	close(bw.stopCh)
+	bw.wg.Wait()
+	return bw.Flush(ctx)
+}
+
+func (bw *BatchWriter) flush(ctx context.Context) error {
+	bw.sendLock.Lock()
+	defer bw.sendLock.Unlock()
+
+	bw.mu.Lock()
+	buf := bw.buf
+	bw.buf = nil
+	bw.mu.Unlock()
+
+	if len(buf) == 0 {
+		return nil
+	}
+	data, err := compressGzip(buf)
+	if err != nil {
+		return err
+	}
+	return bw.c.ingestCompressed(ctx, data, bw.opts)
+}
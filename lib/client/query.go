@@ -0,0 +1,294 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// QueryOptions contains optional settings for Query.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-logs
+type QueryOptions struct {
+	// Start is the start of the time range to query. The time range isn't limited from the left if it is zero.
+	Start time.Time
+
+	// End is the end of the time range to query. The time range isn't limited from the right if it is zero.
+	End time.Time
+
+	// Limit is the maximum number of rows to return. The number of rows isn't limited if it is zero.
+	Limit int
+
+	// Timeout is the query timeout at VictoriaLogs side. The default timeout is used if it is zero.
+	Timeout time.Duration
+
+	// ExtraFilters contains additional LogsQL filters to apply to the query.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/querying/#extra-filters
+	ExtraFilters []string
+
+	// AnnotateRows instructs VictoriaLogs to add _debug_* fields with the storage node, partition and part to every returned row.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/querying/#row-annotations
+	AnnotateRows bool
+
+	// IncludeHiddenStreams instructs VictoriaLogs to return logs for streams hidden via /select/logsql/hide_stream.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/querying/#hidden-streams
+	IncludeHiddenStreams bool
+}
+
+func (o *QueryOptions) asURLValues(query string) url.Values {
+	args := make(url.Values)
+	args.Set("query", query)
+	if o == nil {
+		return args
+	}
+	if !o.Start.IsZero() {
+		args.Set("start", o.Start.UTC().Format(time.RFC3339Nano))
+	}
+	if !o.End.IsZero() {
+		args.Set("end", o.End.UTC().Format(time.RFC3339Nano))
+	}
+	if o.Limit > 0 {
+		args.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Timeout > 0 {
+		args.Set("timeout", o.Timeout.String())
+	}
+	for _, f := range o.ExtraFilters {
+		args.Add("extra_filters", f)
+	}
+	if o.AnnotateRows {
+		args.Set("annotate_rows", "1")
+	}
+	if o.IncludeHiddenStreams {
+		args.Set("include_hidden_streams", "1")
+	}
+	return args
+}
+
+// TailOptions contains optional settings for Tail.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#live-tailing
+type TailOptions struct {
+	// StartOffset is the duration for returning historical logs ingested before the start of live tailing.
+	StartOffset time.Duration
+
+	// Offset is the delay for returning the ingested logs. The default delay is used if it is zero.
+	Offset time.Duration
+
+	// RefreshInterval is the interval for checking for new logs. The default interval is used if it is zero.
+	RefreshInterval time.Duration
+
+	// ExtraFilters contains additional LogsQL filters to apply to the query.
+	//
+	// See https://docs.victoriametrics.com/victorialogs/querying/#extra-filters
+	ExtraFilters []string
+}
+
+func (o *TailOptions) asURLValues(query string) url.Values {
+	args := make(url.Values)
+	args.Set("query", query)
+	if o == nil {
+		return args
+	}
+	if o.StartOffset > 0 {
+		args.Set("start_offset", o.StartOffset.String())
+	}
+	if o.Offset > 0 {
+		args.Set("offset", o.Offset.String())
+	}
+	if o.RefreshInterval > 0 {
+		args.Set("refresh_interval", o.RefreshInterval.String())
+	}
+	for _, f := range o.ExtraFilters {
+		args.Add("extra_filters", f)
+	}
+	return args
+}
+
+// Query executes the given LogsQL query with the given optional opts and returns the matching rows.
+//
+// The rows are streamed from VictoriaLogs while they are read via Rows.Next, so the query may return arbitrary number of rows
+// without buffering them in memory. Rows.Close must be called when the returned rows are no longer needed.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/
+func (c *Client) Query(ctx context.Context, query string, opts *QueryOptions) (*Rows, error) {
+	return c.queryRows(ctx, "/select/logsql/query", opts.asURLValues(query))
+}
+
+// Tail returns rows for the given LogsQL query, which are ingested into VictoriaLogs after the call, with the given optional opts.
+//
+// Rows.Next blocks until new rows arrive. It returns false when ctx is canceled or Rows.Close is called.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#live-tailing
+func (c *Client) Tail(ctx context.Context, query string, opts *TailOptions) (*Rows, error) {
+	return c.queryRows(ctx, "/select/logsql/tail", opts.asURLValues(query))
+}
+
+func (c *Client) queryRows(ctx context.Context, path string, args url.Values) (*Rows, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, c.selectURL, path, nil, bytes.NewBufferString(args.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute query at %s: %w", path, err)
+	}
+	rs := &Rows{
+		body: resp.Body,
+		br:   bufio.NewReaderSize(resp.Body, 64*1024),
+	}
+	return rs, nil
+}
+
+// Row is a single row returned by Query or Tail.
+type Row []Field
+
+// Get returns the value for the field with the given name.
+//
+// An empty string is returned if the field is missing.
+func (r Row) Get(name string) string {
+	for _, f := range r {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Time returns the value of the _time field.
+//
+// See https://docs.victoriametrics.com/victorialogs/keyconcepts/#time-field
+func (r Row) Time() (time.Time, error) {
+	s := r.Get("_time")
+	if s == "" {
+		return time.Time{}, fmt.Errorf("missing _time field")
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// Rows is an iterator over rows returned by Query or Tail.
+//
+// Rows cannot be used from concurrently running goroutines.
+type Rows struct {
+	body io.ReadCloser
+	br   *bufio.Reader
+
+	line []byte
+	row  Row
+	err  error
+}
+
+// Next reads the next row. The row can be obtained via Row call.
+//
+// false is returned if there are no more rows or if an error occurs. Err must be called in this case.
+func (rs *Rows) Next() bool {
+	if rs.err != nil {
+		return false
+	}
+	for {
+		line, err := rs.readLine()
+		if err != nil {
+			rs.err = err
+			return false
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		row, err := parseRow(rs.row[:0], line)
+		if err != nil {
+			rs.err = err
+			return false
+		}
+		rs.row = row
+		return true
+	}
+}
+
+func (rs *Rows) readLine() ([]byte, error) {
+	rs.line = rs.line[:0]
+	for {
+		b, err := rs.br.ReadSlice('\n')
+		rs.line = append(rs.line, b...)
+		if err == nil {
+			return rs.line, nil
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(rs.line) > 0 {
+			return rs.line, nil
+		}
+		return nil, err
+	}
+}
+
+// Row returns the row read by the last Next call.
+//
+// The returned row is valid until the next call to Next.
+func (rs *Rows) Row() Row {
+	return rs.row
+}
+
+// Err returns the error occurred while reading rows.
+//
+// nil is returned if all the rows have been successfully read.
+func (rs *Rows) Err() error {
+	if rs.err == io.EOF {
+		return nil
+	}
+	return rs.err
+}
+
+// Close closes rs.
+func (rs *Rows) Close() error {
+	if rs.err == nil {
+		rs.err = io.EOF
+	}
+	return rs.body.Close()
+}
+
+// parseRow appends fields from the JSON object at line to dst and returns the result.
+//
+// The order of fields is preserved.
+func parseRow(dst Row, line []byte) (Row, error) {
+	d := json.NewDecoder(bytes.NewReader(line))
+	t, err := d.Token()
+	if err != nil {
+		return dst, fmt.Errorf("cannot parse row %q: %w", line, err)
+	}
+	if t != json.Delim('{') {
+		return dst, fmt.Errorf("cannot parse row %q: expecting JSON object", line)
+	}
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return dst, fmt.Errorf("cannot parse field name in row %q: %w", line, err)
+		}
+		name, ok := t.(string)
+		if !ok {
+			return dst, fmt.Errorf("cannot parse row %q: unexpected field name %v", line, t)
+		}
+		var value string
+		if err := d.Decode(&value); err != nil {
+			return dst, fmt.Errorf("cannot parse value for field %q in row %q: %w", name, line, err)
+		}
+		dst = append(dst, Field{
+			Name:  name,
+			Value: value,
+		})
+	}
+	return dst, nil
+}
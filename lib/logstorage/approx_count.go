@@ -0,0 +1,327 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// ApproxCount contains an estimated number of logs matching the query.
+//
+// See Storage.GetApproxCount for details.
+type ApproxCount struct {
+	// Count is the estimated number of matching logs.
+	Count uint64
+
+	// LowerBound is the number of logs, which are guaranteed to match the query.
+	LowerBound uint64
+
+	// UpperBound is the maximum number of logs, which may match the query.
+	UpperBound uint64
+}
+
+// Marshal appends marshaled ac to dst and returns the result.
+func (ac *ApproxCount) Marshal(dst []byte) []byte {
+	dst = encoding.MarshalUint64(dst, ac.Count)
+	dst = encoding.MarshalUint64(dst, ac.LowerBound)
+	dst = encoding.MarshalUint64(dst, ac.UpperBound)
+	return dst
+}
+
+// Unmarshal unmarshals ac from src and returns the remaining tail.
+func (ac *ApproxCount) Unmarshal(src []byte) ([]byte, error) {
+	if len(src) < 24 {
+		return src, fmt.Errorf("cannot unmarshal ApproxCount from %d bytes; need at least 24 bytes", len(src))
+	}
+	ac.Count = encoding.UnmarshalUint64(src)
+	ac.LowerBound = encoding.UnmarshalUint64(src[8:])
+	ac.UpperBound = encoding.UnmarshalUint64(src[16:])
+	return src[24:], nil
+}
+
+// Add adds a to ac.
+//
+// It is used for merging approximate counts obtained from multiple storage nodes.
+func (ac *ApproxCount) Add(a *ApproxCount) {
+	ac.Count += a.Count
+	ac.LowerBound += a.LowerBound
+	ac.UpperBound += a.UpperBound
+}
+
+// GetApproxCountResultName returns the result name for the count() function if q can be answered by Storage.GetApproxCount.
+//
+// false is returned if q cannot be answered by Storage.GetApproxCount.
+// This is the case when q contains pipes other than a single `count()` pipe without grouping
+// or when it contains filters other than time filter, stream filter, word filter, phrase filter and exact filter.
+func (q *Query) GetApproxCountResultName() (string, bool) {
+	if len(q.pipes) != 1 {
+		return "", false
+	}
+	ps, ok := q.pipes[0].(*pipeStats)
+	if !ok || len(ps.byFields) > 0 || len(ps.funcs) != 1 {
+		return "", false
+	}
+	psf := &ps.funcs[0]
+	sc, ok := psf.f.(*statsCount)
+	if !ok || psf.iff != nil || len(sc.fieldFilters) > 0 && !slices.Equal(sc.fieldFilters, []string{"*"}) {
+		return "", false
+	}
+
+	_, f := getCommonStreamFilter(q.f)
+	if _, ok := getApproxCountFilters(f); !ok {
+		return "", false
+	}
+	return psf.resultName, true
+}
+
+// getApproxCountFilters returns filters from f, which must be checked per every block for approximate count.
+//
+// false is returned if f contains filters, which cannot be checked without reading column values.
+func getApproxCountFilters(f filter) ([]filter, bool) {
+	var filters []filter
+	if fa, ok := f.(*filterAnd); ok {
+		filters = fa.filters
+	} else {
+		filters = []filter{f}
+	}
+
+	var result []filter
+	for _, f := range filters {
+		switch f.(type) {
+		case *filterNoop, *filterTime:
+			// The time range is checked separately.
+		case *filterPhrase, *filterExact:
+			result = append(result, f)
+		default:
+			return nil, false
+		}
+	}
+	return result, true
+}
+
+// GetApproxCount returns an estimated number of logs matching qctx.
+//
+// The qctx.Query must be accepted by Query.GetApproxCountResultName.
+//
+// The estimation is performed only by block headers, column headers and bloom filters, so it doesn't read the stored column values.
+// This allows obtaining the estimation much faster than the exact number of matching logs.
+func (s *Storage) GetApproxCount(qctx *QueryContext) (*ApproxCount, error) {
+	q := qctx.Query
+	if _, ok := q.GetApproxCountResultName(); !ok {
+		return nil, fmt.Errorf("the query [%s] cannot be used for approximate count; it must contain only time filter, stream filter, "+
+			"word filter, phrase filter and exact filter followed by `count()` pipe", q)
+	}
+
+	sf, f := getCommonStreamFilter(q.f)
+	filters, _ := getApproxCountFilters(f)
+	minTimestamp, maxTimestamp := q.GetFilterTimeRange()
+
+	var hiddenFieldsFilter *prefixfilter.Filter
+	if len(qctx.HiddenFieldsFilters) > 0 {
+		var hff prefixfilter.Filter
+		hff.AddAllowFilters(qctx.HiddenFieldsFilters)
+		hiddenFieldsFilter = &hff
+	}
+	pso := &partitionSearchOptions{
+		tenantIDs:          qctx.TenantIDs,
+		minTimestamp:       minTimestamp,
+		maxTimestamp:       maxTimestamp,
+		filter:             f,
+		hiddenFieldsFilter: hiddenFieldsFilter,
+	}
+
+	ptws, ptwsDecRef := s.getPartitionsForTimeRange(minTimestamp, maxTimestamp)
+	defer ptwsDecRef()
+
+	stopCh := qctx.Context.Done()
+	var ac ApproxCount
+	for _, ptw := range ptws {
+		pt := ptw.pt
+
+		var sids map[streamID]struct{}
+		if sf != nil {
+			streamIDs := pt.idb.searchStreamIDs(qctx.TenantIDs, sf)
+			if len(streamIDs) == 0 {
+				continue
+			}
+			sids = make(map[streamID]struct{}, len(streamIDs))
+			for _, sid := range streamIDs {
+				sids[sid] = struct{}{}
+			}
+		}
+
+		pt.ddb.forEachPartInTimeRange(minTimestamp, maxTimestamp, func(p *part) bool {
+			if needStop(stopCh) {
+				return false
+			}
+			p.updateApproxCount(&ac, pso, sids, filters, qctx.QueryStats)
+			return true
+		})
+	}
+
+	if err := qctx.Context.Err(); err != nil {
+		return nil, err
+	}
+	return &ac, nil
+}
+
+// updateApproxCount updates ac with the estimated number of logs in p matching pso, sids and filters.
+func (p *part) updateApproxCount(ac *ApproxCount, pso *partitionSearchOptions, sids map[streamID]struct{}, filters []filter, qs *QueryStats) {
+	ibhIdxs := p.getIndexBlockIdxsForFilter(pso.filter, qs)
+	if ibhIdxs != nil && len(ibhIdxs) == 0 {
+		// Fast path - the field index guarantees that the part has no matching logs.
+		return
+	}
+
+	bs := getBlockSearch()
+	defer putBlockSearch(bs)
+
+	bhss := getBlockHeaders()
+	defer putBlockHeaders(bhss)
+
+	var bsw blockSearchWork
+	for i := range p.indexBlockHeaders {
+		ibh := &p.indexBlockHeaders[i]
+		if !pso.matchTimeRange(ibh.minTimestamp, ibh.maxTimestamp) {
+			continue
+		}
+		if ibhIdxs != nil {
+			if _, ok := ibhIdxs[uint32(i)]; !ok {
+				continue
+			}
+		}
+
+		bhss.bhs = ibh.mustReadBlockHeaders(bhss.bhs[:0], p, qs)
+		for j := range bhss.bhs {
+			bh := &bhss.bhs[j]
+			if sids != nil {
+				if _, ok := sids[bh.streamID]; !ok {
+					continue
+				}
+			} else if !slices.Contains(pso.tenantIDs, bh.streamID.tenantID) {
+				continue
+			}
+			th := &bh.timestampsHeader
+			if !pso.matchTimeRange(th.minTimestamp, th.maxTimestamp) {
+				continue
+			}
+
+			bsw.p = p
+			bsw.pso = pso
+			bsw.bh.copyFrom(bh)
+
+			bs.reset()
+			bs.qs = qs
+			bs.bsw = &bsw
+			m := getApproxBlockMatch(bs, filters)
+			if m == approxBlockMatchNone {
+				continue
+			}
+
+			rowsCount := bh.rowsCount
+			estimatedRows := rowsCount
+			if th.minTimestamp < pso.minTimestamp || th.maxTimestamp > pso.maxTimestamp {
+				// The block is partially covered by the selected time range.
+				// Estimate the number of rows on the selected time range under the assumption they are evenly distributed over time.
+				minTs := max(th.minTimestamp, pso.minTimestamp)
+				maxTs := min(th.maxTimestamp, pso.maxTimestamp)
+				ratio := (float64(maxTs) - float64(minTs) + 1) / (float64(th.maxTimestamp) - float64(th.minTimestamp) + 1)
+				estimatedRows = uint64(math.Ceil(ratio * float64(rowsCount)))
+				m = approxBlockMatchSome
+			}
+
+			ac.Count += estimatedRows
+			ac.UpperBound += rowsCount
+			if m == approxBlockMatchAll {
+				ac.LowerBound += rowsCount
+			}
+			qs.BlocksProcessed++
+		}
+	}
+}
+
+type approxBlockMatch int
+
+const (
+	// approxBlockMatchNone means that the block doesn't contain matching logs.
+	approxBlockMatchNone approxBlockMatch = iota
+
+	// approxBlockMatchSome means that the block may contain matching logs.
+	approxBlockMatchSome
+
+	// approxBlockMatchAll means that all the logs in the block match.
+	approxBlockMatchAll
+)
+
+// getApproxBlockMatch checks whether the block at bs matches all the filters without reading column values.
+func getApproxBlockMatch(bs *blockSearch, filters []filter) approxBlockMatch {
+	result := approxBlockMatchAll
+	for _, f := range filters {
+		var m approxBlockMatch
+		switch t := f.(type) {
+		case *filterPhrase:
+			m = getApproxBlockMatchForValue(bs, t.fieldName, t.getTokensHashes(), func(v string) bool {
+				return matchPhrase(v, t.phrase)
+			})
+		case *filterExact:
+			m = getApproxBlockMatchForValue(bs, t.fieldName, t.getTokensHashes(), func(v string) bool {
+				return v == t.value
+			})
+		default:
+			m = approxBlockMatchSome
+		}
+		if m == approxBlockMatchNone {
+			return approxBlockMatchNone
+		}
+		result = min(result, m)
+	}
+	return result
+}
+
+func getApproxBlockMatchForValue(bs *blockSearch, fieldName string, tokens []uint64, matchValue func(v string) bool) approxBlockMatch {
+	v := bs.getConstColumnValue(fieldName)
+	if v != "" {
+		if matchValue(v) {
+			return approxBlockMatchAll
+		}
+		return approxBlockMatchNone
+	}
+
+	ch := bs.getColumnHeader(fieldName)
+	if ch == nil {
+		// All the logs in the block have empty value for the given field.
+		if matchValue("") {
+			return approxBlockMatchAll
+		}
+		return approxBlockMatchNone
+	}
+
+	switch ch.valueType {
+	case valueTypeString:
+		if !matchBloomFilterAllTokens(bs, ch, tokens) {
+			return approxBlockMatchNone
+		}
+		return approxBlockMatchSome
+	case valueTypeDict:
+		matches := 0
+		for _, v := range ch.valuesDict.values {
+			if matchValue(v) {
+				matches++
+			}
+		}
+		if matches == 0 {
+			return approxBlockMatchNone
+		}
+		if matches == len(ch.valuesDict.values) {
+			return approxBlockMatchAll
+		}
+		return approxBlockMatchSome
+	default:
+		// Numeric columns require decoding of values, so assume they may match.
+		return approxBlockMatchSome
+	}
+}
@@ -0,0 +1,179 @@
+package logstorage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestApproxCountMarshalUnmarshal(t *testing.T) {
+	ac := &ApproxCount{
+		Count:      123,
+		LowerBound: 100,
+		UpperBound: 200,
+	}
+
+	data := ac.Marshal(nil)
+
+	ac2 := &ApproxCount{}
+	tail, err := ac2.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal ApproxCount: %s", err)
+	}
+	if len(tail) > 0 {
+		t.Fatalf("unexpected non-empty tail left; len(tail)=%d", len(tail))
+	}
+	if !reflect.DeepEqual(ac, ac2) {
+		t.Fatalf("unexpected unmarshaled ApproxCount; got %#v; want %#v", ac2, ac)
+	}
+}
+
+func TestQueryGetApproxCountResultName(t *testing.T) {
+	f := func(qStr, resultNameExpected string, okExpected bool) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		resultName, ok := q.GetApproxCountResultName()
+		if ok != okExpected {
+			t.Fatalf("unexpected ok for query [%s]; got %v; want %v", qStr, ok, okExpected)
+		}
+		if resultName != resultNameExpected {
+			t.Fatalf("unexpected result name for query [%s]; got %q; want %q", qStr, resultName, resultNameExpected)
+		}
+	}
+
+	// supported queries
+	f("* | count()", "count(*)", true)
+	f("* | count() as hits", "hits", true)
+	f(`_time:1h {app="nginx"} error | stats count() rows`, "rows", true)
+	f(`"foo bar" level:=error | count(*) x`, "x", true)
+
+	// unsupported pipes
+	f("*", "", false)
+	f("* | stats by (host) count()", "", false)
+	f("* | count(host)", "", false)
+	f("* | count() if (error)", "", false)
+	f("* | count(), sum(x)", "", false)
+	f("* | count() | limit 1", "", false)
+
+	// unsupported filters
+	f("foo* | count()", "", false)
+	f("foo or bar | count()", "", false)
+	f("!foo | count()", "", false)
+	f("x:>10 | count()", "", false)
+}
+
+func TestStorageGetApproxCount(t *testing.T) {
+	t.Parallel()
+
+	const rowsCount = 1000
+	const hostsCount = 4
+
+	storagePath := t.Name()
+	cfg := &StorageConfig{
+		Retention: time.Duration(100 * 365 * nsecsPerDay),
+	}
+	s := MustOpenStorage(storagePath, cfg)
+
+	tenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+
+	baseTimestamp := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+	lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+	for i := 0; i < rowsCount; i++ {
+		msg := "some message"
+		if i%hostsCount == 1 && i%10 == 1 {
+			msg = "error occurred"
+		}
+		lr.MustAdd(tenantID, baseTimestamp+int64(i)*1e9, []Field{
+			{Name: "host", Value: fmt.Sprintf("h%d", i%hostsCount)},
+			{Name: "level", Value: "info"},
+			{Name: "_msg", Value: msg},
+		}, -1)
+	}
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	getApproxCount := func(qStr string) *ApproxCount {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tenantID}, q, false, nil)
+		ac, err := s.GetApproxCount(qctx)
+		if err != nil {
+			t.Fatalf("unexpected error for query [%s]: %s", qStr, err)
+		}
+		return ac
+	}
+
+	// f verifies that the approximate count for qStr is exact.
+	f := func(qStr string, countExpected uint64) {
+		t.Helper()
+
+		ac := getApproxCount(qStr)
+		acExpected := &ApproxCount{
+			Count:      countExpected,
+			LowerBound: countExpected,
+			UpperBound: countExpected,
+		}
+		if !reflect.DeepEqual(ac, acExpected) {
+			t.Fatalf("unexpected approximate count for query [%s]; got %#v; want %#v", qStr, ac, acExpected)
+		}
+	}
+
+	// fBounds verifies that the approximate count for qStr contains the exact count within the returned bounds.
+	fBounds := func(qStr string, countExpected uint64) {
+		t.Helper()
+
+		ac := getApproxCount(qStr)
+		if ac.LowerBound > countExpected || ac.UpperBound < countExpected {
+			t.Fatalf("unexpected bounds for query [%s]; got [%d ... %d]; want them to contain %d", qStr, ac.LowerBound, ac.UpperBound, countExpected)
+		}
+		if ac.Count < ac.LowerBound || ac.Count > ac.UpperBound {
+			t.Fatalf("unexpected count for query [%s]; got %d; want it to be in the range [%d ... %d]", qStr, ac.Count, ac.LowerBound, ac.UpperBound)
+		}
+	}
+
+	// block header row counts and const columns give exact results
+	f("* | count()", rowsCount)
+	f(`{host="h1"} | count()`, rowsCount/hostsCount)
+	f(`{host=~"h1|h2"} | count()`, 2*rowsCount/hostsCount)
+	f(`level:=info | count()`, rowsCount)
+	f(`level:=error | count()`, 0)
+	f(`{host="missing"} | count()`, 0)
+	f(`missing_field:=foo | count()`, 0)
+
+	// bloom filters exclude blocks without matching words
+	f(`{host="h0"} error | count()`, 0)
+	fBounds(`{host="h1"} error | count()`, rowsCount/hostsCount/5)
+	fBounds(`"error occurred" | count()`, rowsCount/hostsCount/5)
+
+	// partially covered blocks
+	fBounds(`_time:[2025-01-02T00:01:00Z, 2025-01-02T00:02:00Z) | count()`, 60)
+	fBounds(`{host="h2"} _time:[2025-01-02T00:01:00Z, 2025-01-02T00:02:00Z) | count()`, 15)
+
+	// unsupported query
+	q, err := ParseQuery("foo* | count()")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tenantID}, q, false, nil)
+	if _, err := s.GetApproxCount(qctx); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported query")
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(storagePath)
+}
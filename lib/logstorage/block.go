@@ -159,6 +159,17 @@ func (c *column) mustWriteTo(ch *columnHeader, sw *streamWriters) {
 	if ch.valueType != valueTypeDict {
 		hashesBuf := encoding.GetUint64s(0)
 		hashesBuf.A = tokenizeHashes(hashesBuf.A[:0], c.values)
+		if ch.valueType == valueTypeString && ch.name == "" && sw.tokenPositionsMaxDistance > 0 {
+			// Add pairs of nearby tokens to the bloom filter for the _msg field, so phrase and near() filters could skip blocks without the needed pairs.
+			tokensLen := len(hashesBuf.A)
+			hashesBuf.A = tokenizeTokenPairsHashes(hashesBuf.A, c.values, sw.tokenPositionsMaxDistance)
+			if len(hashesBuf.A) > maxBloomFilterItems {
+				// Too many token pairs for a single bloom filter. Store only tokens for this block.
+				hashesBuf.A = hashesBuf.A[:tokensLen]
+			} else {
+				ch.tokenPositionsMaxDistance = sw.tokenPositionsMaxDistance
+			}
+		}
 		bb.B = bloomFilterMarshalHashes(bb.B[:0], hashesBuf.A)
 		encoding.PutUint64s(hashesBuf)
 	} else {
@@ -286,6 +286,9 @@ type columnData struct {
 
 	// bloomFilterData contains packed bloomFilter data for the given column
 	bloomFilterData []byte
+
+	// tokenPositionsMaxDistance is the maximum distance between tokens, which pairs are stored in bloomFilterData
+	tokenPositionsMaxDistance int
 }
 
 // reset rests cd for subsequent reuse
@@ -299,6 +302,7 @@ func (cd *columnData) reset() {
 
 	cd.valuesData = nil
 	cd.bloomFilterData = nil
+	cd.tokenPositionsMaxDistance = 0
 }
 
 // copyFrom copies src to cd.
@@ -316,6 +320,7 @@ func (cd *columnData) copyFrom(a *arena, src *columnData) {
 
 	cd.valuesData = a.copyBytes(src.valuesData)
 	cd.bloomFilterData = a.copyBytes(src.bloomFilterData)
+	cd.tokenPositionsMaxDistance = src.tokenPositionsMaxDistance
 }
 
 // mustWriteTo writes cd to sw and updates ch accordingly.
@@ -330,6 +335,7 @@ func (cd *columnData) mustWriteTo(ch *columnHeader, sw *streamWriters) {
 	ch.minValue = cd.minValue
 	ch.maxValue = cd.maxValue
 	ch.valuesDict.copyFromNoArena(&cd.valuesDict)
+	ch.tokenPositionsMaxDistance = cd.tokenPositionsMaxDistance
 
 	bloomValuesWriter := sw.getBloomValuesWriterForColumnName(ch.name)
 
@@ -362,6 +368,7 @@ func (cd *columnData) mustReadFrom(a *arena, ch *columnHeader, sr *streamReaders
 	cd.minValue = ch.minValue
 	cd.maxValue = ch.maxValue
 	cd.valuesDict.copyFrom(a, &ch.valuesDict)
+	cd.tokenPositionsMaxDistance = ch.tokenPositionsMaxDistance
 
 	bloomValuesReader := sr.getBloomValuesReaderForColumnName(ch.name)
 
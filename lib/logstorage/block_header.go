@@ -590,11 +590,15 @@ type columnHeader struct {
 
 	// minValue is the minimum encoded value for uint*, ipv4, timestamp and float64 value in the columnHeader
 	//
+	// For valueTypeString it contains the minimum numeric value seen in the strings. See getNumericRange.
+	//
 	// It is used for fast detection of whether the given columnHeader contains values in the given range
 	minValue uint64
 
 	// maxValue is the maximum encoded value for uint*, ipv4, timestamp and float64 value in the columnHeader
 	//
+	// For valueTypeString it contains the maximum numeric value seen in the strings. See getNumericRange.
+	//
 	// It is used for fast detection of whether the given columnHeader contains values in the given range
 	maxValue uint64
 
@@ -612,6 +616,11 @@ type columnHeader struct {
 
 	// bloomFilterSize contains the size of the bloom filter in messageBloomFilename, smallBloomFilename or bigBloomFilename
 	bloomFilterSize uint64
+
+	// tokenPositionsMaxDistance is the maximum distance between tokens, which pairs are stored in the bloom filter for valueTypeString.
+	//
+	// Zero value means the bloom filter contains only tokens. See tokenizeTokenPairsHashes.
+	tokenPositionsMaxDistance int
 }
 
 // reset resets ch
@@ -628,12 +637,16 @@ func (ch *columnHeader) reset() {
 
 	ch.bloomFilterOffset = 0
 	ch.bloomFilterSize = 0
+
+	ch.tokenPositionsMaxDistance = 0
 }
 
 // marshal appends marshaled ch to dst and returns the result.
 func (ch *columnHeader) marshal(dst []byte) []byte {
 	// check minValue/maxValue
 	switch ch.valueType {
+	case valueTypeString:
+		// minValue may exceed maxValue if the strings have no numeric values. See getNumericRange.
 	case valueTypeInt64:
 		minValue := int64(ch.minValue)
 		maxValue := int64(ch.maxValue)
@@ -666,6 +679,10 @@ func (ch *columnHeader) marshal(dst []byte) []byte {
 	// Encode other fields depending on ch.valueType
 	switch ch.valueType {
 	case valueTypeString:
+		// numeric range is encoded as uint64 via math.Float64bits()
+		dst = encoding.MarshalUint64(dst, ch.minValue)
+		dst = encoding.MarshalUint64(dst, ch.maxValue)
+		dst = append(dst, byte(ch.tokenPositionsMaxDistance))
 		dst = ch.marshalValuesAndBloomFilters(dst)
 	case valueTypeDict:
 		dst = ch.valuesDict.marshal(dst)
@@ -757,6 +774,29 @@ func (ch *columnHeader) unmarshalInplace(src []byte, partFormatVersion uint) ([]
 	// Unmarshal the rest of data depending on valueType
 	switch ch.valueType {
 	case valueTypeString:
+		if partFormatVersion >= 4 {
+			if len(src) < 16 {
+				return srcOrig, fmt.Errorf("cannot unmarshal numeric range at valueTypeString from %d bytes for column %q; need at least 16 bytes", len(src), ch.name)
+			}
+			ch.minValue = encoding.UnmarshalUint64(src)
+			ch.maxValue = encoding.UnmarshalUint64(src[8:])
+			src = src[16:]
+		} else {
+			ch.minValue, ch.maxValue = getUnknownNumericRange()
+		}
+
+		if partFormatVersion >= 5 {
+			if len(src) < 1 {
+				return srcOrig, fmt.Errorf("cannot unmarshal tokenPositionsMaxDistance at valueTypeString from 0 bytes for column %q; need at least 1 byte", ch.name)
+			}
+			ch.tokenPositionsMaxDistance = int(src[0])
+			src = src[1:]
+			if ch.tokenPositionsMaxDistance > MaxTokenPositionsDistance {
+				return srcOrig, fmt.Errorf("too big tokenPositionsMaxDistance at valueTypeString for column %q: %d; mustn't exceed %d",
+					ch.name, ch.tokenPositionsMaxDistance, MaxTokenPositionsDistance)
+			}
+		}
+
 		tail, err := ch.unmarshalValuesAndBloomFilters(src)
 		if err != nil {
 			return srcOrig, fmt.Errorf("cannot unmarshal values and bloom filters at valueTypeString for column %q: %w", ch.name, err)
@@ -145,7 +145,7 @@ func TestColumnsHeaderMarshalUnmarshal(t *testing.T) {
 				Value: "bar",
 			},
 		},
-	}, 31)
+	}, 48)
 }
 
 func TestBlockHeaderUnmarshalFailure(t *testing.T) {
@@ -477,6 +477,92 @@ func TestColumnHeaderMarshalUnmarshal(t *testing.T) {
 	}
 	ch.valuesDict.getOrAdd("abc")
 	f(ch, 11)
+
+	minValue, maxValue := getNumericRange([]string{"", "1.5s", "200ms"})
+	f(&columnHeader{
+		name:      "duration",
+		valueType: valueTypeString,
+		minValue:  minValue,
+		maxValue:  maxValue,
+
+		valuesOffset:      123,
+		valuesSize:        456,
+		bloomFilterOffset: 789,
+		bloomFilterSize:   10,
+	}, 24)
+	f(&columnHeader{
+		name:      "",
+		valueType: valueTypeString,
+		minValue:  minValue,
+		maxValue:  maxValue,
+
+		valuesOffset:      123,
+		valuesSize:        456,
+		bloomFilterOffset: 789,
+		bloomFilterSize:   10,
+
+		tokenPositionsMaxDistance: 3,
+	}, 24)
+}
+
+func TestColumnHeaderUnmarshalStringPartFormatV3(t *testing.T) {
+	ch := &columnHeader{
+		valueType: valueTypeString,
+
+		valuesOffset:      123,
+		valuesSize:        456,
+		bloomFilterOffset: 789,
+		bloomFilterSize:   10,
+	}
+	data := ch.marshal(nil)
+
+	// Drop the numeric range and tokenPositionsMaxDistance, since they are missing in part format v3
+	data = append(data[:1], data[18:]...)
+
+	var ch2 columnHeader
+	tail, err := ch2.unmarshalInplace(data, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tail) > 0 {
+		t.Fatalf("unexpected non-empty tail after unmarshal: %X", tail)
+	}
+
+	// The numeric range must cover all the numbers, since it is unknown for part format v3
+	ch.minValue, ch.maxValue = getUnknownNumericRange()
+	if !reflect.DeepEqual(ch, &ch2) {
+		t.Fatalf("unexpected columnHeader after unmarshal;\ngot\n%v\nwant\n%v", &ch2, ch)
+	}
+}
+
+func TestColumnHeaderUnmarshalStringPartFormatV4(t *testing.T) {
+	minValue, maxValue := getNumericRange([]string{"", "1.5s", "200ms"})
+	ch := &columnHeader{
+		valueType: valueTypeString,
+		minValue:  minValue,
+		maxValue:  maxValue,
+
+		valuesOffset:      123,
+		valuesSize:        456,
+		bloomFilterOffset: 789,
+		bloomFilterSize:   10,
+	}
+	data := ch.marshal(nil)
+
+	// Drop tokenPositionsMaxDistance, since it is missing in part format v4
+	data = append(data[:17], data[18:]...)
+
+	var ch2 columnHeader
+	tail, err := ch2.unmarshalInplace(data, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(tail) > 0 {
+		t.Fatalf("unexpected non-empty tail after unmarshal: %X", tail)
+	}
+	if !reflect.DeepEqual(ch, &ch2) {
+		t.Fatalf("unexpected columnHeader after unmarshal;\ngot\n%v\nwant\n%v", &ch2, ch)
+	}
 }
 
 func TestColumnHeaderUnmarshalFailure(t *testing.T) {
@@ -2,6 +2,7 @@ package logstorage
 
 import (
 	"math"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,6 +17,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fastnum"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/stringsutil"
 
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
 )
@@ -650,6 +652,17 @@ func (br *blockResult) addStreamColumn() bool {
 	return true
 }
 
+// addDebugColumns adds _debug_partition and _debug_part columns with the names of the partition and the part p to br.
+func (br *blockResult) addDebugColumns(p *part) {
+	br.addConstColumn("_debug_partition", p.pt.name)
+
+	partName := "inmemory"
+	if p.path != "" {
+		partName = filepath.Base(p.path)
+	}
+	br.addConstColumn("_debug_part", partName)
+}
+
 func (br *blockResult) addConstColumn(name, value string) {
 	nameCopy := br.a.copyString(name)
 
@@ -890,6 +903,32 @@ func (br *blockResult) getBucketedStrings(valuesOrig []string, bf *byStatsField)
 	return values
 }
 
+// getLowercaseStrings returns lowercase values for valuesOrig.
+//
+// The returned values are valid until br.reset() is called.
+func (br *blockResult) getLowercaseStrings(valuesOrig []string) []string {
+	buf := br.a.b
+	valuesBuf := br.valuesBuf
+	valuesBufLen := len(valuesBuf)
+	valuesBuf = slicesutil.SetLength(valuesBuf, valuesBufLen+len(valuesOrig))
+	values := valuesBuf[valuesBufLen:]
+
+	var s string
+	for i := range values {
+		if i == 0 || valuesOrig[i-1] != valuesOrig[i] {
+			bufLen := len(buf)
+			buf = stringsutil.AppendLowercase(buf, valuesOrig[i])
+			s = bytesutil.ToUnsafeString(buf[bufLen:])
+		}
+		values[i] = s
+	}
+
+	br.a.b = buf
+	br.valuesBuf = valuesBuf
+
+	return values
+}
+
 func (br *blockResult) getBucketedDictValues(c *blockResultColumn, bf *byStatsField) []string {
 	dictValuesBucketed := br.getBucketedStrings(c.dictValues, bf)
 	if areConstValues(dictValuesBucketed) {
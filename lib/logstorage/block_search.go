@@ -329,7 +329,7 @@ func (bs *blockSearch) getColumnHeader(name string) *columnHeader {
 		b = b[cr.offset:]
 		bs.chsCache = slicesutil.SetLength(bs.chsCache, len(bs.chsCache)+1)
 		ch := &bs.chsCache[len(bs.chsCache)-1]
-		if _, err := ch.unmarshalInplace(b, partFormatLatestVersion); err != nil {
+		if _, err := ch.unmarshalInplace(b, bs.partFormatVersion()); err != nil {
 			logger.Panicf("FATAL: %s: cannot unmarshal header for column %q: %s", bs.bsw.p.path, name, err)
 		}
 		ch.name = bs.getColumnNameByID(columnNameID)
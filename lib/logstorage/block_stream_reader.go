@@ -259,6 +259,16 @@ type blockStreamReader struct {
 	// globalBlocksCount is the number of blocks seen in the part
 	globalBlocksCount uint64
 
+	// fieldIndexSizeBytes is the size of the field index files in the part.
+	//
+	// These files aren't read by bsr, since the field index is re-created when writing the read blocks.
+	fieldIndexSizeBytes uint64
+
+	// streamHitsSizeBytes is the size of the per-stream hits file in the part.
+	//
+	// This file isn't read by bsr, since per-stream hits are re-created when writing the read blocks.
+	streamHitsSizeBytes uint64
+
 	// sidLast is the stream id for the previously read block
 	sidLast streamID
 
@@ -294,6 +304,8 @@ func (bsr *blockStreamReader) reset() {
 	bsr.globalUncompressedSizeBytes = 0
 	bsr.globalRowsCount = 0
 	bsr.globalBlocksCount = 0
+	bsr.fieldIndexSizeBytes = 0
+	bsr.streamHitsSizeBytes = 0
 
 	bsr.sidLast.reset()
 	bsr.minTimestampLast = 0
@@ -332,6 +344,9 @@ func (bsr *blockStreamReader) MustInitFromInmemoryPart(mp *inmemoryPart) {
 
 	// Read metaindex data
 	bsr.indexBlockHeaders = mustReadIndexBlockHeaders(bsr.indexBlockHeaders[:0], &bsr.streamReaders.metaindexReader)
+
+	bsr.fieldIndexSizeBytes = uint64(mp.fieldIndex.Len() + mp.fieldIndexMetaindex.Len())
+	bsr.streamHitsSizeBytes = uint64(mp.streamHits.Len())
 }
 
 // MustInitFromFilePart initializes bsr from file part at the given path.
@@ -420,6 +435,14 @@ func (bsr *blockStreamReader) MustInitFromFilePart(path string) {
 
 	// Read metaindex data
 	bsr.indexBlockHeaders = mustReadIndexBlockHeaders(bsr.indexBlockHeaders[:0], &bsr.streamReaders.metaindexReader)
+
+	if bsr.ph.FormatVersion >= 6 {
+		bsr.fieldIndexSizeBytes = fs.MustFileSize(filepath.Join(path, fieldIndexFilename))
+		bsr.fieldIndexSizeBytes += fs.MustFileSize(filepath.Join(path, fieldIndexMetaindexFilename))
+	}
+	if bsr.ph.FormatVersion >= 7 {
+		bsr.streamHitsSizeBytes = fs.MustFileSize(filepath.Join(path, streamHitsFilename))
+	}
 }
 
 // NextBlock reads the next block from bsr and puts it into bsr.blockData.
@@ -482,7 +505,7 @@ func (bsr *blockStreamReader) nextIndexBlock() bool {
 	if bsr.nextIndexBlockIdx >= len(bsr.indexBlockHeaders) {
 		// No more blocks left
 		// Validate bsr.ph
-		totalBytesRead := bsr.streamReaders.totalBytesRead()
+		totalBytesRead := bsr.streamReaders.totalBytesRead() + bsr.fieldIndexSizeBytes + bsr.streamHitsSizeBytes
 		if bsr.ph.CompressedSizeBytes != totalBytesRead {
 			logger.Panicf("FATAL: %s: partHeader.CompressedSizeBytes=%d must match the size of data read: %d", bsr.Path(), bsr.ph.CompressedSizeBytes, totalBytesRead)
 		}
@@ -52,6 +52,11 @@ type streamWriters struct {
 	columnsHeaderWriter      writerWithStats
 	timestampsWriter         writerWithStats
 
+	fieldIndexWriter          writerWithStats
+	fieldIndexMetaindexWriter writerWithStats
+
+	streamHitsWriter writerWithStats
+
 	messageBloomValuesWriter bloomValuesWriter
 
 	bloomValuesShards       []bloomValuesWriter
@@ -63,6 +68,11 @@ type streamWriters struct {
 
 	columnIdxs    map[uint64]uint64
 	nextColumnIdx uint64
+
+	// tokenPositionsMaxDistance is the maximum distance between _msg tokens, which pairs must be stored in bloom filters.
+	//
+	// Zero value disables storing token pairs. See tokenizeTokenPairsHashes.
+	tokenPositionsMaxDistance int
 }
 
 type bloomValuesWriter struct {
@@ -104,6 +114,11 @@ func (sw *streamWriters) reset() {
 	sw.columnsHeaderWriter.reset()
 	sw.timestampsWriter.reset()
 
+	sw.fieldIndexWriter.reset()
+	sw.fieldIndexMetaindexWriter.reset()
+
+	sw.streamHitsWriter.reset()
+
 	sw.messageBloomValuesWriter.reset()
 	for i := range sw.bloomValuesShards {
 		sw.bloomValuesShards[i].reset()
@@ -116,11 +131,13 @@ func (sw *streamWriters) reset() {
 	sw.columnNameIDGenerator.reset()
 	sw.columnIdxs = nil
 	sw.nextColumnIdx = 0
+
+	sw.tokenPositionsMaxDistance = 0
 }
 
 func (sw *streamWriters) init(columnNamesWriter, columnIdxsWriter, metaindexWriter, indexWriter,
-	columnsHeaderIndexWriter, columnsHeaderWriter, timestampsWriter filestream.WriteCloser,
-	messageBloomValuesWriter bloomValuesStreamWriter, createBloomValuesWriter func(shardIdx uint64) bloomValuesStreamWriter, maxShards uint64,
+	columnsHeaderIndexWriter, columnsHeaderWriter, timestampsWriter, fieldIndexWriter, fieldIndexMetaindexWriter,
+	streamHitsWriter filestream.WriteCloser, messageBloomValuesWriter bloomValuesStreamWriter, createBloomValuesWriter func(shardIdx uint64) bloomValuesStreamWriter, maxShards uint64,
 ) {
 	sw.columnNamesWriter.init(columnNamesWriter)
 	sw.columnIdxsWriter.init(columnIdxsWriter)
@@ -130,6 +147,11 @@ func (sw *streamWriters) init(columnNamesWriter, columnIdxsWriter, metaindexWrit
 	sw.columnsHeaderWriter.init(columnsHeaderWriter)
 	sw.timestampsWriter.init(timestampsWriter)
 
+	sw.fieldIndexWriter.init(fieldIndexWriter)
+	sw.fieldIndexMetaindexWriter.init(fieldIndexMetaindexWriter)
+
+	sw.streamHitsWriter.init(streamHitsWriter)
+
 	sw.messageBloomValuesWriter.init(messageBloomValuesWriter)
 
 	sw.createBloomValuesWriter = createBloomValuesWriter
@@ -147,6 +169,11 @@ func (sw *streamWriters) totalBytesWritten() uint64 {
 	n += sw.columnsHeaderWriter.bytesWritten
 	n += sw.timestampsWriter.bytesWritten
 
+	n += sw.fieldIndexWriter.bytesWritten
+	n += sw.fieldIndexMetaindexWriter.bytesWritten
+
+	n += sw.streamHitsWriter.bytesWritten
+
 	n += sw.messageBloomValuesWriter.totalBytesWritten()
 	for i := range sw.bloomValuesShards {
 		n += sw.bloomValuesShards[i].totalBytesWritten()
@@ -166,6 +193,9 @@ func (sw *streamWriters) MustClose() {
 		&sw.columnsHeaderIndexWriter,
 		&sw.columnsHeaderWriter,
 		&sw.timestampsWriter,
+		&sw.fieldIndexWriter,
+		&sw.fieldIndexMetaindexWriter,
+		&sw.streamHitsWriter,
 	}
 
 	cs = sw.messageBloomValuesWriter.appendClosers(cs)
@@ -252,6 +282,15 @@ type blockStreamWriter struct {
 
 	// indexBlockHeader is used for marshaling the data to metaindexData
 	indexBlockHeader indexBlockHeader
+
+	// indexBlocksCount is the number of index blocks written so far
+	indexBlocksCount uint32
+
+	// fieldIndexBuilder builds the field index for the indexed fields. See setIndexedFields.
+	fieldIndexBuilder fieldIndexBuilder
+
+	// streamHitsBuilder builds per-stream per-minute hits for the written blocks. See setStreamHitsEnabled.
+	streamHitsBuilder streamHitsBuilder
 }
 
 // reset resets bsw for subsequent reuse.
@@ -279,6 +318,37 @@ func (bsw *blockStreamWriter) reset() {
 	}
 
 	bsw.indexBlockHeader.reset()
+	bsw.indexBlocksCount = 0
+
+	if len(bsw.fieldIndexBuilder.items) > 1024*1024 {
+		// The length of bsw.fieldIndexBuilder.items is unbound, so drop too long builder
+		// in order to conserve memory.
+		bsw.fieldIndexBuilder = fieldIndexBuilder{}
+	} else {
+		bsw.fieldIndexBuilder.reset()
+	}
+	bsw.streamHitsBuilder.reset()
+}
+
+// setTokenPositionsMaxDistance enables storing pairs of _msg tokens located at distance up to maxDistance in bloom filters.
+//
+// It must be called after bsw initialization.
+func (bsw *blockStreamWriter) setTokenPositionsMaxDistance(maxDistance int) {
+	bsw.streamWriters.tokenPositionsMaxDistance = min(maxDistance, MaxTokenPositionsDistance)
+}
+
+// setIndexedFields enables building the field index for the given fields.
+//
+// It must be called after bsw initialization.
+func (bsw *blockStreamWriter) setIndexedFields(fields []string) {
+	bsw.fieldIndexBuilder.setFields(fields)
+}
+
+// setStreamHitsEnabled enables building per-stream per-minute hits for the written blocks.
+//
+// It must be called after bsw initialization.
+func (bsw *blockStreamWriter) setStreamHitsEnabled(enabled bool) {
+	bsw.streamHitsBuilder.enabled = enabled
 }
 
 // MustInitForInmemoryPart initializes bsw from mp
@@ -290,7 +360,8 @@ func (bsw *blockStreamWriter) MustInitForInmemoryPart(mp *inmemoryPart) {
 		return mp.fieldBloomValues.NewStreamWriter()
 	}
 
-	bsw.streamWriters.init(&mp.columnNames, &mp.columnIdxs, &mp.metaindex, &mp.index, &mp.columnsHeaderIndex, &mp.columnsHeader, &mp.timestamps, messageBloomValues, createBloomValuesWriter, 1)
+	bsw.streamWriters.init(&mp.columnNames, &mp.columnIdxs, &mp.metaindex, &mp.index, &mp.columnsHeaderIndex, &mp.columnsHeader, &mp.timestamps,
+		&mp.fieldIndex, &mp.fieldIndexMetaindex, &mp.streamHits, messageBloomValues, createBloomValuesWriter, 1)
 }
 
 // MustInitForFilePart initializes bsw for writing data to file part located at path.
@@ -311,6 +382,9 @@ func (bsw *blockStreamWriter) MustInitForFilePart(path string, nocache bool) {
 	columnsHeaderIndexPath := filepath.Join(path, columnsHeaderIndexFilename)
 	columnsHeaderPath := filepath.Join(path, columnsHeaderFilename)
 	timestampsPath := filepath.Join(path, timestampsFilename)
+	fieldIndexPath := filepath.Join(path, fieldIndexFilename)
+	fieldIndexMetaindexPath := filepath.Join(path, fieldIndexMetaindexFilename)
+	streamHitsPath := filepath.Join(path, streamHitsFilename)
 
 	var pfc filestream.ParallelFileCreator
 
@@ -338,6 +412,16 @@ func (bsw *blockStreamWriter) MustInitForFilePart(path string, nocache bool) {
 	var timestampsWriter filestream.WriteCloser
 	pfc.Add(timestampsPath, &timestampsWriter, nocache)
 
+	var fieldIndexWriter filestream.WriteCloser
+	pfc.Add(fieldIndexPath, &fieldIndexWriter, nocache)
+
+	// Always cache fieldIndexMetaindex file, since it is re-read immediately after part creation
+	var fieldIndexMetaindexWriter filestream.WriteCloser
+	pfc.Add(fieldIndexMetaindexPath, &fieldIndexMetaindexWriter, false)
+
+	var streamHitsWriter filestream.WriteCloser
+	pfc.Add(streamHitsPath, &streamHitsWriter, nocache)
+
 	messageBloomFilterPath := filepath.Join(path, messageBloomFilename)
 	messageValuesPath := filepath.Join(path, messageValuesFilename)
 	var messageBloomValuesWriter bloomValuesStreamWriter
@@ -358,8 +442,8 @@ func (bsw *blockStreamWriter) MustInitForFilePart(path string, nocache bool) {
 	}
 
 	bsw.streamWriters.init(columnNamesWriter, columnIdxsWriter, metaindexWriter, indexWriter,
-		columnsHeaderIndexWriter, columnsHeaderWriter, timestampsWriter, messageBloomValuesWriter,
-		createBloomValuesWriter, bloomValuesMaxShardsCount)
+		columnsHeaderIndexWriter, columnsHeaderWriter, timestampsWriter, fieldIndexWriter, fieldIndexMetaindexWriter, streamHitsWriter,
+		messageBloomValuesWriter, createBloomValuesWriter, bloomValuesMaxShardsCount)
 }
 
 // MustWriteRows writes timestamps with rows under the given sid to bsw.
@@ -411,6 +495,9 @@ func (bsw *blockStreamWriter) mustWriteBlockInternal(sid *streamID, b *block, bd
 	isSeenSid := sid.equal(&bsw.sidLast)
 	bsw.sidLast = *sid
 
+	bsw.fieldIndexBuilder.addBlock(b, bd, bsw.indexBlocksCount)
+	bsw.streamHitsBuilder.addBlock(sid, b, bd, &bsw.streamWriters.streamHitsWriter)
+
 	bh := getBlockHeader()
 	if b != nil {
 		b.mustWriteTo(sid, bh, &bsw.streamWriters)
@@ -453,7 +540,9 @@ func (bsw *blockStreamWriter) mustFlushIndexBlock(data []byte) {
 	if len(data) > 0 {
 		bsw.indexBlockHeader.mustWriteIndexBlock(data, bsw.sidFirst, bsw.minTimestamp, bsw.maxTimestamp, &bsw.streamWriters)
 		bsw.metaindexData = bsw.indexBlockHeader.marshal(bsw.metaindexData)
+		bsw.indexBlocksCount++
 	}
+	bsw.fieldIndexBuilder.flushIndexBlock()
 	bsw.hasWrittenBlocks = false
 	bsw.minTimestamp = 0
 	bsw.maxTimestamp = 0
@@ -485,6 +574,12 @@ func (bsw *blockStreamWriter) Finalize(ph *partHeader) {
 	// Write metaindex data
 	mustWriteIndexBlockHeaders(&bsw.streamWriters.metaindexWriter, bsw.metaindexData)
 
+	// Write field index data
+	bsw.fieldIndexBuilder.mustWrite(&bsw.streamWriters.fieldIndexWriter, &bsw.streamWriters.fieldIndexMetaindexWriter)
+
+	// Write per-stream hits
+	bsw.streamHitsBuilder.mustWrite(&bsw.streamWriters.streamHitsWriter)
+
 	ph.CompressedSizeBytes = bsw.streamWriters.totalBytesWritten()
 
 	bsw.streamWriters.MustClose()
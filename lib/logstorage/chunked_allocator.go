@@ -13,10 +13,14 @@ import (
 // chunkedAllocator cannot be used from concurrently running goroutines.
 type chunkedAllocator struct {
 	avgProcessors              []statsAvgProcessor
+	avgLenProcessors           []statsAvgLenProcessor
+	cardinalityRateProcessors  []statsCardinalityRateProcessor
 	countProcessors            []statsCountProcessor
 	countEmptyProcessors       []statsCountEmptyProcessor
 	countUniqProcessors        []statsCountUniqProcessor
 	countUniqHashProcessors    []statsCountUniqHashProcessor
+	countUniqApproxProcessors  []statsCountUniqApproxProcessor
+	entropyProcessors          []statsEntropyProcessor
 	histogramProcessors        []statsHistogramProcessor
 	jsonValuesProcessors       []statsJSONValuesProcessor
 	jsonValuesSortedProcessors []statsJSONValuesSortedProcessor
@@ -32,6 +36,7 @@ type chunkedAllocator struct {
 	rowMinProcessors           []statsRowMinProcessor
 	sumProcessors              []statsSumProcessor
 	sumLenProcessors           []statsSumLenProcessor
+	topkApproxProcessors       []statsTopkApproxProcessor
 	uniqValuesProcessors       []statsUniqValuesProcessor
 	valuesProcessors           []statsValuesProcessor
 
@@ -56,6 +61,14 @@ func (a *chunkedAllocator) newStatsAvgProcessor() (p *statsAvgProcessor) {
 	return addNewItem(&a.avgProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsAvgLenProcessor() (p *statsAvgLenProcessor) {
+	return addNewItem(&a.avgLenProcessors, a)
+}
+
+func (a *chunkedAllocator) newStatsCardinalityRateProcessor() (p *statsCardinalityRateProcessor) {
+	return addNewItem(&a.cardinalityRateProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsCountProcessor() (p *statsCountProcessor) {
 	return addNewItem(&a.countProcessors, a)
 }
@@ -72,6 +85,14 @@ func (a *chunkedAllocator) newStatsCountUniqHashProcessor() (p *statsCountUniqHa
 	return addNewItem(&a.countUniqHashProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsCountUniqApproxProcessor() (p *statsCountUniqApproxProcessor) {
+	return addNewItem(&a.countUniqApproxProcessors, a)
+}
+
+func (a *chunkedAllocator) newStatsEntropyProcessor() (p *statsEntropyProcessor) {
+	return addNewItem(&a.entropyProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsHistogramProcessor() (p *statsHistogramProcessor) {
 	return addNewItem(&a.histogramProcessors, a)
 }
@@ -132,6 +153,10 @@ func (a *chunkedAllocator) newStatsSumLenProcessor() (p *statsSumLenProcessor) {
 	return addNewItem(&a.sumLenProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsTopkApproxProcessor() (p *statsTopkApproxProcessor) {
+	return addNewItem(&a.topkApproxProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsUniqValuesProcessor() (p *statsUniqValuesProcessor) {
 	return addNewItem(&a.uniqValuesProcessors, a)
 }
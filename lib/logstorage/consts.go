@@ -8,7 +8,7 @@ const maxParallelReaders = 2_000
 // partFormatLatestVersion is the latest format version for parts.
 //
 // See partHeader.FormatVersion for details.
-const partFormatLatestVersion = 3
+const partFormatLatestVersion = 7
 
 // bloomValuesMaxShardsCount is the number of shards for bloomFilename and valuesFilename files.
 //
@@ -0,0 +1,100 @@
+package logstorage
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// mustInitExtraDataPaths prepares extraPaths for storing partitions of the storage at mainPath and returns lock files for them.
+//
+// Every extra path is locked in the same way as the main storage path, so it cannot be used by multiple storages simultaneously.
+func mustInitExtraDataPaths(mainPath string, extraPaths []string) []*os.File {
+	seen := map[string]struct{}{
+		mustGetAbsPath(mainPath): {},
+	}
+
+	var flockFs []*os.File
+	for _, path := range extraPaths {
+		pathAbs := mustGetAbsPath(path)
+		if _, ok := seen[pathAbs]; ok {
+			logger.Panicf("FATAL: the data path %q is specified multiple times", path)
+		}
+		seen[pathAbs] = struct{}{}
+
+		partitionsPath := filepath.Join(path, partitionsDirname)
+		fs.MustMkdirIfNotExist(partitionsPath)
+		fs.MustSyncPathAndParentDir(partitionsPath)
+
+		flockFs = append(flockFs, fs.MustCreateFlockFile(path))
+	}
+	return flockFs
+}
+
+func mustGetAbsPath(path string) string {
+	pathAbs, err := filepath.Abs(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot obtain absolute path for %q: %s", path, err)
+	}
+	return pathAbs
+}
+
+// findPartitionPath returns the path to the existing directory for the partition with the given name at s.dataPaths.
+//
+// An empty string is returned if the directory for the partition is missing.
+func (s *Storage) findPartitionPath(name string) string {
+	for _, dataPath := range s.dataPaths {
+		partitionPath := filepath.Join(dataPath, partitionsDirname, name)
+		if fs.IsPathExist(partitionPath) {
+			return partitionPath
+		}
+	}
+	return ""
+}
+
+// getDataPathForNewPartition returns the path from s.dataPaths for storing a new partition.
+//
+// It returns the path with the biggest amount of free disk space. This evenly balances disk space usage among the data paths.
+func (s *Storage) getDataPathForNewPartition() string {
+	return getPathWithMaxFreeSpace(s.dataPaths, fs.MustGetFreeSpace)
+}
+
+// getPathWithMaxFreeSpace returns the path with the maximum free space returned by getFreeSpace.
+//
+// The first path is returned if multiple paths have the same free space.
+func getPathWithMaxFreeSpace(paths []string, getFreeSpace func(path string) uint64) string {
+	result := paths[0]
+	if len(paths) == 1 {
+		return result
+	}
+
+	maxFreeSpace := getFreeSpace(result)
+	for _, path := range paths[1:] {
+		freeSpace := getFreeSpace(path)
+		if freeSpace > maxFreeSpace {
+			result = path
+			maxFreeSpace = freeSpace
+		}
+	}
+	return result
+}
+
+// getTotalDiskSpace returns the total disk space at all the s.dataPaths.
+func (s *Storage) getTotalDiskSpace() uint64 {
+	n := uint64(0)
+	for _, dataPath := range s.dataPaths {
+		n += fs.MustGetTotalSpace(dataPath)
+	}
+	return n
+}
+
+// getMinFreeDiskSpace returns the minimum free disk space among all the s.dataPaths.
+func (s *Storage) getMinFreeDiskSpace() uint64 {
+	n := fs.MustGetFreeSpace(s.dataPaths[0])
+	for _, dataPath := range s.dataPaths[1:] {
+		n = min(n, fs.MustGetFreeSpace(dataPath))
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package logstorage
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestGetPathWithMaxFreeSpace(t *testing.T) {
+	f := func(paths []string, freeSpaces map[string]uint64, resultExpected string) {
+		t.Helper()
+
+		result := getPathWithMaxFreeSpace(paths, func(path string) uint64 {
+			return freeSpaces[path]
+		})
+		if result != resultExpected {
+			t.Fatalf("unexpected path; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f([]string{"a"}, nil, "a")
+	f([]string{"a", "b", "c"}, nil, "a")
+	f([]string{"a", "b", "c"}, map[string]uint64{"a": 10, "b": 30, "c": 20}, "b")
+	f([]string{"a", "b", "c"}, map[string]uint64{"a": 10, "b": 30, "c": 30}, "b")
+	f([]string{"a", "b", "c"}, map[string]uint64{"a": 10, "b": 3, "c": 1}, "a")
+}
+
+func TestStorageExtraPaths(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	extraPath := t.Name() + "_extra"
+	cfg := &StorageConfig{
+		Retention:  time.Duration(100 * 365 * nsecsPerDay),
+		ExtraPaths: []string{extraPath},
+	}
+
+	tenantID := TenantID{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+	day1 := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+	day2 := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC).UnixNano()
+
+	addRows := func(s *Storage, timestamp int64, count int) {
+		lr := GetLogRows(nil, nil, nil, nil, "")
+		for i := 0; i < count; i++ {
+			lr.MustAdd(tenantID, timestamp+int64(i)*1e9, []Field{
+				{Name: "_msg", Value: "foo bar"},
+			}, -1)
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+		s.DebugFlush()
+	}
+
+	getRowsCount := func(s *Storage) uint64 {
+		t.Helper()
+
+		q, err := ParseQuery("*")
+		if err != nil {
+			t.Fatalf("cannot parse query: %s", err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tenantID}, q, false, nil)
+
+		var rowsCount atomic.Uint64
+		err = s.RunQuery(qctx, func(_ uint, db *DataBlock) {
+			rowsCount.Add(uint64(db.RowsCount()))
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return rowsCount.Load()
+	}
+
+	// Create the partition for day1 and move it to the extra path.
+	s := MustOpenStorage(path, cfg)
+	addRows(s, day1, 100)
+	s.MustClose()
+
+	day1Name := getPartitionNameFromDay(day1 / nsecsPerDay)
+	srcPath := filepath.Join(path, partitionsDirname, day1Name)
+	dstPath := filepath.Join(extraPath, partitionsDirname, day1Name)
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		t.Fatalf("cannot move partition: %s", err)
+	}
+
+	// The partition from the extra path must be queryable together with partitions from the main path.
+	s = MustOpenStorage(path, cfg)
+	addRows(s, day2, 50)
+	if n := getRowsCount(s); n != 150 {
+		t.Fatalf("unexpected number of rows; got %d; want 150", n)
+	}
+
+	// Logs for the existing partition at the extra path must be written to it.
+	addRows(s, day1+time.Hour.Nanoseconds(), 10)
+	if n := getRowsCount(s); n != 160 {
+		t.Fatalf("unexpected number of rows; got %d; want 160", n)
+	}
+	if fs.IsPathExist(srcPath) {
+		t.Fatalf("unexpected partition %q created at the main path", srcPath)
+	}
+
+	// The partition at the extra path must be detachable and attachable.
+	if err := s.PartitionDetach(day1Name); err != nil {
+		t.Fatalf("cannot detach partition: %s", err)
+	}
+	if n := getRowsCount(s); n != 50 {
+		t.Fatalf("unexpected number of rows after partition detach; got %d; want 50", n)
+	}
+	if err := s.PartitionAttach(day1Name); err != nil {
+		t.Fatalf("cannot attach partition: %s", err)
+	}
+	if n := getRowsCount(s); n != 160 {
+		t.Fatalf("unexpected number of rows after partition attach; got %d; want 160", n)
+	}
+	s.MustClose()
+
+	fs.MustRemoveDir(path)
+	fs.MustRemoveDir(extraPath)
+}
@@ -187,7 +187,7 @@ func mustOpenDatadb(pt *partition, path string, flushInterval time.Duration) *da
 
 		p := mustOpenFilePart(pt, partPath)
 		pw := newPartWrapper(p, nil, time.Time{})
-		if p.ph.CompressedSizeBytes > getMaxInmemoryPartSize() {
+		if p.ph.CompressedSizeBytes > getMaxInmemoryPartSize(pt.s.maxInmemoryPartSize) {
 			bigParts = append(bigParts, pw)
 		} else {
 			smallParts = append(smallParts, pw)
@@ -210,7 +210,7 @@ func mustOpenDatadb(pt *partition, path string, flushInterval time.Duration) *da
 		bigParts:   bigParts,
 		stopCh:     make(chan struct{}),
 	}
-	ddb.rb.init(&ddb.wg, ddb.mustFlushLogRows)
+	ddb.rb.init(&ddb.wg, pt.s.pendingRowsFlushInterval, pt.s.maxPendingRowsSize, ddb.mustFlushLogRows)
 	ddb.mergeIdx.Store(uint64(time.Now().UnixNano()))
 
 	ddb.startBackgroundWorkers()
@@ -233,6 +233,25 @@ var (
 	bigPartsConcurrencyCh      = make(chan struct{}, cgroup.AvailableCPUs())
 )
 
+// SetMergeConcurrency sets the maximum number of concurrent merges per every part type to n.
+//
+// By default the number of available CPU cores is used. This function must be called before opening the Storage.
+func SetMergeConcurrency(n int) {
+	if n <= 0 {
+		n = cgroup.AvailableCPUs()
+	}
+	inmemoryPartsConcurrencyCh = make(chan struct{}, n)
+	smallPartsConcurrencyCh = make(chan struct{}, n)
+	bigPartsConcurrencyCh = make(chan struct{}, n)
+}
+
+// GetMergeConcurrency returns the maximum number of concurrent merges per every part type.
+//
+// See SetMergeConcurrency.
+func GetMergeConcurrency() int {
+	return cap(smallPartsConcurrencyCh)
+}
+
 func (ddb *datadb) startSmallPartsMergers() {
 	ddb.partsLock.Lock()
 	for i := 0; i < cap(smallPartsConcurrencyCh); i++ {
@@ -586,6 +605,9 @@ func (ddb *datadb) mustMergePartsInternal(pws []*partWrapper, isFinal bool, drop
 		nocache := dstPartType == partBig
 		bsw.MustInitForFilePart(dstPartPath, nocache)
 	}
+	bsw.setTokenPositionsMaxDistance(ddb.pt.s.tokenPositionsMaxDistance)
+	bsw.setIndexedFields(ddb.pt.s.indexedFields)
+	bsw.setStreamHitsEnabled(ddb.pt.s.enableHitsPreaggregation)
 
 	// Merge source parts to destination part.
 	var ph partHeader
@@ -679,7 +701,7 @@ func (ddb *datadb) getDstPartType(pws []*partWrapper, isFinal bool) partType {
 	if dstPartSize > ddb.getMaxSmallPartSize() {
 		return partBig
 	}
-	if isFinal || dstPartSize > getMaxInmemoryPartSize() {
+	if isFinal || dstPartSize > getMaxInmemoryPartSize(ddb.pt.s.maxInmemoryPartSize) {
 		return partSmall
 	}
 	if !areAllInmemoryParts(pws) {
@@ -728,6 +750,12 @@ func (ddb *datadb) mustAddRows(lr *LogRows) {
 type rowsBuffer struct {
 	shards  []rowsBufferShard
 	nextIdx atomic.Uint64
+
+	// flushInterval is the maximum duration rows may stay in the buffer before being flushed.
+	flushInterval time.Duration
+
+	// maxShardSize is the maximum size of rows per shard. The shard is flushed when its size exceeds this limit.
+	maxShardSize int
 }
 
 func (rb *rowsBuffer) Len() uint64 {
@@ -745,7 +773,7 @@ func (rb *rowsBuffer) Len() uint64 {
 	return n
 }
 
-func (rb *rowsBuffer) init(wg *sync.WaitGroup, flushFunc func(lr *logRows)) {
+func (rb *rowsBuffer) init(wg *sync.WaitGroup, flushInterval time.Duration, maxShardSize int, flushFunc func(lr *logRows)) {
 	shards := make([]rowsBufferShard, cgroup.AvailableCPUs())
 	for i := range shards {
 		shard := &shards[i]
@@ -753,6 +781,8 @@ func (rb *rowsBuffer) init(wg *sync.WaitGroup, flushFunc func(lr *logRows)) {
 		shard.flushFunc = flushFunc
 	}
 	rb.shards = shards
+	rb.flushInterval = flushInterval
+	rb.maxShardSize = maxShardSize
 }
 
 type rowsBufferShard struct {
@@ -763,6 +793,11 @@ type rowsBufferShard struct {
 	lr         *logRows
 	flushTimer *time.Timer
 
+	// recentPart is an in-memory part created from lr for querying the rows, which aren't flushed yet.
+	//
+	// It is reset when lr is changed.
+	recentPart *partWrapper
+
 	// padding for preventing false sharing
 	_ [atomicutil.CacheLineSize]byte
 }
@@ -789,7 +824,7 @@ func (rb *rowsBuffer) mustAddRows(lr *LogRows) {
 	shard.mu.Lock()
 	if shard.flushTimer == nil {
 		shard.wg.Add(1)
-		shard.flushTimer = time.AfterFunc(time.Second, func() {
+		shard.flushTimer = time.AfterFunc(rb.flushInterval, func() {
 			defer shard.wg.Done()
 
 			shard.mu.Lock()
@@ -801,7 +836,8 @@ func (rb *rowsBuffer) mustAddRows(lr *LogRows) {
 		shard.lr = getLogRows()
 	}
 	shard.lr.mustAddRows(lr)
-	if shard.lr.needFlush() {
+	shard.resetRecentPartLocked()
+	if shard.lr.needFlush(rb.maxShardSize) {
 		shard.flushLocked()
 	}
 	shard.mu.Unlock()
@@ -815,6 +851,8 @@ func (shard *rowsBufferShard) flushLocked() {
 		shard.flushTimer = nil
 	}
 
+	shard.resetRecentPartLocked()
+
 	if shard.lr != nil {
 		shard.flushFunc(shard.lr)
 		putLogRows(shard.lr)
@@ -822,20 +860,57 @@ func (shard *rowsBufferShard) flushLocked() {
 	}
 }
 
+func (shard *rowsBufferShard) resetRecentPartLocked() {
+	if shard.recentPart != nil {
+		shard.recentPart.decRef()
+		shard.recentPart = nil
+	}
+}
+
+// appendRecentParts appends in-memory parts for the rows, which aren't flushed yet, to dst and returns the result.
+//
+// createPart is used for creating in-memory parts from the buffered rows.
+// The created parts are re-used by subsequent calls until new rows are added to rb.
+//
+// The caller must call decRef on the appended parts when they are no longer needed.
+func (rb *rowsBuffer) appendRecentParts(dst []*partWrapper, createPart func(lr *logRows) *partWrapper) []*partWrapper {
+	shards := rb.shards
+	for i := range shards {
+		shard := &shards[i]
+		shard.mu.Lock()
+		if shard.lr != nil && shard.lr.Len() > 0 {
+			if shard.recentPart == nil {
+				shard.recentPart = createPart(shard.lr)
+			}
+			shard.recentPart.incRef()
+			dst = append(dst, shard.recentPart)
+		}
+		shard.mu.Unlock()
+	}
+	return dst
+}
+
 func (ddb *datadb) mustFlushLogRows(lr *logRows) {
+	pw := ddb.mustCreateInmemoryPart(lr)
+
+	ddb.partsLock.Lock()
+	ddb.inmemoryParts = append(ddb.inmemoryParts, pw)
+	ddb.startInmemoryPartsMergerLocked()
+	ddb.partsLock.Unlock()
+}
+
+// mustCreateInmemoryPart creates in-memory part from lr.
+//
+// lr is sorted during the call.
+func (ddb *datadb) mustCreateInmemoryPart(lr *logRows) *partWrapper {
 	inmemoryPartsConcurrencyCh <- struct{}{}
 	mp := getInmemoryPart()
-	mp.mustInitFromRows(lr)
+	mp.mustInitFromRows(lr, ddb.pt.s.tokenPositionsMaxDistance, ddb.pt.s.indexedFields, ddb.pt.s.enableHitsPreaggregation)
 	p := mustOpenInmemoryPart(ddb.pt, mp)
 	<-inmemoryPartsConcurrencyCh
 
 	flushDeadline := time.Now().Add(ddb.flushInterval)
-	pw := newPartWrapper(p, mp, flushDeadline)
-
-	ddb.partsLock.Lock()
-	ddb.inmemoryParts = append(ddb.inmemoryParts, pw)
-	ddb.startInmemoryPartsMergerLocked()
-	ddb.partsLock.Unlock()
+	return newPartWrapper(p, mp, flushDeadline)
 }
 
 // DatadbStats contains various stats for datadb.
@@ -995,6 +1070,12 @@ func (ddb *datadb) debugFlush() {
 	ddb.rb.flush()
 }
 
+// mustFlushToFiles writes all the recently ingested data to disk parts.
+func (ddb *datadb) mustFlushToFiles() {
+	ddb.rb.flush()
+	ddb.mustFlushInmemoryPartsToFiles(true)
+}
+
 func (ddb *datadb) mustCreateSnapshotAt(dstDir string) {
 	fs.MustMkdirFailIfExist(dstDir)
 
@@ -1149,7 +1230,14 @@ func (ddb *datadb) getFlushToDiskDeadline(pws []*partWrapper) time.Time {
 	return d
 }
 
-func getMaxInmemoryPartSize() uint64 {
+// getMaxInmemoryPartSize returns the maximum size for in-memory parts.
+//
+// maxSize is the explicitly configured limit. Zero value means the limit is determined by the allowed memory.
+func getMaxInmemoryPartSize(maxSize uint64) uint64 {
+	if maxSize > 0 {
+		return maxSize
+	}
+
 	// Allocate 10% of allowed memory for in-memory parts.
 	n := uint64(0.1 * float64(memory.Allowed()) / maxInmemoryPartsPerPartition)
 	if n < 1e6 {
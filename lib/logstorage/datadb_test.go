@@ -5,6 +5,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestRowsBuffer(t *testing.T) {
@@ -15,7 +16,7 @@ func TestRowsBuffer(t *testing.T) {
 	var wgBuffer sync.WaitGroup
 
 	var rb rowsBuffer
-	rb.init(&wgBuffer, flushFunc)
+	rb.init(&wgBuffer, time.Second, MaxPendingRowsSize, flushFunc)
 
 	const concurrency = 10
 	const rowsPerInsert = 200
@@ -44,6 +45,120 @@ func TestRowsBuffer(t *testing.T) {
 	}
 }
 
+func TestRowsBufferAppendRecentParts(t *testing.T) {
+	var rowsFlushed atomic.Uint64
+	flushFunc := func(lr *logRows) {
+		rowsFlushed.Add(uint64(lr.Len()))
+	}
+	var wgBuffer sync.WaitGroup
+
+	var rb rowsBuffer
+	rb.init(&wgBuffer, time.Second, MaxPendingRowsSize, flushFunc)
+
+	partsCreated := 0
+	createPart := func(lr *logRows) *partWrapper {
+		partsCreated++
+		mp := getInmemoryPart()
+		mp.mustInitFromRows(lr, 0, nil, false)
+		p := mustOpenInmemoryPart(nil, mp)
+		return newPartWrapper(p, mp, time.Time{})
+	}
+
+	getRecentRowsCount := func() uint64 {
+		t.Helper()
+
+		pws := rb.appendRecentParts(nil, createPart)
+		n := getRowsCount(pws)
+		for _, pw := range pws {
+			pw.decRef()
+		}
+		return n
+	}
+
+	// empty buffer
+	if n := getRecentRowsCount(); n != 0 {
+		t.Fatalf("unexpected number of recent rows in empty buffer; got %d; want 0", n)
+	}
+	if partsCreated != 0 {
+		t.Fatalf("unexpected number of created parts; got %d; want 0", partsCreated)
+	}
+
+	// the first batch of rows
+	lr := newTestLogRows(1, 10, 1)
+	rb.mustAddRows(lr)
+	if n := getRecentRowsCount(); n != 10 {
+		t.Fatalf("unexpected number of recent rows; got %d; want 10", n)
+	}
+	if partsCreated != 1 {
+		t.Fatalf("unexpected number of created parts; got %d; want 1", partsCreated)
+	}
+
+	// the recent part must be re-used if no new rows are added
+	if n := getRecentRowsCount(); n != 10 {
+		t.Fatalf("unexpected number of recent rows; got %d; want 10", n)
+	}
+	if partsCreated != 1 {
+		t.Fatalf("unexpected number of created parts; got %d; want 1", partsCreated)
+	}
+
+	// the recent part must be re-created after adding new rows
+	rb.mustAddRows(lr)
+	rb.mustAddRows(lr)
+	PutLogRows(lr)
+	if n := getRecentRowsCount(); n != 30 {
+		t.Fatalf("unexpected number of recent rows; got %d; want 30", n)
+	}
+
+	// the buffer must be empty after the flush
+	rb.flush()
+	wgBuffer.Wait()
+	if n := getRecentRowsCount(); n != 0 {
+		t.Fatalf("unexpected number of recent rows after the flush; got %d; want 0", n)
+	}
+	if n := rowsFlushed.Load(); n != 30 {
+		t.Fatalf("unexpected number of flushed rows; got %d; want 30", n)
+	}
+}
+
+func TestRowsBufferFlushLimits(t *testing.T) {
+	var flushes atomic.Uint64
+	var rowsFlushed atomic.Uint64
+	flushFunc := func(lr *logRows) {
+		flushes.Add(1)
+		rowsFlushed.Add(uint64(lr.Len()))
+	}
+	var wgBuffer sync.WaitGroup
+
+	var rb rowsBuffer
+	rb.init(&wgBuffer, 10*time.Millisecond, MinPendingRowsSize, flushFunc)
+
+	// The rows must be flushed after the flush interval
+	lr := newTestLogRows(1, 10, 1)
+	rb.mustAddRows(lr)
+	wgBuffer.Wait()
+	if n := rowsFlushed.Load(); n != 10 {
+		t.Fatalf("unexpected number of flushed rows after the flush interval; got %d; want 10", n)
+	}
+	PutLogRows(lr)
+
+	// The rows must be flushed when the buffer size exceeds the limit
+	flushes.Store(0)
+	rowsFlushed.Store(0)
+	lr = newTestLogRows(1, 1000, 1)
+	for i := 0; i < 100; i++ {
+		rb.mustAddRows(lr)
+	}
+	rb.flush()
+	wgBuffer.Wait()
+	if n := rowsFlushed.Load(); n != 100*1000 {
+		t.Fatalf("unexpected number of flushed rows; got %d; want %d", n, 100*1000)
+	}
+	if n := flushes.Load(); n <= uint64(len(rb.shards)) {
+		t.Fatalf("expecting more than %d flushes because of the buffer size limit; got %d flushes", len(rb.shards), n)
+	}
+	PutLogRows(lr)
+}
+
 func TestAppendPartsToMergeManyParts(t *testing.T) {
 	// Verify that big number of parts are merged into minimal number of parts
 	// using minimum merges.
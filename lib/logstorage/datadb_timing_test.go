@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 )
 
 func BenchmarkRowsBuffer(b *testing.B) {
@@ -17,7 +18,7 @@ func BenchmarkRowsBuffer(b *testing.B) {
 func benchmarkRowsBuffer(b *testing.B, rowsPerInsert int) {
 	var rb rowsBuffer
 	var wgBuffer sync.WaitGroup
-	rb.init(&wgBuffer, func(_ *logRows) {})
+	rb.init(&wgBuffer, time.Second, MaxPendingRowsSize, func(_ *logRows) {})
 
 	b.ReportAllocs()
 	b.SetBytes(int64(rowsPerInsert))
@@ -0,0 +1,515 @@
+package logstorage
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// The field index maps values of the indexed fields to index blocks containing these values.
+//
+// It is stored in fieldIndexFilename as a sorted list of fieldIndex items split into compressed blocks,
+// while the list of indexed fields and the blocks' metadata is stored in fieldIndexMetaindexFilename.
+//
+// Every fieldIndex item contains the 32-bit hash of the (fieldName, value) pair in the upper 32 bits
+// and the index of the indexBlockHeader in the part in the lower 32 bits. Hash collisions are OK,
+// since they result only in the scan of some index blocks, which do not contain the needed value.
+
+// maxFieldIndexItemsPerBlock is the maximum number of fieldIndex items per every block in fieldIndexFilename.
+const maxFieldIndexItemsPerBlock = 64 * 1024
+
+// maxFieldIndexItemsPerPart is the maximum number of fieldIndex items per part.
+//
+// This limits memory usage when creating the field index for big parts.
+// Parts with bigger number of unique (value, index block) pairs for indexed fields are created without the field index.
+const maxFieldIndexItemsPerPart = 32 * 1024 * 1024
+
+// getFieldIndexHash returns the hash for the given (fieldName, value) pair stored in the field index.
+func getFieldIndexHash(fieldName, value string) uint32 {
+	d := xxhash.New()
+	_, _ = d.WriteString(fieldName)
+	_, _ = d.Write([]byte{0})
+	_, _ = d.WriteString(value)
+	return uint32(d.Sum64())
+}
+
+// fieldIndexBuilder builds the field index for the indexed fields in the blocks written via blockStreamWriter.
+type fieldIndexBuilder struct {
+	// fields contains canonical names of the indexed fields
+	fields []string
+
+	// items contains fieldIndex items for the blocks written so far
+	items []uint64
+
+	// itemsSeen contains items seen in the current index block.
+	//
+	// It is used for de-duplicating items across blocks in the current index block.
+	itemsSeen map[uint64]struct{}
+
+	// tooManyItems is set to true if the number of items exceeds maxFieldIndexItemsPerPart
+	tooManyItems bool
+}
+
+func (fib *fieldIndexBuilder) reset() {
+	fib.fields = fib.fields[:0]
+	fib.items = fib.items[:0]
+	clear(fib.itemsSeen)
+	fib.tooManyItems = false
+}
+
+// setFields sets the indexed fields for fib.
+func (fib *fieldIndexBuilder) setFields(fields []string) {
+	fib.fields = fib.fields[:0]
+	for _, f := range fields {
+		f = getCanonicalColumnName(f)
+		if !slices.Contains(fib.fields, f) {
+			fib.fields = append(fib.fields, f)
+		}
+	}
+}
+
+// addBlock registers values for the indexed fields at either b or bd, which is written to the index block with the given indexBlockIdx.
+func (fib *fieldIndexBuilder) addBlock(b *block, bd *blockData, indexBlockIdx uint32) {
+	if len(fib.fields) == 0 || fib.tooManyItems {
+		return
+	}
+
+	if b != nil {
+		for _, fieldName := range fib.fields {
+			if v, ok := getFieldValueFromFields(b.constColumns, fieldName); ok {
+				fib.addValue(fieldName, v, indexBlockIdx)
+				continue
+			}
+			if c := getColumnByName(b.columns, fieldName); c != nil {
+				fib.addValues(fieldName, c.values, indexBlockIdx)
+			}
+		}
+	} else {
+		for _, fieldName := range fib.fields {
+			if v, ok := getFieldValueFromFields(bd.constColumns, fieldName); ok {
+				fib.addValue(fieldName, v, indexBlockIdx)
+				continue
+			}
+			for i := range bd.columnsData {
+				cd := &bd.columnsData[i]
+				if getCanonicalColumnName(cd.name) == fieldName {
+					fib.addColumnData(fieldName, cd, bd.rowsCount, indexBlockIdx)
+					break
+				}
+			}
+		}
+	}
+
+	if len(fib.items) > maxFieldIndexItemsPerPart {
+		// Too many items. Drop the field index for the part in order to limit memory usage.
+		fib.items = fib.items[:0]
+		clear(fib.itemsSeen)
+		fib.tooManyItems = true
+	}
+}
+
+func (fib *fieldIndexBuilder) addColumnData(fieldName string, cd *columnData, rowsCount uint64, indexBlockIdx uint32) {
+	if cd.valueType == valueTypeDict {
+		// Fast path - all the values are available in the valuesDict.
+		fib.addValues(fieldName, cd.valuesDict.values, indexBlockIdx)
+		return
+	}
+
+	sbu := getStringsBlockUnmarshaler()
+	vd := getValuesDecoder()
+	values, err := sbu.unmarshal(nil, cd.valuesData, rowsCount)
+	if err != nil {
+		logger.Panicf("FATAL: cannot unmarshal values for the indexed field %q: %s", fieldName, err)
+	}
+	if err := vd.decodeInplace(values, cd.valueType, cd.valuesDict.values); err != nil {
+		logger.Panicf("FATAL: cannot decode values for the indexed field %q: %s", fieldName, err)
+	}
+	fib.addValues(fieldName, values, indexBlockIdx)
+	putValuesDecoder(vd)
+	putStringsBlockUnmarshaler(sbu)
+}
+
+func (fib *fieldIndexBuilder) addValues(fieldName string, values []string, indexBlockIdx uint32) {
+	for i, v := range values {
+		if i > 0 && v == values[i-1] {
+			continue
+		}
+		fib.addValue(fieldName, v, indexBlockIdx)
+	}
+}
+
+func (fib *fieldIndexBuilder) addValue(fieldName, value string, indexBlockIdx uint32) {
+	if value == "" {
+		// Empty values aren't indexed, since they match logs without the given field.
+		return
+	}
+
+	h := getFieldIndexHash(fieldName, value)
+	item := uint64(h)<<32 | uint64(indexBlockIdx)
+	if _, ok := fib.itemsSeen[item]; ok {
+		return
+	}
+	if fib.itemsSeen == nil {
+		fib.itemsSeen = make(map[uint64]struct{})
+	}
+	fib.itemsSeen[item] = struct{}{}
+	fib.items = append(fib.items, item)
+}
+
+// flushIndexBlock must be called when the current index block is flushed.
+func (fib *fieldIndexBuilder) flushIndexBlock() {
+	clear(fib.itemsSeen)
+}
+
+// mustWrite writes the field index to indexWriter and metaindexWriter.
+func (fib *fieldIndexBuilder) mustWrite(indexWriter, metaindexWriter *writerWithStats) {
+	if len(fib.fields) == 0 || fib.tooManyItems {
+		// Leave the field index files empty, since there are no indexed fields.
+		return
+	}
+
+	items := fib.items
+	slices.Sort(items)
+	items = slices.Compact(items)
+
+	var rows []fieldIndexMetaindexRow
+	bb := longTermBufPool.Get()
+	bbCompressed := longTermBufPool.Get()
+	for len(items) > 0 {
+		n := min(len(items), maxFieldIndexItemsPerBlock)
+		blockItems := items[:n]
+		items = items[n:]
+
+		bb.B = marshalFieldIndexItems(bb.B[:0], blockItems)
+		bbCompressed.B = encoding.CompressZSTDLevel(bbCompressed.B[:0], bb.B, 1)
+
+		rows = append(rows, fieldIndexMetaindexRow{
+			firstItem:  blockItems[0],
+			lastItem:   blockItems[len(blockItems)-1],
+			itemsCount: uint64(len(blockItems)),
+			offset:     indexWriter.bytesWritten,
+			size:       uint64(len(bbCompressed.B)),
+		})
+		indexWriter.MustWrite(bbCompressed.B)
+	}
+
+	bb.B = marshalFieldIndexMetaindex(bb.B[:0], fib.fields, rows)
+	bbCompressed.B = encoding.CompressZSTDLevel(bbCompressed.B[:0], bb.B, 1)
+	metaindexWriter.MustWrite(bbCompressed.B)
+
+	longTermBufPool.Put(bb)
+	longTermBufPool.Put(bbCompressed)
+}
+
+func marshalFieldIndexItems(dst []byte, items []uint64) []byte {
+	prevItem := uint64(0)
+	for _, item := range items {
+		dst = encoding.MarshalVarUint64(dst, item-prevItem)
+		prevItem = item
+	}
+	return dst
+}
+
+func unmarshalFieldIndexItems(dst []uint64, src []byte, itemsCount uint64) ([]uint64, error) {
+	prevItem := uint64(0)
+	for i := uint64(0); i < itemsCount; i++ {
+		delta, n := encoding.UnmarshalVarUint64(src)
+		if n <= 0 {
+			return dst, fmt.Errorf("cannot unmarshal item #%d out of %d items", i, itemsCount)
+		}
+		src = src[n:]
+		prevItem += delta
+		dst = append(dst, prevItem)
+	}
+	if len(src) > 0 {
+		return dst, fmt.Errorf("unexpected non-empty tail left after unmarshaling %d items; len(tail)=%d", itemsCount, len(src))
+	}
+	return dst, nil
+}
+
+// fieldIndexMetaindexRow contains metadata for a single block of items in fieldIndexFilename.
+type fieldIndexMetaindexRow struct {
+	// firstItem is the first item in the block
+	firstItem uint64
+
+	// lastItem is the last item in the block
+	lastItem uint64
+
+	// itemsCount is the number of items in the block
+	itemsCount uint64
+
+	// offset is the offset of the block in fieldIndexFilename
+	offset uint64
+
+	// size is the size of the compressed block in fieldIndexFilename
+	size uint64
+}
+
+func marshalFieldIndexMetaindex(dst []byte, fields []string, rows []fieldIndexMetaindexRow) []byte {
+	dst = encoding.MarshalVarUint64(dst, uint64(len(fields)))
+	for _, f := range fields {
+		dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(f))
+	}
+	dst = encoding.MarshalVarUint64(dst, uint64(len(rows)))
+	for i := range rows {
+		r := &rows[i]
+		dst = encoding.MarshalUint64(dst, r.firstItem)
+		dst = encoding.MarshalUint64(dst, r.lastItem)
+		dst = encoding.MarshalVarUint64(dst, r.itemsCount)
+		dst = encoding.MarshalVarUint64(dst, r.offset)
+		dst = encoding.MarshalVarUint64(dst, r.size)
+	}
+	return dst
+}
+
+// fieldIndex is the field index for a single part.
+type fieldIndex struct {
+	// fields contains the indexed fields
+	fields []string
+
+	// rows contains metadata for blocks in fieldIndexFilename sorted by firstItem
+	rows []fieldIndexMetaindexRow
+
+	// indexFile is the file with fieldIndex items
+	indexFile fs.MustReadAtCloser
+}
+
+func (fi *fieldIndex) unmarshalMetaindex(src []byte) error {
+	n, nSize := encoding.UnmarshalVarUint64(src)
+	if nSize <= 0 {
+		return fmt.Errorf("cannot unmarshal the number of indexed fields")
+	}
+	src = src[nSize:]
+	fields := make([]string, 0, n)
+	for i := uint64(0); i < n; i++ {
+		data, nSize := encoding.UnmarshalBytes(src)
+		if nSize <= 0 {
+			return fmt.Errorf("cannot unmarshal indexed field #%d", i)
+		}
+		src = src[nSize:]
+		fields = append(fields, string(data))
+	}
+
+	n, nSize = encoding.UnmarshalVarUint64(src)
+	if nSize <= 0 {
+		return fmt.Errorf("cannot unmarshal the number of field index blocks")
+	}
+	src = src[nSize:]
+	rows := make([]fieldIndexMetaindexRow, n)
+	for i := range rows {
+		r := &rows[i]
+		if len(src) < 16 {
+			return fmt.Errorf("cannot unmarshal firstItem and lastItem for field index block #%d from %d bytes; need 16 bytes", i, len(src))
+		}
+		r.firstItem = encoding.UnmarshalUint64(src)
+		r.lastItem = encoding.UnmarshalUint64(src[8:])
+		src = src[16:]
+
+		var nSize int
+		r.itemsCount, nSize = encoding.UnmarshalVarUint64(src)
+		if nSize <= 0 {
+			return fmt.Errorf("cannot unmarshal itemsCount for field index block #%d", i)
+		}
+		src = src[nSize:]
+		if r.itemsCount == 0 || r.itemsCount > maxFieldIndexItemsPerBlock {
+			return fmt.Errorf("unexpected itemsCount for field index block #%d: %d; must be in the range [1..%d]", i, r.itemsCount, maxFieldIndexItemsPerBlock)
+		}
+
+		r.offset, nSize = encoding.UnmarshalVarUint64(src)
+		if nSize <= 0 {
+			return fmt.Errorf("cannot unmarshal offset for field index block #%d", i)
+		}
+		src = src[nSize:]
+
+		r.size, nSize = encoding.UnmarshalVarUint64(src)
+		if nSize <= 0 {
+			return fmt.Errorf("cannot unmarshal size for field index block #%d", i)
+		}
+		src = src[nSize:]
+	}
+	if len(src) > 0 {
+		return fmt.Errorf("unexpected non-empty tail left after unmarshaling field index metaindex; len(tail)=%d", len(src))
+	}
+
+	fi.fields = fields
+	fi.rows = rows
+	return nil
+}
+
+// mustReadFieldIndexMetaindex reads field index metaindex from r.
+//
+// indexFile must point to the fieldIndexFilename contents.
+func mustReadFieldIndexMetaindex(r *readerWithStats, indexFile fs.MustReadAtCloser) *fieldIndex {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		logger.Panicf("FATAL: %s: cannot read field index metaindex: %s", r.Path(), err)
+	}
+
+	fi := &fieldIndex{
+		indexFile: indexFile,
+	}
+	if len(data) == 0 {
+		// The part has no indexed fields
+		return fi
+	}
+
+	bb := longTermBufPool.Get()
+	defer longTermBufPool.Put(bb)
+
+	bb.B, err = encoding.DecompressZSTD(bb.B[:0], data)
+	if err != nil {
+		logger.Panicf("FATAL: %s: cannot decompress field index metaindex: %s", r.Path(), err)
+	}
+
+	if err := fi.unmarshalMetaindex(bb.B); err != nil {
+		logger.Panicf("FATAL: %s: cannot parse field index metaindex: %s", r.Path(), err)
+	}
+	return fi
+}
+
+// hasField returns true if the given fieldName is indexed at fi.
+func (fi *fieldIndex) hasField(fieldName string) bool {
+	return fi != nil && slices.Contains(fi.fields, fieldName)
+}
+
+// appendIndexBlockIdxs appends indexes of index blocks, which may contain the given value for the given fieldName, to dst.
+func (fi *fieldIndex) appendIndexBlockIdxs(dst []uint32, fieldName, value string, qs *QueryStats) []uint32 {
+	h := uint64(getFieldIndexHash(fieldName, value))
+	minItem := h << 32
+	maxItem := minItem | (1<<32 - 1)
+
+	rows := fi.rows
+	n := sort.Search(len(rows), func(i int) bool {
+		return rows[i].lastItem >= minItem
+	})
+	rows = rows[n:]
+
+	var items []uint64
+	for i := range rows {
+		r := &rows[i]
+		if r.firstItem > maxItem {
+			break
+		}
+		items = fi.mustReadItems(items[:0], r, qs)
+		n := sort.Search(len(items), func(i int) bool {
+			return items[i] >= minItem
+		})
+		for _, item := range items[n:] {
+			if item > maxItem {
+				break
+			}
+			dst = append(dst, uint32(item))
+		}
+	}
+	return dst
+}
+
+func (fi *fieldIndex) mustReadItems(dst []uint64, r *fieldIndexMetaindexRow, qs *QueryStats) []uint64 {
+	bbCompressed := longTermBufPool.Get()
+	bbCompressed.B = bytesutil.ResizeNoCopyMayOverallocate(bbCompressed.B, int(r.size))
+	fi.indexFile.MustReadAt(bbCompressed.B, int64(r.offset))
+
+	qs.BytesReadBlockHeaders += r.size
+
+	bb := longTermBufPool.Get()
+	var err error
+	bb.B, err = encoding.DecompressZSTD(bb.B[:0], bbCompressed.B)
+	longTermBufPool.Put(bbCompressed)
+	if err != nil {
+		logger.Panicf("FATAL: %s: cannot decompress field index block read at offset %d with size %d: %s", fi.indexFile.Path(), r.offset, r.size, err)
+	}
+
+	dst, err = unmarshalFieldIndexItems(dst, bb.B, r.itemsCount)
+	longTermBufPool.Put(bb)
+	if err != nil {
+		logger.Panicf("FATAL: %s: cannot unmarshal field index block read at offset %d with size %d: %s", fi.indexFile.Path(), r.offset, r.size, err)
+	}
+	return dst
+}
+
+// getIndexBlockIdxsForFilter returns indexes of index blocks in p, which may contain logs matching f.
+//
+// nil is returned if the field index cannot be used for f at p.
+func (p *part) getIndexBlockIdxsForFilter(f filter, qs *QueryStats) map[uint32]struct{} {
+	fi := p.fieldIndex
+	if fi == nil || len(fi.fields) == 0 {
+		return nil
+	}
+
+	var result map[uint32]struct{}
+	var idxs []uint32
+	visitIndexedFieldValues(f, func(fieldName string, values []string) {
+		fieldName = getCanonicalColumnName(fieldName)
+		if !fi.hasField(fieldName) {
+			return
+		}
+
+		idxs = idxs[:0]
+		for _, v := range values {
+			idxs = fi.appendIndexBlockIdxs(idxs, fieldName, v, qs)
+		}
+
+		m := make(map[uint32]struct{}, len(idxs))
+		for _, idx := range idxs {
+			if result == nil {
+				m[idx] = struct{}{}
+			} else if _, ok := result[idx]; ok {
+				m[idx] = struct{}{}
+			}
+		}
+		result = m
+	})
+	return result
+}
+
+// visitIndexedFieldValues calls callback for every filter at the top level of f, which matches only the given non-empty values of the given field.
+func visitIndexedFieldValues(f filter, callback func(fieldName string, values []string)) {
+	visit := func(f filter) {
+		switch t := f.(type) {
+		case *filterExact:
+			if t.value != "" {
+				callback(t.fieldName, []string{t.value})
+			}
+		case *filterIn:
+			if t.values.q == nil && !slices.Contains(t.values.values, "") {
+				callback(t.fieldName, t.values.values)
+			}
+		}
+	}
+
+	if fa, ok := f.(*filterAnd); ok {
+		for _, f := range fa.filters {
+			visit(f)
+		}
+		return
+	}
+	visit(f)
+}
+
+// getFieldValueFromFields returns the value for the field with the given canonical name from fields.
+func getFieldValueFromFields(fields []Field, name string) (string, bool) {
+	for i := range fields {
+		if getCanonicalColumnName(fields[i].Name) == name {
+			return fields[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// getColumnByName returns the column with the given canonical name from columns.
+func getColumnByName(columns []column, name string) *column {
+	for i := range columns {
+		if getCanonicalColumnName(columns[i].name) == name {
+			return &columns[i]
+		}
+	}
+	return nil
+}
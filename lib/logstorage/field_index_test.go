@@ -0,0 +1,388 @@
+package logstorage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestFieldIndexItemsMarshalUnmarshal(t *testing.T) {
+	f := func(items []uint64) {
+		t.Helper()
+
+		data := marshalFieldIndexItems(nil, items)
+		result, err := unmarshalFieldIndexItems(nil, data, uint64(len(items)))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(items) == 0 && len(result) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(result, items) {
+			t.Fatalf("unexpected items; got %v; want %v", result, items)
+		}
+
+		if len(data) > 0 {
+			if _, err := unmarshalFieldIndexItems(nil, data[:len(data)-1], uint64(len(items))); err == nil {
+				t.Fatalf("expecting non-nil error when unmarshaling truncated data")
+			}
+		}
+		if _, err := unmarshalFieldIndexItems(nil, append(data, 1), uint64(len(items))); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling data with unexpected tail")
+		}
+	}
+
+	f(nil)
+	f([]uint64{0})
+	f([]uint64{1, 2, 3, 1 << 40, 1<<63 + 5})
+}
+
+func TestFieldIndexMetaindexMarshalUnmarshal(t *testing.T) {
+	f := func(fields []string, rows []fieldIndexMetaindexRow) {
+		t.Helper()
+
+		data := marshalFieldIndexMetaindex(nil, fields, rows)
+
+		var fi fieldIndex
+		if err := fi.unmarshalMetaindex(data); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(fi.fields) != len(fields) || len(fields) > 0 && !reflect.DeepEqual(fi.fields, fields) {
+			t.Fatalf("unexpected fields; got %q; want %q", fi.fields, fields)
+		}
+		if len(fi.rows) != len(rows) || len(rows) > 0 && !reflect.DeepEqual(fi.rows, rows) {
+			t.Fatalf("unexpected rows; got %v; want %v", fi.rows, rows)
+		}
+
+		if err := fi.unmarshalMetaindex(data[:len(data)-1]); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling truncated data")
+		}
+	}
+
+	f(nil, nil)
+	f([]string{"trace_id"}, nil)
+	f([]string{"trace_id", "user_id"}, []fieldIndexMetaindexRow{
+		{
+			firstItem:  10,
+			lastItem:   1 << 50,
+			itemsCount: 123,
+			offset:     0,
+			size:       456,
+		},
+		{
+			firstItem:  1<<50 + 1,
+			lastItem:   1 << 60,
+			itemsCount: maxFieldIndexItemsPerBlock,
+			offset:     456,
+			size:       789,
+		},
+	})
+}
+
+func TestFieldIndexInmemoryPart(t *testing.T) {
+	const streamsCount = 3000
+
+	lr := GetLogRows([]string{"instance"}, nil, nil, nil, "")
+	tenantID := TenantID{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+	for i := 0; i < streamsCount; i++ {
+		fields := []Field{
+			{
+				Name:  "instance",
+				Value: fmt.Sprintf("host-%d", i),
+			},
+			{
+				Name:  "trace_id",
+				Value: fmt.Sprintf("trace-%d", i),
+			},
+			{
+				Name:  "_msg",
+				Value: fmt.Sprintf("some message for the user-%d", i%10),
+			},
+		}
+		lr.mustAdd(tenantID, int64(i)*1e9, fields)
+	}
+
+	var rows logRows
+	rows.mustAddRows(lr)
+	PutLogRows(lr)
+
+	mp := getInmemoryPart()
+	defer putInmemoryPart(mp)
+	mp.mustInitFromRows(&rows, 0, []string{"trace_id", "", "trace_id"}, false)
+
+	p := mustOpenInmemoryPart(nil, mp)
+	defer mustClosePart(p)
+
+	if len(p.indexBlockHeaders) < 2 {
+		t.Fatalf("expecting at least 2 index blocks; got %d", len(p.indexBlockHeaders))
+	}
+	fi := p.fieldIndex
+	fieldsExpected := []string{"trace_id", "_msg"}
+	if !reflect.DeepEqual(fi.fields, fieldsExpected) {
+		t.Fatalf("unexpected indexed fields; got %q; want %q", fi.fields, fieldsExpected)
+	}
+
+	var qs QueryStats
+	seenIdxs := make(map[uint32]struct{})
+	for i := 0; i < streamsCount; i++ {
+		idxs := fi.appendIndexBlockIdxs(nil, "trace_id", fmt.Sprintf("trace-%d", i), &qs)
+		if len(idxs) != 1 {
+			t.Fatalf("unexpected number of index blocks for trace-%d; got %d; want 1", i, len(idxs))
+		}
+		seenIdxs[idxs[0]] = struct{}{}
+	}
+	if len(seenIdxs) != len(p.indexBlockHeaders) {
+		t.Fatalf("unexpected number of index blocks containing trace_id values; got %d; want %d", len(seenIdxs), len(p.indexBlockHeaders))
+	}
+	if qs.BytesReadBlockHeaders == 0 {
+		t.Fatalf("expecting non-zero BytesReadBlockHeaders")
+	}
+
+	// The _msg values are spread among all the index blocks
+	idxs := fi.appendIndexBlockIdxs(nil, "_msg", "some message for the user-3", &qs)
+	if len(idxs) != len(p.indexBlockHeaders) {
+		t.Fatalf("unexpected number of index blocks for _msg; got %d; want %d", len(idxs), len(p.indexBlockHeaders))
+	}
+
+	// missing values
+	idxs = fi.appendIndexBlockIdxs(nil, "trace_id", "trace-missing", &qs)
+	if len(idxs) != 0 {
+		t.Fatalf("unexpected index blocks for the missing value: %v", idxs)
+	}
+	idxs = fi.appendIndexBlockIdxs(nil, "user_id", "trace-1", &qs)
+	if len(idxs) != 0 {
+		t.Fatalf("unexpected index blocks for the non-indexed field: %v", idxs)
+	}
+
+	// filters
+	f := func(f filter, resultExpected []uint32) {
+		t.Helper()
+
+		result := p.getIndexBlockIdxsForFilter(f, &qs)
+		if resultExpected == nil {
+			if result != nil {
+				t.Fatalf("expecting nil result for filter %s; got %v", f, result)
+			}
+			return
+		}
+		if len(result) != len(resultExpected) {
+			t.Fatalf("unexpected result for filter %s; got %v; want %v", f, result, resultExpected)
+		}
+		for _, idx := range resultExpected {
+			if _, ok := result[idx]; !ok {
+				t.Fatalf("missing index block %d in the result for filter %s; got %v", idx, f, result)
+			}
+		}
+	}
+
+	idx0 := fi.appendIndexBlockIdxs(nil, "trace_id", "trace-0", &qs)[0]
+	idxLast := fi.appendIndexBlockIdxs(nil, "trace_id", fmt.Sprintf("trace-%d", streamsCount-1), &qs)[0]
+	if idx0 == idxLast {
+		t.Fatalf("expecting distinct index blocks for the first and the last traces")
+	}
+
+	f(&filterExact{
+		fieldName: "trace_id",
+		value:     "trace-0",
+	}, []uint32{idx0})
+	f(&filterIn{
+		fieldName: "trace_id",
+		values: inValues{
+			values: []string{"trace-0", fmt.Sprintf("trace-%d", streamsCount-1), "trace-missing"},
+		},
+	}, []uint32{idx0, idxLast})
+	f(&filterAnd{
+		filters: []filter{
+			&filterPhrase{
+				fieldName: "_msg",
+				phrase:    "foo",
+			},
+			&filterExact{
+				fieldName: "trace_id",
+				value:     "trace-0",
+			},
+		},
+	}, []uint32{idx0})
+	f(&filterAnd{
+		filters: []filter{
+			&filterExact{
+				fieldName: "trace_id",
+				value:     "trace-0",
+			},
+			&filterExact{
+				fieldName: "trace_id",
+				value:     fmt.Sprintf("trace-%d", streamsCount-1),
+			},
+		},
+	}, []uint32{})
+	f(&filterExact{
+		fieldName: "trace_id",
+		value:     "trace-missing",
+	}, []uint32{})
+
+	// filters, which cannot use the field index
+	f(&filterExact{
+		fieldName: "trace_id",
+		value:     "",
+	}, nil)
+	f(&filterExact{
+		fieldName: "user_id",
+		value:     "trace-0",
+	}, nil)
+	f(&filterPrefix{
+		fieldName: "trace_id",
+		prefix:    "trace-0",
+	}, nil)
+	f(&filterOr{
+		filters: []filter{
+			&filterExact{
+				fieldName: "trace_id",
+				value:     "trace-0",
+			},
+			&filterExact{
+				fieldName: "trace_id",
+				value:     "trace-1",
+			},
+		},
+	}, nil)
+	f(&filterNot{
+		f: &filterExact{
+			fieldName: "trace_id",
+			value:     "trace-0",
+		},
+	}, nil)
+}
+
+func TestFieldIndexStorageSearch(t *testing.T) {
+	t.Parallel()
+
+	const streamsCount = 3000
+
+	storagePath := t.Name()
+	cfg := &StorageConfig{
+		Retention:     time.Duration(100 * 365 * nsecsPerDay),
+		IndexedFields: []string{"trace_id", "user_id"},
+	}
+	s := MustOpenStorage(storagePath, cfg)
+
+	tenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+
+	// Add rows in two batches in order to create multiple parts
+	addRows := func(start, end int) {
+		lr := GetLogRows([]string{"instance"}, nil, nil, nil, "")
+		for i := start; i < end; i++ {
+			fields := []Field{
+				{
+					Name:  "instance",
+					Value: fmt.Sprintf("host-%d", i),
+				},
+				{
+					Name:  "trace_id",
+					Value: fmt.Sprintf("trace-%d", i),
+				},
+				{
+					Name:  "user_id",
+					Value: fmt.Sprintf("%d", i%7),
+				},
+			}
+			lr.mustAdd(tenantID, int64(i)*1e9, fields)
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+		s.DebugFlush()
+	}
+	addRows(0, streamsCount/2)
+	addRows(streamsCount/2, streamsCount)
+
+	f := func(f filter, neededColumnName string, expectedIdxs []int) {
+		t.Helper()
+
+		expectedValues := make([]string, 0, len(expectedIdxs))
+		expectedTimestamps := make([]int64, 0, len(expectedIdxs))
+		for _, idx := range expectedIdxs {
+			switch neededColumnName {
+			case "trace_id":
+				expectedValues = append(expectedValues, fmt.Sprintf("trace-%d", idx))
+			case "user_id":
+				expectedValues = append(expectedValues, fmt.Sprintf("%d", idx%7))
+			}
+			expectedTimestamps = append(expectedTimestamps, int64(idx)*1e9)
+		}
+		testFilterMatchForStorage(t, s, tenantID, f, neededColumnName, expectedValues, expectedTimestamps)
+	}
+
+	var userIdxs []int
+	for i := 0; i < streamsCount; i++ {
+		if i%7 == 6 {
+			userIdxs = append(userIdxs, i)
+		}
+	}
+
+	checkResults := func() {
+		t.Helper()
+
+		f(&filterExact{
+			fieldName: "trace_id",
+			value:     "trace-123",
+		}, "trace_id", []int{123})
+		f(&filterExact{
+			fieldName: "trace_id",
+			value:     "trace-missing",
+		}, "trace_id", nil)
+		f(&filterIn{
+			fieldName: "trace_id",
+			values: inValues{
+				values: []string{"trace-5", "trace-2999", "trace-missing"},
+			},
+		}, "trace_id", []int{5, 2999})
+		f(&filterAnd{
+			filters: []filter{
+				&filterExact{
+					fieldName: "user_id",
+					value:     "3",
+				},
+				&filterIn{
+					fieldName: "trace_id",
+					values: inValues{
+						values: []string{"trace-3", "trace-4", "trace-10", "trace-17"},
+					},
+				},
+			},
+		}, "user_id", []int{3, 10, 17})
+		f(&filterAnd{
+			filters: []filter{
+				&filterExact{
+					fieldName: "user_id",
+					value:     "3",
+				},
+				&filterExact{
+					fieldName: "trace_id",
+					value:     "trace-4",
+				},
+			},
+		}, "user_id", nil)
+
+		f(&filterExact{
+			fieldName: "user_id",
+			value:     "6",
+		}, "user_id", userIdxs)
+	}
+
+	checkResults()
+
+	// Verify the field index after merging parts
+	s.MustForceMerge("")
+	checkResults()
+
+	s.MustClose()
+	fs.MustRemoveDir(storagePath)
+}
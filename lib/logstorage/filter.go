@@ -1,6 +1,8 @@
 package logstorage
 
 import (
+	"fmt"
+
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
 )
 
@@ -123,3 +125,68 @@ func copyFilters(filters []filter, visitFunc func(f filter) bool, copyFunc func(
 	}
 	return filtersNew, nil
 }
+
+// renameFilterFields returns a copy of f where the srcFieldName field is replaced with dstFieldName.
+//
+// It returns false if f contains filters on srcFieldName, which cannot be renamed.
+func renameFilterFields(f filter, srcFieldName, dstFieldName string) (filter, bool) {
+	visitFunc := func(f filter) bool {
+		switch f.(type) {
+		case *filterAnd, *filterOr, *filterNot:
+			return false
+		}
+		var pf prefixfilter.Filter
+		f.updateNeededFields(&pf)
+		return pf.MatchString(srcFieldName)
+	}
+	copyFunc := func(f filter) (filter, error) {
+		fNew, ok := renameFilterField(f, dstFieldName)
+		if !ok {
+			return nil, fmt.Errorf("cannot rename field at %T filter", f)
+		}
+		return fNew, nil
+	}
+	fNew, err := copyFilter(f, visitFunc, copyFunc)
+	if err != nil {
+		return nil, false
+	}
+	return fNew, true
+}
+
+// renameFilterField returns a copy of the leaf filter f with the given fieldName.
+//
+// It returns false if f doesn't support field renaming.
+func renameFilterField(f filter, fieldName string) (filter, bool) {
+	fieldName = getCanonicalColumnName(fieldName)
+
+	switch t := f.(type) {
+	case *filterPhrase:
+		return &filterPhrase{fieldName: fieldName, phrase: t.phrase}, true
+	case *filterPrefix:
+		return &filterPrefix{fieldName: fieldName, prefix: t.prefix}, true
+	case *filterExact:
+		return &filterExact{fieldName: fieldName, value: t.value}, true
+	case *filterExactPrefix:
+		return &filterExactPrefix{fieldName: fieldName, prefix: t.prefix}, true
+	case *filterAnyCasePhrase:
+		return &filterAnyCasePhrase{fieldName: fieldName, phrase: t.phrase}, true
+	case *filterAnyCasePrefix:
+		return &filterAnyCasePrefix{fieldName: fieldName, prefix: t.prefix}, true
+	case *filterSubstring:
+		return &filterSubstring{fieldName: fieldName, substring: t.substring}, true
+	case *filterRegexp:
+		return &filterRegexp{fieldName: fieldName, re: t.re}, true
+	case *filterRange:
+		return &filterRange{fieldName: fieldName, minValue: t.minValue, maxValue: t.maxValue, stringRepr: t.stringRepr}, true
+	case *filterStringRange:
+		return &filterStringRange{fieldName: fieldName, minValue: t.minValue, maxValue: t.maxValue, stringRepr: t.stringRepr}, true
+	case *filterLenRange:
+		return &filterLenRange{fieldName: fieldName, minLen: t.minLen, maxLen: t.maxLen, stringRepr: t.stringRepr}, true
+	case *filterIPv4Range:
+		return &filterIPv4Range{fieldName: fieldName, minValue: t.minValue, maxValue: t.maxValue}, true
+	case *filterValueType:
+		return &filterValueType{fieldName: fieldName, valueType: t.valueType}, true
+	default:
+		return nil, false
+	}
+}
@@ -1,6 +1,7 @@
 package logstorage
 
 import (
+	"sort"
 	"strings"
 	"sync"
 
@@ -17,6 +18,13 @@ type filterAnd struct {
 
 	byFieldTokensOnce sync.Once
 	byFieldTokens     []fieldTokens
+
+	// filtersOrdered contains filters ordered by their estimated execution cost.
+	//
+	// It is used for applying cheap filters before the expensive ones, since the expensive filters
+	// may be skipped when the cheap filters do not match any rows.
+	filtersOrderedOnce sync.Once
+	filtersOrdered     []filter
 }
 
 type fieldTokens struct {
@@ -45,7 +53,7 @@ func (fa *filterAnd) updateNeededFields(pf *prefixfilter.Filter) {
 }
 
 func (fa *filterAnd) matchRow(fields []Field) bool {
-	for _, f := range fa.filters {
+	for _, f := range fa.getFiltersOrdered() {
 		if !f.matchRow(fields) {
 			return false
 		}
@@ -54,7 +62,7 @@ func (fa *filterAnd) matchRow(fields []Field) bool {
 }
 
 func (fa *filterAnd) applyToBlockResult(br *blockResult, bm *bitmap) {
-	for _, f := range fa.filters {
+	for _, f := range fa.getFiltersOrdered() {
 		f.applyToBlockResult(br, bm)
 		if bm.isZero() {
 			// Shortcut - there is no need in applying the remaining filters,
@@ -72,7 +80,7 @@ func (fa *filterAnd) applyToBlockSearch(bs *blockSearch, bm *bitmap) {
 	}
 
 	// Slow path - verify every filter separately.
-	for _, f := range fa.filters {
+	for _, f := range fa.getFiltersOrdered() {
 		f.applyToBlockSearch(bs, bm)
 		if bm.isZero() {
 			// Shortcut - there is no need in applying the remaining filters,
@@ -119,6 +127,66 @@ func (fa *filterAnd) matchBloomFilters(bs *blockSearch) bool {
 	return true
 }
 
+func (fa *filterAnd) getFiltersOrdered() []filter {
+	fa.filtersOrderedOnce.Do(fa.initFiltersOrdered)
+	return fa.filtersOrdered
+}
+
+func (fa *filterAnd) initFiltersOrdered() {
+	filters := append([]filter{}, fa.filters...)
+	sort.SliceStable(filters, func(i, j int) bool {
+		return getFilterCost(filters[i]) < getFilterCost(filters[j])
+	})
+	fa.filtersOrdered = filters
+}
+
+// getFilterCost returns the estimated cost of applying f to a block of logs.
+//
+// Filters, which can quickly skip the whole block with the help of bloom filters or min/max values from column headers,
+// have lower cost than filters, which need to inspect every value in the block.
+func getFilterCost(f filter) int {
+	switch t := f.(type) {
+	case *filterNoop:
+		return 0
+	case *filterTime, *filterDayRange, *filterWeekRange, *filterStream, *filterStreamID:
+		// These filters work with timestamps and stream ids, which are cheap to read.
+		return 1
+	case *filterExact, *filterExactPrefix, *filterPhrase, *filterPrefix, *filterSequence,
+		*filterAnyCasePhrase, *filterAnyCasePrefix, *filterIn, *filterContainsAll, *filterContainsAny,
+		*filterEqualsCommonCase, *filterContainsCommonCase:
+		// These filters may skip the block with the help of bloom filters.
+		return 10
+	case *filterRange, *filterStringRange, *filterLenRange, *filterIPv4Range, *filterValueType:
+		// These filters may skip the block with the help of min/max values in the column header.
+		return 20
+	case *filterEqField, *filterLeField:
+		// These filters need reading two columns.
+		return 40
+	case *filterSubstring, *filterPatternMatch:
+		return 50
+	case *filterNear:
+		return 80
+	case *filterRegexp:
+		return 100
+	case *filterNot:
+		return getFilterCost(t.f) + 1
+	case *filterAnd:
+		cost := 0
+		for _, f := range t.filters {
+			cost = max(cost, getFilterCost(f))
+		}
+		return cost
+	case *filterOr:
+		cost := 0
+		for _, f := range t.filters {
+			cost += getFilterCost(f)
+		}
+		return cost
+	default:
+		return 50
+	}
+}
+
 func (fa *filterAnd) getByFieldTokens() []fieldTokens {
 	fa.byFieldTokensOnce.Do(fa.initByFieldTokens)
 	return fa.byFieldTokens
@@ -152,6 +220,9 @@ func getCommonTokensForAndFilters(filters []filter) []fieldTokens {
 		case *filterExactPrefix:
 			tokens := t.getTokens()
 			mergeFieldTokens(t.fieldName, tokens)
+		case *filterNear:
+			tokens := t.getTokens()
+			mergeFieldTokens(t.fieldName, tokens)
 		case *filterPatternMatch:
 			tokens := t.getTokens()
 			mergeFieldTokens(t.fieldName, tokens)
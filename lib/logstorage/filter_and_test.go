@@ -2,6 +2,7 @@ package logstorage
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -173,3 +174,38 @@ func TestGetCommonTokensForAndFilters(t *testing.T) {
 		},
 	})
 }
+
+func TestFilterAndGetFiltersOrdered(t *testing.T) {
+	f := func(qStr, resultExpected string) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error in ParseQuery: %s", err)
+		}
+		fa, ok := q.f.(*filterAnd)
+		if !ok {
+			t.Fatalf("unexpected filter type: %T; want *filterAnd", q.f)
+		}
+
+		var a []string
+		for _, f := range fa.getFiltersOrdered() {
+			a = append(a, f.String())
+		}
+		result := strings.Join(a, " ")
+		if result != resultExpected {
+			t.Fatalf("unexpected ordered filters; got\n%s\nwant\n%s", result, resultExpected)
+		}
+
+		// The original order of filters must be preserved in the string representation of the query
+		if s := fa.String(); s != qStr {
+			t.Fatalf("unexpected string representation of the filter; got\n%s\nwant\n%s", s, qStr)
+		}
+	}
+
+	f(`foo bar`, `foo bar`)
+	f(`~"foo.+bar" error`, `error ~"foo.+bar"`)
+	f(`x:~"a.+b" y:*foo* _time:5m z:>10 error`, `_time:5m error z:>10 y:*foo* x:~"a.+b"`)
+	f(`!~"x.+y" (foo or bar) !baz`, `!baz foo or bar !~"x.+y"`)
+	f(`(~"x.+y" or foo) ~"a.+b" bar`, `bar ~"a.+b" ~"x.+y" or foo`)
+}
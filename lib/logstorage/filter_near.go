@@ -0,0 +1,218 @@
+package logstorage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// filterNear matches values containing the given words located at most maxDistance words from each other.
+//
+// Example LogsQL: `fieldName:near(foo, bar, 3)`
+type filterNear struct {
+	fieldName   string
+	word1       string
+	word2       string
+	maxDistance int
+
+	tokensOnce   sync.Once
+	tokens       []string
+	tokensHashes []uint64
+
+	// tokenPairsHashes contains bloom filter hashes for every possible (word1, word2) and (word2, word1) pairs at distance up to maxDistance.
+	tokenPairsHashes [][]uint64
+
+	prefixFilter     prefixfilter.Filter
+	prefixFilterOnce sync.Once
+}
+
+func (fn *filterNear) String() string {
+	return fmt.Sprintf("%snear(%s, %s, %d)", quoteFieldNameIfNeeded(fn.fieldName), quoteTokenIfNeeded(fn.word1), quoteTokenIfNeeded(fn.word2), fn.maxDistance)
+}
+
+func (fn *filterNear) updateNeededFields(pf *prefixfilter.Filter) {
+	pf.AddAllowFilter(fn.fieldName)
+}
+
+func (fn *filterNear) getTokens() []string {
+	fn.tokensOnce.Do(fn.initTokens)
+	return fn.tokens
+}
+
+func (fn *filterNear) getTokensHashes() []uint64 {
+	fn.tokensOnce.Do(fn.initTokens)
+	return fn.tokensHashes
+}
+
+func (fn *filterNear) getTokenPairsHashes() [][]uint64 {
+	fn.tokensOnce.Do(fn.initTokens)
+	return fn.tokenPairsHashes
+}
+
+func (fn *filterNear) initTokens() {
+	fn.tokens = tokenizeStrings(nil, []string{fn.word1, fn.word2})
+	fn.tokensHashes = appendTokensHashes(nil, fn.tokens)
+
+	if fn.maxDistance > MaxTokenPositionsDistance {
+		// The token positions index cannot be used for the given maxDistance.
+		return
+	}
+	var pairs [][]uint64
+	for d := 1; d <= fn.maxDistance; d++ {
+		pairs = append(pairs, appendTokenPairHashes(nil, fn.word1, fn.word2, d))
+		if fn.word1 != fn.word2 {
+			pairs = append(pairs, appendTokenPairHashes(nil, fn.word2, fn.word1, d))
+		}
+	}
+	fn.tokenPairsHashes = pairs
+}
+
+func (fn *filterNear) getPrefixFilter() *prefixfilter.Filter {
+	fn.prefixFilterOnce.Do(fn.initPrefixFilter)
+	return &fn.prefixFilter
+}
+
+func (fn *filterNear) initPrefixFilter() {
+	fn.prefixFilter.AddAllowFilter(fn.fieldName)
+}
+
+func (fn *filterNear) matchRow(fields []Field) bool {
+	v := getFieldValueByName(fields, fn.fieldName)
+	return fn.matchValue(v)
+}
+
+func (fn *filterNear) matchValue(v string) bool {
+	return matchNear(v, fn.word1, fn.word2, fn.maxDistance)
+}
+
+func (fn *filterNear) applyToBlockResult(br *blockResult, bm *bitmap) {
+	applyToBlockResultGeneric(br, bm, fn.fieldName, "", func(v, _ string) bool {
+		return fn.matchValue(v)
+	})
+}
+
+func (fn *filterNear) applyToBlockSearch(bs *blockSearch, bm *bitmap) {
+	fieldName := fn.fieldName
+
+	// Verify whether fn matches const column
+	v := bs.getConstColumnValue(fieldName)
+	if v != "" {
+		if !fn.matchValue(v) {
+			bm.resetBits()
+		}
+		return
+	}
+
+	// Verify whether fn matches other columns
+	ch := bs.getColumnHeader(fieldName)
+	if ch == nil {
+		// Fast path - there are no matching columns.
+		bm.resetBits()
+		return
+	}
+
+	switch ch.valueType {
+	case valueTypeString:
+		fn.matchString(bs, ch, bm)
+	case valueTypeDict:
+		bb := bbPool.Get()
+		for _, v := range ch.valuesDict.values {
+			c := byte(0)
+			if fn.matchValue(v) {
+				c = 1
+			}
+			bb.B = append(bb.B, c)
+		}
+		matchEncodedValuesDict(bs, ch, bm, bb.B)
+		bbPool.Put(bb)
+	case valueTypeUint8, valueTypeUint16, valueTypeUint32, valueTypeUint64, valueTypeInt64,
+		valueTypeFloat64, valueTypeIPv4, valueTypeTimestampISO8601:
+		// Slow path - convert the encoded values to strings and match them, since they may contain multiple tokens
+		fn.matchGeneric(bs, bm)
+	default:
+		logger.Panicf("FATAL: %s: unknown valueType=%d", bs.partPath(), ch.valueType)
+	}
+}
+
+func (fn *filterNear) matchString(bs *blockSearch, ch *columnHeader, bm *bitmap) {
+	tokens := fn.getTokensHashes()
+	if !matchBloomFilterAllTokens(bs, ch, tokens) {
+		bm.resetBits()
+		return
+	}
+
+	if ch.tokenPositionsMaxDistance >= fn.maxDistance {
+		// The block contains pairs of tokens at distance up to maxDistance in the bloom filter,
+		// so it can be skipped if none of the possible pairs for the given words is found there.
+		if !fn.matchBloomFilterAnyTokenPair(bs, ch) {
+			bm.resetBits()
+			return
+		}
+	}
+
+	visitValues(bs, ch, bm, fn.matchValue)
+}
+
+func (fn *filterNear) matchBloomFilterAnyTokenPair(bs *blockSearch, ch *columnHeader) bool {
+	pairs := fn.getTokenPairsHashes()
+	if len(pairs) == 0 {
+		return true
+	}
+	bf := bs.getBloomFilterForColumn(ch)
+	for _, pair := range pairs {
+		if bf.containsAll(pair) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fn *filterNear) matchGeneric(bs *blockSearch, bm *bitmap) {
+	br := getBlockResult()
+	br.mustInit(bs, bm)
+
+	pf := fn.getPrefixFilter()
+	br.initColumns(pf)
+
+	c := br.getColumnByName(fn.fieldName)
+	values := c.getValues(br)
+
+	srcIdx := 0
+	bm.forEachSetBit(func(_ int) bool {
+		ok := fn.matchValue(values[srcIdx])
+		srcIdx++
+		return ok
+	})
+
+	putBlockResult(br)
+}
+
+// matchNear returns true if s contains word1 and word2 tokens located at most maxDistance tokens from each other.
+func matchNear(s, word1, word2 string, maxDistance int) bool {
+	t := getTokenizer()
+	tokens := t.tokenizeString(nil, s, true)
+	putTokenizer(t)
+
+	lastPos1 := -1
+	lastPos2 := -1
+	for i, token := range tokens {
+		isWord1 := token == word1
+		isWord2 := token == word2
+		if isWord1 && lastPos2 >= 0 && i-lastPos2 <= maxDistance {
+			return true
+		}
+		if isWord2 && lastPos1 >= 0 && i-lastPos1 <= maxDistance {
+			return true
+		}
+		if isWord1 {
+			lastPos1 = i
+		}
+		if isWord2 {
+			lastPos2 = i
+		}
+	}
+	return false
+}
@@ -0,0 +1,334 @@
+package logstorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestMatchNear(t *testing.T) {
+	t.Parallel()
+
+	f := func(s, word1, word2 string, maxDistance int, resultExpected bool) {
+		t.Helper()
+		result := matchNear(s, word1, word2, maxDistance)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+		}
+	}
+
+	f("", "foo", "bar", 1, false)
+	f("foo", "foo", "bar", 1, false)
+	f("foo bar", "foo", "bar", 1, true)
+	f("foo bar", "bar", "foo", 1, true)
+	f("foo-bar", "foo", "bar", 1, true)
+	f("foo baz bar", "foo", "bar", 1, false)
+	f("foo baz bar", "foo", "bar", 2, true)
+	f("bar baz foo", "foo", "bar", 2, true)
+	f("foo a b c bar foo", "foo", "bar", 1, true)
+	f("foobar", "foo", "bar", 1, false)
+
+	// the same word must be seen twice
+	f("foo", "foo", "foo", 1, false)
+	f("foo foo", "foo", "foo", 1, true)
+	f("foo bar foo", "foo", "foo", 1, false)
+	f("foo bar foo", "foo", "foo", 2, true)
+}
+
+func TestFilterNear(t *testing.T) {
+	t.Parallel()
+
+	t.Run("const-column", func(t *testing.T) {
+		columns := []column{
+			{
+				name: "foo",
+				values: []string{
+					"abc def ghi",
+					"abc def ghi",
+					"abc def ghi",
+				},
+			},
+		}
+
+		// match
+		fn := &filterNear{
+			fieldName:   "foo",
+			word1:       "abc",
+			word2:       "ghi",
+			maxDistance: 2,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{0, 1, 2})
+
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "def",
+			word2:       "abc",
+			maxDistance: 1,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{0, 1, 2})
+
+		// mismatch
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "abc",
+			word2:       "ghi",
+			maxDistance: 1,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", nil)
+
+		fn = &filterNear{
+			fieldName:   "non-existing-column",
+			word1:       "abc",
+			word2:       "ghi",
+			maxDistance: 2,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", nil)
+	})
+
+	t.Run("dict", func(t *testing.T) {
+		columns := []column{
+			{
+				name: "foo",
+				values: []string{
+					"",
+					"foo bar",
+					"foo baz bar",
+					"bar foo",
+					"foo",
+					"bar",
+				},
+			},
+		}
+
+		// match
+		fn := &filterNear{
+			fieldName:   "foo",
+			word1:       "foo",
+			word2:       "bar",
+			maxDistance: 1,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{1, 3})
+
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "foo",
+			word2:       "bar",
+			maxDistance: 2,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{1, 2, 3})
+
+		// mismatch
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "foo",
+			word2:       "qwe",
+			maxDistance: 10,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", nil)
+	})
+
+	t.Run("strings", func(t *testing.T) {
+		columns := []column{
+			{
+				name: "foo",
+				values: []string{
+					"a foo",
+					"a foobar",
+					"aa abc a",
+					"ca afdf a,foobar baz",
+					"a fddf foobarbaz",
+					"a afoobarbaz foobar",
+					"a foobar baz",
+					"a kjlkjf dfff",
+					"a ТЕСТЙЦУК НГКШ ",
+					"a !!,23.(!1)",
+				},
+			},
+		}
+
+		// match
+		fn := &filterNear{
+			fieldName:   "foo",
+			word1:       "foobar",
+			word2:       "a",
+			maxDistance: 1,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{1, 3, 6})
+
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "a",
+			word2:       "foobar",
+			maxDistance: 2,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{1, 3, 5, 6})
+
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "ТЕСТЙЦУК",
+			word2:       "a",
+			maxDistance: 1,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{8})
+
+		// mismatch
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "foobar",
+			word2:       "abc",
+			maxDistance: 5,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", nil)
+	})
+
+	t.Run("ipv4", func(t *testing.T) {
+		columns := []column{
+			{
+				name: "foo",
+				values: []string{
+					"1.2.3.4",
+					"0.0.0.0",
+					"127.0.0.1",
+					"254.255.255.255",
+					"127.0.0.1",
+					"127.0.0.1",
+					"12.0.127.6",
+					"55.55.12.55",
+					"66.66.66.66",
+					"7.7.7.7",
+				},
+			},
+		}
+
+		// match
+		fn := &filterNear{
+			fieldName:   "foo",
+			word1:       "127",
+			word2:       "1",
+			maxDistance: 3,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{2, 4, 5})
+
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "12",
+			word2:       "127",
+			maxDistance: 2,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", []int{6})
+
+		// mismatch
+		fn = &filterNear{
+			fieldName:   "foo",
+			word1:       "127",
+			word2:       "1",
+			maxDistance: 2,
+		}
+		testFilterMatchForColumns(t, columns, fn, "foo", nil)
+	})
+}
+
+func TestFilterNearAndPhraseWithTokenPositions(t *testing.T) {
+	t.Parallel()
+
+	columns := []column{
+		{
+			name: "_msg",
+			values: []string{
+				"error: connection refused",
+				"connection error: refused",
+				"connection was refused with error",
+				"foo bar baz",
+				"foo bar baz",
+				"baz bar foo",
+				"filler 1",
+				"filler 2",
+				"filler 3",
+				"filler 4",
+				"filler 5",
+				"filler 6",
+				"filler 7",
+				"filler 8",
+			},
+		},
+	}
+
+	f := func(f filter, expectedRowIdxs []int) {
+		t.Helper()
+
+		for _, maxDistance := range []int{0, 1, 2, MaxTokenPositionsDistance} {
+			testFilterMatchForColumnsWithTokenPositions(t, columns, f, "_msg", expectedRowIdxs, maxDistance)
+		}
+	}
+
+	// phrase filter
+	f(&filterPhrase{
+		fieldName: "_msg",
+		phrase:    "connection refused",
+	}, []int{0})
+	f(&filterPhrase{
+		fieldName: "_msg",
+		phrase:    "foo bar",
+	}, []int{3, 4})
+	f(&filterPhrase{
+		fieldName: "_msg",
+		phrase:    "refused connection",
+	}, nil)
+
+	// near filter
+	f(&filterNear{
+		fieldName:   "_msg",
+		word1:       "connection",
+		word2:       "refused",
+		maxDistance: 1,
+	}, []int{0})
+	f(&filterNear{
+		fieldName:   "_msg",
+		word1:       "refused",
+		word2:       "connection",
+		maxDistance: 2,
+	}, []int{0, 1, 2})
+	f(&filterNear{
+		fieldName:   "_msg",
+		word1:       "foo",
+		word2:       "baz",
+		maxDistance: 2,
+	}, []int{3, 4, 5})
+	f(&filterNear{
+		fieldName:   "_msg",
+		word1:       "foo",
+		word2:       "error",
+		maxDistance: 10,
+	}, nil)
+}
+
+func testFilterMatchForColumnsWithTokenPositions(t *testing.T, columns []column, f filter, neededColumnName string, expectedRowIdxs []int, tokenPositionsMaxDistance int) {
+	t.Helper()
+
+	storagePath := t.Name()
+	cfg := &StorageConfig{
+		Retention:                 time.Duration(100 * 365 * nsecsPerDay),
+		TokenPositionsMaxDistance: tokenPositionsMaxDistance,
+	}
+	s := MustOpenStorage(storagePath, cfg)
+
+	tenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+	generateRowsFromColumns(s, tenantID, columns)
+
+	values := columns[0].values
+	expectedResults := make([]string, len(expectedRowIdxs))
+	expectedTimestamps := make([]int64, len(expectedRowIdxs))
+	for i, idx := range expectedRowIdxs {
+		expectedResults[i] = values[idx]
+		expectedTimestamps[i] = int64(idx) * 1e9
+	}
+
+	testFilterMatchForStorage(t, s, tenantID, f, neededColumnName, expectedResults, expectedTimestamps)
+
+	s.MustClose()
+	fs.MustRemoveDir(storagePath)
+}
@@ -156,6 +156,9 @@ func getCommonTokensForOrFilters(filters []filter) []fieldTokens {
 		case *filterExactPrefix:
 			tokens := t.getTokens()
 			mergeFieldTokens(t.fieldName, tokens)
+		case *filterNear:
+			tokens := t.getTokens()
+			mergeFieldTokens(t.fieldName, tokens)
 		case *filterPatternMatch:
 			tokens := t.getTokens()
 			mergeFieldTokens(t.fieldName, tokens)
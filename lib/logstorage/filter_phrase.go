@@ -29,6 +29,11 @@ type filterPhrase struct {
 	tokensOnce   sync.Once
 	tokens       []string
 	tokensHashes []uint64
+
+	// tokenPairsHashes contains bloom filter hashes for adjacent tokens in the phrase.
+	//
+	// It is used for skipping blocks with token positions index, which do not contain the given adjacent tokens.
+	tokenPairsHashes []uint64
 }
 
 func (fp *filterPhrase) String() string {
@@ -52,6 +57,12 @@ func (fp *filterPhrase) getTokensHashes() []uint64 {
 func (fp *filterPhrase) initTokens() {
 	fp.tokens = tokenizeStrings(nil, []string{fp.phrase})
 	fp.tokensHashes = appendTokensHashes(nil, fp.tokens)
+	fp.tokenPairsHashes = appendAdjacentTokenPairsHashes(nil, fp.phrase)
+}
+
+func (fp *filterPhrase) getTokenPairsHashes() []uint64 {
+	fp.tokensOnce.Do(fp.initTokens)
+	return fp.tokenPairsHashes
 }
 
 func (fp *filterPhrase) matchRow(fields []Field) bool {
@@ -91,7 +102,8 @@ func (fp *filterPhrase) applyToBlockSearch(bs *blockSearch, bm *bitmap) {
 
 	switch ch.valueType {
 	case valueTypeString:
-		matchStringByPhrase(bs, ch, bm, phrase, tokens)
+		tokenPairs := fp.getTokenPairsHashes()
+		matchStringByPhrase(bs, ch, bm, phrase, tokens, tokenPairs)
 	case valueTypeDict:
 		matchValuesDictByPhrase(bs, ch, bm, phrase)
 	case valueTypeUint8:
@@ -203,11 +215,15 @@ func matchValuesDictByPhrase(bs *blockSearch, ch *columnHeader, bm *bitmap, phra
 	bbPool.Put(bb)
 }
 
-func matchStringByPhrase(bs *blockSearch, ch *columnHeader, bm *bitmap, phrase string, tokens []uint64) {
+func matchStringByPhrase(bs *blockSearch, ch *columnHeader, bm *bitmap, phrase string, tokens, tokenPairs []uint64) {
 	if !matchBloomFilterAllTokens(bs, ch, tokens) {
 		bm.resetBits()
 		return
 	}
+	if !matchBloomFilterTokenPairs(bs, ch, tokenPairs) {
+		bm.resetBits()
+		return
+	}
 	visitValues(bs, ch, bm, func(v string) bool {
 		return matchPhrase(v, phrase)
 	})
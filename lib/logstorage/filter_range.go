@@ -264,6 +264,12 @@ func matchValuesDictByRange(bs *blockSearch, ch *columnHeader, bm *bitmap, minVa
 }
 
 func matchStringByRange(bs *blockSearch, ch *columnHeader, bm *bitmap, minValue, maxValue float64) {
+	if minValue > math.Float64frombits(ch.maxValue) || maxValue < math.Float64frombits(ch.minValue) {
+		// Fast path - the block has no numeric values in the given range.
+		bm.resetBits()
+		return
+	}
+
 	visitValues(bs, ch, bm, func(v string) bool {
 		return matchRange(v, minValue, maxValue)
 	})
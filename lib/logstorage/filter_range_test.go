@@ -213,6 +213,56 @@ func TestFilterRange(t *testing.T) {
 		testFilterMatchForColumns(t, columns, fr, "foo", nil)
 	})
 
+	t.Run("strings-durations", func(t *testing.T) {
+		columns := []column{
+			{
+				name: "foo",
+				values: []string{
+					"foo",
+					"1.5s",
+					"200ms",
+					"3s",
+					"bar",
+					"1m",
+					"5µs",
+					"2h",
+					"baz",
+					"10s",
+				},
+			},
+		}
+
+		// match
+		fr := &filterRange{
+			fieldName: "foo",
+			minValue:  2e9,
+			maxValue:  60e9,
+		}
+		testFilterMatchForColumns(t, columns, fr, "foo", []int{3, 5, 9})
+
+		fr = &filterRange{
+			fieldName: "foo",
+			minValue:  0,
+			maxValue:  1e6,
+		}
+		testFilterMatchForColumns(t, columns, fr, "foo", []int{6})
+
+		// mismatch
+		fr = &filterRange{
+			fieldName: "foo",
+			minValue:  3 * 3600e9,
+			maxValue:  1e18,
+		}
+		testFilterMatchForColumns(t, columns, fr, "foo", nil)
+
+		fr = &filterRange{
+			fieldName: "foo",
+			minValue:  -1e9,
+			maxValue:  1e3,
+		}
+		testFilterMatchForColumns(t, columns, fr, "foo", nil)
+	})
+
 	t.Run("uint8", func(t *testing.T) {
 		columns := []column{
 			{
@@ -23,6 +23,11 @@ type inmemoryPart struct {
 	columnsHeader      chunkedbuffer.Buffer
 	timestamps         chunkedbuffer.Buffer
 
+	fieldIndex          chunkedbuffer.Buffer
+	fieldIndexMetaindex chunkedbuffer.Buffer
+
+	streamHits chunkedbuffer.Buffer
+
 	messageBloomValues bloomValuesBuffer
 	fieldBloomValues   bloomValuesBuffer
 }
@@ -63,12 +68,20 @@ func (mp *inmemoryPart) reset() {
 	mp.columnsHeader.Reset()
 	mp.timestamps.Reset()
 
+	mp.fieldIndex.Reset()
+	mp.fieldIndexMetaindex.Reset()
+
+	mp.streamHits.Reset()
+
 	mp.messageBloomValues.reset()
 	mp.fieldBloomValues.reset()
 }
 
 // mustInitFromRows initializes mp from lr.
-func (mp *inmemoryPart) mustInitFromRows(lr *logRows) {
+//
+// tokenPositionsMaxDistance is the maximum distance between _msg tokens, which pairs must be stored in bloom filters.
+// indexedFields contains fields, which must be indexed in the field index.
+func (mp *inmemoryPart) mustInitFromRows(lr *logRows, tokenPositionsMaxDistance int, indexedFields []string, enableStreamHits bool) {
 	mp.reset()
 
 	sort.Sort(lr)
@@ -76,6 +89,9 @@ func (mp *inmemoryPart) mustInitFromRows(lr *logRows) {
 
 	bsw := getBlockStreamWriter()
 	bsw.MustInitForInmemoryPart(mp)
+	bsw.setTokenPositionsMaxDistance(tokenPositionsMaxDistance)
+	bsw.setIndexedFields(indexedFields)
+	bsw.setStreamHitsEnabled(enableStreamHits)
 	trs := getTmpRows()
 	var sidPrev *streamID
 	uncompressedBlockSizeBytes := uint64(0)
@@ -119,6 +135,9 @@ func (mp *inmemoryPart) MustStoreToDisk(path string) {
 	timestampsPath := filepath.Join(path, timestampsFilename)
 	messageValuesPath := filepath.Join(path, messageValuesFilename)
 	messageBloomFilterPath := filepath.Join(path, messageBloomFilename)
+	fieldIndexPath := filepath.Join(path, fieldIndexFilename)
+	fieldIndexMetaindexPath := filepath.Join(path, fieldIndexMetaindexFilename)
+	streamHitsPath := filepath.Join(path, streamHitsFilename)
 
 	var psw filestream.ParallelStreamWriter
 
@@ -129,6 +148,9 @@ func (mp *inmemoryPart) MustStoreToDisk(path string) {
 	psw.Add(columnsHeaderIndexPath, &mp.columnsHeaderIndex)
 	psw.Add(columnsHeaderPath, &mp.columnsHeader)
 	psw.Add(timestampsPath, &mp.timestamps)
+	psw.Add(fieldIndexPath, &mp.fieldIndex)
+	psw.Add(fieldIndexMetaindexPath, &mp.fieldIndexMetaindex)
+	psw.Add(streamHitsPath, &mp.streamHits)
 
 	psw.Add(messageBloomFilterPath, &mp.messageBloomValues.bloom)
 	psw.Add(messageValuesPath, &mp.messageBloomValues.values)
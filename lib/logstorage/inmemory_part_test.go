@@ -38,7 +38,7 @@ func TestInmemoryPartMustInitFromRows(t *testing.T) {
 
 		// Create inmemory part from lr
 		mp := getInmemoryPart()
-		mp.mustInitFromRows(&lr)
+		mp.mustInitFromRows(&lr, 0, nil, false)
 
 		// Check mp.ph
 		ph := &mp.ph
@@ -102,7 +102,7 @@ func TestInmemoryPartMustInitFromRows_Overflow(t *testing.T) {
 
 		// Create inmemory part from lr
 		mp := getInmemoryPart()
-		mp.mustInitFromRows(&lr)
+		mp.mustInitFromRows(&lr, 0, nil, false)
 
 		// Check mp.ph
 		ph := &mp.ph
@@ -160,7 +160,7 @@ func TestInmemoryPartInitFromBlockStreamReaders(t *testing.T) {
 			lr.mustAddRows(lrOrig)
 
 			mp := getInmemoryPart()
-			mp.mustInitFromRows(&lr)
+			mp.mustInitFromRows(&lr, 0, nil, false)
 			mpsSrc = append(mpsSrc, mp)
 
 			bsr := getBlockStreamReader()
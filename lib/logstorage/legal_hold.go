@@ -0,0 +1,242 @@
+package logstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// LegalHold describes a legal hold for logs.
+//
+// Logs matching the legal hold aren't deleted by retention and by delete tasks until the legal hold is released.
+type LegalHold struct {
+	// HoldID is the id of the legal hold
+	HoldID string `json:"hold_id"`
+
+	// TenantIDs are tenant ids for the legal hold
+	TenantIDs []TenantID `json:"tenant_ids"`
+
+	// Filter is the filter for logs under the legal hold
+	Filter string `json:"filter"`
+
+	// Reason is an optional human-readable reason for the legal hold
+	Reason string `json:"reason,omitempty"`
+
+	// CreatedAt is the time when the legal hold has been placed
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MarshalLegalHoldsToJSON marshals holds into a JSON array and returns the result
+func MarshalLegalHoldsToJSON(holds []*LegalHold) []byte {
+	if holds == nil {
+		// This is needed in order to return `[]` instead of `null`.
+		holds = []*LegalHold{}
+	}
+	data, err := json.Marshal(holds)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal legal holds: %s", err)
+	}
+	return data
+}
+
+// UnmarshalLegalHoldsFromJSON unmarshals LegalHold slice from JSON array at data
+func UnmarshalLegalHoldsFromJSON(data []byte) ([]*LegalHold, error) {
+	var holds []*LegalHold
+	if err := json.Unmarshal(data, &holds); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func mustReadLegalHoldsFromFile(path string) []*LegalHold {
+	if !fs.IsPathExist(path) {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read %s: %s", path, err)
+	}
+	holds, err := UnmarshalLegalHoldsFromJSON(data)
+	if err != nil {
+		logger.Panicf("FATAL: cannot parse legal holds from %s: %s", path, err)
+	}
+	return holds
+}
+
+func mustWriteLegalHoldsToFile(path string, holds []*LegalHold) {
+	data := MarshalLegalHoldsToJSON(holds)
+	fs.MustWriteAtomic(path, data, true)
+}
+
+// LegalHoldPlace places the legal hold with the given holdID on logs matching the given filter f for the given tenantIDs.
+//
+// Logs under the legal hold aren't deleted by retention and by delete tasks until the legal hold is released via LegalHoldRelease.
+// The timestamp must contain the time in nanoseconds when the legal hold is placed.
+func (s *Storage) LegalHoldPlace(_ context.Context, holdID string, timestamp int64, tenantIDs []TenantID, f *Filter, reason string) error {
+	if holdID == "" {
+		return fmt.Errorf("hold_id cannot be empty")
+	}
+	if len(tenantIDs) == 0 {
+		return fmt.Errorf("tenant_ids cannot be empty")
+	}
+
+	lh := &LegalHold{
+		HoldID:    holdID,
+		TenantIDs: append([]TenantID{}, tenantIDs...),
+		Filter:    f.String(),
+		Reason:    reason,
+		CreatedAt: time.Unix(0, timestamp).UTC(),
+	}
+
+	s.legalHoldsLock.Lock()
+	defer s.legalHoldsLock.Unlock()
+
+	for _, h := range s.legalHolds {
+		if h.HoldID == holdID {
+			return fmt.Errorf("the legal hold with hold_id=%q already exists", holdID)
+		}
+	}
+
+	s.legalHolds = append(s.legalHolds, lh)
+	s.mustSaveLegalHoldsLocked()
+
+	return nil
+}
+
+// LegalHoldRelease releases the legal hold with the given holdID placed via LegalHoldPlace.
+func (s *Storage) LegalHoldRelease(_ context.Context, holdID string) error {
+	s.legalHoldsLock.Lock()
+	defer s.legalHoldsLock.Unlock()
+
+	for i, h := range s.legalHolds {
+		if h.HoldID == holdID {
+			s.legalHolds = append(s.legalHolds[:i], s.legalHolds[i+1:]...)
+			s.mustSaveLegalHoldsLocked()
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find the legal hold with hold_id=%q", holdID)
+}
+
+// LegalHoldList returns the list of legal holds placed via LegalHoldPlace.
+func (s *Storage) LegalHoldList(_ context.Context) ([]*LegalHold, error) {
+	s.legalHoldsLock.Lock()
+	holds := append([]*LegalHold{}, s.legalHolds...)
+	s.legalHoldsLock.Unlock()
+
+	return holds, nil
+}
+
+// mustSaveLegalHoldsLocked saves s.legalHolds to file.
+//
+// s.legalHoldsLock must be locked while calling this function.
+func (s *Storage) mustSaveLegalHoldsLocked() {
+	legalHoldsPath := filepath.Join(s.path, legalHoldsFilename)
+	mustWriteLegalHoldsToFile(legalHoldsPath, s.legalHolds)
+}
+
+func (s *Storage) getLegalHolds() []*LegalHold {
+	s.legalHoldsLock.Lock()
+	holds := append([]*LegalHold{}, s.legalHolds...)
+	s.legalHoldsLock.Unlock()
+
+	return holds
+}
+
+// deleteTaskGroup is a group of tenants with the same filter for logs' deletion.
+type deleteTaskGroup struct {
+	tenantIDs []TenantID
+	filter    string
+}
+
+// getDeleteTaskGroups splits tenantIDs into groups with the same filter for deletion of logs matching the given filter.
+//
+// The filter for tenants under legal holds excludes logs matching these legal holds.
+func (s *Storage) getDeleteTaskGroups(tenantIDs []TenantID, filter string) []deleteTaskGroup {
+	holds := s.getLegalHolds()
+
+	var groups []deleteTaskGroup
+	var tenantIDsWithoutHolds []TenantID
+	for _, tenantID := range tenantIDs {
+		var holdFilters []string
+		for _, h := range holds {
+			if slices.Contains(h.TenantIDs, tenantID) {
+				holdFilters = append(holdFilters, "("+h.Filter+")")
+			}
+		}
+		if len(holdFilters) == 0 {
+			tenantIDsWithoutHolds = append(tenantIDsWithoutHolds, tenantID)
+			continue
+		}
+		groups = append(groups, deleteTaskGroup{
+			tenantIDs: []TenantID{tenantID},
+			filter:    fmt.Sprintf("(%s) !(%s)", filter, strings.Join(holdFilters, " or ")),
+		})
+	}
+	if len(tenantIDsWithoutHolds) > 0 {
+		groups = append(groups, deleteTaskGroup{
+			tenantIDs: tenantIDsWithoutHolds,
+			filter:    filter,
+		})
+	}
+	return groups
+}
+
+// getDaysWithoutLegalHolds returns days from the given days, which do not contain logs under legal holds.
+//
+// Partitions for the returned days can be dropped by retention.
+func (s *Storage) getDaysWithoutLegalHolds(ctx context.Context, days []int64) (map[int64]struct{}, error) {
+	holds := s.getLegalHolds()
+
+	m := make(map[int64]struct{}, len(days))
+	for _, day := range days {
+		isHeld := false
+		for _, h := range holds {
+			ok, err := s.hasLegalHoldLogs(ctx, h, day)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				isHeld = true
+				break
+			}
+		}
+		if !isHeld {
+			m[day] = struct{}{}
+		}
+	}
+	return m, nil
+}
+
+// hasLegalHoldLogs returns true if the partition for the given day contains logs matching the given legal hold h.
+func (s *Storage) hasLegalHoldLogs(ctx context.Context, h *LegalHold, day int64) (bool, error) {
+	qStr := h.Filter + " | limit 1"
+	q, err := ParseQueryAtTimestamp(qStr, time.Now().UnixNano())
+	if err != nil {
+		logger.Panicf("BUG: cannot parse query [%s] for the legal hold with hold_id=%q: %s", qStr, h.HoldID, err)
+	}
+	q.AddTimeFilter(day*nsecsPerDay, (day+1)*nsecsPerDay-1)
+
+	var qs QueryStats
+	qctx := NewQueryContext(ctx, &qs, h.TenantIDs, q, false, nil)
+
+	var found atomic.Bool
+	writeBlock := func(_ uint, db *DataBlock) {
+		if db.RowsCount() > 0 {
+			found.Store(true)
+		}
+	}
+	if err := s.RunQuery(qctx, writeBlock); err != nil {
+		return false, fmt.Errorf("cannot check for logs under the legal hold with hold_id=%q: %w", h.HoldID, err)
+	}
+	return found.Load(), nil
+}
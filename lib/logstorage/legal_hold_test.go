@@ -0,0 +1,154 @@
+package logstorage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageLegalHold(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	cfg := &StorageConfig{
+		Retention: time.Duration(100 * 365 * nsecsPerDay),
+	}
+	s := MustOpenStorage(path, cfg)
+
+	tenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+	otherTenantID := TenantID{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+
+	baseTimestamp := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+	lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+	for _, tid := range []TenantID{tenantID, otherTenantID} {
+		for i := 0; i < 300; i++ {
+			lr.MustAdd(tid, baseTimestamp+int64(i)*nsecsPerDay/100, []Field{
+				{Name: "host", Value: fmt.Sprintf("h%d", i%3)},
+				{Name: "_msg", Value: fmt.Sprintf("message %d", i)},
+			}, -1)
+		}
+	}
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	f := func(tid TenantID, qStr string, rowsCountExpected uint64) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tid}, q, false, nil)
+
+		var rowsCount atomic.Uint64
+		err = s.RunQuery(qctx, func(_ uint, db *DataBlock) {
+			rowsCount.Add(uint64(db.RowsCount()))
+		})
+		if err != nil {
+			t.Fatalf("unexpected error for query [%s]: %s", qStr, err)
+		}
+		if n := rowsCount.Load(); n != rowsCountExpected {
+			t.Fatalf("unexpected number of rows for query [%s] at tenant %s; got %d; want %d", qStr, tid, n, rowsCountExpected)
+		}
+	}
+
+	runDeleteTask := func(taskID, filter string) {
+		t.Helper()
+
+		fDelete, err := ParseFilter(filter)
+		if err != nil {
+			t.Fatalf("cannot parse filter: %s", err)
+		}
+		tenantIDs := []TenantID{tenantID, otherTenantID}
+		if err := s.DeleteRunTask(t.Context(), taskID, time.Now().UnixNano(), tenantIDs, fDelete); err != nil {
+			t.Fatalf("cannot run delete task: %s", err)
+		}
+		waitForDeleteTasks(t, s)
+	}
+
+	// Place the legal hold on h1 logs for the tenantID
+	fHold, err := ParseFilter(`{host="h1"}`)
+	if err != nil {
+		t.Fatalf("cannot parse filter: %s", err)
+	}
+	if err := s.LegalHoldPlace(t.Context(), "hold1", time.Now().UnixNano(), []TenantID{tenantID}, fHold, "investigation"); err != nil {
+		t.Fatalf("cannot place legal hold: %s", err)
+	}
+	if err := s.LegalHoldPlace(t.Context(), "hold1", time.Now().UnixNano(), []TenantID{tenantID}, fHold, ""); err == nil {
+		t.Fatalf("expecting non-nil error when placing the legal hold with duplicate hold_id")
+	}
+
+	// Logs under the legal hold must be preserved by delete tasks
+	runDeleteTask("task1", `{host=~"h0|h1"}`)
+	f(tenantID, "*", 200)
+	f(tenantID, `{host="h1"}`, 100)
+	f(otherTenantID, "*", 100)
+
+	// Legal holds must persist across restarts
+	s.MustClose()
+	s = MustOpenStorage(path, cfg)
+
+	holds, err := s.LegalHoldList(t.Context())
+	if err != nil {
+		t.Fatalf("cannot list legal holds: %s", err)
+	}
+	if len(holds) != 1 || holds[0].HoldID != "hold1" || holds[0].Filter != `{host="h1"}` || holds[0].Reason != "investigation" {
+		t.Fatalf("unexpected legal holds: %s", MarshalLegalHoldsToJSON(holds))
+	}
+
+	// Partitions with logs under the legal hold must be preserved by retention
+	days := []int64{baseTimestamp / nsecsPerDay, baseTimestamp/nsecsPerDay + 1, baseTimestamp/nsecsPerDay + 2}
+	ptwsToDelete := s.detachPartitionsForDays(days[:1])
+	if len(ptwsToDelete) != 0 {
+		t.Fatalf("unexpected number of partitions to delete; got %d; want 0", len(ptwsToDelete))
+	}
+	f(tenantID, "*", 200)
+
+	// Logs outside the legal hold must be deleted
+	runDeleteTask("task2", `{host="h2"}`)
+	f(tenantID, "*", 100)
+
+	// Release the legal hold
+	if err := s.LegalHoldRelease(t.Context(), "hold1"); err != nil {
+		t.Fatalf("cannot release legal hold: %s", err)
+	}
+	if err := s.LegalHoldRelease(t.Context(), "hold1"); err == nil {
+		t.Fatalf("expecting non-nil error when releasing missing legal hold")
+	}
+	holds, err = s.LegalHoldList(t.Context())
+	if err != nil {
+		t.Fatalf("cannot list legal holds: %s", err)
+	}
+	if len(holds) != 0 {
+		t.Fatalf("unexpected legal holds: %s", MarshalLegalHoldsToJSON(holds))
+	}
+
+	// Partitions without legal holds can be deleted
+	ptwsToDelete = s.detachPartitionsForDays(days[:1])
+	if len(ptwsToDelete) != 1 {
+		t.Fatalf("unexpected number of partitions to delete; got %d; want 1", len(ptwsToDelete))
+	}
+	for _, ptw := range ptwsToDelete {
+		ptw.mustDrop.Store(true)
+		ptw.decRef()
+	}
+	f(tenantID, "*", 67)
+
+	// Logs previously under the legal hold can be deleted now
+	runDeleteTask("task3", "*")
+	f(tenantID, "*", 0)
+	f(otherTenantID, "*", 0)
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
@@ -54,6 +54,9 @@ type LogRows struct {
 
 	// defaultMsgValue contains default value for missing _msg field
 	defaultMsgValue string
+
+	// streamLimiter is an optional limiter for log streams added via MustAdd.
+	streamLimiter StreamLimiter
 }
 
 type logRows struct {
@@ -99,9 +102,9 @@ func (lr *logRows) reset() {
 	lr.sf = nil
 }
 
-// needFlush returns true if lr contains too much data, so it must be flushed to the storage.
-func (lr *logRows) needFlush() bool {
-	return len(lr.a.b) > (maxUncompressedBlockSize/8)*7
+// needFlush returns true if lr contains more than maxSize bytes of data, so it must be flushed to the storage.
+func (lr *logRows) needFlush(maxSize int) bool {
+	return len(lr.a.b) > maxSize
 }
 
 func (lr *logRows) mustAddRows(src *LogRows) {
@@ -265,6 +268,8 @@ func (lr *LogRows) Reset() {
 	lr.extraStreamFields = lr.extraStreamFields[:0]
 
 	lr.defaultMsgValue = ""
+
+	lr.streamLimiter = nil
 }
 
 // RowsCount returns current log rows count
@@ -407,6 +412,15 @@ func (lr *LogRows) MustAdd(tenantID TenantID, timestamp int64, fields []Field, s
 	sid.tenantID = tenantID
 	sid.id = hash128(bb.B)
 
+	if lr.streamLimiter != nil && !lr.streamLimiter.AllowStream(tenantID, sid.id.lo) {
+		if !lr.streamLimiter.RerouteToCatchAllStream() {
+			bbPool.Put(bb)
+			return
+		}
+		bb.B = appendCatchAllStreamTagsCanonical(bb.B[:0])
+		sid.id = hash128(bb.B)
+	}
+
 	// Store the row
 	streamTagsCanonical := bytesutil.ToUnsafeString(bb.B)
 	lr.mustAddInternal(sid, timestamp, fields, streamTagsCanonical)
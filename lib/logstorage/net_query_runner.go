@@ -59,7 +59,8 @@ func NewNetQueryRunner(qctx *QueryContext, runNetQuery RunNetQueryFunc, writeNet
 //
 // netSearch must execute the given query q at remote storage nodes and pass results to writeBlock.
 func (nqr *NetQueryRunner) Run(ctx context.Context, concurrency int, netSearch func(stopCh <-chan struct{}, q *Query, writeBlock WriteDataBlockFunc) error) error {
-	search := func(stopCh <-chan struct{}, writeBlockToPipes writeBlockResultFunc) error {
+	search := func(stopCh <-chan struct{}, writeBlockToPipes writeBlockResultFunc, _ timeRangePruner) error {
+		// Time range pruning is performed by remote storage nodes, since they execute the first pipes from the query.
 		writeNetBlock := writeBlockToPipes.newDataBlockWriter()
 		return netSearch(stopCh, nqr.qRemote, writeNetBlock)
 	}
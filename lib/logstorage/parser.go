@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"maps"
 	"math"
+	"regexp/syntax"
 	"slices"
 	"strconv"
 	"strings"
@@ -401,6 +402,11 @@ type queryOptions struct {
 
 	// timeOffsetStr is a string representation of the timeOffset.
 	timeOffsetStr string
+
+	// readPreference is the preference for choosing vlstorage replicas in VictoriaLogs cluster setup.
+	//
+	// See IsValidReadPreference for the list of supported values.
+	readPreference string
 }
 
 func (opts *queryOptions) String() string {
@@ -420,6 +426,9 @@ func (opts *queryOptions) String() string {
 	if opts.timeOffsetStr != "" {
 		a = append(a, fmt.Sprintf("time_offset=%s", opts.timeOffsetStr))
 	}
+	if opts.readPreference != "" {
+		a = append(a, fmt.Sprintf("read_preference=%s", opts.readPreference))
+	}
 	if len(a) == 0 {
 		return ""
 	}
@@ -903,6 +912,7 @@ func (q *Query) optimize() {
 func (q *Query) optimizeNoSubqueries() {
 	q.pipes = optimizeOffsetLimitPipes(q.pipes)
 	q.pipes = optimizeUniqLimitPipes(q.pipes)
+	q.pipes = pushDownFilterPipes(q.pipes)
 	q.pipes = optimizeFilterPipes(q.pipes)
 
 	// Merge `q | filter ...` into q.
@@ -1124,6 +1134,14 @@ func (q *Query) GetStatsLabelsAddGroupingByTime(step int64) ([]string, error) {
 			for _, f := range t.funcs {
 				addToMetricFields(f.resultName)
 			}
+		case *pipeCompare:
+			// `| compare ...` pipe adds baseline and delta metrics for every metric from the preceding `stats` pipe.
+			for i := range ps.funcs {
+				resultName := ps.funcs[i].resultName
+				addToMetricFields(resultName + "_baseline")
+				addToMetricFields(resultName + "_delta")
+				addToMetricFields(resultName + "_delta_percent")
+			}
 		case *pipeMath:
 			// Allow `| math ...` pipe, since it adds additional metrics to the given set of fields.
 			for _, me := range t.entries {
@@ -1613,6 +1631,87 @@ func optimizeFilterPipes(pipes []pipe) []pipe {
 	return pipes
 }
 
+// pushDownFilterPipes moves `| filter ...` pipes in front of the preceding `| copy ...` and `| rename ...` pipes when possible.
+//
+// This allows merging the filter into the query filter, which is executed at the storage level
+// with the help of bloom filters and column stats.
+func pushDownFilterPipes(pipes []pipe) []pipe {
+	for i := 1; i < len(pipes); i++ {
+		pf, ok := pipes[i].(*pipeFilter)
+		if !ok {
+			continue
+		}
+
+		var fNew filter
+		switch t := pipes[i-1].(type) {
+		case *pipeCopy:
+			fNew, ok = getFilterBeforeFieldsCopy(pf.f, t.srcFieldFilters, t.dstFieldFilters, false)
+		case *pipeRename:
+			fNew, ok = getFilterBeforeFieldsCopy(pf.f, t.srcFieldFilters, t.dstFieldFilters, true)
+		default:
+			ok = false
+		}
+		if !ok {
+			continue
+		}
+
+		pipes[i-1], pipes[i] = &pipeFilter{f: fNew}, pipes[i-1]
+		if i > 1 {
+			// Try pushing down the filter further
+			i -= 2
+		}
+	}
+	return pipes
+}
+
+// getFilterBeforeFieldsCopy returns the filter, which is equivalent to f applied after copying or renaming srcFieldFilters to dstFieldFilters.
+//
+// It returns false if such a filter cannot be built.
+func getFilterBeforeFieldsCopy(f filter, srcFieldFilters, dstFieldFilters []string, isRename bool) (filter, bool) {
+	// Field copying and renaming is performed sequentially, so the filter must be updated in the reverse order.
+	for i := len(srcFieldFilters) - 1; i >= 0; i-- {
+		srcFieldFilter := srcFieldFilters[i]
+		dstFieldFilter := dstFieldFilters[i]
+		if srcFieldFilter == dstFieldFilter {
+			continue
+		}
+
+		var pf prefixfilter.Filter
+		f.updateNeededFields(&pf)
+		if !pf.MatchStringOrWildcard(dstFieldFilter) && !(isRename && pf.MatchStringOrWildcard(srcFieldFilter)) {
+			// The filter doesn't depend on the copied or renamed fields
+			continue
+		}
+
+		if prefixfilter.IsWildcardFilter(srcFieldFilter) || prefixfilter.IsWildcardFilter(dstFieldFilter) {
+			return nil, false
+		}
+		if isRename && pf.MatchString(srcFieldFilter) {
+			// The filter depends on the field, which is removed by rename.
+			return nil, false
+		}
+		if isSpecialFieldName(srcFieldFilter) || isSpecialFieldName(dstFieldFilter) {
+			return nil, false
+		}
+
+		fNew, ok := renameFilterFields(f, dstFieldFilter, srcFieldFilter)
+		if !ok {
+			return nil, false
+		}
+		f = fNew
+	}
+	return f, true
+}
+
+func isSpecialFieldName(fieldName string) bool {
+	switch fieldName {
+	case "_time", "_stream", "_stream_id":
+		return true
+	default:
+		return false
+	}
+}
+
 func mergeFiltersAnd(f1, f2 filter) filter {
 	fa1, ok := f1.(*filterAnd)
 	if ok {
@@ -1669,6 +1768,32 @@ func (q *Query) HasGlobalTimeFilter() bool {
 	return start != math.MinInt64 && end != math.MaxInt64
 }
 
+// HasOnlyTimeFilters returns true if q selects all the logs on the time range set by global _time filters.
+//
+// Pipes in q are ignored.
+func (q *Query) HasOnlyTimeFilters() bool {
+	if q.opts.timeOffset != 0 {
+		return false
+	}
+	switch t := q.f.(type) {
+	case *filterNoop, *filterTime:
+		return true
+	case *filterPrefix:
+		return isMsgFieldName(t.fieldName) && t.prefix == ""
+	case *filterAnd:
+		for _, f := range t.filters {
+			switch f.(type) {
+			case *filterNoop, *filterTime:
+			default:
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
 // ParseQueryAtTimestamp parses s in the context of the given timestamp.
 //
 // E.g. _time:duration filters are adjusted according to the provided timestamp as _time:[timestamp-duration, duration].
@@ -1884,6 +2009,12 @@ func parseQueryOptions(dstOpts *queryOptions, lex *lexer) error {
 			dstOpts.timeOffset = timeOffset
 			dstOpts.timeOffsetStr = v
 			dstOpts.needPrint = true
+		case "read_preference":
+			if !IsValidReadPreference(v) {
+				return fmt.Errorf("unsupported 'read_preference=%q' option; supported values: any, freshest, zone-local", v)
+			}
+			dstOpts.readPreference = v
+			dstOpts.needPrint = true
 		default:
 			return fmt.Errorf("unexpected option %q with value %q", k, v)
 		}
@@ -2043,6 +2174,8 @@ func parseFilterGeneric(lex *lexer, fieldName string) (filter, error) {
 		return parseFilterLenRange(lex, fieldName)
 	case lex.isKeyword("lt_field"):
 		return parseFilterLtField(lex, fieldName)
+	case lex.isKeyword("near"):
+		return parseFilterNear(lex, fieldName)
 	case lex.isKeyword("pattern_match"):
 		return parseFilterPatternMatch(lex, fieldName)
 	case lex.isKeyword("pattern_match_full"):
@@ -2406,6 +2539,37 @@ func parseFilterSequence(lex *lexer, fieldName string) (filter, error) {
 	})
 }
 
+func parseFilterNear(lex *lexer, fieldName string) (filter, error) {
+	return parseFuncArgs(lex, fieldName, func(funcName string, args []string) (filter, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("unexpected number of args for %s(); got %d; want 3", funcName, len(args))
+		}
+
+		for _, word := range args[:2] {
+			tokens := tokenizeStrings(nil, []string{word})
+			if len(tokens) != 1 || tokens[0] != word {
+				return nil, fmt.Errorf("%s() arg %q must contain a single word", funcName, word)
+			}
+		}
+
+		maxDistance, err := parseUint(args[2])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse maxDistance at %s(): %w", funcName, err)
+		}
+		if maxDistance < 1 || maxDistance > 1000 {
+			return nil, fmt.Errorf("maxDistance at %s() must be in the range [1..1000]; got %d", funcName, maxDistance)
+		}
+
+		fn := &filterNear{
+			fieldName:   getCanonicalColumnName(fieldName),
+			word1:       args[0],
+			word2:       args[1],
+			maxDistance: int(maxDistance),
+		}
+		return fn, nil
+	})
+}
+
 func parseFilterEqField(lex *lexer, fieldName string) (filter, error) {
 	return parseFuncArg(lex, fieldName, func(arg string) (filter, error) {
 		fe := &filterEqField{
@@ -2488,6 +2652,12 @@ func newFilterRegexp(fieldName, arg string) (filter, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid regexp %q:%q: %w", getCanonicalColumnName(fieldName), arg, err)
 	}
+
+	// Substitute anchored regexps such as `^foo` and `^foo$` with faster exact prefix and exact filters.
+	if f := tryGetFilterForAnchoredRegexp(fieldName, arg); f != nil {
+		return f, nil
+	}
+
 	fr := &filterRegexp{
 		fieldName: getCanonicalColumnName(fieldName),
 		re:        re,
@@ -2495,6 +2665,77 @@ func newFilterRegexp(fieldName, arg string) (filter, error) {
 	return fr, nil
 }
 
+// tryGetFilterForAnchoredRegexp returns an exact prefix filter for `^prefix` and `^prefix.*` regexps
+// and an exact filter for `^value$` regexps.
+//
+// It returns nil if the regexp cannot be substituted with these filters.
+func tryGetFilterForAnchoredRegexp(fieldName, arg string) filter {
+	sre, err := syntax.Parse(arg, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	sre = sre.Simplify()
+	if sre.Op != syntax.OpConcat || len(sre.Sub) < 2 || len(sre.Sub) > 3 {
+		return nil
+	}
+	if sre.Sub[0].Op != syntax.OpBeginText {
+		return nil
+	}
+	lit := sre.Sub[1]
+	if lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 {
+		return nil
+	}
+	value := string(lit.Rune)
+
+	if len(sre.Sub) == 2 || isRegexpDotStar(sre.Sub[2]) {
+		return &filterExactPrefix{
+			fieldName: getCanonicalColumnName(fieldName),
+			prefix:    value,
+		}
+	}
+	if sre.Sub[2].Op == syntax.OpEndText && isCanonicalExactValue(value) {
+		return &filterExact{
+			fieldName: getCanonicalColumnName(fieldName),
+			value:     value,
+		}
+	}
+	return nil
+}
+
+func isRegexpDotStar(sre *syntax.Regexp) bool {
+	if sre.Op != syntax.OpStar {
+		return false
+	}
+	op := sre.Sub[0].Op
+	return op == syntax.OpAnyChar || op == syntax.OpAnyCharNotNL
+}
+
+// isCanonicalExactValue returns true if the exact filter for v matches the same values as the `^v$` regexp.
+//
+// This isn't the case for non-canonical numeric, IPv4 and timestamp values, since the exact filter
+// compares them with the values stored in numeric, IPv4 and timestamp columns after parsing.
+func isCanonicalExactValue(v string) bool {
+	if v == "" {
+		return false
+	}
+	if n, ok := tryParseUint64(v); ok {
+		return strconv.FormatUint(n, 10) == v
+	}
+	if n, ok := tryParseInt64(v); ok {
+		return strconv.FormatInt(n, 10) == v
+	}
+	if _, ok := tryParseFloat64Exact(v); ok {
+		return false
+	}
+	if _, ok := tryParseIPv4(v); ok {
+		return false
+	}
+	if _, ok := tryParseTimestampISO8601(v); ok {
+		return false
+	}
+	return true
+}
+
 func parseFilterStar(lex *lexer, fieldName string) (filter, error) {
 	lex.nextToken()
 
@@ -3546,7 +3787,14 @@ func parseFilterStreamID(lex *lexer, fieldName string) (filter, error) {
 	lex.nextToken()
 
 	if lex.isKeyword("in") {
-		return parseFilterStreamIDIn(lex)
+		// Verify whether this is in(...) filter, since `_stream_id:in` must be parsed as a stream id.
+		lexState := lex.backupState()
+		lex.nextToken()
+		isFunc := lex.isKeyword("(")
+		lex.restoreState(lexState)
+		if isFunc {
+			return parseFilterStreamIDIn(lex)
+		}
 	}
 
 	sid, err := parseStreamID(lex)
@@ -3767,6 +4015,10 @@ func needQuoteToken(s string) bool {
 	if isPipeName(sLower) || isStatsFuncName(sLower) {
 		return true
 	}
+	if slices.Contains(glueCompoundTokens, s) {
+		// Single-char compound tokens with glue chars are disallowed by lexer.nextCompoundToken.
+		return true
+	}
 	for _, r := range s {
 		if !isTokenRune(r) && r != '.' {
 			return true
@@ -3829,6 +4081,7 @@ var reservedKeywords = func() map[string]struct{} {
 		"le_field",
 		"len_range",
 		"lt_field",
+		"near",
 		"pattern_match",
 		"pattern_match_full",
 		"range",
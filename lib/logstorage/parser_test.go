@@ -221,6 +221,10 @@ func TestQuery_AddTimeFilter(t *testing.T) {
 	f(`options(allow_partial_response=true) * | count() x`, `options(allow_partial_response=true) _time:[2024-12-25T14:56:43.000000000Z,2025-01-13T12:45:34.999999999Z] | stats count(*) as x`)
 	f(`options(allow_partial_response=false) * | count() x`, `options(allow_partial_response=false) _time:[2024-12-25T14:56:43.000000000Z,2025-01-13T12:45:34.999999999Z] | stats count(*) as x`)
 
+	// read_preference option
+	f(`options(read_preference=freshest) *`, `options(read_preference=freshest) _time:[2024-12-25T14:56:43.000000000Z,2025-01-13T12:45:34.999999999Z]`)
+	f(`options(read_preference=zone-local, allow_partial_response=true) *`, `options(allow_partial_response=true, read_preference=zone-local) _time:[2024-12-25T14:56:43.000000000Z,2025-01-13T12:45:34.999999999Z]`)
+
 	// time_offset option
 	f(`options(time_offset=1d3h534ms) *`, `options(time_offset=1d3h534ms) _time:[2024-12-25T14:56:43.000000000Z,2025-01-13T12:45:34.999999999Z]`)
 	f(`options(time_offset = -1.5h) _time:2024Z`, `options(time_offset=-1.5h) _time:[2024-12-25T14:56:43.000000000Z,2025-01-13T12:45:34.999999999Z] _time:2024Z`)
@@ -416,6 +420,72 @@ func TestParseQuery_OptimizeOffsetLimitPipes(t *testing.T) {
 	f(`* | offset 3 | limit 10 | offset 5 | limit 30 | limit 0`, `* | limit 0`)
 }
 
+func TestParseQuery_PushDownFilterPipes(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+
+		q, err := ParseQuery(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := q.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// filters below rename pipe
+	f(`* | rename a as b | filter b:x`, `a:x | rename a as b`)
+	f(`foo | rename a as b | filter b:x c:y`, `foo a:x c:y | rename a as b`)
+	f(`* | rename a as b, c as d | filter b:~"x.+y" or d:>10`, `a:~"x.+y" or c:>10 | rename a as b, c as d`)
+	f(`* | mv a b | filter b:=foo*`, `a:=foo* | rename a as b`)
+
+	// filters below copy pipe
+	f(`* | copy a as b | filter b:x a:y`, `a:x a:y | copy a as b`)
+	f(`* | copy a as b | filter foo`, `foo | copy a as b`)
+
+	// filters below multiple pipes
+	f(`* | copy a as b | rename b as c | filter c:x`, `a:x | copy a as b | rename b as c`)
+
+	// filters, which cannot be pushed down
+	f(`* | rename a as b | filter a:x`, `* | rename a as b | filter a:x`)
+	f(`* | rename a* as b* | filter bc:x`, `* | rename a* as b* | filter bc:x`)
+	f(`* | rename a as _time | filter _time:5m`, `* | rename a as _time | filter _time:5m`)
+	f(`* | rename a as b | filter b:eq_field(c)`, `* | rename a as b | filter b:eq_field(c)`)
+	f(`* | rename a as b | stats count() x | filter x:>10`, `* | rename a as b | stats count(*) as x | filter x:>10`)
+}
+
+func TestParseQuery_OptimizeAnchoredRegexpFilters(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+
+		q, err := ParseQuery(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := q.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// regexps, which can be substituted with faster filters
+	f(`a:~"^foo"`, `a:=foo*`)
+	f(`a:~"^foo.*"`, `a:=foo*`)
+	f(`~"^foo bar"`, `="foo bar"*`)
+	f(`a:~"^foo$"`, `a:=foo`)
+	f(`a:~"^123$"`, `a:=123`)
+	f(`a:~"^0123$"`, `a:=0123`)
+
+	// regexps, which cannot be substituted
+	f(`a:~"foo"`, `a:~foo`)
+	f(`a:~"^foo.+"`, `a:~"^foo.+"`)
+	f(`a:~"(?i)^foo"`, `a:~"(?i)^foo"`)
+	f(`a:~"^$"`, `a:~"^$"`)
+	f(`a:~"^1.5$"`, `a:~"^1.5$"`)
+	f(`a:~"^foo|bar"`, `a:~"^foo|bar"`)
+}
+
 func TestParseQuery_OptimizeStarFilters(t *testing.T) {
 	f := func(s, resultExpected string) {
 		t.Helper()
@@ -1685,6 +1755,11 @@ func TestParseQuery_Success(t *testing.T) {
 	f(`seq("foo, bar", baz, abc)`, `seq("foo, bar",baz,abc)`)
 	f(`foo:seq(foo,bar-baz+aa, b)`, `foo:seq(foo,"bar-baz+aa",b)`)
 
+	// near filter
+	f(`near(foo, bar, 3)`, `near(foo, bar, 3)`)
+	f(`foo:near("abc", "Абв", 1)`, `foo:near(abc, Абв, 1)`)
+	f(`near(foo,foo,2)`, `near(foo, foo, 2)`)
+
 	// string_range filter
 	f(`string_range(foo, bar)`, `string_range(foo, bar)`)
 	f(`foo:string_range("foo, bar", baz)`, `foo:string_range("foo, bar", baz)`)
@@ -2270,6 +2345,7 @@ func TestParseQuery_Failure(t *testing.T) {
 	// invalid _stream_id filters
 	f("_stream_id:")
 	f("_stream_id:foo")
+	f("_stream_id:in")
 	f("_stream_id:()")
 	f("_stream_id:in(foo)")
 	f("_stream_id:in(foo | bar)")
@@ -2532,6 +2608,17 @@ func TestParseQuery_Failure(t *testing.T) {
 	f(`seq(foo bar)`)
 	f(`seq(foo, bar`)
 
+	// invalid near filter
+	f(`near()`)
+	f(`near(foo, bar)`)
+	f(`near(foo, bar, 3, 4)`)
+	f(`near(foo bar, baz, 3)`)
+	f(`near(foo, "bar-baz", 3)`)
+	f(`near(foo, bar, baz)`)
+	f(`near(foo, bar, 0)`)
+	f(`near(foo, bar, 1001)`)
+	f(`near(foo, bar, 3`)
+
 	// invalid string_range
 	f(`string_range(`)
 	f(`string_range(,)`)
@@ -2842,6 +2929,7 @@ func TestParseQuery_Failure(t *testing.T) {
 	f(`options(time_offset=foo)`)
 	f(`options(ignore_global_time_filter=123)`)
 	f(`options(allow_partial_response=123)`)
+	f(`options(read_preference=foo)`)
 
 	// valid options, but missing query filter
 	f(`options(concurrency=12)`)
@@ -3274,6 +3362,15 @@ func TestQueryGetNeededColumns(t *testing.T) {
 	f(`* | json_array_len (x) y | count() r1`, ``, ``)
 	f(`* | len(a) as b | count() r1`, ``, ``)
 	f(`* | hash(a) as b | count() r1`, ``, ``)
+
+	// wildcard copy and rename must fetch only the needed source fields
+	f(`* | copy a* as b* | stats count_uniq(b1) r1`, `a1,b1`, ``)
+	f(`* | rename a* as b* | stats count_uniq(b1, c) r1`, `a1,b1,c`, ``)
+	f(`* | rename a* as b* | fields b*`, `a*,b*`, ``)
+
+	// unpack_syslog with result_prefix mustn't fetch the source field if prefixed fields aren't needed
+	f(`* | unpack_syslog from x result_prefix p_ | stats count_uniq(y) r1`, `y`, ``)
+	f(`* | unpack_syslog from x result_prefix p_ | stats count_uniq(p_hostname) r1`, `p_hostname,x`, ``)
 }
 
 func TestQueryClone(t *testing.T) {
@@ -3952,6 +4049,39 @@ func TestQueryGetStatsLabels_Failure(t *testing.T) {
 	f(`* | by (x) count() y | format 'foo' as y`)
 }
 
+func TestQueryHasOnlyTimeFilters(t *testing.T) {
+	f := func(qStr string, resultExpected bool) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("cannot parse [%s]: %s", qStr, err)
+		}
+		result := q.HasOnlyTimeFilters()
+		if result != resultExpected {
+			t.Fatalf("unexpected result for HasOnlyTimeFilters(%q); got %v; want %v", qStr, result, resultExpected)
+		}
+
+		// The result mustn't change after adding global time filter.
+		q.AddTimeFilter(0, 1e18)
+		result = q.HasOnlyTimeFilters()
+		if result != resultExpected {
+			t.Fatalf("unexpected result for HasOnlyTimeFilters(%q) after adding time filter; got %v; want %v", qStr, result, resultExpected)
+		}
+	}
+
+	f(`*`, true)
+	f(`* | count()`, true)
+	f(`_time:5m`, true)
+	f(`_time:5m _time:2024-05-31Z | fields foo`, true)
+	f(`error`, false)
+	f(`_time:5m error`, false)
+	f(`foo:*`, false)
+	f(`_time:5m OR error`, false)
+	f(`{app="foo"}`, false)
+	f(`options(time_offset=1h) _time:5m`, false)
+}
+
 func TestQueryHasGlobalTimeFilter(t *testing.T) {
 	f := func(qStr string, resultExpected bool) {
 		t.Helper()
@@ -4121,3 +4251,90 @@ func TestAdjustEndTimestamp(t *testing.T) {
 	f("2025-08-13T17:05:00.123456Z", 1755104700123456999)    // Microsecond precision
 	f("2025-08-13T17:05:00.123456789Z", 1755104700123456789) // Nanosecond precision
 }
+
+func FuzzParseQuery(f *testing.F) {
+	seeds := []string{
+		"*",
+		"foo",
+		`"foo bar"`,
+		"foo*",
+		`foo:bar`,
+		`_msg:"foo bar" OR baz`,
+		`not foo and (bar or -baz)`,
+		`_time:5m`,
+		`_time:[2024-01-02T10:20:30Z, 2024-01-03T10:20:30Z)`,
+		`_time:1d offset 2h`,
+		`_time:day_range[08:00, 18:00) offset 2h`,
+		`_stream:{app="nginx",host=~"host-.+"}`,
+		`{app!="foo"} error`,
+		`_stream_id:in(0000007b000001c850d9950ea6196b1a4812081265faa1c7)`,
+		`i(foo) i(foo*)`,
+		`foo:in(a, "b c", *)`,
+		`foo:in(* | fields bar)`,
+		`foo:contains_all(a, b)`,
+		`foo:contains_any(a, b)`,
+		`ip:ipv4_range(1.2.3.0/24)`,
+		`foo:string_range(a, b)`,
+		`foo:range[1, 10.5)`,
+		`foo:>=10 bar:<-5.5`,
+		`foo:len_range(1, 10)`,
+		`foo:value_type(dict)`,
+		`foo:~"a.+b"`,
+		`foo:=bar foo:!=baz foo:~"x" foo:!~"y"`,
+		`seq("foo", "bar")`,
+		`foo:eq_field(bar)`,
+		`options(concurrency=2, ignore_global_time_filter=true) foo`,
+		`* | fields foo, bar | rename foo as baz | delete x`,
+		`* | stats by (host, _time:1h offset 30m) count() rows, sum(x) if (error) errs`,
+		`* | stats quantile(0.5, duration) p50, count_uniq(user) limit 10`,
+		`* | sort by (_time desc, foo) offset 10 limit 5`,
+		`* | first 3 by (x) partition by (host)`,
+		`* | uniq by (x, y) with hits limit 100`,
+		`* | top 5 by (host) hits as h`,
+		`* | extract "ip=<ip> " from _msg keep_original_fields`,
+		`* | extract_regexp if (foo) "(?P<ip>[0-9.]+)"`,
+		`* | unpack_json from foo fields (a, b) result_prefix "x."`,
+		`* | unpack_logfmt | unpack_syslog offset 5h`,
+		`* | format "<foo>:<bar>" as baz skip_empty_results`,
+		`* | math (x + y) * 2 / z as r, round(r, 0.1) as rr`,
+		`* | replace ("foo", "bar") at _msg limit 1`,
+		`* | replace_regexp ("f.+o", "bar")`,
+		`* | filter x:>10 | limit 10 | offset 5`,
+		`* | facets 3 max_values_per_field 10`,
+		`* | field_names | field_values foo limit 10`,
+		`* | join by (user) (foo | stats by (user) count() c) inner`,
+		`* | union (bar | fields x)`,
+		`* | running_stats sum(x) s | total_stats count() c`,
+		`* | json_array_len(foo) as n | split "," from foo as bar`,
+		`* | pack_json fields (a, b) as foo | pack_logfmt`,
+		`* | drop_empty_fields | copy a as b | len(a) as n`,
+		`* | collapse_nums prettify | block_stats | blocks_count`,
+		`* | sample 10 | hash(foo) as h | time_add 1h`,
+		`* | stream_context before 3 after 5`,
+		`foo | split " " as bar | unroll (bar)`,
+		`foo | generate_sequence 10 | query_stats`,
+		`foo:"bar\"baz" 'quoted' ` + "`raw`",
+		`# comment
+foo | stats count()`,
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		q, err := ParseQuery(s)
+		if err != nil {
+			return
+		}
+
+		// The string representation of the parsed query must be parsed into the same query.
+		qStr := q.String()
+		q2, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("cannot parse the string representation of the query %q: %s; string representation: %q", s, err, qStr)
+		}
+		if q2Str := q2.String(); q2Str != qStr {
+			t.Fatalf("unexpected string representation for the re-parsed query %q\ngot\n%s\nwant\n%s", s, q2Str, qStr)
+		}
+	})
+}
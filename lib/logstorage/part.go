@@ -47,6 +47,17 @@ type part struct {
 	oldBloomValues     bloomValuesReaderAt
 
 	bloomValuesShards []bloomValuesReaderAt
+
+	// fieldIndex contains the field index for the part.
+	//
+	// It is nil for parts created without the field index.
+	fieldIndex *fieldIndex
+
+	// streamHitsFile contains per-stream per-minute hits for the part.
+	//
+	// It is nil for parts created without per-stream hits.
+	streamHitsFile     fs.MustReadAtCloser
+	streamHitsFileSize uint64
 }
 
 type bloomValuesReaderAt struct {
@@ -89,6 +100,17 @@ func mustOpenInmemoryPart(pt *partition, mp *inmemoryPart) *part {
 	p.columnsHeaderFile = &mp.columnsHeader
 	p.timestampsFile = &mp.timestamps
 
+	// Read field index
+	fieldIndexMetaindexReader := mp.fieldIndexMetaindex.NewReader()
+	var frs readerWithStats
+	frs.init(fieldIndexMetaindexReader)
+	p.fieldIndex = mustReadFieldIndexMetaindex(&frs, &mp.fieldIndex)
+	fieldIndexMetaindexReader.MustClose()
+
+	// Open per-stream hits
+	p.streamHitsFile = &mp.streamHits
+	p.streamHitsFileSize = uint64(mp.streamHits.Len())
+
 	// Open files with bloom filters and column values
 	p.messageBloomValues.bloom = &mp.messageBloomValues.bloom
 	p.messageBloomValues.values = &mp.messageBloomValues.values
@@ -144,6 +166,24 @@ func mustOpenFilePart(pt *partition, path string) *part {
 	p.columnsHeaderFile = fs.MustOpenReaderAt(columnsHeaderPath)
 	p.timestampsFile = fs.MustOpenReaderAt(timestampsPath)
 
+	// Read field index
+	if p.ph.FormatVersion >= 6 {
+		fieldIndexMetaindexPath := filepath.Join(path, fieldIndexMetaindexFilename)
+		fieldIndexMetaindexReader := filestream.MustOpen(fieldIndexMetaindexPath, true)
+		var frs readerWithStats
+		frs.init(fieldIndexMetaindexReader)
+		fieldIndexFile := fs.MustOpenReaderAt(filepath.Join(path, fieldIndexFilename))
+		p.fieldIndex = mustReadFieldIndexMetaindex(&frs, fieldIndexFile)
+		frs.MustClose()
+	}
+
+	// Open per-stream hits
+	if p.ph.FormatVersion >= 7 {
+		streamHitsPath := filepath.Join(path, streamHitsFilename)
+		p.streamHitsFile = fs.MustOpenReaderAt(streamHitsPath)
+		p.streamHitsFileSize = fs.MustFileSize(streamHitsPath)
+	}
+
 	// Open files with bloom filters and column values
 	messageBloomFilterPath := filepath.Join(path, messageBloomFilename)
 	p.messageBloomValues.bloom = fs.MustOpenReaderAt(messageBloomFilterPath)
@@ -184,6 +224,12 @@ func mustClosePart(p *part) {
 	}
 	cs = append(cs, p.columnsHeaderFile)
 	cs = append(cs, p.timestampsFile)
+	if p.fieldIndex != nil {
+		cs = append(cs, p.fieldIndex.indexFile)
+	}
+	if p.streamHitsFile != nil {
+		cs = append(cs, p.streamHitsFile)
+	}
 	cs = p.messageBloomValues.appendClosers(cs)
 
 	if p.ph.FormatVersion < 1 {
@@ -218,6 +218,12 @@ func (pt *partition) debugFlush() {
 	pt.idb.debugFlush()
 }
 
+// mustFlushToFiles writes all the logs added to pt to disk parts.
+func (pt *partition) mustFlushToFiles() {
+	pt.idb.debugFlush()
+	pt.ddb.mustFlushToFiles()
+}
+
 // mustCreateSnapshot creates snapshot for the the given pt and returns full path to the created snapshot.
 func (pt *partition) mustCreateSnapshot() string {
 	logger.Infof("creating a snapshot for partition %q", pt.name)
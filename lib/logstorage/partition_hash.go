@@ -0,0 +1,241 @@
+package logstorage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// PartitionHash contains the Merkle hash for the sealed partition.
+//
+// See Storage.PartitionSeal.
+type PartitionHash struct {
+	// Partition is the name of the sealed partition in the YYYYMMDD format
+	Partition string `json:"partition"`
+
+	// SnapshotPath is the absolute path to the partition snapshot the RootHash is calculated for
+	SnapshotPath string `json:"snapshot_path"`
+
+	// RootHash is hex-encoded root of the Merkle tree for files at SnapshotPath
+	RootHash string `json:"root_hash"`
+
+	// FilesCount is the number of files at SnapshotPath covered by RootHash
+	FilesCount int `json:"files_count"`
+
+	// SealedAt is the time when the partition has been sealed
+	SealedAt time.Time `json:"sealed_at"`
+}
+
+// PartitionHashVerifyResult is the result of Storage.PartitionHashVerify.
+type PartitionHashVerifyResult struct {
+	PartitionHash
+
+	// ActualRootHash is hex-encoded root of the Merkle tree for files at SnapshotPath calculated during the verification
+	ActualRootHash string `json:"actual_root_hash"`
+
+	// Verified is set to true if ActualRootHash matches RootHash
+	Verified bool `json:"verified"`
+
+	// Error contains an error occurred during the verification
+	Error string `json:"error,omitempty"`
+}
+
+// MarshalPartitionHashesToJSON marshals hashes into a JSON array and returns the result
+func MarshalPartitionHashesToJSON(hashes []*PartitionHash) []byte {
+	if hashes == nil {
+		// This is needed in order to return `[]` instead of `null`.
+		hashes = []*PartitionHash{}
+	}
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal partition hashes: %s", err)
+	}
+	return data
+}
+
+func mustReadPartitionHashesFromFile(path string) []*PartitionHash {
+	if !fs.IsPathExist(path) {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read %s: %s", path, err)
+	}
+	var hashes []*PartitionHash
+	if err := json.Unmarshal(data, &hashes); err != nil {
+		logger.Panicf("FATAL: cannot parse partition hashes from %s: %s", path, err)
+	}
+	return hashes
+}
+
+// PartitionSeal seals the partition with the given name in the YYYYMMDD format.
+//
+// It creates a snapshot for the partition, calculates the Merkle hash for the files in the snapshot
+// and stores the hash, so it could be verified later via PartitionHashVerify.
+// Only partitions for the past days can be sealed, since partitions for the current day continue receiving new logs.
+func (s *Storage) PartitionSeal(name string) (*PartitionHash, error) {
+	day, err := getPartitionDayFromName(name)
+	if err != nil {
+		return nil, err
+	}
+	if currentDay := time.Now().UnixNano() / nsecsPerDay; day >= currentDay {
+		return nil, fmt.Errorf("cannot seal partition %q, since it may receive new logs; only partitions for the past days can be sealed", name)
+	}
+
+	snapshotPath, err := s.PartitionSnapshotCreate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rootHash, filesCount, err := getMerkleRootHash(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot calculate hash for partition %q: %w", name, err)
+	}
+
+	ph := &PartitionHash{
+		Partition:    name,
+		SnapshotPath: snapshotPath,
+		RootHash:     rootHash,
+		FilesCount:   filesCount,
+		SealedAt:     time.Now().UTC(),
+	}
+
+	s.partitionHashesLock.Lock()
+	s.partitionHashes = append(s.partitionHashes, ph)
+	partitionHashesPath := filepath.Join(s.path, partitionHashesFilename)
+	fs.MustWriteAtomic(partitionHashesPath, MarshalPartitionHashesToJSON(s.partitionHashes), true)
+	s.partitionHashesLock.Unlock()
+
+	logger.Infof("sealed partition %q at %q with root_hash=%s over %d files", name, snapshotPath, rootHash, filesCount)
+
+	return ph, nil
+}
+
+// PartitionHashList returns hashes for partitions sealed via PartitionSeal.
+func (s *Storage) PartitionHashList() []*PartitionHash {
+	s.partitionHashesLock.Lock()
+	hashes := append([]*PartitionHash{}, s.partitionHashes...)
+	s.partitionHashesLock.Unlock()
+
+	return hashes
+}
+
+// PartitionHashVerify verifies the hashes for all the snapshots of the partition with the given name sealed via PartitionSeal.
+func (s *Storage) PartitionHashVerify(name string) ([]*PartitionHashVerifyResult, error) {
+	var results []*PartitionHashVerifyResult
+	for _, ph := range s.PartitionHashList() {
+		if ph.Partition != name {
+			continue
+		}
+
+		r := &PartitionHashVerifyResult{
+			PartitionHash: *ph,
+		}
+		rootHash, filesCount, err := getMerkleRootHash(ph.SnapshotPath)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.ActualRootHash = rootHash
+			r.Verified = rootHash == ph.RootHash && filesCount == ph.FilesCount
+		}
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("partition %q hasn't been sealed", name)
+	}
+	return results, nil
+}
+
+// getMerkleRootHash returns hex-encoded root of the Merkle tree for all the files at the given dir and the number of these files.
+//
+// Leaves of the tree are hashes of relative file paths and file contents ordered by relative file paths.
+func getMerkleRootHash(dir string) (string, int, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, de os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot read files at %q: %w", dir, err)
+	}
+	sort.Strings(paths)
+
+	leaves := make([][]byte, 0, len(paths))
+	for _, relPath := range paths {
+		leaf, err := getMerkleLeafHash(dir, relPath)
+		if err != nil {
+			return "", 0, err
+		}
+		leaves = append(leaves, leaf)
+	}
+
+	root := getMerkleRoot(leaves)
+	return hex.EncodeToString(root), len(paths), nil
+}
+
+func getMerkleLeafHash(dir, relPath string) ([]byte, error) {
+	path := filepath.Join(dir, filepath.FromSlash(relPath))
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %q: %w", path, err)
+	}
+	defer f.Close()
+
+	contentHash := sha256.New()
+	if _, err := io.Copy(contentHash, f); err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", path, err)
+	}
+
+	// Use distinct prefixes for leaf and internal nodes in order to prevent second preimage attacks.
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write([]byte(relPath))
+	h.Write([]byte{0})
+	h.Write(contentHash.Sum(nil))
+	return h.Sum(nil), nil
+}
+
+// getMerkleRoot returns the root of the Merkle tree with the given leaves.
+//
+// The last node at every level without a pair is promoted to the upper level as is.
+func getMerkleRoot(nodes [][]byte) []byte {
+	if len(nodes) == 0 {
+		h := sha256.Sum256(nil)
+		return h[:]
+	}
+	for len(nodes) > 1 {
+		var upper [][]byte
+		for i := 0; i < len(nodes); i += 2 {
+			if i+1 == len(nodes) {
+				upper = append(upper, nodes[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write([]byte{1})
+			h.Write(nodes[i])
+			h.Write(nodes[i+1])
+			upper = append(upper, h.Sum(nil))
+		}
+		nodes = upper
+	}
+	return nodes[0]
+}
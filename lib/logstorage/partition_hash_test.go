@@ -0,0 +1,136 @@
+package logstorage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestGetMerkleRoot(t *testing.T) {
+	leaf := func(s string) []byte {
+		h := sha256.Sum256([]byte(s))
+		return h[:]
+	}
+	node := func(a, b []byte) []byte {
+		h := sha256.Sum256(append(append([]byte{1}, a...), b...))
+		return h[:]
+	}
+
+	f := func(leaves [][]byte, resultExpected []byte) {
+		t.Helper()
+
+		result := getMerkleRoot(leaves)
+		if !bytes.Equal(result, resultExpected) {
+			t.Fatalf("unexpected root; got %x; want %x", result, resultExpected)
+		}
+	}
+
+	emptyHash := sha256.Sum256(nil)
+	f(nil, emptyHash[:])
+
+	a, b, c := leaf("a"), leaf("b"), leaf("c")
+	f([][]byte{a}, a)
+	f([][]byte{a, b}, node(a, b))
+	f([][]byte{a, b, c}, node(node(a, b), c))
+	f([][]byte{a, b, c, a}, node(node(a, b), node(c, a)))
+}
+
+func TestStoragePartitionSeal(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	cfg := &StorageConfig{
+		Retention: time.Duration(100 * 365 * nsecsPerDay),
+	}
+	s := MustOpenStorage(path, cfg)
+
+	tenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+
+	now := time.Now().UnixNano()
+	yesterday := now - nsecsPerDay
+	lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+	for i := 0; i < 100; i++ {
+		for _, ts := range []int64{yesterday, now} {
+			lr.MustAdd(tenantID, ts, []Field{
+				{Name: "host", Value: fmt.Sprintf("h%d", i%3)},
+				{Name: "_msg", Value: fmt.Sprintf("message %d", i)},
+			}, -1)
+		}
+	}
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	// The partition for the current day cannot be sealed
+	if _, err := s.PartitionSeal(getPartitionNameFromDay(now / nsecsPerDay)); err == nil {
+		t.Fatalf("expecting non-nil error when sealing the partition for the current day")
+	}
+
+	// Missing partitions cannot be sealed
+	if _, err := s.PartitionSeal("20000101"); err == nil {
+		t.Fatalf("expecting non-nil error when sealing missing partition")
+	}
+
+	name := getPartitionNameFromDay(yesterday / nsecsPerDay)
+	ph, err := s.PartitionSeal(name)
+	if err != nil {
+		t.Fatalf("cannot seal partition: %s", err)
+	}
+	if ph.FilesCount == 0 {
+		t.Fatalf("expecting non-zero number of files in the sealed partition")
+	}
+
+	verify := func(verifiedExpected bool) {
+		t.Helper()
+
+		results, err := s.PartitionHashVerify(name)
+		if err != nil {
+			t.Fatalf("cannot verify partition hash: %s", err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("unexpected number of results; got %d; want 1", len(results))
+		}
+		if results[0].Verified != verifiedExpected {
+			t.Fatalf("unexpected verification result; got %v; want %v; result: %+v", results[0].Verified, verifiedExpected, results[0])
+		}
+	}
+
+	verify(true)
+
+	// Hashes must persist across restarts
+	s.MustClose()
+	s = MustOpenStorage(path, cfg)
+
+	hashes := s.PartitionHashList()
+	if len(hashes) != 1 || *hashes[0] != *ph {
+		t.Fatalf("unexpected partition hashes: %s", MarshalPartitionHashesToJSON(hashes))
+	}
+	verify(true)
+
+	// Tampering with the sealed data must be detected
+	metadataPath := filepath.Join(ph.SnapshotPath, datadbDirname, partsFilename)
+	data, err := os.ReadFile(metadataPath)
+	if err != nil {
+		t.Fatalf("cannot read %s: %s", metadataPath, err)
+	}
+	if err := os.WriteFile(metadataPath, append(data, ' '), 0o644); err != nil {
+		t.Fatalf("cannot write %s: %s", metadataPath, err)
+	}
+	verify(false)
+
+	if _, err := s.PartitionHashVerify("20000101"); err == nil {
+		t.Fatalf("expecting non-nil error when verifying unsealed partition")
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
@@ -0,0 +1,250 @@
+package logstorage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// pinnedView is a consistent set of partitions and parts pinned via Storage.PinView.
+//
+// Background merges, retention and deletion of logs do not change the logs visible via the pinned view,
+// since the view holds references to the pinned parts. This allows exporting big amounts of logs
+// via multiple queries without duplicate or missing logs.
+type pinnedView struct {
+	// id is the id of the view passed to Storage.PinView.
+	id string
+
+	// deadline is the time when the view is automatically unpinned.
+	deadline time.Time
+
+	// ptws contains pinned partitions sorted by day.
+	ptws []*partitionWrapper
+
+	// pwss contains pinned parts per every datadb of partitions in ptws.
+	pwss map[*datadb][]*partWrapper
+}
+
+func (pv *pinnedView) incRef() {
+	for _, ptw := range pv.ptws {
+		ptw.incRef()
+	}
+	for _, pws := range pv.pwss {
+		for _, pw := range pws {
+			pw.incRef()
+		}
+	}
+}
+
+func (pv *pinnedView) decRef() {
+	// Parts must be released before the partitions they belong to.
+	for _, pws := range pv.pwss {
+		for _, pw := range pws {
+			pw.decRef()
+		}
+	}
+	for _, ptw := range pv.ptws {
+		ptw.decRef()
+	}
+}
+
+// getPartitionsForTimeRange returns pinned partitions covered by [minTimestamp, maxTimestamp] time range.
+func (pv *pinnedView) getPartitionsForTimeRange(minTimestamp, maxTimestamp int64) []*partitionWrapper {
+	ptws := pv.ptws
+	minDay := minTimestamp / nsecsPerDay
+	n := sort.Search(len(ptws), func(i int) bool {
+		return ptws[i].day >= minDay
+	})
+	ptws = ptws[n:]
+	maxDay := maxTimestamp / nsecsPerDay
+	n = sort.Search(len(ptws), func(i int) bool {
+		return ptws[i].day > maxDay
+	})
+	return ptws[:n]
+}
+
+// getPartsForTimeRange returns pinned parts for the given ddb covered by [minTimestamp, maxTimestamp] time range.
+func (pv *pinnedView) getPartsForTimeRange(ddb *datadb, minTimestamp, maxTimestamp int64) []*partWrapper {
+	return appendPartsInTimeRange(nil, pv.pwss[ddb], minTimestamp, maxTimestamp)
+}
+
+// hasPartition returns true if pv contains ptw.
+func (pv *pinnedView) hasPartition(ptw *partitionWrapper) bool {
+	return slices.Contains(pv.ptws, ptw)
+}
+
+// PinView pins the current set of logs under the given viewID for the given ttl.
+//
+// Queries with QueryContext.ViewID set to viewID see only the logs pinned by this call
+// until the view is unpinned via UnpinView or until the ttl expires.
+// Newly ingested logs, background merges, retention and deletion of logs do not affect the pinned view.
+//
+// The pinned view prevents from deleting the pinned parts from disk, so it may increase disk space usage.
+func (s *Storage) PinView(_ context.Context, viewID string, ttl time.Duration) error {
+	if viewID == "" {
+		return fmt.Errorf("view_id cannot be empty")
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive; got %s", ttl)
+	}
+
+	s.pinnedViewsLock.Lock()
+	_, ok := s.pinnedViews[viewID]
+	s.pinnedViewsLock.Unlock()
+	if ok {
+		return fmt.Errorf("the view with view_id=%q is already pinned", viewID)
+	}
+
+	ptws, ptwsDecRef := s.getPartitionsForTimeRange(math.MinInt64, math.MaxInt64)
+	pv := &pinnedView{
+		id:       viewID,
+		deadline: time.Now().Add(ttl),
+		ptws:     ptws,
+		pwss:     make(map[*datadb][]*partWrapper, len(ptws)),
+	}
+	for _, ptw := range ptws {
+		ddb := ptw.pt.ddb
+		pws, _ := ddb.getPartsForTimeRange(math.MinInt64, math.MaxInt64)
+
+		// Pin the recently ingested rows, which aren't flushed to in-memory parts yet.
+		// They must be obtained after the remaining parts in the same way as datadb.search does.
+		recentPws, _ := ddb.getRecentPartsForTimeRange(math.MinInt64, math.MaxInt64)
+		pv.pwss[ddb] = append(pws, recentPws...)
+	}
+
+	s.pinnedViewsLock.Lock()
+	_, ok = s.pinnedViews[viewID]
+	if !ok {
+		s.pinnedViews[viewID] = pv
+	}
+	s.pinnedViewsLock.Unlock()
+
+	if ok {
+		// The view with the same id has been pinned concurrently.
+		for _, pws := range pv.pwss {
+			for _, pw := range pws {
+				pw.decRef()
+			}
+		}
+		ptwsDecRef()
+		return fmt.Errorf("the view with view_id=%q is already pinned", viewID)
+	}
+
+	return nil
+}
+
+// UnpinView unpins the view with the given viewID pinned via PinView.
+//
+// It is OK to call UnpinView for missing or already expired views.
+func (s *Storage) UnpinView(_ context.Context, viewID string) error {
+	s.pinnedViewsLock.Lock()
+	pv := s.pinnedViews[viewID]
+	delete(s.pinnedViews, viewID)
+	s.pinnedViewsLock.Unlock()
+
+	if pv != nil {
+		pv.decRef()
+	}
+	return nil
+}
+
+// acquirePinnedView returns the pinned view for the given viewID.
+//
+// The caller must call pvDecRef when the returned view is no longer needed.
+func (s *Storage) acquirePinnedView(viewID string) (pv *pinnedView, pvDecRef func(), err error) {
+	s.pinnedViewsLock.Lock()
+	pv = s.pinnedViews[viewID]
+	if pv != nil {
+		pv.incRef()
+	}
+	s.pinnedViewsLock.Unlock()
+
+	if pv == nil {
+		return nil, nil, fmt.Errorf("cannot find pinned view with view_id=%q; it may be already expired or unpinned", viewID)
+	}
+	return pv, pv.decRef, nil
+}
+
+// unpinViewsForPartition unpins all the views, which contain the given ptw.
+//
+// This allows detaching the partition without waiting until the pinned views expire.
+func (s *Storage) unpinViewsForPartition(ptw *partitionWrapper) {
+	var pvs []*pinnedView
+
+	s.pinnedViewsLock.Lock()
+	for viewID, pv := range s.pinnedViews {
+		if pv.hasPartition(ptw) {
+			pvs = append(pvs, pv)
+			delete(s.pinnedViews, viewID)
+		}
+	}
+	s.pinnedViewsLock.Unlock()
+
+	for _, pv := range pvs {
+		logger.Infof("unpinning the view with view_id=%q, since it contains the detached partition %q", pv.id, ptw.pt.name)
+		pv.decRef()
+	}
+}
+
+// unpinExpiredViews unpins views with the deadline smaller than the given currentTime.
+func (s *Storage) unpinExpiredViews(currentTime time.Time) {
+	var pvs []*pinnedView
+
+	s.pinnedViewsLock.Lock()
+	for viewID, pv := range s.pinnedViews {
+		if currentTime.After(pv.deadline) {
+			pvs = append(pvs, pv)
+			delete(s.pinnedViews, viewID)
+		}
+	}
+	s.pinnedViewsLock.Unlock()
+
+	for _, pv := range pvs {
+		pv.decRef()
+	}
+}
+
+// mustUnpinAllViews unpins all the views. It is called when the storage is closed.
+func (s *Storage) mustUnpinAllViews() {
+	s.pinnedViewsLock.Lock()
+	pvs := s.pinnedViews
+	s.pinnedViews = nil
+	s.pinnedViewsLock.Unlock()
+
+	for _, pv := range pvs {
+		pv.decRef()
+	}
+}
+
+func (s *Storage) runPinnedViewsWatcher() {
+	s.wg.Add(1)
+	go func() {
+		s.watchPinnedViews()
+		s.wg.Done()
+	}()
+}
+
+func (s *Storage) watchPinnedViews() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.unpinExpiredViews(time.Now())
+		}
+	}
+}
+
+func (s *Storage) getPinnedViewsCount() uint64 {
+	s.pinnedViewsLock.Lock()
+	n := len(s.pinnedViews)
+	s.pinnedViewsLock.Unlock()
+	return uint64(n)
+}
@@ -0,0 +1,153 @@
+package logstorage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStoragePinView(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	cfg := &StorageConfig{
+		Retention: time.Duration(100 * 365 * nsecsPerDay),
+	}
+	s := MustOpenStorage(path, cfg)
+
+	tenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+
+	baseTimestamp := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+	addRows := func(start, count int) {
+		lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+		for i := start; i < start+count; i++ {
+			lr.MustAdd(tenantID, baseTimestamp+int64(i)*1e9, []Field{
+				{Name: "host", Value: fmt.Sprintf("h%d", i%3)},
+				{Name: "_msg", Value: fmt.Sprintf("message %d", i)},
+			}, -1)
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+	}
+
+	getRowsCount := func(qStr, viewID string) (uint64, error) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tenantID}, q, false, nil)
+		qctx.ViewID = viewID
+
+		var rowsCount atomic.Uint64
+		err = s.RunQuery(qctx, func(_ uint, db *DataBlock) {
+			rowsCount.Add(uint64(db.RowsCount()))
+		})
+		return rowsCount.Load(), err
+	}
+
+	f := func(qStr, viewID string, rowsCountExpected uint64) {
+		t.Helper()
+
+		rowsCount, err := getRowsCount(qStr, viewID)
+		if err != nil {
+			t.Fatalf("unexpected error for query [%s] at view_id=%q: %s", qStr, viewID, err)
+		}
+		if rowsCount != rowsCountExpected {
+			t.Fatalf("unexpected number of rows for query [%s] at view_id=%q; got %d; want %d", qStr, viewID, rowsCount, rowsCountExpected)
+		}
+	}
+
+	// Pin the view with flushed and not yet flushed rows
+	addRows(0, 100)
+	s.DebugFlush()
+	addRows(100, 50)
+	if err := s.PinView(t.Context(), "view1", time.Hour); err != nil {
+		t.Fatalf("cannot pin view: %s", err)
+	}
+	if err := s.PinView(t.Context(), "view1", time.Hour); err == nil {
+		t.Fatalf("expecting non-nil error when pinning the view with duplicate view_id")
+	}
+
+	// Newly ingested rows and background merges must not affect the pinned view
+	addRows(150, 100)
+	s.DebugFlush()
+	s.MustForceMerge("")
+
+	f("*", "", 250)
+	f("*", "view1", 150)
+	f(`{host="h1"}`, "view1", 50)
+	f("_time:[2025-01-02T00:00:00Z, 2025-01-02T00:01:00Z)", "view1", 60)
+	f("* | count()", "view1", 1)
+
+	// Deleted rows must remain visible in the pinned view
+	if err := s.PinView(t.Context(), "view2", time.Hour); err != nil {
+		t.Fatalf("cannot pin view: %s", err)
+	}
+	fDelete, err := ParseFilter(`{host="h0"}`)
+	if err != nil {
+		t.Fatalf("cannot parse filter: %s", err)
+	}
+	if err := s.DeleteRunTask(t.Context(), "task1", time.Now().UnixNano(), []TenantID{tenantID}, fDelete); err != nil {
+		t.Fatalf("cannot run delete task: %s", err)
+	}
+	waitForDeleteTasks(t, s)
+
+	f(`{host="h0"}`, "", 0)
+	f(`{host="h0"}`, "view2", 84)
+	f(`{host="h0"}`, "view1", 50)
+
+	if n := s.getPinnedViewsCount(); n != 2 {
+		t.Fatalf("unexpected number of pinned views; got %d; want 2", n)
+	}
+
+	// Unpinned view cannot be queried
+	if err := s.UnpinView(t.Context(), "view1"); err != nil {
+		t.Fatalf("cannot unpin view: %s", err)
+	}
+	if _, err := getRowsCount("*", "view1"); err == nil {
+		t.Fatalf("expecting non-nil error when querying unpinned view")
+	}
+	f(`{host="h0"}`, "view2", 84)
+
+	// Expired view cannot be queried
+	s.unpinExpiredViews(time.Now().Add(2 * time.Hour))
+	if _, err := getRowsCount("*", "view2"); err == nil {
+		t.Fatalf("expecting non-nil error when querying expired view")
+	}
+	if n := s.getPinnedViewsCount(); n != 0 {
+		t.Fatalf("unexpected number of pinned views; got %d; want 0", n)
+	}
+
+	// Views left pinned must be released on close
+	if err := s.PinView(t.Context(), "view3", time.Hour); err != nil {
+		t.Fatalf("cannot pin view: %s", err)
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
+
+func waitForDeleteTasks(t *testing.T, s *Storage) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		tasks, err := s.DeleteActiveTasks(t.Context())
+		if err != nil {
+			t.Fatalf("cannot obtain active delete tasks: %s", err)
+		}
+		if len(tasks) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout when waiting for delete tasks to complete")
+}
@@ -119,6 +119,14 @@ func parsePipes(lex *lexer) ([]pipe, error) {
 		if err != nil {
 			return nil, err
 		}
+		if pc, ok := p.(*pipeCompare); ok {
+			if len(pipes) == 0 {
+				return nil, fmt.Errorf("missing `stats` pipe in front of [%s]", pc)
+			}
+			if _, ok := pipes[len(pipes)-1].(*pipeStats); !ok {
+				return nil, fmt.Errorf("[%s] pipe must go after `stats` pipe; now it goes after [%s]", pc, pipes[len(pipes)-1])
+			}
+		}
 		pipes = append(pipes, p)
 
 		switch {
@@ -145,6 +153,14 @@ func parsePipe(lex *lexer) (pipe, error) {
 		return p, nil
 	}
 
+	if !lex.isQuotedToken() && getCustomPipe(lex.token) != nil {
+		p, err := parsePipeCustom(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse custom pipe %q: %w", lex.token, err)
+		}
+		return p, nil
+	}
+
 	lexState := lex.backupState()
 
 	// Try parsing stats pipe without 'stats' keyword
@@ -179,6 +195,7 @@ func initPipeParsers() {
 		"block_stats":       parsePipeBlockStats,
 		"blocks_count":      parsePipeBlocksCount,
 		"collapse_nums":     parsePipeCollapseNums,
+		"compare":           parsePipeCompare,
 		"copy":              parsePipeCopy,
 		"cp":                parsePipeCopy,
 		"decolorize":        parsePipeDecolorize,
@@ -186,6 +203,7 @@ func initPipeParsers() {
 		"delete":            parsePipeDelete,
 		"drop":              parsePipeDelete,
 		"drop_empty_fields": parsePipeDropEmptyFields,
+		"expr":              parsePipeExpr,
 		"extract":           parsePipeExtract,
 		"extract_regexp":    parsePipeExtractRegexp,
 		"eval":              parsePipeMath,
@@ -242,7 +260,7 @@ func initPipeParsers() {
 func isPipeName(s string) bool {
 	pps := getPipeParsers()
 	sLower := strings.ToLower(s)
-	return pps[sLower] != nil
+	return pps[sLower] != nil || getCustomPipe(sLower) != nil
 }
 
 func mustParsePipes(s string, timestamp int64) []pipe {
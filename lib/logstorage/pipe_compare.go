@@ -0,0 +1,449 @@
+package logstorage
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// pipeCompare processes '| compare offset ...' pipe.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#compare-pipe
+type pipeCompare struct {
+	// offset is the offset in nanoseconds for the baseline time range
+	offset int64
+
+	// offsetStr is string representation of the offset
+	offsetStr string
+
+	// byFields contains 'by(...)' fields from the preceding `stats` pipe. They are automatically initialized during query execution.
+	byFields []string
+
+	// resultNames contains result names from the preceding `stats` pipe. They are automatically initialized during query execution.
+	resultNames []string
+
+	// m contains the baseline results for the preceding `stats` pipe keyed by byFields values.
+	// They are automatically initialized during query execution.
+	m map[string][][]Field
+}
+
+func (pc *pipeCompare) String() string {
+	return "compare offset " + pc.offsetStr
+}
+
+func (pc *pipeCompare) splitToRemoteAndLocal(_ int64) (pipe, []pipe) {
+	return nil, []pipe{pc}
+}
+
+func (pc *pipeCompare) canLiveTail() bool {
+	return false
+}
+
+func (pc *pipeCompare) canReturnLastNResults() bool {
+	return false
+}
+
+func (pc *pipeCompare) hasFilterInWithQuery() bool {
+	return false
+}
+
+func (pc *pipeCompare) initFilterInValues(_ *inValuesCache, _ getFieldValuesFunc, _ bool) (pipe, error) {
+	return pc, nil
+}
+
+func (pc *pipeCompare) visitSubqueries(_ func(q *Query)) {
+	// nothing to do. The baseline query is generated from the query with the pipe during query execution.
+}
+
+func (pc *pipeCompare) updateNeededFields(pf *prefixfilter.Filter) {
+	// The pipe needs all the fields returned by the preceding `stats` pipe.
+	pf.AddAllowFilter("*")
+}
+
+// initBaseline returns a copy of pc with the initialized baseline results.
+//
+// The baseline results are obtained by executing q with pipes up to pipeIdx on the time range shifted by pc.offset.
+func (pc *pipeCompare) initBaseline(q *Query, pipes []pipe, pipeIdx int, getJoinMap getJoinMapFunc) (pipe, error) {
+	if pipeIdx == 0 {
+		return nil, fmt.Errorf("missing `stats` pipe in front of [%s]", pc)
+	}
+	ps, ok := pipes[pipeIdx-1].(*pipeStats)
+	if !ok {
+		return nil, fmt.Errorf("[%s] pipe must go after `stats` pipe; now it goes after [%s]", pc, pipes[pipeIdx-1])
+	}
+
+	byFields := make([]string, len(ps.byFields))
+	for i, bf := range ps.byFields {
+		byFields[i] = bf.name
+	}
+	resultNames := make([]string, len(ps.funcs))
+	for i := range ps.funcs {
+		resultNames[i] = ps.funcs[i].resultName
+	}
+
+	qBaseline := pc.newBaselineQuery(q, pipes[:pipeIdx])
+	m, err := getJoinMap(qBaseline, byFields, "")
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute baseline query at pipe [%s]: %w", pc, err)
+	}
+
+	pcNew := *pc
+	pcNew.byFields = byFields
+	pcNew.resultNames = resultNames
+	pcNew.m = m
+	return &pcNew, nil
+}
+
+// newBaselineQuery returns the query with the given pipes, which selects logs from q on the time range shifted by pc.offset.
+func (pc *pipeCompare) newBaselineQuery(q *Query, pipes []pipe) *Query {
+	qNew := q.cloneShallow()
+	qNew.pipes = pipes
+
+	qNew.f = updateFilterWithTimeOffset(q.f, pc.offset)
+	qNew.opts.timeOffset += pc.offset
+	qNew.opts.timeOffsetStr = string(marshalDurationString(nil, qNew.opts.timeOffset))
+	qNew.opts.needPrint = true
+
+	return qNew
+}
+
+func (pc *pipeCompare) newPipeProcessor(_ int, stopCh <-chan struct{}, _ func(), ppNext pipeProcessor) pipeProcessor {
+	return &pipeCompareProcessor{
+		pc:     pc,
+		stopCh: stopCh,
+		ppNext: ppNext,
+	}
+}
+
+type pipeCompareProcessor struct {
+	pc     *pipeCompare
+	stopCh <-chan struct{}
+	ppNext pipeProcessor
+
+	shards atomicutil.Slice[pipeCompareProcessorShard]
+}
+
+type pipeCompareProcessorShard struct {
+	// a holds the calculated deltas until they are written to ppNext
+	a arena
+
+	// matchedKeys contains keys for pc.m, which were seen in the current results.
+	matchedKeys map[string]struct{}
+
+	rcs []resultColumn
+	br  blockResult
+
+	// rowsCount is the number of rows in the current block
+	rowsCount int
+
+	// valuesLen is the total length of values in the current block
+	valuesLen int
+
+	byColumns     []*blockResultColumn
+	resultColumns []*blockResultColumn
+
+	byValues     []string
+	resultValues []string
+
+	keyBuf []byte
+	tmpBuf []byte
+}
+
+func (pcp *pipeCompareProcessor) writeBlock(workerID uint, br *blockResult) {
+	if br.rowsLen == 0 {
+		return
+	}
+
+	pc := pcp.pc
+	shard := pcp.shards.Get(workerID)
+	if shard.matchedKeys == nil {
+		shard.matchedKeys = make(map[string]struct{})
+	}
+
+	shard.byColumns = slicesutil.SetLength(shard.byColumns, len(pc.byFields))
+	for i, name := range pc.byFields {
+		shard.byColumns[i] = br.getColumnByName(name)
+	}
+	shard.resultColumns = slicesutil.SetLength(shard.resultColumns, len(pc.resultNames))
+	for i, name := range pc.resultNames {
+		shard.resultColumns[i] = br.getColumnByName(name)
+	}
+	shard.byValues = slicesutil.SetLength(shard.byValues, len(pc.byFields))
+	shard.resultValues = slicesutil.SetLength(shard.resultValues, len(pc.resultNames))
+
+	for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+		if needStop(pcp.stopCh) {
+			return
+		}
+
+		for i, c := range shard.byColumns {
+			shard.byValues[i] = c.getValueAtRow(br, rowIdx)
+		}
+		for i, c := range shard.resultColumns {
+			shard.resultValues[i] = c.getValueAtRow(br, rowIdx)
+		}
+
+		shard.keyBuf = marshalStrings(shard.keyBuf[:0], shard.byValues)
+		var baseline []Field
+		if rows := pc.m[string(shard.keyBuf)]; len(rows) > 0 {
+			baseline = rows[0]
+			if _, ok := shard.matchedKeys[string(shard.keyBuf)]; !ok {
+				shard.matchedKeys[string(shard.keyBuf)] = struct{}{}
+			}
+		}
+
+		shard.writeRow(pcp, workerID, shard.byValues, shard.resultValues, baseline)
+	}
+
+	shard.flush(pcp, workerID)
+}
+
+func (shard *pipeCompareProcessorShard) writeRow(pcp *pipeCompareProcessor, workerID uint, byValues, resultValues []string, baseline []Field) {
+	pc := pcp.pc
+
+	if len(shard.rcs) == 0 {
+		rcs := shard.rcs[:0]
+		for _, name := range pc.byFields {
+			rcs = appendResultColumnWithName(rcs, name)
+		}
+		for _, name := range pc.resultNames {
+			rcs = appendResultColumnWithName(rcs, name)
+		}
+		for _, name := range pc.resultNames {
+			rcs = appendResultColumnWithName(rcs, name+"_baseline")
+			rcs = appendResultColumnWithName(rcs, name+"_delta")
+			rcs = appendResultColumnWithName(rcs, name+"_delta_percent")
+		}
+		shard.rcs = rcs
+	}
+	rcs := shard.rcs
+
+	for i, v := range byValues {
+		rcs[i].addValue(v)
+		shard.valuesLen += len(v)
+	}
+	rcs = rcs[len(byValues):]
+	for i, v := range resultValues {
+		rcs[i].addValue(v)
+		shard.valuesLen += len(v)
+	}
+	rcs = rcs[len(resultValues):]
+
+	for i, name := range pc.resultNames {
+		v := resultValues[i]
+		vBaseline := getFieldValue(baseline, name)
+		delta, deltaPercent := shard.getDeltas(v, vBaseline)
+
+		rcs[3*i].addValue(vBaseline)
+		rcs[3*i+1].addValue(delta)
+		rcs[3*i+2].addValue(deltaPercent)
+		shard.valuesLen += len(vBaseline) + len(delta) + len(deltaPercent)
+	}
+
+	shard.rowsCount++
+
+	// The 64_000 limit provides the best performance results.
+	if shard.valuesLen >= 64_000 {
+		shard.flush(pcp, workerID)
+	}
+}
+
+// getDeltas returns the absolute and the percent difference between v and vBaseline.
+//
+// Empty values are treated as zero, since they usually mean there were no matching logs for the given group on the corresponding time range.
+// Empty results are returned if the difference cannot be calculated.
+func (shard *pipeCompareProcessorShard) getDeltas(v, vBaseline string) (string, string) {
+	if v == "" && vBaseline == "" {
+		return "", ""
+	}
+
+	f, ok := tryParseCompareNumber(v)
+	if !ok {
+		return "", ""
+	}
+	fBaseline, ok := tryParseCompareNumber(vBaseline)
+	if !ok {
+		return "", ""
+	}
+
+	delta := f - fBaseline
+	shard.tmpBuf = marshalFloat64String(shard.tmpBuf[:0], delta)
+	deltaStr := shard.a.copyBytesToString(shard.tmpBuf)
+
+	if fBaseline == 0 {
+		return deltaStr, ""
+	}
+	deltaPercent := delta / fBaseline * 100
+	shard.tmpBuf = marshalFloat64String(shard.tmpBuf[:0], deltaPercent)
+	deltaPercentStr := shard.a.copyBytesToString(shard.tmpBuf)
+
+	return deltaStr, deltaPercentStr
+}
+
+func tryParseCompareNumber(s string) (float64, bool) {
+	if s == "" {
+		return 0, true
+	}
+	return tryParseNumber(s)
+}
+
+func (shard *pipeCompareProcessorShard) flush(pcp *pipeCompareProcessor, workerID uint) {
+	if shard.rowsCount == 0 {
+		return
+	}
+
+	rcs := shard.rcs
+	br := &shard.br
+
+	shard.valuesLen = 0
+
+	// Flush rcs to ppNext
+	br.setResultColumns(rcs, shard.rowsCount)
+	shard.rowsCount = 0
+	pcp.ppNext.writeBlock(workerID, br)
+	br.reset()
+	for i := range rcs {
+		rcs[i].resetValues()
+	}
+	shard.a.reset()
+}
+
+func (pcp *pipeCompareProcessor) flush() error {
+	if needStop(pcp.stopCh) {
+		return nil
+	}
+
+	pc := pcp.pc
+	if len(pc.m) == 0 {
+		return nil
+	}
+
+	// Write the baseline groups, which are missing in the current results.
+	matchedKeys := make(map[string]struct{})
+	for _, shard := range pcp.shards.All() {
+		for k := range shard.matchedKeys {
+			matchedKeys[k] = struct{}{}
+		}
+	}
+
+	keys := make([]string, 0, len(pc.m))
+	for k := range pc.m {
+		if _, ok := matchedKeys[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	slices.Sort(keys)
+
+	var shard pipeCompareProcessorShard
+	byValues := make([]string, len(pc.byFields))
+	resultValues := make([]string, len(pc.resultNames))
+	for _, k := range keys {
+		if needStop(pcp.stopCh) {
+			return nil
+		}
+		if err := unmarshalStrings(byValues, k); err != nil {
+			return fmt.Errorf("BUG: cannot unmarshal baseline group key: %w", err)
+		}
+		baseline := pc.m[k][0]
+		shard.writeRow(pcp, 0, byValues, resultValues, baseline)
+	}
+	shard.flush(pcp, 0)
+
+	return nil
+}
+
+// unmarshalStrings unmarshals strings marshaled with marshalStrings from src into dst.
+func unmarshalStrings(dst []string, src string) error {
+	for i := range dst {
+		data, nSize := encoding.UnmarshalBytes(bytesutil.ToUnsafeBytes(src))
+		if nSize <= 0 {
+			return fmt.Errorf("cannot unmarshal string #%d", i)
+		}
+		dst[i] = bytesutil.ToUnsafeString(data)
+		src = src[nSize:]
+	}
+	if len(src) > 0 {
+		return fmt.Errorf("unexpected tail left after unmarshaling %d strings; len(tail)=%d", len(dst), len(src))
+	}
+	return nil
+}
+
+func getFieldValue(fields []Field, name string) string {
+	for _, f := range fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+func parsePipeCompare(lex *lexer) (pipe, error) {
+	if !lex.isKeyword("compare") {
+		return nil, fmt.Errorf("unexpected token: %q; want %q", lex.token, "compare")
+	}
+	lex.nextToken()
+
+	if !lex.isKeyword("offset") {
+		return nil, fmt.Errorf("missing 'offset' after 'compare'; got %q", lex.token)
+	}
+	lex.nextToken()
+
+	offsetStr, err := lex.nextCompoundToken()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read offset for 'compare': %w", err)
+	}
+	offset, ok := tryParseDuration(offsetStr)
+	if !ok {
+		return nil, fmt.Errorf("cannot parse offset for 'compare': %q", offsetStr)
+	}
+	if offset <= 0 {
+		return nil, fmt.Errorf("offset for 'compare' must be positive; got %q", offsetStr)
+	}
+
+	pc := &pipeCompare{
+		offset:    offset,
+		offsetStr: offsetStr,
+	}
+	return pc, nil
+}
+
+func hasComparePipes(pipes []pipe) bool {
+	for _, p := range pipes {
+		if _, ok := p.(*pipeCompare); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func initComparePipes(q *Query, getJoinMap getJoinMapFunc) (*Query, error) {
+	if !hasComparePipes(q.pipes) {
+		return q, nil
+	}
+
+	pipesNew := make([]pipe, len(q.pipes))
+	for i, p := range q.pipes {
+		if pc, ok := p.(*pipeCompare); ok {
+			pNew, err := pc.initBaseline(q, pipesNew, i, getJoinMap)
+			if err != nil {
+				return nil, err
+			}
+			p = pNew
+		}
+		pipesNew[i] = p
+	}
+
+	qNew := q.cloneShallow()
+	qNew.pipes = pipesNew
+
+	return qNew, nil
+}
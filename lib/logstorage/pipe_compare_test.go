@@ -0,0 +1,182 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestParsePipeCompareSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParsePipeSuccess(t, pipeStr)
+	}
+
+	f(`compare offset 1h`)
+	f(`compare offset 1w`)
+	f(`compare offset 1d12h`)
+}
+
+func TestParsePipeCompareFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParsePipeFailure(t, pipeStr)
+	}
+
+	f(`compare`)
+	f(`compare 1h`)
+	f(`compare offset`)
+	f(`compare offset foo`)
+	f(`compare offset -1h`)
+	f(`compare offset 0`)
+}
+
+func TestParseQueryCompareFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		q, err := ParseQuery(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error when parsing [%s]; parsed result: [%s]", s, q)
+		}
+	}
+
+	f(`* | compare offset 1h`)
+	f(`* | stats count() | sort by (x) | compare offset 1h`)
+	f(`* | compare offset 1h | stats count()`)
+}
+
+func TestPipeCompare(t *testing.T) {
+	f := func(qStr string, baselineQueryExpected string, baseline map[string][][]Field, rows, rowsExpected [][]Field) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("cannot parse [%s]: %s", qStr, err)
+		}
+
+		getJoinMap := func(q *Query, _ []string, _ string) (map[string][][]Field, error) {
+			if s := q.String(); s != baselineQueryExpected {
+				t.Fatalf("unexpected baseline query\ngot\n%s\nwant\n%s", s, baselineQueryExpected)
+			}
+			return baseline, nil
+		}
+		qNew, err := initComparePipes(q, getJoinMap)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		pc := qNew.pipes[len(qNew.pipes)-1].(*pipeCompare)
+
+		workersCount := 5
+		stopCh := make(chan struct{})
+		ppTest := newTestPipeProcessor()
+		pp := pc.newPipeProcessor(workersCount, stopCh, func() {}, ppTest)
+
+		brw := newTestBlockResultWriter(workersCount, pp)
+		for _, row := range rows {
+			brw.writeRow(row)
+		}
+		brw.flush()
+		if err := pp.flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		ppTest.expectRows(t, rowsExpected)
+	}
+
+	baselineKey := func(values ...string) string {
+		return string(marshalStrings(nil, values))
+	}
+
+	// by fields
+	f(`_time:1h | stats by (host) count() hits | compare offset 1d`,
+		`options(time_offset=1d) _time:1h | stats by (host) count(*) as hits`,
+		map[string][][]Field{
+			baselineKey("a"): {
+				{
+					{"hits", "10"},
+				},
+			},
+			baselineKey("b"): {
+				{
+					{"hits", "40"},
+				},
+			},
+			baselineKey("c"): {
+				{
+					{"hits", "5"},
+				},
+			},
+		},
+		[][]Field{
+			{
+				{"host", "a"},
+				{"hits", "15"},
+			},
+			{
+				{"host", "b"},
+				{"hits", "30"},
+			},
+			{
+				{"host", "d"},
+				{"hits", "3"},
+			},
+		},
+		[][]Field{
+			{
+				{"host", "a"},
+				{"hits", "15"},
+				{"hits_baseline", "10"},
+				{"hits_delta", "5"},
+				{"hits_delta_percent", "50"},
+			},
+			{
+				{"host", "b"},
+				{"hits", "30"},
+				{"hits_baseline", "40"},
+				{"hits_delta", "-10"},
+				{"hits_delta_percent", "-25"},
+			},
+			{
+				{"host", "c"},
+				{"hits", ""},
+				{"hits_baseline", "5"},
+				{"hits_delta", "-5"},
+				{"hits_delta_percent", "-100"},
+			},
+			{
+				{"host", "d"},
+				{"hits", "3"},
+				{"hits_baseline", ""},
+				{"hits_delta", "3"},
+				{"hits_delta_percent", ""},
+			},
+		})
+
+	// multiple stats functions without by fields and with time offset in the original query
+	f(`options(time_offset=1h) _time:5m | stats count() hits, max(x) max_x | compare offset 1w`,
+		`options(time_offset=1w1h) _time:5m | stats count(*) as hits, max(x) as max_x`,
+		map[string][][]Field{
+			baselineKey(): {
+				{
+					{"hits", "4"},
+					{"max_x", "foo"},
+				},
+			},
+		},
+		[][]Field{
+			{
+				{"hits", "5"},
+				{"max_x", "bar"},
+			},
+		},
+		[][]Field{
+			{
+				{"hits", "5"},
+				{"max_x", "bar"},
+				{"hits_baseline", "4"},
+				{"hits_delta", "1"},
+				{"hits_delta_percent", "25"},
+				{"max_x_baseline", "foo"},
+				{"max_x_delta", ""},
+				{"max_x_delta_percent", ""},
+			},
+		})
+}
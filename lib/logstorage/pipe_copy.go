@@ -55,7 +55,7 @@ func (pc *pipeCopy) updateNeededFields(f *prefixfilter.Filter) {
 			f.AddDenyFilter(dstFieldFilter)
 		}
 		if needSrcField {
-			f.AddAllowFilter(srcFieldFilter)
+			addNeededSrcFields(f, srcFieldFilter, dstFieldFilter)
 		}
 	}
 }
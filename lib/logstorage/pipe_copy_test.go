@@ -328,7 +328,7 @@ func TestPipeCopyUpdateNeededFields(t *testing.T) {
 	// needed fields intersect with dst
 	f("copy s1 d1, s2 d2", "d1,f1,f2", "", "f1,f2,s1", "")
 	f("copy s1 d1, s2 d2", "d*,f*", "", "d*,f*,s1,s2", "d1,d2")
-	f("copy s1* d1*, s2 d2", "d1,f1,f2", "", "d1,f1,f2,s1*", "")
+	f("copy s1* d1*, s2 d2", "d1,f1,f2", "", "d1,f1,f2,s1", "")
 	f("copy s1* d1*, s2 d2", "d1*,f1,f2", "", "d1*,f1,f2,s1*", "")
 
 	// needed fields intersect with src and dst
@@ -336,7 +336,11 @@ func TestPipeCopyUpdateNeededFields(t *testing.T) {
 	f("copy s1 d1, s2 d2", "s1,d2,f1,f2", "", "s1,s2,f1,f2", "")
 	f("copy s1 d1, s2 d2", "s2,d1,f1,f2", "", "s1,s2,f1,f2", "")
 	f("copy s1 d1, s2 d2", "s*,d*,f1,f2", "", "d*,f1,f2,s*", "d1,d2")
-	f("copy s1* d1*, s2 d2", "s2,d1,f1,f2", "", "d1,f1,f2,s1*,s2", "")
+	f("copy s1* d1*, s2 d2", "s2,d1,f1,f2", "", "d1,f1,f2,s1,s2", "")
+
+	// needed fields with the dst prefix for wildcard copy
+	f("copy s* d*", "d1,dx,f1", "", "d1,dx,f1,s1,sx", "")
+	f("copy s* dst_*", "d1,dst_x,f1", "", "d1,dst_x,f1,sx", "")
 }
 
 func expectPipeNeededFields(t *testing.T, s, allowFilters, denyFilters, allowFiltersExpected, denyFiltersExpected string) {
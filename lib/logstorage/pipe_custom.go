@@ -0,0 +1,213 @@
+package logstorage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// CustomPipe is a user-defined pipe, which can be registered via RegisterCustomPipe.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#custom-pipes
+type CustomPipe interface {
+	// NeededFields must return the list of fields needed by the pipe with the given args.
+	//
+	// The returned list may contain wildcard filters such as `*` or `prefix*`.
+	NeededFields(args []string) []string
+
+	// ProcessRow must append fields, which must be set at the row with the given fields, to dst and return the result.
+	//
+	// args are the args passed to the pipe in the query.
+	//
+	// The implementation cannot hold references to fields, since the caller can reuse them.
+	// The implementation must be safe for concurrent use by multiple goroutines.
+	ProcessRow(dst []Field, args []string, fields []Field) []Field
+}
+
+var (
+	customPipesLock sync.Mutex
+	customPipes     = make(map[string]CustomPipe)
+)
+
+// RegisterCustomPipe registers cp under the given name, so it could be used in LogsQL queries as `| name(arg1, ..., argN)`.
+//
+// This function must be called from init() functions of the packages with CustomPipe implementations.
+func RegisterCustomPipe(name string, cp CustomPipe) {
+	name = strings.ToLower(name)
+	if err := CheckCustomPipeName(name); err != nil {
+		logger.Panicf("BUG: %s", err)
+	}
+
+	customPipesLock.Lock()
+	defer customPipesLock.Unlock()
+
+	if _, ok := customPipes[name]; ok {
+		logger.Panicf("BUG: custom pipe %q is already registered", name)
+	}
+	customPipes[name] = cp
+}
+
+// CheckCustomPipeName returns an error if the given name cannot be used for registering custom pipe via RegisterCustomPipe.
+func CheckCustomPipeName(name string) error {
+	name = strings.ToLower(name)
+	if !isWord(name) {
+		return fmt.Errorf("cannot register custom pipe %q, since its name may contain only letters, digits and underscores", name)
+	}
+	if getPipeParsers()[name] != nil {
+		return fmt.Errorf("cannot register custom pipe %q, since it clashes with the builtin pipe", name)
+	}
+	if isStatsFuncName(name) {
+		return fmt.Errorf("cannot register custom pipe %q, since it clashes with the stats function", name)
+	}
+	if getCustomPipe(name) != nil {
+		return fmt.Errorf("custom pipe %q is already registered", name)
+	}
+	return nil
+}
+
+func getCustomPipe(name string) CustomPipe {
+	customPipesLock.Lock()
+	cp := customPipes[strings.ToLower(name)]
+	customPipesLock.Unlock()
+	return cp
+}
+
+// pipeCustom processes '| name(args)' pipe for custom pipes registered via RegisterCustomPipe.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#custom-pipes
+type pipeCustom struct {
+	name string
+	args []string
+
+	cp CustomPipe
+}
+
+func (pc *pipeCustom) String() string {
+	if len(pc.args) == 0 {
+		return pc.name
+	}
+	a := make([]string, len(pc.args))
+	for i, arg := range pc.args {
+		a[i] = quoteTokenIfNeeded(arg)
+	}
+	return pc.name + "(" + strings.Join(a, ", ") + ")"
+}
+
+func (pc *pipeCustom) splitToRemoteAndLocal(_ int64) (pipe, []pipe) {
+	// Execute custom pipes locally, so they must be registered only at vlselect in VictoriaLogs cluster.
+	return nil, []pipe{pc}
+}
+
+func (pc *pipeCustom) canLiveTail() bool {
+	return true
+}
+
+func (pc *pipeCustom) canReturnLastNResults() bool {
+	// The custom pipe may modify the _time field.
+	return false
+}
+
+func (pc *pipeCustom) updateNeededFields(pf *prefixfilter.Filter) {
+	pf.AddAllowFilters(pc.cp.NeededFields(pc.args))
+}
+
+func (pc *pipeCustom) hasFilterInWithQuery() bool {
+	return false
+}
+
+func (pc *pipeCustom) initFilterInValues(_ *inValuesCache, _ getFieldValuesFunc, _ bool) (pipe, error) {
+	return pc, nil
+}
+
+func (pc *pipeCustom) visitSubqueries(_ func(q *Query)) {
+	// nothing to do
+}
+
+func (pc *pipeCustom) newPipeProcessor(_ int, stopCh <-chan struct{}, _ func(), ppNext pipeProcessor) pipeProcessor {
+	return &pipeCustomProcessor{
+		pc:     pc,
+		stopCh: stopCh,
+		ppNext: ppNext,
+	}
+}
+
+type pipeCustomProcessor struct {
+	pc     *pipeCustom
+	stopCh <-chan struct{}
+	ppNext pipeProcessor
+
+	shards atomicutil.Slice[pipeCustomProcessorShard]
+}
+
+type pipeCustomProcessorShard struct {
+	wctx pipeUnpackWriteContext
+
+	fields    []Field
+	newFields []Field
+}
+
+func (pcp *pipeCustomProcessor) writeBlock(workerID uint, br *blockResult) {
+	if br.rowsLen == 0 {
+		return
+	}
+
+	pc := pcp.pc
+	shard := pcp.shards.Get(workerID)
+	shard.wctx.init(workerID, pcp.ppNext, false, false, br)
+
+	cs := br.getColumns()
+	for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+		if needStop(pcp.stopCh) {
+			return
+		}
+
+		fields := shard.fields[:0]
+		for _, c := range cs {
+			fields = append(fields, Field{
+				Name:  c.name,
+				Value: c.getValueAtRow(br, rowIdx),
+			})
+		}
+		shard.fields = fields
+
+		shard.newFields = pc.cp.ProcessRow(shard.newFields[:0], pc.args, fields)
+		shard.wctx.writeRow(rowIdx, shard.newFields)
+	}
+
+	shard.wctx.flush()
+	shard.wctx.reset()
+}
+
+func (pcp *pipeCustomProcessor) flush() error {
+	return nil
+}
+
+func parsePipeCustom(lex *lexer) (pipe, error) {
+	name := strings.ToLower(lex.token)
+	cp := getCustomPipe(name)
+	if cp == nil || lex.isQuotedToken() {
+		return nil, fmt.Errorf("unexpected token: %q; want custom pipe name", lex.token)
+	}
+	lex.nextToken()
+
+	var args []string
+	if lex.isKeyword("(") {
+		a, err := parseArgsInParens(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse args for %q pipe: %w", name, err)
+		}
+		args = a
+	}
+
+	pc := &pipeCustom{
+		name: name,
+		args: args,
+		cp:   cp,
+	}
+	return pc, nil
+}
@@ -0,0 +1,150 @@
+package logstorage
+
+import (
+	"strings"
+	"testing"
+)
+
+// testCustomPipeConcat concatenates the values for fields passed in args and stores the result into `concat` field.
+type testCustomPipeConcat struct{}
+
+func (cp *testCustomPipeConcat) NeededFields(args []string) []string {
+	return args
+}
+
+func (cp *testCustomPipeConcat) ProcessRow(dst []Field, args []string, fields []Field) []Field {
+	a := make([]string, 0, len(args))
+	for _, arg := range args {
+		for _, f := range fields {
+			if f.Name == arg {
+				a = append(a, f.Value)
+			}
+		}
+	}
+	return append(dst, Field{
+		Name:  "concat",
+		Value: strings.Join(a, "-"),
+	})
+}
+
+func init() {
+	RegisterCustomPipe("test_concat", &testCustomPipeConcat{})
+}
+
+func TestCheckCustomPipeName(t *testing.T) {
+	f := func(name string, resultExpected bool) {
+		t.Helper()
+
+		err := CheckCustomPipeName(name)
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for CheckCustomPipeName(%q); got %v; want %v; error: %v", name, result, resultExpected, err)
+		}
+	}
+
+	f("foo", true)
+	f("foo_bar123", true)
+
+	// invalid names
+	f("", false)
+	f("foo-bar", false)
+	f("foo bar", false)
+
+	// builtin pipe
+	f("fields", false)
+	f("SORT", false)
+
+	// stats function
+	f("count", false)
+
+	// already registered pipe
+	f("test_concat", false)
+	f("Test_Concat", false)
+}
+
+func TestParsePipeCustomSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParsePipeSuccess(t, pipeStr)
+	}
+
+	f(`test_concat`)
+	f(`test_concat(foo)`)
+	f(`test_concat(foo, bar)`)
+	f(`test_concat(foo, "bar baz")`)
+}
+
+func TestParsePipeCustomFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParsePipeFailure(t, pipeStr)
+	}
+
+	f(`test_concat(`)
+	f(`test_concat(foo`)
+	f(`test_concat foo`)
+	f(`"test_concat"(foo)`)
+}
+
+func TestPipeCustom(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("test_concat(a, b)", [][]Field{
+		{
+			{"a", "foo"},
+			{"b", "bar"},
+			{"c", "baz"},
+		},
+		{
+			{"a", "x"},
+		},
+	}, [][]Field{
+		{
+			{"a", "foo"},
+			{"b", "bar"},
+			{"c", "baz"},
+			{"concat", "foo-bar"},
+		},
+		{
+			{"a", "x"},
+			{"concat", "x"},
+		},
+	})
+
+	// overwrite the existing field
+	f("test_concat(a)", [][]Field{
+		{
+			{"a", "foo"},
+			{"concat", "abc"},
+		},
+	}, [][]Field{
+		{
+			{"a", "foo"},
+			{"concat", "foo"},
+		},
+	})
+}
+
+func TestPipeCustomUpdateNeededFields(t *testing.T) {
+	f := func(s string, allowFilters, denyFilters, allowFiltersExpected, denyFiltersExpected string) {
+		t.Helper()
+		expectPipeNeededFields(t, s, allowFilters, denyFilters, allowFiltersExpected, denyFiltersExpected)
+	}
+
+	// all the needed fields
+	f("test_concat(x)", "*", "", "*", "")
+
+	// all the needed fields, unneeded fields do not intersect with args
+	f("test_concat(x)", "*", "f1,f2", "*", "f1,f2")
+
+	// all the needed fields, unneeded fields intersect with args
+	f("test_concat(f1, x)", "*", "f1,f2", "*", "f2")
+
+	// needed fields do not intersect with args
+	f("test_concat(x)", "f1,f2", "", "f1,f2,x", "")
+
+	// needed fields intersect with args
+	f("test_concat(f1, x)", "f1,f2", "", "f1,f2,x", "")
+}
@@ -0,0 +1,1029 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// maxExprNodes is the maximum number of nodes in a single expression at 'expr' pipe.
+//
+// Expressions do not contain loops, so the number of evaluation steps per every row is limited by the number of nodes.
+const maxExprNodes = 1000
+
+// maxExprValueLen is the maximum length of a string, which can be generated by a single expression node at 'expr' pipe.
+//
+// Functions such as concat() and replace() check this limit before allocating the result, so nested calls cannot grow the result exponentially.
+const maxExprValueLen = 4 * 1024 * 1024
+
+// maxExprBlockBytes is the maximum number of bytes, which can be generated by 'expr' pipe per every processed block.
+//
+// This includes intermediate results, which are dropped after the evaluation.
+const maxExprBlockBytes = 64 * 1024 * 1024
+
+// pipeExpr processes '| expr ...' pipe.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#expr-pipe
+type pipeExpr struct {
+	entries []*exprEntry
+
+	// maxSteps is the maximum number of expression nodes to evaluate per query. There is no limit if it is zero.
+	maxSteps uint64
+
+	// maxDuration is the maximum duration in nanoseconds to spend on expressions evaluation per query. There is no limit if it is zero.
+	maxDuration int64
+
+	// maxDurationStr is the original string representation of maxDuration.
+	maxDurationStr string
+}
+
+type exprEntry struct {
+	// The calculated expr result is stored in resultField.
+	resultField string
+
+	// expr is the expression to calculate.
+	expr *exprNode
+}
+
+type exprNode struct {
+	// if isConst is set, then the given exprNode returns the given constValue.
+	isConst    bool
+	constValue string
+
+	// constValueStr is the original string representation of constValue.
+	constValueStr string
+
+	// if isField is set, then the given exprNode returns the value for the given fieldName.
+	isField   bool
+	fieldName string
+
+	// op is the operator or the function name for the given exprNode.
+	op string
+
+	// args are args for the given op.
+	args []*exprNode
+
+	// f is the function for calculating the result for function calls.
+	f exprFunc
+}
+
+// exprFunc must return the result for the given args.
+//
+// Functions, which generate new strings, must reserve space for them via eb.reserve() before the allocation.
+type exprFunc func(eb *exprBudget, args []string) (string, error)
+
+var exprBinaryOpPriorities = map[string]int{
+	"or":  1,
+	"and": 2,
+	"==":  3,
+	"!=":  3,
+	"<":   3,
+	"<=":  3,
+	">":   3,
+	">=":  3,
+	"+":   4,
+	"-":   4,
+	"*":   5,
+	"/":   5,
+	"%":   5,
+}
+
+func isExprBinaryOp(op string) bool {
+	_, ok := exprBinaryOpPriorities[op]
+	return ok
+}
+
+// exprFuncs contains functions, which can be used in 'expr' pipe.
+//
+// Functions with lazily evaluated args such as if() and coalesce() are handled separately at exprNode.eval().
+var exprFuncs = map[string]struct {
+	minArgs int
+	maxArgs int
+	f       exprFunc
+}{
+	"coalesce":    {1, -1, nil},
+	"concat":      {1, -1, exprFuncConcat},
+	"contains":    {2, 2, exprFuncContains},
+	"ends_with":   {2, 2, exprFuncEndsWith},
+	"if":          {3, 3, nil},
+	"len":         {1, 1, exprFuncLen},
+	"lower":       {1, 1, exprFuncLower},
+	"replace":     {3, 3, exprFuncReplace},
+	"starts_with": {2, 2, exprFuncStartsWith},
+	"substr":      {2, 3, exprFuncSubstr},
+	"trim":        {1, 1, exprFuncTrim},
+	"upper":       {1, 1, exprFuncUpper},
+}
+
+func (pe *pipeExpr) String() string {
+	a := make([]string, len(pe.entries))
+	for i, e := range pe.entries {
+		a[i] = e.String()
+	}
+	s := "expr " + strings.Join(a, ", ")
+	if pe.maxSteps > 0 {
+		s += fmt.Sprintf(" max_steps %d", pe.maxSteps)
+	}
+	if pe.maxDuration > 0 {
+		s += " max_duration " + pe.maxDurationStr
+	}
+	return s
+}
+
+func (e *exprEntry) String() string {
+	return e.expr.String() + " as " + quoteTokenIfNeeded(e.resultField)
+}
+
+func (en *exprNode) String() string {
+	if en.isConst {
+		return en.constValueStr
+	}
+	if en.isField {
+		return quoteExprFieldName(en.fieldName)
+	}
+
+	switch {
+	case en.op == "?":
+		return fmt.Sprintf("%s ? %s : %s", en.argString(0, 1), en.argString(1, 0), en.argString(2, 0))
+	case en.op == "not":
+		return "not " + en.argString(0, math.MaxInt)
+	case en.op == "unary_minus":
+		return "-" + en.argString(0, math.MaxInt)
+	case isExprBinaryOp(en.op):
+		priority := exprBinaryOpPriorities[en.op]
+		return fmt.Sprintf("%s %s %s", en.argString(0, priority), en.op, en.argString(1, priority+1))
+	default:
+		a := make([]string, len(en.args))
+		for i, arg := range en.args {
+			a[i] = arg.String()
+		}
+		return en.op + "(" + strings.Join(a, ", ") + ")"
+	}
+}
+
+// argString returns string representation for the arg at the given idx.
+//
+// The arg is wrapped into parens if it has lower priority than the given minPriority.
+func (en *exprNode) argString(idx, minPriority int) string {
+	arg := en.args[idx]
+	s := arg.String()
+	priority := math.MaxInt
+	if arg.op == "?" {
+		priority = 0
+	} else if isExprBinaryOp(arg.op) {
+		priority = exprBinaryOpPriorities[arg.op]
+	}
+	if arg.op == "?" && minPriority > 0 || priority < minPriority {
+		s = "(" + s + ")"
+	}
+	return s
+}
+
+func quoteExprFieldName(s string) string {
+	sLower := strings.ToLower(s)
+	if isExprBinaryOp(sLower) || sLower == "not" || sLower == "true" || sLower == "false" || sLower == "as" || isNumberPrefix(s) {
+		return strconv.Quote(s)
+	}
+	return quoteTokenIfNeeded(s)
+}
+
+func (en *exprNode) nodesCount() int {
+	n := 1
+	for _, arg := range en.args {
+		n += arg.nodesCount()
+	}
+	return n
+}
+
+func (pe *pipeExpr) splitToRemoteAndLocal(_ int64) (pipe, []pipe) {
+	return pe, nil
+}
+
+func (pe *pipeExpr) canLiveTail() bool {
+	return true
+}
+
+func (pe *pipeExpr) canReturnLastNResults() bool {
+	for _, e := range pe.entries {
+		if e.resultField == "_time" {
+			return false
+		}
+	}
+	return true
+}
+
+func (pe *pipeExpr) updateNeededFields(pf *prefixfilter.Filter) {
+	for i := len(pe.entries) - 1; i >= 0; i-- {
+		e := pe.entries[i]
+		if pf.MatchString(e.resultField) {
+			pf.AddDenyFilter(e.resultField)
+			e.expr.updateNeededFields(pf)
+		}
+	}
+}
+
+func (en *exprNode) updateNeededFields(pf *prefixfilter.Filter) {
+	if en.isConst {
+		return
+	}
+	if en.isField {
+		pf.AddAllowFilter(en.fieldName)
+		return
+	}
+	for _, arg := range en.args {
+		arg.updateNeededFields(pf)
+	}
+}
+
+func (pe *pipeExpr) hasFilterInWithQuery() bool {
+	return false
+}
+
+func (pe *pipeExpr) initFilterInValues(_ *inValuesCache, _ getFieldValuesFunc, _ bool) (pipe, error) {
+	return pe, nil
+}
+
+func (pe *pipeExpr) visitSubqueries(_ func(q *Query)) {
+	// nothing to do
+}
+
+func (pe *pipeExpr) newPipeProcessor(_ int, stopCh <-chan struct{}, cancel func(), ppNext pipeProcessor) pipeProcessor {
+	return &pipeExprProcessor{
+		pe:     pe,
+		stopCh: stopCh,
+		cancel: cancel,
+		ppNext: ppNext,
+	}
+}
+
+type pipeExprProcessor struct {
+	pe     *pipeExpr
+	stopCh <-chan struct{}
+	cancel func()
+	ppNext pipeProcessor
+
+	shards atomicutil.Slice[pipeExprProcessorShard]
+
+	// stepsTotal is the number of evaluated expression nodes across all the shards.
+	stepsTotal atomic.Uint64
+
+	// durationTotal is the duration in nanoseconds spent on expressions evaluation across all the shards.
+	durationTotal atomic.Int64
+
+	errLock sync.Mutex
+	err     error
+}
+
+type pipeExprProcessorShard struct {
+	// a holds all the data for rc.
+	a arena
+
+	// rcs is used for storing calculated results before they are written to ppNext.
+	rcs []resultColumn
+
+	// argsBuf is used for holding function args during evaluation.
+	argsBuf []string
+
+	// eb limits the size of strings generated during the evaluation of the current block.
+	eb exprBudget
+
+	// steps is the number of evaluated expression nodes, which aren't registered at pipeExprProcessor.stepsTotal yet.
+	steps uint64
+}
+
+// exprBudget limits the size of strings generated during expressions evaluation.
+type exprBudget struct {
+	// bytes is the number of bytes generated for the current block.
+	bytes int
+}
+
+// reserve reserves n bytes for a string generated during expression evaluation.
+//
+// It returns an error if the string exceeds maxExprValueLen or if the generated strings for the current block exceed maxExprBlockBytes.
+func (eb *exprBudget) reserve(n int) error {
+	if n > maxExprValueLen {
+		return fmt.Errorf("the expression generates too long value with %d bytes; the maximum allowed length is %d bytes", n, maxExprValueLen)
+	}
+	eb.bytes += n
+	if eb.bytes > maxExprBlockBytes {
+		return fmt.Errorf("the expression generates more than %d bytes per block", maxExprBlockBytes)
+	}
+	return nil
+}
+
+func (pep *pipeExprProcessor) writeBlock(workerID uint, br *blockResult) {
+	if br.rowsLen == 0 {
+		return
+	}
+
+	shard := pep.shards.Get(workerID)
+	entries := pep.pe.entries
+
+	startTime := time.Now()
+	defer func() {
+		pep.durationTotal.Add(time.Since(startTime).Nanoseconds())
+		pep.stepsTotal.Add(shard.steps)
+		shard.steps = 0
+	}()
+
+	shard.rcs = slicesutil.SetLength(shard.rcs, len(entries))
+	rcs := shard.rcs
+	for i, e := range entries {
+		rc := &rcs[i]
+		rc.name = e.resultField
+		for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+			if needStop(pep.stopCh) {
+				shard.reset()
+				return
+			}
+			if err := pep.checkLimits(shard, rowIdx, startTime); err != nil {
+				pep.setError(err)
+				shard.reset()
+				return
+			}
+			v, err := shard.eval(e.expr, br, rowIdx)
+			if err != nil {
+				pep.setError(fmt.Errorf("cannot evaluate [%s]: %w", e, err))
+				shard.reset()
+				return
+			}
+			rc.addValue(v)
+		}
+		br.addResultColumn(*rc)
+	}
+
+	pep.ppNext.writeBlock(workerID, br)
+
+	shard.reset()
+}
+
+// checkLimits returns an error if the query exceeds max_steps or max_duration limits for 'expr' pipe.
+func (pep *pipeExprProcessor) checkLimits(shard *pipeExprProcessorShard, rowIdx int, startTime time.Time) error {
+	pe := pep.pe
+	if pe.maxSteps > 0 {
+		if steps := pep.stepsTotal.Load() + shard.steps; steps > pe.maxSteps {
+			return fmt.Errorf("[%s] evaluated more than max_steps=%d expression nodes", pe, pe.maxSteps)
+		}
+	}
+	if pe.maxDuration > 0 && rowIdx%1024 == 0 {
+		if d := pep.durationTotal.Load() + time.Since(startTime).Nanoseconds(); d > pe.maxDuration {
+			return fmt.Errorf("[%s] spent more than max_duration=%s on expressions evaluation", pe, pe.maxDurationStr)
+		}
+	}
+	return nil
+}
+
+func (pep *pipeExprProcessor) setError(err error) {
+	pep.errLock.Lock()
+	if pep.err == nil {
+		pep.err = err
+	}
+	pep.errLock.Unlock()
+	pep.cancel()
+}
+
+func (shard *pipeExprProcessorShard) reset() {
+	for i := range shard.rcs {
+		shard.rcs[i].resetValues()
+	}
+	shard.a.reset()
+	shard.eb.bytes = 0
+}
+
+func (pep *pipeExprProcessor) flush() error {
+	pep.errLock.Lock()
+	defer pep.errLock.Unlock()
+
+	return pep.err
+}
+
+func (shard *pipeExprProcessorShard) eval(en *exprNode, br *blockResult, rowIdx int) (string, error) {
+	shard.steps++
+
+	if en.isConst {
+		return en.constValue, nil
+	}
+	if en.isField {
+		c := br.getColumnByName(en.fieldName)
+		return c.getValueAtRow(br, rowIdx), nil
+	}
+
+	switch en.op {
+	case "?", "if":
+		cond, err := shard.eval(en.args[0], br, rowIdx)
+		if err != nil {
+			return "", err
+		}
+		if isExprTrue(cond) {
+			return shard.eval(en.args[1], br, rowIdx)
+		}
+		return shard.eval(en.args[2], br, rowIdx)
+	case "coalesce":
+		for _, arg := range en.args {
+			v, err := shard.eval(arg, br, rowIdx)
+			if err != nil {
+				return "", err
+			}
+			if v != "" {
+				return v, nil
+			}
+		}
+		return "", nil
+	case "and", "or":
+		left, err := shard.eval(en.args[0], br, rowIdx)
+		if err != nil {
+			return "", err
+		}
+		if isExprTrue(left) == (en.op == "or") {
+			return exprBool(en.op == "or"), nil
+		}
+		right, err := shard.eval(en.args[1], br, rowIdx)
+		if err != nil {
+			return "", err
+		}
+		return exprBool(isExprTrue(right)), nil
+	case "not":
+		v, err := shard.eval(en.args[0], br, rowIdx)
+		if err != nil {
+			return "", err
+		}
+		return exprBool(!isExprTrue(v)), nil
+	case "unary_minus":
+		v, err := shard.eval(en.args[0], br, rowIdx)
+		if err != nil {
+			return "", err
+		}
+		f := parseExprNumber(v)
+		return shard.formatNumber(-f), nil
+	}
+
+	if isExprBinaryOp(en.op) {
+		left, err := shard.eval(en.args[0], br, rowIdx)
+		if err != nil {
+			return "", err
+		}
+		right, err := shard.eval(en.args[1], br, rowIdx)
+		if err != nil {
+			return "", err
+		}
+		return shard.evalBinaryOp(en.op, left, right)
+	}
+
+	argsBufLen := len(shard.argsBuf)
+	defer func() {
+		clear(shard.argsBuf[argsBufLen:])
+		shard.argsBuf = shard.argsBuf[:argsBufLen]
+	}()
+	for _, arg := range en.args {
+		v, err := shard.eval(arg, br, rowIdx)
+		if err != nil {
+			return "", err
+		}
+		shard.argsBuf = append(shard.argsBuf, v)
+	}
+	return en.f(&shard.eb, shard.argsBuf[argsBufLen:])
+}
+
+func (shard *pipeExprProcessorShard) evalBinaryOp(op, left, right string) (string, error) {
+	fLeft := parseExprNumber(left)
+	fRight := parseExprNumber(right)
+	isNumeric := !math.IsNaN(fLeft) && !math.IsNaN(fRight)
+
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		var n int
+		if isNumeric {
+			n = compareFloat64(fLeft, fRight)
+		} else {
+			n = strings.Compare(left, right)
+		}
+		switch op {
+		case "==":
+			return exprBool(n == 0), nil
+		case "!=":
+			return exprBool(n != 0), nil
+		case "<":
+			return exprBool(n < 0), nil
+		case "<=":
+			return exprBool(n <= 0), nil
+		case ">":
+			return exprBool(n > 0), nil
+		default:
+			return exprBool(n >= 0), nil
+		}
+	case "+":
+		if !isNumeric {
+			// Concatenate non-numeric values
+			if err := shard.eb.reserve(len(left) + len(right)); err != nil {
+				return "", err
+			}
+			return left + right, nil
+		}
+		return shard.formatNumber(fLeft + fRight), nil
+	case "-":
+		return shard.formatNumber(fLeft - fRight), nil
+	case "*":
+		return shard.formatNumber(fLeft * fRight), nil
+	case "/":
+		return shard.formatNumber(fLeft / fRight), nil
+	default:
+		return shard.formatNumber(math.Mod(fLeft, fRight)), nil
+	}
+}
+
+func compareFloat64(a, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func (shard *pipeExprProcessorShard) formatNumber(f float64) string {
+	if math.IsNaN(f) {
+		return ""
+	}
+	b := shard.a.b
+	bLen := len(b)
+	b = marshalFloat64String(b, f)
+	shard.a.b = b
+	return bytesutil.ToUnsafeString(b[bLen:])
+}
+
+// parseExprNumber parses the number from v.
+//
+// It returns NaN if v doesn't contain a number.
+func parseExprNumber(v string) float64 {
+	if !isNumberPrefix(v) {
+		return nan
+	}
+	return parseMathNumber(v)
+}
+
+func isExprTrue(v string) bool {
+	if v == "" || v == "false" {
+		return false
+	}
+	f := parseExprNumber(v)
+	return f != 0
+}
+
+func exprBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+func exprFuncConcat(eb *exprBudget, args []string) (string, error) {
+	n := 0
+	for _, arg := range args {
+		n += len(arg)
+	}
+	if err := eb.reserve(n); err != nil {
+		return "", err
+	}
+	return strings.Join(args, ""), nil
+}
+
+func exprFuncContains(_ *exprBudget, args []string) (string, error) {
+	return exprBool(strings.Contains(args[0], args[1])), nil
+}
+
+func exprFuncEndsWith(_ *exprBudget, args []string) (string, error) {
+	return exprBool(strings.HasSuffix(args[0], args[1])), nil
+}
+
+func exprFuncStartsWith(_ *exprBudget, args []string) (string, error) {
+	return exprBool(strings.HasPrefix(args[0], args[1])), nil
+}
+
+func exprFuncLen(_ *exprBudget, args []string) (string, error) {
+	return strconv.Itoa(utf8.RuneCountInString(args[0])), nil
+}
+
+func exprFuncLower(eb *exprBudget, args []string) (string, error) {
+	// The result cannot exceed the original string by more than 1.5 times, so it is safe to check its length after the conversion.
+	result := strings.ToLower(args[0])
+	if err := eb.reserve(len(result)); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+func exprFuncUpper(eb *exprBudget, args []string) (string, error) {
+	// The result cannot exceed the original string by more than 1.5 times, so it is safe to check its length after the conversion.
+	result := strings.ToUpper(args[0])
+	if err := eb.reserve(len(result)); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+func exprFuncTrim(_ *exprBudget, args []string) (string, error) {
+	return strings.TrimSpace(args[0]), nil
+}
+
+func exprFuncReplace(eb *exprBudget, args []string) (string, error) {
+	s, oldStr, newStr := args[0], args[1], args[2]
+	if oldStr == "" {
+		// Empty string matches before every char, so it would multiply the string length. Return the original string instead.
+		return s, nil
+	}
+	n := strings.Count(s, oldStr)
+	if n == 0 {
+		return s, nil
+	}
+	if err := eb.reserve(len(s) + n*(len(newStr)-len(oldStr))); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(s, oldStr, newStr), nil
+}
+
+func exprFuncSubstr(_ *exprBudget, args []string) (string, error) {
+	s := args[0]
+	start := parseExprNumber(args[1])
+	if math.IsNaN(start) || start < 0 {
+		start = 0
+	}
+	n := math.Inf(1)
+	if len(args) > 2 {
+		n = parseExprNumber(args[2])
+		if math.IsNaN(n) || n < 0 {
+			n = 0
+		}
+	}
+
+	// Count start and n in runes, since byte offsets may break multi-byte chars.
+	runeIdx := 0
+	startOffset := len(s)
+	endOffset := len(s)
+	for offset := range s {
+		if float64(runeIdx) == start {
+			startOffset = offset
+		}
+		if float64(runeIdx) == start+n {
+			endOffset = offset
+			break
+		}
+		runeIdx++
+	}
+	if startOffset > endOffset {
+		return "", nil
+	}
+	return s[startOffset:endOffset], nil
+}
+
+// exprStopCompoundTokens contains tokens from the glueCompoundTokens, which are disallowed in compound tokens at 'expr' pipe.
+var exprStopCompoundTokens = []string{
+	"+",
+	"-",
+	"/",
+	":",
+}
+
+func parsePipeExpr(lex *lexer) (pipe, error) {
+	if !lex.isKeyword("expr") {
+		return nil, fmt.Errorf("unexpected token: %q; want 'expr'", lex.token)
+	}
+	lex.nextToken()
+
+	var entries []*exprEntry
+	for {
+		e, err := parseExprEntry(lex)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+
+		switch {
+		case lex.isKeyword(","):
+			lex.nextToken()
+		case lex.isKeyword("|", ")", "", "max_steps", "max_duration"):
+			pe := &pipeExpr{
+				entries: entries,
+			}
+			if err := parsePipeExprLimits(lex, pe); err != nil {
+				return nil, err
+			}
+			return pe, nil
+		default:
+			return nil, fmt.Errorf("unexpected token after 'expr' expression [%s]: %q; expecting ',', '|' or ')'", entries[len(entries)-1], lex.token)
+		}
+	}
+}
+
+// parsePipeExprLimits parses optional 'max_steps N' and 'max_duration D' limits for pe.
+func parsePipeExprLimits(lex *lexer, pe *pipeExpr) error {
+	for {
+		switch {
+		case lex.isKeyword("max_steps"):
+			lex.nextToken()
+			s, err := lex.nextCompoundToken()
+			if err != nil {
+				return fmt.Errorf("cannot parse 'max_steps': %w", err)
+			}
+			n, ok := tryParseUint64(s)
+			if !ok || n == 0 {
+				return fmt.Errorf("cannot parse 'max_steps %s'; it must be a positive integer", s)
+			}
+			if pe.maxSteps > 0 {
+				return fmt.Errorf("duplicate 'max_steps'")
+			}
+			pe.maxSteps = n
+		case lex.isKeyword("max_duration"):
+			lex.nextToken()
+			d, s, err := parseDuration(lex)
+			if err != nil {
+				return fmt.Errorf("cannot parse 'max_duration': %w", err)
+			}
+			if d <= 0 {
+				return fmt.Errorf("'max_duration %s' must be positive", s)
+			}
+			if pe.maxDuration > 0 {
+				return fmt.Errorf("duplicate 'max_duration'")
+			}
+			pe.maxDuration = d
+			pe.maxDurationStr = s
+		case lex.isKeyword("|", ")", ""):
+			return nil
+		default:
+			return fmt.Errorf("unexpected token after [%s]: %q; expecting 'max_steps', 'max_duration', '|' or ')'", pe, lex.token)
+		}
+	}
+}
+
+func parseExprEntry(lex *lexer) (*exprEntry, error) {
+	en, err := parseExprNode(lex)
+	if err != nil {
+		return nil, err
+	}
+	if n := en.nodesCount(); n > maxExprNodes {
+		return nil, fmt.Errorf("too complex expression [%s]; it contains %d nodes, while up to %d nodes are allowed", en, n, maxExprNodes)
+	}
+
+	if lex.isKeyword("as") {
+		// skip optional 'as'
+		lex.nextToken()
+	}
+	resultField, err := parseFieldName(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse result name for [%s]: %w", en, err)
+	}
+
+	e := &exprEntry{
+		resultField: resultField,
+		expr:        en,
+	}
+	return e, nil
+}
+
+func parseExprNode(lex *lexer) (*exprNode, error) {
+	cond, err := parseExprBinary(lex, 1)
+	if err != nil {
+		return nil, err
+	}
+	if !lex.isKeyword("?") {
+		return cond, nil
+	}
+	lex.nextToken()
+
+	ifTrue, err := parseExprNode(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the expression after [%s ?]: %w", cond, err)
+	}
+	if !lex.isKeyword(":") {
+		return nil, fmt.Errorf("missing ':' after [%s ? %s]; got %q instead", cond, ifTrue, lex.token)
+	}
+	lex.nextToken()
+	ifFalse, err := parseExprNode(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the expression after [%s ? %s :]: %w", cond, ifTrue, err)
+	}
+
+	en := &exprNode{
+		op:   "?",
+		args: []*exprNode{cond, ifTrue, ifFalse},
+	}
+	return en, nil
+}
+
+func parseExprBinary(lex *lexer, minPriority int) (*exprNode, error) {
+	left, err := parseExprOperand(lex)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		lexState := lex.backupState()
+		op := nextExprBinaryOp(lex)
+		if op == "" || exprBinaryOpPriorities[op] < minPriority {
+			lex.restoreState(lexState)
+			return left, nil
+		}
+
+		right, err := parseExprBinary(lex, exprBinaryOpPriorities[op]+1)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse operand after [%s %s]: %w", left, op, err)
+		}
+		left = &exprNode{
+			op:   op,
+			args: []*exprNode{left, right},
+		}
+	}
+}
+
+// nextExprBinaryOp reads the next binary operator from lex.
+//
+// It returns an empty string if lex doesn't contain binary operator at the current position.
+func nextExprBinaryOp(lex *lexer) string {
+	if lex.isQuotedToken() {
+		return ""
+	}
+	switch {
+	case lex.isKeyword("and", "or"):
+		op := strings.ToLower(lex.token)
+		lex.nextToken()
+		return op
+	case lex.isKeyword("!=", "+", "-", "*", "/", "%"):
+		op := lex.token
+		lex.nextToken()
+		return op
+	case lex.isKeyword("="):
+		lex.nextToken()
+		if lex.isSkippedSpace || !lex.isKeyword("=") {
+			return ""
+		}
+		lex.nextToken()
+		return "=="
+	case lex.isKeyword("<", ">"):
+		op := lex.token
+		lex.nextToken()
+		if !lex.isSkippedSpace && lex.isKeyword("=") {
+			lex.nextToken()
+			op += "="
+		}
+		return op
+	default:
+		return ""
+	}
+}
+
+func parseExprOperand(lex *lexer) (*exprNode, error) {
+	if lex.isQuotedToken() {
+		en := &exprNode{
+			isConst:       true,
+			constValue:    lex.token,
+			constValueStr: strconv.Quote(lex.token),
+		}
+		lex.nextToken()
+		return en, nil
+	}
+
+	switch {
+	case lex.isKeyword("("):
+		lex.nextToken()
+		en, err := parseExprNode(lex)
+		if err != nil {
+			return nil, err
+		}
+		if !lex.isKeyword(")") {
+			return nil, fmt.Errorf("missing ')' after [%s]; got %q instead", en, lex.token)
+		}
+		lex.nextToken()
+		return en, nil
+	case lex.isKeyword("not"):
+		lex.nextToken()
+		arg, err := parseExprOperand(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse operand for 'not': %w", err)
+		}
+		en := &exprNode{
+			op:   "not",
+			args: []*exprNode{arg},
+		}
+		return en, nil
+	case lex.isKeyword("-"):
+		lex.nextToken()
+		arg, err := parseExprOperand(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse operand for unary minus: %w", err)
+		}
+		en := &exprNode{
+			op:   "unary_minus",
+			args: []*exprNode{arg},
+		}
+		return en, nil
+	case lex.isKeyword("true", "false"):
+		v := strings.ToLower(lex.token)
+		lex.nextToken()
+		en := &exprNode{
+			isConst:       true,
+			constValue:    v,
+			constValueStr: v,
+		}
+		return en, nil
+	case isNumberPrefix(lex.token):
+		numStr, err := lex.nextCompoundTokenExt(exprStopCompoundTokens)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse number: %w", err)
+		}
+		f := parseExprNumber(numStr)
+		if math.IsNaN(f) {
+			return nil, fmt.Errorf("cannot parse number from %q", numStr)
+		}
+		en := &exprNode{
+			isConst:       true,
+			constValue:    string(marshalFloat64String(nil, f)),
+			constValueStr: numStr,
+		}
+		return en, nil
+	}
+
+	if lex.isKeyword("as", ",", ")", "|", "") {
+		return nil, fmt.Errorf("missing operand; got %q instead", lex.token)
+	}
+
+	lexState := lex.backupState()
+	name := strings.ToLower(lex.token)
+	lex.nextToken()
+	if !lex.isSkippedSpace && lex.isKeyword("(") {
+		return parseExprFuncCall(lex, name)
+	}
+	lex.restoreState(lexState)
+
+	fieldName, err := lex.nextCompoundTokenExt(exprStopCompoundTokens)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse field name: %w", err)
+	}
+	fieldName = getCanonicalColumnName(fieldName)
+	en := &exprNode{
+		isField:   true,
+		fieldName: fieldName,
+	}
+	return en, nil
+}
+
+func parseExprFuncCall(lex *lexer, name string) (*exprNode, error) {
+	fi, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q; supported functions: %s", name, strings.Join(getExprFuncNames(), ", "))
+	}
+
+	// skip '('
+	lex.nextToken()
+
+	var args []*exprNode
+	for !lex.isKeyword(")") {
+		arg, err := parseExprNode(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse arg #%d for %s(): %w", len(args)+1, name, err)
+		}
+		args = append(args, arg)
+		if lex.isKeyword(")") {
+			break
+		}
+		if !lex.isKeyword(",") {
+			return nil, fmt.Errorf("unexpected token after [%s] at %s(): %q; want ',' or ')'", arg, name, lex.token)
+		}
+		lex.nextToken()
+	}
+	lex.nextToken()
+
+	if len(args) < fi.minArgs || fi.maxArgs >= 0 && len(args) > fi.maxArgs {
+		return nil, fmt.Errorf("unexpected number of args for %s(); got %d", name, len(args))
+	}
+	if name == "replace" && args[1].isConst && args[1].constValue == "" {
+		return nil, fmt.Errorf("the second arg for replace() cannot be empty")
+	}
+
+	en := &exprNode{
+		op:   name,
+		args: args,
+		f:    fi.f,
+	}
+	return en, nil
+}
+
+func getExprFuncNames() []string {
+	names := make([]string, 0, len(exprFuncs))
+	for name := range exprFuncs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
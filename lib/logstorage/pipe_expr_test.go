@@ -0,0 +1,360 @@
+package logstorage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePipeExprSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParsePipeSuccess(t, pipeStr)
+	}
+
+	f(`expr a as b`)
+	f(`expr "foo bar" as b`)
+	f(`expr 123 as b`)
+	f(`expr 1.5KB as b`)
+	f(`expr -a as b`)
+	f(`expr not a as b`)
+	f(`expr true as b, false as c`)
+	f(`expr a + b * c as d`)
+	f(`expr (a + b) * c as d`)
+	f(`expr a - (b - c) as d`)
+	f(`expr a - b - c as d`)
+	f(`expr a == "x" and b != 3 or c as d`)
+	f(`expr a == "x" and (b != 3 or c) as d`)
+	f(`expr a < 1 or a <= 2 or a > 3 or a >= 4 as d`)
+	f(`expr a > 3 ? "big" : "small" as size`)
+	f(`expr (a ? b : c) ? d : e as x`)
+	f(`expr a ? b : c ? d : e as x`)
+	f(`expr (a ? b : c) + 1 as x`)
+	f(`expr lower(a) as x`)
+	f(`expr concat(a, "-", upper(b)) as x`)
+	f(`expr substr(a, 1) as x, substr(a, 1, 3) as y`)
+	f(`expr if(contains(_msg, "error"), "error", coalesce(level, "info")) as level`)
+	f(`expr len(trim(a)) % 2 as x`)
+	f(`expr replace(a, "foo", "bar") as x`)
+	f(`expr starts_with(a, "x") and ends_with(a, "y") as x`)
+	f(`expr "and" + "or" as x`)
+	f(`expr foo.bar + 1 as "x y"`)
+	f(`expr a + b as c max_steps 1000`)
+	f(`expr a + b as c max_duration 5s`)
+	f(`expr a + b as c, d as e max_steps 1000 max_duration 1.5s`)
+}
+
+func TestParsePipeExprFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParsePipeFailure(t, pipeStr)
+	}
+
+	f(`expr`)
+	f(`expr a`)
+	f(`expr a as`)
+	f(`expr a as *`)
+	f(`expr (a as b`)
+	f(`expr a + as b`)
+	f(`expr a = b as c`)
+	f(`expr a ? b as c`)
+	f(`expr foo(a) as b`)
+	f(`expr lower() as b`)
+	f(`expr lower(a, b) as b`)
+	f(`expr if(a, b) as c`)
+	f(`expr substr(a) as b`)
+	f(`expr lower(a as b`)
+
+	// too complex expression
+	f(`expr ` + strings.Repeat("a + ", maxExprNodes) + `a as b`)
+
+	// empty string to replace
+	f(`expr replace(a, "", "x") as b`)
+
+	// invalid limits
+	f(`expr a as b max_steps`)
+	f(`expr a as b max_steps foo`)
+	f(`expr a as b max_steps 0`)
+	f(`expr a as b max_steps 10 max_steps 20`)
+	f(`expr a as b max_duration`)
+	f(`expr a as b max_duration foo`)
+	f(`expr a as b max_duration 1s max_duration 2s`)
+	f(`expr a as b max_steps 10 foo`)
+}
+
+func TestPipeExpr(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// arithmetic and string concatenation
+	f(`expr a + b * 2 as x, a + "-" + c as y`, [][]Field{
+		{
+			{"a", "3"},
+			{"b", "4"},
+			{"c", "foo"},
+		},
+	}, [][]Field{
+		{
+			{"a", "3"},
+			{"b", "4"},
+			{"c", "foo"},
+			{"x", "11"},
+			{"y", "3-foo"},
+		},
+	})
+
+	// invalid arithmetic
+	f(`expr a * 2 as x`, [][]Field{
+		{
+			{"a", "foo"},
+		},
+	}, [][]Field{
+		{
+			{"a", "foo"},
+			{"x", ""},
+		},
+	})
+
+	// comparisons and ternary operator
+	f(`expr code >= 500 ? "error" : code >= 400 ? "warn" : "info" as level`, [][]Field{
+		{
+			{"code", "503"},
+		},
+		{
+			{"code", "404"},
+		},
+		{
+			{"code", "200"},
+		},
+		{
+			{"code", "abc"},
+		},
+	}, [][]Field{
+		{
+			{"code", "503"},
+			{"level", "error"},
+		},
+		{
+			{"code", "404"},
+			{"level", "warn"},
+		},
+		{
+			{"code", "200"},
+			{"level", "info"},
+		},
+		{
+			{"code", "abc"},
+			{"level", "error"},
+		},
+	})
+
+	// logical operators
+	f(`expr a == "x" and not b as x, a == "y" or b as y`, [][]Field{
+		{
+			{"a", "x"},
+			{"b", "0"},
+		},
+		{
+			{"a", "x"},
+			{"b", "true"},
+		},
+	}, [][]Field{
+		{
+			{"a", "x"},
+			{"b", "0"},
+			{"x", "true"},
+			{"y", "false"},
+		},
+		{
+			{"a", "x"},
+			{"b", "true"},
+			{"x", "false"},
+			{"y", "true"},
+		},
+	})
+
+	// functions
+	f(`expr upper(substr(a, 1, 3)) as x, len(a) as y, if(contains(a, "ф"), "yes", "no") as z, coalesce(missing, b, "def") as w`, [][]Field{
+		{
+			{"a", "афыва"},
+			{"b", ""},
+		},
+	}, [][]Field{
+		{
+			{"a", "афыва"},
+			{"b", ""},
+			{"x", "ФЫВ"},
+			{"y", "5"},
+			{"z", "yes"},
+			{"w", "def"},
+		},
+	})
+
+	// results of the previous entries are available to the next entries
+	f(`expr a * 2 as b, b + 1 as c`, [][]Field{
+		{
+			{"a", "5"},
+		},
+	}, [][]Field{
+		{
+			{"a", "5"},
+			{"b", "10"},
+			{"c", "11"},
+		},
+	})
+}
+
+func TestPipeExprEmptyReplace(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// replace() with empty string to replace returns the original string
+	f(`expr replace(a, b, "x") as c`, [][]Field{
+		{
+			{"a", "foo"},
+		},
+	}, [][]Field{
+		{
+			{"a", "foo"},
+			{"c", "foo"},
+		},
+	})
+}
+
+func TestPipeExprLimitsFailure(t *testing.T) {
+	f := func(pipeStr string, rows [][]Field) {
+		t.Helper()
+
+		lex := newLexer(pipeStr, 0)
+		p, err := parsePipe(lex)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", pipeStr, err)
+		}
+
+		workersCount := 5
+		stopCh := make(chan struct{})
+		ppTest := newTestPipeProcessor()
+		pp := p.newPipeProcessor(workersCount, stopCh, func() {}, ppTest)
+
+		brw := newTestBlockResultWriter(workersCount, pp)
+		for _, row := range rows {
+			brw.writeRow(row)
+		}
+		brw.flush()
+		if err := pp.flush(); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// nested replace() calls, which grow the value exponentially
+	f(`expr replace(replace(replace(replace(a, "x", "xxxxxxxxxx"), "x", "xxxxxxxxxx"), "x", "xxxxxxxxxx"), "x", "xxxxxxxxxx") as b`, [][]Field{
+		{
+			{"a", strings.Repeat("x", 1000)},
+		},
+	})
+
+	// too long concatenation
+	f(`expr concat(a, a, a, a, a) as b`, [][]Field{
+		{
+			{"a", strings.Repeat("x", maxExprValueLen/4)},
+		},
+	})
+	f(`expr a + a + a + a + a as b`, [][]Field{
+		{
+			{"a", strings.Repeat("x", maxExprValueLen/4)},
+		},
+	})
+
+	// too many evaluation steps
+	var rows [][]Field
+	for i := 0; i < 10; i++ {
+		rows = append(rows, []Field{
+			{"a", "1"},
+		})
+	}
+	f(`expr a + 1 as b max_steps 10`, rows)
+}
+
+func TestExprBudget(t *testing.T) {
+	var eb exprBudget
+
+	// too long value
+	if err := eb.reserve(maxExprValueLen + 1); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+
+	// too many bytes per block
+	eb.bytes = 0
+	for i := 0; i < maxExprBlockBytes/maxExprValueLen; i++ {
+		if err := eb.reserve(maxExprValueLen); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := eb.reserve(1); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
+
+func TestPipeExprProcessorCheckLimits(t *testing.T) {
+	f := func(pipeStr string, stepsTotal uint64, durationTotal int64, resultExpected bool) {
+		t.Helper()
+
+		lex := newLexer(pipeStr, 0)
+		p, err := parsePipe(lex)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", pipeStr, err)
+		}
+		pep := p.newPipeProcessor(1, nil, func() {}, newTestPipeProcessor()).(*pipeExprProcessor)
+		pep.stepsTotal.Store(stepsTotal)
+		pep.durationTotal.Store(durationTotal)
+
+		var shard pipeExprProcessorShard
+		err = pep.checkLimits(&shard, 0, time.Now())
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v; err: %v", result, resultExpected, err)
+		}
+	}
+
+	// no limits
+	f(`expr a as b`, 1e12, 1e12, true)
+
+	// max_steps
+	f(`expr a as b max_steps 100`, 100, 0, true)
+	f(`expr a as b max_steps 100`, 101, 0, false)
+
+	// max_duration
+	f(`expr a as b max_duration 1s`, 0, 0.5e9, true)
+	f(`expr a as b max_duration 1s`, 0, 2e9, false)
+}
+
+func TestPipeExprUpdateNeededFields(t *testing.T) {
+	f := func(s string, allowFilters, denyFilters, allowFiltersExpected, denyFiltersExpected string) {
+		t.Helper()
+		expectPipeNeededFields(t, s, allowFilters, denyFilters, allowFiltersExpected, denyFiltersExpected)
+	}
+
+	// all the needed fields
+	f("expr a + b as x", "*", "", "*", "x")
+
+	// all the needed fields, unneeded fields do not intersect with src and dst
+	f("expr a + b as x", "*", "f1,f2", "*", "f1,f2,x")
+
+	// all the needed fields, unneeded fields intersect with src
+	f("expr a + b as x", "*", "a,f1", "*", "f1,x")
+
+	// all the needed fields, unneeded fields intersect with dst
+	f("expr a + b as x", "*", "x,f1", "*", "f1,x")
+
+	// needed fields do not intersect with src and dst
+	f("expr a + b as x", "f1,f2", "", "f1,f2", "")
+
+	// needed fields intersect with dst
+	f("expr a + lower(b) as x", "f1,x", "", "a,b,f1", "")
+
+	// needed fields intersect with src and dst
+	f("expr a ? b : c as x", "a,x", "", "a,b,c", "")
+}
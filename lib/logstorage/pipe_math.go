@@ -3,6 +3,7 @@ package logstorage
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -54,6 +55,9 @@ type mathExpr struct {
 	// f is the function for calculating results for the given mathExpr.
 	f mathFunc
 
+	// timezone is an optional timezone name for time functions such as day_of_week() and hour().
+	timezone string
+
 	// whether the mathExpr was wrapped in parens.
 	wrappedInParens bool
 }
@@ -131,6 +135,9 @@ func (me *mathExpr) String() string {
 	for i, arg := range args {
 		a[i] = arg.String()
 	}
+	if me.timezone != "" {
+		a = append(a, strconv.Quote(me.timezone))
+	}
 	argsStr := strings.Join(a, ", ")
 	return fmt.Sprintf("%s(%s)", me.op, argsStr)
 }
@@ -589,6 +596,10 @@ func parseMathExprOperand(lex *lexer) (*mathExpr, error) {
 		return parseMathExprCeil(lex)
 	case lex.isKeyword("floor"):
 		return parseMathExprFloor(lex)
+	case lex.isKeyword("day_of_week") && isNextTokenOpenParen(lex):
+		return parseMathExprTimeFunc(lex, "day_of_week", getDayOfWeek)
+	case lex.isKeyword("hour") && isNextTokenOpenParen(lex):
+		return parseMathExprTimeFunc(lex, "hour", getHour)
 	case lex.isKeyword("-"):
 		return parseMathExprUnaryMinus(lex)
 	case lex.isKeyword("+"):
@@ -730,6 +741,73 @@ func parseMathExprFloor(lex *lexer) (*mathExpr, error) {
 	return me, nil
 }
 
+// isNextTokenOpenParen returns true if the token next to the current token is '('.
+//
+// This allows using names of time functions such as hour as regular field names.
+func isNextTokenOpenParen(lex *lexer) bool {
+	lexState := lex.backupState()
+	lex.nextToken()
+	ok := lex.isKeyword("(")
+	lex.restoreState(lexState)
+	return ok
+}
+
+// parseMathExprTimeFunc parses funcName(x, "timezone") function, which returns getValue(t) for the timestamp t at x in the given timezone.
+//
+// The timezone arg is optional. UTC timezone is used if it is missing.
+func parseMathExprTimeFunc(lex *lexer, funcName string, getValue func(t time.Time) int) (*mathExpr, error) {
+	if !lex.isKeyword(funcName) {
+		return nil, fmt.Errorf("missing %q keyword", funcName)
+	}
+	lex.nextToken()
+
+	if !lex.isKeyword("(") {
+		return nil, fmt.Errorf("missing '(' after %q", funcName)
+	}
+	lex.nextToken()
+
+	arg, err := parseMathExpr(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the first arg for %q function: %w", funcName, err)
+	}
+
+	timezone := ""
+	loc := time.UTC
+	if lex.isKeyword(",") {
+		lex.nextToken()
+		tz, err := lex.nextCompoundToken()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read timezone for %q function: %w", funcName, err)
+		}
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load timezone %q for %q function: %w", tz, funcName, err)
+		}
+		timezone = tz
+	}
+
+	if !lex.isKeyword(")") {
+		return nil, fmt.Errorf("unexpected token for %q function: %q; want ')'", funcName, lex.token)
+	}
+	lex.nextToken()
+
+	me := &mathExpr{
+		args:     []*mathExpr{arg},
+		op:       funcName,
+		f:        newMathFuncTime(loc, getValue),
+		timezone: timezone,
+	}
+	return me, nil
+}
+
+func getDayOfWeek(t time.Time) int {
+	return int(t.Weekday())
+}
+
+func getHour(t time.Time) int {
+	return t.Hour()
+}
+
 func parseMathExprGenericFunc(lex *lexer, funcName string, f mathFunc) (*mathExpr, error) {
 	if !lex.isKeyword(funcName) {
 		return nil, fmt.Errorf("missing %q keyword", funcName)
@@ -1016,6 +1094,20 @@ func mathFuncNow(result []float64, _ [][]float64) {
 	}
 }
 
+func newMathFuncTime(loc *time.Location, getValue func(t time.Time) int) mathFunc {
+	return func(result []float64, args [][]float64) {
+		arg := args[0]
+		for i := range result {
+			if math.IsNaN(arg[i]) {
+				result[i] = nan
+				continue
+			}
+			t := time.Unix(0, int64(arg[i])).In(loc)
+			result[i] = float64(getValue(t))
+		}
+	}
+}
+
 func mathFuncRound(result []float64, args [][]float64) {
 	arg := args[0]
 	if len(args) == 1 {
@@ -32,6 +32,11 @@ func TestParsePipeMathSuccess(t *testing.T) {
 	f(`math (x - (y + z)) as x`)
 	f(`math now() as current_time`)
 	f(`math round((now() - max_time) / 1s) as duration_seconds`)
+	f(`math day_of_week(_time) as dow`)
+	f(`math day_of_week(_time, "Europe/Berlin") as dow`)
+	f(`math hour(_time) as h`)
+	f(`math hour(_time + 1h, "America/New_York") as h`)
+	f(`math (hour * 2) as x`)
 }
 
 func TestParsePipeMathFailure(t *testing.T) {
@@ -56,6 +61,10 @@ func TestParsePipeMathFailure(t *testing.T) {
 	f(`math round(a, b, c) as x`)
 	f(`math rand(123) as x`)
 	f(`math now(123) as x`)
+	f(`math day_of_week() as x`)
+	f(`math day_of_week(_time, "foo/bar") as x`)
+	f(`math day_of_week(_time, "UTC", x) as x`)
+	f(`math hour(_time,) as x`)
 }
 
 func TestPipeMath(t *testing.T) {
@@ -91,6 +100,34 @@ func TestPipeMath(t *testing.T) {
 		},
 	})
 
+	f(`math day_of_week(_time) as dow_utc, day_of_week(_time, "Asia/Tokyo") as dow_tokyo, hour(_time) as h_utc, hour(_time, "America/New_York") as h_ny, hour * 2 as x`, [][]Field{
+		{
+			{"_time", "2024-05-31T20:30:00Z"},
+			{"hour", "3"},
+		},
+		{
+			{"_time", "foo"},
+		},
+	}, [][]Field{
+		{
+			{"_time", "2024-05-31T20:30:00Z"},
+			{"hour", "3"},
+			{"dow_utc", "5"},
+			{"dow_tokyo", "6"},
+			{"h_utc", "20"},
+			{"h_ny", "16"},
+			{"x", "6"},
+		},
+		{
+			{"_time", "foo"},
+			{"dow_utc", "NaN"},
+			{"dow_tokyo", "NaN"},
+			{"h_utc", "NaN"},
+			{"h_ny", "NaN"},
+			{"x", "NaN"},
+		},
+	})
+
 	f("eval b+1 as a, a*2 as b, b-10.5+c as c", [][]Field{
 		{
 			{"a", "v1"},
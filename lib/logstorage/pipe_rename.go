@@ -62,13 +62,43 @@ func (pr *pipeRename) updateNeededFields(pf *prefixfilter.Filter) {
 		}
 
 		if needSrcField {
-			pf.AddAllowFilter(srcFieldFilter)
+			addNeededSrcFields(pf, srcFieldFilter, dstFieldFilter)
 		} else {
 			pf.AddDenyFilter(srcFieldFilter)
 		}
 	}
 }
 
+// addNeededSrcFields adds the fields matching srcFieldFilter, which are needed for obtaining the fields matching dstFieldFilter, to pf.
+//
+// If both srcFieldFilter and dstFieldFilter are wildcards such as `src*` and `dst*`, while pf contains only full field names,
+// then only `src<suffix>` fields are added for the needed `dst<suffix>` fields instead of all the `src*` fields.
+// This reduces the number of columns to read from the storage.
+func addNeededSrcFields(pf *prefixfilter.Filter, srcFieldFilter, dstFieldFilter string) {
+	if !prefixfilter.IsWildcardFilter(srcFieldFilter) || !prefixfilter.IsWildcardFilter(dstFieldFilter) {
+		pf.AddAllowFilter(srcFieldFilter)
+		return
+	}
+	fields, ok := pf.GetAllowStrings()
+	if !ok {
+		pf.AddAllowFilter(srcFieldFilter)
+		return
+	}
+
+	srcPrefix := srcFieldFilter[:len(srcFieldFilter)-1]
+	dstPrefix := dstFieldFilter[:len(dstFieldFilter)-1]
+
+	var srcFields []string
+	for _, f := range fields {
+		if suffix, ok := strings.CutPrefix(f, dstPrefix); ok && pf.MatchString(f) {
+			srcFields = append(srcFields, srcPrefix+suffix)
+		}
+	}
+	for _, f := range srcFields {
+		pf.AddAllowFilter(f)
+	}
+}
+
 func (pr *pipeRename) hasFilterInWithQuery() bool {
 	return false
 }
@@ -300,12 +300,16 @@ func TestPipeRenameUpdateNeededFields(t *testing.T) {
 	// needed fields intersect with dst
 	f("rename s1 d1, s2 d2", "d1,f1,f2", "", "f1,f2,s1", "")
 	f("rename s1 d1, s2 d2", "d*,f*", "", "d*,f*,s1,s2", "d1,d2")
-	f("rename s1* d1*, s2 d2", "d1,f1,f2", "", "d1,f1,f2,s1*", "")
+	f("rename s1* d1*, s2 d2", "d1,f1,f2", "", "d1,f1,f2,s1", "")
 
 	// needed fields intersect with src and dst
 	f("rename s1 d1, s2 d2", "s1,d1,f1,f2", "", "f1,f2,s1", "")
 	f("rename s1 d1, s2 d2", "s1,d2,f1,f2", "", "f1,f2,s2", "")
 	f("rename s1 d1, s2 d2", "s2,d1,f1,f2", "", "f1,f2,s1", "")
 	f("rename s1 d1, s2 d2", "s*,d*,f*", "", "d*,f*,s*", "d1,d2")
-	f("rename s1* d1*, s2 d2", "s2,d1,f1,f2", "", "d1,f1,f2,s1*", "")
+	f("rename s1* d1*, s2 d2", "s2,d1,f1,f2", "", "d1,f1,f2,s1", "")
+
+	// needed fields with the dst prefix for wildcard rename
+	f("rename s* d*", "d1,dx,f1", "", "d1,dx,f1,s1,sx", "")
+	f("rename s* dst_*", "d1,dst_x,f1", "", "d1,dst_x,f1,sx", "")
 }
@@ -155,6 +155,8 @@ func newPipeSortProcessor(ps *pipeSort, stopCh <-chan struct{}, cancel func(), p
 		ppNext: ppNext,
 
 		maxStateSize: maxStateSize,
+
+		ss: newSpillStorage(),
 	}
 	psp.shards.Init = func(shard *pipeSortProcessorShard) {
 		shard.ps = ps
@@ -174,6 +176,17 @@ type pipeSortProcessor struct {
 
 	maxStateSize    int64
 	stateSizeBudget atomic.Int64
+
+	// ss holds sorted runs spilled to disk when the state doesn't fit maxStateSize.
+	//
+	// It is nil if spilling to disk is disabled. See SetSpillToDisk.
+	ss *spillStorage
+
+	// runsLock protects runs
+	runsLock sync.Mutex
+
+	// runs contains sorted runs spilled to disk
+	runs []*spillFile
 }
 
 type pipeSortProcessorShard struct {
@@ -195,8 +208,20 @@ type pipeSortProcessorShard struct {
 	// The per-shard budget is provided in chunks from the parent pipeSortProcessor.
 	stateSizeBudget int
 
+	// stateSizeAcquired is the budget acquired by the shard from the parent pipeSortProcessor.
+	stateSizeAcquired int
+
 	// columnValues is used as temporary buffer at pipeSortProcessorShard.writeBlock
 	columnValues [][]string
+
+	// run is the sorted run spilled to disk, which is read by the shard during merge shards phase.
+	run *spillFile
+
+	// runBuf is a temporary buffer for reading the run.
+	runBuf []byte
+
+	// runValuesBuf is a temporary buffer for values read from the run.
+	runValuesBuf []string
 }
 
 // sortBlock represents a block of logs for sorting.
@@ -211,6 +236,21 @@ type sortBlock struct {
 	otherColumns []*blockResultColumn
 }
 
+// hasTimeColumn returns true if b contains _time column with timestamps.
+func (b *sortBlock) hasTimeColumn() bool {
+	for i := range b.byColumns {
+		if b.byColumns[i].c.isTime {
+			return true
+		}
+	}
+	for _, c := range b.otherColumns {
+		if c.isTime {
+			return true
+		}
+	}
+	return false
+}
+
 // sortBlockByColumn represents data for a single column from 'sort by(...)' clause.
 type sortBlockByColumn struct {
 	// c contains column data
@@ -221,6 +261,9 @@ type sortBlockByColumn struct {
 
 	// f64Values contains float64 numbers parsed from values
 	f64Values []float64
+
+	// lowercaseValues contains lowercase values for the column if it must be sorted case-insensitively
+	lowercaseValues []string
 }
 
 // sortRowRef is the reference to a single log entry written to `sort` pipe.
@@ -246,6 +289,16 @@ func (c *sortBlockByColumn) getF64ValueAtRow(rowIdx int) float64 {
 	return c.f64Values[rowIdx]
 }
 
+func (c *sortBlockByColumn) getStringValueAtRow(br *blockResult, rowIdx int) string {
+	if c.lowercaseValues == nil {
+		return c.c.getValueAtRow(br, rowIdx)
+	}
+	if c.c.isConst {
+		return c.lowercaseValues[0]
+	}
+	return c.lowercaseValues[rowIdx]
+}
+
 // writeBlock writes br to shard.
 func (shard *pipeSortProcessorShard) writeBlock(br *blockResult) {
 	// clone br, so it could be owned by shard
@@ -325,6 +378,9 @@ func (shard *pipeSortProcessorShard) writeBlock(br *blockResult) {
 			if c.isConst {
 				bc.i64Values = shard.createInt64Values(c.valuesEncoded)
 				bc.f64Values = shard.createFloat64Values(c.valuesEncoded)
+				if bf.ignoreCase {
+					bc.lowercaseValues = shard.createLowercaseValues(c.valuesEncoded)
+				}
 				continue
 			}
 
@@ -332,6 +388,9 @@ func (shard *pipeSortProcessorShard) writeBlock(br *blockResult) {
 			values := c.getValues(br)
 			bc.i64Values = shard.createInt64Values(values)
 			bc.f64Values = shard.createFloat64Values(values)
+			if bf.ignoreCase {
+				bc.lowercaseValues = shard.createLowercaseValues(values)
+			}
 		}
 		shard.stateSizeBudget -= len(byColumns) * int(unsafe.Sizeof(byColumns[0]))
 
@@ -376,6 +435,25 @@ func (shard *pipeSortProcessorShard) writeBlock(br *blockResult) {
 	shard.stateSizeBudget -= (len(rowRefs) - rowRefsLen) * int(unsafe.Sizeof(rowRefs[0]))
 }
 
+func (shard *pipeSortProcessorShard) createLowercaseValues(values []string) []string {
+	a := make([]string, len(values))
+	for i, v := range values {
+		if i > 0 && values[i-1] == v {
+			a[i] = a[i-1]
+			continue
+		}
+		s := strings.ToLower(v)
+		a[i] = s
+		if s != v {
+			shard.stateSizeBudget -= len(s)
+		}
+	}
+
+	shard.stateSizeBudget -= len(a) * int(unsafe.Sizeof(a[0]))
+
+	return a
+}
+
 func (shard *pipeSortProcessorShard) createInt64Values(values []string) []int64 {
 	a := make([]int64, len(values))
 	for i, v := range values {
@@ -423,6 +501,155 @@ func (shard *pipeSortProcessorShard) Less(i, j int) bool {
 	return sortBlockLess(shard, i, shard, j)
 }
 
+// sortRows sorts shard.rowRefs.
+//
+// Rows are sorted individually per every block at first. This is fast for blocks read from the storage,
+// since every such block contains logs for a single stream sorted by _time, so the rows are already sorted
+// for the default `sort by (_time)` and `sort by (_time) desc` queries.
+// Then the sorted blocks are merged with k-way merge instead of the global sort of all the rows at the shard.
+func (shard *pipeSortProcessorShard) sortRows() {
+	if sort.IsSorted(shard) {
+		// Fast path - the shard is already sorted. This is the case when the sorted rows
+		// are received from the remote storage.
+		return
+	}
+	if len(shard.blocks) < 2 {
+		sort.Sort(shard)
+		return
+	}
+
+	// Sort rows per every block. Rows for every block are stored in a contiguous range at shard.rowRefs.
+	sh := make(sortRowRefsRangesHeap, 0, len(shard.blocks))
+	start := 0
+	for i := range shard.blocks {
+		end := start + shard.blocks[i].br.rowsLen
+		r := sortRowRefsRange{
+			shard: shard,
+			start: start,
+			end:   end,
+		}
+		r.sort()
+		sh = append(sh, r)
+		start = end
+	}
+
+	// Merge the sorted blocks.
+	rowRefs := make([]sortRowRef, 0, len(shard.rowRefs))
+	heap.Init(&sh)
+	for len(sh) > 1 {
+		r := &sh[0]
+		rowRefs = append(rowRefs, shard.rowRefs[r.start])
+		r.start++
+		if r.start >= r.end {
+			_ = heap.Pop(&sh)
+		} else {
+			sh.siftDown()
+		}
+	}
+	if len(sh) == 1 {
+		r := &sh[0]
+		rowRefs = append(rowRefs, shard.rowRefs[r.start:r.end]...)
+	}
+	shard.rowRefs = rowRefs
+}
+
+// sortRowRefsRange represents a range of rows at shard.rowRefs, which belong to a single block.
+type sortRowRefsRange struct {
+	shard *pipeSortProcessorShard
+	start int
+	end   int
+}
+
+func (r *sortRowRefsRange) Len() int {
+	return r.end - r.start
+}
+
+func (r *sortRowRefsRange) Swap(i, j int) {
+	r.shard.Swap(r.start+i, r.start+j)
+}
+
+func (r *sortRowRefsRange) Less(i, j int) bool {
+	return r.shard.Less(r.start+i, r.start+j)
+}
+
+// sort sorts rows in r.
+//
+// Rows sorted in the reverse order are reversed in linear time. This is the case for `sort by (_time) desc`,
+// since rows in blocks read from the storage are sorted by _time in ascending order.
+func (r *sortRowRefsRange) sort() {
+	if sort.IsSorted(r) {
+		return
+	}
+
+	isReverseSorted := true
+	for i := r.Len() - 1; i > 0; i-- {
+		if r.Less(i-1, i) {
+			isReverseSorted = false
+			break
+		}
+	}
+	if isReverseSorted {
+		slices.Reverse(r.shard.rowRefs[r.start:r.end])
+		return
+	}
+
+	sort.Sort(r)
+}
+
+type sortRowRefsRangesHeap []sortRowRefsRange
+
+func (sh *sortRowRefsRangesHeap) Len() int {
+	return len(*sh)
+}
+
+func (sh *sortRowRefsRangesHeap) Swap(i, j int) {
+	a := *sh
+	a[i], a[j] = a[j], a[i]
+}
+
+func (sh *sortRowRefsRangesHeap) Less(i, j int) bool {
+	return sh.less(i, j)
+}
+
+// siftDown moves the top item to the correct position at sh.
+//
+// It is faster than heap.Fix(sh, 0), since it avoids calls via interface.
+func (sh *sortRowRefsRangesHeap) siftDown() {
+	a := *sh
+	i := 0
+	for {
+		j := 2*i + 1
+		if j >= len(a) {
+			return
+		}
+		if j+1 < len(a) && sh.less(j+1, j) {
+			j++
+		}
+		if !sh.less(j, i) {
+			return
+		}
+		a[i], a[j] = a[j], a[i]
+		i = j
+	}
+}
+
+func (sh *sortRowRefsRangesHeap) less(i, j int) bool {
+	a := *sh
+	return sortBlockLess(a[i].shard, a[i].start, a[j].shard, a[j].start)
+}
+
+func (sh *sortRowRefsRangesHeap) Push(x any) {
+	r := x.(sortRowRefsRange)
+	*sh = append(*sh, r)
+}
+
+func (sh *sortRowRefsRangesHeap) Pop() any {
+	a := *sh
+	x := a[len(a)-1]
+	*sh = a[:len(a)-1]
+	return x
+}
+
 func (psp *pipeSortProcessor) writeBlock(workerID uint, br *blockResult) {
 	if br.rowsLen == 0 {
 		return
@@ -433,6 +660,22 @@ func (psp *pipeSortProcessor) writeBlock(workerID uint, br *blockResult) {
 	for shard.stateSizeBudget < 0 {
 		// steal some budget for the state size from the global budget.
 		remaining := psp.stateSizeBudget.Add(-stateSizeBudgetChunk)
+		if remaining < 0 && psp.ss != nil {
+			if shard.stateSizeAcquired > 0 {
+				// Spill the shard state to disk and return the acquired budget to the global budget.
+				psp.stateSizeBudget.Add(stateSizeBudgetChunk)
+				if err := psp.spillShard(shard); err != nil {
+					psp.ss.setError(err)
+					psp.cancel()
+					return
+				}
+				continue
+			}
+
+			// The budget is held by other shards, which will spill their state to disk on the next write.
+			// Allow exceeding the budget by a single chunk per shard meanwhile.
+			remaining = 0
+		}
 		if remaining < 0 {
 			// The state size is too big. Stop processing data in order to avoid OOM crash.
 			if remaining+stateSizeBudgetChunk >= 0 {
@@ -442,13 +685,132 @@ func (psp *pipeSortProcessor) writeBlock(workerID uint, br *blockResult) {
 			return
 		}
 		shard.stateSizeBudget += stateSizeBudgetChunk
+		shard.stateSizeAcquired += stateSizeBudgetChunk
 	}
 
 	shard.writeBlock(br)
 }
 
+// spillShard sorts the shard and writes it as a sorted run to disk. Then it resets the shard and returns the acquired budget to psp.
+func (psp *pipeSortProcessor) spillShard(shard *pipeSortProcessorShard) error {
+	if err := psp.ss.getError(); err != nil {
+		return err
+	}
+
+	shard.sortRows()
+
+	sf, err := psp.ss.newFile()
+	if err != nil {
+		return err
+	}
+
+	var db DataBlock
+	var buf []byte
+	wctx := &pipeSortWriteContext{}
+	wctx.writeBlock = func(br *blockResult) {
+		if err != nil {
+			return
+		}
+
+		// Store whether the block contains _time column with timestamps, so it is restored with the same type.
+		// This preserves the sort order for the block, since timestamps are sorted differently than strings.
+		buf = append(buf[:0], 0)
+		if wctx.hasTimeColumn {
+			buf[0] = 1
+		}
+		db.initFromBlockResult(br)
+		buf = db.Marshal(buf)
+		err = sf.write(buf)
+	}
+	for shard.rowRefNext < len(shard.rowRefs) {
+		wctx.writeNextRow(shard)
+	}
+	wctx.flush()
+	if err != nil {
+		return err
+	}
+	if err := sf.finishWrite(); err != nil {
+		return err
+	}
+
+	psp.runsLock.Lock()
+	psp.runs = append(psp.runs, sf)
+	psp.runsLock.Unlock()
+
+	clear(shard.blocks)
+	shard.blocks = shard.blocks[:0]
+	shard.rowRefs = shard.rowRefs[:0]
+	shard.rowRefNext = 0
+
+	psp.stateSizeBudget.Add(int64(shard.stateSizeAcquired))
+	shard.stateSizeBudget = 0
+	shard.stateSizeAcquired = 0
+
+	return nil
+}
+
+// nextRunBlock loads the next block from shard.run into the shard.
+//
+// false is returned if there are no more blocks in shard.run or if the shard doesn't read the run.
+func (shard *pipeSortProcessorShard) nextRunBlock(ss *spillStorage) bool {
+	if shard.run == nil {
+		return false
+	}
+
+	clear(shard.blocks)
+	shard.blocks = shard.blocks[:0]
+	shard.rowRefs = shard.rowRefs[:0]
+	shard.rowRefNext = 0
+
+	buf, ok, err := shard.run.read(shard.runBuf[:0])
+	shard.runBuf = buf
+	if err != nil {
+		ss.setError(err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	if len(buf) == 0 {
+		ss.setError(fmt.Errorf("unexpected empty sorted block at temporary file"))
+		return false
+	}
+	hasTimeColumn := buf[0] == 1
+
+	var db DataBlock
+	if _, shard.runValuesBuf, err = db.UnmarshalInplace(buf[1:], shard.runValuesBuf[:0]); err != nil {
+		ss.setError(fmt.Errorf("cannot unmarshal sorted block from temporary file: %w", err))
+		return false
+	}
+
+	var br blockResult
+	if hasTimeColumn {
+		br.initFromDataBlock(&db)
+	} else {
+		br.rowsLen = db.RowsCount()
+		for _, c := range db.Columns {
+			br.addResultColumn(resultColumn{
+				name:   c.Name,
+				values: c.Values,
+			})
+		}
+	}
+
+	// shard.writeBlock clones br, so runBuf and runValuesBuf can be reused for the next block.
+	shard.writeBlock(&br)
+
+	return len(shard.rowRefs) > 0
+}
+
 func (psp *pipeSortProcessor) flush() error {
-	if n := psp.stateSizeBudget.Load(); n <= 0 {
+	if psp.ss != nil {
+		defer psp.ss.mustClose()
+
+		if err := psp.ss.getError(); err != nil {
+			return fmt.Errorf("cannot calculate [%s]: %w", psp.ps.String(), err)
+		}
+	} else if n := psp.stateSizeBudget.Load(); n <= 0 {
 		return fmt.Errorf("cannot calculate [%s], since it requires more than %dMB of memory", psp.ps.String(), psp.maxStateSize/(1<<20))
 	}
 
@@ -470,12 +832,7 @@ func (psp *pipeSortProcessor) flush() error {
 
 			// TODO: interrupt long sorting when psp.stopCh is closed.
 
-			if sort.IsSorted(shard) {
-				// Fast path - the shard is already sorted. This is the case when the sorted rows
-				// are received from the remote storage.
-				return
-			}
-			sort.Sort(shard)
+			shard.sortRows()
 		}(shard)
 	}
 	wg.Wait()
@@ -484,6 +841,33 @@ func (psp *pipeSortProcessor) flush() error {
 		return nil
 	}
 
+	if len(psp.runs) > 0 {
+		// Some shards were spilled to disk. Spill the remaining shards too,
+		// so all the rows are merged from sorted runs with the same representation.
+		for _, shard := range shards {
+			if len(shard.rowRefs) == 0 {
+				continue
+			}
+			if err := psp.spillShard(shard); err != nil {
+				return fmt.Errorf("cannot calculate [%s]: %w", psp.ps.String(), err)
+			}
+		}
+
+		shards = make([]*pipeSortProcessorShard, 0, len(psp.runs))
+		for _, sf := range psp.runs {
+			shard := &pipeSortProcessorShard{
+				ps:  psp.ps,
+				run: sf,
+			}
+			if shard.nextRunBlock(psp.ss) {
+				shards = append(shards, shard)
+			}
+		}
+		if err := psp.ss.getError(); err != nil {
+			return fmt.Errorf("cannot calculate [%s]: %w", psp.ps.String(), err)
+		}
+	}
+
 	// Merge sorted results across shards
 	sh := pipeSortProcessorShardsHeap(make([]*pipeSortProcessorShard, 0, len(shards)))
 	for _, shard := range shards {
@@ -497,8 +881,13 @@ func (psp *pipeSortProcessor) flush() error {
 
 	heap.Init(&sh)
 
+	ps := psp.ps
 	wctx := &pipeSortWriteContext{
-		psp: psp,
+		offset:        ps.offset,
+		rankFieldName: ps.rankFieldName,
+		writeBlock: func(br *blockResult) {
+			psp.ppNext.writeBlock(0, br)
+		},
 	}
 	shardNextIdx := 0
 
@@ -507,7 +896,11 @@ func (psp *pipeSortProcessor) flush() error {
 		wctx.writeNextRow(shard)
 
 		if shard.rowRefNext >= len(shard.rowRefs) {
-			_ = heap.Pop(&sh)
+			if shard.nextRunBlock(psp.ss) {
+				heap.Fix(&sh, 0)
+			} else {
+				_ = heap.Pop(&sh)
+			}
 			shardNextIdx = 0
 
 			if needStop(psp.stopCh) {
@@ -535,17 +928,39 @@ func (psp *pipeSortProcessor) flush() error {
 	}
 	if len(sh) == 1 {
 		shard := sh[0]
-		for shard.rowRefNext < len(shard.rowRefs) {
-			wctx.writeNextRow(shard)
+		for {
+			for shard.rowRefNext < len(shard.rowRefs) {
+				wctx.writeNextRow(shard)
+			}
+			if !shard.nextRunBlock(psp.ss) {
+				break
+			}
 		}
 	}
 	wctx.flush()
 
+	if psp.ss != nil {
+		if err := psp.ss.getError(); err != nil {
+			return fmt.Errorf("cannot calculate [%s]: %w", psp.ps.String(), err)
+		}
+	}
+
 	return nil
 }
 
 type pipeSortWriteContext struct {
-	psp *pipeSortProcessor
+	// offset is the number of rows to skip
+	offset uint64
+
+	// rankFieldName is the name of the field to write the rank of the row to. It is empty if the rank isn't needed.
+	rankFieldName string
+
+	// writeBlock is called for every sorted block
+	writeBlock func(br *blockResult)
+
+	// hasTimeColumn is set to true if the current block contains _time column with timestamps.
+	hasTimeColumn bool
+
 	rcs []resultColumn
 	br  blockResult
 
@@ -564,7 +979,7 @@ type pipeSortWriteContext struct {
 
 func (wctx *pipeSortWriteContext) writeNextRow(shard *pipeSortProcessorShard) {
 	ps := shard.ps
-	rankFieldName := ps.rankFieldName
+	rankFieldName := wctx.rankFieldName
 	rankFields := 0
 	if rankFieldName != "" {
 		rankFields = 1
@@ -574,7 +989,7 @@ func (wctx *pipeSortWriteContext) writeNextRow(shard *pipeSortProcessorShard) {
 	shard.rowRefNext++
 
 	wctx.rowsWritten++
-	if wctx.rowsWritten <= ps.offset {
+	if wctx.rowsWritten <= wctx.offset {
 		return
 	}
 
@@ -584,7 +999,8 @@ func (wctx *pipeSortWriteContext) writeNextRow(shard *pipeSortProcessorShard) {
 	byFields := ps.byFields
 	rcs := wctx.rcs
 
-	areEqualColumns := len(rcs) == rankFields+len(byFields)+len(b.otherColumns)
+	hasTimeColumn := b.hasTimeColumn()
+	areEqualColumns := len(rcs) == rankFields+len(byFields)+len(b.otherColumns) && hasTimeColumn == wctx.hasTimeColumn
 	if areEqualColumns {
 		for i, c := range b.otherColumns {
 			if rcs[rankFields+len(byFields)+i].name != c.name {
@@ -608,6 +1024,7 @@ func (wctx *pipeSortWriteContext) writeNextRow(shard *pipeSortProcessorShard) {
 			rcs = appendResultColumnWithName(rcs, c.name)
 		}
 		wctx.rcs = rcs
+		wctx.hasTimeColumn = hasTimeColumn
 	}
 
 	if rankFieldName != "" {
@@ -643,10 +1060,14 @@ func (wctx *pipeSortWriteContext) flush() {
 
 	wctx.valuesLen = 0
 
-	// Flush rcs to ppNext
+	if wctx.rowsCount == 0 {
+		return
+	}
+
+	// Flush rcs to the next pipe
 	br.setResultColumns(rcs, wctx.rowsCount)
 	wctx.rowsCount = 0
-	wctx.psp.ppNext.writeBlock(0, br)
+	wctx.writeBlock(br)
 	br.reset()
 	for i := range rcs {
 		rcs[i].resetValues()
@@ -750,8 +1171,8 @@ func sortBlockLess(shardA *pipeSortProcessorShard, rowIdxA int, shardB *pipeSort
 		}
 
 		// Fall back to string sorting
-		sA := cA.c.getValueAtRow(bA.br, rrA.rowIdx)
-		sB := cB.c.getValueAtRow(bB.br, rrB.rowIdx)
+		sA := cA.getStringValueAtRow(bA.br, rrA.rowIdx)
+		sB := cB.getStringValueAtRow(bB.br, rrB.rowIdx)
 		if sA == sB {
 			continue
 		}
@@ -845,10 +1266,16 @@ type bySortField struct {
 
 	// whether the sorting for the given field in descending order
 	isDesc bool
+
+	// whether the given field values must be compared case-insensitively
+	ignoreCase bool
 }
 
 func (bf *bySortField) String() string {
 	s := quoteTokenIfNeeded(bf.name)
+	if bf.ignoreCase {
+		s += " ignore_case"
+	}
 	if bf.isDesc {
 		s += " desc"
 	}
@@ -873,6 +1300,10 @@ func parseBySortFields(lex *lexer) ([]*bySortField, error) {
 		bf := &bySortField{
 			name: fieldName,
 		}
+		if lex.isKeyword("ignore_case") {
+			lex.nextToken()
+			bf.ignoreCase = true
+		}
 		switch {
 		case lex.isKeyword("desc"):
 			lex.nextToken()
@@ -1,6 +1,8 @@
 package logstorage
 
 import (
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -19,6 +21,7 @@ func TestParsePipeSortSuccess(t *testing.T) {
 	f(`sort by (x) offset 20 limit 10 rank as bar`)
 	f(`sort by (x desc, y) desc`)
 	f(`sort by (a, b) partition by (y, z) limit 10`)
+	f(`sort by (x ignore_case, y ignore_case desc)`)
 }
 
 func TestParsePipeSortFailure(t *testing.T) {
@@ -73,6 +76,118 @@ func TestPipeSort(t *testing.T) {
 		},
 	})
 
+	// Sort case-insensitively
+	f("sort by (a ignore_case) rank x", [][]Field{
+		{
+			{"a", `B`},
+		},
+		{
+			{"a", `a`},
+		},
+		{
+			{"a", `C`},
+		},
+		{
+			{"a", `host10`},
+		},
+		{
+			{"a", `Host2`},
+		},
+	}, [][]Field{
+		{
+			{"a", `a`},
+			{"x", "1"},
+		},
+		{
+			{"a", `B`},
+			{"x", "2"},
+		},
+		{
+			{"a", `C`},
+			{"x", "3"},
+		},
+		{
+			{"a", `Host2`},
+			{"x", "4"},
+		},
+		{
+			{"a", `host10`},
+			{"x", "5"},
+		},
+	})
+
+	// Sort case-insensitively in descending order with limit
+	f("sort by (a ignore_case desc) limit 3 rank x", [][]Field{
+		{
+			{"a", `B`},
+		},
+		{
+			{"a", `a`},
+		},
+		{
+			{"a", `C`},
+		},
+		{
+			{"a", `host10`},
+		},
+		{
+			{"a", `Host2`},
+		},
+	}, [][]Field{
+		{
+			{"a", `host10`},
+			{"x", "1"},
+		},
+		{
+			{"a", `Host2`},
+			{"x", "2"},
+		},
+		{
+			{"a", `C`},
+			{"x", "3"},
+		},
+	})
+
+	// Sort case-sensitively
+	f("sort by (a) rank x", [][]Field{
+		{
+			{"a", `B`},
+		},
+		{
+			{"a", `a`},
+		},
+		{
+			{"a", `C`},
+		},
+		{
+			{"a", `host10`},
+		},
+		{
+			{"a", `Host2`},
+		},
+	}, [][]Field{
+		{
+			{"a", `B`},
+			{"x", "1"},
+		},
+		{
+			{"a", `C`},
+			{"x", "2"},
+		},
+		{
+			{"a", `Host2`},
+			{"x", "3"},
+		},
+		{
+			{"a", `a`},
+			{"x", "4"},
+		},
+		{
+			{"a", `host10`},
+			{"x", "5"},
+		},
+	})
+
 	// Sort by all fields with rank
 	f("sort rank x", [][]Field{
 		{
@@ -410,3 +525,61 @@ func TestPipeSortUpdateNeededFields(t *testing.T) {
 	f("order by(s1,s2) rank as x", "s1,f1,f2,x", "", "s1,s2,f1,f2", "")
 	f("order by(s1,s2) limit 1 partition by (x,y) rank as x", "s1,f1,f2,x", "", "s1,s2,f1,f2,x,y", "")
 }
+
+func TestPipeSortProcessorShardSortRows(t *testing.T) {
+	f := func(pipeStr string, blocks [][]string) {
+		t.Helper()
+
+		lex := newLexer(pipeStr, 0)
+		p, err := parsePipeSort(lex)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", pipeStr, err)
+		}
+		shard := &pipeSortProcessorShard{
+			ps: p.(*pipeSort),
+		}
+		var valuesExpected []string
+		for _, values := range blocks {
+			var rc resultColumn
+			rc.name = "x"
+			for _, v := range values {
+				rc.addValue(v)
+			}
+			valuesExpected = append(valuesExpected, values...)
+
+			var br blockResult
+			br.setResultColumns([]resultColumn{rc}, len(values))
+			shard.writeBlock(&br)
+		}
+
+		shard.sortRows()
+
+		if !sort.IsSorted(shard) {
+			t.Fatalf("rows aren't sorted for %q", pipeStr)
+		}
+		var values []string
+		for _, rr := range shard.rowRefs {
+			b := &shard.blocks[rr.blockIdx]
+			values = append(values, b.byColumns[0].c.getValueAtRow(b.br, rr.rowIdx))
+		}
+		sort.Strings(values)
+		sort.Strings(valuesExpected)
+		if !reflect.DeepEqual(values, valuesExpected) {
+			t.Fatalf("unexpected values; got %q; want %q", values, valuesExpected)
+		}
+	}
+
+	// a single block
+	f("sort by (x)", [][]string{{"c", "a", "b"}})
+
+	// sorted blocks
+	f("sort by (x)", [][]string{{"a", "c", "e"}, {"b", "d", "f"}, {"a", "a", "z"}})
+
+	// reverse sorted blocks
+	f("sort by (x) desc", [][]string{{"a", "c", "e"}, {"b", "d", "f"}, {"1", "5", "10"}})
+	f("sort by (x)", [][]string{{"e", "c", "a"}, {"f", "d", "b"}})
+
+	// unsorted blocks
+	f("sort by (x)", [][]string{{"c", "a", "e", "b"}, {"3", "1", "2"}, {"x"}})
+	f("sort by (x) desc", [][]string{{"c", "a", "e", "b"}, {"3", "10", "2"}, {"x", "x"}})
+}
@@ -3,6 +3,7 @@ package logstorage
 import (
 	"container/heap"
 	"fmt"
+	"math"
 	"slices"
 	"sort"
 	"strings"
@@ -34,6 +35,13 @@ func newPipeTopkProcessor(ps *pipeSort, stopCh <-chan struct{}, cancel func(), p
 	}
 	ptp.stateSizeBudget.Store(maxStateSize)
 
+	ptp.pruneTimeRanges = len(ps.partitionByFields) == 0 && len(ps.byFields) > 0 && ps.byFields[0].name == "_time"
+	if ptp.isTimeDesc() {
+		ptp.timeThreshold.Store(math.MinInt64)
+	} else {
+		ptp.timeThreshold.Store(math.MaxInt64)
+	}
+
 	return ptp
 }
 
@@ -47,6 +55,71 @@ type pipeTopkProcessor struct {
 
 	maxStateSize    int64
 	stateSizeBudget atomic.Int64
+
+	// pruneTimeRanges is set if the rows are sorted by _time at first and there are no partitions.
+	//
+	// In this case time ranges, which cannot change the results, can be skipped during the search. See canSkipTimeRange.
+	pruneTimeRanges bool
+
+	// timeThreshold contains the _time of the worst row among the full set of top rows collected by some shard.
+	//
+	// Logs with _time worse than timeThreshold cannot change the results.
+	timeThreshold atomic.Int64
+}
+
+// canPruneTimeRanges returns true if ptp supports skipping time ranges, which cannot change the results.
+func (ptp *pipeTopkProcessor) canPruneTimeRanges() bool {
+	return ptp.pruneTimeRanges
+}
+
+// isTimeDesc returns true if the rows are sorted by _time in descending order.
+func (ptp *pipeTopkProcessor) isTimeDesc() bool {
+	ps := ptp.ps
+	if len(ps.byFields) == 0 {
+		return ps.isDesc
+	}
+	return ps.isDesc != ps.byFields[0].isDesc
+}
+
+// canSkipTimeRange implements timeRangePruner interface.
+func (ptp *pipeTopkProcessor) canSkipTimeRange(minTimestamp, maxTimestamp int64) bool {
+	if !ptp.pruneTimeRanges {
+		return false
+	}
+	threshold := ptp.timeThreshold.Load()
+	if ptp.isTimeDesc() {
+		return maxTimestamp < threshold
+	}
+	return minTimestamp > threshold
+}
+
+// preferNewerLogs implements timeRangePruner interface.
+func (ptp *pipeTopkProcessor) preferNewerLogs() bool {
+	return ptp.isTimeDesc()
+}
+
+// updateTimeThreshold updates ptp.timeThreshold from the rows collected by the given shard.
+func (ptp *pipeTopkProcessor) updateTimeThreshold(shard *pipeTopkProcessorShard) {
+	rs := shard.rowsByPartition[""]
+	if rs == nil || uint64(len(rs.rows)) < ptp.ps.offset+ptp.ps.limit {
+		// The shard has no full set of top rows yet.
+		return
+	}
+	r := rs.rows[0]
+	if !r.byColumnsIsTime[0] {
+		return
+	}
+
+	isDesc := ptp.isTimeDesc()
+	for {
+		threshold := ptp.timeThreshold.Load()
+		if isDesc && r.timestamp <= threshold || !isDesc && r.timestamp >= threshold {
+			return
+		}
+		if ptp.timeThreshold.CompareAndSwap(threshold, r.timestamp) {
+			return
+		}
+	}
 }
 
 type pipeTopkProcessorShard struct {
@@ -376,6 +449,10 @@ func (ptp *pipeTopkProcessor) writeBlock(workerID uint, br *blockResult) {
 	}
 
 	shard.writeBlock(br)
+
+	if ptp.pruneTimeRanges {
+		ptp.updateTimeThreshold(shard)
+	}
 }
 
 func (ptp *pipeTopkProcessor) flush() error {
@@ -685,20 +762,36 @@ func topkLess(ps *pipeSort, a, b *pipeTopkRow) bool {
 			vB = bytesutil.ToUnsafeString(bb.B)
 		}
 
-		if vA == vB {
-			if bb != nil {
-				bbPool.Put(bb)
-			}
-			continue
+		var bbA, bbB *bytesutil.ByteBuffer
+		if len(byFields) > 0 && byFields[i].ignoreCase {
+			bbA = bbPool.Get()
+			bbB = bbPool.Get()
+			bbA.B = stringsutil.AppendLowercase(bbA.B[:0], vA)
+			bbB.B = stringsutil.AppendLowercase(bbB.B[:0], vB)
+			vA = bytesutil.ToUnsafeString(bbA.B)
+			vB = bytesutil.ToUnsafeString(bbB.B)
 		}
 
-		if isDesc {
-			vA, vB = vB, vA
+		isEqual := vA == vB
+		ok := false
+		if !isEqual {
+			if isDesc {
+				vA, vB = vB, vA
+			}
+			ok = lessString(vA, vB)
 		}
-		ok := lessString(vA, vB)
+
 		if bb != nil {
 			bbPool.Put(bb)
 		}
+		if bbA != nil {
+			bbPool.Put(bbA)
+			bbPool.Put(bbB)
+		}
+
+		if isEqual {
+			continue
+		}
 		return ok
 	}
 	return false
@@ -522,6 +522,8 @@ func initStatsConcurrency(sfp statsProcessor, concurrency uint) {
 		t.concurrency = concurrency
 	case *statsUniqValuesProcessor:
 		t.concurrency = concurrency
+	case *statsCardinalityRateProcessor:
+		t.sup.concurrency = concurrency
 	}
 }
 
@@ -576,11 +578,7 @@ func (shard *pipeStatsProcessorShard) writeBlockDefault(br *blockResult) {
 	columnValues := slicesutil.SetLength(shard.columnValues, len(byFields))
 	for i, bf := range byFields {
 		c := br.getColumnByName(bf.name)
-		if bf.hasBucketConfig() {
-			columnValues[i] = c.getValuesBucketed(br, bf)
-		} else {
-			columnValues[i] = c.getValues(br)
-		}
+		columnValues[i] = bf.getValues(br, c)
 	}
 	shard.columnValues = columnValues
 
@@ -709,13 +707,16 @@ func (shard *pipeStatsProcessorShard) updateStatsSingleColumn(br *blockResult, b
 		if bf.hasBucketConfig() {
 			v = br.getBucketedValue(c.valuesEncoded[0], bf)
 		}
+		if bf.ignoreCase {
+			v = strings.ToLower(v)
+		}
 		psg := shard.getPipeStatsGroupGeneric(v)
 		shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp)
 		return
 	}
 
-	if bf.hasBucketConfig() {
-		values := c.getValuesBucketed(br, bf)
+	if bf.hasBucketConfig() || bf.ignoreCase {
+		values := bf.getValues(br, c)
 		if areConstValues(values) {
 			// Fast path - values are constant after bucketing.
 			psg := shard.getPipeStatsGroupGeneric(values[0])
@@ -1361,6 +1362,16 @@ func parseStatsFunc(lex *lexer) (statsFunc, error) {
 		}
 		return sf, nil
 	}
+
+	if !lex.isQuotedToken() && getCustomStatsFunc(lex.token) != nil {
+		funcName := lex.token
+		sf, err := parseStatsCustom(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse custom stats func %q: %w", funcName, err)
+		}
+		return sf, nil
+	}
+
 	return nil, fmt.Errorf("unknown stats func %q", lex.token)
 }
 
@@ -1376,33 +1387,38 @@ func getStatsFuncParsers() map[string]statsFuncParser {
 
 func initStatsFuncParsers() {
 	statsFuncParsers = map[string]statsFuncParser{
-		"avg":             parseStatsAvg,
-		"count":           parseStatsCount,
-		"count_empty":     parseStatsCountEmpty,
-		"count_uniq":      parseStatsCountUniq,
-		"count_uniq_hash": parseStatsCountUniqHash,
-		"histogram":       parseStatsHistogram,
-		"json_values":     parseStatsJSONValues,
-		"max":             parseStatsMax,
-		"median":          parseStatsMedian,
-		"min":             parseStatsMin,
-		"quantile":        parseStatsQuantile,
-		"rate":            parseStatsRate,
-		"rate_sum":        parseStatsRateSum,
-		"row_any":         parseStatsRowAny,
-		"row_max":         parseStatsRowMax,
-		"row_min":         parseStatsRowMin,
-		"sum":             parseStatsSum,
-		"sum_len":         parseStatsSumLen,
-		"uniq_values":     parseStatsUniqValues,
-		"values":          parseStatsValues,
+		"avg":               parseStatsAvg,
+		"avg_len":           parseStatsAvgLen,
+		"cardinality_rate":  parseStatsCardinalityRate,
+		"count":             parseStatsCount,
+		"count_empty":       parseStatsCountEmpty,
+		"count_uniq":        parseStatsCountUniq,
+		"count_uniq_hash":   parseStatsCountUniqHash,
+		"count_uniq_approx": parseStatsCountUniqApprox,
+		"entropy":           parseStatsEntropy,
+		"histogram":         parseStatsHistogram,
+		"json_values":       parseStatsJSONValues,
+		"max":               parseStatsMax,
+		"median":            parseStatsMedian,
+		"min":               parseStatsMin,
+		"quantile":          parseStatsQuantile,
+		"rate":              parseStatsRate,
+		"rate_sum":          parseStatsRateSum,
+		"row_any":           parseStatsRowAny,
+		"row_max":           parseStatsRowMax,
+		"row_min":           parseStatsRowMin,
+		"sum":               parseStatsSum,
+		"sum_len":           parseStatsSumLen,
+		"topk_approx":       parseStatsTopkApprox,
+		"uniq_values":       parseStatsUniqValues,
+		"values":            parseStatsValues,
 	}
 }
 
 func isStatsFuncName(s string) bool {
 	sps := getStatsFuncParsers()
 	sLower := strings.ToLower(s)
-	return sps[sLower] != nil
+	return sps[sLower] != nil || getCustomStatsFunc(sLower) != nil
 }
 
 // byStatsField represents 'by (...)' part of the pipeStats.
@@ -1424,6 +1440,11 @@ type byStatsField struct {
 
 	// bucketOffset is the offset for bucketSize
 	bucketOffset float64
+
+	// ignoreCase is set if the field values must be grouped case-insensitively.
+	//
+	// The field values are converted to lowercase in this case.
+	ignoreCase bool
 }
 
 func (bf *byStatsField) String() string {
@@ -1434,9 +1455,26 @@ func (bf *byStatsField) String() string {
 			s += " offset " + bf.bucketOffsetStr
 		}
 	}
+	if bf.ignoreCase {
+		s += " ignore_case"
+	}
 	return s
 }
 
+// getValues returns values for bf from c, which belongs to br.
+func (bf *byStatsField) getValues(br *blockResult, c *blockResultColumn) []string {
+	var values []string
+	if bf.hasBucketConfig() {
+		values = c.getValuesBucketed(br, bf)
+	} else {
+		values = c.getValues(br)
+	}
+	if bf.ignoreCase {
+		values = br.getLowercaseStrings(values)
+	}
+	return values
+}
+
 func (bf *byStatsField) hasBucketConfig() bool {
 	return len(bf.bucketSizeStr) > 0 || len(bf.bucketOffsetStr) > 0
 }
@@ -1494,6 +1532,10 @@ func parseByStatsFields(lex *lexer) ([]*byStatsField, error) {
 				bf.bucketOffset = bucketOffset
 			}
 		}
+		if lex.isKeyword("ignore_case") {
+			lex.nextToken()
+			bf.ignoreCase = true
+		}
 		bfs = append(bfs, bf)
 		switch {
 		case lex.isKeyword(")"):
@@ -1593,6 +1635,22 @@ func parseFieldNamesInParens(lex *lexer) ([]string, error) {
 	return fieldNames, nil
 }
 
+// parseCommaSeparatedFieldNames parses comma-separated field names without parens.
+//
+// Wildcard field names are rejected in the same way as at parseFieldNamesInParens.
+func parseCommaSeparatedFieldNames(lex *lexer) ([]string, error) {
+	fieldNames, err := parseCommaSeparatedFields(lex)
+	if err != nil {
+		return nil, err
+	}
+	for _, fieldName := range fieldNames {
+		if prefixfilter.IsWildcardFilter(fieldName) {
+			return nil, fmt.Errorf("the field name %q cannot end with '*'", fieldName)
+		}
+	}
+	return fieldNames, nil
+}
+
 func parseFieldFiltersInParens(lex *lexer) ([]string, error) {
 	if !lex.isKeyword("(") {
 		return nil, fmt.Errorf("missing `(`")
@@ -15,6 +15,7 @@ func TestParsePipeStatsSuccess(t *testing.T) {
 	f(`stats by (x) count(*) as rows, count_uniq(x) as uniqs`)
 	f(`stats by (_time:month offset 6.5h, y) count(*) as rows, count_uniq(x) as uniqs`)
 	f(`stats by (_time:month offset 6.5h, y) count(*) if (q:w) as rows, count_uniq(x) as uniqs`)
+	f(`stats by (x ignore_case, y:10 offset 5 ignore_case) count(*) as rows`)
 }
 
 func TestParsePipeStatsFailure(t *testing.T) {
@@ -44,6 +45,63 @@ func TestPipeStats(t *testing.T) {
 		expectPipeResults(t, pipeStr, rows, rowsExpected)
 	}
 
+	// group by a single field case-insensitively
+	f("stats by (host ignore_case) count() rows", [][]Field{
+		{
+			{"host", `Foo`},
+		},
+		{
+			{"host", `foo`},
+		},
+		{
+			{"host", `FOO`},
+		},
+		{
+			{"host", `bar`},
+		},
+		{},
+	}, [][]Field{
+		{
+			{"host", "foo"},
+			{"rows", "3"},
+		},
+		{
+			{"host", "bar"},
+			{"rows", "1"},
+		},
+		{
+			{"host", ""},
+			{"rows", "1"},
+		},
+	})
+
+	// group by multiple fields case-insensitively
+	f("stats by (host ignore_case, app) count() rows", [][]Field{
+		{
+			{"host", `Foo`},
+			{"app", `x`},
+		},
+		{
+			{"host", `foo`},
+			{"app", `x`},
+		},
+		{
+			{"host", `FOO`},
+			{"app", `X`},
+		},
+	}, [][]Field{
+		{
+			{"host", "foo"},
+			{"app", "x"},
+			{"rows", "2"},
+		},
+		{
+			{"host", "foo"},
+			{"app", "X"},
+			{"rows", "1"},
+		},
+	})
+
 	// missing 'stats' keyword and result name
 	f("count(*)", [][]Field{
 		{
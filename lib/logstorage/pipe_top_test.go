@@ -32,6 +32,8 @@ func TestParsePipeTopFailure(t *testing.T) {
 	f(`top 5foo bar`)
 	f(`top foo bar`)
 	f(`top by`)
+	f(`top 5 *`)
+	f(`top 5 foo*`)
 	f(`top (x) rank a b`)
 	f(`top (x) hits`)
 	f(`top`)
@@ -6,6 +6,8 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/cespare/xxhash/v2"
+
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
@@ -88,6 +90,10 @@ func (pu *pipeUniq) newPipeProcessor(concurrency int, stopCh <-chan struct{}, ca
 
 		maxStateSize: maxStateSize,
 	}
+	if pu.limit == 0 {
+		// There is no need in spilling the state to disk when the limit is set, since the state size is limited by the limit.
+		pup.ss = newSpillStorage()
+	}
 	pup.shards.Init = func(shard *pipeUniqProcessorShard) {
 		shard.pu = pu
 		shard.m.init(uint(concurrency), &shard.stateSizeBudget)
@@ -107,8 +113,24 @@ type pipeUniqProcessor struct {
 
 	maxStateSize    int64
 	stateSizeBudget atomic.Int64
+
+	// ss holds the state spilled to disk when it doesn't fit maxStateSize.
+	//
+	// It is nil if spilling to disk is disabled. See SetSpillToDisk.
+	ss *spillStorage
+
+	// bucketsLock protects buckets
+	bucketsLock sync.Mutex
+
+	// buckets contains the spilled state partitioned by hash of the unique entries.
+	//
+	// Every bucket is processed independently at flush, so it needs up to 1/uniqSpillBucketsCount of the memory needed for the whole state.
+	buckets []*spillFile
 }
 
+// uniqSpillBucketsCount is the number of buckets for spilling the `uniq` pipe state to disk.
+const uniqSpillBucketsCount = 64
+
 type pipeUniqProcessorShard struct {
 	// pu points to the parent pipeUniq.
 	pu *pipeUniq
@@ -125,6 +147,9 @@ type pipeUniqProcessorShard struct {
 	// stateSizeBudget is the remaining budget for the whole state size for the shard.
 	// The per-shard budget is provided in chunks from the parent pipeUniqProcessor.
 	stateSizeBudget int
+
+	// stateSizeAcquired is the budget acquired by the shard from the parent pipeUniqProcessor.
+	stateSizeAcquired int
 }
 
 // writeBlock writes br to shard.
@@ -236,6 +261,22 @@ func (pup *pipeUniqProcessor) writeBlock(workerID uint, br *blockResult) {
 	for shard.stateSizeBudget < 0 {
 		// steal some budget for the state size from the global budget.
 		remaining := pup.stateSizeBudget.Add(-stateSizeBudgetChunk)
+		if remaining < 0 && pup.ss != nil {
+			if shard.stateSizeAcquired > 0 {
+				// Spill the shard state to disk and return the acquired budget to the global budget.
+				pup.stateSizeBudget.Add(stateSizeBudgetChunk)
+				if err := pup.spillShard(shard); err != nil {
+					pup.ss.setError(err)
+					pup.cancel()
+					return
+				}
+				continue
+			}
+
+			// The budget is held by other shards, which will spill their state to disk on the next write.
+			// Allow exceeding the budget by a single chunk per shard meanwhile.
+			remaining = 0
+		}
 		if remaining < 0 {
 			// The state size is too big. Stop processing data in order to avoid OOM crash.
 			if remaining+stateSizeBudgetChunk >= 0 {
@@ -245,6 +286,7 @@ func (pup *pipeUniqProcessor) writeBlock(workerID uint, br *blockResult) {
 			return
 		}
 		shard.stateSizeBudget += stateSizeBudgetChunk
+		shard.stateSizeAcquired += stateSizeBudgetChunk
 	}
 
 	if !shard.writeBlock(br) {
@@ -252,8 +294,168 @@ func (pup *pipeUniqProcessor) writeBlock(workerID uint, br *blockResult) {
 	}
 }
 
+// spillShard writes the shard state to disk buckets. Then it resets the shard and returns the acquired budget to pup.
+func (pup *pipeUniqProcessor) spillShard(shard *pipeUniqProcessorShard) error {
+	if err := pup.ss.getError(); err != nil {
+		return err
+	}
+
+	// Spill shards one-by-one in order to avoid concurrent writes to buckets.
+	pup.bucketsLock.Lock()
+	defer pup.bucketsLock.Unlock()
+
+	if pup.buckets == nil {
+		buckets := make([]*spillFile, uniqSpillBucketsCount)
+		for i := range buckets {
+			sf, err := pup.ss.newFile()
+			if err != nil {
+				return err
+			}
+			buckets[i] = sf
+		}
+		pup.buckets = buckets
+	}
+
+	// Every bucket buffer contains a sequence of (key, hits) entries.
+	bufs := make([][]byte, len(pup.buckets))
+	var err error
+	addEntry := func(key string, hits uint64) {
+		if err != nil {
+			return
+		}
+		idx := xxhash.Sum64String(key) % uint64(len(bufs))
+		buf := encoding.MarshalBytes(bufs[idx], bytesutil.ToUnsafeBytes(key))
+		buf = encoding.MarshalVarUint64(buf, hits)
+		if len(buf) >= 256*1024 {
+			err = pup.buckets[idx].write(buf)
+			buf = buf[:0]
+		}
+		bufs[idx] = buf
+	}
+
+	var tmpBuf []byte
+	forEachHitsMap(&shard.m, func(hm *hitsMap) {
+		for n, pHits := range hm.u64 {
+			tmpBuf = marshalUint64String(tmpBuf[:0], n)
+			addEntry(bytesutil.ToUnsafeString(tmpBuf), *pHits)
+		}
+		for n, pHits := range hm.negative64 {
+			tmpBuf = marshalInt64String(tmpBuf[:0], int64(n))
+			addEntry(bytesutil.ToUnsafeString(tmpBuf), *pHits)
+		}
+		for k, pHits := range hm.strings {
+			addEntry(k, *pHits)
+		}
+	})
+	for i, buf := range bufs {
+		if err == nil && len(buf) > 0 {
+			err = pup.buckets[i].write(buf)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	shard.m.init(shard.m.concurrency, &shard.stateSizeBudget)
+
+	pup.stateSizeBudget.Add(int64(shard.stateSizeAcquired))
+	shard.stateSizeBudget = 0
+	shard.stateSizeAcquired = 0
+
+	return nil
+}
+
+// flushSpilled writes the state spilled to disk buckets to the next pipe.
+func (pup *pipeUniqProcessor) flushSpilled() error {
+	// Spill the remaining shards, so all the state is stored in buckets.
+	for _, shard := range pup.shards.All() {
+		if shard.m.entriesCount() == 0 {
+			continue
+		}
+		if err := pup.spillShard(shard); err != nil {
+			return err
+		}
+	}
+
+	// Process buckets one-by-one in order to limit memory usage.
+	var buf []byte
+	for _, sf := range pup.buckets {
+		if needStop(pup.stopCh) {
+			return nil
+		}
+
+		if err := sf.finishWrite(); err != nil {
+			return err
+		}
+
+		var stateSizeBudget int
+		var hma hitsMapAdaptive
+		hma.init(1, &stateSizeBudget)
+		for {
+			var ok bool
+			var err error
+			buf, ok, err = sf.read(buf[:0])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+
+			src := buf
+			for len(src) > 0 {
+				key, n := encoding.UnmarshalBytes(src)
+				if n <= 0 {
+					return fmt.Errorf("cannot unmarshal key from temporary file")
+				}
+				src = src[n:]
+				hits, n := encoding.UnmarshalVarUint64(src)
+				if n <= 0 {
+					return fmt.Errorf("cannot unmarshal hits from temporary file")
+				}
+				src = src[n:]
+
+				if len(pup.pu.byFields) == 1 {
+					hma.updateStateGeneric(bytesutil.ToUnsafeString(key), hits)
+				} else {
+					hma.updateStateString(key, hits)
+				}
+			}
+		}
+
+		forEachHitsMap(&hma, func(hm *hitsMap) {
+			pup.writeShardData(0, hm, false)
+		})
+	}
+
+	return nil
+}
+
+// forEachHitsMap calls f for every hitsMap in hma.
+func forEachHitsMap(hma *hitsMapAdaptive, f func(hm *hitsMap)) {
+	if hma.hmShards == nil {
+		f(&hma.hm)
+		return
+	}
+	for i := range hma.hmShards {
+		f(&hma.hmShards[i].hitsMap)
+	}
+}
+
 func (pup *pipeUniqProcessor) flush() error {
-	if n := pup.stateSizeBudget.Load(); n <= 0 {
+	if pup.ss != nil {
+		defer pup.ss.mustClose()
+
+		if err := pup.ss.getError(); err != nil {
+			return fmt.Errorf("cannot calculate [%s]: %w", pup.pu.String(), err)
+		}
+		if pup.buckets != nil {
+			if err := pup.flushSpilled(); err != nil {
+				return fmt.Errorf("cannot calculate [%s]: %w", pup.pu.String(), err)
+			}
+			return nil
+		}
+	} else if n := pup.stateSizeBudget.Load(); n <= 0 {
 		return fmt.Errorf("cannot calculate [%s], since it requires more than %dMB of memory", pup.pu.String(), pup.maxStateSize/(1<<20))
 	}
 
@@ -542,7 +744,7 @@ func parsePipeUniq(lex *lexer) (pipe, error) {
 		}
 		byFields = bfs
 	} else if !lex.isKeyword("with", "hits", "limit", ")", "|", "") {
-		bfs, err := parseCommaSeparatedFields(lex)
+		bfs, err := parseCommaSeparatedFieldNames(lex)
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse 'by ...': %w", err)
 		}
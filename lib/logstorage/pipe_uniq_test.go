@@ -30,6 +30,8 @@ func TestParsePipeUniqFailure(t *testing.T) {
 	f(`uniq by ()`)
 	f(`uniq by (*)`)
 	f(`uniq by (a*)`)
+	f(`uniq *`)
+	f(`uniq a, b*`)
 	f(`uniq by`)
 	f(`uniq by hits`)
 	f(`uniq by foo bar`)
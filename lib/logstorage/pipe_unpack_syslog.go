@@ -61,7 +61,8 @@ func (pu *pipeUnpackSyslog) canReturnLastNResults() bool {
 }
 
 func (pu *pipeUnpackSyslog) updateNeededFields(pf *prefixfilter.Filter) {
-	updateNeededFieldsForUnpackPipe(pu.fromField, pu.resultPrefix, nil, pu.keepOriginalFields, false, pu.iff, pf)
+	// unpack_syslog may produce arbitrary fields from structured data, so all the fields starting with resultPrefix must be taken into account.
+	updateNeededFieldsForUnpackPipe(pu.fromField, pu.resultPrefix, []string{"*"}, pu.keepOriginalFields, false, pu.iff, pf)
 }
 
 func (pu *pipeUnpackSyslog) hasFilterInWithQuery() bool {
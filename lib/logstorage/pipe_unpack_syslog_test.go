@@ -293,4 +293,12 @@ func TestPipeUnpackSyslogUpdateNeededFields(t *testing.T) {
 	f("unpack_syslog from x result_prefix foo_", "*", "", "*", "")
 	f("unpack_syslog from x result_prefix foo_ keep_original_fields", "*", "", "*", "")
 	f("unpack_syslog if (y:z) from x result_prefix foo_", "*", "", "*", "")
+
+	// needed fields do not intersect with fields with 'result_prefix'
+	f("unpack_syslog from x result_prefix foo_", "f1,f2", "", "f1,f2", "")
+	f("unpack_syslog if (y:z) from x result_prefix foo_", "f1,f2", "", "f1,f2", "")
+
+	// needed fields intersect with fields with 'result_prefix'
+	f("unpack_syslog from x result_prefix foo_", "f1,foo_hostname", "", "f1,foo_hostname,x", "")
+	f("unpack_syslog if (y:z) from x result_prefix foo_", "f1,foo_*", "", "f1,foo_*,x,y", "")
 }
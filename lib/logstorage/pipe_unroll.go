@@ -230,7 +230,7 @@ func parsePipeUnroll(lex *lexer) (pipe, error) {
 		}
 		fields = fs
 	} else {
-		fs, err := parseCommaSeparatedFields(lex)
+		fs, err := parseCommaSeparatedFieldNames(lex)
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse 'by ...': %w", err)
 		}
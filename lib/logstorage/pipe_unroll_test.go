@@ -32,6 +32,7 @@ func TestParsePipeUrollFailure(t *testing.T) {
 	f(`unroll by (x) if (a:b)`)
 	f(`unroll foo bar`)
 	f(`unroll foo, `)
+	f(`unroll foo*`)
 }
 
 func TestPipeUnroll(t *testing.T) {
@@ -68,6 +68,25 @@ func (qs *QueryStats) UpdateAtomic(src *QueryStats) {
 	atomic.AddUint64(&qs.BytesProcessedUncompressedValues, src.BytesProcessedUncompressedValues)
 }
 
+// LoadAtomic returns a copy of qs, which may be updated concurrently via UpdateAtomic.
+func (qs *QueryStats) LoadAtomic() QueryStats {
+	return QueryStats{
+		BytesReadColumnsHeaders:       atomic.LoadUint64(&qs.BytesReadColumnsHeaders),
+		BytesReadColumnsHeaderIndexes: atomic.LoadUint64(&qs.BytesReadColumnsHeaderIndexes),
+		BytesReadBloomFilters:         atomic.LoadUint64(&qs.BytesReadBloomFilters),
+		BytesReadValues:               atomic.LoadUint64(&qs.BytesReadValues),
+		BytesReadTimestamps:           atomic.LoadUint64(&qs.BytesReadTimestamps),
+		BytesReadBlockHeaders:         atomic.LoadUint64(&qs.BytesReadBlockHeaders),
+
+		BlocksProcessed:                  atomic.LoadUint64(&qs.BlocksProcessed),
+		RowsProcessed:                    atomic.LoadUint64(&qs.RowsProcessed),
+		RowsFound:                        atomic.LoadUint64(&qs.RowsFound),
+		ValuesRead:                       atomic.LoadUint64(&qs.ValuesRead),
+		TimestampsRead:                   atomic.LoadUint64(&qs.TimestampsRead),
+		BytesProcessedUncompressedValues: atomic.LoadUint64(&qs.BytesProcessedUncompressedValues),
+	}
+}
+
 // UpdateAtomicFromDataBlock adds query stats from db to qs.
 func (qs *QueryStats) UpdateFromDataBlock(db *DataBlock) error {
 	rowsCount := db.RowsCount()
@@ -0,0 +1,178 @@
+package logstorage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	spillDir     string
+	maxSpillSize int64
+)
+
+// SetSpillToDisk enables spilling the state of memory-heavy pipes such as `sort` and `uniq` to temporary files at the given dir
+// when the state doesn't fit the memory limits.
+//
+// maxSize limits the total size of temporary files per every pipe. Spilling to disk is disabled if dir is empty.
+// This function must be called before executing queries.
+func SetSpillToDisk(dir string, maxSize int64) {
+	if dir != "" {
+		fs.MustMkdirIfNotExist(dir)
+	}
+	spillDir = dir
+	maxSpillSize = maxSize
+}
+
+// spillStorage holds temporary files with the spilled state for a single pipe.
+type spillStorage struct {
+	// sizeBudget is the remaining size, which can be written to temporary files.
+	sizeBudget atomic.Int64
+
+	mu    sync.Mutex
+	files []*spillFile
+	err   error
+}
+
+// newSpillStorage returns new spillStorage.
+//
+// nil is returned if spilling to disk is disabled. See SetSpillToDisk.
+func newSpillStorage() *spillStorage {
+	if spillDir == "" {
+		return nil
+	}
+	ss := &spillStorage{}
+	ss.sizeBudget.Store(maxSpillSize)
+	return ss
+}
+
+// newFile returns new temporary file for spilling the state.
+func (ss *spillStorage) newFile() (*spillFile, error) {
+	f, err := os.CreateTemp(spillDir, "spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create temporary file for spilling the pipe state to disk: %w", err)
+	}
+
+	// Remove the file immediately, so it is automatically deleted after closing, even on unclean shutdown.
+	if err := os.Remove(f.Name()); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("cannot remove temporary file %q: %w", f.Name(), err)
+	}
+
+	sf := &spillFile{
+		ss: ss,
+		f:  f,
+		bw: bufio.NewWriterSize(f, 256*1024),
+	}
+
+	ss.mu.Lock()
+	ss.files = append(ss.files, sf)
+	ss.mu.Unlock()
+
+	spillFilesCreated.Inc()
+
+	return sf, nil
+}
+
+// setError registers the given err occurred during spilling the state to disk.
+func (ss *spillStorage) setError(err error) {
+	ss.mu.Lock()
+	if ss.err == nil {
+		ss.err = err
+	}
+	ss.mu.Unlock()
+}
+
+// getError returns the first error registered via setError.
+func (ss *spillStorage) getError() error {
+	ss.mu.Lock()
+	err := ss.err
+	ss.mu.Unlock()
+	return err
+}
+
+// mustClose closes all the temporary files created via newFile.
+func (ss *spillStorage) mustClose() {
+	ss.mu.Lock()
+	files := ss.files
+	ss.files = nil
+	ss.mu.Unlock()
+
+	for _, sf := range files {
+		_ = sf.f.Close()
+	}
+}
+
+// spillFile is a temporary file with length-prefixed records.
+//
+// Records are written via write. Then finishWrite must be called before reading records via read.
+type spillFile struct {
+	ss *spillStorage
+	f  *os.File
+	bw *bufio.Writer
+	br *bufio.Reader
+
+	tmpBuf []byte
+}
+
+// write writes a record with the given data to sf.
+func (sf *spillFile) write(data []byte) error {
+	sf.tmpBuf = binary.AppendUvarint(sf.tmpBuf[:0], uint64(len(data)))
+	size := len(sf.tmpBuf) + len(data)
+	if n := sf.ss.sizeBudget.Add(-int64(size)); n < 0 {
+		return fmt.Errorf("cannot spill the pipe state to disk, since it requires more than -search.maxSpillSize=%dMB of disk space", maxSpillSize/(1<<20))
+	}
+	spillBytesWritten.Add(size)
+
+	if _, err := sf.bw.Write(sf.tmpBuf); err != nil {
+		return fmt.Errorf("cannot write to temporary file %q: %w", sf.f.Name(), err)
+	}
+	if _, err := sf.bw.Write(data); err != nil {
+		return fmt.Errorf("cannot write to temporary file %q: %w", sf.f.Name(), err)
+	}
+	return nil
+}
+
+// finishWrite finishes writing records to sf and prepares it for reading.
+func (sf *spillFile) finishWrite() error {
+	if err := sf.bw.Flush(); err != nil {
+		return fmt.Errorf("cannot flush data to temporary file %q: %w", sf.f.Name(), err)
+	}
+	sf.bw = nil
+	if _, err := sf.f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("cannot seek to the start of temporary file %q: %w", sf.f.Name(), err)
+	}
+	sf.br = bufio.NewReaderSize(sf.f, 256*1024)
+	return nil
+}
+
+// read appends the next record from sf to dst and returns the result.
+//
+// false is returned if there are no more records in sf.
+func (sf *spillFile) read(dst []byte) ([]byte, bool, error) {
+	n, err := binary.ReadUvarint(sf.br)
+	if err != nil {
+		if err == io.EOF {
+			return dst, false, nil
+		}
+		return dst, false, fmt.Errorf("cannot read record size from temporary file %q: %w", sf.f.Name(), err)
+	}
+	dstLen := len(dst)
+	dst = append(dst, make([]byte, n)...)
+	if _, err := io.ReadFull(sf.br, dst[dstLen:]); err != nil {
+		return dst[:dstLen], false, fmt.Errorf("cannot read record with size %d bytes from temporary file %q: %w", n, sf.f.Name(), err)
+	}
+	return dst, true, nil
+}
+
+var (
+	spillFilesCreated = metrics.NewCounter(`vl_select_spill_files_created_total`)
+	spillBytesWritten = metrics.NewCounter(`vl_select_spill_bytes_written_total`)
+)
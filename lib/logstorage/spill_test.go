@@ -0,0 +1,169 @@
+package logstorage
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipeSortSpillToDisk(t *testing.T) {
+	const rowsCount = 30_000
+
+	baseTimestamp := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+	var rows [][]Field
+	for _, n := range rand.Perm(rowsCount) {
+		rows = append(rows, []Field{
+			{Name: "_time", Value: string(marshalTimestampRFC3339NanoString(nil, baseTimestamp+int64(n)*1e6))},
+			{Name: "n", Value: strconv.Itoa(n)},
+			{Name: "s", Value: fmt.Sprintf("value_%d_%s", n%100, strings.Repeat("x", 100))},
+		})
+	}
+
+	runPipe := func(pipeStr string, spill, isTime bool) [][]Field {
+		t.Helper()
+
+		if spill {
+			SetSpillToDisk(t.TempDir(), 1<<30)
+			defer SetSpillToDisk("", 0)
+		}
+
+		lex := newLexer(pipeStr, 0)
+		p, err := parsePipe(lex)
+		if err != nil {
+			t.Fatalf("cannot parse [%s]: %s", pipeStr, err)
+		}
+
+		workersCount := 5
+		stopCh := make(chan struct{})
+		ppTest := newTestPipeProcessor()
+		pp := p.newPipeProcessor(workersCount, stopCh, func() {}, ppTest)
+
+		psp := pp.(*pipeSortProcessor)
+		if spill {
+			// Limit the state size, so it is spilled to disk.
+			psp.stateSizeBudget.Store(2 * stateSizeBudgetChunk)
+		}
+
+		if isTime {
+			// Write blocks with _time column containing timestamps in the same way as blocks are read from storage.
+			for i := 0; i < len(rows); i += 1000 {
+				var db DataBlock
+				for j, f := range rows[0] {
+					values := make([]string, 0, 1000)
+					for _, row := range rows[i:min(i+1000, len(rows))] {
+						values = append(values, row[j].Value)
+					}
+					db.Columns = append(db.Columns, BlockColumn{
+						Name:   f.Name,
+						Values: values,
+					})
+				}
+				var br blockResult
+				br.initFromDataBlock(&db)
+				pp.writeBlock(uint(rand.Intn(workersCount)), &br)
+			}
+		} else {
+			brw := newTestBlockResultWriter(workersCount, pp)
+			for _, row := range rows {
+				brw.writeRow(row)
+			}
+			brw.flush()
+		}
+
+		if err := pp.flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if spill && len(psp.runs) == 0 {
+			t.Fatalf("expecting non-zero number of sorted runs spilled to disk")
+		}
+		return ppTest.resultRows
+	}
+
+	f := func(pipeStr string, isTime bool) {
+		t.Helper()
+
+		rowsExpected := runPipe(pipeStr, false, isTime)
+		rows := runPipe(pipeStr, true, isTime)
+		if len(rows) != len(rowsExpected) {
+			t.Fatalf("unexpected number of rows; got %d; want %d", len(rows), len(rowsExpected))
+		}
+		for i := range rows {
+			if rowToString(rows[i]) != rowToString(rowsExpected[i]) {
+				t.Fatalf("unexpected row #%d\ngot\n%s\nwant\n%s", i, rowToString(rows[i]), rowToString(rowsExpected[i]))
+			}
+		}
+	}
+
+	for _, isTime := range []bool{false, true} {
+		f("sort by (n)", isTime)
+		f("sort by (_time desc) offset 100 rank", isTime)
+		f("sort by (s, n desc)", isTime)
+		f("sort desc", isTime)
+	}
+}
+
+func TestPipeUniqSpillToDisk(t *testing.T) {
+	SetSpillToDisk(t.TempDir(), 1<<30)
+	defer SetSpillToDisk("", 0)
+
+	f := func(pipeStr string, rowsCount, uniqCount int) {
+		t.Helper()
+
+		lex := newLexer(pipeStr, 0)
+		p, err := parsePipe(lex)
+		if err != nil {
+			t.Fatalf("cannot parse [%s]: %s", pipeStr, err)
+		}
+
+		workersCount := 5
+		stopCh := make(chan struct{})
+		ppTest := newTestPipeProcessor()
+		pp := p.newPipeProcessor(workersCount, stopCh, func() {}, ppTest)
+
+		// Limit the state size, so it is spilled to disk.
+		pup := pp.(*pipeUniqProcessor)
+		pup.stateSizeBudget.Store(stateSizeBudgetChunk)
+
+		brw := newTestBlockResultWriter(workersCount, pp)
+		for i := 0; i < rowsCount; i++ {
+			n := i % uniqCount
+			brw.writeRow([]Field{
+				{Name: "n", Value: strconv.Itoa(n)},
+				{Name: "s", Value: fmt.Sprintf("value_%d_%s", n, strings.Repeat("x", 50))},
+			})
+		}
+		brw.flush()
+
+		if err := pp.flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if pup.buckets == nil {
+			t.Fatalf("expecting the state to be spilled to disk")
+		}
+
+		rows := ppTest.resultRows
+		if len(rows) != uniqCount {
+			t.Fatalf("unexpected number of unique rows; got %d; want %d", len(rows), uniqCount)
+		}
+		hitsExpected := strconv.Itoa(rowsCount / uniqCount)
+		seen := make(map[string]bool, len(rows))
+		for _, row := range rows {
+			s := rowToString(row)
+			if seen[s] {
+				t.Fatalf("duplicate row: %s", s)
+			}
+			seen[s] = true
+
+			hits := row[len(row)-1]
+			if hits.Name != "hits" || hits.Value != hitsExpected {
+				t.Fatalf("unexpected hits for row %s; want %s", s, hitsExpected)
+			}
+		}
+	}
+
+	f("uniq by (s) with hits", 300_000, 100_000)
+	f("uniq by (n, s) with hits", 300_000, 100_000)
+}
@@ -0,0 +1,123 @@
+package logstorage
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+type statsAvgLen struct {
+	fieldFilters []string
+}
+
+func (sa *statsAvgLen) String() string {
+	return "avg_len(" + fieldNamesString(sa.fieldFilters) + ")"
+}
+
+func (sa *statsAvgLen) updateNeededFields(pf *prefixfilter.Filter) {
+	pf.AddAllowFilters(sa.fieldFilters)
+}
+
+func (sa *statsAvgLen) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsAvgLenProcessor()
+}
+
+type statsAvgLenProcessor struct {
+	sumLen uint64
+	count  uint64
+}
+
+func (sap *statsAvgLenProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sa := sf.(*statsAvgLen)
+
+	mc := getMatchingColumns(br, sa.fieldFilters)
+	for _, c := range mc.cs {
+		if c.isConst {
+			v := c.valuesEncoded[0]
+			if v != "" {
+				sap.sumLen += uint64(br.rowsLen * len(v))
+				sap.count += uint64(br.rowsLen)
+			}
+			continue
+		}
+		values := c.getValues(br)
+		for _, v := range values {
+			if v != "" {
+				sap.sumLen += uint64(len(v))
+				sap.count++
+			}
+		}
+	}
+	putMatchingColumns(mc)
+
+	return 0
+}
+
+func (sap *statsAvgLenProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sa := sf.(*statsAvgLen)
+
+	mc := getMatchingColumns(br, sa.fieldFilters)
+	for _, c := range mc.cs {
+		v := c.getValueAtRow(br, rowIdx)
+		if v != "" {
+			sap.sumLen += uint64(len(v))
+			sap.count++
+		}
+	}
+	putMatchingColumns(mc)
+
+	return 0
+}
+
+func (sap *statsAvgLenProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsAvgLenProcessor)
+	sap.sumLen += src.sumLen
+	sap.count += src.count
+}
+
+func (sap *statsAvgLenProcessor) exportState(dst []byte, _ <-chan struct{}) []byte {
+	dst = encoding.MarshalVarUint64(dst, sap.sumLen)
+	dst = encoding.MarshalVarUint64(dst, sap.count)
+	return dst
+}
+
+func (sap *statsAvgLenProcessor) importState(src []byte, _ <-chan struct{}) (int, error) {
+	sumLen, n := encoding.UnmarshalVarUint64(src)
+	if n <= 0 {
+		return 0, fmt.Errorf("cannot unmarshal sumLen")
+	}
+	sap.sumLen = sumLen
+	src = src[n:]
+
+	count, n := encoding.UnmarshalVarUint64(src)
+	if n <= 0 {
+		return 0, fmt.Errorf("cannot unmarshal count")
+	}
+	sap.count = count
+	src = src[n:]
+
+	if len(src) > 0 {
+		return 0, fmt.Errorf("unexpected tail left; len(tail)=%d", len(src))
+	}
+
+	return 0, nil
+}
+
+func (sap *statsAvgLenProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	avg := float64(sap.sumLen) / float64(sap.count)
+	return strconv.AppendFloat(dst, avg, 'f', -1, 64)
+}
+
+func parseStatsAvgLen(lex *lexer) (statsFunc, error) {
+	fieldFilters, err := parseStatsFuncFieldFilters(lex, "avg_len")
+	if err != nil {
+		return nil, err
+	}
+	sa := &statsAvgLen{
+		fieldFilters: fieldFilters,
+	}
+	return sa, nil
+}
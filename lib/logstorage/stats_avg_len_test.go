@@ -0,0 +1,141 @@
+package logstorage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStatsAvgLenSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`avg_len(*)`)
+	f(`avg_len(a)`)
+	f(`avg_len(a, b)`)
+	f(`avg_len(a*, b)`)
+}
+
+func TestParseStatsAvgLenFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`avg_len`)
+	f(`avg_len(a b)`)
+	f(`avg_len(x) y`)
+}
+
+func TestStatsAvgLen(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("stats avg_len(*) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `1`},
+		},
+		{
+			{"a", `-3`},
+			{"b", `54`},
+		},
+	}, [][]Field{
+		{
+			{"x", "1.8571428571428572"},
+		},
+	})
+
+	f("stats avg_len(_msg) as x", [][]Field{
+		{
+			{"_msg", `abcd`},
+		},
+		{
+			{"_msg", `ef`},
+		},
+		{
+			{"a", `3`},
+		},
+	}, [][]Field{
+		{
+			{"x", "3"},
+		},
+	})
+
+	f("stats avg_len(c) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+		},
+	}, [][]Field{
+		{
+			{"x", "NaN"},
+		},
+	})
+
+	f("stats by (a) avg_len(b) as x", [][]Field{
+		{
+			{"a", `1`},
+			{"b", `3`},
+		},
+		{
+			{"a", `1`},
+			{"b", `abcde`},
+		},
+		{
+			{"a", `3`},
+			{"b", `foo`},
+		},
+	}, [][]Field{
+		{
+			{"a", "1"},
+			{"x", "3"},
+		},
+		{
+			{"a", "3"},
+			{"x", "3"},
+		},
+	})
+}
+
+func TestStatsAvgLen_ExportImportState(t *testing.T) {
+	f := func(sap *statsAvgLenProcessor, dataLenExpected int) {
+		t.Helper()
+
+		data := sap.exportState(nil, nil)
+		dataLen := len(data)
+		if dataLen != dataLenExpected {
+			t.Fatalf("unexpected dataLen; got %d; want %d", dataLen, dataLenExpected)
+		}
+
+		var sap2 statsAvgLenProcessor
+		stateSize, err := sap2.importState(data, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if stateSize != 0 {
+			t.Fatalf("unexpected state size; got %d bytes; want 0 bytes", stateSize)
+		}
+
+		if !reflect.DeepEqual(sap, &sap2) {
+			t.Fatalf("unexpected state imported; got %#v; want %#v", &sap2, sap)
+		}
+	}
+
+	var sap statsAvgLenProcessor
+
+	f(&sap, 2)
+
+	sap = statsAvgLenProcessor{
+		sumLen: 12345,
+		count:  234,
+	}
+	f(&sap, 4)
+}
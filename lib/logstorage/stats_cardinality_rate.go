@@ -0,0 +1,139 @@
+package logstorage
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// statsCardinalityRate calculates the ratio of the number of unique values to the number of non-empty values for the given fields.
+//
+// The unique values are tracked in the same way as count_uniq() does.
+type statsCardinalityRate struct {
+	su statsCountUniq
+}
+
+func (sc *statsCardinalityRate) String() string {
+	return "cardinality_rate(" + fieldNamesString(sc.su.fields) + ")"
+}
+
+func (sc *statsCardinalityRate) updateNeededFields(pf *prefixfilter.Filter) {
+	pf.AddAllowFilters(sc.su.fields)
+}
+
+func (sc *statsCardinalityRate) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	scp := a.newStatsCardinalityRateProcessor()
+	scp.sup.a = a
+	return scp
+}
+
+type statsCardinalityRateProcessor struct {
+	// sup tracks unique values
+	sup statsCountUniqProcessor
+
+	// valuesCount is the number of rows with non-empty values
+	valuesCount uint64
+}
+
+func (scp *statsCardinalityRateProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sc := sf.(*statsCardinalityRate)
+
+	if len(sc.su.fields) == 1 {
+		// Fast path for a single column.
+		c := br.getColumnByName(sc.su.fields[0])
+		if c.isConst {
+			if c.valuesEncoded[0] != "" {
+				scp.valuesCount += uint64(br.rowsLen)
+			}
+		} else {
+			for _, v := range c.getValues(br) {
+				if v != "" {
+					scp.valuesCount++
+				}
+			}
+		}
+	} else {
+		for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+			if hasNonEmptyValueAtRow(br, sc.su.fields, rowIdx) {
+				scp.valuesCount++
+			}
+		}
+	}
+
+	return scp.sup.updateStatsForAllRows(&sc.su, br)
+}
+
+func (scp *statsCardinalityRateProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sc := sf.(*statsCardinalityRate)
+
+	if hasNonEmptyValueAtRow(br, sc.su.fields, rowIdx) {
+		scp.valuesCount++
+	}
+
+	return scp.sup.updateStatsForRow(&sc.su, br, rowIdx)
+}
+
+func hasNonEmptyValueAtRow(br *blockResult, fields []string, rowIdx int) bool {
+	for _, f := range fields {
+		c := br.getColumnByName(f)
+		if c.getValueAtRow(br, rowIdx) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (scp *statsCardinalityRateProcessor) mergeState(a *chunkedAllocator, sf statsFunc, sfp statsProcessor) {
+	sc := sf.(*statsCardinalityRate)
+	src := sfp.(*statsCardinalityRateProcessor)
+
+	scp.valuesCount += src.valuesCount
+	scp.sup.mergeState(a, &sc.su, &src.sup)
+}
+
+func (scp *statsCardinalityRateProcessor) exportState(dst []byte, stopCh <-chan struct{}) []byte {
+	dst = encoding.MarshalVarUint64(dst, scp.valuesCount)
+	dst = scp.sup.exportState(dst, stopCh)
+	return dst
+}
+
+func (scp *statsCardinalityRateProcessor) importState(src []byte, stopCh <-chan struct{}) (int, error) {
+	valuesCount, n := encoding.UnmarshalVarUint64(src)
+	if n <= 0 {
+		return 0, fmt.Errorf("cannot unmarshal valuesCount")
+	}
+	scp.valuesCount = valuesCount
+	src = src[n:]
+
+	stateSizeIncrease, err := scp.sup.importState(src, stopCh)
+	if err != nil {
+		return 0, fmt.Errorf("cannot import unique values: %w", err)
+	}
+	return stateSizeIncrease, nil
+}
+
+func (scp *statsCardinalityRateProcessor) finalizeStats(_ statsFunc, dst []byte, stopCh <-chan struct{}) []byte {
+	scp.sup.mergeShardssParallel(stopCh)
+
+	rate := float64(scp.sup.entriesCount()) / float64(scp.valuesCount)
+	return strconv.AppendFloat(dst, rate, 'f', -1, 64)
+}
+
+func parseStatsCardinalityRate(lex *lexer) (statsFunc, error) {
+	fields, err := parseStatsFuncFields(lex, "cardinality_rate")
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("expecting at least a single field")
+	}
+	sc := &statsCardinalityRate{
+		su: statsCountUniq{
+			fields: fields,
+		},
+	}
+	return sc, nil
+}
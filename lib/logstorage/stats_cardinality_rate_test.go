@@ -0,0 +1,146 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestParseStatsCardinalityRateSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`cardinality_rate(a)`)
+	f(`cardinality_rate(a, b)`)
+}
+
+func TestParseStatsCardinalityRateFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`cardinality_rate`)
+	f(`cardinality_rate()`)
+	f(`cardinality_rate(*)`)
+	f(`cardinality_rate(a*)`)
+	f(`cardinality_rate(a b)`)
+	f(`cardinality_rate(x) y`)
+}
+
+func TestStatsCardinalityRate(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("stats cardinality_rate(a) as x", [][]Field{
+		{
+			{"a", `1`},
+		},
+		{
+			{"a", `1`},
+		},
+		{
+			{"a", `foo`},
+		},
+		{
+			{"a", `bar`},
+		},
+		{
+			{"b", `3`},
+		},
+	}, [][]Field{
+		{
+			{"x", "0.75"},
+		},
+	})
+
+	f("stats cardinality_rate(a, b) as x", [][]Field{
+		{
+			{"a", `1`},
+		},
+		{
+			{"a", `1`},
+			{"b", `2`},
+		},
+		{
+			{"a", `1`},
+			{"b", `2`},
+		},
+		{
+			{"b", `2`},
+		},
+		{
+			{"c", `2`},
+		},
+	}, [][]Field{
+		{
+			{"x", "0.75"},
+		},
+	})
+
+	f("stats by (host) cardinality_rate(query) as x", [][]Field{
+		{
+			{"host", `a`},
+			{"query", `foo.example.com`},
+		},
+		{
+			{"host", `a`},
+			{"query", `foo.example.com`},
+		},
+		{
+			{"host", `b`},
+			{"query", `x1.example.com`},
+		},
+		{
+			{"host", `b`},
+			{"query", `x2.example.com`},
+		},
+	}, [][]Field{
+		{
+			{"host", "a"},
+			{"x", "0.5"},
+		},
+		{
+			{"host", "b"},
+			{"x", "1"},
+		},
+	})
+}
+
+func TestStatsCardinalityRate_ExportImportState(t *testing.T) {
+	var a chunkedAllocator
+	newProcessor := func() *statsCardinalityRateProcessor {
+		scp := a.newStatsCardinalityRateProcessor()
+		scp.sup.a = &a
+		scp.sup.concurrency = 2
+		return scp
+	}
+
+	scp := newProcessor()
+	scp.valuesCount = 10
+	scp.sup.uniqValues.strings = map[string]struct{}{
+		"foo": {},
+		"bar": {},
+	}
+	scp.sup.uniqValues.u64 = map[uint64]struct{}{
+		123: {},
+		456: {},
+	}
+
+	data := scp.exportState(nil, nil)
+
+	scp2 := newProcessor()
+	if _, err := scp2.importState(data, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if scp2.valuesCount != scp.valuesCount {
+		t.Fatalf("unexpected valuesCount; got %d; want %d", scp2.valuesCount, scp.valuesCount)
+	}
+
+	result := scp2.finalizeStats(nil, nil, nil)
+	if string(result) != "0.4" {
+		t.Fatalf("unexpected result; got %q; want %q", result, "0.4")
+	}
+}
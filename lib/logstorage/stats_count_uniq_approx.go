@@ -0,0 +1,277 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"unsafe"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// statsCountUniqApprox estimates the number of unique (field1, ..., fieldN) tuples with HyperLogLog.
+//
+// See https://en.wikipedia.org/wiki/HyperLogLog
+type statsCountUniqApprox struct {
+	fields []string
+}
+
+func (su *statsCountUniqApprox) String() string {
+	return "count_uniq_approx(" + fieldNamesString(su.fields) + ")"
+}
+
+func (su *statsCountUniqApprox) updateNeededFields(pf *prefixfilter.Filter) {
+	pf.AddAllowFilters(su.fields)
+}
+
+func (su *statsCountUniqApprox) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsCountUniqApproxProcessor()
+}
+
+// hllPrecision is the number of hash bits used for selecting HyperLogLog register.
+//
+// The standard error of the estimation is 1.04/sqrt(2^hllPrecision), e.g. 0.81% for hllPrecision=14.
+const hllPrecision = 14
+
+// hllRegistersCount is the number of registers in the dense HyperLogLog representation.
+const hllRegistersCount = 1 << hllPrecision
+
+// hllSparseMaxLen is the maximum number of unique hashes to track in the sparse representation
+// before switching to the dense representation.
+//
+// The sparse representation returns exact number of unique hashes, while it uses less memory than the dense representation
+// for small number of unique values. This is important when count_uniq_approx() is applied to big number of groups.
+const hllSparseMaxLen = hllRegistersCount / 16
+
+type statsCountUniqApproxProcessor struct {
+	// sparse contains unique hashes until their number exceeds hllSparseMaxLen.
+	sparse map[uint64]struct{}
+
+	// registers contains the dense HyperLogLog state. It is nil until sparse overflows.
+	registers []uint8
+
+	keyBuf []byte
+}
+
+func (sup *statsCountUniqApproxProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	su := sf.(*statsCountUniqApprox)
+
+	stateSizeIncrease := 0
+
+	if len(su.fields) == 1 {
+		// Fast path for a single column.
+		c := br.getColumnByName(su.fields[0])
+		if c.isConst {
+			v := c.valuesEncoded[0]
+			if v == "" {
+				// Do not count empty values
+				return 0
+			}
+			return sup.updateStateHash(xxhash.Sum64(bytesutil.ToUnsafeBytes(v)))
+		}
+		if c.valueType == valueTypeDict {
+			c.forEachDictValue(br, func(v string) {
+				if v == "" {
+					// Do not count empty values
+					return
+				}
+				stateSizeIncrease += sup.updateStateHash(xxhash.Sum64(bytesutil.ToUnsafeBytes(v)))
+			})
+			return stateSizeIncrease
+		}
+		values := c.getValues(br)
+		for i, v := range values {
+			if v == "" {
+				// Do not count empty values
+				continue
+			}
+			if i > 0 && values[i-1] == v {
+				// This value has been already counted.
+				continue
+			}
+			stateSizeIncrease += sup.updateStateHash(xxhash.Sum64(bytesutil.ToUnsafeBytes(v)))
+		}
+		return stateSizeIncrease
+	}
+
+	// Slow path for multiple columns.
+	for i := 0; i < br.rowsLen; i++ {
+		stateSizeIncrease += sup.updateStatsForRow(sf, br, i)
+	}
+	return stateSizeIncrease
+}
+
+func (sup *statsCountUniqApproxProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	su := sf.(*statsCountUniqApprox)
+
+	if len(su.fields) == 1 {
+		// Fast path for a single column.
+		c := br.getColumnByName(su.fields[0])
+		v := c.getValueAtRow(br, rowIdx)
+		if v == "" {
+			// Do not count empty values
+			return 0
+		}
+		return sup.updateStateHash(xxhash.Sum64(bytesutil.ToUnsafeBytes(v)))
+	}
+
+	// Slow path for multiple columns.
+	allEmptyValues := true
+	keyBuf := sup.keyBuf[:0]
+	for _, f := range su.fields {
+		c := br.getColumnByName(f)
+		v := c.getValueAtRow(br, rowIdx)
+		if v != "" {
+			allEmptyValues = false
+		}
+		keyBuf = encoding.MarshalBytes(keyBuf, bytesutil.ToUnsafeBytes(v))
+	}
+	sup.keyBuf = keyBuf
+
+	if allEmptyValues {
+		// Do not count empty values
+		return 0
+	}
+	return sup.updateStateHash(xxhash.Sum64(keyBuf))
+}
+
+func (sup *statsCountUniqApproxProcessor) updateStateHash(h uint64) int {
+	if sup.registers != nil {
+		hllUpdateRegisters(sup.registers, h)
+		return 0
+	}
+
+	stateSizeIncrease := updateUint64Set(&sup.sparse, h)
+	if len(sup.sparse) > hllSparseMaxLen {
+		stateSizeIncrease += sup.convertToDense()
+	}
+	return stateSizeIncrease
+}
+
+func (sup *statsCountUniqApproxProcessor) convertToDense() int {
+	sup.registers = make([]uint8, hllRegistersCount)
+	for h := range sup.sparse {
+		hllUpdateRegisters(sup.registers, h)
+	}
+	stateSizeIncrease := len(sup.registers) - len(sup.sparse)*int(unsafe.Sizeof(uint64(0)))
+	sup.sparse = nil
+	return stateSizeIncrease
+}
+
+func hllUpdateRegisters(registers []uint8, h uint64) {
+	idx := h >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64((h<<hllPrecision)|(1<<(hllPrecision-1)))) + 1
+	if rank > registers[idx] {
+		registers[idx] = rank
+	}
+}
+
+func (sup *statsCountUniqApproxProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsCountUniqApproxProcessor)
+
+	if src.registers == nil {
+		for h := range src.sparse {
+			sup.updateStateHash(h)
+		}
+		return
+	}
+
+	if sup.registers == nil {
+		sup.convertToDense()
+	}
+	for i, v := range src.registers {
+		if v > sup.registers[i] {
+			sup.registers[i] = v
+		}
+	}
+}
+
+func (sup *statsCountUniqApproxProcessor) exportState(dst []byte, stopCh <-chan struct{}) []byte {
+	if sup.registers != nil {
+		dst = append(dst, 1)
+		return append(dst, sup.registers...)
+	}
+	dst = append(dst, 0)
+	return marshalUint64Set(dst, sup.sparse, stopCh)
+}
+
+func (sup *statsCountUniqApproxProcessor) importState(src []byte, stopCh <-chan struct{}) (int, error) {
+	if len(src) == 0 {
+		return 0, fmt.Errorf("missing state type")
+	}
+	stateType := src[0]
+	src = src[1:]
+
+	switch stateType {
+	case 0:
+		tail, stateSize, err := unmarshalUint64Set(&sup.sparse, src, stopCh)
+		if err != nil {
+			return 0, fmt.Errorf("cannot unmarshal sparse state: %w", err)
+		}
+		if len(tail) > 0 {
+			return 0, fmt.Errorf("unexpected non-empty tail left; len(tail)=%d", len(tail))
+		}
+		sup.registers = nil
+		return stateSize, nil
+	case 1:
+		if len(src) != hllRegistersCount {
+			return 0, fmt.Errorf("unexpected dense state size; got %d bytes; want %d bytes", len(src), hllRegistersCount)
+		}
+		sup.registers = append(sup.registers[:0], src...)
+		sup.sparse = nil
+		return len(sup.registers), nil
+	default:
+		return 0, fmt.Errorf("unexpected state type: %d", stateType)
+	}
+}
+
+func (sup *statsCountUniqApproxProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	n := sup.entriesCount()
+	return strconv.AppendUint(dst, n, 10)
+}
+
+func (sup *statsCountUniqApproxProcessor) entriesCount() uint64 {
+	if sup.registers == nil {
+		return uint64(len(sup.sparse))
+	}
+	return hllEstimate(sup.registers)
+}
+
+func hllEstimate(registers []uint8) uint64 {
+	m := float64(len(registers))
+	sum := 0.0
+	zeros := 0
+	for _, v := range registers {
+		sum += math.Ldexp(1, -int(v))
+		if v == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	if estimate <= 2.5*m && zeros > 0 {
+		// Use linear counting for small cardinalities, since it is more precise than the raw HyperLogLog estimate.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+func parseStatsCountUniqApprox(lex *lexer) (statsFunc, error) {
+	fields, err := parseStatsFuncFields(lex, "count_uniq_approx")
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("expecting at least a single field")
+	}
+	su := &statsCountUniqApprox{
+		fields: fields,
+	}
+	return su, nil
+}
@@ -0,0 +1,196 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestParseStatsCountUniqApproxSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`count_uniq_approx(a)`)
+	f(`count_uniq_approx(a, b)`)
+}
+
+func TestParseStatsCountUniqApproxFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`count_uniq_approx`)
+	f(`count_uniq_approx()`)
+	f(`count_uniq_approx(*)`)
+	f(`count_uniq_approx(a*, b)`)
+	f(`count_uniq_approx(a b)`)
+	f(`count_uniq_approx(x) y`)
+	f(`count_uniq_approx(x) limit 10`)
+}
+
+func TestStatsCountUniqApprox(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("stats count_uniq_approx(a) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `1`},
+		},
+		{},
+		{
+			{"a", `2`},
+			{"b", `54`},
+		},
+	}, [][]Field{
+		{
+			{"x", "2"},
+		},
+	})
+
+	f("stats count_uniq_approx(a, b) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `1`},
+		},
+		{},
+		{
+			{"a", `2`},
+			{"b", `3`},
+		},
+	}, [][]Field{
+		{
+			{"x", "2"},
+		},
+	})
+
+	f("stats by (a) count_uniq_approx(b) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `1`},
+			{"b", `3`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `1`},
+			{"b", `4`},
+		},
+		{
+			{"a", `3`},
+			{"b", `5`},
+		},
+		{
+			{"a", `3`},
+		},
+	}, [][]Field{
+		{
+			{"a", "1"},
+			{"x", "2"},
+		},
+		{
+			{"a", "3"},
+			{"x", "1"},
+		},
+	})
+}
+
+func TestStatsCountUniqApprox_Accuracy(t *testing.T) {
+	f := func(n int) {
+		t.Helper()
+
+		// Spread the values among multiple processors in order to verify mergeState
+		var sups [4]statsCountUniqApproxProcessor
+		for i := 0; i < n; i++ {
+			v := fmt.Sprintf("value_%d", i)
+			h := xxhash.Sum64String(v)
+			sups[i%len(sups)].updateStateHash(h)
+			sups[(i+1)%len(sups)].updateStateHash(h)
+		}
+		sup := &sups[0]
+		for i := 1; i < len(sups); i++ {
+			sup.mergeState(nil, nil, &sups[i])
+		}
+
+		got := sup.entriesCount()
+		relErr := math.Abs(float64(got)-float64(n)) / float64(n)
+
+		// Allow 5 standard errors
+		if relErr > 5*1.04/math.Sqrt(hllRegistersCount) {
+			t.Fatalf("too big relative error for n=%d; got %d; relative error: %.4f", n, got, relErr)
+		}
+	}
+
+	f(1)
+	f(100)
+	f(hllSparseMaxLen)
+	f(hllSparseMaxLen + 1)
+	f(10_000)
+	f(100_000)
+	f(1_000_000)
+}
+
+func TestStatsCountUniqApprox_ExportImportState(t *testing.T) {
+	f := func(sup *statsCountUniqApproxProcessor, dataLenExpected int, entriesCountExpected uint64) {
+		t.Helper()
+
+		data := sup.exportState(nil, nil)
+		dataLen := len(data)
+		if dataLen != dataLenExpected {
+			t.Fatalf("unexpected dataLen; got %d; want %d", dataLen, dataLenExpected)
+		}
+
+		entriesCount := sup.entriesCount()
+		if entriesCount != entriesCountExpected {
+			t.Fatalf("unexpected entries count; got %d; want %d", entriesCount, entriesCountExpected)
+		}
+
+		var sup2 statsCountUniqApproxProcessor
+		if _, err := sup2.importState(data, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		entriesCount = sup2.entriesCount()
+		if entriesCount != entriesCountExpected {
+			t.Fatalf("unexpected entries count after import; got %d; want %d", entriesCount, entriesCountExpected)
+		}
+
+		if !reflect.DeepEqual(sup.sparse, sup2.sparse) || !reflect.DeepEqual(sup.registers, sup2.registers) {
+			t.Fatalf("unexpected state imported\ngot\n%#v\nwant\n%#v", &sup2, sup)
+		}
+	}
+
+	var sup statsCountUniqApproxProcessor
+
+	// Zero state
+	f(&sup, 2, 0)
+
+	// Sparse state
+	sup.updateStateHash(123)
+	sup.updateStateHash(456)
+	sup.updateStateHash(123)
+	f(&sup, 18, 2)
+
+	// Dense state
+	for i := 0; i < 2*hllSparseMaxLen; i++ {
+		sup.updateStateHash(xxhash.Sum64String(fmt.Sprintf("value_%d", i)))
+	}
+	f(&sup, 1+hllRegistersCount, sup.entriesCount())
+}
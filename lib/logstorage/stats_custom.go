@@ -0,0 +1,201 @@
+package logstorage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// CustomStatsFunc is a user-defined stats function, which can be registered via RegisterCustomStatsFunc.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#custom-stats-functions
+type CustomStatsFunc interface {
+	// NewState must return an empty state for calculating stats over the fields matching the given fieldFilters.
+	//
+	// fieldFilters are passed to the function in the query. They may contain wildcard filters such as `*` or `prefix*`.
+	NewState(fieldFilters []string) CustomStatsState
+}
+
+// CustomStatsState is the state for calculating stats for a single group of logs with CustomStatsFunc.
+//
+// CustomStatsState methods are called from a single goroutine at a time, so there is no need in the internal synchronization.
+type CustomStatsState interface {
+	// Update must update the state with the fields of a single log entry.
+	//
+	// fields contain only the fields matching the field filters passed to CustomStatsFunc.NewState.
+	// The implementation cannot hold references to fields, since the caller can reuse them.
+	//
+	// It must return the change of the state size in bytes. This is used for limiting memory usage by stats pipe.
+	Update(fields []Field) int
+
+	// Merge must merge src state into the state. src is created by the same CustomStatsFunc.
+	Merge(src CustomStatsState)
+
+	// Marshal must append the marshaled state to dst and return the result.
+	Marshal(dst []byte) []byte
+
+	// Unmarshal must unmarshal the state from src obtained via Marshal.
+	//
+	// It must return the state size in bytes after the unmarshal.
+	Unmarshal(src []byte) (int, error)
+
+	// Finalize must return the stats result.
+	Finalize() string
+}
+
+var (
+	customStatsFuncsLock sync.Mutex
+	customStatsFuncs     = make(map[string]CustomStatsFunc)
+)
+
+// RegisterCustomStatsFunc registers csf under the given name, so it could be used in LogsQL queries as `| stats name(field1, ..., fieldN)`.
+//
+// This function must be called from init() functions of the packages with CustomStatsFunc implementations.
+func RegisterCustomStatsFunc(name string, csf CustomStatsFunc) {
+	name = strings.ToLower(name)
+	if err := CheckCustomStatsFuncName(name); err != nil {
+		logger.Panicf("BUG: %s", err)
+	}
+
+	customStatsFuncsLock.Lock()
+	defer customStatsFuncsLock.Unlock()
+
+	if _, ok := customStatsFuncs[name]; ok {
+		logger.Panicf("BUG: custom stats function %q is already registered", name)
+	}
+	customStatsFuncs[name] = csf
+}
+
+// CheckCustomStatsFuncName returns an error if the given name cannot be used for registering custom stats function via RegisterCustomStatsFunc.
+func CheckCustomStatsFuncName(name string) error {
+	name = strings.ToLower(name)
+	if !isWord(name) {
+		return fmt.Errorf("cannot register custom stats function %q, since its name may contain only letters, digits and underscores", name)
+	}
+	if getStatsFuncParsers()[name] != nil {
+		return fmt.Errorf("cannot register custom stats function %q, since it clashes with the builtin stats function", name)
+	}
+	if isPipeName(name) {
+		return fmt.Errorf("cannot register custom stats function %q, since it clashes with the pipe", name)
+	}
+	if getCustomStatsFunc(name) != nil {
+		return fmt.Errorf("custom stats function %q is already registered", name)
+	}
+	return nil
+}
+
+func getCustomStatsFunc(name string) CustomStatsFunc {
+	customStatsFuncsLock.Lock()
+	csf := customStatsFuncs[strings.ToLower(name)]
+	customStatsFuncsLock.Unlock()
+	return csf
+}
+
+// statsCustom calculates stats with custom stats functions registered via RegisterCustomStatsFunc.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#custom-stats-functions
+type statsCustom struct {
+	name         string
+	fieldFilters []string
+
+	csf CustomStatsFunc
+}
+
+func (sc *statsCustom) String() string {
+	return sc.name + "(" + fieldNamesString(sc.fieldFilters) + ")"
+}
+
+func (sc *statsCustom) updateNeededFields(pf *prefixfilter.Filter) {
+	pf.AddAllowFilters(sc.fieldFilters)
+}
+
+func (sc *statsCustom) newStatsProcessor(_ *chunkedAllocator) statsProcessor {
+	return &statsCustomProcessor{
+		state: sc.csf.NewState(sc.fieldFilters),
+	}
+}
+
+type statsCustomProcessor struct {
+	state CustomStatsState
+}
+
+func (scp *statsCustomProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sc := sf.(*statsCustom)
+
+	mc := getMatchingColumns(br, sc.fieldFilters)
+	defer putMatchingColumns(mc)
+
+	fs := GetFields()
+	defer PutFields(fs)
+
+	stateSizeIncrease := 0
+	for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+		stateSizeIncrease += scp.updateStateForRow(fs, mc, br, rowIdx)
+	}
+	return stateSizeIncrease
+}
+
+func (scp *statsCustomProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sc := sf.(*statsCustom)
+
+	mc := getMatchingColumns(br, sc.fieldFilters)
+	defer putMatchingColumns(mc)
+
+	fs := GetFields()
+	defer PutFields(fs)
+
+	return scp.updateStateForRow(fs, mc, br, rowIdx)
+}
+
+func (scp *statsCustomProcessor) updateStateForRow(fs *Fields, mc *matchingColumns, br *blockResult, rowIdx int) int {
+	fs.Reset()
+	for _, c := range mc.cs {
+		fs.Add(c.name, c.getValueAtRow(br, rowIdx))
+	}
+	return scp.state.Update(fs.Fields)
+}
+
+func (scp *statsCustomProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsCustomProcessor)
+	scp.state.Merge(src.state)
+}
+
+func (scp *statsCustomProcessor) exportState(dst []byte, _ <-chan struct{}) []byte {
+	return scp.state.Marshal(dst)
+}
+
+func (scp *statsCustomProcessor) importState(src []byte, _ <-chan struct{}) (int, error) {
+	return scp.state.Unmarshal(src)
+}
+
+func (scp *statsCustomProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	return append(dst, scp.state.Finalize()...)
+}
+
+func parseStatsCustom(lex *lexer) (statsFunc, error) {
+	name := strings.ToLower(lex.token)
+	csf := getCustomStatsFunc(name)
+	if csf == nil || lex.isQuotedToken() {
+		return nil, fmt.Errorf("unexpected token: %q; want custom stats function name", lex.token)
+	}
+	lex.nextToken()
+
+	fieldFilters, err := parseFieldFiltersInParens(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q args: %w", name, err)
+	}
+	if len(fieldFilters) == 0 {
+		fieldFilters = []string{"*"}
+	}
+
+	sc := &statsCustom{
+		name:         name,
+		fieldFilters: fieldFilters,
+		csf:          csf,
+	}
+	return sc, nil
+}
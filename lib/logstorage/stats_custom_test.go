@@ -0,0 +1,219 @@
+package logstorage
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+)
+
+// testCustomStatsMaxLen calculates the maximum length of values for the fields passed in args.
+type testCustomStatsMaxLen struct{}
+
+func (csf *testCustomStatsMaxLen) NewState(_ []string) CustomStatsState {
+	return &testCustomStatsMaxLenState{}
+}
+
+type testCustomStatsMaxLenState struct {
+	maxLen uint64
+}
+
+func (s *testCustomStatsMaxLenState) Update(fields []Field) int {
+	for _, f := range fields {
+		s.maxLen = max(s.maxLen, uint64(len(f.Value)))
+	}
+	return 0
+}
+
+func (s *testCustomStatsMaxLenState) Merge(src CustomStatsState) {
+	s.maxLen = max(s.maxLen, src.(*testCustomStatsMaxLenState).maxLen)
+}
+
+func (s *testCustomStatsMaxLenState) Marshal(dst []byte) []byte {
+	return encoding.MarshalVarUint64(dst, s.maxLen)
+}
+
+func (s *testCustomStatsMaxLenState) Unmarshal(src []byte) (int, error) {
+	maxLen, n := encoding.UnmarshalVarUint64(src)
+	if n <= 0 || n != len(src) {
+		return 0, fmt.Errorf("cannot unmarshal maxLen")
+	}
+	s.maxLen = maxLen
+	return 0, nil
+}
+
+func (s *testCustomStatsMaxLenState) Finalize() string {
+	return strconv.FormatUint(s.maxLen, 10)
+}
+
+func init() {
+	RegisterCustomStatsFunc("test_max_len", &testCustomStatsMaxLen{})
+}
+
+func TestCheckCustomStatsFuncName(t *testing.T) {
+	f := func(name string, resultExpected bool) {
+		t.Helper()
+
+		err := CheckCustomStatsFuncName(name)
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for CheckCustomStatsFuncName(%q); got %v; want %v; error: %v", name, result, resultExpected, err)
+		}
+	}
+
+	f("foo", true)
+	f("foo_bar123", true)
+
+	// invalid names
+	f("", false)
+	f("foo-bar", false)
+	f("foo(bar)", false)
+
+	// builtin stats function
+	f("count", false)
+	f("MAX", false)
+
+	// pipe
+	f("fields", false)
+
+	// already registered stats function
+	f("test_max_len", false)
+}
+
+func TestParseStatsCustomSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`test_max_len(*)`)
+	f(`test_max_len(a)`)
+	f(`test_max_len(a, b)`)
+	f(`test_max_len(a*, b)`)
+}
+
+func TestParseStatsCustomFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`test_max_len`)
+	f(`test_max_len(a b)`)
+	f(`test_max_len(x) y`)
+	f(`"test_max_len"(x)`)
+}
+
+func TestStatsCustom(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("stats test_max_len(*) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"_msg", `defgh`},
+			{"a", `1`},
+		},
+		{
+			{"a", `-3`},
+			{"b", `54`},
+		},
+	}, [][]Field{
+		{
+			{"x", "5"},
+		},
+	})
+
+	f("test_max_len(a, b) as x", [][]Field{
+		{
+			{"_msg", `abcdef`},
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"a", `-3`},
+			{"b", `54`},
+		},
+	}, [][]Field{
+		{
+			{"x", "2"},
+		},
+	})
+
+	f("stats by (b) test_max_len(a) if (b:*) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `1234`},
+		},
+		{
+			{"a", `-3`},
+			{"b", `3`},
+		},
+		{
+			{"a", `foo`},
+			{"b", `bar`},
+		},
+	}, [][]Field{
+		{
+			{"b", "3"},
+			{"x", "2"},
+		},
+		{
+			{"b", "bar"},
+			{"x", "3"},
+		},
+		{
+			{"b", ""},
+			{"x", "0"},
+		},
+	})
+}
+
+func TestStatsCustom_ExportImportState(t *testing.T) {
+	f := func(scp *statsCustomProcessor, dataLenExpected int) {
+		t.Helper()
+
+		data := scp.exportState(nil, nil)
+		dataLen := len(data)
+		if dataLen != dataLenExpected {
+			t.Fatalf("unexpected dataLen; got %d; want %d", dataLen, dataLenExpected)
+		}
+
+		scp2 := &statsCustomProcessor{
+			state: &testCustomStatsMaxLenState{},
+		}
+		stateSize, err := scp2.importState(data, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if stateSize != 0 {
+			t.Fatalf("unexpected state size; got %d bytes; want 0 bytes", stateSize)
+		}
+
+		result := string(scp2.finalizeStats(nil, nil, nil))
+		resultExpected := string(scp.finalizeStats(nil, nil, nil))
+		if result != resultExpected {
+			t.Fatalf("unexpected state imported; got %s; want %s", result, resultExpected)
+		}
+	}
+
+	f(&statsCustomProcessor{
+		state: &testCustomStatsMaxLenState{},
+	}, 1)
+	f(&statsCustomProcessor{
+		state: &testCustomStatsMaxLenState{
+			maxLen: 12345,
+		},
+	}, 2)
+}
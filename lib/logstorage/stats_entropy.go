@@ -0,0 +1,155 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+type statsEntropy struct {
+	fieldFilters []string
+}
+
+func (se *statsEntropy) String() string {
+	return "entropy(" + fieldNamesString(se.fieldFilters) + ")"
+}
+
+func (se *statsEntropy) updateNeededFields(pf *prefixfilter.Filter) {
+	pf.AddAllowFilters(se.fieldFilters)
+}
+
+func (se *statsEntropy) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsEntropyProcessor()
+}
+
+type statsEntropyProcessor struct {
+	// sum is the sum of Shannon entropy for the processed non-empty values
+	sum float64
+
+	// count is the number of the processed non-empty values
+	count uint64
+}
+
+func (sep *statsEntropyProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	se := sf.(*statsEntropy)
+
+	mc := getMatchingColumns(br, se.fieldFilters)
+	for _, c := range mc.cs {
+		if c.isConst {
+			v := c.valuesEncoded[0]
+			if v != "" {
+				sep.sum += float64(br.rowsLen) * getShannonEntropy(v)
+				sep.count += uint64(br.rowsLen)
+			}
+			continue
+		}
+		values := c.getValues(br)
+		entropy := float64(0)
+		for i, v := range values {
+			if v == "" {
+				continue
+			}
+			if i == 0 || values[i-1] != v {
+				entropy = getShannonEntropy(v)
+			}
+			sep.sum += entropy
+			sep.count++
+		}
+	}
+	putMatchingColumns(mc)
+
+	return 0
+}
+
+func (sep *statsEntropyProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	se := sf.(*statsEntropy)
+
+	mc := getMatchingColumns(br, se.fieldFilters)
+	for _, c := range mc.cs {
+		v := c.getValueAtRow(br, rowIdx)
+		if v != "" {
+			sep.sum += getShannonEntropy(v)
+			sep.count++
+		}
+	}
+	putMatchingColumns(mc)
+
+	return 0
+}
+
+func (sep *statsEntropyProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsEntropyProcessor)
+	sep.sum += src.sum
+	sep.count += src.count
+}
+
+func (sep *statsEntropyProcessor) exportState(dst []byte, _ <-chan struct{}) []byte {
+	dst = marshalFloat64(dst, sep.sum)
+	dst = encoding.MarshalVarUint64(dst, sep.count)
+	return dst
+}
+
+func (sep *statsEntropyProcessor) importState(src []byte, _ <-chan struct{}) (int, error) {
+	if len(src) < 8 {
+		return 0, fmt.Errorf("cannot unmarshal sum from %d bytes; need 8 bytes", len(src))
+	}
+	sep.sum = unmarshalFloat64(bytesutil.ToUnsafeString(src))
+	src = src[8:]
+
+	count, n := encoding.UnmarshalVarUint64(src)
+	if n <= 0 {
+		return 0, fmt.Errorf("cannot unmarshal count")
+	}
+	sep.count = count
+	src = src[n:]
+
+	if len(src) > 0 {
+		return 0, fmt.Errorf("unexpected tail left; len(tail)=%d", len(src))
+	}
+
+	return 0, nil
+}
+
+func (sep *statsEntropyProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	avg := sep.sum / float64(sep.count)
+	return strconv.AppendFloat(dst, avg, 'f', -1, 64)
+}
+
+// getShannonEntropy returns Shannon entropy in bits per byte for the given s.
+func getShannonEntropy(s string) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+
+	n := float64(len(s))
+	entropy := float64(0)
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func parseStatsEntropy(lex *lexer) (statsFunc, error) {
+	fieldFilters, err := parseStatsFuncFieldFilters(lex, "entropy")
+	if err != nil {
+		return nil, err
+	}
+	se := &statsEntropy{
+		fieldFilters: fieldFilters,
+	}
+	return se, nil
+}
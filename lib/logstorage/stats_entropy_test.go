@@ -0,0 +1,140 @@
+package logstorage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStatsEntropySuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`entropy(*)`)
+	f(`entropy(a)`)
+	f(`entropy(a, b)`)
+	f(`entropy(a*, b)`)
+}
+
+func TestParseStatsEntropyFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`entropy`)
+	f(`entropy(a b)`)
+	f(`entropy(x) y`)
+}
+
+func TestStatsEntropy(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("stats entropy(_msg) as x", [][]Field{
+		{
+			{"_msg", `aaaa`},
+		},
+		{
+			{"_msg", `abcd`},
+		},
+		{
+			{"a", `3`},
+		},
+	}, [][]Field{
+		{
+			{"x", "1"},
+		},
+	})
+
+	f("stats by (a) entropy(b) as x", [][]Field{
+		{
+			{"a", `1`},
+			{"b", `ab`},
+		},
+		{
+			{"a", `1`},
+			{"b", `abab`},
+		},
+		{
+			{"a", `3`},
+			{"b", `abcdefgh`},
+		},
+	}, [][]Field{
+		{
+			{"a", "1"},
+			{"x", "1"},
+		},
+		{
+			{"a", "3"},
+			{"x", "3"},
+		},
+	})
+
+	f("stats entropy(c) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+		},
+	}, [][]Field{
+		{
+			{"x", "NaN"},
+		},
+	})
+}
+
+func TestGetShannonEntropy(t *testing.T) {
+	f := func(s string, entropyExpected float64) {
+		t.Helper()
+
+		entropy := getShannonEntropy(s)
+		if entropy != entropyExpected {
+			t.Fatalf("unexpected entropy for %q; got %v; want %v", s, entropy, entropyExpected)
+		}
+	}
+
+	f("", 0)
+	f("a", 0)
+	f("aaaa", 0)
+	f("ab", 1)
+	f("aabb", 1)
+	f("abcd", 2)
+	f("0123456789abcdef", 4)
+}
+
+func TestStatsEntropy_ExportImportState(t *testing.T) {
+	f := func(sep *statsEntropyProcessor, dataLenExpected int) {
+		t.Helper()
+
+		data := sep.exportState(nil, nil)
+		dataLen := len(data)
+		if dataLen != dataLenExpected {
+			t.Fatalf("unexpected dataLen; got %d; want %d", dataLen, dataLenExpected)
+		}
+
+		var sep2 statsEntropyProcessor
+		stateSize, err := sep2.importState(data, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if stateSize != 0 {
+			t.Fatalf("unexpected state size; got %d bytes; want 0 bytes", stateSize)
+		}
+
+		if !reflect.DeepEqual(sep, &sep2) {
+			t.Fatalf("unexpected state imported; got %#v; want %#v", &sep2, sep)
+		}
+	}
+
+	var sep statsEntropyProcessor
+
+	f(&sep, 9)
+
+	sep = statsEntropyProcessor{
+		sum:   123.3243,
+		count: 234,
+	}
+	f(&sep, 10)
+}
@@ -0,0 +1,406 @@
+package logstorage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/cespare/xxhash/v2"
+	"github.com/valyala/quicktemplate"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/prefixfilter"
+)
+
+// statsTopkApprox returns the k most frequent values for the given field with Count-Min sketch.
+//
+// See https://en.wikipedia.org/wiki/Count%E2%80%93min_sketch
+type statsTopkApprox struct {
+	field string
+
+	k    uint64
+	kStr string
+}
+
+func (st *statsTopkApprox) String() string {
+	return "topk_approx(" + st.kStr + ", " + quoteTokenIfNeeded(st.field) + ")"
+}
+
+func (st *statsTopkApprox) updateNeededFields(pf *prefixfilter.Filter) {
+	pf.AddAllowFilter(st.field)
+}
+
+func (st *statsTopkApprox) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsTopkApproxProcessor()
+}
+
+// cmsWidth is the number of counters per every Count-Min sketch row.
+//
+// Estimated hits exceed the real hits by at most e/cmsWidth*N with the probability 1-e^-cmsDepth,
+// where N is the total number of counted values.
+const cmsWidth = 2048
+
+// cmsDepth is the number of rows in Count-Min sketch.
+const cmsDepth = 4
+
+// topkApproxExactMaxLen is the maximum number of unique values to count exactly before switching to Count-Min sketch.
+const topkApproxExactMaxLen = 1024
+
+// topkApproxMaxK is the maximum k value, which can be passed to topk_approx().
+const topkApproxMaxK = 10_000
+
+type statsTopkApproxProcessor struct {
+	// exact contains exact hits per every value until the number of unique values exceeds topkApproxExactMaxLen.
+	exact map[string]uint64
+
+	// sketch contains Count-Min sketch counters. It is nil until exact overflows.
+	sketch []uint64
+
+	// candidates contains the values, which may be among the top k values, when sketch is used.
+	candidates map[string]struct{}
+}
+
+func (stp *statsTopkApproxProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	st := sf.(*statsTopkApprox)
+
+	c := br.getColumnByName(st.field)
+	if c.isConst {
+		v := c.valuesEncoded[0]
+		if v == "" {
+			// Do not count empty values
+			return 0
+		}
+		return stp.updateState(st, v, uint64(br.rowsLen))
+	}
+
+	stateSizeIncrease := 0
+	values := c.getValues(br)
+	for i := 0; i < len(values); {
+		v := values[i]
+		hits := uint64(1)
+		i++
+		for i < len(values) && values[i] == v {
+			hits++
+			i++
+		}
+		if v == "" {
+			// Do not count empty values
+			continue
+		}
+		stateSizeIncrease += stp.updateState(st, v, hits)
+	}
+	return stateSizeIncrease
+}
+
+func (stp *statsTopkApproxProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	st := sf.(*statsTopkApprox)
+
+	c := br.getColumnByName(st.field)
+	v := c.getValueAtRow(br, rowIdx)
+	if v == "" {
+		// Do not count empty values
+		return 0
+	}
+	return stp.updateState(st, v, 1)
+}
+
+func (stp *statsTopkApproxProcessor) updateState(st *statsTopkApprox, v string, hits uint64) int {
+	if stp.sketch == nil {
+		if n, ok := stp.exact[v]; ok {
+			stp.exact[v] = n + hits
+			return 0
+		}
+		if stp.exact == nil {
+			stp.exact = make(map[string]uint64)
+		}
+		v = strings.Clone(v)
+		stp.exact[v] = hits
+		stateSizeIncrease := len(v) + int(unsafe.Sizeof(v)+unsafe.Sizeof(hits))
+		if len(stp.exact) > topkApproxExactMaxLen {
+			stateSizeIncrease += stp.convertToSketch(st)
+		}
+		return stateSizeIncrease
+	}
+
+	cmsAdd(stp.sketch, v, hits)
+	if _, ok := stp.candidates[v]; ok {
+		return 0
+	}
+	v = strings.Clone(v)
+	stp.candidates[v] = struct{}{}
+	stateSizeIncrease := len(v) + int(unsafe.Sizeof(v))
+	stateSizeIncrease += stp.pruneCandidatesIfNeeded(st)
+	return stateSizeIncrease
+}
+
+func (stp *statsTopkApproxProcessor) convertToSketch(st *statsTopkApprox) int {
+	stp.sketch = make([]uint64, cmsWidth*cmsDepth)
+	stp.candidates = make(map[string]struct{}, len(stp.exact))
+	stateSizeIncrease := len(stp.sketch) * int(unsafe.Sizeof(stp.sketch[0]))
+	for v, hits := range stp.exact {
+		cmsAdd(stp.sketch, v, hits)
+		stp.candidates[v] = struct{}{}
+		stateSizeIncrease -= int(unsafe.Sizeof(hits))
+	}
+	stp.exact = nil
+	stateSizeIncrease += stp.pruneCandidatesIfNeeded(st)
+	return stateSizeIncrease
+}
+
+// pruneCandidatesIfNeeded leaves only the candidates with the biggest estimated hits if the number of candidates becomes too big.
+//
+// The pruned values are added back to candidates on the next occurrence, while their hits are preserved in the sketch.
+func (stp *statsTopkApproxProcessor) pruneCandidatesIfNeeded(st *statsTopkApprox) int {
+	maxLen := topkApproxCandidatesMaxLen(st.k)
+	if len(stp.candidates) <= 2*maxLen {
+		return 0
+	}
+
+	entries := stp.getSketchEntries()
+	sortTopkApproxEntries(entries)
+
+	stateSizeIncrease := 0
+	for _, e := range entries[maxLen:] {
+		delete(stp.candidates, e.value)
+		stateSizeIncrease -= len(e.value) + int(unsafe.Sizeof(e.value))
+	}
+	return stateSizeIncrease
+}
+
+func topkApproxCandidatesMaxLen(k uint64) int {
+	return max(4*int(k), 256)
+}
+
+func cmsAdd(sketch []uint64, v string, hits uint64) {
+	h := xxhash.Sum64(bytesutil.ToUnsafeBytes(v))
+	h1 := uint32(h)
+	h2 := uint32(h >> 32)
+	for i := 0; i < cmsDepth; i++ {
+		idx := (h1 + uint32(i)*h2) % cmsWidth
+		sketch[i*cmsWidth+int(idx)] += hits
+	}
+}
+
+func cmsEstimate(sketch []uint64, v string) uint64 {
+	h := xxhash.Sum64(bytesutil.ToUnsafeBytes(v))
+	h1 := uint32(h)
+	h2 := uint32(h >> 32)
+	hits := uint64(1<<64 - 1)
+	for i := 0; i < cmsDepth; i++ {
+		idx := (h1 + uint32(i)*h2) % cmsWidth
+		hits = min(hits, sketch[i*cmsWidth+int(idx)])
+	}
+	return hits
+}
+
+type topkApproxEntry struct {
+	value string
+	hits  uint64
+}
+
+func (stp *statsTopkApproxProcessor) getSketchEntries() []topkApproxEntry {
+	entries := make([]topkApproxEntry, 0, len(stp.candidates))
+	for v := range stp.candidates {
+		entries = append(entries, topkApproxEntry{
+			value: v,
+			hits:  cmsEstimate(stp.sketch, v),
+		})
+	}
+	return entries
+}
+
+func sortTopkApproxEntries(entries []topkApproxEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := &entries[i], &entries[j]
+		if a.hits != b.hits {
+			return a.hits > b.hits
+		}
+		return a.value < b.value
+	})
+}
+
+func (stp *statsTopkApproxProcessor) mergeState(_ *chunkedAllocator, sf statsFunc, sfp statsProcessor) {
+	st := sf.(*statsTopkApprox)
+	src := sfp.(*statsTopkApproxProcessor)
+
+	if src.sketch == nil {
+		for v, hits := range src.exact {
+			stp.updateState(st, v, hits)
+		}
+		return
+	}
+
+	if stp.sketch == nil {
+		stp.convertToSketch(st)
+	}
+	for i, n := range src.sketch {
+		stp.sketch[i] += n
+	}
+	for v := range src.candidates {
+		stp.candidates[v] = struct{}{}
+	}
+	stp.pruneCandidatesIfNeeded(st)
+}
+
+func (stp *statsTopkApproxProcessor) exportState(dst []byte, _ <-chan struct{}) []byte {
+	if stp.sketch == nil {
+		dst = append(dst, 0)
+		dst = encoding.MarshalVarUint64(dst, uint64(len(stp.exact)))
+		for v, hits := range stp.exact {
+			dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(v))
+			dst = encoding.MarshalVarUint64(dst, hits)
+		}
+		return dst
+	}
+
+	dst = append(dst, 1)
+	for _, n := range stp.sketch {
+		dst = encoding.MarshalVarUint64(dst, n)
+	}
+	dst = encoding.MarshalVarUint64(dst, uint64(len(stp.candidates)))
+	for v := range stp.candidates {
+		dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(v))
+	}
+	return dst
+}
+
+func (stp *statsTopkApproxProcessor) importState(src []byte, _ <-chan struct{}) (int, error) {
+	if len(src) == 0 {
+		return 0, fmt.Errorf("missing state type")
+	}
+	stateType := src[0]
+	src = src[1:]
+
+	stateSize := 0
+	switch stateType {
+	case 0:
+		entriesLen, n := encoding.UnmarshalVarUint64(src)
+		if n <= 0 {
+			return 0, fmt.Errorf("cannot unmarshal the number of entries")
+		}
+		src = src[n:]
+
+		stp.sketch = nil
+		stp.candidates = nil
+		stp.exact = make(map[string]uint64, entriesLen)
+		for i := uint64(0); i < entriesLen; i++ {
+			v, n := encoding.UnmarshalBytes(src)
+			if n <= 0 {
+				return 0, fmt.Errorf("cannot unmarshal value")
+			}
+			src = src[n:]
+
+			hits, n := encoding.UnmarshalVarUint64(src)
+			if n <= 0 {
+				return 0, fmt.Errorf("cannot unmarshal hits")
+			}
+			src = src[n:]
+
+			stp.exact[string(v)] = hits
+			stateSize += len(v) + int(unsafe.Sizeof("")+unsafe.Sizeof(hits))
+		}
+	case 1:
+		stp.exact = nil
+		stp.sketch = make([]uint64, cmsWidth*cmsDepth)
+		for i := range stp.sketch {
+			hits, n := encoding.UnmarshalVarUint64(src)
+			if n <= 0 {
+				return 0, fmt.Errorf("cannot unmarshal sketch counter #%d", i)
+			}
+			src = src[n:]
+			stp.sketch[i] = hits
+		}
+		stateSize += len(stp.sketch) * int(unsafe.Sizeof(stp.sketch[0]))
+
+		candidatesLen, n := encoding.UnmarshalVarUint64(src)
+		if n <= 0 {
+			return 0, fmt.Errorf("cannot unmarshal the number of candidates")
+		}
+		src = src[n:]
+
+		stp.candidates = make(map[string]struct{}, candidatesLen)
+		for i := uint64(0); i < candidatesLen; i++ {
+			v, n := encoding.UnmarshalBytes(src)
+			if n <= 0 {
+				return 0, fmt.Errorf("cannot unmarshal candidate")
+			}
+			src = src[n:]
+
+			stp.candidates[string(v)] = struct{}{}
+			stateSize += len(v) + int(unsafe.Sizeof(""))
+		}
+	default:
+		return 0, fmt.Errorf("unexpected state type: %d", stateType)
+	}
+
+	if len(src) > 0 {
+		return 0, fmt.Errorf("unexpected non-empty tail left; len(tail)=%d", len(src))
+	}
+
+	return stateSize, nil
+}
+
+func (stp *statsTopkApproxProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	st := sf.(*statsTopkApprox)
+
+	var entries []topkApproxEntry
+	if stp.sketch == nil {
+		entries = make([]topkApproxEntry, 0, len(stp.exact))
+		for v, hits := range stp.exact {
+			entries = append(entries, topkApproxEntry{
+				value: v,
+				hits:  hits,
+			})
+		}
+	} else {
+		entries = stp.getSketchEntries()
+	}
+	sortTopkApproxEntries(entries)
+	if uint64(len(entries)) > st.k {
+		entries = entries[:st.k]
+	}
+
+	dst = append(dst, '[')
+	for i, e := range entries {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, `{"value":`...)
+		dst = quicktemplate.AppendJSONString(dst, e.value, true)
+		dst = append(dst, `,"hits":`...)
+		dst = strconv.AppendUint(dst, e.hits, 10)
+		dst = append(dst, '}')
+	}
+	dst = append(dst, ']')
+	return dst
+}
+
+func parseStatsTopkApprox(lex *lexer) (statsFunc, error) {
+	fields, err := parseStatsFuncFields(lex, "topk_approx")
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("'topk_approx' must have two args - k and field name; got %d args", len(fields))
+	}
+
+	kStr := fields[0]
+	k, ok := tryParseUint64(kStr)
+	if !ok {
+		return nil, fmt.Errorf("k arg in 'topk_approx' must be positive integer; got %q", kStr)
+	}
+	if k == 0 || k > topkApproxMaxK {
+		return nil, fmt.Errorf("k arg in 'topk_approx' must be in the range [1..%d]; got %q", topkApproxMaxK, kStr)
+	}
+
+	st := &statsTopkApprox{
+		field: fields[1],
+
+		k:    k,
+		kStr: kStr,
+	}
+	return st, nil
+}
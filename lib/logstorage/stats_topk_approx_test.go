@@ -0,0 +1,199 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseStatsTopkApproxSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`topk_approx(1, a)`)
+	f(`topk_approx(10, a)`)
+	f(`topk_approx(10000, "foo bar")`)
+}
+
+func TestParseStatsTopkApproxFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`topk_approx`)
+	f(`topk_approx()`)
+	f(`topk_approx(10)`)
+	f(`topk_approx(a)`)
+	f(`topk_approx(10, *)`)
+	f(`topk_approx(10, a*)`)
+	f(`topk_approx(10, a, b)`)
+	f(`topk_approx(0, a)`)
+	f(`topk_approx(-1, a)`)
+	f(`topk_approx(1.5, a)`)
+	f(`topk_approx(10001, a)`)
+	f(`topk_approx(10, a) y`)
+}
+
+func TestStatsTopkApprox(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("stats topk_approx(2, a) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `foo`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `bar`},
+		},
+		{},
+		{
+			{"a", `foo`},
+		},
+		{
+			{"a", `baz`},
+		},
+		{
+			{"a", `bar`},
+		},
+		{
+			{"a", `foo`},
+		},
+	}, [][]Field{
+		{
+			{"x", `[{"value":"foo","hits":3},{"value":"bar","hits":2}]`},
+		},
+	})
+
+	f("stats by (a) topk_approx(5, b) as x", [][]Field{
+		{
+			{"a", `1`},
+			{"b", `x"y`},
+		},
+		{
+			{"a", `1`},
+			{"b", `z`},
+		},
+		{
+			{"a", `3`},
+		},
+	}, [][]Field{
+		{
+			{"a", "1"},
+			{"x", `[{"value":"x\"y","hits":1},{"value":"z","hits":1}]`},
+		},
+		{
+			{"a", "3"},
+			{"x", `[]`},
+		},
+	})
+}
+
+func TestStatsTopkApprox_Accuracy(t *testing.T) {
+	st := &statsTopkApprox{
+		field: "a",
+		k:     5,
+		kStr:  "5",
+	}
+
+	// Spread the values among multiple processors in order to verify mergeState
+	var stps [4]statsTopkApproxProcessor
+	total := uint64(0)
+	for i := 0; i < 100_000; i++ {
+		v := fmt.Sprintf("rare_%d", i)
+		stps[i%len(stps)].updateState(st, v, 1)
+		total++
+	}
+	for i := 0; i < 10; i++ {
+		v := fmt.Sprintf("heavy_%d", i)
+		hits := uint64(10_000 * (10 - i))
+		for j := range stps {
+			stps[j].updateState(st, v, hits/uint64(len(stps)))
+		}
+		total += hits
+	}
+
+	stp := &stps[0]
+	for i := 1; i < len(stps); i++ {
+		stp.mergeState(nil, st, &stps[i])
+	}
+	if stp.sketch == nil {
+		t.Fatalf("expecting sketch to be used")
+	}
+
+	result := string(stp.finalizeStats(st, nil, nil))
+
+	var expected []byte
+	maxErr := uint64(math.E / cmsWidth * float64(total))
+	for i := 0; i < 5; i++ {
+		v := fmt.Sprintf("heavy_%d", i)
+		hits := uint64(10_000 * (10 - i))
+		hitsEstimated := cmsEstimate(stp.sketch, v)
+		if hitsEstimated < hits || hitsEstimated > hits+maxErr {
+			t.Fatalf("unexpected estimated hits for %q; got %d; want [%d..%d]", v, hitsEstimated, hits, hits+maxErr)
+		}
+		if i > 0 {
+			expected = append(expected, ',')
+		}
+		expected = fmt.Appendf(expected, `{"value":%q,"hits":%d}`, v, hitsEstimated)
+	}
+	expectedStr := "[" + string(expected) + "]"
+	if result != expectedStr {
+		t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, expectedStr)
+	}
+}
+
+func TestStatsTopkApprox_ExportImportState(t *testing.T) {
+	st := &statsTopkApprox{
+		field: "a",
+		k:     3,
+		kStr:  "3",
+	}
+
+	f := func(stp *statsTopkApproxProcessor, dataLenExpected int) {
+		t.Helper()
+
+		data := stp.exportState(nil, nil)
+		dataLen := len(data)
+		if dataLenExpected >= 0 && dataLen != dataLenExpected {
+			t.Fatalf("unexpected dataLen; got %d; want %d", dataLen, dataLenExpected)
+		}
+
+		var stp2 statsTopkApproxProcessor
+		if _, err := stp2.importState(data, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		result := string(stp.finalizeStats(st, nil, nil))
+		result2 := string(stp2.finalizeStats(st, nil, nil))
+		if result != result2 {
+			t.Fatalf("unexpected result after import\ngot\n%s\nwant\n%s", result2, result)
+		}
+		if !reflect.DeepEqual(stp.sketch, stp2.sketch) {
+			t.Fatalf("unexpected sketch imported")
+		}
+	}
+
+	var stp statsTopkApproxProcessor
+
+	// Zero state
+	f(&stp, 2)
+
+	// Exact state
+	stp.updateState(st, "foo", 3)
+	stp.updateState(st, "bar", 1)
+	f(&stp, 12)
+
+	// Sketch state
+	for i := 0; i < 2*topkApproxExactMaxLen; i++ {
+		stp.updateState(st, fmt.Sprintf("value_%d", i), uint64(i))
+	}
+	f(&stp, -1)
+}
@@ -38,6 +38,15 @@ type StorageStats struct {
 	// IsReadOnly indicates whether the storage is read-only.
 	IsReadOnly bool
 
+	// PinnedViewsCount is the number of views pinned via Storage.PinView.
+	PinnedViewsCount uint64
+
+	// WALBytesWritten is the number of bytes written to the write-ahead log.
+	WALBytesWritten uint64
+
+	// WALSyncs is the number of syncs of the write-ahead log to disk.
+	WALSyncs uint64
+
 	// PartitionStats contains partition stats.
 	PartitionStats
 
@@ -48,6 +57,13 @@ type StorageStats struct {
 	// MaxTimestamp is the maximum event timestamp across the entire storage (in nanoseconds).
 	// It is set to math.MaxInt64 if there is no data.
 	MaxTimestamp int64
+
+	// RowsIngested is the number of rows passed to Storage.MustAddRows since the storage start, including the dropped rows.
+	RowsIngested uint64
+
+	// MaxIngestedTimestamp is the maximum timestamp for the logs ingested since the storage start (in nanoseconds).
+	// It is set to 0 if no logs were ingested since the start. See Storage.GetMaxIngestedTimestamp.
+	MaxIngestedTimestamp int64
 }
 
 // Reset resets s.
@@ -103,13 +119,91 @@ type StorageConfig struct {
 	//
 	// This can be useful for debugging of data ingestion.
 	LogIngestedRows bool
+
+	// TenantRetentions contains optional per-tenant retention for the stored data.
+	//
+	// Logs for the given tenants with timestamps older than the corresponding retention are automatically deleted.
+	// The per-tenant retention cannot exceed Retention, since older logs are dropped for all the tenants.
+	TenantRetentions map[TenantID]time.Duration
+
+	// InactiveTenantRetention is an optional duration after which all the logs for tenants
+	// without newly ingested logs are automatically deleted.
+	InactiveTenantRetention time.Duration
+
+	// TokenPositionsMaxDistance is an optional maximum distance between _msg tokens, which pairs are stored in bloom filters.
+	//
+	// This allows skipping blocks without the needed adjacent words for multi-word phrase filters
+	// and blocks without the needed nearby words for near() filters at the cost of bigger bloom filters.
+	// Zero value disables the token positions index. The value cannot exceed MaxTokenPositionsDistance.
+	TokenPositionsMaxDistance int
+
+	// IndexedFields is an optional list of fields, which must be indexed in the field index.
+	//
+	// The field index maps values of these fields to blocks containing them. This allows avoiding the scan of blocks
+	// without the needed values for exact and in() filters on these fields, e.g. `trace_id:=abc` or `user_id:in(1,2,3)`.
+	// It is recommended to index fields with high number of unique values such as trace_id or user_id.
+	IndexedFields []string
+
+	// EnableHitsPreaggregation enables maintaining per-stream per-minute hits for the newly created parts.
+	//
+	// This allows answering hits queries without scanning the stored logs at the cost of an additional file per part.
+	// See Storage.GetHitsPreaggregated.
+	EnableHitsPreaggregation bool
+
+	// EnableWAL enables the write-ahead log for the added logs.
+	//
+	// The write-ahead log allows recovering the recently added logs, which weren't written to disk parts yet, after unclean shutdown.
+	EnableWAL bool
+
+	// WALSyncPolicy is the policy for syncing the write-ahead log to disk.
+	WALSyncPolicy WALSyncPolicy
+
+	// WALSyncInterval is the interval for syncing the write-ahead log to disk when WALSyncPolicy is set to WALSyncPolicyInterval.
+	WALSyncInterval time.Duration
+
+	// PendingRowsFlushInterval is the maximum duration the added logs may stay in the pending buffer before they become searchable
+	// via in-memory parts. One second is used by default. The value cannot exceed FlushInterval.
+	PendingRowsFlushInterval time.Duration
+
+	// MaxPendingRowsSize is the maximum size in bytes of the pending buffer for the added logs per CPU core.
+	//
+	// The buffer is converted to an in-memory part when its size exceeds this limit. It must be in the range
+	// [MinPendingRowsSize..MaxPendingRowsSize]. MaxPendingRowsSize is used by default.
+	MaxPendingRowsSize int
+
+	// ExtraPaths is an optional list of additional directories for storing per-day partitions.
+	//
+	// New partitions are created at the directory with the biggest amount of free disk space among the storage path and ExtraPaths.
+	// This allows using multiple disks without RAID or LVM.
+	ExtraPaths []string
+
+	// MaxInmemoryPartSize is the maximum size in bytes for in-memory parts.
+	//
+	// Bigger in-memory parts are written to disk. By default the limit depends on the available memory.
+	MaxInmemoryPartSize int64
 }
 
+const (
+	// MinPendingRowsSize is the minimum supported value for StorageConfig.MaxPendingRowsSize.
+	MinPendingRowsSize = 64 * 1024
+
+	// MaxPendingRowsSize is the maximum supported value for StorageConfig.MaxPendingRowsSize.
+	MaxPendingRowsSize = (maxUncompressedBlockSize / 8) * 7
+)
+
 // Storage is the storage for log entries.
 type Storage struct {
 	rowsDroppedTooBigTimestamp   atomic.Uint64
 	rowsDroppedTooSmallTimestamp atomic.Uint64
 
+	// rowsIngested is the number of rows passed to MustAddRows since the storage start.
+	rowsIngested atomic.Uint64
+
+	// maxIngestedTimestamp is the maximum timestamp in nanoseconds for the logs ingested into the storage since its start.
+	//
+	// It is limited by the current time, so logs with timestamps in the future do not affect it.
+	maxIngestedTimestamp atomic.Int64
+
 	// path is the path to the Storage directory
 	path string
 
@@ -134,6 +228,15 @@ type Storage struct {
 	// flushInterval is the interval for flushing in-memory data to disk
 	flushInterval time.Duration
 
+	// pendingRowsFlushInterval is the interval for converting pending rows to in-memory parts
+	pendingRowsFlushInterval time.Duration
+
+	// maxPendingRowsSize is the maximum size of pending rows per shard of the rows buffer
+	maxPendingRowsSize int
+
+	// maxInmemoryPartSize is the maximum size of in-memory part. Zero means the size is determined by the available memory.
+	maxInmemoryPartSize uint64
+
 	// futureRetention is the maximum allowed interval to write data into the future
 	futureRetention time.Duration
 
@@ -143,6 +246,21 @@ type Storage struct {
 	// minFreeDiskSpaceBytes is the minimum free disk space at path after which the storage stops accepting new data
 	minFreeDiskSpaceBytes uint64
 
+	// tenantRetentions contains optional per-tenant retention for the stored data
+	tenantRetentions map[TenantID]time.Duration
+
+	// inactiveTenantRetention is an optional duration after which logs for tenants without new logs are deleted
+	inactiveTenantRetention time.Duration
+
+	// tokenPositionsMaxDistance is the maximum distance between _msg tokens, which pairs are stored in bloom filters
+	tokenPositionsMaxDistance int
+
+	// indexedFields contains fields, which must be indexed in the field index. See StorageConfig.IndexedFields
+	indexedFields []string
+
+	// enableHitsPreaggregation enables maintaining per-stream per-minute hits for the newly created parts. See StorageConfig.EnableHitsPreaggregation
+	enableHitsPreaggregation bool
+
 	// logNewStreams instructs to log new streams if it is set to true
 	logNewStreams atomic.Bool
 
@@ -152,6 +270,12 @@ type Storage struct {
 	// flockF is a file, which makes sure that the Storage is opened by a single process
 	flockF *os.File
 
+	// dataPaths contains paths for storing partitions. The first path is the Storage path, while the rest are StorageConfig.ExtraPaths.
+	dataPaths []string
+
+	// extraFlockFs contains lock files for StorageConfig.ExtraPaths.
+	extraFlockFs []*os.File
+
 	// partitions is a list of partitions for the Storage.
 	//
 	// It must be accessed under partitionsLock.
@@ -196,6 +320,35 @@ type Storage struct {
 
 	// deleteTasks contains a list of active and pending delete tasks
 	deleteTasks []*DeleteTask
+
+	// legalHoldsLock protects legalHolds
+	legalHoldsLock sync.Mutex
+
+	// legalHolds contains a list of legal holds placed via LegalHoldPlace
+	legalHolds []*LegalHold
+
+	// streamsRelabelLock prevents from concurrent execution of StreamsRelabel
+	streamsRelabelLock sync.Mutex
+
+	// partitionHashesLock protects partitionHashes
+	partitionHashesLock sync.Mutex
+
+	// partitionHashes contains hashes for partitions sealed via PartitionSeal
+	partitionHashes []*PartitionHash
+
+	// streamsLastSeen tracks the last time when logs were received per each log stream.
+	//
+	// It is used for detecting log streams, which stopped receiving logs. See GetStreamsLastSeen.
+	streamsLastSeen *streamsLastSeenTracker
+
+	// pinnedViewsLock protects pinnedViews.
+	pinnedViewsLock sync.Mutex
+
+	// pinnedViews contains views pinned via PinView keyed by view id.
+	pinnedViews map[string]*pinnedView
+
+	// wal is an optional write-ahead log for the added logs. It is nil if StorageConfig.EnableWAL isn't set.
+	wal *wal
 }
 
 // PartitionAttach attaches the partition with the given name to s.
@@ -224,9 +377,9 @@ func (s *Storage) PartitionAttach(name string) error {
 	}
 
 	// Open the partition and add it to the s.partitions.
-	partitionsPath := filepath.Join(s.path, partitionsDirname)
-	partitionPath := filepath.Join(partitionsPath, name)
-	if !fs.IsPathExist(partitionPath) {
+	partitionPath := s.findPartitionPath(name)
+	if partitionPath == "" {
+		partitionPath = filepath.Join(s.path, partitionsDirname, name)
 		return fmt.Errorf("cannot attach the partition %q, because there is no the corresponding directory %q", name, partitionPath)
 	}
 
@@ -271,6 +424,7 @@ func (s *Storage) PartitionDetach(name string) error {
 	}
 
 	partitionPath := ptw.pt.path
+	s.unpinViewsForPartition(ptw)
 	ptw.decRef()
 
 	logger.Infof("waiting until the partition %q isn't accessed", name)
@@ -556,6 +710,27 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 		flushInterval = time.Second
 	}
 
+	pendingRowsFlushInterval := cfg.PendingRowsFlushInterval
+	if pendingRowsFlushInterval <= 0 {
+		pendingRowsFlushInterval = time.Second
+	}
+	if pendingRowsFlushInterval > flushInterval {
+		pendingRowsFlushInterval = flushInterval
+	}
+
+	maxPendingRowsSize := cfg.MaxPendingRowsSize
+	if maxPendingRowsSize <= 0 || maxPendingRowsSize > MaxPendingRowsSize {
+		maxPendingRowsSize = MaxPendingRowsSize
+	}
+	if maxPendingRowsSize < MinPendingRowsSize {
+		maxPendingRowsSize = MinPendingRowsSize
+	}
+
+	var maxInmemoryPartSize uint64
+	if cfg.MaxInmemoryPartSize > 0 {
+		maxInmemoryPartSize = uint64(cfg.MaxInmemoryPartSize)
+	}
+
 	retention := cfg.Retention
 	if retention < 24*time.Hour {
 		retention = 24 * time.Hour
@@ -581,6 +756,7 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 	}
 
 	flockF := fs.MustCreateFlockFile(path)
+	extraFlockFs := mustInitExtraDataPaths(path, cfg.ExtraPaths)
 
 	// Load caches
 	streamIDCache := newCache()
@@ -590,24 +766,52 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 	deleteTasksPath := filepath.Join(path, deleteTasksFilename)
 	deleteTasks := mustReadDeleteTasksFromFile(deleteTasksPath)
 
+	// Load legal holds
+	legalHoldsPath := filepath.Join(path, legalHoldsFilename)
+	legalHolds := mustReadLegalHoldsFromFile(legalHoldsPath)
+
+	// Load hashes for sealed partitions
+	partitionHashesPath := filepath.Join(path, partitionHashesFilename)
+	partitionHashes := mustReadPartitionHashesFromFile(partitionHashesPath)
+
 	s := &Storage{
-		path:                   path,
-		retention:              retention,
-		defaultParallelReaders: cfg.DefaultParallelReaders,
-		maxDiskSpaceUsageBytes: cfg.MaxDiskSpaceUsageBytes,
-		maxDiskUsagePercent:    cfg.MaxDiskUsagePercent,
-		flushInterval:          flushInterval,
-		futureRetention:        futureRetention,
-		maxBackfillAge:         maxBackfillAge,
-		minFreeDiskSpaceBytes:  minFreeDiskSpaceBytes,
-		logIngestedRows:        cfg.LogIngestedRows,
-		flockF:                 flockF,
-		stopCh:                 make(chan struct{}),
+		path:                     path,
+		retention:                retention,
+		defaultParallelReaders:   cfg.DefaultParallelReaders,
+		maxDiskSpaceUsageBytes:   cfg.MaxDiskSpaceUsageBytes,
+		maxDiskUsagePercent:      cfg.MaxDiskUsagePercent,
+		flushInterval:            flushInterval,
+		pendingRowsFlushInterval: pendingRowsFlushInterval,
+		maxPendingRowsSize:       maxPendingRowsSize,
+		maxInmemoryPartSize:      maxInmemoryPartSize,
+		futureRetention:          futureRetention,
+		maxBackfillAge:           maxBackfillAge,
+		minFreeDiskSpaceBytes:    minFreeDiskSpaceBytes,
+		logIngestedRows:          cfg.LogIngestedRows,
+		flockF:                   flockF,
+		dataPaths:                append([]string{path}, cfg.ExtraPaths...),
+		extraFlockFs:             extraFlockFs,
+		stopCh:                   make(chan struct{}),
 
 		streamIDCache:     streamIDCache,
 		filterStreamCache: filterStreamCache,
 
 		deleteTasks: deleteTasks,
+
+		legalHolds: legalHolds,
+
+		partitionHashes: partitionHashes,
+
+		streamsLastSeen: newStreamsLastSeenTracker(),
+
+		pinnedViews: make(map[string]*pinnedView),
+
+		tenantRetentions:        cfg.TenantRetentions,
+		inactiveTenantRetention: cfg.InactiveTenantRetention,
+
+		tokenPositionsMaxDistance: min(max(cfg.TokenPositionsMaxDistance, 0), MaxTokenPositionsDistance),
+		indexedFields:             append([]string{}, cfg.IndexedFields...),
+		enableHitsPreaggregation:  cfg.EnableHitsPreaggregation,
 	}
 	s.logNewStreams.Store(cfg.LogNewStreams)
 
@@ -615,22 +819,33 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 	fs.MustMkdirIfNotExist(partitionsPath)
 	fs.MustSyncPath(path)
 
-	des := fs.MustReadDir(partitionsPath)
-	ptws := make([]*partitionWrapper, len(des))
+	// Collect partition directories from all the data paths.
+	var partitionDirs []string
+	partitionPaths := make(map[string]string)
+	for _, dataPath := range s.dataPaths {
+		partitionsPath := filepath.Join(dataPath, partitionsDirname)
+		for _, de := range fs.MustReadDir(partitionsPath) {
+			fname := de.Name()
+			partitionDir := filepath.Join(partitionsPath, fname)
+			if fs.IsPartiallyRemovedDir(partitionDir) {
+				// Drop partially removed partition directory. This may happen when unclean shutdown happens during partition deletion.
+				fs.MustRemoveDir(partitionDir)
+				continue
+			}
+			if prevDir, ok := partitionPaths[fname]; ok {
+				logger.Panicf("FATAL: the partition %q exists at multiple data paths: %q and %q; remove one of these directories", fname, prevDir, partitionDir)
+			}
+			partitionPaths[fname] = partitionDir
+			partitionDirs = append(partitionDirs, partitionDir)
+		}
+	}
+	ptws := make([]*partitionWrapper, len(partitionDirs))
 
 	// Open partitions in parallel. This should improve VictoriaLogs initialization duration
 	// when it opens many partitions.
 	var wg sync.WaitGroup
 	concurrencyLimiterCh := make(chan struct{}, cgroup.AvailableCPUs())
-	for i, de := range des {
-		fname := de.Name()
-
-		partitionDir := filepath.Join(partitionsPath, fname)
-		if fs.IsPartiallyRemovedDir(partitionDir) {
-			// Drop partially removed partition directory. This may happen when unclean shutdown happens during partition deletion.
-			fs.MustRemoveDir(partitionDir)
-			continue
-		}
+	for i, partitionPath := range partitionDirs {
 
 		wg.Add(1)
 		concurrencyLimiterCh <- struct{}{}
@@ -640,12 +855,12 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 				wg.Done()
 			}()
 
+			fname := filepath.Base(partitionPath)
 			day, err := getPartitionDayFromName(fname)
 			if err != nil {
-				logger.Panicf("FATAL: cannot parse partition filename %q at %q: %s", fname, partitionsPath, err)
+				logger.Panicf("FATAL: cannot parse partition filename %q at %q: %s", fname, filepath.Dir(partitionPath), err)
 			}
 
-			partitionPath := filepath.Join(partitionsPath, fname)
 			pt := mustOpenPartition(s, partitionPath)
 			ptws[idx] = newPartitionWrapper(pt, day)
 		}(i)
@@ -675,9 +890,37 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 	ptws = ptws[:j]
 
 	s.partitions = ptws
+
+	// Recover logs from the write-ahead log left after unclean shutdown.
+	// This must be performed even if the write-ahead log is disabled now, since it could be enabled before the restart.
+	walPath := filepath.Join(path, walDirname)
+	if fs.IsPathExist(walPath) {
+		startTime := time.Now()
+		rowsReplayed := s.mustReplayWAL(walPath)
+		s.mustFlushPartitionsToFiles()
+		if cfg.EnableWAL {
+			mustRemoveWALSegmentsBefore(walPath, math.MaxUint64)
+		} else {
+			fs.MustRemoveDir(walPath)
+		}
+		if rowsReplayed > 0 {
+			logger.Infof("recovered %d log entries from the write-ahead log at %q in %.3f seconds", rowsReplayed, walPath, time.Since(startTime).Seconds())
+		}
+	}
+	if cfg.EnableWAL {
+		walSyncInterval := cfg.WALSyncInterval
+		if walSyncInterval <= 0 {
+			walSyncInterval = time.Second
+		}
+		s.wal = mustOpenWAL(walPath, cfg.WALSyncPolicy)
+		s.runWALWatcher(walSyncInterval)
+	}
+
 	s.runRetentionWatcher()
 	s.runMaxDiskSpaceUsageWatcher()
 	s.runDeleteTasksWatcher()
+	s.runPinnedViewsWatcher()
+	s.runTenantRetentionWatcher()
 	return s
 }
 
@@ -719,35 +962,23 @@ func (s *Storage) watchRetention() {
 	ticker := time.NewTicker(d)
 	defer ticker.Stop()
 	for {
-		var ptwsToDelete []*partitionWrapper
 		now := time.Now().UnixNano()
 		minAllowedDay := s.getMinAllowedDay(now)
 
-		s.partitionsLock.Lock()
-
-		// Delete outdated partitions.
+		// Collect outdated partitions.
 		// s.partitions are sorted by day, so the partitions, which can become outdated, are located at the beginning of the list
-		ptws := s.partitions
-		for i, ptw := range ptws {
-			if ptw.day < minAllowedDay {
-				continue
-			}
-
-			// ptws are sorted by time, so just drop all the partitions until i.
-			ptwsToDelete = ptws[:i]
-			s.partitions = ptws[i:]
-			s.updateDeletedPartitionsLocked(ptwsToDelete)
-
-			// Remove reference to deleted partitions from s.ptwHot
-			if slices.Contains(ptwsToDelete, s.ptwHot) {
-				s.ptwHot = nil
+		var days []int64
+		s.partitionsLock.Lock()
+		for _, ptw := range s.partitions {
+			if ptw.day >= minAllowedDay {
+				break
 			}
-
-			break
+			days = append(days, ptw.day)
 		}
-
 		s.partitionsLock.Unlock()
 
+		ptwsToDelete := s.detachPartitionsForDays(days)
+
 		for i, ptw := range ptwsToDelete {
 			logger.Infof("the partition %s is scheduled to be deleted because it is outside the -retentionPeriod=%dd", ptw.pt.path, durationToDays(s.retention))
 			ptw.mustDrop.Store(true)
@@ -773,7 +1004,7 @@ func (s *Storage) watchMaxDiskSpaceUsage() {
 		if s.maxDiskSpaceUsageBytes > 0 {
 			limitBytes = uint64(s.maxDiskSpaceUsageBytes)
 		} else if s.maxDiskUsagePercent > 0 {
-			total := fs.MustGetTotalSpace(s.path)
+			total := s.getTotalDiskSpace()
 			if total > 0 {
 				limitBytes = (total * uint64(s.maxDiskUsagePercent)) / 100
 			}
@@ -788,10 +1019,10 @@ func (s *Storage) watchMaxDiskSpaceUsage() {
 			}
 		}
 
+		var days []int64
 		s.partitionsLock.Lock()
 		var n uint64
 		ptws := s.partitions
-		var ptwsToDelete []*partitionWrapper
 		for i := len(ptws) - 1; i >= 0; i-- {
 			ptw := ptws[i]
 			var ps PartitionStats
@@ -806,21 +1037,15 @@ func (s *Storage) watchMaxDiskSpaceUsage() {
 			}
 
 			// ptws are sorted by time, so just drop all the partitions until i, including i.
-			i++
-			ptwsToDelete = ptws[:i]
-			s.partitions = ptws[i:]
-			s.updateDeletedPartitionsLocked(ptwsToDelete)
-
-			// Remove reference to deleted partitions from s.ptwHot
-			if slices.Contains(ptwsToDelete, s.ptwHot) {
-				s.ptwHot = nil
+			for _, ptw := range ptws[:i+1] {
+				days = append(days, ptw.day)
 			}
-
 			break
 		}
-
 		s.partitionsLock.Unlock()
 
+		ptwsToDelete := s.detachPartitionsForDays(days)
+
 		for i, ptw := range ptwsToDelete {
 			var reason string
 			if s.maxDiskSpaceUsageBytes > 0 {
@@ -905,9 +1130,34 @@ func (s *Storage) processDeleteTask(ctx context.Context, dt *DeleteTask) bool {
 	logger.Infof("started processing delete task %s", dt)
 	startTime := time.Now()
 
-	f, err := ParseFilter(dt.Filter)
+	// Logs under legal holds must be preserved, so they are excluded from the deletion.
+	// See LegalHoldPlace.
+	for _, g := range s.getDeleteTaskGroups(dt.TenantIDs, dt.Filter) {
+		ok, canceled := s.processDeleteTaskGroup(ctx, dt, g.tenantIDs, g.filter)
+		if canceled {
+			// The task has been canceled explicitly. Return true, so it isn't re-scheduled for later execution.
+			logger.Infof("the delete task with task_id=%q is explicitly canceled after %.3f seconds", dt.TaskID, time.Since(startTime).Seconds())
+			return true
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	logger.Infof("finished processing delete task %s in %.3f seconds", dt, time.Since(startTime).Seconds())
+	return true
+}
+
+// processDeleteTaskGroup deletes logs matching the given filter for the given tenantIDs according to dt.
+//
+// ok=false is returned if the logs couldn't be deleted at the moment, so dt must be processed later.
+// canceled=true is returned if dt has been explicitly canceled.
+func (s *Storage) processDeleteTaskGroup(ctx context.Context, dt *DeleteTask, tenantIDs []TenantID, filter string) (ok, canceled bool) {
+	startTime := time.Now()
+
+	f, err := ParseFilter(filter)
 	if err != nil {
-		logger.Panicf("BUG: cannot parse filter from delete task: [%s]", dt.Filter)
+		logger.Panicf("BUG: cannot parse filter from delete task: [%s]", filter)
 	}
 
 	q := &Query{
@@ -922,17 +1172,17 @@ func (s *Storage) processDeleteTask(ctx context.Context, dt *DeleteTask) bool {
 	q.AddTimeFilter(start, end)
 
 	var qs QueryStats
-	qctx := NewQueryContext(ctx, &qs, dt.TenantIDs, q, false, nil)
+	qctx := NewQueryContext(ctx, &qs, tenantIDs, q, false, nil)
 
 	// Initialize subqueries
 	qNew, err := initSubqueries(qctx, s.runQuery, true)
 	if err != nil {
 		logger.Errorf("cannot process delete task with task_id=%q while initializing subqueries: %s; retrying later", dt.TaskID, err)
-		return false
+		return false, false
 	}
 	q = qNew
 
-	sso := s.getSearchOptions(dt.TenantIDs, q, qctx.HiddenFieldsFilters)
+	sso := s.getSearchOptions(tenantIDs, q, qctx.HiddenFieldsFilters)
 
 	// reset fieldsFilter in order to avoid loading all the log fields
 	// during search for parts which contain rows to delete, since these fields aren't needed.
@@ -943,22 +1193,19 @@ func (s *Storage) processDeleteTask(ctx context.Context, dt *DeleteTask) bool {
 	if !s.deleteRows(sso, stopCh) {
 		if needStop(s.stopCh) {
 			logger.Infof("the storage is stopped while executing the delete task with task_id=%q; postponing the task for later execution", dt.TaskID)
-			return false
+			return false, false
 		}
 
 		if needStop(stopCh) {
-			// The task has been canceled explicitly. Return true, so it isn't re-scheduled for later execution.
-			logger.Infof("the delete task with task_id=%q is explicitly canceled after %.3f seconds", dt.TaskID, time.Since(startTime).Seconds())
-			return true
+			return false, true
 		}
 
 		// The task couldn't be processed at the moment
 		logger.Warnf("cannot proceeed with the delete task with task_id=%q in %.3f seconds; retrying it later", dt.TaskID, time.Since(startTime).Seconds())
-		return false
+		return false, false
 	}
 
-	logger.Infof("finished processing delete task %s in %.3f seconds", dt, time.Since(startTime).Seconds())
-	return true
+	return true, false
 }
 
 func (s *Storage) deleteRows(sso *storageSearchOptions, stopCh <-chan struct{}) bool {
@@ -978,6 +1225,56 @@ func (s *Storage) deleteRows(sso *storageSearchOptions, stopCh <-chan struct{})
 	return ok
 }
 
+// detachPartitionsForDays detaches partitions for the given days from s.partitions and returns them.
+//
+// Partitions containing logs under legal holds aren't detached. See LegalHoldPlace.
+// The caller must drop the returned partitions.
+func (s *Storage) detachPartitionsForDays(days []int64) []*partitionWrapper {
+	if len(days) == 0 {
+		return nil
+	}
+
+	ctx, cancel := contextutil.NewStopChanContext(s.stopCh)
+	daysToDelete, err := s.getDaysWithoutLegalHolds(ctx, days)
+	cancel()
+	if err != nil {
+		if !needStop(s.stopCh) {
+			logger.Errorf("cannot delete outdated partitions: %s; retrying later", err)
+		}
+		return nil
+	}
+	for _, day := range days {
+		if _, ok := daysToDelete[day]; !ok {
+			legalHoldPartitionLogger.Warnf("the partition for the day %s isn't deleted because it contains logs under legal hold", time.Unix(0, day*nsecsPerDay).UTC().Format(time.DateOnly))
+		}
+	}
+	if len(daysToDelete) == 0 {
+		return nil
+	}
+
+	s.partitionsLock.Lock()
+	defer s.partitionsLock.Unlock()
+
+	var ptwsToDelete []*partitionWrapper
+	ptws := make([]*partitionWrapper, 0, len(s.partitions))
+	for _, ptw := range s.partitions {
+		if _, ok := daysToDelete[ptw.day]; ok {
+			ptwsToDelete = append(ptwsToDelete, ptw)
+		} else {
+			ptws = append(ptws, ptw)
+		}
+	}
+	s.partitions = ptws
+	s.updateDeletedPartitionsLocked(ptwsToDelete)
+
+	// Remove reference to deleted partitions from s.ptwHot
+	if slices.Contains(ptwsToDelete, s.ptwHot) {
+		s.ptwHot = nil
+	}
+
+	return ptwsToDelete
+}
+
 func (s *Storage) updateDeletedPartitionsLocked(ptwsToDelete []*partitionWrapper) {
 	for _, ptw := range ptwsToDelete {
 		if !slices.Contains(s.deletedPartitions, ptw.day) {
@@ -994,6 +1291,18 @@ func (s *Storage) getMaxAllowedDay(now int64) int64 {
 	return (now + s.futureRetention.Nanoseconds()) / nsecsPerDay
 }
 
+// IsTimestampAllowed returns true if logs with the given timestamp in nanoseconds can be added to s.
+//
+// Logs with other timestamps are dropped by MustAddRows because of -retentionPeriod, -futureRetention or -maxBackfillAge.
+func (s *Storage) IsTimestampAllowed(timestamp int64) bool {
+	now := time.Now().UnixNano()
+	day := timestamp / nsecsPerDay
+	if day < s.getMinAllowedDay(now) || day > s.getMaxAllowedDay(now) {
+		return false
+	}
+	return timestamp >= now-s.maxBackfillAge.Nanoseconds()
+}
+
 // MustClose closes s.
 //
 // It is expected that nobody uses the storage at the close time.
@@ -1002,6 +1311,17 @@ func (s *Storage) MustClose() {
 	close(s.stopCh)
 	s.wg.Wait()
 
+	// Release pinned views, so they do not hold references to partitions
+	s.mustUnpinAllViews()
+
+	// Close the write-ahead log. Its segments are removed after all the logs are written to disk parts when closing partitions below.
+	var walPath string
+	if s.wal != nil {
+		s.wal.mustClose()
+		walPath = s.wal.path
+		s.wal = nil
+	}
+
 	// Close partitions
 	for _, pw := range s.partitions {
 		pw.decRef()
@@ -1012,6 +1332,10 @@ func (s *Storage) MustClose() {
 	s.partitions = nil
 	s.ptwHot = nil
 
+	if walPath != "" {
+		mustRemoveWALSegmentsBefore(walPath, math.MaxUint64)
+	}
+
 	// Stop caches
 
 	// Do not persist caches, since they may become out of sync with partitions
@@ -1025,9 +1349,13 @@ func (s *Storage) MustClose() {
 	s.filterStreamCache.MustStop()
 	s.filterStreamCache = nil
 
-	// release lock file
+	// release lock files
 	fs.MustClose(s.flockF)
 	s.flockF = nil
+	for _, f := range s.extraFlockFs {
+		fs.MustClose(f)
+	}
+	s.extraFlockFs = nil
 
 	s.path = ""
 }
@@ -1066,7 +1394,28 @@ func (s *Storage) MustForceMerge(partitionNamePrefix string) {
 //
 // The added rows become visible for search after small duration of time.
 // Call DebugFlush if the added rows must be queried immediately (for example, in tests).
+//
+// If the write-ahead log is enabled via StorageConfig.EnableWAL, then the rows are written to it before being added to s.
 func (s *Storage) MustAddRows(lr *LogRows) {
+	s.rowsIngested.Add(uint64(len(lr.timestamps)))
+
+	w := s.wal
+	if w == nil {
+		s.mustAddRows(lr)
+		return
+	}
+
+	// Prevent from removing the wal segment with lr until lr is added to s.
+	w.rotateLock.RLock()
+	w.mustWriteRows(lr)
+	s.mustAddRows(lr)
+	w.rotateLock.RUnlock()
+}
+
+func (s *Storage) mustAddRows(lr *LogRows) {
+	s.streamsLastSeen.update(lr)
+	s.updateMaxIngestedTimestamp(lr.timestamps)
+
 	// Fast path - try adding all the rows to the hot partition
 	s.partitionsLock.Lock()
 	ptwHot := s.ptwHot
@@ -1149,6 +1498,7 @@ func (s *Storage) MustAddRows(lr *LogRows) {
 var tooSmallTimestampLogger = logger.WithThrottler("too_small_timestamp", 5*time.Second)
 var tooBigTimestampLogger = logger.WithThrottler("too_big_timestamp", 5*time.Second)
 var inactivePartitionLogger = logger.WithThrottler("inactive_partition", 5*time.Second)
+var legalHoldPartitionLogger = logger.WithThrottler("legal_hold_partition", time.Hour)
 
 // TimeFormatter implements fmt.Stringer for timestamp in nanoseconds
 type TimeFormatter int64
@@ -1195,15 +1545,15 @@ func (s *Storage) getPartitionForWriting(day int64) *partitionWrapper {
 		}
 
 		fname := getPartitionNameFromDay(day)
-		partitionPath := filepath.Join(s.path, partitionsDirname, fname)
-		if fs.IsPathExist(partitionPath) {
+		if s.findPartitionPath(fname) != "" {
 			// The partition directory exists. This can happen in the following cases:
 			// - When the partition directory has been manually added, but it wasn't attached yet via Storage.PartitionAttach().
 			// - When the partition has been detached via Storage.PartitionDetach().
 			return nil
 		}
 
-		// Create missing partition.
+		// Create missing partition at the data path with the biggest amount of free disk space.
+		partitionPath := filepath.Join(s.getDataPathForNewPartition(), partitionsDirname, fname)
 		mustCreatePartition(partitionPath)
 		pt := mustOpenPartition(s, partitionPath)
 		ptw = newPartitionWrapper(pt, day)
@@ -1229,7 +1579,7 @@ func (s *Storage) UpdateStats(ss *StorageStats) {
 	if s.maxDiskSpaceUsageBytes > 0 {
 		ss.MaxDiskSpaceUsageBytes = s.maxDiskSpaceUsageBytes
 	} else {
-		ss.MaxDiskSpaceUsageBytes = int64(fs.MustGetTotalSpace(s.path) * uint64(s.maxDiskUsagePercent) / 100)
+		ss.MaxDiskSpaceUsageBytes = int64(s.getTotalDiskSpace() * uint64(s.maxDiskUsagePercent) / 100)
 	}
 	// Use sentinel values to indicate unbounded / no data for consistency
 	ss.MinTimestamp, ss.MaxTimestamp = math.MinInt64, math.MaxInt64
@@ -1250,11 +1600,43 @@ func (s *Storage) UpdateStats(ss *StorageStats) {
 	s.partitionsLock.Unlock()
 
 	ss.IsReadOnly = s.IsReadOnly()
+	ss.RowsIngested += s.rowsIngested.Load()
+	ss.MaxIngestedTimestamp = s.GetMaxIngestedTimestamp()
+	ss.PinnedViewsCount += s.getPinnedViewsCount()
+	if s.wal != nil {
+		ss.WALBytesWritten += s.wal.bytesWritten.Load()
+		ss.WALSyncs += s.wal.syncs.Load()
+	}
+}
+
+func (s *Storage) updateMaxIngestedTimestamp(timestamps []int64) {
+	if len(timestamps) == 0 {
+		return
+	}
+	maxTimestamp := slices.Max(timestamps)
+	maxTimestamp = min(maxTimestamp, time.Now().UnixNano())
+	for {
+		n := s.maxIngestedTimestamp.Load()
+		if maxTimestamp <= n || s.maxIngestedTimestamp.CompareAndSwap(n, maxTimestamp) {
+			return
+		}
+	}
+}
+
+// GetMaxIngestedTimestamp returns the maximum timestamp in nanoseconds for the logs ingested into s since its start.
+//
+// The returned timestamp doesn't exceed the current time. Zero is returned if no logs were ingested since the start.
+//
+// The timestamp can be used for detecting lagging replicas, which didn't receive the recently ingested logs.
+func (s *Storage) GetMaxIngestedTimestamp() int64 {
+	return s.maxIngestedTimestamp.Load()
 }
 
 // IsReadOnly returns true if s is in read-only mode.
+//
+// The storage is in read-only mode if free disk space at any of its data paths drops below StorageConfig.MinFreeDiskSpaceBytes.
 func (s *Storage) IsReadOnly() bool {
-	available := fs.MustGetFreeSpace(s.path)
+	available := s.getMinFreeDiskSpace()
 	return available < s.minFreeDiskSpaceBytes
 }
 
@@ -44,6 +44,22 @@ type QueryContext struct {
 	// Prefix match all the fields starting with the given prefix.
 	HiddenFieldsFilters []string
 
+	// AnnotateRows indicates whether to add _debug_partition and _debug_part fields to the selected logs.
+	//
+	// These fields contain the partition and the part the log entry was read from. They are used for debugging purposes.
+	// vlselect additionally adds _debug_node field with the vlstorage node address in cluster setup.
+	AnnotateRows bool
+
+	// ViewID is an optional id of the view pinned via Storage.PinView.
+	//
+	// If it is set, then the query is executed only over the logs pinned in the given view.
+	ViewID string
+
+	// ReadPreference is an optional preference for choosing vlstorage replicas in cluster setup.
+	//
+	// It is overridden by read_preference query option. Use GetReadPreference for obtaining the effective read preference.
+	ReadPreference string
+
 	// startTime is creation time for the QueryContext.
 	//
 	// It is used for calculating query druation.
@@ -58,17 +74,51 @@ func NewQueryContext(ctx context.Context, qs *QueryStats, tenantIDs []TenantID,
 
 // WithQuery returns new QueryContext with the given q, while preserving other fields from qctx.
 func (qctx *QueryContext) WithQuery(q *Query) *QueryContext {
-	return newQueryContext(qctx.Context, qctx.QueryStats, qctx.TenantIDs, q, qctx.AllowPartialResponse, qctx.HiddenFieldsFilters, qctx.startTime)
+	return qctx.withContextAndQuery(qctx.Context, q)
 }
 
 // WithContext returns new QueryContext with the given ctx, while preserving other fields from qctx.
 func (qctx *QueryContext) WithContext(ctx context.Context) *QueryContext {
-	return newQueryContext(ctx, qctx.QueryStats, qctx.TenantIDs, qctx.Query, qctx.AllowPartialResponse, qctx.HiddenFieldsFilters, qctx.startTime)
+	return qctx.withContextAndQuery(ctx, qctx.Query)
 }
 
 // WithContextAndQuery returns new QueryContext with the given ctx and q, while preserving other fields from qctx.
 func (qctx *QueryContext) WithContextAndQuery(ctx context.Context, q *Query) *QueryContext {
-	return newQueryContext(ctx, qctx.QueryStats, qctx.TenantIDs, q, qctx.AllowPartialResponse, qctx.HiddenFieldsFilters, qctx.startTime)
+	return qctx.withContextAndQuery(ctx, q)
+}
+
+func (qctx *QueryContext) withContextAndQuery(ctx context.Context, q *Query) *QueryContext {
+	qctxNew := newQueryContext(ctx, qctx.QueryStats, qctx.TenantIDs, q, qctx.AllowPartialResponse, qctx.HiddenFieldsFilters, qctx.startTime)
+	qctxNew.AnnotateRows = qctx.AnnotateRows
+	qctxNew.ViewID = qctx.ViewID
+	qctxNew.ReadPreference = qctx.ReadPreference
+	return qctxNew
+}
+
+// GetReadPreference returns the read preference for the given qctx.
+//
+// The read_preference query option takes precedence over qctx.ReadPreference.
+func (qctx *QueryContext) GetReadPreference() string {
+	if qctx.Query != nil && qctx.Query.opts.readPreference != "" {
+		return qctx.Query.opts.readPreference
+	}
+	return qctx.ReadPreference
+}
+
+// IsValidReadPreference returns true if s is a valid read preference for querying vlstorage replicas in cluster setup.
+//
+// Supported values:
+//
+//   - "" and "any" - query replicas in the order they are specified in -storageNode
+//   - "freshest" - query only replicas, which aren't lagging behind the freshest replica
+//   - "zone-local" - query replicas from the same zone as vlselect at first
+func IsValidReadPreference(s string) bool {
+	switch s {
+	case "", "any", "freshest", "zone-local":
+		return true
+	default:
+		return false
+	}
 }
 
 // QueryDurationNsecs returns the duration in nanoseconds since the NewQueryContext call.
@@ -128,6 +178,15 @@ type storageSearchOptions struct {
 
 	// timeOffset is the offset in nanoseconds, which must be subtracted from the selected the _time values before these values are passed to query pipes.
 	timeOffset int64
+
+	// timeRangePruner is an optional pruner for time ranges, which cannot change the query results.
+	timeRangePruner *searchTimeRangePruner
+
+	// annotateRows indicates whether to add _debug_partition and _debug_part fields to the selected logs.
+	annotateRows bool
+
+	// pinnedView is an optional view pinned via Storage.PinView. If it is set, then the search is performed only over the pinned parts.
+	pinnedView *pinnedView
 }
 
 // partitionSearchOptions is search options for the partition.
@@ -156,6 +215,12 @@ type partitionSearchOptions struct {
 
 	// hiddenFieldsFilter is the filter of fields, which must be hidden during query
 	hiddenFieldsFilter *prefixfilter.Filter
+
+	// timeRangePruner is an optional pruner for time ranges, which cannot change the query results.
+	timeRangePruner *searchTimeRangePruner
+
+	// pinnedView is an optional view pinned via Storage.PinView. If it is set, then the search is performed only over the pinned parts.
+	pinnedView *pinnedView
 }
 
 func (pso *partitionSearchOptions) matchStreamID(sid *streamID) bool {
@@ -221,10 +286,28 @@ func (s *Storage) runQuery(qctx *QueryContext, writeBlock writeBlockResultFunc)
 	q := qNew
 
 	sso := s.getSearchOptions(qctx.TenantIDs, q, qctx.HiddenFieldsFilters)
+	sso.annotateRows = qctx.AnnotateRows
+	if qctx.ViewID != "" {
+		pv, pvDecRef, err := s.acquirePinnedView(qctx.ViewID)
+		if err != nil {
+			return err
+		}
+		defer pvDecRef()
+		sso.pinnedView = pv
+	}
 
-	search := func(stopCh <-chan struct{}, writeBlockToPipes writeBlockResultFunc) error {
+	search := func(stopCh <-chan struct{}, writeBlockToPipes writeBlockResultFunc, trp timeRangePruner) error {
+		ssoLocal := sso
+		if trp != nil {
+			ssoCopy := *sso
+			ssoCopy.timeRangePruner = &searchTimeRangePruner{
+				trp:        trp,
+				timeOffset: sso.timeOffset,
+			}
+			ssoLocal = &ssoCopy
+		}
 		workersCount := q.GetParallelReaders(s.defaultParallelReaders)
-		s.searchParallel(workersCount, sso, qctx.QueryStats, stopCh, writeBlockToPipes)
+		s.searchParallel(workersCount, ssoLocal, qctx.QueryStats, stopCh, writeBlockToPipes)
 		return nil
 	}
 
@@ -264,7 +347,62 @@ func (s *Storage) getSearchOptions(tenantIDs []TenantID, q *Query, hiddenFieldsF
 }
 
 // searchFunc must perform search and pass its results to writeBlock.
-type searchFunc func(stopCh <-chan struct{}, writeBlock writeBlockResultFunc) error
+//
+// If trp isn't nil, then the search may skip logs on time ranges, which cannot change the results according to trp.
+type searchFunc func(stopCh <-chan struct{}, writeBlock writeBlockResultFunc, trp timeRangePruner) error
+
+// timeRangePruner is an optional interface, which can be implemented by pipeProcessor.
+//
+// It is used for skipping partitions, parts and blocks, which cannot change the results of the first pipe in the query.
+type timeRangePruner interface {
+	// canSkipTimeRange must return true if logs on the [minTimestamp, maxTimestamp] time range cannot change the pipe results.
+	//
+	// It is called concurrently from multiple goroutines.
+	canSkipTimeRange(minTimestamp, maxTimestamp int64) bool
+
+	// preferNewerLogs must return true if newer logs are more likely to be included in the pipe results than older logs.
+	//
+	// In this case the search is performed from newer to older partitions, so canSkipTimeRange starts returning true earlier.
+	preferNewerLogs() bool
+}
+
+// getTimeRangePruner returns timeRangePruner for the given pp.
+//
+// nil is returned if pp doesn't support time range pruning.
+func getTimeRangePruner(pp pipeProcessor) timeRangePruner {
+	trp, ok := pp.(timeRangePruner)
+	if !ok {
+		return nil
+	}
+	if ptp, ok := pp.(*pipeTopkProcessor); ok && !ptp.canPruneTimeRanges() {
+		return nil
+	}
+	return trp
+}
+
+// searchTimeRangePruner skips time ranges, which cannot change the query results, during the search.
+type searchTimeRangePruner struct {
+	trp timeRangePruner
+
+	// timeOffset is the offset in nanoseconds, which must be subtracted from the stored timestamps before passing them to trp.
+	timeOffset int64
+}
+
+// canSkipTimeRange returns true if logs on the [minTimestamp, maxTimestamp] time range can be skipped during the search.
+//
+// minTimestamp and maxTimestamp must contain timestamps as stored in the storage.
+func (stp *searchTimeRangePruner) canSkipTimeRange(minTimestamp, maxTimestamp int64) bool {
+	if stp == nil {
+		return false
+	}
+	minTimestamp = subNoOverflowInt64(minTimestamp, stp.timeOffset)
+	maxTimestamp = subNoOverflowInt64(maxTimestamp, stp.timeOffset)
+	return stp.trp.canSkipTimeRange(minTimestamp, maxTimestamp)
+}
+
+func (stp *searchTimeRangePruner) preferNewerLogs() bool {
+	return stp != nil && stp.trp.preferNewerLogs()
+}
 
 func runPipes(qctx *QueryContext, pipes []pipe, search searchFunc, writeBlock writeBlockResultFunc, concurrency int) error {
 	ctx, topCancel := context.WithCancel(qctx.Context)
@@ -273,7 +411,7 @@ func runPipes(qctx *QueryContext, pipes []pipe, search searchFunc, writeBlock wr
 	stopCh := ctx.Done()
 	if len(pipes) == 0 {
 		// Fast path when there are no pipes
-		return search(stopCh, writeBlock)
+		return search(stopCh, writeBlock, nil)
 	}
 
 	pp := newNoopPipeProcessor(stopCh, writeBlock)
@@ -292,7 +430,11 @@ func runPipes(qctx *QueryContext, pipes []pipe, search searchFunc, writeBlock wr
 		ctx = ctxChild
 	}
 
-	errSearch := search(stopCh, pp.writeBlock)
+	// The first pipe receives logs directly from the search, so it may prune time ranges,
+	// which cannot change its results.
+	trp := getTimeRangePruner(pp)
+
+	errSearch := search(stopCh, pp.writeBlock, trp)
 	if errSearch != nil {
 		// Cancel the whole query in order to free up resources occupied by pipes.
 		topCancel()
@@ -773,6 +915,10 @@ func initSubqueries(qctx *QueryContext, runQuery runQueryFunc, keepInSubquery bo
 	if err != nil {
 		return nil, fmt.Errorf("cannot initialize `join` subqueries: %w", err)
 	}
+	qNew, err = initComparePipes(qNew, getJoinMap)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize `compare` pipes: %w", err)
+	}
 
 	runUnionQuery := func(ctx context.Context, q *Query, writeBlock writeBlockResultFunc) error {
 		qctxLocal := qctx.WithContextAndQuery(ctx, q)
@@ -1296,6 +1442,13 @@ func (s *Storage) searchParallel(workersCount int, sso *storageSearchOptions, qs
 						continue
 					}
 
+					th := &bsw.bh.timestampsHeader
+					if sso.timeRangePruner.canSkipTimeRange(th.minTimestamp, th.maxTimestamp) {
+						// The block cannot change the query results.
+						bsw.reset()
+						continue
+					}
+
 					rowsProcessed := bsw.bh.rowsCount
 
 					bs.search(qsLocal, bsw, bm)
@@ -1303,6 +1456,9 @@ func (s *Storage) searchParallel(workersCount int, sso *storageSearchOptions, qs
 						if sso.timeOffset != 0 {
 							bs.subTimeOffsetToTimestamps(sso.timeOffset)
 						}
+						if sso.annotateRows {
+							bs.br.addDebugColumns(bsw.p)
+						}
 						writeBlock(workerID, &bs.br)
 					}
 					bsw.reset()
@@ -1313,24 +1469,49 @@ func (s *Storage) searchParallel(workersCount int, sso *storageSearchOptions, qs
 				}
 				bswb.bsws = bswb.bsws[:0]
 				putBlockSearchWorkBatch(bswb)
+
+				// Update qs after every processed batch, so the query stats can be tracked while the query is executed.
+				// See https://docs.victoriametrics.com/victorialogs/querying/#active-queries
+				qs.UpdateAtomic(qsLocal)
+				*qsLocal = QueryStats{}
 			}
 
 			putBlockSearch(bs)
 			putBitmap(bm)
-			qs.UpdateAtomic(qsLocal)
 
 		}(uint(workerID))
 	}
 
 	// Select partitions according to the selected time range
-	ptws, ptwsDecRef := s.getPartitionsForTimeRange(sso.minTimestamp, sso.maxTimestamp)
-	defer ptwsDecRef()
+	var ptws []*partitionWrapper
+	if sso.pinnedView != nil {
+		// The pinned partitions are referenced by sso.pinnedView until the search is finished.
+		ptws = sso.pinnedView.getPartitionsForTimeRange(sso.minTimestamp, sso.maxTimestamp)
+	} else {
+		var ptwsDecRef func()
+		ptws, ptwsDecRef = s.getPartitionsForTimeRange(sso.minTimestamp, sso.maxTimestamp)
+		defer ptwsDecRef()
+	}
+
+	if sso.timeRangePruner.preferNewerLogs() {
+		// Search newer partitions at first, so older partitions can be skipped via sso.timeRangePruner.
+		ptws = slices.Clone(ptws)
+		slices.Reverse(ptws)
+	}
 
 	// Schedule concurrent search across matching partitions.
 	psfs := make([]partitionSearchFinalizer, len(ptws))
 	var wgSearchers sync.WaitGroup
 	for i, ptw := range ptws {
 		partitionSearchConcurrencyLimitCh <- struct{}{}
+		minTimestamp := ptw.day * nsecsPerDay
+		maxTimestamp := minTimestamp + nsecsPerDay - 1
+		if sso.timeRangePruner.canSkipTimeRange(minTimestamp, maxTimestamp) {
+			// The partition cannot change the query results.
+			psfs[i] = func() {}
+			<-partitionSearchConcurrencyLimitCh
+			continue
+		}
 		wgSearchers.Add(1)
 		go func(idx int, pt *partition) {
 			qsLocal := &QueryStats{}
@@ -1436,6 +1617,8 @@ func (pt *partition) getSearchOptions(sso *storageSearchOptions) *partitionSearc
 		filter:             f,
 		fieldsFilter:       sso.fieldsFilter,
 		hiddenFieldsFilter: sso.hiddenFieldsFilter,
+		timeRangePruner:    sso.timeRangePruner,
+		pinnedView:         sso.pinnedView,
 	}
 }
 
@@ -1499,15 +1682,42 @@ func initStreamFilters(tenantIDs []TenantID, idb *indexdb, f filter) filter {
 }
 
 func (ddb *datadb) search(pso *partitionSearchOptions, qs *QueryStats, workCh chan<- *blockSearchWorkBatch, stopCh <-chan struct{}) partitionSearchFinalizer {
+	if pso.pinnedView != nil {
+		// Search only the pinned parts. They are referenced by pso.pinnedView until the search is finished.
+		pws := pso.pinnedView.getPartsForTimeRange(ddb, pso.minTimestamp, pso.maxTimestamp)
+		searchParts(pws, pso, qs, workCh, stopCh)
+		return func() {}
+	}
+
 	// Select parts with data for the given time range
 	pws, pwsDecRef := ddb.getPartsForTimeRange(pso.minTimestamp, pso.maxTimestamp)
 
+	// Add parts for the recently ingested rows, which aren't flushed to in-memory parts yet.
+	// This makes these rows visible for queries without waiting for the flush.
+	//
+	// The recent parts must be obtained after the remaining parts. Otherwise the same rows could be returned twice
+	// if they are flushed between obtaining the recent parts and the remaining parts.
+	recentPws, recentPwsDecRef := ddb.getRecentPartsForTimeRange(pso.minTimestamp, pso.maxTimestamp)
+	pws = append(pws, recentPws...)
+
+	searchParts(pws, pso, qs, workCh, stopCh)
+
+	return func() {
+		pwsDecRef()
+		recentPwsDecRef()
+	}
+}
+
+func searchParts(pws []*partWrapper, pso *partitionSearchOptions, qs *QueryStats, workCh chan<- *blockSearchWorkBatch, stopCh <-chan struct{}) {
 	// Apply search to matching parts
 	for _, pw := range pws {
+		ph := &pw.p.ph
+		if pso.timeRangePruner.canSkipTimeRange(ph.MinTimestamp, ph.MaxTimestamp) {
+			// The part cannot change the query results.
+			continue
+		}
 		pw.p.search(pso, qs, workCh, stopCh)
 	}
-
-	return pwsDecRef
 }
 
 // getPartsForTimeRange returns ddb parts for the given time range.
@@ -1533,12 +1743,41 @@ func (ddb *datadb) getPartsForTimeRange(minTimestamp, maxTimestamp int64) (pws [
 	return pws, pwsDecRef
 }
 
+// getRecentPartsForTimeRange returns in-memory parts for the rows in ddb, which aren't flushed to in-memory parts yet.
+//
+// The caller must call pwsDecRef on the returned parts when they are no longer needed.
+func (ddb *datadb) getRecentPartsForTimeRange(minTimestamp, maxTimestamp int64) (pws []*partWrapper, pwsDecRef func()) {
+	pwsAll := ddb.rb.appendRecentParts(nil, ddb.mustCreateInmemoryPart)
+	for _, pw := range pwsAll {
+		ph := &pw.p.ph
+		if ph.MinTimestamp > maxTimestamp || ph.MaxTimestamp < minTimestamp {
+			pw.decRef()
+			continue
+		}
+		pws = append(pws, pw)
+	}
+
+	pwsDecRef = func() {
+		for _, pw := range pws {
+			pw.decRef()
+		}
+	}
+
+	return pws, pwsDecRef
+}
+
 func (p *part) search(pso *partitionSearchOptions, qs *QueryStats, workCh chan<- *blockSearchWorkBatch, stopCh <-chan struct{}) {
+	ibhIdxs := p.getIndexBlockIdxsForFilter(pso.filter, qs)
+	if ibhIdxs != nil && len(ibhIdxs) == 0 {
+		// Fast path - the field index guarantees that the part has no matching logs.
+		return
+	}
+
 	bhss := getBlockHeaders()
 	if len(pso.tenantIDs) > 0 {
-		p.searchByTenantIDs(pso, qs, bhss, workCh, stopCh)
+		p.searchByTenantIDs(pso, qs, bhss, ibhIdxs, workCh, stopCh)
 	} else {
-		p.searchByStreamIDs(pso, qs, bhss, workCh, stopCh)
+		p.searchByStreamIDs(pso, qs, bhss, ibhIdxs, workCh, stopCh)
 	}
 	putBlockHeaders(bhss)
 }
@@ -1621,7 +1860,7 @@ func (bhss *blockHeaders) reset() {
 	bhss.bhs = bhs[:0]
 }
 
-func (p *part) searchByTenantIDs(pso *partitionSearchOptions, qs *QueryStats, bhss *blockHeaders, workCh chan<- *blockSearchWorkBatch, stopCh <-chan struct{}) {
+func (p *part) searchByTenantIDs(pso *partitionSearchOptions, qs *QueryStats, bhss *blockHeaders, ibhIdxs map[uint32]struct{}, workCh chan<- *blockSearchWorkBatch, stopCh <-chan struct{}) {
 	// it is assumed that tenantIDs are sorted
 	tenantIDs := pso.tenantIDs
 
@@ -1677,6 +1916,17 @@ func (p *part) searchByTenantIDs(pso *partitionSearchOptions, qs *QueryStats, bh
 			// Skip the ibh, since it doesn't contain entries on the requested time range
 			continue
 		}
+		if pso.timeRangePruner.canSkipTimeRange(ibh.minTimestamp, ibh.maxTimestamp) {
+			// Skip the ibh, since it cannot change the query results
+			continue
+		}
+		if ibhIdxs != nil {
+			ibhIdx := uint32(len(p.indexBlockHeaders) - len(ibhs) - 1)
+			if _, ok := ibhIdxs[ibhIdx]; !ok {
+				// Skip the ibh, since the field index guarantees it has no matching logs
+				continue
+			}
+		}
 
 		bhss.bhs = ibh.mustReadBlockHeaders(bhss.bhs[:0], p, qs)
 
@@ -1694,6 +1944,9 @@ func (p *part) searchByTenantIDs(pso *partitionSearchOptions, qs *QueryStats, bh
 				if pso.minTimestamp > th.maxTimestamp || pso.maxTimestamp < th.minTimestamp {
 					continue
 				}
+				if pso.timeRangePruner.canSkipTimeRange(th.minTimestamp, th.maxTimestamp) {
+					continue
+				}
 				if !scheduleBlockSearch(bh) {
 					return
 				}
@@ -1723,7 +1976,7 @@ func (p *part) searchByTenantIDs(pso *partitionSearchOptions, qs *QueryStats, bh
 	}
 }
 
-func (p *part) searchByStreamIDs(pso *partitionSearchOptions, qs *QueryStats, bhss *blockHeaders, workCh chan<- *blockSearchWorkBatch, stopCh <-chan struct{}) {
+func (p *part) searchByStreamIDs(pso *partitionSearchOptions, qs *QueryStats, bhss *blockHeaders, ibhIdxs map[uint32]struct{}, workCh chan<- *blockSearchWorkBatch, stopCh <-chan struct{}) {
 	// it is assumed that streamIDs are sorted
 	streamIDs := pso.streamIDs
 
@@ -1780,6 +2033,17 @@ func (p *part) searchByStreamIDs(pso *partitionSearchOptions, qs *QueryStats, bh
 			// Skip the ibh, since it doesn't contain entries on the requested time range
 			continue
 		}
+		if pso.timeRangePruner.canSkipTimeRange(ibh.minTimestamp, ibh.maxTimestamp) {
+			// Skip the ibh, since it cannot change the query results
+			continue
+		}
+		if ibhIdxs != nil {
+			ibhIdx := uint32(len(p.indexBlockHeaders) - len(ibhs) - 1)
+			if _, ok := ibhIdxs[ibhIdx]; !ok {
+				// Skip the ibh, since the field index guarantees it has no matching logs
+				continue
+			}
+		}
 
 		bhss.bhs = ibh.mustReadBlockHeaders(bhss.bhs[:0], p, qs)
 
@@ -1797,6 +2061,9 @@ func (p *part) searchByStreamIDs(pso *partitionSearchOptions, qs *QueryStats, bh
 				if pso.minTimestamp > th.maxTimestamp || pso.maxTimestamp < th.minTimestamp {
 					continue
 				}
+				if pso.timeRangePruner.canSkipTimeRange(th.minTimestamp, th.maxTimestamp) {
+					continue
+				}
 				if !scheduleBlockSearch(bh) {
 					return
 				}
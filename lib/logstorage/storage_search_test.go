@@ -160,6 +160,41 @@ func TestStorageRunQuery(t *testing.T) {
 			}
 		}
 	})
+	t.Run("annotate-rows", func(t *testing.T) {
+		q := mustParseQuery(`* | stats by (_debug_partition) count() rows, count_empty(_debug_part) rows_without_part`)
+		qctx := newTestQueryContext(allTenantIDs, q)
+		qctx.AnnotateRows = true
+
+		var resultRowsLock sync.Mutex
+		var resultRows [][]Field
+		writeBlock := func(_ uint, db *DataBlock) {
+			for i := 0; i < db.RowsCount(); i++ {
+				row := make([]Field, len(db.Columns))
+				for j, bc := range db.Columns {
+					row[j] = Field{
+						Name:  strings.Clone(bc.Name),
+						Value: strings.Clone(bc.Values[i]),
+					}
+				}
+				resultRowsLock.Lock()
+				resultRows = append(resultRows, row)
+				resultRowsLock.Unlock()
+			}
+		}
+		if err := s.RunQuery(qctx, writeBlock); err != nil {
+			t.Fatalf("unexpected error returned from the query [%s]: %s", q, err)
+		}
+
+		partitionName := time.Unix(0, baseTimestamp).UTC().Format(partitionNameFormat)
+		rowsExpected := [][]Field{
+			{
+				{"_debug_partition", partitionName},
+				{"rows", "1155"},
+				{"rows_without_part", "0"},
+			},
+		}
+		assertRowsEqual(t, resultRows, rowsExpected)
+	})
 	t.Run("matching-multiple-tenant-ids", func(t *testing.T) {
 		q := mustParseQuery(`"log message"`)
 		var rowsCountTotal atomic.Uint32
@@ -1564,3 +1599,216 @@ func newTestQueryContext(tenantIDs []TenantID, q *Query) *QueryContext {
 	qs := &QueryStats{}
 	return NewQueryContext(context.Background(), qs, tenantIDs, q, false, nil)
 }
+
+func TestStorageRunQueryTimeRangePruning(t *testing.T) {
+	t.Parallel()
+
+	tenantIDs := []TenantID{
+		{
+			AccountID: 123,
+			ProjectID: 456,
+		},
+	}
+
+	path := t.Name()
+
+	cfg := &StorageConfig{
+		Retention: 30 * 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	// Store logs for 7 days, so every day is stored in a separate partition.
+	now := time.Now().UnixNano() / nsecsPerDay * nsecsPerDay
+	lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+	for dayID := 0; dayID < 7; dayID++ {
+		for rowID := 0; rowID < 100; rowID++ {
+			for streamID := 0; streamID < 5; streamID++ {
+				fields := []Field{
+					{
+						Name:  "host",
+						Value: fmt.Sprintf("host-%d", streamID),
+					},
+					{
+						Name:  "_msg",
+						Value: fmt.Sprintf("day=%d row=%d stream=%d", dayID, rowID, streamID),
+					},
+				}
+				timestamp := now - int64(dayID)*nsecsPerDay + int64(rowID*5+streamID)*1e9
+				lr.mustAdd(tenantIDs[0], timestamp, fields)
+			}
+		}
+	}
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	runQuery := func(qStr string) ([]string, uint64) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("cannot parse query %q: %s", qStr, err)
+		}
+		var qs QueryStats
+		qctx := NewQueryContext(t.Context(), &qs, tenantIDs, q, false, nil)
+
+		var rows []string
+		var rowsLock sync.Mutex
+		writeBlock := func(_ uint, db *DataBlock) {
+			rowsLock.Lock()
+			defer rowsLock.Unlock()
+			for _, c := range db.Columns {
+				if c.Name == "_msg" {
+					rows = append(rows, c.Values...)
+				}
+			}
+		}
+		if err := s.RunQuery(qctx, writeBlock); err != nil {
+			t.Fatalf("unexpected error in query %q: %s", qStr, err)
+		}
+		return rows, qs.BlocksProcessed
+	}
+
+	_, blocksTotal := runQuery(`* | count()`)
+
+	f := func(qStr string, rowsExpected []string) {
+		t.Helper()
+
+		rows, blocksProcessed := runQuery(qStr)
+		if !reflect.DeepEqual(rows, rowsExpected) {
+			t.Fatalf("unexpected rows for query %q\ngot\n%q\nwant\n%q", qStr, rows, rowsExpected)
+		}
+		if blocksProcessed >= blocksTotal {
+			t.Fatalf("expecting less than %d blocks to be processed for query %q; got %d blocks", blocksTotal, qStr, blocksProcessed)
+		}
+	}
+
+	// the newest logs
+	f(`* | sort by (_time desc) limit 3 | fields _msg`, []string{
+		"day=0 row=99 stream=4",
+		"day=0 row=99 stream=3",
+		"day=0 row=99 stream=2",
+	})
+	f(`* | sort by (_time) desc offset 1 limit 2 | fields _msg`, []string{
+		"day=0 row=99 stream=3",
+		"day=0 row=99 stream=2",
+	})
+	f(`* | last 2 by (_time) | fields _msg`, []string{
+		"day=0 row=99 stream=4",
+		"day=0 row=99 stream=3",
+	})
+
+	// the oldest logs
+	f(`* | sort by (_time) limit 2 | fields _msg`, []string{
+		"day=6 row=0 stream=0",
+		"day=6 row=0 stream=1",
+	})
+	f(`* | first 2 by (_time) | fields _msg`, []string{
+		"day=6 row=0 stream=0",
+		"day=6 row=0 stream=1",
+	})
+
+	// time range pruning isn't applied to sorting with partitions
+	rows, blocksProcessed := runQuery(`* | sort by (_time desc) partition by (host) limit 1 | sort by (_msg) | fields _msg`)
+	rowsExpected := []string{
+		"day=0 row=99 stream=0",
+		"day=0 row=99 stream=1",
+		"day=0 row=99 stream=2",
+		"day=0 row=99 stream=3",
+		"day=0 row=99 stream=4",
+	}
+	if !reflect.DeepEqual(rows, rowsExpected) {
+		t.Fatalf("unexpected rows\ngot\n%q\nwant\n%q", rows, rowsExpected)
+	}
+	if blocksProcessed != blocksTotal {
+		t.Fatalf("unexpected number of processed blocks; got %d; want %d", blocksProcessed, blocksTotal)
+	}
+
+	s.MustClose()
+
+	fs.MustRemoveDir(path)
+}
+
+func TestStorageRunQueryRecentRows(t *testing.T) {
+	t.Parallel()
+
+	tenantIDs := []TenantID{
+		{
+			AccountID: 123,
+			ProjectID: 456,
+		},
+	}
+
+	path := t.Name()
+
+	cfg := &StorageConfig{
+		Retention: 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	addRows := func(start, end int) {
+		t.Helper()
+
+		now := time.Now().UnixNano()
+		lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+		for i := start; i < end; i++ {
+			fields := []Field{
+				{
+					Name:  "host",
+					Value: fmt.Sprintf("host-%d", i%3),
+				},
+				{
+					Name:  "_msg",
+					Value: fmt.Sprintf("row=%d", i),
+				},
+			}
+			lr.mustAdd(tenantIDs[0], now, fields)
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+	}
+
+	getRowsCount := func() string {
+		t.Helper()
+
+		q, err := ParseQuery(`_time:1h | count() rows`)
+		if err != nil {
+			t.Fatalf("cannot parse query: %s", err)
+		}
+		var qs QueryStats
+		qctx := NewQueryContext(t.Context(), &qs, tenantIDs, q, false, nil)
+
+		var result string
+		writeBlock := func(_ uint, db *DataBlock) {
+			for _, c := range db.Columns {
+				if c.Name == "rows" && len(c.Values) > 0 {
+					result = c.Values[0]
+				}
+			}
+		}
+		if err := s.RunQuery(qctx, writeBlock); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return result
+	}
+
+	// The recently ingested rows must be visible without flushing them
+	addRows(0, 100)
+	if n := getRowsCount(); n != "100" {
+		t.Fatalf("unexpected number of rows before the flush; got %s; want 100", n)
+	}
+
+	addRows(100, 150)
+	if n := getRowsCount(); n != "150" {
+		t.Fatalf("unexpected number of rows before the flush; got %s; want 150", n)
+	}
+
+	// The rows mustn't be duplicated after the flush
+	s.DebugFlush()
+	if n := getRowsCount(); n != "150" {
+		t.Fatalf("unexpected number of rows after the flush; got %s; want 150", n)
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
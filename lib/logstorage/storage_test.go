@@ -110,6 +110,93 @@ func TestStorageMustAddRows(t *testing.T) {
 	fs.MustRemoveDir(path)
 }
 
+func TestStorageIsTimestampAllowed(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	cfg := &StorageConfig{
+		Retention:       7 * 24 * time.Hour,
+		FutureRetention: 2 * 24 * time.Hour,
+		MaxBackfillAge:  time.Hour,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	f := func(timestamp int64, resultExpected bool) {
+		t.Helper()
+
+		if result := s.IsTimestampAllowed(timestamp); result != resultExpected {
+			t.Fatalf("unexpected result for timestamp %d; got %v; want %v", timestamp, result, resultExpected)
+		}
+	}
+
+	now := time.Now().UnixNano()
+	f(now, true)
+	f(now-time.Minute.Nanoseconds(), true)
+	f(now+24*time.Hour.Nanoseconds(), true)
+
+	// too big timestamps
+	f(now+4*24*time.Hour.Nanoseconds(), false)
+
+	// too small timestamps
+	f(now-2*time.Hour.Nanoseconds(), false)
+	f(now-30*24*time.Hour.Nanoseconds(), false)
+	f(0, false)
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
+
+func TestStorageGetMaxIngestedTimestamp(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	cfg := &StorageConfig{
+		FutureRetention: 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	if ts := s.GetMaxIngestedTimestamp(); ts != 0 {
+		t.Fatalf("unexpected max ingested timestamp for empty storage; got %d; want 0", ts)
+	}
+
+	now := time.Now().UnixNano()
+	lr := newTestLogRows(1, 3, 0)
+	lr.timestamps[0] = now - 2*int64(time.Hour)
+	lr.timestamps[1] = now - int64(time.Hour)
+	lr.timestamps[2] = now - 3*int64(time.Hour)
+	s.MustAddRows(lr)
+	if ts := s.GetMaxIngestedTimestamp(); ts != now-int64(time.Hour) {
+		t.Fatalf("unexpected max ingested timestamp; got %d; want %d", ts, now-int64(time.Hour))
+	}
+
+	// Older logs do not change the max ingested timestamp
+	lr = newTestLogRows(1, 1, 0)
+	lr.timestamps[0] = now - 5*int64(time.Hour)
+	s.MustAddRows(lr)
+	if ts := s.GetMaxIngestedTimestamp(); ts != now-int64(time.Hour) {
+		t.Fatalf("unexpected max ingested timestamp; got %d; want %d", ts, now-int64(time.Hour))
+	}
+
+	// Logs with timestamps in the future are limited by the current time
+	lr = newTestLogRows(1, 1, 0)
+	lr.timestamps[0] = now + 5*int64(time.Hour)
+	s.MustAddRows(lr)
+	if ts := s.GetMaxIngestedTimestamp(); ts < now || ts > time.Now().UnixNano() {
+		t.Fatalf("unexpected max ingested timestamp for logs in the future; got %d; want value in the range [%d..now]", ts, now)
+	}
+
+	var ss StorageStats
+	s.UpdateStats(&ss)
+	if ss.RowsIngested != 5 {
+		t.Fatalf("unexpected number of ingested rows; got %d; want 5", ss.RowsIngested)
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
+
 func TestStorageDeleteTaskOps(t *testing.T) {
 	t.Parallel()
 
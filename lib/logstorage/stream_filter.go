@@ -102,6 +102,21 @@ func (tf *streamTagFilter) String() string {
 	return quoteTokenIfNeeded(tf.tagName) + tf.op + strconv.Quote(tf.value)
 }
 
+// ParseStreamFilter parses stream filter from s in the form `{...}`.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#stream-filter
+func ParseStreamFilter(s string) (*StreamFilter, error) {
+	lex := newLexer(s, 0)
+	sf, err := parseStreamFilter(lex)
+	if err != nil {
+		return nil, err
+	}
+	if !lex.isEnd() {
+		return nil, fmt.Errorf("unexpected tail after stream filter %s: [%s]", sf, lex.rawToken+lex.s)
+	}
+	return sf, nil
+}
+
 func parseStreamFilter(lex *lexer) (*StreamFilter, error) {
 	if !lex.isKeyword("{") {
 		return nil, fmt.Errorf("unexpected token %q instead of '{' in _stream filter", lex.token)
@@ -225,6 +225,43 @@ func mustNewTestStreamFilter(s string) *StreamFilter {
 	return sf
 }
 
+func TestParseStreamFilter(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+		sf, err := ParseStreamFilter(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := sf.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected StreamFilter; got %s; want %s", result, resultExpected)
+		}
+	}
+
+	f(`{foo="bar"}`, `{foo="bar"}`)
+	f(` { app = "nginx" , env="prod" } `, `{app="nginx",env="prod"}`)
+	f(`{a="b" or c=~"d.+"}`, `{a="b" or c=~"d.+"}`)
+}
+
+func TestParseStreamFilterFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		sf, err := ParseStreamFilter(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if sf != nil {
+			t.Fatalf("expecting nil sf; got %v", sf)
+		}
+	}
+
+	f("")
+	f("foo")
+	f("_stream:{foo=\"bar\"}")
+	f("{foo=\"bar\"} baz")
+	f("{foo=\"bar\"} or {baz=\"x\"}")
+}
+
 func newTestStreamFilter(s string) (*StreamFilter, error) {
 	lex := newLexer(s, 0)
 	fs, err := parseFilterStream(lex, "")
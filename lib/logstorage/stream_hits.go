@@ -0,0 +1,429 @@
+package logstorage
+
+import (
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// streamHitsBucketNsecs is the duration of the time bucket for per-stream hits stored in parts.
+const streamHitsBucketNsecs = nsecsPerMinute
+
+// maxStreamHitsChunkSize is the maximum size of the uncompressed chunk with per-stream hits.
+const maxStreamHitsChunkSize = 64 * 1024
+
+// streamHitsBuilder builds per-minute hits per each stream written to the part.
+//
+// The hits are written to streamHitsFilename and are used for answering /select/logsql/hits queries without scanning the stored logs.
+//
+// The file consists of zstd-compressed chunks. Every chunk is prefixed with its compressed size
+// and contains a sequence of (streamID, minutesCount, [(minuteDelta, hits)...]) entries.
+//
+// The file is left empty if the builder isn't enabled.
+type streamHitsBuilder struct {
+	// enabled must be set to true in order to build per-stream hits.
+	enabled bool
+
+	// sid is the stream for the collected minutes and hits.
+	sid streamID
+
+	// minutes and hits contain per-minute hits for the sid.
+	minutes []int64
+	hits    []uint64
+
+	// chunk contains the uncompressed chunk, which isn't written yet.
+	chunk []byte
+
+	// compressedChunk is a buffer for the compressed chunk.
+	compressedChunk []byte
+
+	// timestamps is a buffer for timestamps decoded from blockData.
+	timestamps []int64
+}
+
+func (shb *streamHitsBuilder) reset() {
+	shb.enabled = false
+	shb.sid.reset()
+	shb.minutes = shb.minutes[:0]
+	shb.hits = shb.hits[:0]
+
+	if cap(shb.chunk) > 4*maxStreamHitsChunkSize {
+		// Drop too big buffers in order to conserve memory.
+		shb.chunk = nil
+		shb.compressedChunk = nil
+	} else {
+		shb.chunk = shb.chunk[:0]
+		shb.compressedChunk = shb.compressedChunk[:0]
+	}
+	shb.timestamps = shb.timestamps[:0]
+}
+
+// addBlock registers rows from either b or bd for the given sid.
+//
+// Blocks must be added in the order they are written to the part.
+func (shb *streamHitsBuilder) addBlock(sid *streamID, b *block, bd *blockData, w *writerWithStats) {
+	if !shb.enabled {
+		return
+	}
+
+	if !sid.equal(&shb.sid) {
+		shb.flushStream(w)
+		shb.sid = *sid
+	}
+
+	if b != nil {
+		shb.addTimestamps(b.timestamps)
+		return
+	}
+
+	td := &bd.timestampsData
+	minMinute := td.minTimestamp / streamHitsBucketNsecs
+	if minMinute == td.maxTimestamp/streamHitsBucketNsecs {
+		// Fast path - all the rows in the block belong to the same minute, so there is no need in decoding timestamps.
+		shb.addHits(minMinute, bd.rowsCount)
+		return
+	}
+
+	// Slow path - decode timestamps.
+	var err error
+	shb.timestamps, err = encoding.UnmarshalTimestamps(shb.timestamps[:0], td.data, td.marshalType, td.minTimestamp, int(bd.rowsCount))
+	if err != nil {
+		logger.Panicf("FATAL: cannot unmarshal timestamps for stream hits: %s", err)
+	}
+	shb.addTimestamps(shb.timestamps)
+}
+
+func (shb *streamHitsBuilder) addTimestamps(timestamps []int64) {
+	for len(timestamps) > 0 {
+		minute := timestamps[0] / streamHitsBucketNsecs
+		n := 1
+		for n < len(timestamps) && timestamps[n]/streamHitsBucketNsecs == minute {
+			n++
+		}
+		shb.addHits(minute, uint64(n))
+		timestamps = timestamps[n:]
+	}
+}
+
+func (shb *streamHitsBuilder) addHits(minute int64, hits uint64) {
+	if n := len(shb.minutes); n > 0 && shb.minutes[n-1] == minute {
+		shb.hits[n-1] += hits
+		return
+	}
+	shb.minutes = append(shb.minutes, minute)
+	shb.hits = append(shb.hits, hits)
+}
+
+// flushStream marshals the collected hits for the current stream into shb.chunk.
+func (shb *streamHitsBuilder) flushStream(w *writerWithStats) {
+	if len(shb.minutes) == 0 {
+		return
+	}
+
+	minutes, hits := shb.minutes, shb.hits
+	if !slices.IsSorted(minutes) {
+		// Blocks for the same stream may have overlapping time ranges, so sort the collected minutes and merge duplicates.
+		sort.Sort(&minutesWithHits{
+			minutes: minutes,
+			hits:    hits,
+		})
+		dstIdx := 0
+		for i := 1; i < len(minutes); i++ {
+			if minutes[i] == minutes[dstIdx] {
+				hits[dstIdx] += hits[i]
+				continue
+			}
+			dstIdx++
+			minutes[dstIdx] = minutes[i]
+			hits[dstIdx] = hits[i]
+		}
+		minutes = minutes[:dstIdx+1]
+		hits = hits[:dstIdx+1]
+	}
+
+	dst := shb.sid.marshal(shb.chunk)
+	dst = encoding.MarshalVarUint64(dst, uint64(len(minutes)))
+	prevMinute := int64(0)
+	for i, minute := range minutes {
+		dst = encoding.MarshalVarInt64(dst, minute-prevMinute)
+		dst = encoding.MarshalVarUint64(dst, hits[i])
+		prevMinute = minute
+	}
+	shb.chunk = dst
+
+	shb.minutes = shb.minutes[:0]
+	shb.hits = shb.hits[:0]
+
+	if len(shb.chunk) >= maxStreamHitsChunkSize {
+		shb.flushChunk(w)
+	}
+}
+
+func (shb *streamHitsBuilder) flushChunk(w *writerWithStats) {
+	if len(shb.chunk) == 0 {
+		return
+	}
+
+	shb.compressedChunk = encoding.CompressZSTDLevel(shb.compressedChunk[:0], shb.chunk, 1)
+
+	var lenBuf [10]byte
+	w.MustWrite(encoding.MarshalVarUint64(lenBuf[:0], uint64(len(shb.compressedChunk))))
+	w.MustWrite(shb.compressedChunk)
+
+	shb.chunk = shb.chunk[:0]
+}
+
+// mustWrite writes the remaining hits to w.
+func (shb *streamHitsBuilder) mustWrite(w *writerWithStats) {
+	shb.flushStream(w)
+	shb.flushChunk(w)
+}
+
+type minutesWithHits struct {
+	minutes []int64
+	hits    []uint64
+}
+
+func (mh *minutesWithHits) Len() int {
+	return len(mh.minutes)
+}
+
+func (mh *minutesWithHits) Less(i, j int) bool {
+	return mh.minutes[i] < mh.minutes[j]
+}
+
+func (mh *minutesWithHits) Swap(i, j int) {
+	mh.minutes[i], mh.minutes[j] = mh.minutes[j], mh.minutes[i]
+	mh.hits[i], mh.hits[j] = mh.hits[j], mh.hits[i]
+}
+
+// hasStreamHits returns true if p contains per-stream hits.
+//
+// Parts always contain rows, so the file with per-stream hits is empty only if the part is created without per-stream hits.
+func (p *part) hasStreamHits() bool {
+	return p.streamHitsFileSize > 0
+}
+
+// mustReadStreamHits calls f for every stream stored in p with per-minute hits for this stream.
+//
+// The file with per-stream hits is read chunk by chunk, so the memory usage doesn't depend on the file size.
+//
+// f mustn't hold references to minutes and hits after returning.
+func (p *part) mustReadStreamHits(f func(sid *streamID, minutes []int64, hits []uint64)) {
+	compressedBuf := longTermBufPool.Get()
+	defer longTermBufPool.Put(compressedBuf)
+
+	chunkBuf := longTermBufPool.Get()
+	defer longTermBufPool.Put(chunkBuf)
+
+	var lenBuf [10]byte
+	var minutes []int64
+	var hits []uint64
+	offset := uint64(0)
+	for offset < p.streamHitsFileSize {
+		lenSize := min(uint64(len(lenBuf)), p.streamHitsFileSize-offset)
+		p.streamHitsFile.MustReadAt(lenBuf[:lenSize], int64(offset))
+		compressedLen, n := encoding.UnmarshalVarUint64(lenBuf[:lenSize])
+		if n <= 0 || p.streamHitsFileSize-offset-uint64(n) < compressedLen {
+			logger.Panicf("FATAL: %s: cannot read the compressed chunk size from %s", p.path, streamHitsFilename)
+		}
+		offset += uint64(n)
+
+		compressedBuf.B = bytesutil.ResizeNoCopyNoOverallocate(compressedBuf.B, int(compressedLen))
+		p.streamHitsFile.MustReadAt(compressedBuf.B, int64(offset))
+		offset += compressedLen
+
+		var err error
+		chunkBuf.B, err = encoding.DecompressZSTD(chunkBuf.B[:0], compressedBuf.B)
+		if err != nil {
+			logger.Panicf("FATAL: %s: cannot decompress chunk from %s: %s", p.path, streamHitsFilename, err)
+		}
+
+		chunk := chunkBuf.B
+		for len(chunk) > 0 {
+			var sid streamID
+			tail, err := sid.unmarshal(chunk)
+			if err != nil {
+				logger.Panicf("FATAL: %s: cannot unmarshal streamID from %s: %s", p.path, streamHitsFilename, err)
+			}
+			chunk = tail
+
+			minutesCount, n := encoding.UnmarshalVarUint64(chunk)
+			if n <= 0 {
+				logger.Panicf("FATAL: %s: cannot unmarshal the number of minutes from %s", p.path, streamHitsFilename)
+			}
+			chunk = chunk[n:]
+
+			minutes = minutes[:0]
+			hits = hits[:0]
+			prevMinute := int64(0)
+			for i := uint64(0); i < minutesCount; i++ {
+				minuteDelta, n := encoding.UnmarshalVarInt64(chunk)
+				if n <= 0 {
+					logger.Panicf("FATAL: %s: cannot unmarshal minute from %s", p.path, streamHitsFilename)
+				}
+				chunk = chunk[n:]
+
+				h, n := encoding.UnmarshalVarUint64(chunk)
+				if n <= 0 {
+					logger.Panicf("FATAL: %s: cannot unmarshal hits from %s", p.path, streamHitsFilename)
+				}
+				chunk = chunk[n:]
+
+				prevMinute += minuteDelta
+				minutes = append(minutes, prevMinute)
+				hits = append(hits, h)
+			}
+
+			f(&sid, minutes, hits)
+		}
+	}
+}
+
+// GetHitsPreaggregated returns the number of logs matching qctx grouped into time buckets with the given step and offset.
+//
+// The hits are obtained from per-minute hits per each stream, which are maintained during data ingestion,
+// so the stored logs aren't scanned. This allows quickly obtaining hits over long time ranges.
+//
+// The returned timestamps are sorted. Time buckets without hits are skipped.
+//
+// false is returned if the hits cannot be obtained from the pre-aggregated data. In this case the query must be executed in the regular way.
+// This is the case when qctx.Query contains filters other than time filter and _stream:{...} filter, when it contains pipes,
+// when the selected time range, step or offset aren't aligned to minutes or when the selected time range contains parts
+// created by older VictoriaLogs releases or without StorageConfig.EnableHitsPreaggregation.
+func (s *Storage) GetHitsPreaggregated(qctx *QueryContext, step, offset int64) ([]int64, []uint64, bool, error) {
+	q := qctx.Query
+	if len(q.pipes) > 0 || q.opts.timeOffset != 0 {
+		return nil, nil, false, nil
+	}
+	if step <= 0 || step%streamHitsBucketNsecs != 0 || offset%streamHitsBucketNsecs != 0 {
+		return nil, nil, false, nil
+	}
+
+	var sf *StreamFilter
+	if !isNoopFilter(q.f) {
+		sfCommon, fRemaining := getCommonStreamFilter(q.f)
+		if !isTimeFilterOnly(fRemaining) {
+			return nil, nil, false, nil
+		}
+		sf = sfCommon
+	}
+
+	minTimestamp, maxTimestamp := q.GetFilterTimeRange()
+	if minTimestamp != math.MinInt64 && minTimestamp%streamHitsBucketNsecs != 0 {
+		return nil, nil, false, nil
+	}
+	if maxTimestamp != math.MaxInt64 && (maxTimestamp+1)%streamHitsBucketNsecs != 0 {
+		return nil, nil, false, nil
+	}
+	if minTimestamp > maxTimestamp {
+		return nil, nil, true, nil
+	}
+	minMinute := minTimestamp / streamHitsBucketNsecs
+	maxMinute := maxTimestamp / streamHitsBucketNsecs
+
+	ptws, ptwsDecRef := s.getPartitionsForTimeRange(minTimestamp, maxTimestamp)
+	defer ptwsDecRef()
+
+	stopCh := qctx.Context.Done()
+	m := make(map[int64]uint64)
+	for _, ptw := range ptws {
+		pt := ptw.pt
+
+		var sids map[streamID]struct{}
+		if sf != nil {
+			streamIDs := pt.idb.searchStreamIDs(qctx.TenantIDs, sf)
+			sids = make(map[streamID]struct{}, len(streamIDs))
+			for _, sid := range streamIDs {
+				sids[sid] = struct{}{}
+			}
+		}
+		matchStream := func(sid *streamID) bool {
+			if sids != nil {
+				_, ok := sids[*sid]
+				return ok
+			}
+			return slices.Contains(qctx.TenantIDs, sid.tenantID)
+		}
+
+		ok := pt.ddb.forEachPartInTimeRange(minTimestamp, maxTimestamp, func(p *part) bool {
+			if !p.hasStreamHits() {
+				return false
+			}
+			if needStop(stopCh) {
+				return true
+			}
+			p.mustReadStreamHits(func(sid *streamID, minutes []int64, hits []uint64) {
+				if !matchStream(sid) {
+					return
+				}
+				for i, minute := range minutes {
+					if minute < minMinute || minute > maxMinute {
+						continue
+					}
+					bucket := truncateTimestamp(minute*streamHitsBucketNsecs, step, offset, "")
+					m[bucket] += hits[i]
+				}
+			})
+			return true
+		})
+		if !ok {
+			return nil, nil, false, nil
+		}
+	}
+
+	if err := qctx.Context.Err(); err != nil {
+		return nil, nil, false, err
+	}
+
+	timestamps := make([]int64, 0, len(m))
+	for ts := range m {
+		timestamps = append(timestamps, ts)
+	}
+	slices.Sort(timestamps)
+	hits := make([]uint64, len(timestamps))
+	for i, ts := range timestamps {
+		hits[i] = m[ts]
+	}
+	return timestamps, hits, true, nil
+}
+
+// forEachPartInTimeRange calls f for every part in ddb with the data on the given time range.
+//
+// It stops calling f and returns false as soon as f returns false.
+func (ddb *datadb) forEachPartInTimeRange(minTimestamp, maxTimestamp int64, f func(p *part) bool) bool {
+	pws, pwsDecRef := ddb.getPartsForTimeRange(minTimestamp, maxTimestamp)
+	defer pwsDecRef()
+
+	// The recent parts must be obtained after the remaining parts. See datadb.search for details.
+	recentPws, recentPwsDecRef := ddb.getRecentPartsForTimeRange(minTimestamp, maxTimestamp)
+	defer recentPwsDecRef()
+
+	pws = append(pws, recentPws...)
+	for _, pw := range pws {
+		if !f(pw.p) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTimeFilterOnly(f filter) bool {
+	switch t := f.(type) {
+	case *filterNoop, *filterTime:
+		return true
+	case *filterAnd:
+		for _, f := range t.filters {
+			if _, ok := f.(*filterTime); !ok {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,168 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageGetHitsPreaggregated(t *testing.T) {
+	t.Parallel()
+
+	const rowsCount = 1000
+	const hostsCount = 3
+
+	storagePath := t.Name()
+	cfg := &StorageConfig{
+		Retention:                time.Duration(100 * 365 * nsecsPerDay),
+		EnableHitsPreaggregation: true,
+	}
+	s := MustOpenStorage(storagePath, cfg)
+
+	tenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+	otherTenantID := TenantID{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+
+	baseTimestamp := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+	getTimestamp := func(i int) int64 {
+		return baseTimestamp + int64(i)*20*1e9
+	}
+
+	// Add rows in two batches with interleaved timestamps in order to create multiple parts with overlapping time ranges.
+	addRows := func(tenantID TenantID, rem int) {
+		lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+		for i := 0; i < rowsCount; i++ {
+			if i%2 != rem {
+				continue
+			}
+			lr.MustAdd(tenantID, getTimestamp(i), []Field{
+				{Name: "host", Value: fmt.Sprintf("h%d", i%hostsCount)},
+				{Name: "_msg", Value: "foo"},
+			}, -1)
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+		s.DebugFlush()
+	}
+	addRows(tenantID, 0)
+	addRows(tenantID, 1)
+	addRows(otherTenantID, 0)
+
+	getExpectedHits := func(hosts []int, minTimestamp, maxTimestamp, step, offset int64) ([]int64, []uint64) {
+		m := make(map[int64]uint64)
+		for i := 0; i < rowsCount; i++ {
+			ts := getTimestamp(i)
+			if ts < minTimestamp || ts > maxTimestamp || !slices.Contains(hosts, i%hostsCount) {
+				continue
+			}
+			m[truncateTimestamp(ts, step, offset, "")]++
+		}
+		timestamps := make([]int64, 0, len(m))
+		for ts := range m {
+			timestamps = append(timestamps, ts)
+		}
+		slices.Sort(timestamps)
+		hits := make([]uint64, len(timestamps))
+		for i, ts := range timestamps {
+			hits[i] = m[ts]
+		}
+		return timestamps, hits
+	}
+
+	getHits := func(qStr string, step, offset int64) ([]int64, []uint64, bool) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tenantID}, q, false, nil)
+		timestamps, hits, ok, err := s.GetHitsPreaggregated(qctx, step, offset)
+		if err != nil {
+			t.Fatalf("unexpected error for query [%s]: %s", qStr, err)
+		}
+		return timestamps, hits, ok
+	}
+
+	f := func(qStr string, step, offset int64, hosts []int, minTimestamp, maxTimestamp int64) {
+		t.Helper()
+
+		timestamps, hits, ok := getHits(qStr, step, offset)
+		if !ok {
+			t.Fatalf("expecting pre-aggregated hits for query [%s]", qStr)
+		}
+		timestampsExpected, hitsExpected := getExpectedHits(hosts, minTimestamp, maxTimestamp, step, offset)
+		if !reflect.DeepEqual(timestamps, timestampsExpected) {
+			t.Fatalf("unexpected timestamps for query [%s]\ngot\n%v\nwant\n%v", qStr, timestamps, timestampsExpected)
+		}
+		if !reflect.DeepEqual(hits, hitsExpected) {
+			t.Fatalf("unexpected hits for query [%s]\ngot\n%v\nwant\n%v", qStr, hits, hitsExpected)
+		}
+	}
+
+	fUnsupported := func(qStr string, step, offset int64) {
+		t.Helper()
+
+		if _, _, ok := getHits(qStr, step, offset); ok {
+			t.Fatalf("expecting no pre-aggregated hits for query [%s]", qStr)
+		}
+	}
+
+	allHosts := []int{0, 1, 2}
+	minTimestamp := time.Date(2025, 1, 2, 1, 0, 0, 0, time.UTC).UnixNano()
+	maxTimestamp := time.Date(2025, 1, 2, 2, 30, 0, 0, time.UTC).UnixNano() - 1
+
+	checkResults := func() {
+		t.Helper()
+
+		f("*", nsecsPerHour, 0, allHosts, math.MinInt64, math.MaxInt64)
+		f("*", 5*nsecsPerMinute, 2*nsecsPerMinute, allHosts, math.MinInt64, math.MaxInt64)
+		f(`{host="h1"}`, 10*nsecsPerMinute, 0, []int{1}, math.MinInt64, math.MaxInt64)
+		f(`_stream:{host=~"h0|h2"}`, nsecsPerHour, 0, []int{0, 2}, math.MinInt64, math.MaxInt64)
+		f(`_time:[2025-01-02T01:00:00Z, 2025-01-02T02:30:00Z)`, 15*nsecsPerMinute, 0, allHosts, minTimestamp, maxTimestamp)
+		f(`{host="h2"} _time:[2025-01-02T01:00:00Z, 2025-01-02T02:30:00Z)`, nsecsPerMinute, 0, []int{2}, minTimestamp, maxTimestamp)
+		f(`{host="missing"}`, nsecsPerHour, 0, nil, math.MinInt64, math.MaxInt64)
+
+		// queries, which cannot be answered from the pre-aggregated hits
+		fUnsupported("foo", nsecsPerHour, 0)
+		fUnsupported(`{host="h1"} foo`, nsecsPerHour, 0)
+		fUnsupported("* | count()", nsecsPerHour, 0)
+		fUnsupported("options(time_offset=1h) *", nsecsPerHour, 0)
+		fUnsupported(`_time:[2025-01-02T01:00:30Z, 2025-01-02T02:30:00Z)`, nsecsPerHour, 0)
+		fUnsupported("*", 30*1e9, 0)
+		fUnsupported("*", nsecsPerHour, 30*1e9)
+	}
+
+	checkResults()
+
+	// Verify the pre-aggregated hits after merging parts
+	s.MustForceMerge("")
+	checkResults()
+
+	// Parts created with disabled hits pre-aggregation do not contain per-stream hits
+	s.MustClose()
+	cfg.EnableHitsPreaggregation = false
+	s = MustOpenStorage(storagePath, cfg)
+	addRows(otherTenantID, 1)
+	fUnsupported("*", nsecsPerHour, 0)
+
+	// Per-stream hits are re-created for merged parts after enabling hits pre-aggregation
+	s.MustClose()
+	cfg.EnableHitsPreaggregation = true
+	s = MustOpenStorage(storagePath, cfg)
+	s.MustForceMerge("")
+	checkResults()
+
+	s.MustClose()
+	fs.MustRemoveDir(storagePath)
+}
@@ -0,0 +1,225 @@
+package logstorage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+)
+
+// StreamLastSeen contains the last time when logs were received for the given log stream.
+type StreamLastSeen struct {
+	// StreamID is the _stream_id of the log stream.
+	StreamID string
+
+	// Stream is the _stream of the log stream.
+	Stream string
+
+	// LastSeen is the last time in nanoseconds when logs for the given log stream were received by the storage.
+	LastSeen int64
+}
+
+// Marshal appends marshaled sls to dst and returns the result.
+func (sls *StreamLastSeen) Marshal(dst []byte) []byte {
+	dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(sls.StreamID))
+	dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(sls.Stream))
+	dst = encoding.MarshalInt64(dst, sls.LastSeen)
+	return dst
+}
+
+// UnmarshalInplace unmarshals sls from src and returns the remaining tail.
+//
+// sls is valid until src is changed.
+func (sls *StreamLastSeen) UnmarshalInplace(src []byte) ([]byte, error) {
+	srcOrig := src
+
+	streamID, n := encoding.UnmarshalBytes(src)
+	if n <= 0 {
+		return srcOrig, fmt.Errorf("cannot unmarshal streamID")
+	}
+	src = src[n:]
+	sls.StreamID = bytesutil.ToUnsafeString(streamID)
+
+	stream, n := encoding.UnmarshalBytes(src)
+	if n <= 0 {
+		return srcOrig, fmt.Errorf("cannot unmarshal stream")
+	}
+	src = src[n:]
+	sls.Stream = bytesutil.ToUnsafeString(stream)
+
+	if len(src) < 8 {
+		return srcOrig, fmt.Errorf("cannot unmarshal lastSeen")
+	}
+	sls.LastSeen = encoding.UnmarshalInt64(src)
+	src = src[8:]
+
+	return src, nil
+}
+
+// MergeStreamsLastSeen merges a obtained from multiple storage nodes.
+//
+// The maximum LastSeen is selected for streams seen at multiple storage nodes,
+// since logs for the same stream may be spread among multiple storage nodes.
+//
+// The returned streams are sorted by LastSeen, so the streams, which stopped receiving logs first, go first.
+func MergeStreamsLastSeen(a [][]StreamLastSeen) []StreamLastSeen {
+	m := make(map[string]*StreamLastSeen)
+	for _, slss := range a {
+		for i := range slss {
+			sls := &slss[i]
+			if p := m[sls.StreamID]; p != nil {
+				p.LastSeen = max(p.LastSeen, sls.LastSeen)
+				continue
+			}
+			m[sls.StreamID] = sls
+		}
+	}
+
+	result := make([]StreamLastSeen, 0, len(m))
+	for _, sls := range m {
+		result = append(result, *sls)
+	}
+	sortStreamsLastSeen(result)
+	return result
+}
+
+func sortStreamsLastSeen(slss []StreamLastSeen) {
+	sort.Slice(slss, func(i, j int) bool {
+		a, b := &slss[i], &slss[j]
+		if a.LastSeen != b.LastSeen {
+			return a.LastSeen < b.LastSeen
+		}
+		return a.Stream < b.Stream
+	})
+}
+
+// GetStreamsLastSeen returns the last time when logs were received for streams matching qctx.
+//
+// The qctx.Query may contain only _stream:{...} filter without pipes.
+//
+// Only streams, which received logs since the storage start, are returned, since the last seen time is tracked in memory.
+func (s *Storage) GetStreamsLastSeen(qctx *QueryContext) ([]StreamLastSeen, error) {
+	q := qctx.Query
+	if len(q.pipes) > 0 {
+		return nil, fmt.Errorf("the query [%s] mustn't contain pipes", q)
+	}
+
+	var sf *StreamFilter
+	if !isNoopFilter(q.f) {
+		var fRemaining filter
+		sf, fRemaining = getCommonStreamFilter(q.f)
+		if sf == nil || !isNoopFilter(fRemaining) {
+			return nil, fmt.Errorf("the query [%s] may contain only _stream:{...} filter", q)
+		}
+	}
+
+	minLastSeen := time.Now().UnixNano() - s.retention.Nanoseconds()
+	slss := s.streamsLastSeen.getStreams(qctx.TenantIDs, sf, minLastSeen)
+	sortStreamsLastSeen(slss)
+	return slss, nil
+}
+
+// streamsLastSeenShardsCount is the number of shards in streamsLastSeenTracker.
+//
+// Sharding reduces lock contention during concurrent data ingestion.
+const streamsLastSeenShardsCount = 64
+
+// streamsLastSeenTracker tracks the last time when logs were received per each log stream.
+type streamsLastSeenTracker struct {
+	shards [streamsLastSeenShardsCount]streamsLastSeenShard
+}
+
+type streamsLastSeenShard struct {
+	mu sync.Mutex
+	m  map[streamID]*streamLastSeenEntry
+}
+
+type streamLastSeenEntry struct {
+	// stream is the _stream value for the given stream.
+	stream string
+
+	// lastSeen is the last time in nanoseconds when logs for the given stream were received.
+	lastSeen int64
+}
+
+func newStreamsLastSeenTracker() *streamsLastSeenTracker {
+	var t streamsLastSeenTracker
+	for i := range t.shards {
+		t.shards[i].m = make(map[streamID]*streamLastSeenEntry)
+	}
+	return &t
+}
+
+// update registers streams for the rows from lr as seen at the current time.
+func (t *streamsLastSeenTracker) update(lr *LogRows) {
+	now := time.Now().UnixNano()
+
+	var sidPrev streamID
+	for i := range lr.streamIDs {
+		sid := &lr.streamIDs[i]
+		if i > 0 && sid.equal(&sidPrev) {
+			// Fast path - rows for the same stream are usually ingested in a row.
+			continue
+		}
+		sidPrev = *sid
+
+		shard := &t.shards[sid.id.lo%streamsLastSeenShardsCount]
+		shard.mu.Lock()
+		e := shard.m[*sid]
+		if e == nil {
+			e = &streamLastSeenEntry{
+				stream: getStreamTagsString(lr.streamTagsCanonicals[i]),
+			}
+			shard.m[*sid] = e
+		}
+		e.lastSeen = now
+		shard.mu.Unlock()
+	}
+}
+
+// getStreams returns streams for the given tenantIDs matching the optional sf.
+//
+// Streams with the last seen time smaller than minLastSeen are dropped from t.
+func (t *streamsLastSeenTracker) getStreams(tenantIDs []TenantID, sf *StreamFilter, minLastSeen int64) []StreamLastSeen {
+	var slss []StreamLastSeen
+	var buf []byte
+	for i := range t.shards {
+		shard := &t.shards[i]
+		shard.mu.Lock()
+		for sid, e := range shard.m {
+			if e.lastSeen < minLastSeen {
+				delete(shard.m, sid)
+				continue
+			}
+			if !slices.Contains(tenantIDs, sid.tenantID) {
+				continue
+			}
+			if sf != nil && !sf.matchStreamName(e.stream) {
+				continue
+			}
+			buf = sid.marshalString(buf[:0])
+			slss = append(slss, StreamLastSeen{
+				StreamID: string(buf),
+				Stream:   e.stream,
+				LastSeen: e.lastSeen,
+			})
+		}
+		shard.mu.Unlock()
+	}
+	return slss
+}
+
+func isNoopFilter(f filter) bool {
+	switch t := f.(type) {
+	case *filterNoop:
+		return true
+	case *filterAnd:
+		return len(t.filters) == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,153 @@
+package logstorage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStreamLastSeenMarshalUnmarshal(t *testing.T) {
+	sls := &StreamLastSeen{
+		StreamID: "0000000000000000000000000000000000000000000000000000000000000001",
+		Stream:   `{host="foo"}`,
+		LastSeen: 1234567890,
+	}
+
+	data := sls.Marshal(nil)
+
+	sls2 := &StreamLastSeen{}
+	tail, err := sls2.UnmarshalInplace(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal StreamLastSeen: %s", err)
+	}
+	if len(tail) > 0 {
+		t.Fatalf("unexpected non-empty tail left; len(tail)=%d", len(tail))
+	}
+
+	if !reflect.DeepEqual(sls, sls2) {
+		t.Fatalf("unexpected unmarshaled StreamLastSeen; got %#v; want %#v", sls2, sls)
+	}
+}
+
+func TestMergeStreamsLastSeen(t *testing.T) {
+	f := func(a [][]StreamLastSeen, resultExpected []StreamLastSeen) {
+		t.Helper()
+
+		result := MergeStreamsLastSeen(a)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	f(nil, []StreamLastSeen{})
+
+	// streams seen at multiple storage nodes must get the maximum last seen time
+	f([][]StreamLastSeen{
+		{
+			{StreamID: "a", Stream: `{host="a"}`, LastSeen: 10},
+			{StreamID: "b", Stream: `{host="b"}`, LastSeen: 30},
+		},
+		{
+			{StreamID: "a", Stream: `{host="a"}`, LastSeen: 40},
+			{StreamID: "c", Stream: `{host="c"}`, LastSeen: 20},
+		},
+		nil,
+	}, []StreamLastSeen{
+		{StreamID: "c", Stream: `{host="c"}`, LastSeen: 20},
+		{StreamID: "b", Stream: `{host="b"}`, LastSeen: 30},
+		{StreamID: "a", Stream: `{host="a"}`, LastSeen: 40},
+	})
+}
+
+func TestStorageGetStreamsLastSeen(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	s := MustOpenStorage(path, &StorageConfig{})
+	defer func() {
+		s.MustClose()
+		fs.MustRemoveDir(path)
+	}()
+
+	tenantID := TenantID{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+	otherTenantID := TenantID{
+		AccountID: 3,
+		ProjectID: 4,
+	}
+
+	addRows := func(tenantID TenantID, hosts ...string) {
+		lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+		for _, host := range hosts {
+			lr.MustAdd(tenantID, time.Now().UnixNano(), []Field{
+				{Name: "host", Value: host},
+				{Name: "_msg", Value: "foo"},
+			}, -1)
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+	}
+
+	startTime := time.Now().UnixNano()
+	addRows(tenantID, "h1", "h1", "h2")
+	addRows(otherTenantID, "h3")
+	time.Sleep(10 * time.Millisecond)
+	midTime := time.Now().UnixNano()
+	addRows(tenantID, "h2")
+
+	f := func(qStr string, streamsExpected []string) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tenantID}, q, false, nil)
+		slss, err := s.GetStreamsLastSeen(qctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var streams []string
+		for _, sls := range slss {
+			streams = append(streams, sls.Stream)
+			if sls.LastSeen < startTime {
+				t.Fatalf("unexpected last seen time for %s; got %d; want bigger than %d", sls.Stream, sls.LastSeen, startTime)
+			}
+			if sls.Stream == `{host="h2"}` && sls.LastSeen < midTime {
+				t.Fatalf("unexpected last seen time for %s; got %d; want bigger than %d", sls.Stream, sls.LastSeen, midTime)
+			}
+		}
+		if !reflect.DeepEqual(streams, streamsExpected) {
+			t.Fatalf("unexpected streams\ngot\n%q\nwant\n%q", streams, streamsExpected)
+		}
+	}
+
+	// streams must be sorted by the last seen time
+	f("*", []string{`{host="h1"}`, `{host="h2"}`})
+
+	// stream filter
+	f(`{host="h2"}`, []string{`{host="h2"}`})
+	f(`_stream:{host=~"h1|h3"}`, []string{`{host="h1"}`})
+
+	// unsupported queries
+	fError := func(qStr string) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tenantID}, q, false, nil)
+		if _, err := s.GetStreamsLastSeen(qctx); err == nil {
+			t.Fatalf("expecting non-nil error for query [%s]", qStr)
+		}
+	}
+	fError("foo")
+	fError(`{host="h1"} foo`)
+	fError("* | count()")
+}
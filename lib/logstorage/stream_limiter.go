@@ -0,0 +1,33 @@
+package logstorage
+
+// CatchAllStreamField is the name of the stream field for the catch-all log stream.
+//
+// Logs for streams, which exceed StreamLimiter limits, are stored into the catch-all stream {stream_limit_exceeded="true"}
+// if StreamLimiter.RerouteToCatchAllStream returns true.
+const CatchAllStreamField = "stream_limit_exceeded"
+
+// StreamLimiter limits the number of log streams per tenant.
+//
+// See LogRows.SetStreamLimiter.
+type StreamLimiter interface {
+	// AllowStream must return true if logs for the stream with the given streamHash can be ingested into the given tenantID.
+	AllowStream(tenantID TenantID, streamHash uint64) bool
+
+	// RerouteToCatchAllStream must return true if logs for disallowed streams must be stored into the catch-all stream instead of dropping them.
+	RerouteToCatchAllStream() bool
+}
+
+// SetStreamLimiter sets sl for limiting log streams added to lr via MustAdd.
+//
+// The sl is reset by Reset call.
+func (lr *LogRows) SetStreamLimiter(sl StreamLimiter) {
+	lr.streamLimiter = sl
+}
+
+func appendCatchAllStreamTagsCanonical(dst []byte) []byte {
+	st := GetStreamTags()
+	st.Add(CatchAllStreamField, "true")
+	dst = st.MarshalCanonical(dst)
+	PutStreamTags(st)
+	return dst
+}
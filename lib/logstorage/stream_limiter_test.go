@@ -0,0 +1,85 @@
+package logstorage
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testStreamLimiter struct {
+	maxStreams int
+	reroute    bool
+
+	streams map[uint64]struct{}
+}
+
+func (sl *testStreamLimiter) AllowStream(_ TenantID, streamHash uint64) bool {
+	if _, ok := sl.streams[streamHash]; ok {
+		return true
+	}
+	if len(sl.streams) >= sl.maxStreams {
+		return false
+	}
+	sl.streams[streamHash] = struct{}{}
+	return true
+}
+
+func (sl *testStreamLimiter) RerouteToCatchAllStream() bool {
+	return sl.reroute
+}
+
+func TestLogRows_StreamLimiter(t *testing.T) {
+	f := func(reroute bool, resultExpected []string) {
+		t.Helper()
+
+		lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+		defer PutLogRows(lr)
+
+		lr.SetStreamLimiter(&testStreamLimiter{
+			maxStreams: 2,
+			reroute:    reroute,
+			streams:    make(map[uint64]struct{}),
+		})
+
+		tid := TenantID{
+			AccountID: 123,
+			ProjectID: 456,
+		}
+		for i, host := range []string{"a", "b", "c", "a", "d"} {
+			fields := []Field{
+				{
+					Name:  "host",
+					Value: host,
+				},
+				{
+					Name:  "_msg",
+					Value: "foo",
+				},
+			}
+			lr.MustAdd(tid, int64(i+1), fields, -1)
+		}
+
+		var result []string
+		for i := 0; i < lr.RowsCount(); i++ {
+			result = append(result, lr.GetRowString(i))
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	// drop logs for streams exceeding the limit
+	f(false, []string{
+		`{"_msg":"foo","_stream":"{host=\"a\"}","_time":"1970-01-01T00:00:00.000000001Z","host":"a"}`,
+		`{"_msg":"foo","_stream":"{host=\"b\"}","_time":"1970-01-01T00:00:00.000000002Z","host":"b"}`,
+		`{"_msg":"foo","_stream":"{host=\"a\"}","_time":"1970-01-01T00:00:00.000000004Z","host":"a"}`,
+	})
+
+	// reroute logs for streams exceeding the limit to the catch-all stream
+	f(true, []string{
+		`{"_msg":"foo","_stream":"{host=\"a\"}","_time":"1970-01-01T00:00:00.000000001Z","host":"a"}`,
+		`{"_msg":"foo","_stream":"{host=\"b\"}","_time":"1970-01-01T00:00:00.000000002Z","host":"b"}`,
+		`{"_msg":"foo","_stream":"{stream_limit_exceeded=\"true\"}","_time":"1970-01-01T00:00:00.000000003Z","host":"c"}`,
+		`{"_msg":"foo","_stream":"{host=\"a\"}","_time":"1970-01-01T00:00:00.000000004Z","host":"a"}`,
+		`{"_msg":"foo","_stream":"{stream_limit_exceeded=\"true\"}","_time":"1970-01-01T00:00:00.000000005Z","host":"d"}`,
+	})
+}
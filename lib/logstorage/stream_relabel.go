@@ -0,0 +1,345 @@
+package logstorage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// StreamLabelRename is a rule for renaming log stream label at Storage.StreamsRelabel.
+type StreamLabelRename struct {
+	// OldName is the name of the stream label to rename.
+	OldName string
+
+	// NewName is the new name for the stream label.
+	NewName string
+}
+
+// String returns string representation of r.
+func (r *StreamLabelRename) String() string {
+	return r.OldName + ":" + r.NewName
+}
+
+// StreamsRelabelResult is the result of Storage.StreamsRelabel call.
+type StreamsRelabelResult struct {
+	// TaskID is the id of the delete task for the original logs, which have been relabeled.
+	//
+	// It is empty if no logs have been relabeled.
+	TaskID string `json:"task_id"`
+
+	// StreamsRelabeled is the number of relabeled log streams.
+	StreamsRelabeled uint64 `json:"streams_relabeled"`
+
+	// StreamsSkipped is the number of log streams, which weren't relabeled because they already contain the label with the new name.
+	StreamsSkipped uint64 `json:"streams_skipped"`
+
+	// RowsRelabeled is the number of relabeled logs.
+	RowsRelabeled uint64 `json:"rows_relabeled"`
+}
+
+// StreamsRelabel renames stream labels for the already stored logs matching the given filter f at the given tenantID according to renames.
+//
+// The logs are copied into log streams with the renamed labels, while the original logs are deleted via the delete task with the given taskID.
+// If the resulting log stream already exists, then the copied logs are merged into it.
+// Log streams, which already contain the label with the new name, are skipped.
+// Logs under legal holds are left untouched. See LegalHoldPlace.
+//
+// The timestamp must contain the time in nanoseconds when the relabeling is started. Logs with bigger timestamps aren't relabeled.
+func (s *Storage) StreamsRelabel(ctx context.Context, taskID string, timestamp int64, tenantID TenantID, f *Filter, renames []StreamLabelRename) (*StreamsRelabelResult, error) {
+	if err := validateStreamLabelRenames(renames); err != nil {
+		return nil, err
+	}
+	if s.IsReadOnly() {
+		return nil, fmt.Errorf("cannot relabel streams, since the storage is in read-only mode because of the lack of free disk space")
+	}
+
+	s.streamsRelabelLock.Lock()
+	defer s.streamsRelabelLock.Unlock()
+
+	tenantIDs := []TenantID{tenantID}
+	groups := s.getDeleteTaskGroups(tenantIDs, f.String())
+	if len(groups) != 1 {
+		logger.Panicf("BUG: unexpected number of delete task groups for a single tenant; got %d; want 1", len(groups))
+	}
+	fStr := groups[0].filter
+
+	q, err := ParseQueryAtTimestamp(fStr, timestamp)
+	if err != nil {
+		logger.Panicf("BUG: cannot parse filter [%s]: %s", fStr, err)
+	}
+	q.AddTimeFilter(math.MinInt64, timestamp)
+
+	sr := newStreamsRelabeler(s, renames)
+	defer sr.mustClose()
+
+	var qs QueryStats
+	qctx := NewQueryContext(ctx, &qs, tenantIDs, q, false, nil)
+	if err := s.RunQuery(qctx, sr.writeBlock); err != nil {
+		return nil, fmt.Errorf("cannot read logs for relabeling: %w", err)
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	sr.mustFlush()
+
+	rr := &StreamsRelabelResult{}
+	var oldStreamIDs []streamID
+	for _, rs := range sr.streams {
+		switch {
+		case rs.skipped:
+			rr.StreamsSkipped++
+		case rs.newStreamTagsCanonical != "":
+			rr.StreamsRelabeled++
+			oldStreamIDs = append(oldStreamIDs, rs.sid)
+		}
+	}
+	rr.RowsRelabeled = sr.rowsRelabeled
+	if len(oldStreamIDs) == 0 {
+		return rr, nil
+	}
+
+	// Make sure the relabeled logs are persisted to disk before deleting the original logs.
+	ptws, ptwsDecRef := s.getPartitionsForTimeRange(sr.minTimestamp, sr.maxTimestamp)
+	for _, ptw := range ptws {
+		ptw.pt.mustFlushToFiles()
+	}
+	ptwsDecRef()
+
+	// Delete the original logs. The relabeled logs belong to other log streams, so they aren't deleted.
+	fs := &filterStreamID{
+		streamIDs: oldStreamIDs,
+	}
+	fDelete := &Filter{
+		f: &filterAnd{
+			filters: []filter{q.f, fs},
+		},
+	}
+	if err := s.DeleteRunTask(ctx, taskID, timestamp, tenantIDs, fDelete); err != nil {
+		return nil, fmt.Errorf("cannot start the delete task for the original logs: %w", err)
+	}
+	rr.TaskID = taskID
+
+	return rr, nil
+}
+
+func validateStreamLabelRenames(renames []StreamLabelRename) error {
+	if len(renames) == 0 {
+		return fmt.Errorf("missing stream label renames")
+	}
+
+	oldNames := make(map[string]struct{}, len(renames))
+	newNames := make(map[string]struct{}, len(renames))
+	for i := range renames {
+		r := &renames[i]
+		if r.OldName == "" || r.NewName == "" {
+			return fmt.Errorf("stream label names cannot be empty in the rename %q", r)
+		}
+		if r.OldName == r.NewName {
+			return fmt.Errorf("the old and the new stream label names must differ in the rename %q", r)
+		}
+		if _, ok := oldNames[r.OldName]; ok {
+			return fmt.Errorf("duplicate rename for the stream label %q", r.OldName)
+		}
+		if _, ok := newNames[r.NewName]; ok {
+			return fmt.Errorf("multiple stream labels cannot be renamed to %q", r.NewName)
+		}
+		oldNames[r.OldName] = struct{}{}
+		newNames[r.NewName] = struct{}{}
+	}
+
+	// Chained renames such as a:b and b:c are prohibited, since they may result in the same stream ids
+	// for the original and the relabeled logs, so the relabeled logs could be deleted together with the original logs.
+	for name := range newNames {
+		if _, ok := oldNames[name]; ok {
+			return fmt.Errorf("the stream label %q cannot be renamed, since another stream label is renamed to it", name)
+		}
+	}
+	return nil
+}
+
+// relabeledStream contains the relabeling state for a single log stream.
+type relabeledStream struct {
+	// sid is the original stream id.
+	sid streamID
+
+	// newStreamTagsCanonical contains canonical stream tags after the relabeling.
+	//
+	// It is empty if the stream doesn't need relabeling.
+	newStreamTagsCanonical string
+
+	// skipped is set to true if the stream already contains the label with the new name.
+	skipped bool
+}
+
+// streamsRelabeler copies logs into log streams with renamed labels.
+type streamsRelabeler struct {
+	s *Storage
+
+	// renames maps the old stream label name to the new name.
+	renames map[string]string
+
+	mu sync.Mutex
+
+	// streams contains relabeling state for the already seen log streams keyed by _stream_id.
+	streams map[string]*relabeledStream
+
+	lr *LogRows
+	r  InsertRow
+
+	rowsRelabeled uint64
+	minTimestamp  int64
+	maxTimestamp  int64
+
+	err error
+}
+
+func newStreamsRelabeler(s *Storage, renames []StreamLabelRename) *streamsRelabeler {
+	m := make(map[string]string, len(renames))
+	for _, r := range renames {
+		m[r.OldName] = r.NewName
+	}
+	return &streamsRelabeler{
+		s:            s,
+		renames:      m,
+		streams:      make(map[string]*relabeledStream),
+		lr:           GetLogRows(nil, nil, nil, nil, ""),
+		minTimestamp: math.MaxInt64,
+		maxTimestamp: math.MinInt64,
+	}
+}
+
+func (sr *streamsRelabeler) mustClose() {
+	PutLogRows(sr.lr)
+	sr.lr = nil
+}
+
+func (sr *streamsRelabeler) mustFlush() {
+	if sr.lr.RowsCount() == 0 {
+		return
+	}
+	sr.s.MustAddRows(sr.lr)
+	sr.lr.ResetKeepSettings()
+}
+
+func (sr *streamsRelabeler) writeBlock(_ uint, db *DataBlock) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.err != nil {
+		return
+	}
+
+	cStreamID := db.GetColumnByName("_stream_id")
+	cStream := db.GetColumnByName("_stream")
+	if cStreamID == nil || cStream == nil {
+		sr.err = fmt.Errorf("missing _stream_id or _stream fields in the selected logs")
+		return
+	}
+	timestamps, ok := db.GetTimestamps(nil)
+	if !ok {
+		sr.err = fmt.Errorf("missing or invalid _time field in the selected logs")
+		return
+	}
+
+	r := &sr.r
+	for rowIdx, timestamp := range timestamps {
+		rs, err := sr.getRelabeledStream(cStreamID.Values[rowIdx], cStream.Values[rowIdx])
+		if err != nil {
+			sr.err = err
+			return
+		}
+		if rs.newStreamTagsCanonical == "" {
+			continue
+		}
+
+		r.Reset()
+		r.TenantID = rs.sid.tenantID
+		r.StreamTagsCanonical = rs.newStreamTagsCanonical
+		r.Timestamp = timestamp
+		for i := range db.Columns {
+			c := &db.Columns[i]
+			switch c.Name {
+			case "_stream_id", "_stream", "_time":
+				continue
+			}
+			v := c.Values[rowIdx]
+			if v == "" {
+				continue
+			}
+			name := c.Name
+			if newName, ok := sr.renames[name]; ok {
+				name = newName
+			}
+			r.Fields = append(r.Fields, Field{
+				Name:  name,
+				Value: v,
+			})
+		}
+		sr.lr.MustAddInsertRow(r)
+
+		sr.rowsRelabeled++
+		sr.minTimestamp = min(sr.minTimestamp, timestamp)
+		sr.maxTimestamp = max(sr.maxTimestamp, timestamp)
+
+		if sr.lr.NeedFlush() {
+			sr.mustFlush()
+		}
+	}
+}
+
+func (sr *streamsRelabeler) getRelabeledStream(streamIDStr, streamStr string) (*relabeledStream, error) {
+	if rs, ok := sr.streams[streamIDStr]; ok {
+		return rs, nil
+	}
+
+	rs := &relabeledStream{}
+	if !rs.sid.tryUnmarshalFromString(streamIDStr) {
+		return nil, fmt.Errorf("cannot parse _stream_id=%q", streamIDStr)
+	}
+
+	sn := getStreamName()
+	defer putStreamName(sn)
+	if !sn.parse(streamStr) {
+		return nil, fmt.Errorf("cannot parse _stream=%q", streamStr)
+	}
+
+	needRelabel := false
+	for _, tag := range sn.tags {
+		if _, ok := sr.renames[tag.Name]; ok {
+			needRelabel = true
+		}
+	}
+	if needRelabel {
+		for _, newName := range sr.renames {
+			if sn.getTagValueByTagName(newName) != "" {
+				// The stream already contains the label with the new name. Skip it in order to avoid losing the label value.
+				rs.skipped = true
+				needRelabel = false
+				break
+			}
+		}
+	}
+
+	if needRelabel {
+		st := GetStreamTags()
+		for _, tag := range sn.tags {
+			name := tag.Name
+			if newName, ok := sr.renames[name]; ok {
+				name = newName
+			}
+			st.Add(name, tag.Value)
+		}
+		bb := bbPool.Get()
+		bb.B = st.MarshalCanonical(bb.B)
+		PutStreamTags(st)
+		rs.newStreamTagsCanonical = string(bb.B)
+		bbPool.Put(bb)
+	}
+
+	sr.streams[strings.Clone(streamIDStr)] = rs
+	return rs, nil
+}
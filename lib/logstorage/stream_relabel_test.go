@@ -0,0 +1,183 @@
+package logstorage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageStreamsRelabel(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	cfg := &StorageConfig{
+		Retention: time.Duration(100 * 365 * nsecsPerDay),
+	}
+	s := MustOpenStorage(path, cfg)
+
+	tenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+	otherTenantID := TenantID{
+		AccountID: 1,
+		ProjectID: 2,
+	}
+
+	baseTimestamp := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+	lr := GetLogRows([]string{"app", "host", "service"}, nil, nil, nil, "")
+	for _, tid := range []TenantID{tenantID, otherTenantID} {
+		for i := 0; i < 300; i++ {
+			lr.MustAdd(tid, baseTimestamp+int64(i)*nsecsPerDay/100, []Field{
+				{Name: "app", Value: fmt.Sprintf("a%d", i%2)},
+				{Name: "host", Value: fmt.Sprintf("h%d", i%3)},
+				{Name: "_msg", Value: fmt.Sprintf("message %d", i)},
+			}, -1)
+		}
+	}
+
+	// The log stream with both the old and the new label names must be skipped.
+	for i := 0; i < 10; i++ {
+		lr.MustAdd(tenantID, baseTimestamp+int64(i), []Field{
+			{Name: "app", Value: "a0"},
+			{Name: "service", Value: "s0"},
+			{Name: "_msg", Value: fmt.Sprintf("conflict %d", i)},
+		}, -1)
+	}
+
+	// The log stream with the new label name must receive the relabeled logs.
+	for i := 0; i < 20; i++ {
+		lr.MustAdd(tenantID, baseTimestamp+int64(i), []Field{
+			{Name: "host", Value: "h0"},
+			{Name: "service", Value: "a0"},
+			{Name: "_msg", Value: fmt.Sprintf("new %d", i)},
+		}, -1)
+	}
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	f := func(tid TenantID, qStr string, rowsCountExpected uint64) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tid}, q, false, nil)
+
+		var rowsCount atomic.Uint64
+		err = s.RunQuery(qctx, func(_ uint, db *DataBlock) {
+			rowsCount.Add(uint64(db.RowsCount()))
+		})
+		if err != nil {
+			t.Fatalf("unexpected error for query [%s]: %s", qStr, err)
+		}
+		if n := rowsCount.Load(); n != rowsCountExpected {
+			t.Fatalf("unexpected number of rows for query [%s] at tenant %s; got %d; want %d", qStr, tid, n, rowsCountExpected)
+		}
+	}
+
+	relabel := func(taskID, filter string, renames []StreamLabelRename) *StreamsRelabelResult {
+		t.Helper()
+
+		fRelabel, err := ParseFilter(filter)
+		if err != nil {
+			t.Fatalf("cannot parse filter: %s", err)
+		}
+		rr, err := s.StreamsRelabel(t.Context(), taskID, time.Now().UnixNano(), tenantID, fRelabel, renames)
+		if err != nil {
+			t.Fatalf("cannot relabel streams: %s", err)
+		}
+		waitForDeleteTasks(t, s)
+		s.DebugFlush()
+		return rr
+	}
+
+	// Relabel logs for h0 and h1 hosts, while leaving logs for h2 host untouched.
+	rr := relabel("task1", `{host=~"h0|h1"}`, []StreamLabelRename{
+		{
+			OldName: "app",
+			NewName: "service",
+		},
+	})
+	if rr.TaskID != "task1" || rr.StreamsRelabeled != 4 || rr.StreamsSkipped != 0 || rr.RowsRelabeled != 200 {
+		t.Fatalf("unexpected result: %+v", rr)
+	}
+
+	f(tenantID, `*`, 330)
+	f(tenantID, `{app=~".+"}`, 110)
+	f(tenantID, `{app=~".+"} host:h2`, 100)
+	f(tenantID, `{service="a0"} {host="h0"}`, 70)
+	f(tenantID, `{service=~"a.+"}`, 220)
+	f(tenantID, `service:a1 -app:*`, 100)
+	f(tenantID, `message`, 300)
+
+	// Logs at other tenants must be left untouched.
+	f(otherTenantID, `{app=~".+"}`, 300)
+	f(otherTenantID, `{service=~".+"}`, 0)
+
+	// The log stream with both app and service labels must be skipped.
+	rr = relabel("task2", `*`, []StreamLabelRename{
+		{
+			OldName: "app",
+			NewName: "service",
+		},
+	})
+	if rr.TaskID != "task2" || rr.StreamsRelabeled != 2 || rr.StreamsSkipped != 1 || rr.RowsRelabeled != 100 {
+		t.Fatalf("unexpected result: %+v", rr)
+	}
+	f(tenantID, `*`, 330)
+	f(tenantID, `{app=~".+"}`, 10)
+	f(tenantID, `{service=~".+"}`, 330)
+
+	// Nothing to relabel
+	rr = relabel("task3", `*`, []StreamLabelRename{
+		{
+			OldName: "app",
+			NewName: "service",
+		},
+	})
+	if rr.TaskID != "" || rr.StreamsRelabeled != 0 || rr.StreamsSkipped != 1 || rr.RowsRelabeled != 0 {
+		t.Fatalf("unexpected result: %+v", rr)
+	}
+	f(tenantID, `*`, 330)
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
+
+func TestValidateStreamLabelRenames_Failure(t *testing.T) {
+	f := func(renames []StreamLabelRename) {
+		t.Helper()
+
+		if err := validateStreamLabelRenames(renames); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// missing renames
+	f(nil)
+
+	// empty names
+	f([]StreamLabelRename{{OldName: "", NewName: "foo"}})
+	f([]StreamLabelRename{{OldName: "foo", NewName: ""}})
+
+	// identical names
+	f([]StreamLabelRename{{OldName: "foo", NewName: "foo"}})
+
+	// duplicate old names
+	f([]StreamLabelRename{{OldName: "foo", NewName: "bar"}, {OldName: "foo", NewName: "baz"}})
+
+	// duplicate new names
+	f([]StreamLabelRename{{OldName: "foo", NewName: "bar"}, {OldName: "baz", NewName: "bar"}})
+
+	// chained renames
+	f([]StreamLabelRename{{OldName: "foo", NewName: "bar"}, {OldName: "bar", NewName: "baz"}})
+
+	// swapped names
+	f([]StreamLabelRename{{OldName: "foo", NewName: "bar"}, {OldName: "bar", NewName: "foo"}})
+}
@@ -70,9 +70,22 @@ func (tid *TenantID) unmarshal(src []byte) ([]byte, error) {
 }
 
 // GetTenantIDFromRequest returns tenantID from r.
+//
+// The tenantID is read from AccountID and ProjectID request headers.
+// If these headers are missing, then the tenantID is read from Loki-compatible X-Scope-OrgID header in the form accountID:projectID.
 func GetTenantIDFromRequest(r *http.Request) (TenantID, error) {
 	var tenantID TenantID
 
+	if r.Header.Get("AccountID") == "" && r.Header.Get("ProjectID") == "" {
+		if orgID := r.Header.Get("X-Scope-OrgID"); orgID != "" {
+			tid, err := ParseTenantID(orgID)
+			if err != nil {
+				return tenantID, fmt.Errorf("cannot parse X-Scope-OrgID header: %w", err)
+			}
+			return tid, nil
+		}
+	}
+
 	accountID, err := getUint32FromHeader(r, "AccountID")
 	if err != nil {
 		return tenantID, err
@@ -87,6 +100,68 @@ func GetTenantIDFromRequest(r *http.Request) (TenantID, error) {
 	return tenantID, nil
 }
 
+// HasTenantInRequest returns true if r contains tenant headers.
+func HasTenantInRequest(r *http.Request) bool {
+	return r.Header.Get("AccountID") != "" || r.Header.Get("ProjectID") != "" || r.Header.Get("X-Scope-OrgID") != ""
+}
+
+// StripTenantFromPath removes the optional tenant from the path starting with the given prefix and returns the resulting path.
+//
+// The following tenant forms are supported after the prefix: accountID/projectID/, accountID:projectID/ and accountID/.
+// For example, /insert/12/34/jsonline is converted to /insert/jsonline for tenant 12:34 when the prefix is /insert/.
+//
+// The tenant is stored in AccountID and ProjectID headers of r, so it can be obtained via GetTenantIDFromRequest.
+// An error is returned if r already contains headers for another tenant.
+func StripTenantFromPath(r *http.Request, path, prefix string) (string, error) {
+	tail, ok := strings.CutPrefix(path, prefix)
+	if !ok || tail == "" || tail[0] < '0' || tail[0] > '9' {
+		return path, nil
+	}
+
+	n := strings.IndexByte(tail, '/')
+	if n < 0 {
+		return path, nil
+	}
+	tenant := tail[:n]
+	tail = tail[n+1:]
+	if !strings.Contains(tenant, ":") {
+		// Try parsing accountID/projectID/ form
+		if n := strings.IndexByte(tail, '/'); n > 0 && isDecimalString(tail[:n]) {
+			tenant += ":" + tail[:n]
+			tail = tail[n+1:]
+		}
+	}
+	tenantID, err := ParseTenantID(tenant)
+	if err != nil {
+		return path, fmt.Errorf("cannot parse tenant from the path %q: %w", path, err)
+	}
+
+	if HasTenantInRequest(r) {
+		tenantIDHeader, err := GetTenantIDFromRequest(r)
+		if err != nil {
+			return path, err
+		}
+		if tenantIDHeader != tenantID {
+			return path, fmt.Errorf("tenant %s at the path %q doesn't match tenant %s at request headers", tenantID, path, tenantIDHeader)
+		}
+	}
+	r.Header.Set("AccountID", strconv.FormatUint(uint64(tenantID.AccountID), 10))
+	r.Header.Set("ProjectID", strconv.FormatUint(uint64(tenantID.ProjectID), 10))
+
+	path = prefix + tail
+	r.URL.Path = path
+	return path, nil
+}
+
+func isDecimalString(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
 // ParseTenantID returns tenantID from s.
 //
 // s is expected in the form of accountID:projectID. If s is empty, then zero tenantID is returned.
@@ -1,6 +1,8 @@
 package logstorage
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 )
@@ -169,3 +171,109 @@ func TestMarshalUnmarshalTenantIDsAsJSON(t *testing.T) {
 		t.Fatalf("unexpected tenantIDs after unmarshaling\ngot\n%#v\nwant\n%#v", result, tenantIDs)
 	}
 }
+
+func TestGetTenantIDFromRequest(t *testing.T) {
+	f := func(headers map[string]string, tenantIDExpected TenantID) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, "/select/logsql/query", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		tenantID, err := GetTenantIDFromRequest(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if tenantID != tenantIDExpected {
+			t.Fatalf("unexpected tenantID; got %s; want %s", tenantID, tenantIDExpected)
+		}
+	}
+
+	f(nil, TenantID{})
+	f(map[string]string{"AccountID": "12"}, TenantID{AccountID: 12})
+	f(map[string]string{"AccountID": "12", "ProjectID": "34"}, TenantID{AccountID: 12, ProjectID: 34})
+	f(map[string]string{"X-Scope-OrgID": "12"}, TenantID{AccountID: 12})
+	f(map[string]string{"X-Scope-OrgID": "12:34"}, TenantID{AccountID: 12, ProjectID: 34})
+
+	// AccountID and ProjectID headers have priority over X-Scope-OrgID header
+	f(map[string]string{"X-Scope-OrgID": "12:34", "ProjectID": "5"}, TenantID{ProjectID: 5})
+
+	// invalid X-Scope-OrgID
+	r := httptest.NewRequest(http.MethodGet, "/select/logsql/query", nil)
+	r.Header.Set("X-Scope-OrgID", "tenant-a")
+	if _, err := GetTenantIDFromRequest(r); err == nil {
+		t.Fatalf("expecting non-nil error for invalid X-Scope-OrgID header")
+	}
+}
+
+func TestStripTenantFromPathSuccess(t *testing.T) {
+	f := func(path, prefix string, headers map[string]string, pathExpected string, tenantIDExpected TenantID) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		result, err := StripTenantFromPath(r, path, prefix)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != pathExpected {
+			t.Fatalf("unexpected path; got %q; want %q", result, pathExpected)
+		}
+		if r.URL.Path != pathExpected {
+			t.Fatalf("unexpected r.URL.Path; got %q; want %q", r.URL.Path, pathExpected)
+		}
+		tenantID, err := GetTenantIDFromRequest(r)
+		if err != nil {
+			t.Fatalf("cannot get tenantID: %s", err)
+		}
+		if tenantID != tenantIDExpected {
+			t.Fatalf("unexpected tenantID; got %s; want %s", tenantID, tenantIDExpected)
+		}
+	}
+
+	// no tenant in the path
+	f("/insert/jsonline", "/insert/", nil, "/insert/jsonline", TenantID{})
+	f("/select/logsql/query", "/select/", map[string]string{"AccountID": "3"}, "/select/logsql/query", TenantID{AccountID: 3})
+	f("/select/vmui/", "/select/", nil, "/select/vmui/", TenantID{})
+
+	// accountID/projectID form
+	f("/insert/12/34/jsonline", "/insert/", nil, "/insert/jsonline", TenantID{AccountID: 12, ProjectID: 34})
+	f("/insert/12/34/loki/api/v1/push", "/insert/", nil, "/insert/loki/api/v1/push", TenantID{AccountID: 12, ProjectID: 34})
+
+	// accountID:projectID form
+	f("/select/12:34/logsql/query", "/select/", nil, "/select/logsql/query", TenantID{AccountID: 12, ProjectID: 34})
+
+	// accountID form
+	f("/select/12/logsql/query", "/select/", nil, "/select/logsql/query", TenantID{AccountID: 12})
+	f("/delete/7/run_task", "/delete/", nil, "/delete/run_task", TenantID{AccountID: 7})
+
+	// matching headers
+	f("/insert/12/34/jsonline", "/insert/", map[string]string{"AccountID": "12", "ProjectID": "34"}, "/insert/jsonline", TenantID{AccountID: 12, ProjectID: 34})
+	f("/insert/12/34/jsonline", "/insert/", map[string]string{"X-Scope-OrgID": "12:34"}, "/insert/jsonline", TenantID{AccountID: 12, ProjectID: 34})
+}
+
+func TestStripTenantFromPathFailure(t *testing.T) {
+	f := func(path, prefix string, headers map[string]string) {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		if _, err := StripTenantFromPath(r, path, prefix); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// too big accountID
+	f("/insert/12345678901/jsonline", "/insert/", nil)
+
+	// invalid projectID
+	f("/select/1:foo/logsql/query", "/select/", nil)
+
+	// mismatched headers
+	f("/insert/12/34/jsonline", "/insert/", map[string]string{"AccountID": "1"})
+	f("/select/12:34/logsql/query", "/select/", map[string]string{"X-Scope-OrgID": "12"})
+}
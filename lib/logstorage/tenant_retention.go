@@ -0,0 +1,219 @@
+package logstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+)
+
+// TenantRetentionTask describes logs' deletion, which must be performed in order to apply
+// per-tenant retention or in order to delete inactive tenants.
+//
+// See https://docs.victoriametrics.com/victorialogs/#per-tenant-retention
+type TenantRetentionTask struct {
+	// TenantID is the tenant to delete logs for.
+	TenantID TenantID `json:"tenant_id"`
+
+	// Reason is the reason for logs' deletion. It is either "retention" or "inactive".
+	Reason string `json:"reason"`
+
+	// Filter is the filter for logs to delete.
+	Filter string `json:"filter"`
+}
+
+// MarshalTenantRetentionTasksToJSON marshals tasks into a JSON array and returns the result
+func MarshalTenantRetentionTasksToJSON(tasks []*TenantRetentionTask) []byte {
+	if tasks == nil {
+		// This is needed in order to return `[]` instead of `null` to the client.
+		tasks = []*TenantRetentionTask{}
+	}
+	// Do not escape '<' in filters, since this complicates reading the returned tasks.
+	var bb bytes.Buffer
+	enc := json.NewEncoder(&bb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(tasks); err != nil {
+		logger.Panicf("BUG: cannot marshal tasks: %s", err)
+	}
+	return bytes.TrimSuffix(bb.Bytes(), []byte("\n"))
+}
+
+// taskIDPrefix returns the prefix for delete task ids registered for trt.
+func (trt *TenantRetentionTask) taskIDPrefix() string {
+	return fmt.Sprintf("tenant_%s_%d_%d_", trt.Reason, trt.TenantID.AccountID, trt.TenantID.ProjectID)
+}
+
+// GetTenantRetentionTasks returns tasks, which must be executed at the given timestamp now
+// in order to apply per-tenant retention and to delete inactive tenants.
+//
+// The returned tasks aren't executed. They are executed automatically in background
+// if StorageConfig.TenantRetentions or StorageConfig.InactiveTenantRetention is set.
+func (s *Storage) GetTenantRetentionTasks(ctx context.Context, now int64) ([]*TenantRetentionTask, error) {
+	var tasks []*TenantRetentionTask
+
+	var inactiveTenantIDs []TenantID
+	if s.inactiveTenantRetention > 0 {
+		allTenantIDs, err := s.GetTenantIDs(ctx, math.MinInt64, math.MaxInt64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain tenants: %w", err)
+		}
+		activeTenantIDs, err := s.GetTenantIDs(ctx, now-s.inactiveTenantRetention.Nanoseconds(), math.MaxInt64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain active tenants: %w", err)
+		}
+		sortTenantIDs(allTenantIDs)
+		for _, tenantID := range allTenantIDs {
+			if slices.Contains(activeTenantIDs, tenantID) {
+				continue
+			}
+			inactiveTenantIDs = append(inactiveTenantIDs, tenantID)
+
+			// The tenant may be still registered in the index after all its logs were deleted,
+			// so verify whether there are logs to delete.
+			task := &TenantRetentionTask{
+				TenantID: tenantID,
+				Reason:   "inactive",
+				Filter:   "*",
+			}
+			ok, err := s.hasTenantRetentionLogs(ctx, task, now)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+
+	tenantIDs := make([]TenantID, 0, len(s.tenantRetentions))
+	for tenantID := range s.tenantRetentions {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sortTenantIDs(tenantIDs)
+	for _, tenantID := range tenantIDs {
+		if slices.Contains(inactiveTenantIDs, tenantID) {
+			// All the logs for the given tenant are going to be deleted.
+			continue
+		}
+
+		retention := s.tenantRetentions[tenantID]
+		deadlineTsf := TimeFormatter(now - retention.Nanoseconds())
+		task := &TenantRetentionTask{
+			TenantID: tenantID,
+			Reason:   "retention",
+			Filter:   fmt.Sprintf("_time:<%s", &deadlineTsf),
+		}
+		ok, err := s.hasTenantRetentionLogs(ctx, task, now)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			tasks = append(tasks, task)
+		}
+	}
+
+	return tasks, nil
+}
+
+// hasTenantRetentionLogs returns true if there are logs matching the given task at the given timestamp now.
+func (s *Storage) hasTenantRetentionLogs(ctx context.Context, task *TenantRetentionTask, now int64) (bool, error) {
+	qStr := task.Filter + " | limit 1"
+	q, err := ParseQueryAtTimestamp(qStr, now)
+	if err != nil {
+		logger.Panicf("BUG: cannot parse query [%s] for per-tenant retention: %s", qStr, err)
+	}
+
+	var qs QueryStats
+	qctx := NewQueryContext(ctx, &qs, []TenantID{task.TenantID}, q, false, nil)
+
+	var found atomic.Bool
+	writeBlock := func(_ uint, db *DataBlock) {
+		if db.RowsCount() > 0 {
+			found.Store(true)
+		}
+	}
+	if err := s.RunQuery(qctx, writeBlock); err != nil {
+		return false, fmt.Errorf("cannot check for logs to delete for tenant %s: %w", task.TenantID, err)
+	}
+	return found.Load(), nil
+}
+
+func sortTenantIDs(tenantIDs []TenantID) {
+	sort.Slice(tenantIDs, func(i, j int) bool {
+		return tenantIDs[i].less(&tenantIDs[j])
+	})
+}
+
+func (s *Storage) runTenantRetentionWatcher() {
+	if len(s.tenantRetentions) == 0 && s.inactiveTenantRetention <= 0 {
+		return // nothing to watch
+	}
+	s.wg.Add(1)
+	go func() {
+		s.watchTenantRetention()
+		s.wg.Done()
+	}()
+}
+
+func (s *Storage) watchTenantRetention() {
+	d := timeutil.AddJitterToDuration(time.Hour)
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		s.applyTenantRetention(time.Now().UnixNano())
+
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyTenantRetention registers delete tasks returned from GetTenantRetentionTasks at the given timestamp now.
+//
+// Tasks, which are already registered and aren't finished yet, are skipped.
+func (s *Storage) applyTenantRetention(now int64) {
+	ctx := context.Background()
+	tasks, err := s.GetTenantRetentionTasks(ctx, now)
+	if err != nil {
+		logger.Errorf("cannot obtain per-tenant retention tasks: %s", err)
+		return
+	}
+
+	dts, err := s.DeleteActiveTasks(ctx)
+	if err != nil {
+		logger.Errorf("cannot obtain active delete tasks: %s", err)
+		return
+	}
+
+	for _, task := range tasks {
+		prefix := task.taskIDPrefix()
+		isPending := slices.ContainsFunc(dts, func(dt *DeleteTask) bool {
+			return strings.HasPrefix(dt.TaskID, prefix)
+		})
+		if isPending {
+			continue
+		}
+
+		f, err := ParseFilter(task.Filter)
+		if err != nil {
+			logger.Panicf("BUG: cannot parse filter [%s] for per-tenant retention: %s", task.Filter, err)
+		}
+		taskID := fmt.Sprintf("%s%d", prefix, now)
+		if err := s.DeleteRunTask(ctx, taskID, now, []TenantID{task.TenantID}, f); err != nil {
+			logger.Errorf("cannot register delete task for tenant %s: %s", task.TenantID, err)
+			continue
+		}
+		logger.Infof("scheduled deletion of logs for tenant %s because of %s; task_id=%q, filter=%q", task.TenantID, task.Reason, taskID, task.Filter)
+	}
+}
@@ -0,0 +1,108 @@
+package logstorage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageTenantRetention(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	ctx := t.Context()
+
+	cfg := &StorageConfig{
+		Retention: 30 * 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	now := time.Now().UnixNano()
+
+	activeTenantID := TenantID{
+		AccountID: 123,
+		ProjectID: 456,
+	}
+	inactiveTenantID := TenantID{
+		AccountID: 0,
+		ProjectID: 100,
+	}
+	otherTenantID := TenantID{
+		AccountID: 1,
+		ProjectID: 0,
+	}
+
+	// Store logs for the last 7 days for the active and other tenants, while storing logs older than 3 days for the inactive tenant.
+	lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+	for dayID := int64(0); dayID < 7; dayID++ {
+		for _, tenantID := range []TenantID{activeTenantID, inactiveTenantID, otherTenantID} {
+			if tenantID == inactiveTenantID && dayID < 3 {
+				continue
+			}
+			fields := []Field{
+				{
+					Name:  "host",
+					Value: "host-1",
+				},
+				{
+					Name:  "_msg",
+					Value: fmt.Sprintf("message at the day %d for the tenantID=%s", dayID, tenantID),
+				},
+			}
+			lr.mustAdd(tenantID, now-dayID*nsecsPerDay-time.Minute.Nanoseconds(), fields)
+		}
+	}
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	s.tenantRetentions = map[TenantID]time.Duration{
+		activeTenantID: 2 * 24 * time.Hour,
+	}
+	s.inactiveTenantRetention = 2 * 24 * time.Hour
+
+	// Verify the dry-run report
+	tasks, err := s.GetTenantRetentionTasks(ctx, now)
+	if err != nil {
+		t.Fatalf("unexpected error in GetTenantRetentionTasks: %s", err)
+	}
+	deadlineTsf := TimeFormatter(now - 2*nsecsPerDay)
+	result := MarshalTenantRetentionTasksToJSON(tasks)
+	resultExpected := fmt.Sprintf(`[{"tenant_id":{"account_id":0,"project_id":100},"reason":"inactive","filter":"*"},`+
+		`{"tenant_id":{"account_id":123,"project_id":456},"reason":"retention","filter":"_time:<%s"}]`, &deadlineTsf)
+	if string(result) != resultExpected {
+		t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// Apply the retention and wait until the registered delete tasks are processed
+	s.applyTenantRetention(now)
+	for {
+		dts, err := s.DeleteActiveTasks(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error in DeleteActiveTasks: %s", err)
+		}
+		if len(dts) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	checkQueryResults(t, s, []TenantID{inactiveTenantID}, "* | count() rows", nil, []string{`{"rows":"0"}`})
+	checkQueryResults(t, s, []TenantID{activeTenantID}, "* | count() rows", nil, []string{`{"rows":"2"}`})
+	checkQueryResults(t, s, []TenantID{otherTenantID}, "* | count() rows", nil, []string{`{"rows":"7"}`})
+
+	// Verify that there are no more tasks to execute
+	tasks, err = s.GetTenantRetentionTasks(ctx, now)
+	if err != nil {
+		t.Fatalf("unexpected error in GetTenantRetentionTasks: %s", err)
+	}
+	if result := MarshalTenantRetentionTasksToJSON(tasks); string(result) != "[]" {
+		t.Fatalf("unexpected tasks after applying the retention: %s", result)
+	}
+
+	s.MustClose()
+
+	fs.MustRemoveDir(path)
+}
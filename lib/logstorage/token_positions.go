@@ -0,0 +1,86 @@
+package logstorage
+
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+)
+
+// MaxTokenPositionsDistance is the maximum distance between tokens, which can be stored in the token positions index.
+//
+// See StorageConfig.TokenPositionsMaxDistance for details.
+const MaxTokenPositionsDistance = 8
+
+// maxBloomFilterItems is the maximum number of items, which can be stored in a single bloom filter block.
+const maxBloomFilterItems = maxBloomFilterBlockSize * 8 / bloomFilterBitsPerItem
+
+// tokenizeTokenPairsHashes appends hashes for pairs of tokens located at distance up to maxDistance in every value from a.
+//
+// The hashes are appended to dst, which must be already filled by tokenizeHashes(dst, a).
+// The returned hashes must be passed to bloomFilterMarshalHashes in order to build bloom filters.
+//
+// The hashes for the pairs of tokens can be then verified with appendTokenPairHashes.
+func tokenizeTokenPairsHashes(dst []uint64, a []string, maxDistance int) []uint64 {
+	t := getTokenizer()
+	ht := getHashTokenizer()
+	var tokens []string
+	var key []byte
+	for i, s := range a {
+		if i > 0 && s == a[i-1] {
+			// This string has been already tokenized
+			continue
+		}
+		tokens = t.tokenizeString(tokens[:0], s, true)
+		for j, tokenFirst := range tokens {
+			for d := 1; d <= maxDistance && j+d < len(tokens); d++ {
+				key = marshalTokenPairKey(key[:0], tokenFirst, tokens[j+d], d)
+				if h, ok := ht.addToken(bytesutil.ToUnsafeString(key)); ok {
+					dst = append(dst, h)
+				}
+			}
+		}
+	}
+	putHashTokenizer(ht)
+	putTokenizer(t)
+
+	return dst
+}
+
+// appendTokenPairHashes appends bloom filter hashes for the pair of tokens (tokenFirst, tokenSecond) located at the given distance to dst.
+//
+// The appended hashes can be then passed to bloomFilter.containsAll().
+func appendTokenPairHashes(dst []uint64, tokenFirst, tokenSecond string, distance int) []uint64 {
+	key := marshalTokenPairKey(nil, tokenFirst, tokenSecond, distance)
+	return appendTokensHashes(dst, []string{bytesutil.ToUnsafeString(key)})
+}
+
+// appendAdjacentTokenPairsHashes appends bloom filter hashes for all the adjacent tokens in s to dst.
+//
+// The appended hashes can be then passed to bloomFilter.containsAll().
+func appendAdjacentTokenPairsHashes(dst []uint64, s string) []uint64 {
+	t := getTokenizer()
+	tokens := t.tokenizeString(nil, s, true)
+	putTokenizer(t)
+
+	for i := 1; i < len(tokens); i++ {
+		dst = appendTokenPairHashes(dst, tokens[i-1], tokens[i], 1)
+	}
+	return dst
+}
+
+func marshalTokenPairKey(dst []byte, tokenFirst, tokenSecond string, distance int) []byte {
+	// Tokens cannot contain zero bytes, so they are used as delimiters.
+	dst = append(dst, tokenFirst...)
+	dst = append(dst, 0)
+	dst = append(dst, tokenSecond...)
+	dst = append(dst, 0, byte(distance))
+	return dst
+}
+
+// matchBloomFilterTokenPairs returns false if the bloom filter for ch guarantees that the values in the block
+// have no adjacent tokens for the given tokenPairs generated by appendAdjacentTokenPairsHashes.
+func matchBloomFilterTokenPairs(bs *blockSearch, ch *columnHeader, tokenPairs []uint64) bool {
+	if ch.tokenPositionsMaxDistance < 1 {
+		// The block has no token positions index.
+		return true
+	}
+	return matchBloomFilterAllTokens(bs, ch, tokenPairs)
+}
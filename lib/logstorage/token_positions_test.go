@@ -0,0 +1,86 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestTokenizeTokenPairsHashes(t *testing.T) {
+	f := func(values []string, maxDistance int, phrase string, resultExpected bool) {
+		t.Helper()
+
+		hashes := tokenizeHashes(nil, values)
+		hashes = tokenizeTokenPairsHashes(hashes, values, maxDistance)
+		data := bloomFilterMarshalHashes(nil, hashes)
+
+		bf := getBloomFilter()
+		defer putBloomFilter(bf)
+		if err := bf.unmarshal(data); err != nil {
+			t.Fatalf("unexpected error when unmarshaling bloom filter: %s", err)
+		}
+
+		tokenPairs := appendAdjacentTokenPairsHashes(nil, phrase)
+		result := bf.containsAll(tokenPairs)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for phrase %q; got %v; want %v", phrase, result, resultExpected)
+		}
+	}
+
+	values := []string{
+		"foo bar baz",
+		"error: connection refused",
+		"error: connection refused",
+		"тест ошибка соединения",
+	}
+
+	// adjacent tokens
+	f(values, 1, "foo bar", true)
+	f(values, 1, "bar baz", true)
+	f(values, 1, "foo bar baz", true)
+	f(values, 1, "error: connection refused", true)
+	f(values, 1, "ошибка соединения", true)
+
+	// tokens in the wrong order
+	f(values, 1, "bar foo", false)
+	f(values, 1, "refused connection", false)
+
+	// non-adjacent tokens
+	f(values, 1, "foo baz", false)
+	f(values, 1, "baz error", false)
+
+	// single-token phrase doesn't need token pairs
+	f(values, 1, "foo", true)
+}
+
+func TestAppendTokenPairHashesDistance(t *testing.T) {
+	values := []string{"foo bar baz qwe"}
+	hashes := tokenizeHashes(nil, values)
+	hashes = tokenizeTokenPairsHashes(hashes, values, 2)
+	data := bloomFilterMarshalHashes(nil, hashes)
+
+	bf := getBloomFilter()
+	defer putBloomFilter(bf)
+	if err := bf.unmarshal(data); err != nil {
+		t.Fatalf("unexpected error when unmarshaling bloom filter: %s", err)
+	}
+
+	f := func(tokenFirst, tokenSecond string, distance int, resultExpected bool) {
+		t.Helper()
+
+		tokenPair := appendTokenPairHashes(nil, tokenFirst, tokenSecond, distance)
+		result := bf.containsAll(tokenPair)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for (%q, %q, %d); got %v; want %v", tokenFirst, tokenSecond, distance, result, resultExpected)
+		}
+	}
+
+	f("foo", "bar", 1, true)
+	f("foo", "baz", 2, true)
+	f("bar", "qwe", 2, true)
+
+	// the distance mismatch
+	f("foo", "bar", 2, false)
+	f("foo", "baz", 1, false)
+
+	// the distance exceeds the max distance
+	f("foo", "qwe", 3, false)
+}
@@ -24,6 +24,8 @@ const (
 	valueTypeUnknown = valueType(0)
 
 	// default encoding for column blocks. Strings are stored as is.
+	// The minimum and maximum numeric values seen in the strings are stored as float64 in columnHeader.
+	// See getNumericRange for details.
 	valueTypeString = valueType(1)
 
 	// column blocks with small number of unique values are encoded as dict.
@@ -110,7 +112,8 @@ func (ve *valuesEncoder) encode(values []string, dict *valuesDict) (valueType, u
 	ve.reset()
 
 	if len(values) == 0 {
-		return valueTypeString, 0, 0
+		minValue, maxValue := getNumericRange(values)
+		return valueTypeString, minValue, maxValue
 	}
 
 	var vt valueType
@@ -150,7 +153,46 @@ func (ve *valuesEncoder) encode(values []string, dict *valuesDict) (valueType, u
 
 	// Fall back to default encoding, e.g. leave values as is.
 	ve.values = append(ve.values[:0], values...)
-	return valueTypeString, 0, 0
+	minValue, maxValue = getNumericRange(values)
+	return valueTypeString, minValue, maxValue
+}
+
+// getNumericRange returns the minimum and the maximum numeric values across the given values.
+//
+// Values are parsed with parseMathNumber, so numbers, durations, byte sizes, timestamps and IPv4 addresses are taken into account
+// in the same way as range filters do. Empty values are skipped, since they do not match range filters.
+//
+// The range covering all the numeric values is returned if some value cannot be parsed, since such values are usually
+// arbitrary text such as _msg field. This avoids parsing every value in such columns during data ingestion.
+//
+// The returned values are encoded via math.Float64bits. The minimum value exceeds the maximum value if values have no numeric values.
+func getNumericRange(values []string) (uint64, uint64) {
+	minValue := math.Inf(1)
+	maxValue := math.Inf(-1)
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		f := parseMathNumber(v)
+		if math.IsNaN(f) {
+			return getUnknownNumericRange()
+		}
+		if f < minValue {
+			minValue = f
+		}
+		if f > maxValue {
+			maxValue = f
+		}
+	}
+	return math.Float64bits(minValue), math.Float64bits(maxValue)
+}
+
+// getUnknownNumericRange returns the numeric range for valueTypeString columns with unknown numeric values.
+//
+// This is the case for parts with format versions older than 4 and for columns with non-numeric values. See getNumericRange.
+// The returned range covers all the numeric values.
+func getUnknownNumericRange() (uint64, uint64) {
+	return math.Float64bits(math.Inf(-1)), math.Float64bits(math.Inf(1))
 }
 
 func getValuesEncoder() *valuesEncoder {
@@ -40,14 +40,31 @@ func TestValuesEncoder(t *testing.T) {
 	}
 
 	// An empty values list
-	f(nil, valueTypeString, 0, 0)
+	f(nil, valueTypeString, math.Float64bits(math.Inf(1)), math.Float64bits(math.Inf(-1)))
 
 	// string values
 	values := make([]string, maxDictLen+1)
 	for i := range values {
 		values[i] = fmt.Sprintf("value_%d", i)
 	}
-	f(values, valueTypeString, 0, 0)
+	f(values, valueTypeString, math.Float64bits(math.Inf(-1)), math.Float64bits(math.Inf(1)))
+
+	// string values with durations
+	for i := range values {
+		values[i] = fmt.Sprintf("%dms", i+1)
+	}
+	f(values, valueTypeString, math.Float64bits(1e6), math.Float64bits(float64(len(values))*1e6))
+
+	// string values with byte sizes mixed with non-numeric values
+	for i := range values {
+		values[i] = fmt.Sprintf("%dKB", i+1)
+	}
+	values[0] = "foo"
+	f(values, valueTypeString, math.Float64bits(math.Inf(-1)), math.Float64bits(math.Inf(1)))
+
+	// string values with byte sizes mixed with empty values
+	values[0] = ""
+	f(values, valueTypeString, math.Float64bits(2000), math.Float64bits(float64(len(values))*1000))
 
 	// dict values
 	f([]string{"foobar"}, valueTypeDict, 0, 0)
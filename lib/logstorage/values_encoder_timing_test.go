@@ -6,6 +6,54 @@ import (
 	"testing"
 )
 
+func BenchmarkValuesEncoder(b *testing.B) {
+	const valuesCount = 1000
+
+	b.Run("messages", func(b *testing.B) {
+		values := make([]string, valuesCount)
+		for i := range values {
+			values[i] = fmt.Sprintf("GET /api/v1/users/%d HTTP/1.1 200 %d bytes in %dms", i, i*123, i%100)
+		}
+		benchmarkValuesEncoder(b, values)
+	})
+	b.Run("durations", func(b *testing.B) {
+		values := make([]string, valuesCount)
+		for i := range values {
+			values[i] = fmt.Sprintf("%d.%dms", i, i%10)
+		}
+		benchmarkValuesEncoder(b, values)
+	})
+	b.Run("numbers-then-text", func(b *testing.B) {
+		values := make([]string, valuesCount)
+		for i := range values {
+			if i < valuesCount/2 {
+				values[i] = fmt.Sprintf("%dKB", i)
+			} else {
+				values[i] = fmt.Sprintf("value_%d", i)
+			}
+		}
+		benchmarkValuesEncoder(b, values)
+	})
+}
+
+func benchmarkValuesEncoder(b *testing.B, values []string) {
+	b.SetBytes(int64(len(values)))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		ve := getValuesEncoder()
+		defer putValuesEncoder(ve)
+
+		var dict valuesDict
+		var n uint64
+		for pb.Next() {
+			dict.reset()
+			vt, minValue, maxValue := ve.encode(values, &dict)
+			n += uint64(vt) + minValue + maxValue
+		}
+		GlobalSink.Add(n)
+	})
+}
+
 func BenchmarkTryParseTimestampRFC3339Nano(b *testing.B) {
 	a := []string{
 		"2023-01-15T23:45:51Z",
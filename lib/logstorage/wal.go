@@ -0,0 +1,424 @@
+package logstorage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
+	"github.com/cespare/xxhash/v2"
+)
+
+// WALSyncPolicy is the policy for syncing the write-ahead log to disk.
+type WALSyncPolicy int
+
+const (
+	// WALSyncPolicyInterval syncs the write-ahead log to disk every StorageConfig.WALSyncInterval.
+	//
+	// Logs added during the last WALSyncInterval may be lost on power loss.
+	WALSyncPolicyInterval WALSyncPolicy = iota
+
+	// WALSyncPolicyAlways syncs the write-ahead log to disk before returning from Storage.MustAddRows.
+	//
+	// This guarantees that the added logs survive power loss at the cost of higher disk IO.
+	WALSyncPolicyAlways
+
+	// WALSyncPolicyNone never syncs the write-ahead log to disk explicitly and relies on the operating system instead.
+	//
+	// The added logs survive process crash, but may be lost on power loss.
+	WALSyncPolicyNone
+)
+
+// ParseWALSyncPolicy parses WALSyncPolicy from s.
+func ParseWALSyncPolicy(s string) (WALSyncPolicy, error) {
+	switch s {
+	case "interval":
+		return WALSyncPolicyInterval, nil
+	case "always":
+		return WALSyncPolicyAlways, nil
+	case "none":
+		return WALSyncPolicyNone, nil
+	default:
+		return 0, fmt.Errorf("unsupported WAL sync policy %q; supported values: interval, always, none", s)
+	}
+}
+
+// String returns string representation of p.
+func (p WALSyncPolicy) String() string {
+	switch p {
+	case WALSyncPolicyInterval:
+		return "interval"
+	case WALSyncPolicyAlways:
+		return "always"
+	case WALSyncPolicyNone:
+		return "none"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(p))
+	}
+}
+
+// wal is a write-ahead log for the logs added to Storage.
+//
+// The logs added to the Storage are kept in memory for up to a few seconds before being written to disk.
+// The wal persists the added logs before they are added to the Storage, so they can be recovered
+// after unclean shutdown. The wal consists of segment files, which are rotated every flush interval.
+// Segments are removed after the logs from them are written to disk parts.
+type wal struct {
+	// path is the path to the directory with wal segments.
+	path string
+
+	// syncPolicy is the policy for syncing wal segments to disk.
+	syncPolicy WALSyncPolicy
+
+	// rotateLock must be held for reading while logs are written to wal and are added to the Storage.
+	// It is held for writing during segment rotation. This guarantees that all the logs from the rotated segments are already added to the Storage.
+	rotateLock sync.RWMutex
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// f is the current segment file.
+	f *os.File
+
+	// segmentIdx is the index of the current segment.
+	segmentIdx uint64
+
+	// needSync is set to true if f contains data, which isn't synced to disk yet.
+	needSync bool
+
+	bytesWritten atomic.Uint64
+	syncs        atomic.Uint64
+}
+
+// walRecordHeaderSize is the size of the header for every wal record.
+//
+// The header contains the payload length and the payload checksum.
+const walRecordHeaderSize = 16
+
+// maxWALRecordSize is the maximum size of a single wal record payload.
+//
+// It protects from excess memory allocations when reading corrupted wal segments.
+const maxWALRecordSize = 1 << 30
+
+func mustOpenWAL(path string, syncPolicy WALSyncPolicy) *wal {
+	fs.MustMkdirIfNotExist(path)
+
+	segmentIdx := uint64(0)
+	for _, idx := range mustGetWALSegmentIdxs(path) {
+		segmentIdx = max(segmentIdx, idx)
+	}
+
+	w := &wal{
+		path:       path,
+		syncPolicy: syncPolicy,
+	}
+	w.mustOpenSegmentLocked(segmentIdx + 1)
+	return w
+}
+
+func (w *wal) mustOpenSegmentLocked(segmentIdx uint64) {
+	segmentPath := filepath.Join(w.path, getWALSegmentName(segmentIdx))
+	f, err := os.OpenFile(segmentPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		logger.Panicf("FATAL: cannot create wal segment: %s", err)
+	}
+	fs.MustSyncPath(w.path)
+
+	w.f = f
+	w.segmentIdx = segmentIdx
+	w.needSync = false
+}
+
+func (w *wal) mustCloseSegmentLocked() {
+	w.mustSyncLocked()
+	if err := w.f.Close(); err != nil {
+		logger.Panicf("FATAL: cannot close wal segment %q: %s", w.f.Name(), err)
+	}
+	w.f = nil
+}
+
+// mustWriteRows writes lr to w.
+//
+// w.rotateLock must be held for reading by the caller until lr is added to the Storage.
+func (w *wal) mustWriteRows(lr *LogRows) {
+	bb := walBufPool.Get()
+	bb.B = marshalWALRecord(bb.B[:0], lr)
+
+	w.mu.Lock()
+	if _, err := w.f.Write(bb.B); err != nil {
+		logger.Panicf("FATAL: cannot write %d bytes to wal segment %q: %s", len(bb.B), w.f.Name(), err)
+	}
+	w.needSync = true
+	if w.syncPolicy == WALSyncPolicyAlways {
+		w.mustSyncLocked()
+	}
+	w.mu.Unlock()
+
+	w.bytesWritten.Add(uint64(len(bb.B)))
+	walBufPool.Put(bb)
+}
+
+var walBufPool bytesutil.ByteBufferPool
+
+// mustSync syncs the current segment to disk if it contains unsynced data.
+func (w *wal) mustSync() {
+	w.mu.Lock()
+	w.mustSyncLocked()
+	w.mu.Unlock()
+}
+
+func (w *wal) mustSyncLocked() {
+	if !w.needSync || w.syncPolicy == WALSyncPolicyNone {
+		return
+	}
+	if err := w.f.Sync(); err != nil {
+		logger.Panicf("FATAL: cannot sync wal segment %q: %s", w.f.Name(), err)
+	}
+	w.needSync = false
+	w.syncs.Add(1)
+}
+
+// mustRotate closes the current segment and opens a new one.
+//
+// It returns the index of the new segment. All the logs written to the previous segments are added to the Storage when mustRotate returns.
+func (w *wal) mustRotate() uint64 {
+	w.rotateLock.Lock()
+	defer w.rotateLock.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.mustCloseSegmentLocked()
+	w.mustOpenSegmentLocked(w.segmentIdx + 1)
+	return w.segmentIdx
+}
+
+// mustRemoveSegmentsBefore removes segments with indexes smaller than segmentIdx.
+func (w *wal) mustRemoveSegmentsBefore(segmentIdx uint64) {
+	mustRemoveWALSegmentsBefore(w.path, segmentIdx)
+}
+
+func (w *wal) mustClose() {
+	w.mu.Lock()
+	w.mustCloseSegmentLocked()
+	w.mu.Unlock()
+}
+
+func marshalWALRecord(dst []byte, lr *LogRows) []byte {
+	dstLen := len(dst)
+	dst = append(dst, make([]byte, walRecordHeaderSize)...)
+
+	dst = encoding.MarshalVarUint64(dst, uint64(len(lr.timestamps)))
+	lr.ForEachRow(func(_ uint64, r *InsertRow) {
+		dst = r.Marshal(dst)
+	})
+
+	payload := dst[dstLen+walRecordHeaderSize:]
+	header := dst[dstLen : dstLen+walRecordHeaderSize]
+	binary.BigEndian.PutUint64(header, uint64(len(payload)))
+	binary.BigEndian.PutUint64(header[8:], xxhash.Sum64(payload))
+	return dst
+}
+
+// unmarshalWALRecordPayload calls addRow for every row from the wal record payload src.
+func unmarshalWALRecordPayload(src []byte, addRow func(r *InsertRow)) error {
+	rowsCount, n := encoding.UnmarshalVarUint64(src)
+	if n <= 0 {
+		return fmt.Errorf("cannot unmarshal the number of rows")
+	}
+	src = src[n:]
+
+	r := GetInsertRow()
+	defer PutInsertRow(r)
+
+	for i := uint64(0); i < rowsCount; i++ {
+		tail, err := r.UnmarshalInplace(src)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal row #%d: %w", i, err)
+		}
+		src = tail
+		addRow(r)
+	}
+	if len(src) > 0 {
+		return fmt.Errorf("unexpected tail left after unmarshaling %d rows; len(tail)=%d", rowsCount, len(src))
+	}
+	return nil
+}
+
+// mustReplayWAL adds logs from wal segments at the given path to s.
+//
+// It returns the number of replayed logs.
+func (s *Storage) mustReplayWAL(path string) uint64 {
+	lr := GetLogRows(nil, nil, nil, nil, "")
+	defer PutLogRows(lr)
+
+	rowsReplayed := uint64(0)
+	for _, segmentIdx := range mustGetWALSegmentIdxs(path) {
+		segmentPath := filepath.Join(path, getWALSegmentName(segmentIdx))
+		err := readWALSegment(segmentPath, func(payload []byte) error {
+			return unmarshalWALRecordPayload(payload, func(r *InsertRow) {
+				lr.MustAddInsertRow(r)
+				rowsReplayed++
+				if lr.NeedFlush() {
+					s.mustAddRows(lr)
+					lr.ResetKeepSettings()
+				}
+			})
+		})
+		if err != nil {
+			// The segment tail may be corrupted on unclean shutdown while the record was written to it. Skip the corrupted tail.
+			logger.Warnf("skipping the remaining contents of wal segment %q: %s", segmentPath, err)
+		}
+	}
+	s.mustAddRows(lr)
+
+	return rowsReplayed
+}
+
+// readWALSegment calls f for every record payload from the wal segment at segmentPath.
+func readWALSegment(segmentPath string, f func(payload []byte) error) error {
+	file, err := os.Open(segmentPath)
+	if err != nil {
+		return fmt.Errorf("cannot open wal segment: %w", err)
+	}
+	defer fs.MustClose(file)
+
+	br := bufio.NewReaderSize(file, 64*1024)
+	var header [walRecordHeaderSize]byte
+	var payload []byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("cannot read record header: %w", err)
+		}
+		payloadLen := encoding.UnmarshalUint64(header[:])
+		checksum := encoding.UnmarshalUint64(header[8:])
+		if payloadLen > maxWALRecordSize {
+			return fmt.Errorf("too big record size: %d bytes; mustn't exceed %d bytes", payloadLen, maxWALRecordSize)
+		}
+
+		payload = slicesutil.SetLength(payload, int(payloadLen))
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return fmt.Errorf("cannot read record payload with the size %d bytes: %w", payloadLen, err)
+		}
+		if h := xxhash.Sum64(payload); h != checksum {
+			return fmt.Errorf("checksum mismatch for record payload with the size %d bytes; got %016X; want %016X", payloadLen, h, checksum)
+		}
+		if err := f(payload); err != nil {
+			return fmt.Errorf("cannot parse record payload: %w", err)
+		}
+	}
+}
+
+func getWALSegmentName(segmentIdx uint64) string {
+	return fmt.Sprintf("%016X", segmentIdx)
+}
+
+// mustGetWALSegmentIdxs returns sorted indexes for wal segments at the given path.
+func mustGetWALSegmentIdxs(path string) []uint64 {
+	if !fs.IsPathExist(path) {
+		return nil
+	}
+
+	var idxs []uint64
+	for _, de := range fs.MustReadDir(path) {
+		name := de.Name()
+		idx, err := strconv.ParseUint(name, 16, 64)
+		if err != nil || !de.Type().IsRegular() {
+			logger.Warnf("skipping unexpected file %q in wal directory %q", name, path)
+			continue
+		}
+		idxs = append(idxs, idx)
+	}
+	sort.Slice(idxs, func(i, j int) bool {
+		return idxs[i] < idxs[j]
+	})
+	return idxs
+}
+
+func mustRemoveWALSegmentsBefore(path string, segmentIdx uint64) {
+	removed := false
+	for _, idx := range mustGetWALSegmentIdxs(path) {
+		if idx >= segmentIdx {
+			continue
+		}
+		fs.MustRemovePath(filepath.Join(path, getWALSegmentName(idx)))
+		removed = true
+	}
+	if removed {
+		fs.MustSyncPath(path)
+	}
+}
+
+func (s *Storage) runWALWatcher(syncInterval time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		s.watchWAL(syncInterval)
+		s.wg.Done()
+	}()
+}
+
+func (s *Storage) watchWAL(syncInterval time.Duration) {
+	var syncTickerCh <-chan time.Time
+	if s.wal.syncPolicy == WALSyncPolicyInterval {
+		syncTicker := time.NewTicker(syncInterval)
+		defer syncTicker.Stop()
+		syncTickerCh = syncTicker.C
+	}
+
+	// Do not add jitter to the checkpoint interval in order to guarantee the maximum size of wal.
+	checkpointTicker := time.NewTicker(s.flushInterval)
+	defer checkpointTicker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-syncTickerCh:
+			s.wal.mustSync()
+		case <-checkpointTicker.C:
+			s.mustCheckpointWAL()
+		}
+	}
+}
+
+// mustCheckpointWAL rotates the wal segment, writes the logs from the previous segments to disk parts and removes outdated segments.
+func (s *Storage) mustCheckpointWAL() {
+	segmentIdx := s.wal.mustRotate()
+
+	s.mustFlushPartitionsToFiles()
+
+	// Keep the previous segment, since its logs may be still located in in-memory parts, which were merged
+	// while mustFlushPartitionsToFiles was running. They are flushed to disk during the next checkpoint.
+	s.wal.mustRemoveSegmentsBefore(segmentIdx - 1)
+}
+
+// mustFlushPartitionsToFiles writes all the logs added to s to disk parts.
+func (s *Storage) mustFlushPartitionsToFiles() {
+	s.partitionsLock.Lock()
+	ptws := append([]*partitionWrapper{}, s.partitions...)
+	for _, ptw := range ptws {
+		ptw.incRef()
+	}
+	s.partitionsLock.Unlock()
+
+	for _, ptw := range ptws {
+		ptw.pt.mustFlushToFiles()
+		ptw.decRef()
+	}
+}
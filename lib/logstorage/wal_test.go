@@ -0,0 +1,185 @@
+package logstorage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestParseWALSyncPolicy(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		p, err := ParseWALSyncPolicy(s)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		if result := p.String(); result != s {
+			t.Fatalf("unexpected string representation; got %q; want %q", result, s)
+		}
+	}
+
+	f("interval")
+	f("always")
+	f("none")
+
+	if _, err := ParseWALSyncPolicy("foo"); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported policy")
+	}
+}
+
+func TestStorageWALReplay(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	cfg := &StorageConfig{
+		Retention:     time.Duration(100 * 365 * nsecsPerDay),
+		EnableWAL:     true,
+		WALSyncPolicy: WALSyncPolicyAlways,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	tenantID := TenantID{
+		AccountID: 12,
+		ProjectID: 34,
+	}
+	baseTimestamp := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+	for i := 0; i < 10; i++ {
+		lr := GetLogRows([]string{"host"}, nil, nil, nil, "")
+		for j := 0; j < 100; j++ {
+			n := i*100 + j
+			lr.MustAdd(tenantID, baseTimestamp+int64(n)*1e9, []Field{
+				{Name: "host", Value: fmt.Sprintf("h%d", n%3)},
+				{Name: "_msg", Value: fmt.Sprintf("message %d", n)},
+			}, -1)
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+	}
+
+	if n := s.wal.bytesWritten.Load(); n == 0 {
+		t.Fatalf("expecting non-zero bytes written to wal")
+	}
+	if n := s.wal.syncs.Load(); n != 10 {
+		t.Fatalf("unexpected number of wal syncs; got %d; want 10", n)
+	}
+
+	// Simulate unclean shutdown by copying wal segments to a fresh storage before the rows are flushed to disk.
+	crashPath := path + "_crash"
+	sCrash := MustOpenStorage(crashPath, &StorageConfig{
+		Retention: cfg.Retention,
+	})
+	sCrash.MustClose()
+
+	walPath := filepath.Join(path, walDirname)
+	crashWALPath := filepath.Join(crashPath, walDirname)
+	fs.MustMkdirIfNotExist(crashWALPath)
+	for _, segmentIdx := range mustGetWALSegmentIdxs(walPath) {
+		segmentName := getWALSegmentName(segmentIdx)
+		data, err := os.ReadFile(filepath.Join(walPath, segmentName))
+		if err != nil {
+			t.Fatalf("cannot read wal segment: %s", err)
+		}
+		fs.MustWriteSync(filepath.Join(crashWALPath, segmentName), data)
+	}
+
+	// Add corrupted tail to the last segment, like after unclean shutdown in the middle of writing wal record.
+	idxs := mustGetWALSegmentIdxs(crashWALPath)
+	if len(idxs) == 0 {
+		t.Fatalf("missing wal segments")
+	}
+	lastSegmentPath := filepath.Join(crashWALPath, getWALSegmentName(idxs[len(idxs)-1]))
+	data, err := os.ReadFile(lastSegmentPath)
+	if err != nil {
+		t.Fatalf("cannot read wal segment: %s", err)
+	}
+	data = append(data, 0, 0, 0, 0, 0, 0, 1, 0, 1, 2, 3)
+	fs.MustWriteSync(lastSegmentPath, data)
+
+	// Gracefully stopped storage must remove wal segments.
+	s.MustClose()
+	if idxs := mustGetWALSegmentIdxs(walPath); len(idxs) > 0 {
+		t.Fatalf("unexpected wal segments left after graceful shutdown: %d", idxs)
+	}
+	fs.MustRemoveDir(path)
+
+	// Open the storage without wal. It must recover the rows from the wal left after the crash and remove the wal.
+	sCrash = MustOpenStorage(crashPath, &StorageConfig{
+		Retention: cfg.Retention,
+	})
+	if fs.IsPathExist(crashWALPath) {
+		t.Fatalf("the wal directory must be removed after the recovery if the wal is disabled")
+	}
+
+	f := func(qStr string, rowsCountExpected uint64) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing query [%s]: %s", qStr, err)
+		}
+		qctx := NewQueryContext(t.Context(), &QueryStats{}, []TenantID{tenantID}, q, false, nil)
+
+		var rowsCount atomic.Uint64
+		err = sCrash.RunQuery(qctx, func(_ uint, db *DataBlock) {
+			rowsCount.Add(uint64(db.RowsCount()))
+		})
+		if err != nil {
+			t.Fatalf("unexpected error for query [%s]: %s", qStr, err)
+		}
+		if n := rowsCount.Load(); n != rowsCountExpected {
+			t.Fatalf("unexpected number of rows for query [%s]; got %d; want %d", qStr, n, rowsCountExpected)
+		}
+	}
+
+	f("*", 1000)
+	f(`{host="h1"}`, 333)
+	f(`"message 123"`, 1)
+
+	sCrash.MustClose()
+	fs.MustRemoveDir(crashPath)
+}
+
+func TestStorageWALCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	cfg := &StorageConfig{
+		Retention:     time.Duration(100 * 365 * nsecsPerDay),
+		EnableWAL:     true,
+		WALSyncPolicy: WALSyncPolicyNone,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	tenantID := TenantID{}
+	addRows := func() {
+		lr := GetLogRows(nil, nil, nil, nil, "")
+		lr.MustAdd(tenantID, time.Now().UnixNano(), []Field{
+			{Name: "_msg", Value: "foo"},
+		}, -1)
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+	}
+
+	walPath := filepath.Join(path, walDirname)
+	for i := 0; i < 5; i++ {
+		addRows()
+		s.mustCheckpointWAL()
+
+		// The current and the previous segments must be kept.
+		if idxs := mustGetWALSegmentIdxs(walPath); len(idxs) > 2 {
+			t.Fatalf("unexpected number of wal segments after checkpoint; got %d; want up to 2", len(idxs))
+		}
+	}
+	if n := s.wal.syncs.Load(); n != 0 {
+		t.Fatalf("unexpected number of wal syncs for %q policy; got %d; want 0", WALSyncPolicyNone, n)
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
@@ -0,0 +1,140 @@
+package wasmplugin
+
+// TestFunc is a function for the WebAssembly module created via NewTestModule.
+type TestFunc struct {
+	// Name is the name of the exported function.
+	Name string
+
+	// ArgsCount is the number of args for the function. Every arg is passed as (ptr: i32, len: i32) pair of params.
+	ArgsCount int
+
+	// Code is the function body in WebAssembly binary format without the trailing `end` opcode.
+	//
+	// The body must leave i64 result on the stack.
+	Code []byte
+}
+
+// TestAllocOffset is the offset of the buffer returned by vl_alloc function at the module created via NewTestModule.
+const TestAllocOffset = 32 * 1024
+
+// NewTestModule returns WebAssembly module with the given funcs for tests.
+//
+// The module exports a single 64KiB page of memory with the given data at zero offset,
+// and vl_alloc function, which returns TestAllocOffset for sizes up to 32KiB.
+func NewTestModule(data string, funcs ...TestFunc) []byte {
+	b := []byte("\x00asm\x01\x00\x00\x00")
+
+	// type section: type 0 is vl_alloc type, while the remaining types are for funcs.
+	var types [][]byte
+	types = append(types, []byte{0x60, 0x01, 0x7f, 0x01, 0x7f})
+	for _, f := range funcs {
+		t := []byte{0x60}
+		t = appendTestULEB128(t, uint64(2*f.ArgsCount))
+		for i := 0; i < 2*f.ArgsCount; i++ {
+			t = append(t, 0x7f)
+		}
+		t = append(t, 0x01, 0x7e)
+		types = append(types, t)
+	}
+	b = appendTestSection(b, 1, types)
+
+	// function section
+	var funcTypes [][]byte
+	for i := 0; i <= len(funcs); i++ {
+		funcTypes = append(funcTypes, appendTestULEB128(nil, uint64(i)))
+	}
+	b = appendTestSection(b, 3, funcTypes)
+
+	// memory section: a single page with the same maximum.
+	b = appendTestSection(b, 5, [][]byte{{0x01, 0x01, 0x01}})
+
+	// export section
+	var exports [][]byte
+	exports = append(exports, appendTestExport(nil, "memory", 0x02, 0))
+	exports = append(exports, appendTestExport(nil, "vl_alloc", 0x00, 0))
+	for i, f := range funcs {
+		exports = append(exports, appendTestExport(nil, f.Name, 0x00, uint64(i+1)))
+	}
+	b = appendTestSection(b, 7, exports)
+
+	// code section
+	var bodies [][]byte
+	allocBody := []byte{0x00}
+	// return size <= 32KiB ? TestAllocOffset : -1
+	allocBody = append(allocBody, 0x41)
+	allocBody = appendTestSLEB128(allocBody, TestAllocOffset)
+	allocBody = append(allocBody, 0x41, 0x7f, 0x20, 0x00, 0x41)
+	allocBody = appendTestSLEB128(allocBody, 32*1024)
+	allocBody = append(allocBody, 0x4d, 0x1b, 0x0b)
+	bodies = append(bodies, appendTestVec(nil, allocBody))
+	for _, f := range funcs {
+		body := []byte{0x00}
+		body = append(body, f.Code...)
+		body = append(body, 0x0b)
+		bodies = append(bodies, appendTestVec(nil, body))
+	}
+	b = appendTestSection(b, 10, bodies)
+
+	// data section
+	if data != "" {
+		seg := []byte{0x00, 0x41, 0x00, 0x0b}
+		seg = appendTestVec(seg, []byte(data))
+		b = appendTestSection(b, 11, [][]byte{seg})
+	}
+
+	return b
+}
+
+// NewTestFuncReturningData returns TestFunc with the given name and argsCount, which returns the first dataLen bytes of data passed to NewTestModule.
+func NewTestFuncReturningData(name string, argsCount, dataLen int) TestFunc {
+	code := []byte{0x42}
+	code = appendTestSLEB128(code, int64(dataLen))
+	return TestFunc{
+		Name:      name,
+		ArgsCount: argsCount,
+		Code:      code,
+	}
+}
+
+func appendTestSection(dst []byte, id byte, items [][]byte) []byte {
+	var content []byte
+	content = appendTestULEB128(content, uint64(len(items)))
+	for _, item := range items {
+		content = append(content, item...)
+	}
+	dst = append(dst, id)
+	return appendTestVec(dst, content)
+}
+
+func appendTestExport(dst []byte, name string, kind byte, idx uint64) []byte {
+	dst = appendTestVec(dst, []byte(name))
+	dst = append(dst, kind)
+	return appendTestULEB128(dst, idx)
+}
+
+func appendTestVec(dst, data []byte) []byte {
+	dst = appendTestULEB128(dst, uint64(len(data)))
+	return append(dst, data...)
+}
+
+func appendTestULEB128(dst []byte, n uint64) []byte {
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(dst, c)
+		}
+		dst = append(dst, c|0x80)
+	}
+}
+
+func appendTestSLEB128(dst []byte, n int64) []byte {
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if (n == 0 && c&0x40 == 0) || (n == -1 && c&0x40 != 0) {
+			return append(dst, c)
+		}
+		dst = append(dst, c|0x80)
+	}
+}
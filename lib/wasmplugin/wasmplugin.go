@@ -0,0 +1,276 @@
+// Package wasmplugin executes user-defined functions from WebAssembly modules in a sandbox.
+//
+// Modules have no access to the host file system, network or environment variables.
+// Every module must export the following items:
+//
+//   - `memory` - the linear memory used for passing data between the host and the module.
+//   - `vl_alloc(size: i32) -> i32` - the function, which must return a pointer to a buffer with the given size.
+//     The buffer must remain valid until the next vl_alloc call.
+//
+// Functions called via Module.Call must accept (ptr: i32, len: i32) pair per every arg
+// and must return i64 with the pointer to the result in the upper 32 bits and the result length in the lower 32 bits.
+// The result must remain valid until the next call to the module.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#webassembly-row-processors
+// and https://docs.victoriametrics.com/victorialogs/logsql/#webassembly-functions
+package wasmplugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// maxMemoryPages is the maximum number of 64KiB memory pages per every module instance.
+const maxMemoryPages = 1024
+
+// Module is a WebAssembly module loaded via Load.
+//
+// Module is safe for concurrent use by multiple goroutines.
+type Module struct {
+	path string
+
+	r  wazero.Runtime
+	cm wazero.CompiledModule
+
+	// ctx is canceled by MustClose, so the running calls are stopped.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// instances contains module instances, which are ready for the next call.
+	//
+	// Module instances cannot be used concurrently, so every concurrent call uses a distinct instance.
+	instancesLock sync.Mutex
+	instances     []*instance
+}
+
+type instance struct {
+	mod   api.Module
+	alloc api.Function
+	funcs map[string]api.Function
+
+	params []uint64
+}
+
+// Load loads the WebAssembly module from the given path.
+//
+// Call MustClose on the returned module when it is no longer needed.
+func Load(path string) (*Module, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read WebAssembly module: %w", err)
+	}
+	m, err := newModule(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load WebAssembly module from %q: %w", path, err)
+	}
+	return m, nil
+}
+
+func newModule(path string, data []byte) (*Module, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cfg := wazero.NewRuntimeConfig().WithMemoryLimitPages(maxMemoryPages).WithCloseOnContextDone(true)
+	r := wazero.NewRuntimeWithConfig(ctx, cfg)
+
+	// Modules built with WASI-targeting toolchains such as TinyGo or Rust wasm32-wasip1 import WASI functions.
+	// The host file system, network and environment variables aren't exposed to them.
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		_ = r.Close(ctx)
+		cancel()
+		return nil, fmt.Errorf("cannot initialize WASI: %w", err)
+	}
+
+	cm, err := r.CompileModule(ctx, data)
+	if err != nil {
+		_ = r.Close(ctx)
+		cancel()
+		return nil, fmt.Errorf("cannot compile module: %w", err)
+	}
+
+	m := &Module{
+		path:   path,
+		r:      r,
+		cm:     cm,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if _, ok := cm.ExportedMemories()["memory"]; !ok {
+		m.MustClose()
+		return nil, fmt.Errorf("the module must export `memory`")
+	}
+	if err := m.checkFunction("vl_alloc", []api.ValueType{api.ValueTypeI32}, []api.ValueType{api.ValueTypeI32}); err != nil {
+		m.MustClose()
+		return nil, err
+	}
+
+	// Verify the module can be instantiated.
+	inst, err := m.newInstance()
+	if err != nil {
+		m.MustClose()
+		return nil, err
+	}
+	m.putInstance(inst)
+
+	return m, nil
+}
+
+// Path returns the path the module was loaded from.
+func (m *Module) Path() string {
+	return m.path
+}
+
+// CheckFunction verifies whether the module exports the function with the given name, which can be called via Call with argsCount args.
+func (m *Module) CheckFunction(name string, argsCount int) error {
+	params := make([]api.ValueType, 2*argsCount)
+	for i := range params {
+		params[i] = api.ValueTypeI32
+	}
+	return m.checkFunction(name, params, []api.ValueType{api.ValueTypeI64})
+}
+
+func (m *Module) checkFunction(name string, params, results []api.ValueType) error {
+	fd, ok := m.cm.ExportedFunctions()[name]
+	if !ok {
+		return fmt.Errorf("the module must export `%s` function", name)
+	}
+	if !slices.Equal(fd.ParamTypes(), params) || !slices.Equal(fd.ResultTypes(), results) {
+		return fmt.Errorf("unexpected signature for `%s` function; got (%s) -> (%s); want (%s) -> (%s)", name,
+			valueTypesString(fd.ParamTypes()), valueTypesString(fd.ResultTypes()), valueTypesString(params), valueTypesString(results))
+	}
+	return nil
+}
+
+// Call calls the function with the given name with the given args, appends the result to dst and returns it.
+//
+// The function must be verified via CheckFunction before the call.
+func (m *Module) Call(dst []byte, name string, args ...[]byte) ([]byte, error) {
+	inst, err := m.getInstance()
+	if err != nil {
+		return dst, err
+	}
+	dst, err = inst.call(m.ctx, dst, name, args)
+	if err != nil {
+		// The instance may be left in inconsistent state after the failed call, so drop it.
+		_ = inst.mod.Close(m.ctx)
+		return dst, fmt.Errorf("cannot call `%s` function from WebAssembly module %q: %w", name, m.path, err)
+	}
+	m.putInstance(inst)
+	return dst, nil
+}
+
+// MustClose releases resources occupied by m.
+//
+// The running calls are stopped with an error.
+func (m *Module) MustClose() {
+	m.cancel()
+	_ = m.r.Close(context.Background())
+
+	m.instancesLock.Lock()
+	m.instances = nil
+	m.instancesLock.Unlock()
+}
+
+func (m *Module) getInstance() (*instance, error) {
+	m.instancesLock.Lock()
+	if n := len(m.instances); n > 0 {
+		inst := m.instances[n-1]
+		m.instances[n-1] = nil
+		m.instances = m.instances[:n-1]
+		m.instancesLock.Unlock()
+		return inst, nil
+	}
+	m.instancesLock.Unlock()
+
+	return m.newInstance()
+}
+
+func (m *Module) putInstance(inst *instance) {
+	m.instancesLock.Lock()
+	m.instances = append(m.instances, inst)
+	m.instancesLock.Unlock()
+}
+
+func (m *Module) newInstance() (*instance, error) {
+	// Do not call _start function, since it may exit the module. Call _initialize function instead if it is exported by the module.
+	// See https://github.com/WebAssembly/WASI/blob/main/legacy/application-abi.md
+	cfg := wazero.NewModuleConfig().WithName("").WithStartFunctions()
+	mod, err := m.r.InstantiateModule(m.ctx, m.cm, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("cannot instantiate WebAssembly module %q: %w", m.path, err)
+	}
+	if fn := mod.ExportedFunction("_initialize"); fn != nil {
+		if _, err := fn.Call(m.ctx); err != nil {
+			_ = mod.Close(m.ctx)
+			return nil, fmt.Errorf("cannot initialize WebAssembly module %q: %w", m.path, err)
+		}
+	}
+	inst := &instance{
+		mod:   mod,
+		alloc: mod.ExportedFunction("vl_alloc"),
+		funcs: make(map[string]api.Function),
+	}
+	return inst, nil
+}
+
+func (inst *instance) call(ctx context.Context, dst []byte, name string, args [][]byte) ([]byte, error) {
+	fn := inst.funcs[name]
+	if fn == nil {
+		fn = inst.mod.ExportedFunction(name)
+		if fn == nil {
+			return dst, fmt.Errorf("missing function")
+		}
+		inst.funcs[name] = fn
+	}
+
+	// Write all the args into a single buffer, so the module needs to keep only a single allocated buffer.
+	size := 0
+	for _, arg := range args {
+		size += len(arg)
+	}
+	if uint64(size) > 1<<32-1 {
+		return dst, fmt.Errorf("too big args size: %d bytes", size)
+	}
+	results, err := inst.alloc.Call(ctx, uint64(size))
+	if err != nil {
+		return dst, fmt.Errorf("cannot allocate %d bytes for args: %w", size, err)
+	}
+	mem := inst.mod.Memory()
+	ptr := uint32(results[0])
+	params := inst.params[:0]
+	for _, arg := range args {
+		if !mem.Write(ptr, arg) {
+			return dst, fmt.Errorf("vl_alloc returned invalid pointer %d for %d bytes; memory size: %d bytes", uint32(results[0]), size, mem.Size())
+		}
+		params = append(params, uint64(ptr), uint64(len(arg)))
+		ptr += uint32(len(arg))
+	}
+	inst.params = params
+
+	results, err = fn.Call(ctx, params...)
+	if err != nil {
+		return dst, err
+	}
+	resultPtr := uint32(results[0] >> 32)
+	resultLen := uint32(results[0])
+	result, ok := mem.Read(resultPtr, resultLen)
+	if !ok {
+		return dst, fmt.Errorf("the function returned invalid result with ptr=%d and len=%d; memory size: %d bytes", resultPtr, resultLen, mem.Size())
+	}
+	return append(dst, result...), nil
+}
+
+func valueTypesString(vts []api.ValueType) string {
+	a := make([]string, len(vts))
+	for i, vt := range vts {
+		a[i] = api.ValueTypeName(vt)
+	}
+	return strings.Join(a, ", ")
+}
@@ -0,0 +1,174 @@
+package wasmplugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLoadFailure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		m, err := newModule("test.wasm", data)
+		if err == nil {
+			m.MustClose()
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid module
+	f(nil)
+	f([]byte("foobar"))
+
+	// valid module without memory and vl_alloc exports
+	f([]byte("\x00asm\x01\x00\x00\x00"))
+
+	// missing file
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.wasm")); err == nil {
+		t.Fatalf("expecting non-nil error for missing file")
+	}
+}
+
+func TestModuleCheckFunction(t *testing.T) {
+	data := NewTestModule("foo", NewTestFuncReturningData("one_arg", 1, 3), NewTestFuncReturningData("two_args", 2, 3))
+	m, err := newModule("test.wasm", data)
+	if err != nil {
+		t.Fatalf("cannot load module: %s", err)
+	}
+	defer m.MustClose()
+
+	f := func(name string, argsCount int, resultExpected bool) {
+		t.Helper()
+
+		err := m.CheckFunction(name, argsCount)
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for CheckFunction(%q, %d); got %v; want %v; error: %v", name, argsCount, result, resultExpected, err)
+		}
+	}
+
+	f("one_arg", 1, true)
+	f("two_args", 2, true)
+
+	// invalid number of args
+	f("one_arg", 0, false)
+	f("one_arg", 2, false)
+
+	// missing function
+	f("missing", 1, false)
+
+	// invalid signature
+	f("vl_alloc", 0, false)
+}
+
+func TestModuleCall(t *testing.T) {
+	// echo_second_arg returns the second arg as is.
+	echoSecondArg := TestFunc{
+		Name:      "echo_second_arg",
+		ArgsCount: 2,
+		Code: []byte{
+			// ptr << 32
+			0x20, 0x02, // local.get 2
+			0xad,       // i64.extend_i32_u
+			0x42, 0x20, // i64.const 32
+			0x86, // i64.shl
+
+			// | len
+			0x20, 0x03, // local.get 3
+			0xad, // i64.extend_i32_u
+			0x84, // i64.or
+		},
+	}
+	invalidResult := TestFunc{
+		Name:      "invalid_result",
+		ArgsCount: 0,
+		Code: []byte{
+			0x42, 0x7f, // i64.const -1
+		},
+	}
+	data := NewTestModule("foobar", NewTestFuncReturningData("get_data", 1, 6), echoSecondArg, invalidResult)
+
+	path := filepath.Join(t.TempDir(), "test.wasm")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("cannot write module: %s", err)
+	}
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("cannot load module: %s", err)
+	}
+	defer m.MustClose()
+
+	if m.Path() != path {
+		t.Fatalf("unexpected path; got %q; want %q", m.Path(), path)
+	}
+
+	f := func(name string, args []string, resultExpected string) {
+		t.Helper()
+
+		a := make([][]byte, len(args))
+		for i, arg := range args {
+			a[i] = []byte(arg)
+		}
+		result, err := m.Call([]byte("prefix:"), name, a...)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(result) != "prefix:"+resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, "prefix:"+resultExpected)
+		}
+	}
+
+	f("get_data", []string{"abc"}, "foobar")
+	f("echo_second_arg", []string{"abc", "de"}, "de")
+	f("echo_second_arg", []string{"", "de"}, "de")
+	f("echo_second_arg", []string{"abc", ""}, "")
+
+	fError := func(name string, args ...[]byte) {
+		t.Helper()
+
+		if _, err := m.Call(nil, name, args...); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// missing function
+	fError("missing")
+
+	// the function returns invalid result
+	fError("invalid_result")
+
+	// vl_alloc returns invalid pointer for too big args
+	fError("get_data", make([]byte, 64*1024))
+
+	// The module must remain usable after errors.
+	f("echo_second_arg", []string{"abc", "de"}, "de")
+
+	// concurrent calls
+	var wg sync.WaitGroup
+	errCh := make(chan error, 10)
+	for i := 0; i < cap(errCh); i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			arg := fmt.Sprintf("arg_%d", n)
+			for j := 0; j < 100; j++ {
+				result, err := m.Call(nil, "echo_second_arg", []byte("x"), []byte(arg))
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if string(result) != arg {
+					errCh <- fmt.Errorf("unexpected result; got %q; want %q", result, arg)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatalf("unexpected error in concurrent calls: %s", err)
+	}
+}